@@ -1,6 +1,6 @@
 package cmd
 
-var supportedCmds = "{server}"
+var supportedCmds = "{server|loadtest}"
 
 var helpBase = `
   global-query ` + supportedCmds + `
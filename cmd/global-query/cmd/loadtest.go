@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/conf"
+	"github.com/els0r/goProbe/pkg/api/client"
+	"github.com/els0r/goProbe/pkg/api/loadtest"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// loadTestCmd represents the loadtest command
+var loadTestCmd = &cobra.Command{
+	Use:   "loadtest",
+	Short: "Run a load test against a goProbe / global-query API",
+	Long: `Run a load test against a goProbe / global-query API
+
+Issues a mix of synthetic queries against the query API of a goProbe host or a
+global-query server (and thereby the hosts behind it) and reports latency
+percentiles and error rates per query. Queries rejected by rate limiting are
+reported separately and are not retried.
+
+The query mix is read from a YAML file (list of queries with name, weight and
+query args). If none is provided, a default mix of typical interactive queries
+on the interfaces / hosts provided via --loadtest.ifaces / --loadtest.hosts
+is used.
+`,
+	RunE: loadTestEntrypoint,
+}
+
+func init() {
+	rootCmd.AddCommand(loadTestCmd)
+
+	pflags := loadTestCmd.PersistentFlags()
+
+	pflags.String(conf.LoadTestTarget, conf.DefaultServerAddr, "address of the goProbe / global-query API to run the load test against")
+	pflags.String(conf.LoadTestAPIKey, "", "API key presented to the target API (if it requires authentication)")
+	pflags.String(conf.LoadTestMix, "", "YAML file defining the mix of queries to issue (a default mix is used if empty)")
+	pflags.String(conf.LoadTestIfaces, conf.DefaultLoadTestIfaces, "interfaces queried by the default query mix")
+	pflags.String(conf.LoadTestHosts, "", "hosts queried by the default query mix (required if the target is a global-query server)")
+	pflags.Int(conf.LoadTestConcurrency, conf.DefaultLoadTestConcurrency, "maximum number of queries in flight")
+	pflags.Float64(conf.LoadTestRate, 0, "number of queries issued per second (0 = as fast as the concurrency allows)")
+	pflags.Duration(conf.LoadTestDuration, conf.DefaultLoadTestDuration, "duration during which queries are issued (0 = until the number of requests was issued)")
+	pflags.Int(conf.LoadTestRequests, 0, "total number of queries to issue (0 = until the duration has passed)")
+	pflags.Duration(conf.LoadTestTimeout, conf.DefaultLoadTestTimeout, "timeout of each query (0 = none)")
+	pflags.String(conf.LoadTestFormat, types.FormatTXT, "output format of the report (txt, json)")
+	pflags.Float64(conf.LoadTestMaxErrorRate, 1, "maximum share of failed / rate limited queries (0-1), exceeding it causes a non-zero exit code")
+
+	_ = viper.BindPFlags(pflags)
+}
+
+func loadTestEntrypoint(cmd *cobra.Command, _ []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	format := viper.GetString(conf.LoadTestFormat)
+	if format != types.FormatTXT && format != types.FormatJSON {
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+
+	mix := loadtest.DefaultMix(viper.GetString(conf.LoadTestIfaces), viper.GetString(conf.LoadTestHosts))
+	if mixFile := viper.GetString(conf.LoadTestMix); mixFile != "" {
+		data, err := os.ReadFile(mixFile)
+		if err != nil {
+			return fmt.Errorf("failed to read query mix: %w", err)
+		}
+		mix = nil
+		if err := yaml.Unmarshal(data, &mix); err != nil {
+			return fmt.Errorf("failed to parse query mix: %w", err)
+		}
+	}
+
+	runner := loadtest.NewClient(viper.GetString(conf.LoadTestTarget),
+		client.WithAPIKey(viper.GetString(conf.LoadTestAPIKey)),
+	)
+
+	// from here on, errors are caused by the load test itself and not by its usage
+	cmd.SilenceUsage = true
+
+	report, err := loadtest.Run(ctx, runner, loadtest.Config{
+		Mix:         mix,
+		Concurrency: viper.GetInt(conf.LoadTestConcurrency),
+		Rate:        viper.GetFloat64(conf.LoadTestRate),
+		Duration:    viper.GetDuration(conf.LoadTestDuration),
+		Requests:    viper.GetInt(conf.LoadTestRequests),
+		Timeout:     viper.GetDuration(conf.LoadTestTimeout),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to run load test: %w", err)
+	}
+
+	if format == types.FormatJSON {
+		err = jsoniter.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		err = report.Print(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if maxErrorRate := viper.GetFloat64(conf.LoadTestMaxErrorRate); report.Total.ErrorRate() > maxErrorRate {
+		return fmt.Errorf("error rate of %.2f%% exceeds the maximum of %.2f%%", 100*report.Total.ErrorRate(), 100*maxErrorRate)
+	}
+	return nil
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/els0r/telemetry/tracing"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	_ "github.com/els0r/goProbe/plugins/attribute" // Include custom attributes (if any, see plugins/attribute)
 )
 
 var cfgFile string
@@ -9,6 +9,8 @@ import (
 	"syscall"
 
 	"github.com/els0r/goProbe/cmd/global-query/pkg/conf"
+	"github.com/els0r/goProbe/cmd/global-query/pkg/distributed"
+	"github.com/els0r/goProbe/pkg/api"
 	gqserver "github.com/els0r/goProbe/pkg/api/globalquery/server"
 	"github.com/els0r/goProbe/pkg/api/server"
 	"github.com/els0r/goProbe/plugins"
@@ -35,6 +37,20 @@ func init() {
 
 	pflags.String(conf.ServerAddr, conf.DefaultServerAddr, "address to which the server binds")
 	pflags.Duration(conf.ServerShutdownGracePeriod, conf.DefaultServerShutdownGracePeriod, "duration the server will wait during shutdown before forcing shutdown")
+	pflags.Duration(conf.ServerQueryDeadline, 0, "default deadline for queries not specifying one, after which partial results are returned (0 = no deadline)")
+
+	pflags.Duration(conf.QuerierClockSkewThreshold, conf.DefaultClockSkewThreshold, "clock skew of a queried host beyond which a warning is added to its status (0 = disabled)")
+	pflags.Int(conf.QuerierTopNOverfetch, distributed.DefaultTopNOverfetch, "factor by which the number of rows requested from each host exceeds the number of rows of top-N queries")
+	pflags.Bool(conf.QuerierTopNRefine, true, "request rows possibly ranking among the top rows of top-N queries from the hosts which omitted them in a second pass")
+
+	pflags.String(conf.CheckpointsDir, "", "directory to checkpoint the per-host results of queries to, allowing to resume them after a restart and to re-attach to them by ID (disabled if empty)")
+	pflags.Duration(conf.CheckpointsRetention, conf.DefaultCheckpointsRetention, "duration for which query checkpoints are retained after the query completed")
+
+	pflags.String(conf.StoredResultsDir, "", "directory to store the results of queries run in the background to, allowing clients to retrieve them later on via a token (disabled if empty)")
+	pflags.Duration(conf.StoredResultsRetention, api.DefaultStoredResultsRetention, "duration for which stored query results are retained after the query completed")
+
+	pflags.Duration(conf.CacheTTL, 0, "duration for which the results of completed queries are cached, unless any of the hosts involved reports a newer writeout (0 = disabled)")
+	pflags.Int(conf.CacheMaxEntries, conf.DefaultCacheMaxEntries, "maximum number of cached query results (0 = unlimited)")
 
 	pflags.String(conf.OpenAPISpecOutfile, "", "write OpenAPI 3.0.3 spec to output file and exit")
 
@@ -53,7 +69,7 @@ func serverEntrypoint(cmd *cobra.Command, args []string) error {
 	// print OpenAPI spec and exit if output file is provided
 	openAPIfile := viper.GetString(conf.OpenAPISpecOutfile)
 	if openAPIfile != "" {
-		return server.GenerateSpec(ctx, openAPIfile, gqserver.New("127.0.0.1:8146", nil, nil))
+		return server.GenerateSpec(ctx, openAPIfile, gqserver.New("127.0.0.1:8146", nil, nil, nil))
 	}
 
 	shutdownTracing, err := tracing.InitFromFlags(ctx)
@@ -77,16 +93,53 @@ func serverEntrypoint(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// set up the API server
-	addr := viper.GetString(conf.ServerAddr)
-	apiServer := gqserver.New(addr, hostListResolver, querier,
+	queryOpts := []distributed.QueryOption{
+		distributed.WithClockSkewThreshold(viper.GetDuration(conf.QuerierClockSkewThreshold)),
+		distributed.WithTopN(viper.GetInt(conf.QuerierTopNOverfetch), viper.GetBool(conf.QuerierTopNRefine)),
+	}
+
+	// set up query checkpointing (if enabled)
+	if dir := viper.GetString(conf.CheckpointsDir); dir != "" {
+		checkpoints, err := distributed.NewCheckpointStore(dir, viper.GetDuration(conf.CheckpointsRetention))
+		if err != nil {
+			logger.Errorf("failed to set up query checkpointing: %v", err)
+			return err
+		}
+		go checkpoints.RunCleanup(ctx, conf.DefaultCheckpointsCleanupInterval)
+
+		queryOpts = append(queryOpts, distributed.WithCheckpoints(checkpoints))
+	}
+
+	// set up query result caching (if enabled)
+	if ttl := viper.GetDuration(conf.CacheTTL); ttl > 0 {
+		queryOpts = append(queryOpts, distributed.WithResultCache(distributed.NewResultCache(ttl, viper.GetInt(conf.CacheMaxEntries))))
+	}
+
+	serverOpts := []server.Option{
 		// Set the release mode of GIN depending on the log level
 		server.WithDebugMode(
 			logging.LevelFromString(viper.GetString(conf.LogLevel)) == logging.LevelDebug,
 		),
 		server.WithProfiling(viper.GetBool(conf.ProfilingEnabled)),
 		server.WithTracing(viper.GetBool(tracing.TracingEnabledArg)),
-	)
+		server.WithQueryDeadline(viper.GetDuration(conf.ServerQueryDeadline)),
+	}
+
+	// set up storage of the results of queries run in the background (if enabled)
+	if dir := viper.GetString(conf.StoredResultsDir); dir != "" {
+		resultStore, err := api.NewResultStore(dir, viper.GetDuration(conf.StoredResultsRetention))
+		if err != nil {
+			logger.Errorf("failed to set up query result storage: %v", err)
+			return err
+		}
+		go resultStore.RunCleanup(ctx, api.DefaultStoredResultsCleanupInterval)
+
+		serverOpts = append(serverOpts, server.WithQueryResultStore(resultStore))
+	}
+
+	// set up the API server
+	addr := viper.GetString(conf.ServerAddr)
+	apiServer := gqserver.New(addr, hostListResolver, querier, queryOpts, serverOpts...)
 
 	// initializing the server in a goroutine so that it won't block the graceful
 	// shutdown handling below
@@ -98,6 +151,11 @@ func serverEntrypoint(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
+	// resume all queries interrupted by a previous shutdown / crash
+	if err := apiServer.ResumeQueries(ctx); err != nil {
+		logger.With("error", err).Error("failed to resume checkpointed queries")
+	}
+
 	// listen for the interrupt signal
 	<-ctx.Done()
 
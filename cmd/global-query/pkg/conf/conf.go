@@ -27,9 +27,41 @@ const (
 	QuerierConfig        = querierKey + ".config"
 	QuerierMaxConcurrent = querierKey + ".max_concurrent"
 
+	QuerierClockSkewThreshold = querierKey + ".clock_skew_threshold"
+
+	QuerierTopNOverfetch = querierKey + ".topn_overfetch"
+	QuerierTopNRefine    = querierKey + ".topn_refine"
+
 	serverKey                 = "server"
 	ServerAddr                = serverKey + ".addr"
 	ServerShutdownGracePeriod = serverKey + ".shutdowngraceperiod"
+	ServerQueryDeadline       = serverKey + ".query_deadline"
+
+	checkpointsKey       = "checkpoints"
+	CheckpointsDir       = checkpointsKey + ".dir"
+	CheckpointsRetention = checkpointsKey + ".retention"
+
+	storedResultsKey       = "stored_results"
+	StoredResultsDir       = storedResultsKey + ".dir"
+	StoredResultsRetention = storedResultsKey + ".retention"
+
+	cacheKey        = "cache"
+	CacheTTL        = cacheKey + ".ttl"
+	CacheMaxEntries = cacheKey + ".max_entries"
+
+	loadTestKey          = "loadtest"
+	LoadTestTarget       = loadTestKey + ".target"
+	LoadTestAPIKey       = loadTestKey + ".api_key"
+	LoadTestMix          = loadTestKey + ".mix"
+	LoadTestIfaces       = loadTestKey + ".ifaces"
+	LoadTestHosts        = loadTestKey + ".hosts"
+	LoadTestConcurrency  = loadTestKey + ".concurrency"
+	LoadTestRate         = loadTestKey + ".rate"
+	LoadTestDuration     = loadTestKey + ".duration"
+	LoadTestRequests     = loadTestKey + ".requests"
+	LoadTestTimeout      = loadTestKey + ".timeout"
+	LoadTestFormat       = loadTestKey + ".format"
+	LoadTestMaxErrorRate = loadTestKey + ".max_error_rate"
 
 	openapiKey         = "openapi"
 	OpenAPISpecOutfile = openapiKey + ".spec-outfile"
@@ -44,6 +76,18 @@ const (
 
 	DefaultHostsQuerierType = "api"
 
+	DefaultClockSkewThreshold = 5 * time.Second
+
 	DefaultServerAddr                = "localhost:8145"
 	DefaultServerShutdownGracePeriod = 30 * time.Second
+
+	DefaultCheckpointsRetention       = 24 * time.Hour
+	DefaultCheckpointsCleanupInterval = time.Hour
+
+	DefaultCacheMaxEntries = 1000
+
+	DefaultLoadTestIfaces      = "any"
+	DefaultLoadTestConcurrency = 4
+	DefaultLoadTestDuration    = time.Minute
+	DefaultLoadTestTimeout     = time.Minute
 )
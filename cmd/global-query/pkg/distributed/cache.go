@@ -0,0 +1,223 @@
+package distributed
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ResultCache caches the results of completed distributed queries, absorbing bursts of identical
+// queries (e.g. dashboards being refreshed by many users at once) which would otherwise hit every
+// queried host. Identical queries issued while one of them is running wait for its result instead of
+// being run concurrently.
+//
+// The time range of a query is keyed by the writeout interval it covers, so a relative time range
+// (e.g. the last hour) maps to a new key as soon as the next writeout is due. In addition, a cached
+// result is served until its TTL has passed or any of the hosts involved reports a newer writeout (as
+// part of the result of any other query) than it did for the cached result. Results of live queries and
+// results which are incomplete (e.g. due to failed hosts or a deadline) are not cached
+type ResultCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	entries   map[cacheKey]*cacheEntry
+	pending   map[cacheKey]chan struct{} // queries currently being run, closed once done
+	writeouts map[string]time.Time       // newest writeout reported by each host
+
+	sync.Mutex
+}
+
+// cacheKey identifies a distributed query by its arguments, the set of hosts queried and its time range
+// (aligned to the writeout interval)
+type cacheKey struct {
+	args        string
+	hosts       string
+	first, last int64
+}
+
+type cacheEntry struct {
+	result    *results.Result
+	writeouts map[string]time.Time // writeouts reported by the hosts involved in the result
+	expires   time.Time
+}
+
+// NewResultCache creates a new result cache retaining results for ttl. If more than maxEntries results
+// are cached, the results closest to expiry are evicted first (unbounded if zero)
+func NewResultCache(ttl time.Duration, maxEntries int) *ResultCache {
+	return &ResultCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[cacheKey]*cacheEntry),
+		pending:    make(map[cacheKey]chan struct{}),
+		writeouts:  make(map[string]time.Time),
+	}
+}
+
+// newCacheKey creates the key of a query. The query hosts are replaced by the (resolved) host list and
+// fields not affecting the result are omitted. The time range is resolved from the statement, with its
+// bounds aligned to the writeout interval: all data is stored in blocks at the writeout timestamps, so
+// any two ranges covering the same blocks yield the same result
+func newCacheKey(args *query.Args, stmt *query.Statement, hostList hosts.Hosts) (cacheKey, error) {
+	keyArgs := *args
+	keyArgs.QueryHosts, keyArgs.Caller = "", ""
+	keyArgs.First, keyArgs.Last = "", ""
+
+	b, err := jsoniter.Marshal(&keyArgs)
+	if err != nil {
+		return cacheKey{}, err
+	}
+
+	sortedHosts := slices.Clone(hostList)
+	slices.Sort(sortedHosts)
+
+	return cacheKey{
+		args:  string(b),
+		hosts: strings.Join(slices.Compact(sortedHosts), ","),
+		first: alignUp(stmt.First, goDB.DBWriteInterval),
+		last:  alignDown(stmt.Last, goDB.DBWriteInterval),
+	}, nil
+}
+
+func alignUp(ts, interval int64) int64 {
+	return alignDown(ts+interval-1, interval)
+}
+
+func alignDown(ts, interval int64) int64 {
+	return ts - ((ts%interval)+interval)%interval
+}
+
+// acquire returns the cached result for key (if any). Otherwise, it waits for an identical query
+// currently being run. If none is running (or its result could not be cached), the caller is
+// registered as running the query and must call release once done
+func (c *ResultCache) acquire(ctx context.Context, key cacheKey) (*results.Result, bool, error) {
+	for {
+		c.Lock()
+		if entry, exists := c.entries[key]; exists {
+			if time.Now().Before(entry.expires) {
+				c.Unlock()
+				// the result is modified by the caller (e.g. when rendering it)
+				return entry.result.Clone(), true, nil
+			}
+			delete(c.entries, key)
+		}
+
+		running, isRunning := c.pending[key]
+		if !isRunning {
+			c.pending[key] = make(chan struct{})
+			c.Unlock()
+			return nil, false, nil
+		}
+		c.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-running:
+		}
+	}
+}
+
+// release records the writeouts reported by the hosts of res (invalidating all outdated results) and
+// caches res if it is complete. Any queries waiting for the result are woken up
+func (c *ResultCache) release(key cacheKey, res *results.Result, complete bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if running, isRunning := c.pending[key]; isRunning {
+		close(running)
+		delete(c.pending, key)
+	}
+	if res == nil {
+		return
+	}
+
+	writeouts := c.observe(res)
+	if !complete || !isComplete(res) {
+		return
+	}
+
+	// a host may have written out while the query was running (having been reported by another query)
+	for host, writeout := range writeouts {
+		if writeout.Before(c.writeouts[host]) {
+			return
+		}
+	}
+
+	now := time.Now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict(len(c.entries) - c.maxEntries + 1)
+	}
+
+	c.entries[key] = &cacheEntry{
+		result:    res.Clone(),
+		writeouts: writeouts,
+		expires:   now.Add(c.ttl),
+	}
+}
+
+// observe updates the newest writeout of all hosts reporting one in res and drops all cached results
+// involving hosts which reported a newer writeout. It returns the writeouts reported in res
+func (c *ResultCache) observe(res *results.Result) map[string]time.Time {
+	writeouts := make(map[string]time.Time, len(res.HostsStatuses))
+	for host, status := range res.HostsStatuses {
+		if status.LastWriteout == nil {
+			writeouts[host] = time.Time{}
+			continue
+		}
+		writeout := *status.LastWriteout
+		writeouts[host] = writeout
+
+		if !writeout.After(c.writeouts[host]) {
+			continue
+		}
+		c.writeouts[host] = writeout
+
+		for key, entry := range c.entries {
+			if cached, involved := entry.writeouts[host]; involved && cached.Before(writeout) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	return writeouts
+}
+
+// evict drops the n results closest to expiry
+func (c *ResultCache) evict(n int) {
+	keys := make([]cacheKey, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b cacheKey) int {
+		return c.entries[a].expires.Compare(c.entries[b].expires)
+	})
+	for _, key := range keys[:min(n, len(keys))] {
+		delete(c.entries, key)
+	}
+}
+
+// isComplete checks if the result covers all hosts and was not truncated
+func isComplete(res *results.Result) bool {
+	if res.Summary.TruncatedByDeadline {
+		return false
+	}
+	for _, status := range res.HostsStatuses {
+		if status.Code == types.StatusError {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package distributed
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheArgs(queryHosts string, opts ...query.Option) *query.Args {
+	a := query.NewArgs("sip", "eth0", append([]query.Option{query.WithFormat(types.FormatJSON), query.WithLast("-1h")}, opts...)...)
+	a.QueryHosts = queryHosts
+	return a
+}
+
+func TestResultCache(t *testing.T) {
+	writeout := time.Now().Add(-time.Minute).Truncate(time.Second)
+	querier := &mockQuerier{
+		writeouts: map[string]time.Time{"hostA": writeout, "hostB": writeout},
+		failing:   map[string]struct{}{"hostC": {}},
+	}
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithResultCache(NewResultCache(time.Hour, 0)))
+
+	run := func(args *query.Args) {
+		t.Helper()
+		res, err := qr.Run(context.Background(), args)
+		require.Nil(t, err)
+		require.NotEmpty(t, res.Rows)
+	}
+	requireQueried := func(expected ...string) {
+		t.Helper()
+		require.Equal(t, hosts.Hosts(expected), querier.queried)
+		querier.queried = nil
+	}
+
+	// identical queries (irrespective of the order of hosts / the caller) are served from the cache
+	run(newCacheArgs("hostA,hostB"))
+	run(newCacheArgs("hostB,hostA"))
+	run(newCacheArgs("hostA,hostB", query.WithCaller("dashboard")))
+	requireQueried("hostA", "hostB")
+
+	// different host sets, arguments and time ranges are cached separately
+	run(newCacheArgs("hostA"))
+	run(newCacheArgs("hostA,hostB", query.WithCondition("dport = 443")))
+	run(newCacheArgs("hostA,hostB", query.WithLast("-2h")))
+	requireQueried("hostA", "hostA", "hostB", "hostA", "hostB")
+
+	// a newer writeout reported by any involved host invalidates the cached results
+	querier.writeouts["hostA"] = writeout.Add(5 * time.Minute)
+	run(newCacheArgs("hostA", query.WithCondition("proto = tcp")))
+	run(newCacheArgs("hostA,hostB"))
+	run(newCacheArgs("hostA,hostB"))
+	requireQueried("hostA", "hostA", "hostB")
+
+	// results of live queries and incomplete results are never cached
+	liveArgs := newCacheArgs("hostA")
+	liveArgs.Live, liveArgs.Last = true, ""
+	liveArgs.SetDefaults()
+	run(liveArgs)
+	run(liveArgs)
+	run(newCacheArgs("hostA,hostC"))
+	run(newCacheArgs("hostA,hostC"))
+	requireQueried("hostA", "hostA", "hostA", "hostC", "hostA", "hostC")
+}
+
+func TestCacheKey(t *testing.T) {
+	key := func(first, last string) cacheKey {
+		t.Helper()
+		args := newCacheArgs("hostA", query.WithFirst(first), query.WithLast(last))
+		stmt, err := args.Prepare()
+		require.Nil(t, err)
+		k, err := newCacheKey(args, stmt, hosts.Hosts{"hostA"})
+		require.Nil(t, err)
+		return k
+	}
+
+	// ranges covering the same writeout blocks share a key, irrespective of how they are specified
+	require.Equal(t, key("1700000100", "1700000400"), key("1700000001", "1700000599"))
+	require.Equal(t, key("1700000100", "1700000400"), key("2023-11-14T22:15:00Z", "2023-11-14T22:20:00Z"))
+
+	// ranges including an additional block do not
+	require.NotEqual(t, key("1700000100", "1700000400"), key("1699999800", "1700000400"))
+	require.NotEqual(t, key("1700000100", "1700000400"), key("1700000100", "1700000700"))
+}
+
+func TestResultCacheClone(t *testing.T) {
+	qr := NewQueryRunner(hosts.NewStringResolver(true), &mockQuerier{}, WithResultCache(NewResultCache(time.Hour, 0)))
+
+	// modifications of the returned results (e.g. when rendering them) don't affect the cached one
+	for i := 0; i < 3; i++ {
+		res, err := qr.Run(context.Background(), newCacheArgs("hostA,hostB"))
+		require.Nil(t, err)
+		require.Len(t, res.Rows, 2)
+		require.Len(t, res.HostsStatuses, 2)
+
+		res.Rows = res.Rows[:1]
+		res.Rows[0].Counters.BytesRcvd = 0
+		delete(res.HostsStatuses, "hostA")
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	querier := &mockQuerier{}
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithResultCache(NewResultCache(50*time.Millisecond, 1)))
+
+	for _, queryHosts := range []string{"hostA", "hostA", "hostB", "hostA"} {
+		_, err := qr.Run(context.Background(), newCacheArgs(queryHosts))
+		require.Nil(t, err)
+	}
+	// hostA was evicted since at most one result is cached
+	require.Equal(t, hosts.Hosts{"hostA", "hostB", "hostA"}, querier.queried)
+	querier.queried = nil
+
+	time.Sleep(100 * time.Millisecond)
+	_, err := qr.Run(context.Background(), newCacheArgs("hostA"))
+	require.Nil(t, err)
+	require.Equal(t, hosts.Hosts{"hostA"}, querier.queried)
+}
+
+func TestResultCacheConcurrent(t *testing.T) {
+	querier := &mockQuerier{block: make(chan struct{})}
+	cache := NewResultCache(time.Hour, 0)
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithResultCache(cache))
+
+	requireRunning := func() {
+		require.Eventually(t, func() bool {
+			cache.Lock()
+			defer cache.Unlock()
+			return len(cache.pending) == 1
+		}, time.Second, time.Millisecond)
+	}
+
+	// identical queries issued while one of them is running wait for its result
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := qr.Run(context.Background(), newCacheArgs("hostA,hostB"))
+			require.Nil(t, err)
+			require.Len(t, res.Rows, 2)
+		}()
+	}
+	requireRunning()
+	time.Sleep(50 * time.Millisecond)
+	close(querier.block)
+	wg.Wait()
+
+	require.Equal(t, hosts.Hosts{"hostA", "hostB"}, querier.queried)
+
+	// a waiting query can still be cancelled
+	querier.block = make(chan struct{})
+	go func() {
+		_, _ = qr.Run(context.Background(), newCacheArgs("hostC"))
+	}()
+	requireRunning()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := qr.Run(ctx, newCacheArgs("hostC"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	close(querier.block)
+}
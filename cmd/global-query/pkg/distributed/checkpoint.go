@@ -0,0 +1,379 @@
+package distributed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/telemetry/logging"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	checkpointQueryFile  = "query.json"
+	checkpointResultFile = "result.json"
+	checkpointHostsDir   = "hosts"
+
+	checkpointIDLen          = 16
+	checkpointPermissions    = 0o600
+	checkpointDirPermissions = 0o700
+)
+
+// ErrCheckpointNotFound denotes that no checkpoint exists for a query ID
+var ErrCheckpointNotFound = errors.New("query checkpoint not found")
+
+// Checkpoint denotes the state of a checkpointed query
+type Checkpoint struct {
+	// ID: the ID of the query
+	ID string `json:"id" doc:"ID of the query" example:"5f0c6e2a9d7b4c1e8a3f2b6d9e0c4a7b"`
+	// Done: whether the query has completed
+	Done bool `json:"done" doc:"Whether the query has completed" example:"false"`
+	// Started: the time when the query was started
+	Started time.Time `json:"started" doc:"Time when the query was started" example:"2024-04-12T09:45:00+02:00"`
+	// Hosts: the number of hosts queried
+	Hosts int `json:"hosts" doc:"Number of hosts queried" example:"250"`
+	// HostsDone: the number of hosts whose results are available
+	HostsDone int `json:"hosts_done" doc:"Number of hosts whose results are available" example:"120"`
+	// Result: the result of the query
+	Result *results.Result `json:"result" doc:"Result of the query (aggregated across all hosts whose results are available if the query is still running)"`
+}
+
+// checkpointMeta stores everything required to resume a query
+type checkpointMeta struct {
+	ID      string      `json:"id"`
+	Args    query.Args  `json:"args"`
+	Hosts   hosts.Hosts `json:"hosts"`
+	Started time.Time   `json:"started"`
+}
+
+// CheckpointStore persists the per-host results of distributed queries to disk. This allows queries to
+// be resumed after a crash / restart of the global-query server (querying only the hosts whose results
+// are still missing instead of re-fanning out to all hosts) and clients to re-attach to running or
+// completed queries by their ID
+type CheckpointStore struct {
+	dir       string
+	retention time.Duration
+
+	running map[string]struct{} // queries currently being run (and hence not to be resumed / evicted)
+	sync.Mutex
+}
+
+// NewCheckpointStore creates a new checkpoint store in dir. Checkpoints are evicted once retention has
+// passed after their query completed (or was started, in case it never completed)
+func NewCheckpointStore(dir string, retention time.Duration) (*CheckpointStore, error) {
+	if err := os.MkdirAll(dir, checkpointDirPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	return &CheckpointStore{
+		dir:       dir,
+		retention: retention,
+		running:   make(map[string]struct{}),
+	}, nil
+}
+
+// Get returns the checkpoint of the query identified by id
+func (s *CheckpointStore) Get(ctx context.Context, id string) (*Checkpoint, error) {
+	meta, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	hostResults, err := s.hostResults(id)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{
+		ID:        id,
+		Started:   meta.Started,
+		Hosts:     len(meta.Hosts),
+		HostsDone: len(hostResults),
+	}
+
+	cp.Result = new(results.Result)
+	err = readJSON(filepath.Join(s.dir, id, checkpointResultFile), cp.Result)
+	if err == nil {
+		cp.Done = true
+		return cp, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// the query is still running (or about to be resumed), hence the results of all hosts available
+	// so far are aggregated
+	stmt, err := meta.Args.Prepare()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query statement: %w", err)
+	}
+	cp.Result = finalize(aggregateResults(ctx, id, stmt, replay(ctx, hostResults, nil), nil, nil), &meta.Args)
+
+	return cp, nil
+}
+
+// RunCleanup periodically evicts expired checkpoints until the context is cancelled
+func (s *CheckpointStore) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.FromContext(ctx)
+	for {
+		if err := s.Cleanup(); err != nil {
+			logger.Errorf("failed to evict expired query checkpoints: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup evicts all checkpoints whose retention has passed
+func (s *CheckpointStore) Cleanup() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var errs []error
+	for _, entry := range entries {
+		id := entry.Name()
+		if _, isRunning := s.running[id]; !entry.IsDir() || isRunning {
+			continue
+		}
+
+		// completed queries expire relative to their completion, all others relative to their start
+		info, err := os.Stat(filepath.Join(s.dir, id, checkpointResultFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			info, err = os.Stat(filepath.Join(s.dir, id, checkpointQueryFile))
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		if info != nil && time.Since(info.ModTime()) < s.retention {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// create creates a new checkpoint for a query and marks it as running
+func (s *CheckpointStore) create(args *query.Args, hostList hosts.Hosts) (*checkpointMeta, error) {
+	id, err := newQueryID()
+	if err != nil {
+		return nil, err
+	}
+	meta := &checkpointMeta{
+		ID:      id,
+		Args:    *args,
+		Hosts:   hostList,
+		Started: time.Now(),
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.dir, id, checkpointHostsDir), checkpointDirPermissions); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(s.dir, id), checkpointQueryFile, meta); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	s.running[id] = struct{}{}
+	s.Unlock()
+
+	return meta, nil
+}
+
+// incomplete returns all checkpoints of queries which have not completed and are not running (e.g.
+// due to a crash / restart of the server) and marks them as running
+func (s *CheckpointStore) incomplete() ([]*checkpointMeta, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var metas []*checkpointMeta
+	for _, entry := range entries {
+		id := entry.Name()
+		if _, isRunning := s.running[id]; !entry.IsDir() || isRunning {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, id, checkpointResultFile)); err == nil {
+			continue
+		}
+
+		meta, err := s.load(id)
+		if err != nil {
+			return nil, err
+		}
+		s.running[id] = struct{}{}
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
+
+// saveHostResult persists the result of a single host
+func (s *CheckpointStore) saveHostResult(id string, res *results.Result) error {
+	return writeJSON(filepath.Join(s.dir, id, checkpointHostsDir), url.PathEscape(res.Hostname)+".json", res)
+}
+
+// complete persists the final result of a query and marks it as no longer running
+func (s *CheckpointStore) complete(id string, res *results.Result) error {
+	defer s.release(id)
+	return writeJSON(filepath.Join(s.dir, id), checkpointResultFile, res)
+}
+
+// release marks a query as no longer running (without completing it)
+func (s *CheckpointStore) release(id string) {
+	s.Lock()
+	delete(s.running, id)
+	s.Unlock()
+}
+
+func (s *CheckpointStore) load(id string) (*checkpointMeta, error) {
+	if !isQueryID(id) {
+		return nil, ErrCheckpointNotFound
+	}
+
+	meta := new(checkpointMeta)
+	if err := readJSON(filepath.Join(s.dir, id, checkpointQueryFile), meta); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrCheckpointNotFound
+		}
+		return nil, fmt.Errorf("failed to read query checkpoint: %w", err)
+	}
+	return meta, nil
+}
+
+func (s *CheckpointStore) hostResults(id string) ([]*results.Result, error) {
+	dir := filepath.Join(s.dir, id, checkpointHostsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host results: %w", err)
+	}
+
+	hostResults := make([]*results.Result, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		res := new(results.Result)
+		if err := readJSON(filepath.Join(dir, entry.Name()), res); err != nil {
+			return nil, fmt.Errorf("failed to read host result: %w", err)
+		}
+		hostResults = append(hostResults, res)
+	}
+	return hostResults, nil
+}
+
+// track persists every successful host result read from queryResults before forwarding it. The results
+// of hosts which were already processed (e.g. before a restart) are forwarded first
+func (s *CheckpointStore) track(ctx context.Context, id string, done []*results.Result, queryResults <-chan *results.Result) <-chan *results.Result {
+	logger := logging.FromContext(ctx)
+	return replay(ctx, done, func(out chan<- *results.Result) {
+		for res := range queryResults {
+			if res.Err() == nil {
+				if err := s.saveHostResult(id, res); err != nil {
+					logger.With("hostname", res.Hostname).Errorf("failed to checkpoint host result: %v", err)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case out <- res:
+			}
+		}
+	})
+}
+
+// replay returns a channel providing the (already available) results, followed by the ones sent by
+// the (optional) producer
+func replay(ctx context.Context, available []*results.Result, producer func(out chan<- *results.Result)) <-chan *results.Result {
+	out := make(chan *results.Result)
+	go func() {
+		defer close(out)
+		for _, res := range available {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- res:
+			}
+		}
+		if producer != nil {
+			producer(out)
+		}
+	}()
+	return out
+}
+
+func newQueryID() (string, error) {
+	id := make([]byte, checkpointIDLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate query ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// isQueryID checks if id is a valid query ID (and hence safe to be used as part of a path)
+func isQueryID(id string) bool {
+	raw, err := hex.DecodeString(id)
+	return err == nil && len(raw) == checkpointIDLen
+}
+
+// writeJSON atomically writes v as JSON to the file name in dir
+func writeJSON(dir, name string, v any) error {
+	tempFile, err := os.CreateTemp(dir, ".tmp-"+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	if err = jsoniter.NewEncoder(tempFile).Encode(v); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), checkpointPermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), filepath.Join(dir, name))
+}
+
+func readJSON(path string, v any) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return jsoniter.NewDecoder(f).Decode(v)
+}
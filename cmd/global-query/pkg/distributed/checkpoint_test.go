@@ -0,0 +1,187 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// mockQuerier returns a single row per host (or fails for the hosts provided in failing), reporting the
+// writeouts provided in writeouts. If block is set, the results are only returned once it is closed
+type mockQuerier struct {
+	failing   map[string]struct{}
+	writeouts map[string]time.Time
+	block     chan struct{}
+
+	queried hosts.Hosts
+	sync.Mutex
+}
+
+func (m *mockQuerier) Query(_ context.Context, hostList hosts.Hosts, _ *query.Args) <-chan *results.Result {
+	m.Lock()
+	m.queried = append(m.queried, hostList...)
+	m.Unlock()
+
+	m.Lock()
+	hostResults := make([]*results.Result, 0, len(hostList))
+	for _, host := range hostList {
+		res := results.New()
+		res.Hostname = host
+		if _, fails := m.failing[host]; fails {
+			res.SetErr(errors.New("host unreachable"))
+			hostResults = append(hostResults, res)
+			continue
+		}
+		status := results.Status{Code: types.StatusOK}
+		if writeout, exists := m.writeouts[host]; exists {
+			status.LastWriteout = &writeout
+		}
+		res.HostsStatuses[host] = status
+		res.Summary.Interfaces = results.Interfaces{"eth0"}
+		res.Summary.Totals = types.Counters{BytesRcvd: 100, PacketsRcvd: 1}
+		res.Rows = results.Rows{{
+			Labels:     results.Labels{Hostname: host, Iface: "eth0"},
+			Attributes: results.Attributes{SrcIP: netip.MustParseAddr("10.0.0.1")},
+			Counters:   types.Counters{BytesRcvd: 100, PacketsRcvd: 1},
+		}}
+		hostResults = append(hostResults, res)
+	}
+	m.Unlock()
+
+	out := make(chan *results.Result, len(hostList))
+	go func() {
+		if m.block != nil {
+			<-m.block
+		}
+		for _, res := range hostResults {
+			out <- res
+		}
+		close(out)
+	}()
+	return out
+}
+
+func newCheckpointArgs() *query.Args {
+	a := query.NewArgs("sip", "eth0", query.WithFormat(types.FormatJSON))
+	a.QueryHosts = "hostA,hostB,hostC"
+	return a
+}
+
+func TestCheckpointQuery(t *testing.T) {
+	store, err := NewCheckpointStore(t.TempDir(), time.Hour)
+	require.Nil(t, err)
+
+	querier := &mockQuerier{failing: map[string]struct{}{"hostC": {}}}
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithCheckpoints(store))
+
+	res, err := qr.Run(context.Background(), newCheckpointArgs())
+	require.Nil(t, err)
+	require.NotEmpty(t, res.ID)
+	require.Len(t, res.Rows, 2)
+
+	// re-attaching to the completed query yields the same result
+	cp, err := store.Get(context.Background(), res.ID)
+	require.Nil(t, err)
+	require.True(t, cp.Done)
+	require.Equal(t, 3, cp.Hosts)
+	require.Equal(t, 2, cp.HostsDone)
+	require.Equal(t, res.ID, cp.Result.ID)
+	require.Equal(t, res.Summary.Totals, cp.Result.Summary.Totals)
+	require.Len(t, cp.Result.Rows, 2)
+	require.Equal(t, types.StatusError, cp.Result.HostsStatuses["hostC"].Code)
+
+	// there is nothing to be resumed
+	require.Nil(t, qr.Resume(context.Background()))
+	require.Len(t, querier.queried, 3)
+
+	_, err = store.Get(context.Background(), "5f0c6e2a9d7b4c1e8a3f2b6d9e0c4a7b")
+	require.ErrorIs(t, err, ErrCheckpointNotFound)
+	_, err = store.Get(context.Background(), "../../etc")
+	require.ErrorIs(t, err, ErrCheckpointNotFound)
+}
+
+func TestCheckpointQueryStarted(t *testing.T) {
+	store, err := NewCheckpointStore(t.TempDir(), time.Hour)
+	require.Nil(t, err)
+
+	querier := &mockQuerier{block: make(chan struct{})}
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithCheckpoints(store))
+
+	started := make(chan string, 1)
+	ctx := WithQueryStartedFn(context.Background(), func(id string) {
+		started <- id
+	})
+	done := make(chan *results.Result, 1)
+	go func() {
+		res, err := qr.Run(ctx, newCheckpointArgs())
+		require.Nil(t, err)
+		done <- res
+	}()
+
+	// the ID is known before any host answered, allowing to re-attach to the running query
+	id := <-started
+	cp, err := store.Get(context.Background(), id)
+	require.Nil(t, err)
+	require.False(t, cp.Done)
+	require.Zero(t, cp.HostsDone)
+
+	close(querier.block)
+	require.Equal(t, id, (<-done).ID)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+
+	// simulate a query interrupted after the result of a single host was checkpointed
+	store, err := NewCheckpointStore(dir, time.Hour)
+	require.Nil(t, err)
+	args := newCheckpointArgs()
+	meta, err := store.create(args, hosts.Hosts{"hostA", "hostB", "hostC"})
+	require.Nil(t, err)
+	res := <-(&mockQuerier{}).Query(context.Background(), hosts.Hosts{"hostB"}, args)
+	require.Nil(t, store.saveHostResult(meta.ID, res))
+
+	// the result of the host queried so far is available while the query is incomplete
+	cp, err := store.Get(context.Background(), meta.ID)
+	require.Nil(t, err)
+	require.False(t, cp.Done)
+	require.Equal(t, 1, cp.HostsDone)
+	require.Len(t, cp.Result.Rows, 1)
+
+	// after a restart, only the remaining hosts are queried
+	store, err = NewCheckpointStore(dir, time.Hour)
+	require.Nil(t, err)
+	querier := &mockQuerier{}
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithCheckpoints(store))
+	require.Nil(t, qr.Resume(context.Background()))
+
+	require.Eventually(t, func() bool {
+		cp, err = store.Get(context.Background(), meta.ID)
+		return err == nil && cp.Done
+	}, 5*time.Second, 10*time.Millisecond)
+
+	querier.Lock()
+	slices.Sort(querier.queried)
+	require.Equal(t, hosts.Hosts{"hostA", "hostC"}, querier.queried)
+	querier.Unlock()
+
+	require.Equal(t, 3, cp.HostsDone)
+	require.Len(t, cp.Result.Rows, 3)
+	require.Equal(t, types.Counters{BytesRcvd: 300, PacketsRcvd: 3}, cp.Result.Summary.Totals)
+
+	// completed checkpoints are evicted once their retention has passed
+	store.retention = 0
+	require.Nil(t, store.Cleanup())
+	_, err = store.Get(context.Background(), meta.ID)
+	require.ErrorIs(t, err, ErrCheckpointNotFound)
+}
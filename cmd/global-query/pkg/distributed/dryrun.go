@@ -0,0 +1,88 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/telemetry/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HostDryRun denotes the outcome of a dry-run on an individual host
+type HostDryRun struct {
+	Hostname string
+
+	DryRun *results.DryRun
+	Err    error
+}
+
+// DryRunQuerier extends a Querier with the support to validate queries and estimate their cost on
+// the hosts without running them
+type DryRunQuerier interface {
+	// DryRun runs the dry-run on the provided hosts and returns a channel from which the outcomes
+	// can be read. It is the responsibility of the implementing type to close the channel
+	DryRun(ctx context.Context, hosts hosts.Hosts, args *query.Args) <-chan *HostDryRun
+}
+
+// DryRun validates the query and estimates its cost on all hosts without running it
+func (q *QueryRunner) DryRun(ctx context.Context, args *query.Args) (*results.DryRun, error) {
+	queryArgs := *args
+
+	if queryArgs.QueryHosts == "" {
+		return nil, fmt.Errorf("couldn't prepare query: list of target hosts is empty")
+	}
+
+	ctx, span := tracing.Start(ctx, "(*distributed.QueryRunner).DryRun", trace.WithAttributes(attribute.String("args", queryArgs.ToJSONString())))
+	defer span.End()
+
+	dryRunQuerier, ok := q.querier.(DryRunQuerier)
+	if !ok {
+		return nil, errors.New("querier type does not support dry-runs")
+	}
+
+	queryArgs.Query = types.SanitizeQueryType(queryArgs.Query)
+
+	stmt, err := queryArgs.Prepare()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query statement: %w", err)
+	}
+	err = queryArgs.CheckUnboundedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	hostList, err := q.prepareHostList(ctx, args.QueryHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &results.DryRun{
+		First:         time.Unix(stmt.First, 0),
+		Last:          time.Unix(stmt.Last, 0),
+		HostsStatuses: make(results.HostsStatuses, len(hostList)),
+	}
+	for hostRes := range dryRunQuerier.DryRun(ctx, hostList, &queryArgs) {
+		if hostRes.Err != nil {
+			res.HostsStatuses.SetErr(hostRes.Hostname, hostRes.Err)
+			continue
+		}
+		res.HostsStatuses[hostRes.Hostname] = results.Status{Code: types.StatusOK}
+
+		res.Cost.Add(&hostRes.DryRun.Cost)
+		for _, warning := range hostRes.DryRun.Warnings {
+			if !slices.Contains(res.Warnings, warning) {
+				res.Warnings = append(res.Warnings, warning)
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,62 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// dryRunQuerier returns the configured estimate of each host (or an error for unknown hosts)
+type dryRunQuerier struct {
+	topNQuerier
+
+	costs map[string]results.Cost
+}
+
+func (q *dryRunQuerier) DryRun(_ context.Context, hostList hosts.Hosts, _ *query.Args) <-chan *HostDryRun {
+	out := make(chan *HostDryRun, len(hostList))
+	for _, host := range hostList {
+		res := &HostDryRun{Hostname: host}
+		cost, exists := q.costs[host]
+		if !exists {
+			res.Err = errors.New("unknown host")
+		} else {
+			res.DryRun = &results.DryRun{Cost: cost, Warnings: []string{"shared warning"}}
+		}
+		out <- res
+	}
+	close(out)
+	return out
+}
+
+func TestDryRun(t *testing.T) {
+	querier := &dryRunQuerier{costs: map[string]results.Cost{
+		"hostA": {Hosts: 1, Interfaces: 1, Directories: 2, Blocks: 10, Bytes: 1000, Flows: 100},
+		"hostB": {Hosts: 1, Interfaces: 2, Directories: 4, DirectoriesPruned: 1, Blocks: 20, Bytes: 3000, Flows: 50},
+	}}
+
+	args := query.NewArgs("sip", "eth0", query.WithFormat(types.FormatJSON))
+	args.QueryHosts = "hostA,hostB,hostC"
+
+	res, err := NewQueryRunner(hosts.NewStringResolver(true), querier).DryRun(context.Background(), args)
+	require.Nil(t, err)
+	require.Equal(t, results.Cost{Hosts: 2, Interfaces: 3, Directories: 6, DirectoriesPruned: 1, Blocks: 30, Bytes: 4000, Flows: 150}, res.Cost)
+	require.Equal(t, []string{"shared warning"}, res.Warnings)
+	require.Equal(t, types.StatusOK, res.HostsStatuses["hostA"].Code)
+	require.Equal(t, types.StatusError, res.HostsStatuses["hostC"].Code)
+
+	// queriers without dry-run support are rejected
+	_, err = NewQueryRunner(hosts.NewStringResolver(true), &topNQuerier{}).DryRun(context.Background(), args)
+	require.Error(t, err)
+
+	// invalid queries are rejected
+	args.Condition = "dport = "
+	_, err = NewQueryRunner(hosts.NewStringResolver(true), querier).DryRun(context.Background(), args)
+	require.Error(t, err)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
 	"github.com/els0r/goProbe/pkg/query"
@@ -25,16 +28,42 @@ type QueryRunner struct {
 	// of a new result from one of the queried hosts (allowing for dynamic / iterative
 	// handling of said results)
 	onResult func(*results.Result) error
+
+	// checkpoints persists the per-host results of all queries (if enabled)
+	checkpoints *CheckpointStore
+
+	// clockSkewThreshold denotes the clock skew of a host beyond which a warning is issued
+	clockSkewThreshold time.Duration
+
+	// cache caches the results of completed queries (if enabled)
+	cache *ResultCache
+
+	// deadlineGrace denotes the time granted to the hosts beyond the query deadline to return
+	// their (partial) results
+	deadlineGrace time.Duration
+
+	// topNOverfetch denotes the factor by which the number of rows requested from each host exceeds
+	// the number of rows of a top-N query, topNRefine whether incomplete rows are requested in a
+	// second pass
+	topNOverfetch int
+	topNRefine    bool
 }
 
+// DefaultDeadlineGrace denotes the default time granted to the hosts beyond the query deadline
+// to return their (partial) results
+const DefaultDeadlineGrace = 5 * time.Second
+
 // QueryOption configures the query runner
 type QueryOption func(*QueryRunner)
 
 // NewQueryRunner instantiates a new distributed query runner
 func NewQueryRunner(resolver hosts.Resolver, querier Querier, opts ...QueryOption) (qr *QueryRunner) {
 	qr = &QueryRunner{
-		resolver: resolver,
-		querier:  querier,
+		resolver:      resolver,
+		querier:       querier,
+		deadlineGrace: DefaultDeadlineGrace,
+		topNOverfetch: DefaultTopNOverfetch,
+		topNRefine:    true,
 	}
 	for _, opt := range opts {
 		opt(qr)
@@ -42,6 +71,43 @@ func NewQueryRunner(resolver hosts.Resolver, querier Querier, opts ...QueryOptio
 	return
 }
 
+// WithCheckpoints enables checkpointing of the per-host results of all queries to the store
+func WithCheckpoints(store *CheckpointStore) QueryOption {
+	return func(qr *QueryRunner) {
+		qr.checkpoints = store
+	}
+}
+
+// WithClockSkewThreshold sets the clock skew of a host beyond which a warning is added to its status
+// (disabled if zero)
+func WithClockSkewThreshold(threshold time.Duration) QueryOption {
+	return func(qr *QueryRunner) {
+		qr.clockSkewThreshold = threshold
+	}
+}
+
+// WithResultCache enables caching of the results of completed queries
+func WithResultCache(cache *ResultCache) QueryOption {
+	return func(qr *QueryRunner) {
+		qr.cache = cache
+	}
+}
+
+// WithDeadlineGrace sets the time granted to the hosts beyond the query deadline to return their
+// (partial) results. Hosts not answering within it are reported as having timed out
+func WithDeadlineGrace(grace time.Duration) QueryOption {
+	return func(qr *QueryRunner) {
+		if grace >= 0 {
+			qr.deadlineGrace = grace
+		}
+	}
+}
+
+// Checkpoints returns the checkpoint store of the query runner (or nil if checkpointing is disabled)
+func (q *QueryRunner) Checkpoints() *CheckpointStore {
+	return q.checkpoints
+}
+
 // SetResultReceivedFn registers a callback to be executed for every results.Result that is
 // read off the results channel
 func (q *QueryRunner) SetResultReceivedFn(f func(*results.Result) error) *QueryRunner {
@@ -57,6 +123,16 @@ func (q *QueryRunner) ResultReceived(res *results.Result) error {
 	return q.onResult(res)
 }
 
+type queryStartedKey struct{}
+
+// WithQueryStartedFn returns a copy of ctx which makes Run call f with the ID of the query as
+// soon as it has been checkpointed, i.e. before any host is queried. It allows clients to learn
+// the ID required to re-attach to the query up front. f is not called if checkpointing is
+// disabled or the result is served from the cache
+func WithQueryStartedFn(ctx context.Context, f func(id string)) context.Context {
+	return context.WithValue(ctx, queryStartedKey{}, f)
+}
+
 // Run executes / runs the query and creates the final result structure
 func (q *QueryRunner) Run(ctx context.Context, args *query.Args) (*results.Result, error) {
 	// use a copy of the arguments, since some fields are modified by the querier
@@ -91,24 +167,213 @@ func (q *QueryRunner) Run(ctx context.Context, args *query.Args) (*results.Resul
 		return nil, err // prepareHostList() returns formatted error
 	}
 
-	// log the query
-	logger := logging.Logger().With("hosts", hostList)
+	// serve the result from the cache if an identical query has been run recently. Live queries
+	// are never cached, since their results change continuously
+	if q.cache != nil && !queryArgs.Live {
+		key, err := newCacheKey(&queryArgs, stmt, hostList)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create query cache key: %w", err)
+		}
+		res, cached, err := q.cache.acquire(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if cached {
+			logging.FromContext(ctx).With("hosts", hostList).Info("serving query result from cache")
+			return res, nil
+		}
+
+		res, err = q.runCheckpointed(ctx, stmt, &queryArgs, hostList)
+		q.cache.release(key, res, err == nil && ctx.Err() == nil)
+		return res, err
+	}
+
+	return q.runCheckpointed(ctx, stmt, &queryArgs, hostList)
+}
+
+// runCheckpointed runs the query, checkpointing it if enabled
+func (q *QueryRunner) runCheckpointed(ctx context.Context, stmt *query.Statement, queryArgs *query.Args, hostList hosts.Hosts) (*results.Result, error) {
+	if q.checkpoints == nil {
+		return q.run(ctx, stmt, queryArgs, hostList, nil, nil), nil
+	}
+
+	cp, err := q.checkpoints.create(queryArgs, hostList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create query checkpoint: %w", err)
+	}
+	if onStarted, ok := ctx.Value(queryStartedKey{}).(func(id string)); ok {
+		onStarted(cp.ID)
+	}
+
+	// the query keeps running if the client disconnects, allowing it to re-attach via the query ID
+	return q.run(context.WithoutCancel(ctx), stmt, queryArgs, hostList, cp, nil), nil
+}
+
+// Resume resumes all checkpointed queries which did not complete (e.g. due to a crash / restart of
+// the server) in the background. Only the hosts whose results are still missing are queried
+func (q *QueryRunner) Resume(ctx context.Context) error {
+	if q.checkpoints == nil {
+		return nil
+	}
 
+	cps, err := q.checkpoints.incomplete()
+	if err != nil {
+		return fmt.Errorf("failed to read query checkpoints: %w", err)
+	}
+
+	logger := logging.FromContext(ctx)
+	for _, cp := range cps {
+		logger := logger.With("query_id", cp.ID)
+
+		stmt, err := cp.Args.Prepare()
+		if err != nil {
+			logger.Errorf("failed to prepare checkpointed query: %v", err)
+			q.checkpoints.release(cp.ID)
+			continue
+		}
+		done, err := q.checkpoints.hostResults(cp.ID)
+		if err != nil {
+			logger.Errorf("failed to read checkpointed query: %v", err)
+			q.checkpoints.release(cp.ID)
+			continue
+		}
+
+		doneHosts := make(map[string]struct{}, len(done))
+		for _, res := range done {
+			doneHosts[res.Hostname] = struct{}{}
+		}
+		var remaining hosts.Hosts
+		for _, host := range cp.Hosts {
+			if _, isDone := doneHosts[host]; !isDone {
+				remaining = append(remaining, host)
+			}
+		}
+
+		logger.With("hosts_done", len(done), "hosts_remaining", len(remaining)).Info("resuming checkpointed query")
+		go q.run(ctx, stmt, &cp.Args, remaining, cp, done)
+	}
+
+	return nil
+}
+
+// run queries the hosts and aggregates their results (along with the results of the hosts which are
+// already done). If a checkpoint is provided, the host results are persisted along the way
+func (q *QueryRunner) run(ctx context.Context, stmt *query.Statement, args *query.Args, hostList hosts.Hosts, cp *checkpointMeta, done []*results.Result) *results.Result {
+	logger := logging.Logger().With("hosts", hostList)
 	logger.Info("reading query results from querier")
 
-	finalResult := aggregateResults(ctx, stmt,
-		q.querier.Query(ctx, hostList, &queryArgs), q.onResult,
-	)
+	// the hosts stop processing at the query deadline themselves, hence they're only waited for
+	// until then (plus some leeway for returning their partial results)
+	fanoutCtx := ctx
+	if args.Deadline > 0 {
+		var cancel context.CancelFunc
+		fanoutCtx, cancel = context.WithDeadline(ctx, time.Now().Add(args.Deadline+q.deadlineGrace))
+		defer cancel()
+	}
+
+	// top-N queries only fetch the top rows of each host
+	hostArgs, topN := q.hostArgs(stmt, args)
+
+	var queryResults <-chan *results.Result
+	if len(hostList) > 0 {
+		queryResults = q.querier.Query(fanoutCtx, hostList, hostArgs)
+	} else {
+		closed := make(chan *results.Result)
+		close(closed)
+		queryResults = closed
+	}
+
+	var id string
+	if cp != nil {
+		id = cp.ID
+		queryResults = q.checkpoints.track(fanoutCtx, id, done, queryResults)
+	}
+
+	finalResult := aggregateResults(fanoutCtx, id, stmt, queryResults, q.onResult, topN)
+	if topN != nil {
+		q.completeTopN(fanoutCtx, finalResult, stmt, args, topN)
+	}
+	finalResult = finalize(finalResult, args)
+	if ctx.Err() == nil && errors.Is(fanoutCtx.Err(), context.DeadlineExceeded) {
+		markTimedOut(finalResult, hostList, args.Deadline)
+	}
+	q.checkClockSkew(ctx, finalResult)
 
+	if cp != nil {
+		// a query which did not complete is resumed upon the next restart
+		if ctx.Err() != nil {
+			q.checkpoints.release(id)
+			return finalResult
+		}
+		if err := q.checkpoints.complete(id, finalResult); err != nil {
+			logger.With("query_id", id).Errorf("failed to checkpoint query result: %v", err)
+		}
+	}
+
+	return finalResult
+}
+
+// markTimedOut reports all hosts which did not return a result before the query deadline as having
+// timed out and flags the result as truncated
+func markTimedOut(res *results.Result, hostList hosts.Hosts, deadline time.Duration) {
+	err := fmt.Errorf("no result returned within query deadline of %s", deadline)
+	for _, host := range hostList {
+		if _, answered := res.HostsStatuses[host]; !answered {
+			res.HostsStatuses.SetErr(host, err)
+			res.Summary.TruncatedByDeadline = true
+		}
+	}
+}
+
+// finalize completes the aggregated result and truncates it based on the limit
+func finalize(finalResult *results.Result, args *query.Args) *results.Result {
 	finalResult.End()
 
-	// truncate results based on the limit
-	if queryArgs.NumResults < uint64(len(finalResult.Rows)) {
-		finalResult.Rows = finalResult.Rows[:queryArgs.NumResults]
+	if args.NumResults < uint64(len(finalResult.Rows)) {
+		finalResult.Rows = finalResult.Rows[:args.NumResults]
 	}
 	finalResult.Summary.Hits.Displayed = len(finalResult.Rows)
 
-	return finalResult, nil
+	// sources / policies / resource usages are added in the order the hosts responded
+	if provenance := finalResult.Summary.Provenance; provenance != nil {
+		slices.SortStableFunc(provenance.Sources, func(a, b results.Source) int {
+			return strings.Compare(a.Hostname, b.Hostname)
+		})
+	}
+	slices.SortStableFunc(finalResult.Summary.ResourcePolicies, func(a, b results.ResourcePolicy) int {
+		return strings.Compare(a.Hostname, b.Hostname)
+	})
+	slices.SortStableFunc(finalResult.Summary.ResourceUsage, func(a, b results.ResourceUsage) int {
+		return strings.Compare(a.Hostname, b.Hostname)
+	})
+
+	return finalResult
+}
+
+// checkClockSkew warns about all hosts whose clock skew exceeds the threshold. Skew silently shifts
+// the time bins of a host relative to those of all others, rendering cross-host comparisons misleading
+func (q *QueryRunner) checkClockSkew(ctx context.Context, res *results.Result) {
+	if q.clockSkewThreshold <= 0 {
+		return
+	}
+
+	logger := logging.FromContext(ctx)
+	for host, status := range res.HostsStatuses {
+		if status.ClockSkew.Abs() <= q.clockSkewThreshold {
+			continue
+		}
+
+		msg := fmt.Sprintf("clock skew of %s exceeds threshold of %s", status.ClockSkew.Round(time.Millisecond), q.clockSkewThreshold)
+		logger.With("hostname", host).Warn(msg)
+
+		// retain an existing message (e.g. on why the result is empty)
+		if status.Message == "" {
+			status.Message = msg
+		} else {
+			status.Message += "; " + msg
+		}
+		res.HostsStatuses[host] = status
+	}
 }
 
 func (q *QueryRunner) prepareHostList(ctx context.Context, queryHosts string) (hostList hosts.Hosts, err error) {
@@ -137,13 +402,15 @@ func (q *QueryRunner) prepareHostList(ctx context.Context, queryHosts string) (h
 }
 
 // aggregateResults takes finished query workloads from the workloads channel, aggregates the result by merging the rows and summaries,
-// and returns the final result. The `tracker` variable provides information about potential Run failures for individual hosts
-func aggregateResults(ctx context.Context, stmt *query.Statement, queryResults <-chan *results.Result, onResult func(*results.Result) error) (finalResult *results.Result) {
+// and returns the final result. The `tracker` variable provides information about potential Run failures for individual hosts.
+// For top-N queries, the partial results of the hosts are tracked by topN
+func aggregateResults(ctx context.Context, id string, stmt *query.Statement, queryResults <-chan *results.Result, onResult func(*results.Result) error, topN *topNTracker) (finalResult *results.Result) {
 	ctx, span := tracing.Start(ctx, "aggregateResults")
 	defer span.End()
 
 	// aggregation
 	finalResult = results.New()
+	finalResult.ID = id
 	finalResult.Start()
 
 	var rowMap = make(results.RowsMap)
@@ -183,6 +450,9 @@ func aggregateResults(ctx context.Context, stmt *query.Statement, queryResults <
 			}
 
 			res := qr
+			if topN != nil {
+				topN.add(res)
+			}
 
 			for host, status := range res.HostsStatuses {
 				finalResult.HostsStatuses[host] = status
@@ -212,6 +482,46 @@ func aggregateResults(ctx context.Context, stmt *query.Statement, queryResults <
 			finalResult.Summary.Last = res.Summary.Last
 			finalResult.Summary.Totals.Add(res.Summary.Totals)
 			finalResult.Summary.Stats.Add(res.Summary.Stats)
+			finalResult.Summary.TruncatedByDeadline = finalResult.Summary.TruncatedByDeadline || res.Summary.TruncatedByDeadline
+			if res.Summary.Profile != nil {
+				if finalResult.Summary.Profile == nil {
+					finalResult.Summary.Profile = new(results.Profile)
+				}
+				finalResult.Summary.Profile.Add(res.Summary.Profile)
+			}
+			if res.Summary.Drops != nil {
+				if finalResult.Summary.Drops == nil {
+					finalResult.Summary.Drops = new(results.Drops)
+				}
+				finalResult.Summary.Drops.Add(res.Summary.Drops)
+				finalResult.Summary.Drops.Estimate(finalResult.Summary.Totals)
+			}
+			if res.Summary.Provenance != nil {
+				if finalResult.Summary.Provenance == nil {
+					finalResult.Summary.Provenance = new(results.Provenance)
+				}
+				finalResult.Summary.Provenance.Add(res.Summary.Provenance)
+			}
+			if res.Summary.Matrix != nil {
+				if finalResult.Summary.Matrix == nil {
+					finalResult.Summary.Matrix = new(results.Matrix)
+				}
+				finalResult.Summary.Matrix.Add(res.Summary.Matrix)
+			}
+			if res.Summary.Baseline != nil {
+				if finalResult.Summary.Baseline == nil {
+					finalResult.Summary.Baseline = new(results.Baseline)
+				}
+				finalResult.Summary.Baseline.Add(res.Summary.Baseline)
+			}
+			for _, basis := range res.Summary.ByteAccounting {
+				if !slices.Contains(finalResult.Summary.ByteAccounting, basis) {
+					finalResult.Summary.ByteAccounting = append(finalResult.Summary.ByteAccounting, basis)
+				}
+			}
+			slices.Sort(finalResult.Summary.ByteAccounting)
+			finalResult.Summary.ResourcePolicies = append(finalResult.Summary.ResourcePolicies, res.Summary.ResourcePolicies...)
+			finalResult.Summary.ResourceUsage = append(finalResult.Summary.ResourceUsage, res.Summary.ResourceUsage...)
 
 			// take the total from the query result. Since there may be overlap between the queries of two
 			// different systems, the overlap has to be deducted from the total
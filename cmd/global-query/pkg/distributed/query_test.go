@@ -0,0 +1,88 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckClockSkew(t *testing.T) {
+	res := results.New()
+	res.HostsStatuses = results.HostsStatuses{
+		"hostA": {Code: types.StatusOK, ClockSkew: time.Second},
+		"hostB": {Code: types.StatusOK, ClockSkew: -7 * time.Second},
+		"hostC": {Code: types.StatusEmpty, Message: results.ErrorNoResults.Error(), ClockSkew: 10 * time.Second},
+	}
+
+	// disabled by default
+	NewQueryRunner(nil, nil).checkClockSkew(context.Background(), res)
+	require.Empty(t, res.HostsStatuses["hostB"].Message)
+
+	NewQueryRunner(nil, nil, WithClockSkewThreshold(5*time.Second)).checkClockSkew(context.Background(), res)
+	require.Empty(t, res.HostsStatuses["hostA"].Message)
+	require.Equal(t, "clock skew of -7s exceeds threshold of 5s", res.HostsStatuses["hostB"].Message)
+	require.Equal(t, results.ErrorNoResults.Error()+"; clock skew of 10s exceeds threshold of 5s", res.HostsStatuses["hostC"].Message)
+	require.Equal(t, types.StatusOK, res.HostsStatuses["hostB"].Code)
+}
+
+// slowQuerier returns a result for all hosts except the ones provided in stalling, which never answer
+// (until the query is cancelled)
+type slowQuerier struct {
+	mockQuerier
+	stalling map[string]struct{}
+}
+
+func (s *slowQuerier) Query(ctx context.Context, hostList hosts.Hosts, args *query.Args) <-chan *results.Result {
+	var answering hosts.Hosts
+	for _, host := range hostList {
+		if _, stalls := s.stalling[host]; !stalls {
+			answering = append(answering, host)
+		}
+	}
+
+	out := make(chan *results.Result)
+	go func() {
+		defer close(out)
+		for res := range s.mockQuerier.Query(ctx, answering, args) {
+			out <- res
+		}
+		if len(answering) < len(hostList) {
+			<-ctx.Done()
+		}
+	}()
+	return out
+}
+
+func TestQueryDeadline(t *testing.T) {
+	querier := &slowQuerier{stalling: map[string]struct{}{"hostC": {}}}
+	qr := NewQueryRunner(hosts.NewStringResolver(true), querier, WithDeadlineGrace(0))
+
+	args := newCheckpointArgs()
+	args.Deadline = 100 * time.Millisecond
+
+	start := time.Now()
+	res, err := qr.Run(context.Background(), args)
+	require.Nil(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	require.True(t, res.Summary.TruncatedByDeadline)
+	require.Len(t, res.Rows, 2)
+	require.Equal(t, types.StatusOK, res.HostsStatuses["hostA"].Code)
+	require.Equal(t, types.StatusOK, res.HostsStatuses["hostB"].Code)
+	require.Equal(t, types.StatusError, res.HostsStatuses["hostC"].Code)
+	require.Equal(t, "no result returned within query deadline of 100ms", res.HostsStatuses["hostC"].Message)
+
+	// without a deadline, all hosts are waited for
+	querier.stalling = nil
+	args.Deadline = 0
+	res, err = qr.Run(context.Background(), args)
+	require.Nil(t, err)
+	require.False(t, res.Summary.TruncatedByDeadline)
+	require.Len(t, res.Rows, 3)
+}
@@ -0,0 +1,258 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/telemetry/logging"
+)
+
+// DefaultTopNOverfetch denotes the default factor by which the number of rows requested from each host
+// exceeds the number of rows of a top-N query
+const DefaultTopNOverfetch = 2
+
+// WithTopN configures the scatter-gather of top-N queries, i.e. queries ranking the rows by bytes or
+// packets in descending order: each host is only asked for its top overfetch*N rows. If refine is set,
+// rows possibly ranking among the top N whose volume is incomplete (since some hosts omitted them) are
+// requested from these hosts in a second, targeted pass
+func WithTopN(overfetch int, refine bool) QueryOption {
+	return func(qr *QueryRunner) {
+		if overfetch >= 1 {
+			qr.topNOverfetch = overfetch
+		}
+		qr.topNRefine = refine
+	}
+}
+
+// hostArgs returns the arguments of the query as sent to the hosts, along with a tracker of the partial
+// results of the hosts if the query is a top-N query (nil otherwise)
+func (q *QueryRunner) hostArgs(stmt *query.Statement, args *query.Args) (*query.Args, *topNTracker) {
+	hostArgs := *args
+
+	// Without a ranking by volume in descending order, the rows omitted by a host cannot be bounded,
+	// hence more rows are requested from the hosts than are returned in the end
+	value, byCounter := results.CounterValue(stmt.SortBy, stmt.Direction)
+	if !byCounter || stmt.SortAscending {
+		hostArgs.NumResults = max(args.NumResults, query.DefaultNumResults)
+		return &hostArgs, nil
+	}
+
+	hostArgs.NumResults = query.MaxResults
+	if args.NumResults <= query.MaxResults/uint64(q.topNOverfetch) {
+		hostArgs.NumResults = args.NumResults * uint64(q.topNOverfetch)
+	}
+	return &hostArgs, &topNTracker{
+		value:   value,
+		partial: make(map[string]*partialResult),
+	}
+}
+
+// topNTracker tracks the results of the hosts of a top-N query which did not return all of their rows
+type topNTracker struct {
+	value   func(types.Counters) uint64
+	partial map[string]*partialResult
+
+	unbounded bool // a host omitted rows without returning any, hence they cannot be bounded
+}
+
+type partialResult struct {
+	keys    map[results.MergeableAttributes]struct{}
+	origins map[origin]struct{}
+
+	// cutoff denotes the volume of the smallest row returned, bounding the volume of all rows omitted
+	cutoff uint64
+}
+
+// origin denotes the host a row originates from (as per its labels). A result can only hold rows of
+// the hosts it covers, hence rows of other hosts are never omitted from it
+type origin struct {
+	hostname, hostID string
+}
+
+func originOf(labels results.Labels) origin {
+	return origin{hostname: labels.Hostname, hostID: labels.HostID}
+}
+
+// add tracks the result of a host (if it is partial)
+func (t *topNTracker) add(res *results.Result) {
+	if res.Summary.Hits.Total <= len(res.Rows) {
+		return
+	}
+	if len(res.Rows) == 0 {
+		t.unbounded = true
+		return
+	}
+
+	p := &partialResult{
+		keys:    make(map[results.MergeableAttributes]struct{}, len(res.Rows)),
+		origins: make(map[origin]struct{}),
+		cutoff:  t.value(res.Rows[0].Counters),
+	}
+	for _, row := range res.Rows {
+		p.keys[results.MergeableAttributes{Labels: row.Labels, Attributes: row.Attributes}] = struct{}{}
+		p.origins[originOf(row.Labels)] = struct{}{}
+		p.cutoff = min(p.cutoff, t.value(row.Counters))
+	}
+	t.partial[res.Hostname] = p
+}
+
+// missing returns the upper bound of the volume of a row omitted by the hosts with partial results,
+// along with these hosts
+func (t *topNTracker) missing(row *results.Row) (bound uint64, omittedBy []string) {
+	key := results.MergeableAttributes{Labels: row.Labels, Attributes: row.Attributes}
+	for hostname, p := range t.partial {
+		if _, covers := p.origins[originOf(row.Labels)]; !covers {
+			continue
+		}
+		if _, returned := p.keys[key]; !returned {
+			bound += p.cutoff
+			omittedBy = append(omittedBy, hostname)
+		}
+	}
+	return
+}
+
+// unseenBound returns the upper bound of the volume of a row omitted by all hosts
+func (t *topNTracker) unseenBound() (bound uint64) {
+	sums := make(map[origin]uint64)
+	for _, p := range t.partial {
+		for o := range p.origins {
+			sums[o] += p.cutoff
+			bound = max(bound, sums[o])
+		}
+	}
+	return
+}
+
+// completeTopN verifies the ranking of the top rows of the (aggregated, but not yet truncated) result
+// based on the partial results of the hosts. Rows possibly ranking among the top rows whose volume is
+// incomplete are requested from the hosts which omitted them (if refinement is enabled). If the ranking
+// cannot be verified, the result is flagged as approximate
+func (q *QueryRunner) completeTopN(ctx context.Context, res *results.Result, stmt *query.Statement, args *query.Args, t *topNTracker) {
+	if len(t.partial) == 0 && !t.unbounded {
+		return
+	}
+	logger := logging.FromContext(ctx)
+
+	// candidates are all rows whose volume may exceed the one of the last top row once complete
+	threshold := t.threshold(res.Rows, args.NumResults)
+	candidates := make(map[results.MergeableAttributes]struct{})
+	var refineHosts hosts.Hosts
+	for i := range res.Rows {
+		bound, omittedBy := t.missing(&res.Rows[i])
+		if bound == 0 || t.value(res.Rows[i].Counters)+bound < threshold {
+			continue
+		}
+		candidates[results.MergeableAttributes{Labels: res.Rows[i].Labels, Attributes: res.Rows[i].Attributes}] = struct{}{}
+		for _, host := range omittedBy {
+			if !slices.Contains(refineHosts, host) {
+				refineHosts = append(refineHosts, host)
+			}
+		}
+	}
+
+	if len(candidates) > 0 {
+		condition, expressible := candidatesCondition(args, candidates)
+		if !q.topNRefine || !expressible {
+			res.Summary.TopNApproximate = true
+			return
+		}
+
+		logger.With("candidates", len(candidates), "hosts", refineHosts).Info("refining top-N query result")
+		if !q.refineTopN(ctx, res, args, condition, refineHosts, candidates, t) {
+			res.Summary.TopNApproximate = true
+			return
+		}
+		results.By(stmt.SortBy, stmt.Direction, stmt.SortAscending).Sort(res.Rows)
+	}
+
+	if t.unbounded || t.unseenBound() > t.threshold(res.Rows, args.NumResults) {
+		res.Summary.TopNApproximate = true
+	}
+}
+
+// threshold returns the volume of the last top row (zero if there are less than n rows)
+func (t *topNTracker) threshold(rows results.Rows, n uint64) uint64 {
+	if n == 0 || uint64(len(rows)) < n {
+		return 0
+	}
+	return t.value(rows[n-1].Counters)
+}
+
+// refineTopN requests the candidate rows from the hosts which omitted (some of) them and adds the
+// volume of the rows omitted to the result. It returns whether all hosts provided their rows
+func (q *QueryRunner) refineTopN(ctx context.Context, res *results.Result, args *query.Args, condition string, hostList hosts.Hosts, candidates map[results.MergeableAttributes]struct{}, t *topNTracker) bool {
+	refineArgs := *args
+	refineArgs.Condition = condition
+	refineArgs.NumResults = query.MaxResults
+
+	index := make(map[results.MergeableAttributes]int, len(candidates))
+	for i, row := range res.Rows {
+		key := results.MergeableAttributes{Labels: row.Labels, Attributes: row.Attributes}
+		if _, isCandidate := candidates[key]; isCandidate {
+			index[key] = i
+		}
+	}
+
+	answered := 0
+	for hostRes := range q.querier.Query(ctx, hostList, &refineArgs) {
+		p, exists := t.partial[hostRes.Hostname]
+		if hostRes.Err() != nil || !exists {
+			continue
+		}
+		answered++
+
+		for _, row := range hostRes.Rows {
+			key := results.MergeableAttributes{Labels: row.Labels, Attributes: row.Attributes}
+			idx, isCandidate := index[key]
+			if _, returned := p.keys[key]; !isCandidate || returned {
+				continue
+			}
+			res.Rows[idx].Counters.Add(row.Counters)
+		}
+	}
+
+	return answered == len(hostList)
+}
+
+// candidatesCondition returns the condition of the query restricted to the attributes of the candidate
+// rows. This is only possible if all attributes of the query can be expressed as conditions
+func candidatesCondition(args *query.Args, candidates map[results.MergeableAttributes]struct{}) (string, bool) {
+	attributes, _, err := types.ParseQueryType(args.Query)
+	if err != nil || len(attributes) == 0 {
+		return "", false
+	}
+
+	terms := make([]string, 0, len(candidates))
+	for key := range candidates {
+		conds := make([]string, 0, len(attributes))
+		for _, attribute := range attributes {
+			switch attribute.Name() {
+			case types.SIPName:
+				conds = append(conds, fmt.Sprintf("%s = %s", types.SIPName, key.SrcIP))
+			case types.DIPName:
+				conds = append(conds, fmt.Sprintf("%s = %s", types.DIPName, key.DstIP))
+			case types.DportName:
+				conds = append(conds, fmt.Sprintf("%s = %d", types.DportName, key.DstPort))
+			case types.ProtoName:
+				conds = append(conds, fmt.Sprintf("%s = %d", types.ProtoName, key.IPProto))
+			default:
+				return "", false
+			}
+		}
+		terms = append(terms, "("+strings.Join(conds, " & ")+")")
+	}
+	slices.Sort(terms)
+
+	condition := "(" + strings.Join(terms, " | ") + ")"
+	if args.Condition != "" {
+		condition = "(" + args.Condition + ") & " + condition
+	}
+	return condition, true
+}
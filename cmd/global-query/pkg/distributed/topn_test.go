@@ -0,0 +1,125 @@
+package distributed
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/els0r/goProbe/cmd/global-query/pkg/hosts"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// topNQuerier returns the top rows (by bytes) of each host, as limited by the number of results
+type topNQuerier struct {
+	rows map[string]results.Rows
+
+	args []query.Args
+	sync.Mutex
+}
+
+func (q *topNQuerier) Query(_ context.Context, hostList hosts.Hosts, args *query.Args) <-chan *results.Result {
+	q.Lock()
+	q.args = append(q.args, *args)
+	q.Unlock()
+
+	out := make(chan *results.Result, len(hostList))
+	for _, host := range hostList {
+		rows := append(results.Rows{}, q.rows[host]...)
+		results.By(results.SortTraffic, types.DirectionSum, false).Sort(rows)
+
+		res := results.New()
+		res.Hostname = host
+		res.HostsStatuses[host] = results.Status{Code: types.StatusOK}
+		res.Summary.Hits.Total = len(rows)
+		res.Rows = rows[:min(uint64(len(rows)), args.NumResults)]
+		out <- res
+	}
+	close(out)
+	return out
+}
+
+func topNRow(hostname, sip string, bytes uint64) results.Row {
+	return results.Row{
+		Labels:     results.Labels{Hostname: hostname},
+		Attributes: results.Attributes{SrcIP: netip.MustParseAddr(sip)},
+		Counters:   types.Counters{BytesRcvd: bytes},
+	}
+}
+
+func TestTopN(t *testing.T) {
+	// the rows of both results share their labels (e.g. since the same host is queried under
+	// different names), hence they are merged
+	shared := map[string]results.Rows{
+		"hostA": {topNRow("", "10.0.0.1", 10), topNRow("", "10.0.0.2", 9), topNRow("", "10.0.0.3", 1)},
+		"hostB": {topNRow("", "10.0.0.2", 9), topNRow("", "10.0.0.3", 8), topNRow("", "10.0.0.1", 1)},
+	}
+
+	newArgs := func() *query.Args {
+		args := query.NewArgs("sip", "eth0", query.WithFormat(types.FormatJSON), query.WithNumResults(1))
+		args.QueryHosts = "hostA,hostB"
+		return args
+	}
+
+	t.Run("refined", func(t *testing.T) {
+		querier := &topNQuerier{rows: shared}
+		res, err := NewQueryRunner(hosts.NewStringResolver(true), querier, WithTopN(1, true)).Run(context.Background(), newArgs())
+		require.Nil(t, err)
+
+		// 10.0.0.1 (11 bytes) and 10.0.0.2 (18 bytes) were each omitted by one of the hosts and are
+		// completed in the second pass. A row omitted by both hosts could still exceed 18 bytes
+		require.Len(t, querier.args, 2)
+		require.EqualValues(t, 1, querier.args[0].NumResults)
+		require.Equal(t, "((sip = 10.0.0.1) | (sip = 10.0.0.2))", querier.args[1].Condition)
+		require.Len(t, res.Rows, 1)
+		require.Equal(t, netip.MustParseAddr("10.0.0.2"), res.Rows[0].Attributes.SrcIP)
+		require.EqualValues(t, 18, res.Rows[0].Counters.BytesRcvd)
+		require.True(t, res.Summary.TopNApproximate)
+
+		// fetching more rows from each host allows to rule it out
+		querier = &topNQuerier{rows: shared}
+		res, err = NewQueryRunner(hosts.NewStringResolver(true), querier, WithTopN(2, true)).Run(context.Background(), newArgs())
+		require.Nil(t, err)
+		require.Len(t, querier.args, 2)
+		require.EqualValues(t, 2, querier.args[0].NumResults)
+		require.Equal(t, "((sip = 10.0.0.1))", querier.args[1].Condition)
+		require.Len(t, res.Rows, 1)
+		require.EqualValues(t, 18, res.Rows[0].Counters.BytesRcvd)
+		require.False(t, res.Summary.TopNApproximate)
+	})
+
+	t.Run("without refinement", func(t *testing.T) {
+		querier := &topNQuerier{rows: shared}
+		res, err := NewQueryRunner(hosts.NewStringResolver(true), querier, WithTopN(1, false)).Run(context.Background(), newArgs())
+		require.Nil(t, err)
+		require.Len(t, querier.args, 1)
+		require.True(t, res.Summary.TopNApproximate)
+	})
+
+	t.Run("distinct hosts", func(t *testing.T) {
+		// rows of different hosts are never merged, hence the top rows of each host suffice
+		querier := &topNQuerier{rows: map[string]results.Rows{
+			"hostA": {topNRow("hostA", "10.0.0.1", 10), topNRow("hostA", "10.0.0.2", 9), topNRow("hostA", "10.0.0.3", 1)},
+			"hostB": {topNRow("hostB", "10.0.0.2", 9), topNRow("hostB", "10.0.0.3", 8), topNRow("hostB", "10.0.0.1", 1)},
+		}}
+		res, err := NewQueryRunner(hosts.NewStringResolver(true), querier, WithTopN(1, true)).Run(context.Background(), newArgs())
+		require.Nil(t, err)
+		require.Len(t, querier.args, 1)
+		require.Len(t, res.Rows, 1)
+		require.Equal(t, "hostA", res.Rows[0].Labels.Hostname)
+		require.EqualValues(t, 10, res.Rows[0].Counters.BytesRcvd)
+		require.False(t, res.Summary.TopNApproximate)
+	})
+
+	t.Run("ascending", func(t *testing.T) {
+		querier := &topNQuerier{rows: shared}
+		args := newArgs()
+		args.SortAscending = true
+		_, err := NewQueryRunner(hosts.NewStringResolver(true), querier).Run(context.Background(), args)
+		require.Nil(t, err)
+		require.Equal(t, query.DefaultNumResults, querier.args[0].NumResults)
+	})
+}
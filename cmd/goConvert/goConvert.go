@@ -15,22 +15,28 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"io"
 	"io/fs"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	// for metrics export to metricsbeat
 	_ "expvar"
 
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
 	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/convert"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
@@ -44,12 +50,15 @@ import (
 // Config stores the flags provided to the converter
 type Config struct {
 	FilePath      string
+	DBPath        string
 	SavePath      string
 	Iface         string
 	Schema        string
 	NumLines      int
-	EncoderType   int
+	EncoderType   string
+	EncoderLevel  int
 	DBPermissions uint
+	NumWorkers    int
 }
 
 // parameter governing the number of seconds that are covered by a block
@@ -181,17 +190,34 @@ func (c *CSVConverter) parsesIface() bool {
 
 func parseCommandLineArgs(cfg *Config) {
 	flag.StringVar(&cfg.FilePath, "in", "", "CSV file from which the data should be read")
+	flag.StringVar(&cfg.DBPath, "db", "", "Existing goDB which should be converted (instead of reading CSV data)")
 	flag.StringVar(&cfg.SavePath, "out", "", "Folder to which the .gpf files should be written")
 	flag.StringVar(&cfg.Schema, "schema", "", "Structure of CSV file (e.g. \"sip,dip,dport,time\"")
 	flag.StringVar(&cfg.Iface, "iface", "", "Interface from which CSV data was created")
 	flag.IntVar(&cfg.NumLines, "n", 1000, "Number of rows to read from the CSV file")
-	flag.IntVar(&cfg.EncoderType, "encoder", int(encoders.EncoderTypeLZ4), "Encoder type to use for compression")
+	flag.StringVar(&cfg.EncoderType, "encoder", encoders.EncoderTypeLZ4.String(), "Encoder type to use for compression (null, lz4, zstd)")
+	flag.IntVar(&cfg.EncoderLevel, "level", 0, "Compression level of the encoder (uses the encoder's default level if zero)")
 	flag.UintVar(&cfg.DBPermissions, "permissions", 0, "Permissions to use when writing DB (Unix file mode)")
+	flag.IntVar(&cfg.NumWorkers, "workers", runtime.NumCPU(), "Number of directories converted in parallel (goDB conversion only)")
 	flag.Parse()
 }
 
+// parseEncoderType parses the encoder type by its name (e.g. "zstd"). For backward compatibility,
+// the numeric value of the encoder type is accepted as well
+func parseEncoderType(s string) (encoders.Type, error) {
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+		encoderType := encoders.Type(n)
+		if encoderType.IsDeltaPacked() || encoderType.String() == "" {
+			return encoders.EncoderTypeNull, fmt.Errorf("unsupported encoder: %v", s)
+		}
+		return encoderType, nil
+	}
+	return encoders.GetTypeByString(s)
+}
+
 func printUsage(msg string) {
-	fmt.Println(msg + ".\nUsage: ./goConvert -in <input file path> -out <output folder> [-n <number of lines to read> -schema <schema string> -iface <interface>]")
+	fmt.Println(msg + ".\nUsage: ./goConvert -in <input file path> -out <output folder> [-n <number of lines to read> -schema <schema string> -iface <interface>]" +
+		"\n       ./goConvert -db <goDB path> -out <output folder> [-encoder <encoder type> -level <compression level> -workers <number of workers>]")
 }
 
 func main() {
@@ -201,13 +227,26 @@ func main() {
 	parseCommandLineArgs(&config)
 
 	// sanity check the input
-	if config.FilePath == "" || config.SavePath == "" {
+	if (config.FilePath == "" && config.DBPath == "") || config.SavePath == "" {
 		printUsage("Empty path specified")
 		os.Exit(1)
 	}
+	if config.FilePath != "" && config.DBPath != "" {
+		printUsage("Only one of -in and -db may be specified")
+		os.Exit(1)
+	}
+	encoderType, err := parseEncoderType(config.EncoderType)
+	if err != nil {
+		printUsage(fmt.Sprintf("Invalid encoder type: %s", err))
+		os.Exit(1)
+	}
+	if config.EncoderLevel < 0 {
+		printUsage("Compression level must not be negative")
+		os.Exit(1)
+	}
 
 	// get logger
-	err := logging.Init(logging.LevelDebug, logging.EncodingLogfmt,
+	err = logging.Init(logging.LevelDebug, logging.EncodingLogfmt,
 		logging.WithVersion(version.Short()),
 	)
 	if err != nil {
@@ -216,6 +255,23 @@ func main() {
 	}
 	logger := logging.Logger()
 
+	dbPermissions := goDB.DefaultPermissions
+	if config.DBPermissions != 0 {
+		dbPermissions = fs.FileMode(config.DBPermissions)
+	}
+
+	// convert an existing goDB instead of ingesting CSV data
+	if config.DBPath != "" {
+		if err := convertDB(config, encoderType, dbPermissions); err != nil {
+			if errors.Is(err, errConversionInterrupted) {
+				logger.Error("Conversion interrupted, run the same command again to resume")
+				os.Exit(exitCodeInterrupted)
+			}
+			logger.Fatalf("failed to convert goDB %s: %s", config.DBPath, err)
+		}
+		return
+	}
+
 	// open file
 	var file *os.File
 	if file, err = os.Open(config.FilePath); err != nil {
@@ -266,11 +322,6 @@ func main() {
 	// channel for passing flow maps to writer
 	writeChan := make(chan writeJob, 1024)
 
-	dbPermissions := goDB.DefaultPermissions
-	if config.DBPermissions != 0 {
-		dbPermissions = fs.FileMode(config.DBPermissions)
-	}
-
 	// writer routine accepting flow maps to write out
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -278,7 +329,7 @@ func main() {
 		defer wg.Done()
 		for fm := range writeChan {
 			if _, ok := mapWriters[fm.iface]; !ok {
-				mapWriters[fm.iface] = goDB.NewDBWriter(config.SavePath, fm.iface, encoders.Type(config.EncoderType)).Permissions(dbPermissions)
+				mapWriters[fm.iface] = goDB.NewDBWriter(config.SavePath, fm.iface, encoderType).EncoderLevel(config.EncoderLevel).Permissions(dbPermissions)
 			}
 
 			if err = mapWriters[fm.iface].Write(fm.data, capturetypes.CaptureStats{}, fm.tstamp); err != nil {
@@ -463,3 +514,39 @@ func lineCounter(r io.Reader) (int, error) {
 		}
 	}
 }
+
+// exitCodeInterrupted denotes the exit code of an interrupted (i.e. incomplete) goDB conversion,
+// allowing scripts to tell it apart from both a completed and a failed one
+const exitCodeInterrupted = 2
+
+var errConversionInterrupted = errors.New("conversion interrupted")
+
+// convertDB converts the goDB at config.DBPath to config.SavePath. An interrupted conversion
+// (e.g. via SIGINT / SIGTERM) is resumed when running it again with the same paths
+func convertDB(config Config, encoderType encoders.Type, dbPermissions fs.FileMode) error {
+	logger := logging.Logger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Infof("Converting goDB %s to %s using %d workers", config.DBPath, config.SavePath, config.NumWorkers)
+	stats, err := convert.Run(ctx, config.DBPath, config.SavePath,
+		convert.WithEncoderType(encoderType),
+		convert.WithEncoderLevel(config.EncoderLevel),
+		convert.WithPermissions(dbPermissions),
+		convert.WithWorkers(config.NumWorkers),
+		convert.WithProgress(func(p convert.Progress) {
+			fmt.Fprintf(os.Stderr, "\rProgress: %d/%d directories (%.1f%%), elapsed: %s, ETA: %s   ",
+				p.Done, p.Total, float64(p.Done)/float64(p.Total)*100,
+				p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+		}),
+	)
+	fmt.Fprintln(os.Stderr)
+	if stats != nil {
+		logger.Infof("Converted %d directories (%d blocks), skipped %d directories converted previously", stats.Dirs, stats.Blocks, stats.Resumed)
+	}
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w: %w", errConversionInterrupted, err)
+	}
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 	"github.com/els0r/goProbe/pkg/types"
 
 	"bufio"
@@ -318,3 +319,28 @@ func testParsers(t *testing.T) {
 		}
 	}
 }
+
+func TestParseEncoderType(t *testing.T) {
+	for _, c := range []struct {
+		in       string
+		expected encoders.Type
+		valid    bool
+	}{
+		{"lz4", encoders.EncoderTypeLZ4, true},
+		{"ZSTD", encoders.EncoderTypeZSTD, true},
+		{"null", encoders.EncoderTypeNull, true},
+		{"2", encoders.EncoderTypeZSTD, true},
+		{"3", encoders.EncoderTypeLZ4, true},
+		{"xz", encoders.EncoderTypeNull, false},
+		{"42", encoders.EncoderTypeNull, false},
+		{"-1", encoders.EncoderTypeNull, false},
+	} {
+		encoderType, err := parseEncoderType(c.in)
+		if c.valid != (err == nil) {
+			t.Fatalf("unexpected error state for %q: %v", c.in, err)
+		}
+		if encoderType != c.expected {
+			t.Fatalf("unexpected encoder type for %q: want %v, have %v", c.in, c.expected, encoderType)
+		}
+	}
+}
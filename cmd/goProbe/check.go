@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/els0r/goProbe/cmd/goProbe/flags"
+	"github.com/els0r/goProbe/pkg/goDB/check"
+)
+
+// runCheck verifies the integrity of the whole database (`goProbe db check`) and writes the report
+// to w. An error is returned if any inconsistencies were found
+func runCheck(w io.Writer, dbPath string, dbFlags *flags.DBFlags) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var opts []check.Option
+	if dbFlags.Ifaces != "" {
+		opts = append(opts, check.WithIfaces(strings.Split(dbFlags.Ifaces, ",")...))
+	}
+	if dbFlags.Quarantine != "" {
+		opts = append(opts, check.WithQuarantine(dbFlags.Quarantine))
+	}
+
+	report, err := check.Run(ctx, dbPath, opts...)
+	if err != nil {
+		if report == nil {
+			return fmt.Errorf("failed to check %s: %w", dbPath, err)
+		}
+
+		// report what has been checked so far
+		fmt.Fprintf(os.Stderr, "check of %s incomplete: %v\n", dbPath, err)
+	}
+
+	if dbFlags.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+	} else {
+		printCheckReport(w, report)
+	}
+
+	if err != nil {
+		return err
+	}
+	if n := report.NumIssues(); n > 0 {
+		return fmt.Errorf("found %d inconsistencies in %d directories of %s", n, len(report.Corrupt), dbPath)
+	}
+	return nil
+}
+
+func printCheckReport(w io.Writer, report *check.Report) {
+	fmt.Fprintf(w, "checked %d interfaces, %d directories, %d blocks: ", report.NumIfaces, report.NumDirs, report.NumBlocks)
+	if len(report.Corrupt) == 0 {
+		fmt.Fprintln(w, "no inconsistencies found")
+		return
+	}
+	fmt.Fprintf(w, "found %d inconsistencies in %d directories\n", report.NumIssues(), len(report.Corrupt))
+	for _, dir := range report.Corrupt {
+		fmt.Fprintf(w, "\n%s (%d blocks, %d corrupt)\n", dir.Path, dir.NumBlocks, len(dir.CorruptBlocks))
+		for _, issue := range dir.Issues {
+			fmt.Fprintf(w, "  %s\n", issue)
+		}
+		if dir.Quarantine != "" {
+			fmt.Fprintf(w, "  quarantined to %s\n", dir.Quarantine)
+		}
+	}
+	if report.NumQuarantined > 0 {
+		fmt.Fprintf(w, "\nquarantined %d blocks, the consistent blocks have been rewritten\n", report.NumQuarantined)
+	}
+}
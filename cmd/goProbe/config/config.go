@@ -16,12 +16,27 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
 	"github.com/els0r/goProbe/pkg/defaults"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/retention"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/types"
 	jsoniter "github.com/json-iterator/go"
 	"golang.org/x/net/bpf"
 	"golang.org/x/time/rate"
@@ -51,42 +66,234 @@ type validator interface {
 // Config stores goProbe's configuration
 type Config struct {
 	sync.Mutex
-	DB           DBConfig           `json:"db" yaml:"db"`
-	Interfaces   Ifaces             `json:"interfaces" yaml:"interfaces"`
-	SyslogFlows  bool               `json:"syslog_flows" yaml:"syslog_flows"`
-	Logging      LogConfig          `json:"logging" yaml:"logging"`
-	API          *APIConfig         `json:"api" yaml:"api"`
-	LocalBuffers *LocalBufferConfig `json:"local_buffers" yaml:"local_buffers"`
+	DB           DBConfig           `json:"db" yaml:"db" doc:"Local on-disk database configuration"`
+	Interfaces   Ifaces             `json:"interfaces" yaml:"interfaces" doc:"Capture configuration per interface"`
+	SyslogFlows  bool               `json:"syslog_flows" yaml:"syslog_flows" doc:"Enables / disables writing flows to syslog upon writeout"`
+	SyslogFilter string             `json:"syslog_filter" yaml:"syslog_filter" required:"false" doc:"Condition restricting the flows written to syslog (same grammar as goQuery conditions)" example:"! snet = 10.0.0.0/8"`
+	Logging      LogConfig          `json:"logging" yaml:"logging" doc:"Logging configuration"`
+	API          *APIConfig         `json:"api" yaml:"api" required:"false" doc:"API server configuration (the API is disabled if omitted)"`
+	LocalBuffers *LocalBufferConfig `json:"local_buffers" yaml:"local_buffers" required:"false" doc:"Shared local in-memory buffer configuration"`
+	Alerting     *AlertingConfig    `json:"alerting" yaml:"alerting" required:"false" doc:"Built-in alerting configuration (alerting is disabled if omitted)"`
+	TopTalkers   *TopTalkersConfig  `json:"top_talkers" yaml:"top_talkers" required:"false" doc:"Top talker metrics configuration (top talker metrics are disabled if omitted)"`
+
+	ProcessAttribution *ProcessAttributionConfig `json:"process_attribution" yaml:"process_attribution" required:"false" doc:"Attribution of flows to the local processes owning their sockets (disabled if omitted, requires a build with socket tracking support)"`
+	FlowRecords        *FlowRecordsConfig        `json:"flow_records" yaml:"flow_records" required:"false" doc:"NetFlow-style flow records delimited by active / idle timeouts, independent of the DB writeouts (disabled if omitted)"`
+	NetFlow            *NetFlowConfig            `json:"netflow" yaml:"netflow" required:"false" doc:"Export of the flows of each writeout as NetFlow v9 / IPFIX records to a collector (disabled if omitted)"`
+	Replication        *ReplicationConfig        `json:"replication" yaml:"replication" required:"false" doc:"Replication of the live flows to a standby probe taking over if the active one fails (disabled if omitted)"`
 }
 
 // DBConfig stores the local on-disk database configuration
 type DBConfig struct {
-	Path        string      `json:"path" yaml:"path"`
-	EncoderType string      `json:"encoder_type" yaml:"encoder_type"`
-	Permissions fs.FileMode `json:"permissions" yaml:"permissions"`
+	Path         string      `json:"path" yaml:"path" doc:"Path to the database directory" example:"/usr/local/goprobe/db" minLength:"1"`
+	EncoderType  string      `json:"encoder_type" yaml:"encoder_type" doc:"Encoder used to compress data blocks (null, lz4, zstd)" example:"lz4"`
+	EncoderLevel int         `json:"encoder_level" yaml:"encoder_level" required:"false" doc:"Compression level of the encoder (uses the encoder's default level if zero)" example:"3" minimum:"0"`
+	Permissions  fs.FileMode `json:"permissions" yaml:"permissions" doc:"Permissions of files written to the database" example:"420"`
+	Manifest     bool        `json:"manifest" yaml:"manifest" doc:"Enables / disables maintaining a manifest of the database contents" example:"true"`
+	Quotas       Quotas      `json:"quotas" yaml:"quotas" required:"false" doc:"Storage quotas per interface (group), evicting the oldest data once exceeded"`
+	// Retention: the retention policy applying to all interfaces
+	Retention *RetentionConfig `json:"retention" yaml:"retention" required:"false" doc:"Retention policy applying to all interfaces, evicting the oldest data once exceeded (disabled if omitted)"`
+	// MinFreeSpace: the minimum free space of the file system holding the database
+	MinFreeSpace int64 `json:"min_free_space" yaml:"min_free_space" required:"false" doc:"Minimum free space of the file system holding the database required for writeouts, evicting the oldest data if it falls short (writeouts are skipped if that doesn't suffice; in bytes, disabled if zero)" example:"10737418240" minimum:"0"`
+	// QuotaInterval: the minimum interval between two enforcements of the storage quotas
+	QuotaInterval time.Duration `json:"quota_interval" yaml:"quota_interval" required:"false" doc:"Minimum interval between two enforcements of the storage quotas / the retention policy (in nanoseconds, defaults to 1h if zero)" example:"3600000000000" minimum:"0"`
+	Filter        string        `json:"filter" yaml:"filter" required:"false" doc:"Condition restricting the flows written to the database (same grammar as goQuery conditions)" example:"proto = tcp"`
+	Tags          Tags          `json:"tags" yaml:"tags" required:"false" doc:"Flow tags assigned to all flows satisfying their condition during writeout, available as label / filter in queries"`
+	// AdaptiveEncoding: the per-block selection of the encoder
+	AdaptiveEncoding *AdaptiveEncodingConfig `json:"adaptive_encoding" yaml:"adaptive_encoding" required:"false" doc:"Per-block selection of the encoder (null, lz4, zstd) based on the compression ratio achieved on a sample of each block (disabled if omitted, using the encoder_type for all blocks)"`
+	// BlockFrames: the framing of the blocks written to the column files
+	BlockFrames bool `json:"block_frames" yaml:"block_frames" required:"false" doc:"Precedes each block written to the column files with a frame header, allowing to rebuild the metadata of a directory should it get lost (directories written with block frames cannot be read by older releases)" example:"true"`
+}
+
+// AdaptiveEncodingConfig stores the configuration of the per-block selection of the encoder
+type AdaptiveEncodingConfig struct {
+	// CPUBudget: the CPU time which may be spent on the compression of blocks
+	CPUBudget string `json:"cpu_budget" yaml:"cpu_budget" doc:"CPU time which may be spent on compression (low: lz4 only, medium: zstd for blocks it compresses considerably better than lz4, high: zstd)" example:"medium"`
+	// MinBlockSize: the minimum size of a block for it to be compressed
+	MinBlockSize int `json:"min_block_size" yaml:"min_block_size" required:"false" doc:"Minimum size of a block for it to be compressed, smaller blocks are stored uncompressed (in bytes, defaults to 512 if zero)" example:"1024" minimum:"0"`
+}
+
+// AdaptiveEncoding returns the configuration of the adaptive encoding for use with goDB (assumes a
+// validated configuration)
+func (a *AdaptiveEncodingConfig) AdaptiveEncoding() *gpfile.AdaptiveEncoding {
+	if a == nil {
+		return nil
+	}
+	budget, _ := gpfile.GetCPUBudgetByString(a.CPUBudget)
+	return &gpfile.AdaptiveEncoding{
+		CPUBudget:    budget,
+		MinBlockSize: a.MinBlockSize,
+	}
+}
+
+// TagConfig stores a named flow tag
+type TagConfig struct {
+	// Name: the name of the tag
+	Name string `json:"name" yaml:"name" doc:"Name of the tag" example:"voip" minLength:"1"`
+	// Condition: the condition a flow has to satisfy in order to be tagged
+	Condition string `json:"condition" yaml:"condition" doc:"Condition a flow has to satisfy in order to be tagged (same grammar as goQuery conditions)" example:"proto = udp & (dport = 5060 | (dport >= 10000 & dport <= 20000))"`
+}
+
+// Tags stores all flow tags
+type Tags []TagConfig
+
+// QuotaConfig stores a storage quota shared by a group of interfaces
+type QuotaConfig struct {
+	// Ifaces: the interfaces sharing the quota
+	Ifaces []string `json:"ifaces" yaml:"ifaces" doc:"Interfaces sharing the quota" minItems:"1"`
+	// MaxSize: the maximum on-disk size of all data stored for the interfaces
+	MaxSize int64 `json:"max_size" yaml:"max_size" doc:"Maximum on-disk size of all data stored for the interfaces (in bytes)" example:"10737418240" minimum:"1"`
+}
+
+// RetentionConfig stores the retention policy applying to all interfaces
+type RetentionConfig struct {
+	// MaxAge: the maximum age of the data stored
+	MaxAge time.Duration `json:"max_age" yaml:"max_age" required:"false" doc:"Maximum age of the data stored, older days are evicted (in nanoseconds, disabled if zero)" example:"7776000000000000" minimum:"0"`
+	// MaxSize: the maximum on-disk size of all data stored
+	MaxSize int64 `json:"max_size" yaml:"max_size" required:"false" doc:"Maximum on-disk size of all data stored, evicting the oldest days across all interfaces once exceeded (in bytes, disabled if zero)" example:"1099511627776" minimum:"0"`
+}
+
+// Limits returns the maximum age and size of the retention policy (both zero if there is none)
+func (r *RetentionConfig) Limits() (maxAge time.Duration, maxSize int64) {
+	if r == nil {
+		return 0, 0
+	}
+	return r.MaxAge, r.MaxSize
+}
+
+// Quotas stores the storage quotas of all interface groups
+type Quotas []QuotaConfig
+
+// Quotas returns the storage quotas for use with the goDB retention logic
+func (q Quotas) Quotas() []retention.Quota {
+	quotas := make([]retention.Quota, 0, len(q))
+	for _, quota := range q {
+		quotas = append(quotas, retention.Quota{Ifaces: quota.Ifaces, MaxBytes: quota.MaxSize})
+	}
+	return quotas
 }
 
 // CaptureConfig stores the capture / buffer related configuration for an individual interface
 type CaptureConfig struct {
 	// IgnoreVLANs: enables / disables skipping of VLAN-tagged packets
 	IgnoreVLANs bool `json:"ignore_vlans" yaml:"ignore_vlans" doc:"Enables / disables skipping of VLAN-tagged packets on interface" example:"true"`
+	// VLANs: enables / disables recording of the VLAN IDs of flows
+	VLANs bool `json:"vlans" yaml:"vlans" doc:"Enables / disables recording of the 802.1Q VLAN IDs the flows on interface were observed on, stored in the vlan column of the goDB. Directories containing flows observed on a VLAN cannot be read by releases predating the column" example:"true"`
+	// Decapsulation: enables / disables decapsulation of tunneled (GRE / VXLAN / Geneve) traffic
+	Decapsulation bool `json:"decapsulation" yaml:"decapsulation" doc:"Enables / disables decapsulation of tunneled traffic (GRE, VXLAN, Geneve) on interface, recording flows based on the inner IP headers" example:"true"`
+	// NonIPStats: enables / disables counting the frames not carrying an IP layer
+	NonIPStats bool `json:"non_ip_stats" yaml:"non_ip_stats" doc:"Enables / disables counting the frames not carrying an IP layer (e.g. ARP, LLDP, MPLS) on interface by their ethertype, using an additional socket" example:"true"`
+	// MACs: enables / disables recording of the source / destination MAC addresses of flows
+	MACs bool `json:"macs" yaml:"macs" doc:"Enables / disables recording of the source / destination MAC addresses of flows on interface (requires an Ethernet link or flow records carrying them), stored in the smac / dmac columns of the goDB" example:"true"`
+	// TCPFlags: enables / disables recording of the TCP flags of flows
+	TCPFlags bool `json:"tcp_flags" yaml:"tcp_flags" doc:"Enables / disables recording of the (OR-combined) TCP flags of the flows on interface, stored in the flags column of the goDB. Directories containing TCP flags cannot be read by releases predating the column" example:"true"`
+	// DSCP: enables / disables recording of the DSCP of flows
+	DSCP bool `json:"dscp" yaml:"dscp" doc:"Enables / disables recording of the DSCP of the flows on interface, stored in the dscp column of the goDB. Directories containing flows with a non-default DSCP cannot be read by releases predating the column" example:"true"`
+	// DisableOffloads: disables the receive offloads of the interface upon enabling the capture (restoring them once it is closed)
+	DisableOffloads bool `json:"disable_offloads,omitempty" yaml:"disable_offloads,omitempty" required:"false" doc:"Disables generic / large receive offload (GRO / LRO) on interface upon enabling the capture (and enables them again once it is closed), which merge packets prior to them being captured (distorting packet sizes and counts). If not set, enabled offloads are merely reported" example:"true"`
 	// Promisc: enables / disables promiscuous capture mode
 	Promisc bool `json:"promisc" yaml:"promisc" doc:"Enables / disables promiscuous capture mode on interface" example:"true"`
+	// CaptureLength: overrides the number of bytes captured per packet
+	CaptureLength int `json:"capture_length,omitempty" yaml:"capture_length,omitempty" required:"false" doc:"Number of bytes captured per packet (determined automatically from the link type if zero)" example:"128" minimum:"0" maximum:"65535"`
 	// RingBuffer: denotes the kernel ring buffer configuration of this interface
-	RingBuffer *RingBufferConfig `json:"ring_buffer" yaml:"ring_buffer" doc:"Kernel ring buffer configuration for interface"`
+	RingBuffer *RingBufferConfig `json:"ring_buffer" yaml:"ring_buffer" required:"false" doc:"Kernel ring buffer configuration for interface (required unless ingesting flow records or capturing via XDP)"`
+	// Filter: restricts the capture to the packets matching a filter expression
+	Filter string `json:"filter,omitempty" yaml:"filter,omitempty" required:"false" doc:"tcpdump-style filter expression (host, net, port, portrange and proto primitives combined via and / or / not) compiled to BPF and attached to the capture socket, so that non-matching packets are discarded by the kernel (all packets are captured if empty)" example:"not port 22"`
 	// ExtraBPFFilters: allows setting additional BPF filter instructions during capture
-	ExtraBPFFilters []bpf.RawInstruction `json:"extra_bpf_filters" yaml:"extra_bpf_filters" doc:"Extra BPF filter instructions to be applied during capture"`
+	ExtraBPFFilters []bpf.RawInstruction `json:"extra_bpf_filters" yaml:"extra_bpf_filters" required:"false" doc:"Extra BPF filter instructions to be applied during capture"`
+	// Zone: the network zone the interface is attached to
+	Zone string `json:"zone,omitempty" yaml:"zone,omitempty" required:"false" doc:"Network zone the interface is attached to, provided as label in query results" enum:"internal,external,dmz" example:"external"`
+	// ByteAccounting: the basis the traffic volume of the interface is accounted on
+	ByteAccounting string `json:"byte_accounting,omitempty" yaml:"byte_accounting,omitempty" required:"false" doc:"Basis the traffic volume of the interface is accounted on: l2 (frames including the link-layer header as seen by the kernel), l3 (IP packets only, default) or wire (frames including the frame check sequence and VLAN tags, see wire_vlan_tags). It is recorded in the goDB and documented in query results" enum:"l2,l3,wire" example:"wire"`
+	// WireVLANTags: the number of VLAN tags carried by the frames on the wire
+	WireVLANTags int `json:"wire_vlan_tags,omitempty" yaml:"wire_vlan_tags,omitempty" required:"false" doc:"Number of VLAN tags carried by the frames on the wire, accounted for if byte_accounting is wire. Since VLAN tags are usually stripped by the NIC, they cannot be determined from the captured frames" example:"1" minimum:"0" maximum:"2"`
+	// Ingest: ingests flow records exported by a device instead of capturing packets
+	Ingest *IngestConfig `json:"ingest,omitempty" yaml:"ingest,omitempty" required:"false" doc:"Ingestion of the flow records exported by a device (NetFlow v5 / v9, IPFIX or sFlow v5) instead of capturing packets, in which case the interface name merely labels the flows (packet capture if omitted)"`
+	// SourcePortAggregation: tunes the aggregation of the client ports of flows to common service ports
+	SourcePortAggregation *SourcePortAggregationConfig `json:"source_port_aggregation,omitempty" yaml:"source_port_aggregation,omitempty" required:"false" doc:"Tuning of the aggregation of the client (source) ports of flows to common service ports (e.g. 53/udp, 443/tcp), which are discarded by default in order to limit the number of flows"`
+	// XDP: aggregates the flows in kernel space via an eBPF / XDP program instead of capturing packets
+	XDP *XDPConfig `json:"xdp,omitempty" yaml:"xdp,omitempty" required:"false" doc:"Aggregation of the flows in kernel space by an eBPF program attached via XDP instead of capturing packets via AF_PACKET, reducing the CPU load on high-traffic interfaces (packet capture if omitted)"`
+}
+
+// XDPConfig stores the configuration of the aggregation of flows in kernel space via an eBPF / XDP
+// program in lieu of packet capture
+type XDPConfig struct {
+	// Mode: the mode the XDP program is attached in
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty" required:"false" doc:"Mode the XDP program is attached in: native (requires driver support) or generic. If empty, native mode is attempted first, falling back to generic mode" enum:"native,generic" example:"native"`
+	// Egress: enables / disables counting outgoing packets
+	Egress bool `json:"egress" yaml:"egress" required:"false" doc:"Enables / disables counting outgoing packets via an additional eBPF program attached via TCX (requires Linux >= 6.6, since XDP only sees incoming packets)" example:"true"`
+	// MaxFlows: the capacity of the flow map
+	MaxFlows int `json:"max_flows,omitempty" yaml:"max_flows,omitempty" required:"false" doc:"Maximum number of flows aggregated in kernel space in between two polls, beyond which the packets of further flows are dropped (defaults to 65536 if zero)" example:"262144" minimum:"0"`
+	// PollInterval: the interval in which the flow map is drained
+	PollInterval time.Duration `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty" required:"false" doc:"Interval in which the flows aggregated in kernel space are collected (in nanoseconds, defaults to 1s if zero)" example:"1000000000" minimum:"0"`
 }
 
+// SourcePortAggregationConfig stores the tuning of the aggregation of the client (source) ports of flows
+// to common service ports. By default, the client ports of such flows are discarded, aggregating all
+// flows between a client and a service
+type SourcePortAggregationConfig struct {
+	// Keep: the (ranges of) service ports whose flows retain their client port
+	Keep []string `json:"keep,omitempty" yaml:"keep,omitempty" required:"false" doc:"Service ports (or ranges of ports) whose flows retain their client port, e.g. to analyze individual DNS transactions"`
+	// BucketSize: aggregates the client ports into buckets instead of discarding them
+	BucketSize int `json:"bucket_size,omitempty" yaml:"bucket_size,omitempty" required:"false" doc:"Size of the buckets the client ports of all other flows to common service ports are aggregated into (the lowest port of the bucket being recorded), discarded entirely if zero" example:"4096" minimum:"0" maximum:"32768"`
+}
+
+// PortRange denotes an inclusive range of ports
+type PortRange struct {
+	Low, High uint16
+}
+
+// KeptPorts returns the parsed ranges of service ports whose flows retain their client port
+func (s *SourcePortAggregationConfig) KeptPorts() ([]PortRange, error) {
+	ranges := make([]PortRange, 0, len(s.Keep))
+	for _, str := range s.Keep {
+		low, high, isRange := strings.Cut(str, "-")
+		if !isRange {
+			high = low
+		}
+		lowPort, err := strconv.ParseUint(strings.TrimSpace(low), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errorInvalidPortRange, str)
+		}
+		highPort, err := strconv.ParseUint(strings.TrimSpace(high), 10, 16)
+		if err != nil || highPort < lowPort {
+			return nil, fmt.Errorf("%w: %s", errorInvalidPortRange, str)
+		}
+		ranges = append(ranges, PortRange{Low: uint16(lowPort), High: uint16(highPort)})
+	}
+	return ranges, nil
+}
+
+// XDP attach modes
+const (
+	XDPModeNative  = "native"  // XDPModeNative : program attached to the driver
+	XDPModeGeneric = "generic" // XDPModeGeneric : program attached to the network stack
+)
+
+// IngestConfig stores the configuration of the ingestion of flow records exported by a device (e.g. a
+// router) in lieu of packet capture
+type IngestConfig struct {
+	// Listen: the address the datagrams are received on
+	Listen string `json:"listen" yaml:"listen" doc:"Address the NetFlow / IPFIX / sFlow datagrams are received on via UDP (host:port)" example:"0.0.0.0:2055" minLength:"1"`
+	// SamplingRate: the sampling rate of records not announcing one
+	SamplingRate uint64 `json:"sampling_rate,omitempty" yaml:"sampling_rate,omitempty" required:"false" doc:"Sampling rate applied to the NetFlow / IPFIX records not announcing one (unsampled if zero)" example:"1000" minimum:"0"`
+}
+
+// Network zones interfaces can be tagged with
+const (
+	ZoneInternal = "internal" // ZoneInternal : interface attached to an internal network
+	ZoneExternal = "external" // ZoneExternal : interface attached to an external network (e.g. the internet uplink)
+	ZoneDMZ      = "dmz"      // ZoneDMZ : interface attached to a demilitarized zone
+)
+
 // LocalBufferConfig stores the shared local in-memory buffer configuration
 type LocalBufferConfig struct {
 	// SizeLimit denotes the maximum size of the local buffers (globally)
 	// used to continue capturing while the capture is (b)locked
-	SizeLimit int `json:"size_limit" yaml:"size_limit"`
+	SizeLimit int `json:"size_limit" yaml:"size_limit" doc:"Maximum size of the local buffers (globally, in bytes)" example:"67108864" minimum:"1"`
 
 	// NumBuffers denotes the number of buffers (and hence maximum concurrency
 	// of Status() calls). This should be left at default unless absolutely required
-	NumBuffers int `json:"num_buffers" yaml:"num_buffers"`
+	NumBuffers int `json:"num_buffers" yaml:"num_buffers" doc:"Number of local buffers (maximum concurrency of status calls)" example:"1" minimum:"1"`
 }
 
 // RingBufferConfig stores the kernel ring buffer related configuration for an individual interface
@@ -98,37 +305,306 @@ type RingBufferConfig struct {
 	NumBlocks int `json:"num_blocks" yaml:"num_blocks" doc:"Guides how many blocks are part of the ring buffer" example:"4" minimum:"1"`
 }
 
+// Metrics which can be evaluated by alert rules
+const (
+	AlertMetricDropsRate         = "drops_rate"         // AlertMetricDropsRate : packets dropped per second (per interface)
+	AlertMetricPacketsRate       = "packets_rate"       // AlertMetricPacketsRate : packets received per second (per interface)
+	AlertMetricIfaceDown         = "iface_down"         // AlertMetricIfaceDown : 1 if a configured interface is not capturing, 0 otherwise (per interface)
+	AlertMetricSilenceSeconds    = "silence_seconds"    // AlertMetricSilenceSeconds : seconds since the last packet was processed (per interface, once it carried traffic)
+	AlertMetricWriteoutCongested = "writeout_congested" // AlertMetricWriteoutCongested : 1 if writeouts are persistently congested, 0 otherwise
+)
+
+// AlertMetrics lists all metrics which can be evaluated by alert rules
+var AlertMetrics = []string{AlertMetricDropsRate, AlertMetricPacketsRate, AlertMetricIfaceDown, AlertMetricSilenceSeconds, AlertMetricWriteoutCongested}
+
+// AlertOps lists all comparison operators supported by alert rules
+var AlertOps = []string{">", ">=", "<", "<=", "==", "!="}
+
+// AlertRule stores a threshold rule evaluated over one of goProbe's own metrics
+type AlertRule struct {
+	// Name: the (unique) name of the rule
+	Name string `json:"name" yaml:"name" doc:"Unique name of the rule" example:"high-drops" minLength:"1"`
+	// Metric: the metric evaluated by the rule
+	Metric string `json:"metric" yaml:"metric" doc:"Metric evaluated by the rule" enum:"drops_rate,packets_rate,iface_down,silence_seconds,writeout_congested" example:"drops_rate"`
+	// Op: the operator used to compare the metric against the threshold
+	Op string `json:"op" yaml:"op" doc:"Operator used to compare the metric against the threshold" enum:">,>=,<,<=,==,!=" example:">"`
+	// Threshold: the value the metric is compared against
+	Threshold float64 `json:"threshold" yaml:"threshold" doc:"Value the metric is compared against" example:"100"`
+	// For: the duration the condition has to hold before the alert fires
+	For time.Duration `json:"for" yaml:"for" required:"false" doc:"Duration the condition has to hold before the alert fires (in nanoseconds, fires immediately if zero)" example:"60000000000" minimum:"0"`
+	// Ifaces: the interfaces the rule applies to
+	Ifaces []string `json:"ifaces" yaml:"ifaces" required:"false" doc:"Interfaces the rule applies to (all configured interfaces if empty, ignored for global metrics)"`
+}
+
+// AlertRules stores all alert rules
+type AlertRules []AlertRule
+
+// AlertingConfig stores the configuration of the built-in alerting
+type AlertingConfig struct {
+	// Interval: the interval in which the alert rules are evaluated
+	Interval time.Duration `json:"interval" yaml:"interval" required:"false" doc:"Interval in which the alert rules are evaluated (in nanoseconds, defaults to 30s)" example:"30000000000" minimum:"0"`
+	// Rules: the threshold rules to evaluate
+	Rules AlertRules `json:"rules" yaml:"rules" required:"false" doc:"Threshold rules evaluated over goProbe's own metrics"`
+	// Webhooks: the URLs notified whenever an alert fires or resolves
+	Webhooks []string `json:"webhooks" yaml:"webhooks" required:"false" doc:"URLs notified (via HTTP POST) whenever an alert fires or resolves"`
+}
+
+// Flow attributes which can be used as top talker labels
+const (
+	TopTalkersLabelSIP   = "sip"   // TopTalkersLabelSIP : source IP address
+	TopTalkersLabelDIP   = "dip"   // TopTalkersLabelDIP : destination IP address
+	TopTalkersLabelDport = "dport" // TopTalkersLabelDport : destination port
+	TopTalkersLabelProto = "proto" // TopTalkersLabelProto : IP protocol
+)
+
+// TopTalkersLabels lists all flow attributes which can be used as top talker labels
+var TopTalkersLabels = []string{TopTalkersLabelSIP, TopTalkersLabelDIP, TopTalkersLabelDport, TopTalkersLabelProto}
+
+// TopTalkersConfig stores the configuration of the top talker metrics, exposing the largest flows of
+// each interface (as seen during the last writeout) as Prometheus metrics
+type TopTalkersConfig struct {
+	// K: the number of top talkers exposed per interface
+	K int `json:"k" yaml:"k" required:"false" doc:"Number of top talkers exposed per interface (defaults to 10)" example:"10" minimum:"0" maximum:"100"`
+	// Labels: the flow attributes the top talkers are aggregated by
+	Labels []string `json:"labels" yaml:"labels" required:"false" doc:"Flow attributes the top talkers are aggregated by and exposed as labels (sip, dip, dport, proto; all if empty)"`
+}
+
+// ProcessAttributionConfig stores the configuration of the attribution of flows to the local processes
+// (and their cgroups) owning their sockets, stored as process label alongside the flows in the database
+type ProcessAttributionConfig struct {
+	// Ifaces: the interfaces whose flows are attributed
+	Ifaces []string `json:"ifaces" yaml:"ifaces" required:"false" doc:"Interfaces whose flows are attributed to local processes, typically host-internal ones (all configured interfaces if empty)"`
+	// PollInterval: the interval in which the sockets of the local processes are polled
+	PollInterval time.Duration `json:"poll_interval" yaml:"poll_interval" required:"false" doc:"Interval in which the sockets of the local processes are polled (in nanoseconds, defaults to 1s)" example:"1000000000" minimum:"0"`
+}
+
+// FlowRecordsConfig stores the configuration of the NetFlow-style flow records, which are delimited by
+// active / idle timeouts (as opposed to the flows written to the DB, which are delimited by the writeouts)
+type FlowRecordsConfig struct {
+	// ActiveTimeout: the duration after which a record of an active flow is expired
+	ActiveTimeout time.Duration `json:"active_timeout" yaml:"active_timeout" required:"false" doc:"Duration after which the record of an active flow is expired and continued in a new record (in nanoseconds, defaults to 30m)" example:"1800000000000" minimum:"0"`
+	// IdleTimeout: the duration without packets after which the record of a flow is expired
+	IdleTimeout time.Duration `json:"idle_timeout" yaml:"idle_timeout" required:"false" doc:"Duration without packets after which the record of a flow is expired (in nanoseconds, defaults to 15s)" example:"15000000000" minimum:"0"`
+}
+
+// NetFlowConfig stores the configuration of the export of the flows of each writeout as NetFlow v9 / IPFIX
+// records to a collector
+type NetFlowConfig struct {
+	// Collector: the address of the collector the records are sent to
+	Collector string `json:"collector" yaml:"collector" doc:"Address of the collector the records are sent to via UDP (host:port)" example:"collector.example.com:4739" minLength:"1"`
+	// Version: the export protocol version
+	Version int `json:"version" yaml:"version" required:"false" doc:"Export protocol version (9: NetFlow v9, 10: IPFIX; defaults to 10)" example:"10"`
+	// MaxMessageSize: the maximum size of a message (i.e. UDP datagram)
+	MaxMessageSize int `json:"max_message_size" yaml:"max_message_size" required:"false" doc:"Maximum size of a message sent to the collector (in bytes, defaults to 1400)" example:"1400" minimum:"0" maximum:"65507"`
+	// Filter: the condition restricting the flows exported
+	Filter string `json:"filter" yaml:"filter" required:"false" doc:"Condition restricting the flows exported (same grammar as goQuery conditions)" example:"! snet = 10.0.0.0/8"`
+}
+
+// ReplicationConfig stores the configuration of the replication of the live flows between an active and
+// a standby probe
+type ReplicationConfig struct {
+	// Role: the role of the probe on startup
+	Role string `json:"role" yaml:"role" doc:"Role of the probe on startup (the standby doesn't capture until it takes over)" enum:"active,standby" example:"active"`
+	// Listen: the address on which the connections of the peer are accepted
+	Listen string `json:"listen" yaml:"listen" doc:"Address on which the connections of the peer are accepted (host:port)" example:":8146" minLength:"1"`
+	// Peer: the address of the peer
+	Peer string `json:"peer" yaml:"peer" doc:"Address of the peer probe (host:port)" example:"probe-b.example.com:8146" minLength:"1"`
+	// NodeID: the ID of the probe
+	NodeID string `json:"node_id" yaml:"node_id" required:"false" doc:"ID of the probe, breaking ties between active probes (defaults to the hostname and listen address)" example:"probe-a"`
+	// Interval: the interval in which the changes of the flows are sent to the standby
+	Interval time.Duration `json:"interval" yaml:"interval" required:"false" doc:"Interval in which the changes of the flows are sent to the standby (in nanoseconds, defaults to 5s)" example:"5000000000" minimum:"0"`
+	// FailoverTimeout: the duration without contact to the active probe after which the standby takes over
+	FailoverTimeout time.Duration `json:"failover_timeout" yaml:"failover_timeout" required:"false" doc:"Duration without contact to the active probe after which the standby takes over (in nanoseconds, defaults to 30s)" example:"30000000000" minimum:"0"`
+	// TLS: the certificates mutually authenticating the probes
+	TLS ReplicationTLSConfig `json:"tls" yaml:"tls" doc:"Certificates mutually authenticating the probes"`
+}
+
+// ReplicationTLSConfig stores the certificates authenticating the probes to each other. The certificate
+// of a probe must be valid for the host of its address as configured as peer of the other probe (and
+// permit both server and client authentication)
+type ReplicationTLSConfig struct {
+	// CertFile: the certificate of the probe
+	CertFile string `json:"cert_file" yaml:"cert_file" doc:"Path to the certificate of the probe (PEM)" example:"/etc/goprobe/replication.crt" minLength:"1"`
+	// KeyFile: the private key of the certificate
+	KeyFile string `json:"key_file" yaml:"key_file" doc:"Path to the private key of the certificate (PEM)" example:"/etc/goprobe/replication.key" minLength:"1"`
+	// CAFile: the CA certificate(s) issuing the certificates of both probes
+	CAFile string `json:"ca_file" yaml:"ca_file" doc:"Path to the CA certificate(s) issuing the certificates of both probes (PEM)" example:"/etc/goprobe/replication-ca.crt" minLength:"1"`
+}
+
+const (
+	ReplicationRoleActive  = "active"  // ReplicationRoleActive : the probe captures and writes out flows
+	ReplicationRoleStandby = "standby" // ReplicationRoleStandby : the probe receives the flows of the active probe
+)
+
+const (
+	NetFlowVersionV9    = 9  // NetFlowVersionV9 : NetFlow v9
+	NetFlowVersionIPFIX = 10 // NetFlowVersionIPFIX : IPFIX
+
+	MinNetFlowMessageSize = 256   // MinNetFlowMessageSize : 256 bytes (fitting the header and the templates)
+	MaxNetFlowMessageSize = 65507 // MaxNetFlowMessageSize : 65507 bytes (maximum UDP payload)
+)
+
 const (
 	DefaultRingBufferBlockSize   int = 1 * 1024 * 1024  // DefaultRingBufferBlockSize : 1 MB
 	DefaultRingBufferNumBlocks   int = 4                // DefaultRingBufferNumBlocks : 4
 	DefaultLocalBufferSizeLimit  int = 64 * 1024 * 1024 // DefaultLocalBufferSizeLimit : 64 MB (globally, not per interface)
 	DefaultLocalBufferNumBuffers int = 1                // DefaultLocalBufferNumBuffers : 1 (should suffice)
+
+	DefaultAlertingInterval = 30 * time.Second // DefaultAlertingInterval : 30 seconds
+
+	MaxCaptureLength int = 65535 // MaxCaptureLength : 65535 bytes (maximum IP packet size)
+	MaxWireVLANTags  int = 2     // MaxWireVLANTags : 2 VLAN tags (QinQ)
+
+	MaxSourcePortBucketSize = 32768 // MaxSourcePortBucketSize : 32768 ports (i.e. at least two buckets)
+
+	DefaultTopTalkersK = 10  // DefaultTopTalkersK : 10 top talkers per interface
+	MaxTopTalkersK     = 100 // MaxTopTalkersK : 100 top talkers per interface (bounding the metrics' cardinality)
 )
 
+// minLocalBufferSizeLimit denotes the lower bound of the default local buffer size limit on
+// memory-constrained deployments
+const minLocalBufferSizeLimit = 8 * 1024 * 1024
+
+// DefaultLocalBufferSize returns the default size limit of the local buffers given the memory limit
+// of the process (e.g. the one of its control group, unrestricted if zero). On memory-constrained
+// deployments, DefaultLocalBufferSizeLimit is scaled down to 1/16th of the memory limit (but no less
+// than 8 MB)
+func DefaultLocalBufferSize(memLimit uint64) int {
+	if memLimit == 0 || memLimit/16 >= uint64(DefaultLocalBufferSizeLimit) {
+		return DefaultLocalBufferSizeLimit
+	}
+	return max(minLocalBufferSizeLimit, int(memLimit/16))
+}
+
 // Ifaces stores the per-interface configuration
 type Ifaces map[string]CaptureConfig
 
+// Zones returns the network zones of all interfaces tagged with one
+func (i Ifaces) Zones() info.Zones {
+	zones := make(info.Zones)
+	for iface, cfg := range i {
+		if cfg.Zone != "" {
+			zones[iface] = cfg.Zone
+		}
+	}
+	return zones
+}
+
+// ByteAccounting returns the byte accounting basis of all interfaces
+func (i Ifaces) ByteAccounting() info.ByteAccounting {
+	accounting := make(info.ByteAccounting, len(i))
+	for iface, cfg := range i {
+		accounting[iface] = cfg.ByteAccountingBasis()
+	}
+	return accounting
+}
+
+// ByteAccountingBasis returns the basis the traffic volume of the interface is accounted on
+func (c CaptureConfig) ByteAccountingBasis() string {
+	if c.ByteAccounting == "" {
+		return info.ByteAccountingL3
+	}
+	return c.ByteAccounting
+}
+
 // LogConfig stores the logging configuration
 type LogConfig struct {
-	Destination string `json:"destination" yaml:"destination"`
-	Level       string `json:"level" yaml:"level"`
-	Encoding    string `json:"encoding" yaml:"encoding"`
+	Destination string            `json:"destination" yaml:"destination" doc:"Log file or native log sink (journald, syslog, syslog+udp://<host>:<port>, syslog+tcp://<host>:<port>). Logs are written to stdout / stderr if empty" example:"/var/log/goprobe.log"`
+	Level       string            `json:"level" yaml:"level" doc:"Log level (debug, info, warn, error, fatal, panic)" example:"info"`
+	Encoding    string            `json:"encoding" yaml:"encoding" doc:"Log encoding (logfmt, json, plain)" example:"logfmt"`
+	Modules     map[string]string `json:"modules" yaml:"modules" required:"false" doc:"Log levels of individual modules (capture, writeout, api, query), overriding the log level for the respective module" example:"{\"capture\":\"debug\"}"`
 }
 
 // QueryRateLimitConfig contains query rate limiting related config arguments / parameters
 type QueryRateLimitConfig struct {
-	MaxReqPerSecond rate.Limit `json:"max_req_per_sec" yaml:"max_req_per_sec"`
-	MaxBurst        int        `json:"max_burst" yaml:"max_burst"`
+	MaxReqPerSecond rate.Limit `json:"max_req_per_sec" yaml:"max_req_per_sec" doc:"Maximum number of queries per second (rate limiting is disabled if zero)" example:"5" minimum:"0"`
+	MaxBurst        int        `json:"max_burst" yaml:"max_burst" doc:"Maximum burst of queries exceeding the rate limit" example:"10" minimum:"0"`
 }
 
 // APIConfig stores goProbe's API configuration
 type APIConfig struct {
-	Addr           string               `json:"addr" yaml:"addr"`
-	Metrics        bool                 `json:"metrics" yaml:"metrics"`
-	Profiling      bool                 `json:"profiling" yaml:"profiling"`
-	Timeout        int                  `json:"request_timeout" yaml:"request_timeout"`
-	Keys           []string             `json:"keys" yaml:"keys"`
-	QueryRateLimit QueryRateLimitConfig `json:"query_rate_limit" yaml:"query_rate_limit"`
+	Addr           string               `json:"addr" yaml:"addr" doc:"Address the API server listens on (use the prefix unix: for UNIX sockets)" example:"localhost:8145" minLength:"1"`
+	Metrics        bool                 `json:"metrics" yaml:"metrics" doc:"Enables / disables serving of Prometheus metrics" example:"true"`
+	Profiling      bool                 `json:"profiling" yaml:"profiling" doc:"Enables / disables profiling endpoints" example:"false"`
+	Timeout        int                  `json:"request_timeout" yaml:"request_timeout" doc:"Request timeout (in seconds)" example:"30" minimum:"0"`
+	Keys           []string             `json:"keys" yaml:"keys" required:"false" doc:"API keys permitted to access the API (with admin permissions)"`
+	OIDC           *OIDCConfig          `json:"oidc" yaml:"oidc" required:"false" doc:"Validation of bearer tokens issued by an OpenID Connect provider (disabled if omitted)"`
+	QueryRateLimit QueryRateLimitConfig `json:"query_rate_limit" yaml:"query_rate_limit" doc:"Global query rate limit"`
+	QueryDeadline  time.Duration        `json:"query_deadline" yaml:"query_deadline" doc:"Default query deadline after which partial results are returned (in nanoseconds, disabled if zero)" example:"30000000000" minimum:"0"`
+	StoredResults  *StoredResultsConfig `json:"stored_results" yaml:"stored_results" required:"false" doc:"Server-side storage of the results of queries run in the background (disabled if omitted)"`
+	MetadataCache  *MetadataCacheConfig `json:"metadata_cache" yaml:"metadata_cache" required:"false" doc:"In-memory cache of the DB directory structure / metadata used by queries (disabled if omitted)"`
+	QueryPolicies  []QueryPolicyConfig  `json:"query_policies" yaml:"query_policies" required:"false" doc:"Time-of-day dependent resource limits for queries (the first policy in effect applies, queries are unrestricted outside of all policies)"`
+	QueryPool      QueryPoolConfig      `json:"query_pool" yaml:"query_pool" required:"false" doc:"Bounds of the processing units / memory shared by all queries run concurrently"`
+	Projections    []ProjectionConfig   `json:"projections" yaml:"projections" required:"false" doc:"Restrictions of the attributes visible to callers authenticated via the respective API keys / OIDC roles (granted read-only permissions)"`
+}
+
+// ProjectionConfig restricts the attributes / labels visible to the callers authenticated via its
+// keys or OIDC roles (e.g. permitting an application team to see port / protocol aggregations, but never
+// raw IP addresses). Queries referring to other attributes are rejected and all other attributes are
+// removed from results
+type ProjectionConfig struct {
+	Name       string   `json:"name" yaml:"name" doc:"Name of the projection (used as subject of the callers authenticated via its keys)" example:"app-team" minLength:"1"`
+	Attributes []string `json:"attributes" yaml:"attributes" doc:"Visible attributes / labels (as named in queries)" example:"[\"dport\",\"proto\",\"iface\"]" minItems:"1"`
+	Keys       []string `json:"keys" yaml:"keys" required:"false" doc:"API keys the projection applies to"`
+	Roles      []string `json:"roles" yaml:"roles" required:"false" doc:"OIDC roles the projection applies to (unless the caller is granted admin / read-only permissions by other roles)"`
+}
+
+// QueryPoolConfig bounds the resources shared by all queries run concurrently, so that a single
+// (pathological) query can neither starve the capture nor other queries
+type QueryPoolConfig struct {
+	ProcessingUnits            int    `json:"processing_units" yaml:"processing_units" required:"false" doc:"Number of processing units shared by all queries (defaults to the number of usable CPUs minus one if zero)" example:"8" minimum:"0"`
+	MaxProcessingUnitsPerQuery int    `json:"max_processing_units_per_query" yaml:"max_processing_units_per_query" required:"false" doc:"Maximum number of processing units granted to a single query (defaults to half of the pool if zero)" example:"4" minimum:"0"`
+	MaxMemBytesPerQuery        uint64 `json:"max_mem_bytes_per_query" yaml:"max_mem_bytes_per_query" required:"false" doc:"Maximum (estimated) memory occupied by the flows aggregated by a single query (defaults to half of the memory limit of the control group if zero, unrestricted if there is none)" example:"1073741824" minimum:"0"`
+}
+
+// QueryPolicyConfig restricts the resources available to queries during recurring time windows (e.g. during
+// peak capture hours), so that analytics workloads do not jeopardize capture fidelity
+type QueryPolicyConfig struct {
+	Name               string `json:"name" yaml:"name" doc:"Name of the policy (reported in the summary of the queries it applies to)" example:"business-hours" minLength:"1"`
+	Windows            string `json:"windows" yaml:"windows" doc:"Recurring time windows the policy is in effect (semicolon-separated list of optional weekdays / weekday ranges followed by a time of day range)" example:"mon-fri 08:00-18:00" minLength:"1"`
+	TimeZone           string `json:"time_zone" yaml:"time_zone" required:"false" doc:"IANA time zone the windows are evaluated in (defaults to the local time zone)" example:"Europe/Zurich"`
+	MaxProcessingUnits int    `json:"max_processing_units" yaml:"max_processing_units" required:"false" doc:"Maximum number of processing units (parallel block readers) per query (unrestricted if zero)" example:"2" minimum:"0"`
+	MaxMemPct          int    `json:"max_mem_pct" yaml:"max_mem_pct" required:"false" doc:"Maximum percentage of available host memory per query (unrestricted if zero)" example:"20" minimum:"0" maximum:"100"`
+}
+
+// TimeWindows returns the parsed time windows of the policy along with the location they are evaluated in
+func (q QueryPolicyConfig) TimeWindows() (types.TimeWindows, *time.Location, error) {
+	windows, err := types.ParseTimeWindows(q.Windows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if q.TimeZone == "" {
+		return windows, time.Local, nil
+	}
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return windows, loc, nil
+}
+
+// MetadataCacheConfig configures the in-memory cache of the DB directory listings and the metadata of
+// the daily directories, which allows queries to skip reading them from disk on every request
+type MetadataCacheConfig struct {
+	MaxDirs int `json:"max_dirs" yaml:"max_dirs" required:"false" doc:"Maximum number of daily directories (across all interfaces) whose metadata is cached (defaults to 1024 if zero)" example:"1024" minimum:"0"`
+}
+
+// StoredResultsConfig configures the server-side storage of query results, allowing clients to retrieve
+// the results of queries run in the background via a token
+type StoredResultsConfig struct {
+	Dir       string        `json:"dir" yaml:"dir" doc:"Directory the results are stored in" example:"/var/lib/goprobe/results" minLength:"1"`
+	Retention time.Duration `json:"retention" yaml:"retention" required:"false" doc:"Duration for which results are retained after the query completed (in nanoseconds, defaults to 24h if zero)" example:"86400000000000" minimum:"0"`
+}
+
+// OIDCConfig configures the validation of bearer tokens (JWTs) issued by an OpenID Connect provider.
+// The roles stated in a token are mapped to the read-only / admin permissions of the API
+type OIDCConfig struct {
+	Issuer        string   `json:"issuer" yaml:"issuer" doc:"Issuer URL of the OpenID Connect provider (its discovery document must be served below it)" example:"https://sso.example.com/realms/probes" minLength:"1"`
+	Audience      string   `json:"audience" yaml:"audience" doc:"Audience tokens must be issued for" example:"goprobe" minLength:"1"`
+	Scopes        []string `json:"scopes" yaml:"scopes" required:"false" doc:"Scopes tokens must carry"`
+	RoleClaim     string   `json:"role_claim" yaml:"role_claim" required:"false" doc:"Claim stating the roles of the caller (nested claims separated by dots, defaults to roles)" example:"realm_access.roles"`
+	AdminRoles    []string `json:"admin_roles" yaml:"admin_roles" required:"false" doc:"Roles granting admin permissions (e.g. configuration updates)"`
+	ReadOnlyRoles []string `json:"read_only_roles" yaml:"read_only_roles" required:"false" doc:"Roles granting read-only permissions (all valid tokens are granted read-only permissions if empty, unless projections apply to any OIDC roles)"`
 }
 
 // newDefault creates a new configuration struct with default settings
@@ -147,13 +623,61 @@ func newDefault() *Config {
 }
 
 func (l LogConfig) validate() error {
-	return nil
+	if _, _, err := logs.ParseSink(l.Destination); err != nil {
+		return fmt.Errorf("%w: %w", errorInvalidLogDestination, err)
+	}
+	if l.Level != "" {
+		if _, err := logs.ParseLevel(l.Level); err != nil {
+			return fmt.Errorf("%w: %w", errorInvalidLogLevel, err)
+		}
+	}
+	_, err := l.ModuleLevels()
+	return err
+}
+
+// ModuleLevels returns the (parsed) log levels of the individual modules
+func (l LogConfig) ModuleLevels() (map[logs.Module]slog.Level, error) {
+	levels := make(map[logs.Module]slog.Level, len(l.Modules))
+	for name, lvl := range l.Modules {
+		m, err := logs.ParseModule(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errorInvalidLogModule, err)
+		}
+		level, err := logs.ParseLevel(lvl)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errorInvalidLogLevel, err)
+		}
+		levels[m] = level
+	}
+	return levels, nil
 }
 
 var (
-	errorNoAPIAddrSpecified       = errors.New("no API address specified")
-	errorInvalidAPITimeout        = errors.New("the request timeout must be a positive number")
-	errorInvalidAPIQueryRateLimit = errors.New("the query rate limit values must both be positive numbers")
+	errorInvalidLogDestination         = errors.New("invalid log destination")
+	errorInvalidLogLevel               = errors.New("invalid log level")
+	errorInvalidLogModule              = errors.New("invalid log module")
+	errorNoAPIAddrSpecified            = errors.New("no API address specified")
+	errorInvalidAPITimeout             = errors.New("the request timeout must be a positive number")
+	errorInvalidAPIQueryRateLimit      = errors.New("the query rate limit values must both be positive numbers")
+	errorInvalidAPIQueryDeadline       = errors.New("the query deadline must not be negative")
+	errorInvalidOIDCIssuer             = errors.New("the OIDC issuer must be a valid http(s) URL")
+	errorNoOIDCAudience                = errors.New("no OIDC audience specified")
+	errorNoStoredResultsDir            = errors.New("no directory for stored query results specified")
+	errorInvalidStoredResultsRetention = errors.New("the retention of stored query results must not be negative")
+	errorQueryPolicyNoName             = errors.New("query policy name must not be empty")
+	errorQueryPolicyDuplicate          = errors.New("query policy defined more than once")
+	errorQueryPolicyWindows            = errors.New("invalid query policy time windows")
+	errorQueryPolicyLimits             = errors.New("query policy limits must not be negative (and the memory percentage must not exceed 100)")
+	errorQueryPolicyNoLimits           = errors.New("query policy does not restrict any resources")
+	errorQueryPoolLimits               = errors.New("query pool limits must not be negative")
+	errorQueryPoolPerQuery             = errors.New("the processing units per query must not exceed the ones of the query pool")
+	errorProjectionNoName              = errors.New("projection name must not be empty")
+	errorProjectionDuplicate           = errors.New("projection defined more than once")
+	errorProjectionNoAttributes        = errors.New("projection does not permit any attributes")
+	errorProjectionInvalidAttribute    = errors.New("invalid projection attribute (must be a single attribute / label name)")
+	errorProjectionNoCallers           = errors.New("projection does not apply to any API keys / OIDC roles")
+	errorProjectionKeyReused           = errors.New("API key used by more than one projection / without projection")
+	errorProjectionNoOIDC              = errors.New("projection applies to OIDC roles, but OIDC is not configured")
 )
 
 func (a APIConfig) validate() error {
@@ -164,6 +688,9 @@ func (a APIConfig) validate() error {
 		(a.QueryRateLimit.MaxReqPerSecond > 0. && a.QueryRateLimit.MaxBurst <= 0) {
 		return errorInvalidAPIQueryRateLimit
 	}
+	if a.QueryDeadline < 0 {
+		return errorInvalidAPIQueryDeadline
+	}
 	for _, key := range a.Keys {
 		err := checkKeyConstraints(key)
 		if err != nil {
@@ -174,6 +701,140 @@ func (a APIConfig) validate() error {
 	if a.Timeout < 0 {
 		return errorInvalidAPITimeout
 	}
+	if a.StoredResults != nil {
+		if err := a.StoredResults.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateQueryPolicies(a.QueryPolicies); err != nil {
+		return err
+	}
+	if err := a.QueryPool.validate(); err != nil {
+		return err
+	}
+	if err := a.validateProjections(); err != nil {
+		return err
+	}
+	if a.OIDC != nil {
+		return a.OIDC.validate()
+	}
+	return nil
+}
+
+func validateQueryPolicies(policies []QueryPolicyConfig) error {
+	names := make(map[string]struct{}, len(policies))
+	for _, policy := range policies {
+		if policy.Name == "" {
+			return errorQueryPolicyNoName
+		}
+		if _, exists := names[policy.Name]; exists {
+			return fmt.Errorf("%w: %s", errorQueryPolicyDuplicate, policy.Name)
+		}
+		names[policy.Name] = struct{}{}
+
+		if windows, _, err := policy.TimeWindows(); err != nil || len(windows) == 0 {
+			return fmt.Errorf("%s: %w %q", policy.Name, errorQueryPolicyWindows, policy.Windows)
+		}
+		if policy.MaxProcessingUnits < 0 || policy.MaxMemPct < 0 || policy.MaxMemPct > 100 {
+			return fmt.Errorf("%s: %w", policy.Name, errorQueryPolicyLimits)
+		}
+		if policy.MaxProcessingUnits == 0 && policy.MaxMemPct == 0 {
+			return fmt.Errorf("%s: %w", policy.Name, errorQueryPolicyNoLimits)
+		}
+	}
+	return nil
+}
+
+func (a APIConfig) validateProjections() error {
+	var (
+		names = make(map[string]struct{}, len(a.Projections))
+		keys  = make(map[string]struct{}, len(a.Keys))
+	)
+	for _, key := range a.Keys {
+		keys[key] = struct{}{}
+	}
+	for _, projection := range a.Projections {
+		if projection.Name == "" {
+			return errorProjectionNoName
+		}
+		if _, exists := names[projection.Name]; exists {
+			return fmt.Errorf("%w: %s", errorProjectionDuplicate, projection.Name)
+		}
+		names[projection.Name] = struct{}{}
+
+		if len(projection.Attributes) == 0 {
+			return fmt.Errorf("%s: %w", projection.Name, errorProjectionNoAttributes)
+		}
+		for _, attribute := range projection.Attributes {
+			if !isProjectionAttribute(attribute) {
+				return fmt.Errorf("%s: %w: %s", projection.Name, errorProjectionInvalidAttribute, attribute)
+			}
+		}
+
+		if len(projection.Keys) == 0 && len(projection.Roles) == 0 {
+			return fmt.Errorf("%s: %w", projection.Name, errorProjectionNoCallers)
+		}
+		if len(projection.Roles) > 0 && a.OIDC == nil {
+			return fmt.Errorf("%s: %w", projection.Name, errorProjectionNoOIDC)
+		}
+		for _, key := range projection.Keys {
+			if err := checkKeyConstraints(key); err != nil {
+				return err
+			}
+			if _, exists := keys[key]; exists {
+				return fmt.Errorf("%s: %w", projection.Name, errorProjectionKeyReused)
+			}
+			keys[key] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// isProjectionAttribute returns whether the attribute is a single (canonical) attribute / label name,
+// as used in query results. Custom attributes may only be registered at runtime, hence unknown names
+// are accepted
+func isProjectionAttribute(attribute string) bool {
+	switch attribute {
+	case "", types.TagsName, "hostname":
+		return false
+	}
+	if tokens := types.Tokenize(attribute); len(tokens) != 1 || tokens[0] != attribute {
+		return false
+	}
+	if attr, err := types.NewAttribute(attribute); err == nil && attr.Name() != attribute {
+		return false
+	}
+	return true
+}
+
+func (q QueryPoolConfig) validate() error {
+	if q.ProcessingUnits < 0 || q.MaxProcessingUnitsPerQuery < 0 {
+		return errorQueryPoolLimits
+	}
+	if q.ProcessingUnits > 0 && q.MaxProcessingUnitsPerQuery > q.ProcessingUnits {
+		return errorQueryPoolPerQuery
+	}
+	return nil
+}
+
+func (s StoredResultsConfig) validate() error {
+	if s.Dir == "" {
+		return errorNoStoredResultsDir
+	}
+	if s.Retention < 0 {
+		return errorInvalidStoredResultsRetention
+	}
+	return nil
+}
+
+func (o OIDCConfig) validate() error {
+	u, err := url.ParseRequestURI(o.Issuer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %s", errorInvalidOIDCIssuer, o.Issuer)
+	}
+	if o.Audience == "" {
+		return errorNoOIDCAudience
+	}
 	return nil
 }
 
@@ -192,17 +853,304 @@ func (l LocalBufferConfig) validate() error {
 	return nil
 }
 
+var (
+	errorInvalidAlertingInterval = errors.New("the alerting interval must not be negative")
+	errorInvalidWebhook          = errors.New("invalid webhook URL")
+	errorAlertRuleNoName         = errors.New("alert rule name must not be empty")
+	errorAlertRuleDuplicate      = errors.New("alert rule defined more than once")
+	errorAlertRuleMetric         = errors.New("unknown alert rule metric")
+	errorAlertRuleOp             = errors.New("unknown alert rule operator")
+	errorAlertRuleFor            = errors.New("alert rule duration must not be negative")
+)
+
+func (a AlertingConfig) validate() error {
+	if a.Interval < 0 {
+		return errorInvalidAlertingInterval
+	}
+	for _, webhook := range a.Webhooks {
+		u, err := url.ParseRequestURI(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: %s", errorInvalidWebhook, webhook)
+		}
+	}
+	return a.Rules.validate()
+}
+
+func (r AlertRules) validate() error {
+	names := make(map[string]struct{}, len(r))
+	for _, rule := range r {
+		if rule.Name == "" {
+			return errorAlertRuleNoName
+		}
+		if _, exists := names[rule.Name]; exists {
+			return fmt.Errorf("%w: %s", errorAlertRuleDuplicate, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+
+		if !slices.Contains(AlertMetrics, rule.Metric) {
+			return fmt.Errorf("%s: %w %q", rule.Name, errorAlertRuleMetric, rule.Metric)
+		}
+		if !slices.Contains(AlertOps, rule.Op) {
+			return fmt.Errorf("%s: %w %q", rule.Name, errorAlertRuleOp, rule.Op)
+		}
+		if rule.For < 0 {
+			return fmt.Errorf("%s: %w", rule.Name, errorAlertRuleFor)
+		}
+	}
+	return nil
+}
+
+// Validate validates the alert rules
+func (r AlertRules) Validate() error {
+	return r.validate()
+}
+
+var (
+	errorTopTalkersK              = fmt.Errorf("the number of top talkers must be between 0 and %d", MaxTopTalkersK)
+	errorTopTalkersLabel          = errors.New("unknown top talkers label")
+	errorTopTalkersDuplicateLabel = errors.New("top talkers label specified more than once")
+)
+
+var (
+	errorInvalidPollInterval     = errors.New("process attribution poll interval must not be negative")
+	errorProcessAttributionIface = errors.New("process attribution interface must not be empty")
+)
+
+func (p ProcessAttributionConfig) validate() error {
+	if p.PollInterval < 0 {
+		return errorInvalidPollInterval
+	}
+	if slices.Contains(p.Ifaces, "") {
+		return errorProcessAttributionIface
+	}
+	return nil
+}
+
+var errorFlowRecordsTimeout = errors.New("flow record timeouts must not be negative")
+
+func (f FlowRecordsConfig) validate() error {
+	if f.ActiveTimeout < 0 || f.IdleTimeout < 0 {
+		return errorFlowRecordsTimeout
+	}
+	return nil
+}
+
+var (
+	errorInvalidNetFlowCollector   = errors.New("invalid NetFlow collector address")
+	errorInvalidNetFlowVersion     = fmt.Errorf("unsupported NetFlow version (supported: %d, %d)", NetFlowVersionV9, NetFlowVersionIPFIX)
+	errorInvalidNetFlowMessageSize = fmt.Errorf("the NetFlow message size must be between %d and %d", MinNetFlowMessageSize, MaxNetFlowMessageSize)
+	errorInvalidNetFlowFilter      = errors.New("invalid NetFlow filter")
+)
+
+func (n NetFlowConfig) validate() error {
+	if _, _, err := net.SplitHostPort(n.Collector); err != nil {
+		return fmt.Errorf("%w: %w", errorInvalidNetFlowCollector, err)
+	}
+	if n.Version != 0 && n.Version != NetFlowVersionV9 && n.Version != NetFlowVersionIPFIX {
+		return errorInvalidNetFlowVersion
+	}
+	if n.MaxMessageSize != 0 && (n.MaxMessageSize < MinNetFlowMessageSize || n.MaxMessageSize > MaxNetFlowMessageSize) {
+		return errorInvalidNetFlowMessageSize
+	}
+	if n.Filter != "" {
+		if _, err := node.NewFlowFilter(n.Filter); err != nil {
+			return fmt.Errorf("%w: %w", errorInvalidNetFlowFilter, err)
+		}
+	}
+	return nil
+}
+
+var (
+	errorInvalidReplicationRole     = fmt.Errorf("invalid replication role (supported: %s, %s)", ReplicationRoleActive, ReplicationRoleStandby)
+	errorInvalidReplicationAddress  = errors.New("invalid replication address")
+	errorInvalidReplicationInterval = errors.New("the replication interval / failover timeout must not be negative")
+	errorInvalidFailoverTimeout     = errors.New("the failover timeout must exceed the replication interval")
+	errorMissingReplicationTLS      = errors.New("replication requires a certificate, its key and a CA file")
+)
+
+func (r ReplicationConfig) validate() error {
+	if r.Role != ReplicationRoleActive && r.Role != ReplicationRoleStandby {
+		return errorInvalidReplicationRole
+	}
+	for _, addr := range []string{r.Listen, r.Peer} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("%w: %w", errorInvalidReplicationAddress, err)
+		}
+	}
+	if r.Interval < 0 || r.FailoverTimeout < 0 {
+		return errorInvalidReplicationInterval
+	}
+	if r.Interval > 0 && r.FailoverTimeout > 0 && r.FailoverTimeout <= r.Interval {
+		return errorInvalidFailoverTimeout
+	}
+	if r.TLS.CertFile == "" || r.TLS.KeyFile == "" || r.TLS.CAFile == "" {
+		return errorMissingReplicationTLS
+	}
+	return nil
+}
+
+func (t TopTalkersConfig) validate() error {
+	if t.K < 0 || t.K > MaxTopTalkersK {
+		return errorTopTalkersK
+	}
+	for i, label := range t.Labels {
+		if !slices.Contains(TopTalkersLabels, label) {
+			return fmt.Errorf("%w %q", errorTopTalkersLabel, label)
+		}
+		if slices.Contains(t.Labels[:i], label) {
+			return fmt.Errorf("%w: %s", errorTopTalkersDuplicateLabel, label)
+		}
+	}
+	return nil
+}
+
 var (
 	errorNoRingBufferConfig = errors.New("no ring buffer configuration specified")
+	errorInvalidZone        = errors.New("invalid zone (supported: internal, external, dmz)")
+	errorInvalidCaptureLen  = fmt.Errorf("the capture length must be between 0 and %d", MaxCaptureLength)
+	errorInvalidAccounting  = errors.New("invalid byte accounting (supported: l2, l3, wire)")
+	errorInvalidVLANTags    = fmt.Errorf("the number of VLAN tags on the wire must be between 0 and %d", MaxWireVLANTags)
+	errorInvalidFilter      = errors.New("invalid capture filter")
+	errorInvalidPortRange   = errors.New("invalid port range (expected <port> or <low>-<high>)")
+	errorInvalidBucketSize  = fmt.Errorf("the source port bucket size must be between 0 and %d", MaxSourcePortBucketSize)
+	errorInvalidIngestAddr  = errors.New("invalid ingest listen address")
+	errorIngestAccounting   = errors.New("flow records can only be accounted on layer 3 (byte accounting l3)")
+	errorIngestNonIPStats   = errors.New("non-IP frames cannot be counted when ingesting flow records")
+	errorIngestXDP          = errors.New("flow records cannot be ingested when capturing via XDP")
+	errorIngestFilter       = errors.New("capture filters cannot be applied when ingesting flow records")
+	errorInvalidXDPMode     = errors.New("invalid XDP mode (supported: native, generic)")
+	errorInvalidXDPMaxFlows = errors.New("the maximum number of XDP flows must not be negative")
+	errorInvalidXDPPoll     = errors.New("the XDP poll interval must not be negative")
+	errorXDPDecapsulation   = errors.New("tunneled traffic cannot be decapsulated when capturing via XDP")
+	errorXDPMACs            = errors.New("MAC addresses cannot be recorded when capturing via XDP")
+	errorXDPBPFFilters      = errors.New("extra BPF filters cannot be applied when capturing via XDP")
+	errorXDPFilter          = errors.New("capture filters cannot be applied when capturing via XDP")
 )
 
 func (c CaptureConfig) validate() error {
+	switch c.Zone {
+	case "", ZoneInternal, ZoneExternal, ZoneDMZ:
+	default:
+		return fmt.Errorf("%w: %s", errorInvalidZone, c.Zone)
+	}
+	if c.CaptureLength < 0 || c.CaptureLength > MaxCaptureLength {
+		return errorInvalidCaptureLen
+	}
+	switch c.ByteAccounting {
+	case "", info.ByteAccountingL2, info.ByteAccountingL3, info.ByteAccountingWire:
+	default:
+		return fmt.Errorf("%w: %s", errorInvalidAccounting, c.ByteAccounting)
+	}
+	if c.WireVLANTags < 0 || c.WireVLANTags > MaxWireVLANTags {
+		return errorInvalidVLANTags
+	}
+	if c.Filter != "" {
+
+		// The link type (and hence the offset of the IP header) is only known once the capture is
+		// set up, but neither affects whether the expression compiles
+		if _, err := bpffilter.Compile(c.Filter, 0); err != nil {
+			return fmt.Errorf("%w: %w", errorInvalidFilter, err)
+		}
+	}
+	if c.SourcePortAggregation != nil {
+		if err := c.SourcePortAggregation.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Ingest != nil {
+		if c.XDP != nil {
+			return errorIngestXDP
+		}
+		return c.Ingest.validate(c)
+	}
+	if c.XDP != nil {
+		return c.XDP.validate(c)
+	}
 	if c.RingBuffer == nil {
 		return errorNoRingBufferConfig
 	}
 	return c.RingBuffer.validate()
 }
 
+func (s *SourcePortAggregationConfig) validate() error {
+	if _, err := s.KeptPorts(); err != nil {
+		return err
+	}
+	if s.BucketSize < 0 || s.BucketSize > MaxSourcePortBucketSize {
+		return errorInvalidBucketSize
+	}
+	return nil
+}
+
+// Equals compares s to cfg and returns true if all fields are identical
+func (s *SourcePortAggregationConfig) Equals(cfg *SourcePortAggregationConfig) bool {
+	if s == nil || cfg == nil {
+		return s == cfg
+	}
+	return slices.Equal(s.Keep, cfg.Keep) && s.BucketSize == cfg.BucketSize
+}
+
+// validate validates the ingestion of flow records along with the capture configuration cfg it is part of
+func (i *IngestConfig) validate(cfg CaptureConfig) error {
+	if _, _, err := net.SplitHostPort(i.Listen); err != nil {
+		return fmt.Errorf("%w: %w", errorInvalidIngestAddr, err)
+	}
+	if cfg.ByteAccountingBasis() != info.ByteAccountingL3 {
+		return errorIngestAccounting
+	}
+	if cfg.NonIPStats {
+		return errorIngestNonIPStats
+	}
+	if cfg.Filter != "" {
+		return errorIngestFilter
+	}
+	return nil
+}
+
+// Equals compares i to cfg and returns true if all fields are identical
+func (i *IngestConfig) Equals(cfg *IngestConfig) bool {
+	if i == nil || cfg == nil {
+		return i == cfg
+	}
+	return *i == *cfg
+}
+
+// validate validates the capture via XDP along with the capture configuration cfg it is part of
+func (x *XDPConfig) validate(cfg CaptureConfig) error {
+	switch x.Mode {
+	case "", XDPModeNative, XDPModeGeneric:
+	default:
+		return fmt.Errorf("%w: %s", errorInvalidXDPMode, x.Mode)
+	}
+	if x.MaxFlows < 0 {
+		return errorInvalidXDPMaxFlows
+	}
+	if x.PollInterval < 0 {
+		return errorInvalidXDPPoll
+	}
+	if cfg.Decapsulation {
+		return errorXDPDecapsulation
+	}
+	if cfg.MACs {
+		return errorXDPMACs
+	}
+	if len(cfg.ExtraBPFFilters) > 0 {
+		return errorXDPBPFFilters
+	}
+	if cfg.Filter != "" {
+		return errorXDPFilter
+	}
+	return nil
+}
+
+// Equals compares x to cfg and returns true if all fields are identical
+func (x *XDPConfig) Equals(cfg *XDPConfig) bool {
+	if x == nil || cfg == nil {
+		return x == cfg
+	}
+	return *x == *cfg
+}
+
 var (
 	errorRingBufferBlockSize = errors.New("ring buffer block size must be a postive number")
 	errorRingBufferNumBlocks = errors.New("ring buffer num blocks must be a postive number")
@@ -221,19 +1169,29 @@ func (r *RingBufferConfig) validate() error {
 // Equals compares c to cfg and returns true if all fields are identical
 func (c CaptureConfig) Equals(cfg CaptureConfig) bool {
 	return c.Promisc == cfg.Promisc &&
+		c.DisableOffloads == cfg.DisableOffloads &&
+		c.NonIPStats == cfg.NonIPStats &&
+		c.CaptureLength == cfg.CaptureLength &&
+		c.Filter == cfg.Filter &&
+		c.ByteAccounting == cfg.ByteAccounting &&
+		c.WireVLANTags == cfg.WireVLANTags &&
+		c.SourcePortAggregation.Equals(cfg.SourcePortAggregation) &&
+		c.Ingest.Equals(cfg.Ingest) &&
+		c.XDP.Equals(cfg.XDP) &&
 		c.RingBuffer.Equals(cfg.RingBuffer)
 }
 
 // Equals compares r to cfg and returns true if all fields are identical
 func (r *RingBufferConfig) Equals(cfg *RingBufferConfig) bool {
-	if cfg == nil {
-		return false
+	if r == nil || cfg == nil {
+		return r == cfg
 	}
 	return r.BlockSize == cfg.BlockSize && r.NumBlocks == cfg.NumBlocks
 }
 
 var (
 	errorNoInterfacesSpecified = errors.New("no interfaces specified")
+	errorDuplicateIngestAddr   = errors.New("ingest listen address is used by several interfaces")
 )
 
 func (i Ifaces) validate() error {
@@ -241,11 +1199,18 @@ func (i Ifaces) validate() error {
 		return errorNoInterfacesSpecified
 	}
 
+	listenAddrs := make(map[string]string)
 	for iface, cc := range i {
 		err := cc.validate()
 		if err != nil {
 			return fmt.Errorf("%s: %w", iface, err)
 		}
+		if cc.Ingest != nil {
+			if other, exists := listenAddrs[cc.Ingest.Listen]; exists {
+				return fmt.Errorf("%s: %w: %s (%s)", iface, errorDuplicateIngestAddr, cc.Ingest.Listen, other)
+			}
+			listenAddrs[cc.Ingest.Listen] = iface
+		}
 	}
 	return nil
 }
@@ -256,7 +1221,14 @@ func (i Ifaces) Validate() error {
 }
 
 var (
-	errorEmptyDBPath = errors.New("database path must not be empty")
+	errorEmptyDBPath          = errors.New("database path must not be empty")
+	errorInvalidDBFilter      = errors.New("invalid database filter")
+	errorInvalidSyslogFilter  = errors.New("invalid syslog filter")
+	errorInvalidQuotaInterval = errors.New("the quota enforcement interval must not be negative")
+	errorInvalidMinFreeSpace  = errors.New("the minimum free space must not be negative")
+	errorInvalidEncoderLevel  = errors.New("the encoder level must not be negative")
+	errorInvalidCPUBudget     = errors.New("invalid adaptive encoding CPU budget")
+	errorInvalidMinBlockSize  = errors.New("the adaptive encoding minimum block size must not be negative")
 )
 
 func (d DBConfig) validate() error {
@@ -267,6 +1239,127 @@ func (d DBConfig) validate() error {
 	if err != nil {
 		return err
 	}
+	if d.EncoderLevel < 0 {
+		return errorInvalidEncoderLevel
+	}
+	if err := d.AdaptiveEncoding.validate(); err != nil {
+		return err
+	}
+	if d.Filter != "" {
+		if _, err := node.NewFlowFilter(d.Filter); err != nil {
+			return fmt.Errorf("%w: %w", errorInvalidDBFilter, err)
+		}
+	}
+	if err := d.Tags.validate(); err != nil {
+		return err
+	}
+	if d.QuotaInterval < 0 {
+		return errorInvalidQuotaInterval
+	}
+	if d.MinFreeSpace < 0 {
+		return errorInvalidMinFreeSpace
+	}
+	if err := d.Retention.validate(); err != nil {
+		return err
+	}
+	return d.Quotas.validate()
+}
+
+var (
+	errorInvalidRetentionMaxAge  = errors.New("the retention max age must not be negative")
+	errorInvalidRetentionMaxSize = errors.New("the retention max size must not be negative")
+	errorRetentionNoLimit        = errors.New("no max age or max size specified for retention policy")
+)
+
+func (r *RetentionConfig) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxAge < 0 {
+		return errorInvalidRetentionMaxAge
+	}
+	if r.MaxSize < 0 {
+		return errorInvalidRetentionMaxSize
+	}
+	if r.MaxAge == 0 && r.MaxSize == 0 {
+		return errorRetentionNoLimit
+	}
+	return nil
+}
+
+func (a *AdaptiveEncodingConfig) validate() error {
+	if a == nil {
+		return nil
+	}
+	if _, err := gpfile.GetCPUBudgetByString(a.CPUBudget); err != nil {
+		return fmt.Errorf("%w: %w", errorInvalidCPUBudget, err)
+	}
+	if a.MinBlockSize < 0 {
+		return errorInvalidMinBlockSize
+	}
+	return nil
+}
+
+var (
+	errorTagNoName        = errors.New("no name specified for flow tag")
+	errorTagInvalidName   = errors.New("invalid flow tag name (must not contain commas or whitespace)")
+	errorTagDuplicateName = errors.New("flow tag defined more than once")
+	errorTagReservedName  = errors.New("flow tag name is reserved for decapsulated flows")
+	errorTagTooMany       = fmt.Errorf("too many flow tags (maximum: %d)", info.MaxTags)
+	errorInvalidTag       = errors.New("invalid flow tag condition")
+)
+
+func (t Tags) validate() error {
+	if len(t) > info.MaxTags {
+		return errorTagTooMany
+	}
+	seen := make(map[string]struct{})
+	for _, tag := range t {
+		if tag.Name == "" {
+			return errorTagNoName
+		}
+		if strings.ContainsAny(tag.Name, info.TagSep+" \t\n") {
+			return fmt.Errorf("%w: %s", errorTagInvalidName, tag.Name)
+		}
+		if strings.HasPrefix(tag.Name, capturetypes.DecapTagPrefix) {
+			return fmt.Errorf("%w: %s", errorTagReservedName, tag.Name)
+		}
+		if _, exists := seen[tag.Name]; exists {
+			return fmt.Errorf("%w: %s", errorTagDuplicateName, tag.Name)
+		}
+		seen[tag.Name] = struct{}{}
+		if _, err := node.NewFlowFilter(tag.Condition); err != nil {
+			return fmt.Errorf("%w `%s`: %w", errorInvalidTag, tag.Name, err)
+		}
+	}
+	return nil
+}
+
+var (
+	errorQuotaNoInterfaces   = errors.New("no interfaces specified for storage quota")
+	errorQuotaInvalidMaxSize = errors.New("storage quota size must be a positive number")
+	errorQuotaDuplicateIface = errors.New("interface assigned to more than one storage quota")
+)
+
+func (q Quotas) validate() error {
+	seen := make(map[string]struct{})
+	for _, quota := range q {
+		if len(quota.Ifaces) == 0 {
+			return errorQuotaNoInterfaces
+		}
+		if quota.MaxSize <= 0 {
+			return errorQuotaInvalidMaxSize
+		}
+		for _, iface := range quota.Ifaces {
+			if iface == "" {
+				return errorQuotaNoInterfaces
+			}
+			if _, exists := seen[iface]; exists {
+				return fmt.Errorf("%w: %s", errorQuotaDuplicateIface, iface)
+			}
+			seen[iface] = struct{}{}
+		}
+	}
 	return nil
 }
 
@@ -284,6 +1377,12 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.SyslogFilter != "" {
+		if _, err := node.NewFlowFilter(c.SyslogFilter); err != nil {
+			return fmt.Errorf("%w: %w", errorInvalidSyslogFilter, err)
+		}
+	}
+
 	// run all config subsection validators for optional sections
 	optValidators := []validator{}
 	if c.API != nil {
@@ -292,18 +1391,53 @@ func (c *Config) Validate() error {
 	if c.LocalBuffers != nil {
 		optValidators = append(optValidators, c.LocalBuffers)
 	}
+	if c.Alerting != nil {
+		optValidators = append(optValidators, c.Alerting)
+	}
+	if c.TopTalkers != nil {
+		optValidators = append(optValidators, c.TopTalkers)
+	}
+	if c.ProcessAttribution != nil {
+		optValidators = append(optValidators, c.ProcessAttribution)
+	}
+	if c.FlowRecords != nil {
+		optValidators = append(optValidators, c.FlowRecords)
+	}
+	if c.NetFlow != nil {
+		optValidators = append(optValidators, c.NetFlow)
+	}
+	if c.Replication != nil {
+		optValidators = append(optValidators, c.Replication)
+	}
 	for _, section := range optValidators {
 		err := section.validate()
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+
+	// ensure that all value constraints of the schema are met
+	return c.validateSchema()
+}
+
+// ParseOption denotes a functional option for parsing a configuration
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	overrides Overrides
+}
+
+// WithOverrides sets overrides (e.g. from environment variables or command line flags) which take
+// precedence over the values provided in the configuration file
+func WithOverrides(overrides Overrides) ParseOption {
+	return func(o *parseOptions) {
+		o.overrides = overrides
+	}
 }
 
 // ParseFile reads in a configuration from a file at `path`.
 // If provided, fields are overwritten from the default configuration
-func ParseFile(path string) (*Config, error) {
+func ParseFile(path string, opts ...ParseOption) (*Config, error) {
 	fd, err := os.Open(filepath.Clean(path))
 	if err != nil {
 		return nil, err
@@ -314,17 +1448,23 @@ func ParseFile(path string) (*Config, error) {
 		}
 	}()
 
-	return Parse(fd)
+	return Parse(fd, opts...)
 }
 
 var (
 	errorUnmarshalConfig = errors.New("failed to unmarshal config")
 )
 
-// Parse attempts to read the configuration from an io.Reader
-func Parse(src io.Reader) (*Config, error) {
+// Parse attempts to read the configuration from an io.Reader. The precedence of values is (from
+// lowest to highest): defaults, configuration read from src, overrides
+func Parse(src io.Reader, opts ...ParseOption) (*Config, error) {
 	config := newDefault()
 
+	var parseOpts parseOptions
+	for _, opt := range opts {
+		opt(&parseOpts)
+	}
+
 	// Slurp the bytes form the src in order to unmarshal it into JSON or YAML
 	// In order to protect this method from cases where src contains a very large file we limit reading
 	// to a maximum size of <maxConfigSize>
@@ -341,6 +1481,10 @@ func Parse(src io.Reader) (*Config, error) {
 		}
 	}
 
+	if err = config.applyOverrides(parseOpts.overrides); err != nil {
+		return nil, err
+	}
+
 	err = config.Validate()
 	if err != nil {
 		return nil, err
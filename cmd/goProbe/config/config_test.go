@@ -3,11 +3,19 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/els0r/goProbe/pkg/defaults"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/assert"
 )
 
+var testReplicationTLS = ReplicationTLSConfig{
+	CertFile: "/etc/goprobe/replication.crt",
+	KeyFile:  "/etc/goprobe/replication.key",
+	CAFile:   "/etc/goprobe/replication-ca.crt",
+}
+
 func TestValidate(t *testing.T) {
 	var tests = []struct {
 		name        string
@@ -17,21 +25,1134 @@ func TestValidate(t *testing.T) {
 		{"new", newDefault(), errorNoInterfacesSpecified},
 		{"valid config",
 			&Config{
-				DB: DBConfig{
-					Path: defaults.DBPath,
+				DB: DBConfig{
+					Path: defaults.DBPath,
+				},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{
+							BlockSize: 1024 * 1024,
+							NumBlocks: 2,
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{"valid config extended",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
+				API: &APIConfig{
+					Addr: "unix:/var/run/goprobe.sock",
+					Keys: []string{"testtesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttest"},
+				},
+			},
+			nil,
+		},
+		{"empty DB path",
+			&Config{
+				DB: DBConfig{},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{
+							BlockSize: 1024 * 1024,
+							NumBlocks: 2,
+						},
+					},
+				},
+			},
+			errorEmptyDBPath,
+		},
+		{"valid log sink and module levels",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Destination: "syslog+udp://logs.example.com:514", Level: "info", Encoding: "logfmt", Modules: map[string]string{"capture": "debug", "API": "warn"}},
+			},
+			nil,
+		},
+		{"invalid log destination",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Destination: "syslog+tcp://logs.example.com"},
+			},
+			errorInvalidLogDestination,
+		},
+		{"invalid log level",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Level: "verbose"},
+			},
+			errorInvalidLogLevel,
+		},
+		{"unknown log module",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Modules: map[string]string{"dns": "debug"}},
+			},
+			errorInvalidLogModule,
+		},
+		{"invalid log module level",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Modules: map[string]string{"capture": "verbose"}},
+			},
+			errorInvalidLogLevel,
+		},
+		{"no iface config provided",
+			&Config{
+				DB:         DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{},
+			},
+			errorNoInterfacesSpecified,
+		},
+		{"no ring buffer config",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						Promisc: true,
+					},
+				},
+			},
+			errorNoRingBufferConfig,
+		},
+		{"faulty ring buffer config",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{},
+					},
+				},
+			},
+			errorRingBufferBlockSize,
+		},
+		{"faulty ring buffer config: empty num blocks",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024},
+					},
+				},
+			},
+			errorRingBufferNumBlocks,
+		},
+		{"valid zone",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						Zone:       ZoneExternal,
+					},
+				},
+			},
+			nil,
+		},
+		{"invalid zone",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						Zone:       "outside",
+					},
+				},
+			},
+			errorInvalidZone,
+		},
+		{"invalid byte accounting",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer:     &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						ByteAccounting: "l1",
+					},
+				},
+			},
+			errorInvalidAccounting,
+		},
+		{"invalid number of VLAN tags",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer:     &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						ByteAccounting: "wire",
+						WireVLANTags:   3,
+					},
+				},
+			},
+			errorInvalidVLANTags,
+		},
+		{"valid source port aggregation",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer:            &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						SourcePortAggregation: &SourcePortAggregationConfig{Keep: []string{"53", "8000-8999"}, BucketSize: 1024},
+					},
+				},
+			},
+			nil,
+		},
+		{"invalid source port aggregation range",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer:            &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						SourcePortAggregation: &SourcePortAggregationConfig{Keep: []string{"8999-8000"}},
+					},
+				},
+			},
+			errorInvalidPortRange,
+		},
+		{"invalid source port bucket size",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer:            &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						SourcePortAggregation: &SourcePortAggregationConfig{BucketSize: 65536},
+					},
+				},
+			},
+			errorInvalidBucketSize,
+		},
+		{"valid capture filter",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						Filter:     "not port 22 and not (net 10.0.0.0/8 or net fd00::/8)",
+					},
+				},
+			},
+			nil,
+		},
+		{"invalid capture filter",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+						Filter:     "port ssh",
+					},
+				},
+			},
+			errorInvalidFilter,
+		},
+		{"capture filter with ingest",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						Ingest:         &IngestConfig{Listen: ":2055"},
+						ByteAccounting: "l3",
+						Filter:         "not port 22",
+					},
+				},
+			},
+			errorIngestFilter,
+		},
+		{"valid flow record ingestion",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"router0": CaptureConfig{
+						Ingest: &IngestConfig{Listen: "0.0.0.0:2055", SamplingRate: 1000},
+					},
+					"router1": CaptureConfig{
+						Ingest:         &IngestConfig{Listen: "0.0.0.0:6343"},
+						ByteAccounting: "l3",
+					},
+				},
+			},
+			nil,
+		},
+		{"invalid ingest listen address",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"router0": CaptureConfig{
+						Ingest: &IngestConfig{Listen: "2055"},
+					},
+				},
+			},
+			errorInvalidIngestAddr,
+		},
+		{"invalid ingest byte accounting",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"router0": CaptureConfig{
+						Ingest:         &IngestConfig{Listen: ":2055"},
+						ByteAccounting: "l2",
+					},
+				},
+			},
+			errorIngestAccounting,
+		},
+		{"non-IP stats with ingest",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"router0": CaptureConfig{
+						Ingest:     &IngestConfig{Listen: ":2055"},
+						NonIPStats: true,
+					},
+				},
+			},
+			errorIngestNonIPStats,
+		},
+		{"duplicate ingest listen address",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"router0": CaptureConfig{
+						Ingest: &IngestConfig{Listen: ":2055"},
+					},
+					"router1": CaptureConfig{
+						Ingest: &IngestConfig{Listen: ":2055"},
+					},
+				},
+			},
+			errorDuplicateIngestAddr,
+		},
+		{"valid XDP capture",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						XDP: &XDPConfig{Mode: XDPModeNative, Egress: true, MaxFlows: 1 << 18},
+					},
+					"eth1": CaptureConfig{
+						XDP:            &XDPConfig{},
+						ByteAccounting: "wire",
+						NonIPStats:     true,
+					},
+				},
+			},
+			nil,
+		},
+		{"invalid XDP mode",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						XDP: &XDPConfig{Mode: "offload"},
+					},
+				},
+			},
+			errorInvalidXDPMode,
+		},
+		{"XDP with decapsulation",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						XDP:           &XDPConfig{},
+						Decapsulation: true,
+					},
+				},
+			},
+			errorXDPDecapsulation,
+		},
+		{"XDP with MAC addresses",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						XDP:  &XDPConfig{},
+						MACs: true,
+					},
+				},
+			},
+			errorXDPMACs,
+		},
+		{"XDP with ingest",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						XDP:    &XDPConfig{},
+						Ingest: &IngestConfig{Listen: ":2055"},
+					},
+				},
+			},
+			errorIngestXDP,
+		},
+		{"capture filter with XDP",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						XDP:    &XDPConfig{},
+						Filter: "not port 22",
+					},
+				},
+			},
+			errorXDPFilter,
+		},
+		{"missing API addr",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
+				API: &APIConfig{
+					Keys: []string{"testtesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttest"},
+				},
+			},
+			errorNoAPIAddrSpecified,
+		},
+		{"invalid / missing rate limit continuous rate value",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
+				API: &APIConfig{
+					Addr: "unix:/var/run/goprobe.sock",
+					QueryRateLimit: QueryRateLimitConfig{
+						MaxBurst: 3,
+					},
+				},
+			},
+			errorInvalidAPIQueryRateLimit,
+		},
+		{"invalid / missing rate limit burst rate value",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
+				API: &APIConfig{
+					Addr: "unix:/var/run/goprobe.sock",
+					QueryRateLimit: QueryRateLimitConfig{
+						MaxReqPerSecond: 1.0,
+					},
+				},
+			},
+			errorInvalidAPIQueryRateLimit,
+		},
+		{"valid OIDC config",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					OIDC: &OIDCConfig{Issuer: "https://sso.example.com/realms/probes", Audience: "goprobe", AdminRoles: []string{"probe-admin"}},
+				},
+			},
+			nil,
+		},
+		{"invalid OIDC issuer",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					OIDC: &OIDCConfig{Issuer: "sso.example.com", Audience: "goprobe"},
+				},
+			},
+			errorInvalidOIDCIssuer,
+		},
+		{"missing OIDC audience",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					OIDC: &OIDCConfig{Issuer: "https://sso.example.com/realms/probes"},
+				},
+			},
+			errorNoOIDCAudience,
+		},
+		{"valid stored results config",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr:          "localhost:8145",
+					StoredResults: &StoredResultsConfig{Dir: "/var/lib/goprobe/results"},
+				},
+			},
+			nil,
+		},
+		{"missing stored results directory",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr:          "localhost:8145",
+					StoredResults: &StoredResultsConfig{Retention: time.Hour},
+				},
+			},
+			errorNoStoredResultsDir,
+		},
+		{"valid query policies",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					QueryPolicies: []QueryPolicyConfig{
+						{Name: "business-hours", Windows: "mon-fri 08:00-18:00", TimeZone: "Europe/Zurich", MaxProcessingUnits: 2, MaxMemPct: 20},
+						{Name: "backup", Windows: "01:00-03:00", MaxProcessingUnits: 1},
+					},
+				},
+			},
+			nil,
+		},
+		{"duplicate query policy",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					QueryPolicies: []QueryPolicyConfig{
+						{Name: "backup", Windows: "01:00-03:00", MaxProcessingUnits: 1},
+						{Name: "backup", Windows: "04:00-05:00", MaxProcessingUnits: 1},
+					},
+				},
+			},
+			errorQueryPolicyDuplicate,
+		},
+		{"invalid query policy windows",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					QueryPolicies: []QueryPolicyConfig{
+						{Name: "backup", Windows: "1-3", MaxProcessingUnits: 1},
+					},
+				},
+			},
+			errorQueryPolicyWindows,
+		},
+		{"unknown query policy time zone",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					QueryPolicies: []QueryPolicyConfig{
+						{Name: "backup", Windows: "01:00-03:00", TimeZone: "Mars/Olympus", MaxProcessingUnits: 1},
+					},
+				},
+			},
+			errorQueryPolicyWindows,
+		},
+		{"valid query pool",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr:      "localhost:8145",
+					QueryPool: QueryPoolConfig{ProcessingUnits: 4, MaxProcessingUnitsPerQuery: 2, MaxMemBytesPerQuery: 1 << 30},
+				},
+			},
+			nil,
+		},
+		{"negative query pool processing units",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr:      "localhost:8145",
+					QueryPool: QueryPoolConfig{ProcessingUnits: -1},
+				},
+			},
+			errorQueryPoolLimits,
+		},
+		{"query pool per query exceeding pool",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr:      "localhost:8145",
+					QueryPool: QueryPoolConfig{ProcessingUnits: 2, MaxProcessingUnitsPerQuery: 4},
+				},
+			},
+			errorQueryPoolPerQuery,
+		},
+		{"invalid query policy memory limit",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					QueryPolicies: []QueryPolicyConfig{
+						{Name: "backup", Windows: "01:00-03:00", MaxMemPct: 120},
+					},
+				},
+			},
+			errorQueryPolicyLimits,
+		},
+		{"query policy without limits",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					QueryPolicies: []QueryPolicyConfig{
+						{Name: "backup", Windows: "01:00-03:00"},
+					},
+				},
+			},
+			errorQueryPolicyNoLimits,
+		},
+		{"valid projection",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Keys: []string{"a3c9e2f1b0d84e7a9c1f2e3d4b5a6978"},
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"dport", "proto", "iface"}, Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			nil,
+		},
+		{"projection without name",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Attributes: []string{"dport"}, Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			errorProjectionNoName,
+		},
+		{"duplicate projection",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"dport"}, Keys: []string{"a3c9e2f1b0d84e7a9c1f2e3d4b5a6978"}},
+						{Name: "app-team", Attributes: []string{"proto"}, Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			errorProjectionDuplicate,
+		},
+		{"projection without attributes",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			errorProjectionNoAttributes,
+		},
+		{"projection with compound attribute",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"talk_conv"}, Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			errorProjectionInvalidAttribute,
+		},
+		{"projection with attribute alias",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"port"}, Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			errorProjectionInvalidAttribute,
+		},
+		{"projection without callers",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"dport"}},
+					},
+				},
+			},
+			errorProjectionNoCallers,
+		},
+		{"projection key reused",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"},
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"dport"}, Keys: []string{"f0e1d2c3b4a5968778695a4b3c2d1e0f"}},
+					},
+				},
+			},
+			errorProjectionKeyReused,
+		},
+		{"projection roles without OIDC",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				API: &APIConfig{
+					Addr: "localhost:8145",
+					Projections: []ProjectionConfig{
+						{Name: "app-team", Attributes: []string{"dport"}, Roles: []string{"app-team"}},
+					},
+				},
+			},
+			errorProjectionNoOIDC,
+		},
+		{"valid quotas",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Quotas: Quotas{
+					{Ifaces: []string{"eth0"}, MaxSize: 1024},
+					{Ifaces: []string{"eth1", "eth2"}, MaxSize: 2048},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			nil,
+		},
+		{"quota without interfaces",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Quotas: Quotas{
+					{MaxSize: 1024},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorQuotaNoInterfaces,
+		},
+		{"quota without size",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Quotas: Quotas{
+					{Ifaces: []string{"eth0"}},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorQuotaInvalidMaxSize,
+		},
+		{"interface with multiple quotas",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Quotas: Quotas{
+					{Ifaces: []string{"eth0"}, MaxSize: 1024},
+					{Ifaces: []string{"eth1", "eth0"}, MaxSize: 2048},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorQuotaDuplicateIface,
+		},
+		{"negative quota interval",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, QuotaInterval: -time.Minute, Quotas: Quotas{
+					{Ifaces: []string{"eth0"}, MaxSize: 1024},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidQuotaInterval,
+		},
+		{"valid retention",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Retention: &RetentionConfig{MaxAge: 90 * 24 * time.Hour}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			nil,
+		},
+		{"retention without limit",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Retention: &RetentionConfig{}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorRetentionNoLimit,
+		},
+		{"negative retention max age",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Retention: &RetentionConfig{MaxAge: -time.Hour, MaxSize: 1024}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidRetentionMaxAge,
+		},
+		{"negative retention max size",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Retention: &RetentionConfig{MaxSize: -1}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidRetentionMaxSize,
+		},
+		{"negative minimum free space",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, MinFreeSpace: -1},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidMinFreeSpace,
+		},
+		{"negative encoder level",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, EncoderType: "zstd", EncoderLevel: -1},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidEncoderLevel,
+		},
+		{"valid encoder level",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, EncoderType: "zstd", EncoderLevel: 3},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			nil,
+		},
+		{"valid adaptive encoding",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, EncoderType: "lz4", AdaptiveEncoding: &AdaptiveEncodingConfig{CPUBudget: "medium", MinBlockSize: 1024}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			nil,
+		},
+		{"invalid adaptive encoding CPU budget",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, EncoderType: "lz4", AdaptiveEncoding: &AdaptiveEncodingConfig{CPUBudget: "unlimited"}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidCPUBudget,
+		},
+		{"negative adaptive encoding minimum block size",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, EncoderType: "lz4", AdaptiveEncoding: &AdaptiveEncodingConfig{CPUBudget: "low", MinBlockSize: -1}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidMinBlockSize,
+		},
+		{"valid filters",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Filter: "proto = tcp"},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				SyslogFlows:  true,
+				SyslogFilter: "! (snet = 10.0.0.0/8 | dnet = 10.0.0.0/8)",
+			},
+			nil,
+		},
+		{"invalid database filter",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Filter: "dport = 80 &"},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidDBFilter,
+		},
+		{"direction condition in syslog filter",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
 				},
+				SyslogFilter: "dir = in",
+			},
+			errorInvalidSyslogFilter,
+		},
+		{"valid tags",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Tags: Tags{
+					{Name: "voip", Condition: "proto = udp & dport = 5060"}, {Name: "web", Condition: "dport = 443"},
+				}},
 				Interfaces: Ifaces{
 					"eth0": CaptureConfig{
-						RingBuffer: &RingBufferConfig{
-							BlockSize: 1024 * 1024,
-							NumBlocks: 2,
-						},
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
 			},
 			nil,
 		},
-		{"valid config extended",
+		{"tag without name",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Tags: Tags{
+					{Condition: "dport = 443"},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorTagNoName,
+		},
+		{"tag with invalid name",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Tags: Tags{
+					{Name: "voip,web", Condition: "dport = 443"},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorTagInvalidName,
+		},
+		{"tag with reserved name",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Tags: Tags{
+					{Name: "decap:vxlan", Condition: "dport = 443"},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorTagReservedName,
+		},
+		{"duplicate tag",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Tags: Tags{
+					{Name: "web", Condition: "dport = 80"}, {Name: "web", Condition: "dport = 443"},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorTagDuplicateName,
+		},
+		{"direction condition in tag",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath, Tags: Tags{
+					{Name: "inbound", Condition: "dir = in"},
+				}},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+			},
+			errorInvalidTag,
+		},
+		{"valid alerting",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
@@ -39,69 +1160,92 @@ func TestValidate(t *testing.T) {
 						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
-				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
-				API: &APIConfig{
-					Addr: "unix:/var/run/goprobe.sock",
-					Keys: []string{"testtesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttest"},
+				Alerting: &AlertingConfig{
+					Rules: AlertRules{
+						{Name: "high-drops", Metric: AlertMetricDropsRate, Op: ">", Threshold: 100, For: time.Minute},
+						{Name: "down", Metric: AlertMetricIfaceDown, Op: "==", Threshold: 1, Ifaces: []string{"eth0"}},
+					},
+					Webhooks: []string{"https://alerts.example.com/hook"},
 				},
 			},
 			nil,
 		},
-		{"empty DB path",
+		{"duplicate alert rule",
 			&Config{
-				DB: DBConfig{},
+				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
 					"eth0": CaptureConfig{
-						RingBuffer: &RingBufferConfig{
-							BlockSize: 1024 * 1024,
-							NumBlocks: 2,
-						},
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Alerting: &AlertingConfig{
+					Rules: AlertRules{
+						{Name: "high-drops", Metric: AlertMetricDropsRate, Op: ">", Threshold: 100},
+						{Name: "high-drops", Metric: AlertMetricDropsRate, Op: ">", Threshold: 1000},
 					},
 				},
 			},
-			errorEmptyDBPath,
+			errorAlertRuleDuplicate,
 		},
-		{"no iface config provided",
+		{"unknown alert rule metric",
 			&Config{
-				DB:         DBConfig{Path: defaults.DBPath},
-				Interfaces: Ifaces{},
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Alerting: &AlertingConfig{
+					Rules: AlertRules{
+						{Name: "cpu", Metric: "cpu_usage", Op: ">", Threshold: 90},
+					},
+				},
 			},
-			errorNoInterfacesSpecified,
+			errorAlertRuleMetric,
 		},
-		{"no ring buffer config",
+		{"unknown alert rule operator",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
 					"eth0": CaptureConfig{
-						Promisc: true,
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Alerting: &AlertingConfig{
+					Rules: AlertRules{
+						{Name: "high-drops", Metric: AlertMetricDropsRate, Op: "=>", Threshold: 100},
 					},
 				},
 			},
-			errorNoRingBufferConfig,
+			errorAlertRuleOp,
 		},
-		{"faulty ring buffer config",
+		{"invalid webhook",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
 					"eth0": CaptureConfig{
-						RingBuffer: &RingBufferConfig{},
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
+				Alerting: &AlertingConfig{
+					Webhooks: []string{"alerts.example.com/hook"},
+				},
 			},
-			errorRingBufferBlockSize,
+			errorInvalidWebhook,
 		},
-		{"faulty ring buffer config: empty num blocks",
+		{"valid top talkers",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
 					"eth0": CaptureConfig{
-						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024},
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
+				TopTalkers: &TopTalkersConfig{K: 20, Labels: []string{TopTalkersLabelSIP, TopTalkersLabelDport}},
 			},
-			errorRingBufferNumBlocks,
+			nil,
 		},
-		{"missing API addr",
+		{"too many top talkers",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
@@ -109,14 +1253,23 @@ func TestValidate(t *testing.T) {
 						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
-				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
-				API: &APIConfig{
-					Keys: []string{"testtesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttest"},
+				TopTalkers: &TopTalkersConfig{K: MaxTopTalkersK + 1},
+			},
+			errorTopTalkersK,
+		},
+		{"unknown top talkers label",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
 				},
+				TopTalkers: &TopTalkersConfig{Labels: []string{TopTalkersLabelSIP, "iface"}},
 			},
-			errorNoAPIAddrSpecified,
+			errorTopTalkersLabel,
 		},
-		{"invalid / missing rate limit continuous rate value",
+		{"duplicate top talkers label",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
@@ -124,17 +1277,23 @@ func TestValidate(t *testing.T) {
 						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
-				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
-				API: &APIConfig{
-					Addr: "unix:/var/run/goprobe.sock",
-					QueryRateLimit: QueryRateLimitConfig{
-						MaxBurst: 3,
+				TopTalkers: &TopTalkersConfig{Labels: []string{TopTalkersLabelDIP, TopTalkersLabelDIP}},
+			},
+			errorTopTalkersDuplicateLabel,
+		},
+		{"valid NetFlow export",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
+				NetFlow: &NetFlowConfig{Collector: "collector.example.com:4739", Version: NetFlowVersionV9, Filter: "proto = tcp"},
 			},
-			errorInvalidAPIQueryRateLimit,
+			nil,
 		},
-		{"invalid / missing rate limit burst rate value",
+		{"invalid NetFlow collector",
 			&Config{
 				DB: DBConfig{Path: defaults.DBPath},
 				Interfaces: Ifaces{
@@ -142,15 +1301,142 @@ func TestValidate(t *testing.T) {
 						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
-				Logging: LogConfig{Level: "debug", Encoding: "logfmt"},
-				API: &APIConfig{
-					Addr: "unix:/var/run/goprobe.sock",
-					QueryRateLimit: QueryRateLimitConfig{
-						MaxReqPerSecond: 1.0,
+				NetFlow: &NetFlowConfig{Collector: "collector.example.com"},
+			},
+			errorInvalidNetFlowCollector,
+		},
+		{"unsupported NetFlow version",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
 					},
 				},
+				NetFlow: &NetFlowConfig{Collector: "127.0.0.1:2055", Version: 5},
 			},
-			errorInvalidAPIQueryRateLimit,
+			errorInvalidNetFlowVersion,
+		},
+		{"too small NetFlow messages",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				NetFlow: &NetFlowConfig{Collector: "127.0.0.1:2055", MaxMessageSize: MinNetFlowMessageSize - 1},
+			},
+			errorInvalidNetFlowMessageSize,
+		},
+		{"invalid NetFlow filter",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				NetFlow: &NetFlowConfig{Collector: "127.0.0.1:2055", Filter: "proto ="},
+			},
+			errorInvalidNetFlowFilter,
+		},
+		{"valid replication",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Replication: &ReplicationConfig{Role: ReplicationRoleStandby, Listen: ":8146", Peer: "probe-a.example.com:8146", FailoverTimeout: time.Minute, TLS: testReplicationTLS},
+			},
+			nil,
+		},
+		{"invalid replication role",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Replication: &ReplicationConfig{Role: "primary", Listen: ":8146", Peer: "probe-a.example.com:8146"},
+			},
+			errorInvalidReplicationRole,
+		},
+		{"invalid replication peer",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Replication: &ReplicationConfig{Role: ReplicationRoleActive, Listen: ":8146", Peer: "probe-b.example.com"},
+			},
+			errorInvalidReplicationAddress,
+		},
+		{"failover timeout below replication interval",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Replication: &ReplicationConfig{Role: ReplicationRoleActive, Listen: ":8146", Peer: "probe-b.example.com:8146", Interval: time.Minute, FailoverTimeout: time.Second, TLS: testReplicationTLS},
+			},
+			errorInvalidFailoverTimeout,
+		},
+		{"replication without TLS",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				Replication: &ReplicationConfig{Role: ReplicationRoleActive, Listen: ":8146", Peer: "probe-b.example.com:8146",
+					TLS: ReplicationTLSConfig{CertFile: "/etc/goprobe/replication.crt", KeyFile: "/etc/goprobe/replication.key"}},
+			},
+			errorMissingReplicationTLS,
+		},
+		{"valid process attribution",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				ProcessAttribution: &ProcessAttributionConfig{Ifaces: []string{"lo", "docker0"}, PollInterval: 2 * time.Second},
+			},
+			nil,
+		},
+		{"negative process attribution poll interval",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				ProcessAttribution: &ProcessAttributionConfig{PollInterval: -time.Second},
+			},
+			errorInvalidPollInterval,
+		},
+		{"empty process attribution interface",
+			&Config{
+				DB: DBConfig{Path: defaults.DBPath},
+				Interfaces: Ifaces{
+					"eth0": CaptureConfig{
+						RingBuffer: &RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 2},
+					},
+				},
+				ProcessAttribution: &ProcessAttributionConfig{Ifaces: []string{"lo", ""}},
+			},
+			errorProcessAttributionIface,
 		},
 	}
 
@@ -224,3 +1510,27 @@ interfaces:
 		})
 	}
 }
+
+func TestWriteSchema(t *testing.T) {
+	buf := new(strings.Builder)
+	assert.Nil(t, WriteSchema(buf))
+
+	var schema struct {
+		Dialect string                    `json:"$schema"`
+		Ref     string                    `json:"$ref"`
+		Defs    map[string]map[string]any `json:"$defs"`
+	}
+	assert.Nil(t, jsoniter.UnmarshalFromString(buf.String(), &schema))
+	assert.Equal(t, schemaDialect, schema.Dialect)
+	assert.Equal(t, schemaDefsPrefix+"Config", schema.Ref)
+	for _, def := range []string{"Config", "DBConfig", "APIConfig", "CaptureConfig"} {
+		assert.Contains(t, schema.Defs, def)
+	}
+}
+
+func TestDefaultLocalBufferSize(t *testing.T) {
+	assert.Equal(t, DefaultLocalBufferSizeLimit, DefaultLocalBufferSize(0))
+	assert.Equal(t, DefaultLocalBufferSizeLimit, DefaultLocalBufferSize(16*1024*1024*1024))
+	assert.Equal(t, 32*1024*1024, DefaultLocalBufferSize(512*1024*1024))
+	assert.Equal(t, minLocalBufferSizeLimit, DefaultLocalBufferSize(64*1024*1024))
+}
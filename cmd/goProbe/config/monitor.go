@@ -3,6 +3,8 @@ package config
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +20,18 @@ type Monitor struct {
 	config *Config
 
 	reloadInterval time.Duration
+	parseOpts      []ParseOption
+
+	// alert rules set at runtime take precedence over the ones in the config file
+	alertRules AlertRules
+
+	// serializes access to the config file via StoredConfig / StoreConfig (and the watcher)
+	storeMu sync.Mutex
+
+	// watchDebounce enables watching the config file for changes if non-zero. The version of the
+	// config file last applied allows to skip events not changing it
+	watchDebounce  time.Duration
+	appliedVersion string
 
 	sync.RWMutex
 }
@@ -35,17 +49,19 @@ func WithReloadInterval(interval time.Duration) MonitorOption {
 	}
 }
 
-// NewMonitor instantiates a new config monitor and performs an initial read of the
-// provided config file
-func NewMonitor(path string, opts ...MonitorOption) (*Monitor, error) {
-	config, err := ParseFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config file: %w", err)
+// WithParseOptions sets options (e.g. overrides) applied whenever the config file is parsed
+func WithParseOptions(opts ...ParseOption) MonitorOption {
+	return func(m *Monitor) {
+		m.parseOpts = append(m.parseOpts, opts...)
 	}
+}
 
+// NewMonitor instantiates a new config monitor and performs an initial read of the
+// provided config file. If no path is provided, the configuration is assembled from
+// the defaults and the overrides provided via WithParseOptions()
+func NewMonitor(path string, opts ...MonitorOption) (*Monitor, error) {
 	obj := &Monitor{
 		path:           path,
-		config:         config,
 		reloadInterval: defaultReloadInterval,
 	}
 
@@ -54,6 +70,12 @@ func NewMonitor(path string, opts ...MonitorOption) (*Monitor, error) {
 		opt(obj)
 	}
 
+	config, err := obj.parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	obj.config = config
+
 	return obj, nil
 }
 
@@ -80,20 +102,82 @@ func (m *Monitor) PutIfaceConfig(cfg Ifaces) {
 	m.Unlock()
 }
 
+// GetIfaces safely returns the (sorted) names of all configured interfaces
+func (m *Monitor) GetIfaces() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	ifaces := make([]string, 0, len(m.config.Interfaces))
+	for iface := range m.config.Interfaces {
+		ifaces = append(ifaces, iface)
+	}
+	slices.Sort(ifaces)
+
+	return ifaces
+}
+
+// GetAlertingConfig safely returns a copy of the alerting configuration (or nil if alerting
+// is disabled)
+func (m *Monitor) GetAlertingConfig() *AlertingConfig {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.config.Alerting == nil {
+		return nil
+	}
+	cfg := *m.config.Alerting
+	cfg.Rules = slices.Clone(cfg.Rules)
+	cfg.Webhooks = slices.Clone(cfg.Webhooks)
+
+	return &cfg
+}
+
+// PutAlertRules safely updates the alert rules with new ones. The rules take precedence over the
+// ones in the config file (surviving reloads)
+func (m *Monitor) PutAlertRules(rules AlertRules) {
+	if rules == nil {
+		rules = AlertRules{}
+	}
+
+	m.Lock()
+	m.alertRules = rules
+	m.config.putAlertRules(rules)
+	m.Unlock()
+}
+
+func (c *Config) putAlertRules(rules AlertRules) {
+	if rules == nil {
+		return
+	}
+	if c.Alerting == nil {
+		c.Alerting = new(AlertingConfig)
+	}
+	c.Alerting.Rules = rules
+}
+
 // Start initializaes the config monitor background task(s)
 func (m *Monitor) Start(ctx context.Context, fn CallbackFn) {
 	go m.reloadPeriodically(ctx, fn)
+
+	if m.watchDebounce > 0 && m.path != "" {
+		if err := m.watch(ctx, fn); err != nil {
+			logging.FromContext(ctx).Errorf("failed to start config file watcher (relying on periodic reloads): %v", err)
+		}
+	}
 }
 
 // Reload triggers a config reload from disk and triggers the execution of the provided callback (if any)
 func (m *Monitor) Reload(ctx context.Context, fn CallbackFn) (enabled, updated, disabled capturetypes.IfaceChanges, err error) {
-	cfg, perr := ParseFile(m.path)
+	cfg, perr := m.parse()
 	if perr != nil {
-		err = fmt.Errorf("failed to reload config file: %w", err)
+		err = fmt.Errorf("failed to reload config file: %w", perr)
 		return
 	}
 
-	m.PutConfig(cfg)
+	m.Lock()
+	cfg.putAlertRules(m.alertRules)
+	m.config = cfg
+	m.Unlock()
 
 	logging.FromContext(ctx).With("path", m.path).Debugf("config reloaded")
 
@@ -128,6 +212,13 @@ func (m *Monitor) Apply(ctx context.Context, fn CallbackFn) (enabled, updated, d
 
 ////////////////////////////////////////////////////////////////////////
 
+func (m *Monitor) parse() (*Config, error) {
+	if m.path == "" {
+		return Parse(strings.NewReader(""), m.parseOpts...)
+	}
+	return ParseFile(m.path, m.parseOpts...)
+}
+
 func (m *Monitor) reloadPeriodically(ctx context.Context, fn CallbackFn) {
 
 	logger := logging.FromContext(ctx)
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/stretchr/testify/require"
+)
+
+const testMonitorConfig = `db:
+  path: /tmp/goprobe
+interfaces:
+  eth0:
+    ring_buffer:
+      block_size: 1048576
+      num_blocks: 2
+alerting:
+  rules:
+    - name: high-drops
+      metric: drops_rate
+      op: ">"
+      threshold: 100
+`
+
+func TestMonitorAlertRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goprobe.yaml")
+	require.Nil(t, os.WriteFile(path, []byte(testMonitorConfig), 0600))
+
+	m, err := NewMonitor(path)
+	require.Nil(t, err)
+	require.Equal(t, []string{"eth0"}, m.GetIfaces())
+	require.Len(t, m.GetAlertingConfig().Rules, 1)
+
+	// rules set at runtime survive reloads of the config file
+	rules := AlertRules{{Name: "down", Metric: AlertMetricIfaceDown, Op: "==", Threshold: 1}}
+	m.PutAlertRules(rules)
+	_, _, _, err = m.Reload(context.Background(), nil)
+	require.Nil(t, err)
+	require.Equal(t, rules, m.GetAlertingConfig().Rules)
+
+	// the returned config is a copy
+	m.GetAlertingConfig().Rules[0].Threshold = 0
+	require.Equal(t, 1., m.GetAlertingConfig().Rules[0].Threshold)
+}
+
+func TestMonitorStoreConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goprobe.yaml")
+	require.Nil(t, os.WriteFile(path, []byte(testMonitorConfig), 0600))
+
+	m, err := NewMonitor(path)
+	require.Nil(t, err)
+
+	cfg, version, err := m.StoredConfig()
+	require.Nil(t, err)
+	require.NotEmpty(t, version)
+
+	var applied Ifaces
+	callback := func(_ context.Context, ifaces Ifaces) (enabled, updated, disabled capturetypes.IfaceChanges, err error) {
+		applied = ifaces
+		return
+	}
+
+	cfg.Interfaces["eth1"] = CaptureConfig{RingBuffer: &RingBufferConfig{BlockSize: 1048576, NumBlocks: 4}}
+
+	// updates based on an outdated version are rejected
+	_, _, _, _, err = m.StoreConfig(context.Background(), cfg, "outdated", callback)
+	require.ErrorIs(t, err, ErrVersionMismatch)
+
+	// invalid configurations are rejected
+	invalid, _, err := m.StoredConfig()
+	require.Nil(t, err)
+	invalid.Interfaces["eth1"] = CaptureConfig{}
+	_, _, _, _, err = m.StoreConfig(context.Background(), invalid, version, callback)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.Nil(t, applied)
+
+	newVersion, _, _, _, err := m.StoreConfig(context.Background(), cfg, version, callback)
+	require.Nil(t, err)
+	require.NotEqual(t, version, newVersion)
+	require.Equal(t, []string{"eth0", "eth1"}, m.GetIfaces())
+	require.Equal(t, m.GetConfig().Interfaces, applied)
+
+	// the stored configuration is read back as provided
+	stored, storedVersion, err := m.StoredConfig()
+	require.Nil(t, err)
+	require.Equal(t, newVersion, storedVersion)
+	require.Equal(t, cfg.Interfaces, stored.Interfaces)
+	require.Equal(t, cfg.Alerting, stored.Alerting)
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// configurations not backed by a file cannot be stored
+	m = &Monitor{config: cfg}
+	_, _, err = m.StoredConfig()
+	require.ErrorIs(t, err, ErrNoConfigFile)
+	_, _, _, _, err = m.StoreConfig(context.Background(), cfg, AnyVersion, callback)
+	require.ErrorIs(t, err, ErrNoConfigFile)
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix denotes the prefix of all environment variables overriding configuration options
+const EnvPrefix = "GOPROBE_"
+
+const overrideKeySep = "."
+
+// Overrides stores values overriding configuration options, keyed by the (dot-separated) path
+// of the option, e.g. "db.path" or "api.query_rate_limit.max_burst"
+//
+// Scalar options are provided in their string representation (durations as e.g. "30s", permissions
+// in octal notation, lists as comma-separated values). Options holding complex values (such as the
+// interfaces) are provided as YAML / JSON document
+type Overrides map[string]string
+
+type overridableOption struct {
+	key   string
+	index []int
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	fileModeType = reflect.TypeOf(fs.FileMode(0))
+)
+
+// OverridableOptions returns the keys of all configuration options that can be overridden
+func OverridableOptions() []string {
+	options := overridableOptions()
+	keys := make([]string, 0, len(options))
+	for _, opt := range options {
+		keys = append(keys, opt.key)
+	}
+	return keys
+}
+
+// EnvKey returns the name of the environment variable overriding a configuration option, e.g.
+// GOPROBE_DB_PATH for "db.path"
+func EnvKey(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, overrideKeySep, "_"))
+}
+
+// OverridesFromEnv collects the overrides of all configuration options provided via environment
+// variables
+func OverridesFromEnv() Overrides {
+	overrides := make(Overrides)
+	for _, key := range OverridableOptions() {
+		if val, exists := os.LookupEnv(EnvKey(key)); exists {
+			overrides[key] = val
+		}
+	}
+	return overrides
+}
+
+// Merge returns the combination of o and other, where values from other take precedence
+func (o Overrides) Merge(other Overrides) Overrides {
+	merged := make(Overrides, len(o)+len(other))
+	for k, v := range o {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// applyOverrides sets all overridden configuration options
+func (c *Config) applyOverrides(o Overrides) error {
+	options := make(map[string][]int)
+	for _, opt := range overridableOptions() {
+		options[opt.key] = opt.index
+	}
+
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		index, exists := options[key]
+		if !exists {
+			return fmt.Errorf("cannot override unknown configuration option %q", key)
+		}
+		if err := setOverride(fieldByIndexAlloc(reflect.ValueOf(c).Elem(), index), o[key]); err != nil {
+			return fmt.Errorf("invalid override for configuration option %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// overridableOptions walks the configuration and returns all (leaf) options, descending into
+// (optional) sections
+func overridableOptions() []overridableOption {
+	return collectOptions(reflect.TypeOf(Config{}), "", nil)
+}
+
+func collectOptions(t reflect.Type, prefix string, index []int) (options []overridableOption) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || field.Anonymous || name == "" || name == "-" {
+			continue
+		}
+
+		key, fieldIndex := prefix+name, append(slices.Clone(index), i)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			options = append(options, collectOptions(fieldType, key+overrideKeySep, fieldIndex)...)
+			continue
+		}
+		options = append(options, overridableOption{key: key, index: fieldIndex})
+	}
+	return
+}
+
+// fieldByIndexAlloc returns the nested field denoted by index, allocating (optional) sections on the way
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v
+}
+
+func setOverride(v reflect.Value, s string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case fileModeType:
+		mode, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			return err
+		}
+		v.SetUint(mode)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			var elems []string
+			for _, elem := range strings.Split(s, ",") {
+				if elem = strings.TrimSpace(elem); elem != "" {
+					elems = append(elems, elem)
+				}
+			}
+			v.Set(reflect.ValueOf(elems).Convert(v.Type()))
+			return nil
+		}
+		return setDocument(v, s)
+	default:
+		return setDocument(v, s)
+	}
+	return nil
+}
+
+// setDocument decodes a YAML / JSON document into v (replacing any previous value)
+func setDocument(v reflect.Value, s string) error {
+	decoded := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(s), decoded.Interface()); err != nil {
+		return err
+	}
+	v.Set(decoded.Elem())
+	return nil
+}
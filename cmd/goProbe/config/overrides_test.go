@@ -0,0 +1,107 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const overridesTestConfig = `db:
+  path: /var/lib/goprobe/goprobe.db
+interfaces:
+  eth0:
+    ring_buffer:
+      block_size: 1048576
+      num_blocks: 2
+api:
+  addr: localhost:8145
+`
+
+const (
+	testKey1 = "testtesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttest"
+	testKey2 = "abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"
+)
+
+func TestOverridableOptions(t *testing.T) {
+	options := OverridableOptions()
+	for _, expected := range []string{
+		"db.path",
+		"interfaces",
+		"api.addr",
+		"api.query_rate_limit.max_burst",
+		"local_buffers.num_buffers",
+	} {
+		require.Contains(t, options, expected)
+	}
+	require.NotContains(t, options, "api")
+
+	require.Equal(t, "GOPROBE_DB_PATH", EnvKey("db.path"))
+	require.Equal(t, "GOPROBE_API_QUERY_RATE_LIMIT_MAX_BURST", EnvKey("api.query_rate_limit.max_burst"))
+}
+
+func TestOverrides(t *testing.T) {
+	t.Setenv(EnvKey("db.path"), "/tmp/env")
+	t.Setenv(EnvKey("api.addr"), "localhost:9000")
+	t.Setenv(EnvKey("api.query_deadline"), "10s")
+	t.Setenv(EnvKey("db.permissions"), "0640")
+
+	// flags take precedence over the environment
+	overrides := OverridesFromEnv().Merge(Overrides{
+		"db.path":                              "/tmp/flag",
+		"api.keys":                             testKey1 + ", " + testKey2,
+		"api.query_rate_limit.max_burst":       "5",
+		"api.query_rate_limit.max_req_per_sec": "2.5",
+		"local_buffers.num_buffers":            "2",
+		"local_buffers.size_limit":             "1024",
+	})
+
+	cfg, err := Parse(strings.NewReader(overridesTestConfig), WithOverrides(overrides))
+	require.Nil(t, err)
+
+	require.Equal(t, "/tmp/flag", cfg.DB.Path)
+	require.EqualValues(t, 0640, cfg.DB.Permissions)
+	require.Equal(t, "localhost:9000", cfg.API.Addr)
+	require.Equal(t, 10*time.Second, cfg.API.QueryDeadline)
+	require.Equal(t, []string{testKey1, testKey2}, cfg.API.Keys)
+	require.Equal(t, 5, cfg.API.QueryRateLimit.MaxBurst)
+	require.EqualValues(t, 2.5, cfg.API.QueryRateLimit.MaxReqPerSecond)
+	require.NotNil(t, cfg.LocalBuffers)
+	require.Equal(t, 2, cfg.LocalBuffers.NumBuffers)
+
+	// options that aren't overridden retain their value from the configuration file
+	require.Equal(t, 2, cfg.Interfaces["eth0"].RingBuffer.NumBlocks)
+}
+
+func TestOverridesWithoutConfigFile(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(""), WithOverrides(Overrides{
+		"interfaces": `{"eth1": {"promisc": true, "ring_buffer": {"block_size": 1048576, "num_blocks": 4}}}`,
+	}))
+	require.Nil(t, err)
+	require.True(t, cfg.Interfaces["eth1"].Promisc)
+	require.Equal(t, 4, cfg.Interfaces["eth1"].RingBuffer.NumBlocks)
+}
+
+func TestOverridesInvalid(t *testing.T) {
+	var tests = []struct {
+		name      string
+		overrides Overrides
+	}{
+		{"unknown option", Overrides{"db.unknown": "test"}},
+		{"section", Overrides{"api": "test"}},
+		{"invalid integer", Overrides{"api.request_timeout": "ten"}},
+		{"invalid duration", Overrides{"api.query_deadline": "10"}},
+		{"invalid permissions", Overrides{"db.permissions": "0999"}},
+		{"invalid document", Overrides{"interfaces": "[eth0"}},
+		{"schema violation", Overrides{"local_buffers.num_buffers": "0"}},
+		{"negative timeout", Overrides{"api.request_timeout": "-1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(overridesTestConfig), WithOverrides(test.overrides))
+			require.NotNil(t, err)
+		})
+	}
+}
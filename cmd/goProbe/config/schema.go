@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	schemaDefsPrefix = "#/$defs/"
+	schemaDialect    = "https://json-schema.org/draft/2020-12/schema"
+)
+
+var errorSchemaValidation = errors.New("configuration violates schema")
+
+// schema generates the JSON schema of the configuration (along with the registry holding
+// the schema definitions it references)
+func schema() (huma.Registry, *huma.Schema) {
+	registry := huma.NewMapRegistry(schemaDefsPrefix, huma.DefaultSchemaNamer)
+	return registry, registry.Schema(reflect.TypeOf(Config{}), true, "")
+}
+
+// WriteSchema writes the JSON schema of the configuration to w
+func WriteSchema(w io.Writer) error {
+	registry, s := schema()
+
+	// encoding/json is used since it re-indents the output of the schema's custom marshaller
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"$schema": schemaDialect,
+		"$ref":    s.Ref,
+		"$defs":   registry.Map(),
+	})
+}
+
+// validateSchema validates the configuration against its JSON schema
+func (c *Config) validateSchema() error {
+	b, err := jsoniter.Marshal(c)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := jsoniter.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	registry, s := schema()
+	res := &huma.ValidateResult{}
+	huma.Validate(registry, s, huma.NewPathBuffer([]byte{}, 0), huma.ModeWriteToServer, dropNulls(doc), res)
+	if len(res.Errors) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(res.Errors))
+	for _, err := range res.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("%w: %s", errorSchemaValidation, strings.Join(msgs, "; "))
+}
+
+// dropNulls removes all null values from a generic JSON document, since unset optional sections
+// are omitted (as opposed to being null) in a configuration file
+func dropNulls(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, elem := range val {
+			if elem == nil {
+				delete(val, k)
+				continue
+			}
+			val[k] = dropNulls(elem)
+		}
+	case []any:
+		for i, elem := range val {
+			val[i] = dropNulls(elem)
+		}
+	}
+	return v
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// AnyVersion denotes that a stored configuration is to be replaced regardless of its version
+const AnyVersion = "*"
+
+var (
+	// ErrNoConfigFile denotes that the configuration is not backed by a file (and hence cannot be stored)
+	ErrNoConfigFile = errors.New("configuration is not backed by a file")
+
+	// ErrVersionMismatch denotes that the stored configuration was modified since the version an
+	// update was based on
+	ErrVersionMismatch = errors.New("stored configuration version mismatch")
+
+	// ErrInvalidConfig denotes that a configuration to be stored failed validation
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+// StoredConfig reads the configuration stored in the config file (without any overrides applied),
+// along with its version. The version changes whenever the file is modified, regardless of whether
+// it was modified via StoreConfig or externally
+func (m *Monitor) StoredConfig() (cfg *Config, version string, err error) {
+	if m.path == "" {
+		return nil, "", ErrNoConfigFile
+	}
+
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+
+	data, err := os.ReadFile(filepath.Clean(m.path))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg, err = Parse(bytes.NewReader(data)); err != nil {
+		return nil, "", err
+	}
+	return cfg, configVersion(data), nil
+}
+
+// StoreConfig validates the configuration and replaces the one stored in the config file with it,
+// provided the stored configuration still matches version (or version is AnyVersion). Afterwards, the
+// configuration is reloaded (applying the overrides) and the callback is executed just as by Reload.
+// The version of the stored configuration is returned
+func (m *Monitor) StoreConfig(ctx context.Context, cfg *Config, version string, fn CallbackFn) (newVersion string, enabled, updated, disabled capturetypes.IfaceChanges, err error) {
+	if m.path == "" {
+		err = ErrNoConfigFile
+		return
+	}
+
+	data, err := marshalStored(cfg)
+	if err != nil {
+		return
+	}
+
+	// validate the configuration in its effective form, i.e. as it is going to be parsed upon reload
+	if _, perr := Parse(bytes.NewReader(data), m.parseOpts...); perr != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidConfig, perr)
+		return
+	}
+
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+
+	current, err := os.ReadFile(filepath.Clean(m.path))
+	if err != nil {
+		return
+	}
+	if version != AnyVersion && version != configVersion(current) {
+		err = ErrVersionMismatch
+		return
+	}
+	if err = m.writeStoredAtomic(data); err != nil {
+		err = fmt.Errorf("failed to store configuration: %w", err)
+		return
+	}
+	newVersion = configVersion(data)
+
+	// the change is applied right away, there's no need for the watcher (if any) to apply it again
+	m.appliedVersion = newVersion
+
+	enabled, updated, disabled, err = m.Reload(ctx, fn)
+	return
+}
+
+// marshalStored serializes the configuration to be stored. It is always stored as JSON, which is
+// parsed first (and is valid YAML as well), guaranteeing that it is read back exactly as provided
+func marshalStored(cfg *Config) ([]byte, error) {
+	data, err := jsoniter.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeStoredAtomic replaces the config file (retaining its permissions)
+func (m *Monitor) writeStoredAtomic(data []byte) error {
+	path := filepath.Clean(m.path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteAtomic(path, data, info.Mode().Perm())
+}
+
+// configVersion derives the version of a stored configuration from its raw content
+func configVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/els0r/telemetry/logging"
+	"github.com/fsnotify/fsnotify"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// DefaultWatchDebounce denotes the default time to wait for further changes of the config file before
+// applying them
+const DefaultWatchDebounce = 2 * time.Second
+
+// WithWatch enables watching the config file for changes, which are validated and applied (just as
+// by Reload) once no further change occurred for the debounce duration
+func WithWatch(debounce time.Duration) MonitorOption {
+	return func(m *Monitor) {
+		m.watchDebounce = debounce
+	}
+}
+
+// watch watches the directory of the config file for changes and reloads the config file once it
+// settled. The directory (instead of the file itself) is watched since config files are commonly
+// replaced atomically (e.g. by renaming a temporary file or swapping a symlink) by deploy tooling,
+// which would silently end a watch on the file. Events on other files of the directory are filtered
+// by comparing the version of the config file with the one last applied
+func (m *Monitor) watch(ctx context.Context, fn CallbackFn) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config file watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(filepath.Clean(m.path))); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to watch config file directory: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Clean(m.path))
+	if err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	m.storeMu.Lock()
+	m.appliedVersion = configVersion(data)
+	m.storeMu.Unlock()
+
+	go func() {
+		logger := logging.FromContext(ctx).With("path", m.path)
+		logger.With("debounce", m.watchDebounce).Info("watching config file for changes")
+
+		debounce := time.NewTimer(m.watchDebounce)
+		debounce.Stop()
+		defer func() {
+			debounce.Stop()
+			_ = watcher.Close()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("stopping config file watcher")
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Errorf("error while watching config file: %v", err)
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce.Reset(m.watchDebounce)
+			case <-debounce.C:
+				m.applyWatched(ctx, fn)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// applyWatched reloads the config file if it changed since the version last applied and writes an
+// audit log entry describing the changes applied (or why they were rejected)
+func (m *Monitor) applyWatched(ctx context.Context, fn CallbackFn) {
+	logger := logging.FromContext(ctx).With("path", m.path)
+
+	data, err := os.ReadFile(filepath.Clean(m.path))
+	if err != nil {
+		logger.Errorf("failed to read config file after change: %v", err)
+		return
+	}
+	version := configVersion(data)
+
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	if version == m.appliedVersion {
+		return
+	}
+
+	previous := m.GetConfig()
+	enabled, updated, disabled, err := m.Reload(ctx, fn)
+	m.appliedVersion = version
+
+	logger = logger.With("audit", true, "version", version)
+	if err != nil {
+		logger.Errorf("rejected config file change: %v", err)
+		return
+	}
+	logger.With(
+		"changes", diffConfigs(previous, m.GetConfig()),
+		"enabled", enabled,
+		"updated", updated,
+		"disabled", disabled,
+	).Info("applied config file change")
+}
+
+// diffConfigs lists the options differing between two configurations, prefixed by "+" (added), "-"
+// (removed) or "~" (modified). Only the paths of the options are listed (lists are compared as a
+// whole), their values are omitted since they may contain secrets (e.g. API keys)
+func diffConfigs(c1, c2 *Config) []string {
+	var v1, v2 any
+	if err := unmarshalGeneric(c1, &v1); err != nil {
+		return []string{"~ (" + err.Error() + ")"}
+	}
+	if err := unmarshalGeneric(c2, &v2); err != nil {
+		return []string{"~ (" + err.Error() + ")"}
+	}
+
+	var changes []string
+	diffValues("", v1, v2, &changes)
+	slices.Sort(changes)
+	return changes
+}
+
+func unmarshalGeneric(cfg *Config, v *any) error {
+	data, err := jsoniter.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return jsoniter.Unmarshal(data, v)
+}
+
+func diffValues(path string, v1, v2 any, changes *[]string) {
+	m1, isMap1 := v1.(map[string]any)
+	m2, isMap2 := v2.(map[string]any)
+	if !isMap1 || !isMap2 {
+		switch {
+		case v1 == nil && v2 != nil:
+			*changes = append(*changes, "+"+path)
+		case v1 != nil && v2 == nil:
+			*changes = append(*changes, "-"+path)
+		case !reflect.DeepEqual(v1, v2):
+			*changes = append(*changes, "~"+path)
+		}
+		return
+	}
+
+	for key, val1 := range m1 {
+		diffValues(joinPath(path, key), val1, m2[key], changes)
+	}
+	for key, val2 := range m2 {
+		if _, exists := m1[key]; !exists {
+			diffValues(joinPath(path, key), nil, val2, changes)
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return strings.Join([]string{path, key}, ".")
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/stretchr/testify/require"
+)
+
+const testWatchIface = `  eth1:
+    ring_buffer:
+      block_size: 1048576
+      num_blocks: 4
+`
+
+func TestMonitorWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goprobe.yaml")
+	require.Nil(t, os.WriteFile(path, []byte(testMonitorConfig), 0600))
+
+	m, err := NewMonitor(path, WithWatch(50*time.Millisecond), WithReloadInterval(time.Hour))
+	require.Nil(t, err)
+
+	var (
+		mu      sync.Mutex
+		applied []Ifaces
+	)
+	callback := func(_ context.Context, ifaces Ifaces) (enabled, updated, disabled capturetypes.IfaceChanges, err error) {
+		mu.Lock()
+		applied = append(applied, ifaces)
+		mu.Unlock()
+		return
+	}
+	numApplied := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(applied)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx, callback)
+
+	// replace the config file atomically (as deploy tooling commonly does)
+	replace := func(content string) {
+		tmp := path + ".tmp"
+		require.Nil(t, os.WriteFile(tmp, []byte(content), 0600))
+		require.Nil(t, os.Rename(tmp, path))
+	}
+
+	replace(strings.Replace(testMonitorConfig, "interfaces:\n", "interfaces:\n"+testWatchIface, 1))
+	require.Eventually(t, func() bool { return numApplied() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"eth0", "eth1"}, m.GetIfaces())
+
+	// invalid changes are rejected, retaining the current config
+	replace(strings.Replace(testMonitorConfig, "num_blocks: 2", "num_blocks: -1", 1))
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, 1, numApplied())
+	require.Equal(t, []string{"eth0", "eth1"}, m.GetIfaces())
+
+	// changes of other files in the directory or writes without changes are ignored
+	require.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(path), "other"), []byte("test"), 0600))
+	replace(strings.Replace(testMonitorConfig, "num_blocks: 2", "num_blocks: -1", 1))
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, 1, numApplied())
+}
+
+func TestDiffConfigs(t *testing.T) {
+	c1, err := Parse(strings.NewReader(testMonitorConfig))
+	require.Nil(t, err)
+	c2, err := Parse(strings.NewReader(strings.NewReplacer(
+		"num_blocks: 2", "num_blocks: 4",
+		"interfaces:\n", "interfaces:\n"+testWatchIface,
+	).Replace(testMonitorConfig)))
+	require.Nil(t, err)
+
+	require.Empty(t, diffConfigs(c1, c1))
+	require.Equal(t, []string{"+interfaces.eth1", "~interfaces.eth0.ring_buffer.num_blocks"}, diffConfigs(c1, c2))
+	require.Equal(t, []string{"-interfaces.eth1", "~interfaces.eth0.ring_buffer.num_blocks"}, diffConfigs(c2, c1))
+}
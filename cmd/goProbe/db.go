@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/els0r/goProbe/cmd/goProbe/flags"
+	"github.com/els0r/goProbe/pkg/goDB/snapshot"
+
+	gpconf "github.com/els0r/goProbe/cmd/goProbe/config"
+)
+
+const dbPathKey = "db.path"
+
+// runDBCommand executes a database command (`goProbe db <command>`) and returns the exit code
+func runDBCommand(args []string) int {
+	if err := flags.ReadDB(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// inspection operates on a single directory and hence doesn't require the database path
+	if flags.DBCmdLine.Command == flags.DBInspectCommand {
+		if err := runInspect(os.Stdout, flags.DBCmdLine); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	// the database path is taken from (in decreasing order of precedence) the command line, the
+	// environment or the configuration file
+	dbPath := flags.DBCmdLine.Path
+	if dbPath == "" {
+		dbPath = os.Getenv(gpconf.EnvKey(dbPathKey))
+	}
+	if dbPath == "" {
+		config, err := gpconf.ParseFile(flags.DBCmdLine.Config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read configuration file: %v\n", err)
+			return 1
+		}
+		dbPath = config.DB.Path
+	}
+
+	switch flags.DBCmdLine.Command {
+	case flags.DBSnapshotCommand:
+		var opts []snapshot.Option
+		if flags.DBCmdLine.Link {
+			opts = append(opts, snapshot.WithHardlinks())
+		}
+		stats, err := snapshot.Create(dbPath, flags.DBCmdLine.To, opts...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create snapshot of %s: %v\n", dbPath, err)
+			return 1
+		}
+		fmt.Printf("created snapshot of %s in %s: %d interfaces, %d directories, %d files (%d hardlinked), %d bytes\n",
+			dbPath, flags.DBCmdLine.To, stats.Interfaces, stats.Dirs, stats.Files, stats.Linked, stats.SizeBytes)
+	case flags.DBCheckCommand:
+		if err := runCheck(os.Stdout, dbPath, flags.DBCmdLine); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	case flags.DBExportCommand:
+		if err := runExport(os.Stdout, dbPath, flags.DBCmdLine); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
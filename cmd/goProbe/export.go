@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/els0r/goProbe/cmd/goProbe/flags"
+	"github.com/els0r/goProbe/pkg/goDB/export"
+)
+
+// runExport exports the whole database to partitioned Parquet files (`goProbe db export`) and writes
+// the report to w
+func runExport(w io.Writer, dbPath string, dbFlags *flags.DBFlags) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var opts []export.Option
+	if dbFlags.Ifaces != "" {
+		opts = append(opts, export.WithIfaces(strings.Split(dbFlags.Ifaces, ",")...))
+	}
+
+	report, err := export.Run(ctx, dbPath, dbFlags.Out, opts...)
+	if err != nil {
+		if report == nil {
+			return fmt.Errorf("failed to export %s: %w", dbPath, err)
+		}
+
+		// report what has been exported so far
+		fmt.Fprintf(os.Stderr, "export of %s incomplete: %v\n", dbPath, err)
+	}
+
+	if dbFlags.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+	} else {
+		printExportReport(w, report)
+	}
+	return err
+}
+
+func printExportReport(w io.Writer, report *export.Report) {
+	fmt.Fprintf(w, "exported %d interfaces, %d directories, %d blocks to %s: %d files, %d rows\n",
+		report.NumIfaces, report.NumDirs, report.NumBlocks, report.Out, report.NumFiles, report.NumRows)
+	if len(report.Skipped) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nskipped %d inconsistent directories / blocks (see `goProbe db check`):\n", len(report.Skipped))
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(w, "  %s\n", skipped)
+	}
+}
@@ -0,0 +1,148 @@
+package flags
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+)
+
+const (
+	// DBCommand denotes the command used to perform maintenance tasks on goProbe's database
+	DBCommand = "db"
+
+	// DBSnapshotCommand denotes the database command used to create a snapshot of the database
+	DBSnapshotCommand = "snapshot"
+
+	// DBInspectCommand denotes the database command used to inspect a single directory of the database
+	DBInspectCommand = "inspect"
+
+	// DBCheckCommand denotes the database command used to verify the integrity of the whole database
+	DBCheckCommand = "check"
+
+	// DBExportCommand denotes the database command used to export the whole database to Parquet files
+	DBExportCommand = "export"
+
+	supportedDBCommands = DBSnapshotCommand + ", " + DBInspectCommand + ", " + DBCheckCommand + ", " + DBExportCommand
+)
+
+// DBFlags stores the command line parameters of the database commands (`goProbe db <command>`)
+type DBFlags struct {
+	Command string
+	Config  string
+	Path    string
+	To      string
+	Link    bool
+
+	Block  int64
+	Verify bool
+	Ratios bool
+	JSON   bool
+
+	Ifaces     string
+	Quarantine string
+	Out        string
+}
+
+// DBCmdLine globally exposes the parsed database command flags
+var DBCmdLine = &DBFlags{}
+
+// IsDBCommand states whether the command line arguments denote a database command
+func IsDBCommand(args []string) bool {
+	return len(args) > 0 && args[0] == DBCommand
+}
+
+// ReadDB reads in the command line parameters of a database command. args is expected to
+// contain all arguments following the database command itself
+func ReadDB(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no database command provided, supported commands: %s", supportedDBCommands)
+	}
+
+	DBCmdLine.Command = args[0]
+	switch DBCmdLine.Command {
+	case DBSnapshotCommand:
+		fs := flag.NewFlagSet(DBCommand+" "+DBSnapshotCommand, flag.ContinueOnError)
+		fs.StringVar(&DBCmdLine.Config, "config", "", "path to goProbe's configuration file (used to determine the database path)")
+		fs.StringVar(&DBCmdLine.Path, "db.path", "", "path to the database (takes precedence over the environment and the configuration file)")
+		fs.StringVar(&DBCmdLine.To, "to", "", "path to the snapshot destination, must not exist or be empty (required)")
+		fs.BoolVar(&DBCmdLine.Link, "link", false, "hardlink files instead of copying them (the snapshot then shares its data files with the database)")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if DBCmdLine.Config == "" && DBCmdLine.Path == "" && os.Getenv(config.EnvKey("db.path")) == "" {
+			fs.PrintDefaults()
+			return errors.New("neither configuration file nor database path provided")
+		}
+		if DBCmdLine.To == "" {
+			fs.PrintDefaults()
+			return errors.New("no snapshot destination provided")
+		}
+	case DBCheckCommand:
+		fs := flag.NewFlagSet(DBCommand+" "+DBCheckCommand, flag.ContinueOnError)
+		fs.StringVar(&DBCmdLine.Config, "config", "", "path to goProbe's configuration file (used to determine the database path)")
+		fs.StringVar(&DBCmdLine.Path, "db.path", "", "path to the database (takes precedence over the environment and the configuration file)")
+		fs.StringVar(&DBCmdLine.Ifaces, "ifaces", "", "comma-separated list of interfaces to check (defaults to all interfaces)")
+		fs.StringVar(&DBCmdLine.Quarantine, "quarantine", "", "move corrupt directories to this path (outside of the database) and rewrite their consistent blocks")
+		fs.BoolVar(&DBCmdLine.JSON, "json", false, "print the report in JSON format")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if DBCmdLine.Config == "" && DBCmdLine.Path == "" && os.Getenv(config.EnvKey("db.path")) == "" {
+			fs.PrintDefaults()
+			return errors.New("neither configuration file nor database path provided")
+		}
+	case DBExportCommand:
+		fs := flag.NewFlagSet(DBCommand+" "+DBExportCommand, flag.ContinueOnError)
+		fs.StringVar(&DBCmdLine.Config, "config", "", "path to goProbe's configuration file (used to determine the database path)")
+		fs.StringVar(&DBCmdLine.Path, "db.path", "", "path to the database (takes precedence over the environment and the configuration file)")
+		fs.StringVar(&DBCmdLine.Ifaces, "ifaces", "", "comma-separated list of interfaces to export (defaults to all interfaces)")
+		fs.StringVar(&DBCmdLine.Out, "out", "", "path to the output directory (outside of the database) holding the partitioned Parquet files (required)")
+		fs.BoolVar(&DBCmdLine.JSON, "json", false, "print the report in JSON format")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if DBCmdLine.Config == "" && DBCmdLine.Path == "" && os.Getenv(config.EnvKey("db.path")) == "" {
+			fs.PrintDefaults()
+			return errors.New("neither configuration file nor database path provided")
+		}
+		if DBCmdLine.Out == "" {
+			fs.PrintDefaults()
+			return errors.New("no output directory provided")
+		}
+	case DBInspectCommand:
+		fs := flag.NewFlagSet(DBCommand+" "+DBInspectCommand+" <path>", flag.ContinueOnError)
+		fs.Int64Var(&DBCmdLine.Block, "block", 0, "dump the decoded entries of the block at the given timestamp")
+		fs.BoolVar(&DBCmdLine.Verify, "verify", false, "verify the consistency of all blocks across columns")
+		fs.BoolVar(&DBCmdLine.Ratios, "ratios", false, "show the per-column compression ratios of all blocks")
+		fs.BoolVar(&DBCmdLine.JSON, "json", false, "print the output in JSON format")
+
+		// allow the path to be provided before or after the flags
+		if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+			DBCmdLine.Path = args[1]
+			args = args[1:]
+		}
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if DBCmdLine.Path == "" {
+			DBCmdLine.Path = fs.Arg(0)
+		}
+		if DBCmdLine.Path == "" {
+			fs.PrintDefaults()
+			return errors.New("no directory to inspect provided")
+		}
+		if DBCmdLine.Block != 0 && (DBCmdLine.Verify || DBCmdLine.Ratios) {
+			return errors.New("-block cannot be combined with -verify or -ratios")
+		}
+	default:
+		return fmt.Errorf("unknown database command %q, supported commands: %s", DBCmdLine.Command, supportedDBCommands)
+	}
+	return nil
+}
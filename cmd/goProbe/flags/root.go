@@ -4,27 +4,53 @@ package flags
 import (
 	"errors"
 	"flag"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
 )
 
 // Flags stores goProbe's command line parameters
 type Flags struct {
-	Config             string
-	Version            bool
-	OpenAPISpecOutfile string
+	Config              string
+	Version             bool
+	OpenAPISpecOutfile  string
+	ConfigSchemaOutfile string
+
+	// WatchConfig enables watching the config file for changes (applied after WatchDebounce)
+	WatchConfig   bool
+	WatchDebounce time.Duration
+
+	// Overrides stores configuration options overridden via the command line
+	Overrides config.Overrides
 }
 
 // CmdLine globally exposes the parsed flags
-var CmdLine = &Flags{}
+var CmdLine = &Flags{
+	Overrides: make(config.Overrides),
+}
 
 // Read reads in the command line parameters
 func Read() error {
-	flag.StringVar(&CmdLine.Config, "config", "", "path to goProbe's configuration file (required)")
+	flag.StringVar(&CmdLine.Config, "config", "", "path to goProbe's configuration file (required unless all options are provided via overrides)")
 	flag.BoolVar(&CmdLine.Version, "version", false, "print goProbe's version and exit")
 	flag.StringVar(&CmdLine.OpenAPISpecOutfile, "openapi.spec-outfile", "", "write OpenAPI 3.0.3 spec to output file and exit")
+	flag.StringVar(&CmdLine.ConfigSchemaOutfile, "config.schema-outfile", "", "write JSON schema of the configuration to output file and exit")
+	flag.BoolVar(&CmdLine.WatchConfig, "config.watch", false, "watch the configuration file for changes and apply them automatically (just as via the /_reload API endpoint)")
+	flag.DurationVar(&CmdLine.WatchDebounce, "config.watch-debounce", config.DefaultWatchDebounce, "time to wait for further changes of the configuration file before applying them (requires -config.watch)")
+
+	// every configuration option can be overridden via the command line (taking precedence over
+	// both the configuration file and environment variables)
+	for _, key := range config.OverridableOptions() {
+		flag.Func(key, "override configuration option (env: "+config.EnvKey(key)+")", func(s string) error {
+			CmdLine.Overrides[key] = s
+			return nil
+		})
+	}
 
 	flag.Parse()
 
-	if CmdLine.Config == "" && !CmdLine.Version {
+	if CmdLine.Config == "" && !CmdLine.Version && CmdLine.ConfigSchemaOutfile == "" &&
+		len(CmdLine.Overrides) == 0 && len(config.OverridesFromEnv()) == 0 {
 		flag.PrintDefaults()
 		return errors.New("no configuration file provided")
 	}
@@ -0,0 +1,64 @@
+package flags
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+// SimulateCommand denotes the command used to simulate the resource usage for a configuration and a
+// traffic profile (`goProbe simulate`)
+const SimulateCommand = "simulate"
+
+// SimulateFlags stores the command line parameters of the simulate command
+type SimulateFlags struct {
+	Config string
+	Ifaces string
+
+	PacketRate float64
+	Flows      int
+	IPv6Share  float64
+	PacketSize int
+
+	JSON bool
+}
+
+// SimulateCmdLine globally exposes the parsed simulate command flags
+var SimulateCmdLine = &SimulateFlags{}
+
+// IsSimulateCommand states whether the command line arguments denote the simulate command
+func IsSimulateCommand(args []string) bool {
+	return len(args) > 0 && args[0] == SimulateCommand
+}
+
+// IfaceList returns the interfaces the simulation is restricted to (all configured interfaces if empty)
+func (s *SimulateFlags) IfaceList() (ifaces []string) {
+	for _, iface := range strings.Split(s.Ifaces, ",") {
+		if iface = strings.TrimSpace(iface); iface != "" {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	return
+}
+
+// ReadSimulate reads in the command line parameters of the simulate command. args is expected to
+// contain all arguments following the simulate command itself
+func ReadSimulate(args []string) error {
+	fs := flag.NewFlagSet(SimulateCommand, flag.ContinueOnError)
+	fs.StringVar(&SimulateCmdLine.Config, "config", "", "path to goProbe's configuration file (required)")
+	fs.StringVar(&SimulateCmdLine.Ifaces, "ifaces", "", "comma-separated list of interfaces to simulate (all configured interfaces if empty)")
+	fs.Float64Var(&SimulateCmdLine.PacketRate, "rate", 10000, "packet rate per interface (packets per second)")
+	fs.IntVar(&SimulateCmdLine.Flows, "flows", 10000, "number of distinct flows per interface and writeout interval")
+	fs.Float64Var(&SimulateCmdLine.IPv6Share, "ipv6", 0.1, "share of IPv6 flows (between 0 and 1)")
+	fs.IntVar(&SimulateCmdLine.PacketSize, "packet-size", 800, "average packet size including the link-layer header (bytes)")
+	fs.BoolVar(&SimulateCmdLine.JSON, "json", false, "print the output in JSON format")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if SimulateCmdLine.Config == "" {
+		fs.PrintDefaults()
+		return errors.New("no configuration file provided")
+	}
+	return nil
+}
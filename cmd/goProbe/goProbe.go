@@ -15,6 +15,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -23,13 +25,21 @@ import (
 	"time"
 
 	"github.com/els0r/goProbe/cmd/goProbe/flags"
+	"github.com/els0r/goProbe/pkg/api"
+	"github.com/els0r/goProbe/pkg/api/auth"
 	gpserver "github.com/els0r/goProbe/pkg/api/goprobe/server"
 	"github.com/els0r/goProbe/pkg/api/server"
 	"github.com/els0r/goProbe/pkg/capture"
+	"github.com/els0r/goProbe/pkg/goprobe/alerting"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/goprobe/replication"
+	"github.com/els0r/goProbe/pkg/goprobe/upgrade"
 	"github.com/els0r/goProbe/pkg/version"
 	"github.com/els0r/telemetry/logging"
 
 	gpconf "github.com/els0r/goProbe/cmd/goProbe/config"
+
+	_ "github.com/els0r/goProbe/plugins/attribute" // Include custom attributes (if any, see plugins/attribute)
 )
 
 const shutdownGracePeriod = 30 * time.Second
@@ -41,6 +51,16 @@ func main() {
 	// non-zero exit code.
 	// Issues encountered during capture will be logged to syslog by default
 
+	// Database commands (e.g. snapshots) are run standalone, i.e. without starting goProbe
+	if flags.IsDBCommand(os.Args[1:]) {
+		os.Exit(runDBCommand(os.Args[2:]))
+	}
+
+	// Simulations are run standalone as well, without capturing any packets
+	if flags.IsSimulateCommand(os.Args[1:]) {
+		os.Exit(runSimulateCommand(os.Args[2:]))
+	}
+
 	// Read / parse command-line flags
 	if err := flags.Read(); err != nil {
 		os.Exit(1)
@@ -51,8 +71,25 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Read / parse config file
-	configMonitor, err := gpconf.NewMonitor(flags.CmdLine.Config)
+	// write config schema and exit
+	if schemaFile := flags.CmdLine.ConfigSchemaOutfile; schemaFile != "" {
+		if err := writeConfigSchema(schemaFile); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write configuration schema: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Read / parse config file. Options can be overridden via environment variables and command
+	// line flags (in increasing order of precedence)
+	overrides := gpconf.OverridesFromEnv().Merge(flags.CmdLine.Overrides)
+	monitorOpts := []gpconf.MonitorOption{
+		gpconf.WithParseOptions(gpconf.WithOverrides(overrides)),
+	}
+	if flags.CmdLine.WatchConfig {
+		monitorOpts = append(monitorOpts, gpconf.WithWatch(flags.CmdLine.WatchDebounce))
+	}
+	configMonitor, err := gpconf.NewMonitor(flags.CmdLine.Config, monitorOpts...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to initialize config file monitor: %v\n", err)
 		os.Exit(1)
@@ -60,16 +97,7 @@ func main() {
 	config := configMonitor.GetConfig()
 
 	// Initialize logger
-	loggerOpts := []logging.Option{
-		logging.WithVersion(appVersion),
-	}
-	if config.Logging.Destination != "" {
-		loggerOpts = append(loggerOpts, logging.WithFileOutput(config.Logging.Destination))
-	}
-
-	err = logging.Init(logging.LevelFromString(config.Logging.Level), logging.Encoding(config.Logging.Encoding),
-		loggerOpts...,
-	)
+	err = initLogging(config.Logging, appVersion)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
 		os.Exit(1)
@@ -78,11 +106,14 @@ func main() {
 	logger := logging.Logger()
 	logger.Info("loaded configuration")
 
+	// Adapt to the resource limits when running in a container / control group
+	applyResourceLimits(logger)
+
 	// write spec and exit
 	openAPIfile := flags.CmdLine.OpenAPISpecOutfile
 	if openAPIfile != "" {
 		// skeleton server just for route registration
-		err := server.GenerateSpec(context.Background(), openAPIfile, gpserver.New("127.0.0.1:8145", config.DB.Path, nil, nil))
+		err := server.GenerateSpec(context.Background(), openAPIfile, gpserver.New("127.0.0.1:8145", config.DB.Path, nil, nil, nil))
 		if err != nil {
 			logger.Fatal(err)
 		}
@@ -99,6 +130,31 @@ func main() {
 		logger.Fatalf("cannot monitor more than %d interfaces", capture.MaxIfaces)
 	}
 
+	// If this process was started by a running goProbe process as part of a binary upgrade, take
+	// over its state (API listener and, once capturing, the flows captured since the last writeout)
+	upgradeChild, err := upgrade.Inherited(upgrade.DefaultTimeout)
+	if err != nil {
+		logger.Fatalf("failed to initialize binary upgrade: %v", err)
+	}
+	var apiListener net.Listener
+	if upgradeChild != nil {
+		logger.Info("taking over from running goProbe process")
+		if apiListener, err = upgradeChild.Ready(); err != nil {
+			logger.Fatalf("failed to take over from running goProbe process: %v", err)
+		}
+	}
+
+	// failTakeover notifies the running goProbe process (if any) that the takeover failed before
+	// terminating
+	failTakeover := func(err error) {
+		if upgradeChild != nil {
+			if doneErr := upgradeChild.Done(err); doneErr != nil {
+				logger.Errorf("failed to notify running goProbe process: %v", doneErr)
+			}
+		}
+		logger.Fatal(err)
+	}
+
 	// We quit on encountering SIGTERM or SIGINT (see further down)
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	defer stop()
@@ -114,18 +170,60 @@ func main() {
 	// Create DB directory if it doesn't exist already.
 	// #nosec G301
 	if err := os.MkdirAll(filepath.Clean(config.DB.Path), 0755); err != nil {
-		logger.Fatalf("failed to create database directory: %v", err)
+		failTakeover(fmt.Errorf("failed to create database directory: %w", err))
+	}
+
+	// Set up the (optional) replication of the live flows to / from a standby probe. A standby neither
+	// captures nor writes out until it takes over, whereas the writeouts of an active probe are fenced
+	// once its peer has taken over
+	var (
+		replicationNode     *replication.Node
+		replicationListener net.Listener
+		managerOpts         []capture.ManagerOption
+	)
+	if config.Replication != nil {
+		if replicationListener, err = net.Listen("tcp", config.Replication.Listen); err != nil {
+			failTakeover(fmt.Errorf("failed to listen on replication address %s: %w", config.Replication.Listen, err))
+		}
+		managerOpts = append(managerOpts,
+			capture.WithStandby(config.Replication.Role == gpconf.ReplicationRoleStandby),
+			capture.WithWriteoutGuard(func(ctx context.Context) error {
+				return replicationNode.CheckWriteout(ctx)
+			}),
+		)
 	}
 
 	// None of the initialization steps failed.
-	captureManager, err := capture.InitManager(ctx, config)
+	captureManager, err := capture.InitManager(ctx, config, managerOpts...)
 	if err != nil {
-		logger.Fatal(err)
+		failTakeover(err)
+	}
+
+	if config.Replication != nil {
+		tlsConfig, err := replication.LoadTLSConfig(config.Replication.TLS.CertFile, config.Replication.TLS.KeyFile, config.Replication.TLS.CAFile)
+		if err != nil {
+			failTakeover(err)
+		}
+		replicationNode, err = replication.New(replication.Role(config.Replication.Role), replicationListener, config.Replication.Peer, tlsConfig, captureManager,
+			replication.WithNodeID(config.Replication.NodeID),
+			replication.WithInterval(config.Replication.Interval),
+			replication.WithFailoverTimeout(config.Replication.FailoverTimeout),
+			replication.WithEpochFile(filepath.Join(config.DB.Path, replication.EpochFileName)),
+		)
+		if err != nil {
+			failTakeover(fmt.Errorf("failed to set up replication: %w", err))
+		}
+		go replicationNode.Run(ctx)
 	}
 
 	// Initialize constant monitoring / reloading of the config file
 	configMonitor.Start(ctx, captureManager.Update)
 
+	// Evaluate the alert rules. The evaluator runs regardless of whether alerting is configured,
+	// since rules may be added at runtime (via a config reload or the API)
+	alerts := alerting.New(captureManager, configMonitor)
+	go alerts.Run(ctx)
+
 	// configure api server
 	var apiServer *gpserver.Server
 
@@ -145,13 +243,59 @@ func main() {
 
 			// enable global query rate limit if provided
 			server.WithQueryRateLimit(config.API.QueryRateLimit.MaxReqPerSecond, config.API.QueryRateLimit.MaxBurst),
+
+			// return partial results for queries exceeding the deadline
+			server.WithQueryDeadline(config.API.QueryDeadline),
+
+			// surface capture manager warnings (e.g. congested writeouts) via the health endpoint
+			server.WithHealthChecks(captureManager.HealthCheck),
+		}
+		if replicationNode != nil {
+			apiOptions = append(apiOptions, server.WithHealthChecks(replicationNode.HealthCheck))
+		}
+
+		// listen on the API address unless the listener was handed over by a running goProbe process
+		if apiListener == nil {
+			if apiListener, err = server.Listen(config.API.Addr); err != nil {
+				failTakeover(fmt.Errorf("failed to listen on API address %s: %w", config.API.Addr, err))
+			}
+		}
+		apiOptions = append(apiOptions, server.WithListener(apiListener))
+
+		// authenticate API calls if static keys and / or an OIDC provider are configured
+		authProviders, err := newAuthProviders(config.API)
+		if err != nil {
+			failTakeover(fmt.Errorf("failed to set up API authentication: %w", err))
+		}
+		if len(authProviders) > 0 {
+			apiOptions = append(apiOptions, server.WithAuthProviders(authProviders...))
 		}
-		// if len(config.API.Keys) > 0 {
-		// 	apiOptions = append(apiOptions, api.WithKeys(config.API.Keys))
-		// }
 
-		apiServer = gpserver.New(config.API.Addr, config.DB.Path, captureManager, configMonitor, apiOptions...)
+		// store the results of queries run in the background (if enabled)
+		if config.API.StoredResults != nil {
+			resultStore, err := api.NewResultStore(config.API.StoredResults.Dir, config.API.StoredResults.Retention)
+			if err != nil {
+				failTakeover(fmt.Errorf("failed to set up query result storage: %w", err))
+			}
+			go resultStore.RunCleanup(ctx, api.DefaultStoredResultsCleanupInterval)
+
+			apiOptions = append(apiOptions, server.WithQueryResultStore(resultStore))
+		}
 
+		apiServer = gpserver.New(config.API.Addr, config.DB.Path, captureManager, configMonitor, alerts, apiOptions...)
+	}
+
+	// Now that the captures are running, the running goProbe process (if any) stops its own ones
+	// and hands over the flows captured since the last writeout
+	if upgradeChild != nil {
+		flows, err := upgradeChild.Capturing()
+		if err != nil {
+			failTakeover(fmt.Errorf("failed to receive flows from running goProbe process: %w", err))
+		}
+		captureManager.ReplayFlows(flows...)
+	}
+
+	if apiServer != nil {
 		// serve API
 		go func() {
 			logger.With("addr", config.API.Addr).Info("starting API server")
@@ -162,14 +306,46 @@ func main() {
 		}()
 	}
 
+	// Notify the running goProbe process (if any) that the takeover is complete
+	if upgradeChild != nil {
+		if err := upgradeChild.Done(nil); err != nil {
+			logger.Errorf("failed to notify running goProbe process: %v", err)
+		}
+		logger.Info("took over from running goProbe process")
+	}
+
+	// Binary upgrades are triggered via SIGUSR2
+	upgradeChan := make(chan os.Signal, 1)
+	signal.Notify(upgradeChan, syscall.SIGUSR2)
+
 	logger.Info("started goProbe")
 
-	// listen for the interrupt signal
-	<-ctx.Done()
+	// listen for the interrupt signal (or an upgrade request)
+	var upgraded bool
+	for !upgraded && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-upgradeChan:
+			if replicationNode != nil {
+				logger.Error("binary upgrades are not supported with replication enabled (restart the probes one after another instead)")
+				continue
+			}
+			if err := upgradeBinary(ctx, captureManager, configMonitor, apiListener); err != nil {
+				logger.Errorf("binary upgrade failed: %v", err)
+				continue
+			}
+			upgraded = true
+		}
+	}
 
 	// restore default behavior on the interrupt signal and notify user of shutdown.
 	stop()
-	logger.Info("shutting down gracefully")
+	signal.Stop(upgradeChan)
+	if upgraded {
+		logger.Info("handed over to new goProbe process, shutting down")
+	} else {
+		logger.Info("shutting down gracefully")
+	}
 
 	// the context is used to inform the server it has ShutdownGracePeriod to wrap up the requests it is
 	// currently handling
@@ -187,6 +363,98 @@ func main() {
 		}
 	}
 
-	captureManager.Close(fallbackCtx)
+	// after a handover, all captures have been stopped already and their flows are written out by
+	// the new process
+	if !upgraded {
+		captureManager.Close(fallbackCtx)
+	}
 	logger.Info("graceful shut down completed")
 }
+
+func writeConfigSchema(path string) (err error) {
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	return gpconf.WriteSchema(f)
+}
+
+// newAuthProviders sets up the providers authenticating API calls from the API configuration
+func newAuthProviders(cfg *gpconf.APIConfig) (providers []auth.Provider, err error) {
+	projections := make([]*auth.Projection, 0, len(cfg.Projections))
+	for _, projection := range cfg.Projections {
+		projections = append(projections, auth.NewProjection(projection.Name, projection.Attributes...))
+	}
+
+	keyProvider, numKeys := auth.NewKeyProvider(cfg.Keys...), len(cfg.Keys)
+	for i, projection := range cfg.Projections {
+		keyProvider.WithProjectedKeys(projections[i], projection.Keys...)
+		numKeys += len(projection.Keys)
+	}
+	if numKeys > 0 {
+		providers = append(providers, keyProvider)
+	}
+	if cfg.OIDC != nil {
+		opts := []auth.OIDCOption{
+			auth.WithRequiredScopes(cfg.OIDC.Scopes...),
+			auth.WithRoleClaim(cfg.OIDC.RoleClaim),
+			auth.WithAdminRoles(cfg.OIDC.AdminRoles...),
+			auth.WithReadOnlyRoles(cfg.OIDC.ReadOnlyRoles...),
+		}
+		for i, projection := range cfg.Projections {
+			if len(projection.Roles) > 0 {
+				opts = append(opts, auth.WithProjectedRoles(projections[i], projection.Roles...))
+			}
+		}
+		oidcProvider, err := auth.NewOIDCProvider(cfg.OIDC.Issuer, cfg.OIDC.Audience, opts...)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, oidcProvider)
+	}
+	return providers, nil
+}
+
+// initLogging initializes the default logger, writing either to a native log sink (journald / syslog)
+// or to a log file / the console. The logger itself accepts all levels, the filtering is done based on
+// the (runtime adjustable) log levels of the individual modules
+func initLogging(cfg gpconf.LogConfig, appVersion string) error {
+	level, err := logs.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	moduleLevels, err := cfg.ModuleLevels()
+	if err != nil {
+		return err
+	}
+
+	sink, isSink, err := logs.ParseSink(cfg.Destination)
+	if err != nil {
+		return err
+	}
+	if isSink {
+		handler, err := sink.NewHandler(gpconf.ServiceName, logging.Encoding(cfg.Encoding))
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(slog.New(handler.WithAttrs([]slog.Attr{slog.String("version", appVersion)})))
+	} else {
+		loggerOpts := []logging.Option{
+			logging.WithVersion(appVersion),
+		}
+		if cfg.Destination != "" {
+			loggerOpts = append(loggerOpts, logging.WithFileOutput(cfg.Destination))
+		}
+		if err := logging.Init(logging.LevelDebug, logging.Encoding(cfg.Encoding), loggerOpts...); err != nil {
+			return err
+		}
+	}
+
+	return logs.Init(level, moduleLevels)
+}
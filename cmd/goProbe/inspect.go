@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/flags"
+	"github.com/els0r/goProbe/pkg/goDB/inspect"
+	"github.com/els0r/goProbe/pkg/goDB/protocols"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const inspectTimeFormat = "2006-01-02 15:04:05"
+
+// runInspect inspects a single directory of the database (`goProbe db inspect <path>`) and
+// writes the result to w
+func runInspect(w io.Writer, dbFlags *flags.DBFlags) error {
+	gpDir, err := inspect.Open(dbFlags.Path)
+	if err != nil {
+		return err
+	}
+	defer gpDir.Close()
+
+	var (
+		output    any
+		numIssues int
+	)
+	switch {
+	case dbFlags.Block != 0:
+		entries, err := inspect.DumpBlock(gpDir, dbFlags.Block)
+		if err != nil {
+			return err
+		}
+		output = entries
+		if !dbFlags.JSON {
+			printEntries(w, entries)
+		}
+	case dbFlags.Verify || dbFlags.Ratios:
+		result := struct {
+			Issues []inspect.Issue       `json:"issues,omitempty"`
+			Ratios []inspect.BlockRatios `json:"ratios,omitempty"`
+		}{}
+		if dbFlags.Ratios {
+			result.Ratios = inspect.CompressionRatios(gpDir)
+			if !dbFlags.JSON {
+				printRatios(w, result.Ratios)
+			}
+		}
+		if dbFlags.Verify {
+			result.Issues = inspect.Verify(gpDir)
+			if !dbFlags.JSON {
+				printIssues(w, gpDir.NBlocks(), result.Issues)
+			}
+		}
+		output, numIssues = result, len(result.Issues)
+	default:
+		dir, err := inspect.Describe(gpDir)
+		if err != nil {
+			return err
+		}
+		output = dir
+		if !dbFlags.JSON {
+			printDir(w, dir)
+		}
+	}
+
+	if dbFlags.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(output); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+	}
+	if numIssues > 0 {
+		return fmt.Errorf("found %d inconsistencies in %s", numIssues, dbFlags.Path)
+	}
+	return nil
+}
+
+func printDir(w io.Writer, dir *inspect.Dir) {
+	fmt.Fprintf(w, `
+                Path: %s
+           Timestamp: %d (%s UTC)
+             Version: %d
+    Number of Blocks: %d
+     Number of Flows: %d / %d (IP v4 / v6)
+             Traffic: %s
+`, dir.Path, dir.Timestamp, time.Unix(dir.Timestamp, 0).UTC().Format(inspectTimeFormat), dir.Version,
+		dir.NumBlocks, dir.Traffic.NumV4Entries, dir.Traffic.NumV6Entries, dir.Counts)
+
+	if dir.FlowSizes != nil {
+		printFlowSizes(w, dir.NumBlocks, dir.FlowSizes)
+	}
+
+	for _, column := range dir.Columns {
+		var ratio float64
+		if column.RawSize > 0 {
+			ratio = 100 * float64(column.Size) / float64(column.RawSize)
+		}
+		fmt.Fprintf(w, "\nColumn: %s (%d / %d bytes, %.2f%%)\n\n", column.Name, column.Size, column.RawSize, ratio)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "\t#\tts\ttime UTC\toffset\tlen\traw len\tencoder\tratio\t#F v4\t#F v6\tdrops\tfirst 4 bytes\tissue\t")
+		for i, block := range column.Blocks {
+			encoder := block.Encoder
+			if block.DeltaPacked {
+				encoder += "+delta"
+			}
+			fmt.Fprintf(tw, "\t%d\t%d\t%s\t%d\t%d\t%d\t%s\t%.2f%%\t%d\t%d\t%d\t%s\t%s\t\n", i+1,
+				block.Timestamp, time.Unix(block.Timestamp, 0).UTC().Format(inspectTimeFormat),
+				block.Offset, block.Len, block.RawLen, encoder, block.RatioPct,
+				block.NumV4Entries, block.NumV6Entries, block.NumDrops,
+				block.Header, block.Issue,
+			)
+		}
+		tw.Flush()
+	}
+}
+
+// printFlowSizes prints all non-empty buckets of the flow size histograms
+func printFlowSizes(w io.Writer, nBlocks int, sizes *inspect.FlowSizes) {
+	fmt.Fprintf(w, "\nFlow Sizes (%d / %d blocks covered)\n\n", sizes.NumBlocks, nBlocks)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tsize <=\t#F (bytes)\t#F (packets)\t")
+	for i := 0; i < gpfile.NumFlowSizeBuckets; i++ {
+		if sizes.Bytes.Buckets[i] == 0 && sizes.Packets.Buckets[i] == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\t%d\t%d\t%d\t\n", gpfile.FlowSizeBucketBound(i), sizes.Bytes.Buckets[i], sizes.Packets.Buckets[i])
+	}
+	tw.Flush()
+}
+
+func printRatios(w io.Writer, ratios []inspect.BlockRatios) {
+	var columns []string
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		columns = append(columns, types.ColumnFileNames[colIdx])
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tts\ttime UTC\t"+strings.Join(columns, "\t")+"\t")
+	for _, block := range ratios {
+		fmt.Fprintf(tw, "\t%d\t%s\t", block.Timestamp, time.Unix(block.Timestamp, 0).UTC().Format(inspectTimeFormat))
+		for _, column := range columns {
+			if ratio, exists := block.Ratios[column]; exists {
+				fmt.Fprintf(tw, "%.2f%%\t", ratio)
+			} else {
+				fmt.Fprint(tw, "-\t")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+func printIssues(w io.Writer, nBlocks int, issues []inspect.Issue) {
+	if len(issues) == 0 {
+		fmt.Fprintf(w, "verified %d blocks: no inconsistencies found\n", nBlocks)
+		return
+	}
+	fmt.Fprintf(w, "verified %d blocks: found %d inconsistencies\n", nBlocks, len(issues))
+	for _, issue := range issues {
+		fmt.Fprintf(w, "  %s\n", issue)
+	}
+}
+
+func printEntries(w io.Writer, entries []inspect.Entry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\t#\tsip\tdip\tdport\tproto\tbytes rcvd\tbytes sent\tpkts rcvd\tpkts sent\ttags\tprocess\tvlan\tsmac\tdmac\tflags\tdscp\t")
+	for i, entry := range entries {
+		fmt.Fprintf(tw, "\t%d\t%s\t%s\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t\n", i+1,
+			entry.SrcIP, entry.DstIP, entry.DstPort, protocols.GetIPProto(int(entry.IPProto)),
+			entry.Counters.BytesRcvd, entry.Counters.BytesSent, entry.Counters.PacketsRcvd, entry.Counters.PacketsSent,
+			entry.Tags, entry.ProcessID, entry.VLAN, entry.SrcMAC, entry.DstMAC, entry.TCPFlags, entry.DSCP,
+		)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/els0r/goProbe/pkg/cgroup"
+	"github.com/els0r/telemetry/logging"
+)
+
+// memoryLimitRatio denotes the share of the memory limit of the control group used as soft memory
+// limit of the Go runtime, leaving headroom for memory not managed by it (e.g. the ring buffers)
+const memoryLimitRatio = 0.9
+
+// applyResourceLimits adapts the Go runtime to the resource limits of the control group of goProbe
+// (e.g. when running in a container), unless overridden via the GOMAXPROCS / GOMEMLIMIT environment
+// variables: the number of OS threads executing Go code simultaneously is capped by the CPU limit
+// and garbage collection is intensified when approaching the memory limit
+func applyResourceLimits(logger *logging.L) {
+	limits := cgroup.Current()
+	if !limits.Detected() {
+		return
+	}
+
+	if _, isSet := os.LookupEnv("GOMAXPROCS"); !isSet && limits.CPUs > 0 {
+		runtime.GOMAXPROCS(limits.NumCPU())
+	}
+	if _, isSet := os.LookupEnv("GOMEMLIMIT"); !isSet && limits.MemoryBytes > 0 {
+		debug.SetMemoryLimit(int64(float64(limits.MemoryBytes) * memoryLimitRatio))
+	}
+
+	logger.With(
+		"cgroup", limits.Path,
+		"memory_limit", limits.MemoryBytes,
+		"cpu_limit", limits.CPUs,
+		"gomaxprocs", runtime.GOMAXPROCS(0),
+	).Info("applied resource limits of control group")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/flags"
+	"github.com/els0r/goProbe/pkg/capture"
+	"github.com/els0r/goProbe/pkg/goprobe/simulate"
+
+	gpconf "github.com/els0r/goProbe/cmd/goProbe/config"
+)
+
+// runSimulateCommand executes the simulate command (`goProbe simulate`) and returns the exit code
+func runSimulateCommand(args []string) int {
+	if err := flags.ReadSimulate(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := runSimulate(os.Stdout, flags.SimulateCmdLine); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runSimulate simulates the resource usage for the configuration and traffic profile provided via the
+// command line and writes the report to w
+func runSimulate(w io.Writer, simFlags *flags.SimulateFlags) error {
+	config, err := gpconf.ParseFile(simFlags.Config)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	report, err := simulate.Run(config, capture.TrafficProfile{
+		PacketRate: simFlags.PacketRate,
+		Flows:      simFlags.Flows,
+		IPv6Share:  simFlags.IPv6Share,
+		PacketSize: simFlags.PacketSize,
+	}, simFlags.IfaceList()...)
+	if err != nil {
+		return err
+	}
+
+	if simFlags.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return nil
+	}
+	printReport(w, report)
+	return nil
+}
+
+func printReport(w io.Writer, report *simulate.Report) {
+	fmt.Fprintf(w, `
+     Packet Rate: %.0f pps (%.2f%% IPv6 flows, %d bytes / packet)
+           Flows: %d per writeout interval
+    Local Buffer: %d bytes
+
+`, report.Profile.PacketRate, 100*report.Profile.IPv6Share, report.Profile.PacketSize,
+		report.Profile.Flows, report.LocalBufferSize)
+
+	ifaces := make([]string, 0, len(report.Ifaces))
+	for iface := range report.Ifaces {
+		ifaces = append(ifaces, iface)
+	}
+	slices.Sort(ifaces)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tiface\tflow log\trotation\taggregation\tlocal buffer\tring buffer\tring buffer time\twriteout\twriteout time\tper day\t")
+	for _, iface := range ifaces {
+		res := report.Ifaces[iface]
+		ringBuffer, ringBufferTime := "-", "-"
+		if res.RingBufferSize > 0 {
+			ringBuffer, ringBufferTime = fmt.Sprintf("%d", res.RingBufferSize), res.RingBufferDuration.Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(tw, "\t%s\t%d\t%s\t%s\t%d\t%s\t%s\t%d\t%s\t%d\t\n", iface,
+			res.FlowLogSize, res.RotationDuration.Round(time.Microsecond), res.AggregationDuration.Round(time.Microsecond),
+			res.LocalBufferSize, ringBuffer, ringBufferTime,
+			res.WriteoutSize, res.WriteoutDuration.Round(time.Microsecond), res.DailySize,
+		)
+	}
+	tw.Flush()
+
+	if len(report.Quotas) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 0, 4, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "\tquota\tmax size\tper day\tretention (days)\t")
+		for _, quota := range report.Quotas {
+			retention := "-"
+			if quota.Retention > 0 {
+				retention = fmt.Sprintf("%.1f", quota.Retention.Hours()/24)
+			}
+			fmt.Fprintf(tw, "\t%s\t%d\t%d\t%s\t\n", strings.Join(quota.Ifaces, ","), quota.MaxSize, quota.DailySize, retention)
+		}
+		tw.Flush()
+	}
+
+	if len(report.Warnings) > 0 {
+		fmt.Fprintln(w)
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(w, "warning: %s\n", warning)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/els0r/goProbe/pkg/capture"
+	"github.com/els0r/goProbe/pkg/goprobe/upgrade"
+	"github.com/els0r/telemetry/logging"
+
+	gpconf "github.com/els0r/goProbe/cmd/goProbe/config"
+)
+
+// upgradeBinary hands over to a new goProbe process started from the binary at the original path
+// (which may have been replaced in the meantime). The captures keep running until the ones of the
+// new process have been started. If the new process fails to take over, the running process
+// continues as before
+func upgradeBinary(ctx context.Context, captureManager *capture.Manager, configMonitor *gpconf.Monitor, apiListener net.Listener) error {
+	logger := logging.FromContext(ctx)
+
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return fmt.Errorf("failed to locate goProbe binary: %w", err)
+	}
+
+	logger.With("binary", path).Info("starting binary upgrade")
+	upgrader, err := upgrade.Start(path, os.Args[1:], upgrade.DefaultTimeout)
+	if err != nil {
+		return err
+	}
+
+	// Keep capturing until the captures of the new process are running
+	if err := upgrader.HandoverListener(apiListener); err != nil {
+		upgrader.Abort()
+		return err
+	}
+
+	// Stop capturing and hand over all flows captured since the last writeout
+	flows := captureManager.Handover(ctx)
+	if err := upgrader.HandoverFlows(flows); err != nil {
+		upgrader.Abort()
+
+		// The new process failed after it had started capturing (which is not expected to happen),
+		// hence the captures have to be restarted. The flows will be written out during the next
+		// regular writeout instead
+		captureManager.ReplayFlows(flows...)
+		if _, _, _, updateErr := captureManager.Update(ctx, configMonitor.GetConfig().Interfaces); updateErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restart captures: %w", updateErr))
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goQuery/pkg/conf"
+	"github.com/els0r/goProbe/pkg/goDB/engine"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/telemetry/logging"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/viper"
+)
+
+// runBatch runs the queries stored in the batch at location (or stdin if location is "-") in a single
+// pass over the local goDB and renders their results one after the other. The command line parameters
+// serve as the base for each query
+func runBatch(ctx context.Context, location, dbPath string, base query.Args) error {
+	if len(getQueryServerAddrs()) > 0 {
+		return errors.New("query batches can only be run against the local goDB")
+	}
+
+	var batchReader io.Reader = os.Stdin
+	if location != "-" {
+		f, err := os.Open(filepath.Clean(location))
+		if err != nil {
+			return fmt.Errorf("failed to open query batch from %s: %w", location, err)
+		}
+		defer f.Close()
+		batchReader = f
+	}
+
+	var rawArgs []jsoniter.RawMessage
+	if err := jsoniter.NewDecoder(batchReader).Decode(&rawArgs); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON query batch: %w", err)
+	}
+	if len(rawArgs) == 0 {
+		return errors.New("query batch is empty")
+	}
+
+	redactor, err := newRedactor()
+	if err != nil {
+		return err
+	}
+
+	var (
+		batch = make([]*query.Args, len(rawArgs))
+		stmts = make([]*query.Statement, len(rawArgs))
+	)
+	for i, raw := range rawArgs {
+		queryArgs := new(query.Args)
+		*queryArgs = base
+		if err := jsoniter.Unmarshal(raw, queryArgs); err != nil {
+			return fmt.Errorf("failed to unmarshal JSON query args of query %d: %w", i, err)
+		}
+		*queryArgs = setDefaultTimeRange(queryArgs)
+		if queryArgs.Caller == "" {
+			queryArgs.Caller = os.Args[0] // take the full path of called binary
+		}
+		if redactor != nil {
+			// resolved domains would reveal the redacted addresses
+			queryArgs.DNSResolution.Enabled = false
+		}
+
+		stmt, err := queryArgs.Prepare()
+		if err != nil {
+			return types.ShouldPretty(err, fmt.Sprintf("%s %d", queryPrepFailureMsg, i))
+		}
+		batch[i], stmts[i] = queryArgs, stmt
+	}
+
+	aliases, err := results.ParseColumnAliases(viper.GetString(conf.ResultsAliases))
+	if err != nil {
+		return fmt.Errorf("invalid column aliases: %w", err)
+	}
+
+	if queryTimeout := viper.GetDuration(conf.QueryTimeout); queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+	}
+
+	res, err := engine.NewQueryRunner(dbPath, engine.WithKeepAlive(viper.GetDuration(conf.QueryKeepAlive))).RunBatch(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("failed to execute query batch: %w", err)
+	}
+
+	var (
+		summaryOnly   = viper.GetBool(conf.SummaryOnly)
+		deterministic = viper.GetBool(conf.Deterministic)
+	)
+	for i, result := range res {
+		stmt := stmts[i]
+		if redactor != nil {
+			redactor.Redact(result)
+		}
+		if deterministic {
+			result.MakeDeterministic(results.By(stmt.SortBy, stmt.Direction, stmt.SortAscending))
+		}
+		tRenderStart := time.Now()
+
+		// serialize raw results if json is selected (one document per query)
+		if stmt.Format == types.FormatJSON {
+			if summaryOnly {
+				result.DropRows()
+			}
+			if err := results.EncodeJSON(stmt.Output, result, aliases); err != nil {
+				return fmt.Errorf("failed to serialize results of query %d: %w", i, err)
+			}
+			if err := writeProfile(result, time.Since(tRenderStart)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if result.Status.Code != types.StatusOK {
+			logger, err := logging.New(logging.LevelInfo, logging.EncodingPlain,
+				logging.WithOutput(stmt.Output),
+			)
+			if err != nil {
+				return err
+			}
+			logger.Infof("Status %q: %s", result.Status.Code, result.Status.Message)
+			continue
+		}
+
+		err = stmt.Print(ctx, result,
+			results.WithQueryStats(viper.GetBool(conf.QueryStats)),
+			results.WithSummaryOnly(summaryOnly),
+			results.WithColumnAliases(aliases),
+			results.WithDeterministic(deterministic),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to print results of query %d: %w", i, err)
+		}
+
+		// DNS resolution is performed while printing, but accounted for separately
+		if err := writeProfile(result, time.Since(tRenderStart)-result.Summary.Timings.ResolutionDuration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// checkCondition validates the condition without running a query and prints how it is understood
+// by the parser (in the requested output format)
+func checkCondition(w io.Writer, condition string, dnsTimeout time.Duration, strictHostnames bool, format string) error {
+	validation, err := node.Validate(condition, dnsTimeout, node.WithStrictHostnames(strictHostnames))
+	if err != nil {
+		errMsg := err.Error()
+		var p *types.ParseError
+		if errors.As(err, &p) {
+			errMsg = "\n" + p.Pretty()
+		}
+		return fmt.Errorf("invalid condition: %s", errMsg)
+	}
+
+	if format == types.FormatJSON {
+		return jsoniter.NewEncoder(w).Encode(validation)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Tokens:\t%s\n", strings.Join(validation.Tokens, " "))
+	fmt.Fprintf(tw, "Resolved:\t%s\n", validation.Resolved)
+	for i, cond := range validation.Conditions {
+		label := ""
+		if i == 0 {
+			label = "Conditions:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", label, cond)
+	}
+	for i, warning := range validation.Warnings {
+		label := ""
+		if i == 0 {
+			label = "Warnings:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", label, warning)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if validation.Tree != "" {
+		fmt.Fprintf(w, "\nParse tree:\n\n%s\n", validation.Tree)
+	}
+	return nil
+}
+
+// translateToBPF translates the condition into the closest equivalent BPF filter expression and prints
+// it (in the requested output format)
+func translateToBPF(w io.Writer, condition string, dnsTimeout time.Duration, strictHostnames bool, format string) error {
+	translation, err := node.ToBPFFilter(condition, dnsTimeout, node.WithStrictHostnames(strictHostnames))
+	if err != nil {
+		errMsg := err.Error()
+		var p *types.ParseError
+		if errors.As(err, &p) {
+			errMsg = "\n" + p.Pretty()
+		}
+		return fmt.Errorf("invalid condition: %s", errMsg)
+	}
+	return printTranslation(w, "BPF filter", translation, format)
+}
+
+// translateFromBPF translates the BPF filter expression into the closest equivalent condition and prints
+// it (in the requested output format)
+func translateFromBPF(w io.Writer, bpfFilter string, format string) error {
+	translation, err := bpffilter.ToCondition(bpfFilter)
+	if err != nil {
+		return err
+	}
+	return printTranslation(w, "Condition", translation, format)
+}
+
+// printTranslation prints the translation of a condition into a BPF filter expression (or vice versa)
+// in the requested output format
+func printTranslation(w io.Writer, label string, translation *bpffilter.Translation, format string) error {
+	if format == types.FormatJSON {
+		return jsoniter.NewEncoder(w).Encode(translation)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s:\t%s\n", label, translation.Result)
+	exact := "yes"
+	if !translation.Exact {
+		exact = "no"
+	}
+	fmt.Fprintf(tw, "Exact:\t%s\n", exact)
+	for i, warning := range translation.Warnings {
+		label := ""
+		if i == 0 {
+			label = "Warnings:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", label, warning)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCondition(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, checkCondition(&buf, "sip = 10.0.0.1 | !(dport < 80)", 0, false, types.FormatTXT))
+	require.Equal(t, `Tokens:      sip = 10.0.0.1 | ! ( dport < 80 )
+Resolved:    (sip = 10.0.0.1 | dport >= 80)
+Conditions:  sip = 10.0.0.1
+             dport >= 80
+
+Parse tree:
+
+OR
+├── sip = 10.0.0.1
+└── NOT
+    └── dport < 80
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, checkCondition(&buf, "dport = 443", 0, false, types.FormatJSON))
+	require.JSONEq(t, `{
+		"tokens": ["dport", "=", "443"],
+		"conditions": [{"attribute": "dport", "comparator": "=", "value": "443"}],
+		"resolved": "dport = 443",
+		"tree": "dport = 443"
+	}`, buf.String())
+
+	require.NotNil(t, checkCondition(&buf, "dport = ", 0, false, types.FormatTXT))
+}
+
+func TestTranslateCondition(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, translateToBPF(&buf, "host = 10.0.0.1 & dport != 22 & vlan = 5", 0, false, types.FormatTXT))
+	require.Equal(t, `BPF filter:  host 10.0.0.1 and not port 22
+Exact:       no
+Warnings:    dport != 22: translated to `+"`not port 22`"+`, which doesn't distinguish the source and destination port of packets (and only applies to TCP / UDP / SCTP)
+             vlan = 5: cannot be translated (the attribute is not part of the packet headers evaluated by filter expressions)
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, translateFromBPF(&buf, "net 10.0.0.0/8 and not udp", types.FormatJSON))
+	require.JSONEq(t, `{"result": "net = 10.0.0.0/8 & !(proto = udp)", "exact": true}`, buf.String())
+
+	require.NotNil(t, translateToBPF(&buf, "dport = ", 0, false, types.FormatTXT))
+	require.NotNil(t, translateFromBPF(&buf, "port", types.FormatTXT))
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/formatting"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// explainQuery validates the query and estimates its cost without running it and prints the estimate
+// (in the requested output format)
+func explainQuery(ctx context.Context, w io.Writer, querier query.Runner, args *query.Args) error {
+	dryRunner, ok := querier.(query.DryRunner)
+	if !ok {
+		return errors.New("querier does not support estimating the cost of queries")
+	}
+
+	res, err := dryRunner.DryRun(ctx, args)
+	if err != nil {
+		return fmt.Errorf("failed to estimate cost of query: %w", err)
+	}
+
+	return printDryRun(w, res, args.Format)
+}
+
+// printDryRun prints the outcome of a query dry-run
+func printDryRun(w io.Writer, res *results.DryRun, format string) error {
+	if format == types.FormatJSON {
+		return jsoniter.NewEncoder(w).Encode(res)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Time range:\t%s - %s\n", res.First.Format(time.RFC3339), res.Last.Format(time.RFC3339))
+	if len(res.Interfaces) > 0 {
+		fmt.Fprintf(tw, "Interfaces:\t%s\n", strings.Join(res.Interfaces, ", "))
+	}
+	if len(res.HostsStatuses) > 0 {
+		fmt.Fprintf(tw, "Hosts:\t%s\n", res.HostsStatuses.Summary())
+	}
+	fmt.Fprintf(tw, "Interfaces read:\t%d\n", res.Cost.Interfaces)
+	fmt.Fprintf(tw, "Directories read:\t%d\n", res.Cost.Directories)
+	if res.Cost.DirectoriesPruned > 0 {
+		fmt.Fprintf(tw, "Directories pruned:\t%d\n", res.Cost.DirectoriesPruned)
+	}
+	fmt.Fprintf(tw, "Blocks read:\t%d\n", res.Cost.Blocks)
+	fmt.Fprintf(tw, "Bytes read:\t%s\n", formatting.Size(res.Cost.Bytes))
+	fmt.Fprintf(tw, "Flows scanned:\t%s\n", formatting.Count(res.Cost.Flows))
+	for i, warning := range res.Warnings {
+		label := ""
+		if i == 0 {
+			label = "Warnings:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", label, warning)
+	}
+
+	// list the hosts the estimate failed for
+	var failed []string
+	for host, status := range res.HostsStatuses {
+		if status.Code == types.StatusError {
+			failed = append(failed, host)
+		}
+	}
+	slices.Sort(failed)
+	for i, host := range failed {
+		label := ""
+		if i == 0 {
+			label = "Failed hosts:"
+		}
+		fmt.Fprintf(tw, "%s\t%s: %s\n", label, host, res.HostsStatuses[host].Message)
+	}
+	return tw.Flush()
+}
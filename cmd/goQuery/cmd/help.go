@@ -45,6 +45,12 @@ const helpBaseLong = helpBase + `
       dip   (or dst)   destination ip
       dport (or port)  destination port
       proto            protocol (e.g. UDP, TCP)
+      dportclass       class of the destination port (well-known, registered or
+      (or portclass)   ephemeral, see --query.port-classes for user-defined classes).
+                       Mutually exclusive with dport
+
+    Custom attributes provided by compiled-in attribute plugins (if any) can be
+    used like any other column (and in conditions via = and !=).
 
     Labels which can also be printed as columns:
 
@@ -52,6 +58,15 @@ const helpBaseLong = helpBase + `
       hostname         hostname
       iface            interface
       time             timestamp
+      zone             network zone of the interface (e.g. internal, external, dmz)
+      tag              flow tags assigned during writeout (e.g. voip)
+      process          local process (and cgroup) owning the flow's socket,
+                       attributed during writeout (e.g. nginx (/system.slice/nginx.service))
+      vlan             802.1Q VLAN ID the flow was observed on (empty if untagged)
+      smac             source MAC address of the flow (empty if not recorded)
+      dmac             destination MAC address of the flow (empty if not recorded)
+      flags            TCP flags observed for the flow (e.g. SYN,ACK; empty if none)
+      dscp             DSCP the flow was observed with (e.g. EF; empty if default)
 
   QUERY_TYPE
 
@@ -70,6 +85,23 @@ const helpBaseLong = helpBase + `
                       (equivalent to columns "sip,dip,dport,proto")
       raw             a raw dump of all flows, including timestamps and interfaces
                       (equivalent to columns "time,iface,sip,dip,dport,proto")
+
+  SQL-LIKE STATEMENTS
+
+    Instead of the columns and flags, the query can be provided as a (quoted)
+    SQL-like statement, e.g.
+
+      goQuery "SELECT sip,dip,bytes WHERE dport = 443 AND iface = 'eth0' SINCE -24h LIMIT 50"
+
+    Supported clauses (in any order after SELECT):
+
+      SELECT <columns>              columns as above (bytes / packets are always shown)
+      FROM <interfaces>             interfaces to query (or iface = / iface IN (...) in WHERE)
+      WHERE <conditions>            conditions (see --condition), using AND / OR / NOT,
+                                    IN (...) / NOT IN (...) and quoted values
+      SINCE <time> / UNTIL <time>   time range (see --first / --last)
+      ORDER BY <column> [ASC|DESC]  column to sort by
+      LIMIT <n>                     number of results
 `
 
 var helpMap = map[string]string{
@@ -174,6 +206,43 @@ ATTRIBUTES:
     EXAMPLE: "dport = 22 & proto = TCP" is equivalent to
              "port = 22 & proto = 6"
 
+  VLAN:
+
+    vlan            802.1Q VLAN ID the flow was observed on (0 if untagged)
+
+    EXAMPLE: "vlan = 100 & dport = 443"
+             "vlan >= 100 & vlan < 200"
+
+  MAC addresses:
+
+    smac            source MAC address of the flow
+    dmac            destination MAC address of the flow
+
+    Only "=" and "!=" are supported as comparators.
+
+    EXAMPLE: "smac = aa:bb:cc:00:11:22"
+             "dmac != 00:11:22:33:44:55 & dport = 53"
+
+  TCP flags:
+
+    flags           TCP flags observed for the flow (fin, syn, rst, psh, ack,
+                    urg, ece, cwr), given as conjunction of (negated) flags.
+                    "flags = syn & !ack" holds if SYN was observed but ACK
+                    was not, "flags != ..." negates the condition.
+
+    Only "=" and "!=" are supported as comparators.
+
+    EXAMPLE: "flags = syn & !ack"
+             "flags = rst & dport = 443"
+
+  DSCP:
+
+    dscp            DSCP the flow was observed with, given as number (0-63)
+                    or code point name (e.g. ef, af41, cs1, be for 0)
+
+    EXAMPLE: "dscp = ef & proto = udp"
+             "dscp != be"
+
   Traffic Direction:
 
     direction (or dir)   Direction filter to match against aggregated results
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/els0r/goProbe/cmd/goQuery/pkg/conf"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ipsCmd = &cobra.Command{
+	Use:   "ips [ifaces]",
+	Short: "Lists the unique IPs observed per interface and day",
+	Long: `Lists the unique IPs observed per interface and day
+
+The unique source and destination IPs of each day are maintained by goProbe
+in an index during writeout, so they can be listed (or checked for a specific
+IP via --contains) without reading any flows. The time range is taken from
+--first / --last.
+
+If a list of interfaces is provided, only those interfaces are considered.
+Days written by releases not maintaining the index are marked as such.
+`,
+	Example: `  goQuery ips eth0 -f -7d
+  goQuery ips --contains 10.1.2.3 -f -30d`,
+	RunE: ipsEntrypoint,
+}
+
+var ipsContains string
+
+func init() {
+	rootCmd.AddCommand(ipsCmd)
+
+	flags := ipsCmd.Flags()
+
+	flags.StringVar(&ipsContains, "contains", "", `only state whether the IP was observed on each day instead of listing all IPs.
+`)
+}
+
+func ipsEntrypoint(_ *cobra.Command, args []string) error {
+	setDeterministicTimeZone()
+
+	var lookup netip.Addr
+	if ipsContains != "" {
+		ip, err := netip.ParseAddr(ipsContains)
+		if err != nil {
+			return fmt.Errorf("invalid IP address for --contains: %w", err)
+		}
+		lookup = ip.Unmap()
+	}
+
+	first, last, err := query.ParseTimeRange(cmdLineParams.First, cmdLineParams.Last)
+	if err != nil {
+		return err
+	}
+
+	var ifaces []string
+	for _, arg := range args {
+		ifaces = append(ifaces, strings.Split(arg, ",")...)
+	}
+
+	indices, err := goDB.ReadIPIndices(viper.GetString(conf.QueryDBPath), ifaces, first, last)
+	if err != nil {
+		return fmt.Errorf("failed to read IP indices: %w", err)
+	}
+
+	days := make([]gpapi.DayIPs, 0, len(indices))
+	for _, day := range indices {
+		var index gpapi.IPIndex
+		if day.Index != nil {
+			index = day.Index
+		}
+		days = append(days, gpapi.NewDayIPs(day.Iface, day.Day, index, lookup))
+	}
+
+	output := os.Stdout
+	if cmdLineParams.Format == types.FormatJSON {
+		return jsoniter.NewEncoder(output).Encode(days)
+	}
+	if lookup.IsValid() {
+		return printIPsContains(output, days)
+	}
+	return printIPs(output, days)
+}
+
+func printIPsContains(w io.Writer, days []gpapi.DayIPs) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 4, tableSep, tabwriter.AlignRight)
+
+	fmt.Fprintln(tw, strings.Join([]string{"iface", "day", "unique IPs", "contains"}, itemSep)+itemSep)
+	fmt.Fprintln(tw, strings.Join([]string{"-----", "---", "----------", "--------"}, itemSep)+itemSep)
+	for _, day := range days {
+		numIPs, contains := "n/a", "not indexed"
+		if day.Indexed {
+			numIPs, contains = strconv.Itoa(day.NumIPs), strconv.FormatBool(day.Contains)
+		}
+		fmt.Fprintln(tw, strings.Join([]string{
+			day.Iface,
+			day.Day.Format(types.DefaultTimeOutputFormat),
+			numIPs,
+			contains,
+		}, itemSep)+itemSep)
+	}
+	return tw.Flush()
+}
+
+func printIPs(w io.Writer, days []gpapi.DayIPs) error {
+	for _, day := range days {
+		header := day.Iface + " " + day.Day.Format(types.DefaultTimeOutputFormat)
+		if !day.Indexed {
+			fmt.Fprintf(w, "# %s: not indexed\n", header)
+			continue
+		}
+		fmt.Fprintf(w, "# %s: %d unique IPs\n", header, day.NumIPs)
+		for _, ip := range day.IPs {
+			fmt.Fprintln(w, ip)
+		}
+	}
+	return nil
+}
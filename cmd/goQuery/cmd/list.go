@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
@@ -12,9 +13,11 @@ import (
 	"text/tabwriter"
 
 	"github.com/els0r/goProbe/cmd/goQuery/pkg/conf"
+	"github.com/els0r/goProbe/pkg/formatting"
 	"github.com/els0r/goProbe/pkg/goDB"
 	"github.com/els0r/goProbe/pkg/goDB/info"
 	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/telemetry/logging"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/spf13/cobra"
@@ -31,6 +34,12 @@ are printed.
 
 Otherwise, all interface statistics are printed. By default, cumulative
 information is printed (sum of flows, sum of ingress and egress traffic)
+
+For inventory automation, the (per-interface) statistics can be printed in a
+machine-parsable format via -e json (retaining the nested schema of previous
+releases) or -e csv. The latter provides a flat and stable
+set of fields: iface, first, last, flows_v4, flows_v6, bytes_rcvd, bytes_sent,
+packets_rcvd, packets_sent, drops and zone (timestamps as epoch seconds in CSV)
 `,
 	RunE: listInterfacesEntrypoint,
 }
@@ -46,10 +55,13 @@ func init() {
 
 If enabled, both directions for packet and byte counters will be printed, the flows will
 be broken up into IPv4 and IPv6 flows and the drops for that interface will be shown.
+In addition, gaps in the data coverage (missing blocks or days within the queried time
+range, e.g. due to goProbe not running) are listed per interface.
 `)
 }
 
 func listInterfacesEntrypoint(_ *cobra.Command, args []string) error {
+	setDeterministicTimeZone()
 	return listInterfaces(context.Background(), viper.GetString(conf.QueryDBPath), viper.GetString(conf.QueryLog), args...)
 }
 
@@ -110,15 +122,24 @@ func listInterfaces(ctx context.Context, dbPath, queryLogFile string, ifaces ...
 	}
 
 	// create work managers
+	var opts []goDB.WorkManagerOption
+	if detailed {
+		opts = append(opts, goDB.WithCoverageGaps())
+	}
 	var dbWorkerManagers = make([]*goDB.DBWorkManager, 0, len(ifaceDirs))
 	for _, iface := range ifaceDirs {
-		wm, err := goDB.NewDBWorkManager(goDB.NewMetadataQuery(), dbPath, iface, runtime.NumCPU())
+		wm, err := goDB.NewDBWorkManager(goDB.NewMetadataQuery(), dbPath, iface, runtime.NumCPU(), opts...)
 		if err != nil {
 			return fmt.Errorf("failed to set up work manager for %s: %w", iface, err)
 		}
 		dbWorkerManagers = append(dbWorkerManagers, wm)
 	}
 
+	zones, err := info.ReadZones(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to read interface zones: %w", err)
+	}
+
 	ifacesMetadata = make([]*goDB.InterfaceMetadata, 0, len(dbWorkerManagers))
 	for _, manager := range dbWorkerManagers {
 		manager := manager
@@ -127,11 +148,18 @@ func listInterfaces(ctx context.Context, dbPath, queryLogFile string, ifaces ...
 		if err != nil {
 			return err
 		}
+		im.Zone = zones.Zone(im.Iface)
 		ifacesMetadata = append(ifacesMetadata, im)
 	}
 
-	if queryArgs.Format == "json" {
+	switch queryArgs.Format {
+	case types.FormatJSON:
 		return jsoniter.NewEncoder(output).Encode(ifacesMetadata)
+	case types.FormatCSV:
+		return printInterfaceSummariesCSV(output, ifacesMetadata)
+	case types.FormatTXT:
+	default:
+		return fmt.Errorf("unsupported output format for interface list: %s", queryArgs.Format)
 	}
 
 	// empty line before table header
@@ -149,6 +177,20 @@ func listInterfaces(ctx context.Context, dbPath, queryLogFile string, ifaces ...
 	return nil
 }
 
+func printInterfaceSummariesCSV(w io.Writer, ifaceMetadata []*goDB.InterfaceMetadata) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(goDB.InterfaceSummaryCSVHeader); err != nil {
+		return err
+	}
+	for _, metadata := range ifaceMetadata {
+		if err := cw.Write(metadata.Summary().CSVRecord()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
 const (
 	tableSep = ' '
 	itemSep  = "\t"
@@ -201,15 +243,42 @@ func printInterfaceStats(w io.Writer, ifaceMetadata []*goDB.InterfaceMetadata, d
 
 	// sum row
 	sumRow := totalsMetadata.TableRow(detailed)
-	// iface, from, to make no sense in the totals, so remove them
-	sumRow[0] = "Total"
+	// iface, zone, from, to make no sense in the totals, so remove them
+	sumRow[0], sumRow[1] = "Total", ""
+	sumRow[len(sumRow)-2], sumRow[len(sumRow)-1] = "", ""
 	if detailed {
-		sumRow[8], sumRow[9] = "", ""
-	} else {
-		sumRow[4], sumRow[5] = "", ""
+		// the same holds for the gaps
+		sumRow[len(sumRow)-3] = ""
 	}
 
 	fmt.Fprintln(tw, strings.Join(sumRow, itemSep)+itemSep)
 
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if detailed {
+		return printCoverageGaps(w, ifaceMetadata)
+	}
+	return nil
+}
+
+// printCoverageGaps lists the gaps in the data coverage of all interfaces (if any)
+func printCoverageGaps(w io.Writer, ifaceMetadata []*goDB.InterfaceMetadata) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 4, tableSep, 0)
+
+	header := false
+	for _, metadata := range ifaceMetadata {
+		for _, gap := range metadata.Gaps {
+			if !header {
+				fmt.Fprint(tw, "\nGaps in data coverage:\n\n")
+				header = true
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t-\t%s\t(%s)\n", metadata.Iface,
+				gap.From.Format(types.DefaultTimeOutputFormat),
+				gap.To.Format(types.DefaultTimeOutputFormat),
+				formatting.Durationable(gap.Duration()),
+			)
+		}
+	}
 	return tw.Flush()
 }
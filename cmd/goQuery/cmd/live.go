@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/api/goprobe/client"
+	"github.com/els0r/goProbe/pkg/formatting"
+	"github.com/els0r/goProbe/pkg/goDB/protocols"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/telemetry/logging"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/cobra"
+)
+
+var liveCmd = &cobra.Command{
+	Use:   "live",
+	Short: "Continuously prints new and updated flows observed by the local goProbe",
+	Long: `Continuously prints new and updated flows observed by the local goProbe
+
+The live flow data of the running goProbe instance is polled periodically and
+each flow which was newly observed or saw traffic since the previous poll is
+printed as a single line, e.g.
+
+  14:02:11.532 eth0 TCP 10.0.0.1 > 10.0.0.2:443 new in 12 pkts / 5.27 kB, out 3 pkts / 180 B
+
+The counters denote the traffic observed since the previous poll. Flows which
+were present before goQuery was started are only printed once they see traffic.
+
+Via -e json, each update is printed as a JSON document (one per line) instead
+`,
+	Args: cobra.NoArgs,
+	RunE: liveEntrypoint,
+}
+
+var (
+	liveIfaces       []string
+	liveServerAddr   string
+	livePollInterval time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(liveCmd)
+
+	flags := liveCmd.Flags()
+
+	flags.StringSliceVarP(&liveIfaces, "ifaces", "i", nil, `interfaces to follow (all interfaces if none are provided).
+`)
+	flags.StringVar(&liveServerAddr, "addr", gpapi.DefaultServerAddress, `address of the goProbe API to poll the live flow data from.
+`)
+	flags.DurationVar(&livePollInterval, "interval", time.Second, `interval in which the live flow data is polled.
+`)
+}
+
+func liveEntrypoint(_ *cobra.Command, _ []string) error {
+	if livePollInterval <= 0 {
+		return fmt.Errorf("invalid poll interval: %s", livePollInterval)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return followLiveFlows(ctx, client.New(liveServerAddr), os.Stdout, cmdLineParams.Format == types.FormatJSON)
+}
+
+// followLiveFlows polls the live flow data until the context is cancelled and prints all new and updated
+// flows to w
+func followLiveFlows(ctx context.Context, c *client.Client, w io.Writer, asJSON bool) error {
+	logger := logging.FromContext(ctx)
+
+	tracker := newLiveFlowTracker()
+
+	ticker := time.NewTicker(livePollInterval)
+	defer ticker.Stop()
+
+	for {
+		res, err := c.GetLiveFlows(ctx, liveIfaces...)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			// goProbe may be restarted while following its flows, hence failed polls are skipped
+			logger.Warnf("failed to fetch live flows: %v", err)
+		} else {
+			for _, update := range tracker.update(time.Now(), res.LastRotation, res.Flows) {
+				if err := printLiveFlowUpdate(w, update, asJSON); err != nil {
+					return err
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// liveFlowID identifies a flow of the live flow data across polls
+type liveFlowID struct {
+	iface string
+	gpapi.FlowKey
+}
+
+// liveFlowUpdate denotes a new or updated flow. Its counters hold the traffic observed since the
+// previous poll
+type liveFlowUpdate struct {
+	Timestamp time.Time `json:"timestamp"`
+	gpapi.LiveFlow
+	New bool `json:"new"`
+}
+
+// liveFlowTracker keeps track of the live flow data between polls to determine the traffic observed
+// in between
+type liveFlowTracker struct {
+	initialized  bool
+	lastRotation time.Time
+
+	counters map[liveFlowID]types.Counters // counters of the previous poll
+	known    map[liveFlowID]struct{}       // flows observed before the last rotation
+}
+
+func newLiveFlowTracker() *liveFlowTracker {
+	return &liveFlowTracker{
+		counters: make(map[liveFlowID]types.Counters),
+		known:    make(map[liveFlowID]struct{}),
+	}
+}
+
+// update processes the live flow data of a poll and returns all flows that are new or saw traffic since the
+// previous poll (ordered by interface and traffic volume). The first poll only serves as baseline
+func (t *liveFlowTracker) update(ts, lastRotation time.Time, flows []gpapi.LiveFlow) []liveFlowUpdate {
+
+	// the live flow data is reset upon rotation, hence the flows of the previous period are remembered in
+	// order to tell them apart from new ones
+	prev := t.counters
+	rotated := !lastRotation.Equal(t.lastRotation)
+	if rotated {
+		t.known = make(map[liveFlowID]struct{}, len(prev))
+		for id := range prev {
+			t.known[id] = struct{}{}
+		}
+		prev = nil
+	}
+	t.lastRotation = lastRotation
+
+	var updates []liveFlowUpdate
+	t.counters = make(map[liveFlowID]types.Counters, len(flows))
+	for _, flow := range flows {
+		id := liveFlowID{iface: flow.Iface, FlowKey: flow.FlowKey}
+		t.counters[id] = flow.Counters
+		if !t.initialized {
+			continue
+		}
+
+		base, seen := prev[id]
+		if !seen {
+			_, seen = t.known[id]
+		}
+
+		// counters can only decrease if the live flow data was reset without a rotation being
+		// reported (e.g. if goProbe was restarted)
+		delta := flow.Counters
+		if delta.PacketsRcvd >= base.PacketsRcvd && delta.PacketsSent >= base.PacketsSent {
+			delta.Sub(base)
+		}
+		if delta.SumPackets() == 0 {
+			continue
+		}
+
+		flow.Counters = delta
+		updates = append(updates, liveFlowUpdate{
+			Timestamp: ts,
+			LiveFlow:  flow,
+			New:       !seen,
+		})
+	}
+	t.initialized = true
+
+	slices.SortFunc(updates, func(a, b liveFlowUpdate) int {
+		return cmp.Or(
+			cmp.Compare(a.Iface, b.Iface),
+			cmp.Compare(b.Counters.SumBytes(), a.Counters.SumBytes()),
+		)
+	})
+	return updates
+}
+
+func printLiveFlowUpdate(w io.Writer, update liveFlowUpdate, asJSON bool) error {
+	if asJSON {
+		return jsoniter.NewEncoder(w).Encode(update)
+	}
+	_, err := fmt.Fprintln(w, formatLiveFlowUpdate(update))
+	return err
+}
+
+// formatLiveFlowUpdate renders an update as single line, e.g.
+//
+//	14:02:11.532 eth0 TCP 10.0.0.1 > 10.0.0.2:443 new in 12 pkts / 5.27 kB, out 3 pkts / 180 B
+func formatLiveFlowUpdate(update liveFlowUpdate) string {
+	proto := protocols.GetIPProto(int(update.IPProto))
+	if proto == "" {
+		proto = fmt.Sprint(update.IPProto)
+	}
+
+	// the destination port is only meaningful for protocols using ports
+	dst := update.DstIP.String()
+	if update.DstPort != 0 {
+		dst = netip.AddrPortFrom(update.DstIP, update.DstPort).String()
+	}
+
+	state := "upd"
+	if update.New {
+		state = "new"
+	}
+
+	return fmt.Sprintf("%s %s %s %s > %s %s in %s pkts / %s, out %s pkts / %s",
+		update.Timestamp.Format("15:04:05.000"),
+		update.Iface,
+		proto,
+		update.SrcIP,
+		dst,
+		state,
+		formatting.CountSmall(update.Counters.PacketsRcvd, false),
+		liveBytes(update.Counters.BytesRcvd),
+		formatting.CountSmall(update.Counters.PacketsSent, false),
+		liveBytes(update.Counters.BytesSent),
+	)
+}
+
+func liveBytes(size uint64) string {
+	if size > 1024 {
+		return formatting.Size(size)
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func testLiveFlow(iface, dip string, dport uint16, pr, ps uint64) gpapi.LiveFlow {
+	return gpapi.LiveFlow{
+		FlowKey: gpapi.FlowKey{
+			SrcIP:   netip.MustParseAddr("10.0.0.1"),
+			DstIP:   netip.MustParseAddr(dip),
+			DstPort: dport,
+			IPProto: 6,
+		},
+		Iface:    iface,
+		Counters: types.Counters{PacketsRcvd: pr, PacketsSent: ps, BytesRcvd: pr * 100, BytesSent: ps * 100},
+	}
+}
+
+func TestLiveFlowTracker(t *testing.T) {
+	var (
+		tracker  = newLiveFlowTracker()
+		now      = time.Now()
+		rotation = now.Add(-time.Minute)
+	)
+
+	// the first poll only serves as baseline
+	require.Empty(t, tracker.update(now, rotation, []gpapi.LiveFlow{
+		testLiveFlow("eth0", "10.0.0.2", 443, 10, 5),
+		testLiveFlow("eth0", "10.0.0.3", 22, 1, 1),
+	}))
+
+	updates := tracker.update(now, rotation, []gpapi.LiveFlow{
+		testLiveFlow("eth0", "10.0.0.2", 443, 12, 6),
+		testLiveFlow("eth0", "10.0.0.3", 22, 1, 1),
+		testLiveFlow("eth1", "10.0.0.4", 53, 1, 0),
+		testLiveFlow("eth0", "10.0.0.5", 80, 10, 10),
+	})
+	require.Equal(t, []liveFlowUpdate{
+		{Timestamp: now, LiveFlow: testLiveFlow("eth0", "10.0.0.5", 80, 10, 10), New: true},
+		{Timestamp: now, LiveFlow: testLiveFlow("eth0", "10.0.0.2", 443, 2, 1), New: false},
+		{Timestamp: now, LiveFlow: testLiveFlow("eth1", "10.0.0.4", 53, 1, 0), New: true},
+	}, updates)
+
+	// after a rotation, the counters start from scratch but flows of the previous period are not new
+	rotation = now
+	updates = tracker.update(now, rotation, []gpapi.LiveFlow{
+		testLiveFlow("eth0", "10.0.0.3", 22, 2, 0),
+		testLiveFlow("eth0", "10.0.0.6", 443, 1, 0),
+	})
+	require.Equal(t, []liveFlowUpdate{
+		{Timestamp: now, LiveFlow: testLiveFlow("eth0", "10.0.0.3", 22, 2, 0), New: false},
+		{Timestamp: now, LiveFlow: testLiveFlow("eth0", "10.0.0.6", 443, 1, 0), New: true},
+	}, updates)
+
+	// decreasing counters (e.g. after a restart of goProbe) are taken as they are
+	updates = tracker.update(now, rotation, []gpapi.LiveFlow{
+		testLiveFlow("eth0", "10.0.0.3", 22, 1, 0),
+	})
+	require.Equal(t, []liveFlowUpdate{
+		{Timestamp: now, LiveFlow: testLiveFlow("eth0", "10.0.0.3", 22, 1, 0), New: false},
+	}, updates)
+}
+
+func TestFormatLiveFlowUpdate(t *testing.T) {
+	ts := time.Date(2024, 4, 12, 14, 2, 11, 532000000, time.Local)
+
+	update := liveFlowUpdate{Timestamp: ts, LiveFlow: testLiveFlow("eth0", "10.0.0.2", 443, 12, 3), New: true}
+	update.Counters.BytesRcvd = 5400
+	require.Equal(t, "14:02:11.532 eth0 TCP 10.0.0.1 > 10.0.0.2:443 new in 12 pkts / 5.27 kB, out 3 pkts / 300 B", formatLiveFlowUpdate(update))
+
+	update = liveFlowUpdate{Timestamp: ts, LiveFlow: testLiveFlow("eth0", "2001:db8::1", 0, 1, 0)}
+	update.SrcIP, update.IPProto = netip.MustParseAddr("2001:db8::2"), 58
+	require.Equal(t, "14:02:11.532 eth0 IPv6-ICMP 2001:db8::2 > 2001:db8::1 upd in 1 pkts / 100 B, out 0 pkts / 0 B", formatLiveFlowUpdate(update))
+}
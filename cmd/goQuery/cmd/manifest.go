@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/els0r/goProbe/cmd/goQuery/pkg/conf"
+	"github.com/els0r/goProbe/pkg/formatting"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Prints the manifest of the goDB",
+	Long: `Prints the manifest of the goDB
+
+The manifest summarizes the interfaces, covered time ranges, encoders and sizes
+of the goDB. It is maintained by goProbe during writeouts. If no manifest is
+present, it is generated by walking the database.
+`,
+	RunE: manifestEntrypoint,
+}
+
+var rebuildManifest bool
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+
+	flags := manifestCmd.Flags()
+
+	flags.BoolVar(&rebuildManifest, "rebuild", false, `ignore a stored manifest and generate it by walking the database.
+`)
+}
+
+func manifestEntrypoint(_ *cobra.Command, _ []string) error {
+	dbPath := viper.GetString(conf.QueryDBPath)
+
+	var (
+		manifest *info.Manifest
+		err      error
+	)
+	if rebuildManifest {
+		manifest, err = info.BuildManifest(dbPath)
+	} else {
+		manifest, err = info.ReadOrBuildManifest(dbPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	output := os.Stdout
+	if cmdLineParams.Format == types.FormatJSON {
+		return jsoniter.NewEncoder(output).Encode(manifest)
+	}
+
+	fmt.Fprintln(output)
+	if err := printManifest(output, manifest); err != nil {
+		return err
+	}
+	fmt.Fprintln(output)
+
+	return nil
+}
+
+func printManifest(w io.Writer, manifest *info.Manifest) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 4, tableSep, tabwriter.AlignRight)
+
+	ifaces := make([]string, 0, len(manifest.Interfaces))
+	for iface := range manifest.Interfaces {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	fmt.Fprintln(tw, strings.Join([]string{"iface", "size", "encoders", "from", "to"}, itemSep)+itemSep)
+	fmt.Fprintln(tw, strings.Join([]string{"-----", "----", "--------", "----", "--"}, itemSep)+itemSep)
+	for _, iface := range ifaces {
+		im := manifest.Interfaces[iface]
+		fmt.Fprintln(tw, strings.Join([]string{
+			iface,
+			formatting.Size(im.SizeBytes),
+			strings.Join(im.Encoders, ","),
+			im.First.Format(types.DefaultTimeOutputFormat),
+			im.Last.Format(types.DefaultTimeOutputFormat),
+		}, itemSep)+itemSep)
+	}
+	fmt.Fprintln(tw, strings.Repeat(itemSep, 5))
+	fmt.Fprintln(tw, strings.Join([]string{"Total", formatting.Size(manifest.SizeBytes), "", "", ""}, itemSep)+itemSep)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nVersion: %s, last updated: %s\n", manifest.Version, manifest.UpdatedAt.Format(types.DefaultTimeOutputFormat))
+	return nil
+}
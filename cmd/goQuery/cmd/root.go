@@ -26,6 +26,8 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	_ "github.com/els0r/goProbe/plugins/attribute" // Include custom attributes (if any, see plugins/attribute)
 )
 
 var cfgFile string
@@ -106,11 +108,22 @@ func init() {
   bytes         Sort by accumulated data volume (default)
   packets       Sort by accumulated packets
   time          Sort by time. Enforced for "time" queries
+  sip, dip      Sort by source / destination IP (numeric order, IPv4 before IPv6)
+  dport         Sort by destination port
+  proto         Sort by IP protocol number
+  iface         Sort by interface name
+
+Sorting by an attribute column requires it to be part of the query. Counter
+columns are sorted in descending, attribute columns in ascending order by default.
 `,
 	)
 	flags.BoolVarP(&cmdLineParams.SortAscending, conf.SortAscending, "a", false,
 		`Sort results in ascending instead of descending order. Forced for queries
 including the "time" field.
+`,
+	)
+	flags.BoolVarP(&cmdLineParams.SortDescending, conf.SortDescending, "", false,
+		`Sort results by an attribute column in descending instead of ascending order.
 `,
 	)
 
@@ -151,6 +164,28 @@ and I/O load)
 `,
 	)
 	flags.StringVarP(&cmdLineParams.QueryHosts, conf.QueryHostsResolution, "q", "", "Hosts resolution query\n")
+	flags.BoolVar(&cmdLineParams.StrictHostnames, conf.QueryStrictHostnames, false,
+		`Fail if a hostname in the condition (e.g. "dip = www.example.com") resolves to multiple
+addresses. By default, a warning is reported and the condition applies to all of them
+`,
+	)
+	flags.StringVar(&cmdLineParams.PortClasses, conf.QueryPortClasses, "",
+		`User-defined port classes used for the dportclass column, given as a semicolon-separated
+list of named ports / port ranges, e.g. "web=80,443,8080-8090;dns=53". Ports not
+covered by any class are attributed to the "other" class
+`,
+	)
+	flags.StringVar(&cmdLineParams.MatrixSrcGroups, conf.QueryMatrixSrc, "",
+		`Source prefix groups of a traffic matrix (e.g. sites or VLAN subnets), given as a
+semicolon-separated list of named prefixes / IPs, e.g. "siteA=10.1.0.0/16;siteB=10.2.0.0/16".
+Requires --`+conf.QueryMatrixDst+` and the sip and dip attributes. If set, the traffic
+between the groups is printed as a matrix instead of the individual rows
+`,
+	)
+	flags.StringVar(&cmdLineParams.MatrixDstGroups, conf.QueryMatrixDst, "",
+		`Destination prefix groups of a traffic matrix (same syntax as --`+conf.QueryMatrixSrc+`)
+`,
+	)
 
 	// persistent flags to be also passed to children commands
 	pflags.String(conf.ProfilingOutputDir, "", "Enable and set directory to store CPU and memory profiles")
@@ -160,6 +195,14 @@ and I/O load)
   txt           Output in plain text format (default)
   json          Output in JSON format
   csv           Output in comma-separated table format
+  xlsx          Output as Excel workbook (redirect to a file)
+  parquet       Output as Apache Parquet file (redirect to a file)
+`,
+	)
+
+	pflags.String(conf.ResultsAliases, "",
+		`Comma-separated list of user-defined column names used in the output (including
+JSON keys), e.g. "sip=client,dip=server"
 `,
 	)
 
@@ -167,9 +210,22 @@ and I/O load)
 	pflags.StringVarP(&cmdLineParams.First, conf.First, "f", "", helpMap["First"])
 	pflags.StringVarP(&cmdLineParams.Last, conf.Last, "l", "", "Show flows no later than --last. See help for --first for more info\n")
 
-	pflags.String(conf.QueryServerAddr, "",
+	pflags.StringSlice(conf.QueryServerAddr, nil,
 		`Address of query server to run queries against (host:port). If this value is
-set, goQuery will attempt to run queries using the specified query server as opposed to its local goDB
+set, goQuery will attempt to run queries using the specified query server as opposed to its local goDB.
+Multiple (redundant) query servers can be provided (comma-separated or by repeating the flag), in which
+case failed queries are transparently retried against the next query server
+`,
+	)
+	pflags.String(conf.QueryServerFailover, string(gqclient.FailoverOrdered),
+		`Order in which multiple query servers are tried:
+  ordered       Try the query servers in the order they were provided
+  fastest       Try the query servers in ascending order of their health check latency
+`,
+	)
+	pflags.Bool(conf.QueryServerHealth, true,
+		`Check the health of multiple query servers prior to running a query, trying
+unhealthy ones only as a last resort
 `,
 	)
 	pflags.StringP(conf.QueryDBPath, "d", defaults.DBPath,
@@ -183,10 +239,119 @@ goProbe.
 `,
 	)
 	pflags.String(conf.StoredQuery, "", "Load JSON serialized query arguments from disk and run them\n")
+	pflags.String(conf.QueryBatch, "",
+		`Load a JSON serialized list of query arguments from disk (or stdin via "-") and run
+them in a single pass over the local goDB. All queries must cover the same time range and
+interfaces (which can be set for all of them via the command line parameters)
+`,
+	)
 	pflags.Duration(conf.QueryTimeout, query.DefaultQueryTimeout, "Abort query processing after timeout expires\n")
+	pflags.DurationVar(&cmdLineParams.Deadline, conf.QueryDeadline, 0,
+		`Stop query processing once the deadline expires and return the results aggregated
+so far (flagged as truncated). In contrast to --query.timeout, the query does not fail
+`,
+	)
 	pflags.String(conf.QueryLog, "", "Log query invocations to file\n")
 	pflags.DurationP(conf.QueryKeepAlive, "k", 0, "Interval to emit log messages showing that query processing is still ongoing\n")
 	pflags.Bool(conf.QueryStats, false, "Print query DB interaction statistics\n")
+	pflags.BoolVar(&cmdLineParams.Profile, conf.QueryProfile, false,
+		`Report per-stage timings of the query (directory walk, block reads, decompression,
+aggregation, merge, sort, DNS resolution, serialization) in the result summary and
+write them as JSON to stderr once the output has been rendered
+`,
+	)
+	pflags.BoolVar(&cmdLineParams.Drops, conf.QueryDrops, false,
+		`Report the packets dropped during the covered time range (per time bin if the time
+attribute is queried) and annotate the totals with the traffic estimated to be missing
+due to them. Drops are only available for data stored in the DB (not for live flows)
+`,
+	)
+	pflags.BoolVar(&cmdLineParams.Provenance, conf.QueryProvenance, false,
+		`Report the hosts / DBs the data originated from and how it was obtained (software
+versions, block time range actually covered, encoders and corrupt blocks encountered,
+sampling state) in the result summary (JSON / CSV output)
+`,
+	)
+	pflags.StringVar(&cmdLineParams.Zones, conf.QueryZones, "",
+		`Restrict the queried interfaces to those tagged with any of the given network zones
+in the goProbe configuration (comma-separated list, e.g. "external,dmz")
+`,
+	)
+	pflags.StringVar(&cmdLineParams.Tags, conf.QueryTags, "",
+		`Restrict the query to flows tagged with any of the given flow tags during writeout
+(comma-separated list, e.g. "voip,web"). Live flows are not tagged
+`,
+	)
+	pflags.StringVar(&cmdLineParams.TimeWindows, conf.QueryTimeWindows, "",
+		`Restrict the query to recurring time windows within the queried time range, given as
+a semicolon-separated list of optional weekdays / weekday ranges followed by a time of
+day range, e.g. "mon-fri 09:00-17:00;sat 10:00-12:00". Blocks straddling a window
+boundary are considered if at least half of their interval falls into the window
+`,
+	)
+	pflags.StringVar(&cmdLineParams.TimeWindowsZone, conf.QueryTimeWindowsZone, "",
+		`IANA time zone the time windows are evaluated in (e.g. "Europe/Zurich"). Defaults to
+the local time zone of the host running the query
+`,
+	)
+	pflags.StringVar(&cmdLineParams.BaselineFirst, conf.QueryBaselineFirst, "",
+		`Only show new talkers, i.e. rows whose attribute combination did not occur during
+the baseline time range starting at the given time (same formats as --first), e.g.
+new external destinations in the last hour vs. the previous week
+`,
+	)
+	pflags.StringVar(&cmdLineParams.BaselineLast, conf.QueryBaselineLast, "",
+		`End of the baseline time range (see --`+conf.QueryBaselineFirst+`). Defaults to --first, i.e. the
+baseline directly precedes the queried time range
+`,
+	)
+	pflags.Bool(conf.CheckCondition, false,
+		`Validate the condition provided via --condition without running a query. Prints
+its canonical tokenized form, the conditions it is evaluated by (with hostnames
+resolved) and its parse tree
+`,
+	)
+	pflags.Bool(conf.ToBPF, false,
+		`Translate the condition provided via --condition into the closest equivalent BPF
+filter expression (tcpdump syntax, as supported by capture filters) without running
+a query. Prints all parts of the condition which could only be approximated or not
+be translated at all
+`,
+	)
+	pflags.String(conf.FromBPF, "",
+		`Translate the given BPF filter expression (tcpdump syntax) into the closest
+equivalent condition without running a query (see --`+conf.ToBPF+`)
+`,
+	)
+	pflags.Bool(conf.Explain, false,
+		`Validate the query and estimate its cost without running it. Prints the time range
+and interfaces covered as well as the number of directories, blocks, bytes and flows
+read. Supported for the local goDB and query servers (see --`+conf.QueryServerAddr+`)
+`,
+	)
+	pflags.Bool(conf.Redact, false,
+		`Pseudonymize IP addresses and strip hostnames / host IDs in the output, e.g. to share
+it in bug reports. IP addresses are replaced consistently (within a run) by keyed
+hashes of the same address family. Disables reverse DNS lookups
+`,
+	)
+	pflags.Bool(conf.RedactPrefixes, false,
+		`Preserve the prefix structure when pseudonymizing IP addresses: addresses sharing
+a prefix map to pseudonyms sharing a prefix of the same length. Requires --redact
+`,
+	)
+	pflags.Bool(conf.SummaryOnly, false,
+		`Skip printing of result rows and only show the summary (totals, covered time
+range and, if enabled, the query statistics) in the selected output format
+`,
+	)
+	pflags.Bool(conf.Deterministic, false,
+		`Produce deterministic (golden) output which can be diffed across runs of the same query,
+e.g. for CI assertions: timestamps are printed (and absolute times without time zone are
+interpreted) in UTC, rows are ordered with defined tie-breaks and runtime information (query
+duration, profiling, clock skew, last writeouts) is omitted
+`,
+	)
 	pflags.Bool(conf.QueryStreaming, false, "Stream results instead of waiting for the final result from a distributed query\n")
 
 	pflags.String(conf.LogLevel, logging.LevelWarn.String(), "log level (debug, info, warn, error, fatal, panic)")
@@ -246,6 +411,8 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 	// in the arguments
 	dbPathCfg := viper.GetString(conf.QueryDBPath)
 
+	setDeterministicTimeZone()
+
 	queryCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	defer stop()
 
@@ -265,6 +432,24 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 		return nil
 	}
 
+	// validate the condition and exit
+	if viper.GetBool(conf.CheckCondition) {
+		return checkCondition(os.Stdout, cmdLineParams.Condition, cmdLineParams.DNSResolution.Timeout, cmdLineParams.StrictHostnames, cmdLineParams.Format)
+	}
+
+	// translate the condition into a BPF filter expression (or vice versa) and exit
+	if viper.GetBool(conf.ToBPF) {
+		return translateToBPF(os.Stdout, cmdLineParams.Condition, cmdLineParams.DNSResolution.Timeout, cmdLineParams.StrictHostnames, cmdLineParams.Format)
+	}
+	if bpfFilter := viper.GetString(conf.FromBPF); bpfFilter != "" {
+		return translateFromBPF(os.Stdout, bpfFilter, cmdLineParams.Format)
+	}
+
+	// run a batch of queries if requested. The cmdLineParams are taken as the base for each query
+	if batchLocation := viper.GetString(conf.QueryBatch); batchLocation != "" {
+		return runBatch(queryCtx, batchLocation, dbPathCfg, queryArgs)
+	}
+
 	// check if arguments should be loaded from disk. The cmdLineParams are taken as
 	// the base for this to allow modification of single parameters
 	argsLocation := viper.GetString(conf.StoredQuery)
@@ -293,8 +478,15 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 			return cmd.Help()
 		}
 
-		// if we didn't find a supported command, we assume this is the query type
-		queryArgs.Query = args[0]
+		// statements in the SQL-like syntax (e.g. "SELECT sip,dip WHERE dport = 443 SINCE -24h") are
+		// translated into the query args. Otherwise, we assume this is the query type
+		if stmt := strings.Join(args, " "); query.IsSQL(stmt) {
+			if err = queryArgs.ApplySQL(stmt); err != nil {
+				return err
+			}
+		} else {
+			queryArgs.Query = args[0]
+		}
 	}
 
 	// make sure there's protection against unbounded time intervals
@@ -329,7 +521,7 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 
 	// run query against query server if it is specified, otherwise, take the local DB
 	var querier query.Runner
-	if viper.GetString(conf.QueryServerAddr) != "" {
+	if queryServerAddrs := getQueryServerAddrs(); len(queryServerAddrs) > 0 {
 		if queryArgs.QueryHosts == "" {
 			err := fmt.Errorf("list of target hosts is empty")
 			fmt.Fprintf(os.Stderr, "Distributed query preparation failed: %v\n", err)
@@ -349,29 +541,28 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 			}
 		}
 
-		// query using query server
+		// query using query server(s)
+		newQuerier := func(addr string) gqclient.Server {
+			return gqclient.New(addr)
+		}
 		if viper.GetBool(conf.QueryStreaming) {
 			logger.Info("calling streaming API")
 
-			querier = gqclient.NewSSE(viper.GetString(conf.QueryServerAddr),
-
-				// TODO: this will become more informational in the future as in: printing partial results, etc.
-				func(ctx context.Context, r *results.Result) error {
-					if r == nil {
-						return nil
-					}
-					all := len(r.HostsStatuses)
-					errs := len(r.HostsStatuses.GetErrorStatuses())
-
-					logger := logging.FromContext(ctx)
-					logger.Infof("received update: %d total / %d done / %d errors", all, all-errs, errs)
+			newQuerier = func(addr string) gqclient.Server {
+				return newStreamingQuerier(addr)
+			}
+		}
 
-					return nil
-				},
-				func(ctx context.Context, r *results.Result) error { return nil },
+		querier = newQuerier(queryServerAddrs[0])
+		if len(queryServerAddrs) > 1 {
+			strategy := gqclient.FailoverStrategy(viper.GetString(conf.QueryServerFailover))
+			if strategy != gqclient.FailoverOrdered && strategy != gqclient.FailoverFastest {
+				return fmt.Errorf("invalid query server failover strategy: %s", strategy)
+			}
+			querier = gqclient.NewFailover(queryServerAddrs, newQuerier,
+				gqclient.WithFailoverStrategy(strategy),
+				gqclient.WithHealthCheck(viper.GetBool(conf.QueryServerHealth)),
 			)
-		} else {
-			querier = gqclient.New(viper.GetString(conf.QueryServerAddr))
 		}
 	} else {
 		// query using local goDB
@@ -410,6 +601,15 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 
+	redactor, err := newRedactor()
+	if err != nil {
+		return err
+	}
+	if redactor != nil {
+		// resolved domains would reveal the redacted addresses
+		queryArgs.DNSResolution.Enabled = false
+	}
+
 	// convert the command line parameters
 	stmt, err := queryArgs.Prepare()
 	if err != nil {
@@ -417,12 +617,22 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 		return types.ShouldPretty(err, queryPrepFailureMsg)
 	}
 
+	aliases, err := results.ParseColumnAliases(viper.GetString(conf.ResultsAliases))
+	if err != nil {
+		return fmt.Errorf("invalid column aliases: %w", err)
+	}
+
 	if queryLogFile != "" {
 		if qlogger != nil {
 			qlogger.With("stmt", stmt).Info("running query")
 		}
 	}
 
+	// estimate the cost of the query and exit
+	if viper.GetBool(conf.Explain) {
+		return explainQuery(ctx, os.Stdout, querier, &queryArgs)
+	}
+
 	result, err = querier.Run(ctx, &queryArgs)
 	if err != nil {
 		return fmt.Errorf(`failed to execute query
@@ -432,13 +642,27 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 %s`, err, types.PrettyIndent(stmt, 4))
 	}
 
+	if redactor != nil {
+		redactor.Redact(result)
+	}
+	deterministic := viper.GetBool(conf.Deterministic)
+	if deterministic {
+		result.MakeDeterministic(results.By(stmt.SortBy, stmt.Direction, stmt.SortAscending))
+	}
+
+	summaryOnly := viper.GetBool(conf.SummaryOnly)
+	tRenderStart := time.Now()
+
 	// serialize raw results array if json is selected
 	if stmt.Format == types.FormatJSON {
-		err = jsoniter.NewEncoder(stmt.Output).Encode(result)
+		if summaryOnly {
+			result.DropRows()
+		}
+		err = results.EncodeJSON(stmt.Output, result, aliases)
 		if err != nil {
 			return fmt.Errorf("failed to serialize query results: %w", err)
 		}
-		return nil
+		return writeProfile(result, time.Since(tRenderStart))
 	}
 
 	// when running against a local goDB, there should be exactly one result
@@ -466,10 +690,52 @@ func entrypoint(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 
-	err = stmt.Print(ctx, result, results.WithQueryStats(viper.GetBool(conf.QueryStats)))
+	err = stmt.Print(ctx, result,
+		results.WithQueryStats(viper.GetBool(conf.QueryStats)),
+		results.WithSummaryOnly(summaryOnly),
+		results.WithColumnAliases(aliases),
+		results.WithDeterministic(deterministic),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to print query result: %w", err)
 	}
+
+	// DNS resolution is performed while printing, but accounted for separately
+	return writeProfile(result, time.Since(tRenderStart)-result.Summary.Timings.ResolutionDuration)
+}
+
+// setDeterministicTimeZone switches the local time zone to UTC if deterministic output was requested,
+// so that the output doesn't depend on the time zone of the host running goQuery
+func setDeterministicTimeZone() {
+	if viper.GetBool(conf.Deterministic) {
+		time.Local = time.UTC
+	}
+}
+
+// newRedactor returns the redactor for the query results if redaction was requested (nil otherwise)
+func newRedactor() (*results.Redactor, error) {
+	if !viper.GetBool(conf.Redact) {
+		return nil, nil
+	}
+	redactor, err := results.NewRedactor(results.WithPreservedPrefixes(viper.GetBool(conf.RedactPrefixes)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up redaction: %w", err)
+	}
+	return redactor, nil
+}
+
+// writeProfile writes the per-stage timings of the query (if available) to stderr, including the
+// time spent rendering the output
+func writeProfile(result *results.Result, renderDuration time.Duration) error {
+	profile := result.Summary.Profile
+	if profile == nil {
+		return nil
+	}
+	profile.Serialization = renderDuration
+
+	if err := jsoniter.NewEncoder(os.Stderr).Encode(profile); err != nil {
+		return fmt.Errorf("failed to serialize query profile: %w", err)
+	}
 	return nil
 }
 
@@ -496,3 +762,37 @@ func setDefaultTimeRange(args *query.Args) query.Args {
 	}
 	return *args
 }
+
+// getQueryServerAddrs returns the configured query server address(es), which can be provided as a list
+// or as a comma-separated string
+func getQueryServerAddrs() (addrs []string) {
+	for _, addr := range viper.GetStringSlice(conf.QueryServerAddr) {
+		for _, a := range strings.Split(addr, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				addrs = append(addrs, a)
+			}
+		}
+	}
+	return addrs
+}
+
+// newStreamingQuerier creates a streaming client for the query server reachable at addr
+func newStreamingQuerier(addr string) *gqclient.SSEClient {
+	return gqclient.NewSSE(addr,
+
+		// TODO: this will become more informational in the future as in: printing partial results, etc.
+		func(ctx context.Context, r *results.Result) error {
+			if r == nil {
+				return nil
+			}
+			all := len(r.HostsStatuses)
+			errs := len(r.HostsStatuses.GetErrorStatuses())
+
+			logger := logging.FromContext(ctx)
+			logger.Infof("received update: %d total / %d done / %d errors", all, all-errs, errs)
+
+			return nil
+		},
+		func(ctx context.Context, r *results.Result) error { return nil },
+	)
+}
@@ -6,17 +6,34 @@ const (
 
 	serverKey            = queryKey + ".server"
 	QueryServerAddr      = serverKey + ".addr"
+	QueryServerFailover  = serverKey + ".failover"
+	QueryServerHealth    = serverKey + ".health-check"
 	QueryTimeout         = queryKey + ".timeout"
+	QueryDeadline        = queryKey + ".deadline"
 	QueryHostsResolution = queryKey + ".hosts-resolution"
 	QueryLog             = queryKey + ".log"
 	QueryKeepAlive       = queryKey + ".keepalive"
 	QueryStats           = queryKey + ".stats"
 	QueryStreaming       = queryKey + ".streaming"
+	QueryPortClasses     = queryKey + ".port-classes"
+	QueryMatrixSrc       = queryKey + ".matrix-src"
+	QueryMatrixDst       = queryKey + ".matrix-dst"
+	QueryStrictHostnames = queryKey + ".strict-hostnames"
+	QueryProfile         = "profile"
+	QueryDrops           = "drops"
+	QueryProvenance      = "provenance"
+	QueryZones           = "zones"
+	QueryTags            = "tags"
+	QueryTimeWindows     = "time-windows"
+	QueryTimeWindowsZone = "time-windows-zone"
+	QueryBaselineFirst   = "baseline-first"
+	QueryBaselineLast    = "baseline-last"
 
 	dbKey       = "db"
 	QueryDBPath = dbKey + ".path"
 
 	StoredQuery = "stored-query"
+	QueryBatch  = "batch"
 
 	// logging
 	loggingKey = "logging"
@@ -29,14 +46,37 @@ const (
 	DNSResolutionTimeout = dnsKey + ".timeout"
 
 	// Sorting
-	sortKey       = "sort"
-	SortBy        = sortKey + ".by"
-	SortAscending = sortKey + ".ascending"
+	sortKey        = "sort"
+	SortBy         = sortKey + ".by"
+	SortAscending  = sortKey + ".ascending"
+	SortDescending = sortKey + ".descending"
 
 	// Results
-	resultsKey    = "results"
-	ResultsFormat = resultsKey + ".format"
-	ResultsLimit  = resultsKey + ".limit"
+	resultsKey     = "results"
+	ResultsFormat  = resultsKey + ".format"
+	ResultsLimit   = resultsKey + ".limit"
+	ResultsAliases = resultsKey + ".aliases"
+
+	// CheckCondition validates the condition instead of running a query
+	CheckCondition = "check-condition"
+
+	// ToBPF / FromBPF translate the condition into a BPF filter expression (or vice versa) instead of
+	// running a query
+	ToBPF   = "to-bpf"
+	FromBPF = "from-bpf"
+
+	// Explain estimates the cost of the query instead of running it
+	Explain = "explain"
+
+	// Redaction of IPs and hostnames in the output
+	Redact         = "redact"
+	RedactPrefixes = "redact-prefixes"
+
+	// SummaryOnly suppresses row output
+	SummaryOnly = "summary-only"
+
+	// Deterministic omits all output elements varying between runs of the same query
+	Deterministic = "deterministic"
 
 	// Memory
 	memoryKey     = "memory"
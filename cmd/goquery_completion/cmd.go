@@ -173,7 +173,7 @@ func bashCompletion(args []string) {
 		// handled by wrapper bash script
 		return
 	case "-e":
-		printlns(filterPrefix(last(args), types.FormatTXT, types.FormatJSON, types.FormatCSV, types.FormatInfluxDB))
+		printlns(filterPrefix(last(args), types.FormatTXT, types.FormatJSON, types.FormatCSV, types.FormatXLSX, types.FormatParquet, types.FormatInfluxDB))
 		return
 	case "-f", "-l", "-h", "--help":
 		return
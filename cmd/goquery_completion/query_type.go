@@ -27,12 +27,13 @@ func queryType(args []string) []string {
 
 	unusedAttribs := func(attribs []string) []string {
 		attribUnused := map[string]bool{
-			"time":          true,
-			"iface":         true,
-			types.SIPName:   true,
-			types.DIPName:   true,
-			types.DportName: true,
-			types.ProtoName: true,
+			"time":               true,
+			"iface":              true,
+			types.SIPName:        true,
+			types.DIPName:        true,
+			types.DportName:      true,
+			types.ProtoName:      true,
+			types.DportClassName: true,
 		}
 
 		for _, attrib := range attribs {
@@ -43,8 +44,18 @@ func queryType(args []string) []string {
 				attrib = types.SIPName
 			case "dst":
 				attrib = types.DIPName
+			case "portclass":
+				attrib = types.DportClassName
 			}
 			attribUnused[attrib] = false
+
+			// the destination port and its class are mutually exclusive
+			switch attrib {
+			case types.DportName, "port":
+				attribUnused[types.DportClassName] = false
+			case types.DportClassName:
+				attribUnused[types.DportName] = false
+			}
 		}
 
 		var result []string
@@ -111,6 +111,12 @@ func configEntrypoint(ctx context.Context, cmd *cobra.Command, args []string) er
 	table.AddSeparator()
 
 	for _, icfg := range allConfigs {
+
+		// Interfaces ingesting flow records do not use a ring buffer
+		if icfg.cfg.RingBuffer == nil {
+			table.AddRow(icfg.iface, icfg.cfg.Promisc, "-", "-")
+			continue
+		}
 		table.AddRow(icfg.iface,
 			icfg.cfg.Promisc,
 			icfg.cfg.RingBuffer.BlockSize,
@@ -183,6 +189,15 @@ func printIfaceChanges(enabled, updated, disabled capturetypes.IfaceChanges) {
 		formatIfaceChanges(updated.Results()),
 		formatIfaceChanges(disabled.Results()),
 	)
+
+	// List the issues found when validating the interfaces prior to enabling them (if any)
+	for _, changes := range []capturetypes.IfaceChanges{enabled, updated} {
+		for _, change := range changes {
+			for _, warning := range change.Warnings {
+				fmt.Println(shellformat.Fmt(shellformat.Bold|shellformat.Yellow, "     Warning (%s): ", change.Name) + warning)
+			}
+		}
+	}
 }
 
 func formatIfaceChanges(ok, failed []string) string {
@@ -105,6 +105,8 @@ func statusEntrypoint(ctx context.Context, cmd *cobra.Command, args []string) er
 			Alignment: tablewriter.AlignCenter,
 			ColSpan:   2,
 		}))
+		headerRow1 = append(headerRow1, "", "")
+		headerRow2 = append(headerRow2, "decapsulated", "non-IP")
 	}
 
 	table.AddRow(headerRow1...)
@@ -136,6 +138,14 @@ func statusEntrypoint(ctx context.Context, cmd *cobra.Command, args []string) er
 			for _, parsingErrno := range ifaceStatus.ParsingErrors {
 				ifaceRow = append(ifaceRow, tablewriter.CreateCell(formatting.Countable(parsingErrno), &tablewriter.CellStyle{Alignment: tablewriter.AlignRight}))
 			}
+			ifaceRow = append(ifaceRow, tablewriter.CreateCell(formatting.Countable(ifaceStatus.Decapsulated.Sum()), &tablewriter.CellStyle{Alignment: tablewriter.AlignRight}))
+
+			// frames not carrying an IP layer are only counted if enabled for the interface
+			nonIP := "-"
+			if ifaceStatus.NonIP != nil {
+				nonIP = fmt.Sprint(formatting.Countable(ifaceStatus.NonIP.Sum()))
+			}
+			ifaceRow = append(ifaceRow, tablewriter.CreateCell(nonIP, &tablewriter.CellStyle{Alignment: tablewriter.AlignRight}))
 		}
 
 		table.AddRow(ifaceRow...)
@@ -149,6 +159,18 @@ func statusEntrypoint(ctx context.Context, cmd *cobra.Command, args []string) er
 
 	fmt.Println(table.Render())
 
+	// print the diagnostics of all interfaces with a high rate of packet parsing errors (if any)
+	for _, st := range allStatuses {
+		for _, diagnostic := range st.status.Diagnostics {
+			suggestion := ""
+			if diagnostic.SuggestedCaptureLength > 0 {
+				suggestion = fmt.Sprintf(" (suggested capture length: %d bytes)", diagnostic.SuggestedCaptureLength)
+			}
+			fmt.Printf("%s %s: %.2f%% %s, %s%s\n", shellformat.Fmt(shellformat.Bold|shellformat.Red, "Warning:"),
+				st.iface, 100*diagnostic.Rate, diagnostic.Error, diagnostic.Hint, suggestion)
+		}
+	}
+
 	lastWriteoutStr := "-"
 	ago := "-"
 	if !lastWriteout.IsZero() {
@@ -18,6 +18,55 @@ const (
 	// ValidationRoute is the route to validate a goquery query
 	ValidationRoute = QueryRoute + "/validate"
 
+	// DryRunRoute is the route to validate a goquery query and estimate its cost without running it
+	DryRunRoute = QueryRoute + "/dry-run"
+
 	// SSEQueryRoute runs a goquery query with a return channel for partial results
 	SSEQueryRoute = QueryRoute + "/sse"
+
+	// BatchQueryRoute is the route to run multiple goquery queries in a single pass over the data
+	BatchQueryRoute = QueryRoute + "/batch"
+
+	// StoredResultsRoute is the route to retrieve the results of queries run in the background by their token
+	StoredResultsRoute = QueryRoute + "/results"
+
+	// CheckpointsRoute is the route to re-attach to checkpointed (distributed) queries by their ID
+	CheckpointsRoute = QueryRoute + "/checkpoints"
+)
+
+const (
+	// SchemaRoute is the base route of the JSON schema related endpoints
+	SchemaRoute = "/schema"
+
+	// QueryArgsSchemaRoute is the route to retrieve the JSON schema of the query args
+	QueryArgsSchemaRoute = SchemaRoute + "/query-args"
+
+	// QueryResultSchemaRoute is the route to retrieve the JSON schema of query results
+	QueryResultSchemaRoute = SchemaRoute + "/query-result"
+)
+
+const (
+	// ConditionsRoute is the base route of the condition related endpoints
+	ConditionsRoute = "/conditions"
+
+	// ConditionValidationRoute is the route to validate a condition without running a query
+	ConditionValidationRoute = ConditionsRoute + "/_validate"
+
+	// ConditionTranslationRoute is the route to translate a condition into a BPF filter expression or vice versa
+	ConditionTranslationRoute = ConditionsRoute + "/_translate"
+)
+
+const (
+	// GrafanaRoute is the base route of the Grafana JSON datasource endpoints (also used by Grafana
+	// to test the connection)
+	GrafanaRoute = "/grafana"
+
+	// GrafanaSearchRoute is the route to list the query types available as targets
+	GrafanaSearchRoute = GrafanaRoute + "/search"
+
+	// GrafanaQueryRoute is the route to run the queries of Grafana panels
+	GrafanaQueryRoute = GrafanaRoute + "/query"
+
+	// GrafanaAnnotationsRoute is the route to fetch annotations
+	GrafanaAnnotationsRoute = GrafanaRoute + "/annotations"
 )
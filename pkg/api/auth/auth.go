@@ -0,0 +1,128 @@
+// Package auth provides pluggable authentication of API requests. Each provider validates the
+// credentials presented in the Authorization header of a request (e.g. a static pre-shared key
+// or a bearer JWT issued by an OpenID Connect provider) and maps them to a role.
+//
+// JWT and JWKS validation is based on github.com/go-jose/go-jose/v4, restricted to the asymmetric signing
+// algorithms, the key sizes and the claims relevant for OpenID Connect access tokens
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Authorization schemes handled by the providers
+const (
+	// SchemeDigest denotes the scheme used to present static API keys
+	SchemeDigest = "digest"
+	// SchemeBearer denotes the scheme used to present bearer tokens (JWTs)
+	SchemeBearer = "bearer"
+)
+
+// RoleMetadataKey denotes the key of the API operation metadata stating the role required to
+// call the operation
+const RoleMetadataKey = "role"
+
+var (
+	// ErrNoCredentials signifies that no credentials were presented
+	ErrNoCredentials = errors.New("no credentials provided")
+
+	// ErrUnsupportedScheme signifies that a provider does not handle the authorization scheme
+	ErrUnsupportedScheme = errors.New("unsupported authorization scheme")
+
+	// ErrInvalidCredentials signifies that the credentials presented were rejected
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Role denotes the permissions granted to an authenticated caller
+type Role int
+
+// Roles, in increasing order of permissions
+const (
+	// RoleNone grants no permissions at all
+	RoleNone Role = iota
+	// RoleReadOnly permits calls not modifying any state (e.g. queries)
+	RoleReadOnly
+	// RoleAdmin permits all calls (e.g. configuration updates)
+	RoleAdmin
+)
+
+// String returns a string representation of the role
+func (r Role) String() string {
+	switch r {
+	case RoleReadOnly:
+		return "read-only"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// Permits returns whether the role grants the permissions of the required role
+func (r Role) Permits(required Role) bool {
+	return r >= required
+}
+
+// RequireRole returns operation metadata requiring callers to be granted (at least) the role
+func RequireRole(role Role) map[string]any {
+	return map[string]any{RoleMetadataKey: role}
+}
+
+// RequiredRole extracts the role required to call an operation from its metadata. Operations not
+// stating a role require read-only permissions
+func RequiredRole(metadata map[string]any) Role {
+	if role, ok := metadata[RoleMetadataKey].(Role); ok {
+		return role
+	}
+	return RoleReadOnly
+}
+
+// Identity denotes an authenticated caller
+type Identity struct {
+	Subject    string      // Subject identifies the caller (e.g. the "sub" claim of a token)
+	Role       Role        // Role denotes the permissions granted to the caller
+	Projection *Projection // Projection restricts the attributes visible to the caller (unrestricted if nil)
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the identity of the authenticated caller
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity of the authenticated caller carried by ctx (if any)
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Provider validates credentials presented with a specific authorization scheme
+type Provider interface {
+
+	// Authenticate validates the credentials and returns the identity of the caller. It returns
+	// ErrUnsupportedScheme if the provider does not handle the scheme
+	Authenticate(ctx context.Context, scheme, credentials string) (Identity, error)
+}
+
+// Authenticate validates the credentials presented in an Authorization header value using the first
+// provider handling its scheme
+func Authenticate(ctx context.Context, authorization string, providers ...Provider) (Identity, error) {
+	scheme, credentials, found := strings.Cut(strings.TrimSpace(authorization), " ")
+	credentials = strings.TrimSpace(credentials)
+	if !found || credentials == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	scheme = strings.ToLower(scheme)
+
+	for _, provider := range providers {
+		identity, err := provider.Authenticate(ctx, scheme, credentials)
+		if errors.Is(err, ErrUnsupportedScheme) {
+			continue
+		}
+		return identity, err
+	}
+	return Identity{}, fmt.Errorf("%w: %s", ErrUnsupportedScheme, scheme)
+}
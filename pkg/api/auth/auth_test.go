@@ -0,0 +1,457 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKey      = "a3c9e2f1b0d84e7a9c1f2e3d4b5a6978"
+	testAudience = "goprobe"
+)
+
+func TestKeyProvider(t *testing.T) {
+	providers := []Provider{NewKeyProvider(testKey)}
+
+	identity, err := Authenticate(context.Background(), "digest "+testKey, providers...)
+	require.Nil(t, err)
+	require.Equal(t, RoleAdmin, identity.Role)
+
+	_, err = Authenticate(context.Background(), "Digest "+testKey[1:], providers...)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = Authenticate(context.Background(), "", providers...)
+	require.ErrorIs(t, err, ErrNoCredentials)
+
+	_, err = Authenticate(context.Background(), "Basic "+testKey, providers...)
+	require.ErrorIs(t, err, ErrUnsupportedScheme)
+}
+
+func TestKeyProviderProjection(t *testing.T) {
+	const projectedKey = "f0e1d2c3b4a5968778695a4b3c2d1e0f"
+
+	projection := NewProjection("app-team", "dport", "proto")
+	providers := []Provider{NewKeyProvider(testKey).WithProjectedKeys(projection, projectedKey)}
+
+	identity, err := Authenticate(context.Background(), "Digest "+projectedKey, providers...)
+	require.Nil(t, err)
+	require.Equal(t, RoleReadOnly, identity.Role)
+	require.Equal(t, "api-key:app-team", identity.Subject)
+	require.Same(t, projection, identity.Projection)
+
+	identity, err = Authenticate(context.Background(), "Digest "+testKey, providers...)
+	require.Nil(t, err)
+	require.Equal(t, RoleAdmin, identity.Role)
+	require.Nil(t, identity.Projection)
+}
+
+func TestProjection(t *testing.T) {
+	projection := NewProjection("app-team", "dport", "proto")
+	require.True(t, projection.Permits("dport"))
+	require.False(t, projection.Permits("sip"))
+
+	var unrestricted *Projection
+	require.True(t, unrestricted.Permits("sip"))
+
+	require.True(t, SupportsProjection(SupportProjection()))
+	require.False(t, SupportsProjection(RequireRole(RoleReadOnly)))
+	require.False(t, SupportsProjection(nil))
+}
+
+func TestRequiredRole(t *testing.T) {
+	require.Equal(t, RoleReadOnly, RequiredRole(nil))
+	require.Equal(t, RoleAdmin, RequiredRole(RequireRole(RoleAdmin)))
+
+	require.True(t, RoleAdmin.Permits(RoleReadOnly))
+	require.False(t, RoleReadOnly.Permits(RoleAdmin))
+	require.False(t, RoleNone.Permits(RoleReadOnly))
+}
+
+// testIssuer serves the discovery document and JWKS of an OIDC provider and signs tokens
+type testIssuer struct {
+	*httptest.Server
+
+	kid         string
+	alg         string
+	signer      crypto.Signer
+	jwk         jose.JSONWebKey
+	jwksFetches atomic.Int64
+
+	// jwksBlocked, if set, blocks serving the JWKS until it is closed
+	jwksBlocked chan struct{}
+}
+
+func newTestIssuer(t *testing.T, alg string) *testIssuer {
+	t.Helper()
+
+	iss := &testIssuer{alg: alg}
+	iss.rotate(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.URL,
+			"jwks_uri": iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		iss.jwksFetches.Add(1)
+		if iss.jwksBlocked != nil {
+			<-iss.jwksBlocked
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{iss.jwk}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+
+	return iss
+}
+
+// rotate generates a new signing key
+func (iss *testIssuer) rotate(t *testing.T) {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	iss.kid = b64(big.NewInt(time.Now().UnixNano()).Bytes())
+
+	switch iss.alg {
+	case "RS256", "PS256":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.Nil(t, err)
+		iss.signer = key
+		iss.jwk = jose.JSONWebKey{Key: key.Public(), KeyID: iss.kid, Use: "sig"}
+	case "ES256":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.Nil(t, err)
+		iss.signer = key
+		iss.jwk = jose.JSONWebKey{Key: key.Public(), KeyID: iss.kid, Use: "sig"}
+	case "EdDSA":
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+		iss.signer = key
+		iss.jwk = jose.JSONWebKey{Key: pub, KeyID: iss.kid, Use: "sig"}
+	}
+}
+
+func (iss *testIssuer) token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": iss.alg, "kid": iss.kid, "typ": "JWT"})
+	require.Nil(t, err)
+	payload, err := json.Marshal(claims)
+	require.Nil(t, err)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch key := iss.signer.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		if iss.alg == "PS256" {
+			sig, err = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		}
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(signingInput))
+	}
+	require.Nil(t, err)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (iss *testIssuer) claims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss":   iss.URL,
+		"aud":   []string{testAudience, "other"},
+		"sub":   "alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "openid goprobe.query",
+		"realm_access": map[string]any{
+			"roles": []string{"probe-reader"},
+		},
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestOIDCProvider(t *testing.T) {
+	for _, alg := range []string{"RS256", "PS256", "ES256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			iss := newTestIssuer(t, alg)
+
+			provider, err := NewOIDCProvider(iss.URL, testAudience,
+				WithRequiredScopes("goprobe.query"),
+				WithRoleClaim("realm_access.roles"),
+				WithAdminRoles("probe-admin"),
+				WithReadOnlyRoles("probe-reader"),
+			)
+			require.Nil(t, err)
+
+			var tests = []struct {
+				name     string
+				claims   map[string]any
+				expected Role
+				valid    bool
+			}{
+				{"read-only", nil, RoleReadOnly, true},
+				{"admin", map[string]any{"realm_access": map[string]any{"roles": []string{"probe-reader", "probe-admin"}}}, RoleAdmin, true},
+				{"no matching role", map[string]any{"realm_access": map[string]any{"roles": "guest"}}, RoleNone, true},
+				{"scp claim", map[string]any{"scope": nil, "scp": []string{"goprobe.query"}}, RoleReadOnly, true},
+				{"single audience", map[string]any{"aud": testAudience}, RoleReadOnly, true},
+				{"expired", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}, RoleNone, false},
+				{"no expiration", map[string]any{"exp": nil}, RoleNone, false},
+				{"not yet valid", map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}, RoleNone, false},
+				{"wrong issuer", map[string]any{"iss": "https://sso.example.com"}, RoleNone, false},
+				{"wrong audience", map[string]any{"aud": "other"}, RoleNone, false},
+				{"missing scope", map[string]any{"scope": "openid"}, RoleNone, false},
+			}
+
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					identity, err := Authenticate(context.Background(), "Bearer "+iss.token(t, iss.claims(test.claims)), provider)
+					if !test.valid {
+						require.ErrorIs(t, err, ErrInvalidCredentials)
+						return
+					}
+					require.Nil(t, err)
+					require.Equal(t, test.expected, identity.Role)
+					require.Equal(t, "alice", identity.Subject)
+				})
+			}
+
+			// the keys are only fetched once
+			require.Equal(t, int64(1), iss.jwksFetches.Load())
+		})
+	}
+}
+
+func TestOIDCProviderProjection(t *testing.T) {
+	iss := newTestIssuer(t, "ES256")
+
+	projection := NewProjection("app-team", "dport", "proto")
+	provider, err := NewOIDCProvider(iss.URL, testAudience,
+		WithRoleClaim("realm_access.roles"),
+		WithAdminRoles("probe-admin"),
+		WithReadOnlyRoles("probe-reader"),
+		WithProjectedRoles(projection, "app-team"),
+	)
+	require.Nil(t, err)
+
+	var tests = []struct {
+		name       string
+		roles      []string
+		expected   Role
+		projection *Projection
+	}{
+		{"projected", []string{"app-team"}, RoleReadOnly, projection},
+		{"read-only supersedes projection", []string{"app-team", "probe-reader"}, RoleReadOnly, nil},
+		{"admin supersedes projection", []string{"app-team", "probe-admin"}, RoleAdmin, nil},
+		{"no matching role", []string{"guest"}, RoleNone, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := iss.claims(map[string]any{"realm_access": map[string]any{"roles": test.roles}})
+			identity, err := Authenticate(context.Background(), "Bearer "+iss.token(t, claims), provider)
+			require.Nil(t, err)
+			require.Equal(t, test.expected, identity.Role)
+			require.Equal(t, test.projection, identity.Projection)
+		})
+	}
+
+	// without read-only roles, tokens carrying none of the roles are denied (instead of being granted
+	// read-only permissions bypassing the projection)
+	provider, err = NewOIDCProvider(iss.URL, testAudience,
+		WithRoleClaim("realm_access.roles"),
+		WithProjectedRoles(projection, "app-team"),
+	)
+	require.Nil(t, err)
+	identity, err := Authenticate(context.Background(), "Bearer "+iss.token(t, iss.claims(nil)), provider)
+	require.Nil(t, err)
+	require.Equal(t, RoleNone, identity.Role)
+	identity, err = Authenticate(context.Background(), "Bearer "+iss.token(t, iss.claims(map[string]any{"realm_access": map[string]any{"roles": []string{"app-team"}}})), provider)
+	require.Nil(t, err)
+	require.Equal(t, RoleReadOnly, identity.Role)
+	require.Equal(t, projection, identity.Projection)
+}
+
+func TestOIDCProviderInvalidTokens(t *testing.T) {
+	iss := newTestIssuer(t, "ES256")
+	provider, err := NewOIDCProvider(iss.URL, testAudience)
+	require.Nil(t, err)
+
+	token := iss.token(t, iss.claims(nil))
+
+	// every valid token grants read-only permissions if no read-only roles are configured
+	identity, err := provider.Authenticate(context.Background(), SchemeBearer, token)
+	require.Nil(t, err)
+	require.Equal(t, RoleReadOnly, identity.Role)
+
+	// tampered claims
+	tampered := iss.claims(map[string]any{"sub": "mallory"})
+	payload, err := json.Marshal(tampered)
+	require.Nil(t, err)
+	parts := strings.Split(token, ".")
+	_, err = provider.Authenticate(context.Background(), SchemeBearer, parts[0]+"."+base64.RawURLEncoding.EncodeToString(payload)+"."+parts[2])
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// unsigned token
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	_, err = provider.Authenticate(context.Background(), SchemeBearer, header+"."+parts[1]+".")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// malformed token
+	_, err = provider.Authenticate(context.Background(), SchemeBearer, "not-a-jwt")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// static keys are not handled by the provider
+	_, err = provider.Authenticate(context.Background(), SchemeDigest, testKey)
+	require.ErrorIs(t, err, ErrUnsupportedScheme)
+}
+
+func TestOIDCProviderKeyRotation(t *testing.T) {
+	iss := newTestIssuer(t, "RS256")
+	provider, err := NewOIDCProvider(iss.URL, testAudience)
+	require.Nil(t, err)
+
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	_, err = provider.Authenticate(context.Background(), SchemeBearer, iss.token(t, iss.claims(nil)))
+	require.Nil(t, err)
+
+	// tokens signed by an unknown key only trigger a refresh once the minimum refresh interval has passed
+	iss.rotate(t)
+	_, err = provider.Authenticate(context.Background(), SchemeBearer, iss.token(t, iss.claims(nil)))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	require.Equal(t, int64(1), iss.jwksFetches.Load())
+
+	now = now.Add(2 * minRefreshInterval)
+	_, err = provider.Authenticate(context.Background(), SchemeBearer, iss.token(t, iss.claims(nil)))
+	require.Nil(t, err)
+	require.Equal(t, int64(2), iss.jwksFetches.Load())
+}
+
+func TestOIDCProviderConcurrentRefresh(t *testing.T) {
+	iss := newTestIssuer(t, "ES256")
+	iss.jwksBlocked = make(chan struct{})
+	provider, err := NewOIDCProvider(iss.URL, testAudience)
+	require.Nil(t, err)
+
+	// requests arriving while the keys are fetched wait for the pending fetch instead of fetching them
+	// again (or blocking on the lock of the provider)
+	token := iss.token(t, iss.claims(nil))
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := provider.Authenticate(context.Background(), SchemeBearer, token)
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return iss.jwksFetches.Load() == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// requests of callers giving up don't wait for the fetch to complete
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = provider.Authenticate(ctx, SchemeBearer, token)
+	require.ErrorIs(t, err, context.Canceled)
+
+	close(iss.jwksBlocked)
+	for i := 0; i < cap(errs); i++ {
+		require.Nil(t, <-errs)
+	}
+	require.Equal(t, int64(1), iss.jwksFetches.Load())
+}
+
+func TestVerifyECDSACurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+
+	sign := func(alg string, hash crypto.Hash) *jwt {
+		signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"`+alg+`"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`))
+		h := hash.New()
+		h.Write([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		require.Nil(t, err)
+
+		token, err := parseJWT(signingInput + "." + base64.RawURLEncoding.EncodeToString(append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...)))
+		require.Nil(t, err)
+		return token
+	}
+
+	require.Nil(t, sign("ES384", crypto.SHA384).verify(&key.PublicKey))
+
+	// keys on a curve other than the one defined for the algorithm are rejected, even if the signature
+	// is valid otherwise
+	require.ErrorIs(t, sign("ES256", crypto.SHA256).verify(&key.PublicKey), errInvalidSignature)
+	require.ErrorIs(t, sign("ES512", crypto.SHA512).verify(&key.PublicKey), errInvalidSignature)
+}
+
+func TestRSAKeySize(t *testing.T) {
+	newKeySetRSA := func(bits, e int) error {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		require.Nil(t, err)
+		raw, err := json.Marshal(jose.JSONWebKey{Key: &rsa.PublicKey{N: key.N, E: e}, KeyID: "test", Use: "sig"})
+		require.Nil(t, err)
+		_, err = newKeySet(jwks{Keys: []json.RawMessage{raw}})
+		return err
+	}
+
+	require.Nil(t, newKeySetRSA(minRSAModulusBits, 65537))
+
+	// keys with a modulus below the minimum size or a trivial exponent are rejected
+	require.ErrorContains(t, newKeySetRSA(1024, 65537), "below the minimum")
+	require.ErrorContains(t, newKeySetRSA(minRSAModulusBits, 1), "exponent out of range")
+}
+
+func TestKeySetUnsupportedKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	sigKey, err := json.Marshal(jose.JSONWebKey{Key: key.Public(), KeyID: "sig", Use: "sig"})
+	require.Nil(t, err)
+	encKey, err := json.Marshal(jose.JSONWebKey{Key: key.Public(), KeyID: "enc", Use: "enc"})
+	require.Nil(t, err)
+	symKey, err := json.Marshal(jose.JSONWebKey{Key: []byte("secret"), KeyID: "oct", Use: "sig"})
+	require.Nil(t, err)
+
+	// keys of unknown types, encryption keys and symmetric keys are skipped
+	keys, err := newKeySet(jwks{Keys: []json.RawMessage{[]byte(`{"kty":"unknown","kid":"x"}`), sigKey, encKey, symKey}})
+	require.Nil(t, err)
+	require.Len(t, keys, 1)
+	require.Len(t, keys.lookup("sig"), 1)
+
+	_, err = newKeySet(jwks{Keys: []json.RawMessage{symKey}})
+	require.NotNil(t, err)
+}
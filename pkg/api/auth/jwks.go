@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// minRSAModulusBits denotes the minimum size of the modulus of RSA keys, c.f. RFC 7518, section 3.3
+const minRSAModulusBits = 2048
+
+// jwks denotes a JSON Web Key Set. Its keys are decoded individually, such that keys of unsupported
+// types can be skipped (RFC 7517, section 5) instead of rejecting the whole set
+type jwks struct {
+	Keys []json.RawMessage `json:"keys"`
+}
+
+// keySet holds the public keys of a JWKS by key ID. Keys without an ID are stored under the
+// empty ID
+type keySet map[string][]crypto.PublicKey
+
+// lookup returns all keys matching the key ID of a token. Tokens without a key ID may be signed by
+// any of the keys
+func (s keySet) lookup(kid string) []crypto.PublicKey {
+	if kid != "" {
+		return append(slices.Clone(s[kid]), s[""]...)
+	}
+	var keys []crypto.PublicKey
+	for _, k := range s {
+		keys = append(keys, k...)
+	}
+	return keys
+}
+
+// newKeySet parses all signing keys of a JWKS. Keys of unsupported types are skipped
+func newKeySet(set jwks) (keySet, error) {
+	keys := make(keySet)
+	for i, raw := range set.Keys {
+		var k jose.JSONWebKey
+		if err := json.Unmarshal(raw, &k); err != nil {
+			if errors.Is(err, jose.ErrUnsupportedKeyType) {
+				continue
+			}
+			return nil, fmt.Errorf("invalid key at index %d: %w", i, err)
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := publicKey(k)
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", k.KeyID, err)
+		}
+		keys[k.KeyID] = append(keys[k.KeyID], key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no supported signing keys found")
+	}
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+// publicKey extracts the public key of an asymmetric JWK, enforcing the minimum size of RSA keys
+// (symmetric keys are not supported)
+func publicKey(k jose.JSONWebKey) (crypto.PublicKey, error) {
+	switch key := k.Public().Key.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAModulusBits {
+			return nil, fmt.Errorf("modulus of %d bits below the minimum of %d bits", key.N.BitLen(), minRSAModulusBits)
+		}
+		if key.E < 3 {
+			return nil, errors.New("exponent out of range")
+		}
+		return key, nil
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, errUnsupportedKey
+}
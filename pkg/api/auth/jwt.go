@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	josejwt "github.com/go-jose/go-jose/v4/jwt"
+)
+
+var (
+	errMalformedToken   = errors.New("malformed token")
+	errInvalidSignature = errors.New("invalid signature")
+)
+
+// signatureAlgorithms denotes the signing algorithms accepted for tokens (symmetric algorithms and
+// "none" are rejected upon parsing)
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// jwt denotes a parsed (but not yet verified) JSON Web Token
+type jwt struct {
+	*josejwt.JSONWebToken
+	header jose.Header
+}
+
+// parseJWT decodes a signed token in compact serialization
+func parseJWT(token string) (*jwt, error) {
+	t, err := josejwt.ParseSigned(token, signatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errMalformedToken, err)
+	}
+	return &jwt{
+		JSONWebToken: t,
+		header:       t.Headers[0],
+	}, nil
+}
+
+// ecdsaCurves maps the ECDSA signing algorithms to the curve their keys must be on (RFC 7518, section 3.4)
+var ecdsaCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// verify checks the signature of the token against the provided key. The key type must match
+// the signing algorithm stated in the header
+func (t *jwt) verify(key crypto.PublicKey) error {
+	if pub, ok := key.(*ecdsa.PublicKey); ok && pub.Curve != ecdsaCurves[t.header.Algorithm] {
+		return errInvalidSignature
+	}
+	if err := t.Claims(key); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSignature, err)
+	}
+	return nil
+}
+
+// decodeClaims extracts the claims of the token, whose signature must have been verified before
+func (t *jwt) decodeClaims() (c claims, err error) {
+	if err := t.UnsafeClaimsWithoutVerification(&c.Claims, &c.all); err != nil {
+		return claims{}, fmt.Errorf("%w: claims: %w", errMalformedToken, err)
+	}
+	return c, nil
+}
+
+// claims denotes the claims of a JWT, i.e. the registered claims along with all claims (providing the
+// ones specific to the issuer, e.g. roles and scopes)
+type claims struct {
+	josejwt.Claims
+	all map[string]any
+}
+
+// strings extracts a claim holding either a single string or a list of strings. Nested claims
+// can be accessed by separating their names with dots (e.g. "realm_access.roles")
+func (c claims) strings(name string) []string {
+	var v any = c.all
+	for _, field := range strings.Split(name, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if v, ok = obj[field]; !ok {
+			return nil
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		values := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+)
+
+// KeyProvider authenticates callers presenting one of a static list of pre-shared API keys. Callers
+// are granted admin permissions, unless the key is restricted by a projection
+type KeyProvider struct {
+	keys        [][]byte
+	projections []*Projection // projections restricting the keys (nil for unrestricted keys)
+}
+
+// NewKeyProvider creates a new provider permitting the given keys
+func NewKeyProvider(keys ...string) *KeyProvider {
+	p := &KeyProvider{
+		keys:        make([][]byte, 0, len(keys)),
+		projections: make([]*Projection, 0, len(keys)),
+	}
+	for _, key := range keys {
+		p.keys = append(p.keys, []byte(key))
+		p.projections = append(p.projections, nil)
+	}
+	return p
+}
+
+// WithProjectedKeys additionally permits the given keys, restricting callers presenting them by the
+// projection (with read-only permissions)
+func (p *KeyProvider) WithProjectedKeys(projection *Projection, keys ...string) *KeyProvider {
+	for _, key := range keys {
+		p.keys = append(p.keys, []byte(key))
+		p.projections = append(p.projections, projection)
+	}
+	return p
+}
+
+// Authenticate validates the presented API key. It implements the Provider interface
+func (p *KeyProvider) Authenticate(_ context.Context, scheme, credentials string) (Identity, error) {
+	if scheme != SchemeDigest {
+		return Identity{}, ErrUnsupportedScheme
+	}
+
+	// all keys are compared (in constant time) so as to not leak which one (partially) matched
+	var match, matchIdx int
+	for i, key := range p.keys {
+		equal := subtle.ConstantTimeCompare(key, []byte(credentials))
+		match |= equal
+		matchIdx = subtle.ConstantTimeSelect(equal, i, matchIdx)
+	}
+	if match != 1 {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	if projection := p.projections[matchIdx]; projection != nil {
+		return Identity{
+			Subject:    "api-key:" + projection.Name,
+			Role:       RoleReadOnly,
+			Projection: projection,
+		}, nil
+	}
+	return Identity{
+		Subject: "api-key",
+		Role:    RoleAdmin,
+	}, nil
+}
@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	josejwt "github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// DefaultRoleClaim denotes the claim the roles of a caller are extracted from by default
+	DefaultRoleClaim = "roles"
+
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// keys are refreshed periodically in order to pick up rotations, but at most once per
+	// minRefreshInterval if tokens signed by an unknown key are presented
+	keysTTL            = time.Hour
+	minRefreshInterval = time.Minute
+
+	// tolerated clock skew between the issuer and the API server
+	clockLeeway = time.Minute
+
+	httpTimeout = 10 * time.Second
+)
+
+// OIDCProvider authenticates callers presenting a bearer JWT issued by an OpenID Connect provider.
+// The signing keys are fetched from the issuer's JWKS (as advertised by its discovery document) and
+// refreshed on key rotation. The roles of a caller are mapped from a (configurable) claim of its token
+type OIDCProvider struct {
+	issuer   string
+	audience string
+	scopes   []string
+
+	roleClaim      string
+	adminRoles     []string
+	readOnlyRoles  []string
+	projectedRoles []projectedRoles
+
+	client *http.Client
+	now    func() time.Time
+
+	// the keys are fetched without holding the lock by a single request at a time, concurrent
+	// requests waiting for the result (signalled by closing refreshing)
+	keys        keySet
+	keysErr     error
+	lastRefresh time.Time
+	refreshing  chan struct{}
+	sync.Mutex
+}
+
+// OIDCOption configures the OIDC provider
+type OIDCOption func(*OIDCProvider)
+
+// WithRequiredScopes requires tokens to carry all of the scopes (in their "scope" or "scp" claim)
+func WithRequiredScopes(scopes ...string) OIDCOption {
+	return func(p *OIDCProvider) {
+		p.scopes = scopes
+	}
+}
+
+// WithRoleClaim sets the claim the roles of a caller are extracted from. Nested claims can be accessed
+// by separating their names with dots (e.g. "realm_access.roles")
+func WithRoleClaim(claim string) OIDCOption {
+	return func(p *OIDCProvider) {
+		if claim != "" {
+			p.roleClaim = claim
+		}
+	}
+}
+
+// WithAdminRoles sets the roles (claim values) granting admin permissions
+func WithAdminRoles(roles ...string) OIDCOption {
+	return func(p *OIDCProvider) {
+		p.adminRoles = roles
+	}
+}
+
+// WithReadOnlyRoles sets the roles (claim values) granting read-only permissions. If none are set
+// (and no projected roles either), all valid tokens grant read-only permissions
+func WithReadOnlyRoles(roles ...string) OIDCOption {
+	return func(p *OIDCProvider) {
+		p.readOnlyRoles = roles
+	}
+}
+
+// WithProjectedRoles sets roles (claim values) granting read-only permissions restricted by the projection.
+// Callers carrying an admin or read-only role as well are not restricted. The option may be provided
+// multiple times, in which case the first projection matching the roles of a caller applies
+func WithProjectedRoles(projection *Projection, roles ...string) OIDCOption {
+	return func(p *OIDCProvider) {
+		p.projectedRoles = append(p.projectedRoles, projectedRoles{projection: projection, roles: roles})
+	}
+}
+
+// WithHTTPClient sets the client used to fetch the discovery document and the JWKS
+func WithHTTPClient(client *http.Client) OIDCOption {
+	return func(p *OIDCProvider) {
+		if client != nil {
+			p.client = client
+		}
+	}
+}
+
+// NewOIDCProvider creates a new provider validating tokens issued by issuer for the audience. The
+// signing keys are fetched upon the first request (so that an unavailable issuer does not prevent
+// the API from being served)
+func NewOIDCProvider(issuer, audience string, opts ...OIDCOption) (*OIDCProvider, error) {
+	if issuer == "" {
+		return nil, errors.New("no issuer provided")
+	}
+	if audience == "" {
+		return nil, errors.New("no audience provided")
+	}
+
+	p := &OIDCProvider{
+		issuer:    issuer,
+		audience:  audience,
+		roleClaim: DefaultRoleClaim,
+		client:    &http.Client{Timeout: httpTimeout},
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// Authenticate validates the presented token. It implements the Provider interface
+func (p *OIDCProvider) Authenticate(ctx context.Context, scheme, credentials string) (Identity, error) {
+	if scheme != SchemeBearer {
+		return Identity{}, ErrUnsupportedScheme
+	}
+
+	token, err := parseJWT(credentials)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	claims, err := p.verifySignature(ctx, token)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if err := p.validateClaims(claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	identity := Identity{Subject: claims.Subject}
+	identity.Role, identity.Projection = p.role(claims)
+	return identity, nil
+}
+
+// verifySignature verifies the token against the signing keys matching its key ID and returns its claims
+func (p *OIDCProvider) verifySignature(ctx context.Context, token *jwt) (claims, error) {
+	keys, err := p.signingKeys(ctx, token.header.KeyID)
+	if err != nil {
+		return claims{}, err
+	}
+	for _, key := range keys {
+		if token.verify(key) == nil {
+			return token.decodeClaims()
+		}
+	}
+	return claims{}, errInvalidSignature
+}
+
+// signingKeys returns the keys matching the key ID, refreshing the key set if it is stale or (rate
+// limited) if no key matches. If a refresh is in progress already, its result is awaited instead
+func (p *OIDCProvider) signingKeys(ctx context.Context, kid string) ([]crypto.PublicKey, error) {
+	p.Lock()
+	if refreshing := p.refreshing; refreshing != nil {
+		p.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.Lock()
+	} else if p.stale(kid) {
+		p.refreshKeys(ctx)
+	}
+	defer p.Unlock()
+
+	if p.keys == nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", p.keysErr)
+	}
+	keys := p.keys.lookup(kid)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing key found for key ID %q", kid)
+	}
+	return keys, nil
+}
+
+// stale returns if the key set must be refreshed (the caller must hold the lock)
+func (p *OIDCProvider) stale(kid string) bool {
+	now := p.now()
+	if p.keys == nil || now.Sub(p.lastRefresh) > keysTTL {
+		return true
+	}
+	return len(p.keys.lookup(kid)) == 0 && now.Sub(p.lastRefresh) > minRefreshInterval
+}
+
+// refreshKeys fetches the key set, releasing the lock (which the caller must hold) during the fetch
+func (p *OIDCProvider) refreshKeys(ctx context.Context) {
+	refreshing, now := make(chan struct{}), p.now()
+	p.refreshing = refreshing
+	p.Unlock()
+
+	keys, err := p.fetchKeys(ctx)
+
+	p.Lock()
+
+	// in case of an error, the previous keys remain in use until the next attempt
+	if err == nil {
+		p.keys = keys
+	}
+	p.keysErr, p.lastRefresh, p.refreshing = err, now, nil
+	close(refreshing)
+}
+
+// fetchKeys fetches the JWKS advertised in the issuer's discovery document
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (keySet, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.issuer, "/")+discoveryPath, &discovery); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if discovery.Issuer != p.issuer {
+		return nil, fmt.Errorf("discovery: issuer mismatch (expected %q, got %q)", p.issuer, discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery: no JWKS URI advertised")
+	}
+
+	var set jwks
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("JWKS: %w", err)
+	}
+	return newKeySet(set)
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v any) error {
+	// the request context is detached so that a cancelled request does not prevent the keys from being
+	// fetched for concurrent requests waiting for them
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), httpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *OIDCProvider) validateClaims(c claims) error {
+	if c.Expiry == nil {
+		return errors.New("no expiration time")
+	}
+	if err := c.ValidateWithLeeway(josejwt.Expected{
+		Issuer:      p.issuer,
+		AnyAudience: josejwt.Audience{p.audience},
+		Time:        p.now(),
+	}, clockLeeway); err != nil {
+		return err
+	}
+
+	// scopes are either provided as space separated string ("scope", RFC 8693) or as list ("scp")
+	var scopes []string
+	for _, scope := range c.strings("scope") {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	scopes = append(scopes, c.strings("scp")...)
+	for _, required := range p.scopes {
+		if !slices.Contains(scopes, required) {
+			return fmt.Errorf("missing scope %q", required)
+		}
+	}
+	return nil
+}
+
+// projectedRoles denotes roles granting read-only permissions restricted by a projection
+type projectedRoles struct {
+	projection *Projection
+	roles      []string
+}
+
+// role maps the roles stated in the token to the permissions of the caller (and the projection
+// restricting them, if any)
+func (p *OIDCProvider) role(c claims) (Role, *Projection) {
+	roles := c.strings(p.roleClaim)
+	containsAny := func(candidates []string) bool {
+		return slices.ContainsFunc(candidates, func(role string) bool {
+			return slices.Contains(roles, role)
+		})
+	}
+
+	switch {
+	case containsAny(p.adminRoles):
+		return RoleAdmin, nil
+	case containsAny(p.readOnlyRoles):
+		return RoleReadOnly, nil
+	}
+	for _, projected := range p.projectedRoles {
+		if containsAny(projected.roles) {
+			return RoleReadOnly, projected.projection
+		}
+	}
+
+	// with projections configured, tokens carrying none of the roles must not bypass them
+	if len(p.readOnlyRoles) == 0 && len(p.projectedRoles) == 0 {
+		return RoleReadOnly, nil
+	}
+	return RoleNone, nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import "slices"
+
+// ProjectionMetadataKey denotes the key of the API operation metadata stating that the operation
+// supports callers restricted by a projection (i.e. it removes all attributes not visible to them)
+const ProjectionMetadataKey = "projection"
+
+// Projection restricts the flow attributes and labels visible to a caller (e.g. an application team
+// permitted to see port / protocol aggregations, but never raw IP addresses). Callers restricted by
+// a projection are granted read-only permissions and may only call operations supporting it (see
+// SupportProjection)
+type Projection struct {
+	Name       string   // Name identifies the projection (e.g. in logs)
+	Attributes []string // Attributes lists the visible attributes / labels (as named in queries, e.g. "dport", "proto", "iface")
+}
+
+// NewProjection creates a new projection permitting the given attributes / labels
+func NewProjection(name string, attributes ...string) *Projection {
+	return &Projection{
+		Name:       name,
+		Attributes: attributes,
+	}
+}
+
+// Permits returns whether the attribute / label is visible. A nil projection permits all attributes
+func (p *Projection) Permits(attribute string) bool {
+	if p == nil {
+		return true
+	}
+	return slices.Contains(p.Attributes, attribute)
+}
+
+// SupportProjection returns operation metadata stating that the operation supports callers restricted
+// by a projection
+func SupportProjection() map[string]any {
+	return map[string]any{ProjectionMetadataKey: true}
+}
+
+// SupportsProjection extracts whether an operation supports callers restricted by a projection from its
+// metadata. Operations not stating it don't support such callers
+func SupportsProjection(metadata map[string]any) bool {
+	supported, _ := metadata[ProjectionMetadataKey].(bool)
+	return supported
+}
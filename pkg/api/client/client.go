@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -12,6 +13,9 @@ import (
 	"github.com/els0r/goProbe/pkg/api"
 	"github.com/els0r/goProbe/pkg/api/server"
 	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/version"
 	"github.com/els0r/telemetry/logging"
 	"github.com/fako1024/httpc"
@@ -64,6 +68,13 @@ func WithAPIKey(key string) Option {
 	}
 }
 
+// WithRetry enables / disables retrying failed requests (enabled by default)
+func WithRetry(b bool) Option {
+	return func(c *DefaultClient) {
+		c.retry = b
+	}
+}
+
 // WithScheme sets the scheme for client requests. http is the default
 func WithScheme(scheme string) Option {
 	return func(c *DefaultClient) {
@@ -238,6 +249,19 @@ func (c *DefaultClient) Modify(_ context.Context, req *httpc.Request) *httpc.Req
 	return req
 }
 
+// Health checks if the API server is reachable and its health endpoint responds successfully. In
+// contrast to other requests, health checks are not retried
+func (c *DefaultClient) Health(ctx context.Context) error {
+	req := httpc.NewWithClient(http.MethodGet, c.NewURL(api.HealthRoute), c.client).
+		Headers(httpc.Params{
+			server.RuntimeIDHeaderKey: info.RuntimeID(),
+		})
+	if c.key != "" {
+		req = req.AuthToken("digest", c.key)
+	}
+	return req.RunWithContext(ctx)
+}
+
 // NewURL synthesizes a new URL for a given path depending on how the
 // client was configured.
 //
@@ -247,3 +271,81 @@ func (c *DefaultClient) Modify(_ context.Context, req *httpc.Request) *httpc.Req
 func (c *DefaultClient) NewURL(path string) string {
 	return c.scheme + filepath.Join(c.hostAddr, path)
 }
+
+// StoreQuery runs a query in the background on the API server, which stores its result for later
+// retrieval (if enabled). The returned result is in pending state and carries the token to retrieve
+// the final result with as its ID
+func (c *DefaultClient) StoreQuery(ctx context.Context, args *query.Args) (*results.Result, error) {
+	// use a copy of the arguments, since some fields are modified by the client
+	queryArgs := *args
+	queryArgs.Format = types.FormatJSON
+
+	var res = new(results.Result)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient(http.MethodPost, c.NewURL(api.QueryRoute), c.client).
+			QueryParams(httpc.Params{
+				"store": "true",
+			}).
+			AcceptedResponseCodes([]int{http.StatusAccepted}).
+			EncodeJSON(queryArgs).
+			ParseJSON(res),
+	)
+	if err := req.RunWithContext(ctx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetStoredResult retrieves the result of a query run in the background by its token. While the query
+// is still running, a result in pending state is returned
+func (c *DefaultClient) GetStoredResult(ctx context.Context, token string) (*results.Result, error) {
+	var res = new(results.Result)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient(http.MethodGet, c.NewURL(api.StoredResultsRoute+"/"+token), c.client).
+			AcceptedResponseCodes([]int{http.StatusOK, http.StatusAccepted}).
+			ParseJSON(res),
+	)
+	if err := req.RunWithContext(ctx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DownloadStoredResult downloads the (rendered) result of a query run in the background by its token to w,
+// optionally as gzip archive. The download starts at offset, allowing to resume an interrupted download by
+// providing the number of bytes received so far. The number of bytes written to w is returned (also in case
+// of an error, so the download can be resumed from there)
+func (c *DefaultClient) DownloadStoredResult(ctx context.Context, token string, w io.Writer, offset int64, compressed bool) (int64, error) {
+	params := httpc.Params{}
+	if compressed {
+		params["archive"] = api.StoredResultArchiveGzip
+	}
+
+	var written int64
+	req := c.Modify(ctx,
+		httpc.NewWithClient(http.MethodGet, c.NewURL(api.StoredResultsRoute+"/"+token+"/download"), c.client).
+			QueryParams(params).
+			AcceptedResponseCodes([]int{http.StatusOK, http.StatusPartialContent}).
+			ParseFn(func(resp *http.Response) error {
+				// the server may serve the whole result instead of the range, in which case the bytes
+				// received so far are skipped
+				if offset > 0 && resp.StatusCode == http.StatusOK {
+					if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+						return err
+					}
+				}
+				n, err := io.Copy(w, resp.Body)
+				written += n
+				return err
+			}),
+	).ModifyRequest(func(req *http.Request) error {
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return nil
+	})
+	err := req.RunWithContext(ctx)
+	return written, err
+}
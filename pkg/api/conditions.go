@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const invalidConditionMsg = "invalid condition"
+
+// ConditionInput stores the condition to be validated in the body
+type ConditionInput struct {
+	Body struct {
+		// Condition: the condition to validate
+		Condition string `json:"condition" doc:"Condition to validate" example:"sip = 10.0.0.1 & !(dport < 1024)"`
+		// DNSTimeout: timeout for the resolution of hostnames in the condition
+		DNSTimeout time.Duration `json:"dns_timeout,omitempty" required:"false" doc:"Timeout for the resolution of hostnames in the condition" example:"2000000000" minimum:"0" default:"1000000000"`
+		// StrictHostnames: fail if a hostname in the condition resolves to multiple addresses
+		StrictHostnames bool `json:"strict_hostnames,omitempty" required:"false" doc:"Fail if a hostname in the condition resolves to multiple addresses (instead of reporting a warning and matching any of them)" example:"false"`
+	}
+}
+
+// ConditionValidationOutput stores the description of a validated condition
+type ConditionValidationOutput struct {
+	Body *node.Validation
+}
+
+// getConditionValidationHandler returns the condition validation handler
+func getConditionValidationHandler() func(context.Context, *ConditionInput) (*ConditionValidationOutput, error) {
+	return func(ctx context.Context, input *ConditionInput) (*ConditionValidationOutput, error) {
+		dnsTimeout := input.Body.DNSTimeout
+		if dnsTimeout == 0 {
+			dnsTimeout = query.DefaultResolveTimeout
+		}
+
+		logger := logs.FromContext(ctx, logs.ModuleAPI).With("condition", input.Body.Condition)
+		logger.Debug("validating condition")
+
+		validation, err := node.Validate(input.Body.Condition, dnsTimeout, node.WithStrictHostnames(input.Body.StrictHostnames))
+		if err != nil {
+			logger.With("error", err).Error("invalid condition")
+
+			errMsg := err.Error()
+			var p *types.ParseError
+			if errors.As(err, &p) {
+				errMsg = "\n" + p.Pretty()
+			}
+			return nil, huma.Error422UnprocessableEntity(invalidConditionMsg, &huma.ErrorDetail{
+				Message:  fmt.Sprintf("%s: %s", invalidConditionMsg, errMsg),
+				Location: "body.condition",
+				Value:    input.Body.Condition,
+			})
+		}
+
+		return &ConditionValidationOutput{Body: validation}, nil
+	}
+}
+
+const invalidTranslationInputMsg = "exactly one of condition and bpf_filter has to be provided"
+
+// ConditionTranslationInput stores the condition or BPF filter expression to be translated in the body
+type ConditionTranslationInput struct {
+	Body struct {
+		// Condition: the condition to translate into a BPF filter expression
+		Condition string `json:"condition,omitempty" required:"false" doc:"Condition to translate into a BPF filter expression" example:"host = 10.0.0.1 & dport != 22"`
+		// BPFFilter: the BPF filter expression to translate into a condition
+		BPFFilter string `json:"bpf_filter,omitempty" required:"false" doc:"BPF filter expression (tcpdump syntax) to translate into a condition" example:"host 10.0.0.1 and not udp"`
+		// DNSTimeout: timeout for the resolution of hostnames in the condition
+		DNSTimeout time.Duration `json:"dns_timeout,omitempty" required:"false" doc:"Timeout for the resolution of hostnames in the condition" example:"2000000000" minimum:"0" default:"1000000000"`
+		// StrictHostnames: fail if a hostname in the condition resolves to multiple addresses
+		StrictHostnames bool `json:"strict_hostnames,omitempty" required:"false" doc:"Fail if a hostname in the condition resolves to multiple addresses (instead of matching any of them)" example:"false"`
+	}
+}
+
+// ConditionTranslationOutput stores the translated condition / BPF filter expression
+type ConditionTranslationOutput struct {
+	Body *bpffilter.Translation
+}
+
+// getConditionTranslationHandler returns the condition translation handler
+func getConditionTranslationHandler() func(context.Context, *ConditionTranslationInput) (*ConditionTranslationOutput, error) {
+	return func(ctx context.Context, input *ConditionTranslationInput) (*ConditionTranslationOutput, error) {
+		if (input.Body.Condition == "") == (input.Body.BPFFilter == "") {
+			return nil, huma.Error422UnprocessableEntity(invalidTranslationInputMsg)
+		}
+
+		logger := logs.FromContext(ctx, logs.ModuleAPI)
+		if input.Body.BPFFilter != "" {
+			logger.With("bpf_filter", input.Body.BPFFilter).Debug("translating BPF filter")
+
+			translation, err := bpffilter.ToCondition(input.Body.BPFFilter)
+			if err != nil {
+				return nil, huma.Error422UnprocessableEntity("invalid BPF filter", &huma.ErrorDetail{
+					Message:  err.Error(),
+					Location: "body.bpf_filter",
+					Value:    input.Body.BPFFilter,
+				})
+			}
+			return &ConditionTranslationOutput{Body: translation}, nil
+		}
+
+		dnsTimeout := input.Body.DNSTimeout
+		if dnsTimeout == 0 {
+			dnsTimeout = query.DefaultResolveTimeout
+		}
+		logger.With("condition", input.Body.Condition).Debug("translating condition")
+
+		translation, err := node.ToBPFFilter(input.Body.Condition, dnsTimeout, node.WithStrictHostnames(input.Body.StrictHostnames))
+		if err != nil {
+			errMsg := err.Error()
+			var p *types.ParseError
+			if errors.As(err, &p) {
+				errMsg = "\n" + p.Pretty()
+			}
+			return nil, huma.Error422UnprocessableEntity(invalidConditionMsg, &huma.ErrorDetail{
+				Message:  fmt.Sprintf("%s: %s", invalidConditionMsg, errMsg),
+				Location: "body.condition",
+				Value:    input.Body.Condition,
+			})
+		}
+		return &ConditionTranslationOutput{Body: translation}, nil
+	}
+}
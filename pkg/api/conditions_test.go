@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionValidationAPI(t *testing.T) {
+	_, a := humatest.New(t)
+	RegisterQueryAPI(a, "test", &grafanaTestRunner{}, nil)
+
+	resp := a.Post(ConditionValidationRoute, strings.NewReader(`{"condition":"sip = 10.0.0.1 & !(dport < 80)"}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{
+		"tokens": ["sip", "=", "10.0.0.1", "&", "!", "(", "dport", "<", "80", ")"],
+		"conditions": [
+			{"attribute": "sip", "comparator": "=", "value": "10.0.0.1"},
+			{"attribute": "dport", "comparator": ">=", "value": "80"}
+		],
+		"resolved": "(sip = 10.0.0.1 & dport >= 80)",
+		"tree": "AND\n├── sip = 10.0.0.1\n└── NOT\n    └── dport < 80"
+	}`, resp.Body.String())
+
+	resp = a.Post(ConditionValidationRoute, strings.NewReader(`{"condition":"sip = 10.0.0.1 & (dport = 80"}`))
+	require.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	require.Contains(t, resp.Body.String(), invalidConditionMsg)
+}
+
+func TestConditionTranslationAPI(t *testing.T) {
+	_, a := humatest.New(t)
+	RegisterQueryAPI(a, "test", &grafanaTestRunner{}, nil)
+
+	resp := a.Post(ConditionTranslationRoute, strings.NewReader(`{"condition":"host = 10.0.0.1 & !(proto = udp) & vlan = 5"}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{
+		"result": "host 10.0.0.1 and not udp",
+		"exact": false,
+		"warnings": ["vlan = 5: cannot be translated (the attribute is not part of the packet headers evaluated by filter expressions)"]
+	}`, resp.Body.String())
+
+	resp = a.Post(ConditionTranslationRoute, strings.NewReader(`{"bpf_filter":"host 10.0.0.1 and not udp"}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"result": "host = 10.0.0.1 & !(proto = udp)", "exact": true}`, resp.Body.String())
+
+	for _, body := range []string{`{}`, `{"condition":"sip = 10.0.0.1","bpf_filter":"host 10.0.0.1"}`, `{"condition":"sip = 10.0.0.1 &"}`, `{"bpf_filter":"port http"}`} {
+		resp = a.Post(ConditionTranslationRoute, strings.NewReader(body))
+		require.Equal(t, http.StatusUnprocessableEntity, resp.Code, body)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+const (
+	// StoredResultArchiveGzip denotes the gzip archive format of stored result downloads
+	StoredResultArchiveGzip = "gzip"
+
+	byteRangeUnit = "bytes"
+)
+
+var errorUnsatisfiableRange = errors.New("range not satisfiable")
+
+// downloadStoredResultHandler returns the handler to download the (rendered) results of queries run in the
+// background. Range requests are supported, so that interrupted downloads of large results can be resumed
+func (q *queryAPI) downloadStoredResultHandler() func(context.Context, *DownloadStoredResultInput) (*huma.StreamResponse, error) {
+	return func(_ context.Context, input *DownloadStoredResultInput) (*huma.StreamResponse, error) {
+		compressed := input.Archive == StoredResultArchiveGzip
+		f, err := q.resultStore.Open(input.Token, compressed)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrStoredResultNotFound):
+				return nil, huma.Error404NotFound(err.Error())
+			case errors.Is(err, ErrStoredResultPending):
+				return nil, huma.Error409Conflict(err.Error())
+			}
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to read stored query result: %w", err)
+		}
+
+		// a stored result is never modified, hence its token serves as (strong) entity tag
+		fileName, contentType, etag := input.Token+storedResultSuffix, "application/json", `"`+input.Token+`"`
+		if compressed {
+			fileName, contentType, etag = input.Token+storedArchiveSuffix, "application/gzip", `"`+input.Token+`-gzip"`
+		}
+
+		size := info.Size()
+		status, offset, length := http.StatusOK, int64(0), size
+		if input.Range != "" && (input.IfRange == "" || input.IfRange == etag) {
+			rangeOffset, rangeLength, ok, err := parseByteRange(input.Range, size)
+			if err != nil {
+				_ = f.Close()
+				return nil, huma.ErrorWithHeaders(
+					huma.NewError(http.StatusRequestedRangeNotSatisfiable, err.Error()),
+					http.Header{"Content-Range": []string{fmt.Sprintf("%s */%d", byteRangeUnit, size)}},
+				)
+			}
+			if ok {
+				status, offset, length = http.StatusPartialContent, rangeOffset, rangeLength
+			}
+		}
+
+		return &huma.StreamResponse{
+			Body: func(ctx huma.Context) {
+				defer f.Close()
+
+				ctx.SetHeader("Content-Type", contentType)
+				ctx.SetHeader("Content-Disposition", `attachment; filename="`+fileName+`"`)
+				ctx.SetHeader("Content-Length", strconv.FormatInt(length, 10))
+				ctx.SetHeader("Accept-Ranges", byteRangeUnit)
+				ctx.SetHeader("ETag", etag)
+				if status == http.StatusPartialContent {
+					ctx.SetHeader("Content-Range", fmt.Sprintf("%s %d-%d/%d", byteRangeUnit, offset, offset+length-1, size))
+				}
+				ctx.SetStatus(status)
+
+				// the client is gone if writing fails, it may resume the download via a range request
+				_, _ = io.Copy(ctx.BodyWriter(), io.NewSectionReader(f, offset, length))
+			},
+		}, nil
+	}
+}
+
+// parseByteRange parses a Range header for a resource of the given size, returning the offset and
+// length of the requested range. Only a single range is supported ("bytes=<first>-[<last>]" or
+// "bytes=-<suffix length>"), otherwise ok is false and the whole resource is to be served (as permitted
+// by RFC 9110). An error is returned if the range cannot be satisfied
+func parseByteRange(header string, size int64) (offset, length int64, ok bool, err error) {
+	spec, isBytes := strings.CutPrefix(header, byteRangeUnit+"=")
+	if !isBytes || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+	if !isRange {
+		return 0, 0, false, nil
+	}
+
+	// suffix range, denoting the last bytes of the resource
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, errorUnsatisfiableRange
+		}
+		suffix = min(suffix, size)
+		return size - suffix, suffix, true, nil
+	}
+
+	offset, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, false, nil
+	}
+	if offset >= size {
+		return 0, 0, false, errorUnsatisfiableRange
+	}
+	end := size - 1
+	if last != "" {
+		lastPos, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || lastPos < offset {
+			return 0, 0, false, nil
+		}
+		end = min(lastPos, end)
+	}
+	return offset, end - offset + 1, true, nil
+}
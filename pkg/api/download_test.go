@@ -0,0 +1,40 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteRange(t *testing.T) {
+	for _, test := range []struct {
+		header         string
+		offset, length int64
+		ok             bool
+		err            error
+	}{
+		{"bytes=0-99", 0, 100, true, nil},
+		{"bytes=10-", 10, 90, true, nil},
+		{"bytes=10-19", 10, 10, true, nil},
+		{"bytes=90-200", 90, 10, true, nil},
+		{"bytes=-10", 90, 10, true, nil},
+		{"bytes=-200", 0, 100, true, nil},
+		{"bytes=100-", 0, 0, false, errorUnsatisfiableRange},
+		{"bytes=-0", 0, 0, false, errorUnsatisfiableRange},
+
+		// unsupported / malformed ranges are ignored
+		{"bytes=0-9,20-29", 0, 0, false, nil},
+		{"items=0-9", 0, 0, false, nil},
+		{"bytes=20-10", 0, 0, false, nil},
+		{"bytes=a-", 0, 0, false, nil},
+		{"bytes=10", 0, 0, false, nil},
+	} {
+		t.Run(test.header, func(t *testing.T) {
+			offset, length, ok, err := parseByteRange(test.header, 100)
+			require.ErrorIs(t, err, test.err)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.offset, offset)
+			require.Equal(t, test.length, length)
+		})
+	}
+}
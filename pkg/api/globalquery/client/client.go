@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/els0r/goProbe/cmd/global-query/pkg/distributed"
 	"github.com/els0r/goProbe/pkg/api"
 	"github.com/els0r/goProbe/pkg/api/client"
 	"github.com/els0r/goProbe/pkg/query"
@@ -61,3 +62,44 @@ func (c *Client) Query(ctx context.Context, args *query.Args) (*results.Result,
 
 	return res, nil
 }
+
+// DryRun validates the global query and estimates its cost on all hosts without running it
+func (c *Client) DryRun(ctx context.Context, args *query.Args) (*results.DryRun, error) {
+	queryArgs := *args
+	if queryArgs.Caller == "" {
+		queryArgs.Caller = clientName
+	}
+
+	var res = new(results.DryRun)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient(http.MethodPost, c.NewURL(api.DryRunRoute), c.Client()).
+			EncodeJSON(queryArgs).
+			ParseJSON(res),
+	)
+
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetCheckpoint re-attaches to a checkpointed query by its ID, returning its final result if it completed
+// or the result aggregated across all hosts queried so far if it is still running
+func (c *Client) GetCheckpoint(ctx context.Context, id string) (*distributed.Checkpoint, error) {
+	var res = new(distributed.Checkpoint)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient(http.MethodGet, c.NewURL(api.CheckpointsRoute+"/"+id), c.Client()).
+			ParseJSON(res),
+	)
+
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/telemetry/logging"
+)
+
+// FailoverStrategy denotes the order in which the query servers of a FailoverClient are tried
+type FailoverStrategy string
+
+const (
+	// FailoverOrdered tries the query servers in the order they were provided
+	FailoverOrdered FailoverStrategy = "ordered"
+	// FailoverFastest tries the query servers in ascending order of their health check latency
+	FailoverFastest FailoverStrategy = "fastest"
+
+	defaultHealthCheckTimeout = 2 * time.Second
+)
+
+// Server denotes a query server a FailoverClient can run queries against (e.g. a Client or SSEClient)
+type Server interface {
+	query.Runner
+
+	// Health checks if the server is reachable and healthy
+	Health(ctx context.Context) error
+}
+
+// FailoverClient runs queries against one of multiple (redundant) global-query servers. Since queries
+// are idempotent, a failed query is transparently retried against the next server
+type FailoverClient struct {
+	servers []failoverServer
+
+	strategy           FailoverStrategy
+	healthCheck        bool
+	healthCheckTimeout time.Duration
+}
+
+type failoverServer struct {
+	addr string
+	Server
+}
+
+// FailoverOption configures the failover client
+type FailoverOption func(*FailoverClient)
+
+// WithFailoverStrategy sets the order in which the query servers are tried. FailoverOrdered is the default
+func WithFailoverStrategy(strategy FailoverStrategy) FailoverOption {
+	return func(c *FailoverClient) {
+		if strategy != "" {
+			c.strategy = strategy
+		}
+	}
+}
+
+// WithHealthCheck enables / disables health checks of the query servers prior to each query. Healthy
+// servers are tried before unhealthy ones (which are only tried as a last resort). Health checks are
+// always performed for the FailoverFastest strategy
+func WithHealthCheck(enabled bool) FailoverOption {
+	return func(c *FailoverClient) {
+		c.healthCheck = enabled
+	}
+}
+
+// WithHealthCheckTimeout sets the timeout for the health check of each query server
+func WithHealthCheckTimeout(timeout time.Duration) FailoverOption {
+	return func(c *FailoverClient) {
+		if timeout > 0 {
+			c.healthCheckTimeout = timeout
+		}
+	}
+}
+
+// NewFailover creates a new failover client for the query servers reachable at addrs. newServer is
+// used to create the client for each query server
+func NewFailover(addrs []string, newServer func(addr string) Server, opts ...FailoverOption) *FailoverClient {
+	c := &FailoverClient{
+		strategy:           FailoverOrdered,
+		healthCheckTimeout: defaultHealthCheckTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	for _, addr := range addrs {
+		c.servers = append(c.servers, failoverServer{
+			addr:   addr,
+			Server: newServer(addr),
+		})
+	}
+	return c
+}
+
+// Run implements the query.Runner interface
+func (c *FailoverClient) Run(ctx context.Context, args *query.Args) (*results.Result, error) {
+	if len(c.servers) == 0 {
+		return nil, errors.New("no query servers available")
+	}
+
+	logger := logging.FromContext(ctx)
+
+	var errs []error
+	for _, srv := range c.candidates(ctx) {
+		res, err := srv.Run(ctx, args)
+		if err == nil {
+			return res, nil
+		}
+
+		// if the query itself was cancelled / timed out, there's no point in trying other servers
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		logger.With("addr", srv.addr).Warnf("query failed on query server: %v", err)
+		errs = append(errs, fmt.Errorf("%s: %w", srv.addr, err))
+	}
+
+	return nil, fmt.Errorf("query failed on all query servers: %w", errors.Join(errs...))
+}
+
+// DryRun implements the query.DryRunner interface (for all query servers supporting dry-runs)
+func (c *FailoverClient) DryRun(ctx context.Context, args *query.Args) (*results.DryRun, error) {
+	logger := logging.FromContext(ctx)
+
+	var errs []error
+	for _, srv := range c.candidates(ctx) {
+		dryRunner, ok := srv.Server.(query.DryRunner)
+		if !ok {
+			continue
+		}
+		res, err := dryRunner.DryRun(ctx, args)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		logger.With("addr", srv.addr).Warnf("dry-run failed on query server: %v", err)
+		errs = append(errs, fmt.Errorf("%s: %w", srv.addr, err))
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no query servers supporting dry-runs available")
+	}
+
+	return nil, fmt.Errorf("dry-run failed on all query servers: %w", errors.Join(errs...))
+}
+
+// candidates returns the query servers in the order they should be tried
+func (c *FailoverClient) candidates(ctx context.Context) []failoverServer {
+	if !c.healthCheck && c.strategy != FailoverFastest {
+		return c.servers
+	}
+
+	type healthResult struct {
+		latency time.Duration
+		err     error
+	}
+
+	var (
+		wg     sync.WaitGroup
+		health = make([]healthResult, len(c.servers))
+	)
+	for i, srv := range c.servers {
+		wg.Add(1)
+		go func(i int, srv failoverServer) {
+			defer wg.Done()
+
+			hctx, cancel := context.WithTimeout(ctx, c.healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := srv.Health(hctx)
+			health[i] = healthResult{latency: time.Since(start), err: err}
+		}(i, srv)
+	}
+	wg.Wait()
+
+	logger := logging.FromContext(ctx)
+
+	var healthy, unhealthy []int
+	for i, res := range health {
+		if res.err != nil {
+			logger.With("addr", c.servers[i].addr).Warnf("query server health check failed: %v", res.err)
+			unhealthy = append(unhealthy, i)
+			continue
+		}
+		healthy = append(healthy, i)
+	}
+	if c.strategy == FailoverFastest {
+		slices.SortStableFunc(healthy, func(a, b int) int {
+			return cmp.Compare(health[a].latency, health[b].latency)
+		})
+	}
+
+	candidates := make([]failoverServer, 0, len(c.servers))
+	for _, i := range append(healthy, unhealthy...) {
+		candidates = append(candidates, c.servers[i])
+	}
+	return candidates
+}
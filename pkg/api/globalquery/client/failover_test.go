@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/stretchr/testify/require"
+)
+
+type mockServer struct {
+	addr        string
+	queryErr    error
+	healthErr   error
+	healthDelay time.Duration
+
+	queried *[]string
+	mu      *sync.Mutex
+}
+
+func (m *mockServer) Run(_ context.Context, _ *query.Args) (*results.Result, error) {
+	m.mu.Lock()
+	*m.queried = append(*m.queried, m.addr)
+	m.mu.Unlock()
+
+	if m.queryErr != nil {
+		return nil, m.queryErr
+	}
+	return &results.Result{Hostname: m.addr}, nil
+}
+
+func (m *mockServer) Health(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.healthDelay):
+	}
+	return m.healthErr
+}
+
+func TestFailover(t *testing.T) {
+	errQuery := errors.New("query failed")
+	errHealth := errors.New("unhealthy")
+
+	var tests = []struct {
+		name            string
+		servers         []mockServer
+		opts            []FailoverOption
+		expectedQueried []string
+		expectedErr     bool
+	}{
+		{
+			name:            "first server succeeds",
+			servers:         []mockServer{{addr: "a"}, {addr: "b"}},
+			expectedQueried: []string{"a"},
+		},
+		{
+			name:            "failover to second server",
+			servers:         []mockServer{{addr: "a", queryErr: errQuery}, {addr: "b"}},
+			expectedQueried: []string{"a", "b"},
+		},
+		{
+			name:            "all servers fail",
+			servers:         []mockServer{{addr: "a", queryErr: errQuery}, {addr: "b", queryErr: errQuery}},
+			expectedQueried: []string{"a", "b"},
+			expectedErr:     true,
+		},
+		{
+			name:            "unhealthy server tried last",
+			servers:         []mockServer{{addr: "a", healthErr: errHealth}, {addr: "b", queryErr: errQuery}},
+			opts:            []FailoverOption{WithHealthCheck(true)},
+			expectedQueried: []string{"b", "a"},
+		},
+		{
+			name:            "health check timeout",
+			servers:         []mockServer{{addr: "a", healthDelay: time.Second}, {addr: "b"}},
+			opts:            []FailoverOption{WithHealthCheck(true), WithHealthCheckTimeout(10 * time.Millisecond)},
+			expectedQueried: []string{"b"},
+		},
+		{
+			name:            "fastest server first",
+			servers:         []mockServer{{addr: "a", healthDelay: 100 * time.Millisecond}, {addr: "b"}},
+			opts:            []FailoverOption{WithFailoverStrategy(FailoverFastest)},
+			expectedQueried: []string{"b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				queried []string
+				addrs   []string
+				servers = make(map[string]*mockServer)
+			)
+			for i := range test.servers {
+				srv := &test.servers[i]
+				srv.queried, srv.mu = &queried, &mu
+				servers[srv.addr] = srv
+				addrs = append(addrs, srv.addr)
+			}
+
+			c := NewFailover(addrs, func(addr string) Server {
+				return servers[addr]
+			}, test.opts...)
+
+			res, err := c.Run(context.Background(), &query.Args{})
+			require.Equal(t, test.expectedQueried, queried)
+			if test.expectedErr {
+				require.ErrorIs(t, err, errQuery)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expectedQueried[len(test.expectedQueried)-1], res.Hostname)
+		})
+	}
+}
+
+func TestFailoverCancelled(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queried []string
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := NewFailover([]string{"a", "b"}, func(addr string) Server {
+		return &mockServer{addr: addr, queryErr: context.Canceled, queried: &queried, mu: &mu}
+	})
+
+	_, err := c.Run(ctx, &query.Args{})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []string{"a"}, queried)
+}
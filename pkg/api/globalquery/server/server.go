@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -16,15 +17,18 @@ import (
 type Server struct {
 	hostListResolver hosts.Resolver
 	querier          distributed.Querier
+	queryRunner      *distributed.QueryRunner
 
 	*server.DefaultServer
 }
 
-// New creates a new global-query API server
-func New(addr string, resolver hosts.Resolver, querier distributed.Querier, opts ...server.Option) *Server {
+// New creates a new global-query API server. The query options configure the distributed query runner
+// (e.g. checkpointing of queries)
+func New(addr string, resolver hosts.Resolver, querier distributed.Querier, queryOpts []distributed.QueryOption, opts ...server.Option) *Server {
 	server := &Server{
 		hostListResolver: resolver,
 		querier:          querier,
+		queryRunner:      distributed.NewQueryRunner(resolver, querier, queryOpts...),
 		DefaultServer:    server.NewDefault(conf.ServiceName, addr, opts...),
 	}
 
@@ -41,9 +45,20 @@ func (server *Server) registerRoutes() {
 		middlewares = append(middlewares, api.RateLimitMiddleware(rateLimiter))
 	}
 
-	api.RegisterQueryAPI(server.API(),
-		fmt.Sprintf("global-query/%s", version.Short()),
-		distributed.NewQueryRunner(server.hostListResolver, server.querier),
-		middlewares,
-	)
+	// handlers are shared across all API versions
+	server.ForEachVersion(func(_ api.Version, a huma.API) {
+		api.RegisterQueryAPI(a,
+			fmt.Sprintf("global-query/%s", version.Short()),
+			server.queryRunner,
+			middlewares,
+			api.WithDefaultQueryDeadline(server.QueryDeadline()),
+			api.WithResultStore(server.QueryResultStore()),
+		)
+	})
+}
+
+// ResumeQueries resumes all checkpointed queries which did not complete before the server was
+// stopped (if checkpointing is enabled)
+func (server *Server) ResumeQueries(ctx context.Context) error {
+	return server.queryRunner.Resume(ctx)
 }
@@ -9,7 +9,7 @@ import (
 
 func TestGenerateOpenAPISpec(t *testing.T) {
 	buf := &bytes.Buffer{}
-	s := New("localhost:8146", nil, nil)
+	s := New("localhost:8146", nil, nil, nil)
 
 	err := s.WriteOpenAPISpec(buf)
 	require.Nil(t, err)
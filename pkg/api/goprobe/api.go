@@ -1,10 +1,16 @@
 package goprobe
 
 import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
 	"time"
 
 	"github.com/els0r/goProbe/cmd/goProbe/config"
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goprobe/alerting"
+	"github.com/els0r/goProbe/pkg/types"
 )
 
 const (
@@ -39,12 +45,91 @@ type StatusResponse struct {
 	Statuses capturetypes.InterfaceStats `json:"statuses" doc:"Stores the statistics for each interface"`
 }
 
+// ManifestRoute is the route to query the DB manifest
+const ManifestRoute = "/manifest"
+
+// ManifestResponse is the response to a manifest query
+type ManifestResponse struct {
+	Response
+	// Manifest: stores the manifest of the goDB
+	Manifest *info.Manifest `json:"manifest,omitempty" doc:"Manifest of the goDB"`
+}
+
+// ContainsRoute is the route to check whether an IP was observed
+const ContainsRoute = "/db/contains"
+
+// ContainsResponse is the response to an IP existence check
+type ContainsResponse struct {
+	Response
+	// IP: the IP address that was checked
+	IP string `json:"ip" doc:"IP address that was checked" example:"10.81.45.1"`
+	// Seen: denotes whether the IP was observed (as source or destination) in the time range
+	Seen bool `json:"seen" doc:"Whether the IP was observed (as source or destination) in the time range" example:"true"`
+	// Interfaces: stores the traffic involving the IP for each interface it was observed on
+	Interfaces map[string]types.Counters `json:"interfaces,omitempty" doc:"Traffic involving the IP for each interface it was observed on"`
+}
+
+// IPsRoute is the route to enumerate the unique IPs observed per interface and day (or to check for a
+// specific IP), as maintained in the IP index of each day
+const IPsRoute = "/db/ips"
+
+// IPIndex denotes the index of all unique IPs observed on an interface during a day
+type IPIndex interface {
+	Len() int
+	Contains(ip netip.Addr) bool
+	IPs() []netip.Addr
+}
+
+// DayIPs denotes the unique IPs observed on an interface during a day
+type DayIPs struct {
+	// Iface: the interface the IPs were observed on
+	Iface string `json:"iface" doc:"Interface the IPs were observed on" example:"eth0"`
+	// Day: the start of the day
+	Day time.Time `json:"day" doc:"Start of the day" example:"2024-04-12T00:00:00Z"`
+	// Indexed: denotes whether the day is covered by an IP index
+	Indexed bool `json:"indexed" doc:"Whether the day is covered by an IP index (days written by older releases are not)" example:"true"`
+	// NumIPs: the number of unique IPs observed during the day
+	NumIPs int `json:"num_ips" doc:"Number of unique IPs (source or destination) observed during the day" example:"1024"`
+	// Contains: denotes whether the IP looked up was observed during the day
+	Contains bool `json:"contains,omitempty" doc:"Whether the IP looked up was observed during the day (only if an IP was looked up)" example:"true"`
+	// IPs: the unique IPs observed during the day
+	IPs []netip.Addr `json:"ips,omitempty" doc:"Unique IPs observed during the day (IPv4 first, each in ascending order; omitted if an IP was looked up)"`
+}
+
+// NewDayIPs summarizes the IP index of a day (which is nil if the day isn't covered by one). If the
+// lookup IP is valid, only its presence is stated, otherwise all IPs of the day are listed
+func NewDayIPs(iface string, day time.Time, index IPIndex, lookup netip.Addr) DayIPs {
+	d := DayIPs{Iface: iface, Day: day}
+	if index == nil {
+		return d
+	}
+	d.Indexed, d.NumIPs = true, index.Len()
+	if lookup.IsValid() {
+		d.Contains = index.Contains(lookup)
+		return d
+	}
+	d.IPs = index.IPs()
+	return d
+}
+
+// IPsResponse is the response to an IP index lookup
+type IPsResponse struct {
+	Response
+	// Lookup: the IP that was looked up (if any)
+	Lookup string `json:"lookup,omitempty" doc:"IP address that was looked up (if any)" example:"10.81.45.1"`
+	// Days: the unique IPs of each interface and day (in chronological order per interface)
+	Days []DayIPs `json:"days" doc:"Unique IPs of each interface and day (in chronological order per interface)"`
+}
+
 // ConfigRoute is the route to query/modify the current configuration
 const ConfigRoute = "/config"
 
 // ConfigReloadRoute is the route to trigger a config reload
 const ConfigReloadRoute = "/_reload"
 
+// ConfigFileRoute is the route to fetch / replace the stored configuration
+const ConfigFileRoute = "/_file"
+
 // ConfigResponse is the response to a config query
 type ConfigResponse struct {
 	Response
@@ -62,6 +147,167 @@ type ConfigUpdateResponse struct {
 	Disabled capturetypes.IfaceChanges `json:"disabled" doc:"Interfaces that were disabled"`
 }
 
+// StoredConfigResponse is the response to a stored configuration query
+type StoredConfigResponse struct {
+	Response
+	Version string         `json:"version" doc:"Version of the stored configuration, to be provided via If-Match upon update" example:"3f2a9c0d41b7e865"`
+	Config  *config.Config `json:"config" doc:"Stored configuration"`
+}
+
+// StoredConfigUpdateResponse is the response to an update of the stored configuration
+type StoredConfigUpdateResponse struct {
+	ConfigUpdateResponse
+	Version string `json:"version" doc:"Version of the stored configuration after the update" example:"3f2a9c0d41b7e865"`
+}
+
 // ConfigUpdateRequest is the payload to update the configuration of all
 // interfaces stored in it
 type ConfigUpdateRequest config.Ifaces
+
+// FlowWatchRoute is the route to watch the live flow data for a specific flow
+const FlowWatchRoute = "/flows/watch"
+
+const (
+	// DefaultFlowWatchTimeout denotes the default duration for which a flow is watched
+	DefaultFlowWatchTimeout = 30 * time.Second
+
+	// DefaultFlowWatchPollInterval denotes the default interval in which the live flow data is checked
+	DefaultFlowWatchPollInterval = 5 * time.Second
+)
+
+// FlowKey identifies a flow by its attributes (as returned by a query)
+type FlowKey struct {
+	// SrcIP: the source IP address of the flow (IPv4 or IPv6)
+	SrcIP netip.Addr `json:"sip" format:"ip" doc:"Source IP of the flow (IPv4 or IPv6)" example:"10.81.45.1"`
+	// DstIP: the destination IP address of the flow (IPv4 or IPv6)
+	DstIP netip.Addr `json:"dip" format:"ip" doc:"Destination IP of the flow (IPv4 or IPv6)" example:"8.8.8.8"`
+	// DstPort: the destination port of the flow
+	DstPort uint16 `json:"dport" doc:"Destination port of the flow" example:"53"`
+	// IPProto: the IP protocol number of the flow
+	IPProto uint8 `json:"proto" doc:"IP protocol number of the flow" example:"17"`
+}
+
+// Key returns the flow map key of the flow
+func (f FlowKey) Key() (types.Key, error) {
+	if !f.SrcIP.IsValid() || !f.DstIP.IsValid() {
+		return nil, fmt.Errorf("invalid flow key: source and destination IP are required")
+	}
+	sip, dip := f.SrcIP.Unmap(), f.DstIP.Unmap()
+	if sip.Is4() != dip.Is4() {
+		return nil, fmt.Errorf("invalid flow key: source and destination IP must be of the same IP version")
+	}
+
+	dport := make([]byte, 2)
+	binary.BigEndian.PutUint16(dport, f.DstPort)
+	if sip.Is4() {
+		return types.NewV4KeyStatic(sip.As4(), dip.As4(), dport, f.IPProto), nil
+	}
+	return types.NewV6KeyStatic(sip.As16(), dip.As16(), dport, f.IPProto), nil
+}
+
+// NewFlowKey returns the attributes of the flow identified by a flow map key
+func NewFlowKey(key types.Key) FlowKey {
+	return FlowKey{
+		SrcIP:   types.RawIPToAddr(key.GetSIP()),
+		DstIP:   types.RawIPToAddr(key.GetDIP()),
+		DstPort: types.PortToUint16(key.GetDport()),
+		IPProto: key.GetProto(),
+	}
+}
+
+// FlowWatchRequest is the payload to watch the live flow data for a specific flow
+type FlowWatchRequest struct {
+	FlowKey
+	// Ifaces: the interfaces to watch. If empty, all interfaces are watched
+	Ifaces []string `json:"ifaces,omitempty" doc:"Interfaces to watch (all interfaces if empty)" required:"false" example:"eth0"`
+	// Timeout: the maximum duration for which the flow is watched
+	Timeout time.Duration `json:"timeout,omitempty" doc:"Maximum duration for which the flow is watched (in nanoseconds)" required:"false" minimum:"0" example:"30000000000"`
+	// PollInterval: the interval in which the live flow data is checked
+	PollInterval time.Duration `json:"poll_interval,omitempty" doc:"Interval in which the live flow data is checked (in nanoseconds)" required:"false" minimum:"0" example:"5000000000"`
+}
+
+// FlowWatchResponse is the response to a flow watch request
+type FlowWatchResponse struct {
+	Response
+	// Observed: denotes if traffic matching the flow was observed while watching
+	Observed bool `json:"observed" doc:"Traffic matching the flow was observed while watching" example:"true"`
+	// ObservedAt: denotes the time when traffic matching the flow was observed
+	ObservedAt time.Time `json:"observed_at,omitempty" doc:"Time when traffic matching the flow was observed" example:"2024-04-12T09:47:00+02:00"`
+	// Counters: the traffic observed for the flow while watching (per interface)
+	Counters map[string]types.Counters `json:"counters,omitempty" doc:"Traffic observed for the flow while watching (per interface)"`
+}
+
+// LiveFlowsRoute is the route to query the live flow data (i.e. the flows observed since the last writeout)
+const LiveFlowsRoute = "/flows/live"
+
+// LiveFlow denotes a single flow of the live flow data
+type LiveFlow struct {
+	FlowKey
+	// Iface: the interface the flow was observed on
+	Iface string `json:"iface" doc:"Interface the flow was observed on" example:"eth0"`
+	// Counters: the traffic observed for the flow since the last writeout
+	Counters types.Counters `json:"counters" doc:"Traffic observed for the flow since the last writeout"`
+}
+
+// LiveFlowsResponse is the response to a live flows query
+type LiveFlowsResponse struct {
+	Response
+	// LastRotation: denotes the time when the live flow data was last reset (upon writeout)
+	LastRotation time.Time `json:"last_rotation" doc:"Time when the live flow data was last reset (upon writeout)" example:"2024-04-12T09:45:00+02:00"`
+	// Flows: stores the flows observed since the last writeout
+	Flows []LiveFlow `json:"flows" doc:"Flows observed since the last writeout"`
+}
+
+// FlowSnapshotRoute is the route to dump / replay the live flow data of an interface as binary snapshot
+// (see capturetypes.WriteFlowSnapshot)
+const FlowSnapshotRoute = "/flows/snapshot"
+
+// IfaceQueryParam is the query parameter to specify a single interface
+const IfaceQueryParam = "iface"
+
+// FlowSnapshotResponse is the response to a replayed flow snapshot
+type FlowSnapshotResponse struct {
+	Response
+	// Iface: the interface the snapshot was taken on
+	Iface string `json:"iface" doc:"Interface the snapshot was taken on" example:"eth0"`
+	// NumFlows: the number of flows contained in the snapshot
+	NumFlows int `json:"num_flows" doc:"Number of flows contained in the snapshot" example:"1024"`
+}
+
+// AlertsRoute is the route to query the current alerts
+const AlertsRoute = "/alerts"
+
+// AlertRulesRoute is the route to query/modify the alert rules
+const AlertRulesRoute = AlertsRoute + "/rules"
+
+// AlertsResponse is the response to an alerts query
+type AlertsResponse struct {
+	Response
+	// Alerts: stores all pending, firing and resolved alerts
+	Alerts []alerting.Alert `json:"alerts" doc:"Pending, firing and resolved alerts"`
+}
+
+// AlertRulesResponse is the response to an alert rules query / update
+type AlertRulesResponse struct {
+	Response
+	// Rules: stores the current alert rules
+	Rules config.AlertRules `json:"rules" doc:"Current alert rules"`
+}
+
+// LogLevelsRoute is the route to query/modify the log levels
+const LogLevelsRoute = "/logging/levels"
+
+// LogLevels denotes the default log level and the individual log levels of modules
+type LogLevels struct {
+	// Default: the log level of all modules without an individual log level
+	Default string `json:"default,omitempty" doc:"Log level of all modules without an individual log level (left unchanged on update if empty)" example:"info"`
+	// Modules: the individual log levels of modules
+	Modules map[string]string `json:"modules,omitempty" doc:"Individual log levels of modules (capture, writeout, api, query). On update, an empty level resets the module to the default log level" example:"{\"capture\":\"debug\"}"`
+}
+
+// LogLevelsResponse is the response to a log levels query / update
+type LogLevelsResponse struct {
+	Response
+	// Levels: stores the current log levels
+	Levels LogLevels `json:"levels" doc:"Current log levels"`
+}
@@ -0,0 +1,63 @@
+package goprobe
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowKey(t *testing.T) {
+	var tests = []struct {
+		name     string
+		key      FlowKey
+		expected types.Key
+		err      bool
+	}{
+		{"IPv4",
+			FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), DstPort: 443, IPProto: 6},
+			types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0x01, 0xbb}, 6),
+			false,
+		},
+		{"IPv4-mapped IPv6",
+			FlowKey{SrcIP: netip.MustParseAddr("::ffff:10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), DstPort: 53, IPProto: 17},
+			types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0x00, 0x35}, 17),
+			false,
+		},
+		{"IPv6",
+			FlowKey{SrcIP: netip.MustParseAddr("2001:db8::1"), DstIP: netip.MustParseAddr("2001:db8::2"), DstPort: 80, IPProto: 6},
+			types.NewV6KeyStatic(netip.MustParseAddr("2001:db8::1").As16(), netip.MustParseAddr("2001:db8::2").As16(), []byte{0x00, 0x50}, 6),
+			false,
+		},
+		{"mixed IP versions",
+			FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("2001:db8::2")},
+			nil,
+			true,
+		},
+		{"missing IP",
+			FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1")},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := test.key.Key()
+			if test.err {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expected, key)
+
+			// the flow key can be restored from the flow map key (with IPv4-mapped addresses unmapped)
+			restored := NewFlowKey(key)
+			require.Equal(t, test.key.SrcIP.Unmap(), restored.SrcIP)
+			require.Equal(t, test.key.DstIP.Unmap(), restored.DstIP)
+			require.Equal(t, test.key.DstPort, restored.DstPort)
+			require.Equal(t, test.key.IPProto, restored.IPProto)
+		})
+	}
+}
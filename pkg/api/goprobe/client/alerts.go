@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/goprobe/alerting"
+	"github.com/fako1024/httpc"
+)
+
+// GetAlerts returns all pending, firing and resolved alerts
+func (c *Client) GetAlerts(ctx context.Context) ([]alerting.Alert, error) {
+	var res = new(gpapi.AlertsResponse)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("GET", c.NewURL(gpapi.AlertsRoute), c.Client()).
+			ParseJSON(res),
+	)
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res.Alerts, nil
+}
+
+// GetAlertRules returns the alert rules
+func (c *Client) GetAlertRules(ctx context.Context) (config.AlertRules, error) {
+	var res = new(gpapi.AlertRulesResponse)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("GET", c.NewURL(gpapi.AlertRulesRoute), c.Client()).
+			ParseJSON(res),
+	)
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res.Rules, nil
+}
+
+// UpdateAlertRules replaces the alert rules
+func (c *Client) UpdateAlertRules(ctx context.Context, rules config.AlertRules) (config.AlertRules, error) {
+	var res = new(gpapi.AlertRulesResponse)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("PUT", c.NewURL(gpapi.AlertRulesRoute), c.Client()).
+			EncodeJSON(rules).
+			ParseJSON(res),
+	)
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res.Rules, nil
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/fako1024/httpc"
+)
+
+// WatchFlow watches the live flow data of the running goProbe instance for a flow and returns as soon as
+// traffic matching the flow is observed or the watch times out
+func (c *Client) WatchFlow(ctx context.Context, req *gpapi.FlowWatchRequest) (*gpapi.FlowWatchResponse, error) {
+	var res = new(gpapi.FlowWatchResponse)
+
+	url := c.NewURL(gpapi.FlowWatchRoute)
+
+	err := c.Modify(ctx,
+		httpc.NewWithClient("POST", url, c.Client()).
+			EncodeJSON(req).
+			ParseJSON(res),
+	).RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetLiveFlows returns the flows observed by the running goProbe instance since the last writeout (on all
+// interfaces if none are provided)
+func (c *Client) GetLiveFlows(ctx context.Context, ifaces ...string) (*gpapi.LiveFlowsResponse, error) {
+	var res = new(gpapi.LiveFlowsResponse)
+
+	url := c.NewURL(gpapi.LiveFlowsRoute)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("GET", url, c.Client()).
+			ParseJSON(res),
+	)
+	if len(ifaces) > 0 {
+		req = req.QueryParams(httpc.Params{
+			gpapi.IfacesQueryParam: strings.Join(ifaces, ","),
+		})
+	}
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetFlowSnapshot returns the flows observed on an interface of the running goProbe instance since the last
+// writeout as binary snapshot (see capturetypes.ReadFlowSnapshot)
+func (c *Client) GetFlowSnapshot(ctx context.Context, iface string) (*capturetypes.TaggedAggFlowMap, error) {
+	var snapshot []byte
+
+	url := c.NewURL(gpapi.FlowSnapshotRoute)
+
+	err := c.Modify(ctx,
+		httpc.NewWithClient("GET", url, c.Client()).
+			QueryParams(httpc.Params{
+				gpapi.IfaceQueryParam: iface,
+			}).
+			ParseFn(func(resp *http.Response) (err error) {
+				snapshot, err = io.ReadAll(resp.Body)
+				return err
+			}),
+	).RunWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := capturetypes.ReadFlowSnapshot(bytes.NewReader(snapshot))
+	if err != nil {
+		return nil, err
+	}
+	return &flows, nil
+}
+
+// ReplayFlowSnapshot merges the flows of a snapshot into the next writeout of the running goProbe instance
+func (c *Client) ReplayFlowSnapshot(ctx context.Context, flows capturetypes.TaggedAggFlowMap) (*gpapi.FlowSnapshotResponse, error) {
+	var res = new(gpapi.FlowSnapshotResponse)
+
+	snapshot := bytes.NewBuffer(nil)
+	if err := capturetypes.WriteFlowSnapshot(snapshot, flows); err != nil {
+		return nil, err
+	}
+
+	url := c.NewURL(gpapi.FlowSnapshotRoute)
+
+	err := c.Modify(ctx,
+		httpc.NewWithClient("POST", url, c.Client()).
+			Body(snapshot.Bytes()).
+			ParseJSON(res),
+	).ModifyRequest(func(req *http.Request) error {
+		req.Header.Set("Content-Type", capturetypes.FlowSnapshotContentType)
+		return nil
+	}).RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/fako1024/httpc"
+)
+
+// GetLogLevels returns the default log level and the individual log levels of modules
+func (c *Client) GetLogLevels(ctx context.Context) (gpapi.LogLevels, error) {
+	var res = new(gpapi.LogLevelsResponse)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("GET", c.NewURL(gpapi.LogLevelsRoute), c.Client()).
+			ParseJSON(res),
+	)
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return gpapi.LogLevels{}, err
+	}
+	return res.Levels, nil
+}
+
+// UpdateLogLevels adjusts the default log level and / or the individual log levels of modules
+func (c *Client) UpdateLogLevels(ctx context.Context, levels gpapi.LogLevels) (gpapi.LogLevels, error) {
+	var res = new(gpapi.LogLevelsResponse)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("PUT", c.NewURL(gpapi.LogLevelsRoute), c.Client()).
+			EncodeJSON(levels).
+			ParseJSON(res),
+	)
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return gpapi.LogLevels{}, err
+	}
+	return res.Levels, nil
+}
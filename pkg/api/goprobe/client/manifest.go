@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/fako1024/httpc"
+)
+
+// GetManifest returns the DB manifest from the running goProbe instance
+func (c *Client) GetManifest(ctx context.Context) (*info.Manifest, error) {
+	var res = new(gpapi.ManifestResponse)
+
+	url := c.NewURL(gpapi.ManifestRoute)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("GET", url, c.Client()).
+			ParseJSON(res),
+	)
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		if res.Error != "" {
+			err = fmt.Errorf("%d: %s", res.StatusCode, res.Error)
+		}
+		return nil, err
+	}
+	return res.Manifest, nil
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"time"
 
 	"github.com/els0r/goProbe/pkg/api"
 	"github.com/els0r/goProbe/pkg/query"
@@ -26,11 +27,6 @@ func (c *Client) Query(ctx context.Context, args *query.Args) (*results.Result,
 		queryArgs.Caller = clientName
 	}
 
-	// we need more results before truncating
-	if queryArgs.NumResults < query.DefaultNumResults {
-		queryArgs.NumResults = query.DefaultNumResults
-	}
-
 	var res = new(results.Result)
 
 	req := c.Modify(ctx,
@@ -38,6 +34,76 @@ func (c *Client) Query(ctx context.Context, args *query.Args) (*results.Result,
 			EncodeJSON(queryArgs).
 			ParseJSON(res),
 	)
+	sent := time.Now()
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the query ran on the host in between sending the request and receiving its result, which allows
+	// to detect skew of the host's clock
+	res.HostsStatuses.SetClockSkew(res.Summary.Timings.ClockSkew(sent, time.Now()))
+
+	return res, nil
+}
+
+// RunBatch implements the query.BatchRunner interface
+func (c *Client) RunBatch(ctx context.Context, args []*query.Args) ([]*results.Result, error) {
+	return c.QueryBatch(ctx, args)
+}
+
+// QueryBatch runs multiple queries covering the same time range and interfaces in a single pass on
+// the API endpoint
+func (c *Client) QueryBatch(ctx context.Context, args []*query.Args) ([]*results.Result, error) {
+	// use copies of the arguments, since some fields are modified by the client
+	batchArgs := make([]query.Args, len(args))
+	for i, a := range args {
+		batchArgs[i] = *a
+		batchArgs[i].Format = types.FormatJSON
+
+		if batchArgs[i].Caller == "" {
+			batchArgs[i].Caller = clientName
+		}
+	}
+
+	var res []*results.Result
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("POST", c.NewURL(api.BatchQueryRoute), c.Client()).
+			EncodeJSON(batchArgs).
+			ParseJSON(&res),
+	)
+	sent := time.Now()
+	err := req.RunWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the queries ran on the host in between sending the request and receiving their results, which
+	// allows to detect skew of the host's clock
+	received := time.Now()
+	for _, r := range res {
+		r.HostsStatuses.SetClockSkew(r.Summary.Timings.ClockSkew(sent, received))
+	}
+
+	return res, nil
+}
+
+// DryRun implements the query.DryRunner interface: it validates the query and estimates its cost on
+// the API endpoint without running it
+func (c *Client) DryRun(ctx context.Context, args *query.Args) (*results.DryRun, error) {
+	queryArgs := *args
+	if queryArgs.Caller == "" {
+		queryArgs.Caller = clientName
+	}
+
+	var res = new(results.DryRun)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient("POST", c.NewURL(api.DryRunRoute), c.Client()).
+			EncodeJSON(queryArgs).
+			ParseJSON(res),
+	)
 	err := req.RunWithContext(ctx)
 	if err != nil {
 		return nil, err
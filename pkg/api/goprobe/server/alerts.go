@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+)
+
+const errAlertingDisabled = "alerting is disabled"
+
+func (server *Server) getAlertsHandler() func(context.Context, *struct{}) (*GetAlertsOutput, error) {
+	return func(_ context.Context, _ *struct{}) (*GetAlertsOutput, error) {
+		if server.alerts == nil {
+			return nil, huma.Error404NotFound(errAlertingDisabled)
+		}
+
+		output := &GetAlertsOutput{}
+		resp := &gpapi.AlertsResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+		resp.Alerts = server.alerts.Alerts()
+
+		return output, nil
+	}
+}
+
+func (server *Server) getAlertRulesHandler() func(context.Context, *struct{}) (*AlertRulesOutput, error) {
+	return func(_ context.Context, _ *struct{}) (*AlertRulesOutput, error) {
+		if server.alerts == nil {
+			return nil, huma.Error404NotFound(errAlertingDisabled)
+		}
+
+		output := &AlertRulesOutput{}
+		resp := &gpapi.AlertRulesResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+		if cfg := server.configMonitor.GetAlertingConfig(); cfg != nil {
+			resp.Rules = cfg.Rules
+		}
+
+		return output, nil
+	}
+}
+
+func (server *Server) putAlertRulesHandler() func(context.Context, *PutAlertRulesInput) (*AlertRulesOutput, error) {
+	return func(_ context.Context, input *PutAlertRulesInput) (*AlertRulesOutput, error) {
+		if server.alerts == nil {
+			return nil, huma.Error404NotFound(errAlertingDisabled)
+		}
+
+		output := &AlertRulesOutput{}
+		resp := &gpapi.AlertRulesResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+
+		err := input.Body.Validate()
+		if err != nil {
+			return output, huma.Error422UnprocessableEntity("alert rules validation failed", err)
+		}
+
+		server.configMonitor.PutAlertRules(input.Body)
+		resp.Rules = input.Body
+
+		return output, nil
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+)
+
+var alertsTags = []string{"Alerts"}
+
+const (
+	getAlertsOpName        = "get-alerts"
+	getAlertRulesOpName    = "get-alert-rules"
+	updateAlertRulesOpName = "update-alert-rules"
+)
+
+func (server *Server) registerAlertsAPI(a huma.API) {
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getAlertsOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.AlertsRoute,
+			Summary:     "Get alerts",
+			Description: "Gets all pending, firing and resolved alerts",
+			Tags:        alertsTags,
+		},
+		server.getAlertsHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getAlertRulesOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.AlertRulesRoute,
+			Summary:     "Get alert rules",
+			Description: "Gets the threshold rules evaluated by the built-in alerting",
+			Tags:        alertsTags,
+		},
+		server.getAlertRulesHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: updateAlertRulesOpName,
+			Metadata:    auth.RequireRole(auth.RoleAdmin),
+			Method:      http.MethodPut,
+			Path:        gpapi.AlertRulesRoute,
+			Summary:     "Update alert rules",
+			Description: "Replaces the threshold rules evaluated by the built-in alerting. The rules are applied as of the next evaluation",
+			Tags:        alertsTags,
+		},
+		server.putAlertRulesHandler(),
+	)
+}
+
+// GetAlertsOutput returns the alerts
+type GetAlertsOutput struct {
+	Body *gpapi.AlertsResponse
+}
+
+// AlertRulesOutput returns the alert rules
+type AlertRulesOutput struct {
+	Body *gpapi.AlertRulesResponse
+}
+
+// PutAlertRulesInput is the input to an alert rules update
+type PutAlertRulesInput struct {
+	Body config.AlertRules
+}
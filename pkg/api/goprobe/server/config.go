@@ -1,10 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/cmd/goProbe/config"
 	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
 )
 
@@ -101,3 +106,59 @@ func (server *Server) reloadConfigHandler() func(context.Context, *struct{}) (*C
 		return output, nil
 	}
 }
+
+func (server *Server) getStoredConfigHandler() func(context.Context, *struct{}) (*GetStoredConfigOutput, error) {
+	return func(ctx context.Context, _ *struct{}) (*GetStoredConfigOutput, error) {
+		output := &GetStoredConfigOutput{}
+		resp := &gpapi.StoredConfigResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+
+		var err error
+		resp.Config, resp.Version, err = server.configMonitor.StoredConfig()
+		if err != nil {
+			if errors.Is(err, config.ErrNoConfigFile) {
+				return output, huma.Error404NotFound("no stored configuration", err)
+			}
+			return output, huma.Error500InternalServerError("failed to read stored configuration", err)
+		}
+		output.ETag = strconv.Quote(resp.Version)
+
+		return output, nil
+	}
+}
+
+func (server *Server) putStoredConfigHandler() func(context.Context, *PutStoredConfigInput) (*PutStoredConfigOutput, error) {
+	return func(ctx context.Context, input *PutStoredConfigInput) (*PutStoredConfigOutput, error) {
+		output := &PutStoredConfigOutput{}
+		resp := &gpapi.StoredConfigUpdateResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+
+		cfg, err := config.Parse(bytes.NewReader(input.RawBody))
+		if err != nil {
+			return output, huma.Error422UnprocessableEntity("config validation failed", err)
+		}
+
+		resp.Version, resp.Enabled, resp.Updated, resp.Disabled, err = server.configMonitor.StoreConfig(ctx, cfg, strings.Trim(input.IfMatch, `"`), server.captureManager.Update)
+		if err != nil {
+			resp.StatusCode = http.StatusBadRequest
+			resp.Error = err.Error()
+
+			switch {
+			case errors.Is(err, config.ErrVersionMismatch):
+				return output, huma.Error412PreconditionFailed("stored configuration was modified", err)
+			case errors.Is(err, config.ErrInvalidConfig):
+				return output, huma.Error422UnprocessableEntity("config validation failed", err)
+			case errors.Is(err, config.ErrNoConfigFile):
+				return output, huma.Error404NotFound("no stored configuration", err)
+			}
+			return output, huma.Error400BadRequest("config update failed", err)
+		}
+		output.ETag = strconv.Quote(resp.Version)
+
+		return output, nil
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/api/auth"
 	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
 )
 
@@ -15,12 +16,15 @@ const (
 	reloadConfigOpName = "reload-config"
 	updateConfigOpName = "update-config"
 
+	getStoredConfigOpName    = "get-stored-config"
+	updateStoredConfigOpName = "update-stored-config"
+
 	getConfigSingle   = getConfigOpName + "-single"
 	getConfigMultiple = getConfigOpName + "-many"
 )
 
-func (server *Server) registerConfigAPI() {
-	huma.Register(server.API(),
+func (server *Server) registerConfigAPI(a huma.API) {
+	huma.Register(a,
 		huma.Operation{
 			OperationID: getConfigSingle,
 			Method:      http.MethodGet,
@@ -31,7 +35,7 @@ func (server *Server) registerConfigAPI() {
 		},
 		server.getIfaceConfigHandler(),
 	)
-	huma.Register(server.API(),
+	huma.Register(a,
 		huma.Operation{
 			OperationID: getConfigMultiple,
 			Method:      http.MethodGet,
@@ -42,9 +46,10 @@ func (server *Server) registerConfigAPI() {
 		},
 		server.getIfacesConfigHandler(),
 	)
-	huma.Register(server.API(),
+	huma.Register(a,
 		huma.Operation{
 			OperationID: updateConfigOpName,
+			Metadata:    auth.RequireRole(auth.RoleAdmin),
 			Method:      http.MethodPut,
 			Path:        gpapi.ConfigRoute,
 			Summary:     "Update capture configuration",
@@ -53,9 +58,10 @@ func (server *Server) registerConfigAPI() {
 		},
 		server.putConfigHandler(),
 	)
-	huma.Register(server.API(),
+	huma.Register(a,
 		huma.Operation{
 			OperationID: reloadConfigOpName,
+			Metadata:    auth.RequireRole(auth.RoleAdmin),
 			Method:      http.MethodPost,
 			Path:        gpapi.ConfigRoute + gpapi.ConfigReloadRoute,
 			Summary:     "Reload capture configuration",
@@ -64,6 +70,30 @@ func (server *Server) registerConfigAPI() {
 		},
 		server.reloadConfigHandler(),
 	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getStoredConfigOpName,
+			Metadata:    auth.RequireRole(auth.RoleAdmin),
+			Method:      http.MethodGet,
+			Path:        gpapi.ConfigRoute + gpapi.ConfigFileRoute,
+			Summary:     "Get stored configuration",
+			Description: "Gets the configuration stored in the config file along with its version (also provided as ETag)",
+			Tags:        configTags,
+		},
+		server.getStoredConfigHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: updateStoredConfigOpName,
+			Metadata:    auth.RequireRole(auth.RoleAdmin),
+			Method:      http.MethodPut,
+			Path:        gpapi.ConfigRoute + gpapi.ConfigFileRoute,
+			Summary:     "Replace stored configuration",
+			Description: "Validates the configuration, replaces the one stored in the config file with it and reloads it. The update is rejected if the stored configuration changed since the version provided via If-Match",
+			Tags:        configTags,
+		},
+		server.putStoredConfigHandler(),
+	)
 }
 
 // GetIfaceConfigInput describes the input to a config request for a single interface
@@ -91,3 +121,21 @@ type PutConfigInput struct {
 type ConfigUpdateOutput struct {
 	Body *gpapi.ConfigUpdateResponse
 }
+
+// GetStoredConfigOutput returns the stored configuration
+type GetStoredConfigOutput struct {
+	ETag string `header:"ETag"`
+	Body *gpapi.StoredConfigResponse
+}
+
+// PutStoredConfigInput is the input to an update of the stored configuration
+type PutStoredConfigInput struct {
+	IfMatch string `header:"If-Match" doc:"Version of the stored configuration the update is based on (* to replace any version)" required:"true"`
+	RawBody []byte `contentType:"application/yaml" doc:"Configuration (JSON or YAML)"`
+}
+
+// PutStoredConfigOutput returns the version of the stored configuration and the updated interfaces
+type PutStoredConfigOutput struct {
+	ETag string `header:"ETag"`
+	Body *gpapi.StoredConfigUpdateResponse
+}
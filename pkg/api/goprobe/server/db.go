@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// containsDefaultFrom denotes the start of the time range checked if none is provided, covering
+// the whole DB
+const containsDefaultFrom = "0"
+
+func (server *Server) getContainsHandler() func(ctx context.Context, input *GetContainsInput) (*GetContainsOutput, error) {
+	return func(ctx context.Context, input *GetContainsInput) (*GetContainsOutput, error) {
+		output := &GetContainsOutput{}
+		resp := &gpapi.ContainsResponse{}
+		output.Body = resp
+
+		ip, err := netip.ParseAddr(input.IP)
+		if err != nil {
+			return output, huma.Error400BadRequest("invalid IP address", err)
+		}
+		resp.IP = ip.Unmap().String()
+
+		from := input.From
+		if from == "" {
+			from = containsDefaultFrom
+		}
+
+		ifaces := types.AnySelector
+		if len(input.Ifaces) > 0 {
+			ifaces = strings.Join(input.Ifaces, ",")
+		}
+
+		// the condition on the IP allows the query engine to skip all days whose IP filter
+		// rules out the IP, so only days which (likely) observed it are read
+		args := query.NewArgs(types.IfaceName, ifaces,
+			query.WithCondition("host = "+resp.IP),
+			query.WithFirst(from),
+			query.WithFormat(types.FormatJSON),
+			query.WithNumResults(query.MaxResults),
+			query.WithCaller(getContainsOpName),
+		)
+		if input.To != "" {
+			args.Last = input.To
+		}
+
+		res, err := server.newQueryRunner().Run(ctx, args)
+		if err != nil {
+			resp.StatusCode = http.StatusInternalServerError
+			resp.Error = err.Error()
+
+			return output, huma.Error500InternalServerError("failed to check for IP", err)
+		}
+
+		for _, row := range res.Rows {
+			if resp.Interfaces == nil {
+				resp.Interfaces = make(map[string]types.Counters)
+			}
+			counters := resp.Interfaces[row.Labels.Iface]
+			counters.Add(row.Counters)
+			resp.Interfaces[row.Labels.Iface] = counters
+		}
+		resp.Seen = len(resp.Interfaces) > 0
+
+		resp.StatusCode = http.StatusOK
+		output.Status = resp.StatusCode
+
+		return output, nil
+	}
+}
+
+func (server *Server) getIPsHandler() func(ctx context.Context, input *GetIPsInput) (*GetIPsOutput, error) {
+	return func(_ context.Context, input *GetIPsInput) (*GetIPsOutput, error) {
+		output := &GetIPsOutput{}
+		resp := &gpapi.IPsResponse{}
+		output.Body = resp
+
+		var lookup netip.Addr
+		if input.Contains != "" {
+			ip, err := netip.ParseAddr(input.Contains)
+			if err != nil {
+				return output, huma.Error400BadRequest("invalid IP address", err)
+			}
+			lookup = ip.Unmap()
+			resp.Lookup = lookup.String()
+		}
+
+		from := input.From
+		if from == "" {
+			from = containsDefaultFrom
+		}
+		first, last, err := query.ParseTimeRange(from, input.To)
+		if err != nil {
+			return output, huma.Error400BadRequest("invalid time range", err)
+		}
+
+		indices, err := goDB.ReadIPIndices(server.dbPath, input.Ifaces, first, last)
+		if err != nil {
+			resp.StatusCode = http.StatusInternalServerError
+			resp.Error = err.Error()
+
+			return output, huma.Error500InternalServerError("failed to read IP indices", err)
+		}
+
+		resp.Days = make([]gpapi.DayIPs, 0, len(indices))
+		for _, day := range indices {
+			var index gpapi.IPIndex
+			if day.Index != nil {
+				index = day.Index
+			}
+			resp.Days = append(resp.Days, gpapi.NewDayIPs(day.Iface, day.Day, index, lookup))
+		}
+
+		resp.StatusCode = http.StatusOK
+		output.Status = resp.StatusCode
+
+		return output, nil
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+)
+
+var dbTags = []string{"DB"}
+
+const (
+	getContainsOpName = "get-db-contains"
+	getIPsOpName      = "get-db-ips"
+)
+
+func (server *Server) registerDBAPI(a huma.API, middlewares huma.Middlewares) {
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getContainsOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.ContainsRoute,
+			Summary:     "Check if an IP was observed",
+			Description: "Checks whether an IP was observed as source or destination in the given time range. Days whose IP filter rules out the IP are skipped without being read",
+			Tags:        dbTags,
+			Middlewares: middlewares,
+		},
+		server.getContainsHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getIPsOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.IPsRoute,
+			Summary:     "Get unique IPs per day",
+			Description: "Lists the unique IPs observed as source or destination per interface and day (or checks whether a specific IP was observed). Only the IP index of each day is read, none of its flows",
+			Tags:        dbTags,
+			Middlewares: middlewares,
+		},
+		server.getIPsHandler(),
+	)
+}
+
+// GetContainsInput describes the input to an IP existence check
+type GetContainsInput struct {
+	IP     string   `query:"ip" doc:"IP address to check (IPv4 or IPv6)" required:"true" example:"10.81.45.1"`
+	From   string   `query:"from" doc:"Start of the time range (any format accepted by queries, defaults to the beginning of the DB)" example:"-30d"`
+	To     string   `query:"to" doc:"End of the time range (any format accepted by queries, defaults to now)" example:"-1h"`
+	Ifaces []string `query:"ifaces" doc:"Interfaces to check (defaults to all)" required:"false" minItems:"1"`
+}
+
+// GetContainsOutput returns the result of an IP existence check
+type GetContainsOutput struct {
+	Status int
+	Body   *gpapi.ContainsResponse
+}
+
+// GetIPsInput describes the input to an IP index lookup
+type GetIPsInput struct {
+	Contains string   `query:"contains" doc:"IP address to check for (IPv4 or IPv6). If set, only its presence is stated per day instead of listing all IPs" example:"10.81.45.1"`
+	From     string   `query:"from" doc:"Start of the time range (any format accepted by queries, defaults to the beginning of the DB)" example:"-7d"`
+	To       string   `query:"to" doc:"End of the time range (any format accepted by queries, defaults to now)" example:"-1h"`
+	Ifaces   []string `query:"ifaces" doc:"Interfaces to look up (defaults to all)" required:"false" minItems:"1"`
+}
+
+// GetIPsOutput returns the result of an IP index lookup
+type GetIPsOutput struct {
+	Status int
+	Body   *gpapi.IPsResponse
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+const (
+	maxFlowWatchTimeout      = 10 * time.Minute
+	minFlowWatchPollInterval = time.Second
+)
+
+func (server *Server) watchFlowHandler() func(ctx context.Context, input *WatchFlowInput) (*WatchFlowOutput, error) {
+	return func(ctx context.Context, input *WatchFlowInput) (*WatchFlowOutput, error) {
+		output := &WatchFlowOutput{}
+		resp := &gpapi.FlowWatchResponse{}
+		output.Body = resp
+
+		key, err := input.Body.Key()
+		if err != nil {
+			return output, huma.Error400BadRequest("invalid flow", err)
+		}
+
+		timeout := input.Body.Timeout
+		if timeout == 0 {
+			timeout = gpapi.DefaultFlowWatchTimeout
+		}
+		timeout = min(timeout, maxFlowWatchTimeout)
+
+		pollInterval := input.Body.PollInterval
+		if pollInterval == 0 {
+			pollInterval = gpapi.DefaultFlowWatchPollInterval
+		}
+		pollInterval = max(pollInterval, minFlowWatchPollInterval)
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		resp.Counters, resp.ObservedAt = server.watchFlow(ctx, goDB.KeyFilter(key), pollInterval, input.Body.Ifaces...)
+		resp.Observed = !resp.ObservedAt.IsZero()
+
+		resp.StatusCode = http.StatusOK
+		output.Status = resp.StatusCode
+
+		return output, nil
+	}
+}
+
+func (server *Server) getLiveFlowsHandler() func(ctx context.Context, input *GetLiveFlowsInput) (*GetLiveFlowsOutput, error) {
+	return func(ctx context.Context, input *GetLiveFlowsInput) (*GetLiveFlowsOutput, error) {
+		output := &GetLiveFlowsOutput{}
+		resp := &gpapi.LiveFlowsResponse{}
+		output.Body = resp
+
+		resp.LastRotation = server.captureManager.LastRotation()
+		resp.Flows = server.liveFlows(ctx, input.Ifaces...)
+		if identity, _ := auth.FromContext(ctx); identity.Projection != nil {
+			resp.Flows = projectLiveFlows(resp.Flows, identity.Projection)
+		}
+
+		resp.StatusCode = http.StatusOK
+		output.Status = resp.StatusCode
+
+		return output, nil
+	}
+}
+
+func (server *Server) getFlowSnapshotHandler() func(ctx context.Context, input *GetFlowSnapshotInput) (*GetFlowSnapshotOutput, error) {
+	return func(ctx context.Context, input *GetFlowSnapshotInput) (*GetFlowSnapshotOutput, error) {
+		output := &GetFlowSnapshotOutput{
+			ContentType: capturetypes.FlowSnapshotContentType,
+		}
+
+		if len(server.captureManager.Config(input.Iface)) == 0 {
+			return output, huma.Error404NotFound("interface not captured: " + input.Iface)
+		}
+
+		// A flow map is only provided if any flows were observed (resulting in an empty snapshot otherwise)
+		flows := capturetypes.TaggedAggFlowMap{Iface: input.Iface}
+		mapChan := make(chan hashmap.AggFlowMapWithMetadata, 1)
+		go func() {
+			server.captureManager.GetFlowMaps(ctx, nil, mapChan, input.Iface)
+			close(mapChan)
+		}()
+		for flowMap := range mapChan {
+			flows.Map = flowMap.AggFlowMap
+		}
+
+		buf := bytes.NewBuffer(nil)
+		if err := capturetypes.WriteFlowSnapshot(buf, flows); err != nil {
+			return output, huma.Error500InternalServerError("failed to write flow snapshot", err)
+		}
+		output.Body = buf.Bytes()
+
+		return output, nil
+	}
+}
+
+func (server *Server) replayFlowSnapshotHandler() func(ctx context.Context, input *ReplayFlowSnapshotInput) (*ReplayFlowSnapshotOutput, error) {
+	return func(ctx context.Context, input *ReplayFlowSnapshotInput) (*ReplayFlowSnapshotOutput, error) {
+		output := &ReplayFlowSnapshotOutput{}
+		resp := &gpapi.FlowSnapshotResponse{}
+		output.Body = resp
+
+		flows, err := capturetypes.ReadFlowSnapshot(bytes.NewReader(input.RawBody))
+		if err != nil {
+			if errors.Is(err, capturetypes.ErrUnsupportedFlowSnapshotVersion) {
+				return output, huma.Error422UnprocessableEntity("unsupported flow snapshot", err)
+			}
+			return output, huma.Error400BadRequest("invalid flow snapshot", err)
+		}
+		server.captureManager.ReplayFlows(flows)
+
+		resp.Iface = flows.Iface
+		resp.NumFlows = flows.Map.Len()
+
+		resp.StatusCode = http.StatusOK
+		output.Status = resp.StatusCode
+
+		return output, nil
+	}
+}
+
+// watchFlow polls the live flow data until traffic passing filterFn is observed or the context
+// expires. Only traffic observed after the call is taken into account
+func (server *Server) watchFlow(ctx context.Context, filterFn goDB.FilterFn, pollInterval time.Duration, ifaces ...string) (observed map[string]types.Counters, observedAt time.Time) {
+	lastRotation := server.captureManager.LastRotation()
+	baseline := server.liveFlowCounters(ctx, filterFn, ifaces...)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, time.Time{}
+		case <-ticker.C:
+			rotation := server.captureManager.LastRotation()
+			current := server.liveFlowCounters(ctx, filterFn, ifaces...)
+
+			// the live flow data is reset upon rotation, hence any traffic present after a rotation
+			// has been observed while watching. If a rotation occurred while fetching the data, it
+			// is unclear whether it predates the rotation, so the next poll is awaited
+			if !rotation.Equal(lastRotation) {
+				baseline, lastRotation = nil, rotation
+			}
+			if !server.captureManager.LastRotation().Equal(rotation) {
+				continue
+			}
+
+			observed = make(map[string]types.Counters)
+			for iface, counters := range current {
+				base := baseline[iface]
+				if counters.PacketsRcvd < base.PacketsRcvd || counters.PacketsSent < base.PacketsSent {
+					continue
+				}
+				counters.Sub(base)
+				if counters.SumPackets() > 0 {
+					observed[iface] = counters
+				}
+			}
+			if len(observed) > 0 {
+				return observed, time.Now()
+			}
+		}
+	}
+}
+
+// liveFlows returns all flows of the live flow data
+func (server *Server) liveFlows(ctx context.Context, ifaces ...string) []gpapi.LiveFlow {
+	mapChan := make(chan hashmap.AggFlowMapWithMetadata, 1)
+	go func() {
+		server.captureManager.GetFlowMaps(ctx, nil, mapChan, ifaces...)
+		close(mapChan)
+	}()
+
+	flows := make([]gpapi.LiveFlow, 0)
+	for flowMap := range mapChan {
+		for it := flowMap.Iter(); it.Next(); {
+			flows = append(flows, gpapi.LiveFlow{
+				FlowKey:  gpapi.NewFlowKey(it.Key()),
+				Iface:    flowMap.Interface,
+				Counters: it.Val(),
+			})
+		}
+	}
+	return flows
+}
+
+// projectLiveFlows removes all attributes not visible according to the projection from the flows,
+// merging flows becoming indistinguishable (retaining the order of their first occurrence)
+func projectLiveFlows(flows []gpapi.LiveFlow, projection *auth.Projection) []gpapi.LiveFlow {
+	var (
+		flowIdx   = make(map[gpapi.LiveFlow]int, len(flows))
+		projected = flows[:0]
+	)
+	for _, flow := range flows {
+		if !projection.Permits(types.SIPName) {
+			flow.SrcIP = netip.Addr{}
+		}
+		if !projection.Permits(types.DIPName) {
+			flow.DstIP = netip.Addr{}
+		}
+		if !projection.Permits(types.DportName) {
+			flow.DstPort = 0
+		}
+		if !projection.Permits(types.ProtoName) {
+			flow.IPProto = 0
+		}
+		if !projection.Permits(types.IfaceName) {
+			flow.Iface = ""
+		}
+
+		key := flow
+		key.Counters = types.Counters{}
+		if idx, exists := flowIdx[key]; exists {
+			projected[idx].Counters.Add(flow.Counters)
+			continue
+		}
+		flowIdx[key] = len(projected)
+		projected = append(projected, flow)
+	}
+	return projected
+}
+
+// liveFlowCounters sums up the live flow data passing filterFn for each interface
+func (server *Server) liveFlowCounters(ctx context.Context, filterFn goDB.FilterFn, ifaces ...string) map[string]types.Counters {
+	mapChan := make(chan hashmap.AggFlowMapWithMetadata, 1)
+	go func() {
+		server.captureManager.GetFlowMaps(ctx, filterFn, mapChan, ifaces...)
+		close(mapChan)
+	}()
+
+	counters := make(map[string]types.Counters)
+	for flowMap := range mapChan {
+		var c types.Counters
+		for it := flowMap.PrimaryMap.Iter(); it.Next(); {
+			c.Add(it.Val())
+		}
+		for it := flowMap.SecondaryMap.Iter(); it.Next(); {
+			c.Add(it.Val())
+		}
+		counters[flowMap.Interface] = c
+	}
+	return counters
+}
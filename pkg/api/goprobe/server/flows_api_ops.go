@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+)
+
+var flowsTags = []string{"Flows"}
+
+const (
+	watchFlowOpName          = "watch-flow"
+	liveFlowsOpName          = "get-live-flows"
+	getFlowSnapshotOpName    = "get-flow-snapshot"
+	replayFlowSnapshotOpName = "replay-flow-snapshot"
+
+	// maxFlowSnapshotSize limits the size of a replayed flow snapshot (corresponding to roughly ten
+	// million IPv6 flows)
+	maxFlowSnapshotSize = 512 * 1024 * 1024
+)
+
+func (server *Server) registerFlowsAPI(a huma.API) {
+	huma.Register(a,
+		huma.Operation{
+			OperationID: watchFlowOpName,
+			Method:      http.MethodPost,
+			Path:        gpapi.FlowWatchRoute,
+			Summary:     "Watch live flow",
+			Description: "Watches the live flow data for a flow (e.g. returned by a query) and returns as soon as traffic matching the flow is observed or the timeout expires",
+			Tags:        flowsTags,
+		},
+		server.watchFlowHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: liveFlowsOpName,
+			Metadata:    auth.SupportProjection(),
+			Method:      http.MethodGet,
+			Path:        gpapi.LiveFlowsRoute,
+			Summary:     "Get live flows",
+			Description: "Returns all flows observed since the last writeout, allowing to follow the traffic of an interface at flow granularity",
+			Tags:        flowsTags,
+		},
+		server.getLiveFlowsHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getFlowSnapshotOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.FlowSnapshotRoute,
+			Summary:     "Get flow snapshot",
+			Description: "Dumps the flows of an interface observed since the last writeout as compact binary snapshot (e.g. to inspect the flows at the time of an issue or to replay them into another instance)",
+			Tags:        flowsTags,
+		},
+		server.getFlowSnapshotHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID:  replayFlowSnapshotOpName,
+			Metadata:     auth.RequireRole(auth.RoleAdmin),
+			Method:       http.MethodPost,
+			Path:         gpapi.FlowSnapshotRoute,
+			Summary:      "Replay flow snapshot",
+			Description:  "Merges the flows of a binary snapshot into the next writeout of the interface the snapshot was taken on",
+			Tags:         flowsTags,
+			MaxBodyBytes: maxFlowSnapshotSize,
+		},
+		server.replayFlowSnapshotHandler(),
+	)
+}
+
+// WatchFlowInput is the input to a flow watch request
+type WatchFlowInput struct {
+	Body gpapi.FlowWatchRequest
+}
+
+// WatchFlowOutput returns the outcome of a flow watch request
+type WatchFlowOutput struct {
+	Status int
+	Body   *gpapi.FlowWatchResponse
+}
+
+// GetLiveFlowsInput is the input to a live flows query
+type GetLiveFlowsInput struct {
+	Ifaces []string `query:"ifaces" doc:"Interfaces to get live flows from (all interfaces if empty)" required:"false" minItems:"1"`
+}
+
+// GetLiveFlowsOutput returns the flows observed since the last writeout
+type GetLiveFlowsOutput struct {
+	Status int
+	Body   *gpapi.LiveFlowsResponse
+}
+
+// GetFlowSnapshotInput is the input to a flow snapshot request
+type GetFlowSnapshotInput struct {
+	Iface string `query:"iface" doc:"Interface to get the flow snapshot from" required:"true" minLength:"1"`
+}
+
+// GetFlowSnapshotOutput returns the binary flow snapshot
+type GetFlowSnapshotOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+// ReplayFlowSnapshotInput is the input to a flow snapshot replay
+type ReplayFlowSnapshotInput struct {
+	RawBody []byte `contentType:"application/octet-stream" doc:"Binary flow snapshot"`
+}
+
+// ReplayFlowSnapshotOutput returns the outcome of a flow snapshot replay
+type ReplayFlowSnapshotOutput struct {
+	Status int
+	Body   *gpapi.FlowSnapshotResponse
+}
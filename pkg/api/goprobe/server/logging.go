@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+)
+
+func (server *Server) getLogLevelsHandler() func(context.Context, *struct{}) (*LogLevelsOutput, error) {
+	return func(_ context.Context, _ *struct{}) (*LogLevelsOutput, error) {
+		output := &LogLevelsOutput{}
+		resp := &gpapi.LogLevelsResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+		resp.Levels = logLevels(server.logLevels)
+
+		return output, nil
+	}
+}
+
+func (server *Server) putLogLevelsHandler() func(context.Context, *PutLogLevelsInput) (*LogLevelsOutput, error) {
+	return func(_ context.Context, input *PutLogLevelsInput) (*LogLevelsOutput, error) {
+		output := &LogLevelsOutput{}
+		resp := &gpapi.LogLevelsResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+
+		// validate all levels before applying any of them
+		var (
+			errs    []error
+			def     slog.Level
+			modules = make(map[logs.Module]*slog.Level, len(input.Body.Modules))
+		)
+		if input.Body.Default != "" {
+			level, err := logs.ParseLevel(input.Body.Default)
+			if err != nil {
+				errs = append(errs, &huma.ErrorDetail{Location: "body.default", Message: err.Error(), Value: input.Body.Default})
+			}
+			def = level
+		}
+		for name, lvl := range input.Body.Modules {
+			m, err := logs.ParseModule(name)
+			if err != nil {
+				errs = append(errs, &huma.ErrorDetail{Location: "body.modules." + name, Message: err.Error(), Value: name})
+				continue
+			}
+			if lvl == "" {
+				modules[m] = nil
+				continue
+			}
+			level, err := logs.ParseLevel(lvl)
+			if err != nil {
+				errs = append(errs, &huma.ErrorDetail{Location: "body.modules." + name, Message: err.Error(), Value: lvl})
+				continue
+			}
+			modules[m] = &level
+		}
+		if len(errs) > 0 {
+			return output, huma.Error422UnprocessableEntity("log levels validation failed", errs...)
+		}
+
+		if input.Body.Default != "" {
+			server.logLevels.SetDefault(def)
+		}
+		for m, level := range modules {
+			if level == nil {
+				_ = server.logLevels.Reset(m)
+				continue
+			}
+			_ = server.logLevels.Set(m, *level)
+		}
+		resp.Levels = logLevels(server.logLevels)
+
+		logs.Logger(logs.ModuleAPI).With("levels", resp.Levels).Info("updated log levels")
+
+		return output, nil
+	}
+}
+
+func logLevels(levels *logs.Levels) gpapi.LogLevels {
+	res := gpapi.LogLevels{
+		Default: logs.LevelString(levels.Default()),
+		Modules: make(map[string]string),
+	}
+	for m, level := range levels.Overrides() {
+		res.Modules[string(m)] = logs.LevelString(level)
+	}
+	return res
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+)
+
+var loggingTags = []string{"Logging"}
+
+const (
+	getLogLevelsOpName    = "get-log-levels"
+	updateLogLevelsOpName = "update-log-levels"
+)
+
+func (server *Server) registerLoggingAPI(a huma.API) {
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getLogLevelsOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.LogLevelsRoute,
+			Summary:     "Get log levels",
+			Description: "Gets the default log level and the individual log levels of modules",
+			Tags:        loggingTags,
+		},
+		server.getLogLevelsHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: updateLogLevelsOpName,
+			Metadata:    auth.RequireRole(auth.RoleAdmin),
+			Method:      http.MethodPut,
+			Path:        gpapi.LogLevelsRoute,
+			Summary:     "Update log levels",
+			Description: "Adjusts the default log level and / or the individual log levels of modules. The levels apply immediately (until the next restart)",
+			Tags:        loggingTags,
+		},
+		server.putLogLevelsHandler(),
+	)
+}
+
+// LogLevelsOutput returns the log levels
+type LogLevelsOutput struct {
+	Body *gpapi.LogLevelsResponse
+}
+
+// PutLogLevelsInput is the input to a log levels update
+type PutLogLevelsInput struct {
+	Body gpapi.LogLevels
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+)
+
+func (server *Server) getManifestHandler() func(ctx context.Context, _ *struct{}) (*GetManifestOutput, error) {
+	return func(ctx context.Context, _ *struct{}) (*GetManifestOutput, error) {
+		output := &GetManifestOutput{}
+		resp := &gpapi.ManifestResponse{}
+		output.Body = resp
+
+		resp.StatusCode = http.StatusOK
+
+		manifest, err := info.ReadOrBuildManifest(server.dbPath)
+		if err != nil {
+			resp.StatusCode = http.StatusInternalServerError
+			resp.Error = err.Error()
+
+			return output, huma.Error500InternalServerError("failed to read DB manifest", err)
+		}
+		resp.Manifest = manifest
+
+		output.Status = resp.StatusCode
+
+		return output, nil
+	}
+}
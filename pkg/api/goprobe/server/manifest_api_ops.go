@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	gpapi "github.com/els0r/goProbe/pkg/api/goprobe"
+)
+
+var manifestTags = []string{"Manifest"}
+
+const (
+	getManifestOpName = "get-manifest"
+)
+
+func (server *Server) registerManifestAPI(a huma.API) {
+	huma.Register(a,
+		huma.Operation{
+			OperationID: getManifestOpName,
+			Method:      http.MethodGet,
+			Path:        gpapi.ManifestRoute,
+			Summary:     "Get DB manifest",
+			Description: "Gets the manifest describing the contents of the goDB (interfaces, covered time ranges, encoders and sizes)",
+			Tags:        manifestTags,
+		},
+		server.getManifestHandler(),
+	)
+}
+
+// GetManifestOutput returns the manifest fetched during a manifest request
+type GetManifestOutput struct {
+	Status int
+	Body   *gpapi.ManifestResponse
+}
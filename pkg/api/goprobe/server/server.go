@@ -8,7 +8,10 @@ import (
 	"github.com/els0r/goProbe/pkg/api"
 	"github.com/els0r/goProbe/pkg/api/server"
 	"github.com/els0r/goProbe/pkg/capture"
+	"github.com/els0r/goProbe/pkg/cgroup"
 	"github.com/els0r/goProbe/pkg/goDB/engine"
+	"github.com/els0r/goProbe/pkg/goprobe/alerting"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 	"github.com/els0r/goProbe/pkg/version"
 )
 
@@ -19,16 +22,23 @@ type Server struct {
 	dbPath         string
 	captureManager *capture.Manager
 	configMonitor  *config.Monitor
+	alerts         *alerting.Evaluator
+	logLevels      *logs.Levels
+	queryPool      *engine.QueryPool
 
 	*server.DefaultServer
 }
 
-// New creates a new goprobe API server
-func New(addr, dbPath string, captureManager *capture.Manager, configMonitor *config.Monitor, opts ...server.Option) *Server {
+// New creates a new goprobe API server. If alerts is nil, the alerting endpoints report alerting as
+// being disabled
+func New(addr, dbPath string, captureManager *capture.Manager, configMonitor *config.Monitor, alerts *alerting.Evaluator, opts ...server.Option) *Server {
 	server := &Server{
 		dbPath:         dbPath,
 		captureManager: captureManager,
 		configMonitor:  configMonitor,
+		alerts:         alerts,
+		logLevels:      logs.GlobalLevels(),
+		queryPool:      newQueryPool(configMonitor),
 		DefaultServer:  server.NewDefault(config.ServiceName, addr, opts...),
 	}
 
@@ -46,16 +56,89 @@ func (server *Server) registerRoutes() {
 		middlewares = append(middlewares, api.RateLimitMiddleware(rateLimiter))
 	}
 
-	// query
-	api.RegisterQueryAPI(server.API(),
-		fmt.Sprintf("goProbe/%s", version.Short()),
-		engine.NewQueryRunnerWithLiveData(server.dbPath, server.captureManager),
-		middlewares,
-	)
+	// handlers are shared across all API versions
+	querier := server.newQueryRunner()
+	server.ForEachVersion(func(_ api.Version, a huma.API) {
+		// query
+		api.RegisterQueryAPI(a,
+			fmt.Sprintf("goProbe/%s", version.Short()),
+			querier,
+			middlewares,
+			api.WithDefaultQueryDeadline(server.QueryDeadline()),
+			api.WithResultStore(server.QueryResultStore()),
+		)
 
-	// stats
-	server.registerStatusAPI()
+		// stats
+		server.registerStatusAPI(a)
 
-	// config
-	server.registerConfigAPI()
+		// config
+		server.registerConfigAPI(a)
+
+		// manifest
+		server.registerManifestAPI(a)
+
+		// DB lookups
+		server.registerDBAPI(a, middlewares)
+
+		// live flows
+		server.registerFlowsAPI(a)
+
+		// alerts
+		server.registerAlertsAPI(a)
+
+		// logging
+		server.registerLoggingAPI(a)
+	})
+}
+
+// newQueryPool creates the pool shared by all queries run by the server (using the configured bounds, if any).
+// Unless configured, the memory of a single query is capped to half of the memory limit of the control group
+// (if any), so that a single query cannot get the probe OOM killed
+func newQueryPool(configMonitor *config.Monitor) *engine.QueryPool {
+	var cfg config.QueryPoolConfig
+	if configMonitor != nil {
+		if apiCfg := configMonitor.GetConfig().API; apiCfg != nil {
+			cfg = apiCfg.QueryPool
+		}
+	}
+	if cfg.MaxMemBytesPerQuery == 0 {
+		cfg.MaxMemBytesPerQuery = cgroup.Current().MemoryBytes / 2
+	}
+	return engine.NewQueryPool(cfg.ProcessingUnits, cfg.MaxProcessingUnitsPerQuery, cfg.MaxMemBytesPerQuery)
+}
+
+// newQueryRunner creates a query runner acting on both DB and live data (using the metadata cache of
+// the capture manager and the configured query resource policies, if any). All query runners share the
+// query pool of the server
+func (server *Server) newQueryRunner() *engine.QueryRunner {
+	opts := []engine.RunnerOption{engine.WithLiveData(server.captureManager), engine.WithQueryPool(server.queryPool)}
+	if server.captureManager != nil {
+		opts = append(opts, engine.WithMetadataCache(server.captureManager.MetadataCache()))
+	}
+	if server.configMonitor != nil {
+		if cfg := server.configMonitor.GetConfig(); cfg.API != nil {
+			opts = append(opts, engine.WithResourcePolicies(resourcePolicies(cfg.API.QueryPolicies)...))
+		}
+	}
+	return engine.NewQueryRunner(server.dbPath, opts...)
+}
+
+// resourcePolicies converts the (validated) query policies of the configuration into the resource
+// policies applied by the query runner
+func resourcePolicies(cfgs []config.QueryPolicyConfig) []engine.ResourcePolicy {
+	policies := make([]engine.ResourcePolicy, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		windows, loc, err := cfg.TimeWindows()
+		if err != nil {
+			continue
+		}
+		policies = append(policies, engine.ResourcePolicy{
+			Name:               cfg.Name,
+			Windows:            windows,
+			Location:           loc,
+			MaxProcessingUnits: cfg.MaxProcessingUnits,
+			MaxMemPct:          cfg.MaxMemPct,
+		})
+	}
+	return policies
 }
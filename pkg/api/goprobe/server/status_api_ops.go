@@ -16,8 +16,8 @@ const (
 	getStatusMultiple = getStatusOpName + "-multiple"
 )
 
-func (server *Server) registerStatusAPI() {
-	huma.Register(server.API(),
+func (server *Server) registerStatusAPI(a huma.API) {
+	huma.Register(a,
 		huma.Operation{
 			OperationID: getStatusSingle,
 			Method:      http.MethodGet,
@@ -28,7 +28,7 @@ func (server *Server) registerStatusAPI() {
 		},
 		server.getIfaceStatusHandler(),
 	)
-	huma.Register(server.API(),
+	huma.Register(a,
 		huma.Operation{
 			OperationID: getStatusMultiple,
 			Method:      http.MethodGet,
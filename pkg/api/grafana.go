@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const grafanaTypeTable = "table"
+
+// grafanaTargets lists the attributes, labels and shorthands available as targets of Grafana queries
+var grafanaTargets = []string{
+	types.SIPName, types.DIPName, types.DportName, types.ProtoName, types.DportClassName,
+	types.IfaceName, types.ZoneName, types.TagName, types.ProcessName, types.VLANName, types.SMACName, types.DMACName, types.TCPFlagsName, types.DSCPName, types.HostnameName, types.HostIDName,
+	types.TalkConvCompoundQuery, types.TalkSrcCompoundQuery, types.TalkDstCompoundQuery,
+	types.AppsPortCompoundQuery, types.AggTalkPortCompoundQuery,
+}
+
+func getGrafanaTestHandler() func(context.Context, *struct{}) (*GrafanaTestOutput, error) {
+	return func(context.Context, *struct{}) (*GrafanaTestOutput, error) {
+		return &GrafanaTestOutput{Status: http.StatusOK}, nil
+	}
+}
+
+func getGrafanaSearchHandler() func(context.Context, *GrafanaSearchInput) (*GrafanaSearchOutput, error) {
+	return func(_ context.Context, input *GrafanaSearchInput) (*GrafanaSearchOutput, error) {
+		output := &GrafanaSearchOutput{Body: []string{}}
+
+		var search string
+		if input.Body != nil {
+			search = input.Body.Target
+		}
+		for _, target := range grafanaTargets {
+			if strings.Contains(target, search) {
+				output.Body = append(output.Body, target)
+			}
+		}
+		return output, nil
+	}
+}
+
+func getGrafanaAnnotationsHandler() func(context.Context, *GrafanaAnnotationsInput) (*GrafanaAnnotationsOutput, error) {
+	return func(context.Context, *GrafanaAnnotationsInput) (*GrafanaAnnotationsOutput, error) {
+		return &GrafanaAnnotationsOutput{Body: []any{}}, nil
+	}
+}
+
+func (q *queryAPI) getGrafanaQueryHandler(caller string, querier query.Runner) func(context.Context, *GrafanaQueryInput) (*GrafanaQueryOutput, error) {
+	return func(ctx context.Context, input *GrafanaQueryInput) (*GrafanaQueryOutput, error) {
+		output := &GrafanaQueryOutput{Body: []any{}}
+
+		for i, target := range input.Body.Targets {
+			if target.Hide {
+				continue
+			}
+
+			data := target.Payload
+			if data == nil {
+				data = target.Data
+			}
+			if data == nil {
+				data = &GrafanaTargetData{}
+			}
+			if _, err := data.Metric.Value(types.Counters{}); err != nil {
+				return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("target %d: %s", i, err))
+			}
+
+			ifaces := data.Ifaces
+			if ifaces == "" {
+				ifaces = types.AnySelector
+			}
+			args := query.NewArgs(target.Target, ifaces)
+			args.QueryHosts = data.QueryHosts
+			args.Condition = data.Condition
+			args.First = strconv.FormatInt(input.Body.Range.From.Unix(), 10)
+			args.Last = strconv.FormatInt(input.Body.Range.To.Unix(), 10)
+			if data.Limit > 0 {
+				args.NumResults = data.Limit
+			}
+
+			attributes, selector, err := types.ParseQueryType(args.Query)
+			if err != nil {
+				return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("target %d: invalid query type", i), err)
+			}
+
+			// time series are aggregated per (5-minute) interval
+			isTable := target.Type == grafanaTypeTable
+			if !isTable && !selector.Timestamp {
+				args.Query = types.TimeName + types.AttrSep + args.Query
+				selector.Timestamp = true
+			}
+
+			res, err := q.runQuery(ctx, caller, args, querier)
+			if err != nil {
+				return nil, err
+			}
+
+			if isTable {
+				output.Body = append(output.Body, res.GrafanaTable(selector, attributes))
+				continue
+			}
+			series, err := res.GrafanaTimeSeries(selector, attributes, data.Metric, target.RefID)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range series {
+				output.Body = append(output.Body, s)
+			}
+		}
+
+		return output, nil
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+)
+
+var grafanaTags = []string{"Grafana"}
+
+// registerGrafanaAPI registers the endpoints following the conventions of the Grafana JSON datasource,
+// allowing Grafana panels to query goProbe / global-query directly
+func (q *queryAPI) registerGrafanaAPI(a huma.API, caller string, querier query.Runner, middlewares huma.Middlewares) {
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "grafana-test",
+			Method:      http.MethodGet,
+			Path:        GrafanaRoute,
+			Summary:     "Test Grafana datasource",
+			Description: "Returns 200 OK, allowing Grafana to test the connection to the datasource",
+			Tags:        grafanaTags,
+		},
+		getGrafanaTestHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "grafana-search",
+			Method:      http.MethodPost,
+			Path:        GrafanaSearchRoute,
+			Summary:     "List Grafana targets",
+			Description: "Lists the attributes, labels and query type shorthands which can be used (comma-separated) as targets of Grafana queries",
+			Tags:        grafanaTags,
+		},
+		getGrafanaSearchHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "grafana-query",
+			Method:      http.MethodPost,
+			Path:        GrafanaQueryRoute,
+			Summary:     "Run Grafana queries",
+			Description: "Runs the queries of a Grafana panel over the panel's time range, returning the results as time series (one per distinct set of attributes, aggregated in 5-minute intervals) or as tables",
+			Middlewares: middlewares,
+			Tags:        grafanaTags,
+		},
+		q.getGrafanaQueryHandler(caller, querier),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "grafana-annotations",
+			Method:      http.MethodPost,
+			Path:        GrafanaAnnotationsRoute,
+			Summary:     "Get Grafana annotations",
+			Description: "Provided for compatibility with the Grafana JSON datasource. No annotations are returned",
+			Tags:        grafanaTags,
+		},
+		getGrafanaAnnotationsHandler(),
+	)
+}
+
+// GrafanaTestOutput confirms that the datasource is reachable
+type GrafanaTestOutput struct {
+	Status int
+}
+
+// GrafanaSearchInput stores the (partial) target to search for
+type GrafanaSearchInput struct {
+	Body *GrafanaSearchRequest `required:"false"`
+}
+
+// GrafanaSearchRequest is the payload of a Grafana search
+type GrafanaSearchRequest struct {
+	_ struct{} `additionalProperties:"true"`
+
+	// Target: the (partial) target to search for
+	Target string `json:"target,omitempty" required:"false" doc:"(Partial) target to search for" example:"sip"`
+}
+
+// GrafanaSearchOutput lists the available targets
+type GrafanaSearchOutput struct {
+	Body []string
+}
+
+// GrafanaQueryInput stores the queries of a Grafana panel
+type GrafanaQueryInput struct {
+	Body *GrafanaQueryRequest
+}
+
+// GrafanaQueryRequest is the payload of a Grafana query
+type GrafanaQueryRequest struct {
+	_ struct{} `additionalProperties:"true"`
+
+	// Range: the time range of the panel
+	Range GrafanaRange `json:"range" doc:"Time range to query"`
+	// Targets: the queries of the panel
+	Targets []GrafanaTarget `json:"targets" doc:"Queries to run" minItems:"1"`
+}
+
+// GrafanaRange is the time range of a Grafana query
+type GrafanaRange struct {
+	_ struct{} `additionalProperties:"true"`
+
+	From time.Time `json:"from" doc:"Start of the time range" example:"2024-04-12T09:00:00Z"`
+	To   time.Time `json:"to" doc:"End of the time range" example:"2024-04-12T15:00:00Z"`
+}
+
+// GrafanaTarget is a single query of a Grafana panel
+type GrafanaTarget struct {
+	_ struct{} `additionalProperties:"true"`
+
+	// RefID: the ID of the query within the panel
+	RefID string `json:"refId,omitempty" required:"false" doc:"ID of the query within the panel, used to name the series of queries without attributes" example:"A"`
+	// Target: the query type
+	Target string `json:"target" doc:"Query type / Attributes to aggregate by. The time attribute is added for time series if missing" example:"dport,proto" minLength:"3"`
+	// Type: the type of the response
+	Type string `json:"type,omitempty" required:"false" doc:"Type of the response (default: timeserie)" enum:"timeserie,table"`
+	// Hide: skip the query
+	Hide bool `json:"hide,omitempty" required:"false" doc:"Skip the query"`
+
+	// Payload / Data: additional query parameters (depending on the plugin version, they are provided in either field)
+	Payload *GrafanaTargetData `json:"payload,omitempty" required:"false" doc:"Additional query parameters"`
+	Data    *GrafanaTargetData `json:"data,omitempty" required:"false" doc:"Additional query parameters (legacy)"`
+}
+
+// GrafanaTargetData stores the additional parameters of a Grafana query
+type GrafanaTargetData struct {
+	_ struct{} `additionalProperties:"true"`
+
+	// Ifaces: the interfaces to query
+	Ifaces string `json:"ifaces,omitempty" required:"false" doc:"Interfaces to query (default: any)" example:"eth0,eth1"`
+	// QueryHosts: the hosts to query (global-query only)
+	QueryHosts string `json:"query_hosts,omitempty" required:"false" doc:"Hosts for which data is queried (global-query only)" example:"hostA,hostB"`
+	// Condition: the condition to filter data by
+	Condition string `json:"condition,omitempty" required:"false" doc:"Condition to filter data by" example:"proto=TCP"`
+	// Metric: the counter exported as value of time series
+	Metric results.GrafanaMetric `json:"metric,omitempty" required:"false" doc:"Counter exported as value of time series (default: bytes)" enum:"bytes,bytes_in,bytes_out,packets,packets_in,packets_out"`
+	// Limit: the maximum number of rows returned (for time series, this caps the number of datapoints across all series)
+	Limit uint64 `json:"limit,omitempty" required:"false" doc:"Maximum number of rows returned (default: 1000). For time series, this caps the number of datapoints across all series" example:"100"`
+}
+
+// GrafanaQueryOutput stores the time series / tables returned for the queries of a Grafana panel
+type GrafanaQueryOutput struct {
+	Body []any
+}
+
+// GrafanaAnnotationsInput stores the annotation query of a Grafana panel
+type GrafanaAnnotationsInput struct {
+	Body *GrafanaAnnotationsRequest `required:"false"`
+}
+
+// GrafanaAnnotationsRequest is the payload of a Grafana annotation query
+type GrafanaAnnotationsRequest struct {
+	_ struct{} `additionalProperties:"true"`
+
+	// Range: the time range of the panel
+	Range GrafanaRange `json:"range,omitempty" required:"false" doc:"Time range to query"`
+}
+
+// GrafanaAnnotationsOutput stores the annotations returned for a Grafana panel
+type GrafanaAnnotationsOutput struct {
+	Body []any
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+)
+
+type grafanaTestRunner struct {
+	args []*query.Args
+}
+
+func (g *grafanaTestRunner) Run(_ context.Context, args *query.Args) (*results.Result, error) {
+	g.args = append(g.args, args)
+
+	res := results.New()
+	res.Rows = results.Rows{{
+		Labels:     results.Labels{Timestamp: time.Unix(1712900000, 0)},
+		Attributes: results.Attributes{DstPort: 80},
+		Counters:   types.Counters{BytesRcvd: 3, PacketsRcvd: 1},
+	}}
+	return res, nil
+}
+
+func TestGrafanaAPI(t *testing.T) {
+	runner := &grafanaTestRunner{}
+
+	_, a := humatest.New(t)
+	RegisterQueryAPI(a, "test", runner, nil)
+
+	require.Equal(t, http.StatusOK, a.Get(GrafanaRoute).Code)
+
+	resp := a.Post(GrafanaSearchRoute, strings.NewReader(`{"target":"ip"}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `["sip","dip"]`, resp.Body.String())
+
+	// additional fields sent by Grafana are ignored
+	resp = a.Post(GrafanaQueryRoute, strings.NewReader(`{
+		"range": {"from": "2024-04-12T06:00:00.000Z", "to": "2024-04-12T12:00:00.000Z", "raw": {"from": "now-6h", "to": "now"}},
+		"intervalMs": 30000,
+		"targets": [
+			{"refId": "A", "target": "dport", "type": "timeserie", "payload": {"ifaces": "eth0", "metric": "packets"}},
+			{"refId": "B", "target": "dport", "type": "table", "data": {"limit": 5}},
+			{"refId": "C", "target": "sip", "hide": true}
+		]
+	}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var body []map[string]any
+	require.Nil(t, jsoniter.Unmarshal(resp.Body.Bytes(), &body))
+	require.Len(t, body, 2)
+	require.Equal(t, "dport=80", body[0]["target"])
+	require.Equal(t, []any{[]any{1., 1712900000000.}}, body[0]["datapoints"])
+	require.Equal(t, "table", body[1]["type"])
+	require.Equal(t, []any{[]any{"80", 3., 0., 1., 0.}}, body[1]["rows"])
+
+	require.Len(t, runner.args, 2)
+	require.Equal(t, "time,dport", runner.args[0].Query)
+	require.Equal(t, "eth0", runner.args[0].Ifaces)
+	require.Equal(t, "1712901600", runner.args[0].First)
+	require.Equal(t, "1712923200", runner.args[0].Last)
+	require.Equal(t, "dport", runner.args[1].Query)
+	require.Equal(t, types.AnySelector, runner.args[1].Ifaces)
+	require.Equal(t, uint64(5), runner.args[1].NumResults)
+
+	resp = a.Post(GrafanaQueryRoute, strings.NewReader(`{"range": {"from": "2024-04-12T06:00:00Z", "to": "2024-04-12T12:00:00Z"}, "targets": [{"target": "dport", "payload": {"metric": "flows"}}]}`))
+	require.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+	resp = a.Post(GrafanaAnnotationsRoute, strings.NewReader(`{"annotation": {"name": "events"}}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `[]`, resp.Body.String())
+}
@@ -2,10 +2,14 @@ package api
 
 import (
 	"context"
+	"math"
 	"net/http"
 	"os"
+	"runtime"
+	"runtime/debug"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/cgroup"
 	"github.com/els0r/goProbe/pkg/version"
 )
 
@@ -13,6 +17,7 @@ var infoTags = []string{"Info"}
 
 const (
 	healthy = "healthy"
+	warning = "warning"
 	ready   = "ready"
 
 	getHealthOpName = "get-health"
@@ -27,6 +32,31 @@ type ServiceInfo struct {
 	Version string `json:"version" doc:"Service (semantic) version" example:"4.0.0-824f5847"`                             // Version: (semantic) version and commit short
 	Commit  string `json:"commit,omitempty" doc:"Full git commit SHA" example:"824f58479a8f326cb350085b3a0e287645e11bc1"` // Commit: full git commit SHA
 	Pod     string `json:"pod,omitempty" doc:"Name of kubernetes pod (if available)"`                                     // Pod: name of kubernetes pod, if available
+
+	Resources *Resources `json:"resources,omitempty" doc:"Resources usable by the service"` // Resources: resources usable by the service
+}
+
+// Resources summarizes the resources usable by the running service, taking into account the limits of
+// its control group (e.g. when running in a container)
+type Resources struct {
+	NumCPU      int            `json:"num_cpu" doc:"Number of logical CPUs of the host" example:"16"`
+	GOMAXPROCS  int            `json:"gomaxprocs" doc:"Maximum number of CPUs executing Go code simultaneously" example:"2"`
+	MemoryLimit int64          `json:"memory_limit,omitempty" doc:"Soft memory limit of the Go runtime (in bytes, unlimited if omitted)" example:"1932735283"`
+	Cgroup      *cgroup.Limits `json:"cgroup,omitempty" doc:"Resource limits of the (cgroup v2) control group of the service (if detected)"`
+}
+
+func currentResources() *Resources {
+	resources := &Resources{
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+	if memLimit := debug.SetMemoryLimit(-1); memLimit != math.MaxInt64 {
+		resources.MemoryLimit = memLimit
+	}
+	if limits := cgroup.Current(); limits.Path != "" {
+		resources.Cgroup = &limits
+	}
+	return resources
 }
 
 // GetInfoOutput is the output of the info request
@@ -43,7 +73,7 @@ func GetInfoOperation() huma.Operation {
 		Method:      http.MethodGet,
 		Path:        InfoRoute,
 		Summary:     "Get application info",
-		Description: "Get runtime information about the application.",
+		Description: "Get runtime information about the application, including the resources usable by it (e.g. the limits of the container it is running in).",
 		Tags:        infoTags,
 	}
 }
@@ -66,16 +96,25 @@ func GetServiceInfoHandler(serviceName string) func(context.Context, *struct{})
 	}
 
 	return func(ctx context.Context, _ *struct{}) (*GetInfoOutput, error) {
+		// the resources may be adapted at runtime, hence they are obtained upon each request
+		serviceInfo := *info
+		serviceInfo.Resources = currentResources()
+
 		output := &GetInfoOutput{}
-		output.Body.ServiceInfo = info
+		output.Body.ServiceInfo = &serviceInfo
 		return output, nil
 	}
 }
 
+// HealthCheck denotes a function reporting warnings about the state of the application. If
+// no warnings are returned, the application is considered healthy
+type HealthCheck func(ctx context.Context) (warnings []string)
+
 // HealthOutput returns the output of the health command
 type GetHealthOutput struct {
 	Body struct {
-		Status string `json:"status" doc:"Health status of application" example:"healthy"`
+		Status   string   `json:"status" doc:"Health status of application" example:"healthy" enum:"healthy,warning"`
+		Warnings []string `json:"warnings,omitempty" doc:"Warnings about the state of the application (if any)" example:"[\"writeouts congested\"]"`
 	}
 }
 
@@ -91,11 +130,19 @@ func GetHealthOperation() huma.Operation {
 	}
 }
 
-// GetHealthHandler returns a handler that returns the application readiness state
-func GetHealthHandler() func(context.Context, *struct{}) (*GetHealthOutput, error) {
+// GetHealthHandler returns a handler that returns the application health state. If any of the
+// health checks reports warnings, the application is in a warning state (which does not constitute
+// a failure of the health endpoint, i.e. the application is still considered alive)
+func GetHealthHandler(checks ...HealthCheck) func(context.Context, *struct{}) (*GetHealthOutput, error) {
 	return func(ctx context.Context, _ *struct{}) (*GetHealthOutput, error) {
 		output := &GetHealthOutput{}
 		output.Body.Status = healthy
+		for _, check := range checks {
+			output.Body.Warnings = append(output.Body.Warnings, check(ctx)...)
+		}
+		if len(output.Body.Warnings) > 0 {
+			output.Body.Status = warning
+		}
 		return output, nil
 	}
 }
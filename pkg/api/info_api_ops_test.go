@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetServiceInfoHandler(t *testing.T) {
+	handler := GetServiceInfoHandler("goprobe")
+
+	output, err := handler(context.Background(), nil)
+	require.Nil(t, err)
+	require.Equal(t, "goprobe", output.Body.Name)
+	require.NotNil(t, output.Body.Resources)
+	require.Equal(t, runtime.NumCPU(), output.Body.Resources.NumCPU)
+	require.Equal(t, runtime.GOMAXPROCS(0), output.Body.Resources.GOMAXPROCS)
+
+	// the resources are obtained upon each request
+	prev := runtime.GOMAXPROCS(1)
+	defer runtime.GOMAXPROCS(prev)
+
+	output, err = handler(context.Background(), nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, output.Body.Resources.GOMAXPROCS)
+}
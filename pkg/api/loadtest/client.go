@@ -0,0 +1,67 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/els0r/goProbe/pkg/api"
+	"github.com/els0r/goProbe/pkg/api/client"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/fako1024/httpc"
+)
+
+const clientName = "goprobe-loadtest"
+
+// StatusError denotes a query rejected by the API with a non-successful HTTP status code
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("query rejected: %s", e.Status)
+}
+
+// Client issues queries against the query API of a goProbe host or a global-query server. In contrast
+// to the regular API clients, failed requests are not retried, so rejections (e.g. due to rate
+// limiting) are reported as they occur
+type Client struct {
+	*client.DefaultClient
+}
+
+// NewClient creates a new load test client for the API at the given address
+func NewClient(addr string, opts ...client.Option) *Client {
+	opts = append(opts, client.WithName(clientName), client.WithRetry(false))
+	return &Client{
+		DefaultClient: client.NewDefault(addr, opts...),
+	}
+}
+
+// Run implements the query.Runner interface
+func (c *Client) Run(ctx context.Context, args *query.Args) (*results.Result, error) {
+	// use a copy of the arguments, since some fields are modified by the client
+	queryArgs := *args
+	queryArgs.Format = types.FormatJSON
+	if queryArgs.Caller == "" {
+		queryArgs.Caller = clientName
+	}
+
+	var res = new(results.Result)
+
+	req := c.Modify(ctx,
+		httpc.NewWithClient(http.MethodPost, c.NewURL(api.QueryRoute), c.Client()).
+			EncodeJSON(queryArgs).
+			ParseJSON(res).
+			ErrorFn(func(resp *http.Response) error {
+				return &StatusError{Code: resp.StatusCode, Status: resp.Status}
+			}),
+	)
+	if err := req.RunWithContext(ctx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,238 @@
+// Package loadtest issues a configurable mix of synthetic queries against the query API of a goProbe
+// host or a global-query server (and thereby the fleet of hosts behind it), measuring latency
+// percentiles and error rates. It allows operators to size hardware and to validate rate limit
+// settings before rolling out to production
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/query"
+	"golang.org/x/time/rate"
+)
+
+// Query denotes a query of the load test mix
+type Query struct {
+	// Name: identifies the query in the report
+	Name string `json:"name" yaml:"name"`
+	// Weight: relative frequency of the query within the mix (defaults to 1 if zero)
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Args: the arguments of the query
+	Args query.Args `json:"args" yaml:"args"`
+}
+
+// Mix denotes the set of queries issued during a load test
+type Mix []Query
+
+// DefaultMix returns a mix of queries typical for interactive use (top talkers, services and
+// interface volumes over various time ranges) on the given interfaces and hosts (only required if
+// the target is a global-query server)
+func DefaultMix(ifaces, hosts string) Mix {
+	newArgs := func(q, first string) query.Args {
+		args := query.NewArgs(q, ifaces, query.WithFirst(first))
+		args.QueryHosts = hosts
+		args.NumResults = 25
+		return *args
+	}
+	return Mix{
+		{Name: "top-talkers-1h", Weight: 4, Args: newArgs("sip,dip", "-1h")},
+		{Name: "services-24h", Weight: 2, Args: newArgs("dport,proto", "-24h")},
+		{Name: "top-ips-24h", Weight: 2, Args: newArgs("sip", "-24h")},
+		{Name: "ifaces-7d", Weight: 1, Args: newArgs("iface", "-7d")},
+	}
+}
+
+func (m Mix) validate() error {
+	if len(m) == 0 {
+		return errors.New("no queries in load test mix")
+	}
+	names := make(map[string]struct{}, len(m))
+	for _, q := range m {
+		if q.Name == "" {
+			return errors.New("load test query without name")
+		}
+		if _, exists := names[q.Name]; exists {
+			return fmt.Errorf("load test query %q defined more than once", q.Name)
+		}
+		names[q.Name] = struct{}{}
+		if q.Weight < 0 {
+			return fmt.Errorf("load test query %q: weight must not be negative", q.Name)
+		}
+	}
+	return nil
+}
+
+// picker selects queries from the mix at random, according to their weights
+type picker struct {
+	cumulative []int
+}
+
+func newPicker(m Mix) *picker {
+	p := &picker{cumulative: make([]int, len(m))}
+	total := 0
+	for i, q := range m {
+		total += max(q.Weight, 1)
+		p.cumulative[i] = total
+	}
+	return p
+}
+
+func (p *picker) pick() int {
+	// the first query whose cumulative weight exceeds the random number is selected
+	idx, _ := slices.BinarySearch(p.cumulative, rand.IntN(p.cumulative[len(p.cumulative)-1])+1)
+	return idx
+}
+
+// Config denotes the parameters of a load test
+type Config struct {
+	// Mix: the queries to issue
+	Mix Mix
+	// Concurrency: the number of queries in flight at any time (at most)
+	Concurrency int
+	// Rate: the number of queries issued per second (unlimited if zero)
+	Rate float64
+	// Duration: the duration during which queries are issued (unlimited if zero)
+	Duration time.Duration
+	// Requests: the total number of queries to issue (unlimited if zero)
+	Requests int
+	// Timeout: the timeout of each query (none if zero)
+	Timeout time.Duration
+}
+
+func (c Config) validate() error {
+	if err := c.Mix.validate(); err != nil {
+		return err
+	}
+	if c.Concurrency < 1 {
+		return errors.New("load test concurrency must be at least 1")
+	}
+	if c.Rate < 0 || c.Duration < 0 || c.Requests < 0 || c.Timeout < 0 {
+		return errors.New("load test rate, duration, requests and timeout must not be negative")
+	}
+	if c.Duration == 0 && c.Requests == 0 {
+		return errors.New("load test requires a duration or a number of requests")
+	}
+	return nil
+}
+
+// sample denotes the outcome of a single query
+type sample struct {
+	query   int
+	latency time.Duration
+	err     error
+}
+
+// Run runs a load test against the runner (typically a Client). Queries are issued until the
+// configured duration passed or number of requests was issued (whichever happens first). Queries
+// in flight at that point are awaited and accounted for
+func Run(ctx context.Context, runner query.Runner, cfg Config) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	issueCtx, cancel := ctx, context.CancelFunc(func() {})
+	if cfg.Duration > 0 {
+		issueCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+	}
+	defer cancel()
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if cfg.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(cfg.Rate), 1)
+	}
+
+	var (
+		jobs    = make(chan int)
+		samples = make(chan sample, cfg.Concurrency)
+		picker  = newPicker(cfg.Mix)
+		wg      sync.WaitGroup
+	)
+
+	start := time.Now()
+
+	// issue queries from the mix
+	go func() {
+		defer close(jobs)
+		for i := 0; cfg.Requests == 0 || i < cfg.Requests; i++ {
+			if err := limiter.Wait(issueCtx); err != nil {
+				return
+			}
+			select {
+			case jobs <- picker.pick():
+			case <-issueCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// run the queries. They are run with the parent context, so queries in flight are not
+	// interrupted when the load test duration has passed
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				args := cfg.Mix[idx].Args
+
+				queryCtx, queryCancel := ctx, context.CancelFunc(func() {})
+				if cfg.Timeout > 0 {
+					queryCtx, queryCancel = context.WithTimeout(ctx, cfg.Timeout)
+				}
+				t0 := time.Now()
+				_, err := runner.Run(queryCtx, &args)
+				samples <- sample{query: idx, latency: time.Since(t0), err: err}
+				queryCancel()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	latencies := make([][]time.Duration, len(cfg.Mix))
+	report := &Report{Queries: make([]Stats, len(cfg.Mix))}
+	for i, q := range cfg.Mix {
+		report.Queries[i].Name = q.Name
+	}
+	for s := range samples {
+		stats := &report.Queries[s.query]
+		stats.Requests++
+
+		var statusErr *StatusError
+		switch {
+		case s.err == nil:
+			latencies[s.query] = append(latencies[s.query], s.latency)
+		case errors.As(s.err, &statusErr) && statusErr.Code == http.StatusTooManyRequests:
+			stats.RateLimited++
+		default:
+			stats.Errors++
+		}
+	}
+	report.Duration = time.Since(start)
+
+	// the overall statistics are derived from all queries
+	var all []time.Duration
+	report.Total.Name = totalName
+	for i := range report.Queries {
+		report.Queries[i].finalize(latencies[i], report.Duration)
+
+		report.Total.Requests += report.Queries[i].Requests
+		report.Total.Errors += report.Queries[i].Errors
+		report.Total.RateLimited += report.Queries[i].RateLimited
+		all = append(all, latencies[i]...)
+	}
+	report.Total.finalize(all, report.Duration)
+
+	if report.Total.Requests == 0 && ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+	return report, nil
+}
@@ -0,0 +1,178 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRunner struct {
+	calls atomic.Int64
+	run   func(args *query.Args) error
+}
+
+func (m *mockRunner) Run(_ context.Context, args *query.Args) (*results.Result, error) {
+	m.calls.Add(1)
+	if err := m.run(args); err != nil {
+		return nil, err
+	}
+	return &results.Result{}, nil
+}
+
+func TestRun(t *testing.T) {
+	runner := &mockRunner{run: func(args *query.Args) error {
+		switch args.Query {
+		case "sip":
+			return &StatusError{Code: http.StatusTooManyRequests, Status: "429 Too Many Requests"}
+		case "dip":
+			return errors.New("connection refused")
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	}}
+
+	mix := Mix{
+		{Name: "ok", Weight: 2, Args: query.Args{Query: "sip,dip", Ifaces: "eth0"}},
+		{Name: "limited", Args: query.Args{Query: "sip", Ifaces: "eth0"}},
+		{Name: "failing", Args: query.Args{Query: "dip", Ifaces: "eth0"}},
+	}
+
+	report, err := Run(context.Background(), runner, Config{Mix: mix, Concurrency: 4, Requests: 200})
+	require.Nil(t, err)
+	require.EqualValues(t, 200, runner.calls.Load())
+
+	require.Equal(t, 200, report.Total.Requests)
+	require.Len(t, report.Queries, 3)
+	for _, stats := range report.Queries {
+		require.Greater(t, stats.Requests, 0, stats.Name)
+	}
+
+	ok, limited, failing := report.Queries[0], report.Queries[1], report.Queries[2]
+	require.Zero(t, ok.Errors+ok.RateLimited)
+	require.GreaterOrEqual(t, ok.Latency.Min, time.Millisecond)
+	require.LessOrEqual(t, ok.Latency.P50, ok.Latency.P99)
+	require.Greater(t, ok.Throughput, 0.)
+
+	require.Equal(t, limited.Requests, limited.RateLimited)
+	require.Zero(t, limited.Errors)
+	require.Equal(t, failing.Requests, failing.Errors)
+	require.Zero(t, failing.RateLimited)
+	require.Equal(t, 1., failing.ErrorRate())
+
+	require.Equal(t, limited.RateLimited, report.Total.RateLimited)
+	require.Equal(t, failing.Errors, report.Total.Errors)
+	require.Equal(t, ok.Latency, report.Total.Latency)
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, report.Print(buf))
+	require.Contains(t, buf.String(), "limited")
+	require.Equal(t, 7, strings.Count(buf.String(), "\n")) // title, blank line, header, three queries and total
+}
+
+func TestRunRateAndDuration(t *testing.T) {
+	runner := &mockRunner{run: func(_ *query.Args) error { return nil }}
+	mix := Mix{{Name: "ok", Args: query.Args{Query: "sip", Ifaces: "eth0"}}}
+
+	// the rate limits the number of queries issued during the load test
+	report, err := Run(context.Background(), runner, Config{Mix: mix, Concurrency: 2, Rate: 20, Duration: 500 * time.Millisecond})
+	require.Nil(t, err)
+	require.LessOrEqual(t, report.Total.Requests, 11)
+	require.GreaterOrEqual(t, report.Total.Requests, 5)
+	require.Equal(t, report.Total.Requests, int(runner.calls.Load()))
+}
+
+func TestConfigValidation(t *testing.T) {
+	mix := Mix{{Name: "ok", Args: query.Args{Query: "sip", Ifaces: "eth0"}}}
+
+	var tests = []struct {
+		name string
+		cfg  Config
+	}{
+		{"empty mix", Config{Concurrency: 1, Requests: 1}},
+		{"unnamed query", Config{Mix: Mix{{}}, Concurrency: 1, Requests: 1}},
+		{"duplicate query", Config{Mix: append(mix, mix...), Concurrency: 1, Requests: 1}},
+		{"negative weight", Config{Mix: Mix{{Name: "ok", Weight: -1}}, Concurrency: 1, Requests: 1}},
+		{"no concurrency", Config{Mix: mix, Requests: 1}},
+		{"negative rate", Config{Mix: mix, Concurrency: 1, Requests: 1, Rate: -1}},
+		{"unbounded", Config{Mix: mix, Concurrency: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Run(context.Background(), &mockRunner{}, test.cfg)
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestPicker(t *testing.T) {
+	p := newPicker(Mix{{Name: "a", Weight: 3}, {Name: "b"}, {Name: "c", Weight: 0}})
+
+	counts := make([]int, 3)
+	for i := 0; i < 10000; i++ {
+		counts[p.pick()]++
+	}
+
+	// queries without weight count as weight 1
+	require.InDelta(t, 6000, counts[0], 500)
+	require.InDelta(t, 2000, counts[1], 500)
+	require.InDelta(t, 2000, counts[2], 500)
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	var stats Stats
+	stats.finalize(latencies, time.Second)
+	require.Equal(t, Latencies{
+		Min:  time.Millisecond,
+		Mean: 50500 * time.Microsecond,
+		P50:  50 * time.Millisecond,
+		P90:  90 * time.Millisecond,
+		P95:  95 * time.Millisecond,
+		P99:  99 * time.Millisecond,
+		Max:  100 * time.Millisecond,
+	}, stats.Latency)
+	require.Equal(t, 100., stats.Throughput)
+
+	require.Equal(t, 7*time.Millisecond, percentile([]time.Duration{7 * time.Millisecond}, 99))
+}
+
+func TestClient(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) > 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"hostname":"test"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	args := &query.Args{Query: "sip", Ifaces: "eth0"}
+
+	res, err := client.Run(context.Background(), args)
+	require.Nil(t, err)
+	require.Equal(t, "test", res.Hostname)
+
+	// rejections are not retried
+	_, err = client.Run(context.Background(), args)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusTooManyRequests, statusErr.Code)
+	require.EqualValues(t, 2, requests.Load())
+}
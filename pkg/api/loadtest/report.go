@@ -0,0 +1,110 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// totalName denotes the statistics across all queries of the mix
+const totalName = "total"
+
+// Report denotes the outcome of a load test
+type Report struct {
+	// Duration: the duration of the load test (including queries in flight when it ended)
+	Duration time.Duration `json:"duration"`
+	// Total: the statistics across all queries
+	Total Stats `json:"total"`
+	// Queries: the statistics of each query of the mix
+	Queries []Stats `json:"queries"`
+}
+
+// Stats denotes the statistics of (a query of) a load test
+type Stats struct {
+	Name string `json:"name"`
+
+	// Requests: the number of queries issued
+	Requests int `json:"requests"`
+	// Errors: the number of failed queries (excluding the ones rejected by rate limiting)
+	Errors int `json:"errors"`
+	// RateLimited: the number of queries rejected by rate limiting
+	RateLimited int `json:"rate_limited"`
+
+	// Throughput: the number of successful queries per second
+	Throughput float64 `json:"throughput"`
+	// Latency: the latency distribution of successful queries
+	Latency Latencies `json:"latency"`
+}
+
+// ErrorRate returns the share of queries which failed or were rejected by rate limiting
+func (s Stats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors+s.RateLimited) / float64(s.Requests)
+}
+
+// Latencies denotes the latency distribution of a set of queries
+type Latencies struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+func (s *Stats) finalize(latencies []time.Duration, duration time.Duration) {
+	if duration > 0 {
+		s.Throughput = float64(len(latencies)) / duration.Seconds()
+	}
+	if len(latencies) == 0 {
+		return
+	}
+
+	latencies = slices.Clone(latencies)
+	slices.Sort(latencies)
+
+	var sum time.Duration
+	for _, latency := range latencies {
+		sum += latency
+	}
+	s.Latency = Latencies{
+		Min:  latencies[0],
+		Mean: sum / time.Duration(len(latencies)),
+		P50:  percentile(latencies, 50),
+		P90:  percentile(latencies, 90),
+		P95:  percentile(latencies, 95),
+		P99:  percentile(latencies, 99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
+
+// percentile returns the p-th percentile of the (sorted) latencies using the nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// Print prints the report as table, listing the statistics of each query and the total
+func (r *Report) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Load test completed after %s\n\n", r.Duration.Round(time.Millisecond))
+
+	writer := tabwriter.NewWriter(w, 0, 1, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "query\trequests\terrors\trate limited\terror rate\tthroughput\tmin\tmean\tp50\tp90\tp95\tp99\tmax\t")
+	for _, stats := range append(slices.Clone(r.Queries), r.Total) {
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%.2f%%\t%.2f/s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			stats.Name, stats.Requests, stats.Errors, stats.RateLimited, 100*stats.ErrorRate(), stats.Throughput,
+			round(stats.Latency.Min), round(stats.Latency.Mean), round(stats.Latency.P50), round(stats.Latency.P90),
+			round(stats.Latency.P95), round(stats.Latency.P99), round(stats.Latency.Max),
+		)
+	}
+	return writer.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
@@ -1,12 +1,17 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 	"github.com/els0r/telemetry/logging"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
@@ -40,7 +45,7 @@ const requestMsg = "handled request"
 // RequestLoggingMiddleware logs all requests received via the including hander chain
 func RequestLoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		logger := logging.FromContext(c.Request.Context())
+		logger := logs.FromContext(c.Request.Context(), logs.ModuleAPI)
 
 		// call next handlers
 		start := time.Now()
@@ -86,13 +91,159 @@ func RateLimitMiddleware(limiter *rate.Limiter) func(ctx huma.Context, next func
 	}
 }
 
+const authorizationHeaderKey = "Authorization"
+
+// AuthenticationMiddleware authenticates all requests (except for the ones to paths for which exempt
+// returns true) using the first of the providers handling the authorization scheme presented. It is
+// attached to the router, so that all routes (including e.g. metrics and profiling) are covered. The
+// identity of the caller is passed on via the request context (see auth.FromContext)
+func AuthenticationMiddleware(exempt func(path string) bool, providers ...auth.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if exempt(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		identity, err := auth.Authenticate(c.Request.Context(), c.GetHeader(authorizationHeaderKey), providers...)
+		if err != nil {
+			logs.FromContext(c.Request.Context(), logs.ModuleAPI).With("error", err).Warn("request authentication failed")
+			c.Header("WWW-Authenticate", "Bearer")
+			c.Header("Content-Type", "application/problem+json")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			_ = json.NewEncoder(c.Writer).Encode(huma.NewError(http.StatusUnauthorized, "authentication failed"))
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), identity))
+		c.Next()
+	}
+}
+
+// ProjectionMiddleware rejects callers restricted by a projection (see auth.Projection) for all paths
+// for which restricted returns true. It covers routes not served by the API operations (e.g. metrics
+// and profiling), which aren't subject to the AuthorizationMiddleware
+func ProjectionMiddleware(restricted func(path string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, _ := auth.FromContext(c.Request.Context())
+		if identity.Projection == nil || !restricted(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		logs.FromContext(c.Request.Context(), logs.ModuleAPI).With("subject", identity.Subject, "projection", identity.Projection.Name).Warn("request authorization failed")
+		c.Header("Content-Type", "application/problem+json")
+		c.AbortWithStatus(http.StatusForbidden)
+		_ = json.NewEncoder(c.Writer).Encode(huma.NewError(http.StatusForbidden, "insufficient permissions (route not permitted with projection "+identity.Projection.Name+")"))
+	}
+}
+
+// AuthorizationMiddleware rejects callers not granted the role required by the operation (see
+// auth.RequireRole), as well as callers restricted by a projection unless the operation supports
+// them (see auth.SupportProjection). The callers must have been authenticated by the
+// AuthenticationMiddleware
+func AuthorizationMiddleware(a huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		logger := logs.FromContext(ctx.Context(), logs.ModuleAPI)
+
+		identity, authenticated := auth.FromContext(ctx.Context())
+		if !authenticated {
+			ctx.SetHeader("WWW-Authenticate", "Bearer")
+			_ = huma.WriteErr(a, ctx, http.StatusUnauthorized, "authentication failed")
+			return
+		}
+
+		required := auth.RequiredRole(ctx.Operation().Metadata)
+		if !identity.Role.Permits(required) {
+			logger.With("subject", identity.Subject, "role", identity.Role, "required_role", required).Warn("request authorization failed")
+			_ = huma.WriteErr(a, ctx, http.StatusForbidden, fmt.Sprintf("insufficient permissions (%s role required)", required))
+			return
+		}
+
+		// callers restricted by a projection may only call operations removing all attributes not
+		// visible to them
+		if identity.Projection != nil && !auth.SupportsProjection(ctx.Operation().Metadata) {
+			logger.With("subject", identity.Subject, "projection", identity.Projection.Name).Warn("request authorization failed")
+			_ = huma.WriteErr(a, ctx, http.StatusForbidden, fmt.Sprintf("insufficient permissions (operation not permitted with projection %s)", identity.Projection.Name))
+			return
+		}
+		next(ctx)
+	}
+}
+
+const (
+	deprecationHeaderKey = "Deprecation"
+	linkHeaderKey        = "Link"
+	varyHeaderKey        = "Vary"
+	acceptHeaderKey      = "Accept"
+)
+
+// VersionMiddleware states the API version which handled a request in the response headers. If
+// the version is deprecated, the response is additionally marked via the Deprecation header and
+// points to the successor version via a Link header (see RFC 9745 / RFC 8288)
+func VersionMiddleware(v Version) func(ctx huma.Context, next func(huma.Context)) {
+	var (
+		versionHeader = v.String()
+		link          = fmt.Sprintf("<%s>; rel=\"successor-version\"", v.Successor().Prefix())
+	)
+	return func(ctx huma.Context, next func(huma.Context)) {
+		ctx.SetHeader(VersionHeaderKey, versionHeader)
+		if v.Deprecated() {
+			ctx.SetHeader(deprecationHeaderKey, "true")
+			ctx.AppendHeader(linkHeaderKey, link)
+		}
+		ctx.AppendHeader(varyHeaderKey, acceptHeaderKey)
+		next(ctx)
+	}
+}
+
+// VersionNegotiationHandler routes requests to the API version requested via a vendor media type in
+// their Accept header (e.g. "application/vnd.goprobe.v2+json"), allowing clients to select a version
+// without changing the paths they call. It has to wrap the router since it rewrites the path of
+// unprefixed requests to the one of the requested version (if served by it according to serves, paths
+// not being part of the versioned APIs such as the info routes are left untouched). Requests for
+// unsupported versions (or versions conflicting with the one stated by the path) are rejected with
+// 406 Not Acceptable
+func VersionNegotiationHandler(next http.Handler, serves func(v Version, path string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, requested := VersionFromAccept(r.Header.Get(acceptHeaderKey))
+		if !requested {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pathVersion := VersionFromPath(r.URL.Path)
+		if v == VersionUnknown || (pathVersion != V1 && pathVersion != v) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotAcceptable)
+			_ = json.NewEncoder(w).Encode(huma.NewError(http.StatusNotAcceptable,
+				fmt.Sprintf("requested API version not available for %s, supported media types: %s", r.URL.Path, supportedMediaTypes()),
+			))
+			return
+		}
+
+		if pathVersion != v && v.Prefix() != "" && serves(v, r.URL.Path) {
+			r.URL.Path = v.Route(r.URL.Path)
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func supportedMediaTypes() string {
+	mediaTypes := make([]string, 0, len(Versions))
+	for _, v := range Versions {
+		mediaTypes = append(mediaTypes, v.MediaType())
+	}
+	return strings.Join(mediaTypes, ", ")
+}
+
 // RecursionDetectorMiddleware provides a means to avoid having a distributed querier query itself
 // into oblivion
 func RecursionDetectorMiddleware(headerKey, match string) gin.HandlerFunc {
 	ErrRecursionDetected := errors.New("API query recursion detected, cross-check host configuration")
 	return func(c *gin.Context) {
 		if c.Request.Header.Get(headerKey) == match {
-			logging.FromContext(c.Request.Context()).Error(c.AbortWithError(http.StatusBadRequest, ErrRecursionDetected))
+			logs.FromContext(c.Request.Context(), logs.ModuleAPI).Error(c.AbortWithError(http.StatusBadRequest, ErrRecursionDetected))
 			return
 		}
 		c.Next()
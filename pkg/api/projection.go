@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// checkProjection rejects query args referring to attributes / labels (either in the query type or
+// in the condition) which are not visible to the caller. Callers not restricted by a projection may
+// refer to all attributes
+func checkProjection(ctx context.Context, args *query.Args) error {
+	identity, _ := auth.FromContext(ctx)
+	if identity.Projection == nil {
+		return nil
+	}
+
+	names, err := queriedAttributes(args)
+	if err != nil {
+		return huma.Error422UnprocessableEntity("invalid query args", err)
+	}
+	for _, name := range names {
+		if !identity.Projection.Permits(name) {
+			return huma.Error403Forbidden(fmt.Sprintf("attribute %s is not visible with projection %s", name, identity.Projection.Name))
+		}
+	}
+	return nil
+}
+
+// projectResult returns the result with all attributes / labels not visible to the caller removed,
+// irrespective of the query it originates from (e.g. a result stored on behalf of another caller). The
+// result is cloned prior to projecting it, since it may still be in use (e.g. partial results during
+// aggregation)
+func projectResult(ctx context.Context, result *results.Result) *results.Result {
+	identity, _ := auth.FromContext(ctx)
+	if identity.Projection == nil || result == nil {
+		return result
+	}
+	projected := result.Clone()
+	projected.Project(identity.Projection.Permits)
+	return projected
+}
+
+// queriedAttributes returns the names of all attributes / labels the query args refer to
+func queriedAttributes(args *query.Args) ([]string, error) {
+	attributes, selector, err := types.ParseQueryType(args.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		names = append(names, attribute.Name())
+	}
+	for name, selected := range map[string]bool{
+		types.TimeName:     selector.Timestamp,
+		types.IfaceName:    selector.Iface,
+		types.HostnameName: selector.Hostname,
+		types.HostIDName:   selector.HostID,
+		types.ZoneName:     selector.Zone,
+		types.TagName:      selector.Tag,
+		types.ProcessName:  selector.Process,
+		types.VLANName:     selector.VLAN,
+		types.SMACName:     selector.SMAC,
+		types.DMACName:     selector.DMAC,
+		types.TCPFlagsName: selector.TCPFlags,
+		types.DSCPName:     selector.DSCP,
+	} {
+		if selected {
+			names = append(names, name)
+		}
+	}
+
+	// restricting the query to tags / zones filters on the respective labels, revealing which of them
+	// match just as well as selecting them
+	if args.Tags != "" {
+		names = append(names, types.TagName)
+	}
+	if args.Zones != "" {
+		names = append(names, types.ZoneName)
+	}
+
+	conditionNames, err := node.ConditionAttributes(args.Condition)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, conditionNames...), nil
+}
@@ -2,50 +2,210 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 
+	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/sse"
 	"github.com/els0r/goProbe/cmd/global-query/pkg/distributed"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 	"github.com/els0r/goProbe/pkg/query"
 	"github.com/els0r/goProbe/pkg/results"
 	"github.com/els0r/goProbe/pkg/types"
-	"github.com/els0r/telemetry/logging"
 )
 
-func getBodyQueryRunnerHandler(caller string, querier query.Runner) func(context.Context, *ArgsInput) (*QueryResultOutput, error) {
-	return func(ctx context.Context, input *ArgsInput) (*QueryResultOutput, error) {
-		output := &QueryResultOutput{}
+func (q *queryAPI) getBodyQueryRunnerHandler(caller string, querier query.Runner) func(context.Context, *RunArgsInput) (*QueryResultOutput, error) {
+	return func(ctx context.Context, input *RunArgsInput) (*QueryResultOutput, error) {
+		if input.Store {
+			return q.storeQuery(ctx, caller, input.Body, querier)
+		}
+		if input.Detach {
+			return q.detachQuery(ctx, caller, input.Body, querier)
+		}
+
+		output := &QueryResultOutput{Status: http.StatusOK}
+
+		res, err := q.runQuery(ctx, caller, input.Body, querier)
+		if err != nil {
+			return nil, err
+		}
+		output.Body = projectResult(ctx, res)
+		output.QueryID = res.ID
+
+		return output, nil
+	}
+}
+
+// detachQuery starts a checkpointed query in the background and returns its ID as soon as it has
+// been assigned, allowing the client to re-attach to the query via the checkpoints route
+func (q *queryAPI) detachQuery(ctx context.Context, caller string, args *query.Args, querier query.Runner) (*QueryResultOutput, error) {
+	qr, ok := querier.(*distributed.QueryRunner)
+	if !ok || qr.Checkpoints() == nil {
+		return nil, huma.Error400BadRequest("detaching from queries requires checkpointing to be enabled")
+	}
+	if err := q.prepareArgs(ctx, caller, args); err != nil {
+		return nil, err
+	}
+
+	type runResult struct {
+		res *results.Result
+		err error
+	}
+	started, done := make(chan string, 1), make(chan runResult, 1)
+
+	// the query must not be cancelled once the request returns
+	runCtx := distributed.WithQueryStartedFn(context.WithoutCancel(ctx), func(id string) {
+		started <- id
+	})
+	go func() {
+		res, err := qr.Run(runCtx, args)
+		done <- runResult{res, err}
+	}()
+
+	select {
+	case id := <-started:
+		return &QueryResultOutput{
+			Status:   http.StatusAccepted,
+			Location: q.routePrefix + CheckpointsRoute + "/" + id,
+			QueryID:  id,
+			Body:     newPendingResult(id),
+		}, nil
+	case r := <-done:
+		// the query failed before it was started or was served from the cache
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &QueryResultOutput{Status: http.StatusOK, Body: projectResult(ctx, r.res)}, nil
+	}
+}
 
-		res, err := runQuery(ctx, caller, input.Body, querier)
+// storeQuery runs a query in the background, returning the URL its result can be retrieved from once
+// it completed
+func (q *queryAPI) storeQuery(ctx context.Context, caller string, args *query.Args, querier query.Runner) (*QueryResultOutput, error) {
+	if q.resultStore == nil {
+		return nil, huma.Error400BadRequest("storing of query results is disabled")
+	}
+	if err := q.prepareArgs(ctx, caller, args); err != nil {
+		return nil, err
+	}
+
+	token, err := q.resultStore.Submit(ctx, func(ctx context.Context) (*results.Result, error) {
+		return querier.Run(ctx, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryResultOutput{
+		Status:   http.StatusAccepted,
+		Location: q.routePrefix + StoredResultsRoute + "/" + token,
+		Body:     newPendingResult(token),
+	}, nil
+}
+
+// getStoredResultHandler returns the handler to retrieve the results of queries run in the background
+func (q *queryAPI) getStoredResultHandler() func(context.Context, *StoredResultInput) (*QueryResultOutput, error) {
+	return func(ctx context.Context, input *StoredResultInput) (*QueryResultOutput, error) {
+		res, err := q.resultStore.Get(input.Token)
 		if err != nil {
+			if errors.Is(err, ErrStoredResultNotFound) {
+				return nil, huma.Error404NotFound(err.Error())
+			}
 			return nil, err
 		}
-		output.Body = res
 
+		output := &QueryResultOutput{Status: http.StatusOK, Body: projectResult(ctx, res)}
+		if res.Status.Code == types.StatusPending {
+			output.Status = http.StatusAccepted
+		}
 		return output, nil
 	}
 }
 
-func getSSEBodyQueryRunnerHandler(caller string, querier *distributed.QueryRunner) func(context.Context, *ArgsInput, sse.Sender) {
+func (q *queryAPI) getSSEBodyQueryRunnerHandler(caller string, querier *distributed.QueryRunner) func(context.Context, *ArgsInput, sse.Sender) {
 	return func(ctx context.Context, input *ArgsInput, send sse.Sender) {
 		querier.SetResultReceivedFn(func(res *results.Result) error {
 			if res == nil {
 				return nil
 			}
-			return send.Data(&PartialResult{res})
+			return send.Data(&PartialResult{projectResult(ctx, res)})
+		})
+
+		// announce the query ID first, so clients can re-attach to the query if the connection drops
+		ctx = distributed.WithQueryStartedFn(ctx, func(id string) {
+			_ = send.Data(&QueryStarted{ID: id})
 		})
 
-		res, err := runQuery(ctx, caller, input.Body, querier)
+		res, err := q.runQuery(ctx, caller, input.Body, querier)
 		if err != nil {
 			_ = send.Data(err)
 			return
 		}
-		_ = send.Data(&FinalResult{res})
+		_ = send.Data(&FinalResult{projectResult(ctx, res)})
 	}
 }
 
-func runQuery(ctx context.Context, caller string, args *query.Args, querier query.Runner) (*results.Result, error) {
+func (q *queryAPI) getBodyBatchRunnerHandler(caller string, querier query.BatchRunner) func(context.Context, *BatchArgsInput) (*BatchResultOutput, error) {
+	return func(ctx context.Context, input *BatchArgsInput) (*BatchResultOutput, error) {
+		for i, args := range input.Body {
+			if args == nil {
+				return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("query %d: no query args provided", i))
+			}
+			if err := q.prepareArgs(ctx, caller, args); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := querier.RunBatch(ctx, input.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range res {
+			res[i] = projectResult(ctx, res[i])
+		}
+
+		return &BatchResultOutput{Body: res}, nil
+	}
+}
+
+// getBodyDryRunHandler returns the handler validating queries and estimating their cost
+func (q *queryAPI) getBodyDryRunHandler(caller string, dryRunner query.DryRunner) func(context.Context, *ArgsInput) (*DryRunOutput, error) {
+	return func(ctx context.Context, input *ArgsInput) (*DryRunOutput, error) {
+		if err := q.prepareArgs(ctx, caller, input.Body); err != nil {
+			return nil, err
+		}
+
+		res, err := dryRunner.DryRun(ctx, input.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DryRunOutput{Body: res}, nil
+	}
+}
+
+func (q *queryAPI) runQuery(ctx context.Context, caller string, args *query.Args, querier query.Runner) (*results.Result, error) {
+	if err := q.prepareArgs(ctx, caller, args); err != nil {
+		return nil, err
+	}
+
+	result, err := querier.Run(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// prepareArgs sets the defaults of the query args and checks if a statement can be created from them
+func (q *queryAPI) prepareArgs(ctx context.Context, caller string, args *query.Args) error {
 	// make sure all defaults are available if they weren't set explicitly
 	args.SetDefaults()
+	if args.Deadline == 0 {
+		args.Deadline = q.defaultDeadline
+	}
 
 	// Set default format for an API query is JSON
 	args.Format = types.FormatJSON
@@ -53,21 +213,36 @@ func runQuery(ctx context.Context, caller string, args *query.Args, querier quer
 		args.Caller = caller
 	}
 
-	logger := logging.FromContext(ctx)
+	logger := logs.FromContext(ctx, logs.ModuleAPI)
 
 	// Check if the statement can be created
 	logger.With("args", args).Info("running query")
-	_, err := args.Prepare()
-	if err != nil {
-		return nil, err
+	if _, err := args.Prepare(); err != nil {
+		return err
 	}
 
-	result, err := querier.Run(ctx, args)
-	if err != nil {
-		return nil, err
-	}
+	// Check if the caller may see all attributes referred to by the query
+	return checkProjection(ctx, args)
+}
 
-	return result, nil
+// getCheckpointHandler returns the handler to re-attach to checkpointed queries
+func getCheckpointHandler(querier *distributed.QueryRunner) func(context.Context, *CheckpointInput) (*CheckpointOutput, error) {
+	return func(ctx context.Context, input *CheckpointInput) (*CheckpointOutput, error) {
+		checkpoints := querier.Checkpoints()
+		if checkpoints == nil {
+			return nil, huma.Error404NotFound("query checkpointing is disabled")
+		}
+
+		cp, err := checkpoints.Get(ctx, input.ID)
+		if err != nil {
+			if errors.Is(err, distributed.ErrCheckpointNotFound) {
+				return nil, huma.Error404NotFound(err.Error())
+			}
+			return nil, err
+		}
+
+		return &CheckpointOutput{Body: cp}, nil
+	}
 }
 
 // getBodyValidationHandler returns the query args validation handler
@@ -75,7 +250,7 @@ func getBodyValidationHandler() func(context.Context, *ArgsInput) (*struct{}, er
 	return func(ctx context.Context, input *ArgsInput) (*struct{}, error) {
 		args := input.Body
 
-		logger := logging.FromContext(ctx).With("args", args)
+		logger := logs.FromContext(ctx, logs.ModuleAPI).With("args", args)
 		logger.Debug("validating args from body")
 
 		_, err := args.Prepare()
@@ -96,7 +271,7 @@ func getParamsValidationHandler() func(context.Context, *ArgsParamsInput) (*stru
 		args := input.Args
 		args.DNSResolution = input.DNSResolution
 
-		logger := logging.FromContext(ctx).With("args", args)
+		logger := logs.FromContext(ctx, logs.ModuleAPI).With("args", args)
 		logger.Debug("validating args from query parameters")
 
 		_, err := args.Prepare()
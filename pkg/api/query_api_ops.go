@@ -2,18 +2,56 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/sse"
 	"github.com/els0r/goProbe/cmd/global-query/pkg/distributed"
+	"github.com/els0r/goProbe/pkg/api/auth"
 	"github.com/els0r/goProbe/pkg/query"
 	"github.com/els0r/goProbe/pkg/results"
 )
 
 var queryTags = []string{"Query"}
 
+// QueryAPIOption configures the query API
+type QueryAPIOption func(*queryAPI)
+
+type queryAPI struct {
+	defaultDeadline time.Duration
+	resultStore     *ResultStore
+
+	routePrefix string // prefix of the (versioned) API the routes are registered with
+}
+
+// WithDefaultQueryDeadline sets the deadline applied to all queries which don't specify one
+// themselves. Once it is exceeded, the results aggregated so far are returned
+func WithDefaultQueryDeadline(deadline time.Duration) QueryAPIOption {
+	return func(q *queryAPI) {
+		q.defaultDeadline = deadline
+	}
+}
+
+// WithResultStore enables running queries in the background and storing their results server-side,
+// allowing clients to retrieve them later on via a token
+func WithResultStore(store *ResultStore) QueryAPIOption {
+	return func(q *queryAPI) {
+		q.resultStore = store
+	}
+}
+
 // RegisterQueryAPI registers all query related endpoints
-func RegisterQueryAPI(a huma.API, caller string, querier query.Runner, middlewares huma.Middlewares) {
+func RegisterQueryAPI(a huma.API, caller string, querier query.Runner, middlewares huma.Middlewares, opts ...QueryAPIOption) {
+	q := &queryAPI{}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	// versioned APIs declare the prefix they are served under as their server URL
+	if servers := a.OpenAPI().Servers; len(servers) > 0 {
+		q.routePrefix = servers[0].URL
+	}
+
 	// validation
 	huma.Register(a,
 		huma.Operation{
@@ -38,10 +76,107 @@ func RegisterQueryAPI(a huma.API, caller string, querier query.Runner, middlewar
 		getParamsValidationHandler(),
 	)
 
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "conditions-post-validate",
+			Method:      http.MethodPost,
+			Path:        ConditionValidationRoute,
+			Summary:     "Validate condition",
+			Description: "Parses a condition without running a query, returning its canonical tokenized form, the conditions it is evaluated by (with hostnames resolved to IP addresses) and its parse tree",
+			Tags:        queryTags,
+		},
+		getConditionValidationHandler(),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "conditions-post-translate",
+			Method:      http.MethodPost,
+			Path:        ConditionTranslationRoute,
+			Summary:     "Translate condition",
+			Description: "Translates a condition into the closest equivalent tcpdump-style BPF filter expression (as supported by capture filters) or vice versa, listing all parts of it which could only be approximated or not be translated at all",
+			Tags:        queryTags,
+		},
+		getConditionTranslationHandler(),
+	)
+
+	// dry-run in case the querier supports it
+	if dryRunner, ok := querier.(query.DryRunner); ok {
+		huma.Register(a,
+			huma.Operation{
+				OperationID: "query-post-dry-run",
+				Metadata:    auth.SupportProjection(),
+				Method:      http.MethodPost,
+				Path:        DryRunRoute,
+				Summary:     "Dry-run query",
+				Description: "Validates query parameters and estimates the cost of the query (interfaces, directories, blocks, bytes and flows read) from the DB metadata without running it",
+				Middlewares: middlewares,
+				Tags:        queryTags,
+			},
+			q.getBodyDryRunHandler(caller, dryRunner),
+		)
+	}
+
+	// JSON schemas of the query args and results, allowing clients to validate requests and to generate
+	// typed clients
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "schema-get-query-args",
+			Method:      http.MethodGet,
+			Path:        QueryArgsSchemaRoute,
+			Summary:     "Get query args schema",
+			Description: "Returns the self-contained JSON schema (draft 2020-12) of the query args, as accepted by the query endpoints",
+			Tags:        queryTags,
+		},
+		getSchemaHandler(queryArgsSchema),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "schema-get-query-result",
+			Method:      http.MethodGet,
+			Path:        QueryResultSchemaRoute,
+			Summary:     "Get query result schema",
+			Description: "Returns the self-contained JSON schema (draft 2020-12) of query results, as returned by the query endpoints",
+			Tags:        queryTags,
+		},
+		getSchemaHandler(queryResultSchema),
+	)
+
+	// retrieval of stored results
+	if q.resultStore != nil {
+		huma.Register(a,
+			huma.Operation{
+				OperationID: "query-get-stored-result",
+				Metadata:    auth.SupportProjection(),
+				Method:      http.MethodGet,
+				Path:        StoredResultsRoute + "/{token}",
+				Summary:     "Get stored query result",
+				Description: "Retrieves the result of a query run in the background (via the store parameter) by its token. While the query is still running, a result in pending state is returned with status 202",
+				Middlewares: middlewares,
+				Tags:        queryTags,
+			},
+			q.getStoredResultHandler(),
+		)
+		huma.Register(a,
+			huma.Operation{
+				OperationID: "query-download-stored-result",
+				Method:      http.MethodGet,
+				Path:        StoredResultsRoute + "/{token}/download",
+				Summary:     "Download stored query result",
+				Description: "Downloads the result of a query run in the background (via the store parameter) by its token as file, optionally as gzip archive. Range requests are supported, allowing to resume interrupted downloads of large results. While the query is still running, status 409 is returned",
+				Middlewares: middlewares,
+				Tags:        queryTags,
+			},
+			q.downloadStoredResultHandler(),
+		)
+	}
+
+	// Grafana JSON datasource
+	q.registerGrafanaAPI(a, caller, querier, middlewares)
+
 	// register routes specific to distributed querying
 	dqr, ok := querier.(*distributed.QueryRunner)
 	if ok {
-		registerDistributedQueryAPI(a, caller, dqr, middlewares)
+		q.registerDistributedQueryAPI(a, caller, dqr, middlewares)
 		return
 	}
 
@@ -49,34 +184,54 @@ func RegisterQueryAPI(a huma.API, caller string, querier query.Runner, middlewar
 	huma.Register(a,
 		huma.Operation{
 			OperationID: "query-post-run",
+			Metadata:    auth.SupportProjection(),
 			Method:      http.MethodPost,
 			Path:        QueryRoute,
 			Summary:     "Run query",
-			Description: "Runs a query based on the parameters provided in the body",
+			Description: "Runs a query based on the parameters provided in the body. If the result should be stored server-side, the query is run in the background and the URL to retrieve its result is returned via the Location header",
 			Middlewares: middlewares,
 			Tags:        queryTags,
 		},
-		getBodyQueryRunnerHandler(caller, querier),
+		q.getBodyQueryRunnerHandler(caller, querier),
 	)
+
+	// batch query running in case the querier supports it (e.g. goProbe's query endpoint)
+	if batcher, ok := querier.(query.BatchRunner); ok {
+		huma.Register(a,
+			huma.Operation{
+				OperationID: "query-post-run-batch",
+				Metadata:    auth.SupportProjection(),
+				Method:      http.MethodPost,
+				Path:        BatchQueryRoute,
+				Summary:     "Run batch of queries",
+				Description: "Runs multiple queries covering the same time range and interfaces in a single pass over the data, returning their results in the order of the queries",
+				Middlewares: middlewares,
+				Tags:        queryTags,
+			},
+			q.getBodyBatchRunnerHandler(caller, batcher),
+		)
+	}
 }
 
-func registerDistributedQueryAPI(a huma.API, caller string, qr *distributed.QueryRunner, middlewares huma.Middlewares) {
+func (q *queryAPI) registerDistributedQueryAPI(a huma.API, caller string, qr *distributed.QueryRunner, middlewares huma.Middlewares) {
 	// query running
 	huma.Register(a,
 		huma.Operation{
 			OperationID: "query-post-run",
+			Metadata:    auth.SupportProjection(),
 			Method:      http.MethodPost,
 			Path:        QueryRoute,
 			Summary:     "Run query",
-			Description: "Runs a query based on the parameters provided in the body",
+			Description: "Runs a query based on the parameters provided in the body. If the result should be stored server-side, the query is run in the background and the URL to retrieve its result is returned via the Location header",
 			Middlewares: middlewares,
 			Tags:        queryTags,
 		},
-		getBodyQueryRunnerHandler(caller, qr),
+		q.getBodyQueryRunnerHandler(caller, qr),
 	)
 	sse.Register(a,
 		huma.Operation{
 			OperationID: "query-post-run-sse",
+			Metadata:    auth.SupportProjection(),
 			Method:      http.MethodPost,
 			Path:        SSEQueryRoute,
 			Summary:     "Run query with server sent events (SSE)",
@@ -85,11 +240,24 @@ func registerDistributedQueryAPI(a huma.API, caller string, qr *distributed.Quer
 			Tags:        queryTags,
 		},
 		map[string]any{
+			string(StreamEventQueryStarted):  &QueryStarted{},
 			string(StreamEventQueryError):    &query.DetailError{},
 			string(StreamEventPartialResult): &PartialResult{},
 			string(StreamEventFinalResult):   &FinalResult{},
 		},
-		getSSEBodyQueryRunnerHandler(caller, qr),
+		q.getSSEBodyQueryRunnerHandler(caller, qr),
+	)
+	huma.Register(a,
+		huma.Operation{
+			OperationID: "query-get-checkpoint",
+			Method:      http.MethodGet,
+			Path:        CheckpointsRoute + "/{id}",
+			Summary:     "Get checkpointed query",
+			Description: "Re-attaches to a checkpointed query by its ID, returning its final result if it completed or the result aggregated across all hosts queried so far if it is still running",
+			Middlewares: middlewares,
+			Tags:        queryTags,
+		},
+		getCheckpointHandler(qr),
 	)
 }
 
@@ -98,6 +266,7 @@ type StreamEventType string
 
 // Different event types that the query server sends
 const (
+	StreamEventQueryStarted  StreamEventType = "queryStarted"
 	StreamEventQueryError    StreamEventType = "queryError"
 	StreamEventPartialResult StreamEventType = "partialResult"
 	StreamEventFinalResult   StreamEventType = "finalResult"
@@ -108,6 +277,21 @@ type ArgsInput struct {
 	Body *query.Args
 }
 
+// RunArgsInput stores the args of a query to be run in the body
+type RunArgsInput struct {
+	// Store: run the query in the background and store its result server-side
+	Store bool `query:"store" required:"false" doc:"Run the query in the background and store its result server-side for later retrieval via the URL returned in the Location header (if enabled)"`
+	// Detach: return the ID of the query as soon as it started, without waiting for its result
+	Detach bool `query:"detach" required:"false" doc:"Return as soon as the query has been started, providing the URL to re-attach to it via the Location header (requires checkpointing of distributed queries)"`
+
+	Body *query.Args
+}
+
+// BatchArgsInput stores the args of multiple queries to be run in a single pass
+type BatchArgsInput struct {
+	Body []*query.Args `minItems:"1"`
+}
+
 // ArgsParamsInput stores the query args to be validated in the query parameters
 type ArgsParamsInput struct {
 	// for get parameters
@@ -115,16 +299,62 @@ type ArgsParamsInput struct {
 	query.DNSResolution
 }
 
+// CheckpointInput stores the ID of the checkpointed query to re-attach to
+type CheckpointInput struct {
+	ID string `path:"id" doc:"ID of the query" minLength:"32" maxLength:"32" example:"5f0c6e2a9d7b4c1e8a3f2b6d9e0c4a7b"`
+}
+
+// CheckpointOutput stores the state of a checkpointed query
+type CheckpointOutput struct {
+	Body *distributed.Checkpoint
+}
+
+// StoredResultInput stores the token of the stored result to retrieve
+type StoredResultInput struct {
+	Token string `path:"token" doc:"Token of the stored result" minLength:"32" maxLength:"32" example:"9b2d4e6f8a0c1e3b5d7f9a1c3e5b7d9f"`
+}
+
+// DownloadStoredResultInput stores the token of the stored result to download (and the range to download)
+type DownloadStoredResultInput struct {
+	Token   string `path:"token" doc:"Token of the stored result" minLength:"32" maxLength:"32" example:"9b2d4e6f8a0c1e3b5d7f9a1c3e5b7d9f"`
+	Archive string `query:"archive" doc:"Archive format to download the result as (uncompressed JSON if empty)" enum:"gzip" required:"false"`
+	Range   string `header:"Range" doc:"Byte range to download (a single range is supported)" example:"bytes=1048576-"`
+	IfRange string `header:"If-Range" doc:"Entity tag the range applies to (the whole result is returned if it doesn't match)"`
+}
+
 // QueryResultOutput stores the result of a query
 type QueryResultOutput struct {
+	Status int
+	// Location: the URL to retrieve the result from (only set if it is stored server-side)
+	Location string `header:"Location" doc:"URL to retrieve the stored result from"`
+	// QueryID: the ID of the query, allowing to re-attach to it (only set for checkpointed queries)
+	QueryID string `header:"X-Goprobe-Query-Id" doc:"ID of the query, allowing to re-attach to it"`
+
 	Body *results.Result
 }
 
+// BatchResultOutput stores the results of multiple queries (in the order of the queries)
+type BatchResultOutput struct {
+	Body []*results.Result
+}
+
+// DryRunOutput stores the outcome of a query dry-run
+type DryRunOutput struct {
+	Body *results.DryRun
+}
+
 // PartialResult represents an update to the results structure. It SHOULD only be used if the
 // results.Result object will be further modified / aggregated. This data structure is relevant
 // only in the context of SSE
 type PartialResult struct{ *results.Result }
 
+// QueryStarted is sent as the first event of a checkpointed query, providing the ID which allows to
+// re-attach to it (e.g. if the connection drops before the final result is received). This data
+// structure is relevant only in the context of SSE
+type QueryStarted struct {
+	ID string `json:"query_id" doc:"ID of the query, allowing to re-attach to it" example:"5f0c6e2a9d7b4c1e8a3f2b6d9e0c4a7b"`
+}
+
 // FinalResult represents the result which is sent after all aggregation of partial results has
 // completed. It SHOULD only be sent at the end of a streaming operation. This data structure is relevant
 // only in the context of SSE
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// DefaultStoredResultsRetention denotes the default duration for which stored query results are
+	// retained after the query completed
+	DefaultStoredResultsRetention = 24 * time.Hour
+
+	// DefaultStoredResultsCleanupInterval denotes the default interval in which expired query results
+	// are evicted
+	DefaultStoredResultsCleanupInterval = time.Hour
+)
+
+const (
+	storedResultTokenLen       = 16
+	storedResultSuffix         = ".json"
+	storedArchiveSuffix        = ".json.gz"
+	storedResultPermissions    = 0o600
+	storedResultDirPermissions = 0o700
+)
+
+var (
+	// ErrStoredResultNotFound denotes that no stored result exists for a token (e.g. because it expired)
+	ErrStoredResultNotFound = errors.New("stored query result not found")
+
+	// ErrStoredResultPending denotes that the query of a stored result is still running
+	ErrStoredResultPending = errors.New("query is still running")
+)
+
+// ResultStore persists the (rendered) results of queries run in the background to disk. This allows
+// slow clients or e.g. email-based workflows to retrieve large results later on via a token instead of
+// keeping the connection open for the entire duration of the query
+type ResultStore struct {
+	dir       string
+	retention time.Duration
+
+	pending map[string]func() results.ResourceUsage // queries currently being run (and their resource usage, if reported)
+	sync.Mutex
+}
+
+// NewResultStore creates a new result store in dir. Results are evicted once retention has passed after
+// their query completed
+func NewResultStore(dir string, retention time.Duration) (*ResultStore, error) {
+	if err := os.MkdirAll(dir, storedResultDirPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create result store directory: %w", err)
+	}
+	if retention <= 0 {
+		retention = DefaultStoredResultsRetention
+	}
+	return &ResultStore{
+		dir:       dir,
+		retention: retention,
+		pending:   make(map[string]func() results.ResourceUsage),
+	}, nil
+}
+
+// Submit runs a query in the background and stores its result once it completes, returning the token
+// to retrieve the result with. The query is detached from the cancellation of ctx (but retains its
+// values, e.g. the logger), so that it outlives the request submitting it. Failed queries are stored
+// as result carrying the error
+func (s *ResultStore) Submit(ctx context.Context, run func(ctx context.Context) (*results.Result, error)) (string, error) {
+	token, err := newStoredResultToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.Lock()
+	s.pending[token] = nil
+	s.Unlock()
+
+	// track the resource usage of the query while it is running, so it can be reported as progress
+	ctx = query.WithResourceUsageFn(context.WithoutCancel(ctx), func(usage func() results.ResourceUsage) {
+		s.Lock()
+		if _, isPending := s.pending[token]; isPending {
+			s.pending[token] = usage
+		}
+		s.Unlock()
+	})
+	go func() {
+		defer s.release(token)
+
+		res, err := run(ctx)
+		if err != nil {
+			res = &results.Result{
+				Status: results.Status{
+					Code:    types.StatusError,
+					Message: err.Error(),
+				},
+			}
+		}
+		res.ID = token
+
+		if err := s.write(token, res); err != nil {
+			logs.FromContext(ctx, logs.ModuleAPI).With("token", token).Errorf("failed to store query result: %v", err)
+		}
+	}()
+
+	return token, nil
+}
+
+// Get returns the stored result of the query identified by token. If the query is still running, a
+// result in pending state is returned (carrying the current resource usage of the query, if available)
+func (s *ResultStore) Get(token string) (*results.Result, error) {
+	if !isStoredResultToken(token) {
+		return nil, ErrStoredResultNotFound
+	}
+
+	f, err := os.Open(filepath.Clean(s.path(token)))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read stored query result: %w", err)
+		}
+		usage, isPending := s.pendingUsage(token)
+		if !isPending {
+			return nil, ErrStoredResultNotFound
+		}
+		res := newPendingResult(token)
+		if usage != nil {
+			res.Summary.ResourceUsage = []results.ResourceUsage{usage()}
+		}
+		return res, nil
+	}
+	defer f.Close()
+
+	res := new(results.Result)
+	if err := jsoniter.NewDecoder(f).Decode(res); err != nil {
+		return nil, fmt.Errorf("failed to decode stored query result: %w", err)
+	}
+	return res, nil
+}
+
+// Open opens the (rendered) stored result of the query identified by token for download, optionally as
+// gzip archive (which is created upon its first download). ErrStoredResultPending is returned if the
+// query is still running. Since a stored result is never modified, the file can be served in chunks
+// (e.g. to resume an interrupted download)
+func (s *ResultStore) Open(token string, compressed bool) (*os.File, error) {
+	if !isStoredResultToken(token) {
+		return nil, ErrStoredResultNotFound
+	}
+
+	// the archive is only served as long as the result itself is retained
+	if _, err := os.Stat(s.path(token)); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read stored query result: %w", err)
+		}
+		if _, isPending := s.pendingUsage(token); isPending {
+			return nil, ErrStoredResultPending
+		}
+		return nil, ErrStoredResultNotFound
+	}
+	if !compressed {
+		return os.Open(filepath.Clean(s.path(token)))
+	}
+
+	f, err := os.Open(filepath.Clean(s.archivePath(token)))
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	if err := s.writeArchive(token); err != nil {
+		return nil, fmt.Errorf("failed to compress stored query result: %w", err)
+	}
+	return os.Open(filepath.Clean(s.archivePath(token)))
+}
+
+// Retention returns the duration for which results are retained after their query completed
+func (s *ResultStore) Retention() time.Duration {
+	return s.retention
+}
+
+// RunCleanup periodically evicts expired results until the context is cancelled
+func (s *ResultStore) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logs.FromContext(ctx, logs.ModuleAPI)
+	for {
+		if err := s.Cleanup(); err != nil {
+			logger.Errorf("failed to evict expired query results: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup evicts all results whose retention has passed (including leftovers of interrupted writes)
+func (s *ResultStore) Cleanup() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if time.Since(info.ModTime()) < s.retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// write atomically stores the result of the query identified by token
+func (s *ResultStore) write(token string, res *results.Result) error {
+	tempFile, err := os.CreateTemp(s.dir, ".tmp-"+token+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	if err = jsoniter.NewEncoder(tempFile).Encode(res); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), storedResultPermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), s.path(token))
+}
+
+// writeArchive atomically stores the gzip archive of the stored result of the query identified by token.
+// Concurrent downloads may each create the archive, the last one simply replacing an identical file
+func (s *ResultStore) writeArchive(token string) error {
+	src, err := os.Open(filepath.Clean(s.path(token)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tempFile, err := os.CreateTemp(s.dir, ".tmp-"+token+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	zw := gzip.NewWriter(tempFile)
+	if _, err = io.Copy(zw, src); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), storedResultPermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), s.archivePath(token))
+}
+
+func (s *ResultStore) path(token string) string {
+	return filepath.Join(s.dir, token+storedResultSuffix)
+}
+
+func (s *ResultStore) archivePath(token string) string {
+	return filepath.Join(s.dir, token+storedArchiveSuffix)
+}
+
+func (s *ResultStore) pendingUsage(token string) (func() results.ResourceUsage, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	usage, isPending := s.pending[token]
+	return usage, isPending
+}
+
+func (s *ResultStore) release(token string) {
+	s.Lock()
+	delete(s.pending, token)
+	s.Unlock()
+}
+
+// newPendingResult returns the placeholder result of a query which is still running
+func newPendingResult(token string) *results.Result {
+	return &results.Result{
+		ID: token,
+		Status: results.Status{
+			Code:    types.StatusPending,
+			Message: "query is still running",
+		},
+	}
+}
+
+func newStoredResultToken() (string, error) {
+	token := make([]byte, storedResultTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate result token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// isStoredResultToken checks if token is a valid result token (and hence safe to be used as part of a path)
+func isStoredResultToken(token string) bool {
+	raw, err := hex.DecodeString(token)
+	return err == nil && len(raw) == storedResultTokenLen
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewResultStore(dir, time.Hour)
+	require.Nil(t, err)
+
+	release := make(chan struct{})
+	token, err := store.Submit(context.Background(), func(_ context.Context) (*results.Result, error) {
+		<-release
+		return &results.Result{Hostname: "hostA", Status: results.Status{Code: types.StatusOK}}, nil
+	})
+	require.Nil(t, err)
+	require.True(t, isStoredResultToken(token))
+
+	res, err := store.Get(token)
+	require.Nil(t, err)
+	require.Equal(t, types.StatusPending, res.Status.Code)
+	require.Equal(t, token, res.ID)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		res, err = store.Get(token)
+		return err == nil && res.Status.Code != types.StatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "hostA", res.Hostname)
+	require.Equal(t, token, res.ID)
+
+	// unknown and invalid tokens are not found
+	for _, token := range []string{"00000000000000000000000000000000", "../../etc/passwd", ""} {
+		_, err = store.Get(token)
+		require.ErrorIs(t, err, ErrStoredResultNotFound)
+	}
+
+	// results are evicted once their retention has passed
+	require.Nil(t, store.Cleanup())
+	_, err = store.Get(token)
+	require.Nil(t, err)
+
+	expired := time.Now().Add(-2 * time.Hour)
+	require.Nil(t, os.Chtimes(filepath.Join(dir, token+storedResultSuffix), expired, expired))
+	require.Nil(t, store.Cleanup())
+	_, err = store.Get(token)
+	require.ErrorIs(t, err, ErrStoredResultNotFound)
+}
+
+func TestResultStoreOpen(t *testing.T) {
+	store, err := NewResultStore(t.TempDir(), time.Hour)
+	require.Nil(t, err)
+
+	release := make(chan struct{})
+	token, err := store.Submit(context.Background(), func(_ context.Context) (*results.Result, error) {
+		<-release
+		return &results.Result{Hostname: "hostA", Status: results.Status{Code: types.StatusOK}}, nil
+	})
+	require.Nil(t, err)
+
+	_, err = store.Open(token, false)
+	require.ErrorIs(t, err, ErrStoredResultPending)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		res, err := store.Get(token)
+		return err == nil && res.Status.Code != types.StatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+
+	f, err := store.Open(token, false)
+	require.Nil(t, err)
+	stored, err := io.ReadAll(f)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	// the archive is created upon its first download and reused afterwards
+	for i := 0; i < 2; i++ {
+		f, err = store.Open(token, true)
+		require.Nil(t, err)
+		zr, err := gzip.NewReader(f)
+		require.Nil(t, err)
+		decompressed, err := io.ReadAll(zr)
+		require.Nil(t, err)
+		require.Nil(t, f.Close())
+		require.Equal(t, stored, decompressed)
+	}
+
+	// the archive isn't served once the result expired
+	require.Nil(t, os.Remove(filepath.Join(store.dir, token+storedResultSuffix)))
+	_, err = store.Open(token, true)
+	require.ErrorIs(t, err, ErrStoredResultNotFound)
+
+	_, err = store.Open("../../etc/passwd", false)
+	require.ErrorIs(t, err, ErrStoredResultNotFound)
+}
+
+func TestResultStorePendingResourceUsage(t *testing.T) {
+	store, err := NewResultStore(t.TempDir(), time.Hour)
+	require.Nil(t, err)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	token, err := store.Submit(context.Background(), func(ctx context.Context) (*results.Result, error) {
+		query.ResourceUsageFn(ctx)(func() results.ResourceUsage {
+			return results.ResourceUsage{Hostname: "hostA", ProcessingUnits: 2, Goroutines: 3}
+		})
+		close(started)
+		<-release
+		return &results.Result{Hostname: "hostA", Status: results.Status{Code: types.StatusOK}}, nil
+	})
+	require.Nil(t, err)
+	<-started
+
+	res, err := store.Get(token)
+	require.Nil(t, err)
+	require.Equal(t, types.StatusPending, res.Status.Code)
+	require.Equal(t, []results.ResourceUsage{{Hostname: "hostA", ProcessingUnits: 2, Goroutines: 3}}, res.Summary.ResourceUsage)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		res, err = store.Get(token)
+		return err == nil && res.Status.Code != types.StatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, res.Summary.ResourceUsage)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+)
+
+const (
+	schemaDefsPrefix = "#/$defs/"
+	schemaDialect    = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// SchemaOutput stores a self-contained JSON schema document
+type SchemaOutput struct {
+	Body map[string]any
+}
+
+// jsonSchema generates the self-contained JSON schema document of the provided type (generated from its
+// huma annotations, i.e. identical to the schema referenced in the OpenAPI specification)
+func jsonSchema(t reflect.Type) map[string]any {
+	registry := huma.NewMapRegistry(schemaDefsPrefix, huma.DefaultSchemaNamer)
+	s := registry.Schema(t, true, "")
+
+	return map[string]any{
+		"$schema": schemaDialect,
+		"$ref":    s.Ref,
+		"$defs":   registry.Map(),
+	}
+}
+
+// the schemas are static, hence they are only generated once
+var (
+	queryArgsSchema   = sync.OnceValue(func() map[string]any { return jsonSchema(reflect.TypeOf(query.Args{})) })
+	queryResultSchema = sync.OnceValue(func() map[string]any { return jsonSchema(reflect.TypeOf(results.Result{})) })
+)
+
+// getSchemaHandler returns the handler serving a JSON schema document
+func getSchemaHandler(schema func() map[string]any) func(context.Context, *struct{}) (*SchemaOutput, error) {
+	return func(_ context.Context, _ *struct{}) (*SchemaOutput, error) {
+		return &SchemaOutput{Body: schema()}, nil
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaAPI(t *testing.T) {
+	_, a := humatest.New(t)
+	RegisterQueryAPI(a, "test", &grafanaTestRunner{}, nil)
+
+	for route, name := range map[string]string{
+		QueryArgsSchemaRoute:   "Args",
+		QueryResultSchemaRoute: "Result",
+	} {
+		resp := a.Get(route)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var doc struct {
+			Schema string                    `json:"$schema"`
+			Ref    string                    `json:"$ref"`
+			Defs   map[string]map[string]any `json:"$defs"`
+		}
+		require.Nil(t, jsoniter.Unmarshal(resp.Body.Bytes(), &doc))
+		require.Equal(t, schemaDialect, doc.Schema)
+		require.Equal(t, schemaDefsPrefix+name, doc.Ref)
+
+		// all referenced definitions are part of the document
+		require.Contains(t, doc.Defs, name)
+		require.Contains(t, doc.Defs[name], "properties")
+	}
+
+	resp := a.Get(QueryArgsSchemaRoute)
+	require.Contains(t, resp.Body.String(), `"condition"`)
+	require.Contains(t, resp.Body.String(), `"query"`)
+}
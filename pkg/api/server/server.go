@@ -12,6 +12,7 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humagin"
 	"github.com/els0r/goProbe/pkg/api"
+	"github.com/els0r/goProbe/pkg/api/auth"
 	"github.com/els0r/goProbe/pkg/goDB/info"
 	"github.com/els0r/goProbe/pkg/version"
 	"github.com/els0r/telemetry/metrics"
@@ -28,6 +29,9 @@ const (
 	RuntimeIDHeaderKey = "X-GOPROBE-RUNTIME-ID"
 
 	maxMultipartMemory = 32 << 20 // 32 MiB
+
+	metricsRoute   = "/metrics"     // default route of the Prometheus metrics
+	profilingRoute = "/debug/pprof" // default prefix of the profiling routes
 )
 
 // Option denotes a functional option fo a default server instance
@@ -37,8 +41,8 @@ type Option func(*DefaultServer)
 // re-used across binaries serving an API
 type DefaultServer struct {
 	// api handling
-	// TODO: authorize API access
-	keys []string
+	authProviders []auth.Provider
+	docsPaths     []string // paths of the API documentation (exempt from authentication)
 
 	debug bool
 
@@ -54,11 +58,20 @@ type DefaultServer struct {
 	// global rate limiting for queries
 	queryRateLimiter *rate.Limiter
 
+	// default deadline for queries
+	queryDeadline time.Duration
+
+	// server-side storage of query results
+	queryResultStore *api.ResultStore
+
+	healthChecks []api.HealthCheck
+
 	srv    *http.Server
 	router *gin.Engine
 	api    huma.API
+	apis   map[api.Version]huma.API
 
-	unixSocketFile string
+	listener net.Listener
 }
 
 // WithDebugMode runs the gin server in debug mode (e.g. not setting the release mode)
@@ -91,6 +104,15 @@ func WithTracing(enabled bool) Option {
 	}
 }
 
+// WithAuthProviders enables authentication of all calls using the providers, including the metrics and
+// profiling routes. Only the info routes and the API documentation (OpenAPI spec, docs and schemas) are
+// exempt. The first provider handling the authorization scheme presented by a caller is used
+func WithAuthProviders(providers ...auth.Provider) Option {
+	return func(server *DefaultServer) {
+		server.authProviders = append(server.authProviders, providers...)
+	}
+}
+
 // WithQueryRateLimit enables a global rate limit for query calls
 func WithQueryRateLimit(r rate.Limit, b int) Option {
 	return func(server *DefaultServer) {
@@ -100,6 +122,38 @@ func WithQueryRateLimit(r rate.Limit, b int) Option {
 	}
 }
 
+// WithQueryDeadline sets the default deadline for query calls not specifying one themselves
+func WithQueryDeadline(deadline time.Duration) Option {
+	return func(server *DefaultServer) {
+		if deadline > 0 {
+			server.queryDeadline = deadline
+		}
+	}
+}
+
+// WithQueryResultStore enables running queries in the background and storing their results in store
+// for later retrieval
+func WithQueryResultStore(store *api.ResultStore) Option {
+	return func(server *DefaultServer) {
+		server.queryResultStore = store
+	}
+}
+
+// WithHealthChecks adds checks which are evaluated on each call to the health endpoint
+func WithHealthChecks(checks ...api.HealthCheck) Option {
+	return func(server *DefaultServer) {
+		server.healthChecks = append(server.healthChecks, checks...)
+	}
+}
+
+// WithListener serves the API on an existing listener (e.g. one inherited from another process)
+// instead of listening on the server address
+func WithListener(listener net.Listener) Option {
+	return func(server *DefaultServer) {
+		server.listener = listener
+	}
+}
+
 // NewDefault creates a new API server
 func NewDefault(serviceName, addr string, opts ...Option) *DefaultServer {
 	s := &DefaultServer{
@@ -119,16 +173,15 @@ func NewDefault(serviceName, addr string, opts ...Option) *DefaultServer {
 	router.Use(gin.Recovery())
 	router.Use(cors.Default())
 
-	// make sure that unix sockets are handled if they are provided
-	s.unixSocketFile = api.ExtractUnixSocket(addr)
-
 	s.router = router
 	for _, opt := range opts {
 		opt(s)
 	}
 
 	// get a documented API
-	s.api = humagin.New(s.router, huma.DefaultConfig(serviceName, version.Short()))
+	cfg := apiConfig(serviceName, api.V1)
+	s.docsPaths = []string{cfg.OpenAPIPath, cfg.DocsPath, cfg.SchemasPath}
+	s.api = humagin.New(s.router, cfg)
 
 	// register info routes before any other middleware so they are exempt from logging
 	// and/or tracing
@@ -136,14 +189,33 @@ func NewDefault(serviceName, addr string, opts ...Option) *DefaultServer {
 
 	s.registerMiddlewares()
 
+	// set up the versioned APIs (must happen _after_ the middlewares have been registered so
+	// that the router groups inherit them)
+	s.registerVersionedAPIs()
+
 	return s
 }
 
-// API returns the huma API server which is used to register and document endpoints
+// API returns the huma API server which is used to register and document endpoints. It
+// corresponds to the (unprefixed) API version 1
 func (server *DefaultServer) API() huma.API {
 	return server.api
 }
 
+// VersionedAPI returns the huma API server which is used to register and document endpoints
+// for a specific API version (or nil if the version isn't served)
+func (server *DefaultServer) VersionedAPI(v api.Version) huma.API {
+	return server.apis[v]
+}
+
+// ForEachVersion calls fn for each served API version in ascending order. It allows
+// handlers to be shared across API versions
+func (server *DefaultServer) ForEachVersion(fn func(v api.Version, a huma.API)) {
+	for _, v := range api.Versions {
+		fn(v, server.apis[v])
+	}
+}
+
 // WriteOpenAPISpec writes the full OpenAPI spec to the writer w. It implements the
 // OpenAPISpecWriter interface
 func (server *DefaultServer) WriteOpenAPISpec(w io.Writer) error {
@@ -155,17 +227,77 @@ func (server *DefaultServer) WriteOpenAPISpec(w io.Writer) error {
 	return err
 }
 
+// WriteVersionedOpenAPISpec writes the OpenAPI spec of a specific API version to the writer w. It
+// implements the VersionedOpenAPISpecWriter interface
+func (server *DefaultServer) WriteVersionedOpenAPISpec(w io.Writer, v api.Version) error {
+	a, exists := server.apis[v]
+	if !exists {
+		return fmt.Errorf("API version %s not served", v)
+	}
+	b, err := a.OpenAPI().DowngradeYAML()
+	if err != nil {
+		return fmt.Errorf("failed to generate OpenAPI spec for API %s: %w", v, err)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// QueryDeadline returns the default deadline for queries (zero if none is set)
+func (server *DefaultServer) QueryDeadline() time.Duration {
+	return server.queryDeadline
+}
+
+// QueryResultStore returns the store for query results (nil if storing of results is disabled)
+func (server *DefaultServer) QueryResultStore() *api.ResultStore {
+	return server.queryResultStore
+}
+
 // QueryRateLimiter returns the global rate limiter, if enabled (if not it return nil and false)
 func (server *DefaultServer) QueryRateLimiter() (*rate.Limiter, bool) {
 	return server.queryRateLimiter, server.queryRateLimiter != nil
 }
 
 func (server *DefaultServer) registerInfoRoutes() {
-	huma.Register(server.api, api.GetHealthOperation(), api.GetHealthHandler())
+	huma.Register(server.api, api.GetHealthOperation(), api.GetHealthHandler(server.healthChecks...))
 	huma.Register(server.api, api.GetInfoOperation(), api.GetServiceInfoHandler(server.serviceName))
 	huma.Register(server.api, api.GetReadyOperation(), api.GetReadyHandler())
 }
 
+// apiConfig returns the huma configuration for API version v. In addition to the default formats,
+// responses are rendered for the vendor media type of the version (so that clients negotiating the
+// version via their Accept header receive a response stating it as content type)
+func apiConfig(title string, v api.Version) huma.Config {
+	cfg := huma.DefaultConfig(title, version.Short())
+
+	formats := make(map[string]huma.Format, len(cfg.Formats)+1)
+	for contentType, format := range cfg.Formats {
+		formats[contentType] = format
+	}
+	formats[v.MediaType()] = huma.DefaultJSONFormat
+	cfg.Formats = formats
+
+	return cfg
+}
+
+func (server *DefaultServer) registerVersionedAPIs() {
+	server.apis = make(map[api.Version]huma.API, len(api.Versions))
+	for _, v := range api.Versions {
+		a := server.api
+		if v.Prefix() != "" {
+			cfg := apiConfig(server.api.OpenAPI().Info.Title, v)
+			cfg.Servers = []*huma.Server{{URL: v.Prefix()}}
+
+			a = humagin.NewWithGroup(server.router, server.router.Group(v.Prefix()), cfg)
+		}
+		a.UseMiddleware(api.VersionMiddleware(v))
+		if len(server.authProviders) > 0 {
+			a.UseMiddleware(api.AuthorizationMiddleware(a))
+		}
+
+		server.apis[v] = a
+	}
+}
+
 func (server *DefaultServer) registerMiddlewares() {
 	var middlewares []gin.HandlerFunc
 	if server.tracing {
@@ -192,6 +324,12 @@ func (server *DefaultServer) registerMiddlewares() {
 		api.RequestLoggingMiddleware(),
 		api.RecursionDetectorMiddleware(RuntimeIDHeaderKey, info.RuntimeID()),
 	)
+	if len(server.authProviders) > 0 {
+		middlewares = append(middlewares,
+			api.AuthenticationMiddleware(server.isPublic, server.authProviders...),
+			api.ProjectionMiddleware(isUnprojected),
+		)
+	}
 
 	server.router.Use(middlewares...)
 
@@ -211,25 +349,93 @@ func (server *DefaultServer) registerMiddlewares() {
 
 const headerTimeout = 30 * time.Second
 
+// Handler returns the HTTP handler serving all routes, selecting the API version requested via
+// content negotiation (see api.VersionNegotiationHandler)
+func (server *DefaultServer) Handler() http.Handler {
+	return api.VersionNegotiationHandler(server.router.Handler(), server.serves)
+}
+
+// isUnprojected returns whether the path is served by a route not removing attributes invisible to
+// callers restricted by a projection (i.e. metrics and profiling)
+func isUnprojected(path string) bool {
+	return path == metricsRoute || strings.HasPrefix(path, profilingRoute)
+}
+
+// isPublic states whether path is accessible without authentication, which is the case for the info
+// routes and the API documentation of all versions
+func (server *DefaultServer) isPublic(path string) bool {
+	for _, route := range []string{api.InfoRoute, api.HealthRoute, api.ReadyRoute} {
+		if path == route || path == "/-"+route {
+			return true
+		}
+	}
+
+	path = strings.TrimPrefix(path, api.VersionFromPath(path).Prefix())
+	for _, docsPath := range server.docsPaths {
+		if docsPath != "" && strings.HasPrefix(path, docsPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// serves states whether the (unprefixed) path is served by API version v
+func (server *DefaultServer) serves(v api.Version, path string) bool {
+	a, exists := server.apis[v]
+	if !exists {
+		return false
+	}
+	for template := range a.OpenAPI().Paths {
+		if matchesPathTemplate(template, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPathTemplate states whether path matches an OpenAPI path template (e.g. "/_query/results/{token}")
+func matchesPathTemplate(template, path string) bool {
+	templateSegments, pathSegments := strings.Split(template, "/"), strings.Split(path, "/")
+	if len(templateSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range templateSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && pathSegments[i] != "" {
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Serve starts the API server after adding additional (optional) routes
 func (server *DefaultServer) Serve() error {
 	server.srv = &http.Server{
-		Handler:           server.router.Handler(),
+		Handler:           server.Handler(),
 		ReadHeaderTimeout: headerTimeout,
 	}
 
-	// listen on UNIX socket
-	if server.unixSocketFile != "" {
-		listener, err := net.Listen("unix", server.unixSocketFile)
-		if err != nil {
+	listener := server.listener
+	if listener == nil {
+		var err error
+		if listener, err = Listen(server.addr); err != nil {
 			return err
 		}
-		return server.srv.Serve(listener)
 	}
+	return server.srv.Serve(listener)
+}
 
-	// listen on address
-	server.srv.Addr = server.addr
-	return server.srv.ListenAndServe()
+// Listen listens on the provided address, which may either denote a TCP address or a UNIX socket
+func Listen(addr string) (net.Listener, error) {
+	if unixSocketFile := api.ExtractUnixSocket(addr); unixSocketFile != "" {
+		return net.Listen("unix", unixSocketFile)
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+	return net.Listen("tcp", addr)
 }
 
 // Shutdown shuts down the API server
@@ -2,9 +2,29 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/els0r/goProbe/pkg/api"
+	"github.com/els0r/goProbe/pkg/api/auth"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 )
 
 func TestGenerateOpenAPISpec(t *testing.T) {
@@ -14,3 +34,467 @@ func TestGenerateOpenAPISpec(t *testing.T) {
 	err := s.WriteOpenAPISpec(buf)
 	require.Nil(t, err)
 }
+
+func TestVersionedAPIs(t *testing.T) {
+	s := NewDefault("test", "localhost:8146")
+
+	type pingOutput struct {
+		Body struct {
+			Version string `json:"version"`
+		}
+	}
+	s.ForEachVersion(func(v api.Version, a huma.API) {
+		require.NotNil(t, a)
+		huma.Register(a, huma.Operation{
+			OperationID: "get-ping",
+			Method:      http.MethodGet,
+			Path:        "/ping",
+		}, func(_ context.Context, _ *struct{}) (*pingOutput, error) {
+			out := &pingOutput{}
+			out.Body.Version = v.String()
+			return out, nil
+		})
+	})
+
+	var tests = []struct {
+		path        string
+		version     string
+		deprecation string
+		link        string
+	}{
+		{"/ping", "v1", "true", `</api/v2>; rel="successor-version"`},
+		{"/api/v2/ping", "v2", "", ""},
+		{api.HealthRoute, "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, test.version, rec.Header().Get(api.VersionHeaderKey))
+			require.Equal(t, test.deprecation, rec.Header().Get("Deprecation"))
+			if test.link != "" {
+				require.Contains(t, rec.Header().Values("Link"), test.link)
+			} else {
+				require.NotContains(t, rec.Header().Values("Link"), `</api/v2>; rel="successor-version"`)
+			}
+			if test.version != "" {
+				require.Contains(t, rec.Body.String(), test.version)
+			}
+		})
+	}
+
+	// the version can be negotiated via the Accept header instead of the path prefix
+	for _, test := range []struct {
+		path        string
+		accept      string
+		code        int
+		version     string
+		contentType string
+	}{
+		{"/ping", api.V2.MediaType(), http.StatusOK, "v2", api.V2.MediaType()},
+		{"/ping", api.V1.MediaType(), http.StatusOK, "v1", api.V1.MediaType()},
+		{"/ping", "application/json", http.StatusOK, "v1", "application/json"},
+		{"/api/v2/ping", api.V2.MediaType(), http.StatusOK, "v2", api.V2.MediaType()},
+		{"/api/v2/ping", api.V1.MediaType(), http.StatusNotAcceptable, "", "application/problem+json"},
+		{"/ping", "application/vnd.goprobe.v9+json", http.StatusNotAcceptable, "", "application/problem+json"},
+		{api.HealthRoute, api.V2.MediaType(), http.StatusOK, "", "application/json"},
+	} {
+		t.Run(test.path+" "+test.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Header.Set("Accept", test.accept)
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+
+			require.Equal(t, test.code, rec.Code)
+			require.Equal(t, test.version, rec.Header().Get(api.VersionHeaderKey))
+			require.Equal(t, test.contentType, rec.Header().Get("Content-Type"))
+			if test.version != "" {
+				require.Contains(t, rec.Body.String(), test.version)
+				require.Contains(t, rec.Header().Values("Vary"), "Accept")
+			}
+		})
+	}
+
+	// each version has its own OpenAPI spec
+	for _, v := range api.Versions {
+		buf := &bytes.Buffer{}
+		require.Nil(t, s.WriteVersionedOpenAPISpec(buf, v))
+		require.Contains(t, buf.String(), "/ping")
+	}
+	require.NotNil(t, s.WriteVersionedOpenAPISpec(&bytes.Buffer{}, api.VersionUnknown))
+}
+
+func TestGenerateVersionedSpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spec.yaml")
+	require.Nil(t, GenerateSpec(context.Background(), path, NewDefault("test", "localhost:8146")))
+
+	for _, specPath := range []string{path, filepath.Join(filepath.Dir(path), "spec.v2.yaml")} {
+		_, err := os.Stat(specPath)
+		require.Nil(t, err)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	var warnings []string
+	s := NewDefault("test", "localhost:8146", WithHealthChecks(func(_ context.Context) []string {
+		return warnings
+	}))
+
+	for _, test := range []struct {
+		warnings []string
+		expected string
+	}{
+		{nil, `"status":"healthy"`},
+		{[]string{"writeouts congested"}, `"status":"warning","warnings":["writeouts congested"]`},
+	} {
+		warnings = test.warnings
+
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, api.HealthRoute, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), test.expected)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	const key = "a3c9e2f1b0d84e7a9c1f2e3d4b5a6978"
+
+	s := NewDefault("test", "localhost:8146", WithProfiling(true), WithAuthProviders(auth.NewKeyProvider(key), readOnlyProvider{}))
+	for _, op := range []huma.Operation{
+		{OperationID: "get-ping", Method: http.MethodGet, Path: "/ping"},
+		{OperationID: "put-ping", Method: http.MethodPut, Path: "/ping", Metadata: auth.RequireRole(auth.RoleAdmin)},
+	} {
+		huma.Register(s.API(), op, func(_ context.Context, _ *struct{}) (*struct{}, error) {
+			return nil, nil
+		})
+	}
+
+	var tests = []struct {
+		method        string
+		path          string
+		authorization string
+		expected      int
+	}{
+		{http.MethodGet, api.HealthRoute, "", http.StatusOK},
+		{http.MethodGet, "/openapi.yaml", "", http.StatusOK},
+		{http.MethodGet, "/api/v2/openapi.yaml", "", http.StatusOK},
+		{http.MethodGet, "/debug/pprof/cmdline", "", http.StatusUnauthorized},
+		{http.MethodGet, "/debug/pprof/cmdline", "Bearer token", http.StatusOK},
+		{http.MethodGet, "/api/v2/_query/results/00000000000000000000000000000000", "", http.StatusUnauthorized},
+		{http.MethodGet, "/ping", "", http.StatusUnauthorized},
+		{http.MethodGet, "/ping", "Digest invalid", http.StatusUnauthorized},
+		{http.MethodGet, "/ping", "Basic " + key, http.StatusUnauthorized},
+		{http.MethodGet, "/ping", "Digest " + key, http.StatusNoContent},
+		{http.MethodPut, "/ping", "Digest " + key, http.StatusNoContent},
+		{http.MethodGet, "/ping", "Bearer token", http.StatusNoContent},
+		{http.MethodPut, "/ping", "Bearer token", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path+" "+test.authorization, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+
+			require.Equal(t, test.expected, rec.Code)
+		})
+	}
+}
+
+// staticQuerier returns the same result for all queries
+type staticQuerier struct {
+	result *results.Result
+}
+
+func (s staticQuerier) Run(_ context.Context, _ *query.Args) (*results.Result, error) {
+	return s.result.Clone(), nil
+}
+
+func TestProjection(t *testing.T) {
+	const (
+		key          = "a3c9e2f1b0d84e7a9c1f2e3d4b5a6978"
+		projectedKey = "f0e1d2c3b4a5968778695a4b3c2d1e0f"
+	)
+
+	provider := auth.NewKeyProvider(key).WithProjectedKeys(auth.NewProjection("app-team", types.DportName, types.ProtoName), projectedKey)
+	s := NewDefault("test", "localhost:8146", WithProfiling(true), WithAuthProviders(provider))
+	huma.Register(s.API(), huma.Operation{OperationID: "get-ping", Method: http.MethodGet, Path: "/ping"},
+		func(_ context.Context, _ *struct{}) (*struct{}, error) {
+			return nil, nil
+		})
+
+	querier := staticQuerier{&results.Result{
+		Status: results.Status{Code: types.StatusOK},
+		Query:  results.Query{Attributes: []string{types.SIPName, types.DportName}},
+		Rows: results.Rows{
+			{Attributes: results.Attributes{SrcIP: netip.MustParseAddr("10.0.0.1"), DstPort: 443}, Counters: types.Counters{BytesRcvd: 1}},
+			{Attributes: results.Attributes{SrcIP: netip.MustParseAddr("10.0.0.2"), DstPort: 443}, Counters: types.Counters{BytesRcvd: 2}},
+		},
+	}}
+	s.ForEachVersion(func(_ api.Version, a huma.API) {
+		api.RegisterQueryAPI(a, "test", querier, nil)
+	})
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Digest "+key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var tests = []struct {
+		name     string
+		method   string
+		path     string
+		key      string
+		body     string
+		expected int
+	}{
+		{"unprojected query", http.MethodPost, api.QueryRoute, key, `{"query": "sip,dport", "ifaces": "eth0"}`, http.StatusOK},
+		{"hidden attribute", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "sip,dport", "ifaces": "eth0"}`, http.StatusForbidden},
+		{"hidden attribute alias", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "talk_conv", "ifaces": "eth0"}`, http.StatusForbidden},
+		{"hidden label", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "dport,iface", "ifaces": "eth0"}`, http.StatusForbidden},
+		{"hidden condition attribute", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "dport", "ifaces": "eth0", "condition": "snet = 10.0.0.0/8"}`, http.StatusForbidden},
+		{"hidden tag filter", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "dport", "ifaces": "eth0", "tags": "voip"}`, http.StatusForbidden},
+		{"hidden zone filter", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "dport", "ifaces": "eth0", "zones": "dmz"}`, http.StatusForbidden},
+		{"visible attributes", http.MethodPost, api.QueryRoute, projectedKey, `{"query": "dport,proto", "ifaces": "eth0", "condition": "dport = 443"}`, http.StatusOK},
+		{"unsupported operation", http.MethodGet, "/ping", projectedKey, "", http.StatusForbidden},
+		{"profiling", http.MethodGet, "/debug/pprof/cmdline", projectedKey, "", http.StatusForbidden},
+		{"unprojected profiling", http.MethodGet, "/debug/pprof/cmdline", key, "", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := do(test.method, test.path, test.key, test.body)
+			require.Equal(t, test.expected, rec.Code, rec.Body.String())
+		})
+	}
+
+	// attributes not visible are removed from the result even if the querier returns them
+	rec := do(http.MethodPost, api.QueryRoute, projectedKey, `{"query": "dport", "ifaces": "eth0"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	res := new(results.Result)
+	require.Nil(t, jsoniter.Unmarshal(rec.Body.Bytes(), res))
+	require.Equal(t, []string{types.DportName}, res.Query.Attributes)
+	require.Equal(t, results.Rows{
+		{Attributes: results.Attributes{DstPort: 443}, Counters: types.Counters{BytesRcvd: 3}},
+	}, res.Rows)
+}
+
+// readOnlyProvider grants read-only permissions to all bearer tokens
+type readOnlyProvider struct{}
+
+func (readOnlyProvider) Authenticate(_ context.Context, scheme, _ string) (auth.Identity, error) {
+	if scheme != auth.SchemeBearer {
+		return auth.Identity{}, auth.ErrUnsupportedScheme
+	}
+	return auth.Identity{Subject: "test", Role: auth.RoleReadOnly}, nil
+}
+
+type blockingQuerier struct {
+	release chan struct{}
+}
+
+func (b *blockingQuerier) Run(ctx context.Context, args *query.Args) (*results.Result, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.release:
+	}
+	if args.Query != "sip" {
+		return nil, errors.New("unexpected query")
+	}
+	return &results.Result{Hostname: "hostA", Status: results.Status{Code: types.StatusOK}}, nil
+}
+
+func TestStoredQueryResults(t *testing.T) {
+	store, err := api.NewResultStore(t.TempDir(), time.Minute)
+	require.Nil(t, err)
+
+	querier := &blockingQuerier{release: make(chan struct{})}
+	s := NewDefault("test", "localhost:8146", WithQueryResultStore(store))
+	s.ForEachVersion(func(_ api.Version, a huma.API) {
+		api.RegisterQueryAPI(a, "test", querier, nil, api.WithResultStore(s.QueryResultStore()))
+	})
+
+	get := func(path string) (int, *results.Result) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		res := new(results.Result)
+		if rec.Code < http.StatusBadRequest {
+			require.Nil(t, jsoniter.Unmarshal(rec.Body.Bytes(), res))
+		}
+		return rec.Code, res
+	}
+
+	for _, test := range []struct {
+		name      string
+		query     string
+		available types.Status
+	}{
+		{"successful query", "sip", types.StatusOK},
+		{"failed query", "dip", types.StatusError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v2"+api.QueryRoute+"?store=true",
+				strings.NewReader(`{"query": "`+test.query+`", "ifaces": "eth0"}`)))
+			require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+			res := new(results.Result)
+			require.Nil(t, jsoniter.Unmarshal(rec.Body.Bytes(), res))
+			require.Equal(t, types.StatusPending, res.Status.Code)
+
+			location := rec.Header().Get("Location")
+			require.Equal(t, "/api/v2"+api.StoredResultsRoute+"/"+res.ID, location)
+
+			// the result is pending until the query completes
+			code, res := get(location)
+			require.Equal(t, http.StatusAccepted, code)
+			require.Equal(t, types.StatusPending, res.Status.Code)
+
+			querier.release <- struct{}{}
+			require.Eventually(t, func() bool {
+				code, res = get(location)
+				return code == http.StatusOK
+			}, 5*time.Second, 10*time.Millisecond)
+			require.Equal(t, test.available, res.Status.Code)
+
+			// results can be retrieved via all API versions
+			code, _ = get(api.StoredResultsRoute + "/" + res.ID)
+			require.Equal(t, http.StatusOK, code)
+		})
+	}
+
+	// unknown / expired results are not found
+	code, _ := get("/api/v2" + api.StoredResultsRoute + "/00000000000000000000000000000000")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestStoredQueryResultDownload(t *testing.T) {
+	store, err := api.NewResultStore(t.TempDir(), time.Minute)
+	require.Nil(t, err)
+
+	querier := &blockingQuerier{release: make(chan struct{})}
+	s := NewDefault("test", "localhost:8146", WithQueryResultStore(store))
+	s.ForEachVersion(func(_ api.Version, a huma.API) {
+		api.RegisterQueryAPI(a, "test", querier, nil, api.WithResultStore(s.QueryResultStore()))
+	})
+
+	download := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v2"+api.QueryRoute+"?store=true",
+		strings.NewReader(`{"query": "sip", "ifaces": "eth0"}`)))
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	path := rec.Header().Get("Location") + "/download"
+
+	// the result can't be downloaded until the query completes
+	require.Equal(t, http.StatusConflict, download(path, nil).Code)
+
+	querier.release <- struct{}{}
+	require.Eventually(t, func() bool {
+		rec = download(path, nil)
+		return rec.Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	full := rec.Body.Bytes()
+	res := new(results.Result)
+	require.Nil(t, jsoniter.Unmarshal(full, res))
+	require.Equal(t, "hostA", res.Hostname)
+	require.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	t.Run("resume", func(t *testing.T) {
+		rec := download(path, map[string]string{"Range": "bytes=10-"})
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		require.Equal(t, full[10:], rec.Body.Bytes())
+		require.Equal(t, fmt.Sprintf("bytes 10-%d/%d", len(full)-1, len(full)), rec.Header().Get("Content-Range"))
+
+		// the range only applies if the result is the one the download was started for
+		rec = download(path, map[string]string{"Range": "bytes=10-", "If-Range": etag})
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		rec = download(path, map[string]string{"Range": "bytes=10-", "If-Range": `"other"`})
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, full, rec.Body.Bytes())
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		rec := download(path, map[string]string{"Range": fmt.Sprintf("bytes=%d-", len(full))})
+		require.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+		require.Equal(t, fmt.Sprintf("bytes */%d", len(full)), rec.Header().Get("Content-Range"))
+	})
+
+	t.Run("gzip archive", func(t *testing.T) {
+		rec := download(path+"?archive=gzip", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "application/gzip", rec.Header().Get("Content-Type"))
+		archive := rec.Body.Bytes()
+
+		// the archive is downloaded in chunks
+		rec = download(path+"?archive=gzip", map[string]string{"Range": "bytes=0-9"})
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		chunked := append([]byte{}, rec.Body.Bytes()...)
+		rec = download(path+"?archive=gzip", map[string]string{"Range": "bytes=10-"})
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		chunked = append(chunked, rec.Body.Bytes()...)
+		require.Equal(t, archive, chunked)
+
+		zr, err := gzip.NewReader(bytes.NewReader(archive))
+		require.Nil(t, err)
+		decompressed, err := io.ReadAll(zr)
+		require.Nil(t, err)
+		require.Equal(t, full, decompressed)
+	})
+
+	require.Equal(t, http.StatusNotFound, download("/api/v2"+api.StoredResultsRoute+"/00000000000000000000000000000000/download", nil).Code)
+}
+
+func TestStoredQueryResultsDisabled(t *testing.T) {
+	s := NewDefault("test", "localhost:8146")
+	s.ForEachVersion(func(_ api.Version, a huma.API) {
+		api.RegisterQueryAPI(a, "test", &blockingQuerier{}, nil, api.WithResultStore(s.QueryResultStore()))
+	})
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v2"+api.QueryRoute+"?store=true",
+		strings.NewReader(`{"query": "sip", "ifaces": "eth0"}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// detaching requires a checkpointing distributed querier
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v2"+api.QueryRoute+"?detach=true",
+		strings.NewReader(`{"query": "sip", "ifaces": "eth0"}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestStoredQueryResultsRateLimited(t *testing.T) {
+	store, err := api.NewResultStore(t.TempDir(), time.Minute)
+	require.Nil(t, err)
+
+	// retrieving stored results is subject to the same middlewares as running queries
+	s := NewDefault("test", "localhost:8146", WithQueryResultStore(store))
+	s.ForEachVersion(func(_ api.Version, a huma.API) {
+		api.RegisterQueryAPI(a, "test", &blockingQuerier{}, huma.Middlewares{api.RateLimitMiddleware(rate.NewLimiter(0, 0))},
+			api.WithResultStore(s.QueryResultStore()))
+	})
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2"+api.StoredResultsRoute+"/00000000000000000000000000000000", nil))
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
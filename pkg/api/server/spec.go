@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/els0r/telemetry/logging"
+	"github.com/els0r/goProbe/pkg/api"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 )
 
 // OpenAPISpecWriter can be implemented by any server able to produce an OpenAPI spec
@@ -15,20 +18,61 @@ type OpenAPISpecWriter interface {
 	WriteOpenAPISpec(w io.Writer) error
 }
 
-// GenerateSpec writes the OpenAPI spec to a file
+// VersionedOpenAPISpecWriter can be implemented by any server able to produce an OpenAPI spec
+// for each of the API versions it serves
+type VersionedOpenAPISpecWriter interface {
+	WriteVersionedOpenAPISpec(w io.Writer, v api.Version) error
+}
+
+// GenerateSpec writes the OpenAPI spec to a file. If the server implements VersionedOpenAPISpecWriter,
+// the specs of all prefixed API versions are written alongside it, with the version appended to
+// the file name (e.g. spec.yaml -> spec.v2.yaml)
 func GenerateSpec(ctx context.Context, path string, ow OpenAPISpecWriter) error {
 	if path == "" {
 		return nil
 	}
-	logger := logging.FromContext(ctx).With("path", path)
+	logger := logs.FromContext(ctx, logs.ModuleAPI).With("path", path)
 
 	logger.Info("writing OpenAPI spec only")
+	if err := writeSpec(path, ow.WriteOpenAPISpec); err != nil {
+		return err
+	}
+
+	vow, ok := ow.(VersionedOpenAPISpecWriter)
+	if !ok {
+		return nil
+	}
+	for _, v := range api.Versions {
+		if v.Prefix() == "" {
+			continue
+		}
+		versionedPath := VersionedSpecPath(path, v)
+
+		logs.FromContext(ctx, logs.ModuleAPI).With("path", versionedPath, "version", v.String()).Info("writing versioned OpenAPI spec")
+		if err := writeSpec(versionedPath, func(w io.Writer) error {
+			return vow.WriteVersionedOpenAPISpec(w, v)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VersionedSpecPath returns the path of the OpenAPI spec file for API version v, derived
+// from the path of the main spec file
+func VersionedSpecPath(path string, v api.Version) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + v.String() + ext
+}
+
+func writeSpec(path string, write func(w io.Writer) error) error {
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	err = ow.WriteOpenAPISpec(f)
+	err = write(f)
 	if err != nil {
 		return fmt.Errorf("failed to write OpenAPI spec to %s: %w", path, err)
 	}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version denotes a version of the goProbe / global-query API
+type Version int
+
+// Supported API versions. V1 is served without a path prefix for compatibility with
+// deployed clients and is deprecated in favor of the prefixed successor versions
+const (
+	VersionUnknown Version = iota
+	V1
+	V2
+
+	// LatestVersion denotes the most recent API version
+	LatestVersion = V2
+)
+
+// Versions lists all API versions served, in ascending order
+var Versions = []Version{V1, V2}
+
+const (
+	versionPrefix = "/api/"
+
+	mediaTypePrefix = "application/vnd.goprobe."
+	mediaTypeSuffix = "+json"
+
+	// VersionHeaderKey denotes the header name / key which states the API version that
+	// handled a request
+	VersionHeaderKey = "X-GOPROBE-API-VERSION"
+)
+
+// String returns a string representation of the API version, e.g. "v2"
+func (v Version) String() string {
+	if v == VersionUnknown {
+		return "unknown"
+	}
+	return fmt.Sprintf("v%d", int(v))
+}
+
+// Prefix returns the route prefix under which the API version is served, e.g. "/api/v2".
+// V1 is served at the root for backwards compatibility and hence has an empty prefix
+func (v Version) Prefix() string {
+	if v <= V1 {
+		return ""
+	}
+	return versionPrefix + v.String()
+}
+
+// Deprecated states whether the API version is deprecated (i.e. superseded by a newer version)
+func (v Version) Deprecated() bool {
+	return v < LatestVersion
+}
+
+// Successor returns the API version that supersedes v. The latest version has no successor,
+// in which case it is returned itself
+func (v Version) Successor() Version {
+	if v >= LatestVersion {
+		return LatestVersion
+	}
+	return v + 1
+}
+
+// MediaType returns the (vendor) media type by which clients can request API version v via
+// content negotiation, e.g. "application/vnd.goprobe.v2+json"
+func (v Version) MediaType() string {
+	return mediaTypePrefix + v.String() + mediaTypeSuffix
+}
+
+// Route returns the full route / URI path of an endpoint served by API version v
+func (v Version) Route(route string) string {
+	return v.Prefix() + route
+}
+
+// VersionFromString parses an API version from a string (e.g. "v2" or "2")
+func VersionFromString(s string) Version {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "v"))
+	if err != nil {
+		return VersionUnknown
+	}
+	for _, v := range Versions {
+		if int(v) == n {
+			return v
+		}
+	}
+	return VersionUnknown
+}
+
+// VersionFromPath returns the API version serving the URI path (V1 for unprefixed paths)
+func VersionFromPath(path string) Version {
+	if !strings.HasPrefix(path, versionPrefix) {
+		return V1
+	}
+	version, _, _ := strings.Cut(strings.TrimPrefix(path, versionPrefix), "/")
+	if v := VersionFromString(version); v.Prefix() != "" {
+		return v
+	}
+	return V1
+}
+
+// VersionFromAccept extracts the API version requested via a vendor media type (see MediaType) in
+// an Accept header. If no such media type is present, false is returned. Unsupported versions are
+// reported as VersionUnknown
+func VersionFromAccept(accept string) (Version, bool) {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if !strings.HasPrefix(mediaType, mediaTypePrefix) || !strings.HasSuffix(mediaType, mediaTypeSuffix) {
+			continue
+		}
+		return VersionFromString(strings.TrimSuffix(strings.TrimPrefix(mediaType, mediaTypePrefix), mediaTypeSuffix)), true
+	}
+	return VersionUnknown, false
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersion(t *testing.T) {
+	require.Equal(t, "", V1.Prefix())
+	require.Equal(t, "/api/v2", V2.Prefix())
+	require.Equal(t, "/api/v2/_query", V2.Route(QueryRoute))
+	require.Equal(t, QueryRoute, V1.Route(QueryRoute))
+
+	require.True(t, V1.Deprecated())
+	require.False(t, LatestVersion.Deprecated())
+	require.Equal(t, V2, V1.Successor())
+	require.Equal(t, LatestVersion, LatestVersion.Successor())
+
+	for _, v := range Versions {
+		require.Equal(t, v, VersionFromString(v.String()))
+	}
+	require.Equal(t, V2, VersionFromString("2"))
+	require.Equal(t, VersionUnknown, VersionFromString("v0"))
+	require.Equal(t, VersionUnknown, VersionFromString("latest"))
+
+	require.Equal(t, V1, VersionFromPath("/_query"))
+	require.Equal(t, V2, VersionFromPath("/api/v2/_query"))
+	require.Equal(t, V1, VersionFromPath("/api/v9/_query"))
+}
+
+func TestVersionFromAccept(t *testing.T) {
+	require.Equal(t, "application/vnd.goprobe.v2+json", V2.MediaType())
+
+	for _, test := range []struct {
+		accept    string
+		version   Version
+		requested bool
+	}{
+		{"", VersionUnknown, false},
+		{"application/json", VersionUnknown, false},
+		{"application/vnd.goprobe.v2+json", V2, true},
+		{"text/html, application/vnd.goprobe.V1+json;q=0.9", V1, true},
+		{"application/vnd.goprobe.v9+json", VersionUnknown, true},
+	} {
+		t.Run(test.accept, func(t *testing.T) {
+			v, requested := VersionFromAccept(test.accept)
+			require.Equal(t, test.version, v)
+			require.Equal(t, test.requested, requested)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package bpffilter
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	etherHdrLen = 14
+	snapLen     = 65535
+)
+
+type testPacket struct {
+	src, dst     string
+	proto        byte
+	sport, dport uint16
+	fragOffset   uint16
+}
+
+// build synthesizes a packet (preceded by an Ethernet header if requested)
+func (p testPacket) build(ether bool) []byte {
+	src, dst := netip.MustParseAddr(p.src), netip.MustParseAddr(p.dst)
+
+	var pkt []byte
+	if ether {
+		pkt = make([]byte, etherHdrLen)
+		binary.BigEndian.PutUint16(pkt[12:], 0x0800)
+		if src.Is6() {
+			binary.BigEndian.PutUint16(pkt[12:], 0x86dd)
+		}
+	}
+
+	if src.Is4() {
+		hdr := make([]byte, 20)
+		hdr[0] = 0x45
+		binary.BigEndian.PutUint16(hdr[ipv4Frag:], p.fragOffset)
+		hdr[ipv4Proto] = p.proto
+		copy(hdr[ipv4Src:], src.AsSlice())
+		copy(hdr[ipv4Dst:], dst.AsSlice())
+		pkt = append(pkt, hdr...)
+	} else {
+		hdr := make([]byte, 40)
+		hdr[0] = 0x60
+		hdr[ipv6NextHdr] = p.proto
+		copy(hdr[ipv6Src:], src.AsSlice())
+		copy(hdr[ipv6Dst:], dst.AsSlice())
+		pkt = append(pkt, hdr...)
+	}
+
+	ports := make([]byte, 20)
+	binary.BigEndian.PutUint16(ports, p.sport)
+	binary.BigEndian.PutUint16(ports[2:], p.dport)
+	return append(pkt, ports...)
+}
+
+var (
+	sshV4      = testPacket{src: "10.0.0.1", dst: "192.168.1.1", proto: 6, sport: 50000, dport: 22}
+	sshV4Rev   = testPacket{src: "192.168.1.1", dst: "10.0.0.1", proto: 6, sport: 22, dport: 50000}
+	httpsV4    = testPacket{src: "10.0.0.1", dst: "8.8.8.8", proto: 6, sport: 50000, dport: 443}
+	dnsV4      = testPacket{src: "172.16.0.1", dst: "8.8.8.8", proto: 17, sport: 50000, dport: 53}
+	fragV4     = testPacket{src: "10.0.0.1", dst: "192.168.1.1", proto: 6, sport: 50000, dport: 22, fragOffset: 100}
+	greV4      = testPacket{src: "10.0.0.1", dst: "10.0.0.2", proto: 47}
+	icmpV4     = testPacket{src: "10.0.0.1", dst: "10.0.0.2", proto: 1}
+	httpsV6    = testPacket{src: "2001:db8::1", dst: "2001:db8:1::1", proto: 6, sport: 50000, dport: 443}
+	dnsV6      = testPacket{src: "fd00::1", dst: "2001:db8::53", proto: 17, sport: 50000, dport: 53}
+	sctpV6     = testPacket{src: "fd00::1", dst: "fd00::2", proto: 132, sport: 1500, dport: 2905}
+	icmp6V6    = testPacket{src: "fd00::1", dst: "fd00::2", proto: 58}
+	allPackets = []testPacket{sshV4, sshV4Rev, httpsV4, dnsV4, fragV4, greV4, icmpV4, httpsV6, dnsV6, sctpV6, icmp6V6}
+)
+
+func TestCompile(t *testing.T) {
+	var tests = []struct {
+		expr    string
+		matches []testPacket
+	}{
+		{"not port 22", []testPacket{httpsV4, dnsV4, fragV4, greV4, icmpV4, httpsV6, dnsV6, sctpV6, icmp6V6}},
+		{"port 22", []testPacket{sshV4, sshV4Rev}},
+		{"dst port 22", []testPacket{sshV4}},
+		{"src port 22", []testPacket{sshV4Rev}},
+		{"tcp dst port 443", []testPacket{httpsV4, httpsV6}},
+		{"udp dst port 443", nil},
+		{"port 443 or 53", []testPacket{httpsV4, dnsV4, httpsV6, dnsV6}},
+		{"portrange 1000-3000", []testPacket{sctpV6}},
+		{"sctp", []testPacket{sctpV6}},
+		{"tcp", []testPacket{sshV4, sshV4Rev, httpsV4, fragV4, httpsV6}},
+		{"udp or icmp6", []testPacket{dnsV4, dnsV6, icmp6V6}},
+		{"icmp", []testPacket{icmpV4}},
+		{"ip", []testPacket{sshV4, sshV4Rev, httpsV4, dnsV4, fragV4, greV4, icmpV4}},
+		{"ip6 and udp", []testPacket{dnsV6}},
+		{"proto 47", []testPacket{greV4}},
+		{"ip proto \\gre", []testPacket{greV4}},
+		{"proto udp", []testPacket{dnsV4, dnsV6}},
+		{"host 10.0.0.1", []testPacket{sshV4, sshV4Rev, httpsV4, fragV4, greV4, icmpV4}},
+		{"src host 10.0.0.1", []testPacket{sshV4, httpsV4, fragV4, greV4, icmpV4}},
+		{"dst 8.8.8.8", []testPacket{httpsV4, dnsV4}},
+		{"10.0.0.2", []testPacket{greV4, icmpV4}},
+		{"net 172.16.0.0/12", []testPacket{dnsV4}},
+		{"net 0.0.0.0/0", []testPacket{sshV4, sshV4Rev, httpsV4, dnsV4, fragV4, greV4, icmpV4}},
+		{"dst net 2001:db8::/32", []testPacket{httpsV6, dnsV6}},
+		{"src net 2001:db8::/48", []testPacket{httpsV6}},
+		{"host fd00::2", []testPacket{sctpV6, icmp6V6}},
+		{"not (net 10.0.0.0/8 or net fd00::/8)", []testPacket{dnsV4, httpsV6}},
+		{"!net 10.0.0.0/8 && !net fd00::/8", []testPacket{dnsV4, httpsV6}},
+		{"tcp and not (port 22 || port 443)", []testPacket{fragV4}},
+		{"host 10.0.0.1 and (port 22 or icmp)", []testPacket{sshV4, sshV4Rev, icmpV4}},
+		{"not not tcp", []testPacket{sshV4, sshV4Rev, httpsV4, fragV4, httpsV6}},
+	}
+
+	for _, ether := range []bool{true, false} {
+		ipHeaderOffset := 0
+		if ether {
+			ipHeaderOffset = etherHdrLen
+		}
+		for _, test := range tests {
+			t.Run(test.expr, func(t *testing.T) {
+				raw, err := Compile(test.expr, ipHeaderOffset)
+				require.Nil(t, err)
+
+				instructions, decoded := bpf.Disassemble(raw)
+				require.True(t, decoded)
+				vm, err := bpf.NewVM(append(instructions, bpf.RetConstant{Val: snapLen}))
+				require.Nil(t, err)
+
+				for _, pkt := range allPackets {
+					n, err := vm.Run(pkt.build(ether))
+					require.Nil(t, err)
+					require.Equal(t, slices.Contains(test.matches, pkt), n == snapLen, "unexpected result for packet %+v", pkt)
+				}
+			})
+		}
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"port",
+		"port http",
+		"port 65536",
+		"portrange 2000-1000",
+		"portrange 1000",
+		"host example.com",
+		"ip host 2001:db8::1",
+		"ip6 net 10.0.0.0/8",
+		"net 10.0.0.0/33",
+		"tcp host 10.0.0.1",
+		"icmp port 22",
+		"proto foo",
+		"src proto 6",
+		"tcp 22",
+		"port 22 and",
+		"(port 22",
+		"port 22)",
+		"or port 22",
+		"not",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := Compile(expr, etherHdrLen)
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestCompileTooComplex(t *testing.T) {
+	expr := "host 2001:db8::1"
+	for i := 2; i < 20; i++ {
+		expr += " or host 2001:db8::" + strconv.Itoa(i)
+	}
+	_, err := Compile(expr, etherHdrLen)
+	require.ErrorIs(t, err, errTooComplex)
+}
+
+func TestToCondition(t *testing.T) {
+	for _, test := range []struct {
+		expr      string
+		condition string
+		exact     bool
+	}{
+		{"host 10.0.0.1", "host = 10.0.0.1", true},
+		{"src host 10.0.0.1", "host = 10.0.0.1", false},
+		{"net 10.0.0.0/8 or ip6", "net = 10.0.0.0/8 | snet = ::/0", true},
+		{"net 10.0.0.1/32", "host = 10.0.0.1", true},
+		{"tcp and not port 22", "proto = tcp & !(dport = 22)", false},
+		{"udp dst port 53", "proto = udp & dport = 53", false},
+		{"tcp dst portrange 1000-2000", "proto = tcp & (dport >= 1000 & dport <= 2000)", false},
+		{"icmp6 or proto 47", "proto = 58 | proto = 47", true},
+		{"ip proto \\gre", "snet = 0.0.0.0/0 & proto = 47", true},
+		{"not (host 10.0.0.1 or port 53)", "!(host = 10.0.0.1 | dport = 53)", false},
+		{"!icmp && !sctp", "!(proto = icmp) & !(proto = sctp)", true},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			translation, err := ToCondition(test.expr)
+			require.Nil(t, err)
+			require.Equal(t, test.condition, translation.Result)
+			require.Equal(t, test.exact, translation.Exact)
+			require.Equal(t, test.exact, len(translation.Warnings) == 0)
+		})
+	}
+
+	_, err := ToCondition("port http")
+	require.ErrorIs(t, err, errInvalidValue)
+}
@@ -0,0 +1,348 @@
+// Package bpffilter compiles tcpdump-style filter expressions (c.f. pcap-filter(7)) into classic BPF
+// instructions, allowing to discard uninteresting packets in the kernel before they reach the capture.
+//
+// Only the subset of the grammar relevant to the IP layer and above is supported: host, net, port,
+// portrange and proto primitives (qualified by ip / ip6 / tcp / udp / sctp / icmp / icmp6 and src /
+// dst), combined via and / or / not (or &&, ||, !) and parentheses. Host and port names are not
+// resolved and IPv6 extension headers are not traversed. The compiled instructions operate on the IP
+// header at a fixed offset and are meant to be appended to the link type filter of a capture (c.f.
+// link.BPFFn), i.e. packets passing the filter fall through to the instruction following them.
+package bpffilter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"golang.org/x/net/bpf"
+)
+
+// MaxInstructions denotes the maximum number of instructions of a compiled filter (the link type filter
+// a filter is appended to has to be able to skip all of them in a single jump)
+const MaxInstructions = 200
+
+var errTooComplex = errors.New("filter expression too complex")
+
+// Offsets of the relevant IPv4 / IPv6 header fields
+const (
+	ipv4Proto     = 9
+	ipv4Frag      = 6
+	ipv4Src       = 12
+	ipv4Dst       = 16
+	ipv6NextHdr   = 6
+	ipv6Src       = 8
+	ipv6Dst       = 24
+	ipv6Transport = 40
+
+	ipVersionMask = 0xf0
+	ipVersion4    = 0x40
+	ipVersion6    = 0x60
+	ipv4FragMask  = 0x1fff
+)
+
+// Compile compiles a filter expression into BPF instructions, assuming the IP header of each packet to
+// start at ipHeaderOffset. Packets matching the expression fall through past the last instruction, all
+// others are rejected (via a return of zero)
+func Compile(expr string, ipHeaderOffset int) ([]bpf.RawInstruction, error) {
+	tree, err := parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filter expression `%s`: %w", expr, err)
+	}
+
+	c := &compiler{off: uint32(ipHeaderOffset)}
+	accept, reject := c.newLabel(), c.newLabel()
+	c.gen(tree, accept, reject)
+	c.place(reject)
+	c.emit(bpf.RetConstant{Val: 0})
+	c.place(accept)
+
+	instructions, err := c.resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile filter expression `%s`: %w", expr, err)
+	}
+	if len(instructions) > MaxInstructions {
+		return nil, fmt.Errorf("failed to compile filter expression `%s`: %w (%d instructions, at most %d supported)",
+			expr, errTooComplex, len(instructions), MaxInstructions)
+	}
+
+	raw, err := bpf.Assemble(instructions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble filter expression `%s`: %w", expr, err)
+	}
+	return raw, nil
+}
+
+// label denotes a (forward) jump target, resolved once the whole program has been generated
+type label int
+
+// instruction denotes a generated instruction, which is either a plain instruction or a conditional jump
+// to labels
+type instruction struct {
+	ins bpf.Instruction
+
+	cond   bpf.JumpTest
+	val    uint32
+	jt, jf label
+}
+
+type compiler struct {
+	off    uint32
+	prog   []instruction
+	labels []int
+}
+
+func (c *compiler) newLabel() label {
+	c.labels = append(c.labels, -1)
+	return label(len(c.labels) - 1)
+}
+
+func (c *compiler) place(l label) {
+	c.labels[l] = len(c.prog)
+}
+
+func (c *compiler) emit(ins bpf.Instruction) {
+	c.prog = append(c.prog, instruction{ins: ins})
+}
+
+func (c *compiler) jump(cond bpf.JumpTest, val uint32, jt, jf label) {
+	c.prog = append(c.prog, instruction{cond: cond, val: val, jt: jt, jf: jf})
+}
+
+// jumpNext emits a conditional jump continuing with the next instruction if the condition holds
+func (c *compiler) jumpNext(cond bpf.JumpTest, val uint32, jf label) {
+	next := c.newLabel()
+	c.jump(cond, val, next, jf)
+	c.place(next)
+}
+
+// goTo emits an unconditional jump
+func (c *compiler) goTo(l label) {
+	c.jump(bpf.JumpEqual, 0, l, l)
+}
+
+// resolve replaces all jumps to labels by relative jumps
+func (c *compiler) resolve() ([]bpf.Instruction, error) {
+	res := make([]bpf.Instruction, len(c.prog))
+	for i, ins := range c.prog {
+		if ins.ins != nil {
+			res[i] = ins.ins
+			continue
+		}
+
+		skipTrue, skipFalse := c.labels[ins.jt]-i-1, c.labels[ins.jf]-i-1
+		if skipTrue < 0 || skipFalse < 0 {
+			return nil, fmt.Errorf("unresolved jump at instruction %d", i)
+		}
+		if ins.jt == ins.jf {
+			res[i] = bpf.Jump{Skip: uint32(skipTrue)}
+			continue
+		}
+		if skipTrue > 0xff || skipFalse > 0xff {
+			return nil, fmt.Errorf("%w (jump at instruction %d out of range)", errTooComplex, i)
+		}
+		res[i] = bpf.JumpIf{Cond: ins.cond, Val: ins.val, SkipTrue: uint8(skipTrue), SkipFalse: uint8(skipFalse)}
+	}
+	return res, nil
+}
+
+// gen generates the instructions of a node, continuing at t if the packet matches and at f otherwise
+func (c *compiler) gen(n node, t, f label) {
+	switch n := n.(type) {
+	case andNode:
+		m := c.newLabel()
+		c.gen(n.left, m, f)
+		c.place(m)
+		c.gen(n.right, t, f)
+	case orNode:
+		m := c.newLabel()
+		c.gen(n.left, t, m)
+		c.place(m)
+		c.gen(n.right, t, f)
+	case notNode:
+		c.gen(n.operand, f, t)
+	case primitive:
+		c.genPrimitive(n, t, f)
+	default:
+		panic(fmt.Sprintf("unexpected node type %T", n))
+	}
+}
+
+// genPrimitive generates the instructions of a primitive, dispatching by the IP version of the packet
+func (c *compiler) genPrimitive(p primitive, t, f label) {
+	v4, v6 := p.families()
+
+	c.emit(bpf.LoadAbsolute{Off: c.off, Size: 1})
+	c.emit(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: ipVersionMask})
+	switch {
+	case v4 && v6:
+		l4, l6 := c.newLabel(), c.newLabel()
+		m := c.newLabel()
+		c.jump(bpf.JumpEqual, ipVersion4, l4, m)
+		c.place(m)
+		c.jump(bpf.JumpEqual, ipVersion6, l6, f)
+		c.place(l4)
+		c.genIPv4(p, t, f)
+		c.place(l6)
+		c.genIPv6(p, t, f)
+	case v4:
+		c.jumpNext(bpf.JumpEqual, ipVersion4, f)
+		c.genIPv4(p, t, f)
+	default:
+		c.jumpNext(bpf.JumpEqual, ipVersion6, f)
+		c.genIPv6(p, t, f)
+	}
+}
+
+func (c *compiler) genIPv4(p primitive, t, f label) {
+	switch p.kind {
+	case "":
+		c.genProto(p.proto, c.off+ipv4Proto, t, f)
+	case kindProto:
+		c.emit(bpf.LoadAbsolute{Off: c.off + ipv4Proto, Size: 1})
+		c.jump(bpf.JumpEqual, uint32(p.ipProto), t, f)
+	case kindHost, kindNet:
+		c.genDirections(p.dir, t, f, func(dir string, t, f label) {
+			off := c.off + ipv4Src
+			if dir == dirDst {
+				off = c.off + ipv4Dst
+			}
+			c.genAddr(p.prefix, off, t, f)
+		})
+	case kindPort, kindPortRange:
+		c.genTransportProto(p.proto, c.off+ipv4Proto, f)
+
+		// Only the first fragment carries the transport layer header, whose offset depends on the
+		// length of the IPv4 header
+		m := c.newLabel()
+		c.emit(bpf.LoadAbsolute{Off: c.off + ipv4Frag, Size: 2})
+		c.jump(bpf.JumpBitsSet, ipv4FragMask, f, m)
+		c.place(m)
+		c.emit(bpf.LoadMemShift{Off: c.off})
+		c.genDirections(p.dir, t, f, func(dir string, t, f label) {
+			off := c.off
+			if dir == dirDst {
+				off += 2
+			}
+			c.emit(bpf.LoadIndirect{Off: off, Size: 2})
+			c.genPortRange(p.portLow, p.portHigh, t, f)
+		})
+	}
+}
+
+func (c *compiler) genIPv6(p primitive, t, f label) {
+	switch p.kind {
+	case "":
+		c.genProto(p.proto, c.off+ipv6NextHdr, t, f)
+	case kindProto:
+		c.emit(bpf.LoadAbsolute{Off: c.off + ipv6NextHdr, Size: 1})
+		c.jump(bpf.JumpEqual, uint32(p.ipProto), t, f)
+	case kindHost, kindNet:
+		c.genDirections(p.dir, t, f, func(dir string, t, f label) {
+			off := c.off + ipv6Src
+			if dir == dirDst {
+				off = c.off + ipv6Dst
+			}
+			c.genAddr(p.prefix, off, t, f)
+		})
+	case kindPort, kindPortRange:
+		c.genTransportProto(p.proto, c.off+ipv6NextHdr, f)
+		c.genDirections(p.dir, t, f, func(dir string, t, f label) {
+			off := c.off + ipv6Transport
+			if dir == dirDst {
+				off += 2
+			}
+			c.emit(bpf.LoadAbsolute{Off: off, Size: 2})
+			c.genPortRange(p.portLow, p.portHigh, t, f)
+		})
+	}
+}
+
+// genDirections generates the instructions of a primitive for the source and / or destination as
+// requested, matching either of them if no direction was specified
+func (c *compiler) genDirections(dir string, t, f label, genFn func(dir string, t, f label)) {
+	if dir != "" {
+		genFn(dir, t, f)
+		return
+	}
+	m := c.newLabel()
+	genFn(dirSrc, t, m)
+	c.place(m)
+	genFn(dirDst, t, f)
+}
+
+// genProto generates the instructions of a protocol primitive (e.g. "tcp"), loading the protocol from
+// off if required
+func (c *compiler) genProto(proto string, off uint32, t, f label) {
+	if proto == qualIP || proto == qualIP6 {
+		c.goTo(t)
+		return
+	}
+	c.emit(bpf.LoadAbsolute{Off: off, Size: 1})
+	c.jump(bpf.JumpEqual, uint32(protocols[proto]), t, f)
+}
+
+// genTransportProto ensures that the packet carries the requested transport protocol (or any protocol
+// with ports if none was requested), continuing with the next instruction if so
+func (c *compiler) genTransportProto(proto string, off uint32, f label) {
+	c.emit(bpf.LoadAbsolute{Off: off, Size: 1})
+	if proto != "" && proto != qualIP && proto != qualIP6 {
+		c.jumpNext(bpf.JumpEqual, uint32(protocols[proto]), f)
+		return
+	}
+
+	m := c.newLabel()
+	for _, name := range []string{"tcp", "udp"} {
+		next := c.newLabel()
+		c.jump(bpf.JumpEqual, uint32(protocols[name]), m, next)
+		c.place(next)
+	}
+	c.jump(bpf.JumpEqual, uint32(protocols["sctp"]), m, f)
+	c.place(m)
+}
+
+// genAddr generates the comparison of the address at off against a prefix, word by word
+func (c *compiler) genAddr(prefix netip.Prefix, off uint32, t, f label) {
+	bits := prefix.Bits()
+	if bits == 0 {
+		c.goTo(t)
+		return
+	}
+
+	addr := prefix.Addr().AsSlice()
+	for i := 0; bits > 0; i, bits = i+1, bits-32 {
+		word := uint32(addr[4*i])<<24 | uint32(addr[4*i+1])<<16 | uint32(addr[4*i+2])<<8 | uint32(addr[4*i+3])
+		c.emit(bpf.LoadAbsolute{Off: off + uint32(4*i), Size: 4})
+		if bits < 32 {
+			c.emit(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: ^uint32(0) << (32 - bits)})
+		}
+		if bits <= 32 {
+			c.jump(bpf.JumpEqual, word, t, f)
+			return
+		}
+		c.jumpNext(bpf.JumpEqual, word, f)
+	}
+}
+
+// genPortRange generates the comparison of the (previously loaded) port against a range of ports
+func (c *compiler) genPortRange(low, high uint16, t, f label) {
+	if low == high {
+		c.jump(bpf.JumpEqual, uint32(low), t, f)
+		return
+	}
+	c.jumpNext(bpf.JumpGreaterOrEqual, uint32(low), f)
+	c.jump(bpf.JumpGreaterThan, uint32(high), f, t)
+}
+
+// families returns the IP versions a primitive applies to
+func (p primitive) families() (v4, v6 bool) {
+	switch p.proto {
+	case qualIP, "icmp":
+		return true, false
+	case qualIP6, "icmp6":
+		return false, true
+	}
+	if p.kind == kindHost || p.kind == kindNet {
+		return p.prefix.Addr().Is4(), p.prefix.Addr().Is6()
+	}
+	return true, true
+}
@@ -0,0 +1,324 @@
+package bpffilter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	errSyntax           = errors.New("syntax error")
+	errInvalidValue     = errors.New("invalid value")
+	errInvalidQualifier = errors.New("invalid combination of qualifiers")
+)
+
+// IP protocol numbers supported by name
+var protocols = map[string]byte{
+	"icmp":  1,
+	"tcp":   6,
+	"udp":   17,
+	"gre":   47,
+	"esp":   50,
+	"ah":    51,
+	"icmp6": 58,
+	"sctp":  132,
+}
+
+// Qualifiers of a primitive (c.f. pcap-filter(7))
+const (
+	qualIP  = "ip"
+	qualIP6 = "ip6"
+
+	dirSrc = "src"
+	dirDst = "dst"
+
+	kindHost      = "host"
+	kindNet       = "net"
+	kindPort      = "port"
+	kindPortRange = "portrange"
+	kindProto     = "proto"
+)
+
+var (
+	protoQualifiers = []string{qualIP, qualIP6, "tcp", "udp", "sctp", "icmp", "icmp6"}
+	dirQualifiers   = []string{dirSrc, dirDst}
+	kindQualifiers  = []string{kindHost, kindNet, kindPort, kindPortRange, kindProto}
+)
+
+// node denotes a node of the syntax tree of a filter expression
+type node interface{}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ operand node }
+
+// primitive denotes a primitive of a filter expression, e.g. "tcp dst port 443" or "src net 10.0.0.0/8"
+type primitive struct {
+	proto, dir, kind string
+
+	// Parsed value (depending on the kind)
+	prefix   netip.Prefix
+	portLow  uint16
+	portHigh uint16
+	ipProto  byte
+}
+
+// qualifiers denotes the qualifiers of the most recent primitive, which are assumed for subsequent bare
+// values (e.g. "port 80 or 443")
+type qualifiers struct {
+	proto, dir, kind string
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	last   *qualifiers
+}
+
+// parse parses a filter expression into its syntax tree
+func parse(expr string) (node, error) {
+	p := &parser{tokens: tokenize(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", errSyntax)
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", errSyntax, p.tokens[p.pos])
+	}
+	return n, nil
+}
+
+// tokenize splits an expression into words, parentheses and operators
+func tokenize(expr string) (tokens []string) {
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case unicode.IsSpace(rune(c)):
+			flush()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == '!':
+			flush()
+			tokens = append(tokens, "not")
+		case (c == '&' || c == '|') && i+1 < len(expr) && expr[i+1] == c:
+			flush()
+			if c == '&' {
+				tokens = append(tokens, "and")
+			} else {
+				tokens = append(tokens, "or")
+			}
+			i++
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.peek() {
+	case "not":
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	case "(":
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", errSyntax)
+		}
+		return n, nil
+	case "", ")", "and", "or":
+		return nil, fmt.Errorf("%w: expected primitive at position %d", errSyntax, p.pos+1)
+	}
+	return p.parsePrimitive()
+}
+
+func (p *parser) parsePrimitive() (node, error) {
+	var q qualifiers
+	if slices.Contains(protoQualifiers, p.peek()) {
+		q.proto = p.next()
+	}
+	if slices.Contains(dirQualifiers, p.peek()) {
+		q.dir = p.next()
+	}
+	if slices.Contains(kindQualifiers, p.peek()) {
+		q.kind = p.next()
+	}
+
+	switch {
+
+	// A protocol on its own (e.g. "tcp") matches all packets of the protocol
+	case q.proto != "" && q.dir == "" && q.kind == "":
+		if tok := p.peek(); tok != "" && tok != ")" && tok != "and" && tok != "or" {
+			return nil, fmt.Errorf("%w: unexpected %q after %q", errSyntax, tok, q.proto)
+		}
+		p.last = nil
+		return primitive{proto: q.proto}, nil
+
+	// A bare value assumes the qualifiers of the preceding primitive (or denotes a host)
+	case q == qualifiers{}:
+		if p.last != nil {
+			q = *p.last
+		} else {
+			q.kind = kindHost
+		}
+	case q.kind == "":
+		q.kind = kindHost
+	}
+
+	value := p.next()
+	if value == "" || value == "(" || value == ")" || value == "and" || value == "or" || value == "not" {
+		return nil, fmt.Errorf("%w: missing value for %q", errSyntax, q.kind)
+	}
+	prim, err := newPrimitive(q, value)
+	if err != nil {
+		return nil, err
+	}
+	p.last = &q
+
+	return prim, nil
+}
+
+// newPrimitive validates the qualifiers and parses the value of a primitive
+func newPrimitive(q qualifiers, value string) (prim primitive, err error) {
+	prim = primitive{proto: q.proto, dir: q.dir, kind: q.kind}
+
+	switch q.kind {
+	case kindHost, kindNet:
+		if q.proto != "" && q.proto != qualIP && q.proto != qualIP6 {
+			return prim, fmt.Errorf("%w: %s %s", errInvalidQualifier, q.proto, q.kind)
+		}
+		if q.kind == kindNet && strings.Contains(value, "/") {
+			if prim.prefix, err = netip.ParsePrefix(value); err != nil {
+				return prim, fmt.Errorf("%w: %s: %w", errInvalidValue, value, err)
+			}
+			prim.prefix = prim.prefix.Masked()
+		} else {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return prim, fmt.Errorf("%w: %s is not an IP address (host names are not supported)", errInvalidValue, value)
+			}
+			prim.prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if (q.proto == qualIP && !prim.prefix.Addr().Is4()) || (q.proto == qualIP6 && !prim.prefix.Addr().Is6()) {
+			return prim, fmt.Errorf("%w: %s is not an %s address", errInvalidValue, value, q.proto)
+		}
+
+	case kindPort, kindPortRange:
+		if q.proto == "icmp" || q.proto == "icmp6" {
+			return prim, fmt.Errorf("%w: %s %s", errInvalidQualifier, q.proto, q.kind)
+		}
+		if q.kind == kindPort {
+			if prim.portLow, err = parsePort(value); err != nil {
+				return prim, err
+			}
+			prim.portHigh = prim.portLow
+			break
+		}
+		low, high, found := strings.Cut(value, "-")
+		if !found {
+			return prim, fmt.Errorf("%w: port range %s (expected <low>-<high>)", errInvalidValue, value)
+		}
+		if prim.portLow, err = parsePort(low); err != nil {
+			return prim, err
+		}
+		if prim.portHigh, err = parsePort(high); err != nil {
+			return prim, err
+		}
+		if prim.portLow > prim.portHigh {
+			return prim, fmt.Errorf("%w: port range %s", errInvalidValue, value)
+		}
+
+	case kindProto:
+		if (q.proto != "" && q.proto != qualIP && q.proto != qualIP6) || q.dir != "" {
+			return prim, fmt.Errorf("%w: %s %s %s", errInvalidQualifier, q.proto, q.dir, q.kind)
+		}
+		value = strings.TrimPrefix(value, `\`)
+		if proto, exists := protocols[value]; exists {
+			prim.ipProto = proto
+			break
+		}
+		proto, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return prim, fmt.Errorf("%w: protocol %s", errInvalidValue, value)
+		}
+		prim.ipProto = byte(proto)
+	}
+
+	return prim, nil
+}
+
+func parsePort(value string) (uint16, error) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: port %s (port names are not supported)", errInvalidValue, value)
+	}
+	return uint16(port), nil
+}
@@ -0,0 +1,178 @@
+package bpffilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Translation denotes the translation of a filter expression into a goDB condition or vice versa. Since
+// filter expressions are evaluated on individual packets whereas conditions are evaluated on flows (which
+// only retain the destination port of their responder and are matched irrespective of the direction of
+// their packets), a translation is often only an approximation
+type Translation struct {
+	// Result denotes the translated expression (empty if no part of the expression could be translated)
+	Result string `json:"result"`
+
+	// Exact denotes if the result is equivalent to the translated expression
+	Exact bool `json:"exact"`
+
+	// Warnings lists the parts of the expression which could only be approximated or not be translated
+	// at all
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Warn records a warning (unless an identical one was already recorded), rendering the translation inexact
+func (t *Translation) Warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	for _, warning := range t.Warnings {
+		if warning == msg {
+			return
+		}
+	}
+	t.Warnings = append(t.Warnings, msg)
+}
+
+// Finalize sets the result of the translation (stripping any enclosing parentheses) and determines if
+// it is exact
+func (t *Translation) Finalize(result string) *Translation {
+	if strings.HasPrefix(result, "(") && strings.HasSuffix(result, ")") && enclosed(result) {
+		result = result[1 : len(result)-1]
+	}
+	t.Result, t.Exact = result, len(t.Warnings) == 0
+	return t
+}
+
+// enclosed determines if the opening parenthesis at the start of expr is closed at its very end
+func enclosed(expr string) bool {
+	depth := 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i == len(expr)-1
+			}
+		}
+	}
+	return false
+}
+
+// Names of the IP protocols supported as values of goDB conditions
+var conditionProtocols = map[byte]string{
+	1:   "icmp",
+	6:   "tcp",
+	17:  "udp",
+	132: "sctp",
+}
+
+// ToCondition translates a filter expression into the closest equivalent goDB condition, e.g.
+// "tcp and not port 22" into "proto = tcp & !(dport = 22)"
+func ToCondition(expr string) (*Translation, error) {
+	tree, err := parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filter expression `%s`: %w", expr, err)
+	}
+
+	t := new(Translation)
+	return t.Finalize(toCondition(tree, t)), nil
+}
+
+func toCondition(n node, t *Translation) string {
+	switch n := n.(type) {
+	case andNode:
+		return "(" + toCondition(n.left, t) + " & " + toCondition(n.right, t) + ")"
+	case orNode:
+		return "(" + toCondition(n.left, t) + " | " + toCondition(n.right, t) + ")"
+	case notNode:
+		operand := toCondition(n.operand, t)
+		if !strings.HasPrefix(operand, "(") {
+			operand = "(" + operand + ")"
+		}
+		return "!" + operand
+	case primitive:
+		return n.toCondition(t)
+	}
+	panic(fmt.Sprintf("unexpected node type %T", n))
+}
+
+// toCondition translates a primitive into the equivalent condition(s). The direction of a packet isn't
+// retained by flows, hence host / net primitives match flows irrespective of it. Likewise, only the
+// destination port of flows is stored, hence port primitives are matched against it
+func (p primitive) toCondition(t *Translation) string {
+	var conds []string
+	switch p.proto {
+	case qualIP:
+		conds = append(conds, "snet = 0.0.0.0/0")
+	case qualIP6:
+		conds = append(conds, "snet = ::/0")
+	case "":
+	default:
+		conds = append(conds, "proto = "+protocolValue(protocols[p.proto]))
+	}
+
+	switch p.kind {
+	case kindHost, kindNet:
+		if p.dir != "" {
+			t.Warn("%s: flows are matched irrespective of the direction of their packets", p)
+		}
+		if p.kind == kindHost || p.prefix.IsSingleIP() {
+			conds = append(conds, "host = "+p.prefix.Addr().String())
+		} else {
+			conds = append(conds, "net = "+p.prefix.String())
+		}
+	case kindPort, kindPortRange:
+		if p.proto == "" || p.proto == qualIP || p.proto == qualIP6 {
+			t.Warn("%s: matched against the destination port of flows of any IP protocol (the source port isn't stored)", p)
+		} else {
+			t.Warn("%s: matched against the destination port of flows (the source port isn't stored)", p)
+		}
+		if p.portLow == p.portHigh {
+			conds = append(conds, fmt.Sprintf("dport = %d", p.portLow))
+		} else {
+			conds = append(conds, fmt.Sprintf("(dport >= %d & dport <= %d)", p.portLow, p.portHigh))
+		}
+	case kindProto:
+		conds = append(conds, "proto = "+protocolValue(p.ipProto))
+	}
+
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return "(" + strings.Join(conds, " & ") + ")"
+}
+
+// protocolValue returns the value of a condition on the IP protocol (using its name if supported)
+func protocolValue(proto byte) string {
+	if name, exists := conditionProtocols[proto]; exists {
+		return name
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// String returns the primitive in its canonical form, e.g. "tcp dst port 443"
+func (p primitive) String() string {
+	var value string
+	switch p.kind {
+	case kindHost:
+		value = p.prefix.Addr().String()
+	case kindNet:
+		value = p.prefix.String()
+	case kindPort:
+		value = strconv.Itoa(int(p.portLow))
+	case kindPortRange:
+		value = fmt.Sprintf("%d-%d", p.portLow, p.portHigh)
+	case kindProto:
+		value = strconv.Itoa(int(p.ipProto))
+	}
+
+	var fields []string
+	for _, field := range []string{p.proto, p.dir, p.kind, value} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, " ")
+}
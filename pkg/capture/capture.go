@@ -5,17 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
-	"github.com/els0r/telemetry/logging"
 	"github.com/fako1024/gotools/concurrency"
 	"github.com/fako1024/slimcap/capture"
 	"github.com/fako1024/slimcap/capture/afpacket/afring"
 	"github.com/fako1024/slimcap/link"
+	"golang.org/x/net/bpf"
 )
 
 const (
@@ -32,20 +35,98 @@ var (
 	ErrLocalBufferOverflow = errors.New("local packet buffer overflow")
 
 	defaultSourceInitFn = func(c *Capture) (Source, error) {
-		return afring.NewSource(c.iface,
-			afring.CaptureLength(link.CaptureLengthMinimalIPv6Transport),
+		if c.config.Ingest != nil {
+			return newIngestSource(c)
+		}
+		if c.config.XDP != nil {
+			return newXDPSource(c)
+		}
+
+		l, err := link.New(c.iface)
+		if err != nil {
+			return nil, err
+		}
+		extraInstructions, err := bpfFilterInstructions(c.config, l)
+		if err != nil {
+			return nil, err
+		}
+		return afring.NewSourceFromLink(l,
+			afring.CaptureLength(captureLengthStrategy(c.config)),
 			afring.BufferSize(c.config.RingBuffer.BlockSize, c.config.RingBuffer.NumBlocks),
 			afring.Promiscuous(c.config.Promisc),
 			afring.IgnoreVLANs(c.config.IgnoreVLANs),
-			afring.ExtraBPFInstructions(c.config.ExtraBPFFilters),
+			afring.ExtraBPFInstructions(extraInstructions),
 		)
 	}
 )
 
+// bpfFilterInstructions determines the BPF instructions appended to the link type filter of an interface,
+// i.e. the compiled capture filter (if any) followed by the extra BPF filters. Since the compiled filter
+// rejects non-matching packets on its own, the relative jumps of the extra filters remain valid
+func bpfFilterInstructions(cfg config.CaptureConfig, l *link.Link) ([]bpf.RawInstruction, error) {
+	if cfg.Filter == "" {
+		return cfg.ExtraBPFFilters, nil
+	}
+
+	instructions, err := bpffilter.Compile(cfg.Filter, int(l.Type.IPHeaderOffset()))
+	if err != nil {
+		return nil, err
+	}
+	instructions = append(instructions, cfg.ExtraBPFFilters...)
+	if len(instructions) > bpffilter.MaxInstructions {
+		return nil, fmt.Errorf("capture filter and extra BPF filters exceed %d instructions", bpffilter.MaxInstructions)
+	}
+	return instructions, nil
+}
+
+// captureLengthStrategy determines the capture length of an interface, either as configured explicitly
+// or as the minimal length covering the transport layer of its packets
+func captureLengthStrategy(cfg config.CaptureConfig) link.CaptureLengthStrategy {
+	if cfg.CaptureLength > 0 {
+		return link.CaptureLengthFixed(cfg.CaptureLength)
+	}
+	return defaultCaptureLengthStrategy(cfg)
+}
+
+// defaultCaptureLengthStrategy determines the minimal capture length covering the transport layer of
+// the packets of an interface
+func defaultCaptureLengthStrategy(cfg config.CaptureConfig) link.CaptureLengthStrategy {
+
+	// If tunneled traffic is to be decapsulated, the capture length has to cover
+	// the inner IP / transport layer as well
+	if cfg.Decapsulation {
+		return captureLengthDecapsulation
+	}
+	return link.CaptureLengthMinimalIPv6Transport
+}
+
 // sourceInitFn denotes the function used to initialize a capture source,
 // providing the ability to override the default behavior, e.g. in mock tests
 type sourceInitFn func(*Capture) (Source, error)
 
+// VLANSource denotes a capture source able to provide the 802.1Q VLAN ID of the packets it returns
+// (e.g. decoded from the flow records exported by a device). Flows are attributed to the VLAN of
+// the packet they were created from
+type VLANSource interface {
+
+	// VLAN returns the VLAN ID of the packet returned by the most recent call to NextIPPacketZeroCopy()
+	// (zero if the packet was untagged)
+	VLAN() uint16
+}
+
+// MACSource denotes a capture source able to provide the source / destination MAC addresses of the
+// packets it returns (e.g. decoded from the flow records exported by a device)
+type MACSource interface {
+
+	// MACs returns the source / destination MAC addresses of the packet returned by the most recent call
+	// to NextIPPacketZeroCopy() (zero if unknown)
+	MACs() (src, dst types.MAC)
+}
+
+// errMACsLinkType denotes that MAC addresses cannot be recorded since the capture source neither provides
+// them nor captures Ethernet frames
+var errMACsLinkType = errors.New("MAC addresses can only be recorded on Ethernet links or from flow records carrying them")
+
 // Capture captures and logs flow data for all traffic on a
 // given network interface. For each Capture, a goroutine is
 // spawned at creation time. To avoid leaking this goroutine,
@@ -66,14 +147,25 @@ type Capture struct {
 	// Rotation state synchronization
 	capLock *concurrency.ThreePointLock
 
-	// Logged flows since creation of the capture (note that some
-	// flows are retained even after Rotate has been called)
+	// Logged flows since the last rotation (along with the flows detached
+	// by it, retaining the orientation of continued flows)
 	flowLog *FlowLog
 
 	// Generic handle / source for packet capture
 	captureHandle Source
 	sourceInitFn  sourceInitFn
 
+	// vlanSource provides the VLAN IDs of the packets of the capture handle (nil if not supported
+	// by the source), whereas linkVLANs denotes that they are read from the tpacket headers of the
+	// AF_PACKET ring buffer
+	vlanSource VLANSource
+	linkVLANs  bool
+
+	// macSource provides the MAC addresses of the packets of the capture handle, whereas linkMACs denotes
+	// that they are extracted from the Ethernet header of the captured frames (only if enabled)
+	macSource MACSource
+	linkMACs  bool
+
 	// Memory buffer pool
 	memPool *LocalBufferPool
 
@@ -83,6 +175,39 @@ type Capture struct {
 	// startedAt tracks when the capture was started
 	startedAt time.Time
 
+	// health tracks the packet parsing errors in order to diagnose capture misconfigurations
+	health parsingHealth
+
+	// nonIP counts the frames not carrying an IP layer (if enabled)
+	nonIP *nonIPCounter
+
+	// disabledOffloads denotes the receive offloads disabled upon enabling the capture, which are
+	// restored once it is closed
+	disabledOffloads offloads
+
+	// params stores the static parameters effectively applied to the capture (if known)
+	params *capturetypes.CaptureParameters
+
+	// portAggregation tunes the aggregation of the client ports of flows to common ports (nil if the
+	// default behavior applies)
+	portAggregation *portAggregation
+
+	// sizeAdjustment denotes the number of bytes added to the length of each packet in order to account
+	// for it on the configured basis (see byteAccountingAdjustment())
+	sizeAdjustment int32
+
+	// flowsCreated counts the flows added to the flow log since the capture was started (excluding
+	// flows continued across a rotation). It is updated atomically, allowing to observe the flow
+	// creation rate between rotations without interrupting the capture
+	flowsCreated atomic.Uint64
+
+	// flowsCreatedAtRotation stores the value of flowsCreated at the time of the last rotation
+	flowsCreatedAtRotation atomic.Uint64
+
+	// stopRecords / wgRecords control the clock of the flow records (if enabled)
+	stopRecords chan struct{}
+	wgRecords   sync.WaitGroup
+
 	// Mutex to allow concurrent access to capture components
 	// This is _unrelated_ to the three-point capture lock to
 	// interrupt the capture for purposes of e.g. rotation
@@ -105,6 +230,13 @@ func (c *Capture) SetSourceInitFn(fn sourceInitFn) *Capture {
 	return c
 }
 
+// SetFlowRecords enables tracking NetFlow-style flow records delimited by the given timeouts, handing
+// all expired records to the handlers. It has to be called before the capture is started
+func (c *Capture) SetFlowRecords(timeouts FlowTimeouts, handlers ...FlowRecordHandler) *Capture {
+	c.flowLog.records = newFlowRecords(timeouts, handlers...)
+	return c
+}
+
 // Iface returns the name of the interface
 func (c *Capture) Iface() string {
 	return c.iface
@@ -112,12 +244,48 @@ func (c *Capture) Iface() string {
 
 func (c *Capture) run(memPool *LocalBufferPool) (err error) {
 
+	if c.portAggregation, err = newPortAggregation(c.config.SourcePortAggregation); err != nil {
+		return fmt.Errorf("failed to initialize source port aggregation: %w", err)
+	}
+
 	// Set up the packet source and capturing
 	c.captureHandle, err = c.sourceInitFn(c)
 	if err != nil {
 		return fmt.Errorf("failed to initialize capture: %w", err)
 	}
 
+	// VLAN IDs are only recorded if enabled, taken from the source if supported and otherwise read from
+	// the tpacket headers of the AF_PACKET ring buffer (until slimcap provides them, c.f. linkVLAN())
+	if c.config.VLANs {
+		if c.vlanSource, _ = any(c.captureHandle).(VLANSource); c.vlanSource == nil && !c.config.IgnoreVLANs {
+			_, c.linkVLANs = any(c.captureHandle).(*afring.Source)
+		}
+	}
+
+	// MAC addresses are extracted from the captured frames unless provided by the source
+	if c.config.MACs {
+		if c.macSource, _ = any(c.captureHandle).(MACSource); c.macSource == nil {
+			if l := c.captureHandle.Link(); l == nil || l.Type != link.TypeEthernet {
+				if cerr := c.captureHandle.Close(); cerr != nil {
+					return fmt.Errorf("failed to close capture after failing to record MAC addresses: %w", cerr)
+				}
+				return errMACsLinkType
+			}
+			c.linkMACs = true
+		}
+	}
+
+	if c.config.NonIPStats {
+		if c.nonIP, err = newNonIPCounter(c.iface); err != nil {
+			if cerr := c.captureHandle.Close(); cerr != nil {
+				return fmt.Errorf("failed to close capture after failing to count non-IP frames: %w", cerr)
+			}
+			return fmt.Errorf("failed to count non-IP frames: %w", err)
+		}
+	}
+
+	c.initParameters()
+
 	c.memPool = memPool
 	c.capLock = concurrency.NewThreePointLock(
 		concurrency.WithMemPool(memPool.MemPoolLimitUnique),
@@ -129,9 +297,21 @@ func (c *Capture) run(memPool *LocalBufferPool) (err error) {
 	// make sure to store when the capture started
 	c.startedAt = time.Now()
 
+	promFlowsCreated.add(c)
+
 	return
 }
 
+// startFlowRecords starts advancing the clock of the flow records (if enabled)
+func (c *Capture) startFlowRecords() {
+	if c.flowLog.records == nil {
+		return
+	}
+	c.stopRecords = make(chan struct{})
+	c.wgRecords.Add(1)
+	go c.advanceFlowRecordClock()
+}
+
 func (c *Capture) close() error {
 
 	// Lock the whole capture to protect against duplicate close() calls
@@ -142,56 +322,112 @@ func (c *Capture) close() error {
 	if c.captureHandle == nil {
 		return nil
 	}
+
+	// Stop advancing the clock of the flow records
+	if c.stopRecords != nil {
+		close(c.stopRecords)
+		c.wgRecords.Wait()
+		c.stopRecords = nil
+	}
 	if err := c.captureHandle.Close(); err != nil {
 		return err
 	}
+	if c.nonIP != nil {
+		if err := c.nonIP.close(); err != nil {
+			return err
+		}
+	}
+	promFlowsCreated.remove(c)
 
 	// Wait until processing has concluded, then close the capture lock
 	c.wgProc.Wait()
 	c.capLock.Close()
 
+	// Expire all remaining flow records (processing has concluded, hence no lock is required)
+	if c.flowLog.records != nil {
+		c.flowLog.records.emit(c.iface, c.flowLog.records.flush(c.flowLog))
+	}
+
 	// Setting the handle to nil isn't stricly necessary, but it's an additional
 	// guard against races (because it allows the race detector to pick up more
 	// easily on potential concurrent accesses) and might trigger a crash on any
 	// unwanted access
 	c.captureHandle = nil
-	return nil
+
+	return c.restoreOffloads()
 }
 
-func (c *Capture) rotate(ctx context.Context) (agg *hashmap.AggFlowMap) {
+// restoreOffloads restores the receive offloads disabled upon enabling the capture (if any)
+func (c *Capture) restoreOffloads() error {
+	if !c.disabledOffloads.enabled() {
+		return nil
+	}
+	if err := setOffloads(c.iface, c.disabledOffloads, true); err != nil {
+		return fmt.Errorf("failed to restore receive offloads (%s): %w", c.disabledOffloads, err)
+	}
+	c.disabledOffloads = offloads{}
+	return nil
+}
 
-	logger := logging.FromContext(ctx)
+// rotate detaches all flows recorded since the last rotation. It has to be called while holding the
+// capture lock, but takes constant time regardless of the number of flows, hence keeping the capture
+// stalled for as short as possible. The detached flows are aggregated (and reset) via aggregate() after
+// releasing the lock
+func (c *Capture) rotate(ctx context.Context) (detached *FlowLog) {
 
 	// write how many flows are currently in the map
 	nFlows := c.flowLog.Len()
-
-	var totals = &types.Counters{}
-	defer func() {
-		go func(iface string) {
-			// write volume metrics to prometheus
-			promNumFlows.WithLabelValues(c.iface).Set(float64(nFlows))
-
-			if totals != nil {
-				promBytes.WithLabelValues(iface, "inbound").Add(float64(totals.BytesRcvd))
-				promBytes.WithLabelValues(iface, "outbound").Add(float64(totals.BytesSent))
-				promPackets.WithLabelValues(iface, "inbound").Add(float64(totals.PacketsRcvd))
-				promPackets.WithLabelValues(iface, "outbound").Add(float64(totals.PacketsSent))
-			}
-		}(c.iface)
-	}()
+	promNumFlows.WithLabelValues(c.iface).Set(float64(nFlows))
 
 	if nFlows == 0 {
-		logger.Debug("there are currently no flow records available")
+		logs.FromContext(ctx, logs.ModuleCapture).Debug("there are currently no flow records available")
+	}
+	c.flowsCreatedAtRotation.Store(c.flowsCreated.Load())
+
+	return c.flowLog.Detach()
+}
+
+// aggregate extracts an AggFlowMap (along with the attributes recorded for its flows beyond their
+// counters) from the flows detached via rotate() and clears the ones detached by the previous rotation,
+// such that they can be swapped in again by the next rotation. It does not require the capture lock, but
+// has to complete before the next rotation
+func (c *Capture) aggregate(detached *FlowLog) (agg *hashmap.AggFlowMap, attrs capturetypes.FlowAttributes) {
+	if detached == nil {
 		return
 	}
-	agg, totals = c.flowLog.Rotate()
+	c.flowLog.recycle()
+
+	// Flow records are accrued from the detached flows (and expired) upon each rotation, even if
+	// there are none
+	if c.flowLog.records != nil {
+		c.flowLog.records.emit(c.iface, c.flowLog.records.rotate(detached, time.Now()))
+	}
+	if detached.Len() == 0 {
+		return
+	}
+
+	var totals *types.Counters
+	agg, totals, attrs = detached.aggregateDetached()
+
+	// write volume metrics to prometheus
+	promBytes.WithLabelValues(c.iface, "inbound").Add(float64(totals.BytesRcvd))
+	promBytes.WithLabelValues(c.iface, "outbound").Add(float64(totals.BytesSent))
+	promPackets.WithLabelValues(c.iface, "inbound").Add(float64(totals.PacketsRcvd))
+	promPackets.WithLabelValues(c.iface, "outbound").Add(float64(totals.PacketsSent))
 
 	return
 }
 
+// flowCounts returns the number of flows added to the flow log since the last rotation and since the
+// capture was started. It does not require the capture lock
+func (c *Capture) flowCounts() (sinceRotation, total uint64) {
+	total = c.flowsCreated.Load()
+	return total - c.flowsCreatedAtRotation.Load(), total
+}
+
 func (c *Capture) flowMap(ctx context.Context) (agg *hashmap.AggFlowMap) {
 
-	logger := logging.FromContext(ctx)
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
 
 	if c.flowLog.Len() == 0 {
 		logger.Debug("there are currently no flow records available")
@@ -202,6 +438,17 @@ func (c *Capture) flowMap(ctx context.Context) (agg *hashmap.AggFlowMap) {
 	return
 }
 
+// taggedFlowMap extracts an AggFlowMap from the active flows along with the attributes recorded for
+// them beyond their counters (the capture must be locked)
+func (c *Capture) taggedFlowMap() (agg *hashmap.AggFlowMap, attrs capturetypes.FlowAttributes) {
+	if c.flowLog.Len() == 0 {
+		return
+	}
+	agg, _, attrs = c.flowLog.aggregateDetached()
+
+	return
+}
+
 // process is the heart of the Capture. It listens for network traffic on the
 // network interface and logs the corresponding flows.
 //
@@ -224,9 +471,16 @@ func (c *Capture) process() <-chan error {
 		// memory area
 		localBuf := NewLocalBuffer(c.memPool)
 
+		// Sample the latencies of the loop (only ever accessed from this goroutine)
+		sampler := newLatencySampler()
+
 		// Main packet capture loop which an interface should be in most of the time
 		for {
 
+			// Complete the latency sample of the previous packet (if any). Since the packet may have been
+			// discarded at various stages this is done here instead of at the end of the loop
+			sampler.processed()
+
 			// Since lock confirmation is only done from a single goroutine (this one)
 			// tracking if the capture source was unblocked is safe and can act as flag when to
 			// read from the lock request channel (which in turn is atomic).
@@ -253,8 +507,21 @@ func (c *Capture) process() <-chan error {
 			}
 
 			// Fetch the next packet or PPOLL event from the source
-			ipLayer, pktType, pktSize, err := c.captureHandle.NextIPPacketZeroCopy()
+			sampler.fetch()
+			var (
+				ipLayer capture.IPLayer
+				pktType capture.PacketType
+				pktSize uint32
+				macs    capturetypes.MACPair
+				err     error
+			)
+			if c.linkMACs {
+				ipLayer, macs, pktType, pktSize, err = c.nextEthernetFrame()
+			} else {
+				ipLayer, pktType, pktSize, err = c.captureHandle.NextIPPacketZeroCopy()
+			}
 			if err != nil {
+				sampler.abort()
 				if errors.Is(err, capture.ErrCaptureUnblocked) { // capture unblocked
 
 					// Advance to the next loop iteration (during which the pending lock will be
@@ -268,11 +535,32 @@ func (c *Capture) process() <-chan error {
 				captureErrors <- fmt.Errorf("capture error: %w", err)
 				return
 			}
+			sampler.fetched()
+
+			// Collect the labels of the packet recorded along with its flow. If supported by the source,
+			// retrieve the VLAN the packet was observed on (and its MAC addresses)
+			labels := capturetypes.FlowLabels{MACs: macs}
+			if c.linkVLANs {
+				labels.VLAN = linkVLAN(ipLayer)
+			} else if c.vlanSource != nil {
+				labels.VLAN = c.vlanSource.VLAN()
+			}
+			if c.macSource != nil {
+				labels.MACs.Src, labels.MACs.Dst = c.macSource.MACs()
+			}
+
+			// If enabled, strip any tunnel headers in order to record flows based on the inner
+			// IP layer of the packet
+			if c.config.Decapsulation {
+				if ipLayer, labels.Encapsulation = Decapsulate(ipLayer); labels.Encapsulation != capturetypes.EncapNone {
+					c.stats.Decapsulated[labels.Encapsulation]++
+				}
+			}
 
 			// Parse the packet, extract relevant data and add to the flow log
 			// Note: Since the compiler fails to inline this as a function, it is kept in the main loop
 			if iplayerType := ipLayer.Type(); iplayerType == ipLayerTypeV4 {
-				epHash, direction, errno := ParsePacketV4(ipLayer)
+				epHash, direction, errno := parsePacketV4(ipLayer, c.portAggregation)
 
 				// Check for issues / errors during parsing (checked inline to avoid unnecessary function
 				// call to ParsePacket...())
@@ -284,9 +572,12 @@ func (c *Capture) process() <-chan error {
 				}
 
 				c.stats.Processed++
-				c.addToFlowLogV4(epHash, pktType, pktSize, direction, errno)
+				if c.config.DSCP {
+					labels.DSCP = dscpV4(ipLayer)
+				}
+				c.addToFlowLogV4(epHash, pktType, pktSize, direction, labels)
 			} else if iplayerType == ipLayerTypeV6 {
-				epHash, direction, errno := ParsePacketV6(ipLayer)
+				epHash, direction, errno := parsePacketV6(ipLayer, c.portAggregation)
 
 				// Check for issues / errors during parsing (checked inline to avoid unnecessary function
 				// call to ParsePacket...())
@@ -298,7 +589,10 @@ func (c *Capture) process() <-chan error {
 				}
 
 				c.stats.Processed++
-				c.addToFlowLogV6(epHash, pktType, pktSize, direction, errno)
+				if c.config.DSCP {
+					labels.DSCP = dscpV6(ipLayer)
+				}
+				c.addToFlowLogV6(epHash, pktType, pktSize, direction, labels)
 			} else {
 				c.stats.Processed++
 				c.stats.ParsingErrors[capturetypes.ErrnoInvalidIPHeader]++
@@ -309,6 +603,25 @@ func (c *Capture) process() <-chan error {
 	return captureErrors
 }
 
+// invalidIPLayer denotes the IP layer returned for frames not carrying any (it is accounted for as invalid
+// IP header, just like any other IP layer of unknown version)
+var invalidIPLayer = capture.IPLayer{0}
+
+// nextEthernetFrame fetches the next frame from the source, returning its IP layer along with the MAC
+// addresses of its Ethernet header
+func (c *Capture) nextEthernetFrame() (ipLayer capture.IPLayer, macs capturetypes.MACPair, pktType capture.PacketType, pktSize uint32, err error) {
+	frame, pktType, pktSize, err := c.captureHandle.NextPayloadZeroCopy()
+	if err != nil {
+		return
+	}
+	if len(frame) <= link.IPLayerOffsetEthernet {
+		return invalidIPLayer, macs, pktType, pktSize, nil
+	}
+	copy(macs.Dst[:], frame[0:types.MACWidth])
+	copy(macs.Src[:], frame[types.MACWidth:2*types.MACWidth])
+	return frame[link.IPLayerOffsetEthernet:], macs, pktType, pktSize, nil
+}
+
 func (c *Capture) bufferPackets(buf *LocalBuffer, captureErrors chan error) error {
 
 	// Ensure that the buffer is released at the end of the method
@@ -345,11 +658,18 @@ func (c *Capture) bufferPackets(buf *LocalBuffer, captureErrors chan error) erro
 			break
 		}
 
+		// If enabled, strip any tunnel headers (decapsulated packets are neither counted nor
+		// marked as such during buffering for the same reason as invalid IP header packets,
+		// see below, which equally applies to their VLAN, DSCP and MAC addresses)
+		if c.config.Decapsulation {
+			ipLayer, _ = Decapsulate(ipLayer)
+		}
+
 		// Parse the packet and extract relevant data for future addition to the flow log
 		// Note: Since the compiler fails to inline this as a function, it is kept in the
 		// main buffer loop
 		if iplayerType := ipLayer.Type(); iplayerType == ipLayerTypeV4 {
-			epHash, auxInfo, errno := ParsePacketV4(ipLayer)
+			epHash, auxInfo, errno := parsePacketV4(ipLayer, c.portAggregation)
 
 			// Try to append to local buffer. In case the buffer is full, stop buffering and
 			// wait for the unlock request
@@ -359,7 +679,7 @@ func (c *Capture) bufferPackets(buf *LocalBuffer, captureErrors chan error) erro
 				break
 			}
 		} else if iplayerType == ipLayerTypeV6 {
-			epHash, auxInfo, errno := ParsePacketV6(ipLayer)
+			epHash, auxInfo, errno := parsePacketV6(ipLayer, c.portAggregation)
 
 			// Try to append to local buffer. In case the buffer is full, stop buffering and
 			// wait for the unlock request
@@ -390,10 +710,10 @@ func (c *Capture) bufferPackets(buf *LocalBuffer, captureErrors chan error) erro
 		c.stats.Processed++
 
 		if isIPv4 {
-			c.addToFlowLogV4(capturetypes.EPHashV4(epHash), pktType, pktSize, auxInfo, errno)
+			c.addToFlowLogV4(capturetypes.EPHashV4(epHash), pktType, pktSize, auxInfo, capturetypes.FlowLabels{})
 			continue
 		}
-		c.addToFlowLogV6(capturetypes.EPHashV6(epHash), pktType, pktSize, auxInfo, errno)
+		c.addToFlowLogV6(capturetypes.EPHashV6(epHash), pktType, pktSize, auxInfo, capturetypes.FlowLabels{})
 	}
 
 	// Update the buffer usage gauge for this interface and release the buffer
@@ -413,20 +733,43 @@ func (c *Capture) updateParsingErrorCounters(errno capturetypes.ParsingErrno) {
 	}
 }
 
-func (c *Capture) addToFlowLogV4(epHash capturetypes.EPHashV4, pktType byte, pktSize uint32, auxInfo byte, errno capturetypes.ParsingErrno) {
+// tcpFlagsV4 returns the TCP flags of a packet (zero for non-TCP packets, whose auxiliary information
+// denotes e.g. their ICMP type instead)
+func tcpFlagsV4(epHash capturetypes.EPHashV4, auxInfo byte) types.TCPFlags {
+	if epHash[capturetypes.EPHashV4ProtocolPos] != capturetypes.TCP {
+		return 0
+	}
+	return types.TCPFlags(auxInfo)
+}
+
+// tcpFlagsV6 returns the TCP flags of a packet (see tcpFlagsV4)
+func tcpFlagsV6(epHash capturetypes.EPHashV6, auxInfo byte) types.TCPFlags {
+	if epHash[capturetypes.EPHashV6ProtocolPos] != capturetypes.TCP {
+		return 0
+	}
+	return types.TCPFlags(auxInfo)
+}
+
+func (c *Capture) addToFlowLogV4(epHash capturetypes.EPHashV4, pktType byte, pktSize uint32, auxInfo byte, labels capturetypes.FlowLabels) {
+	pktSize = c.accountedSize(pktSize)
+	var tcpFlags types.TCPFlags
+	if c.config.TCPFlags {
+		tcpFlags = tcpFlagsV4(epHash, auxInfo)
+	}
 
 	// Predict if the packet is most likely to trigger the reverse hash lookup and start with that flow then
+	// (the MAC addresses of the labels being reversed along with the hash)
 	if epHash.IsProbablyReverse() {
 		epHashReverse := epHash.Reverse()
 		if flowToUpdate, existsReverseHash := c.flowLog.flowMapV4[string(epHashReverse[:])]; existsReverseHash {
-			flowToUpdate.UpdateFlow(pktType, pktSize)
+			c.flowLog.touch(flowToUpdate)
+			flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels.Reverse())
 		} else if flowToUpdate, existsHash := c.flowLog.flowMapV4[string(epHash[:])]; existsHash {
-			flowToUpdate.UpdateFlow(pktType, pktSize)
+			c.flowLog.touch(flowToUpdate)
+			flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels)
 		} else {
-			if direction := capturetypes.ClassifyPacketDirectionV4(epHash, auxInfo); direction == capturetypes.DirectionReverts {
-				c.flowLog.flowMapV4[string(epHashReverse[:])] = NewFlow(pktType, pktSize)
-			} else {
-				c.flowLog.flowMapV4[string(epHash[:])] = NewFlow(pktType, pktSize)
+			if c.flowLog.addFlowV4(epHash, epHashReverse, pktType, pktSize, auxInfo, tcpFlags, labels) {
+				c.flowsCreated.Add(1)
 			}
 		}
 		return
@@ -434,35 +777,41 @@ func (c *Capture) addToFlowLogV4(epHash capturetypes.EPHashV4, pktType byte, pkt
 
 	// Update or assign the flow in forward lookup mode first
 	if flowToUpdate, existsHash := c.flowLog.flowMapV4[string(epHash[:])]; existsHash {
-		flowToUpdate.UpdateFlow(pktType, pktSize)
+		c.flowLog.touch(flowToUpdate)
+		flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels)
 	} else {
 		epHashReverse := epHash.Reverse()
 		if flowToUpdate, existsReverseHash := c.flowLog.flowMapV4[string(epHashReverse[:])]; existsReverseHash {
-			flowToUpdate.UpdateFlow(pktType, pktSize)
+			c.flowLog.touch(flowToUpdate)
+			flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels.Reverse())
 		} else {
-			if direction := capturetypes.ClassifyPacketDirectionV4(epHash, auxInfo); direction == capturetypes.DirectionReverts {
-				c.flowLog.flowMapV4[string(epHashReverse[:])] = NewFlow(pktType, pktSize)
-			} else {
-				c.flowLog.flowMapV4[string(epHash[:])] = NewFlow(pktType, pktSize)
+			if c.flowLog.addFlowV4(epHash, epHashReverse, pktType, pktSize, auxInfo, tcpFlags, labels) {
+				c.flowsCreated.Add(1)
 			}
 		}
 	}
 }
 
-func (c *Capture) addToFlowLogV6(epHash capturetypes.EPHashV6, pktType byte, pktSize uint32, auxInfo byte, errno capturetypes.ParsingErrno) {
+func (c *Capture) addToFlowLogV6(epHash capturetypes.EPHashV6, pktType byte, pktSize uint32, auxInfo byte, labels capturetypes.FlowLabels) {
+	pktSize = c.accountedSize(pktSize)
+	var tcpFlags types.TCPFlags
+	if c.config.TCPFlags {
+		tcpFlags = tcpFlagsV6(epHash, auxInfo)
+	}
 
 	// Predict if the packet is most likely to trigger the reverse hash lookup and start with that flow then
+	// (the MAC addresses of the labels being reversed along with the hash)
 	if epHash.IsProbablyReverse() {
 		epHashReverse := epHash.Reverse()
 		if flowToUpdate, existsReverseHash := c.flowLog.flowMapV6[string(epHashReverse[:])]; existsReverseHash {
-			flowToUpdate.UpdateFlow(pktType, pktSize)
+			c.flowLog.touch(flowToUpdate)
+			flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels.Reverse())
 		} else if flowToUpdate, existsHash := c.flowLog.flowMapV6[string(epHash[:])]; existsHash {
-			flowToUpdate.UpdateFlow(pktType, pktSize)
+			c.flowLog.touch(flowToUpdate)
+			flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels)
 		} else {
-			if direction := capturetypes.ClassifyPacketDirectionV6(epHash, auxInfo); direction == capturetypes.DirectionReverts {
-				c.flowLog.flowMapV6[string(epHashReverse[:])] = NewFlow(pktType, pktSize)
-			} else {
-				c.flowLog.flowMapV6[string(epHash[:])] = NewFlow(pktType, pktSize)
+			if c.flowLog.addFlowV6(epHash, epHashReverse, pktType, pktSize, auxInfo, tcpFlags, labels) {
+				c.flowsCreated.Add(1)
 			}
 		}
 		return
@@ -470,22 +819,22 @@ func (c *Capture) addToFlowLogV6(epHash capturetypes.EPHashV6, pktType byte, pkt
 
 	// Update or assign the flow in forward lookup mode first
 	if flowToUpdate, existsHash := c.flowLog.flowMapV6[string(epHash[:])]; existsHash {
-		flowToUpdate.UpdateFlow(pktType, pktSize)
+		c.flowLog.touch(flowToUpdate)
+		flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels)
 	} else {
 		epHashReverse := epHash.Reverse()
 		if flowToUpdate, existsReverseHash := c.flowLog.flowMapV6[string(epHashReverse[:])]; existsReverseHash {
-			flowToUpdate.UpdateFlow(pktType, pktSize)
+			c.flowLog.touch(flowToUpdate)
+			flowToUpdate.UpdateFlow(pktType, pktSize, tcpFlags, labels.Reverse())
 		} else {
-			if direction := capturetypes.ClassifyPacketDirectionV6(epHash, auxInfo); direction == capturetypes.DirectionReverts {
-				c.flowLog.flowMapV6[string(epHashReverse[:])] = NewFlow(pktType, pktSize)
-			} else {
-				c.flowLog.flowMapV6[string(epHash[:])] = NewFlow(pktType, pktSize)
+			if c.flowLog.addFlowV6(epHash, epHashReverse, pktType, pktSize, auxInfo, tcpFlags, labels) {
+				c.flowsCreated.Add(1)
 			}
 		}
 	}
 }
 
-func (c *Capture) status() (*capturetypes.CaptureStats, error) {
+func (c *Capture) status(ctx context.Context) (*capturetypes.CaptureStats, error) {
 
 	stats, err := c.captureHandle.Stats()
 	if err != nil {
@@ -495,17 +844,38 @@ func (c *Capture) status() (*capturetypes.CaptureStats, error) {
 	c.stats.ReceivedTotal += stats.PacketsReceived
 	c.stats.ProcessedTotal += c.stats.Processed
 	c.stats.DroppedTotal += stats.PacketsDropped
+	c.stats.QueueFreezesTotal += stats.QueueFreezes
+
+	// Tracking the time of each individual packet would be too costly, hence any packet processed
+	// since the previous rotation / status call is attributed to the current time
+	if c.stats.Processed > 0 {
+		c.stats.LastPacketAt = time.Now()
+	}
+
+	// Diagnose likely capture misconfigurations based on the parsing errors within the recent past
+	c.health.observe(time.Now(), c.stats.Processed, c.stats.ParsingErrors)
+	diagnostics := c.health.diagnose(c.captureLengths())
+	c.health.logTransitions(ctx, diagnostics)
 
 	// Add exposed metrics
 	// We do this only upon rotation and / or explicit status call in order not to interfere
 	// with the main packet processing loop (or introduce race conditions). If this counter
 	// moves slowly (as in gets gets an update only every ~5 minutes) it's not an issue to
 	// understand processed data volumes across longer time frames
-	go func(iface string, processed, dropped uint64, captureIssues capturetypes.ParsingErrTracker) {
+	var nonIP *capturetypes.NonIPTracker
+	if c.nonIP != nil {
+		counts := c.nonIP.fetch()
+		nonIP = &counts
+	}
+
+	go func(iface string, processed, dropped uint64, captureIssues capturetypes.ParsingErrTracker, decapsulated capturetypes.DecapsulationTracker, nonIP *capturetypes.NonIPTracker, lastPacketAt time.Time) {
 
 		// Count total packet stats
 		promPacketsProcessed.WithLabelValues(iface).Add(float64(processed))
 		promPacketsDropped.WithLabelValues(iface).Add(float64(dropped))
+		if !lastPacketAt.IsZero() {
+			promLastPacket.WithLabelValues(iface).Set(float64(lastPacketAt.Unix()))
+		}
 
 		// Count the individual packet parsing issues / errors (note that this operates on a copy
 		// of the provided ParsingErrTracker which is unaffected by the Reset() performed on the original
@@ -513,21 +883,44 @@ func (c *Capture) status() (*capturetypes.CaptureStats, error) {
 		for i := capturetypes.ErrnoPacketFragmentIgnore; i < capturetypes.NumParsingErrors; i++ {
 			promCaptureIssues.WithLabelValues(iface, i.String()).Add(float64(captureIssues[i]))
 		}
-	}(c.iface, c.stats.Processed, stats.PacketsDropped, c.stats.ParsingErrors)
+
+		// Count the decapsulated packets per encapsulation type (if any)
+		if decapsulated.Sum() > 0 {
+			for i := capturetypes.EncapGRE; i < capturetypes.NumEncapsulations; i++ {
+				promPacketsDecapsulated.WithLabelValues(iface, i.String()).Add(float64(decapsulated[i]))
+			}
+		}
+
+		// Count the frames not carrying an IP layer per type (if enabled)
+		if nonIP != nil {
+			for i := capturetypes.NonIPARP; i < capturetypes.NumNonIPTypes; i++ {
+				promFramesNonIP.WithLabelValues(iface, i.String()).Add(float64(nonIP[i]))
+			}
+		}
+	}(c.iface, c.stats.Processed, stats.PacketsDropped, c.stats.ParsingErrors, c.stats.Decapsulated, nonIP, c.stats.LastPacketAt)
 
 	res := capturetypes.CaptureStats{
-		StartedAt:      c.startedAt,
-		Received:       stats.PacketsReceived,
-		ReceivedTotal:  c.stats.ReceivedTotal,
-		Processed:      c.stats.Processed,
-		ProcessedTotal: c.stats.ProcessedTotal,
-		Dropped:        stats.PacketsDropped,
-		DroppedTotal:   c.stats.DroppedTotal,
-		ParsingErrors:  c.stats.ParsingErrors,
+		StartedAt:         c.startedAt,
+		Received:          stats.PacketsReceived,
+		ReceivedTotal:     c.stats.ReceivedTotal,
+		Processed:         c.stats.Processed,
+		ProcessedTotal:    c.stats.ProcessedTotal,
+		Dropped:           stats.PacketsDropped,
+		DroppedTotal:      c.stats.DroppedTotal,
+		QueueFreezes:      stats.QueueFreezes,
+		QueueFreezesTotal: c.stats.QueueFreezesTotal,
+		ParsingErrors:     c.stats.ParsingErrors,
+		Diagnostics:       diagnostics,
+		Decapsulated:      c.stats.Decapsulated,
+		NonIP:             nonIP,
+		LastPacketAt:      c.stats.LastPacketAt,
+		Parameters:        c.parameters(),
 	}
+	res.FlowsCreated, res.FlowsCreatedTotal = c.flowCounts()
 
 	c.stats.Processed = 0
 	c.stats.ParsingErrors.Reset()
+	c.stats.Decapsulated.Reset()
 
 	return &res, nil
 }
@@ -538,10 +931,14 @@ func (c *Capture) fetchStatusInBackground(ctx context.Context) (res chan *captur
 	// Extract capture stats in a separate goroutine to minimize time-to-unblock
 	// This should be finished by the time the rotation has taken place (at which
 	// time the stats can be pulled from the returned channel)
+	// The flow counts are determined upfront since the rotation resets them concurrently
+	sinceRotation, total := c.flowCounts()
 	go func() {
-		stats, err := c.status()
+		stats, err := c.status(ctx)
 		if err != nil {
-			logging.FromContext(ctx).Errorf("failed to get capture stats: %v", err)
+			logs.FromContext(ctx, logs.ModuleCapture).Errorf("failed to get capture stats: %v", err)
+		} else {
+			stats.FlowsCreated, stats.FlowsCreatedTotal = sinceRotation, total
 		}
 
 		res <- stats
@@ -3,21 +3,37 @@ package capture
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/els0r/goProbe/cmd/goProbe/config"
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/cgroup"
+	"github.com/els0r/goProbe/pkg/export/netflow"
 	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/goprobe/socktrack"
 	"github.com/els0r/goProbe/pkg/goprobe/writeout"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/els0r/telemetry/logging"
 	"github.com/fako1024/gotools/concurrency"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-const allowedWriteoutDurationFraction = 0.1
+const (
+	allowedWriteoutDurationFraction = 0.1
+
+	// number of consecutive writeouts during which the rotation was blocked by a full writeout
+	// channel before writeouts are considered to be persistently congested
+	congestedWriteoutsThreshold = 3
+)
 
 // Manager manages a set of Capture instances.
 // Each interface can be associated with up to one Capture.
@@ -33,9 +49,35 @@ type Manager struct {
 	lastRotation time.Time
 	startedAt    time.Time
 
+	// number of consecutive writeouts blocked by a full writeout channel (accessed atomically, since
+	// it is read by health checks, which must not block on the manager lock held during writeouts)
+	stalledWriteouts atomic.Int64
+
+	// interfaces whose rotation was deferred to the next writeout due to persistent congestion
+	deferredIfaces []string
+
 	skipWriteoutSchedule bool
 
+	// in standby, configuration updates are retained without starting any captures (e.g. while
+	// another probe is capturing, c.f. Standby() / Activate())
+	standby bool
+
+	// optional guard run before each writeout, skipping the latter if it fails (e.g. if another
+	// probe may have taken over capturing)
+	writeoutGuard func(ctx context.Context) error
+
 	localBufferPool *LocalBufferPool
+
+	// flows handed over by another process (e.g. during a binary upgrade), which are merged
+	// into the next writeout of the respective interface
+	replayedFlows map[string]capturetypes.TaggedAggFlowMap
+
+	// optional cache of the DB metadata used by queries, kept up to date by the writeouts
+	metadataCache *goDB.MetadataCache
+
+	// optional NetFlow-style flow record tracking (along with the handlers of expired records)
+	flowTimeouts       *FlowTimeouts
+	flowRecordHandlers []FlowRecordHandler
 }
 
 // InitManager initializes a CaptureManager and the underlying writeout logic
@@ -52,13 +94,103 @@ func InitManager(ctx context.Context, config *config.Config, opts ...ManagerOpti
 		dbPermissions = config.DB.Permissions
 	}
 
+	// Setup the (optional) filters of the individual writeout sinks
+	var dbFilter, syslogFilter *node.FlowFilter
+	if config.DB.Filter != "" {
+		if dbFilter, err = node.NewFlowFilter(config.DB.Filter); err != nil {
+			return nil, fmt.Errorf("failed to set up database filter: %w", err)
+		}
+	}
+	if config.SyslogFilter != "" {
+		if syslogFilter, err = node.NewFlowFilter(config.SyslogFilter); err != nil {
+			return nil, fmt.Errorf("failed to set up syslog filter: %w", err)
+		}
+	}
+
+	// Setup the (optional) flow tagger, registering its tags with the DB
+	var tagger *node.Tagger
+	if len(config.DB.Tags) > 0 {
+		if tagger, err = newTagger(config.DB.Path, dbPermissions, config.DB.Tags); err != nil {
+			return nil, fmt.Errorf("failed to set up flow tagger: %w", err)
+		}
+	}
+
+	// Setup the (optional) attribution of flows to local processes, tracking their sockets in the background
+	var processes *writeout.ProcessAttribution
+	if config.ProcessAttribution != nil {
+		if processes, err = newProcessAttribution(ctx, config.DB.Path, config.ProcessAttribution); err != nil {
+			return nil, fmt.Errorf("failed to set up process attribution: %w", err)
+		}
+	}
+
+	// Setup the (optional) top talker metrics
+	var topTalkers *writeout.TopTalkers
+	if config.TopTalkers != nil {
+		if topTalkers, err = writeout.NewTopTalkers(config.TopTalkers.K, config.TopTalkers.Labels...); err != nil {
+			return nil, fmt.Errorf("failed to set up top talkers: %w", err)
+		}
+		if err = prometheus.Register(topTalkers); err != nil {
+			return nil, fmt.Errorf("failed to register top talker metrics: %w", err)
+		}
+	}
+
+	// Setup the (optional) export of the flows to a NetFlow / IPFIX collector
+	var (
+		netflowExporter *netflow.Exporter
+		netflowFilter   *node.FlowFilter
+	)
+	if config.NetFlow != nil {
+		if config.NetFlow.Filter != "" {
+			if netflowFilter, err = node.NewFlowFilter(config.NetFlow.Filter); err != nil {
+				return nil, fmt.Errorf("failed to set up NetFlow filter: %w", err)
+			}
+		}
+		if netflowExporter, err = netflow.New(config.NetFlow.Collector,
+			netflow.WithVersion(netflow.Version(config.NetFlow.Version)),
+			netflow.WithMaxMessageSize(config.NetFlow.MaxMessageSize),
+		); err != nil {
+			return nil, fmt.Errorf("failed to set up NetFlow exporter: %w", err)
+		}
+	}
+
+	// Setup the (optional) metadata cache used by the query API
+	var metadataCache *goDB.MetadataCache
+	if config.API != nil && config.API.MetadataCache != nil {
+		metadataCache = goDB.NewMetadataCache(config.API.MetadataCache.MaxDirs)
+	}
+
 	// Initialize the DB writeout handler
 	writeoutHandler := writeout.NewGoDBHandler(config.DB.Path, encoderType).
+		WithEncoderLevel(config.DB.EncoderLevel).
+		WithAdaptiveEncoding(config.DB.AdaptiveEncoding.AdaptiveEncoding()).
+		WithBlockFrames(config.DB.BlockFrames).
 		WithSyslogWriting(config.SyslogFlows).
-		WithPermissions(dbPermissions)
+		WithPermissions(dbPermissions).
+		WithManifest(config.DB.Manifest).
+		WithQuotas(config.DB.Quotas.Quotas()...).
+		WithRetention(config.DB.Retention.Limits()).
+		WithMinFreeSpace(uint64(config.DB.MinFreeSpace)).
+		WithQuotaInterval(config.DB.QuotaInterval).
+		WithFilter(dbFilter).
+		WithSyslogFilter(syslogFilter).
+		WithTagger(tagger).
+		WithProcessAttribution(processes).
+		WithTopTalkers(topTalkers).
+		WithNetFlowExporter(netflowExporter).
+		WithNetFlowFilter(netflowFilter).
+		WithMetadataCache(metadataCache)
+
+	// Setup the (optional) flow records, preceding any options of the caller (e.g. adding handlers)
+	if config.FlowRecords != nil {
+		opts = append([]ManagerOption{WithFlowRecords(FlowTimeouts{
+			Active: config.FlowRecords.ActiveTimeout,
+			Idle:   config.FlowRecords.IdleTimeout,
+		})}, opts...)
+	}
 
 	// Initialize the CaptureManager
 	captureManager := NewManager(writeoutHandler, opts...)
+	captureManager.metadataCache = metadataCache
 
 	// Initialize local buffer
 	if err := captureManager.setLocalBuffers(); err != nil {
@@ -82,6 +214,50 @@ func InitManager(ctx context.Context, config *config.Config, opts ...ManagerOpti
 	return captureManager, nil
 }
 
+// newTagger registers the configured flow tags with the registry stored in the DB (retaining the bits of
+// all previously registered tags) and sets up a tagger evaluating them
+func newTagger(dbPath string, permissions fs.FileMode, tags config.Tags) (*node.Tagger, error) {
+	registry, err := info.ReadTagRegistry(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]node.TagDefinition, 0, len(tags))
+	for _, tag := range tags {
+		bit, err := registry.Register(tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, node.TagDefinition{Name: tag.Name, Bit: bit, Condition: tag.Condition})
+	}
+
+	tagger, err := node.NewTagger(defs...)
+	if err != nil {
+		return nil, err
+	}
+	if err := registry.Write(dbPath, permissions); err != nil {
+		return nil, fmt.Errorf("failed to store flow tags: %w", err)
+	}
+	return tagger, nil
+}
+
+// newProcessAttribution sets up a socket tracker (running until the context is cancelled) and attributes
+// flows to the processes owning their sockets, extending the registry of process labels stored in the DB
+func newProcessAttribution(ctx context.Context, dbPath string, cfg *config.ProcessAttributionConfig) (*writeout.ProcessAttribution, error) {
+	tracker, err := socktrack.New(socktrack.WithPollInterval(cfg.PollInterval))
+	if err != nil {
+		return nil, err
+	}
+	registry, err := info.ReadProcessRegistry(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	go tracker.Run(ctx)
+
+	return writeout.NewProcessAttribution(tracker, registry, cfg.Ifaces...), nil
+}
+
 // NewManager creates a new CaptureManager
 func NewManager(writeoutHandler writeout.Handler, opts ...ManagerOption) *Manager {
 	captureManager := &Manager{
@@ -89,8 +265,9 @@ func NewManager(writeoutHandler writeout.Handler, opts ...ManagerOption) *Manage
 		writeoutHandler: writeoutHandler,
 		sourceInitFn:    defaultSourceInitFn,
 
-		// This is explicit here to ensure that each manager by default has its own memory pool (unless injected)
-		localBufferPool: NewLocalBufferPool(1, config.DefaultLocalBufferSizeLimit),
+		// This is explicit here to ensure that each manager by default has its own memory pool (unless injected),
+		// sized according to the memory limit of the control group (if any)
+		localBufferPool: NewLocalBufferPool(1, config.DefaultLocalBufferSize(cgroup.Current().MemoryBytes)),
 	}
 	for _, opt := range opts {
 		opt(captureManager)
@@ -108,6 +285,27 @@ func (cm *Manager) LastRotation() (t time.Time) {
 	return
 }
 
+// MetadataCache returns the cache of the DB metadata kept up to date by the writeouts (nil if
+// caching is disabled)
+func (cm *Manager) MetadataCache() *goDB.MetadataCache {
+	return cm.metadataCache
+}
+
+// WriteoutCongested returns whether writeouts are persistently congested, i.e. if the rotation
+// was blocked by a full writeout channel during several consecutive writeouts
+func (cm *Manager) WriteoutCongested() bool {
+	return cm.stalledWriteouts.Load() >= congestedWriteoutsThreshold
+}
+
+// HealthCheck reports warnings about the state of the capture manager (e.g. persistently
+// congested writeouts). It can be used as an API health check
+func (cm *Manager) HealthCheck(_ context.Context) (warnings []string) {
+	if stalledWriteouts := cm.stalledWriteouts.Load(); stalledWriteouts >= congestedWriteoutsThreshold {
+		warnings = append(warnings, fmt.Sprintf("writeouts congested: rotation blocked by full writeout channel during the last %d writeouts", stalledWriteouts))
+	}
+	return
+}
+
 // StartedAt returns the timestamp when the capture manager was initialized
 func (cm *Manager) StartedAt() (t time.Time) {
 	cm.RLock()
@@ -132,7 +330,7 @@ func (cm *Manager) GetTimestamps() (startedAt, lastRotation time.Time) {
 // intervals
 func (cm *Manager) ScheduleWriteouts(ctx context.Context, interval time.Duration) {
 	go func() {
-		logger := logging.FromContext(ctx)
+		logger := logs.FromContext(ctx, logs.ModuleCapture)
 
 		// wait until the next 5 minute interval of the hour is reached before starting the ticker
 		tNow := time.Now()
@@ -191,6 +389,22 @@ func WithSkipWriteoutSchedule(skip bool) ManagerOption {
 	}
 }
 
+// WithStandby starts the capture manager in standby, i.e. without starting any captures until it
+// is activated (c.f. Activate())
+func WithStandby(standby bool) ManagerOption {
+	return func(cm *Manager) {
+		cm.standby = standby
+	}
+}
+
+// WithWriteoutGuard sets a guard run before each writeout. If it fails, the writeout is skipped and
+// the flows are retained until the next one
+func WithWriteoutGuard(guard func(ctx context.Context) error) ManagerOption {
+	return func(cm *Manager) {
+		cm.writeoutGuard = guard
+	}
+}
+
 // WithLocalBuffers sets one or multiple local buffers for the capture manager
 func WithLocalBuffers(nBuffers, sizeLimit int) ManagerOption {
 	return func(cm *Manager) {
@@ -199,6 +413,158 @@ func WithLocalBuffers(nBuffers, sizeLimit int) ManagerOption {
 	}
 }
 
+// WithFlowRecords enables tracking NetFlow-style flow records delimited by active / idle timeouts on
+// all interfaces (in addition to the writeouts, which are unaffected)
+func WithFlowRecords(timeouts FlowTimeouts) ManagerOption {
+	return func(cm *Manager) {
+		cm.flowTimeouts = &timeouts
+	}
+}
+
+// WithFlowRecordHandler adds a handler receiving all expired flow records (if flow records are enabled
+// via WithFlowRecords)
+func WithFlowRecordHandler(handler FlowRecordHandler) ManagerOption {
+	return func(cm *Manager) {
+		cm.flowRecordHandlers = append(cm.flowRecordHandlers, handler)
+	}
+}
+
+// ReplayFlows merges flows handed over by another process (e.g. during a binary upgrade) into the
+// next writeout of the respective interface
+func (cm *Manager) ReplayFlows(flows ...capturetypes.TaggedAggFlowMap) {
+	cm.Lock()
+	cm.replayFlows(flows...)
+	cm.Unlock()
+}
+
+func (cm *Manager) replayFlows(flows ...capturetypes.TaggedAggFlowMap) {
+	if cm.replayedFlows == nil {
+		cm.replayedFlows = make(map[string]capturetypes.TaggedAggFlowMap)
+	}
+	for _, flow := range flows {
+		if flow.Map == nil {
+			continue
+		}
+		if replayed, exists := cm.replayedFlows[flow.Iface]; exists {
+			flow.Map.Merge(*replayed.Map)
+			flow.Attributes.Merge(replayed.Attributes)
+			addCaptureStats(&flow.Stats, &replayed.Stats)
+		}
+		cm.replayedFlows[flow.Iface] = flow
+	}
+}
+
+// mergeReplayedFlows merges the replayed flows of an interface (if any) into a rotation result
+// (the caller must hold the lock)
+func (cm *Manager) mergeReplayedFlows(taggedMap *capturetypes.TaggedAggFlowMap) {
+	replayed, exists := cm.replayedFlows[taggedMap.Iface]
+	if !exists {
+		return
+	}
+	delete(cm.replayedFlows, taggedMap.Iface)
+
+	if taggedMap.Map == nil {
+		taggedMap.Map = replayed.Map
+	} else {
+		taggedMap.Map.Merge(*replayed.Map)
+	}
+	taggedMap.Attributes.Merge(replayed.Attributes)
+	addCaptureStats(&taggedMap.Stats, &replayed.Stats)
+}
+
+// flushReplayedFlows sends the replayed flows of all interfaces that are not captured (anymore)
+// on the provided channel (the caller must hold the lock)
+func (cm *Manager) flushReplayedFlows(flowsChan chan<- capturetypes.TaggedAggFlowMap) {
+	for iface, replayed := range cm.replayedFlows {
+		if _, exists := cm.captures.Get(iface); exists {
+			continue
+		}
+		delete(cm.replayedFlows, iface)
+		flowsChan <- replayed
+	}
+}
+
+func addCaptureStats(a, b *capturetypes.CaptureStats) {
+	capturetypes.AddStats(a, b)
+	a.Processed += b.Processed
+}
+
+// Handover stops all captures without writing out their flows. Instead, the flows captured since
+// the last writeout (including any replayed ones) are returned so that they can be handed over to
+// another process (e.g. during a binary upgrade), which continues capturing
+func (cm *Manager) Handover(ctx context.Context) []capturetypes.TaggedAggFlowMap {
+
+	logger, t0 := logs.FromContext(ctx, logs.ModuleCapture), time.Now()
+
+	cm.Lock()
+	defer cm.Unlock()
+
+	ifaces := cm.captures.Ifaces()
+
+	flowsChan := make(chan capturetypes.TaggedAggFlowMap, len(ifaces)+len(cm.replayedFlows))
+	cm.rotate(ctx, flowsChan, false, ifaces...)
+	cm.closeCaptures(ctx, capturetypes.FromIfaceNames(ifaces))
+	cm.flushReplayedFlows(flowsChan)
+	close(flowsChan)
+
+	flows := make([]capturetypes.TaggedAggFlowMap, 0, len(flowsChan))
+	for flow := range flowsChan {
+		if flow.Map != nil {
+			flows = append(flows, flow)
+		}
+	}
+
+	logger.With(
+		"elapsed", time.Since(t0).Round(time.Millisecond).String(),
+		"ifaces", ifaces,
+	).Info("stopped interfaces for handover")
+
+	return flows
+}
+
+// Standby stops all captures and discards the flows captured since the last writeout (including any
+// replayed ones), e.g. because another probe has taken over capturing. Configuration updates are
+// retained, but not applied before the capture manager is activated again
+func (cm *Manager) Standby(ctx context.Context) {
+
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
+
+	cm.Lock()
+	defer cm.Unlock()
+
+	ifaces := cm.captures.Ifaces()
+	cm.standby = true
+	cm.closeCaptures(ctx, capturetypes.FromIfaceNames(ifaces))
+	cm.replayedFlows = nil
+
+	logger.With("ifaces", ifaces).Info("stopped interfaces for standby")
+}
+
+// Activate starts the captures of the last applied configuration if the capture manager is in
+// standby (and does nothing otherwise)
+func (cm *Manager) Activate(ctx context.Context) error {
+	cm.Lock()
+	if !cm.standby {
+		cm.Unlock()
+		return nil
+	}
+	cm.standby = false
+	ifaces := cm.lastAppliedConfig
+	cm.Unlock()
+
+	_, _, _, err := cm.Update(ctx, ifaces)
+	return err
+}
+
+// IsStandby returns whether the capture manager is in standby
+func (cm *Manager) IsStandby() (standby bool) {
+	cm.RLock()
+	standby = cm.standby
+	cm.RUnlock()
+
+	return
+}
+
 // Config returns the runtime config of the capture manager for all (or a set of) interfaces
 func (cm *Manager) Config(ifaces ...string) (ifaceConfigs config.Ifaces) {
 	cm.RLock()
@@ -223,7 +589,7 @@ func (cm *Manager) Config(ifaces ...string) (ifaceConfigs config.Ifaces) {
 // Status fetches the current capture stats from all (or a set of) interfaces
 func (cm *Manager) Status(ctx context.Context, ifaces ...string) (statusmap capturetypes.InterfaceStats) {
 
-	logger, t0 := logging.FromContext(ctx), time.Now()
+	logger, t0 := logs.FromContext(ctx, logs.ModuleCapture), time.Now()
 
 	statusmap = make(capturetypes.InterfaceStats)
 
@@ -250,7 +616,7 @@ func (cm *Manager) Status(ctx context.Context, ifaces ...string) (statusmap capt
 
 		// Lock the running capture
 		if err := mc.capLock.Lock(); err != nil {
-			logger := logging.FromContext(runCtx)
+			logger := logs.FromContext(runCtx, logs.ModuleCapture)
 			logger.Errorf("failed to establish status call three-point lock: %s", err)
 			if err := mc.close(); err != nil {
 				logger.Errorf("failed to close capture after failed three-point lock: %s", err)
@@ -262,9 +628,9 @@ func (cm *Manager) Status(ctx context.Context, ifaces ...string) (statusmap capt
 
 		// Since the capture is locked we can safely extract the (capture) status
 		// from the individual interfaces (and unlock no matter what)
-		status, err := mc.status()
+		status, err := mc.status(runCtx)
 		if lErr := mc.capLock.Unlock(); lErr != nil {
-			logger := logging.FromContext(runCtx)
+			logger := logs.FromContext(runCtx, logs.ModuleCapture)
 			logger.Errorf("failed to release status call three-point lock: %s", err)
 			if err := mc.close(); err != nil {
 				logger.Errorf("failed to close capture after failed three-point lock: %s", err)
@@ -273,7 +639,7 @@ func (cm *Manager) Status(ctx context.Context, ifaces ...string) (statusmap capt
 		}
 
 		if err != nil {
-			logging.FromContext(runCtx).Errorf("failed to get capture stats: %s", err)
+			logs.FromContext(runCtx, logs.ModuleCapture).Errorf("failed to get capture stats: %s", err)
 			return
 		}
 
@@ -296,7 +662,18 @@ func (cm *Manager) Update(ctx context.Context, ifaces config.Ifaces) (enabled, u
 		return
 	}
 
-	logger, t0 := logging.FromContext(ctx), time.Now()
+	logger, t0 := logs.FromContext(ctx, logs.ModuleCapture), time.Now()
+
+	// Persist the network zones of the interfaces (if supported by the writeout handler), so that
+	// they are available to queries
+	if zoneWriter, ok := cm.writeoutHandler.(writeout.ZoneWriter); ok {
+		if err := zoneWriter.WriteZones(ifaces.Zones()); err != nil {
+			logger.Errorf("failed to store interface zones: %v", err)
+		}
+	}
+	if accountingRecorder, ok := cm.writeoutHandler.(writeout.ByteAccountingRecorder); ok {
+		accountingRecorder.SetByteAccounting(ifaces.ByteAccounting())
+	}
 
 	// Build set of interfaces to enable / disable
 	var (
@@ -305,6 +682,13 @@ func (cm *Manager) Update(ctx context.Context, ifaces config.Ifaces) (enabled, u
 	)
 
 	cm.Lock()
+	if cm.standby {
+		cm.lastAppliedConfig = ifaces
+		cm.Unlock()
+
+		logger.With("ifaces", len(ifaces)).Info("stored interface configuration (standby)")
+		return nil, nil, nil, nil
+	}
 	for iface, cfg := range ifaces {
 		ifaceSet[iface] = struct{}{}
 		if _, exists := cm.captures.Get(iface); !exists {
@@ -332,6 +716,11 @@ func (cm *Manager) Update(ctx context.Context, ifaces config.Ifaces) (enabled, u
 
 	cm.update(ctx, ifaces, enable, disable)
 
+	// The results (and pre-validation warnings) of the interfaces enabled / updated are reported
+	// via the combined list, which does not necessarily share its backing array
+	copy(enableIfaces, enable)
+	copy(updateIfaces, enable[len(enableIfaces):])
+
 	logger.With(
 		"elapsed", time.Since(t0).Round(time.Millisecond).String(),
 		slog.Group("ifaces",
@@ -361,45 +750,33 @@ func (cm *Manager) update(ctx context.Context, ifaces config.Ifaces, enable, dis
 	cm.lastAppliedConfig = ifaces
 
 	// Disable any interfaces present in the negative list
-	var rg RunGroup
-	for i, iface := range disable {
-		iface := iface
-
-		mc, exists := cm.captures.Get(iface.Name)
-		if !exists {
-			continue
-		}
-		rg.Run(func() {
-
-			runCtx := withIfaceContext(ctx, mc.iface)
-
-			logger := logging.FromContext(runCtx)
-			logger.Info("closing capture / stopping packet processing")
-			if err := mc.close(); err != nil {
-				logger.Errorf("failed to close capture during config update: %s", err)
-			} else {
-				disable[i].Success = true
-			}
-
-			cm.captures.Delete(mc.iface)
-		})
-	}
-	rg.Wait()
+	cm.closeCaptures(ctx, disable)
 
 	// Enable any interfaces present in the positive list
+	var rg RunGroup
 	for i, iface := range enable {
 		iface := iface
 
 		rg.Run(func() {
 
 			runCtx := withIfaceContext(ctx, iface.Name)
-			logger := logging.FromContext(runCtx)
+			logger := logs.FromContext(runCtx, logs.ModuleCapture)
 
 			logger.Info("initializing capture / running packet processing")
 
+			warnings, disabledOffloads := prevalidate(runCtx, iface.Name, ifaces[iface.Name])
+			enable[i].Warnings = warnings
+
 			newCap := newCapture(iface.Name, ifaces[iface.Name]).SetSourceInitFn(cm.sourceInitFn)
+			newCap.disabledOffloads = disabledOffloads
+			if cm.flowTimeouts != nil {
+				newCap.SetFlowRecords(*cm.flowTimeouts, cm.flowRecordHandlers...)
+			}
 			if err := newCap.run(cm.localBufferPool); err != nil {
 				logger.Errorf("failed to start capture: %s", err)
+				if err := newCap.restoreOffloads(); err != nil {
+					logger.Error(err)
+				}
 				return
 			}
 			enable[i].Success = true
@@ -407,7 +784,8 @@ func (cm *Manager) update(ctx context.Context, ifaces config.Ifaces, enable, dis
 			// Start up processing and error handling / logging in the
 			// background
 			errChan := newCap.process()
-			go cm.logErrors(runCtx, iface.Name, errChan)
+			go cm.logErrors(runCtx, newCap, errChan)
+			newCap.startFlowRecords()
 
 			cm.captures.Set(iface.Name, newCap)
 		})
@@ -415,11 +793,39 @@ func (cm *Manager) update(ctx context.Context, ifaces config.Ifaces, enable, dis
 	rg.Wait()
 }
 
+// closeCaptures closes all interfaces in the list (the caller must hold the lock)
+func (cm *Manager) closeCaptures(ctx context.Context, disable capturetypes.IfaceChanges) {
+	var rg RunGroup
+	for i, iface := range disable {
+		iface := iface
+
+		mc, exists := cm.captures.Get(iface.Name)
+		if !exists {
+			continue
+		}
+		rg.Run(func() {
+
+			runCtx := withIfaceContext(ctx, mc.iface)
+
+			logger := logs.FromContext(runCtx, logs.ModuleCapture)
+			logger.Info("closing capture / stopping packet processing")
+			if err := mc.close(); err != nil {
+				logger.Errorf("failed to close capture: %s", err)
+			} else {
+				disable[i].Success = true
+			}
+
+			cm.captures.Delete(mc.iface)
+		})
+	}
+	rg.Wait()
+}
+
 // GetFlowMaps extracts a copy of all active flows and sends them on the provided channel (compatible with normal query
 // processing). This way, live data can be added to a query result
 func (cm *Manager) GetFlowMaps(ctx context.Context, filterFn goDB.FilterFn, writeoutChan chan<- hashmap.AggFlowMapWithMetadata, ifaces ...string) {
 
-	logger, t0 := logging.FromContext(ctx), time.Now()
+	logger, t0 := logs.FromContext(ctx, logs.ModuleCapture), time.Now()
 
 	// Build list of interfaces to process (either from all interfaces or from explicit list)
 	// If none are provided / are available, return empty map
@@ -433,25 +839,10 @@ func (cm *Manager) GetFlowMaps(ctx context.Context, filterFn goDB.FilterFn, writ
 
 			runCtx := withIfaceContext(ctx, mc.iface)
 
-			// Lock the running capture and perform the rotation
-			if err := mc.capLock.Lock(); err != nil {
-				logger := logging.FromContext(runCtx)
-				logger.Errorf("failed to establish GetFlowMaps three-point lock: %s", err)
-				if err := mc.close(); err != nil {
-					logger.Errorf("failed to close capture after failed three-point lock: %s", err)
-				}
-				cm.captures.Delete(mc.iface)
-				continue
-			}
-			flowMap := mc.flowMap(runCtx)
-			if err := mc.capLock.Unlock(); err != nil {
-				logger := logging.FromContext(runCtx)
-				logger.Errorf("failed to release GetFlowMaps three-point lock: %s", err)
-				if err := mc.close(); err != nil {
-					logger.Errorf("failed to close capture after failed three-point lock: %s", err)
-				}
-				cm.captures.Delete(mc.iface)
-			}
+			var flowMap *hashmap.AggFlowMap
+			cm.withLockedCapture(runCtx, "GetFlowMaps", mc, func() {
+				flowMap = mc.flowMap(runCtx)
+			})
 
 			if flowMap != nil {
 				if filterFn != nil {
@@ -472,10 +863,55 @@ func (cm *Manager) GetFlowMaps(ctx context.Context, filterFn goDB.FilterFn, writ
 	).Debug("fetched flow maps")
 }
 
+// GetTaggedFlowMaps extracts a copy of all active flows along with the attributes recorded for them
+// beyond their counters (e.g. in order to replicate them to a standby probe)
+func (cm *Manager) GetTaggedFlowMaps(ctx context.Context, ifaces ...string) (flows []capturetypes.TaggedAggFlowMap) {
+	for _, iface := range cm.captures.Ifaces(ifaces...) {
+		mc, exists := cm.captures.Get(iface)
+		if !exists {
+			continue
+		}
+
+		var flow capturetypes.TaggedAggFlowMap
+		cm.withLockedCapture(withIfaceContext(ctx, mc.iface), "GetTaggedFlowMaps", mc, func() {
+			flow.Map, flow.Attributes = mc.taggedFlowMap()
+		})
+		if flow.Map != nil {
+			flow.Iface = iface
+			flows = append(flows, flow)
+		}
+	}
+
+	return
+}
+
+// withLockedCapture calls fn while holding the lock of a running capture. If the lock cannot be
+// established / released, the capture is closed (fn not being called in the former case)
+func (cm *Manager) withLockedCapture(ctx context.Context, op string, mc *Capture, fn func()) {
+	if err := mc.capLock.Lock(); err != nil {
+		logger := logs.FromContext(ctx, logs.ModuleCapture)
+		logger.Errorf("failed to establish %s three-point lock: %s", op, err)
+		if err := mc.close(); err != nil {
+			logger.Errorf("failed to close capture after failed three-point lock: %s", err)
+		}
+		cm.captures.Delete(mc.iface)
+		return
+	}
+	fn()
+	if err := mc.capLock.Unlock(); err != nil {
+		logger := logs.FromContext(ctx, logs.ModuleCapture)
+		logger.Errorf("failed to release %s three-point lock: %s", op, err)
+		if err := mc.close(); err != nil {
+			logger.Errorf("failed to close capture after failed three-point lock: %s", err)
+		}
+		cm.captures.Delete(mc.iface)
+	}
+}
+
 // Close stops / closes all (or a set of) interfaces
 func (cm *Manager) Close(ctx context.Context, ifaces ...string) {
 
-	logger, t0 := logging.FromContext(ctx), time.Now()
+	logger, t0 := logs.FromContext(ctx, logs.ModuleCapture), time.Now()
 
 	// Build list of interfaces to process (either from all interfaces or from explicit list)
 	if ifaces = cm.captures.Ifaces(ifaces...); len(ifaces) == 0 {
@@ -496,9 +932,14 @@ func withIfaceContext(ctx context.Context, iface string) context.Context {
 	return logging.WithFields(ctx, slog.String("iface", iface))
 }
 
-func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.TaggedAggFlowMap, ifaces ...string) {
+// rotate rotates the interfaces and puts their flow maps on the writeout channel, returning whether the
+// rotation was stalled by a full writeout channel. If deferrable, the rotation of the remaining interfaces
+// is deferred to the next writeout once the writeout channel is full (instead of blocking until the writer
+// has caught up). Interfaces deferred by the previous writeout are rotated first and never deferred twice
+// in a row
+func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.TaggedAggFlowMap, deferrable bool, ifaces ...string) (stalled bool) {
 
-	logger, t0 := logging.FromContext(ctx), time.Now()
+	logger, t0 := logs.FromContext(ctx, logs.ModuleCapture), time.Now()
 
 	// Build list of interfaces to process (either from all interfaces or from explicit list)
 	// If none are provided / are available, return empty map
@@ -506,6 +947,24 @@ func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.
 		return
 	}
 
+	var deferred []string
+	if deferrable {
+		deferred, cm.deferredIfaces = cm.deferredIfaces, nil
+
+		ordered := make([]string, 0, len(ifaces))
+		for _, iface := range ifaces {
+			if slices.Contains(deferred, iface) {
+				ordered = append(ordered, iface)
+			}
+		}
+		for _, iface := range ifaces {
+			if !slices.Contains(deferred, iface) {
+				ordered = append(ordered, iface)
+			}
+		}
+		ifaces = ordered
+	}
+
 	// Iteratively rotate all interfaces. Since the rotation results are put on the writeoutChan for
 	// writeout by the DBWriter (which is sequential and certainly slower than the actual in-memory rotation)
 	// there is no significant benefit from running the rotations in parallel, thus allowing us to minimize
@@ -514,7 +973,17 @@ func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.
 		if mc, exists := cm.captures.Get(iface); exists {
 
 			runCtx := withIfaceContext(ctx, mc.iface)
-			logger, lockStart := logging.FromContext(runCtx), time.Now()
+			logger, lockStart := logs.FromContext(runCtx, logs.ModuleCapture), time.Now()
+
+			// If the writeout channel is full, the flows of the interface are retained until the next
+			// writeout (if deferrable), hence neither the capture nor the remaining interfaces are blocked
+			if deferrable && len(writeoutChan) == cap(writeoutChan) && !slices.Contains(deferred, mc.iface) {
+				stalled = true
+				cm.deferredIfaces = append(cm.deferredIfaces, mc.iface)
+				promRotationsDeferred.Inc()
+				logger.Warn("rotation deferred to the next writeout due to congested writeouts")
+				continue
+			}
 
 			// Lock the running capture in order to safely perform rotation tasks
 			if err := mc.capLock.Lock(); err != nil {
@@ -529,8 +998,9 @@ func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.
 			// Extract capture stats in a separate goroutine to minimize rotation duration
 			statsRes := mc.fetchStatusInBackground(runCtx)
 
-			// Perform the rotation
-			rotateResult := mc.rotate(runCtx)
+			// Perform the rotation (only detaching the flows, which are aggregated once the capture
+			// has been released again)
+			detached := mc.rotate(runCtx)
 
 			stats := <-statsRes
 			if err := mc.capLock.Unlock(); err != nil {
@@ -542,11 +1012,29 @@ func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.
 			}
 			logger.With("elapsed", time.Since(lockStart).Round(time.Microsecond).String()).Debug("interface lock-cycle complete")
 
-			writeoutChan <- capturetypes.TaggedAggFlowMap{
-				Map:   rotateResult,
-				Stats: *stats,
-				Iface: mc.iface,
+			rotateResult, attrs := mc.aggregate(detached)
+
+			taggedMap := capturetypes.TaggedAggFlowMap{
+				Map:        rotateResult,
+				Stats:      *stats,
+				Iface:      mc.iface,
+				Attributes: attrs,
+			}
+			cm.mergeReplayedFlows(&taggedMap)
+
+			select {
+			case writeoutChan <- taggedMap:
+			default:
+				// The writeout channel is full, hence the rotation (and thereby all subsequent interfaces)
+				// is blocked until the writer has caught up
+				stalled = true
+				promWriteoutStalls.Inc()
+
+				stallStart := time.Now()
+				writeoutChan <- taggedMap
+				logger.With("elapsed", time.Since(stallStart).Round(time.Microsecond).String()).Warn("rotation blocked by full writeout channel")
 			}
+			promWriteoutQueueDepth.Set(float64(len(writeoutChan)))
 		}
 	}
 
@@ -559,10 +1047,12 @@ func (cm *Manager) rotate(ctx context.Context, writeoutChan chan<- capturetypes.
 		"elapsed", t1.Round(time.Microsecond).String(),
 		"ifaces", ifaces,
 	).Info("rotated interfaces")
+
+	return
 }
 
-func (cm *Manager) logErrors(ctx context.Context, iface string, errsChan <-chan error) {
-	logger := logging.FromContext(ctx)
+func (cm *Manager) logErrors(ctx context.Context, c *Capture, errsChan <-chan error) {
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
 	for {
 		select {
 		case <-ctx.Done():
@@ -576,8 +1066,9 @@ func (cm *Manager) logErrors(ctx context.Context, iface string, errsChan <-chan
 				defer cm.captures.Unlock()
 
 				// If the error channel was closed prematurely, we have to assume there was
-				// a critical processing error and tear down the interface
-				if mc, exists := cm.captures.GetNoLock(iface); exists {
+				// a critical processing error and tear down the interface (unless it has been
+				// closed and restarted in the meantime)
+				if mc, exists := cm.captures.GetNoLock(c.iface); exists && mc == c {
 					logger.Info("closing capture / stopping packet processing")
 					if err := mc.close(); err != nil {
 						logger.Warnf("failed to close capture in logging routine (might be expected): %s", err)
@@ -592,14 +1083,52 @@ func (cm *Manager) logErrors(ctx context.Context, iface string, errsChan <-chan
 }
 
 func (cm *Manager) performWriteout(ctx context.Context, timestamp time.Time, ifaces ...string) {
+
+	// nothing is captured in standby
+	if cm.IsStandby() {
+		return
+	}
+	if cm.writeoutGuard != nil {
+		if err := cm.writeoutGuard(ctx); err != nil {
+			logs.FromContext(ctx, logs.ModuleCapture).Warnf("skipping writeout: %v", err)
+			return
+		}
+	}
+
 	writeoutChan := make(chan capturetypes.TaggedAggFlowMap, writeout.WriteoutsChanDepth)
 	doneChan := cm.writeoutHandler.HandleWriteout(ctx, timestamp, writeoutChan)
 
 	cm.Lock()
-	cm.rotate(ctx, writeoutChan, ifaces...)
+	// the rotation of interfaces is only deferred by regular writeouts once writeouts are persistently
+	// congested
+	stalled := cm.rotate(ctx, writeoutChan, len(ifaces) == 0 && cm.WriteoutCongested(), ifaces...)
+
+	// replayed flows of interfaces that are not captured (anymore) are written out during the
+	// next regular writeout
+	if len(ifaces) == 0 {
+		cm.flushReplayedFlows(writeoutChan)
+	}
 
 	close(writeoutChan)
 	<-doneChan
+	promWriteoutQueueDepth.Set(0)
+
+	// Track consecutive writeouts that were blocked by a full writeout channel in order to
+	// detect persistent congestion
+	stalledWriteouts := int64(0)
+	if stalled {
+		stalledWriteouts = cm.stalledWriteouts.Add(1)
+		if stalledWriteouts == congestedWriteoutsThreshold {
+			logs.FromContext(ctx, logs.ModuleCapture).With("writeouts", stalledWriteouts).Warn("writeouts persistently congested")
+		}
+	} else {
+		cm.stalledWriteouts.Store(0)
+	}
+	if stalledWriteouts >= congestedWriteoutsThreshold {
+		promWriteoutCongested.Set(1)
+	} else {
+		promWriteoutCongested.Set(0)
+	}
 
 	cm.lastRotation = timestamp
 	cm.Unlock()
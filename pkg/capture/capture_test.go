@@ -13,6 +13,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -22,6 +23,8 @@ import (
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 	"github.com/els0r/goProbe/pkg/goprobe/writeout"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/els0r/telemetry/logging"
 	"github.com/fako1024/gotools/concurrency"
 	"github.com/fako1024/slimcap/capture"
@@ -29,6 +32,7 @@ import (
 	"github.com/fako1024/slimcap/link"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 const randSeed = 10000
@@ -146,7 +150,7 @@ func testConcurrentMethodAccess(t *testing.T, nIfaces, nIterations int) {
 		prng := rand.New(rand.NewSource(randSeed)) // #nosec G404
 		for i := 0; i < nIterations; i++ {
 			ifaceIdx := prng.Int63n(int64(nIfaces))
-			captureManager.rotate(ctx, writeoutChan, fmt.Sprintf("mock%00d", ifaceIdx))
+			captureManager.rotate(ctx, writeoutChan, false, fmt.Sprintf("mock%00d", ifaceIdx))
 			<-writeoutChan
 		}
 		wg.Done()
@@ -171,6 +175,198 @@ func testConcurrentMethodAccess(t *testing.T, nIfaces, nIterations int) {
 	captureManager.Close(context.Background())
 }
 
+func TestWriteoutCongestion(t *testing.T) {
+
+	captureManager, _, testMockSrcs := setupInterfaces(t, defaultMockIfaceConfig, 3)
+	ctx := context.Background()
+
+	// A writeout channel that can hold all rotated flow maps must not stall the rotation
+	writeoutChan := make(chan capturetypes.TaggedAggFlowMap, 3)
+	require.False(t, captureManager.rotate(ctx, writeoutChan, false))
+	close(writeoutChan)
+	for range writeoutChan {
+	}
+
+	// A full writeout channel with a slow consumer stalls the rotation
+	writeoutChan = make(chan capturetypes.TaggedAggFlowMap, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for range writeoutChan {
+		}
+	}()
+	require.True(t, captureManager.rotate(ctx, writeoutChan, false))
+	close(writeoutChan)
+
+	// Only persistent congestion is reported as a warning
+	require.Empty(t, captureManager.HealthCheck(ctx))
+	require.False(t, captureManager.WriteoutCongested())
+	captureManager.stalledWriteouts.Store(congestedWriteoutsThreshold)
+	require.Len(t, captureManager.HealthCheck(ctx), 1)
+	require.True(t, captureManager.WriteoutCongested())
+
+	// The health state must be available while a writeout holds the manager lock
+	captureManager.Lock()
+	require.Len(t, captureManager.HealthCheck(ctx), 1)
+	require.True(t, captureManager.WriteoutCongested())
+	captureManager.Unlock()
+
+	// If deferrable, the rotation of the remaining interfaces is deferred once the writeout channel is
+	// full instead of blocking
+	writeoutChan = make(chan capturetypes.TaggedAggFlowMap, 1)
+	require.True(t, captureManager.rotate(ctx, writeoutChan, true))
+	require.Len(t, writeoutChan, 1)
+	deferred := slices.Clone(captureManager.deferredIfaces)
+	require.Len(t, deferred, 2)
+	close(writeoutChan)
+
+	// The deferred interfaces are rotated first by the next writeout and not deferred again
+	writeoutChan = make(chan capturetypes.TaggedAggFlowMap, 1)
+	rotated := make(chan []string)
+	go func() {
+		var ifaces []string
+		time.Sleep(50 * time.Millisecond)
+		for taggedMap := range writeoutChan {
+			ifaces = append(ifaces, taggedMap.Iface)
+		}
+		rotated <- ifaces
+	}()
+	require.True(t, captureManager.rotate(ctx, writeoutChan, true))
+	close(writeoutChan)
+	ifaces := <-rotated
+	require.GreaterOrEqual(t, len(ifaces), 2)
+	require.ElementsMatch(t, deferred, ifaces[:2])
+	for _, iface := range deferred {
+		require.NotContains(t, captureManager.deferredIfaces, iface)
+	}
+
+	testMockSrcs.Done()
+	require.Nil(t, testMockSrcs.Wait())
+
+	captureManager.Close(context.Background())
+}
+
+func TestReplayFlows(t *testing.T) {
+
+	captureManager, _, testMockSrcs := setupInterfaces(t, defaultMockIfaceConfig, 2)
+	ctx := context.Background()
+
+	key := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0, 80}, 6)
+	replayedFlows := func(iface string, bytesRcvd uint64) capturetypes.TaggedAggFlowMap {
+		m := hashmap.NewAggFlowMap()
+		m.PrimaryMap.Set(key, types.Counters{BytesRcvd: bytesRcvd, PacketsRcvd: 1})
+		return capturetypes.TaggedAggFlowMap{
+			Map:   m,
+			Stats: capturetypes.CaptureStats{Received: 1, Processed: 1},
+			Iface: iface,
+			Attributes: capturetypes.FlowAttributes{
+				Labeled: capturetypes.LabeledFlows{string(key): {{
+					FlowLabels: capturetypes.FlowLabels{VLAN: 100},
+					Counters:   types.Counters{BytesRcvd: bytesRcvd, PacketsRcvd: 1},
+					TCPFlags:   types.TCPFlagACK,
+				}}},
+			},
+		}
+	}
+	captureManager.ReplayFlows(replayedFlows("mock0", 100), replayedFlows("mock0", 50), replayedFlows("gone", 10))
+
+	// Replayed flows are merged into the rotation result of the respective interface, flows of interfaces
+	// not captured (anymore) are written out separately
+	writeoutChan := make(chan capturetypes.TaggedAggFlowMap, 3)
+	captureManager.Lock()
+	captureManager.rotate(ctx, writeoutChan, false)
+	captureManager.flushReplayedFlows(writeoutChan)
+	captureManager.Unlock()
+	close(writeoutChan)
+
+	rotated := make(map[string]capturetypes.TaggedAggFlowMap)
+	for taggedMap := range writeoutChan {
+		rotated[taggedMap.Iface] = taggedMap
+	}
+	require.Len(t, rotated, 3)
+	require.Nil(t, rotated["mock1"].Map)
+	for iface, expected := range map[string]types.Counters{
+		"mock0": {BytesRcvd: 150, PacketsRcvd: 2},
+		"gone":  {BytesRcvd: 10, PacketsRcvd: 1},
+	} {
+		require.Equal(t, 1, rotated[iface].Map.Len())
+		for it := rotated[iface].Map.Iter(); it.Next(); {
+			require.Equal(t, expected, it.Val())
+		}
+	}
+	require.Equal(t, uint64(1), rotated["gone"].Stats.Received)
+
+	// The attributes of the replayed flows are merged along with them
+	require.Equal(t, capturetypes.LabeledFlows{string(key): {{
+		FlowLabels: capturetypes.FlowLabels{VLAN: 100},
+		Counters:   types.Counters{BytesRcvd: 150, PacketsRcvd: 2},
+		TCPFlags:   types.TCPFlagACK,
+	}}}, rotated["mock0"].Attributes.Labeled)
+	require.Empty(t, captureManager.replayedFlows)
+
+	// A handover stops all captures and returns the flows instead of writing them out
+	captureManager.ReplayFlows(replayedFlows("mock1", 100))
+	flows := captureManager.Handover(ctx)
+	require.Len(t, flows, 1)
+	require.Equal(t, "mock1", flows[0].Iface)
+	require.Empty(t, captureManager.captures.Ifaces())
+
+	testMockSrcs.Done()
+	require.Nil(t, testMockSrcs.Wait())
+}
+
+func TestStandby(t *testing.T) {
+
+	captureManager, ifaceConfigs, mockSrcs := setupInterfaces(t, defaultMockIfaceConfig, 2)
+	ctx := context.Background()
+
+	// Entering standby stops all captures and discards their flows (including replayed ones)
+	m := hashmap.NewAggFlowMap()
+	m.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0, 80}, 6),
+		types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+	captureManager.ReplayFlows(capturetypes.TaggedAggFlowMap{Map: m, Iface: "mock0"})
+	captureManager.Standby(ctx)
+	require.True(t, captureManager.IsStandby())
+	require.Empty(t, captureManager.captures.Ifaces())
+	require.Empty(t, captureManager.replayedFlows)
+
+	mockSrcs.Done()
+	require.Nil(t, mockSrcs.Wait())
+
+	// Configuration updates are retained, but don't start any captures in standby
+	enabled, _, _, err := captureManager.Update(ctx, ifaceConfigs)
+	require.Nil(t, err)
+	require.Empty(t, enabled)
+	require.Empty(t, captureManager.captures.Ifaces())
+
+	// Activating the capture manager starts the captures of the retained configuration
+	var mu sync.Mutex
+	activatedSrcs := make(testMockSrcs)
+	captureManager.sourceInitFn = func(c *Capture) (capture.SourceZeroCopy, error) {
+		mockSrc, errChan := initMockSrc(t, c.Iface())
+
+		mu.Lock()
+		activatedSrcs[c.Iface()] = testMockSrc{src: mockSrc, errChan: errChan}
+		mu.Unlock()
+
+		return mockSrc, nil
+	}
+	require.Nil(t, captureManager.Activate(ctx))
+	require.False(t, captureManager.IsStandby())
+	require.ElementsMatch(t, []string{"mock0", "mock1"}, captureManager.captures.Ifaces())
+
+	// A failing writeout guard skips the writeout
+	captureManager.writeoutGuard = func(context.Context) error {
+		return errors.New("not allowed")
+	}
+	captureManager.performWriteout(ctx, time.Now())
+	require.True(t, captureManager.LastRotation().IsZero())
+
+	activatedSrcs.Done()
+	require.Nil(t, activatedSrcs.Wait())
+
+	captureManager.Close(context.Background())
+}
+
 func setupInterfaces(t *testing.T, cfg config.CaptureConfig, nIfaces int) (*Manager, config.Ifaces, testMockSrcs) {
 
 	ifaceConfigs := make(config.Ifaces)
@@ -220,6 +416,263 @@ func setupInterfaces(t *testing.T, cfg config.CaptureConfig, nIfaces int) (*Mana
 	return captureManager, ifaceConfigs, testMockSrcs
 }
 
+func TestRotationRetainsFlowOrientation(t *testing.T) {
+	c := &Capture{
+		flowLog: NewFlowLog(),
+	}
+
+	addPacket := func(sip, dip string, sport, dport uint16, tcpFlags byte) {
+		pkt, err := capture.BuildPacket(net.ParseIP(sip), net.ParseIP(dip), sport, dport, 6,
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, tcpFlags}, capture.PacketOutgoing, 128)
+		require.Nil(t, err)
+		epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{})
+	}
+	requireFlow := func(agg *hashmap.AggFlowMap, sip, dip string, dport uint16) {
+		require.Equal(t, 1, agg.Len())
+		val, exists := agg.PrimaryMap.Get(types.NewV4KeyStatic(
+			[4]byte(net.ParseIP(sip).To4()), [4]byte(net.ParseIP(dip).To4()),
+			binary.BigEndian.AppendUint16(nil, dport), 6))
+		require.True(t, exists)
+		require.Equal(t, types.Counters{BytesSent: 128, PacketsSent: 1}, val)
+	}
+	flowObject := func() *Flow {
+		require.Len(t, c.flowLog.flowMapV4, 1)
+		for _, flow := range c.flowLog.flowMapV4 {
+			return flow
+		}
+		return nil
+	}
+
+	// The SYN identifies 10.0.0.2 as the client of a connection to an uncommon (high) port
+	addPacket("10.0.0.2", "10.0.0.1", 444, 40000, 0x02)
+	flow := flowObject()
+	agg, _, _ := c.flowLog.Rotate()
+	requireFlow(agg, "10.0.0.2", "10.0.0.1", 40000)
+	require.Zero(t, c.flowLog.Len())
+
+	// Subsequent packets of the connection don't carry a SYN, yet the flow retains its orientation
+	// across the rotation (instead of being oriented based on the port numbers)
+	addPacket("10.0.0.1", "10.0.0.2", 40000, 444, 0x10)
+	agg, _, _ = c.flowLog.Rotate()
+	requireFlow(agg, "10.0.0.2", "10.0.0.1", 40000)
+
+	// Once the flow is idle for a whole interval, its orientation is forgotten. The (cleared) flow
+	// object is reused for the next flow once the flow maps detached by the first rotation are swapped
+	// in again, which is oriented according to its packets (instead of carrying over any counters)
+	_, _, _ = c.flowLog.Rotate()
+	addPacket("10.0.0.1", "10.0.0.2", 40000, 444, 0x10)
+	require.Same(t, flow, flowObject())
+	agg, _, _ = c.flowLog.Rotate()
+	requireFlow(agg, "10.0.0.1", "10.0.0.2", 444)
+}
+
+func TestFlowCounts(t *testing.T) {
+	c := &Capture{
+		iface:   "test",
+		flowLog: NewFlowLog(),
+	}
+
+	addPacket := func(sip, dip string, sport, dport uint16) {
+		pkt, err := capture.BuildPacket(net.ParseIP(sip), net.ParseIP(dip), sport, dport, 17,
+			[]byte{1, 2}, capture.PacketOutgoing, 128)
+		require.Nil(t, err)
+		epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{})
+	}
+
+	// packets of existing flows (in either direction) don't count as created flows
+	addPacket("10.0.0.1", "10.0.0.2", 40000, 53)
+	addPacket("10.0.0.2", "10.0.0.1", 53, 40000)
+	addPacket("10.0.0.1", "10.0.0.3", 40000, 53)
+	sinceRotation, total := c.flowCounts()
+	require.Equal(t, uint64(2), sinceRotation)
+	require.Equal(t, uint64(2), total)
+
+	_ = c.rotate(context.Background())
+	sinceRotation, total = c.flowCounts()
+	require.Equal(t, uint64(0), sinceRotation)
+	require.Equal(t, uint64(2), total)
+
+	// flows continued across the rotation don't count as created flows either
+	addPacket("10.0.0.2", "10.0.0.1", 53, 40000)
+	addPacket("10.0.0.1", "10.0.0.4", 40000, 53)
+	sinceRotation, total = c.flowCounts()
+	require.Equal(t, uint64(1), sinceRotation)
+	require.Equal(t, uint64(3), total)
+}
+
+func TestVLANFlows(t *testing.T) {
+	c := &Capture{
+		flowLog: NewFlowLog(),
+	}
+
+	addPacket := func(sip, dip string, vlan uint16) {
+		pkt, err := capture.BuildPacket(net.ParseIP(sip), net.ParseIP(dip), 40000, 53, 17,
+			[]byte{1, 2}, capture.PacketOutgoing, 128)
+		require.Nil(t, err)
+		epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{VLAN: vlan})
+	}
+
+	// Only the flow observed on a VLAN is assigned its VLAN ID in the aggregated flow map. The packets of
+	// a flow observed on different VLANs are recorded separately (rather than assigned to the VLAN the
+	// flow was first observed on)
+	addPacket("10.0.0.1", "10.0.0.2", 100)
+	addPacket("10.0.0.1", "10.0.0.2", 100)
+	addPacket("10.0.0.1", "10.0.0.2", 200)
+	addPacket("10.0.0.1", "10.0.0.2", 0)
+	addPacket("10.0.0.1", "10.0.0.3", 0)
+	agg, _, attrs := c.flowLog.Rotate()
+	require.Equal(t, 2, agg.Len())
+	flowKey := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 53}, 17)
+	flow, exists := agg.PrimaryMap.Get(flowKey)
+	require.True(t, exists)
+	require.Equal(t, uint64(4), flow.PacketsSent)
+	require.ElementsMatch(t, []capturetypes.LabeledFlow{
+		{FlowLabels: capturetypes.FlowLabels{VLAN: 100}, Counters: types.Counters{BytesSent: 256, PacketsSent: 2}},
+		{FlowLabels: capturetypes.FlowLabels{VLAN: 200}, Counters: types.Counters{BytesSent: 128, PacketsSent: 1}},
+	}, attrs.Labeled[string(flowKey)])
+	require.Len(t, attrs.Labeled, 1)
+
+	// Once the flow is removed from the flow log, so is its VLAN ID
+	_, _, attrs = c.flowLog.Rotate()
+	require.Empty(t, attrs.Labeled)
+}
+
+func TestMACFlows(t *testing.T) {
+	c := &Capture{
+		flowLog: NewFlowLog(),
+	}
+
+	var (
+		clientMAC = types.MAC{0x02, 0, 0, 0, 0, 0x01}
+		serverMAC = types.MAC{0x02, 0, 0, 0, 0, 0x02}
+		otherMAC  = types.MAC{0x02, 0, 0, 0, 0, 0x03}
+		flowKey   = string(types.NewV4KeyStatic([4]byte{10, 0, 0, 2}, [4]byte{10, 0, 0, 1}, []byte{0x01, 0xbc}, 6))
+	)
+	addPacket := func(sip, dip string, sport, dport uint16, tcpFlags byte, macs capturetypes.MACPair) {
+		pkt, err := capture.BuildPacket(net.ParseIP(sip), net.ParseIP(dip), sport, dport, 6,
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, tcpFlags}, capture.PacketOutgoing, 128)
+		require.Nil(t, err)
+		epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{MACs: macs})
+	}
+	macShares := func(attrs capturetypes.FlowAttributes) (macs []capturetypes.MACPair) {
+		for _, share := range attrs.Labeled[flowKey] {
+			macs = append(macs, share.MACs)
+		}
+		return
+	}
+
+	// The MAC addresses are oriented like the flow, hence both directions of the flow are recorded
+	// as one
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 0x02, capturetypes.MACPair{Src: clientMAC, Dst: serverMAC})
+	addPacket("10.0.0.1", "10.0.0.2", 444, 40000, 0x12, capturetypes.MACPair{Src: serverMAC, Dst: clientMAC})
+	_, _, attrs := c.flowLog.Rotate()
+	require.Equal(t, []capturetypes.MACPair{{Src: clientMAC, Dst: serverMAC}}, macShares(attrs))
+
+	// ... even if the flow continues across a rotation with a packet in the reverse direction
+	addPacket("10.0.0.1", "10.0.0.2", 444, 40000, 0x10, capturetypes.MACPair{Src: serverMAC, Dst: clientMAC})
+	_, _, attrs = c.flowLog.Rotate()
+	require.Equal(t, []capturetypes.MACPair{{Src: clientMAC, Dst: serverMAC}}, macShares(attrs))
+
+	// Packets of the flow carrying other MAC addresses are recorded separately
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 0x10, capturetypes.MACPair{Src: clientMAC, Dst: serverMAC})
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 0x10, capturetypes.MACPair{Src: otherMAC, Dst: serverMAC})
+	_, _, attrs = c.flowLog.Rotate()
+	require.ElementsMatch(t, []capturetypes.MACPair{{Src: clientMAC, Dst: serverMAC}, {Src: otherMAC, Dst: serverMAC}}, macShares(attrs))
+
+	// Flows recorded without MAC addresses are omitted
+	_, _, attrs = c.flowLog.Rotate()
+	require.Empty(t, attrs.Labeled)
+}
+
+func TestTCPFlagsFlows(t *testing.T) {
+	c := &Capture{
+		config:  config.CaptureConfig{TCPFlags: true},
+		flowLog: NewFlowLog(),
+	}
+
+	var (
+		tcpFlowKey = string(types.NewV4KeyStatic([4]byte{10, 0, 0, 2}, [4]byte{10, 0, 0, 1}, []byte{0x01, 0xbc}, 6))
+	)
+	addPacket := func(sip, dip string, sport, dport uint16, proto byte, tcpFlags byte) {
+		pkt, err := capture.BuildPacket(net.ParseIP(sip), net.ParseIP(dip), sport, dport, proto,
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, tcpFlags}, capture.PacketOutgoing, 128)
+		require.Nil(t, err)
+		epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{})
+	}
+
+	// The flags observed in both directions of a flow are combined, UDP flows carry none
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 6, byte(types.TCPFlagSYN))
+	addPacket("10.0.0.1", "10.0.0.2", 444, 40000, 6, byte(types.TCPFlagSYN|types.TCPFlagACK))
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 53, 17, 0xff)
+	_, _, attrs := c.flowLog.Rotate()
+	require.Equal(t, capturetypes.TCPFlags{tcpFlowKey: types.TCPFlagSYN | types.TCPFlagACK}, attrs.TCPFlags)
+
+	// ... and are reset upon rotation
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 6, byte(types.TCPFlagFIN|types.TCPFlagACK))
+	_, _, attrs = c.flowLog.Rotate()
+	require.Equal(t, capturetypes.TCPFlags{tcpFlowKey: types.TCPFlagFIN | types.TCPFlagACK}, attrs.TCPFlags)
+
+	// No flags are recorded unless enabled
+	c.config.TCPFlags = false
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 6, byte(types.TCPFlagSYN))
+	_, _, attrs = c.flowLog.Rotate()
+	require.Empty(t, attrs.TCPFlags)
+}
+
+func TestDSCPFlows(t *testing.T) {
+	c := &Capture{
+		flowLog: NewFlowLog(),
+	}
+
+	var (
+		flowKey = string(types.NewV4KeyStatic([4]byte{10, 0, 0, 2}, [4]byte{10, 0, 0, 1}, []byte{0x01, 0xbc}, 6))
+	)
+	addPacket := func(sip, dip string, sport, dport uint16, tcpFlags byte, dscp types.DSCP) {
+		pkt, err := capture.BuildPacket(net.ParseIP(sip), net.ParseIP(dip), sport, dport, 6,
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, tcpFlags}, capture.PacketOutgoing, 128)
+		require.Nil(t, err)
+		ipLayer := pkt.IPLayer()
+		ipLayer[ipLayerV4ToSPos] = byte(dscp)<<2 | 0x01 // ECN bits must not affect the DSCP
+		epHash, auxInfo, errno := ParsePacketV4(ipLayer)
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{DSCP: dscpV4(ipLayer)})
+	}
+
+	// The packets of a flow are recorded separately per DSCP (rather than assigned the DSCP of the
+	// packet the flow was first observed with)
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 0x02, 46)
+	addPacket("10.0.0.1", "10.0.0.2", 444, 40000, 0x12, 0)
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 0x10, 46)
+	agg, _, attrs := c.flowLog.Rotate()
+	flow, exists := agg.PrimaryMap.Get(types.Key(flowKey))
+	require.True(t, exists)
+	require.Equal(t, uint64(3), flow.PacketsSent)
+	require.Equal(t, []capturetypes.LabeledFlow{
+		{FlowLabels: capturetypes.FlowLabels{DSCP: 46}, Counters: types.Counters{BytesSent: 256, PacketsSent: 2}},
+	}, attrs.Labeled[flowKey])
+
+	// Flows observed with the default DSCP are omitted
+	addPacket("10.0.0.2", "10.0.0.1", 40000, 444, 0x10, 0)
+	_, _, attrs = c.flowLog.Rotate()
+	require.Empty(t, attrs.Labeled)
+}
+
+func TestDSCPV6(t *testing.T) {
+	ipLayer := make(capture.IPLayer, ipv6.HeaderLen)
+	ipLayer[0], ipLayer[1] = 0x6b, 0x81 // Traffic Class 0xb8 (EF, i.e. DSCP 46)
+	require.Equal(t, types.DSCP(46), dscpV6(ipLayer))
+}
+
 func TestLowTrafficDeadlock(t *testing.T) {
 	for _, n := range []int{0, 1, 10, 100, 1000} {
 		t.Run(fmt.Sprintf("%d packets", n), func(t *testing.T) {
@@ -327,7 +780,7 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 				binary.BigEndian.PutUint16(ipLayer[ipv4.HeaderLen:ipv4.HeaderLen+2], s)
 				binary.BigEndian.PutUint16(ipLayer[ipv4.HeaderLen+2:ipv4.HeaderLen+4], d)
 
-				epHash, auxInfo, errno := ParsePacketV4(ipLayer)
+				epHash, auxInfo, _ := ParsePacketV4(ipLayer)
 
 				switch {
 
@@ -356,7 +809,7 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 					}
 				}
 
-				benchCap.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, errno)
+				benchCap.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{})
 			}
 		}
 	}
@@ -376,8 +829,8 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 		b.ResetTimer()
 
 		for i := 0; i < b.N; i++ {
-			epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
-			benchCap.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, errno)
+			epHash, auxInfo, _ := ParsePacketV4(pkt.IPLayer())
+			benchCap.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{})
 		}
 	})
 
@@ -394,8 +847,8 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 		b.ResetTimer()
 
 		for i := 0; i < b.N; i++ {
-			epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
-			benchCap.addToFlowLogV4(epHash, capture.PacketThisHost, 128, auxInfo, errno)
+			epHash, auxInfo, _ := ParsePacketV4(pkt.IPLayer())
+			benchCap.addToFlowLogV4(epHash, capture.PacketThisHost, 128, auxInfo, capturetypes.FlowLabels{})
 		}
 	})
 
@@ -410,12 +863,12 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
 
-			// Run best-case scenario (keep all flows)
-			aggMap, _ := benchData[i].transferAndAggregate()
+			// Detach all flows and aggregate them
+			aggMap, _, _ := benchData[i].Rotate()
 			_ = aggMap
 
-			// Run worst-case scenario (keep no flows)
-			aggMap, _ = benchData[i].transferAndAggregate()
+			// Run empty rotation (all flows having been detached)
+			aggMap, _, _ = benchData[i].Rotate()
 			_ = aggMap
 		}
 	})
@@ -423,8 +876,8 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 	printMemUsage(benchCap.flowLog)
 
 	testLog := benchCap.flowLog.clone()
-	testLog.transferAndAggregate()
-	testLog.transferAndAggregate()
+	testLog.Rotate()
+	testLog.Rotate()
 
 	benchCapPost := &Capture{
 		flowLog: testLog,
@@ -442,8 +895,8 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 		b.ReportAllocs()
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
-			benchCapPost.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, errno)
+			epHash, auxInfo, _ := ParsePacketV4(pkt.IPLayer())
+			benchCapPost.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{})
 		}
 	})
 
@@ -459,8 +912,8 @@ func benchmarkRotation(b *testing.B, nIP uint32, nSPort, nDPort uint16) {
 		b.ReportAllocs()
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			epHash, auxInfo, errno := ParsePacketV4(pkt.IPLayer())
-			benchCapPost.addToFlowLogV4(epHash, capture.PacketThisHost, 128, auxInfo, errno)
+			epHash, auxInfo, _ := ParsePacketV4(pkt.IPLayer())
+			benchCapPost.addToFlowLogV4(epHash, capture.PacketThisHost, 128, auxInfo, capturetypes.FlowLabels{})
 		}
 	})
 }
@@ -0,0 +1,94 @@
+package capturetypes
+
+import "github.com/els0r/goProbe/pkg/types"
+
+// FlowLabels denotes the attributes of a packet distinguishing its flow from flows sharing the same
+// IPs / ports / protocol (all of them zero if the packet carried none)
+type FlowLabels struct {
+	Encapsulation Encapsulation
+	VLAN          uint16
+	MACs          MACPair
+	DSCP          types.DSCP
+}
+
+// IsZero returns if the packet carried no labels at all
+func (l FlowLabels) IsZero() bool {
+	return l == FlowLabels{}
+}
+
+// Reverse returns the labels of the reverse direction of the flow
+func (l FlowLabels) Reverse() FlowLabels {
+	l.MACs = l.MACs.Reverse()
+	return l
+}
+
+// LabeledFlow denotes the share of a flow observed with a distinct set of labels, along with the
+// OR-combination of the TCP flags of its packets
+type LabeledFlow struct {
+	FlowLabels
+	types.Counters
+	TCPFlags types.TCPFlags
+}
+
+// LabeledFlows maps the keys of flows (in an aggregated flow map) observed with any labels to their
+// shares per distinct set of labels. The counters of a flow in the aggregated flow map comprise all of
+// its shares, any remainder having been observed without labels
+type LabeledFlows map[string][]LabeledFlow
+
+// Add adds the share of a flow, merging it with an existing share carrying the same labels
+func (l LabeledFlows) Add(key string, share LabeledFlow) {
+	shares := l[key]
+	for i := range shares {
+		if shares[i].FlowLabels == share.FlowLabels {
+			shares[i].Counters.Add(share.Counters)
+			shares[i].TCPFlags |= share.TCPFlags
+			return
+		}
+	}
+	l[key] = append(shares, share)
+}
+
+// FlowAttributes bundles the attributes recorded along with the flows of an aggregated flow map
+// beyond their counters (each of them nil if no flow carries the respective attribute)
+type FlowAttributes struct {
+
+	// Labeled splits the flows observed with any labels (encapsulation, VLAN, MAC addresses or DSCP)
+	// into their shares per distinct set of labels
+	Labeled LabeledFlows
+
+	// TCPFlags assigns the TCP flows to the OR-combination of the TCP flags of their packets observed
+	// without any labels (the flags of all other packets being part of the respective share)
+	TCPFlags TCPFlags
+}
+
+// Merge merges the attributes of flows of another aggregated flow map (e.g. when merging the latter
+// into the one a carries the attributes of)
+func (a *FlowAttributes) Merge(b FlowAttributes) {
+	if len(b.Labeled) > 0 && a.Labeled == nil {
+		a.Labeled = make(LabeledFlows, len(b.Labeled))
+	}
+	for key, shares := range b.Labeled {
+		for _, share := range shares {
+			a.Labeled.Add(key, share)
+		}
+	}
+
+	if len(b.TCPFlags) > 0 && a.TCPFlags == nil {
+		a.TCPFlags = make(TCPFlags, len(b.TCPFlags))
+	}
+	for key, flags := range b.TCPFlags {
+		a.TCPFlags[key] |= flags
+	}
+}
+
+// Decapsulated returns if any flow was decapsulated
+func (a FlowAttributes) Decapsulated() bool {
+	for _, shares := range a.Labeled {
+		for _, share := range shares {
+			if share.Encapsulation != EncapNone {
+				return true
+			}
+		}
+	}
+	return false
+}
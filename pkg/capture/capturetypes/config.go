@@ -8,14 +8,20 @@ type IfaceChange struct {
 	Name string `json:"name" doc:"Name of the interface" example:"eth0"`
 	// Success: the config update / reload operation(s) succeeded
 	Success bool `json:"success" doc:"The config update / reload operation(s) suceeded" example:"true"`
+	// Warnings: issues found when validating the interface state prior to enabling the capture
+	Warnings []string `json:"warnings,omitempty" doc:"Issues found when validating the state of the interface prior to enabling the capture (e.g. link down, receive offloads enabled)"`
 }
 
 // LogValue implements the LogValuer interface
 func (ic IfaceChange) LogValue() slog.Value {
-	return slog.GroupValue(
+	attrs := []slog.Attr{
 		slog.String("name", ic.Name),
 		slog.Bool("success", ic.Success),
-	)
+	}
+	if len(ic.Warnings) > 0 {
+		attrs = append(attrs, slog.Int("warnings", len(ic.Warnings)))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 // IfaceChanges denotes a list of IfaceChange instances
@@ -0,0 +1,62 @@
+package capturetypes
+
+// Encapsulation denotes the type of tunnel encapsulation a packet was received with
+type Encapsulation uint8
+
+const (
+	// EncapNone : No (supported) encapsulation
+	EncapNone Encapsulation = iota
+
+	// EncapGRE : Generic Routing Encapsulation (RFC 2784 / RFC 2890)
+	EncapGRE
+
+	// EncapVXLAN : Virtual eXtensible Local Area Network (RFC 7348)
+	EncapVXLAN
+
+	// EncapGeneve : Generic Network Virtualization Encapsulation (RFC 8926)
+	EncapGeneve
+
+	// NumEncapsulations : Number of tracked encapsulation types
+	NumEncapsulations
+)
+
+// DecapTagPrefix denotes the prefix of the flow tags marking decapsulated flows (followed by
+// the name of their encapsulation type, e.g. "decap:vxlan")
+const DecapTagPrefix = "decap:"
+
+// EncapsulationNames maps an Encapsulation to a string
+var EncapsulationNames = [NumEncapsulations]string{
+	"none",
+	"gre",
+	"vxlan",
+	"geneve",
+}
+
+// String returns a string representation of the underlying Encapsulation
+func (e Encapsulation) String() string {
+	return EncapsulationNames[e]
+}
+
+// Tag returns the name of the flow tag marking flows decapsulated from the Encapsulation
+func (e Encapsulation) Tag() string {
+	return DecapTagPrefix + e.String()
+}
+
+// DecapsulationTracker denotes a simple table-based structure for counting all
+// decapsulated packets per encapsulation type
+type DecapsulationTracker [NumEncapsulations]int
+
+// Sum returns the sum of all decapsulated packets currently tracked in the table
+func (d *DecapsulationTracker) Sum() (res int) {
+	for i := EncapGRE; i < NumEncapsulations; i++ {
+		res += d[i]
+	}
+	return
+}
+
+// Reset resets all counters in the table (for reuse)
+func (d *DecapsulationTracker) Reset() {
+	for i := EncapNone; i < NumEncapsulations; i++ {
+		d[i] = 0
+	}
+}
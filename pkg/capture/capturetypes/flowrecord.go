@@ -0,0 +1,56 @@
+package capturetypes
+
+import (
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// FlowEndReason denotes why a flow record was expired (values as per the flowEndReason
+// information element of IPFIX, RFC 5102)
+type FlowEndReason uint8
+
+const (
+	// FlowEndIdleTimeout : No packets were observed for the duration of the idle timeout
+	FlowEndIdleTimeout FlowEndReason = 1
+
+	// FlowEndActiveTimeout : The flow was active for the duration of the active timeout (and
+	// continues in a new record)
+	FlowEndActiveTimeout FlowEndReason = 2
+
+	// FlowEndForced : The capture of the interface was stopped
+	FlowEndForced FlowEndReason = 4
+)
+
+// String returns a string representation of the underlying FlowEndReason
+func (r FlowEndReason) String() string {
+	switch r {
+	case FlowEndIdleTimeout:
+		return "idle_timeout"
+	case FlowEndActiveTimeout:
+		return "active_timeout"
+	case FlowEndForced:
+		return "forced_end"
+	default:
+		return "unknown"
+	}
+}
+
+// FlowRecord denotes a NetFlow-style record of a flow, delimited by the active / idle timeouts
+// instead of the writeout interval
+type FlowRecord struct {
+	// Key denotes the attributes of the flow (as stored in the goDB)
+	Key types.Key
+	// SrcPort denotes the source port of the flow (zero if it was not tracked, e.g. for flows to
+	// a common port, or the lowest port of its bucket if aggregated into buckets)
+	SrcPort uint16
+
+	// Start / End denote the time the flow was first / last observed with packets in this record
+	Start, End time.Time
+
+	types.Counters
+	Reason FlowEndReason
+}
+
+// FlowRecords denotes a list of flow records
+type FlowRecords []FlowRecord
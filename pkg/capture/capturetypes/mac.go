@@ -0,0 +1,18 @@
+package capturetypes
+
+import "github.com/els0r/goProbe/pkg/types"
+
+// MACPair denotes the source / destination MAC addresses of a flow
+type MACPair struct {
+	Src, Dst types.MAC
+}
+
+// IsZero returns if neither MAC address was recorded
+func (m MACPair) IsZero() bool {
+	return m == MACPair{}
+}
+
+// Reverse returns the MAC addresses of the reverse direction of the flow
+func (m MACPair) Reverse() MACPair {
+	return MACPair{Src: m.Dst, Dst: m.Src}
+}
@@ -0,0 +1,90 @@
+package capturetypes
+
+// NonIPType denotes the kind of a frame not carrying an IP layer, classified by its ethertype
+type NonIPType uint8
+
+const (
+	// NonIPARP : Address Resolution Protocol (ethertype 0x0806)
+	NonIPARP NonIPType = iota
+
+	// NonIPLLDP : Link Layer Discovery Protocol (ethertype 0x88CC)
+	NonIPLLDP
+
+	// NonIPMPLS : Multiprotocol Label Switching (ethertypes 0x8847 / 0x8848)
+	NonIPMPLS
+
+	// NonIPVLAN : Frames carrying (additional) VLAN tags not stripped by the NIC (ethertypes 0x8100 / 0x88A8 / 0x9100)
+	NonIPVLAN
+
+	// NonIPPPPoE : PPPoE discovery frames and PPPoE session frames not carrying IP (ethertypes 0x8863 / 0x8864)
+	NonIPPPPoE
+
+	// NonIPLLC : IEEE 802.3 frames with an LLC header instead of an ethertype (e.g. Spanning Tree)
+	NonIPLLC
+
+	// NonIPOther : Any other ethertype
+	NonIPOther
+
+	// NumNonIPTypes : Number of tracked non-IP frame types
+	NumNonIPTypes
+)
+
+// NonIPTypeNames maps a NonIPType to a string
+var NonIPTypeNames = [NumNonIPTypes]string{
+	"arp",
+	"lldp",
+	"mpls",
+	"vlan",
+	"pppoe",
+	"llc",
+	"other",
+}
+
+// String returns a string representation of the underlying NonIPType
+func (t NonIPType) String() string {
+	return NonIPTypeNames[t]
+}
+
+// maxIEEE8023Length denotes the largest value of the ethertype field denoting the length of an
+// IEEE 802.3 frame instead of an ethertype
+const maxIEEE8023Length = 0x05DC
+
+// ClassifyEtherType determines the NonIPType of a frame based on its ethertype (which must not
+// denote IPv4 / IPv6)
+func ClassifyEtherType(etherType uint16) NonIPType {
+	switch etherType {
+	case 0x0806:
+		return NonIPARP
+	case 0x88CC:
+		return NonIPLLDP
+	case 0x8847, 0x8848:
+		return NonIPMPLS
+	case 0x8100, 0x88A8, 0x9100:
+		return NonIPVLAN
+	case 0x8863, 0x8864:
+		return NonIPPPPoE
+	}
+	if etherType <= maxIEEE8023Length {
+		return NonIPLLC
+	}
+	return NonIPOther
+}
+
+// NonIPTracker denotes a simple table-based structure for counting all frames not carrying
+// an IP layer per type
+type NonIPTracker [NumNonIPTypes]uint64
+
+// Sum returns the sum of all non-IP frames currently tracked in the table
+func (n *NonIPTracker) Sum() (res uint64) {
+	for i := NonIPARP; i < NumNonIPTypes; i++ {
+		res += n[i]
+	}
+	return
+}
+
+// Reset resets all counters in the table (for reuse)
+func (n *NonIPTracker) Reset() {
+	for i := NonIPARP; i < NumNonIPTypes; i++ {
+		n[i] = 0
+	}
+}
@@ -66,3 +66,16 @@ func (e *ParsingErrTracker) Reset() {
 		e[i] = 0
 	}
 }
+
+// ParsingDiagnostic denotes a hint on a likely capture misconfiguration (e.g. an insufficient capture
+// length or corrupt mirrored traffic), derived from the rate of packet parsing errors on an interface
+type ParsingDiagnostic struct {
+	// Error: the parsing error the diagnostic is based on
+	Error string `json:"error" doc:"Parsing error the diagnostic is based on" example:"packet truncated"`
+	// Rate: the fraction of processed packets affected by the error
+	Rate float64 `json:"rate" doc:"Fraction of processed packets affected by the error (over the diagnostic window)" example:"0.05"`
+	// Hint: the likely cause of the errors
+	Hint string `json:"hint" doc:"Likely cause of the errors" example:"packets are truncated before their transport layer"`
+	// SuggestedCaptureLength: the capture length suggested to resolve the errors (if applicable)
+	SuggestedCaptureLength int `json:"suggested_capture_length,omitempty" doc:"Capture length suggested to resolve the errors (if applicable)" example:"192"`
+}
@@ -0,0 +1,168 @@
+package capturetypes
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+// FlowSnapshotContentType denotes the media type of a flow snapshot
+const FlowSnapshotContentType = "application/octet-stream"
+
+const (
+	flowSnapshotMagic   = "GPFS"
+	flowSnapshotVersion = 1
+
+	// maxFlowSnapshotIfaceLen limits the length of the interface name (to avoid allocations based on
+	// corrupt input)
+	maxFlowSnapshotIfaceLen = 256
+
+	// maxFlowSnapshotPrealloc limits the number of flows the flow maps are pre-allocated for (since the
+	// number of flows stated in the snapshot is only validated upon reading the flows)
+	maxFlowSnapshotPrealloc = 1 << 16
+)
+
+var (
+	// ErrInvalidFlowSnapshot denotes that the input is not a (valid) flow snapshot
+	ErrInvalidFlowSnapshot = errors.New("invalid flow snapshot")
+
+	// ErrUnsupportedFlowSnapshotVersion denotes that the flow snapshot was written in a (newer)
+	// version not supported by this release
+	ErrUnsupportedFlowSnapshotVersion = errors.New("unsupported flow snapshot version")
+)
+
+// WriteFlowSnapshot writes the flows of an interface as compact binary snapshot, which can be read
+// back via ReadFlowSnapshot (e.g. by another process). The snapshot consists of
+//
+//   - the magic bytes "GPFS" followed by the version of the format (1 byte)
+//   - the interface name (length as uvarint, followed by the name)
+//   - the IPv4 and the IPv6 flows: the number of flows (uvarint), followed by the flows, each of them
+//     consisting of its key (raw flow map key of fixed width) and its counters (bytes received / sent,
+//     packets received / sent as uvarint each)
+//
+// Capture stats and encapsulations are not part of the snapshot
+func WriteFlowSnapshot(w io.Writer, flows TaggedAggFlowMap) error {
+	if len(flows.Iface) > maxFlowSnapshotIfaceLen {
+		return fmt.Errorf("interface name exceeds %d bytes", maxFlowSnapshotIfaceLen)
+	}
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, 4*binary.MaxVarintLen64)
+
+	buf = append(buf, flowSnapshotMagic...)
+	buf = append(buf, flowSnapshotVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(flows.Iface)))
+	if _, err := bw.Write(append(buf, flows.Iface...)); err != nil {
+		return err
+	}
+
+	primary, secondary := hashmap.New(), hashmap.New()
+	if flows.Map != nil {
+		primary, secondary = flows.Map.PrimaryMap, flows.Map.SecondaryMap
+	}
+	for _, m := range []struct {
+		flows    *hashmap.Map
+		keyWidth int
+	}{
+		{primary, types.KeyWidthIPv4},
+		{secondary, types.KeyWidthIPv6},
+	} {
+		if _, err := bw.Write(binary.AppendUvarint(buf[:0], uint64(m.flows.Len()))); err != nil {
+			return err
+		}
+		for it := m.flows.Iter(); it.Next(); {
+			key, val := it.Key(), it.Val()
+			if len(key) != m.keyWidth {
+				return fmt.Errorf("unexpected flow key width %d (expected %d)", len(key), m.keyWidth)
+			}
+			if _, err := bw.Write(key); err != nil {
+				return err
+			}
+
+			buf = binary.AppendUvarint(buf[:0], val.BytesRcvd)
+			buf = binary.AppendUvarint(buf, val.BytesSent)
+			buf = binary.AppendUvarint(buf, val.PacketsRcvd)
+			buf = binary.AppendUvarint(buf, val.PacketsSent)
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ReadFlowSnapshot reads the flows of an interface from a snapshot written via WriteFlowSnapshot
+func ReadFlowSnapshot(r io.Reader) (flows TaggedAggFlowMap, err error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(flowSnapshotMagic)+1)
+	if _, err = io.ReadFull(br, header); err != nil {
+		return flows, fmt.Errorf("%w: failed to read header: %w", ErrInvalidFlowSnapshot, err)
+	}
+	if string(header[:len(flowSnapshotMagic)]) != flowSnapshotMagic {
+		return flows, fmt.Errorf("%w: unexpected magic bytes", ErrInvalidFlowSnapshot)
+	}
+	if version := header[len(flowSnapshotMagic)]; version != flowSnapshotVersion {
+		return flows, fmt.Errorf("%w: %d", ErrUnsupportedFlowSnapshotVersion, version)
+	}
+
+	ifaceLen, err := binary.ReadUvarint(br)
+	if err != nil || ifaceLen > maxFlowSnapshotIfaceLen {
+		return flows, fmt.Errorf("%w: invalid interface name", ErrInvalidFlowSnapshot)
+	}
+	iface := make([]byte, ifaceLen)
+	if _, err = io.ReadFull(br, iface); err != nil {
+		return flows, fmt.Errorf("%w: failed to read interface name: %w", ErrInvalidFlowSnapshot, err)
+	}
+
+	primary, err := readFlowSnapshotMap(br, types.KeyWidthIPv4)
+	if err != nil {
+		return flows, err
+	}
+	secondary, err := readFlowSnapshotMap(br, types.KeyWidthIPv6)
+	if err != nil {
+		return flows, err
+	}
+	if _, err = br.ReadByte(); !errors.Is(err, io.EOF) {
+		return flows, fmt.Errorf("%w: unexpected trailing data", ErrInvalidFlowSnapshot)
+	}
+
+	return TaggedAggFlowMap{
+		Map: &hashmap.AggFlowMap{
+			PrimaryMap:   primary,
+			SecondaryMap: secondary,
+		},
+		Iface: string(iface),
+	}, nil
+}
+
+func readFlowSnapshotMap(br *bufio.Reader, keyWidth int) (*hashmap.Map, error) {
+	nFlows, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read number of flows: %w", ErrInvalidFlowSnapshot, err)
+	}
+
+	m := hashmap.New(int(min(nFlows, maxFlowSnapshotPrealloc)))
+	key := make(types.Key, keyWidth)
+	for i := uint64(0); i < nFlows; i++ {
+		if _, err = io.ReadFull(br, key); err != nil {
+			return nil, fmt.Errorf("%w: failed to read flow key: %w", ErrInvalidFlowSnapshot, err)
+		}
+
+		var counters [4]uint64
+		for j := range counters {
+			if counters[j], err = binary.ReadUvarint(br); err != nil {
+				return nil, fmt.Errorf("%w: failed to read flow counters: %w", ErrInvalidFlowSnapshot, err)
+			}
+		}
+		m.SetOrUpdate(key, counters[0], counters[1], counters[2], counters[3])
+	}
+
+	return m, nil
+}
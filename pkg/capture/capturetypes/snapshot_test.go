@@ -0,0 +1,70 @@
+package capturetypes
+
+import (
+	"bytes"
+	"math"
+	"net/netip"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowSnapshot(t *testing.T) {
+
+	flows := TaggedAggFlowMap{
+		Map:   hashmap.NewAggFlowMap(),
+		Iface: "eth0",
+	}
+	for i := 0; i < 1000; i++ {
+		flows.Map.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, byte(i >> 8), byte(i)}, [4]byte{10, 0, 0, 1}, []byte{0x01, 0xbb}, 6),
+			types.Counters{BytesRcvd: uint64(i) * 1000, BytesSent: uint64(i), PacketsRcvd: uint64(i) * 10, PacketsSent: 1})
+	}
+	flows.Map.SecondaryMap.Set(types.NewV6KeyStatic(netip.MustParseAddr("2001:db8::1").As16(), netip.MustParseAddr("2001:db8::2").As16(), []byte{0x00, 0x35}, 17),
+		types.Counters{BytesRcvd: math.MaxUint64, PacketsRcvd: 1})
+
+	buf := bytes.NewBuffer(nil)
+	require.Nil(t, WriteFlowSnapshot(buf, flows))
+	snapshot := buf.Bytes()
+
+	restored, err := ReadFlowSnapshot(bytes.NewReader(snapshot))
+	require.Nil(t, err)
+	require.Equal(t, flows.Iface, restored.Iface)
+	for _, m := range []struct {
+		expected, actual *hashmap.Map
+	}{
+		{flows.Map.PrimaryMap, restored.Map.PrimaryMap},
+		{flows.Map.SecondaryMap, restored.Map.SecondaryMap},
+	} {
+		require.Equal(t, m.expected.Len(), m.actual.Len())
+		for it := m.expected.Iter(); it.Next(); {
+			val, exists := m.actual.Get(it.Key())
+			require.True(t, exists)
+			require.Equal(t, it.Val(), val)
+		}
+	}
+
+	// an empty flow map results in an empty snapshot
+	buf.Reset()
+	require.Nil(t, WriteFlowSnapshot(buf, TaggedAggFlowMap{Iface: "eth1"}))
+	restored, err = ReadFlowSnapshot(buf)
+	require.Nil(t, err)
+	require.Equal(t, "eth1", restored.Iface)
+	require.Zero(t, restored.Map.Len())
+
+	// corrupt or truncated snapshots are rejected
+	for _, corrupt := range [][]byte{
+		nil,
+		[]byte("JSON"),
+		snapshot[:len(snapshot)-1],
+		append(bytes.Clone(snapshot), 0),
+	} {
+		_, err = ReadFlowSnapshot(bytes.NewReader(corrupt))
+		require.ErrorIs(t, err, ErrInvalidFlowSnapshot)
+	}
+	future := bytes.Clone(snapshot)
+	future[len(flowSnapshotMagic)]++
+	_, err = ReadFlowSnapshot(bytes.NewReader(future))
+	require.ErrorIs(t, err, ErrUnsupportedFlowSnapshotVersion)
+}
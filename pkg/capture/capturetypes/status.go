@@ -16,6 +16,9 @@ type TaggedAggFlowMap struct {
 	Map   *hashmap.AggFlowMap
 	Stats CaptureStats `json:"stats,omitempty"`
 	Iface string       `json:"iface"`
+
+	// Attributes holds the attributes recorded along with the flows of Map beyond their counters
+	Attributes FlowAttributes `json:"-"`
 }
 
 // InterfaceStats stores the statistics for each interface
@@ -37,9 +40,66 @@ type CaptureStats struct {
 	Dropped uint64 `json:"dropped" doc:"Number of packets dropped" example:"3"`
 	// DroppedTotal: denotes the number of packets dropped since the capture was started
 	DroppedTotal uint64 `json:"dropped_total" doc:"Number of packets dropped since the capture was started" example:"20"`
+	// QueueFreezes: denotes the number of times the kernel froze the ring buffer queue (e.g. because it was full)
+	QueueFreezes uint64 `json:"queue_freezes,omitempty" doc:"Number of times the kernel froze the ring buffer queue (e.g. because it was full)" example:"1"`
+	// QueueFreezesTotal: denotes the number of ring buffer queue freezes since the capture was started
+	QueueFreezesTotal uint64 `json:"queue_freezes_total,omitempty" doc:"Number of ring buffer queue freezes since the capture was started" example:"4"`
 
 	// ParsingErrors: denotes all packet parsing errors / failures encountered
 	ParsingErrors ParsingErrTracker `json:"parsing_errors,omitempty" doc:"All packet parsing errors / failures" example:"[23,0]"`
+	// Diagnostics: denotes hints on likely capture misconfigurations derived from the parsing errors
+	Diagnostics []ParsingDiagnostic `json:"diagnostics,omitempty" doc:"Hints on likely capture misconfigurations, derived from the rate of packet parsing errors over the last 15 minutes"`
+	// Decapsulated: denotes the number of packets decapsulated per tunnel encapsulation type
+	Decapsulated DecapsulationTracker `json:"decapsulated,omitempty" doc:"Number of packets decapsulated per tunnel encapsulation type (none, gre, vxlan, geneve)" example:"[0,12,340,0]"`
+	// NonIP: denotes the number of frames not carrying an IP layer per type (if counted)
+	NonIP *NonIPTracker `json:"non_ip,omitempty" doc:"Number of frames not carrying an IP layer (hence not accounted for in any flow) per type (arp, lldp, mpls, vlan, pppoe, llc, other), if counting them is enabled for the interface" example:"[120,4,0,0,0,30,2]"`
+
+	// FlowsCreated: denotes the number of flows added to the flow map since the last rotation
+	FlowsCreated uint64 `json:"flows_created" doc:"Number of flows added to the flow map since the last rotation (tracked continuously, i.e. not only upon rotation)" example:"1200"`
+	// FlowsCreatedTotal: denotes the number of flows added to the flow map since the capture was started
+	FlowsCreatedTotal uint64 `json:"flows_created_total" doc:"Number of flows added to the flow map since the capture was started" example:"840000"`
+
+	// LastPacketAt: denotes the (approximate) time when the last packet was processed by the capture
+	LastPacketAt time.Time `json:"last_packet_at" doc:"Time when the last packet was processed by the capture, determined at the granularity of rotations / status calls (zero if no packet was processed since the capture was started)" example:"2021-01-01T00:04:30Z"`
+
+	// Parameters: denotes the parameters effectively applied to the capture (if available)
+	Parameters *CaptureParameters `json:"parameters,omitempty" doc:"Parameters effectively applied to the capture, which may deviate from the configuration (e.g. due to alignment of the ring buffer)"`
+}
+
+// CaptureParameters stores the parameters effectively applied to the capture of an interface
+type CaptureParameters struct {
+	// RingBuffer: denotes the dimensions of the kernel ring buffer
+	RingBuffer RingBufferParameters `json:"ring_buffer" doc:"Dimensions of the kernel ring buffer"`
+	// CaptureLength: denotes the number of bytes captured per packet
+	CaptureLength int `json:"capture_length" doc:"Number of bytes captured per packet" example:"128"`
+	// ByteAccounting: denotes the basis the traffic volume is accounted on
+	ByteAccounting string `json:"byte_accounting" doc:"Basis the traffic volume is accounted on (l2, l3 or wire)" example:"l3"`
+	// Promiscuous: denotes whether the interface is in promiscuous mode (as reported by the kernel)
+	Promiscuous *bool `json:"promiscuous,omitempty" doc:"Whether the interface is in promiscuous mode, as reported by the kernel (omitted if unknown)" example:"true"`
+	// BPFFilter: denotes the BPF filter attached to the capture socket
+	BPFFilter []string `json:"bpf_filter,omitempty" doc:"BPF filter attached to the capture socket (disassembled instructions), including any extra instructions" example:"[\"ldh [12]\",\"jeq #0x800,1,0\"]"`
+	// SourcePortAggregation: denotes the aggregation of the client ports of flows to common ports
+	SourcePortAggregation SourcePortAggregationParameters `json:"source_port_aggregation" doc:"Aggregation of the client (source) ports of flows to common service ports"`
+}
+
+// SourcePortAggregationParameters stores the aggregation of the client ports of flows to common ports
+type SourcePortAggregationParameters struct {
+	// CommonPorts: denotes the service ports whose flows are subject to aggregation
+	CommonPorts []string `json:"common_ports" doc:"Service ports (and protocols) whose flows are subject to the aggregation of their client ports" example:"[\"53/udp\",\"443/tcp\"]"`
+	// Keep: denotes the (ranges of) service ports whose flows retain their client port
+	Keep []string `json:"keep,omitempty" doc:"Service ports (or ranges of ports) whose flows retain their client port" example:"[\"53\"]"`
+	// BucketSize: denotes the size of the buckets the client ports are aggregated into
+	BucketSize int `json:"bucket_size,omitempty" doc:"Size of the buckets the client ports of all other flows are aggregated into (discarded entirely if zero)" example:"4096"`
+}
+
+// RingBufferParameters stores the dimensions of a kernel ring buffer
+type RingBufferParameters struct {
+	// BlockSize: denotes the size of a block (aligned to the page size)
+	BlockSize int `json:"block_size" doc:"Size of a block in bytes, aligned to the page size" example:"1048576"`
+	// NumBlocks: denotes the number of blocks
+	NumBlocks int `json:"num_blocks" doc:"Number of blocks" example:"4"`
+	// Size: denotes the total size of the ring buffer
+	Size int `json:"size" doc:"Total size of the ring buffer in bytes" example:"4194304"`
 }
 
 // AddStats is a convenience method to total capture stats. This is relevant in the scope of
@@ -0,0 +1,7 @@
+package capturetypes
+
+import "github.com/els0r/goProbe/pkg/types"
+
+// TCPFlags maps the keys of TCP flows (in an aggregated flow map) to the OR-combination of the TCP flags
+// of all of their packets. Flows not contained in the map carried no TCP flags (e.g. non-TCP flows)
+type TCPFlags map[string]types.TCPFlags
@@ -0,0 +1,190 @@
+package capture
+
+import (
+	"encoding/binary"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/fako1024/slimcap/capture"
+	"github.com/fako1024/slimcap/link"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	greProto    = 0x2F // GRE : 47
+	vxlanPort   = 4789 // VXLAN : IANA assigned UDP port
+	genevePort  = 6081 // Geneve : IANA assigned UDP port
+	udpHdrLen   = 8
+	vxlanHdrLen = 8
+
+	greHdrMinLen      = 4
+	greFlagChecksum   = 0x80
+	greFlagKey        = 0x20
+	greFlagSeqNum     = 0x10
+	greVersionMask    = 0x07
+	geneveHdrMinLen   = 8
+	geneveVersionMask = 0xC0
+	geneveOptLenMask  = 0x3F
+
+	etherTypeIPv4  = 0x0800
+	etherTypeIPv6  = 0x86DD
+	etherTypeVLAN  = 0x8100
+	etherTypeQinQ  = 0x88A8
+	etherTypeTEB   = 0x6558 // Transparent Ethernet Bridging (used by GRE / Geneve to carry Ethernet frames)
+	etherHdrLen    = 14
+	vlanTagLen     = 4
+	maxGeneveOpts  = geneveOptLenMask * 4
+	maxEncapHdrLen = ipv6.HeaderLen + udpHdrLen + geneveHdrMinLen + maxGeneveOpts + etherHdrLen + 2*vlanTagLen
+)
+
+// captureLengthDecapsulation is a capture length strategy that ensures that the inner IP and
+// transport layer of a tunneled packet is covered (up to the maximum supported outer header length)
+var captureLengthDecapsulation link.CaptureLengthStrategy = func(l *link.Link) int {
+	return int(l.Type.IPHeaderOffset()) + maxEncapHdrLen + ipv6.HeaderLen + 14 // include inner transport layer up to TCP flag position
+}
+
+// Decapsulate attempts to strip the tunnel headers (GRE, VXLAN or Geneve) from the IP layer received
+// from a capture source. If the packet is tunneled, the inner IP layer and the encapsulation type are
+// returned. Otherwise (or if the inner packet cannot be extracted) the original IP layer is returned
+// unmodified along with capturetypes.EncapNone
+func Decapsulate(ipLayer capture.IPLayer) (capture.IPLayer, capturetypes.Encapsulation) {
+
+	var (
+		protocol byte
+		hdrLen   int
+	)
+
+	// Determine the transport protocol and length of the outer IP header
+	if iplayerType := ipLayer.Type(); iplayerType == ipLayerTypeV4 {
+		if len(ipLayer) < ipv4.HeaderLen {
+			return ipLayer, capturetypes.EncapNone
+		}
+
+		// Non-first fragments do not carry a tunnel header
+		if fragOffset := (uint16(0x1f&ipLayer[ipLayerV4FragFlagFirstByte]) << 8) | uint16(ipLayer[ipLayerV4FragFlagLastByte]); fragOffset != 0 {
+			return ipLayer, capturetypes.EncapNone
+		}
+
+		protocol = ipLayer[ipLayerV4ProtoPos]
+		if hdrLen = int(ipLayer[0]&0x0f) * 4; hdrLen < ipv4.HeaderLen || len(ipLayer) < hdrLen {
+			return ipLayer, capturetypes.EncapNone
+		}
+	} else if iplayerType == ipLayerTypeV6 {
+		if len(ipLayer) < ipv6.HeaderLen {
+			return ipLayer, capturetypes.EncapNone
+		}
+		protocol = ipLayer[ipLayerV6ProtoPos]
+		hdrLen = ipv6.HeaderLen
+	} else {
+		return ipLayer, capturetypes.EncapNone
+	}
+
+	if protocol == greProto {
+		if inner, ok := decapsulateGRE(ipLayer[hdrLen:]); ok {
+			return inner, capturetypes.EncapGRE
+		}
+		return ipLayer, capturetypes.EncapNone
+	}
+
+	if protocol == capturetypes.UDP {
+		if len(ipLayer) < hdrLen+udpHdrLen {
+			return ipLayer, capturetypes.EncapNone
+		}
+		dport := binary.BigEndian.Uint16(ipLayer[hdrLen+2 : hdrLen+4])
+		if dport == vxlanPort {
+			if inner, ok := decapsulateVXLAN(ipLayer[hdrLen+udpHdrLen:]); ok {
+				return inner, capturetypes.EncapVXLAN
+			}
+		} else if dport == genevePort {
+			if inner, ok := decapsulateGeneve(ipLayer[hdrLen+udpHdrLen:]); ok {
+				return inner, capturetypes.EncapGeneve
+			}
+		}
+	}
+
+	return ipLayer, capturetypes.EncapNone
+}
+
+func decapsulateGRE(payload []byte) (capture.IPLayer, bool) {
+	if len(payload) < greHdrMinLen || payload[1]&greVersionMask != 0 {
+		return nil, false
+	}
+
+	// Determine the header length based on the optional fields present
+	hdrLen := greHdrMinLen
+	if payload[0]&greFlagChecksum != 0 {
+		hdrLen += 4
+	}
+	if payload[0]&greFlagKey != 0 {
+		hdrLen += 4
+	}
+	if payload[0]&greFlagSeqNum != 0 {
+		hdrLen += 4
+	}
+	if len(payload) < hdrLen {
+		return nil, false
+	}
+
+	return innerIPLayer(binary.BigEndian.Uint16(payload[2:4]), payload[hdrLen:])
+}
+
+func decapsulateVXLAN(payload []byte) (capture.IPLayer, bool) {
+
+	// Check if the VNI flag is set (all valid VXLAN packets must have it)
+	if len(payload) < vxlanHdrLen || payload[0]&0x08 == 0 {
+		return nil, false
+	}
+
+	return innerIPLayer(etherTypeTEB, payload[vxlanHdrLen:])
+}
+
+func decapsulateGeneve(payload []byte) (capture.IPLayer, bool) {
+	if len(payload) < geneveHdrMinLen || payload[0]&geneveVersionMask != 0 {
+		return nil, false
+	}
+
+	hdrLen := geneveHdrMinLen + int(payload[0]&geneveOptLenMask)*4
+	if len(payload) < hdrLen {
+		return nil, false
+	}
+
+	return innerIPLayer(binary.BigEndian.Uint16(payload[2:4]), payload[hdrLen:])
+}
+
+// innerIPLayer extracts the inner IP layer from a tunnel payload of the given ethertype,
+// skipping an Ethernet header (and VLAN tags) in case of a bridged payload
+func innerIPLayer(etherType uint16, payload []byte) (capture.IPLayer, bool) {
+	if etherType == etherTypeTEB {
+		if len(payload) < etherHdrLen {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(payload[12:14])
+		payload = payload[etherHdrLen:]
+
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(payload) < vlanTagLen {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(payload[2:4])
+			payload = payload[vlanTagLen:]
+		}
+	}
+
+	// Validate that the inner IP layer is consistent with the ethertype and
+	// is large enough to be parsed
+	inner := capture.IPLayer(payload)
+	if etherType == etherTypeIPv4 {
+		if len(inner) < ipv4.HeaderLen || inner.Type() != ipLayerTypeV4 {
+			return nil, false
+		}
+		return inner, true
+	}
+	if etherType == etherTypeIPv6 {
+		if len(inner) < ipv6.HeaderLen || inner.Type() != ipLayerTypeV6 {
+			return nil, false
+		}
+		return inner, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,205 @@
+package capture
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/fako1024/slimcap/capture"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+var decapInnerTestCases = []testParams{
+	{"10.0.0.1", "10.0.0.2", 37485, 17500, capturetypes.TCP, 0, capturetypes.DirectionRemains},
+	{"10.0.0.1", "4.5.6.7", 0, 53, capturetypes.UDP, 0, capturetypes.DirectionRemains},
+	{"2c04:4000::6ab", "2c01:2000::3", 37485, 17500, capturetypes.TCP, 0, capturetypes.DirectionRemains},
+	{"2c04:4000::6ab", "2c01:2000::3", 0, 0, capturetypes.ICMPv6, 0x80, capturetypes.DirectionRemains},
+}
+
+func TestDecapsulation(t *testing.T) {
+	for _, params := range decapInnerTestCases {
+		testPacket := params.genDummyPacket(0)
+		inner := testPacket.IPLayer()
+		_, isIPv4 := params.genEPHash()
+
+		etherType := uint16(etherTypeIPv6)
+		if isIPv4 {
+			etherType = etherTypeIPv4
+		}
+
+		for name, tc := range map[string]struct {
+			ipLayer capture.IPLayer
+			encap   capturetypes.Encapsulation
+		}{
+			"GRE/IPv4":          {genOuterIPv4(greProto, genGRE(0x0, etherType, inner)), capturetypes.EncapGRE},
+			"GRE/IPv6":          {genOuterIPv6(greProto, genGRE(0x0, etherType, inner)), capturetypes.EncapGRE},
+			"GRE_Key_Seq/IPv4":  {genOuterIPv4(greProto, genGRE(greFlagKey|greFlagSeqNum, etherType, inner)), capturetypes.EncapGRE},
+			"GRE_TEB/IPv4":      {genOuterIPv4(greProto, genGRE(0x0, etherTypeTEB, genEthernet(etherType, true, inner))), capturetypes.EncapGRE},
+			"VXLAN/IPv4":        {genOuterIPv4(capturetypes.UDP, genUDP(vxlanPort, genVXLAN(genEthernet(etherType, false, inner)))), capturetypes.EncapVXLAN},
+			"VXLAN_VLAN/IPv6":   {genOuterIPv6(capturetypes.UDP, genUDP(vxlanPort, genVXLAN(genEthernet(etherType, true, inner)))), capturetypes.EncapVXLAN},
+			"Geneve/IPv4":       {genOuterIPv4(capturetypes.UDP, genUDP(genevePort, genGeneve(0, etherType, inner))), capturetypes.EncapGeneve},
+			"Geneve_Opts/IPv6":  {genOuterIPv6(capturetypes.UDP, genUDP(genevePort, genGeneve(3, etherType, inner))), capturetypes.EncapGeneve},
+			"Geneve_TEB/IPv4":   {genOuterIPv4(capturetypes.UDP, genUDP(genevePort, genGeneve(1, etherTypeTEB, genEthernet(etherType, false, inner)))), capturetypes.EncapGeneve},
+			"VXLAN_NoVNI/IPv4":  {genOuterIPv4(capturetypes.UDP, genUDP(vxlanPort, append(make([]byte, vxlanHdrLen), genEthernet(etherType, false, inner)...))), capturetypes.EncapNone},
+			"GRE_Short/IPv4":    {genOuterIPv4(greProto, genGRE(0x0, etherType, inner)[:greHdrMinLen-1]), capturetypes.EncapNone},
+			"UDP_Regular/IPv4":  {genOuterIPv4(capturetypes.UDP, genUDP(4790, genVXLAN(genEthernet(etherType, false, inner)))), capturetypes.EncapNone},
+			"GRE_Truncated/v6":  {genOuterIPv6(greProto, genGRE(0x0, etherType, inner[:8])), capturetypes.EncapNone},
+			"Geneve_Trunc/IPv4": {genOuterIPv4(capturetypes.UDP, genUDP(genevePort, genGeneve(3, etherType, nil)[:geneveHdrMinLen+4])), capturetypes.EncapNone},
+		} {
+			t.Run(params.String()+"_"+name, func(t *testing.T) {
+				decapsulated, encap := Decapsulate(tc.ipLayer)
+				require.Equal(t, tc.encap, encap)
+
+				// If the packet could not be decapsulated, it has to be returned unmodified
+				if tc.encap == capturetypes.EncapNone {
+					require.Equal(t, tc.ipLayer, decapsulated)
+					return
+				}
+				require.Equal(t, inner, decapsulated)
+
+				// Ensure that the flow is recorded based on the inner IP layer
+				refHash, _ := params.genEPHash()
+				if isIPv4 {
+					epHash, _, errno := ParsePacketV4(decapsulated)
+					require.Equal(t, capturetypes.ErrnoOK, errno)
+					require.Equal(t, capturetypes.EPHashV4(refHash), epHash)
+				} else {
+					epHash, _, errno := ParsePacketV6(decapsulated)
+					require.Equal(t, capturetypes.ErrnoOK, errno)
+					require.Equal(t, capturetypes.EPHashV6(refHash), epHash)
+				}
+			})
+		}
+	}
+}
+
+func TestDecapsulationNonTunneled(t *testing.T) {
+	for _, params := range testCases {
+		t.Run(params.String(), func(t *testing.T) {
+			testPacket := params.genDummyPacket(0)
+			ipLayer := testPacket.IPLayer()
+			decapsulated, encap := Decapsulate(ipLayer)
+			require.Equal(t, capturetypes.EncapNone, encap)
+			require.Equal(t, ipLayer, decapsulated)
+		})
+	}
+}
+
+func TestDecapsulatedFlows(t *testing.T) {
+	c := &Capture{
+		flowLog: NewFlowLog(),
+	}
+
+	tunneledPacket, plainPacket := decapInnerTestCases[0].genDummyPacket(0), decapInnerTestCases[1].genDummyPacket(0)
+	tunneled, plain := tunneledPacket.IPLayer(), plainPacket.IPLayer()
+	for _, ipLayer := range []capture.IPLayer{
+		genOuterIPv4(capturetypes.UDP, genUDP(vxlanPort, genVXLAN(genEthernet(etherTypeIPv4, false, tunneled)))),
+		plain,
+	} {
+		inner, encap := Decapsulate(ipLayer)
+		epHash, auxInfo, errno := ParsePacketV4(inner)
+		require.Equal(t, capturetypes.ErrnoOK, errno)
+		c.addToFlowLogV4(epHash, capture.PacketOutgoing, 128, auxInfo, capturetypes.FlowLabels{Encapsulation: encap})
+	}
+
+	// Only the tunneled flow is marked as decapsulated in the aggregated flow map
+	agg, _, attrs := c.flowLog.Rotate()
+	require.Equal(t, 2, agg.Len())
+	require.Len(t, attrs.Labeled, 1)
+	for key, shares := range attrs.Labeled {
+		require.Len(t, shares, 1)
+		require.Equal(t, capturetypes.EncapVXLAN, shares[0].Encapsulation)
+		_, exists := agg.PrimaryMap.Get(types.Key(key))
+		require.True(t, exists)
+		require.Equal(t, "decap:vxlan", shares[0].Encapsulation.Tag())
+	}
+	require.True(t, attrs.Decapsulated())
+
+	// Once the flow is removed from the flow log, so is its encapsulation
+	_, _, attrs = c.flowLog.Rotate()
+	require.Empty(t, attrs.Labeled)
+}
+
+func BenchmarkDecapsulation(b *testing.B) {
+	testPacket := decapInnerTestCases[0].genDummyPacket(0)
+	inner := testPacket.IPLayer()
+
+	for name, ipLayer := range map[string]capture.IPLayer{
+		"none":   inner,
+		"gre":    genOuterIPv4(greProto, genGRE(0x0, etherTypeIPv4, inner)),
+		"vxlan":  genOuterIPv4(capturetypes.UDP, genUDP(vxlanPort, genVXLAN(genEthernet(etherTypeIPv4, false, inner)))),
+		"geneve": genOuterIPv4(capturetypes.UDP, genUDP(genevePort, genGeneve(0, etherTypeIPv4, inner))),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = Decapsulate(ipLayer)
+			}
+		})
+	}
+}
+
+func genOuterIPv4(proto byte, payload []byte) capture.IPLayer {
+	data := make([]byte, ipv4.HeaderLen, ipv4.HeaderLen+len(payload))
+	data[0] = (4 << 4) | (ipv4.HeaderLen / 4)
+	data[ipLayerV4ProtoPos] = proto
+	copy(data[ipLayerV4SipStart:ipLayerV4SipEnd], []byte{192, 168, 0, 1})
+	copy(data[ipLayerV4DipStart:ipLayerV4DipEnd], []byte{192, 168, 0, 2})
+	return append(data, payload...)
+}
+
+func genOuterIPv6(proto byte, payload []byte) capture.IPLayer {
+	data := make([]byte, ipv6.HeaderLen, ipv6.HeaderLen+len(payload))
+	data[0] = (6 << 4)
+	data[ipLayerV6ProtoPos] = proto
+	data[ipLayerV6SipEnd-1] = 0x1
+	data[ipLayerV6DipEnd-1] = 0x2
+	return append(data, payload...)
+}
+
+func genUDP(dport uint16, payload []byte) []byte {
+	data := make([]byte, udpHdrLen)
+	binary.BigEndian.PutUint16(data[0:2], 54321)
+	binary.BigEndian.PutUint16(data[2:4], dport)
+	return append(data, payload...)
+}
+
+func genGRE(flags byte, etherType uint16, payload []byte) []byte {
+	data := make([]byte, greHdrMinLen)
+	data[0] = flags
+	binary.BigEndian.PutUint16(data[2:4], etherType)
+	for _, flag := range []byte{greFlagChecksum, greFlagKey, greFlagSeqNum} {
+		if flags&flag != 0 {
+			data = append(data, 0xFF, 0xFF, 0xFF, 0xFF)
+		}
+	}
+	return append(data, payload...)
+}
+
+func genVXLAN(payload []byte) []byte {
+	data := make([]byte, vxlanHdrLen)
+	data[0] = 0x08
+	data[6] = 0x2A // VNI 42
+	return append(data, payload...)
+}
+
+func genGeneve(optLen byte, etherType uint16, payload []byte) []byte {
+	data := make([]byte, geneveHdrMinLen+int(optLen)*4)
+	data[0] = optLen & geneveOptLenMask
+	binary.BigEndian.PutUint16(data[2:4], etherType)
+	return append(data, payload...)
+}
+
+func genEthernet(etherType uint16, vlan bool, payload []byte) []byte {
+	data := make([]byte, etherHdrLen-2)
+	if vlan {
+		data = binary.BigEndian.AppendUint16(data, etherTypeVLAN)
+		data = append(data, 0x00, 0x0A)
+	}
+	data = binary.BigEndian.AppendUint16(data, etherType)
+	return append(data, payload...)
+}
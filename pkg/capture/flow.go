@@ -32,6 +32,7 @@ const (
 	ipLayerTypeV4 = 0x04 // IPv4
 	ipLayerTypeV6 = 0x06 // IPv6
 
+	ipLayerV4ToSPos            = 1
 	ipLayerV4ProtoPos          = 9
 	ipLayerV4SipStart          = 12
 	ipLayerV4SipEnd            = 16
@@ -46,6 +47,8 @@ const (
 	ipLayerV4FragFlagLastByte  = 7
 
 	ipLayerV6BoundsLimit = ipv6.HeaderLen - 1
+	ipLayerV6TClassStart = 0
+	ipLayerV6TClassEnd   = 1
 	ipLayerV6ProtoPos    = 6
 	ipLayerV6SipStart    = 8
 	ipLayerV6SipEnd      = 24
@@ -70,6 +73,21 @@ const (
 type FlowLog struct {
 	flowMapV4 map[string]*Flow
 	flowMapV6 map[string]*Flow
+
+	// freeFlows holds Flow objects (reset to no packets and traffic) to be reused for new flows
+	freeFlows []*Flow
+
+	// prev holds the flows detached by the last call to Detach. They are never modified until the next
+	// call to Detach (hence may be read concurrently while being aggregated) and serve to retain the
+	// orientation of flows continuing across a rotation
+	prev *FlowLog
+
+	// spare holds the flow maps swapped in for the active ones by the next call to Detach, i.e. the flows
+	// detached by the call before the last one, which are cleared via recycle
+	spare *FlowLog
+
+	// records tracks NetFlow-style flow records delimited by active / idle timeouts (nil if disabled)
+	records *flowRecords
 }
 
 // NewFlowLog creates a new flow log for storing flows.
@@ -77,6 +95,14 @@ func NewFlowLog() *FlowLog {
 	return &FlowLog{
 		flowMapV4: make(map[string]*Flow),
 		flowMapV6: make(map[string]*Flow),
+		prev: &FlowLog{
+			flowMapV4: make(map[string]*Flow),
+			flowMapV6: make(map[string]*Flow),
+		},
+		spare: &FlowLog{
+			flowMapV4: make(map[string]*Flow),
+			flowMapV6: make(map[string]*Flow),
+		},
 	}
 }
 
@@ -110,6 +136,23 @@ func (f *FlowLog) FlowsV6() map[string]*Flow {
 // ParsePacketV4 processes / extracts all information contained in the v6 IP layer received
 // from a capture source and converts it to a hash and flags to be added to the flow map
 func ParsePacketV4(ipLayer capture.IPLayer) (epHash capturetypes.EPHashV4, auxInfo byte, errno capturetypes.ParsingErrno) {
+	return parsePacketV4(ipLayer, nil)
+}
+
+// dscpV4 extracts the DSCP from the ToS field of an IPv4 header
+func dscpV4(ipLayer capture.IPLayer) types.DSCP {
+	return types.DSCP(ipLayer[ipLayerV4ToSPos] >> 2)
+}
+
+// dscpV6 extracts the DSCP from the Traffic Class field of an IPv6 header (spanning the lower nibble
+// of its first and the upper nibble of its second byte)
+func dscpV6(ipLayer capture.IPLayer) types.DSCP {
+	return types.DSCP((ipLayer[ipLayerV6TClassStart]&0x0f)<<2 | ipLayer[ipLayerV6TClassEnd]>>6)
+}
+
+// parsePacketV4 parses a packet (see ParsePacketV4), aggregating the client ports of flows to common
+// ports according to portAgg
+func parsePacketV4(ipLayer capture.IPLayer, portAgg *portAggregation) (epHash capturetypes.EPHashV4, auxInfo byte, errno capturetypes.ParsingErrno) {
 
 	_ = ipLayer[ipLayerV4BoundsLimit] // bounds check hint to compiler
 	protocol := ipLayer[ipLayerV4ProtoPos]
@@ -179,12 +222,16 @@ ports:
 	// If session based traffic is observed, the source port is taken
 	// into account. A major exception is traffic over port 53 as
 	// considering every single DNS request/response would
-	// significantly fill up the flow map
+	// significantly fill up the flow map (unless tuned otherwise)
 	if !isCommonPort(dport, protocol) {
 		copy(epHash[capturetypes.EPHashV4SPortStart:capturetypes.EPHashV4SPortEnd], sport)
+	} else {
+		portAgg.put(epHash[capturetypes.EPHashV4SPortStart:capturetypes.EPHashV4SPortEnd], sport, dport)
 	}
 	if !isCommonPort(sport, protocol) {
 		copy(epHash[capturetypes.EPHashV4DPortStart:capturetypes.EPHashV4DPortEnd], dport)
+	} else {
+		portAgg.put(epHash[capturetypes.EPHashV4DPortStart:capturetypes.EPHashV4DPortEnd], dport, sport)
 	}
 
 finalize:
@@ -197,6 +244,12 @@ finalize:
 // ParsePacketV6 processes / extracts all information contained in the v6 IP layer received
 // from a capture source and converts it to a hash and flags to be added to the flow map
 func ParsePacketV6(ipLayer capture.IPLayer) (epHash capturetypes.EPHashV6, auxInfo byte, errno capturetypes.ParsingErrno) {
+	return parsePacketV6(ipLayer, nil)
+}
+
+// parsePacketV6 parses a packet (see ParsePacketV6), aggregating the client ports of flows to common
+// ports according to portAgg
+func parsePacketV6(ipLayer capture.IPLayer, portAgg *portAggregation) (epHash capturetypes.EPHashV6, auxInfo byte, errno capturetypes.ParsingErrno) {
 
 	_ = ipLayer[ipLayerV6BoundsLimit] // bounds check hint to compiler
 	protocol := ipLayer[ipLayerV6ProtoPos]
@@ -246,12 +299,16 @@ ports:
 	// If session based traffic is observed, the source port is taken
 	// into account. A major exception is traffic over port 53 as
 	// considering every single DNS request/response would
-	// significantly fill up the flow map
+	// significantly fill up the flow map (unless tuned otherwise)
 	if !isCommonPort(dport, protocol) {
 		copy(epHash[capturetypes.EPHashV6SPortStart:capturetypes.EPHashV6SPortEnd], sport)
+	} else {
+		portAgg.put(epHash[capturetypes.EPHashV6SPortStart:capturetypes.EPHashV6SPortEnd], sport, dport)
 	}
 	if !isCommonPort(sport, protocol) {
 		copy(epHash[capturetypes.EPHashV6DPortStart:capturetypes.EPHashV6DPortEnd], dport)
+	} else {
+		portAgg.put(epHash[capturetypes.EPHashV6DPortStart:capturetypes.EPHashV6DPortEnd], dport, sport)
 	}
 
 finalize:
@@ -261,13 +318,61 @@ finalize:
 	return
 }
 
-// Rotate rotates the flow log. All flows are reset to no packets and traffic.
-// Moreover, any flows not worth keeping (according to Flow.IsWorthKeeping)
-// are discarded.
+// Rotate rotates the flow log. All flows are detached (retaining the orientation of
+// flows continuing after the rotation) and the flows detached by the previous rotation
+// are cleared (their Flow objects being reused for subsequent flows).
 //
-// Returns an AggFlowMap containing all flows since the last call to Rotate.
-func (f *FlowLog) Rotate() (agg *hashmap.AggFlowMap, totals *types.Counters) {
-	return f.transferAndAggregate()
+// Returns an AggFlowMap containing all flows since the last call to Rotate, along with
+// the attributes recorded for them beyond their counters.
+func (f *FlowLog) Rotate() (agg *hashmap.AggFlowMap, totals *types.Counters, attrs capturetypes.FlowAttributes) {
+	detached := f.Detach()
+	agg, totals, attrs = detached.aggregateDetached()
+	f.recycle()
+
+	return
+}
+
+// Detach detaches all flows recorded since the last call to Detach / Rotate by swapping the active
+// flow maps with the spare ones (triple buffering), which takes constant time regardless of the number
+// of flows. The returned FlowLog holds the detached flows and may be aggregated concurrently to further
+// additions to f, which look it up to retain the orientation of continued flows. The flows detached by
+// the previous call become the spare ones and have to be cleared via recycle before the next call.
+func (f *FlowLog) Detach() (detached *FlowLog) {
+	detached = f.spare
+	f.flowMapV4, detached.flowMapV4 = detached.flowMapV4, f.flowMapV4
+	f.flowMapV6, detached.flowMapV6 = detached.flowMapV6, f.flowMapV6
+	f.freeFlows, detached.freeFlows = detached.freeFlows, f.freeFlows
+	f.prev, f.spare = detached, f.prev
+
+	return
+}
+
+// recycle clears the flows detached by the call to Detach before the last one (which are no longer
+// looked up), such that they can be swapped in again by the next call to Detach. It does not modify the
+// active flows, hence may be called concurrently to further additions to f.
+func (f *FlowLog) recycle() {
+	f.spare.reset()
+}
+
+// reset clears the flow maps of a FlowLog. The flow maps retain their capacity and the Flow objects are
+// reset for reuse by the flows recorded once the FlowLog has been swapped in again, hence neither has to
+// be reallocated in every interval.
+func (f *FlowLog) reset() {
+
+	// Only retain as many Flow objects as there were flows, releasing any unused ones
+	clear(f.freeFlows)
+	f.freeFlows = f.freeFlows[:0]
+
+	for _, v := range f.flowMapV4 {
+		v.Reset()
+		f.freeFlows = append(f.freeFlows, v)
+	}
+	for _, v := range f.flowMapV6 {
+		v.Reset()
+		f.freeFlows = append(f.freeFlows, v)
+	}
+	clear(f.flowMapV4)
+	clear(f.flowMapV6)
 }
 
 // Aggregate extracts an AggFlowMap from the currently active flowMap. The flowMap
@@ -306,7 +411,10 @@ func (f *FlowLog) Aggregate() (agg *hashmap.AggFlowMap) {
 	return
 }
 
-func (f *FlowLog) transferAndAggregate() (agg *hashmap.AggFlowMap, totals *types.Counters) {
+// aggregateDetached extracts an AggFlowMap (along with the traffic totals and the attributes recorded
+// for the flows beyond their counters) from a FlowLog obtained via Detach (or from the active one while
+// no flows are added to it). The FlowLog is only read in the process.
+func (f *FlowLog) aggregateDetached() (agg *hashmap.AggFlowMap, totals *types.Counters, attrs capturetypes.FlowAttributes) {
 
 	// Initialize aggregate flow map / result
 	agg = hashmap.NewAggFlowMap()
@@ -319,104 +427,207 @@ func (f *FlowLog) transferAndAggregate() (agg *hashmap.AggFlowMap, totals *types
 
 	for k, v := range f.flowMapV4 {
 
-		// Check if the flow actually has any interesting information for us, otherwise
-		// delete it from the FlowMap
-		if v.PacketsRcvd > 0 || v.PacketsSent > 0 {
+		// Update totals
+		totals.Add(v.Counters)
 
-			// Update totals
-			totals.Add(types.Counters(*v))
+		// Populate key buffer according to source flow and update result
+		keyBufV4.PutV4String(k)
+		agg.PrimaryMap.SetOrUpdate(keyBufV4, v.BytesRcvd, v.BytesSent, v.PacketsRcvd, v.PacketsSent)
+		transferAttributes(&attrs, v, keyBufV4)
+	}
 
-			// Populate key buffer according to source flow and update result
-			keyBufV4.PutV4String(k)
-			agg.PrimaryMap.SetOrUpdate(keyBufV4, v.BytesRcvd, v.BytesSent, v.PacketsRcvd, v.PacketsSent)
+	for k, v := range f.flowMapV6 {
 
-			// Reset the flow
-			v.Reset()
-			continue
-		}
+		// Update totals
+		totals.Add(v.Counters)
 
-		delete(f.flowMapV4, k)
+		// Populate key buffer according to source flow and update result
+		keyBufV6.PutV6String(k)
+		agg.SecondaryMap.SetOrUpdate(keyBufV6, v.BytesRcvd, v.BytesSent, v.PacketsRcvd, v.PacketsSent)
+		transferAttributes(&attrs, v, keyBufV6)
 	}
 
-	for k, v := range f.flowMapV6 {
+	return
+}
 
-		// Check if the flow actually has any interesting information for us, otherwise
-		// delete it from the FlowMap
-		if v.PacketsRcvd > 0 || v.PacketsSent > 0 {
+// addFlowV4 records an IPv4 flow for a packet not matching any flow in the active flow map. Flows
+// continuing across the last rotation retain their orientation, all others are oriented according to
+// the classified packet direction (the MAC addresses of the labels of the packet being reversed along
+// with the flow). Returns whether the flow is a new one (i.e. not continued)
+func (f *FlowLog) addFlowV4(epHash, epHashReverse capturetypes.EPHashV4, pktType capture.PacketType, pktSize uint32, auxInfo byte, tcpFlags types.TCPFlags, labels capturetypes.FlowLabels) (created bool) {
+	if _, existsReverseHash := f.prev.flowMapV4[string(epHashReverse[:])]; existsReverseHash {
+		f.flowMapV4[string(epHashReverse[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels.Reverse())
+		return false
+	}
+	if _, existsHash := f.prev.flowMapV4[string(epHash[:])]; existsHash {
+		f.flowMapV4[string(epHash[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels)
+		return false
+	}
 
-			// Update totals
-			totals.Add(types.Counters(*v))
+	if direction := capturetypes.ClassifyPacketDirectionV4(epHash, auxInfo); direction == capturetypes.DirectionReverts {
+		f.flowMapV4[string(epHashReverse[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels.Reverse())
+	} else {
+		f.flowMapV4[string(epHash[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels)
+	}
+	return true
+}
 
-			// Populate key buffer according to source flow and update result
-			keyBufV6.PutV6String(k)
-			agg.SecondaryMap.SetOrUpdate(keyBufV6, v.BytesRcvd, v.BytesSent, v.PacketsRcvd, v.PacketsSent)
+// addFlowV6 records an IPv6 flow for a packet not matching any flow in the active flow map (see
+// addFlowV4)
+func (f *FlowLog) addFlowV6(epHash, epHashReverse capturetypes.EPHashV6, pktType capture.PacketType, pktSize uint32, auxInfo byte, tcpFlags types.TCPFlags, labels capturetypes.FlowLabels) (created bool) {
+	if _, existsReverseHash := f.prev.flowMapV6[string(epHashReverse[:])]; existsReverseHash {
+		f.flowMapV6[string(epHashReverse[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels.Reverse())
+		return false
+	}
+	if _, existsHash := f.prev.flowMapV6[string(epHash[:])]; existsHash {
+		f.flowMapV6[string(epHash[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels)
+		return false
+	}
 
-			// Reset the flow
-			v.Reset()
-			continue
-		}
+	if direction := capturetypes.ClassifyPacketDirectionV6(epHash, auxInfo); direction == capturetypes.DirectionReverts {
+		f.flowMapV6[string(epHashReverse[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels.Reverse())
+	} else {
+		f.flowMapV6[string(epHash[:])] = f.newFlow(pktType, pktSize, tcpFlags, labels)
+	}
+	return true
+}
+
+// newFlow creates a new flow based on the packet, reusing a Flow object released by a previous
+// rotation (if available)
+func (f *FlowLog) newFlow(pktType capture.PacketType, pktSize uint32, tcpFlags types.TCPFlags, labels capturetypes.FlowLabels) *Flow {
+	n := len(f.freeFlows)
+	if n == 0 {
+		flow := NewFlow(pktType, pktSize, tcpFlags, labels)
+		f.touch(flow)
+		return flow
+	}
 
-		delete(f.flowMapV6, k)
+	flow := f.freeFlows[n-1]
+	f.freeFlows = f.freeFlows[:n-1]
+	flow.UpdateFlow(pktType, pktSize, tcpFlags, labels)
+	f.touch(flow)
+	return flow
+}
 
+// touch updates the state of the flow record of a flow upon a packet (if flow records are tracked)
+func (f *FlowLog) touch(flow *Flow) {
+	if f.records != nil {
+		f.records.touch(flow)
 	}
+}
 
-	return
+// transferAttributes assigns the attributes of the flow v to the aggregated flow identified by key, i.e.
+// its shares observed with labels and the TCP flags of its remaining packets (allocating the maps of
+// attrs upon first use)
+func transferAttributes(attrs *capturetypes.FlowAttributes, v *Flow, key types.Key) {
+	if v.TCPFlags != 0 {
+		if attrs.TCPFlags == nil {
+			attrs.TCPFlags = make(capturetypes.TCPFlags)
+		}
+		attrs.TCPFlags[string(key)] |= v.TCPFlags
+	}
+	if len(v.Labeled) == 0 {
+		return
+	}
+
+	if attrs.Labeled == nil {
+		attrs.Labeled = make(capturetypes.LabeledFlows)
+	}
+	for _, share := range v.Labeled {
+		attrs.Labeled.Add(string(key), share)
+	}
 }
 
 func (f *FlowLog) clone() (f2 *FlowLog) {
 	f2 = NewFlowLog()
 	for k, v := range f.flowMapV4 {
-		vCopy := *v
-		f2.flowMapV4[k] = &vCopy
+		f2.flowMapV4[k] = v.clone()
 	}
 	for k, v := range f.flowMapV6 {
-		vCopy := *v
-		f2.flowMapV6[k] = &vCopy
+		f2.flowMapV6[k] = v.clone()
 	}
 	return
 }
 
-// Flow stores a goProbe flow (alias for types.Counters to allow for extension with
-// flow specific methods)
-type Flow types.Counters
+// Flow stores a goProbe flow, i.e. its counters (extended with flow specific methods) along
+// with the OR-combination of the TCP flags of all of its packets (zero for non-TCP flows). Packets
+// carrying any labels (e.g. a VLAN ID) are additionally accounted to the share of the flow observed
+// with the same labels, which comprises their TCP flags instead
+type Flow struct {
+	types.Counters
+	TCPFlags types.TCPFlags             `json:"tcp_flags,omitempty"`
+	Labeled  []capturetypes.LabeledFlow `json:"labeled,omitempty"`
+
+	// record tracks the packets of the flow with respect to its flow record (nil unless enabled)
+	record *flowRecordState
+}
 
 // NewFlow creates a new flow based on the packet
-func NewFlow(pktType capture.PacketType, pktTotalLen uint32) *Flow {
+func NewFlow(pktType capture.PacketType, pktTotalLen uint32, tcpFlags types.TCPFlags, labels capturetypes.FlowLabels) *Flow {
+	f := new(Flow)
+	f.UpdateFlow(pktType, pktTotalLen, tcpFlags, labels)
+	return f
+}
 
-	// Set packet and byte counters with respect to the interface direction
-	if pktType == capture.PacketOutgoing {
-		return &Flow{
-			BytesSent:   uint64(pktTotalLen),
-			PacketsSent: 1,
-		}
+// UpdateFlow increments flow counters (and accumulates the TCP flags) if the packet belongs to an
+// existing flow
+func (f *Flow) UpdateFlow(pktType capture.PacketType, pktTotalLen uint32, tcpFlags types.TCPFlags, labels capturetypes.FlowLabels) {
+	countPacket(&f.Counters, pktType, pktTotalLen)
+	if labels.IsZero() {
+		f.TCPFlags |= tcpFlags
+		return
 	}
 
-	return &Flow{
-		BytesRcvd:   uint64(pktTotalLen),
-		PacketsRcvd: 1,
+	// Packets carrying labels are accounted to the share of the flow observed with the same labels
+	// (of which there are usually very few, if more than one at all)
+	for i := range f.Labeled {
+		if f.Labeled[i].FlowLabels == labels {
+			countPacket(&f.Labeled[i].Counters, pktType, pktTotalLen)
+			f.Labeled[i].TCPFlags |= tcpFlags
+			return
+		}
 	}
+	share := capturetypes.LabeledFlow{FlowLabels: labels, TCPFlags: tcpFlags}
+	countPacket(&share.Counters, pktType, pktTotalLen)
+	f.Labeled = append(f.Labeled, share)
 }
 
-// UpdateFlow increments flow counters if the packet belongs to an existing flow
-func (f *Flow) UpdateFlow(pktType capture.PacketType, pktTotalLen uint32) {
-
-	// increment packet and byte counters with respect to its interface direction
+// countPacket increments the packet and byte counters with respect to the interface direction
+func countPacket(c *types.Counters, pktType capture.PacketType, pktTotalLen uint32) {
 	if pktType == capture.PacketOutgoing {
-		f.BytesSent += uint64(pktTotalLen)
-		f.PacketsSent++
+		c.BytesSent += uint64(pktTotalLen)
+		c.PacketsSent++
 		return
 	}
 
-	f.BytesRcvd += uint64(pktTotalLen)
-	f.PacketsRcvd++
+	c.BytesRcvd += uint64(pktTotalLen)
+	c.PacketsRcvd++
 }
 
-// Reset resets / null all counter values
+// Reset resets / null all counter values (and the TCP flags / labeled shares / flow record state)
 func (f *Flow) Reset() {
 	f.BytesRcvd = 0
 	f.BytesSent = 0
 	f.PacketsRcvd = 0
 	f.PacketsSent = 0
+	f.TCPFlags = 0
+	f.Labeled = f.Labeled[:0]
+	if f.record != nil {
+		f.record.reset()
+	}
+}
+
+func (f *Flow) clone() *Flow {
+	fCopy := *f
+	if f.Labeled != nil {
+		fCopy.Labeled = append([]capturetypes.LabeledFlow(nil), f.Labeled...)
+	}
+	if f.record != nil {
+		record := *f.record
+		record.gaps = append([]recordSplit(nil), f.record.gaps...)
+		fCopy.record = &record
+	}
+	return &fCopy
 }
 
 // FlowInfo summarizes information about a given flow
@@ -0,0 +1,248 @@
+package capture
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const (
+	// DefaultFlowActiveTimeout denotes the default duration after which an active flow record is
+	// expired (and continued in a new record), matching common NetFlow exporter defaults
+	DefaultFlowActiveTimeout = 30 * time.Minute
+
+	// DefaultFlowIdleTimeout denotes the default duration without packets after which a flow record
+	// is expired, matching common NetFlow exporter defaults
+	DefaultFlowIdleTimeout = 15 * time.Second
+
+	minFlowRecordClockInterval = time.Second
+	maxFlowRecordClockInterval = time.Minute
+)
+
+// FlowTimeouts denotes the active / idle timeouts delimiting flow records (defaults are used for
+// any timeout that is zero)
+type FlowTimeouts struct {
+	Active time.Duration
+	Idle   time.Duration
+}
+
+func (t FlowTimeouts) withDefaults() FlowTimeouts {
+	if t.Active <= 0 {
+		t.Active = DefaultFlowActiveTimeout
+	}
+	if t.Idle <= 0 {
+		t.Idle = DefaultFlowIdleTimeout
+	}
+	return t
+}
+
+// clockInterval returns the interval in which the clock of the flow records advances. Since packets are
+// not timestamped individually, it determines the accuracy of the start / end of the records
+func (t FlowTimeouts) clockInterval() time.Duration {
+	return min(max(min(t.Active, t.Idle)/4, minFlowRecordClockInterval), maxFlowRecordClockInterval)
+}
+
+// FlowRecordHandler denotes a function receiving the flow records expired on an interface, e.g. in
+// order to export them. It is called outside of the capture lock, but must not block for long
+type FlowRecordHandler func(iface string, records capturetypes.FlowRecords)
+
+// flowRecordState tracks the packets of a flow with respect to its flow record. It is updated upon each
+// packet (based on the clock of the flow records) and evaluated once the flow has been detached
+type flowRecordState struct {
+	first, last int64         // time of the first / last packet of the flow (in ns since the epoch)
+	gaps        []recordSplit // idle gaps between packets of the flow, each ending its record
+}
+
+// recordSplit denotes a gap between two packets of a flow exceeding the idle timeout
+type recordSplit struct {
+	end, next int64          // time of the last packet before / the first packet after the gap
+	counters  types.Counters // counters of the flow before the gap
+}
+
+func (s *flowRecordState) reset() {
+	s.first, s.last = 0, 0
+	s.gaps = s.gaps[:0]
+}
+
+// flowRecord denotes the NetFlow-style record of a flow, accrued across rotations of the flow log
+type flowRecord struct {
+	counters    types.Counters
+	start, last int64
+}
+
+// flowRecords tracks the flow records of a FlowLog. Processing a packet merely updates the state of its
+// flow, the records themselves are accrued from the detached flows upon rotation (outside of the capture
+// lock), hence they are expired at the first rotation after one of the timeouts elapsed
+type flowRecords struct {
+	timeouts FlowTimeouts
+	handlers []FlowRecordHandler
+
+	// clock denotes the current time (in ns since the epoch), advanced in the clock interval
+	clock atomic.Int64
+
+	mu      sync.Mutex
+	records map[string]*flowRecord // keyed by the same hash as the flow maps
+}
+
+func newFlowRecords(timeouts FlowTimeouts, handlers ...FlowRecordHandler) *flowRecords {
+	r := &flowRecords{
+		timeouts: timeouts.withDefaults(),
+		handlers: handlers,
+		records:  make(map[string]*flowRecord),
+	}
+	r.clock.Store(time.Now().UnixNano())
+
+	return r
+}
+
+// touch updates the state of the record of a flow upon a packet, which must be called before the packet
+// is accounted to the flow (except for its first packet)
+func (r *flowRecords) touch(flow *Flow) {
+	now := r.clock.Load()
+	if flow.record == nil {
+		flow.record = new(flowRecordState)
+	}
+	state := flow.record
+	if state.last == now {
+		return
+	}
+
+	if state.last == 0 {
+		state.first = now
+	} else if now-state.last >= int64(r.timeouts.Idle) {
+		state.gaps = append(state.gaps, recordSplit{end: state.last, next: now, counters: flow.Counters})
+	}
+	state.last = now
+}
+
+// rotate accrues the flows of a detached FlowLog to their records and expires all records which exceeded
+// one of the timeouts. It does not require the capture lock, but has to be called before the detached
+// flows are reset
+func (r *flowRecords) rotate(detached *FlowLog, now time.Time) (expired capturetypes.FlowRecords) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired = r.accrue(detached, expired)
+	for k, rec := range r.records {
+		switch {
+		case now.UnixNano()-rec.last >= int64(r.timeouts.Idle):
+			expired = append(expired, r.expire(k, rec, capturetypes.FlowEndIdleTimeout))
+		case now.UnixNano()-rec.start >= int64(r.timeouts.Active):
+			expired = append(expired, r.expire(k, rec, capturetypes.FlowEndActiveTimeout))
+		}
+	}
+	return
+}
+
+// flush accrues the flows of the (active) FlowLog and expires all records, e.g. when the capture is
+// stopped (hence no further packets are processed)
+func (r *flowRecords) flush(f *FlowLog) (expired capturetypes.FlowRecords) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired = r.accrue(f, expired)
+	for k, rec := range r.records {
+		expired = append(expired, r.expire(k, rec, capturetypes.FlowEndForced))
+	}
+	return
+}
+
+// accrue adds the flows of a FlowLog to their records, expiring records upon idle gaps (the caller
+// must hold the lock)
+func (r *flowRecords) accrue(f *FlowLog, expired capturetypes.FlowRecords) capturetypes.FlowRecords {
+	for _, flows := range []map[string]*Flow{f.flowMapV4, f.flowMapV6} {
+		for k, flow := range flows {
+			if flow.record == nil || flow.record.last == 0 {
+				continue
+			}
+
+			// Each idle gap ends the record, the packets after it being accounted to a new one
+			start, prev := flow.record.first, types.Counters{}
+			for _, gap := range flow.record.gaps {
+				counters := gap.counters
+				counters.Sub(prev)
+				expired = r.add(k, start, gap.end, counters, expired)
+				start, prev = gap.next, gap.counters
+			}
+			counters := flow.Counters
+			counters.Sub(prev)
+			expired = r.add(k, start, flow.record.last, counters, expired)
+		}
+	}
+	return expired
+}
+
+// add accounts the packets of a flow observed between start and end to its record (the caller must
+// hold the lock)
+func (r *flowRecords) add(k string, start, end int64, counters types.Counters, expired capturetypes.FlowRecords) capturetypes.FlowRecords {
+	rec, exists := r.records[k]
+	if exists && start-rec.last >= int64(r.timeouts.Idle) {
+		expired = append(expired, r.expire(k, rec, capturetypes.FlowEndIdleTimeout))
+		exists = false
+	}
+	if !exists {
+		rec = &flowRecord{start: start}
+		r.records[k] = rec
+	}
+	rec.counters.Add(counters)
+	rec.last = end
+
+	return expired
+}
+
+// expire returns the flow record and removes it, so that any subsequent packets of the flow are
+// accounted for in a new record (the caller must hold the lock)
+func (r *flowRecords) expire(k string, rec *flowRecord, reason capturetypes.FlowEndReason) capturetypes.FlowRecord {
+	record := capturetypes.FlowRecord{
+		Start:    time.Unix(0, rec.start),
+		End:      time.Unix(0, rec.last),
+		Counters: rec.counters,
+		Reason:   reason,
+	}
+	if len(k) == capturetypes.EPHashSizeV4 {
+		record.Key = types.NewEmptyV4Key()
+		record.Key.PutV4String(k)
+		record.SrcPort = binary.BigEndian.Uint16([]byte(k[capturetypes.EPHashV4SPortStart:capturetypes.EPHashV4SPortEnd]))
+	} else {
+		record.Key = types.NewEmptyV6Key()
+		record.Key.PutV6String(k)
+		record.SrcPort = binary.BigEndian.Uint16([]byte(k[capturetypes.EPHashV6SPortStart:capturetypes.EPHashV6SPortEnd]))
+	}
+	delete(r.records, k)
+
+	return record
+}
+
+// emit counts the expired records and hands them to all handlers
+func (r *flowRecords) emit(iface string, expired capturetypes.FlowRecords) {
+	if len(expired) == 0 {
+		return
+	}
+	for _, record := range expired {
+		promFlowRecords.WithLabelValues(iface, record.Reason.String()).Inc()
+	}
+	for _, handler := range r.handlers {
+		handler(iface, expired)
+	}
+}
+
+// advanceFlowRecordClock periodically advances the clock of the flow records until the capture is closed
+func (c *Capture) advanceFlowRecordClock() {
+	defer c.wgRecords.Done()
+
+	ticker := time.NewTicker(c.flowLog.records.timeouts.clockInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopRecords:
+			return
+		case now := <-ticker.C:
+			c.flowLog.records.clock.Store(now.UnixNano())
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/fako1024/slimcap/capture"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowRecords(t *testing.T) {
+	epHash := capturetypes.EPHashV4{
+		10, 0, 0, 1, // sip
+		0xc3, 0x50, // sport (50000)
+		10, 0, 0, 2, // dip
+		0x1f, 0x90, // dport (8080)
+		capturetypes.TCP,
+	}
+
+	flowLog := NewFlowLog()
+	flowLog.records = newFlowRecords(FlowTimeouts{Active: time.Minute, Idle: 10 * time.Second})
+
+	t0 := time.Unix(1700000000, 0)
+	packetAt := func(ts time.Time, hash capturetypes.EPHashV4, pktType capture.PacketType) {
+		flowLog.records.clock.Store(ts.UnixNano())
+		if flow, exists := flowLog.flowMapV4[string(hash[:])]; exists {
+			flowLog.touch(flow)
+			flow.UpdateFlow(pktType, 100, 0, capturetypes.FlowLabels{})
+			return
+		}
+		flowLog.flowMapV4[string(hash[:])] = flowLog.newFlow(pktType, 100, 0, capturetypes.FlowLabels{})
+	}
+	rotate := func(now time.Time) capturetypes.FlowRecords {
+		expired := flowLog.records.rotate(flowLog.Detach(), now)
+		flowLog.recycle()
+		return expired
+	}
+
+	// the record continues across rotations
+	packetAt(t0, epHash, capture.PacketOutgoing)
+	packetAt(t0, epHash, capture.PacketThisHost)
+	require.Empty(t, rotate(t0.Add(5*time.Second)))
+
+	// the active timeout expires the record upon the next rotation
+	for i := 1; i <= 11; i++ {
+		packetAt(t0.Add(time.Duration(i*5)*time.Second), epHash, capture.PacketOutgoing)
+	}
+	expired := rotate(t0.Add(time.Minute))
+	require.Len(t, expired, 1)
+	require.Equal(t, capturetypes.FlowEndActiveTimeout, expired[0].Reason)
+	require.EqualValues(t, 50000, expired[0].SrcPort)
+	require.EqualValues(t, 8080, uint16(expired[0].Key.GetDport()[0])<<8|uint16(expired[0].Key.GetDport()[1]))
+	require.EqualValues(t, 12, expired[0].PacketsSent)
+	require.EqualValues(t, 1, expired[0].PacketsRcvd)
+	require.EqualValues(t, 1300, expired[0].SumBytes())
+	require.Equal(t, t0, expired[0].Start)
+	require.Equal(t, t0.Add(55*time.Second), expired[0].End)
+	require.Empty(t, flowLog.records.records)
+
+	// an idle gap between the packets of a flow ends its record, the subsequent packets being
+	// accounted to a new one (which expires once it is idle itself)
+	packetAt(t0.Add(2*time.Minute), epHash, capture.PacketThisHost)
+	packetAt(t0.Add(2*time.Minute+20*time.Second), epHash, capture.PacketThisHost)
+	packetAt(t0.Add(2*time.Minute+20*time.Second), epHash, capture.PacketThisHost)
+	expired = rotate(t0.Add(2*time.Minute + 25*time.Second))
+	require.Len(t, expired, 1)
+	require.Equal(t, capturetypes.FlowEndIdleTimeout, expired[0].Reason)
+	require.EqualValues(t, 1, expired[0].PacketsRcvd)
+	require.Equal(t, t0.Add(2*time.Minute), expired[0].Start)
+	require.Equal(t, t0.Add(2*time.Minute), expired[0].End)
+
+	expired = rotate(t0.Add(3 * time.Minute))
+	require.Len(t, expired, 1)
+	require.Equal(t, capturetypes.FlowEndIdleTimeout, expired[0].Reason)
+	require.EqualValues(t, 2, expired[0].PacketsRcvd)
+	require.Zero(t, expired[0].PacketsSent)
+	require.Equal(t, t0.Add(2*time.Minute+20*time.Second), expired[0].Start)
+	require.Empty(t, flowLog.records.records)
+
+	// all records (including the flows not yet rotated) are expired upon flush
+	packetAt(t0.Add(4*time.Minute), epHash, capture.PacketOutgoing)
+	require.Empty(t, rotate(t0.Add(4*time.Minute+time.Second)))
+	packetAt(t0.Add(4*time.Minute+5*time.Second), epHash, capture.PacketOutgoing)
+	expired = flowLog.records.flush(flowLog)
+	require.Len(t, expired, 1)
+	require.Equal(t, capturetypes.FlowEndForced, expired[0].Reason)
+	require.EqualValues(t, 2, expired[0].PacketsSent)
+	require.Equal(t, t0.Add(4*time.Minute), expired[0].Start)
+	require.Equal(t, t0.Add(4*time.Minute+5*time.Second), expired[0].End)
+	require.Empty(t, flowLog.records.flush(NewFlowLog()))
+}
+
+func TestFlowTimeoutsClockInterval(t *testing.T) {
+	require.Equal(t, DefaultFlowIdleTimeout/4, FlowTimeouts{}.withDefaults().clockInterval())
+	require.Equal(t, minFlowRecordClockInterval, FlowTimeouts{Active: time.Second, Idle: time.Second}.clockInterval())
+	require.Equal(t, maxFlowRecordClockInterval, FlowTimeouts{Active: time.Hour, Idle: time.Hour}.clockInterval())
+}
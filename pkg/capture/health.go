@@ -0,0 +1,147 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	parsingHealthWindow       = 15 * time.Minute // window over which the parsing errors are evaluated
+	parsingHealthMinPackets   = 1000             // minimum number of packets processed within the window for a diagnosis
+	parsingHealthMaxErrorRate = 0.01             // fraction of packets affected by an error that triggers a diagnosis
+
+	// increment of the capture length suggested in case of truncated packets
+	captureLengthIncrement = 64
+)
+
+// parsingHealth tracks the packet parsing errors of an interface over a sliding window in order to
+// detect profiles suggesting a misconfigured capture length or corrupt mirrored traffic
+type parsingHealth struct {
+	samples []parsingSample
+
+	// errors a diagnostic is currently raised for (in order to log state transitions only)
+	raised [capturetypes.NumParsingErrors]bool
+}
+
+type parsingSample struct {
+	at        time.Time
+	processed uint64
+	errors    capturetypes.ParsingErrTracker
+}
+
+// captureLengths describes the capture length of an interface and the lengths required to cover
+// the IP header / transport layer of its packets
+type captureLengths struct {
+	current   int
+	ipHeader  int
+	transport int
+}
+
+// observe adds the packets processed and the parsing errors encountered since the previous observation
+// and drops all samples that have left the window
+func (h *parsingHealth) observe(at time.Time, processed uint64, errors capturetypes.ParsingErrTracker) {
+	h.samples = append(h.samples, parsingSample{
+		at:        at,
+		processed: processed,
+		errors:    errors,
+	})
+
+	var expired int
+	for expired < len(h.samples) && at.Sub(h.samples[expired].at) > parsingHealthWindow {
+		expired++
+	}
+	h.samples = h.samples[expired:]
+}
+
+// diagnose evaluates the parsing errors within the window and provides a diagnostic for each error
+// affecting a significant fraction of the packets
+func (h *parsingHealth) diagnose(lengths captureLengths) (diagnostics []capturetypes.ParsingDiagnostic) {
+	var (
+		processed uint64
+		errors    capturetypes.ParsingErrTracker
+	)
+	for _, sample := range h.samples {
+		processed += sample.processed
+		for i := capturetypes.ErrnoInvalidIPHeader; i < capturetypes.NumParsingErrors; i++ {
+			errors[i] += sample.errors[i]
+		}
+	}
+	if processed < parsingHealthMinPackets {
+		return nil
+	}
+
+	for i := capturetypes.ErrnoInvalidIPHeader; i < capturetypes.NumParsingErrors; i++ {
+		rate := float64(errors[i]) / float64(processed)
+		if rate < parsingHealthMaxErrorRate {
+			continue
+		}
+
+		diagnostic := capturetypes.ParsingDiagnostic{
+			Error: i.String(),
+			Rate:  rate,
+		}
+		switch i {
+		case capturetypes.ErrnoInvalidIPHeader:
+			if lengths.current < lengths.ipHeader {
+				diagnostic.Hint = fmt.Sprintf("the capture length (%d bytes) does not cover the IP header", lengths.current)
+				diagnostic.SuggestedCaptureLength = lengths.transport
+			} else {
+				diagnostic.Hint = "packets carry neither a valid IPv4 nor IPv6 header, the mirrored traffic is likely corrupt or carries an unsupported encapsulation (check the span / mirror port)"
+			}
+		case capturetypes.ErrnoPacketTruncated:
+			diagnostic.Hint = fmt.Sprintf("packets are truncated before their transport layer, the capture length (%d bytes) is likely too small (e.g. due to IP options, IPv6 extension headers or encapsulation)", lengths.current)
+			diagnostic.SuggestedCaptureLength = lengths.transport
+			if lengths.current >= lengths.transport {
+				diagnostic.SuggestedCaptureLength = min(lengths.current+captureLengthIncrement, config.MaxCaptureLength)
+			}
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return
+}
+
+// logTransitions logs all diagnostics raised since the previous call as well as all errors no longer
+// being diagnosed
+func (h *parsingHealth) logTransitions(ctx context.Context, diagnostics []capturetypes.ParsingDiagnostic) {
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
+
+	for i := capturetypes.ErrnoInvalidIPHeader; i < capturetypes.NumParsingErrors; i++ {
+		idx := slices.IndexFunc(diagnostics, func(diagnostic capturetypes.ParsingDiagnostic) bool {
+			return diagnostic.Error == i.String()
+		})
+
+		switch {
+		case idx >= 0 && !h.raised[i]:
+			diagnostic := diagnostics[idx]
+			diagLogger := logger.With("error", diagnostic.Error, "rate", fmt.Sprintf("%.4f", diagnostic.Rate))
+			if diagnostic.SuggestedCaptureLength > 0 {
+				diagLogger = diagLogger.With("suggested_capture_length", diagnostic.SuggestedCaptureLength)
+			}
+			diagLogger.Warnf("high rate of packet parsing errors: %s", diagnostic.Hint)
+		case idx < 0 && h.raised[i]:
+			logger.With("error", i.String()).Info("rate of packet parsing errors back to normal")
+		}
+		h.raised[i] = idx >= 0
+	}
+}
+
+// captureLengths determines the capture length of the interface and the lengths required to cover the
+// IP header / transport layer of its packets
+func (c *Capture) captureLengths() (lengths captureLengths) {
+	l := c.captureHandle.Link()
+	if l == nil {
+		return
+	}
+	return captureLengths{
+		current:   captureLengthStrategy(c.config)(l),
+		ipHeader:  int(l.Type.IPHeaderOffset()) + ipv4.HeaderLen,
+		transport: defaultCaptureLengthStrategy(c.config)(l),
+	}
+}
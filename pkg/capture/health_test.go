@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsingHealth(t *testing.T) {
+	lengths := captureLengths{current: 128, ipHeader: 34, transport: 68}
+	newErrors := func(invalidIPHeader, truncated int) (errors capturetypes.ParsingErrTracker) {
+		errors[capturetypes.ErrnoInvalidIPHeader] = invalidIPHeader
+		errors[capturetypes.ErrnoPacketTruncated] = truncated
+		return
+	}
+
+	var h parsingHealth
+	t0 := time.Now()
+
+	// too few packets within the window for a diagnosis
+	h.observe(t0, 500, newErrors(0, 100))
+	require.Empty(t, h.diagnose(lengths))
+
+	// high rate of truncated packets across the window
+	h.observe(t0.Add(5*time.Minute), 1500, newErrors(1, 0))
+	diagnostics := h.diagnose(lengths)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, capturetypes.ErrnoPacketTruncated.String(), diagnostics[0].Error)
+	require.InDelta(t, 0.05, diagnostics[0].Rate, 1e-9)
+	require.Equal(t, 128+captureLengthIncrement, diagnostics[0].SuggestedCaptureLength)
+
+	// a capture length below the transport layer is raised to the minimal length covering it
+	require.Equal(t, 68, h.diagnose(captureLengths{current: 54, ipHeader: 34, transport: 68})[0].SuggestedCaptureLength)
+
+	// the truncated packets leave the window, invalid IP headers are attributed to the mirrored traffic
+	h.observe(t0.Add(16*time.Minute), 10000, newErrors(500, 0))
+	diagnostics = h.diagnose(lengths)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, capturetypes.ErrnoInvalidIPHeader.String(), diagnostics[0].Error)
+	require.Zero(t, diagnostics[0].SuggestedCaptureLength)
+
+	// unless the capture length does not even cover the IP header
+	diagnostics = h.diagnose(captureLengths{current: 20, ipHeader: 34, transport: 68})
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, 68, diagnostics[0].SuggestedCaptureLength)
+
+	// the diagnostics are resolved once the errors have left the window
+	h.observe(t0.Add(40*time.Minute), 10000, newErrors(0, 0))
+	require.Empty(t, h.diagnose(lengths))
+}
@@ -0,0 +1,13 @@
+//go:build !slimcap_nomock
+// +build !slimcap_nomock
+
+package capture
+
+import "github.com/els0r/goProbe/pkg/capture/ingest"
+
+// newIngestSource initializes a source ingesting the flow records exported by a device
+func newIngestSource(c *Capture) (Source, error) {
+	return ingest.NewSource(c.iface, c.config.Ingest.Listen,
+		ingest.WithSamplingRate(c.config.Ingest.SamplingRate),
+	)
+}
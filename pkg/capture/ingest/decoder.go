@@ -0,0 +1,364 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// Versions of the supported export protocols (as denoted by the first two bytes of a datagram, which
+// are zero for sFlow since its version is encoded as 32 bit value)
+const (
+	versionSFlow     = 0
+	versionNetFlowV5 = 5
+	versionNetFlowV9 = 9
+	versionIPFIX     = 10
+)
+
+const (
+	headerLenV5    = 24
+	recordLenV5    = 48
+	headerLenV9    = 20
+	headerLenIPFIX = 16
+	setHeaderLen   = 4
+
+	templateSetIDV9           = 0
+	optionsTemplateSetIDV9    = 1
+	templateSetIDIPFIX        = 2
+	optionsTemplateSetIDIPFIX = 3
+	minDataSetID              = 256
+
+	// enterpriseBit denotes an enterprise-specific information element (IPFIX only)
+	enterpriseBit = 0x8000
+
+	// variableLength denotes an information element of variable length (IPFIX only)
+	variableLength = 0xffff
+
+	// maxTemplates limits the number of templates retained across all exporters
+	maxTemplates = 4096
+)
+
+// Information elements evaluated from NetFlow v9 / IPFIX records (the IDs below 128 are shared by
+// both protocols)
+const (
+	ieOctetDeltaCount          = 1
+	iePacketDeltaCount         = 2
+	ieProtocolIdentifier       = 4
+	ieIPClassOfService         = 5
+	ieSourceTransportPort      = 7
+	ieSourceIPv4Address        = 8
+	ieDestinationTransportPort = 11
+	ieDestinationIPv4Address   = 12
+	ieSourceIPv6Address        = 27
+	ieDestinationIPv6Address   = 28
+	ieICMPTypeCodeIPv4         = 32
+	ieSamplingInterval         = 34
+	ieSourceMacAddress         = 56
+	ieVlanID                   = 58
+	ieFlowDirection            = 61
+	ieDestinationMacAddress    = 80
+	ieICMPTypeCodeIPv6         = 139
+	ieDot1qVlanID              = 243
+	ieSamplingPacketInterval   = 305
+)
+
+var (
+	errTruncated          = errors.New("truncated datagram")
+	errUnsupportedVersion = errors.New("unsupported datagram version (supported: NetFlow v5 / v9, IPFIX, sFlow v5)")
+	errUnknownTemplate    = errors.New("data set references unknown template")
+)
+
+type templateKey struct {
+	exporter   netip.Addr
+	domainID   uint32
+	templateID uint16
+}
+
+type templateField struct {
+	id     uint16 // zero for enterprise-specific information elements (which are skipped)
+	length uint16
+}
+
+// decoder decodes NetFlow v5 / v9, IPFIX and sFlow v5 datagrams into flow records, maintaining the
+// NetFlow v9 / IPFIX templates announced by the exporters. It must not be used concurrently
+type decoder struct {
+	templates map[templateKey][]templateField
+
+	// samplingRate is applied to the records not carrying a sampling rate of their own
+	samplingRate uint64
+}
+
+func newDecoder(samplingRate uint64) *decoder {
+	return &decoder{
+		templates:    make(map[templateKey][]templateField),
+		samplingRate: max(samplingRate, 1),
+	}
+}
+
+// decode decodes a datagram received from exporter, appending its flow records to recs. Any records
+// decoded prior to an error are retained
+func (d *decoder) decode(exporter netip.Addr, data []byte, recs []Record) ([]Record, error) {
+	if len(data) < 4 {
+		return recs, errTruncated
+	}
+
+	switch version := binary.BigEndian.Uint16(data); version {
+	case versionSFlow:
+		return d.decodeSFlow(data, recs)
+	case versionNetFlowV5:
+		return d.decodeNetFlowV5(data, recs)
+	case versionNetFlowV9, versionIPFIX:
+		return d.decodeTemplated(exporter, version, data, recs)
+	default:
+		return recs, fmt.Errorf("%w: %d", errUnsupportedVersion, version)
+	}
+}
+
+func (d *decoder) decodeNetFlowV5(data []byte, recs []Record) ([]Record, error) {
+	if len(data) < headerLenV5 {
+		return recs, errTruncated
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	if len(data) < headerLenV5+count*recordLenV5 {
+		return recs, errTruncated
+	}
+
+	// The two most significant bits denote the sampling mode, the remaining ones the interval
+	samplingRate := d.samplingRate
+	if interval := uint64(binary.BigEndian.Uint16(data[22:]) & 0x3fff); interval > 0 {
+		samplingRate = interval
+	}
+
+	for i := 0; i < count; i++ {
+		rec := data[headerLenV5+i*recordLenV5:]
+		r := Record{
+			SIP:      netip.AddrFrom4([4]byte(rec[0:4])),
+			DIP:      netip.AddrFrom4([4]byte(rec[4:8])),
+			Packets:  uint64(binary.BigEndian.Uint32(rec[16:])),
+			Bytes:    uint64(binary.BigEndian.Uint32(rec[20:])),
+			SPort:    binary.BigEndian.Uint16(rec[32:]),
+			DPort:    binary.BigEndian.Uint16(rec[34:]),
+			Protocol: rec[38],
+			DSCP:     types.DSCP(rec[39] >> 2),
+		}
+		r.scale(samplingRate)
+		if r.valid() {
+			recs = append(recs, r)
+		}
+	}
+
+	return recs, nil
+}
+
+// decodeTemplated decodes a NetFlow v9 / IPFIX datagram
+func (d *decoder) decodeTemplated(exporter netip.Addr, version uint16, data []byte, recs []Record) ([]Record, error) {
+	var (
+		domainID                    uint32
+		templateSetID, optionsSetID uint16 = templateSetIDIPFIX, optionsTemplateSetIDIPFIX
+		ipfix                              = version == versionIPFIX
+	)
+	if ipfix {
+		if len(data) < headerLenIPFIX {
+			return recs, errTruncated
+		}
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < headerLenIPFIX || length > len(data) {
+			return recs, errTruncated
+		}
+		domainID = binary.BigEndian.Uint32(data[12:])
+		data = data[headerLenIPFIX:length]
+	} else {
+		if len(data) < headerLenV9 {
+			return recs, errTruncated
+		}
+		domainID = binary.BigEndian.Uint32(data[16:])
+		templateSetID, optionsSetID = templateSetIDV9, optionsTemplateSetIDV9
+		data = data[headerLenV9:]
+	}
+
+	var err error
+	for len(data) >= setHeaderLen {
+		setID, length := binary.BigEndian.Uint16(data), int(binary.BigEndian.Uint16(data[2:]))
+		if length < setHeaderLen || length > len(data) {
+			return recs, errTruncated
+		}
+		set := data[setHeaderLen:length]
+		data = data[length:]
+
+		switch {
+		case setID == templateSetID:
+			if err := d.parseTemplates(templateKey{exporter: exporter, domainID: domainID}, set, ipfix); err != nil {
+				return recs, err
+			}
+		case setID == optionsSetID || setID < minDataSetID:
+			continue
+		default:
+			fields, exists := d.templates[templateKey{exporter: exporter, domainID: domainID, templateID: setID}]
+			if !exists {
+				// The template may be announced by a subsequent datagram, hence the remaining sets
+				// are still decoded
+				err = fmt.Errorf("%w: %d", errUnknownTemplate, setID)
+				continue
+			}
+			var setErr error
+			if recs, setErr = d.decodeDataSet(fields, set, recs); setErr != nil {
+				return recs, setErr
+			}
+		}
+	}
+
+	return recs, err
+}
+
+// parseTemplates parses the templates of a template set, registering them with the templates of the
+// exporter / observation domain denoted by key
+func (d *decoder) parseTemplates(key templateKey, set []byte, ipfix bool) error {
+
+	// The set may be padded, hence any remainder too short to hold a template header is ignored
+	for len(set) >= 4 {
+		key.templateID = binary.BigEndian.Uint16(set)
+		count := int(binary.BigEndian.Uint16(set[2:]))
+		set = set[4:]
+		if key.templateID < minDataSetID {
+			return nil
+		}
+
+		// A template without any fields withdraws the template (IPFIX only)
+		if count == 0 {
+			delete(d.templates, key)
+			continue
+		}
+
+		fields := make([]templateField, count)
+		for i := range fields {
+			if len(set) < 4 {
+				return errTruncated
+			}
+			fields[i] = templateField{id: binary.BigEndian.Uint16(set), length: binary.BigEndian.Uint16(set[2:])}
+			set = set[4:]
+
+			if ipfix && fields[i].id&enterpriseBit != 0 {
+				if len(set) < 4 {
+					return errTruncated
+				}
+				fields[i].id = 0
+				set = set[4:]
+			}
+		}
+
+		if _, exists := d.templates[key]; exists || len(d.templates) < maxTemplates {
+			d.templates[key] = fields
+		}
+	}
+
+	return nil
+}
+
+// decodeDataSet decodes the records of a data set according to the fields of its template
+func (d *decoder) decodeDataSet(fields []templateField, set []byte, recs []Record) ([]Record, error) {
+
+	// The set may be padded, hence decoding stops once the remainder is too short to hold a record
+	minLen := 0
+	for _, f := range fields {
+		if f.length == variableLength {
+			minLen++
+		} else {
+			minLen += int(f.length)
+		}
+	}
+	if minLen == 0 {
+		return recs, nil
+	}
+
+	for len(set) >= minLen {
+		var (
+			r            Record
+			icmpTypeCode uint16
+			hasICMP      bool
+			samplingRate = d.samplingRate
+		)
+		for _, f := range fields {
+			length := int(f.length)
+			if f.length == variableLength {
+				if len(set) < 1 {
+					return recs, errTruncated
+				}
+				length, set = int(set[0]), set[1:]
+				if length == 0xff {
+					if len(set) < 2 {
+						return recs, errTruncated
+					}
+					length, set = int(binary.BigEndian.Uint16(set)), set[2:]
+				}
+			}
+			if len(set) < length {
+				return recs, errTruncated
+			}
+			value := set[:length]
+			set = set[length:]
+
+			switch f.id {
+			case ieOctetDeltaCount:
+				r.Bytes = decodeUint(value)
+			case iePacketDeltaCount:
+				r.Packets = decodeUint(value)
+			case ieProtocolIdentifier:
+				r.Protocol = byte(decodeUint(value))
+			case ieSourceTransportPort:
+				r.SPort = uint16(decodeUint(value))
+			case ieDestinationTransportPort:
+				r.DPort = uint16(decodeUint(value))
+			case ieSourceIPv4Address, ieSourceIPv6Address:
+				r.SIP, _ = netip.AddrFromSlice(value)
+			case ieDestinationIPv4Address, ieDestinationIPv6Address:
+				r.DIP, _ = netip.AddrFromSlice(value)
+			case ieICMPTypeCodeIPv4, ieICMPTypeCodeIPv6:
+				icmpTypeCode, hasICMP = uint16(decodeUint(value)), true
+			case ieSamplingInterval, ieSamplingPacketInterval:
+				if rate := decodeUint(value); rate > 0 {
+					samplingRate = rate
+				}
+			case ieIPClassOfService:
+				r.DSCP = types.DSCP(byte(decodeUint(value)) >> 2)
+			case ieFlowDirection:
+				r.Outbound = decodeUint(value) == 1
+			case ieVlanID, ieDot1qVlanID:
+				if vlan := uint16(decodeUint(value)) & vlanIDMask; vlan != 0 {
+					r.VLAN = vlan
+				}
+			case ieSourceMacAddress:
+				if len(value) == types.MACWidth {
+					r.SMAC = types.MAC(value)
+				}
+			case ieDestinationMacAddress:
+				if len(value) == types.MACWidth {
+					r.DMAC = types.MAC(value)
+				}
+			}
+		}
+
+		if hasICMP && (r.Protocol == protoICMP || r.Protocol == protoICMPv6) {
+			r.DPort = icmpTypeCode
+		}
+		r.scale(samplingRate)
+		if r.valid() {
+			recs = append(recs, r)
+		}
+	}
+
+	return recs, nil
+}
+
+// decodeUint decodes a big-endian unsigned integer of up to eight bytes (reduced-size encoding)
+func decodeUint(value []byte) (res uint64) {
+	if len(value) > 8 {
+		value = value[len(value)-8:]
+	}
+	for _, b := range value {
+		res = res<<8 | uint64(b)
+	}
+	return
+}
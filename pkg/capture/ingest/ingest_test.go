@@ -0,0 +1,275 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/fako1024/slimcap/capture"
+	"github.com/stretchr/testify/require"
+)
+
+var testExporter = netip.MustParseAddr("192.0.2.1")
+
+func buildNetFlowV5(samplingInterval uint16, recs ...Record) []byte {
+	data := make([]byte, headerLenV5, headerLenV5+len(recs)*recordLenV5)
+	binary.BigEndian.PutUint16(data[0:], versionNetFlowV5)
+	binary.BigEndian.PutUint16(data[2:], uint16(len(recs)))
+	binary.BigEndian.PutUint16(data[22:], samplingInterval)
+	for _, r := range recs {
+		rec := make([]byte, recordLenV5)
+		sip, dip := r.SIP.As4(), r.DIP.As4()
+		copy(rec[0:], sip[:])
+		copy(rec[4:], dip[:])
+		binary.BigEndian.PutUint32(rec[16:], uint32(r.Packets))
+		binary.BigEndian.PutUint32(rec[20:], uint32(r.Bytes))
+		binary.BigEndian.PutUint16(rec[32:], r.SPort)
+		binary.BigEndian.PutUint16(rec[34:], r.DPort)
+		rec[38] = r.Protocol
+		rec[39] = byte(r.DSCP) << 2
+		data = append(data, rec...)
+	}
+	return data
+}
+
+// buildSet appends a set to a NetFlow v9 / IPFIX message
+func buildSet(msg []byte, setID uint16, content ...[]byte) []byte {
+	start := len(msg)
+	msg = binary.BigEndian.AppendUint16(msg, setID)
+	msg = append(msg, 0, 0)
+	for _, c := range content {
+		msg = append(msg, c...)
+	}
+	binary.BigEndian.PutUint16(msg[start+2:], uint16(len(msg)-start))
+	return msg
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func TestDecodeNetFlowV5(t *testing.T) {
+	recs, err := newDecoder(0).decode(testExporter, buildNetFlowV5(0x4000|10,
+		Record{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.2"), SPort: 50000, DPort: 443, Protocol: 6, Bytes: 1500, Packets: 3, DSCP: 34},
+		Record{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.3"), Protocol: 17},
+	), nil)
+	require.NoError(t, err)
+
+	// The empty record is skipped, the other one scaled by the sampling interval
+	require.Equal(t, []Record{
+		{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.2"), SPort: 50000, DPort: 443, Protocol: 6, Bytes: 15000, Packets: 30, DSCP: 34},
+	}, recs)
+
+	_, err = newDecoder(0).decode(testExporter, buildNetFlowV5(0, Record{SIP: testExporter, DIP: testExporter})[:headerLenV5+10], nil)
+	require.ErrorIs(t, err, errTruncated)
+	_, err = newDecoder(0).decode(testExporter, []byte{0, 7, 0, 0}, nil)
+	require.ErrorIs(t, err, errUnsupportedVersion)
+}
+
+func TestDecodeNetFlowV9(t *testing.T) {
+	header := func() []byte {
+		msg := make([]byte, headerLenV9)
+		binary.BigEndian.PutUint16(msg[0:], versionNetFlowV9)
+		binary.BigEndian.PutUint32(msg[16:], 42)
+		return msg
+	}
+
+	// IPv6 template using reduced-size counters and announcing the direction / sampling interval / class of service
+	template := buildSet(header(), templateSetIDV9,
+		u16(300), u16(9),
+		u16(ieSourceIPv6Address), u16(16), u16(ieDestinationIPv6Address), u16(16),
+		u16(ieSourceTransportPort), u16(2), u16(ieDestinationTransportPort), u16(2),
+		u16(ieProtocolIdentifier), u16(1), u16(ieOctetDeltaCount), u16(4),
+		u16(iePacketDeltaCount), u16(4), u16(ieFlowDirection), u16(1),
+		u16(ieIPClassOfService), u16(1),
+	)
+	sip, dip := netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::2")
+	record := append(append(sip.AsSlice(), dip.AsSlice()...), append(append(u16(53000), u16(53)...), 17)...)
+	record = append(append(append(record, u32(200)...), u32(2)...), 1, 46<<2|0x01) // the ECN bits are ignored
+	data := buildSet(header(), 300, record, record, []byte{0, 0})                  // padded
+
+	dec := newDecoder(5)
+
+	// Data sets referencing templates not yet announced cannot be decoded
+	recs, err := dec.decode(testExporter, data, nil)
+	require.ErrorIs(t, err, errUnknownTemplate)
+	require.Empty(t, recs)
+
+	recs, err = dec.decode(testExporter, template, nil)
+	require.NoError(t, err)
+	require.Empty(t, recs)
+
+	// The templates are maintained per exporter / source ID
+	_, err = dec.decode(netip.MustParseAddr("192.0.2.2"), data, nil)
+	require.ErrorIs(t, err, errUnknownTemplate)
+
+	recs, err = dec.decode(testExporter, data, nil)
+	require.NoError(t, err)
+	expected := Record{SIP: sip, DIP: dip, SPort: 53000, DPort: 53, Protocol: 17, Bytes: 1000, Packets: 10, Outbound: true, DSCP: 46}
+	require.Equal(t, []Record{expected, expected}, recs)
+}
+
+func TestDecodeIPFIX(t *testing.T) {
+	message := func(sets ...[]byte) []byte {
+		msg := make([]byte, headerLenIPFIX)
+		binary.BigEndian.PutUint16(msg[0:], versionIPFIX)
+		binary.BigEndian.PutUint32(msg[12:], 1)
+		for _, set := range sets {
+			msg = append(msg, set...)
+		}
+		binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)))
+		return msg
+	}
+
+	// IPv4 template including a variable-length and an enterprise-specific element
+	template := buildSet(nil, templateSetIDIPFIX,
+		u16(256), u16(9),
+		u16(ieSourceIPv4Address), u16(4), u16(ieDestinationIPv4Address), u16(4),
+		u16(ieProtocolIdentifier), u16(1), u16(ieICMPTypeCodeIPv4), u16(2),
+		u16(82), u16(variableLength), // interfaceName
+		u16(enterpriseBit|1), u16(4), u32(9), // enterprise-specific
+		u16(ieOctetDeltaCount), u16(8), u16(iePacketDeltaCount), u16(8),
+		u16(ieDot1qVlanID), u16(2),
+	)
+	options := buildSet(nil, optionsTemplateSetIDIPFIX, u16(257), u16(1), u16(1), u16(ieSamplingInterval), u16(4))
+	record := append(netip.MustParseAddr("10.0.0.1").AsSlice(), netip.MustParseAddr("10.0.0.2").AsSlice()...)
+	record = append(append(append(record, 1), u16(0x0800)...), 4, 'e', 't', 'h', '0')
+	record = append(append(append(record, u32(0xdeadbeef)...), u64(840)...), u64(10)...)
+	record = append(record, u16(0x2064)...) // priority bits are ignored
+	data := buildSet(nil, 256, record)
+
+	recs, err := newDecoder(0).decode(testExporter, message(template, options, data), nil)
+	require.NoError(t, err)
+	require.Equal(t, []Record{
+		{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.2"), DPort: 0x0800, Protocol: 1, Bytes: 840, Packets: 10, VLAN: 100},
+	}, recs)
+
+	// Sets exceeding the message are rejected
+	msg := message(template, data)
+	_, err = newDecoder(0).decode(testExporter, msg[:len(msg)-1], nil)
+	require.ErrorIs(t, err, errTruncated)
+
+	// Templates may be withdrawn
+	dec := newDecoder(0)
+	_, err = dec.decode(testExporter, message(template), nil)
+	require.NoError(t, err)
+	_, err = dec.decode(testExporter, message(buildSet(nil, templateSetIDIPFIX, u16(256), u16(0))), nil)
+	require.NoError(t, err)
+	_, err = dec.decode(testExporter, message(data), nil)
+	require.ErrorIs(t, err, errUnknownTemplate)
+}
+
+func TestDecodeSFlow(t *testing.T) {
+	xdr := func(fields ...[]byte) (res []byte) {
+		for _, f := range fields {
+			res = append(res, f...)
+		}
+		return
+	}
+	opaque := func(format uint32, data []byte) []byte {
+		res := xdr(u32(format), u32(uint32(len(data))), data)
+		for len(res)%4 != 0 {
+			res = append(res, 0)
+		}
+		return res
+	}
+
+	// Ethernet frame carrying a VLAN tag and a TCP SYN (the header is truncated after the TCP flags)
+	frame := xdr([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, u16(etherTypeVLAN), u16(100), u16(etherTypeIPv4))
+	ipHdr := make([]byte, 20)
+	ipHdr[0], ipHdr[1], ipHdr[9] = 0x45, 46<<2, protoTCP
+	copy(ipHdr[12:], netip.MustParseAddr("10.0.0.1").AsSlice())
+	copy(ipHdr[16:], netip.MustParseAddr("10.0.0.2").AsSlice())
+	frame = xdr(frame, ipHdr, u16(50000), u16(443), make([]byte, 9), []byte{0x02})
+	rawHeader := opaque(sflowRawPacketHeader, xdr(u32(sflowHeaderEthernet), u32(1022), u32(4), u32(uint32(len(frame))), frame))
+
+	// Sampled IPv6 packet (described in addition to the raw header of the same packet)
+	sampledIPv6 := opaque(sflowSampledIPv6, xdr(u32(100), u32(17),
+		netip.MustParseAddr("2001:db8::1").AsSlice(), netip.MustParseAddr("2001:db8::2").AsSlice(),
+		u32(40000), u32(53), u32(0), u32(0),
+	))
+
+	// Flow sample taken on ingress of interface 3, expanded flow sample taken on egress of interface 7
+	flowSample := opaque(sflowFlowSample, xdr(u32(1), u32(3), u32(100), u32(0), u32(0), u32(3), u32(5), u32(2), rawHeader, sampledIPv6))
+	expandedSample := opaque(sflowExpandedFlowSample, xdr(u32(2), u32(0), u32(7), u32(10), u32(0), u32(0), u32(0), u32(2), u32(0), u32(7), u32(1), sampledIPv6))
+	counterSample := opaque(2, make([]byte, 16))
+
+	datagram := xdr(u32(sflowVersion), u32(sflowAddrIPv4), testExporter.AsSlice(), u32(0), u32(1), u32(1000), u32(3),
+		flowSample, counterSample, expandedSample)
+
+	recs, err := newDecoder(0).decode(testExporter, datagram, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Record{
+		{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.2"), SPort: 50000, DPort: 443, Protocol: protoTCP, TCPFlags: 0x02, Bytes: 100 * 1000, Packets: 100, VLAN: 100,
+			SMAC: types.MAC{6, 7, 8, 9, 10, 11}, DMAC: types.MAC{0, 1, 2, 3, 4, 5}, DSCP: 46},
+		{SIP: netip.MustParseAddr("2001:db8::1"), DIP: netip.MustParseAddr("2001:db8::2"), SPort: 40000, DPort: 53, Protocol: 17, Bytes: 10 * 100, Packets: 10, Outbound: true},
+	}, recs)
+
+	_, err = newDecoder(0).decode(testExporter, datagram[:len(datagram)-8], nil)
+	require.ErrorIs(t, err, errTruncated)
+}
+
+func TestWritePacket(t *testing.T) {
+	var buf [maxPacketLen]byte
+
+	pkt := (&Record{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.2"), SPort: 50000, DPort: 443, Protocol: protoTCP, TCPFlags: 0x12, DSCP: 46}).writePacket(&buf)
+	require.Len(t, pkt, 40)
+	require.Equal(t, []byte{0x45, 46 << 2}, pkt[0:2])
+	require.Equal(t, byte(protoTCP), capture.IPLayer(pkt).Protocol())
+	require.Equal(t, []byte{10, 0, 0, 1, 10, 0, 0, 2}, pkt[12:20])
+	require.Equal(t, uint16(50000), binary.BigEndian.Uint16(pkt[20:]))
+	require.Equal(t, uint16(443), binary.BigEndian.Uint16(pkt[22:]))
+	require.Equal(t, byte(0x12), pkt[33])
+
+	pkt = (&Record{SIP: netip.MustParseAddr("2001:db8::1"), DIP: netip.MustParseAddr("2001:db8::2"), DPort: 0x8000, Protocol: protoICMPv6, DSCP: 46}).writePacket(&buf)
+	require.Len(t, pkt, 60)
+	require.Equal(t, []byte{0x6b, 0x80}, pkt[0:2])
+	require.Equal(t, byte(protoICMPv6), pkt[6])
+	require.Equal(t, netip.MustParseAddr("2001:db8::2").AsSlice(), pkt[24:40])
+	require.Equal(t, []byte{0x80, 0x00, 0x00, 0x00}, pkt[40:44])
+}
+
+func TestSource(t *testing.T) {
+	src, err := NewSource("router0", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	conn, err := net.Dial("udp", src.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(buildNetFlowV5(0,
+		Record{SIP: netip.MustParseAddr("10.0.0.1"), DIP: netip.MustParseAddr("10.0.0.2"), SPort: 50000, DPort: 443, Protocol: protoTCP, Bytes: 302, Packets: 3},
+		Record{SIP: netip.MustParseAddr("10.0.0.3"), DIP: netip.MustParseAddr("10.0.0.2"), SPort: 50000, DPort: 80, Protocol: protoTCP, Bytes: 60},
+	))
+	require.NoError(t, err)
+
+	// The volume of the records is distributed across their packets
+	var sizes []uint32
+	for i := 0; i < 4; i++ {
+		ipLayer, pktType, pktSize, err := src.NextIPPacketZeroCopy()
+		require.NoError(t, err)
+		require.Equal(t, capture.PacketThisHost, pktType)
+		require.Equal(t, byte(0x45), ipLayer[0])
+		sizes = append(sizes, pktSize)
+	}
+	require.Equal(t, []uint32{101, 101, 100, 60}, sizes)
+
+	stats, err := src.Stats()
+	require.NoError(t, err)
+	require.Equal(t, capture.Stats{PacketsReceived: 4}, stats)
+
+	// A blocking call is released upon an unblock request
+	time.AfterFunc(50*time.Millisecond, func() {
+		require.NoError(t, src.Unblock())
+	})
+	_, _, _, err = src.NextIPPacketZeroCopy()
+	require.ErrorIs(t, err, capture.ErrCaptureUnblocked)
+
+	require.NoError(t, src.Close())
+	_, _, _, err = src.NextIPPacketZeroCopy()
+	require.ErrorIs(t, err, capture.ErrCaptureStopped)
+	require.Nil(t, src.Link())
+}
@@ -0,0 +1,37 @@
+package ingest
+
+import (
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const ingestSubsystem = "ingest"
+
+var datagramsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: ingestSubsystem,
+	Name:      "datagrams_received_total",
+	Help:      "Total number of NetFlow / IPFIX / sFlow datagrams received and decoded",
+}, []string{"iface"})
+
+var datagramsInvalid = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: ingestSubsystem,
+	Name:      "datagrams_invalid_total",
+	Help:      "Total number of datagrams received which could not be decoded (entirely)",
+}, []string{"iface"})
+
+var recordsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: ingestSubsystem,
+	Name:      "records_received_total",
+	Help:      "Total number of flow records received",
+}, []string{"iface"})
+
+func init() {
+	prometheus.MustRegister(
+		datagramsReceived,
+		datagramsInvalid,
+		recordsReceived,
+	)
+}
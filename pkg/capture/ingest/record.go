@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Protocols requiring special treatment when synthesizing packets
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoICMPv6 = 58
+)
+
+// transportLen denotes the length of the transport layer of a synthesized packet, covering the TCP
+// header (and hence the ports / TCP flags evaluated by the packet parser)
+const transportLen = 20
+
+// maxPacketLen denotes the maximum length of a synthesized packet
+const maxPacketLen = ipv6.HeaderLen + transportLen
+
+// Record denotes a flow record decoded from a NetFlow / IPFIX / sFlow datagram
+type Record struct {
+	SIP, DIP     netip.Addr
+	SPort, DPort uint16
+	Protocol     byte
+
+	// TCPFlags denotes the TCP flags of a sampled packet (only set if they determine the initiator of
+	// the flow, e.g. for packet samples, which the cumulative flags of aggregated records cannot)
+	TCPFlags byte
+
+	Bytes, Packets uint64
+
+	// Outbound denotes if the flow was observed on egress (the ingress direction is assumed otherwise)
+	Outbound bool
+
+	// VLAN denotes the 802.1Q VLAN ID the flow was observed on (zero if untagged / unknown)
+	VLAN uint16
+
+	// SMAC / DMAC denote the source / destination MAC addresses of the flow (zero if unknown)
+	SMAC, DMAC types.MAC
+
+	// DSCP denotes the DSCP of the flow (zero if default / unknown)
+	DSCP types.DSCP
+}
+
+// valid returns if the record denotes an IPv4 / IPv6 flow carrying any traffic
+func (r *Record) valid() bool {
+	if !r.SIP.IsValid() || !r.DIP.IsValid() || r.SIP.Is4() != r.DIP.Is4() {
+		return false
+	}
+	return r.Bytes > 0 || r.Packets > 0
+}
+
+// scale accounts for the sampling of the record
+func (r *Record) scale(samplingRate uint64) {
+	if samplingRate > 1 {
+		r.Bytes *= samplingRate
+		r.Packets *= samplingRate
+	}
+}
+
+// writePacket synthesizes the IP / transport layer of a packet of the flow into buf, returning the
+// populated part of it
+func (r *Record) writePacket(buf *[maxPacketLen]byte) []byte {
+	*buf = [maxPacketLen]byte{}
+
+	hdrLen := ipv6.HeaderLen
+	if r.SIP.Is4() {
+		buf[0], buf[1] = 0x45, byte(r.DSCP)<<2
+		buf[9] = r.Protocol
+		sip, dip := r.SIP.As4(), r.DIP.As4()
+		copy(buf[12:16], sip[:])
+		copy(buf[16:20], dip[:])
+		hdrLen = ipv4.HeaderLen
+	} else {
+		buf[0], buf[1] = 0x60|byte(r.DSCP)>>2, byte(r.DSCP)<<6
+		buf[6] = r.Protocol
+		sip, dip := r.SIP.As16(), r.DIP.As16()
+		copy(buf[8:24], sip[:])
+		copy(buf[24:40], dip[:])
+	}
+	transport := buf[hdrLen : hdrLen+transportLen]
+
+	// ICMP type / code are conventionally encoded as destination port by flow exporters
+	if r.Protocol == protoICMP || r.Protocol == protoICMPv6 {
+		binary.BigEndian.PutUint16(transport[0:], r.DPort)
+	} else {
+		binary.BigEndian.PutUint16(transport[0:], r.SPort)
+		binary.BigEndian.PutUint16(transport[2:], r.DPort)
+		if r.Protocol == protoTCP {
+			transport[13] = r.TCPFlags
+		}
+	}
+
+	return buf[:hdrLen+transportLen]
+}
@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/fako1024/slimcap/capture"
+)
+
+// Replayer replays flow records as a series of synthesized packets each, providing the packet retrieval
+// methods of a capture source to any source consuming flow records (e.g. received from a device or
+// aggregated in kernel space)
+type Replayer struct {
+
+	// queue carries the records to the consumer, unblock signals a pending unblock request to it
+	queue   chan []Record
+	unblock chan struct{}
+
+	// State of the consumer (accessed by the Next*() methods only)
+	batch             []Record
+	pkt               capture.IPLayer
+	pktsLeft, pktSize uint64
+	pktsLarger        uint64 // number of remaining packets carrying an additional byte
+	pktType           capture.PacketType
+	vlan              uint16
+	smac, dmac        types.MAC
+	pktBuf            [maxPacketLen]byte
+	packetsEmitted    atomic.Uint64
+	packetsDropped    atomic.Uint64
+}
+
+// NewReplayer instantiates a new replayer, queueing up to queueSize batches of records for processing
+func NewReplayer(queueSize int) *Replayer {
+	return &Replayer{
+		queue:   make(chan []Record, queueSize),
+		unblock: make(chan struct{}, 1),
+	}
+}
+
+// Enqueue hands a batch of records to the consumer without blocking. If the queue is congested, the
+// records are dropped (counting their packets as dropped) and false is returned
+func (r *Replayer) Enqueue(recs []Record) bool {
+	select {
+	case r.queue <- recs:
+		return true
+	default:
+		var dropped uint64
+		for _, rec := range recs {
+			dropped += max(rec.Packets, 1)
+		}
+		r.packetsDropped.Add(dropped)
+		return false
+	}
+}
+
+// AddDropped accounts for packets dropped by the producer of the records (e.g. in kernel space), which
+// are reported along with the packets dropped due to a congested queue
+func (r *Replayer) AddDropped(packets uint64) {
+	r.packetsDropped.Add(packets)
+}
+
+// Stop signals that no further records are enqueued. Any records already enqueued are still provided
+// by the Next*() methods before they return capture.ErrCaptureStopped. It must be called exactly once,
+// after the last call to Enqueue()
+func (r *Replayer) Stop() {
+	close(r.queue)
+}
+
+// NextIPPacketZeroCopy synthesizes the IP layer of the next packet of the flow records received.
+// The returned IPLayer is only valid until the next call to any Next*() method
+func (r *Replayer) NextIPPacketZeroCopy() (capture.IPLayer, capture.PacketType, uint32, error) {
+	for r.pktsLeft == 0 {
+
+		// Since a batch may carry a large volume of packets, pending unblock requests are
+		// checked upon each record
+		select {
+		case <-r.unblock:
+			return nil, 0, 0, capture.ErrCaptureUnblocked
+		default:
+		}
+
+		if len(r.batch) == 0 {
+			select {
+			case <-r.unblock:
+				return nil, 0, 0, capture.ErrCaptureUnblocked
+			case batch, ok := <-r.queue:
+				if !ok {
+					return nil, 0, 0, capture.ErrCaptureStopped
+				}
+				r.batch = batch
+			}
+			continue
+		}
+
+		r.load(r.batch[0])
+		r.batch = r.batch[1:]
+	}
+
+	pktSize := r.pktSize
+	if r.pktsLarger > 0 {
+		pktSize++
+		r.pktsLarger--
+	}
+	r.pktsLeft--
+	r.packetsEmitted.Add(1)
+
+	return r.pkt, r.pktType, uint32(min(pktSize, math.MaxUint32)), nil
+}
+
+// load sets up the replay of the packets of a record (all of which share the same IP layer)
+func (r *Replayer) load(rec Record) {
+	r.pkt = rec.writePacket(&r.pktBuf)
+	r.pktsLeft = max(rec.Packets, 1)
+	r.pktSize, r.pktsLarger = rec.Bytes/r.pktsLeft, rec.Bytes%r.pktsLeft
+
+	r.pktType = capture.PacketThisHost
+	if rec.Outbound {
+		r.pktType = capture.PacketOutgoing
+	}
+	r.vlan = rec.VLAN
+	r.smac, r.dmac = rec.SMAC, rec.DMAC
+}
+
+// VLAN returns the VLAN ID of the record the packet most recently returned by NextIPPacketZeroCopy()
+// was synthesized from (zero if untagged / unknown)
+func (r *Replayer) VLAN() uint16 {
+	return r.vlan
+}
+
+// MACs returns the source / destination MAC addresses of the record the packet most recently returned
+// by NextIPPacketZeroCopy() was synthesized from (zero if unknown)
+func (r *Replayer) MACs() (src, dst types.MAC) {
+	return r.smac, r.dmac
+}
+
+// NextPayloadZeroCopy synthesizes the next packet of the flow records received (which does not carry
+// a link-layer header, hence the payload is the IP layer)
+func (r *Replayer) NextPayloadZeroCopy() ([]byte, capture.PacketType, uint32, error) {
+	return r.NextIPPacketZeroCopy()
+}
+
+// NewPacket creates an empty "buffer" packet to be used as destination for the NextPacket() /
+// NextPayload() / NextIPPacket() methods
+func (r *Replayer) NewPacket() capture.Packet {
+	return make(capture.Packet, capture.PacketHdrOffset+maxPacketLen)
+}
+
+// NextPacket synthesizes the next packet of the flow records received
+func (r *Replayer) NextPacket(pBuf capture.Packet) (capture.Packet, error) {
+	ipLayer, pktType, pktSize, err := r.NextIPPacketZeroCopy()
+	if err != nil {
+		return nil, err
+	}
+	return capture.NewIPPacket(pBuf, ipLayer, pktType, int(pktSize), 0), nil
+}
+
+// NextPayload synthesizes the next packet of the flow records received, returning its payload
+func (r *Replayer) NextPayload(pBuf []byte) ([]byte, capture.PacketType, uint32, error) {
+	ipLayer, pktType, pktSize, err := r.NextIPPacketZeroCopy()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return append(pBuf[:0], ipLayer...), pktType, pktSize, nil
+}
+
+// NextIPPacket synthesizes the next packet of the flow records received, returning its IP layer
+func (r *Replayer) NextIPPacket(pBuf capture.IPLayer) (capture.IPLayer, capture.PacketType, uint32, error) {
+	ipLayer, pktType, pktSize, err := r.NextIPPacketZeroCopy()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return append(pBuf[:0], ipLayer...), pktType, pktSize, nil
+}
+
+// NextPacketFn executes the provided function on the next packet of the flow records received
+func (r *Replayer) NextPacketFn(fn func(payload []byte, totalLen uint32, pktType capture.PacketType, ipLayerOffset byte) error) error {
+	ipLayer, pktType, pktSize, err := r.NextIPPacketZeroCopy()
+	if err != nil {
+		return err
+	}
+	return fn(ipLayer, pktSize, pktType, 0)
+}
+
+// Stats returns (and clears) the packet counters of the replayer. The packets of any records dropped
+// due to a congested queue are counted as dropped
+func (r *Replayer) Stats() (capture.Stats, error) {
+	return capture.Stats{
+		PacketsReceived: r.packetsEmitted.Swap(0),
+		PacketsDropped:  r.packetsDropped.Swap(0),
+	}, nil
+}
+
+// Unblock ensures that a potentially ongoing blocking call to any Next*() method is released
+func (r *Replayer) Unblock() error {
+	select {
+	case r.unblock <- struct{}{}:
+	default:
+	}
+	return nil
+}
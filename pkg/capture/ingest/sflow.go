@@ -0,0 +1,286 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// sFlow v5 structures evaluated (enterprise 0)
+const (
+	sflowVersion = 5
+
+	sflowAddrIPv4 = 1
+	sflowAddrIPv6 = 2
+
+	sflowFlowSample         = 1
+	sflowExpandedFlowSample = 3
+
+	sflowRawPacketHeader = 1
+	sflowSampledIPv4     = 3
+	sflowSampledIPv6     = 4
+
+	sflowHeaderEthernet = 1
+	sflowHeaderIPv4     = 11
+	sflowHeaderIPv6     = 12
+
+	// sflowIfIndexMask extracts the interface index from the input / output fields of a flow sample
+	sflowIfIndexMask = 0x3fffffff
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+	etherHdrLen   = 14
+	vlanTagLen    = 4
+	vlanIDMask    = 0x0fff
+)
+
+// xdrBuffer reads the XDR encoded fields of an sFlow datagram, flagging any attempt to read beyond its
+// end (in which case all subsequent reads return zero values)
+type xdrBuffer struct {
+	data      []byte
+	truncated bool
+}
+
+func (b *xdrBuffer) bytes(n int) []byte {
+	if b.truncated || n < 0 || n > len(b.data) {
+		b.truncated = true
+		return nil
+	}
+	res := b.data[:n]
+	b.data = b.data[n:]
+	return res
+}
+
+// opaque reads a field of length n, padded to a multiple of four bytes
+func (b *xdrBuffer) opaque(n int) []byte {
+	res := b.bytes(n)
+	b.bytes((4 - n%4) % 4)
+	return res
+}
+
+func (b *xdrBuffer) uint32() uint32 {
+	if v := b.bytes(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+// decodeSFlow decodes the flow samples of an sFlow v5 datagram
+func (d *decoder) decodeSFlow(data []byte, recs []Record) ([]Record, error) {
+	b := xdrBuffer{data: data}
+	if version := b.uint32(); version != sflowVersion {
+		return recs, fmt.Errorf("%w: sFlow %d", errUnsupportedVersion, version)
+	}
+	switch b.uint32() {
+	case sflowAddrIPv4:
+		b.bytes(4)
+	case sflowAddrIPv6:
+		b.bytes(16)
+	default:
+		return recs, errTruncated
+	}
+	b.bytes(12) // sub agent ID, sequence number, uptime
+
+	for numSamples := b.uint32(); numSamples > 0 && !b.truncated; numSamples-- {
+		format, length := b.uint32(), b.uint32()
+		sample := xdrBuffer{data: b.bytes(int(length))}
+
+		// Only the standard (enterprise 0) flow samples are evaluated
+		if format != sflowFlowSample && format != sflowExpandedFlowSample {
+			continue
+		}
+
+		var samplingRate, sourceIdx, input, output uint32
+		sample.bytes(4) // sequence number
+		if format == sflowFlowSample {
+			sourceIdx = sample.uint32() & 0xffffff
+			samplingRate = sample.uint32()
+			sample.bytes(8) // sample pool, drops
+			input, output = sample.uint32()&sflowIfIndexMask, sample.uint32()&sflowIfIndexMask
+		} else {
+			sample.bytes(4) // source ID type
+			sourceIdx = sample.uint32()
+			samplingRate = sample.uint32()
+			sample.bytes(12) // sample pool, drops, input format
+			input = sample.uint32()
+			sample.bytes(4) // output format
+			output = sample.uint32()
+		}
+
+		// The sample is taken on egress if the source denotes the output interface
+		outbound := output == sourceIdx && input != sourceIdx
+
+		// A sample may describe the same packet by several records (e.g. the raw header and the
+		// decoded IP layer), hence only the first one that can be evaluated is used
+		var (
+			r     Record
+			found bool
+		)
+		for numRecords := sample.uint32(); numRecords > 0 && !sample.truncated; numRecords-- {
+			recFormat, recLength := sample.uint32(), sample.uint32()
+			rec := xdrBuffer{data: sample.opaque(int(recLength))}
+			if found {
+				continue
+			}
+
+			switch recFormat {
+			case sflowRawPacketHeader:
+				r, found = decodeRawPacketHeader(&rec)
+			case sflowSampledIPv4, sflowSampledIPv6:
+				r, found = decodeSampledIP(&rec, recFormat == sflowSampledIPv6)
+			}
+			found = found && !rec.truncated
+		}
+		if sample.truncated {
+			return recs, errTruncated
+		}
+		if !found {
+			continue
+		}
+
+		r.Packets, r.Outbound = 1, outbound
+		r.scale(uint64(max(samplingRate, 1)))
+		if r.valid() {
+			recs = append(recs, r)
+		}
+	}
+
+	if b.truncated {
+		return recs, errTruncated
+	}
+	return recs, nil
+}
+
+// decodeRawPacketHeader decodes a packet sample from the header of the sampled packet
+func decodeRawPacketHeader(rec *xdrBuffer) (r Record, ok bool) {
+	protocol, frameLen, stripped := rec.uint32(), rec.uint32(), rec.uint32()
+	hdr := rec.opaque(int(rec.uint32()))
+
+	// Determine the IP layer and hence the length of the link-layer header not accounted for
+	var ipLayerOffset int
+	switch protocol {
+	case sflowHeaderEthernet:
+		ipLayerOffset = etherHdrLen - 2
+		if len(hdr) >= ipLayerOffset {
+			r.DMAC, r.SMAC = types.MAC(hdr[0:types.MACWidth]), types.MAC(hdr[types.MACWidth:2*types.MACWidth])
+		}
+		for {
+			if len(hdr) < ipLayerOffset+2 {
+				return
+			}
+			etherType := binary.BigEndian.Uint16(hdr[ipLayerOffset:])
+			if etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+				if len(hdr) < ipLayerOffset+vlanTagLen {
+					return
+				}
+
+				// The flow is attributed to the outermost VLAN (i.e. the service VLAN of stacked tags)
+				if r.VLAN == 0 {
+					r.VLAN = binary.BigEndian.Uint16(hdr[ipLayerOffset+2:]) & vlanIDMask
+				}
+				ipLayerOffset += vlanTagLen
+				continue
+			}
+			if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+				return
+			}
+			ipLayerOffset += 2
+			break
+		}
+	case sflowHeaderIPv4, sflowHeaderIPv6:
+	default:
+		return
+	}
+
+	// The frame length includes any bytes stripped from the header (e.g. the frame check sequence)
+	if overhead := uint32(ipLayerOffset) + stripped; frameLen > overhead {
+		r.Bytes = uint64(frameLen - overhead)
+	}
+
+	return r, parseIPLayer(&r, hdr[ipLayerOffset:])
+}
+
+// parseIPLayer populates the record from the IP / transport layer of a sampled packet
+func parseIPLayer(r *Record, ipLayer []byte) bool {
+	if len(ipLayer) < ipv4.HeaderLen {
+		return false
+	}
+
+	var transport []byte
+	switch ipLayer[0] >> 4 {
+	case 4:
+		r.DSCP = types.DSCP(ipLayer[1] >> 2)
+		r.Protocol = ipLayer[9]
+		r.SIP = netip.AddrFrom4([4]byte(ipLayer[12:16]))
+		r.DIP = netip.AddrFrom4([4]byte(ipLayer[16:20]))
+
+		// Subsequent fragments lack a transport layer
+		if binary.BigEndian.Uint16(ipLayer[6:])&0x1fff != 0 {
+			return true
+		}
+		if hdrLen := int(ipLayer[0]&0x0f) * 4; hdrLen >= ipv4.HeaderLen && len(ipLayer) >= hdrLen {
+			transport = ipLayer[hdrLen:]
+		}
+	case 6:
+		if len(ipLayer) < ipv6.HeaderLen {
+			return false
+		}
+		r.DSCP = types.DSCP((ipLayer[0]&0x0f)<<2 | ipLayer[1]>>6)
+		r.Protocol = ipLayer[6]
+		r.SIP = netip.AddrFrom16([16]byte(ipLayer[8:24]))
+		r.DIP = netip.AddrFrom16([16]byte(ipLayer[24:40]))
+		transport = ipLayer[ipv6.HeaderLen:]
+	default:
+		return false
+	}
+
+	if len(transport) >= 4 {
+		switch r.Protocol {
+		case protoICMP, protoICMPv6:
+			r.DPort = binary.BigEndian.Uint16(transport)
+		default:
+			r.SPort, r.DPort = binary.BigEndian.Uint16(transport), binary.BigEndian.Uint16(transport[2:])
+		}
+	}
+	if r.Protocol == protoTCP && len(transport) > 13 {
+		r.TCPFlags = transport[13]
+	}
+
+	return true
+}
+
+// decodeSampledIP decodes a packet sample from the decoded IPv4 / IPv6 layer of the sampled packet
+func decodeSampledIP(rec *xdrBuffer, isIPv6 bool) (r Record, ok bool) {
+	r.Bytes = uint64(rec.uint32())
+	r.Protocol = byte(rec.uint32())
+
+	addrLen := 4
+	if isIPv6 {
+		addrLen = 16
+	}
+	sip, dip := rec.bytes(addrLen), rec.bytes(addrLen)
+	if rec.truncated {
+		return
+	}
+	r.SIP, _ = netip.AddrFromSlice(sip)
+	r.DIP, _ = netip.AddrFromSlice(dip)
+	r.SPort, r.DPort = uint16(rec.uint32()), uint16(rec.uint32())
+	if tcpFlags := byte(rec.uint32()); r.Protocol == protoTCP {
+		r.TCPFlags = tcpFlags
+	}
+
+	// The priority of sampled IPv6 packets is not standardized, hence only the ToS of IPv4 packets is evaluated
+	if tos := byte(rec.uint32()); !isIPv6 {
+		r.DSCP = types.DSCP(tos >> 2)
+	}
+
+	return r, !rec.truncated
+}
@@ -0,0 +1,149 @@
+// Package ingest provides a capture source populating the flow log of an interface from the flow
+// records exported by a device (e.g. a router), allowing to aggregate flows on hosts where raw packet
+// capture is not possible. NetFlow v5 / v9, IPFIX and sFlow v5 datagrams are accepted on a single UDP
+// socket (the protocol is determined per datagram).
+//
+// The source replays each flow record as a series of synthesized packets (covering the IP / transport
+// layer only), so that the records are processed by the regular packet parsing and flow logging. The
+// traffic volume of a record is distributed evenly across its packets. Since flow records carry the
+// volume of IP packets, it is accounted on layer 3. Sampled records (sFlow, or NetFlow / IPFIX records
+// announcing a sampling interval) are scaled by their sampling rate.
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/fako1024/slimcap/capture"
+	"github.com/fako1024/slimcap/link"
+)
+
+const (
+
+	// DefaultQueueSize denotes the default number of datagrams queued for processing
+	DefaultQueueSize = 1024
+
+	maxDatagramSize = 65535
+)
+
+var _ capture.SourceZeroCopy = &Source{}
+
+// Option denotes a functional option for a Source
+type Option func(*Source)
+
+// WithSamplingRate sets the sampling rate applied to the records not announcing one (the records are
+// considered to be unsampled if zero)
+func WithSamplingRate(rate uint64) Option {
+	return func(s *Source) {
+		s.samplingRate = rate
+	}
+}
+
+// WithQueueSize sets the number of datagrams queued for processing, beyond which any further datagrams
+// are dropped (the default size is retained if zero)
+func WithQueueSize(size int) Option {
+	return func(s *Source) {
+		if size > 0 {
+			s.queueSize = size
+		}
+	}
+}
+
+// Source denotes a capture source consuming flow records exported via NetFlow v5 / v9, IPFIX or
+// sFlow v5 [fulfils the capture.SourceZeroCopy interface]
+type Source struct {
+	iface string
+	conn  *net.UDPConn
+
+	samplingRate uint64
+	queueSize    int
+
+	// The records decoded from each datagram are replayed as packets
+	*Replayer
+
+	wgReceive sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewSource instantiates a new source for the interface, listening for datagrams on the given address
+// (host:port)
+func NewSource(iface, listen string, opts ...Option) (*Source, error) {
+	s := &Source{
+		iface:     iface,
+		queueSize: DefaultQueueSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Replayer = NewReplayer(s.queueSize)
+
+	addr, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve listen address %s: %w", listen, err)
+	}
+	if s.conn, err = net.ListenUDP("udp", addr); err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+
+	s.wgReceive.Add(1)
+	go s.receive()
+
+	return s, nil
+}
+
+// LocalAddr returns the address the source is listening on
+func (s *Source) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// receive decodes all datagrams received until the source is closed and hands their records to the
+// consumer
+func (s *Source) receive() {
+	defer func() {
+		s.Stop()
+		s.wgReceive.Done()
+	}()
+
+	var (
+		dec = newDecoder(s.samplingRate)
+		buf = make([]byte, maxDatagramSize)
+	)
+	for {
+		n, addr, err := s.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		recs, err := dec.decode(addr.Addr().Unmap(), buf[:n], nil)
+		if err != nil {
+			datagramsInvalid.WithLabelValues(s.iface).Inc()
+		} else {
+			datagramsReceived.WithLabelValues(s.iface).Inc()
+		}
+		if len(recs) == 0 {
+			continue
+		}
+		recordsReceived.WithLabelValues(s.iface).Add(float64(len(recs)))
+		s.Enqueue(recs)
+	}
+}
+
+// Link returns nil since the source is not associated with a local link
+func (s *Source) Link() *link.Link {
+	return nil
+}
+
+// Close stops listening for datagrams. Any records already received are still provided by the Next*()
+// methods before they return capture.ErrCaptureStopped
+func (s *Source) Close() (err error) {
+	s.closeOnce.Do(func() {
+		err = s.conn.Close()
+		s.wgReceive.Wait()
+	})
+	return
+}
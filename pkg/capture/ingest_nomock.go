@@ -0,0 +1,13 @@
+//go:build slimcap_nomock
+// +build slimcap_nomock
+
+package capture
+
+import "errors"
+
+var errIngestUnsupported = errors.New("ingestion of flow records is not supported by builds with the slimcap_nomock tag (restricting the capture source to AF_PACKET)")
+
+// newIngestSource fails since the capture source is restricted to an afring source
+func newIngestSource(_ *Capture) (Source, error) {
+	return nil, errIngestUnsupported
+}
@@ -0,0 +1,146 @@
+//go:build !slimcap_nomock
+// +build !slimcap_nomock
+
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/capture/ingest"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestFlowRecords(t *testing.T) {
+	c := newCapture("router0", config.CaptureConfig{
+		Ingest: &config.IngestConfig{Listen: "127.0.0.1:0", SamplingRate: 2},
+	})
+	require.Nil(t, c.run(testLocalBufferPool))
+	c.process()
+	defer func() {
+		require.Nil(t, c.close())
+	}()
+
+	conn, err := net.Dial("udp", c.captureHandle.(*ingest.Source).LocalAddr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	// NetFlow v5 datagram carrying a single record (10.0.0.1:50000 -> 10.0.0.2:443 / TCP)
+	datagram := make([]byte, 24+48)
+	binary.BigEndian.PutUint16(datagram[0:], 5)
+	binary.BigEndian.PutUint16(datagram[2:], 1)
+	rec := datagram[24:]
+	copy(rec[0:], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+	binary.BigEndian.PutUint32(rec[16:], 10)
+	binary.BigEndian.PutUint32(rec[20:], 1000)
+	binary.BigEndian.PutUint16(rec[32:], 50000)
+	binary.BigEndian.PutUint16(rec[34:], 443)
+	rec[38] = 6
+	_, err = conn.Write(datagram)
+	require.Nil(t, err)
+
+	// The record is scaled by the configured sampling rate and accounted as received traffic
+	expectedKey := types.NewKey([]byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, []byte{0x01, 0xbb}, 6)
+	require.Eventually(t, func() bool {
+		require.Nil(t, c.capLock.Lock())
+		defer func() {
+			require.Nil(t, c.capLock.Unlock())
+		}()
+
+		agg := c.flowMap(context.Background())
+		if agg == nil {
+			return false
+		}
+		require.Equal(t, 1, agg.Len())
+		for it := agg.Iter(); it.Next(); {
+			require.Equal(t, expectedKey, types.Key(it.Key()))
+			require.Equal(t, types.Counters{BytesRcvd: 2000, PacketsRcvd: 20}, it.Val())
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats, err := c.status(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, uint64(20), stats.Received)
+	require.Equal(t, uint64(20), stats.Processed)
+	require.Nil(t, stats.Parameters)
+}
+
+func TestIngestDSCP(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dscp=%v", enabled), func(t *testing.T) {
+			c := newCapture("router0", config.CaptureConfig{
+				Ingest: &config.IngestConfig{Listen: "127.0.0.1:0"},
+				DSCP:   enabled,
+			})
+			require.Nil(t, c.run(testLocalBufferPool))
+			c.process()
+			defer func() {
+				require.Nil(t, c.close())
+			}()
+
+			conn, err := net.Dial("udp", c.captureHandle.(*ingest.Source).LocalAddr().String())
+			require.Nil(t, err)
+			defer conn.Close()
+
+			// NetFlow v5 datagram carrying a single record marked EF (DSCP 46)
+			datagram := make([]byte, 24+48)
+			binary.BigEndian.PutUint16(datagram[0:], 5)
+			binary.BigEndian.PutUint16(datagram[2:], 1)
+			rec := datagram[24:]
+			copy(rec[0:], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+			binary.BigEndian.PutUint32(rec[16:], 10)
+			binary.BigEndian.PutUint32(rec[20:], 1000)
+			binary.BigEndian.PutUint16(rec[32:], 50000)
+			binary.BigEndian.PutUint16(rec[34:], 443)
+			rec[38], rec[39] = 6, 46<<2
+			_, err = conn.Write(datagram)
+			require.Nil(t, err)
+
+			var attrs capturetypes.FlowAttributes
+			require.Eventually(t, func() bool {
+				require.Nil(t, c.capLock.Lock())
+				defer func() {
+					require.Nil(t, c.capLock.Unlock())
+				}()
+
+				if c.flowLog.Len() == 0 {
+					return false
+				}
+				_, _, attrs = c.flowLog.Rotate()
+				return true
+			}, 5*time.Second, 10*time.Millisecond)
+
+			// The DSCP is only recorded if enabled
+			if !enabled {
+				require.Empty(t, attrs.Labeled)
+				return
+			}
+			key := string(types.NewKey([]byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, []byte{0x01, 0xbb}, 6))
+			require.Len(t, attrs.Labeled[key], 1)
+			require.Equal(t, types.DSCP(46), attrs.Labeled[key][0].DSCP)
+		})
+	}
+}
+
+func TestIngestVLANs(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		c := newCapture("router0", config.CaptureConfig{
+			Ingest: &config.IngestConfig{Listen: "127.0.0.1:0"},
+			VLANs:  enabled,
+		})
+		require.Nil(t, c.run(testLocalBufferPool))
+
+		// The VLAN IDs decoded from the flow records are only recorded if enabled
+		require.Equal(t, enabled, c.vlanSource != nil)
+		require.False(t, c.linkVLANs)
+		require.Nil(t, c.close())
+	}
+}
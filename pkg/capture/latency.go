@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencySampleMask defines the packet sampling rate of the capture loop latencies (one in
+// latencySampleMask+1 packets). A power of two is used in order to avoid a modulo operation
+// in the hot path
+const latencySampleMask = 1<<13 - 1
+
+// latencySampler samples the latencies of the capture loop, i.e. the time spent waiting for
+// a packet (including PPOLL) and the time spent processing it (parsing and adding it to the
+// flow log). Taking the time for each packet would be prohibitively expensive, hence only
+// one in latencySampleMask+1 packets is measured
+type latencySampler struct {
+	wait, processing prometheus.Observer
+
+	n        uint64
+	sampling bool
+	tFetch   time.Time
+	tFetched time.Time
+}
+
+func newLatencySampler() latencySampler {
+	return latencySampler{
+		wait:       promPacketWait,
+		processing: promPacketProcessing,
+	}
+}
+
+// fetch is called prior to fetching the next packet from the capture source
+func (s *latencySampler) fetch() {
+	s.n++
+	if s.n&latencySampleMask == 0 {
+		s.sampling = true
+		s.tFetch = time.Now()
+	}
+}
+
+// fetched is called once a packet has been fetched successfully from the capture source
+func (s *latencySampler) fetched() {
+	if !s.sampling {
+		return
+	}
+	s.tFetched = time.Now()
+	s.wait.Observe(s.tFetched.Sub(s.tFetch).Seconds())
+}
+
+// processed is called once the last packet fetched has been processed (irrespective of its outcome)
+func (s *latencySampler) processed() {
+	if !s.sampling {
+		return
+	}
+	s.processing.Observe(time.Since(s.tFetched).Seconds())
+	s.sampling = false
+}
+
+// abort discards the current sample (e.g. if the capture source was unblocked instead of
+// providing a packet)
+func (s *latencySampler) abort() {
+	s.sampling = false
+}
@@ -0,0 +1,44 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingObserver struct {
+	n int
+}
+
+func (o *countingObserver) Observe(float64) {
+	o.n++
+}
+
+func TestLatencySampler(t *testing.T) {
+	wait, processing := new(countingObserver), new(countingObserver)
+	s := latencySampler{wait: wait, processing: processing}
+
+	// only one in latencySampleMask+1 packets is sampled
+	for i := 0; i < 4*(latencySampleMask+1); i++ {
+		s.processed()
+		s.fetch()
+		s.fetched()
+	}
+	s.processed()
+	require.Equal(t, 4, wait.n)
+	require.Equal(t, 4, processing.n)
+
+	// an aborted fetch does not yield a sample
+	for i := 0; i < latencySampleMask+1; i++ {
+		s.processed()
+		s.fetch()
+		if s.sampling {
+			s.abort()
+			continue
+		}
+		s.fetched()
+	}
+	s.processed()
+	require.Equal(t, 4, wait.n)
+	require.Equal(t, 4, processing.n)
+}
@@ -1,6 +1,7 @@
 package capture
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/els0r/goProbe/cmd/goProbe/config"
@@ -68,6 +69,90 @@ var promCaptureIssues = prometheus.NewCounterVec(prometheus.CounterOpts{
 },
 	[]string{"iface", "issue_type"},
 )
+var promPacketsDecapsulated = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureSubsystem,
+	Name:      "packets_decapsulated_total",
+	Help:      "Number of tunneled packets decapsulated prior to flow processing",
+},
+	[]string{"iface", "encapsulation"},
+)
+var promFramesNonIP = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureSubsystem,
+	Name:      "frames_non_ip_total",
+	Help:      "Number of frames not carrying an IP layer (hence not accounted for in any flow), if counted",
+},
+	[]string{"iface", "type"},
+)
+var promLastPacket = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureSubsystem,
+	Name:      "last_packet_timestamp_seconds",
+	Help:      "Unix timestamp of the last packet processed (determined at the granularity of rotations / status calls)",
+},
+	[]string{"iface"},
+)
+
+var promFlowRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureSubsystem,
+	Name:      "flow_records_expired_total",
+	Help:      "Number of NetFlow-style flow records expired (if enabled), by the reason of their expiry",
+},
+	[]string{"iface", "reason"},
+)
+
+// flowsCreatedCollector exposes the number of flows created per interface. In contrast to the metrics
+// updated upon rotation, the counts are determined at scrape time, providing continuous visibility of
+// the flow creation rate between rotations
+type flowsCreatedCollector struct {
+	captures sync.Map // interface name -> *Capture
+
+	totalDesc         *prometheus.Desc
+	sinceRotationDesc *prometheus.Desc
+}
+
+var promFlowsCreated = &flowsCreatedCollector{
+	totalDesc: prometheus.NewDesc(
+		prometheus.BuildFQName(config.ServiceName, captureSubsystem, "flows_created_total"),
+		"Number of flows added to the flow map since the capture was started",
+		[]string{"iface"}, nil,
+	),
+	sinceRotationDesc: prometheus.NewDesc(
+		prometheus.BuildFQName(config.ServiceName, captureSubsystem, "flows_created_since_rotation"),
+		"Number of flows added to the flow map since the last rotation",
+		[]string{"iface"}, nil,
+	),
+}
+
+// add starts exposing the flow counts of the capture
+func (f *flowsCreatedCollector) add(c *Capture) {
+	f.captures.Store(c.iface, c)
+}
+
+// remove stops exposing the flow counts of the capture (unless it was already superseded by
+// another capture on the same interface)
+func (f *flowsCreatedCollector) remove(c *Capture) {
+	f.captures.CompareAndDelete(c.iface, c)
+}
+
+// Describe implements prometheus.Collector
+func (f *flowsCreatedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.totalDesc
+	ch <- f.sinceRotationDesc
+}
+
+// Collect implements prometheus.Collector
+func (f *flowsCreatedCollector) Collect(ch chan<- prometheus.Metric) {
+	f.captures.Range(func(key, value any) bool {
+		iface, c := key.(string), value.(*Capture)
+		sinceRotation, total := c.flowCounts()
+		ch <- prometheus.MustNewConstMetric(f.totalDesc, prometheus.CounterValue, float64(total), iface)
+		ch <- prometheus.MustNewConstMetric(f.sinceRotationDesc, prometheus.GaugeValue, float64(sinceRotation), iface)
+		return true
+	})
+}
 
 var promInterfacesCapturing = prometheus.NewGauge(prometheus.GaugeOpts{
 	Namespace: config.ServiceName,
@@ -86,6 +171,48 @@ var promRotationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
 	Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 0.75, 1},
 })
 
+// the capture loop latencies are sampled across all interfaces (see latencySampler)
+var promPacketWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureSubsystem,
+	Name:      "packet_wait_seconds",
+	Help:      "Time spent waiting for the next packet (including PPOLL), sampled across all interfaces",
+	Buckets:   []float64{1e-7, 1e-6, 1e-5, 1e-4, 0.001, 0.01, 0.1, 1},
+})
+var promPacketProcessing = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureSubsystem,
+	Name:      "packet_processing_seconds",
+	Help:      "Time spent processing a packet (parsing and flow log update), sampled across all interfaces",
+	// processing a packet typically takes well below a microsecond
+	Buckets: []float64{5e-8, 1e-7, 2.5e-7, 5e-7, 1e-6, 2.5e-6, 1e-5, 1e-4, 0.001},
+})
+
+var promWriteoutQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureManagerSubsystem,
+	Name:      "writeout_queue_depth",
+	Help:      "Number of rotated flow maps waiting on the writeout channel to be written to disk",
+})
+var promWriteoutStalls = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureManagerSubsystem,
+	Name:      "writeout_stalls_total",
+	Help:      "Number of times flow map rotation was blocked by a full writeout channel",
+})
+var promRotationsDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureManagerSubsystem,
+	Name:      "rotations_deferred_total",
+	Help:      "Number of interface rotations deferred to the next writeout due to persistently congested writeouts",
+})
+var promWriteoutCongested = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: config.ServiceName,
+	Subsystem: captureManagerSubsystem,
+	Name:      "writeout_congested",
+	Help:      "Indicates whether writeouts are persistently congested (1) or not (0)",
+})
+
 func init() {
 	prometheus.MustRegister(
 		promPacketsProcessed,
@@ -95,8 +222,19 @@ func init() {
 		promGlobalBufferUsage,
 		promNumFlows,
 		promCaptureIssues,
+		promPacketsDecapsulated,
+		promFramesNonIP,
+		promLastPacket,
+		promFlowRecords,
+		promFlowsCreated,
 		promInterfacesCapturing,
 		promRotationDuration,
+		promWriteoutQueueDepth,
+		promWriteoutStalls,
+		promRotationsDeferred,
+		promWriteoutCongested,
+		promPacketWait,
+		promPacketProcessing,
 	)
 }
 
@@ -116,4 +254,7 @@ func ResetCountersTestingOnly() {
 	promNumFlows.Reset()
 	promPacketsDropped.Reset()
 	promCaptureIssues.Reset()
+	promPacketsDecapsulated.Reset()
+	promFramesNonIP.Reset()
+	promLastPacket.Reset()
 }
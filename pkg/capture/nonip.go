@@ -0,0 +1,154 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	etherTypePPPoE = 0x8864
+
+	pppTypeIPv4 = 0x0021
+	pppTypeIPv6 = 0x0057
+
+	// Offsets / lengths of the relevant fields of an ethernet (PPPoE) frame
+	etherTypeOffset = 12
+	pppTypeOffset   = 20
+	nonIPSnapLen    = pppTypeOffset + 2
+
+	// nonIPPollTimeout denotes the interval in which the non-IP counter checks if it was closed
+	nonIPPollTimeout = 500 * time.Millisecond
+)
+
+// nonIPFilter selects all frames not carrying an IPv4 / IPv6 layer (directly or in a PPPoE session),
+// i.e. the complement of the frames received by the capture source, capturing only their header
+var nonIPFilter = []bpf.Instruction{
+	bpf.LoadAbsolute{Off: etherTypeOffset, Size: 2},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: etherTypeIPv4, SkipTrue: 6},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: etherTypeIPv6, SkipTrue: 5},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: etherTypePPPoE, SkipFalse: 3},
+	bpf.LoadAbsolute{Off: pppTypeOffset, Size: 2},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: pppTypeIPv4, SkipTrue: 2},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: pppTypeIPv6, SkipTrue: 1},
+	bpf.RetConstant{Val: nonIPSnapLen},
+	bpf.RetConstant{Val: 0},
+}
+
+// nonIPCounter counts the frames not carrying an IP layer on an interface by their type. Since the
+// capture source filters such frames in the kernel already, they are received via a dedicated socket
+// (only capturing their link layer header)
+type nonIPCounter struct {
+	fd     int
+	counts [capturetypes.NumNonIPTypes]atomic.Uint64
+
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+// newNonIPCounter opens a socket receiving all non-IP frames on the interface and starts counting them
+func newNonIPCounter(iface string) (*nonIPCounter, error) {
+	link, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface %s: %w", iface, err)
+	}
+
+	filter, err := bpf.Assemble(nonIPFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble non-IP BPF filter: %w", err)
+	}
+	sockFilter := make([]unix.SockFilter, len(filter))
+	for i, instr := range filter {
+		sockFilter[i] = unix.SockFilter{Code: instr.Op, Jt: instr.Jt, Jf: instr.Jf, K: instr.K}
+	}
+
+	protocol := htons(unix.ETH_P_ALL)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(protocol))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open non-IP socket: %w", err)
+	}
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{
+		Len:    uint16(len(sockFilter)),
+		Filter: &sockFilter[0],
+	}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to set non-IP BPF filter: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: protocol, Ifindex: link.Index}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind non-IP socket to interface %s: %w", iface, err)
+	}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Usec: nonIPPollTimeout.Microseconds()}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to set non-IP socket timeout: %w", err)
+	}
+
+	n := &nonIPCounter{fd: fd}
+	n.wg.Add(1)
+	go n.run()
+
+	return n, nil
+}
+
+func (n *nonIPCounter) run() {
+	defer n.wg.Done()
+
+	buf := make([]byte, nonIPSnapLen)
+	for !n.closed.Load() {
+		nBytes, _, err := unix.Recvfrom(n.fd, buf, 0)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return
+		}
+		n.observe(buf[:nBytes])
+	}
+}
+
+// observe counts a frame (provided there is no IP layer, which may be received until the filter is
+// attached to the socket)
+func (n *nonIPCounter) observe(frame []byte) {
+	if len(frame) < etherTypeOffset+2 {
+		return
+	}
+	etherType := binary.BigEndian.Uint16(frame[etherTypeOffset:])
+	switch etherType {
+	case etherTypeIPv4, etherTypeIPv6:
+		return
+	case etherTypePPPoE:
+		if len(frame) >= pppTypeOffset+2 {
+			if pppType := binary.BigEndian.Uint16(frame[pppTypeOffset:]); pppType == pppTypeIPv4 || pppType == pppTypeIPv6 {
+				return
+			}
+		}
+	}
+	n.counts[capturetypes.ClassifyEtherType(etherType)].Add(1)
+}
+
+// fetch returns the number of frames counted since the last call to fetch
+func (n *nonIPCounter) fetch() (res capturetypes.NonIPTracker) {
+	for i := range n.counts {
+		res[i] = n.counts[i].Swap(0)
+	}
+	return
+}
+
+// close stops counting and closes the socket
+func (n *nonIPCounter) close() error {
+	n.closed.Store(true)
+	n.wg.Wait()
+	return unix.Close(n.fd)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,68 @@
+package capture
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+)
+
+func genFrame(etherType, pppType uint16) []byte {
+	frame := make([]byte, 64)
+	binary.BigEndian.PutUint16(frame[etherTypeOffset:], etherType)
+	binary.BigEndian.PutUint16(frame[pppTypeOffset:], pppType)
+	return frame
+}
+
+func TestNonIPCounter(t *testing.T) {
+	vm, err := bpf.NewVM(nonIPFilter)
+	require.Nil(t, err)
+
+	for _, c := range []struct {
+		name      string
+		etherType uint16
+		pppType   uint16
+		expected  capturetypes.NonIPType
+		isIP      bool
+	}{
+		{"ipv4", etherTypeIPv4, 0, 0, true},
+		{"ipv6", etherTypeIPv6, 0, 0, true},
+		{"pppoe_ipv4", etherTypePPPoE, pppTypeIPv4, 0, true},
+		{"pppoe_ipv6", etherTypePPPoE, pppTypeIPv6, 0, true},
+		{"pppoe_lcp", etherTypePPPoE, 0xC021, capturetypes.NonIPPPPoE, false},
+		{"pppoe_discovery", 0x8863, 0, capturetypes.NonIPPPPoE, false},
+		{"arp", 0x0806, 0, capturetypes.NonIPARP, false},
+		{"lldp", 0x88CC, 0, capturetypes.NonIPLLDP, false},
+		{"mpls", 0x8847, 0, capturetypes.NonIPMPLS, false},
+		{"qinq", 0x88A8, 0, capturetypes.NonIPVLAN, false},
+		{"stp", 0x0026, 0, capturetypes.NonIPLLC, false},
+		{"other", 0x88E5, 0, capturetypes.NonIPOther, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			frame := genFrame(c.etherType, c.pppType)
+
+			// The filter only passes (the header of) frames without an IP layer
+			snapLen, err := vm.Run(frame)
+			require.Nil(t, err)
+			if c.isIP {
+				require.Zero(t, snapLen)
+			} else {
+				require.Equal(t, nonIPSnapLen, snapLen)
+			}
+
+			var n nonIPCounter
+			n.observe(frame[:nonIPSnapLen])
+			counts := n.fetch()
+			if c.isIP {
+				require.Zero(t, counts.Sum())
+				return
+			}
+			require.Equal(t, uint64(1), counts.Sum())
+			require.Equal(t, uint64(1), counts[c.expected])
+			counts = n.fetch()
+			require.Zero(t, counts.Sum())
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/els0r/goProbe/cmd/goProbe/config"
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
 	"github.com/fako1024/slimcap/capture"
 	"github.com/stretchr/testify/require"
@@ -322,3 +323,56 @@ func uint16ToPort(p uint16) (res []byte) {
 	binary.BigEndian.PutUint16(res, p)
 	return
 }
+
+func TestSourcePortAggregation(t *testing.T) {
+	portAgg, err := newPortAggregation(&config.SourcePortAggregationConfig{
+		Keep:       []string{"53", "8000-8100"},
+		BucketSize: 4096,
+	})
+	require.Nil(t, err)
+
+	for _, tc := range []struct {
+		input              testParams
+		portAgg            *portAggregation
+		expSport, expDport uint16
+	}{
+		{testParams{sip: "10.0.0.1", dip: "4.5.6.7", sport: 33561, dport: 53, proto: capturetypes.UDP}, nil, 0, 53},
+		{testParams{sip: "10.0.0.1", dip: "4.5.6.7", sport: 33561, dport: 53, proto: capturetypes.UDP}, portAgg, 33561, 53},
+		{testParams{sip: "4.5.6.7", dip: "10.0.0.1", sport: 53, dport: 33561, proto: capturetypes.UDP}, portAgg, 53, 33561},
+		{testParams{sip: "2c04:4000::6ab", dip: "2c01:2000::3", sport: 33561, dport: 53, proto: capturetypes.UDP}, portAgg, 33561, 53},
+		{testParams{sip: "10.0.0.1", dip: "4.5.6.7", sport: 33561, dport: 443, proto: capturetypes.TCP}, nil, 0, 443},
+		{testParams{sip: "10.0.0.1", dip: "4.5.6.7", sport: 33561, dport: 443, proto: capturetypes.TCP}, portAgg, 32768, 443},
+		{testParams{sip: "4.5.6.7", dip: "10.0.0.1", sport: 443, dport: 33561, proto: capturetypes.TCP}, portAgg, 443, 32768},
+		{testParams{sip: "2c01:2000::3", dip: "2c04:4000::6ab", sport: 443, dport: 61000, proto: capturetypes.TCP}, portAgg, 443, 57344},
+
+		// Flows to other ports are unaffected
+		{testParams{sip: "10.0.0.1", dip: "4.5.6.7", sport: 33561, dport: 8000, proto: capturetypes.TCP}, portAgg, 33561, 8000},
+		{testParams{sip: "10.0.0.1", dip: "4.5.6.7", sport: 33561, dport: 444, proto: capturetypes.UDP}, portAgg, 33561, 444},
+	} {
+		t.Run(tc.input.String(), func(t *testing.T) {
+			testPacket := tc.input.genDummyPacket(0)
+			ipLayer := testPacket.IPLayer()
+			var sport, dport []byte
+			if ipLayer.Type() == ipLayerTypeV4 {
+				epHash, _, errno := parsePacketV4(ipLayer, tc.portAgg)
+				require.Equal(t, capturetypes.ErrnoOK, errno)
+				sport, dport = epHash[capturetypes.EPHashV4SPortStart:capturetypes.EPHashV4SPortEnd], epHash[capturetypes.EPHashV4DPortStart:capturetypes.EPHashV4DPortEnd]
+			} else {
+				epHash, _, errno := parsePacketV6(ipLayer, tc.portAgg)
+				require.Equal(t, capturetypes.ErrnoOK, errno)
+				sport, dport = epHash[capturetypes.EPHashV6SPortStart:capturetypes.EPHashV6SPortEnd], epHash[capturetypes.EPHashV6DPortStart:capturetypes.EPHashV6DPortEnd]
+			}
+			require.Equal(t, tc.expSport, binary.BigEndian.Uint16(sport))
+			require.Equal(t, tc.expDport, binary.BigEndian.Uint16(dport))
+		})
+	}
+
+	params := portAgg.parameters()
+	require.Equal(t, []string{"53/tcp", "80/tcp", "443/tcp", "445/tcp", "8080/tcp", "53/udp", "443/udp"}, params.CommonPorts)
+	require.Equal(t, []string{"53", "8000-8100"}, params.Keep)
+	require.Equal(t, 4096, params.BucketSize)
+	require.Empty(t, (*portAggregation)(nil).parameters().Keep)
+
+	_, err = newPortAggregation(&config.SourcePortAggregationConfig{Keep: []string{"100-10"}})
+	require.NotNil(t, err)
+}
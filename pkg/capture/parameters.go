@@ -0,0 +1,135 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/fako1024/slimcap/link"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// sysClassNetPath denotes the path exposing the state of all network interfaces (may be overridden in tests)
+var sysClassNetPath = "/sys/class/net"
+
+// initParameters determines the static parameters effectively applied to the capture, based on the link
+// of the capture source (none if the source does not provide one)
+func (c *Capture) initParameters() {
+	l := c.captureHandle.Link()
+	if l == nil {
+		return
+	}
+
+	params := &capturetypes.CaptureParameters{
+		ByteAccounting:        c.config.ByteAccountingBasis(),
+		SourcePortAggregation: c.portAggregation.parameters(),
+	}
+	c.sizeAdjustment = byteAccountingAdjustment(c.config, l)
+
+	// Flows aggregated in kernel space are neither truncated nor filtered via a socket
+	if c.config.XDP != nil {
+		c.params = params
+		return
+	}
+	captureLength := captureLengthStrategy(c.config)(l)
+	params.CaptureLength = captureLength
+
+	// The ring buffer blocks are aligned to the page size by the capture source
+	if c.config.RingBuffer != nil {
+		blockSize := pageSizeAlign(c.config.RingBuffer.BlockSize)
+		params.RingBuffer = capturetypes.RingBufferParameters{
+			BlockSize: blockSize,
+			NumBlocks: c.config.RingBuffer.NumBlocks,
+			Size:      blockSize * c.config.RingBuffer.NumBlocks,
+		}
+	}
+
+	// The filter is derived the same way as the one attached to the socket by the capture source (which
+	// has already failed to initialize if the capture filter cannot be compiled)
+	if filterFn := l.Type.BPFFilter(); filterFn != nil {
+		if extraInstructions, err := bpfFilterInstructions(c.config, l); err == nil {
+			params.BPFFilter = disassembleBPF(filterFn(captureLength, c.config.IgnoreVLANs, extraInstructions...))
+		}
+	}
+
+	c.params = params
+}
+
+// parameters returns the parameters effectively applied to the capture (nil if unknown)
+func (c *Capture) parameters() *capturetypes.CaptureParameters {
+	if c.params == nil {
+		return nil
+	}
+	params := *c.params
+
+	// The promiscuous state is provided by the kernel (since it is shared among all sockets on the
+	// interface, it may be enabled even if the capture does not request it)
+	if promisc, err := isPromiscuous(c.iface); err == nil {
+		params.Promiscuous = &promisc
+	}
+
+	return &params
+}
+
+// ethernetFCSLen denotes the size of the Ethernet frame check sequence, which is not included in the
+// packet length reported by the kernel (just like VLAN tags stripped by the NIC)
+const ethernetFCSLen = 4
+
+// byteAccountingAdjustment returns the number of bytes to add to the length of each packet as reported by
+// the kernel (i.e. including the link-layer header) in order to account for it on the configured basis
+func byteAccountingAdjustment(cfg config.CaptureConfig, l *link.Link) int32 {
+	switch cfg.ByteAccountingBasis() {
+	case info.ByteAccountingL3:
+		return -int32(l.Type.IPHeaderOffset())
+	case info.ByteAccountingWire:
+		// Only Ethernet frames carry a frame check sequence (and VLAN tags) on the wire
+		if l.Type != link.TypeEthernet {
+			return 0
+		}
+		return ethernetFCSLen + int32(cfg.WireVLANTags)*vlanTagLen
+	}
+	return 0
+}
+
+// accountedSize returns the size of a packet on the byte accounting basis of the capture
+func (c *Capture) accountedSize(pktSize uint32) uint32 {
+	if c.sizeAdjustment < 0 && pktSize < uint32(-c.sizeAdjustment) {
+		return 0
+	}
+	return uint32(int64(pktSize) + int64(c.sizeAdjustment))
+}
+
+// isPromiscuous returns whether an interface is in promiscuous mode
+func isPromiscuous(iface string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(sysClassNetPath, iface, "flags"))
+	if err != nil {
+		return false, err
+	}
+	flags, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 32)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse flags of interface %s: %w", iface, err)
+	}
+	return flags&unix.IFF_PROMISC != 0, nil
+}
+
+// disassembleBPF converts raw BPF instructions into their human-readable representation
+func disassembleBPF(raw []bpf.RawInstruction) []string {
+	insts, _ := bpf.Disassemble(raw)
+	res := make([]string, len(insts))
+	for i, inst := range insts {
+		res[i] = fmt.Sprint(inst)
+	}
+	return res
+}
+
+// pageSizeAlign rounds up to the next multiple of the page size
+func pageSizeAlign(x int) int {
+	pageSize := os.Getpagesize()
+	return (x + pageSize - 1) &^ (pageSize - 1)
+}
@@ -0,0 +1,114 @@
+//go:build !slimcap_nomock
+// +build !slimcap_nomock
+
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
+	"github.com/fako1024/slimcap/capture/afpacket/afring"
+	"github.com/fako1024/slimcap/link"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+)
+
+func TestCaptureParameters(t *testing.T) {
+
+	mockSrc, err := afring.NewMockSource("mock",
+		afring.CaptureLength(link.CaptureLengthFixed(128)),
+	)
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, mockSrc.Close())
+	}()
+
+	c := newMockCapture(mockSrc)
+	c.iface = "mock"
+	c.config = config.CaptureConfig{
+		CaptureLength: 128,
+		RingBuffer: &config.RingBufferConfig{
+			BlockSize: os.Getpagesize() + 1,
+			NumBlocks: 4,
+		},
+	}
+
+	// the promiscuous state is provided by the kernel (if available)
+	sysClassNetPath = t.TempDir()
+	defer func() {
+		sysClassNetPath = "/sys/class/net"
+	}()
+	require.Nil(t, c.parameters())
+	c.initParameters()
+	params := c.parameters()
+	require.NotNil(t, params)
+	require.Nil(t, params.Promiscuous)
+
+	require.Nil(t, os.Mkdir(filepath.Join(sysClassNetPath, "mock"), 0700))
+	require.Nil(t, os.WriteFile(filepath.Join(sysClassNetPath, "mock", "flags"), []byte("0x1103\n"), 0600))
+	params = c.parameters()
+	require.NotNil(t, params.Promiscuous)
+	require.True(t, *params.Promiscuous)
+
+	// the ring buffer blocks are aligned to the page size
+	require.Equal(t, 2*os.Getpagesize(), params.RingBuffer.BlockSize)
+	require.Equal(t, 4, params.RingBuffer.NumBlocks)
+	require.Equal(t, 8*os.Getpagesize(), params.RingBuffer.Size)
+
+	require.Equal(t, 128, params.CaptureLength)
+	require.NotEmpty(t, params.BPFFilter)
+	require.Contains(t, params.BPFFilter[len(params.BPFFilter)-2], "128")
+	require.Equal(t, "l3", params.ByteAccounting)
+}
+
+func TestByteAccounting(t *testing.T) {
+	ethernet, tunnel := &link.EmptyEthernetLink, &link.Link{Interface: link.Interface{Type: link.TypeNone}}
+
+	for _, tc := range []struct {
+		accounting string
+		vlanTags   int
+		link       *link.Link
+		expected   uint32
+	}{
+		{"", 0, ethernet, 1500},
+		{"l2", 1, ethernet, 1514},
+		{"l3", 0, ethernet, 1500},
+		{"wire", 0, ethernet, 1518},
+		{"wire", 2, ethernet, 1526},
+		{"l3", 0, tunnel, 1514},
+		{"wire", 1, tunnel, 1514},
+	} {
+		c := &Capture{sizeAdjustment: byteAccountingAdjustment(config.CaptureConfig{
+			ByteAccounting: tc.accounting,
+			WireVLANTags:   tc.vlanTags,
+		}, tc.link)}
+		require.Equal(t, tc.expected, c.accountedSize(1514), "%s (%d VLAN tags)", tc.accounting, tc.vlanTags)
+	}
+
+	// the size never underflows
+	c := &Capture{sizeAdjustment: byteAccountingAdjustment(config.CaptureConfig{ByteAccounting: "l3"}, ethernet)}
+	require.Zero(t, c.accountedSize(10))
+}
+
+func TestBPFFilterInstructions(t *testing.T) {
+	extra := []bpf.RawInstruction{{Op: 0x6, K: 0x0}}
+
+	instructions, err := bpfFilterInstructions(config.CaptureConfig{ExtraBPFFilters: extra}, &link.EmptyEthernetLink)
+	require.Nil(t, err)
+	require.Equal(t, extra, instructions)
+
+	// the compiled filter precedes the extra filters
+	compiled, err := bpffilter.Compile("not port 22", link.IPLayerOffsetEthernet)
+	require.Nil(t, err)
+	instructions, err = bpfFilterInstructions(config.CaptureConfig{Filter: "not port 22", ExtraBPFFilters: extra}, &link.EmptyEthernetLink)
+	require.Nil(t, err)
+	require.Equal(t, append(compiled, extra...), instructions)
+
+	_, err = bpfFilterInstructions(config.CaptureConfig{Filter: "port ssh"}, &link.EmptyEthernetLink)
+	require.NotNil(t, err)
+	_, err = bpfFilterInstructions(config.CaptureConfig{Filter: "not port 22", ExtraBPFFilters: make([]bpf.RawInstruction, bpffilter.MaxInstructions)}, &link.EmptyEthernetLink)
+	require.NotNil(t, err)
+}
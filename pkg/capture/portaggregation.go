@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/protocols"
+)
+
+// portAggregation tunes the aggregation of the client ports of flows to common ports (c.f. isCommonPort),
+// which are discarded by default (in which case it is nil)
+type portAggregation struct {
+	kept       [65536 / 64]uint64 // kept denotes the (bitmap of) common ports whose flows retain their client port
+	bucketSize uint16             // bucketSize denotes the size of the buckets client ports are aggregated into (discarded if zero)
+
+	cfg config.SourcePortAggregationConfig
+}
+
+// newPortAggregation initializes the aggregation of client ports as configured (nil if not configured)
+func newPortAggregation(cfg *config.SourcePortAggregationConfig) (*portAggregation, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	ranges, err := cfg.KeptPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &portAggregation{
+		bucketSize: uint16(cfg.BucketSize),
+		cfg:        *cfg,
+	}
+	for _, r := range ranges {
+		for port := uint32(r.Low); port <= uint32(r.High); port++ {
+			p.kept[port/64] |= 1 << (port % 64)
+		}
+	}
+	return p, nil
+}
+
+// put stores the client port of a flow to a common port in dst, aggregated as configured
+func (p *portAggregation) put(dst, clientPort, commonPort []byte) {
+
+	// Fast path for the default behavior, leaving the client port zeroed
+	if p == nil {
+		return
+	}
+
+	port := uint16(commonPort[0])<<8 | uint16(commonPort[1])
+	if p.kept[port/64]&(1<<(port%64)) != 0 {
+		copy(dst, clientPort)
+		return
+	}
+	if p.bucketSize > 0 {
+		port = uint16(clientPort[0])<<8 | uint16(clientPort[1])
+		port -= port % p.bucketSize
+		dst[0], dst[1] = byte(port>>8), byte(port)
+	}
+}
+
+// parameters returns the aggregation of client ports effectively applied
+func (p *portAggregation) parameters() capturetypes.SourcePortAggregationParameters {
+	params := capturetypes.SourcePortAggregationParameters{
+		CommonPorts: commonPortNames(),
+	}
+	if p != nil {
+		params.Keep = p.cfg.Keep
+		params.BucketSize = int(p.bucketSize)
+	}
+	return params
+}
+
+// commonPortNames returns all common ports (c.f. isCommonPort) along with their protocol
+func commonPortNames() (names []string) {
+	for _, proto := range []byte{capturetypes.TCP, capturetypes.UDP} {
+		for first := 0; first <= commonPortsMaxTrackedFirstByte; first++ {
+			for last := 0; last < 256; last++ {
+				if commonPorts[proto][first][last] {
+					names = append(names, fmt.Sprintf("%d/%s", first<<8|last, strings.ToLower(protocols.GetIPProto(int(proto)))))
+				}
+			}
+		}
+	}
+	return
+}
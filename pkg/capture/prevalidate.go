@@ -0,0 +1,251 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"golang.org/x/sys/unix"
+)
+
+// procMeminfoPath denotes the path exposing the memory statistics of the host (may be overridden in tests)
+var procMeminfoPath = "/proc/meminfo"
+
+const (
+
+	// ethFlagLRO denotes the large receive offload flag of ETHTOOL_GFLAGS / ETHTOOL_SFLAGS (not provided
+	// by x/sys/unix)
+	ethFlagLRO = 1 << 15
+)
+
+var errIfaceNameTooLong = errors.New("interface name exceeds maximum length")
+
+// offloads denotes the receive offloads of an interface, which merge packets prior to them being
+// captured (i.e. goProbe observes fewer, but larger packets than the ones on the wire)
+type offloads struct {
+	gro, lro bool
+}
+
+func (o offloads) enabled() bool {
+	return o.gro || o.lro
+}
+
+func (o offloads) String() string {
+	var names []string
+	if o.gro {
+		names = append(names, "GRO")
+	}
+	if o.lro {
+		names = append(names, "LRO")
+	}
+	return strings.Join(names, " / ")
+}
+
+// prevalidate validates the state of an interface prior to enabling the capture on it: its link state,
+// its receive offloads (disabling them if configured to) and whether its ring buffer can be allocated.
+// All issues found are logged and returned as warnings (none of them prevent the capture from being
+// enabled), alongside the receive offloads disabled (to be restored upon closing the capture)
+func prevalidate(ctx context.Context, iface string, cfg config.CaptureConfig) (warnings []string, disabled offloads) {
+
+	// The interface name merely labels the flows of ingested flow records
+	if cfg.Ingest != nil {
+		return nil, offloads{}
+	}
+
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
+	if warning := checkLinkState(iface); warning != "" {
+		warnings = append(warnings, warning)
+	}
+
+	// Offloads and ring buffers only affect the capture via AF_PACKET (XDP programs process the packets
+	// before they are merged)
+	if cfg.XDP == nil {
+		var warning string
+		if warning, disabled = checkOffloads(ctx, iface, cfg.DisableOffloads); warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if warning := checkRingBuffer(cfg.RingBuffer); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	for _, warning := range warnings {
+		logger.Warnf("interface pre-validation: %s", warning)
+	}
+	return warnings, disabled
+}
+
+// checkLinkState warns if the link of the interface is down (the interface not being found is left to
+// the capture to report)
+func checkLinkState(iface string) string {
+	state, err := os.ReadFile(filepath.Join(sysClassNetPath, iface, "operstate"))
+	if err != nil {
+		return ""
+	}
+
+	switch operState := strings.TrimSpace(string(state)); operState {
+	case "down", "lowerlayerdown", "notpresent":
+		return fmt.Sprintf("link is %s, no packets are captured until it is up", operState)
+	}
+	return ""
+}
+
+// checkOffloads warns if receive offloads are enabled on the interface (or disables them if requested,
+// returning the ones disabled)
+func checkOffloads(ctx context.Context, iface string, disable bool) (string, offloads) {
+	current, err := readOffloads(iface)
+	if err != nil || !current.enabled() {
+		return "", offloads{}
+	}
+
+	if disable {
+		if err := setOffloads(iface, current, false); err != nil {
+			return fmt.Sprintf("failed to disable receive offloads (%s): %s", current, err), offloads{}
+		}
+		logs.FromContext(ctx, logs.ModuleCapture).With("offloads", current.String()).Info("disabled receive offloads")
+		return "", current
+	}
+	return offloadsWarning(iface, current), offloads{}
+}
+
+func offloadsWarning(iface string, current offloads) string {
+	var features []string
+	if current.gro {
+		features = append(features, "gro off")
+	}
+	if current.lro {
+		features = append(features, "lro off")
+	}
+	return fmt.Sprintf("receive offloads (%s) are enabled, merging packets prior to capture (distorting packet sizes and counts): disable them via `ethtool -K %s %s` or the disable_offloads option",
+		current, iface, strings.Join(features, " "))
+}
+
+// checkRingBuffer warns if the ring buffer (its block size being aligned to the page size) exceeds the
+// memory available on the host, in which case its allocation is likely to fail
+func checkRingBuffer(cfg *config.RingBufferConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	available, err := memAvailable()
+	if err != nil {
+		return ""
+	}
+
+	blockSize := pageSizeAlign(cfg.BlockSize)
+	if size := uint64(blockSize) * uint64(cfg.NumBlocks); size > available {
+		return fmt.Sprintf("ring buffer (%d blocks of %d bytes) exceeds the available memory (%d bytes), its allocation is likely to fail",
+			cfg.NumBlocks, blockSize, available)
+	}
+	return ""
+}
+
+// memAvailable returns the memory available for starting new applications without swapping (in bytes)
+func memAvailable() (uint64, error) {
+	file, err := os.Open(filepath.Clean(procMeminfoPath))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kBytes, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemAvailable in %s: %w", procMeminfoPath, err)
+		}
+		return kBytes * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemAvailable in %s", procMeminfoPath)
+}
+
+// readOffloads determines the receive offloads enabled on the interface
+func readOffloads(iface string) (current offloads, err error) {
+	gro, err := ethtool(iface, unix.ETHTOOL_GGRO, 0)
+	if err != nil {
+		return
+	}
+	flags, err := ethtool(iface, unix.ETHTOOL_GFLAGS, 0)
+	if err != nil {
+		return
+	}
+	return offloads{gro: gro != 0, lro: flags&ethFlagLRO != 0}, nil
+}
+
+// setOffloads enables / disables the given receive offloads on the interface (leaving all others untouched)
+func setOffloads(iface string, which offloads, enable bool) error {
+	if which.gro {
+		var gro uint32
+		if enable {
+			gro = 1
+		}
+		if _, err := ethtool(iface, unix.ETHTOOL_SGRO, gro); err != nil {
+			return err
+		}
+	}
+	if which.lro {
+		flags, err := ethtool(iface, unix.ETHTOOL_GFLAGS, 0)
+		if err != nil {
+			return err
+		}
+		if enable {
+			flags |= ethFlagLRO
+		} else {
+			flags &^= ethFlagLRO
+		}
+		if _, err := ethtool(iface, unix.ETHTOOL_SFLAGS, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ethtoolValue mirrors struct ethtool_value
+type ethtoolValue struct {
+	cmd  uint32
+	data uint32
+}
+
+// ifreqData mirrors struct ifreq carrying a pointer (as required by SIOCETHTOOL)
+type ifreqData struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [unsafe.Sizeof(unix.Ifreq{}) - unix.IFNAMSIZ - unsafe.Sizeof(uintptr(0))]byte
+}
+
+// ethtool performs an ethtool command carrying a single value on the interface
+func ethtool(iface string, cmd, data uint32) (uint32, error) {
+	if len(iface) >= unix.IFNAMSIZ {
+		return 0, fmt.Errorf("%w: %s", errIfaceNameTooLong, iface)
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer unix.Close(fd)
+
+	value := ethtoolValue{cmd: cmd, data: data}
+	ifr := ifreqData{data: unsafe.Pointer(&value)} // #nosec G103
+	copy(ifr.name[:], iface)
+
+	// #nosec G103
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return 0, errno
+	}
+	return value.data, nil
+}
@@ -0,0 +1,78 @@
+package capture
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLinkState(t *testing.T) {
+	sysClassNetPath = t.TempDir()
+	defer func() {
+		sysClassNetPath = "/sys/class/net"
+	}()
+
+	// interfaces not found are left to the capture to report
+	require.Empty(t, checkLinkState("mock"))
+
+	require.Nil(t, os.Mkdir(filepath.Join(sysClassNetPath, "mock"), 0700))
+	for state, expectWarning := range map[string]bool{
+		"up\n":             false,
+		"unknown\n":        false,
+		"down\n":           true,
+		"lowerlayerdown\n": true,
+	} {
+		require.Nil(t, os.WriteFile(filepath.Join(sysClassNetPath, "mock", "operstate"), []byte(state), 0600))
+		if expectWarning {
+			require.Contains(t, checkLinkState("mock"), "link is")
+		} else {
+			require.Empty(t, checkLinkState("mock"))
+		}
+	}
+}
+
+func TestCheckRingBuffer(t *testing.T) {
+	procMeminfoPath = filepath.Join(t.TempDir(), "meminfo")
+	defer func() {
+		procMeminfoPath = "/proc/meminfo"
+	}()
+
+	// without any memory statistics, no warning can be provided
+	require.Empty(t, checkRingBuffer(&config.RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 4}))
+
+	require.Nil(t, os.WriteFile(procMeminfoPath, []byte("MemTotal:        8192 kB\nMemFree:         2048 kB\nMemAvailable:    4096 kB\n"), 0600))
+	available, err := memAvailable()
+	require.Nil(t, err)
+	require.Equal(t, uint64(4096*1024), available)
+
+	require.Empty(t, checkRingBuffer(nil))
+	require.Empty(t, checkRingBuffer(&config.RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 4}))
+	require.Contains(t, checkRingBuffer(&config.RingBufferConfig{BlockSize: 1024 * 1024, NumBlocks: 5}), "exceeds the available memory")
+}
+
+func TestCheckOffloads(t *testing.T) {
+	require.Equal(t, "GRO / LRO", offloads{gro: true, lro: true}.String())
+	require.False(t, offloads{}.enabled())
+	require.Contains(t, offloadsWarning("eth0", offloads{gro: true}), "`ethtool -K eth0 gro off`")
+	require.Contains(t, offloadsWarning("eth0", offloads{gro: true, lro: true}), "`ethtool -K eth0 gro off lro off`")
+
+	// interfaces which do not exist (or whose offloads cannot be determined) are not reported
+	_, err := readOffloads("nonexistent0")
+	require.NotNil(t, err)
+	warning, disabled := checkOffloads(context.Background(), "nonexistent0", true)
+	require.Empty(t, warning)
+	require.False(t, disabled.enabled())
+	require.NotNil(t, setOffloads("nonexistent0", offloads{gro: true}, true))
+	_, err = readOffloads("averyveryverylongname")
+	require.ErrorIs(t, err, errIfaceNameTooLong)
+
+	// the loopback interface is present on all hosts, but its offloads may not be readable
+	// (e.g. in sandboxed environments)
+	if _, err := readOffloads("lo"); err != nil {
+		t.Skipf("cannot read offloads of loopback interface: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package capture
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"runtime"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/fako1024/slimcap/link"
+)
+
+const (
+
+	// ringFrameOverhead denotes the space occupied by the TPACKET_V3 header (aligned) preceding the link
+	// layer of each frame in the ring buffer
+	ringFrameOverhead = 82
+
+	// ringFrameAlignment denotes the alignment of the frames in the ring buffer (TPACKET_ALIGNMENT)
+	ringFrameAlignment = 16
+
+	// simulationSeed seeds the generation of the synthetic flows, so that repeated simulations of the
+	// same profile yield the same flows
+	simulationSeed = 0x676f50726f6265
+)
+
+// commonDPorts denotes the destination ports the majority of synthetic flows is directed to
+var commonDPorts = []uint16{443, 80, 53, 123, 22, 25, 993, 3389, 8080, 8443}
+
+// TrafficProfile describes the (expected) traffic of an interface, used to simulate its capture
+type TrafficProfile struct {
+	PacketRate float64 // PacketRate : number of packets per second
+	Flows      int     // Flows : number of distinct flows per writeout interval
+	IPv6Share  float64 // IPv6Share : share of IPv6 flows (between 0 and 1)
+	PacketSize int     // PacketSize : average size of a packet as seen by the kernel (i.e. including the link-layer header)
+}
+
+// Simulation stores the resource usage of a capture simulated for a traffic profile
+type Simulation struct {
+	// Packets denotes the number of packets per writeout interval
+	Packets uint64 `json:"packets"`
+	// FlowLogSize denotes the heap memory held by the flow log at the end of a writeout interval
+	FlowLogSize uint64 `json:"flow_log_size"`
+	// RotationDuration denotes the duration the capture is stalled while detaching the flows for a writeout
+	RotationDuration time.Duration `json:"rotation_duration"`
+	// AggregationDuration denotes the duration of aggregating the flows of a writeout interval (which
+	// stalls the capture if done for a live query)
+	AggregationDuration time.Duration `json:"aggregation_duration"`
+	// LocalBufferSize denotes the local buffer size required to hold the packets arriving while the
+	// capture is stalled by a live query at the end of a writeout interval
+	LocalBufferSize int `json:"local_buffer_size"`
+	// RingBufferSize denotes the (page aligned) size of the kernel ring buffer (zero if none is used)
+	RingBufferSize int `json:"ring_buffer_size,omitempty"`
+	// RingBufferDuration denotes the duration of traffic the ring buffer can hold while the packets are
+	// not consumed (zero if no ring buffer is used)
+	RingBufferDuration time.Duration `json:"ring_buffer_duration,omitempty"`
+}
+
+// Simulate simulates capturing the traffic profile for one writeout interval on an interface configured
+// with cfg, without capturing any packets. It returns the aggregated flows of the interval (as written to
+// the goDB) along with the simulated resource usage. The synthetic flows are drawn from a deterministic
+// distribution (a pool of local hosts communicating with random remote hosts, mostly on common ports)
+func Simulate(cfg config.CaptureConfig, profile TrafficProfile, interval time.Duration) (*hashmap.AggFlowMap, Simulation) {
+	sim := Simulation{
+		Packets: uint64(profile.PacketRate * interval.Seconds()),
+	}
+
+	// Collecting twice releases the memory held by pools (which survives a single collection), so
+	// that the heap only grows by the flow log in between the two measurements
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	flowLog := NewFlowLog()
+	populateFlowLog(flowLog, profile, sim.Packets)
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if after.HeapAlloc > before.HeapAlloc {
+		sim.FlowLogSize = after.HeapAlloc - before.HeapAlloc
+	}
+
+	// A live query aggregates the flows while holding the capture lock, whereas the writeout only
+	// holds it while detaching the flows
+	t0 := time.Now()
+	flowLog.Aggregate()
+	sim.AggregationDuration = time.Since(t0)
+
+	t0 = time.Now()
+	detached := flowLog.Detach()
+	sim.RotationDuration = time.Since(t0)
+
+	agg, _, _ := detached.aggregateDetached()
+
+	// While the capture is stalled, each packet occupies an element of the local buffer
+	elementSize := profile.IPv6Share*(capturetypes.EPHashSizeV6+bufElementAddSize) +
+		(1-profile.IPv6Share)*(capturetypes.EPHashSizeV4+bufElementAddSize)
+	sim.LocalBufferSize = int(profile.PacketRate * sim.AggregationDuration.Seconds() * elementSize)
+
+	// Each frame in the ring buffer carries its (truncated) packet, preceded by its header
+	if cfg.RingBuffer != nil && cfg.Ingest == nil && cfg.XDP == nil && profile.PacketRate > 0 {
+		captureLength := captureLengthStrategy(cfg)(&link.EmptyEthernetLink)
+		frameSize := alignUp(ringFrameOverhead+min(captureLength, max(profile.PacketSize, 0)), ringFrameAlignment)
+		sim.RingBufferSize = pageSizeAlign(cfg.RingBuffer.BlockSize) * cfg.RingBuffer.NumBlocks
+		sim.RingBufferDuration = time.Duration(float64(sim.RingBufferSize) / float64(frameSize) / profile.PacketRate * float64(time.Second))
+	}
+
+	runtime.KeepAlive(detached)
+
+	return agg, sim
+}
+
+// populateFlowLog populates the flow log with the synthetic flows of a traffic profile, distributing the
+// packets (received and sent alike) among them
+func populateFlowLog(flowLog *FlowLog, profile TrafficProfile, nPackets uint64) {
+	if profile.Flows <= 0 {
+		return
+	}
+
+	rng := rand.New(rand.NewPCG(simulationSeed, uint64(profile.Flows))) // #nosec G404
+	nHosts := max(profile.Flows/16, 1)
+	avgPackets := max(nPackets/uint64(profile.Flows), 1)
+
+	var (
+		epHashV4 capturetypes.EPHashV4
+		epHashV6 capturetypes.EPHashV6
+		sport    = make([]byte, 2)
+		dport    = make([]byte, 2)
+	)
+	for i := 0; i < profile.Flows; i++ {
+
+		// Local hosts are drawn from a pool, remote hosts are random
+		host := uint32(rng.IntN(nHosts))
+		binary.BigEndian.PutUint16(sport, uint16(32768+rng.IntN(28232)))
+		if rng.Float64() < 0.8 {
+			binary.BigEndian.PutUint16(dport, commonDPorts[rng.IntN(len(commonDPorts))])
+		} else {
+			binary.BigEndian.PutUint16(dport, uint16(1+rng.IntN(65535)))
+		}
+		proto := byte(6)
+		if rng.Float64() < 0.2 {
+			proto = 17
+		}
+
+		// Packets are distributed uniformly around the average, half of them in either direction
+		packets := 1 + rng.Uint64N(2*avgPackets)
+		flow := &Flow{Counters: types.Counters{
+			PacketsRcvd: packets / 2,
+			PacketsSent: packets - packets/2,
+		}}
+		flow.BytesRcvd = flow.PacketsRcvd * uint64(max(profile.PacketSize, 0))
+		flow.BytesSent = flow.PacketsSent * uint64(max(profile.PacketSize, 0))
+
+		if rng.Float64() < profile.IPv6Share {
+			binary.BigEndian.PutUint64(epHashV6[capturetypes.EPHashV6SipStart:], 0xfd00000000000000)
+			binary.BigEndian.PutUint64(epHashV6[capturetypes.EPHashV6SipStart+8:], uint64(host))
+			binary.BigEndian.PutUint64(epHashV6[capturetypes.EPHashV6DipStart:], 0x2000000000000000|rng.Uint64()>>4)
+			binary.BigEndian.PutUint64(epHashV6[capturetypes.EPHashV6DipStart+8:], rng.Uint64())
+			copy(epHashV6[capturetypes.EPHashV6SPortStart:], sport)
+			copy(epHashV6[capturetypes.EPHashV6DPortStart:], dport)
+			epHashV6[capturetypes.EPHashV6ProtocolPos] = proto
+			flowLog.flowMapV6[string(epHashV6[:])] = flow
+			continue
+		}
+
+		binary.BigEndian.PutUint32(epHashV4[capturetypes.EPHashV4SipStart:], 0x0a000000|host&0x00ffffff)
+		binary.BigEndian.PutUint32(epHashV4[capturetypes.EPHashV4DipStart:], rng.Uint32())
+		copy(epHashV4[capturetypes.EPHashV4SPortStart:], sport)
+		copy(epHashV4[capturetypes.EPHashV4DPortStart:], dport)
+		epHashV4[capturetypes.EPHashV4ProtocolPos] = proto
+		flowLog.flowMapV4[string(epHashV4[:])] = flow
+	}
+}
+
+// alignUp aligns x to the next multiple of alignment
+func alignUp(x, alignment int) int {
+	return (x + alignment - 1) / alignment * alignment
+}
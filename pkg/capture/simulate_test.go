@@ -0,0 +1,42 @@
+package capture
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	cfg := config.CaptureConfig{
+		CaptureLength: 128,
+		RingBuffer:    &config.RingBufferConfig{BlockSize: os.Getpagesize(), NumBlocks: 4},
+	}
+	profile := TrafficProfile{PacketRate: 1000, Flows: 5000, IPv6Share: 0.25, PacketSize: 1000}
+
+	agg, sim := Simulate(cfg, profile, time.Minute)
+	require.Equal(t, 5000, agg.Len())
+	require.InDelta(t, 1250, agg.SecondaryMap.Len(), 100)
+	require.Equal(t, uint64(60000), sim.Packets)
+	require.NotZero(t, sim.FlowLogSize)
+
+	// Each frame occupies the header and the capture length (aligned)
+	require.Equal(t, 4*os.Getpagesize(), sim.RingBufferSize)
+	require.Equal(t, time.Duration(float64(sim.RingBufferSize)/float64(alignUp(ringFrameOverhead+128, ringFrameAlignment))/1000*float64(time.Second)), sim.RingBufferDuration)
+
+	// The synthetic flows are deterministic
+	agg2, _ := Simulate(cfg, profile, time.Minute)
+	require.Equal(t, agg.PrimaryMap.Len(), agg2.PrimaryMap.Len())
+	for it := agg.PrimaryMap.Iter(); it.Next(); {
+		val, exists := agg2.PrimaryMap.Get(it.Key())
+		require.True(t, exists)
+		require.Equal(t, it.Val(), val)
+	}
+
+	// No ring buffer is used when capturing via XDP
+	_, sim = Simulate(config.CaptureConfig{XDP: &config.XDPConfig{}}, profile, time.Minute)
+	require.Zero(t, sim.RingBufferSize)
+	require.Zero(t, sim.RingBufferDuration)
+}
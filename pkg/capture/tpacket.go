@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/fako1024/slimcap/capture"
+	"golang.org/x/sys/unix"
+)
+
+const (
+
+	// Offset of the network layer of a packet in its frame of an AF_PACKET (TPACKET_V3) ring buffer for
+	// link layer headers of up to 16 bytes, i.e. TPACKET_ALIGN(TPACKET3_HDRLEN + 16)
+	tpacketNetOffset = 96
+
+	// Offsets of the relevant fields of the tpacket3_hdr structure, c.f.
+	// https://github.com/torvalds/linux/blob/master/include/uapi/linux/if_packet.h
+	tpacketStatusOffset  = 20
+	tpacketMacOffset     = 24
+	tpacketNetOffsetPos  = 26
+	tpacketVLANTCIOffset = 32
+
+	vlanIDMask = 0x0fff
+)
+
+// linkVLAN returns the VLAN ID of a packet received from an AF_PACKET ring buffer, which the kernel
+// strips from the frame and provides in the tpacket header (auxdata) preceding it. The IP layer must
+// reference the ring buffer (zero if the header cannot be located or the packet was untagged)
+//
+// Note: This is a stopgap, since slimcap (as of v1.0.6) does not expose the tpacket header (or its
+// tp_vlan_tci field) of the packets it returns. As soon as afring.Source provides the VLAN ID itself
+// (i.e. implements VLANSource), it is used instead and this function can be removed
+func linkVLAN(ipLayer capture.IPLayer) uint16 {
+	if len(ipLayer) == 0 || unsafe.SliceData(ipLayer) == unsafe.SliceData(invalidIPLayer) {
+		return 0
+	}
+	return tpacketVLAN(unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(ipLayer)), -tpacketNetOffset)), tpacketNetOffset)) // #nosec G103
+}
+
+// tpacketVLAN extracts the VLAN ID from a tpacket3 header, provided it is consistent with a network layer
+// located at tpacketNetOffset (i.e. the IP layer was returned for a link layer header of regular size)
+func tpacketVLAN(hdr []byte) uint16 {
+	if binary.NativeEndian.Uint16(hdr[tpacketNetOffsetPos:]) != tpacketNetOffset ||
+		binary.NativeEndian.Uint16(hdr[tpacketMacOffset:]) >= tpacketNetOffset {
+		return 0
+	}
+	if binary.NativeEndian.Uint32(hdr[tpacketStatusOffset:])&unix.TP_STATUS_VLAN_VALID == 0 {
+		return 0
+	}
+	return uint16(binary.NativeEndian.Uint32(hdr[tpacketVLANTCIOffset:]) & vlanIDMask)
+}
@@ -0,0 +1,39 @@
+package capture
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestLinkVLAN(t *testing.T) {
+	newFrame := func(status uint32, mac, net uint16, tci uint32) []byte {
+		frame := make([]byte, tpacketNetOffset+20)
+		binary.NativeEndian.PutUint32(frame[tpacketStatusOffset:], status)
+		binary.NativeEndian.PutUint16(frame[tpacketMacOffset:], mac)
+		binary.NativeEndian.PutUint16(frame[tpacketNetOffsetPos:], net)
+		binary.NativeEndian.PutUint32(frame[tpacketVLANTCIOffset:], tci)
+		frame[tpacketNetOffset] = 0x45
+		return frame
+	}
+
+	for _, c := range []struct {
+		name     string
+		frame    []byte
+		expected uint16
+	}{
+		{"tagged", newFrame(unix.TP_STATUS_USER|unix.TP_STATUS_VLAN_VALID, tpacketNetOffset-14, tpacketNetOffset, 0xa064), 100},
+		{"untagged", newFrame(unix.TP_STATUS_USER, tpacketNetOffset-14, tpacketNetOffset, 0), 0},
+		{"stale_tci", newFrame(unix.TP_STATUS_USER, tpacketNetOffset-14, tpacketNetOffset, 100), 0},
+		{"unexpected_net_offset", newFrame(unix.TP_STATUS_USER|unix.TP_STATUS_VLAN_VALID, tpacketNetOffset-14, tpacketNetOffset+16, 100), 0},
+		{"unexpected_mac_offset", newFrame(unix.TP_STATUS_USER|unix.TP_STATUS_VLAN_VALID, tpacketNetOffset, tpacketNetOffset, 100), 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, linkVLAN(c.frame[tpacketNetOffset:]))
+		})
+	}
+
+	require.Zero(t, linkVLAN(invalidIPLayer))
+}
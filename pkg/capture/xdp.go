@@ -0,0 +1,18 @@
+//go:build !slimcap_nomock
+// +build !slimcap_nomock
+
+package capture
+
+import "github.com/els0r/goProbe/pkg/capture/xdp"
+
+// newXDPSource initializes a source consuming the flows aggregated in kernel space by an eBPF / XDP program
+func newXDPSource(c *Capture) (Source, error) {
+	return xdp.NewSource(c.iface,
+		xdp.WithMode(xdp.Mode(c.config.XDP.Mode)),
+		xdp.WithEgress(c.config.XDP.Egress),
+		xdp.WithMaxFlows(c.config.XDP.MaxFlows),
+		xdp.WithPollInterval(c.config.XDP.PollInterval),
+		xdp.WithPromiscuous(c.config.Promisc),
+		xdp.WithIgnoreVLANs(c.config.IgnoreVLANs),
+	)
+}
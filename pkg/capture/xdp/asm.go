@@ -0,0 +1,213 @@
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// insnSize denotes the size of a raw eBPF instruction
+const insnSize = 8
+
+var errUndefinedLabel = errors.New("jump to undefined label")
+
+// eBPF instruction classes, sizes, modes and operations (c.f. linux/bpf.h and linux/bpf_common.h)
+const (
+	classLDX   = 0x01
+	classST    = 0x02
+	classSTX   = 0x03
+	classJMP   = 0x05
+	classALU   = 0x04
+	classALU64 = 0x07
+	classLD    = 0x00
+
+	sizeW  = 0x00
+	sizeH  = 0x08
+	sizeB  = 0x10
+	sizeDW = 0x18
+
+	modeIMM    = 0x00
+	modeMEM    = 0x60
+	modeATOMIC = 0xc0
+
+	srcK = 0x00
+	srcX = 0x08
+
+	aluAdd = 0x00
+	aluSub = 0x10
+	aluOr  = 0x40
+	aluAnd = 0x50
+	aluLsh = 0x60
+	aluMov = 0xb0
+	aluEnd = 0xd0
+
+	// endToBE converts from host to big-endian byte order (the source bit of the END operation)
+	endToBE = 0x08
+
+	jmpJA   = 0x00
+	jmpJEQ  = 0x10
+	jmpJGT  = 0x20
+	jmpJNE  = 0x50
+	jmpJLT  = 0xa0
+	jmpCall = 0x80
+	jmpExit = 0x90
+
+	pseudoMapFD = 1
+
+	helperMapLookupElem = 1
+	helperMapUpdateElem = 2
+)
+
+// reg denotes an eBPF register
+type reg uint8
+
+// eBPF registers: r0 holds return values, r1 - r5 hold function arguments (and are clobbered by calls),
+// r6 - r9 are callee-saved and r10 is the read-only frame pointer
+const (
+	r0 reg = iota
+	r1
+	r2
+	r3
+	r4
+	r5
+	r6
+	r7
+	r8
+	r9
+	rFP
+)
+
+// instruction denotes a single (raw) eBPF instruction
+type instruction struct {
+	op  uint8
+	dst reg
+	src reg
+	off int16
+	imm int32
+}
+
+// label denotes a jump target, resolved by the assembler
+type label string
+
+// asm assembles an eBPF program, resolving the jump offsets to its labels
+type asm struct {
+	insns  []instruction
+	labels map[label]int
+	jumps  map[int]label
+}
+
+func newAsm() *asm {
+	return &asm{
+		labels: make(map[label]int),
+		jumps:  make(map[int]label),
+	}
+}
+
+func (a *asm) emit(insns ...instruction) {
+	a.insns = append(a.insns, insns...)
+}
+
+// label marks the position of the next instruction as jump target
+func (a *asm) label(l label) {
+	a.labels[l] = len(a.insns)
+}
+
+// mov64Imm: dst = imm
+func (a *asm) mov64Imm(dst reg, imm int32) {
+	a.emit(instruction{op: classALU64 | aluMov | srcK, dst: dst, imm: imm})
+}
+
+// mov64: dst = src
+func (a *asm) mov64(dst, src reg) {
+	a.emit(instruction{op: classALU64 | aluMov | srcX, dst: dst, src: src})
+}
+
+// alu64Imm: dst = dst <op> imm
+func (a *asm) alu64Imm(op uint8, dst reg, imm int32) {
+	a.emit(instruction{op: classALU64 | op | srcK, dst: dst, imm: imm})
+}
+
+// alu64: dst = dst <op> src
+func (a *asm) alu64(op uint8, dst, src reg) {
+	a.emit(instruction{op: classALU64 | op | srcX, dst: dst, src: src})
+}
+
+// toBE16 converts the lower 16 bits of dst from network to host byte order (or vice versa)
+func (a *asm) toBE16(dst reg) {
+	a.emit(instruction{op: classALU | aluEnd | endToBE, dst: dst, imm: 16})
+}
+
+// load: dst = *(size *)(src + off)
+func (a *asm) load(size uint8, dst, src reg, off int16) {
+	a.emit(instruction{op: classLDX | modeMEM | size, dst: dst, src: src, off: off})
+}
+
+// store: *(size *)(dst + off) = src
+func (a *asm) store(size uint8, dst reg, off int16, src reg) {
+	a.emit(instruction{op: classSTX | modeMEM | size, dst: dst, src: src, off: off})
+}
+
+// storeImm: *(size *)(dst + off) = imm
+func (a *asm) storeImm(size uint8, dst reg, off int16, imm int32) {
+	a.emit(instruction{op: classST | modeMEM | size, dst: dst, off: off, imm: imm})
+}
+
+// atomic64: *(u64 *)(dst + off) <op>= src (atomically)
+func (a *asm) atomic64(op uint8, dst reg, off int16, src reg) {
+	a.emit(instruction{op: classSTX | modeATOMIC | sizeDW, dst: dst, src: src, off: off, imm: int32(op)})
+}
+
+// loadMapFD loads the file descriptor of a map (occupying two instruction slots)
+func (a *asm) loadMapFD(dst reg, fd int) {
+	a.emit(
+		instruction{op: classLD | modeIMM | sizeDW, dst: dst, src: pseudoMapFD, imm: int32(fd)},
+		instruction{},
+	)
+}
+
+// jmpImm jumps to the label if dst <op> imm holds
+func (a *asm) jmpImm(op uint8, dst reg, imm int32, target label) {
+	a.jumps[len(a.insns)] = target
+	a.emit(instruction{op: classJMP | op | srcK, dst: dst, imm: imm})
+}
+
+// jmp jumps to the label if dst <op> src holds
+func (a *asm) jmp(op uint8, dst, src reg, target label) {
+	a.jumps[len(a.insns)] = target
+	a.emit(instruction{op: classJMP | op | srcX, dst: dst, src: src})
+}
+
+// ja jumps to the label unconditionally
+func (a *asm) ja(target label) {
+	a.jumps[len(a.insns)] = target
+	a.emit(instruction{op: classJMP | jmpJA})
+}
+
+// call calls a helper function
+func (a *asm) call(helper int32) {
+	a.emit(instruction{op: classJMP | jmpCall, imm: helper})
+}
+
+// exit returns from the program (with r0 as return value)
+func (a *asm) exit() {
+	a.emit(instruction{op: classJMP | jmpExit})
+}
+
+// assemble resolves all jumps and returns the raw program
+func (a *asm) assemble() ([]byte, error) {
+	for pos, target := range a.jumps {
+		dst, exists := a.labels[target]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", errUndefinedLabel, target)
+		}
+		a.insns[pos].off = int16(dst - pos - 1)
+	}
+
+	raw := make([]byte, 0, len(a.insns)*insnSize)
+	for _, insn := range a.insns {
+		raw = append(raw, insn.op, byte(insn.dst&0x0f)|byte(insn.src&0x0f)<<4)
+		raw = binary.NativeEndian.AppendUint16(raw, uint16(insn.off))
+		raw = binary.NativeEndian.AppendUint32(raw, uint32(insn.imm))
+	}
+	return raw, nil
+}
@@ -0,0 +1,167 @@
+package xdp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	bpfObjNameLen = 16
+
+	// verifierLogSize denotes the size of the buffer receiving the verifier log if a program is rejected
+	verifierLogSize = 1 << 20
+
+	// verifierLogLines denotes the number of (trailing) lines of the verifier log included in errors
+	verifierLogLines = 8
+)
+
+// bpfMapCreateAttr denotes the attributes of the BPF_MAP_CREATE command (c.f. union bpf_attr)
+type bpfMapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+	innerMapFD uint32
+	numaNode   uint32
+	mapName    [bpfObjNameLen]byte
+}
+
+// bpfMapElemAttr denotes the attributes of the BPF_MAP_*_ELEM commands (c.f. union bpf_attr)
+type bpfMapElemAttr struct {
+	mapFD uint32
+	_     uint32
+	key   uint64
+	value uint64 // also denotes the next key (BPF_MAP_GET_NEXT_KEY)
+	flags uint64
+}
+
+// bpfProgLoadAttr denotes the attributes of the BPF_PROG_LOAD command (c.f. union bpf_attr)
+type bpfProgLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	progName           [bpfObjNameLen]byte
+	progIfindex        uint32
+	expectedAttachType uint32
+}
+
+// bpfLinkCreateAttr denotes the attributes of the BPF_LINK_CREATE command (c.f. union bpf_attr). The
+// attach type specific attributes are left zero
+type bpfLinkCreateAttr struct {
+	progFD        uint32
+	targetIfindex uint32
+	attachType    uint32
+	flags         uint32
+	_             [2]uint64
+}
+
+func bpfCall(cmd uintptr, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, cmd, uintptr(attr), size) // #nosec: G103
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func objName(name string) (res [bpfObjNameLen]byte) {
+	copy(res[:bpfObjNameLen-1], name)
+	return
+}
+
+// createMap creates a BPF map, returning its file descriptor
+func createMap(name string, mapType, keySize, valueSize, maxEntries uint32) (int, error) {
+	attr := bpfMapCreateAttr{
+		mapType:    mapType,
+		keySize:    keySize,
+		valueSize:  valueSize,
+		maxEntries: maxEntries,
+		mapName:    objName(name),
+	}
+	fd, err := bpfCall(unix.BPF_MAP_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr)) // #nosec: G103
+	if err != nil {
+		return -1, fmt.Errorf("failed to create BPF map %s: %w", name, err)
+	}
+	return fd, nil
+}
+
+// mapElemOp performs an operation on a single element of a BPF map
+func mapElemOp(cmd uintptr, mapFD int, key, value []byte, flags uint64) error {
+	attr := bpfMapElemAttr{
+		mapFD: uint32(mapFD),
+		flags: flags,
+	}
+	if key != nil {
+		attr.key = uint64(uintptr(unsafe.Pointer(&key[0]))) // #nosec: G103
+	}
+	if value != nil {
+		attr.value = uint64(uintptr(unsafe.Pointer(&value[0]))) // #nosec: G103
+	}
+	_, err := bpfCall(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr)) // #nosec: G103
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// loadProgram loads a program into the kernel, returning its file descriptor. If the program is rejected
+// by the verifier, the error includes the tail of the verifier log
+func loadProgram(name string, progType, attachType uint32, insns []byte) (int, error) {
+	license := []byte("GPL\x00")
+	attr := bpfProgLoadAttr{
+		progType:           progType,
+		insnCnt:            uint32(len(insns) / insnSize),
+		insns:              uint64(uintptr(unsafe.Pointer(&insns[0]))),   // #nosec: G103
+		license:            uint64(uintptr(unsafe.Pointer(&license[0]))), // #nosec: G103
+		progName:           objName(name),
+		expectedAttachType: attachType,
+	}
+	fd, err := bpfCall(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr)) // #nosec: G103
+	if err == nil {
+		runtime.KeepAlive(insns)
+		runtime.KeepAlive(license)
+		return fd, nil
+	}
+	if !errors.Is(err, unix.EACCES) && !errors.Is(err, unix.EINVAL) {
+		return -1, fmt.Errorf("failed to load BPF program %s: %w", name, err)
+	}
+
+	// Load the program again in order to obtain the verifier log
+	logBuf := make([]byte, verifierLogSize)
+	attr.logLevel, attr.logSize = 1, uint32(len(logBuf))
+	attr.logBuf = uint64(uintptr(unsafe.Pointer(&logBuf[0]))) // #nosec: G103
+
+	fd, err = bpfCall(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr)) // #nosec: G103
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if err == nil {
+		return fd, nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(bytes.TrimRight(logBuf, "\x00"))), "\n")
+	return -1, fmt.Errorf("failed to load BPF program %s: %w (verifier log: %s)", name, err,
+		strings.Join(lines[max(0, len(lines)-verifierLogLines):], "; "))
+}
+
+// createLink attaches a program to an interface, returning the file descriptor of the link (the program
+// is detached once the link is closed)
+func createLink(progFD, ifIndex int, attachType, flags uint32) (int, error) {
+	attr := bpfLinkCreateAttr{
+		progFD:        uint32(progFD),
+		targetIfindex: uint32(ifIndex),
+		attachType:    attachType,
+		flags:         flags,
+	}
+	return bpfCall(unix.BPF_LINK_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr)) // #nosec: G103
+}
@@ -0,0 +1,324 @@
+package xdp
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Layout of the flow keys stored in the flow map (all fields in network byte order). IPv4 addresses
+// occupy the first four bytes of the address fields, the VLAN ID is the one of the outermost VLAN tag
+// (if any)
+const (
+	keyOffSIP       = 0
+	keyOffDIP       = 16
+	keyOffSPort     = 32
+	keyOffDPort     = 34
+	keyOffProto     = 36
+	keyOffIPVersion = 37
+	keyOffDirection = 38
+	keyOffVLAN      = 40
+	keyLen          = 48
+)
+
+// Layout of the flow counters stored in the flow map (all fields in host byte order)
+const (
+	valOffPackets = 0
+	valOffBytes   = 8
+	valOffFlags   = 16
+	valLen        = 24
+)
+
+// Flags of the flow counters, marking the TCP handshake packets observed (allowing to determine the
+// initiator of a flow)
+const (
+	flagSYN    = 1 << 0 // a SYN packet (without ACK) was observed
+	flagSYNACK = 1 << 1 // a SYN-ACK packet was observed
+)
+
+// Directions of the flows
+const (
+	directionIngress = 0
+	directionEgress  = 1
+)
+
+// Stack layout of the program (relative to the frame pointer): the flow key, the counters of the
+// current packet and the key of the drop counter
+const (
+	stackKey     = -keyLen
+	stackVal     = stackKey - valLen
+	stackDropKey = stackVal - 8
+)
+
+// Offsets of the packet data pointers / length in the program contexts (struct xdp_md and struct
+// __sk_buff, c.f. linux/bpf.h)
+const (
+	xdpMDData    = 0
+	xdpMDDataEnd = 4
+
+	skbLen         = 0
+	skbVLANPresent = 20
+	skbVLANTCI     = 24
+	skbData        = 76
+	skbDataEnd     = 80
+)
+
+// Return codes of the programs, passing on all packets unaltered
+const (
+	xdpPass = 2
+	tcxNext = -1
+)
+
+const (
+	etherHdrLen = 14
+	vlanTagLen  = 4
+
+	// maxVLANTags denotes the maximum number of (stacked) VLAN tags skipped to reach the IP layer
+	maxVLANTags = 2
+	vlanIDMask  = 0x0fff
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	ipv4HdrLen = 20
+	ipv6HdrLen = 40
+
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+	protoSCTP   = 132
+
+	tcpFlagSYN = 0x02
+	tcpFlagACK = 0x10
+)
+
+// programSpec denotes the parameters of the program counting the flows of an interface
+type programSpec struct {
+	egress      bool // count outgoing packets (TCX program) instead of incoming ones (XDP program)
+	ignoreVLANs bool // skip VLAN tagged packets
+	flowsFD     int  // file descriptor of the flow map
+	dropsFD     int  // file descriptor of the drop counter (packets not counted due to a full flow map)
+}
+
+// build assembles the program, which extracts the flow key of each Ethernet frame carrying an IPv4 /
+// IPv6 packet and adds the frame to its counters in the flow map. The frame length (excluding any VLAN
+// tags, just like the length reported by AF_PACKET) is accounted. All frames are passed on unaltered
+func (p programSpec) build() ([]byte, error) {
+	a := newAsm()
+
+	// r7 / r8 hold the start / end of the packet data, the frame length is stored in the counters
+	if p.egress {
+		a.load(sizeW, r7, r1, skbData)
+		a.load(sizeW, r8, r1, skbDataEnd)
+		a.load(sizeW, r2, r1, skbLen)
+	} else {
+		a.load(sizeW, r7, r1, xdpMDData)
+		a.load(sizeW, r8, r1, xdpMDDataEnd)
+		a.mov64(r2, r8)
+		a.alu64(aluSub, r2, r7)
+	}
+	a.store(sizeDW, rFP, stackVal+valOffBytes, r2)
+	a.storeImm(sizeDW, rFP, stackVal+valOffPackets, 1)
+	a.storeImm(sizeDW, rFP, stackVal+valOffFlags, 0)
+	for off := int16(0); off < keyLen; off += 8 {
+		a.storeImm(sizeDW, rFP, stackKey+off, 0)
+	}
+	direction := int32(directionIngress)
+	if p.egress {
+		direction = directionEgress
+	}
+	a.storeImm(sizeB, rFP, stackKey+keyOffDirection, direction)
+
+	// The (outermost) VLAN tag of outgoing packets is usually offloaded to the metadata of the socket
+	// buffer instead of being part of the frame
+	if p.egress {
+		a.load(sizeW, r2, r1, skbVLANPresent)
+		if p.ignoreVLANs {
+			a.jmpImm(jmpJNE, r2, 0, "pass")
+		} else {
+			a.jmpImm(jmpJEQ, r2, 0, "skb_vlan_done")
+			a.load(sizeW, r2, r1, skbVLANTCI)
+			a.alu64Imm(aluAnd, r2, vlanIDMask)
+			a.toBE16(r2)
+			a.store(sizeH, rFP, stackKey+keyOffVLAN, r2)
+			a.label("skb_vlan_done")
+		}
+	}
+
+	// r9 points to the start of the IP layer, r3 holds its EtherType. VLAN tags (if any) are skipped,
+	// recording the VLAN ID of the outermost one (unless provided by the socket buffer)
+	a.mov64(r9, r7)
+	a.alu64Imm(aluAdd, r9, etherHdrLen)
+	a.jmp(jmpJGT, r9, r8, "pass")
+	a.load(sizeH, r3, r9, -2)
+	a.toBE16(r3)
+	if p.ignoreVLANs {
+		a.jmpImm(jmpJEQ, r3, etherTypeVLAN, "pass")
+		a.jmpImm(jmpJEQ, r3, etherTypeQinQ, "pass")
+	} else {
+		for i := 0; i < maxVLANTags; i++ {
+			tag := label(fmt.Sprintf("vlan_%d", i))
+			a.jmpImm(jmpJEQ, r3, etherTypeVLAN, tag)
+			a.jmpImm(jmpJNE, r3, etherTypeQinQ, "vlan_done")
+			a.label(tag)
+			a.alu64Imm(aluAdd, r9, vlanTagLen)
+			a.jmp(jmpJGT, r9, r8, "pass")
+			a.load(sizeH, r3, r9, -2)
+			a.toBE16(r3)
+			if i == 0 {
+				a.load(sizeH, r2, rFP, stackKey+keyOffVLAN)
+				a.jmpImm(jmpJNE, r2, 0, "vlan_id_done")
+				a.load(sizeH, r2, r9, -vlanTagLen)
+				a.toBE16(r2)
+				a.alu64Imm(aluAnd, r2, vlanIDMask)
+				a.toBE16(r2)
+				a.store(sizeH, rFP, stackKey+keyOffVLAN, r2)
+				a.label("vlan_id_done")
+			}
+			a.load(sizeDW, r2, rFP, stackVal+valOffBytes)
+			a.alu64Imm(aluAdd, r2, -vlanTagLen)
+			a.store(sizeDW, rFP, stackVal+valOffBytes, r2)
+		}
+		a.label("vlan_done")
+	}
+	a.jmpImm(jmpJEQ, r3, etherTypeIPv4, "ipv4")
+	a.jmpImm(jmpJEQ, r3, etherTypeIPv6, "ipv6")
+	a.ja("pass")
+
+	// IPv4: r5 holds the protocol, r9 is advanced to the transport layer (unless the packet is a
+	// subsequent fragment, lacking a transport layer)
+	a.label("ipv4")
+	a.mov64(r2, r9)
+	a.alu64Imm(aluAdd, r2, ipv4HdrLen)
+	a.jmp(jmpJGT, r2, r8, "pass")
+	a.load(sizeB, r4, r9, 0)
+	a.alu64Imm(aluAnd, r4, 0x0f)
+	a.alu64Imm(aluLsh, r4, 2)
+	a.jmpImm(jmpJLT, r4, ipv4HdrLen, "pass")
+	a.load(sizeB, r5, r9, 9)
+	a.store(sizeB, rFP, stackKey+keyOffProto, r5)
+	a.load(sizeW, r2, r9, 12)
+	a.store(sizeW, rFP, stackKey+keyOffSIP, r2)
+	a.load(sizeW, r2, r9, 16)
+	a.store(sizeW, rFP, stackKey+keyOffDIP, r2)
+	a.storeImm(sizeB, rFP, stackKey+keyOffIPVersion, 4)
+	a.load(sizeH, r2, r9, 6)
+	a.toBE16(r2)
+	a.alu64Imm(aluAnd, r2, 0x1fff)
+	a.jmpImm(jmpJNE, r2, 0, "update")
+	a.alu64(aluAdd, r9, r4)
+	a.ja("transport")
+
+	// IPv6: r5 holds the next header (extension headers are not traversed), r9 is advanced to the
+	// transport layer
+	a.label("ipv6")
+	a.mov64(r2, r9)
+	a.alu64Imm(aluAdd, r2, ipv6HdrLen)
+	a.jmp(jmpJGT, r2, r8, "pass")
+	a.load(sizeB, r5, r9, 6)
+	a.store(sizeB, rFP, stackKey+keyOffProto, r5)
+	for off := int16(0); off < 16; off += 8 {
+		a.load(sizeDW, r2, r9, 8+off)
+		a.store(sizeDW, rFP, stackKey+keyOffSIP+off, r2)
+		a.load(sizeDW, r2, r9, 24+off)
+		a.store(sizeDW, rFP, stackKey+keyOffDIP+off, r2)
+	}
+	a.storeImm(sizeB, rFP, stackKey+keyOffIPVersion, 6)
+	a.alu64Imm(aluAdd, r9, ipv6HdrLen)
+
+	// Transport layer: the ports (ICMP type / code as destination port) and the TCP handshake flags
+	a.label("transport")
+	a.jmpImm(jmpJEQ, r5, protoTCP, "tcp")
+	a.jmpImm(jmpJEQ, r5, protoUDP, "ports")
+	a.jmpImm(jmpJEQ, r5, protoSCTP, "ports")
+	a.jmpImm(jmpJEQ, r5, protoICMP, "icmp")
+	a.jmpImm(jmpJEQ, r5, protoICMPv6, "icmp")
+	a.ja("update")
+
+	a.label("tcp")
+	a.mov64(r2, r9)
+	a.alu64Imm(aluAdd, r2, 14)
+	a.jmp(jmpJGT, r2, r8, "update")
+	a.load(sizeB, r2, r9, 13)
+	a.alu64Imm(aluAnd, r2, tcpFlagSYN|tcpFlagACK)
+	a.jmpImm(jmpJNE, r2, tcpFlagSYN, "tcp_synack")
+	a.storeImm(sizeDW, rFP, stackVal+valOffFlags, flagSYN)
+	a.ja("ports")
+	a.label("tcp_synack")
+	a.jmpImm(jmpJNE, r2, tcpFlagSYN|tcpFlagACK, "ports")
+	a.storeImm(sizeDW, rFP, stackVal+valOffFlags, flagSYNACK)
+
+	a.label("ports")
+	a.mov64(r2, r9)
+	a.alu64Imm(aluAdd, r2, 4)
+	a.jmp(jmpJGT, r2, r8, "update")
+	a.load(sizeW, r2, r9, 0)
+	a.store(sizeW, rFP, stackKey+keyOffSPort, r2)
+	a.ja("update")
+
+	a.label("icmp")
+	a.mov64(r2, r9)
+	a.alu64Imm(aluAdd, r2, 2)
+	a.jmp(jmpJGT, r2, r8, "update")
+	a.load(sizeH, r2, r9, 0)
+	a.store(sizeH, rFP, stackKey+keyOffDPort, r2)
+
+	// Add the counters to the flow, inserting it if it does not exist yet. If it was inserted
+	// concurrently (on another CPU), the counters are added to it instead. If the flow map is full,
+	// the packet is counted as dropped
+	a.label("update")
+	p.lookupAndAdd(a, "insert")
+	a.label("insert")
+	a.loadMapFD(r1, p.flowsFD)
+	a.mov64(r2, rFP)
+	a.alu64Imm(aluAdd, r2, stackKey)
+	a.mov64(r3, rFP)
+	a.alu64Imm(aluAdd, r3, stackVal)
+	a.mov64Imm(r4, unix.BPF_NOEXIST)
+	a.call(helperMapUpdateElem)
+	a.jmpImm(jmpJEQ, r0, 0, "pass")
+	a.jmpImm(jmpJNE, r0, -int32(unix.EEXIST), "drop")
+	p.lookupAndAdd(a, "pass")
+
+	a.label("drop")
+	a.storeImm(sizeDW, rFP, stackDropKey, 0)
+	a.loadMapFD(r1, p.dropsFD)
+	a.mov64(r2, rFP)
+	a.alu64Imm(aluAdd, r2, stackDropKey)
+	a.call(helperMapLookupElem)
+	a.jmpImm(jmpJEQ, r0, 0, "pass")
+	a.mov64Imm(r1, 1)
+	a.atomic64(aluAdd, r0, 0, r1)
+
+	a.label("pass")
+	if p.egress {
+		a.mov64Imm(r0, tcxNext)
+	} else {
+		a.mov64Imm(r0, xdpPass)
+	}
+	a.exit()
+
+	return a.assemble()
+}
+
+// lookupAndAdd emits the lookup of the flow, atomically adding the counters of the packet to it if it
+// exists (and jumping to the given label otherwise)
+func (p programSpec) lookupAndAdd(a *asm, notFound label) {
+	a.loadMapFD(r1, p.flowsFD)
+	a.mov64(r2, rFP)
+	a.alu64Imm(aluAdd, r2, stackKey)
+	a.call(helperMapLookupElem)
+	a.jmpImm(jmpJEQ, r0, 0, notFound)
+
+	a.mov64Imm(r1, 1)
+	a.atomic64(aluAdd, r0, valOffPackets, r1)
+	a.load(sizeDW, r1, rFP, stackVal+valOffBytes)
+	a.atomic64(aluAdd, r0, valOffBytes, r1)
+	a.load(sizeDW, r1, rFP, stackVal+valOffFlags)
+	a.jmpImm(jmpJEQ, r1, 0, "pass")
+	a.atomic64(aluOr, r0, valOffFlags, r1)
+	a.ja("pass")
+}
@@ -0,0 +1,398 @@
+// Package xdp provides a capture source aggregating the flows of an interface in kernel space, allowing
+// to capture high-traffic interfaces without the packet drops / CPU load incurred by copying each packet
+// to userspace via AF_PACKET.
+//
+// An eBPF program attached to the interface via XDP extracts the 5-tuple of each incoming packet and adds
+// it to the counters of its flow in a BPF map (outgoing packets are optionally counted by a program
+// attached via TCX). The map is periodically drained, and the flows are replayed as a series of
+// synthesized packets (c.f. ingest.Replayer), so that they are processed by the regular packet parsing and
+// flow logging. Since the frame length of each packet is accounted (excluding VLAN tags, just like for
+// AF_PACKET), all byte accounting bases are supported.
+//
+// Attaching the programs requires CAP_BPF, CAP_NET_ADMIN and CAP_PERFMON (or CAP_SYS_ADMIN), XDP links
+// require Linux >= 5.9, egress capture via TCX requires Linux >= 6.6.
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/ingest"
+	"github.com/fako1024/slimcap/capture"
+	"github.com/fako1024/slimcap/link"
+	"golang.org/x/sys/unix"
+)
+
+const (
+
+	// DefaultMaxFlows denotes the default capacity of the flow map (i.e. the maximum number of flows
+	// aggregated in between two polls)
+	DefaultMaxFlows = 1 << 16
+
+	// DefaultPollInterval denotes the default interval in which the flow map is drained
+	DefaultPollInterval = time.Second
+
+	// queueSize denotes the number of batches of flows (one per poll) queued for processing
+	queueSize = 16
+)
+
+var _ capture.SourceZeroCopy = &Source{}
+
+var (
+	errUnsupportedLinkType = errors.New("unsupported link type (only Ethernet links are supported)")
+	errInvalidMode         = errors.New("invalid XDP attach mode")
+)
+
+// Mode denotes the mode the XDP program is attached in
+type Mode string
+
+const (
+
+	// ModeAuto attempts to attach the program in native mode, falling back to generic mode if the driver
+	// does not support XDP
+	ModeAuto Mode = ""
+
+	// ModeNative attaches the program to the driver (requires driver support)
+	ModeNative Mode = "native"
+
+	// ModeGeneric attaches the program to the network stack (supported by all drivers, but slower)
+	ModeGeneric Mode = "generic"
+)
+
+// Option denotes a functional option for a Source
+type Option func(*Source)
+
+// WithMode sets the mode the XDP program is attached in
+func WithMode(mode Mode) Option {
+	return func(s *Source) {
+		s.mode = mode
+	}
+}
+
+// WithEgress enables counting outgoing packets (via a program attached via TCX)
+func WithEgress(enable bool) Option {
+	return func(s *Source) {
+		s.egress = enable
+	}
+}
+
+// WithPromiscuous enables promiscuous mode on the interface (for as long as the source is open)
+func WithPromiscuous(enable bool) Option {
+	return func(s *Source) {
+		s.promisc = enable
+	}
+}
+
+// WithIgnoreVLANs skips all VLAN tagged packets
+func WithIgnoreVLANs(enable bool) Option {
+	return func(s *Source) {
+		s.ignoreVLANs = enable
+	}
+}
+
+// WithMaxFlows sets the capacity of the flow map, beyond which the packets of any further flows are
+// dropped until the next poll (the default capacity is retained if zero)
+func WithMaxFlows(maxFlows int) Option {
+	return func(s *Source) {
+		if maxFlows > 0 {
+			s.maxFlows = maxFlows
+		}
+	}
+}
+
+// WithPollInterval sets the interval in which the flow map is drained (the default interval is retained
+// if zero)
+func WithPollInterval(interval time.Duration) Option {
+	return func(s *Source) {
+		if interval > 0 {
+			s.pollInterval = interval
+		}
+	}
+}
+
+// Source denotes a capture source consuming the flows aggregated in kernel space by an eBPF program
+// attached to an interface [fulfils the capture.SourceZeroCopy interface]
+type Source struct {
+	link *link.Link
+
+	mode         Mode
+	egress       bool
+	promisc      bool
+	ignoreVLANs  bool
+	maxFlows     int
+	pollInterval time.Duration
+
+	// File descriptors of the BPF maps / programs / links and the socket enabling promiscuous mode
+	flowsFD, dropsFD int
+	progFDs, linkFDs []int
+	promiscFD        int
+
+	// The flows drained from the flow map are replayed as packets
+	*ingest.Replayer
+	dropped uint64 // packets dropped due to a full flow map (as of the last poll)
+
+	stop      chan struct{}
+	wgPoll    sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewSource instantiates a new source for the interface, attaching the program(s) counting its flows
+func NewSource(iface string, opts ...Option) (s *Source, err error) {
+	s = &Source{
+		maxFlows:     DefaultMaxFlows,
+		pollInterval: DefaultPollInterval,
+		flowsFD:      -1,
+		dropsFD:      -1,
+		promiscFD:    -1,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.mode != ModeAuto && s.mode != ModeNative && s.mode != ModeGeneric {
+		return nil, fmt.Errorf("%w: %s", errInvalidMode, s.mode)
+	}
+
+	if s.link, err = link.New(iface); err != nil {
+		return nil, err
+	}
+	if s.link.Type.IPHeaderOffset() != etherHdrLen {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedLinkType, iface)
+	}
+
+	// Release all resources acquired so far if any step fails
+	defer func() {
+		if err != nil {
+			s.release()
+		}
+	}()
+
+	if s.flowsFD, err = createMap("goprobe_flows", unix.BPF_MAP_TYPE_HASH, keyLen, valLen, uint32(s.maxFlows)); err != nil {
+		return nil, err
+	}
+	if s.dropsFD, err = createMap("goprobe_drops", unix.BPF_MAP_TYPE_ARRAY, 4, 8, 1); err != nil {
+		return nil, err
+	}
+	if err = s.attachIngress(); err != nil {
+		return nil, err
+	}
+	if s.egress {
+		if err = s.attachEgress(); err != nil {
+			return nil, err
+		}
+	}
+	if s.promisc {
+		if err = s.enablePromiscuous(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Replayer = ingest.NewReplayer(queueSize)
+	s.wgPoll.Add(1)
+	go s.poll()
+
+	return s, nil
+}
+
+// attachIngress loads the program counting incoming packets and attaches it via XDP
+func (s *Source) attachIngress() error {
+	insns, err := programSpec{ignoreVLANs: s.ignoreVLANs, flowsFD: s.flowsFD, dropsFD: s.dropsFD}.build()
+	if err != nil {
+		return err
+	}
+	progFD, err := loadProgram("goprobe_xdp", unix.BPF_PROG_TYPE_XDP, unix.BPF_XDP, insns)
+	if err != nil {
+		return err
+	}
+	s.progFDs = append(s.progFDs, progFD)
+
+	var linkFD int
+	switch s.mode {
+	case ModeNative:
+		linkFD, err = createLink(progFD, s.link.Index, unix.BPF_XDP, unix.XDP_FLAGS_DRV_MODE)
+	case ModeGeneric:
+		linkFD, err = createLink(progFD, s.link.Index, unix.BPF_XDP, unix.XDP_FLAGS_SKB_MODE)
+	default:
+		if linkFD, err = createLink(progFD, s.link.Index, unix.BPF_XDP, unix.XDP_FLAGS_DRV_MODE); err != nil {
+			linkFD, err = createLink(progFD, s.link.Index, unix.BPF_XDP, unix.XDP_FLAGS_SKB_MODE)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to attach XDP program to %s: %w", s.link.Name, err)
+	}
+	s.linkFDs = append(s.linkFDs, linkFD)
+
+	return nil
+}
+
+// attachEgress loads the program counting outgoing packets and attaches it via TCX
+func (s *Source) attachEgress() error {
+	insns, err := programSpec{egress: true, ignoreVLANs: s.ignoreVLANs, flowsFD: s.flowsFD, dropsFD: s.dropsFD}.build()
+	if err != nil {
+		return err
+	}
+	progFD, err := loadProgram("goprobe_tcx", unix.BPF_PROG_TYPE_SCHED_CLS, unix.BPF_TCX_EGRESS, insns)
+	if err != nil {
+		return err
+	}
+	s.progFDs = append(s.progFDs, progFD)
+
+	linkFD, err := createLink(progFD, s.link.Index, unix.BPF_TCX_EGRESS, 0)
+	if err != nil {
+		return fmt.Errorf("failed to attach TCX egress program to %s: %w", s.link.Name, err)
+	}
+	s.linkFDs = append(s.linkFDs, linkFD)
+
+	return nil
+}
+
+// enablePromiscuous enables promiscuous mode on the interface via the membership of a packet socket,
+// which does not receive any packets itself (promiscuous mode is disabled by the kernel once the last
+// socket requesting it is closed)
+func (s *Source) enablePromiscuous() (err error) {
+	if s.promiscFD, err = unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0); err != nil {
+		return fmt.Errorf("failed to create socket for promiscuous mode: %w", err)
+	}
+	if err = unix.SetsockoptPacketMreq(s.promiscFD, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &unix.PacketMreq{
+		Ifindex: int32(s.link.Index),
+		Type:    unix.PACKET_MR_PROMISC,
+	}); err != nil {
+		return fmt.Errorf("failed to set promiscuous mode: %w", err)
+	}
+	return nil
+}
+
+// poll drains the flow map in the configured interval until the source is closed
+func (s *Source) poll() {
+	defer s.wgPoll.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.drain()
+		}
+	}
+}
+
+// drain removes all flows from the flow map and hands them to the replayer
+func (s *Source) drain() {
+
+	// Collect the keys first, since deleting flows while iterating the map would restart the iteration
+	var (
+		keys [][keyLen]byte
+		key  [keyLen]byte
+	)
+	for i := 0; i < s.maxFlows; i++ {
+		var cur []byte
+		if i > 0 {
+			cur = key[:]
+		}
+		var next [keyLen]byte
+		if err := mapElemOp(unix.BPF_MAP_GET_NEXT_KEY, s.flowsFD, cur, next[:], 0); err != nil {
+			break
+		}
+		keys = append(keys, next)
+		key = next
+	}
+
+	recs := make([]ingest.Record, 0, len(keys))
+	var val [valLen]byte
+	for i := range keys {
+		if err := mapElemOp(unix.BPF_MAP_LOOKUP_AND_DELETE_ELEM, s.flowsFD, keys[i][:], val[:], 0); err != nil {
+			continue
+		}
+		if rec, ok := decodeFlow(keys[i][:], val[:]); ok {
+			recs = append(recs, rec)
+		}
+	}
+	if len(recs) > 0 {
+		s.Enqueue(recs)
+	}
+
+	// The drop counter is cumulative, hence only its increase is counted
+	var dropKey [4]byte
+	if err := mapElemOp(unix.BPF_MAP_LOOKUP_ELEM, s.dropsFD, dropKey[:], val[:8], 0); err == nil {
+		if dropped := binary.NativeEndian.Uint64(val[:8]); dropped > s.dropped {
+			s.AddDropped(dropped - s.dropped)
+			s.dropped = dropped
+		}
+	}
+}
+
+// decodeFlow decodes a flow from its key and counters in the flow map
+func decodeFlow(key, val []byte) (rec ingest.Record, ok bool) {
+	switch key[keyOffIPVersion] {
+	case 4:
+		rec.SIP = netip.AddrFrom4([4]byte(key[keyOffSIP : keyOffSIP+4]))
+		rec.DIP = netip.AddrFrom4([4]byte(key[keyOffDIP : keyOffDIP+4]))
+	case 6:
+		rec.SIP = netip.AddrFrom16([16]byte(key[keyOffSIP : keyOffSIP+16]))
+		rec.DIP = netip.AddrFrom16([16]byte(key[keyOffDIP : keyOffDIP+16]))
+	default:
+		return
+	}
+	rec.SPort = binary.BigEndian.Uint16(key[keyOffSPort:])
+	rec.DPort = binary.BigEndian.Uint16(key[keyOffDPort:])
+	rec.Protocol = key[keyOffProto]
+	rec.Outbound = key[keyOffDirection] == directionEgress
+	rec.VLAN = binary.BigEndian.Uint16(key[keyOffVLAN:])
+
+	rec.Packets = binary.NativeEndian.Uint64(val[valOffPackets:])
+	rec.Bytes = binary.NativeEndian.Uint64(val[valOffBytes:])
+
+	// The handshake packets observed determine the initiator of the flow (a SYN taking precedence
+	// over a SYN-ACK)
+	flags := binary.NativeEndian.Uint64(val[valOffFlags:])
+	if flags&flagSYN != 0 {
+		rec.TCPFlags = tcpFlagSYN
+	} else if flags&flagSYNACK != 0 {
+		rec.TCPFlags = tcpFlagSYN | tcpFlagACK
+	}
+
+	return rec, rec.Packets > 0
+}
+
+// Link returns the link the source is attached to
+func (s *Source) Link() *link.Link {
+	return s.link
+}
+
+// Close detaches the programs from the interface. Any flows counted until then are still provided by
+// the Next*() methods before they return capture.ErrCaptureStopped
+func (s *Source) Close() (err error) {
+	s.closeOnce.Do(func() {
+		for _, fd := range s.linkFDs {
+			err = errors.Join(err, unix.Close(fd))
+		}
+		s.linkFDs = nil
+
+		close(s.stop)
+		s.wgPoll.Wait()
+		s.drain()
+		s.Stop()
+
+		err = errors.Join(err, s.release())
+	})
+	return
+}
+
+// release closes all file descriptors held by the source
+func (s *Source) release() (err error) {
+	fds := append(append(s.linkFDs, s.progFDs...), s.flowsFD, s.dropsFD, s.promiscFD)
+	for _, fd := range fds {
+		if fd >= 0 {
+			err = errors.Join(err, unix.Close(fd))
+		}
+	}
+	s.linkFDs, s.progFDs = nil, nil
+	s.flowsFD, s.dropsFD, s.promiscFD = -1, -1, -1
+	return
+}
@@ -0,0 +1,168 @@
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/ingest"
+	"github.com/fako1024/slimcap/capture"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// skipIfUnprivileged skips the test if loading BPF programs is not permitted
+func skipIfUnprivileged(t *testing.T, err error) {
+	if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOSYS) {
+		t.Skipf("loading BPF programs not permitted: %s", err)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	a := newAsm()
+	a.mov64Imm(r0, xdpPass)
+	a.jmpImm(jmpJEQ, r0, 0, "out")
+	a.mov64Imm(r0, 0)
+	a.label("out")
+	a.exit()
+
+	raw, err := a.assemble()
+	require.NoError(t, err)
+	require.Len(t, raw, 4*insnSize)
+	require.Equal(t, byte(classJMP|jmpJEQ|srcK), raw[insnSize])
+	require.Equal(t, int16(1), int16(binary.NativeEndian.Uint16(raw[insnSize+2:])))
+
+	a = newAsm()
+	a.ja("missing")
+	_, err = a.assemble()
+	require.ErrorIs(t, err, errUndefinedLabel)
+}
+
+func TestDecodeFlow(t *testing.T) {
+	key, val := make([]byte, keyLen), make([]byte, valLen)
+	copy(key[keyOffSIP:], []byte{10, 0, 0, 1})
+	copy(key[keyOffDIP:], []byte{10, 0, 0, 2})
+	binary.BigEndian.PutUint16(key[keyOffSPort:], 50000)
+	binary.BigEndian.PutUint16(key[keyOffDPort:], 443)
+	key[keyOffProto], key[keyOffIPVersion], key[keyOffDirection] = 6, 4, directionEgress
+	binary.BigEndian.PutUint16(key[keyOffVLAN:], 100)
+	binary.NativeEndian.PutUint64(val[valOffPackets:], 3)
+	binary.NativeEndian.PutUint64(val[valOffBytes:], 180)
+	binary.NativeEndian.PutUint64(val[valOffFlags:], flagSYN|flagSYNACK)
+
+	rec, ok := decodeFlow(key, val)
+	require.True(t, ok)
+	require.Equal(t, ingest.Record{
+		SIP:      netip.MustParseAddr("10.0.0.1"),
+		DIP:      netip.MustParseAddr("10.0.0.2"),
+		SPort:    50000,
+		DPort:    443,
+		Protocol: 6,
+		Packets:  3,
+		Bytes:    180,
+		TCPFlags: tcpFlagSYN,
+		Outbound: true,
+		VLAN:     100,
+	}, rec)
+
+	key[keyOffIPVersion] = 5
+	_, ok = decodeFlow(key, val)
+	require.False(t, ok)
+}
+
+func TestLoadPrograms(t *testing.T) {
+	for _, egress := range []bool{false, true} {
+		for _, ignoreVLANs := range []bool{false, true} {
+			flowsFD, err := createMap("test_flows", unix.BPF_MAP_TYPE_HASH, keyLen, valLen, 16)
+			skipIfUnprivileged(t, err)
+			require.NoError(t, err)
+			dropsFD, err := createMap("test_drops", unix.BPF_MAP_TYPE_ARRAY, 4, 8, 1)
+			require.NoError(t, err)
+
+			insns, err := programSpec{egress: egress, ignoreVLANs: ignoreVLANs, flowsFD: flowsFD, dropsFD: dropsFD}.build()
+			require.NoError(t, err)
+			progType, attachType := uint32(unix.BPF_PROG_TYPE_XDP), uint32(unix.BPF_XDP)
+			if egress {
+				progType, attachType = unix.BPF_PROG_TYPE_SCHED_CLS, unix.BPF_TCX_EGRESS
+			}
+			progFD, err := loadProgram("test", progType, attachType, insns)
+			require.NoError(t, err, "egress: %v, ignoreVLANs: %v", egress, ignoreVLANs)
+
+			for _, fd := range []int{progFD, dropsFD, flowsFD} {
+				require.NoError(t, unix.Close(fd))
+			}
+		}
+	}
+}
+
+func TestCaptureLoopback(t *testing.T) {
+	for _, egress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("egress=%v", egress), func(t *testing.T) {
+			testCaptureLoopback(t, egress)
+		})
+	}
+}
+
+func testCaptureLoopback(t *testing.T, egress bool) {
+	src, err := NewSource("lo", WithMode(ModeGeneric), WithEgress(egress), WithPollInterval(50*time.Millisecond), WithMaxFlows(256))
+	if err != nil {
+		skipIfUnprivileged(t, err)
+		if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skipf("XDP not supported: %s", err)
+		}
+	}
+	require.NoError(t, err)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sender, err := net.DialUDP("udp4", nil, conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer sender.Close()
+
+	const nPackets, payloadLen = 10, 100
+	for i := 0; i < nPackets; i++ {
+		_, err = sender.Write(make([]byte, payloadLen))
+		require.NoError(t, err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, src.Close())
+
+	var (
+		nMatched  [2]int
+		totalSize uint32
+		sport     = uint16(sender.LocalAddr().(*net.UDPAddr).Port)
+		dport     = uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+	)
+	for {
+		ipLayer, pktType, pktSize, err := src.NextIPPacketZeroCopy()
+		if errors.Is(err, capture.ErrCaptureStopped) {
+			break
+		}
+		require.NoError(t, err)
+		if ipLayer.Protocol() != unix.IPPROTO_UDP ||
+			binary.BigEndian.Uint16(ipLayer[20:]) != sport || binary.BigEndian.Uint16(ipLayer[22:]) != dport {
+			continue
+		}
+		if pktType == capture.PacketOutgoing {
+			nMatched[directionEgress]++
+		} else {
+			nMatched[directionIngress]++
+		}
+		totalSize += pktSize
+	}
+
+	// On the loopback interface, each packet is observed in both directions (if enabled) and accounted
+	// with its frame length (Ethernet + IPv4 + UDP headers + payload)
+	expected := [2]int{nPackets, 0}
+	if egress {
+		expected[directionEgress] = nPackets
+	}
+	require.Equal(t, expected, nMatched)
+	require.Equal(t, uint32((expected[0]+expected[1])*(etherHdrLen+20+8+payloadLen)), totalSize)
+}
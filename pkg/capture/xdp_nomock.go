@@ -0,0 +1,13 @@
+//go:build slimcap_nomock
+// +build slimcap_nomock
+
+package capture
+
+import "errors"
+
+var errXDPUnsupported = errors.New("capture via XDP is not supported by builds with the slimcap_nomock tag (restricting the capture source to AF_PACKET)")
+
+// newXDPSource fails since the capture source is restricted to an afring source
+func newXDPSource(_ *Capture) (Source, error) {
+	return nil, errXDPUnsupported
+}
@@ -0,0 +1,82 @@
+//go:build !slimcap_nomock
+// +build !slimcap_nomock
+
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestXDPCapture(t *testing.T) {
+	c := newCapture("lo", config.CaptureConfig{
+		XDP:            &config.XDPConfig{Mode: config.XDPModeGeneric, PollInterval: 50 * time.Millisecond},
+		ByteAccounting: "l3",
+	})
+	if err := c.run(testLocalBufferPool); errors.Is(err, unix.EPERM) || errors.Is(err, unix.EINVAL) {
+		t.Skipf("capture via XDP not supported: %s", err)
+	} else {
+		require.Nil(t, err)
+	}
+	c.process()
+	defer func() {
+		require.Nil(t, c.close())
+	}()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	defer conn.Close()
+	sender, err := net.DialUDP("udp4", nil, conn.LocalAddr().(*net.UDPAddr))
+	require.Nil(t, err)
+	defer sender.Close()
+
+	for i := 0; i < 10; i++ {
+		_, err = sender.Write(make([]byte, 100))
+		require.Nil(t, err)
+	}
+
+	// The packets are accounted on layer 3 (IPv4 + UDP headers + payload), regardless of the direction
+	// the flow is attributed to
+	var keys []types.Key
+	for _, port := range []net.Addr{conn.LocalAddr(), sender.LocalAddr()} {
+		keys = append(keys, types.NewKey([]byte{127, 0, 0, 1}, []byte{127, 0, 0, 1},
+			binary.BigEndian.AppendUint16(nil, uint16(port.(*net.UDPAddr).Port)), unix.IPPROTO_UDP))
+	}
+	require.Eventually(t, func() bool {
+		require.Nil(t, c.capLock.Lock())
+		defer func() {
+			require.Nil(t, c.capLock.Unlock())
+		}()
+
+		agg := c.flowMap(context.Background())
+		if agg == nil {
+			return false
+		}
+		var total types.Counters
+		for it := agg.Iter(); it.Next(); {
+			for _, key := range keys {
+				if string(it.Key()) == string(key) {
+					total.Add(it.Val())
+				}
+			}
+		}
+		return total == types.Counters{BytesRcvd: 1280, PacketsRcvd: 10} ||
+			total == types.Counters{BytesSent: 1280, PacketsSent: 10}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats, err := c.status(context.Background())
+	require.Nil(t, err)
+	require.NotNil(t, stats.Parameters)
+	require.Equal(t, "l3", stats.Parameters.ByteAccounting)
+	require.Zero(t, stats.Parameters.CaptureLength)
+	require.Empty(t, stats.Parameters.BPFFilter)
+}
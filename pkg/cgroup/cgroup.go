@@ -0,0 +1,193 @@
+// Package cgroup detects the resource limits imposed on the running process by its (cgroup v2)
+// control group, e.g. when deployed in a container with memory / CPU limits. Defaults sized for
+// bare metal (such as the number of processing units or buffer sizes) can be derived from them, so
+// that the process stays within its limits instead of being throttled / OOM killed
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	procSelfCgroupPath = "/proc/self/cgroup"
+	cgroupRoot         = "/sys/fs/cgroup"
+
+	memoryMaxFile = "memory.max"
+	cpuMaxFile    = "cpu.max"
+
+	unlimited = "max"
+)
+
+// Limits denotes the resource limits of a control group. A zero value of a limit denotes that the
+// resource is unrestricted (or that no limit could be detected)
+type Limits struct {
+	Path        string  `json:"path" doc:"Path of the (cgroup v2) control group of the process" example:"/kubepods/burstable/pod1234/abcd"`
+	MemoryBytes uint64  `json:"memory_bytes,omitempty" doc:"Memory limit of the control group (in bytes, unlimited if omitted)" example:"2147483648"`
+	CPUs        float64 `json:"cpus,omitempty" doc:"CPU limit of the control group (in fractional CPUs, unlimited if omitted)" example:"1.5"`
+}
+
+// Detected returns whether any resource limit was detected
+func (l Limits) Detected() bool {
+	return l.MemoryBytes > 0 || l.CPUs > 0
+}
+
+// NumCPU returns the number of CPUs usable by the process, i.e. the number of logical CPUs of the
+// host, capped by the (rounded up) CPU limit
+func (l Limits) NumCPU() int {
+	numCPU := runtime.NumCPU()
+	if l.CPUs > 0 {
+		numCPU = min(numCPU, max(1, int(math.Ceil(l.CPUs))))
+	}
+	return numCPU
+}
+
+// Memory returns the memory usable by the process given the physical memory of the host, i.e.
+// the physical memory capped by the memory limit
+func (l Limits) Memory(physMem uint64) uint64 {
+	if l.MemoryBytes > 0 && (physMem == 0 || l.MemoryBytes < physMem) {
+		return l.MemoryBytes
+	}
+	return physMem
+}
+
+var current = sync.OnceValue(func() Limits {
+	limits, err := Detect()
+	if err != nil {
+		return Limits{}
+	}
+	return limits
+})
+
+// Current returns the resource limits of the running process, which are detected only once. If
+// detection fails, no limits are assumed
+func Current() Limits {
+	return current()
+}
+
+// NumCPU returns the number of CPUs usable by the running process (c.f. Limits.NumCPU())
+func NumCPU() int {
+	return Current().NumCPU()
+}
+
+// Detect detects the resource limits of the control group of the running process. If the process
+// is not part of a cgroup v2 hierarchy (e.g. on hosts using cgroup v1 or other operating systems),
+// no limits are returned
+func Detect() (Limits, error) {
+	return detect(procSelfCgroupPath, cgroupRoot)
+}
+
+func detect(procCgroupPath, root string) (Limits, error) {
+	path, err := unifiedPath(procCgroupPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Limits{}, nil
+		}
+		return Limits{}, err
+	}
+	if path == "" {
+		return Limits{}, nil
+	}
+
+	// the effective limits are the tightest ones of the control group and all of its ancestors.
+	// Within a cgroup namespace (as usual for containers), the control group is mounted as root
+	limits := Limits{Path: path}
+	for dir := filepath.Join(root, path); ; dir = filepath.Dir(dir) {
+		memory, err := readMemoryMax(filepath.Join(dir, memoryMaxFile))
+		if err != nil {
+			return Limits{}, err
+		}
+		if memory > 0 && (limits.MemoryBytes == 0 || memory < limits.MemoryBytes) {
+			limits.MemoryBytes = memory
+		}
+
+		cpus, err := readCPUMax(filepath.Join(dir, cpuMaxFile))
+		if err != nil {
+			return Limits{}, err
+		}
+		if cpus > 0 && (limits.CPUs == 0 || cpus < limits.CPUs) {
+			limits.CPUs = cpus
+		}
+
+		if rel, err := filepath.Rel(root, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			break
+		}
+	}
+	return limits, nil
+}
+
+// unifiedPath returns the path of the control group in the unified (cgroup v2) hierarchy
+// ("0::<path>"), if any
+func unifiedPath(procCgroupPath string) (string, error) {
+	f, err := os.Open(filepath.Clean(procCgroupPath))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, found := strings.CutPrefix(scanner.Text(), "0::"); found {
+			return path, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// readMemoryMax reads the memory limit (in bytes) from a memory.max file, returning zero if there
+// is none
+func readMemoryMax(path string) (uint64, error) {
+	data, err := readLimitFile(path)
+	if err != nil || data == "" || data == unlimited {
+		return 0, err
+	}
+	memory, err := strconv.ParseUint(data, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit in %s: %w", path, err)
+	}
+	return memory, nil
+}
+
+// readCPUMax reads the CPU limit (in fractional CPUs) from a cpu.max file ("<quota> <period>"),
+// returning zero if there is none
+func readCPUMax(path string) (float64, error) {
+	data, err := readLimitFile(path)
+	if err != nil || data == "" {
+		return 0, err
+	}
+	quota, period, _ := strings.Cut(data, " ")
+	if quota == unlimited {
+		return 0, nil
+	}
+	quotaUS, err := strconv.ParseUint(quota, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU quota in %s: %w", path, err)
+	}
+	periodUS, err := strconv.ParseUint(period, 10, 64)
+	if err != nil || periodUS == 0 {
+		return 0, fmt.Errorf("invalid CPU period in %s", path)
+	}
+	return float64(quotaUS) / float64(periodUS), nil
+}
+
+// readLimitFile reads a limit file of a control group. Missing files (e.g. if the controller
+// isn't enabled) are treated as empty
+func readLimitFile(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,80 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(t, os.WriteFile(path, []byte(data), 0600))
+}
+
+func TestDetect(t *testing.T) {
+	var tests = []struct {
+		name     string
+		cgroup   string
+		files    map[string]string
+		expected Limits
+	}{
+		{"no cgroup v2", "12:memory:/docker/abcd\n", nil, Limits{}},
+		{"unlimited", "0::/\n", map[string]string{
+			memoryMaxFile: "max\n",
+			cpuMaxFile:    "max 100000\n",
+		}, Limits{Path: "/"}},
+		{"namespaced", "0::/\n", map[string]string{
+			memoryMaxFile: "2147483648\n",
+			cpuMaxFile:    "150000 100000\n",
+		}, Limits{Path: "/", MemoryBytes: 2147483648, CPUs: 1.5}},
+		{"tightest ancestor", "0::/kubepods/pod1/abcd\n", map[string]string{
+			"kubepods/" + memoryMaxFile:           "1073741824",
+			"kubepods/pod1/abcd/" + memoryMaxFile: "2147483648",
+			"kubepods/pod1/" + cpuMaxFile:         "50000 100000",
+			"kubepods/pod1/abcd/" + cpuMaxFile:    "max 100000",
+		}, Limits{Path: "/kubepods/pod1/abcd", MemoryBytes: 1073741824, CPUs: 0.5}},
+		{"missing controllers", "0::/system.slice/goprobe.service\n", nil, Limits{Path: "/system.slice/goprobe.service"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			procCgroupPath, root := filepath.Join(dir, "cgroup"), filepath.Join(dir, "sys")
+			writeFile(t, procCgroupPath, test.cgroup)
+			for name, data := range test.files {
+				writeFile(t, filepath.Join(root, name), data)
+			}
+
+			limits, err := detect(procCgroupPath, root)
+			require.Nil(t, err)
+			require.Equal(t, test.expected, limits)
+		})
+	}
+
+	// hosts without /proc are considered unrestricted
+	limits, err := detect(filepath.Join(t.TempDir(), "missing"), t.TempDir())
+	require.Nil(t, err)
+	require.False(t, limits.Detected())
+
+	// malformed limits are reported
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "cgroup"), "0::/\n")
+	writeFile(t, filepath.Join(dir, "sys", cpuMaxFile), "100000")
+	_, err = detect(filepath.Join(dir, "cgroup"), filepath.Join(dir, "sys"))
+	require.NotNil(t, err)
+}
+
+func TestLimits(t *testing.T) {
+	require.Equal(t, runtime.NumCPU(), Limits{}.NumCPU())
+	require.Equal(t, min(runtime.NumCPU(), 1), Limits{CPUs: 0.5}.NumCPU())
+	require.Equal(t, min(runtime.NumCPU(), 2), Limits{CPUs: 1.5}.NumCPU())
+
+	require.Equal(t, uint64(4096), Limits{}.Memory(4096))
+	require.Equal(t, uint64(1024), Limits{MemoryBytes: 1024}.Memory(4096))
+	require.Equal(t, uint64(4096), Limits{MemoryBytes: 8192}.Memory(4096))
+	require.Equal(t, uint64(1024), Limits{MemoryBytes: 1024}.Memory(0))
+}
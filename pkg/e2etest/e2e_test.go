@@ -56,6 +56,7 @@ var pcaps embed.FS
 
 var defaultCaptureConfig = config.CaptureConfig{
 	Promisc: false,
+	DSCP:    true,
 	RingBuffer: &config.RingBufferConfig{
 		BlockSize: 1048576,
 		NumBlocks: 4,
@@ -535,6 +536,8 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 		},
 		flowsV4: &map[capturetypes.EPHashV4]types.Counters{},
 		flowsV6: &map[capturetypes.EPHashV6]types.Counters{},
+		dscpsV4: map[capturetypes.EPHashV4]map[types.DSCP]struct{}{},
+		dscpsV6: map[capturetypes.EPHashV6]map[types.DSCP]struct{}{},
 		RWMutex: sync.RWMutex{},
 	}
 
@@ -568,6 +571,12 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 			defer res.Unlock()
 
 			pkt = slimcap.NewIPPacket(pkt, payload, pktType, int(totalLen), ipLayerOffset)
+
+			// the traffic volume is accounted on layer 3 by default, i.e. excluding the link-layer header
+			var accountedLen uint64
+			if totalLen > uint32(ipLayerOffset) {
+				accountedLen = uint64(totalLen - uint32(ipLayerOffset))
+			}
 			ipLayer := pkt.IPLayer()
 			res.tracking.nProcessed++
 
@@ -598,12 +607,12 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 					if pkt.Type() != slimcap.PacketOutgoing {
 						flow.Add(types.Counters{
 							PacketsRcvd: 1,
-							BytesRcvd:   uint64(totalLen),
+							BytesRcvd:   accountedLen,
 						})
 					} else {
 						flow.Add(types.Counters{
 							PacketsSent: 1,
-							BytesSent:   uint64(totalLen),
+							BytesSent:   accountedLen,
 						})
 					}
 					(*res.flowsV4)[hash] = flow
@@ -611,12 +620,12 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 					if pkt.Type() != slimcap.PacketOutgoing {
 						flow.Add(types.Counters{
 							PacketsRcvd: 1,
-							BytesRcvd:   uint64(totalLen),
+							BytesRcvd:   accountedLen,
 						})
 					} else {
 						flow.Add(types.Counters{
 							PacketsSent: 1,
-							BytesSent:   uint64(totalLen),
+							BytesSent:   accountedLen,
 						})
 					}
 					(*res.flowsV4)[hashReverse] = flow
@@ -624,15 +633,24 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 					if pkt.Type() != slimcap.PacketOutgoing {
 						(*res.flowsV4)[hash] = types.Counters{
 							PacketsRcvd: 1,
-							BytesRcvd:   uint64(totalLen),
+							BytesRcvd:   accountedLen,
 						}
 					} else {
 						(*res.flowsV4)[hash] = types.Counters{
 							PacketsSent: 1,
-							BytesSent:   uint64(totalLen),
+							BytesSent:   accountedLen,
 						}
 					}
 				}
+
+				// the packets of a flow are stored in one row per distinct DSCP
+				if _, exists := (*res.flowsV4)[hash]; !exists {
+					hash = hashReverse
+				}
+				if res.dscpsV4[hash] == nil {
+					res.dscpsV4[hash] = make(map[types.DSCP]struct{})
+				}
+				res.dscpsV4[hash][types.DSCP(ipLayer[1]>>2)] = struct{}{}
 			} else if ipLayerType == 0x06 {
 				hash, auxInfo, errno := capture.ParsePacketV6(ipLayer)
 				if errno > capturetypes.ErrnoOK {
@@ -660,12 +678,12 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 					if pkt.Type() != slimcap.PacketOutgoing {
 						flow.Add(types.Counters{
 							PacketsRcvd: 1,
-							BytesRcvd:   uint64(totalLen),
+							BytesRcvd:   accountedLen,
 						})
 					} else {
 						flow.Add(types.Counters{
 							PacketsSent: 1,
-							BytesSent:   uint64(totalLen),
+							BytesSent:   accountedLen,
 						})
 					}
 					(*res.flowsV6)[hash] = flow
@@ -673,12 +691,12 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 					if pkt.Type() != slimcap.PacketOutgoing {
 						flow.Add(types.Counters{
 							PacketsRcvd: 1,
-							BytesRcvd:   uint64(totalLen),
+							BytesRcvd:   accountedLen,
 						})
 					} else {
 						flow.Add(types.Counters{
 							PacketsSent: 1,
-							BytesSent:   uint64(totalLen),
+							BytesSent:   accountedLen,
 						})
 					}
 					(*res.flowsV6)[hashReverse] = flow
@@ -686,15 +704,24 @@ func newPcapSource(t testing.TB, name string, data []byte) (res *mockIface) {
 					if pkt.Type() != slimcap.PacketOutgoing {
 						(*res.flowsV6)[hash] = types.Counters{
 							PacketsRcvd: 1,
-							BytesRcvd:   uint64(totalLen),
+							BytesRcvd:   accountedLen,
 						}
 					} else {
 						(*res.flowsV6)[hash] = types.Counters{
 							PacketsSent: 1,
-							BytesSent:   uint64(totalLen),
+							BytesSent:   accountedLen,
 						}
 					}
 				}
+
+				// the packets of a flow are stored in one row per distinct DSCP
+				if _, exists := (*res.flowsV6)[hash]; !exists {
+					hash = hashReverse
+				}
+				if res.dscpsV6[hash] == nil {
+					res.dscpsV6[hash] = make(map[types.DSCP]struct{})
+				}
+				res.dscpsV6[hash][types.DSCP((ipLayer[0]&0x0f)<<2|ipLayer[1]>>6)] = struct{}{}
 			} else {
 				res.tracking.nParsedOrFailed++
 				res.tracking.nErr++
@@ -41,6 +41,8 @@ type mockIface struct {
 	tracking     *mockTracking
 	flowsV4      *map[capturetypes.EPHashV4]types.Counters
 	flowsV6      *map[capturetypes.EPHashV6]types.Counters
+	dscpsV4      map[capturetypes.EPHashV4]map[types.DSCP]struct{}
+	dscpsV6      map[capturetypes.EPHashV6]map[types.DSCP]struct{}
 	sourceInitFn func(c *capture.Capture) (capture.Source, error)
 
 	sync.RWMutex
@@ -187,9 +189,9 @@ func (m mockIfaces) BuildResults(t *testing.T, testDir string, valFilterNode *no
 			}
 			ifaceMetadata[i].Counts.Add(v)
 			if row.Attributes.SrcIP.Is4() && row.Attributes.DstIP.Is4() {
-				ifaceMetadata[i].Traffic.NumV4Entries++
+				ifaceMetadata[i].Traffic.NumV4Entries += uint64(len(iface.dscpsV4[k]))
 			} else {
-				ifaceMetadata[i].Traffic.NumV6Entries++
+				ifaceMetadata[i].Traffic.NumV6Entries += uint64(len(iface.dscpsV4[k]))
 			}
 		}
 
@@ -212,9 +214,9 @@ func (m mockIfaces) BuildResults(t *testing.T, testDir string, valFilterNode *no
 			}
 			ifaceMetadata[i].Counts.Add(v)
 			if row.Attributes.SrcIP.Is4() && row.Attributes.DstIP.Is4() {
-				ifaceMetadata[i].Traffic.NumV4Entries++
+				ifaceMetadata[i].Traffic.NumV4Entries += uint64(len(iface.dscpsV6[k]))
 			} else {
-				ifaceMetadata[i].Traffic.NumV6Entries++
+				ifaceMetadata[i].Traffic.NumV6Entries += uint64(len(iface.dscpsV6[k]))
 			}
 		}
 		iface.RUnlock()
@@ -239,6 +241,9 @@ func (m mockIfaces) BuildResults(t *testing.T, testDir string, valFilterNode *no
 	res.Summary.Last = resGoQuery.Summary.Last
 	res.Summary.Timings = resGoQuery.Summary.Timings
 
+	// All mock interfaces are captured with the default byte accounting
+	res.Summary.ByteAccounting = []string{info.ByteAccountingL3}
+
 	return res, ifaceMetadata
 }
 
@@ -0,0 +1,24 @@
+/*
+Package engine provides a programmatic API for embedding the goDB query engine into other Go
+services, without having to shell out to goQuery or to run the goProbe / global-query API server.
+
+A database is opened once and can then be queried concurrently:
+
+	db, err := engine.OpenDB("/usr/local/goprobe/db")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := db.Query(ctx, query.NewArgs("sip,dip", "eth0",
+		query.WithCondition("dport = 443"),
+		query.WithFirst("-1h"),
+	))
+
+Multiple queries covering the same time range and interfaces (e.g. the sections of a report) can be
+run in a single pass via QueryBatch, which reads and decompresses each block of flow data only once.
+
+The results are returned as *results.Result, i.e. in the same structure goQuery and the API servers
+provide as JSON output.
+*/
+package engine
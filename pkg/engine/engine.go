@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/els0r/goProbe/pkg/goDB/engine"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/workload"
+)
+
+var (
+	// ErrClosed signifies that the database has already been closed
+	ErrClosed = errors.New("database closed")
+
+	// ErrNoArgs signifies that no query arguments were provided
+	ErrNoArgs = errors.New("no query arguments provided")
+)
+
+// DB denotes a goDB opened for querying. It is safe for concurrent use
+type DB struct {
+	path string
+
+	statsCallbacks workload.StatsFuncs
+
+	// queries tracks the queries currently being run, allowing Close() to wait for them
+	queries sync.WaitGroup
+	closed  bool
+	sync.RWMutex
+}
+
+// Option allows to configure the database
+type Option func(*DB)
+
+// WithStatsCallbacks sets callbacks providing feedback on the processing of each query (e.g. the
+// number of blocks / bytes loaded). They will be called in the order they are provided
+func WithStatsCallbacks(callbacks ...workload.StatsFunc) Option {
+	return func(db *DB) {
+		db.statsCallbacks = callbacks
+	}
+}
+
+// OpenDB opens the goDB located at path for querying
+func OpenDB(path string, opts ...Option) (*DB, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("failed to open database: %s is not a directory", path)
+	}
+
+	db := &DB{
+		path: path,
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db, nil
+}
+
+// Path returns the path of the database
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Interfaces returns all interfaces stored in the database
+func (db *DB) Interfaces() ([]string, error) {
+	if err := db.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.queries.Done()
+
+	return info.GetInterfaces(db.path)
+}
+
+// Query runs a query against the database. The results are returned irrespective of the output format
+// specified in args (which may hence be omitted). The args themselves are not modified
+func (db *DB) Query(ctx context.Context, args *query.Args) (*results.Result, error) {
+	if args == nil {
+		return nil, ErrNoArgs
+	}
+	if err := db.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.queries.Done()
+
+	queryArgs := *args
+	if queryArgs.Format == "" {
+		queryArgs.Format = types.FormatJSON
+	}
+
+	// Query runners maintain state during query execution, hence a dedicated one is used for each query
+	return engine.NewQueryRunner(db.path, engine.WithStatsCallbacks(db.statsCallbacks...)).Run(ctx, &queryArgs)
+}
+
+// QueryBatch runs multiple queries covering the same time range and interfaces against the database
+// in a single pass, i.e. each block of flow data is only read and decompressed once. The results are
+// returned in the order of the queries. The args themselves are not modified
+func (db *DB) QueryBatch(ctx context.Context, args []*query.Args) ([]*results.Result, error) {
+	if len(args) == 0 {
+		return nil, ErrNoArgs
+	}
+	if err := db.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.queries.Done()
+
+	batchArgs := make([]*query.Args, len(args))
+	for i, a := range args {
+		if a == nil {
+			return nil, ErrNoArgs
+		}
+		queryArgs := *a
+		if queryArgs.Format == "" {
+			queryArgs.Format = types.FormatJSON
+		}
+		batchArgs[i] = &queryArgs
+	}
+
+	return engine.NewQueryRunner(db.path, engine.WithStatsCallbacks(db.statsCallbacks...)).RunBatch(ctx, batchArgs)
+}
+
+// Close closes the database, waiting for all queries currently being run to complete. Subsequent
+// queries fail with ErrClosed
+func (db *DB) Close() error {
+	db.Lock()
+	if db.closed {
+		db.Unlock()
+		return ErrClosed
+	}
+	db.closed = true
+	db.Unlock()
+
+	db.queries.Wait()
+	return nil
+}
+
+// acquire registers a new query, unless the database has already been closed
+func (db *DB) acquire() error {
+	db.RLock()
+	defer db.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	db.queries.Add(1)
+	return nil
+}
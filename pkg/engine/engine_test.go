@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/goDB/engine"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testDB = "../goDB/engine/testdb"
+
+func newTestArgs() *query.Args {
+	return query.NewArgs("sip,dport", "eth1",
+		query.WithFirst("1456358400"),
+		query.WithLast("1456473000"),
+		query.WithNumResults(10),
+	)
+}
+
+func TestQuery(t *testing.T) {
+	db, err := OpenDB(testDB)
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, db.Close())
+	}()
+
+	ifaces, err := db.Interfaces()
+	require.Nil(t, err)
+	require.Contains(t, ifaces, "eth1")
+
+	res, err := db.Query(context.Background(), newTestArgs())
+	require.Nil(t, err)
+	require.Equal(t, types.StatusOK, res.Status.Code)
+	require.NotEmpty(t, res.Rows)
+
+	// the results are identical to the ones of the query runner used by goQuery
+	args := newTestArgs()
+	args.Format = types.FormatJSON
+	expected, err := engine.NewQueryRunner(testDB).Run(context.Background(), args)
+	require.Nil(t, err)
+	require.Equal(t, expected.Rows, res.Rows)
+	require.Equal(t, expected.Summary.Totals, res.Summary.Totals)
+
+	// queries can be run concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := db.Query(context.Background(), newTestArgs())
+			require.Nil(t, err)
+			require.Equal(t, expected.Rows, res.Rows)
+		}()
+	}
+	wg.Wait()
+
+	_, err = db.Query(context.Background(), nil)
+	require.ErrorIs(t, err, ErrNoArgs)
+	_, err = db.Query(context.Background(), query.NewArgs("sip", "eth1", query.WithCondition("dport = ")))
+	require.NotNil(t, err)
+}
+
+func TestQueryBatch(t *testing.T) {
+	db, err := OpenDB(testDB)
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, db.Close())
+	}()
+
+	dportArgs := newTestArgs()
+	dportArgs.Query = "dport"
+
+	res, err := db.QueryBatch(context.Background(), []*query.Args{newTestArgs(), dportArgs})
+	require.Nil(t, err)
+	require.Len(t, res, 2)
+
+	// the results are identical to the ones of the individual queries
+	for i, args := range []*query.Args{newTestArgs(), dportArgs} {
+		expected, err := db.Query(context.Background(), args)
+		require.Nil(t, err)
+		require.Equal(t, expected.Rows, res[i].Rows)
+	}
+
+	_, err = db.QueryBatch(context.Background(), nil)
+	require.ErrorIs(t, err, ErrNoArgs)
+	_, err = db.QueryBatch(context.Background(), []*query.Args{newTestArgs(), nil})
+	require.ErrorIs(t, err, ErrNoArgs)
+}
+
+func TestClose(t *testing.T) {
+	_, err := OpenDB("/nonexistent/path")
+	require.NotNil(t, err)
+
+	db, err := OpenDB(testDB)
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+	require.ErrorIs(t, db.Close(), ErrClosed)
+
+	_, err = db.Query(context.Background(), newTestArgs())
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = db.Interfaces()
+	require.ErrorIs(t, err, ErrClosed)
+}
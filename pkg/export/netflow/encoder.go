@@ -0,0 +1,277 @@
+package netflow
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+// Information elements used by the templates (the IDs below 128 are shared by NetFlow v9 and IPFIX)
+const (
+	ieOctetDeltaCount          uint16 = 1
+	iePacketDeltaCount         uint16 = 2
+	ieProtocolIdentifier       uint16 = 4
+	ieSourceIPv4Address        uint16 = 8
+	ieDestinationTransportPort uint16 = 11
+	ieDestinationIPv4Address   uint16 = 12
+	ieLastSwitched             uint16 = 21 // NetFlow v9 only (milliseconds of system uptime)
+	ieFirstSwitched            uint16 = 22 // NetFlow v9 only (milliseconds of system uptime)
+	ieSourceIPv6Address        uint16 = 27
+	ieDestinationIPv6Address   uint16 = 28
+	ieFlowDirection            uint16 = 61
+	ieFlowStartSeconds         uint16 = 150 // IPFIX only
+	ieFlowEndSeconds           uint16 = 151 // IPFIX only
+)
+
+const (
+	templateIDIPv4 uint16 = 256
+	templateIDIPv6 uint16 = 257
+
+	templateSetIDV9    uint16 = 0
+	templateSetIDIPFIX uint16 = 2
+
+	headerLenV9    = 20
+	headerLenIPFIX = 16
+	setHeaderLen   = 4
+
+	// flowDirection values (the direction is relative to the interface the flow was captured on)
+	directionIngress byte = 0
+	directionEgress  byte = 1
+)
+
+type field struct {
+	id, length uint16
+}
+
+// template returns the fields of the records of the template (the order of the fields matching the
+// one in which the records are encoded)
+func template(version Version, templateID uint16) []field {
+	ipLen := uint16(types.IPv4Width)
+	sipID, dipID := ieSourceIPv4Address, ieDestinationIPv4Address
+	if templateID == templateIDIPv6 {
+		ipLen = uint16(types.IPv6Width)
+		sipID, dipID = ieSourceIPv6Address, ieDestinationIPv6Address
+	}
+	startID, endID := ieFlowStartSeconds, ieFlowEndSeconds
+	if version == V9 {
+		startID, endID = ieFirstSwitched, ieLastSwitched
+	}
+
+	return []field{
+		{sipID, ipLen},
+		{dipID, ipLen},
+		{ieDestinationTransportPort, 2},
+		{ieProtocolIdentifier, 1},
+		{ieFlowDirection, 1},
+		{ieOctetDeltaCount, 8},
+		{iePacketDeltaCount, 8},
+		{startID, 4},
+		{endID, 4},
+	}
+}
+
+// encoder encodes flows into NetFlow v9 / IPFIX messages on behalf of a single observation domain
+// (i.e. interface), maintaining its sequence number across exports
+type encoder struct {
+	version        Version
+	domainID       uint32
+	maxMessageSize int
+
+	// reference of the system uptime (NetFlow v9 only)
+	bootTime time.Time
+
+	// timestamp of the last export, denoting the start of the flows of the next one
+	lastExport time.Time
+
+	// sequence number of the next message: the number of data records exported so far (IPFIX) or the
+	// number of messages exported so far (NetFlow v9)
+	seq uint32
+
+	buf        []byte
+	setStart   int // offset of the set currently written to (negative if there is none)
+	setID      uint16
+	numRecords int // number of (template and data) records in the current message
+	numData    int // number of data records in the current message
+}
+
+func newEncoder(version Version, domainID uint32, maxMessageSize int, bootTime time.Time) *encoder {
+	return &encoder{
+		version:        version,
+		domainID:       domainID,
+		maxMessageSize: maxMessageSize,
+		bootTime:       bootTime,
+		buf:            make([]byte, 0, maxMessageSize),
+	}
+}
+
+// encode encodes the flows of m, covering the interval [from, to), and calls emit for each message. The
+// templates are included in the first message. The buffer passed to emit is only valid for the duration
+// of the call. It returns the number of data records encoded
+func (e *encoder) encode(m *hashmap.AggFlowMap, from, to, exportTime time.Time, emit func([]byte) error) (int, error) {
+	var (
+		start, end = e.timestamps(from, to)
+		rec        [2*types.IPv6Width + 2 + 1 + 1 + 8 + 8 + 4 + 4]byte
+		numRecords int
+	)
+
+	e.reset()
+	e.writeTemplates()
+
+	if m != nil {
+		for it := m.Iter(); it.Next(); {
+			key, val := types.Key(it.Key()), it.Val()
+			templateID := templateIDIPv6
+			if key.IsIPv4() {
+				templateID = templateIDIPv4
+			}
+
+			for _, dir := range []struct {
+				direction      byte
+				bytes, packets uint64
+			}{
+				{directionIngress, val.BytesRcvd, val.PacketsRcvd},
+				{directionEgress, val.BytesSent, val.PacketsSent},
+			} {
+				if dir.bytes == 0 && dir.packets == 0 {
+					continue
+				}
+
+				r := rec[:0]
+				r = append(r, key.GetSIP()...)
+				r = append(r, key.GetDIP()...)
+				r = append(r, key.GetDport()...)
+				r = append(r, key.GetProto(), dir.direction)
+				r = binary.BigEndian.AppendUint64(r, dir.bytes)
+				r = binary.BigEndian.AppendUint64(r, dir.packets)
+				r = binary.BigEndian.AppendUint32(r, start)
+				r = binary.BigEndian.AppendUint32(r, end)
+
+				if err := e.writeRecord(templateID, r, exportTime, emit); err != nil {
+					return numRecords, err
+				}
+				numRecords++
+			}
+		}
+	}
+
+	return numRecords, e.flush(exportTime, emit)
+}
+
+// timestamps returns the encoded start / end of the flows
+func (e *encoder) timestamps(from, to time.Time) (uint32, uint32) {
+	if e.version == IPFIX {
+		return uint32(from.Unix()), uint32(to.Unix())
+	}
+	return e.uptime(from), e.uptime(to)
+}
+
+// uptime returns the milliseconds elapsed between the reference of the system uptime and t (zero if t
+// precedes it)
+func (e *encoder) uptime(t time.Time) uint32 {
+	return uint32(max(t.Sub(e.bootTime).Milliseconds(), 0))
+}
+
+func (e *encoder) reset() {
+	headerLen := headerLenIPFIX
+	if e.version == V9 {
+		headerLen = headerLenV9
+	}
+	e.buf = e.buf[:headerLen] // the header is written upon flush
+	e.setStart = -1
+	e.numRecords, e.numData = 0, 0
+}
+
+func (e *encoder) writeTemplates() {
+	setID := templateSetIDIPFIX
+	if e.version == V9 {
+		setID = templateSetIDV9
+	}
+
+	e.openSet(setID)
+	for _, templateID := range []uint16{templateIDIPv4, templateIDIPv6} {
+		fields := template(e.version, templateID)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, templateID)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(len(fields)))
+		for _, f := range fields {
+			e.buf = binary.BigEndian.AppendUint16(e.buf, f.id)
+			e.buf = binary.BigEndian.AppendUint16(e.buf, f.length)
+		}
+		e.numRecords++
+	}
+	e.closeSet()
+}
+
+// writeRecord adds a data record to the current message, emitting the message first if the record
+// does not fit
+func (e *encoder) writeRecord(templateID uint16, rec []byte, exportTime time.Time, emit func([]byte) error) error {
+	required := len(rec) + 3 // accounting for the padding of the set (NetFlow v9)
+	if e.setStart < 0 || e.setID != templateID {
+		required += setHeaderLen
+	}
+	if len(e.buf)+required > e.maxMessageSize && e.numRecords > 0 {
+		if err := e.flush(exportTime, emit); err != nil {
+			return err
+		}
+		e.reset()
+	}
+
+	if e.setStart < 0 || e.setID != templateID {
+		e.closeSet()
+		e.openSet(templateID)
+	}
+	e.buf = append(e.buf, rec...)
+	e.numRecords++
+	e.numData++
+
+	return nil
+}
+
+func (e *encoder) openSet(setID uint16) {
+	e.setStart, e.setID = len(e.buf), setID
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(e.buf[e.setStart:], setID)
+}
+
+// closeSet completes the header of the current set (if any). NetFlow v9 sets are padded to a multiple
+// of four bytes
+func (e *encoder) closeSet() {
+	if e.setStart < 0 {
+		return
+	}
+	if e.version == V9 {
+		for (len(e.buf)-e.setStart)%4 != 0 {
+			e.buf = append(e.buf, 0)
+		}
+	}
+	binary.BigEndian.PutUint16(e.buf[e.setStart+2:], uint16(len(e.buf)-e.setStart))
+	e.setStart = -1
+}
+
+// flush completes the header of the current message and emits it (unless it is empty)
+func (e *encoder) flush(exportTime time.Time, emit func([]byte) error) error {
+	e.closeSet()
+	if e.numRecords == 0 {
+		return nil
+	}
+
+	binary.BigEndian.PutUint16(e.buf[0:], uint16(e.version))
+	if e.version == V9 {
+		binary.BigEndian.PutUint16(e.buf[2:], uint16(e.numRecords))
+		binary.BigEndian.PutUint32(e.buf[4:], e.uptime(exportTime))
+		binary.BigEndian.PutUint32(e.buf[8:], uint32(exportTime.Unix()))
+		binary.BigEndian.PutUint32(e.buf[12:], e.seq)
+		binary.BigEndian.PutUint32(e.buf[16:], e.domainID)
+		e.seq++
+	} else {
+		binary.BigEndian.PutUint16(e.buf[2:], uint16(len(e.buf)))
+		binary.BigEndian.PutUint32(e.buf[4:], uint32(exportTime.Unix()))
+		binary.BigEndian.PutUint32(e.buf[8:], e.seq)
+		binary.BigEndian.PutUint32(e.buf[12:], e.domainID)
+		e.seq += uint32(e.numData)
+	}
+
+	e.numRecords, e.numData = 0, 0
+	return emit(e.buf)
+}
@@ -0,0 +1,37 @@
+package netflow
+
+import (
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const netflowSubsystem = "netflow"
+
+var recordsExported = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: netflowSubsystem,
+	Name:      "records_exported_total",
+	Help:      "Total number of NetFlow / IPFIX data records exported",
+})
+
+var messagesExported = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: netflowSubsystem,
+	Name:      "messages_exported_total",
+	Help:      "Total number of NetFlow / IPFIX messages sent to the collector",
+})
+
+var exportErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: netflowSubsystem,
+	Name:      "export_errors_total",
+	Help:      "Total number of interface writeouts whose export to the collector failed",
+})
+
+func init() {
+	prometheus.MustRegister(
+		recordsExported,
+		messagesExported,
+		exportErrors,
+	)
+}
@@ -0,0 +1,158 @@
+// Package netflow exports the flows of goProbe's writeouts as NetFlow v9 / IPFIX records to a collector,
+// allowing to feed existing flow pipelines.
+//
+// Since goProbe aggregates flows across source ports and directions, each flow is exported as (up to)
+// two records: one for the traffic received on the interface (flowDirection ingress) and one for the
+// traffic sent (flowDirection egress). The source port is not exported. The start / end of the records
+// denote the interval covered by the writeout. Each interface constitutes its own observation domain,
+// identified by its interface index (or a hash of its name if the interface does not exist).
+package netflow
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+// Version denotes the export protocol version
+type Version uint16
+
+const (
+	// V9 denotes NetFlow v9 (RFC 3954)
+	V9 Version = 9
+	// IPFIX denotes IPFIX (RFC 7011), i.e. NetFlow v10
+	IPFIX Version = 10
+)
+
+// DefaultMaxMessageSize denotes the default maximum size of a message, fitting into a single UDP
+// datagram on common paths without fragmentation
+const DefaultMaxMessageSize = 1400
+
+// minMessageSize denotes the minimum size of a message, fitting the header and the templates
+const minMessageSize = 256
+
+var errUnsupportedVersion = errors.New("unsupported NetFlow version (supported: 9, 10)")
+
+// Option denotes a functional option for an Exporter
+type Option func(*Exporter)
+
+// WithVersion sets the export protocol version (IPFIX is retained if zero)
+func WithVersion(version Version) Option {
+	return func(e *Exporter) {
+		if version != 0 {
+			e.version = version
+		}
+	}
+}
+
+// WithInterval sets the interval between two exports of an interface, bounding the start of the flows of
+// its first export (or the first one after an outage). Defaults to the writeout interval of the DB
+func WithInterval(interval time.Duration) Option {
+	return func(e *Exporter) {
+		if interval > 0 {
+			e.interval = interval
+		}
+	}
+}
+
+// WithMaxMessageSize sets the maximum size of a message (the default size is retained if zero)
+func WithMaxMessageSize(size int) Option {
+	return func(e *Exporter) {
+		if size > 0 {
+			e.maxMessageSize = max(size, minMessageSize)
+		}
+	}
+}
+
+// Exporter exports flows as NetFlow v9 / IPFIX records to a collector via UDP
+type Exporter struct {
+	conn           net.Conn
+	version        Version
+	maxMessageSize int
+	interval       time.Duration
+	bootTime       time.Time
+
+	encoders map[string]*encoder
+
+	sync.Mutex
+}
+
+// New instantiates a new exporter sending to the collector (host:port)
+func New(collector string, opts ...Option) (*Exporter, error) {
+	e := &Exporter{
+		version:        IPFIX,
+		maxMessageSize: DefaultMaxMessageSize,
+		interval:       time.Duration(goDB.DBWriteInterval) * time.Second,
+		bootTime:       time.Now(),
+		encoders:       make(map[string]*encoder),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.version != V9 && e.version != IPFIX {
+		return nil, fmt.Errorf("%w: %d", errUnsupportedVersion, e.version)
+	}
+
+	conn, err := net.Dial("udp", collector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up connection to collector %s: %w", collector, err)
+	}
+	e.conn = conn
+
+	return e, nil
+}
+
+// Export sends the flows of a writeout of the interface at timestamp to the collector. The flows are
+// considered to have started upon the previous export of the interface
+func (e *Exporter) Export(iface string, m *hashmap.AggFlowMap, timestamp time.Time) error {
+	e.Lock()
+	defer e.Unlock()
+
+	enc, exists := e.encoders[iface]
+	if !exists {
+		enc = newEncoder(e.version, observationDomainID(iface), e.maxMessageSize, e.bootTime)
+		e.encoders[iface] = enc
+	}
+
+	from := timestamp.Add(-e.interval)
+	if enc.lastExport.After(from) {
+		from = enc.lastExport
+	}
+	enc.lastExport = timestamp
+
+	numRecords, err := enc.encode(m, from, timestamp, time.Now(), func(msg []byte) error {
+		if _, err := e.conn.Write(msg); err != nil {
+			return err
+		}
+		messagesExported.Inc()
+		return nil
+	})
+	recordsExported.Add(float64(numRecords))
+	if err != nil {
+		exportErrors.Inc()
+		return fmt.Errorf("failed to export flows of %s: %w", iface, err)
+	}
+
+	return nil
+}
+
+// Close closes the connection to the collector
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+// observationDomainID returns the ID of the observation domain of an interface
+func observationDomainID(iface string) uint32 {
+	if netIface, err := net.InterfaceByName(iface); err == nil {
+		return uint32(netIface.Index)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(iface))
+	return h.Sum32()
+}
@@ -0,0 +1,172 @@
+package netflow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+type testSet struct {
+	id   uint16
+	data []byte
+}
+
+// decodeSets splits a message into its sets, verifying their lengths
+func decodeSets(t *testing.T, msg []byte, headerLen int) (sets []testSet) {
+	for pos := headerLen; pos < len(msg); {
+		require.GreaterOrEqual(t, len(msg)-pos, setHeaderLen)
+		length := int(binary.BigEndian.Uint16(msg[pos+2:]))
+		require.GreaterOrEqual(t, length, setHeaderLen)
+		require.LessOrEqual(t, pos+length, len(msg))
+		sets = append(sets, testSet{id: binary.BigEndian.Uint16(msg[pos:]), data: msg[pos+setHeaderLen : pos+length]})
+		pos += length
+	}
+	return
+}
+
+func newTestMap(numFlows int) *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	for i := 0; i < numFlows; i++ {
+		sip := netip.MustParseAddr(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		key := types.NewKey(sip.AsSlice(), []byte{10, 1, 0, 1}, []byte{0x01, 0xbb}, 6)
+		m.SetOrUpdate(key, true, 1000, 0, 10, 0)
+	}
+	return m
+}
+
+func TestEncodeIPFIX(t *testing.T) {
+	m := hashmap.NewAggFlowMap()
+	for _, flow := range []struct {
+		sip, dip           string
+		bytesRcvd, bytesSt uint64
+	}{
+		{"10.0.0.1", "10.0.0.2", 1000, 500},
+		{"10.0.0.3", "10.0.0.2", 0, 200},
+		{"2001:db8::1", "2001:db8::2", 300, 0},
+	} {
+		sip, dip := netip.MustParseAddr(flow.sip), netip.MustParseAddr(flow.dip)
+		key := types.NewKey(sip.AsSlice(), dip.AsSlice(), []byte{0x01, 0xbb}, 6)
+		m.SetOrUpdate(key, sip.Is4(), flow.bytesRcvd, flow.bytesSt, min(flow.bytesRcvd, 1), min(flow.bytesSt, 1))
+	}
+
+	to := time.Unix(1700000300, 0)
+	from := to.Add(-5 * time.Minute)
+	enc := newEncoder(IPFIX, 42, DefaultMaxMessageSize, time.Now())
+
+	var msgs [][]byte
+	emit := func(msg []byte) error {
+		msgs = append(msgs, append([]byte(nil), msg...))
+		return nil
+	}
+
+	n, err := enc.encode(m, from, to, to, emit)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.Len(t, msgs, 1)
+
+	msg := msgs[0]
+	require.Equal(t, uint16(IPFIX), binary.BigEndian.Uint16(msg[0:]))
+	require.Equal(t, len(msg), int(binary.BigEndian.Uint16(msg[2:])))
+	require.Equal(t, uint32(to.Unix()), binary.BigEndian.Uint32(msg[4:]))
+	require.Zero(t, binary.BigEndian.Uint32(msg[8:]))
+	require.Equal(t, uint32(42), binary.BigEndian.Uint32(msg[12:]))
+
+	sets := decodeSets(t, msg, headerLenIPFIX)
+	require.Len(t, sets, 3)
+	require.Equal(t, templateSetIDIPFIX, sets[0].id)
+	require.Equal(t, templateIDIPv4, binary.BigEndian.Uint16(sets[0].data[0:]))
+	require.Equal(t, uint16(len(template(IPFIX, templateIDIPv4))), binary.BigEndian.Uint16(sets[0].data[2:]))
+
+	const recLenIPv4, recLenIPv6 = 36, 60
+	require.Equal(t, templateIDIPv4, sets[1].id)
+	require.Len(t, sets[1].data, 3*recLenIPv4)
+	require.Equal(t, templateIDIPv6, sets[2].id)
+	require.Len(t, sets[2].data, recLenIPv6)
+
+	// verify the record of the IPv6 flow
+	rec := sets[2].data
+	require.Equal(t, netip.MustParseAddr("2001:db8::1").AsSlice(), rec[0:16])
+	require.Equal(t, netip.MustParseAddr("2001:db8::2").AsSlice(), rec[16:32])
+	require.Equal(t, uint16(443), binary.BigEndian.Uint16(rec[32:]))
+	require.Equal(t, byte(6), rec[34])
+	require.Equal(t, directionIngress, rec[35])
+	require.Equal(t, uint64(300), binary.BigEndian.Uint64(rec[36:]))
+	require.Equal(t, uint64(1), binary.BigEndian.Uint64(rec[44:]))
+	require.Equal(t, uint32(from.Unix()), binary.BigEndian.Uint32(rec[52:]))
+	require.Equal(t, uint32(to.Unix()), binary.BigEndian.Uint32(rec[56:]))
+
+	// the sequence number counts the data records exported before the message
+	msgs = nil
+	_, err = enc.encode(m, from, to, to, emit)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, uint32(4), binary.BigEndian.Uint32(msgs[0][8:]))
+}
+
+func TestEncodeV9Split(t *testing.T) {
+	const maxSize, numFlows = 256, 50
+
+	enc := newEncoder(V9, 1, maxSize, time.Now().Add(-time.Hour))
+	var msgs [][]byte
+	n, err := enc.encode(newTestMap(numFlows), time.Now().Add(-5*time.Minute), time.Now(), time.Now(), func(msg []byte) error {
+		msgs = append(msgs, append([]byte(nil), msg...))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, numFlows, n)
+	require.Greater(t, len(msgs), 1)
+
+	numRecords := 0
+	for i, msg := range msgs {
+		require.LessOrEqual(t, len(msg), maxSize)
+		require.Equal(t, uint16(V9), binary.BigEndian.Uint16(msg[0:]))
+		require.Equal(t, uint32(i), binary.BigEndian.Uint32(msg[12:]))
+
+		count := int(binary.BigEndian.Uint16(msg[2:]))
+		for j, set := range decodeSets(t, msg, headerLenV9) {
+			require.Zero(t, (len(set.data)+setHeaderLen)%4)
+
+			// the templates are only sent in the first message
+			if i == 0 && j == 0 {
+				require.Equal(t, templateSetIDV9, set.id)
+				count -= 2
+				continue
+			}
+			require.Equal(t, templateIDIPv4, set.id)
+			require.Equal(t, count, len(set.data)/36)
+		}
+		numRecords += count
+	}
+	require.Equal(t, numFlows, numRecords)
+}
+
+func TestExporter(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = New(conn.LocalAddr().String(), WithVersion(5))
+	require.ErrorIs(t, err, errUnsupportedVersion)
+
+	exporter, err := New(conn.LocalAddr().String(), WithVersion(V9))
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	require.NoError(t, exporter.Export("eth0", newTestMap(10), time.Now()))
+
+	buf := make([]byte, 65535)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint16(V9), binary.BigEndian.Uint16(buf[0:]))
+	require.Equal(t, uint16(12), binary.BigEndian.Uint16(buf[2:]))
+	require.Equal(t, observationDomainID("eth0"), binary.BigEndian.Uint32(buf[16:]))
+	require.Len(t, decodeSets(t, buf[:n], headerLenV9), 2)
+}
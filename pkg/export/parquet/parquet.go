@@ -0,0 +1,496 @@
+// Package parquet implements a minimal writer of Apache Parquet files, covering flat tables of required
+// (non-nullable) columns of primitive types. The values of each column of a row group are stored in a
+// single PLAIN encoded data page (optionally compressed via ZSTD), which can be read by all common
+// Parquet readers (e.g. Spark, DuckDB, ClickHouse, pandas / pyarrow).
+//
+// The file layout is documented at https://parquet.apache.org/docs/file-format/
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultRowGroupSize denotes the default number of rows per row group
+const DefaultRowGroupSize = 128 * 1024
+
+const (
+	magic = "PAR1"
+
+	formatVersion = 1
+	createdBy     = "goProbe"
+)
+
+// Physical types, encodings, codecs and converted types (c.f. parquet.thrift)
+const (
+	physicalInt32     int32 = 1
+	physicalInt64     int32 = 2
+	physicalDouble    int32 = 5
+	physicalByteArray int32 = 6
+
+	repetitionRequired int32 = 0
+
+	convertedUTF8            int32 = 0
+	convertedTimestampMillis int32 = 9
+	convertedUint8           int32 = 11
+	convertedUint16          int32 = 12
+	convertedUint64          int32 = 14
+
+	encodingPlain int32 = 0
+	encodingRLE   int32 = 3
+
+	pageTypeData int32 = 0
+)
+
+// Type denotes the (logical) type of a column
+type Type int
+
+// Column types
+const (
+	String    Type = iota // String denotes a UTF-8 string (provided as string)
+	Int64                 // Int64 denotes a signed 64-bit integer (provided as int64)
+	Uint64                // Uint64 denotes an unsigned 64-bit integer (provided as uint64)
+	Uint16                // Uint16 denotes an unsigned 16-bit integer (provided as uint16)
+	Uint8                 // Uint8 denotes an unsigned 8-bit integer (provided as uint8)
+	Double                // Double denotes a double precision floating point number (provided as float64)
+	Timestamp             // Timestamp denotes a point in time, stored with millisecond precision (provided as time.Time)
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int64:
+		return "int64"
+	case Uint64:
+		return "uint64"
+	case Uint16:
+		return "uint16"
+	case Uint8:
+		return "uint8"
+	case Double:
+		return "double"
+	case Timestamp:
+		return "timestamp"
+	}
+	return "unknown"
+}
+
+// physical returns the physical type and the converted type (if any) of the column type
+func (t Type) physical() (physicalType int32, convertedType int32, hasConverted bool) {
+	switch t {
+	case String:
+		return physicalByteArray, convertedUTF8, true
+	case Uint64:
+		return physicalInt64, convertedUint64, true
+	case Uint16:
+		return physicalInt32, convertedUint16, true
+	case Uint8:
+		return physicalInt32, convertedUint8, true
+	case Double:
+		return physicalDouble, 0, false
+	case Timestamp:
+		return physicalInt64, convertedTimestampMillis, true
+	}
+	return physicalInt64, 0, false
+}
+
+// Column denotes a column of a Parquet file
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Codec denotes the compression codec applied to the data pages
+type Codec int32
+
+// Compression codecs
+const (
+	Uncompressed Codec = 0
+	ZSTD         Codec = 6
+)
+
+var (
+	// ErrColumnCount denotes that a row does not provide a value for each column
+	ErrColumnCount = errors.New("number of values does not match number of columns")
+
+	// ErrValueType denotes that a value does not match the type of its column
+	ErrValueType = errors.New("value does not match column type")
+
+	// ErrClosed denotes that the writer has already been closed
+	ErrClosed = errors.New("writer closed")
+)
+
+// Option configures a Writer
+type Option func(*Writer)
+
+// WithRowGroupSize sets the (maximum) number of rows per row group (defaults to DefaultRowGroupSize)
+func WithRowGroupSize(n int) Option {
+	return func(w *Writer) {
+		if n > 0 {
+			w.rowGroupSize = n
+		}
+	}
+}
+
+// WithCodec sets the compression codec of the data pages (defaults to ZSTD)
+func WithCodec(codec Codec) Option {
+	return func(w *Writer) {
+		w.codec = codec
+	}
+}
+
+// Writer writes rows to a Parquet file. Rows are buffered until a row group is complete, the file
+// metadata (footer) is written upon Close()
+type Writer struct {
+	output  *countingWriter
+	columns []Column
+
+	rowGroupSize int
+	codec        Codec
+	encoder      *zstd.Encoder
+
+	// buffered (PLAIN encoded) values of the current row group, per column
+	values  []bytes.Buffer
+	numRows int
+
+	rowGroups []rowGroup
+	metadata  [][2]string
+	closed    bool
+}
+
+type rowGroup struct {
+	chunks         []columnChunk
+	numRows        int
+	totalByteSize  int64
+	fileOffset     int64
+	compressedSize int64
+}
+
+type columnChunk struct {
+	dataPageOffset   int64
+	numValues        int
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewWriter instantiates a new writer of a Parquet file holding the given columns. Nothing is written
+// to w until the first row group is complete (or the writer is closed)
+func NewWriter(w io.Writer, columns []Column, opts ...Option) *Writer {
+	pw := &Writer{
+		output:       &countingWriter{w: w},
+		columns:      columns,
+		rowGroupSize: DefaultRowGroupSize,
+		codec:        ZSTD,
+		values:       make([]bytes.Buffer, len(columns)),
+	}
+	for _, opt := range opts {
+		opt(pw)
+	}
+	return pw
+}
+
+// SetMetadata adds a key / value pair to the metadata of the file (written upon Close())
+func (w *Writer) SetMetadata(key, value string) {
+	w.metadata = append(w.metadata, [2]string{key, value})
+}
+
+// NumRows returns the number of rows written so far
+func (w *Writer) NumRows() (n int) {
+	for _, rg := range w.rowGroups {
+		n += rg.numRows
+	}
+	return n + w.numRows
+}
+
+// WriteRow appends a row, providing one value per column (of the Go type stated by the column type)
+func (w *Writer) WriteRow(values ...any) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("%w: %d values, %d columns", ErrColumnCount, len(values), len(w.columns))
+	}
+
+	for i, value := range values {
+		if err := appendValue(&w.values[i], w.columns[i].Type, value); err != nil {
+			for j := 0; j < i; j++ {
+				w.values[j].Truncate(w.values[j].Len() - valueLen(w.columns[j].Type, values[j]))
+			}
+			return fmt.Errorf("column %s: %w", w.columns[i].Name, err)
+		}
+	}
+
+	w.numRows++
+	if w.numRows >= w.rowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes all buffered rows and the file metadata. It does not close the underlying writer
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.numRows > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.closed = true
+	if w.encoder != nil {
+		defer w.encoder.Close()
+	}
+
+	if err := w.writeMagic(); err != nil {
+		return err
+	}
+	footer := w.fileMetadata()
+	if _, err := w.output.Write(footer); err != nil {
+		return err
+	}
+	if _, err := w.output.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.output, magic)
+	return err
+}
+
+func (w *Writer) writeMagic() error {
+	if w.output.n > 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.output, magic)
+	return err
+}
+
+// flush writes the buffered rows as row group (one data page per column)
+func (w *Writer) flush() error {
+	if err := w.writeMagic(); err != nil {
+		return err
+	}
+
+	rg := rowGroup{
+		chunks:     make([]columnChunk, len(w.columns)),
+		numRows:    w.numRows,
+		fileOffset: w.output.n,
+	}
+	for i := range w.columns {
+		data := w.values[i].Bytes()
+		page, err := w.compress(data)
+		if err != nil {
+			return err
+		}
+
+		header := pageHeader(len(data), len(page), w.numRows)
+		chunk := columnChunk{
+			dataPageOffset:   w.output.n,
+			numValues:        w.numRows,
+			uncompressedSize: int64(len(header) + len(data)),
+			compressedSize:   int64(len(header) + len(page)),
+		}
+		if _, err := w.output.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.output.Write(page); err != nil {
+			return err
+		}
+
+		rg.chunks[i] = chunk
+		rg.totalByteSize += chunk.uncompressedSize
+		rg.compressedSize += chunk.compressedSize
+		w.values[i].Reset()
+	}
+
+	w.rowGroups = append(w.rowGroups, rg)
+	w.numRows = 0
+	return nil
+}
+
+func (w *Writer) compress(data []byte) ([]byte, error) {
+	if w.codec != ZSTD {
+		return data, nil
+	}
+	if w.encoder == nil {
+		var err error
+		if w.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1)); err != nil {
+			return nil, fmt.Errorf("compression context init failed: %w", err)
+		}
+	}
+	return w.encoder.EncodeAll(data, nil), nil
+}
+
+func appendValue(buf *bytes.Buffer, t Type, value any) error {
+	var scratch [8]byte
+	switch t {
+	case String:
+		v, ok := value.(string)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(scratch[:0], uint32(len(v))))
+		buf.WriteString(v)
+	case Int64:
+		v, ok := value.(int64)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(scratch[:0], uint64(v)))
+	case Uint64:
+		v, ok := value.(uint64)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(scratch[:0], v))
+	case Uint16:
+		v, ok := value.(uint16)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(scratch[:0], uint32(v)))
+	case Uint8:
+		v, ok := value.(uint8)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(scratch[:0], uint32(v)))
+	case Double:
+		v, ok := value.(float64)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(scratch[:0], math.Float64bits(v)))
+	case Timestamp:
+		v, ok := value.(time.Time)
+		if !ok {
+			return typeError(t, value)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(scratch[:0], uint64(v.UnixMilli())))
+	default:
+		return typeError(t, value)
+	}
+	return nil
+}
+
+// valueLen returns the size of a (valid) PLAIN encoded value
+func valueLen(t Type, value any) int {
+	switch t {
+	case String:
+		return 4 + len(value.(string))
+	case Uint16, Uint8:
+		return 4
+	}
+	return 8
+}
+
+func typeError(t Type, value any) error {
+	return fmt.Errorf("%w: %T provided for %s column", ErrValueType, value, t)
+}
+
+// pageHeader serializes the header of a PLAIN encoded data page of a required column (holding neither
+// repetition nor definition levels)
+func pageHeader(uncompressedSize, compressedSize, numValues int) []byte {
+	t := &thriftWriter{}
+	t.structBegin()
+	t.i32(1, pageTypeData)
+	t.i32(2, int32(uncompressedSize))
+	t.i32(3, int32(compressedSize))
+	t.structField(5)
+	t.i32(1, int32(numValues))
+	t.i32(2, encodingPlain)
+	t.i32(3, encodingRLE)
+	t.i32(4, encodingRLE)
+	t.structEnd()
+	t.structEnd()
+	return t.buf
+}
+
+// fileMetadata serializes the FileMetaData struct (footer) of the file
+func (w *Writer) fileMetadata() []byte {
+	t := &thriftWriter{}
+	t.structBegin()
+	t.i32(1, formatVersion)
+
+	// the schema is flattened in depth-first order, starting with the root
+	t.list(2, thriftStruct, len(w.columns)+1)
+	t.structBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.structEnd()
+	for _, col := range w.columns {
+		physicalType, convertedType, hasConverted := col.Type.physical()
+		t.structBegin()
+		t.i32(1, physicalType)
+		t.i32(3, repetitionRequired)
+		t.binary(4, col.Name)
+		if hasConverted {
+			t.i32(6, convertedType)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, int64(w.NumRows()))
+
+	t.list(4, thriftStruct, len(w.rowGroups))
+	for _, rg := range w.rowGroups {
+		t.structBegin()
+		t.list(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			physicalType, _, _ := w.columns[i].Type.physical()
+			t.structBegin()
+			t.i64(2, chunk.dataPageOffset)
+			t.structField(3)
+			t.i32(1, physicalType)
+			t.list(2, thriftI32, 2)
+			t.zigzag(int64(encodingPlain))
+			t.zigzag(int64(encodingRLE))
+			t.list(3, thriftBinary, 1)
+			t.rawBinary(w.columns[i].Name)
+			t.i32(4, int32(w.codec))
+			t.i64(5, int64(chunk.numValues))
+			t.i64(6, chunk.uncompressedSize)
+			t.i64(7, chunk.compressedSize)
+			t.i64(9, chunk.dataPageOffset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, rg.totalByteSize)
+		t.i64(3, int64(rg.numRows))
+		t.i64(5, rg.fileOffset)
+		t.i64(6, rg.compressedSize)
+		t.structEnd()
+	}
+
+	if len(w.metadata) > 0 {
+		t.list(5, thriftStruct, len(w.metadata))
+		for _, kv := range w.metadata {
+			t.structBegin()
+			t.binary(1, kv[0])
+			t.binary(2, kv[1])
+			t.structEnd()
+		}
+	}
+	t.binary(6, createdBy)
+	t.structEnd()
+
+	return t.buf
+}
@@ -0,0 +1,269 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+var testColumns = []Column{
+	{Name: "time", Type: Timestamp},
+	{Name: "sip", Type: String},
+	{Name: "dport", Type: Uint16},
+	{Name: "proto", Type: Uint8},
+	{Name: "bytes", Type: Uint64},
+	{Name: "delta", Type: Int64},
+	{Name: "percent", Type: Double},
+}
+
+// thriftStructValue denotes a decoded Thrift struct (fields by ID)
+type thriftStructValue map[int16]any
+
+// thriftReader decodes structs serialized via the Thrift compact protocol (sufficient to validate the
+// footer and page headers written by the Writer)
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(fieldType byte) any {
+	switch fieldType {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		v := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return v
+	case thriftList:
+		header := r.byte()
+		n, elemType := int(header>>4), header&0x0f
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(elemType)
+		}
+		return list
+	case thriftStruct:
+		return r.structValue()
+	}
+	panic(fmt.Sprintf("unsupported field type %d", fieldType))
+}
+
+func (r *thriftReader) structValue() thriftStructValue {
+	s := make(thriftStructValue)
+	var lastID int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return s
+		}
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		s[id] = r.value(header & 0x0f)
+		lastID = id
+	}
+}
+
+func readFooter(t *testing.T, data []byte) thriftStructValue {
+	t.Helper()
+
+	require.GreaterOrEqual(t, len(data), 12)
+	require.Equal(t, magic, string(data[:4]))
+	require.Equal(t, magic, string(data[len(data)-4:]))
+
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	r := &thriftReader{buf: footer}
+	meta := r.structValue()
+	require.Equal(t, len(footer), r.pos)
+	return meta
+}
+
+// readColumn decodes the (PLAIN encoded) values of a column chunk
+func readColumn(t *testing.T, data []byte, chunk thriftStructValue) []byte {
+	t.Helper()
+
+	colMeta := chunk[3].(thriftStructValue)
+	offset := colMeta[9].(int64)
+	require.Equal(t, offset, chunk[2].(int64))
+
+	r := &thriftReader{buf: data, pos: int(offset)}
+	header := r.structValue()
+	require.Equal(t, int64(pageTypeData), header[1])
+	require.Equal(t, colMeta[5], header[5].(thriftStructValue)[1])
+
+	page := data[r.pos : r.pos+int(header[3].(int64))]
+	require.Equal(t, colMeta[7], int64(r.pos-int(offset)+len(page)))
+	if Codec(colMeta[4].(int64)) == ZSTD {
+		dec, err := zstd.NewReader(nil)
+		require.Nil(t, err)
+		defer dec.Close()
+		page, err = dec.DecodeAll(page, nil)
+		require.Nil(t, err)
+	}
+	require.Equal(t, int(header[2].(int64)), len(page))
+	return page
+}
+
+func TestWriter(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	for _, codec := range []Codec{Uncompressed, ZSTD} {
+		t.Run(fmt.Sprintf("codec_%d", codec), func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			w := NewWriter(buf, testColumns, WithRowGroupSize(2), WithCodec(codec))
+			w.SetMetadata("query", "sip,dip")
+
+			for i := 0; i < 5; i++ {
+				require.Nil(t, w.WriteRow(ts.Add(time.Duration(i)*time.Minute), fmt.Sprintf("10.0.0.%d", i),
+					uint16(443+i), uint8(6), uint64(1000*i), int64(-i), float64(i)/10))
+			}
+
+			// invalid rows are rejected without affecting the buffered ones
+			require.ErrorIs(t, w.WriteRow(ts), ErrColumnCount)
+			require.ErrorIs(t, w.WriteRow(ts, "10.0.0.5", uint16(443), 6, uint64(0), int64(0), 0.0), ErrValueType)
+			require.Equal(t, 5, w.NumRows())
+
+			// nothing but the full row groups has been written so far
+			require.NotZero(t, buf.Len())
+			require.Nil(t, w.Close())
+			require.ErrorIs(t, w.Close(), ErrClosed)
+			require.ErrorIs(t, w.WriteRow(), ErrClosed)
+
+			data := buf.Bytes()
+			meta := readFooter(t, data)
+			require.Equal(t, int64(formatVersion), meta[1])
+			require.Equal(t, int64(5), meta[3])
+			require.Equal(t, createdBy, meta[6])
+			require.Equal(t, []any{thriftStructValue{1: "query", 2: "sip,dip"}}, meta[5])
+
+			schema := meta[2].([]any)
+			require.Len(t, schema, len(testColumns)+1)
+			require.Equal(t, int64(len(testColumns)), schema[0].(thriftStructValue)[5])
+			for i, col := range testColumns {
+				elem := schema[i+1].(thriftStructValue)
+				physicalType, _, _ := col.Type.physical()
+				require.Equal(t, col.Name, elem[4])
+				require.Equal(t, int64(physicalType), elem[1])
+				require.Equal(t, int64(repetitionRequired), elem[3])
+			}
+
+			rowGroups := meta[4].([]any)
+			require.Len(t, rowGroups, 3)
+
+			var (
+				times   []int64
+				sips    []string
+				dports  []uint32
+				percent []float64
+			)
+			for i, rg := range rowGroups {
+				rowGroup := rg.(thriftStructValue)
+				numRows := int64(2)
+				if i == 2 {
+					numRows = 1
+				}
+				require.Equal(t, numRows, rowGroup[3])
+
+				chunks := rowGroup[1].([]any)
+				require.Len(t, chunks, len(testColumns))
+				for j, c := range chunks {
+					chunk := c.(thriftStructValue)
+					colMeta := chunk[3].(thriftStructValue)
+					require.Equal(t, []any{testColumns[j].Name}, colMeta[3])
+					require.Equal(t, int64(codec), colMeta[4])
+					require.Equal(t, numRows, colMeta[5])
+
+					page := readColumn(t, data, chunk)
+					switch testColumns[j].Name {
+					case "time":
+						for k := 0; k < len(page); k += 8 {
+							times = append(times, int64(binary.LittleEndian.Uint64(page[k:])))
+						}
+					case "sip":
+						for k := 0; k < len(page); {
+							n := int(binary.LittleEndian.Uint32(page[k:]))
+							sips = append(sips, string(page[k+4:k+4+n]))
+							k += 4 + n
+						}
+					case "dport":
+						for k := 0; k < len(page); k += 4 {
+							dports = append(dports, binary.LittleEndian.Uint32(page[k:]))
+						}
+					case "percent":
+						for k := 0; k < len(page); k += 8 {
+							percent = append(percent, math.Float64frombits(binary.LittleEndian.Uint64(page[k:])))
+						}
+					}
+				}
+			}
+
+			require.Equal(t, []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, sips)
+			require.Equal(t, []uint32{443, 444, 445, 446, 447}, dports)
+			require.Equal(t, []float64{0, 0.1, 0.2, 0.3, 0.4}, percent)
+			require.Len(t, times, 5)
+			require.Equal(t, ts.UnixMilli(), times[0])
+			require.Equal(t, ts.Add(4*time.Minute).UnixMilli(), times[4])
+		})
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, testColumns)
+	require.Zero(t, buf.Len())
+	require.Nil(t, w.Close())
+
+	meta := readFooter(t, buf.Bytes())
+	require.Equal(t, int64(0), meta[3])
+	require.Empty(t, meta[4])
+	require.Len(t, meta[2], len(testColumns)+1)
+}
+
+func TestThriftLongList(t *testing.T) {
+	tw := &thriftWriter{}
+	tw.structBegin()
+	tw.list(1, thriftI32, 20)
+	for i := 0; i < 20; i++ {
+		tw.zigzag(int64(-i))
+	}
+	tw.i64(20, math.MaxInt64)
+	tw.structEnd()
+
+	r := &thriftReader{buf: tw.buf}
+	s := r.structValue()
+	require.Len(t, s[1], 20)
+	require.Equal(t, int64(-19), s[1].([]any)[19])
+	require.Equal(t, int64(math.MaxInt64), s[20])
+}
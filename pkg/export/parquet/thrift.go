@@ -0,0 +1,87 @@
+package parquet
+
+import "encoding/binary"
+
+// Field types of the Thrift compact protocol (used to serialize the page headers and the file metadata)
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter serializes structs via the Thrift compact protocol (each serialized struct being enclosed
+// by structBegin / structEnd). Since the field IDs are encoded as deltas to the ID of the previous field
+// of the same struct, the latter is tracked per nesting level
+type thriftWriter struct {
+	buf       []byte
+	lastField []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf = binary.AppendUvarint(t.buf, v)
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, fieldType byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|fieldType)
+	} else {
+		t.buf = append(t.buf, fieldType)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.rawBinary(v)
+}
+
+func (t *thriftWriter) rawBinary(v string) {
+	t.varint(uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+// list writes the header of a list of n elements of the given type (to be followed by the elements)
+func (t *thriftWriter) list(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elemType)
+	t.varint(uint64(n))
+}
+
+// structField begins a struct nested as field of the current struct
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.structBegin()
+}
+
+// structBegin begins a struct (either nested as field, or as element of a list)
+func (t *thriftWriter) structBegin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+// structEnd terminates the current struct
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, 0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
@@ -15,24 +15,29 @@ package goDB
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
 	"github.com/els0r/goProbe/pkg/goDB/encoder"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 	"github.com/els0r/goProbe/pkg/goDB/storage"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
 	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/results"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/els0r/goProbe/pkg/types/workload"
 	"github.com/els0r/telemetry/logging"
 	"github.com/els0r/telemetry/tracing"
-	"github.com/fako1024/gotools/bitpack"
 	"github.com/fako1024/gotools/concurrency"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -53,45 +58,258 @@ const (
 
 // DBWorkManager schedules parallel processing of blocks relevant for a query
 type DBWorkManager struct {
-	query              *Query
-	dbIfaceDir         string // path to interface directory in DB, e.g. /path/to/db/eth0
+	queries            []*Query            // queries evaluated in a single pass over the blocks
+	columnIndices      []types.ColumnIndex // union of the columns required by any of the queries
+	lowMem             bool                // set if any of the queries runs in memory-saving mode
+	dbIfaceDir         string              // path to interface directory in DB, e.g. /path/to/db/eth0
 	iface              string
 	workloadChan       chan *workload.Workload
 	numProcessingUnits int
 
 	tFirstCovered, tLastCovered int64
 	nWorkloads                  uint64
+
+	truncated atomic.Bool // set if processing was stopped by the query deadline
+
+	throttle  *readThrottle // limits the number of workers processing concurrently if the merge stage cannot keep up
+	stallTime atomic.Int64  // time (in ns) workers spent blocked passing on their results, accumulated across all workers
+
+	profile   *results.Profile // per-stage timings (accumulated across all workers), if enabled
+	profileMu sync.Mutex
+
+	drops   map[int64]uint64 // dropped packets per block (timestamp), if enabled
+	dropsMu sync.Mutex
+
+	requiredIPs [][]byte      // IPs of which any flow matching any of the queries has at least one (if known)
+	pruned      atomic.Uint64 // number of directories skipped since their IP filter excludes all required IPs
+
+	metadataCache *MetadataCache // cache for directory listings / GPDir metadata, if any
+
+	provenance   *BlockProvenance // blocks read during processing, if enabled
+	provenanceMu sync.Mutex
+
+	coverageGaps bool // set if gaps in the data coverage are detected while reading metadata
+
+	origin *gpfile.Origin // origin of the most recent directory covered (nil if unknown)
+
+	byteAccounting []string // byte accounting bases of the directories covered (if recorded)
+}
+
+// BlockProvenance denotes the blocks read during query processing
+type BlockProvenance struct {
+	First, Last   int64                      // timestamps of the first / last block read (zero if none)
+	Encoders      map[encoders.Type]struct{} // encoders / compressors of the blocks read
+	CorruptBlocks []int64                    // timestamps of the blocks which could not be read / processed
+}
+
+func (p *BlockProvenance) addBlock(timestamp int64) {
+	if p.First == 0 || timestamp < p.First {
+		p.First = timestamp
+	}
+	if timestamp > p.Last {
+		p.Last = timestamp
+	}
+}
+
+func (p *BlockProvenance) add(p2 *BlockProvenance) {
+	if p2.First != 0 {
+		p.addBlock(p2.First)
+		p.addBlock(p2.Last)
+	}
+	for encoderType := range p2.Encoders {
+		p.Encoders[encoderType] = struct{}{}
+	}
+	p.CorruptBlocks = append(p.CorruptBlocks, p2.CorruptBlocks...)
+}
+
+func newBlockProvenance() *BlockProvenance {
+	return &BlockProvenance{
+		Encoders: make(map[encoders.Type]struct{}),
+	}
 }
 
 // WorkManagerOption configures the DBWorkManager
 type WorkManagerOption func(*DBWorkManager)
 
+// WithProfiling enables tracking of the time spent in the individual processing stages
+// (block reads, decompression and aggregation)
+func WithProfiling() WorkManagerOption {
+	return func(w *DBWorkManager) {
+		w.profile = new(results.Profile)
+	}
+}
+
+// WithDropTracking enables tracking of the packets dropped during capture for each block
+// covered by the query
+func WithDropTracking() WorkManagerOption {
+	return func(w *DBWorkManager) {
+		w.drops = make(map[int64]uint64)
+	}
+}
+
+// WithMetadataCache uses the provided cache for directory listings and GPDir metadata (instead of
+// reading them from disk for every query)
+func WithMetadataCache(cache *MetadataCache) WorkManagerOption {
+	return func(w *DBWorkManager) {
+		w.metadataCache = cache
+	}
+}
+
+// WithProvenanceTracking enables tracking of the blocks read during processing (their time range,
+// encoders and the blocks which could not be read / processed)
+func WithProvenanceTracking() WorkManagerOption {
+	return func(w *DBWorkManager) {
+		w.provenance = newBlockProvenance()
+	}
+}
+
+// WithCoverageGaps enables the detection of gaps in the data coverage (missing blocks or days) while
+// reading the metadata of an interface. It requires the block metadata of all directories to be read
+func WithCoverageGaps() WorkManagerOption {
+	return func(w *DBWorkManager) {
+		w.coverageGaps = true
+	}
+}
+
 // NewDBWorkManager sets up a new work manager for executing queries
 func NewDBWorkManager(query *Query, dbpath string, iface string, numProcessingUnits int, opts ...WorkManagerOption) (*DBWorkManager, error) {
+	return NewBatchDBWorkManager([]*Query{query}, dbpath, iface, numProcessingUnits, opts...)
+}
+
+// NewBatchDBWorkManager sets up a new work manager for executing multiple queries in a single pass over
+// the blocks: each block is read and decompressed only once, while its flows are aggregated independently
+// for each query
+func NewBatchDBWorkManager(queries []*Query, dbpath string, iface string, numProcessingUnits int, opts ...WorkManagerOption) (*DBWorkManager, error) {
 	// Explicitly handle invalid number of processing units (to avoid deadlock)
 	if numProcessingUnits <= 0 {
 		return nil, fmt.Errorf("invalid number of processing units: %d", numProcessingUnits)
 	}
+	if len(queries) == 0 {
+		return nil, errors.New("no queries provided")
+	}
 
 	w := &DBWorkManager{
-		query:              query,
+		queries:            queries,
 		dbIfaceDir:         filepath.Clean(filepath.Join(dbpath, iface)),
 		iface:              iface,
 		workloadChan:       make(chan *workload.Workload, numProcessingUnits*64), // 64 is relatively arbitrary (but we're just sending quite basic objects)
 		numProcessingUnits: numProcessingUnits,
+		throttle:           newReadThrottle(numProcessingUnits),
+	}
+	for _, query := range queries {
+		for _, colIdx := range query.columnIndices {
+			if !slices.Contains(w.columnIndices, colIdx) {
+				w.columnIndices = append(w.columnIndices, colIdx)
+			}
+		}
+		w.lowMem = w.lowMem || query.lowMem
 	}
 
 	for _, opt := range opts {
 		opt(w)
 	}
+
+	// Directories can only be skipped if none of their blocks is relevant for any of the queries, which
+	// is not the case if drops are tracked (since they are accounted for all blocks covered)
+	if w.drops == nil {
+		w.requiredIPs = requiredIPs(queries)
+	}
 	return w, nil
 }
 
+// requiredIPs determines the IPs of which any flow matching any of the queries has at least one (or
+// nil if they cannot be determined for all of the queries)
+func requiredIPs(queries []*Query) (ips [][]byte) {
+	for _, query := range queries {
+		if query.Conditional == nil {
+			return nil
+		}
+		queryIPs, ok := node.RequiredIPs(query.Conditional)
+		if !ok {
+			return nil
+		}
+		ips = append(ips, queryIPs...)
+	}
+	return ips
+}
+
+// Pruned returns the number of directories skipped since their IP filter rules out all IPs required
+// by the queries' conditionals
+func (w *DBWorkManager) Pruned() uint64 {
+	return w.pruned.Load()
+}
+
+// excludedByIPFilter checks if the IP filter of the directory rules out all IPs required by the
+// queries. Directories without a (valid) IP filter are never excluded
+func (w *DBWorkManager) excludedByIPFilter(dir *gpfile.GPDir) bool {
+	if len(w.requiredIPs) == 0 {
+		return false
+	}
+	filter, err := dir.IPFilter()
+	if err != nil || filter == nil {
+		return false
+	}
+	for _, ip := range w.requiredIPs {
+		if filter.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetNumWorkers returns the number of workloads available to the outside world for loop bounds etc.
 func (w *DBWorkManager) GetNumWorkers() uint64 {
 	return w.nWorkloads
 }
 
+// Truncated returns whether processing was stopped by the query deadline before all
+// workloads were processed
+func (w *DBWorkManager) Truncated() bool {
+	return w.truncated.Load()
+}
+
+// StallTime returns the time workers spent blocked passing their results on to the merge stage,
+// accumulated across all workers
+func (w *DBWorkManager) StallTime() time.Duration {
+	return time.Duration(w.stallTime.Load())
+}
+
+// Throttled returns how many times the number of concurrently processing workers was reduced
+// because the merge stage could not keep up
+func (w *DBWorkManager) Throttled() uint64 {
+	_, reductions := w.throttle.stats()
+	return reductions
+}
+
+// Profile returns the per-stage timings accumulated across all workers (or nil if profiling
+// is disabled)
+func (w *DBWorkManager) Profile() *results.Profile {
+	return w.profile
+}
+
+// Drops returns the packets dropped during capture per block timestamp (or nil if drop tracking
+// is disabled). It must only be called once all workloads have been processed
+func (w *DBWorkManager) Drops() map[int64]uint64 {
+	return w.drops
+}
+
+// Provenance returns the blocks read during processing (nil if tracking is disabled)
+func (w *DBWorkManager) Provenance() *BlockProvenance {
+	return w.provenance
+}
+
+// Origin returns the host which captured the data covered, as stamped on the most recent directory
+// covered (nil if unknown, e.g. because the directory was written by an older release)
+func (w *DBWorkManager) Origin() *gpfile.Origin {
+	return w.origin
+}
+
+// ByteAccounting returns the (sorted, distinct) bases the traffic volume of the data covered was accounted
+// on. Directories without recorded bases (e.g. since they were written by an older release) are skipped
+func (w *DBWorkManager) ByteAccounting() []string {
+	return w.byteAccounting
+}
+
 // GetCoveredTimeInterval can be used to determine the time span actually covered by the query
 func (w *DBWorkManager) GetCoveredTimeInterval() (time.Time, time.Time) {
 	return time.Unix(w.tFirstCovered-DBWriteInterval, 0), time.Unix(w.tLastCovered, 0)
@@ -110,7 +328,7 @@ func (w *DBWorkManager) CreateWorkerJobs(tfirst int64, tlast int64) (nonempty bo
 	workloadBulk := make([]*gpfile.GPDir, 0, WorkBulkSize)
 
 	walkFunc := func(numDirs int, dayTimestamp int64, suffix string) error {
-		curDir = gpfile.NewDirReader(w.dbIfaceDir, dayTimestamp, suffix)
+		curDir = w.newDirReader(dayTimestamp, suffix)
 
 		// For the first and last item, check out the GPDir metadata for the actual first and
 		// last block timestamp to cover (and adapt variables accordingly)
@@ -129,6 +347,22 @@ func (w *DBWorkManager) CreateWorkerJobs(tfirst int64, tlast int64) (nonempty bo
 			}
 		}
 
+		// skip the directory if none of the IPs required by the queries was stored in it
+		if w.excludedByIPFilter(curDir) {
+			w.pruned.Add(1)
+			return nil
+		}
+
+		// collect the byte accounting bases of the directory (skipping them if they cannot be read)
+		if bases, err := curDir.ByteAccounting(); err == nil {
+			for _, basis := range bases {
+				if !slices.Contains(w.byteAccounting, basis) {
+					w.byteAccounting = append(w.byteAccounting, basis)
+				}
+			}
+			slices.Sort(w.byteAccounting)
+		}
+
 		// create new workload for the directory
 		workloadBulk = append(workloadBulk, curDir)
 		if len(workloadBulk) == WorkBulkSize {
@@ -162,6 +396,12 @@ func (w *DBWorkManager) CreateWorkerJobs(tfirst int64, tlast int64) (nonempty bo
 		if tlast > dirLast {
 			w.tLastCovered = dirLast
 		}
+
+		// The origin is only read from the last directory, i.e. the most recent host the data was
+		// captured on (discarding it if it cannot be decoded)
+		if origin, err := curDir.Origin(); err == nil && origin != nil && !origin.IsZero() {
+			w.origin = origin
+		}
 		if err := curDir.Close(); err != nil {
 			return false, fmt.Errorf("failed to close last GPDir %s after ascertaining query block timing: %w", curDir.Path(), err)
 		}
@@ -170,6 +410,26 @@ func (w *DBWorkManager) CreateWorkerJobs(tfirst int64, tlast int64) (nonempty bo
 	return 0 < numDirs, nil
 }
 
+// newDirReader instantiates a GPDir for reading, using its cached metadata (if available)
+func (w *DBWorkManager) newDirReader(dayTimestamp int64, suffix string) *gpfile.GPDir {
+	dir := gpfile.NewDirReader(w.dbIfaceDir, dayTimestamp, suffix)
+	if w.metadataCache == nil {
+		return dir
+	}
+	if meta := w.metadataCache.metadata(w.dbIfaceDir, dayTimestamp, suffix, dir.MetadataPath()); meta != nil {
+		return gpfile.NewDirReader(w.dbIfaceDir, dayTimestamp, suffix, gpfile.WithMetadata(meta))
+	}
+	return dir
+}
+
+// readDir returns the (sorted) entries of a directory in the DB (using the cache, if any)
+func (w *DBWorkManager) readDir(path string) ([]fs.DirEntry, error) {
+	if w.metadataCache != nil {
+		return w.metadataCache.readDir(path)
+	}
+	return os.ReadDir(path)
+}
+
 func skipNonMatchingDir(entry fs.DirEntry) bool {
 	return !entry.IsDir()
 }
@@ -178,7 +438,7 @@ type dbWalkFunc func(numDirs int, dayTimestamp int64, suffix string) error
 
 func (w *DBWorkManager) walkDB(tfirst, tlast int64, fn dbWalkFunc) (numDirs int, err error) {
 	// Get list of years in main directory (ordered by directory name, i.e. time)
-	yearList, err := os.ReadDir(w.dbIfaceDir)
+	yearList, err := w.readDir(w.dbIfaceDir)
 	if err != nil {
 		return numDirs, err
 	}
@@ -202,7 +462,7 @@ func (w *DBWorkManager) walkDB(tfirst, tlast int64, fn dbWalkFunc) (numDirs int,
 		}
 
 		// Get list of months in year directory (ordered by directory name, i.e. time)
-		monthList, err := os.ReadDir(filepath.Join(w.dbIfaceDir, year.Name()))
+		monthList, err := w.readDir(filepath.Join(w.dbIfaceDir, year.Name()))
 		if err != nil {
 			return numDirs, err
 		}
@@ -224,7 +484,7 @@ func (w *DBWorkManager) walkDB(tfirst, tlast int64, fn dbWalkFunc) (numDirs int,
 			}
 
 			// Get list of days in month directory (ordered by directory name, i.e. time)
-			dirList, err := os.ReadDir(filepath.Join(w.dbIfaceDir, year.Name(), month.Name()))
+			dirList, err := w.readDir(filepath.Join(w.dbIfaceDir, year.Name(), month.Name()))
 			if err != nil {
 				return numDirs, err
 			}
@@ -278,6 +538,7 @@ func (w *DBWorkManager) ReadMetadata(tfirst int64, tlast int64) (*InterfaceMetad
 		curDir           *gpfile.GPDir
 		currentTimestamp int64
 		currentSuffix    string
+		gaps             gapDetector
 	)
 
 	walkFunc := func(numDirs int, dayTimestamp int64, suffix string) error {
@@ -286,7 +547,7 @@ func (w *DBWorkManager) ReadMetadata(tfirst int64, tlast int64) (*InterfaceMetad
 		currentTimestamp, currentSuffix = dayTimestamp, suffix
 		curDir = gpfile.NewDirReader(w.dbIfaceDir, dayTimestamp, suffix, gpFileOptions...)
 
-		if curDir.Metadata == nil {
+		if curDir.Metadata == nil || w.coverageGaps {
 			err = curDir.Open()
 			if err != nil {
 				return fmt.Errorf("failed to open GPDir %s to ascertain query block timing: %w", curDir.Path(), err)
@@ -296,6 +557,15 @@ func (w *DBWorkManager) ReadMetadata(tfirst int64, tlast int64) (*InterfaceMetad
 		// do the metadata compuation based on the metadata
 		aggMetadata.Stats = aggMetadata.Stats.Add(curDir.Stats)
 
+		// the blocks of the queried range reveal any gaps in the data coverage (also across days)
+		if w.coverageGaps {
+			for _, block := range curDir.BlockMetadata[0].Blocks() {
+				if tfirst <= block.Timestamp && block.Timestamp <= tlast {
+					gaps.add(block.Timestamp)
+				}
+			}
+		}
+
 		// compute the metadata for the first day. If a "first" time argument is given,
 		// the partial day has to be computed
 		if numDirs == 0 {
@@ -390,6 +660,7 @@ func (w *DBWorkManager) ReadMetadata(tfirst int64, tlast int64) (*InterfaceMetad
 	//
 	// This will retain consistency with what is presented in the summary after a normal query
 	aggMetadata.First, aggMetadata.Last = w.GetCoveredTimeInterval()
+	aggMetadata.Gaps = gaps.gaps
 
 	return aggMetadata, nil
 }
@@ -416,7 +687,7 @@ func (w *DBWorkManager) readMetadataAndEvaluate(workDir *gpfile.GPDir, blocks []
 		)
 
 		// Read the blocks from their files
-		for _, colIdx := range w.query.columnIndices {
+		for _, colIdx := range w.columnIndices {
 			// Read the block from the file
 			if colBlocks[colIdx], err = workDir.ReadBlockAtIndex(colIdx, ind); err != nil {
 				blockBroken = true
@@ -432,20 +703,20 @@ func (w *DBWorkManager) readMetadataAndEvaluate(workDir *gpfile.GPDir, blocks []
 		stats.Traffic.NumV4Entries = workDir.NumIPv4EntriesAtIndex(ind)
 		stats.Traffic.NumV6Entries = workDir.NumIPv6EntriesAtIndex(ind)
 
-		numEntries := bitpack.Len(colBlocks[types.BytesRcvdColIdx])
-		for _, colIdx := range w.query.columnIndices {
+		numEntries := deltapack.Len(colBlocks[types.BytesRcvdColIdx], workDir.DeltaPackedAtIndex(types.BytesRcvdColIdx, ind))
+		for _, colIdx := range w.columnIndices {
 			if colIdx.IsCounterCol() {
 				if len(colBlocks[colIdx]) == 0 {
 					blockBroken = true
 					logger.With("block", ind, "column", types.ColumnFileNames[colIdx]).Warn("Invalid (empty) Bitpack slice found")
 					break
 				}
-				if bitpack.Len(colBlocks[colIdx]) != numEntries {
+				if deltapack.Len(colBlocks[colIdx], workDir.DeltaPackedAtIndex(colIdx, ind)) != numEntries {
 					blockBroken = true
 					logger.With(
 						"block", ind,
 						"column", types.ColumnFileNames[colIdx],
-					).Warnf("Incorrect number of entries in column file. Expected %d, found %d", numEntries, bitpack.Len(colBlocks[colIdx]))
+					).Warnf("Incorrect number of entries in column file. Expected %d, found %d", numEntries, deltapack.Len(colBlocks[colIdx], workDir.DeltaPackedAtIndex(colIdx, ind)))
 					break
 				}
 			}
@@ -456,10 +727,10 @@ func (w *DBWorkManager) readMetadataAndEvaluate(workDir *gpfile.GPDir, blocks []
 			continue
 		}
 
-		bytesRcvdValues = bitpack.UnpackInto(colBlocks[types.BytesRcvdColIdx], bytesRcvdValues)
-		bytesSentValues = bitpack.UnpackInto(colBlocks[types.BytesSentColIdx], bytesSentValues)
-		pktsRcvdValues = bitpack.UnpackInto(colBlocks[types.PacketsRcvdColIdx], pktsRcvdValues)
-		pktsSentValues = bitpack.UnpackInto(colBlocks[types.PacketsSentColIdx], pktsSentValues)
+		bytesRcvdValues = deltapack.UnpackInto(colBlocks[types.BytesRcvdColIdx], workDir.DeltaPackedAtIndex(types.BytesRcvdColIdx, ind), bytesRcvdValues)
+		bytesSentValues = deltapack.UnpackInto(colBlocks[types.BytesSentColIdx], workDir.DeltaPackedAtIndex(types.BytesSentColIdx, ind), bytesSentValues)
+		pktsRcvdValues = deltapack.UnpackInto(colBlocks[types.PacketsRcvdColIdx], workDir.DeltaPackedAtIndex(types.PacketsRcvdColIdx, ind), pktsRcvdValues)
+		pktsSentValues = deltapack.UnpackInto(colBlocks[types.PacketsSentColIdx], workDir.DeltaPackedAtIndex(types.PacketsSentColIdx, ind), pktsSentValues)
 
 		for i := 0; i < numEntries; i++ {
 			stats.Counts.Add(types.Counters{
@@ -479,7 +750,7 @@ func (w *DBWorkManager) readMetadataAndEvaluate(workDir *gpfile.GPDir, blocks []
 }
 
 // main query processing
-func (w *DBWorkManager) grabAndProcessWorkload(ctx context.Context, id int, wg *sync.WaitGroup, workloadChan <-chan *workload.Workload, mapChan chan hashmap.AggFlowMapWithMetadata) {
+func (w *DBWorkManager) grabAndProcessWorkload(ctx context.Context, id int, wg *sync.WaitGroup, workloadChan <-chan *workload.Workload, mapChans []chan hashmap.AggFlowMapWithMetadata) {
 	go func() {
 		defer wg.Done()
 
@@ -488,13 +759,33 @@ func (w *DBWorkManager) grabAndProcessWorkload(ctx context.Context, id int, wg *
 		enc, err := encoder.New(defaultEncoderType)
 		if err != nil {
 			logger.Error(err)
-			mapChan <- hashmap.NilAggFlowMapWithMetadata
+			w.sendNil(mapChans)
 		}
 
 		var memPool concurrency.MemPoolGCable
-		if !w.query.lowMem {
-			memPool = concurrency.NewMemPool(len(w.query.columnIndices))
+		if !w.lowMem {
+			memPool = concurrency.NewMemPool(len(w.columnIndices))
+		}
+
+		// timings are tracked per worker and accumulated once the worker is done
+		var (
+			profile     *results.Profile
+			readTimings *gpfile.ReadTimings
+			openOpts    = []gpfile.Option{gpfile.WithEncoder(enc)}
+		)
+		if w.profile != nil {
+			profile, readTimings = new(results.Profile), new(gpfile.ReadTimings)
+			openOpts = append(openOpts, gpfile.WithReadTimings(readTimings))
+			defer func() {
+				profile.BlockRead += readTimings.Read
+				profile.Decompression += readTimings.Decompression
+
+				w.profileMu.Lock()
+				w.profile.Add(profile)
+				w.profileMu.Unlock()
+			}()
 		}
+
 		defer func() {
 			if memPool != nil {
 				memPool.Clear()
@@ -505,15 +796,35 @@ func (w *DBWorkManager) grabAndProcessWorkload(ctx context.Context, id int, wg *
 		}()
 
 		for wl := range workloadChan {
+			w.throttle.acquire(ctx)
+
+			// each query aggregates into its own map
 			stats := new(workload.Stats)
-			resultMap := hashmap.NewAggFlowMapWithMetadata()
+			resultMaps := make([]hashmap.AggFlowMapWithMetadata, len(w.queries))
+			for i := range resultMaps {
+				resultMaps[i] = hashmap.NewAggFlowMapWithMetadata()
+			}
 			for _, workDir := range wl.WorkDirs() {
 				select {
 				case <-ctx.Done():
+					// query deadline was reached, pass on what was aggregated so far and exit
+					if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+						w.truncated.Store(true)
+						logger.Warn("query deadline reached, returning partial results")
+
+						for i := range resultMaps {
+							resultMaps[i].Interface = w.iface
+							resultMaps[i].Stats = wl.Stats()
+						}
+						w.throttle.release(w.sendAll(mapChans, resultMaps))
+						return
+					}
+
 					// query was cancelled, exit
 					wl.Stats().Lock()
 					logger.Infof("query cancelled (workload %d / %d)...", wl.Stats().DirectoriesProcessed, w.nWorkloads)
 					wl.Stats().Unlock()
+					w.throttle.release(false)
 					return
 				default:
 					// check if a memory pool is available
@@ -522,10 +833,10 @@ func (w *DBWorkManager) grabAndProcessWorkload(ctx context.Context, id int, wg *
 					}
 
 					// if there is an error during one of the read jobs, throw a syslog message and terminate
-					stats, err = w.readBlocksAndEvaluate(workDir, enc, &resultMap)
+					stats, err = w.readBlocksAndEvaluate(workDir, openOpts, profile, resultMaps)
 					if err != nil {
 						logger.Error(err)
-						mapChan <- hashmap.NilAggFlowMapWithMetadata
+						w.throttle.release(w.sendNil(mapChans))
 						return
 					}
 				}
@@ -533,20 +844,65 @@ func (w *DBWorkManager) grabAndProcessWorkload(ctx context.Context, id int, wg *
 				wl.AddStats(stats)
 			}
 
-			// we always send the map, even if the resultMap is empty. Filtering is left to the aggregate method
-			resultMap.Stats = wl.Stats()
-			mapChan <- resultMap
+			// we always send the maps, even if they are empty. Filtering is left to the aggregate method. Since
+			// all queries share the same reads, they also share the processing stats
+			for i := range resultMaps {
+				resultMaps[i].Stats = wl.Stats()
+			}
+			w.throttle.release(w.sendAll(mapChans, resultMaps))
 		}
 	}()
 }
 
-// ExecuteWorkerReadJobs runs the query concurrently with multiple sprocessing units
-func (w *DBWorkManager) ExecuteWorkerReadJobs(ctx context.Context, mapChan chan hashmap.AggFlowMapWithMetadata) {
+// send passes a result on to the merge stage, tracking the time spent blocked if the merge stage
+// cannot keep up. It returns whether the worker was stalled
+func (w *DBWorkManager) send(mapChan chan<- hashmap.AggFlowMapWithMetadata, resultMap hashmap.AggFlowMapWithMetadata) (stalled bool) {
+	select {
+	case mapChan <- resultMap:
+		return false
+	default:
+	}
+
+	tStart := time.Now()
+	mapChan <- resultMap
+	w.stallTime.Add(int64(time.Since(tStart)))
+
+	return true
+}
+
+// sendAll passes the results of all queries on to their respective merge stage. It returns whether
+// the worker was stalled passing on any of them
+func (w *DBWorkManager) sendAll(mapChans []chan hashmap.AggFlowMapWithMetadata, resultMaps []hashmap.AggFlowMapWithMetadata) (stalled bool) {
+	for i, mapChan := range mapChans {
+		if w.send(mapChan, resultMaps[i]) {
+			stalled = true
+		}
+	}
+	return stalled
+}
+
+// sendNil signals a processing error to the merge stages of all queries
+func (w *DBWorkManager) sendNil(mapChans []chan hashmap.AggFlowMapWithMetadata) (stalled bool) {
+	for _, mapChan := range mapChans {
+		if w.send(mapChan, hashmap.NilAggFlowMapWithMetadata) {
+			stalled = true
+		}
+	}
+	return stalled
+}
+
+// ExecuteWorkerReadJobs runs the query concurrently with multiple sprocessing units. The results of
+// each query are passed on via a dedicated channel, provided in the order of the queries
+func (w *DBWorkManager) ExecuteWorkerReadJobs(ctx context.Context, mapChans ...chan hashmap.AggFlowMapWithMetadata) {
+	if len(mapChans) != len(w.queries) {
+		panic(fmt.Sprintf("mismatching number of result channels: %d for %d queries", len(mapChans), len(w.queries)))
+	}
+
 	// measure how long it takes to process a single interface. Performance-wise, this is agreable, as
 	// the hot path is within grabAndProcessWorkload
 	// The benefit: more insight on long-running multi-interface queries (a.k.a "any")
 	ctx, span := tracing.Start(ctx, "(*goDB.DBWorkManager).ExecuteWorkerReadJobs",
-		trace.WithAttributes(attribute.String("iface", w.iface)),
+		trace.WithAttributes(attribute.String("iface", w.iface), attribute.Int("queries", len(w.queries))),
 	)
 	defer span.End()
 
@@ -554,26 +910,50 @@ func (w *DBWorkManager) ExecuteWorkerReadJobs(ctx context.Context, mapChan chan
 	wg.Add(w.numProcessingUnits)
 	for i := 0; i < w.numProcessingUnits; i++ {
 		// start worker up
-		w.grabAndProcessWorkload(ctx, i, wg, w.workloadChan, mapChan)
+		w.grabAndProcessWorkload(ctx, i, wg, w.workloadChan, mapChans)
 	}
 
 	// check if all workers are done
 	wg.Wait()
+
+	if w.profile != nil {
+		w.profile.Stall = w.StallTime()
+	}
+}
+
+// blockColumns denotes the (unpacked) columns of a single block, shared by all queries evaluated
+// in the same pass
+type blockColumns struct {
+	timestamp                int64
+	numEntries, numV4Entries int
+
+	// sorted denotes if the entries are sorted (see gpfile.BlockOrderSorted), allowing queries to narrow
+	// them down via binary search
+	sorted bool
+
+	sip, dip, dport, proto                   []byte
+	bytesRcvd, bytesSent, pktsRcvd, pktsSent []uint64
+
+	// tags / process IDs / VLAN IDs / MAC addresses / TCP flags / DSCPs of the flows (nil if the block
+	// carries none or no query requires them)
+	tags, processes, vlans, smacs, dmacs, tcpFlags, dscps []uint64
 }
 
 // Block evaluation and aggregation -----------------------------------------------------
 // this is where the actual reading and aggregation magic happens
-func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder.Encoder, resultMap *hashmap.AggFlowMapWithMetadata) (stats *workload.Stats, err error) {
+func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, openOpts []gpfile.Option, profile *results.Profile, resultMaps []hashmap.AggFlowMapWithMetadata) (stats *workload.Stats, err error) {
 	logger := logging.Logger()
 
 	var (
-		v4Key, v4ComparisonValue                                         = types.NewEmptyV4Key().ExtendEmpty(), types.NewEmptyV4Key().ExtendEmpty()
-		v6Key, v6ComparisonValue                                         = types.NewEmptyV6Key().ExtendEmpty(), types.NewEmptyV6Key().ExtendEmpty()
 		bytesRcvdValues, bytesSentValues, pktsRcvdValues, pktsSentValues []uint64
+		tagValues                                                        []uint64
+		processValues                                                    []uint64
+		vlanValues                                                       []uint64
+		smacValues, dmacValues, tcpFlagsValues, dscpValues               []uint64
 	)
 
 	// Open GPDir (reading metadata in the process)
-	if err := workDir.Open(gpfile.WithEncoder(enc)); err != nil {
+	if err := workDir.Open(openOpts...); err != nil {
 		return stats, err
 	}
 	defer func() {
@@ -581,18 +961,37 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 			err = cerr
 		}
 	}()
+	if w.metadataCache != nil {
+		w.metadataCache.storeDir(w.dbIfaceDir, workDir)
+	}
 
 	// Set map metadata (and cross-check consistency for consecutive workloads)
-	if resultMap.Interface == "" {
-		resultMap.Interface = w.iface
-	} else if resultMap.Interface != w.iface {
-		return stats, fmt.Errorf("discovered invalid workload for mismatching interfaces, want `%s`, have `%s`", resultMap.Interface, w.iface)
+	for i := range resultMaps {
+		if resultMaps[i].Interface == "" {
+			resultMaps[i].Interface = w.iface
+		} else if resultMaps[i].Interface != w.iface {
+			return stats, fmt.Errorf("discovered invalid workload for mismatching interfaces, want `%s`, have `%s`", resultMaps[i].Interface, w.iface)
+		}
 	}
 
 	stats = &workload.Stats{
 		DirectoriesProcessed: 1,
 	}
 
+	// The order of the entries is only of interest (and hence read) if any query can narrow them down
+	narrowEntries := slices.ContainsFunc(w.queries, (*Query).narrowsEntries)
+
+	// The blocks read are tracked for the directory and merged once it has been processed
+	var provenance *BlockProvenance
+	if w.provenance != nil {
+		provenance = newBlockProvenance()
+		defer func() {
+			w.provenanceMu.Lock()
+			w.provenance.add(provenance)
+			w.provenanceMu.Unlock()
+		}()
+	}
+
 	// Process the workload, looping over all blocks in this directory
 	for b, block := range workDir.BlockMetadata[0].Blocks() {
 
@@ -602,6 +1001,20 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 			continue
 		}
 
+		// Likewise, skip blocks outside of the time windows of all queries (if any)
+		if !slices.ContainsFunc(w.queries, func(q *Query) bool { return q.coversBlock(block.Timestamp) }) {
+			continue
+		}
+
+		// Drops are part of the block metadata and hence available even if the block itself is broken
+		if w.drops != nil {
+			if numDrops := workDir.BlockTraffic[b].NumDrops; numDrops > 0 {
+				w.dropsMu.Lock()
+				w.drops[block.Timestamp] += numDrops
+				w.dropsMu.Unlock()
+			}
+		}
+
 		var (
 			blocks      [types.ColIdxCount][]byte
 			blockBroken bool
@@ -609,8 +1022,8 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 
 		stats.BytesLoaded += uint64(block.Len)
 
-		// Read the blocks from their files
-		for _, colIdx := range w.query.columnIndices {
+		// Read the blocks from their files (only once, irrespective of the number of queries)
+		for _, colIdx := range w.columnIndices {
 			// Read the block from the file
 			blocks[colIdx], err = workDir.ReadBlockAtIndex(colIdx, b)
 			if err != nil {
@@ -625,13 +1038,23 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 		// In case any error was observed during block access, skip this whole block
 		if blockBroken {
 			stats.BlocksCorrupted++
+			if provenance != nil {
+				provenance.CorruptBlocks = append(provenance.CorruptBlocks, block.Timestamp)
+			}
 			continue
 		}
 
+		// Everything from here on (sanity checks, unpacking, condition evaluation and aggregation) is
+		// attributed to the aggregation stage
+		var tAggStart time.Time
+		if profile != nil {
+			tAggStart = time.Now()
+		}
+
 		// Check whether all blocks have matching number of entries
 		numV4Entries := int(workDir.NumIPv4EntriesAtIndex(b))
-		numEntries := bitpack.Len(blocks[types.BytesRcvdColIdx])
-		for _, colIdx := range w.query.columnIndices {
+		numEntries := deltapack.Len(blocks[types.BytesRcvdColIdx], workDir.DeltaPackedAtIndex(types.BytesRcvdColIdx, b))
+		for _, colIdx := range w.columnIndices {
 			l := len(blocks[colIdx])
 			stats.BytesDecompressed += uint64(l)
 
@@ -641,9 +1064,18 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 					logger.With("block", b, "column", types.ColumnFileNames[colIdx]).Warn("Invalid (empty) Bitpack slice found")
 					break
 				}
-				if bitpack.Len(blocks[colIdx]) != numEntries {
+				if deltapack.Len(blocks[colIdx], workDir.DeltaPackedAtIndex(colIdx, b)) != numEntries {
+					blockBroken = true
+					logger.With("block", b, "column", types.ColumnFileNames[colIdx]).Warnf("Incorrect number of entries in column file. Expected %d, found %d", numEntries, deltapack.Len(blocks[colIdx], workDir.DeltaPackedAtIndex(colIdx, b)))
+					break
+				}
+			} else if colIdx.IsLabelCol() {
+				// The tags / process / VLAN / MAC / TCP flags / DSCP columns are empty for blocks written
+				// without a flow tagger / process attributor / flows observed on a VLAN / recorded MAC
+				// addresses / TCP flows / non-default DSCPs (or prior to their introduction)
+				if l > 0 && deltapack.Len(blocks[colIdx], workDir.DeltaPackedAtIndex(colIdx, b)) != numEntries {
 					blockBroken = true
-					logger.With("block", b, "column", types.ColumnFileNames[colIdx]).Warnf("Incorrect number of entries in column file. Expected %d, found %d", numEntries, bitpack.Len(blocks[colIdx]))
+					logger.With("block", b, "column", types.ColumnFileNames[colIdx]).Warnf("Incorrect number of entries in column file. Expected %d, found %d", numEntries, deltapack.Len(blocks[colIdx], workDir.DeltaPackedAtIndex(colIdx, b)))
 					break
 				}
 			} else {
@@ -669,50 +1101,173 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 		}
 
 		// Update keepalive (if required)
-		w.query.UpdateKeepalive()
+		for _, query := range w.queries {
+			query.UpdateKeepalive()
+		}
 
 		// In case any error was observed during above sanity checks, skip this whole block
 		if blockBroken {
 			stats.BlocksCorrupted++
+			if provenance != nil {
+				provenance.CorruptBlocks = append(provenance.CorruptBlocks, block.Timestamp)
+			}
+			if profile != nil {
+				profile.Aggregation += time.Since(tAggStart)
+			}
 			continue
 		}
 
-		// Initialize any (static) key extensions potentially present in the query
-		if w.query.hasAttrTime {
-			v4Key = types.NewEmptyV4Key().Extend(block.Timestamp)
-			v6Key = types.NewEmptyV6Key().Extend(block.Timestamp)
-			if w.query.Conditional == nil {
-				v4ComparisonValue = types.NewEmptyV4Key().Extend(block.Timestamp)
-				v6ComparisonValue = types.NewEmptyV6Key().Extend(block.Timestamp)
+		// Track the block as read (empty blocks, e.g. of the tags column, carry no data, hence their
+		// encoder is irrelevant)
+		if provenance != nil {
+			provenance.addBlock(block.Timestamp)
+			for _, colIdx := range w.columnIndices {
+				if colBlock := workDir.BlockMetadata[colIdx].Blocks()[b]; colBlock.Len > 0 {
+					provenance.Encoders[colBlock.EncoderType] = struct{}{}
+				}
+			}
+		}
+
+		bytesRcvdValues = deltapack.UnpackInto(blocks[types.BytesRcvdColIdx], workDir.DeltaPackedAtIndex(types.BytesRcvdColIdx, b), bytesRcvdValues)
+		bytesSentValues = deltapack.UnpackInto(blocks[types.BytesSentColIdx], workDir.DeltaPackedAtIndex(types.BytesSentColIdx, b), bytesSentValues)
+		pktsRcvdValues = deltapack.UnpackInto(blocks[types.PacketsRcvdColIdx], workDir.DeltaPackedAtIndex(types.PacketsRcvdColIdx, b), pktsRcvdValues)
+		pktsSentValues = deltapack.UnpackInto(blocks[types.PacketsSentColIdx], workDir.DeltaPackedAtIndex(types.PacketsSentColIdx, b), pktsSentValues)
+
+		cols := blockColumns{
+			timestamp:    block.Timestamp,
+			numEntries:   numEntries,
+			numV4Entries: numV4Entries,
+			sip:          blocks[types.SIPColIdx],
+			dip:          blocks[types.DIPColIdx],
+			dport:        blocks[types.DportColIdx],
+			proto:        blocks[types.ProtoColIdx],
+			bytesRcvd:    bytesRcvdValues,
+			bytesSent:    bytesSentValues,
+			pktsRcvd:     pktsRcvdValues,
+			pktsSent:     pktsSentValues,
+			sorted:       narrowEntries && workDir.BlockOrderAtIndex(b) == gpfile.BlockOrderSorted,
+		}
+
+		// Flows of blocks without tags are treated as untagged (the column is only read if any query
+		// requires it)
+		if len(blocks[types.TagsColIdx]) > 0 {
+			tagValues = deltapack.UnpackInto(blocks[types.TagsColIdx], workDir.DeltaPackedAtIndex(types.TagsColIdx, b), tagValues)
+			cols.tags = tagValues
+		}
+
+		// Likewise, flows of blocks without process IDs are treated as unattributed
+		if len(blocks[types.ProcessColIdx]) > 0 {
+			processValues = deltapack.UnpackInto(blocks[types.ProcessColIdx], workDir.DeltaPackedAtIndex(types.ProcessColIdx, b), processValues)
+			cols.processes = processValues
+		}
+
+		// ... and flows of blocks without VLAN IDs as untagged
+		if len(blocks[types.VLANColIdx]) > 0 {
+			vlanValues = deltapack.UnpackInto(blocks[types.VLANColIdx], workDir.DeltaPackedAtIndex(types.VLANColIdx, b), vlanValues)
+			cols.vlans = vlanValues
+		}
+
+		// ... and flows of blocks without MAC addresses as unknown
+		if len(blocks[types.SMACColIdx]) > 0 {
+			smacValues = deltapack.UnpackInto(blocks[types.SMACColIdx], workDir.DeltaPackedAtIndex(types.SMACColIdx, b), smacValues)
+			cols.smacs = smacValues
+		}
+		if len(blocks[types.DMACColIdx]) > 0 {
+			dmacValues = deltapack.UnpackInto(blocks[types.DMACColIdx], workDir.DeltaPackedAtIndex(types.DMACColIdx, b), dmacValues)
+			cols.dmacs = dmacValues
+		}
+
+		// ... and flows of blocks without TCP flags as having none observed
+		if len(blocks[types.TCPFlagsColIdx]) > 0 {
+			tcpFlagsValues = deltapack.UnpackInto(blocks[types.TCPFlagsColIdx], workDir.DeltaPackedAtIndex(types.TCPFlagsColIdx, b), tcpFlagsValues)
+			cols.tcpFlags = tcpFlagsValues
+		}
+
+		// ... and flows of blocks without DSCPs as observed with the default one
+		if len(blocks[types.DSCPColIdx]) > 0 {
+			dscpValues = deltapack.UnpackInto(blocks[types.DSCPColIdx], workDir.DeltaPackedAtIndex(types.DSCPColIdx, b), dscpValues)
+			cols.dscps = dscpValues
+		}
+
+		// The flows are aggregated independently for each query
+		for i, query := range w.queries {
+			if query.coversBlock(block.Timestamp) {
+				evaluateBlock(query, &cols, &resultMaps[i])
 			}
 		}
 
-		bytesRcvdValues = bitpack.UnpackInto(blocks[types.BytesRcvdColIdx], bytesRcvdValues)
-		bytesSentValues = bitpack.UnpackInto(blocks[types.BytesSentColIdx], bytesSentValues)
-		pktsRcvdValues = bitpack.UnpackInto(blocks[types.PacketsRcvdColIdx], pktsRcvdValues)
-		pktsSentValues = bitpack.UnpackInto(blocks[types.PacketsSentColIdx], pktsSentValues)
+		if profile != nil {
+			profile.Aggregation += time.Since(tAggStart)
+		}
+	}
 
-		sipBlocks := blocks[types.SIPColIdx]
-		dipBlocks := blocks[types.DIPColIdx]
-		dportBlocks := blocks[types.DportColIdx]
-		protoBlocks := blocks[types.ProtoColIdx]
+	return stats, nil
+}
 
-		// Determine start / end of block perusal - If the query is limited to either IPv4 or IPv6, adjust
-		// accordingly to skip irrelevant data that wouldn't satisfy the condition anyway
-		key, comparisonValue := v4Key, v4ComparisonValue
-		startEntry, isIPv4, condIsIPv4 := 0, true, true
-		if w.query.ipVersion == types.IPVersionV6 {
-			startEntry = numV4Entries
-		} else if w.query.ipVersion == types.IPVersionV4 {
-			numEntries = numV4Entries
+// evaluateBlock aggregates all flows of a block satisfying the conditional of a query into the
+// result map
+func evaluateBlock(query *Query, cols *blockColumns, resultMap *hashmap.AggFlowMapWithMetadata) {
+	var (
+		v4Key, v4ComparisonValue = types.NewEmptyV4Key().ExtendEmpty(), types.NewEmptyV4Key().ExtendEmpty()
+		v6Key, v6ComparisonValue = types.NewEmptyV6Key().ExtendEmpty(), types.NewEmptyV6Key().ExtendEmpty()
+	)
+
+	// Initialize any (static) key extensions potentially present in the query
+	if query.hasAttrTime {
+		v4Key = types.NewEmptyV4Key().Extend(cols.timestamp)
+		v6Key = types.NewEmptyV6Key().Extend(cols.timestamp)
+		if query.Conditional == nil {
+			v4ComparisonValue = types.NewEmptyV4Key().Extend(cols.timestamp)
+			v6ComparisonValue = types.NewEmptyV6Key().Extend(cols.timestamp)
+		}
+	}
+	if query.hasAttrTag || query.hasAttrProcess || query.hasAttrVLAN || query.hasAttrSMAC || query.hasAttrDMAC || query.hasAttrTCPFlags || query.hasAttrDSCP {
+		var ts int64
+		if query.hasAttrTime {
+			ts = cols.timestamp
 		}
-		for i := startEntry; i < numEntries; i++ {
+		v4Key = types.NewEmptyV4Key().ExtendTagged(ts)
+		v6Key = types.NewEmptyV6Key().ExtendTagged(ts)
+	}
 
-			// If / when reaching the v4/v6 mark, switch to the IPv6 key / submap
-			if i == numV4Entries {
+	blockHasTags := query.needsTags() && cols.tags != nil
+	blockHasProcesses := query.hasAttrProcess && cols.processes != nil
+	blockHasVLANs := (query.hasAttrVLAN || query.hasCondVLAN) && cols.vlans != nil
+	blockHasSMACs := (query.hasAttrSMAC || query.hasCondSMAC) && cols.smacs != nil
+	blockHasDMACs := (query.hasAttrDMAC || query.hasCondDMAC) && cols.dmacs != nil
+	blockHasTCPFlags := (query.hasAttrTCPFlags || query.hasCondTCPFlags) && cols.tcpFlags != nil
+	blockHasDSCPs := (query.hasAttrDSCP || query.hasCondDSCP) && cols.dscps != nil
+
+	// Conditions on the VLAN / MAC addresses / TCP flags / DSCP are evaluated against a comparison value
+	// carrying them
+	if query.hasCondVLAN || query.hasCondSMAC || query.hasCondDMAC || query.hasCondTCPFlags || query.hasCondDSCP {
+		v4ComparisonValue = types.NewEmptyV4Key().ExtendTagged(0)
+		v6ComparisonValue = types.NewEmptyV6Key().ExtendTagged(0)
+	}
+
+	var (
+		numEntries, numV4Entries = cols.numEntries, cols.numV4Entries
+		sipBlocks, dipBlocks     = cols.sip, cols.dip
+		dportBlocks, protoBlocks = cols.dport, cols.proto
+	)
+
+	// Determine start / end of block perusal - If the query is limited to either IPv4 or IPv6, adjust
+	// accordingly to skip irrelevant data that wouldn't satisfy the condition anyway
+	key, comparisonValue := v4Key, v4ComparisonValue
+	startEntry, isIPv4, condIsIPv4 := 0, true, true
+	if query.ipVersion == types.IPVersionV6 {
+		startEntry = numV4Entries
+	} else if query.ipVersion == types.IPVersionV4 {
+		numEntries = numV4Entries
+	}
+	for _, r := range query.entryRanges(cols, startEntry, numEntries) {
+		for i := r.start; i < r.end; i++ {
+
+			// If / when reaching (or skipping past) the v4/v6 mark, switch to the IPv6 key / submap
+			if condIsIPv4 && i >= numV4Entries {
 
 				// Skip switching to secondary map if IPs are not part of the query attributes
-				if w.query.hasAttrSIP || w.query.hasAttrDIP {
+				if query.hasAttrSIP || query.hasAttrDIP {
 					key = v6Key
 					isIPv4 = false
 				}
@@ -722,70 +1277,117 @@ func (w *DBWorkManager) readBlocksAndEvaluate(workDir *gpfile.GPDir, enc encoder
 				condIsIPv4 = false
 			}
 
+			// Skip flows not carrying any of the requested tags (if any)
+			var tags uint64
+			if blockHasTags {
+				tags = cols.tags[i]
+			}
+			if query.tagMask != 0 && tags&query.tagMask == 0 {
+				continue
+			}
+
 			// Populate key for current entry
-			if w.query.hasAttrSIP {
+			if query.hasAttrSIP {
 				if isIPv4 {
 					key.PutSIP(sipBlocks[i*4 : i*4+4])
 				} else {
 					key.PutSIP(sipBlocks[numV4Entries*4+(i-numV4Entries)*16 : numV4Entries*4+(i-numV4Entries)*16+16])
 				}
 			}
-			if w.query.hasAttrDIP {
+			if query.hasAttrDIP {
 				if isIPv4 {
 					key.PutDIPV4(dipBlocks[i*4 : i*4+4])
 				} else {
 					key.PutDIPV6(dipBlocks[numV4Entries*4+(i-numV4Entries)*16 : numV4Entries*4+(i-numV4Entries)*16+16])
 				}
 			}
-			if w.query.hasAttrProto {
+			if query.hasAttrProto {
 				key.PutProtoV(protoBlocks[i], isIPv4)
 			}
-			if w.query.hasAttrDport {
-				key.PutDportV(dportBlocks[i*types.DportSizeof:i*types.DportSizeof+types.DportSizeof], isIPv4)
+			if query.hasAttrDport {
+				dport := dportBlocks[i*types.DportSizeof : i*types.DportSizeof+types.DportSizeof]
+				if query.portClassKeys != nil {
+					dport = query.classifyDport(dport)
+				}
+				key.PutDportV(dport, isIPv4)
+			}
+			if query.hasAttrTag {
+				key.PutTags(tags)
+			}
+			if blockHasProcesses {
+				key.PutProcess(uint32(cols.processes[i]))
+			}
+			if query.hasAttrVLAN && blockHasVLANs {
+				key.PutVLAN(uint16(cols.vlans[i]))
+			}
+			if query.hasAttrSMAC && blockHasSMACs {
+				key.PutSMAC(types.MACFromUint64(cols.smacs[i]))
+			}
+			if query.hasAttrDMAC && blockHasDMACs {
+				key.PutDMAC(types.MACFromUint64(cols.dmacs[i]))
+			}
+			if query.hasAttrTCPFlags && blockHasTCPFlags {
+				key.PutTCPFlags(types.TCPFlags(cols.tcpFlags[i]))
+			}
+			if query.hasAttrDSCP && blockHasDSCPs {
+				key.PutDSCP(types.DSCP(cols.dscps[i]))
 			}
 
 			// Check whether conditional is satisfied for current entry
-			var conditionalSatisfied = (w.query.Conditional == nil)
+			var conditionalSatisfied = (query.Conditional == nil)
 			if !conditionalSatisfied {
 
 				// Populate comparison value for current entry
-				if w.query.hasCondSIP {
+				if query.hasCondSIP {
 					if condIsIPv4 {
 						comparisonValue.PutSIP(sipBlocks[i*4 : i*4+4])
 					} else {
 						comparisonValue.PutSIP(sipBlocks[numV4Entries*4+(i-numV4Entries)*16 : numV4Entries*4+(i-numV4Entries)*16+16])
 					}
 				}
-				if w.query.hasCondDIP {
+				if query.hasCondDIP {
 					if condIsIPv4 {
 						comparisonValue.PutDIPV4(dipBlocks[i*4 : i*4+4])
 					} else {
 						comparisonValue.PutDIPV6(dipBlocks[numV4Entries*4+(i-numV4Entries)*16 : numV4Entries*4+(i-numV4Entries)*16+16])
 					}
 				}
-				if w.query.hasCondProto {
+				if query.hasCondProto {
 					comparisonValue.PutProtoV(protoBlocks[i], condIsIPv4)
 				}
-				if w.query.hasCondDport {
+				if query.hasCondDport {
 					comparisonValue.PutDportV(dportBlocks[i*types.DportSizeof:i*types.DportSizeof+types.DportSizeof], condIsIPv4)
 				}
+				if query.hasCondVLAN && blockHasVLANs {
+					comparisonValue.PutVLAN(uint16(cols.vlans[i]))
+				}
+				if query.hasCondSMAC && blockHasSMACs {
+					comparisonValue.PutSMAC(types.MACFromUint64(cols.smacs[i]))
+				}
+				if query.hasCondDMAC && blockHasDMACs {
+					comparisonValue.PutDMAC(types.MACFromUint64(cols.dmacs[i]))
+				}
+				if query.hasCondTCPFlags && blockHasTCPFlags {
+					comparisonValue.PutTCPFlags(types.TCPFlags(cols.tcpFlags[i]))
+				}
+				if query.hasCondDSCP && blockHasDSCPs {
+					comparisonValue.PutDSCP(types.DSCP(cols.dscps[i]))
+				}
 
-				conditionalSatisfied = w.query.Conditional.Evaluate(comparisonValue.Key())
+				conditionalSatisfied = query.Conditional.Evaluate(comparisonValue)
 			}
 
 			if conditionalSatisfied {
 				resultMap.SetOrUpdate(key,
 					isIPv4,
-					bytesRcvdValues[i],
-					bytesSentValues[i],
-					pktsRcvdValues[i],
-					pktsSentValues[i],
+					cols.bytesRcvd[i],
+					cols.bytesSent[i],
+					cols.pktsRcvd[i],
+					cols.pktsSent[i],
 				)
 			}
 		}
 	}
-
-	return stats, nil
 }
 
 // Close releases all resources claimed by the DBWorkManager
@@ -16,6 +16,7 @@
 package goDB
 
 import (
+	"slices"
 	"time"
 
 	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
@@ -31,10 +32,18 @@ type Query struct {
 
 	// Explicity attribute flags that allow granular processing logic
 	// without having to rely on array loops
-	hasAttrTime, hasAttrIface                          bool
-	hasAttrSIP, hasAttrDIP, hasAttrDport, hasAttrProto bool
-	hasCondSIP, hasCondDIP, hasCondDport, hasCondProto bool
-	ipVersion                                          types.IPVersion
+	hasAttrTime, hasAttrIface, hasAttrTag, hasAttrProcess bool
+	hasAttrSIP, hasAttrDIP, hasAttrDport, hasAttrProto    bool
+	hasCondSIP, hasCondDIP, hasCondDport, hasCondProto    bool
+	hasAttrVLAN, hasCondVLAN                              bool
+	hasAttrSMAC, hasAttrDMAC, hasCondSMAC, hasCondDMAC    bool
+	hasAttrTCPFlags, hasCondTCPFlags                      bool
+	hasAttrDSCP, hasCondDSCP                              bool
+	ipVersion                                             types.IPVersion
+
+	// Values of the protocol, destination port and source IP one of which every flow satisfying the
+	// conditional carries (nil if unrestricted), allowing to narrow down the entries of sorted blocks
+	condProtos, condDports, condSIPs [][]byte
 
 	// metadataOnly will determine if all relevant information to answer the query can be
 	// derived solely from metadata inside GPDir
@@ -55,6 +64,19 @@ type Query struct {
 	// The latter four elements are needed for every query since they contain the variables we aggregate.
 	columnIndices []types.ColumnIndex
 
+	// Port classes by which destination ports are bucketed (if the dportclass attribute is
+	// part of the query), along with a lookup table mapping each port to its (raw) class
+	portClasses   types.PortClasses
+	portClassKeys []byte
+
+	// Bitmap of flow tags restricting the query to flows carrying any of them (if non-zero)
+	tagMask uint64
+
+	// Recurring time windows restricting the query to blocks within them (if any), evaluated
+	// in the given location
+	timeWindows         types.TimeWindows
+	timeWindowsLocation *time.Location
+
 	// Enables memory-saving mode
 	lowMem bool
 
@@ -70,10 +92,11 @@ type Query struct {
 // the condition attributes.
 func queryAttributeNameToColumnIndex(name string) (colIdx types.ColumnIndex) {
 	colIdx, ok := map[string]types.ColumnIndex{
-		types.SIPName:   types.SIPColIdx,
-		types.DIPName:   types.DIPColIdx,
-		types.ProtoName: types.ProtoColIdx,
-		types.DportName: types.DportColIdx}[name]
+		types.SIPName:        types.SIPColIdx,
+		types.DIPName:        types.DIPColIdx,
+		types.ProtoName:      types.ProtoColIdx,
+		types.DportName:      types.DportColIdx,
+		types.DportClassName: types.DportColIdx}[name]
 	if !ok {
 		panic("Unknown query attribute " + name)
 	}
@@ -96,6 +119,23 @@ func conditionalAttributeNameToColumnIndex(name string) (colIdx types.ColumnInde
 	return
 }
 
+// Computes the column indices an attribute is derived from. Apart from custom attributes (which
+// may depend on several columns), each attribute corresponds to exactly one column
+func queryAttributeColumnIndices(attrib types.Attribute) []types.ColumnIndex {
+	if custom, isCustom := attrib.(types.CustomAttribute); isCustom {
+		return custom.Columns()
+	}
+	return []types.ColumnIndex{queryAttributeNameToColumnIndex(attrib.Name())}
+}
+
+// Computes the column indices a conditional attribute is derived from (see queryAttributeColumnIndices)
+func conditionalAttributeColumnIndices(name string) []types.ColumnIndex {
+	if plugin, isCustom := types.GetAttributePlugin(name); isCustom {
+		return plugin.Columns()
+	}
+	return []types.ColumnIndex{conditionalAttributeNameToColumnIndex(name)}
+}
+
 var queryAttributeColumnFlagSetters = [types.ColIdxAttributeCount]func(q *Query){
 	func(q *Query) { q.hasAttrSIP = true },
 	func(q *Query) { q.hasAttrDIP = true },
@@ -121,30 +161,69 @@ func NewMetadataQuery() *Query {
 // NewQuery creates a new Query object based on the parsed command line parameters
 func NewQuery(attributes []types.Attribute, conditional node.Node, selector types.LabelSelector) *Query {
 	q := &Query{
-		Attributes:   attributes,
-		Conditional:  conditional,
-		hasAttrTime:  selector.Timestamp,
-		hasAttrIface: selector.Iface,
+		Attributes:      attributes,
+		Conditional:     conditional,
+		hasAttrTime:     selector.Timestamp,
+		hasAttrIface:    selector.Iface,
+		hasAttrTag:      selector.Tag,
+		hasAttrProcess:  selector.Process,
+		hasAttrVLAN:     selector.VLAN,
+		hasAttrSMAC:     selector.SMAC,
+		hasAttrDMAC:     selector.DMAC,
+		hasAttrTCPFlags: selector.TCPFlags,
+		hasAttrDSCP:     selector.DSCP,
 	}
 
 	// Compute index sets
 	var isAttributeIndex [types.ColIdxAttributeCount]bool // temporary variable for computing set union
 
 	for _, attrib := range q.Attributes {
-		colIdx := queryAttributeNameToColumnIndex(attrib.Name())
-		q.queryAttributeIndices = append(q.queryAttributeIndices, colIdx)
-		isAttributeIndex[colIdx] = true
-		queryAttributeColumnFlagSetters[colIdx](q)
+		for _, colIdx := range queryAttributeColumnIndices(attrib) {
+			if !slices.Contains(q.queryAttributeIndices, colIdx) {
+				q.queryAttributeIndices = append(q.queryAttributeIndices, colIdx)
+			}
+			isAttributeIndex[colIdx] = true
+			queryAttributeColumnFlagSetters[colIdx](q)
+		}
+
+		if _, isDportClass := attrib.(types.DportClassAttribute); isDportClass {
+			q.ClassifyPorts(types.DefaultPortClasses)
+		}
 	}
 
 	if q.Conditional != nil {
 		for attribName, ipVersion := range q.Conditional.Attributes() {
-			colIdx := conditionalAttributeNameToColumnIndex(attribName)
-			q.conditionalAttributeIndices = append(q.conditionalAttributeIndices, colIdx)
-			isAttributeIndex[colIdx] = true
-			queryConditionalColumnFlagSetters[colIdx](q)
+
+			// The VLAN / MAC addresses / TCP flags / DSCP are not part of the flow key but stored in label columns of their own
+			switch attribName {
+			case types.VLANName:
+				q.hasCondVLAN = true
+				continue
+			case types.SMACName:
+				q.hasCondSMAC = true
+				continue
+			case types.DMACName:
+				q.hasCondDMAC = true
+				continue
+			case types.TCPFlagsName:
+				q.hasCondTCPFlags = true
+				continue
+			case types.DSCPName:
+				q.hasCondDSCP = true
+				continue
+			}
+			for _, colIdx := range conditionalAttributeColumnIndices(attribName) {
+				if !slices.Contains(q.conditionalAttributeIndices, colIdx) {
+					q.conditionalAttributeIndices = append(q.conditionalAttributeIndices, colIdx)
+				}
+				isAttributeIndex[colIdx] = true
+				queryConditionalColumnFlagSetters[colIdx](q)
+			}
 			q.ipVersion = q.ipVersion.Merge(ipVersion)
 		}
+		q.condProtos, _ = node.RequiredValues(q.Conditional, types.ProtoName)
+		q.condDports, _ = node.RequiredValues(q.Conditional, types.DportName)
+		q.condSIPs, _ = node.RequiredValues(q.Conditional, types.SIPName)
 	}
 	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxAttributeCount; colIdx++ {
 		if isAttributeIndex[colIdx] {
@@ -153,6 +232,27 @@ func NewQuery(attributes []types.Attribute, conditional node.Node, selector type
 	}
 	q.columnIndices = append(q.columnIndices,
 		types.BytesRcvdColIdx, types.BytesSentColIdx, types.PacketsRcvdColIdx, types.PacketsSentColIdx)
+	if q.hasAttrTag {
+		q.columnIndices = append(q.columnIndices, types.TagsColIdx)
+	}
+	if q.hasAttrProcess {
+		q.columnIndices = append(q.columnIndices, types.ProcessColIdx)
+	}
+	if q.hasAttrVLAN || q.hasCondVLAN {
+		q.columnIndices = append(q.columnIndices, types.VLANColIdx)
+	}
+	if q.hasAttrSMAC || q.hasCondSMAC {
+		q.columnIndices = append(q.columnIndices, types.SMACColIdx)
+	}
+	if q.hasAttrDMAC || q.hasCondDMAC {
+		q.columnIndices = append(q.columnIndices, types.DMACColIdx)
+	}
+	if q.hasAttrTCPFlags || q.hasCondTCPFlags {
+		q.columnIndices = append(q.columnIndices, types.TCPFlagsColIdx)
+	}
+	if q.hasAttrDSCP || q.hasCondDSCP {
+		q.columnIndices = append(q.columnIndices, types.DSCPColIdx)
+	}
 
 	return q
 }
@@ -163,6 +263,72 @@ func (q *Query) LowMem(enable bool) *Query {
 	return q
 }
 
+// ClassifyPorts sets the port classes by which destination ports are bucketed. It has no effect
+// unless the query contains the dportclass attribute
+func (q *Query) ClassifyPorts(classes types.PortClasses) *Query {
+	if len(classes) == 0 || !q.hasPortClassAttribute() {
+		return q
+	}
+	q.portClasses = classes
+	q.portClassKeys = classes.KeyTable()
+	return q
+}
+
+// FilterTags restricts the query to flows carrying any of the flow tags in the bitmap. A zero
+// bitmap disables filtering
+func (q *Query) FilterTags(mask uint64) *Query {
+	q.tagMask = mask
+	if mask != 0 && !slices.Contains(q.columnIndices, types.TagsColIdx) {
+		q.columnIndices = append(q.columnIndices, types.TagsColIdx)
+	}
+	return q
+}
+
+// FilterTimeWindows restricts the query to blocks falling into any of the recurring time windows,
+// evaluated in the given location (the local time zone if nil). Empty windows disable filtering
+func (q *Query) FilterTimeWindows(windows types.TimeWindows, loc *time.Location) *Query {
+	if loc == nil {
+		loc = time.Local
+	}
+	q.timeWindows, q.timeWindowsLocation = windows, loc
+	return q
+}
+
+// coversBlock returns if the block written at the given timestamp falls into any of the time
+// windows of the query. Blocks straddling the boundary of a window are attributed to it if their
+// midpoint lies within the window, i.e. if at least half of the interval they cover does
+func (q *Query) coversBlock(timestamp int64) bool {
+	if len(q.timeWindows) == 0 {
+		return true
+	}
+	return q.timeWindows.Contains(time.Unix(timestamp-DBWriteInterval/2, 0).In(q.timeWindowsLocation))
+}
+
+// needsTags returns if the tags column is required to answer the query
+func (q *Query) needsTags() bool {
+	return q.hasAttrTag || q.tagMask != 0
+}
+
+// PortClasses returns the port classes by which destination ports are bucketed (if any)
+func (q *Query) PortClasses() types.PortClasses {
+	return q.portClasses
+}
+
+// classifyDport returns the (raw) port class of a (raw) destination port
+func (q *Query) classifyDport(dport []byte) []byte {
+	idx := int(types.PortToUint16(dport)) * types.DportSizeof
+	return q.portClassKeys[idx : idx+types.DportSizeof]
+}
+
+func (q *Query) hasPortClassAttribute() bool {
+	for _, attrib := range q.Attributes {
+		if _, isDportClass := attrib.(types.DportClassAttribute); isDportClass {
+			return true
+		}
+	}
+	return false
+}
+
 // Keepalive enables sending keepalives at a given frequency
 func (q *Query) Keepalive(fn func(), interval time.Duration) *Query {
 	q.keepaliveFn = fn
@@ -0,0 +1,434 @@
+// Package check verifies the integrity of an entire goDB, i.e. the consistency of the metadata and of
+// all blocks of every (daily) directory of all interfaces (c.f. inspect.Verify()), and optionally
+// quarantines corrupt blocks.
+//
+// Quarantining moves a corrupt directory to a quarantine location outside of the goDB (retaining the
+// original data for further analysis) and rewrites all of its consistent blocks to the original location,
+// so that queries are no longer affected by the corrupt blocks. Since the goDB is modified, quarantining
+// should only be performed while goProbe is stopped.
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/inspect"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// Report summarizes the integrity check of a goDB
+type Report struct {
+	Path      string `json:"path"`
+	NumIfaces int    `json:"num_ifaces"`
+	NumDirs   int    `json:"num_dirs"`
+	NumBlocks int    `json:"num_blocks"`
+	Corrupt   []Dir  `json:"corrupt,omitempty"`
+
+	// NumQuarantined denotes the number of blocks quarantined (if quarantining is enabled)
+	NumQuarantined int `json:"num_quarantined_blocks,omitempty"`
+}
+
+// NumIssues returns the total number of issues found in all directories
+func (r *Report) NumIssues() (n int) {
+	for _, dir := range r.Corrupt {
+		n += len(dir.Issues)
+	}
+	return
+}
+
+// Dir denotes a (daily) directory of the goDB found to be inconsistent
+type Dir struct {
+	Iface     string          `json:"iface"`
+	Path      string          `json:"path"` // Path denotes the path of the directory relative to the goDB
+	NumBlocks int             `json:"num_blocks"`
+	Issues    []inspect.Issue `json:"issues"`
+
+	// CorruptBlocks denotes the timestamps of all corrupt blocks. If the directory cannot be opened at all,
+	// it holds no blocks and the whole directory is considered corrupt
+	CorruptBlocks []int64 `json:"corrupt_blocks,omitempty"`
+
+	// Quarantine denotes the path the original directory was moved to (if quarantined)
+	Quarantine string `json:"quarantine,omitempty"`
+}
+
+// Option configures an integrity check
+type Option func(*checker)
+
+// WithIfaces restricts the check to the given interfaces (defaults to all interfaces of the goDB)
+func WithIfaces(ifaces ...string) Option {
+	return func(c *checker) {
+		c.ifaces = ifaces
+	}
+}
+
+// WithQuarantine enables quarantining corrupt blocks to the given directory, which must not be
+// located inside the goDB
+func WithQuarantine(dir string) Option {
+	return func(c *checker) {
+		c.quarantine = filepath.Clean(dir)
+	}
+}
+
+// WithPermissions sets the permissions of the files written when rewriting quarantined directories
+func WithPermissions(permissions fs.FileMode) Option {
+	return func(c *checker) {
+		c.permissions = permissions
+	}
+}
+
+// WithWorkers sets the number of directories checked in parallel (defaults to the number of CPUs)
+func WithWorkers(n int) Option {
+	return func(c *checker) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+type checker struct {
+	dbPath      string
+	ifaces      []string
+	quarantine  string
+	permissions fs.FileMode
+	workers     int
+
+	report Report
+	sync.Mutex
+}
+
+// dirJob denotes a (daily) directory of the goDB to check
+type dirJob struct {
+	iface     string
+	relPath   string // relPath denotes the path relative to the goDB (including the metadata suffix)
+	timestamp int64
+	suffix    string
+}
+
+// Run checks the integrity of all directories of the goDB located at dbPath and returns a report
+// of all inconsistencies found. Cancelling the context stops the check after the directories
+// currently being checked (returning the partial report)
+func Run(ctx context.Context, dbPath string, opts ...Option) (*Report, error) {
+	c := &checker{
+		dbPath:      filepath.Clean(dbPath),
+		permissions: goDB.DefaultPermissions,
+		workers:     runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.report.Path = c.dbPath
+
+	if c.quarantine != "" {
+		if rel, err := filepath.Rel(c.dbPath, c.quarantine); err == nil && !strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("quarantine %s must not be located inside the DB", c.quarantine)
+		}
+	}
+
+	jobs, err := c.listDirs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directories: %w", err)
+	}
+	c.report.NumDirs = len(jobs)
+
+	if err := c.checkDirs(ctx, jobs); err != nil {
+		return &c.report, err
+	}
+
+	slices.SortFunc(c.report.Corrupt, func(a, b Dir) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	// the manifest (if any) no longer reflects the quarantined data
+	if slices.ContainsFunc(c.report.Corrupt, func(dir Dir) bool { return dir.Quarantine != "" }) {
+		if err := c.rebuildManifest(); err != nil {
+			return &c.report, err
+		}
+	}
+
+	return &c.report, nil
+}
+
+func (c *checker) checkDirs(ctx context.Context, jobs []dirJob) error {
+	var (
+		jobChan  = make(chan dirJob)
+		errChan  = make(chan error, c.workers)
+		wg       sync.WaitGroup
+		firstErr error
+	)
+
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				if err := c.checkDir(job); err != nil {
+					errChan <- fmt.Errorf("failed to check directory %s: %w", job.relPath, err)
+					return
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, job := range jobs {
+		select {
+		case jobChan <- job:
+		case firstErr = <-errChan:
+			break dispatch
+		case <-ctx.Done():
+			firstErr = ctx.Err()
+			break dispatch
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+
+	if firstErr == nil {
+		select {
+		case firstErr = <-errChan:
+		default:
+		}
+	}
+	return firstErr
+}
+
+// checkDir verifies a single directory and quarantines its corrupt blocks (if enabled)
+func (c *checker) checkDir(job dirJob) error {
+	var (
+		nBlocks int
+		dir     = Dir{Iface: job.iface, Path: job.relPath}
+	)
+
+	gpDir := gpfile.NewDirReader(filepath.Join(c.dbPath, job.iface), job.timestamp, job.suffix)
+	if err := gpDir.Open(); err != nil {
+		dir.Issues = []inspect.Issue{{Message: fmt.Sprintf("failed to open directory: %s", err)}}
+	} else {
+		nBlocks = gpDir.NBlocks()
+		dir.NumBlocks = nBlocks
+		dir.Issues = inspect.Verify(gpDir)
+		for _, issue := range dir.Issues {
+			if issue.Timestamp != 0 && !slices.Contains(dir.CorruptBlocks, issue.Timestamp) {
+				dir.CorruptBlocks = append(dir.CorruptBlocks, issue.Timestamp)
+			}
+		}
+		if err := gpDir.Close(); err != nil {
+			return err
+		}
+	}
+
+	var numQuarantined int
+	if len(dir.Issues) > 0 && c.quarantine != "" {
+		var err error
+		if numQuarantined, err = c.quarantineDir(job, &dir); err != nil {
+			return fmt.Errorf("failed to quarantine directory: %w", err)
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.report.NumBlocks += nBlocks
+	c.report.NumQuarantined += numQuarantined
+	if len(dir.Issues) > 0 {
+		c.report.Corrupt = append(c.report.Corrupt, dir)
+	}
+	return nil
+}
+
+// quarantineDir moves a corrupt directory to the quarantine and rewrites all of its consistent blocks
+// to the original location, returning the number of blocks quarantined. If rewriting fails, the original
+// directory is restored
+func (c *checker) quarantineDir(job dirJob, dir *Dir) (int, error) {
+	src, dst := filepath.Join(c.dbPath, job.relPath), filepath.Join(c.quarantine, job.relPath)
+
+	// #nosec G301
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return 0, err
+	}
+	dir.Quarantine = dst
+
+	// a directory which cannot be opened (or holds no blocks) is quarantined as a whole
+	if dir.NumBlocks == 0 {
+		return 0, nil
+	}
+
+	numRewritten, err := c.rewriteDir(job, dir.CorruptBlocks)
+	if err != nil {
+		if rmErr := removeDir(filepath.Join(c.dbPath, filepath.Dir(job.relPath)), job.timestamp); rmErr != nil {
+			return 0, errors.Join(err, rmErr)
+		}
+		if mvErr := os.Rename(dst, src); mvErr != nil {
+			return 0, errors.Join(err, mvErr)
+		}
+		dir.Quarantine = ""
+		return 0, err
+	}
+	return dir.NumBlocks - numRewritten, nil
+}
+
+// rewriteDir rewrites all blocks of a quarantined directory except for the corrupt ones to the
+// original location, returning the number of blocks rewritten
+func (c *checker) rewriteDir(job dirJob, corruptBlocks []int64) (n int, err error) {
+	src := gpfile.NewDirReader(filepath.Join(c.quarantine, job.iface), job.timestamp, job.suffix)
+	if err := src.Open(); err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	// The origin of the data (if any) is retained
+	origin, err := src.Origin()
+	if err != nil {
+		return 0, err
+	}
+	dstOpts := []gpfile.Option{gpfile.WithPermissions(c.permissions), gpfile.WithEncoderTypeLevel(encoders.EncoderTypeLZ4, 0)}
+	if origin != nil {
+		dstOpts = append(dstOpts, gpfile.WithOrigin(*origin))
+	}
+
+	var dst *gpfile.GPDir
+	for blockIdx := 0; blockIdx < src.NBlocks(); blockIdx++ {
+		timestamp := src.BlockMetadata[types.SIPColIdx].BlockList[blockIdx].Timestamp
+		if slices.Contains(corruptBlocks, timestamp) || blockIdx >= len(src.BlockTraffic) {
+			continue
+		}
+		data, issues := inspect.ReadBlock(src, blockIdx)
+		if len(issues) > 0 {
+			continue
+		}
+
+		var deltaPacked []types.ColumnIndex
+		for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+			if len(data[colIdx]) > 0 && src.DeltaPackedAtIndex(colIdx, blockIdx) {
+				deltaPacked = append(deltaPacked, colIdx)
+			}
+		}
+
+		// The counters are only stored in aggregate per directory, hence they are recomputed
+		// from the blocks
+		var counters types.Counters
+		for colIdx, counter := range map[types.ColumnIndex]*uint64{
+			types.BytesRcvdColIdx:   &counters.BytesRcvd,
+			types.BytesSentColIdx:   &counters.BytesSent,
+			types.PacketsRcvdColIdx: &counters.PacketsRcvd,
+			types.PacketsSentColIdx: &counters.PacketsSent,
+		} {
+			if len(data[colIdx]) == 0 {
+				continue
+			}
+			for _, v := range deltapack.Unpack(data[colIdx], src.DeltaPackedAtIndex(colIdx, blockIdx)) {
+				*counter += v
+			}
+		}
+
+		// The directory is only created if at least one block is consistent
+		if dst == nil {
+			dst = gpfile.NewDirWriter(filepath.Join(c.dbPath, job.iface), job.timestamp, dstOpts...)
+			if err := dst.Open(); err != nil {
+				return 0, err
+			}
+		}
+		if err := dst.WriteBlocks(timestamp, src.BlockTraffic[blockIdx], src.BlockOrderAtIndex(blockIdx), counters, data, deltaPacked...); err != nil {
+			_ = dst.Close()
+			return 0, err
+		}
+		n++
+	}
+	if dst != nil {
+		if err := dst.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// rebuildManifest rebuilds the manifest of the goDB (if it has one)
+func (c *checker) rebuildManifest() error {
+	if _, err := os.Stat(filepath.Join(c.dbPath, info.ManifestFileName)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	manifest, err := info.BuildManifest(c.dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to build manifest: %w", err)
+	}
+	return manifest.Write(c.dbPath, c.permissions)
+}
+
+// listDirs returns all (daily) directories of the interfaces to check (in chronological order per
+// interface)
+func (c *checker) listDirs() ([]dirJob, error) {
+	ifaces := c.ifaces
+	if len(ifaces) == 0 {
+		var err error
+		if ifaces, err = info.GetInterfaces(c.dbPath); err != nil {
+			return nil, err
+		}
+	}
+	c.report.NumIfaces = len(ifaces)
+
+	var jobs []dirJob
+	for _, iface := range ifaces {
+		dayPaths, err := filepath.Glob(filepath.Join(c.dbPath, iface, "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, dayPath := range dayPaths {
+			timestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dayPath))
+			if err != nil {
+				continue
+			}
+			relPath, err := filepath.Rel(c.dbPath, dayPath)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, dirJob{
+				iface:     iface,
+				relPath:   relPath,
+				timestamp: timestamp,
+				suffix:    suffix,
+			})
+		}
+	}
+	return jobs, nil
+}
+
+// removeDir removes the directory for the given timestamp (regardless of its metadata suffix) from
+// a month directory
+func removeDir(monthPath string, timestamp int64) error {
+	dirents, err := os.ReadDir(monthPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, dirent := range dirents {
+		if ts, _, err := gpfile.ExtractTimestampMetadataSuffix(dirent.Name()); err == nil && ts == timestamp {
+			if err := os.RemoveAll(filepath.Join(monthPath, dirent.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
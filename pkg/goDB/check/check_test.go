@@ -0,0 +1,136 @@
+package check
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTimestamp = int64(1700000000)
+	testInterval  = int64(300)
+	testBlocks    = 4
+)
+
+func TestCheck(t *testing.T) {
+	dbPath := t.TempDir()
+	writeTestDB(t, dbPath)
+
+	report, err := Run(context.Background(), dbPath)
+	require.Nil(t, err)
+	require.Equal(t, 2, report.NumIfaces)
+	require.Equal(t, 3, report.NumDirs)
+	require.Equal(t, 3*testBlocks, report.NumBlocks)
+	require.Empty(t, report.Corrupt)
+	require.Zero(t, report.NumIssues())
+
+	// corrupt the last block of the first day of eth0 and the metadata of eth1
+	eth0Dirs := dirPaths(t, dbPath, "eth0")
+	dportPath := filepath.Join(eth0Dirs[0], types.ColumnFileNames[types.DportColIdx]+gpfile.FileSuffix)
+	stat, err := os.Stat(dportPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(dportPath, stat.Size()-1))
+
+	// (including its previous generation, which would allow recovering it otherwise)
+	eth1Dirs := dirPaths(t, dbPath, "eth1")
+	require.Nil(t, os.WriteFile(filepath.Join(eth1Dirs[0], gpfile.MetadataFileName), []byte("corrupt"), 0600))
+	require.Nil(t, os.Remove(filepath.Join(eth1Dirs[0], gpfile.MetadataFileName+gpfile.MetadataPrevFileSuffix)))
+
+	report, err = Run(context.Background(), dbPath, WithWorkers(1))
+	require.Nil(t, err)
+	require.Len(t, report.Corrupt, 2)
+	require.Equal(t, 2, report.NumIssues())
+
+	corruptEth0, corruptEth1 := report.Corrupt[0], report.Corrupt[1]
+	require.Equal(t, "eth0", corruptEth0.Iface)
+	require.Equal(t, testBlocks, corruptEth0.NumBlocks)
+	require.Equal(t, []int64{testTimestamp + (testBlocks-1)*testInterval}, corruptEth0.CorruptBlocks)
+	require.Equal(t, types.ColumnFileNames[types.DportColIdx], corruptEth0.Issues[0].Column)
+	require.Empty(t, corruptEth0.Quarantine)
+
+	require.Equal(t, "eth1", corruptEth1.Iface)
+	require.Zero(t, corruptEth1.NumBlocks)
+	require.Empty(t, corruptEth1.CorruptBlocks)
+
+	// the check is restricted to the requested interfaces
+	report, err = Run(context.Background(), dbPath, WithIfaces("eth1"))
+	require.Nil(t, err)
+	require.Equal(t, 1, report.NumDirs)
+	require.Len(t, report.Corrupt, 1)
+
+	// the quarantine must reside outside of the DB
+	_, err = Run(context.Background(), dbPath, WithQuarantine(filepath.Join(dbPath, "quarantine")))
+	require.NotNil(t, err)
+
+	quarantine := t.TempDir()
+	report, err = Run(context.Background(), dbPath, WithQuarantine(quarantine))
+	require.Nil(t, err)
+	require.Len(t, report.Corrupt, 2)
+	require.Equal(t, 1, report.NumQuarantined)
+	for _, dir := range report.Corrupt {
+		require.Equal(t, filepath.Join(quarantine, dir.Path), dir.Quarantine)
+		require.DirExists(t, dir.Quarantine)
+	}
+
+	// the consistent blocks of eth0 have been rewritten, whereas eth1 has been quarantined as a whole
+	report, err = Run(context.Background(), dbPath)
+	require.Nil(t, err)
+	require.Empty(t, report.Corrupt)
+	require.Equal(t, 2, report.NumDirs)
+	require.Equal(t, 2*testBlocks-1, report.NumBlocks)
+
+	// the manifest reflects the quarantined data
+	manifest, err := info.ReadManifest(dbPath)
+	require.Nil(t, err)
+	require.NotContains(t, manifest.Interfaces, "eth1")
+	require.Contains(t, manifest.Interfaces, "eth0")
+}
+
+// writeTestDB writes two days of testBlocks blocks for eth0 and a single one for eth1 (including a
+// manifest)
+func writeTestDB(t *testing.T, dbPath string) {
+	t.Helper()
+
+	for iface, days := range map[string]int64{"eth0": 2, "eth1": 1} {
+		w := goDB.NewDBWriter(dbPath, iface, encoders.EncoderTypeLZ4)
+		for day := int64(0); day < days; day++ {
+			for i := int64(0); i < testBlocks; i++ {
+				require.Nil(t, w.Write(testFlows(byte(i)), capturetypes.CaptureStats{}, testTimestamp+day*gpfile.EpochDay+i*testInterval))
+			}
+		}
+	}
+
+	manifest, err := info.BuildManifest(dbPath)
+	require.Nil(t, err)
+	require.Nil(t, manifest.Write(dbPath, goDB.DefaultPermissions))
+}
+
+func dirPaths(t *testing.T, dbPath, iface string) []string {
+	t.Helper()
+
+	dirs, err := filepath.Glob(filepath.Join(dbPath, iface, "*", "*", "*"))
+	require.Nil(t, err)
+	require.NotEmpty(t, dirs)
+	return dirs
+}
+
+func testFlows(n byte) *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	for i := byte(0); i <= n; i++ {
+		m.PrimaryMap.Set(types.NewV4KeyStatic(
+			[4]byte{10, 0, 0, i},
+			[4]byte{10, 0, 1, i},
+			[]byte{1, 187}, 6), types.Counters{BytesRcvd: uint64(i) + 1, PacketsRcvd: 1})
+	}
+	return m
+}
@@ -0,0 +1,174 @@
+package node
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
+	"github.com/els0r/goProbe/pkg/goDB/conditions"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// IP protocols expressible by name in filter expressions (irrespective of the IP version)
+var bpfProtocols = map[byte]string{
+	6:   "tcp",
+	17:  "udp",
+	132: "sctp",
+}
+
+// ToBPFFilter translates the given conditional into the closest equivalent tcpdump-style filter expression
+// (as supported by capture filters, c.f. bpffilter.Compile), e.g. "host = 10.0.0.1 & dport != 22" into
+// "host 10.0.0.1 and not port 22". The conditional is sanitized and parsed like the one of a query
+// (including resolving hostnames, see ParseAndInstrument).
+//
+// Since flows comprise the packets of both directions, the source / destination IP and the port of a flow
+// are matched irrespective of the direction of a packet. Conditions without any equivalent (e.g. on the
+// VLAN or the traffic direction) are dropped, such that the filter matches (at least) all packets of the
+// flows matching the conditional. Each approximation is reported as warning
+func ToBPFFilter(conditional string, dnsTimeout time.Duration, opts ...ParseOption) (*bpffilter.Translation, error) {
+	conditionalNode, valFilterNode, err := ParseAndInstrument(conditions.SanitizeUserInput(conditional), dnsTimeout, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(bpffilter.Translation)
+	if valFilterNode.FilterType != types.FilterKeywordNone {
+		t.Warn("%s: cannot be translated (filter expressions are evaluated on individual packets)", valFilterNode.conditionNode)
+	}
+	if conditionalNode == nil {
+		return t.Finalize(""), nil
+	}
+
+	expr, matchesAll := toBPFFilter(conditionalNode, t)
+	if matchesAll {
+		t.Warn("no part of the conditional could be translated")
+		return t.Finalize(""), nil
+	}
+	return t.Finalize(expr), nil
+}
+
+// toBPFFilter translates a node of a conditional in negation normal form. If the node cannot be
+// translated, it matches all packets (which is reported via matchesAll)
+func toBPFFilter(node Node, t *bpffilter.Translation) (expr string, matchesAll bool) {
+	switch node := node.(type) {
+	case conditionNode:
+		return node.toBPFFilter(t)
+	case andNode:
+		if primitive, isSame := sameHostOrNet(node.left, node.right, "!="); isSame {
+			return "not " + primitive, false
+		}
+		left, leftMatchesAll := toBPFFilter(node.left, t)
+		right, rightMatchesAll := toBPFFilter(node.right, t)
+		switch {
+		case leftMatchesAll:
+			return right, rightMatchesAll
+		case rightMatchesAll:
+			return left, false
+		}
+		return "(" + left + " and " + right + ")", false
+	case orNode:
+		if primitive, isSame := sameHostOrNet(node.left, node.right, "="); isSame {
+			return primitive, false
+		}
+		left, leftMatchesAll := toBPFFilter(node.left, t)
+		right, rightMatchesAll := toBPFFilter(node.right, t)
+		if leftMatchesAll || rightMatchesAll {
+			return "", true
+		}
+		return "(" + left + " or " + right + ")", false
+	}
+	panic(fmt.Sprintf("unexpected node type %T", node))
+}
+
+// sameHostOrNet determines if the nodes compare the source and destination IP / network against the
+// same value (as desugared from host / net conditions), which is exactly matched by the returned host /
+// net primitive
+func sameHostOrNet(left, right Node, comparator string) (string, bool) {
+	l, isCondition := left.(conditionNode)
+	if !isCondition {
+		return "", false
+	}
+	r, isCondition := right.(conditionNode)
+	if !isCondition || l.comparator != comparator || r.comparator != comparator || l.value != r.value {
+		return "", false
+	}
+	if (l.attribute != types.SIPName || r.attribute != types.DIPName) && (l.attribute != "snet" || r.attribute != "dnet") {
+		return "", false
+	}
+	primitive, err := l.bpfPrimitive()
+	return primitive, err == nil
+}
+
+// toBPFFilter translates a single condition (reporting approximations via the translation). Conditions
+// on the source / destination IP and the port are translated irrespective of the direction of packets
+func (n conditionNode) toBPFFilter(t *bpffilter.Translation) (expr string, matchesAll bool) {
+	primitive, err := n.bpfPrimitive()
+	if err != nil {
+		t.Warn("%s: cannot be translated (%s)", n, err)
+		return "", true
+	}
+
+	expr = primitive
+	if n.comparator == "!=" {
+		expr = "not " + primitive
+	}
+	switch n.attribute {
+	case types.SIPName, types.DIPName, "snet", "dnet":
+		t.Warn("%s: translated to `%s`, which doesn't distinguish the source and destination of packets", n, expr)
+	case types.DportName:
+		t.Warn("%s: translated to `%s`, which doesn't distinguish the source and destination port of packets (and only applies to TCP / UDP / SCTP)", n, expr)
+	}
+	return expr, false
+}
+
+// bpfPrimitive returns the primitive of a filter expression corresponding to the condition (disregarding
+// the negation of "!=" comparisons)
+func (n conditionNode) bpfPrimitive() (string, error) {
+	value, netmask, _, err := conditionBytesAndNetmask(n)
+	if err != nil {
+		return "", err
+	}
+
+	switch n.attribute {
+	case types.SIPName, types.DIPName, "snet", "dnet":
+		if n.comparator != "=" && n.comparator != "!=" {
+			return "", errors.New("IP addresses are not ordered in filter expressions")
+		}
+		addr, _ := netip.AddrFromSlice(value)
+		if n.attribute == types.SIPName || n.attribute == types.DIPName {
+			return "host " + addr.String(), nil
+		}
+		return "net " + netip.PrefixFrom(addr, netmask).Masked().String(), nil
+	case types.DportName:
+		port := int(binary.BigEndian.Uint16(value))
+		low, high := 0, 65535
+		switch n.comparator {
+		case "=", "!=":
+			return fmt.Sprintf("port %d", port), nil
+		case "<":
+			high = port - 1
+		case "<=":
+			high = port
+		case ">":
+			low = port + 1
+		case ">=":
+			low = port
+		}
+		if low > high {
+			return "", errors.New("the port range is empty")
+		}
+		return fmt.Sprintf("portrange %d-%d", low, high), nil
+	case types.ProtoName:
+		if n.comparator != "=" && n.comparator != "!=" {
+			return "", errors.New("IP protocols are not ordered in filter expressions")
+		}
+		if name, exists := bpfProtocols[value[0]]; exists {
+			return name, nil
+		}
+		return fmt.Sprintf("proto %d", value[0]), nil
+	}
+	return "", errors.New("the attribute is not part of the packet headers evaluated by filter expressions")
+}
@@ -0,0 +1,68 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/bpffilter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToBPFFilter(t *testing.T) {
+	for _, test := range []struct {
+		conditional string
+		filter      string
+		nWarnings   int
+	}{
+		{"", "", 0},
+		{"host = 10.0.0.1", "host 10.0.0.1", 0},
+		{"host != 2001:db8::1", "not host 2001:db8::1", 0},
+		{"net = 10.0.0.0/8 | proto = udp", "net 10.0.0.0/8 or udp", 0},
+		{"!(proto = 47 | proto = sctp)", "not proto 47 and not sctp", 0},
+		{"sip = 10.0.0.1 & dip = 10.0.0.2", "host 10.0.0.1 and host 10.0.0.2", 2},
+		{"host = 10.0.0.1 & dport != 22", "host 10.0.0.1 and not port 22", 1},
+		{"proto = tcp & !(dport >= 1024)", "tcp and portrange 0-1023", 1},
+		{"dport > 1023", "portrange 1024-65535", 1},
+		{"!(host = 10.0.0.1) & vlan = 5", "not host 10.0.0.1", 1},
+		{"dir = in & proto = 47", "proto 47", 1},
+		{"dport < 0 & proto = udp", "udp", 1},
+		{"proto > 6", "", 2},
+		{"vlan = 1 | dport = 53", "", 3},
+		{"dscp = ef", "", 2},
+	} {
+		t.Run(test.conditional, func(t *testing.T) {
+			translation, err := ToBPFFilter(test.conditional, 0)
+			require.Nil(t, err)
+			require.Equal(t, test.filter, translation.Result)
+			require.Len(t, translation.Warnings, test.nWarnings)
+			require.Equal(t, test.nWarnings == 0, translation.Exact)
+
+			// the result is a valid capture filter
+			if translation.Result != "" {
+				_, err = bpffilter.Compile(translation.Result, 0)
+				require.Nil(t, err)
+			}
+		})
+	}
+
+	_, err := ToBPFFilter("dport = 80 &", 0)
+	require.NotNil(t, err)
+}
+
+func TestBPFFilterRoundTrip(t *testing.T) {
+	for _, filter := range []string{
+		"host 10.0.0.1 and not udp",
+		"net 10.0.0.0/8 or net 2001:db8::/32",
+		"not proto 47 and not host 192.168.1.1",
+	} {
+		t.Run(filter, func(t *testing.T) {
+			condition, err := bpffilter.ToCondition(filter)
+			require.Nil(t, err)
+			require.True(t, condition.Exact)
+
+			translation, err := ToBPFFilter(condition.Result, 0)
+			require.Nil(t, err)
+			require.True(t, translation.Exact)
+			require.Equal(t, filter, translation.Result)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package node
+
+import (
+	"errors"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+// flowFilterResolveTimeout denotes the timeout for resolving hostnames in a flow filter. Since
+// hostnames are resolved only once when the filter is created, it is generous compared to queries
+const flowFilterResolveTimeout = 5 * time.Second
+
+var (
+	errEmptyFlowFilter     = errors.New("empty flow filter")
+	errFlowFilterDirection = errors.New("direction conditions are not supported in flow filters")
+	errFlowFilterLabel     = errors.New("vlan / mac / flags / dscp conditions are not supported in flow filters")
+)
+
+// FlowFilter evaluates a conditional against the keys of in-memory flow maps (e.g. the flows captured
+// during a writeout interval), allowing to restrict the flows handed to a writeout sink
+type FlowFilter struct {
+	conditional Node
+	ipVersion   types.IPVersion
+}
+
+// NewFlowFilter parses and instruments the given conditional for evaluation against flow keys. In contrast
+// to queries, direction conditions (e.g. "dir = in") are not supported since they refer to the counters
+// of a flow rather than its key (the same applies to vlan / mac / flags / dscp conditions, since neither the
+// VLAN, the MAC addresses, the TCP flags nor the DSCP are part of the key)
+func NewFlowFilter(conditional string) (*FlowFilter, error) {
+	conditionalNode, valFilterNode, err := ParseAndInstrument(conditional, flowFilterResolveTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if valFilterNode != nil && valFilterNode.ValFilter != nil {
+		return nil, errFlowFilterDirection
+	}
+	if conditionalNode == nil {
+		return nil, errEmptyFlowFilter
+	}
+	for _, label := range []string{types.VLANName, types.SMACName, types.DMACName, types.TCPFlagsName, types.DSCPName} {
+		if _, hasLabel := conditionalNode.Attributes()[label]; hasLabel {
+			return nil, errFlowFilterLabel
+		}
+	}
+
+	f := &FlowFilter{conditional: conditionalNode}
+	for _, ipVersion := range conditionalNode.Attributes() {
+		f.ipVersion = f.ipVersion.Merge(ipVersion)
+	}
+	return f, nil
+}
+
+// String returns the (instrumented) conditional of the filter
+func (f *FlowFilter) String() string {
+	return f.conditional.String()
+}
+
+// Filter returns a new flow map containing only the flows of m satisfying the conditional. The
+// original map remains unchanged
+func (f *FlowFilter) Filter(m *hashmap.AggFlowMap) *hashmap.AggFlowMap {
+	res := hashmap.NewAggFlowMap()
+	if m == nil {
+		return res
+	}
+
+	// Conditions on IPv4 addresses / networks can never be satisfied by IPv6 flows and vice versa (and
+	// evaluating them against keys of the other IP version would compare unrelated bytes)
+	if f.ipVersion != types.IPVersionV6 {
+		f.filter(m.PrimaryMap, res.PrimaryMap)
+	}
+	if f.ipVersion != types.IPVersionV4 {
+		f.filter(m.SecondaryMap, res.SecondaryMap)
+	}
+
+	return res
+}
+
+func (f *FlowFilter) filter(src, dst *hashmap.Map) {
+
+	// Some conditions (e.g. network conditions) modify the key during evaluation, hence it is
+	// evaluated on a copy
+	var comparisonValue types.ExtendedKey
+	for it := src.Iter(); it.Next(); {
+		comparisonValue = append(comparisonValue[:0], it.Key()...)
+		if f.conditional.Evaluate(comparisonValue) {
+			dst.Set(it.Key(), it.Val())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowFilter(t *testing.T) {
+	var (
+		internalV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0, 53}, 17)
+		externalV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6)
+		externalV6 = types.NewV6KeyStatic([16]byte{0x20, 0x01, 15: 1}, [16]byte{0x2a, 0x00, 15: 2}, []byte{1, 187}, 6)
+	)
+
+	m := hashmap.NewAggFlowMap()
+	m.PrimaryMap.Set(internalV4, types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+	m.PrimaryMap.Set(externalV4, types.Counters{BytesSent: 200, PacketsSent: 2})
+	m.SecondaryMap.Set(externalV6, types.Counters{BytesSent: 300, PacketsSent: 3})
+
+	for _, test := range []struct {
+		conditional string
+		expected    []types.Key
+	}{
+		{"dport = 443", []types.Key{externalV4, externalV6}},
+		{"proto = udp", []types.Key{internalV4}},
+		{"! dnet = 10.0.0.0/8", []types.Key{externalV4}},
+		{"snet = 2001::/16", []types.Key{externalV6}},
+		{"dport = 53 | dport = 443", []types.Key{internalV4, externalV4, externalV6}},
+
+		// as with queries, conditions on IPv4 addresses / networks restrict the filter to IPv4 flows
+		{"dnet = 10.0.0.0/8 | dport = 443", []types.Key{internalV4, externalV4}},
+	} {
+		t.Run(test.conditional, func(t *testing.T) {
+			f, err := NewFlowFilter(test.conditional)
+			require.Nil(t, err)
+
+			filtered := f.Filter(m)
+			require.Equal(t, len(test.expected), filtered.PrimaryMap.Len()+filtered.SecondaryMap.Len())
+			for _, key := range test.expected {
+				flows := filtered.PrimaryMap
+				if !key.IsIPv4() {
+					flows = filtered.SecondaryMap
+				}
+				_, exists := flows.Get(key)
+				require.True(t, exists, "flow %s missing", key)
+			}
+
+			// the original flows must remain unchanged
+			require.Equal(t, 2, m.PrimaryMap.Len())
+			require.Equal(t, 1, m.SecondaryMap.Len())
+			_, exists := m.PrimaryMap.Get(externalV4)
+			require.True(t, exists)
+		})
+	}
+}
+
+func TestFlowFilterInvalid(t *testing.T) {
+	for _, conditional := range []string{"", "dport = 80 &", "dir = in", "dir = out & proto = TCP", "vlan = 100", "dport = 53 | vlan != 1", "smac = aa:bb:cc:00:11:22", "dmac != 00:11:22:33:44:55 & dport = 443", "flags = syn & !ack", "dscp = ef"} {
+		_, err := NewFlowFilter(conditional)
+		require.Error(t, err, conditional)
+	}
+}
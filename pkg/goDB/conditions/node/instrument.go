@@ -18,6 +18,7 @@ package node
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
@@ -50,6 +51,11 @@ func generateCompareValue(condition *conditionNode) error {
 		err       error
 	)
 
+	// custom attributes are compared by their derived value instead of their binary representation
+	if plugin, isCustom := types.GetAttributePlugin(condition.attribute); isCustom {
+		return generateCustomCompareValue(condition, plugin)
+	}
+
 	if value, netmask, ipVersion, err = conditionBytesAndNetmask(*condition); err != nil {
 		return err
 	}
@@ -62,12 +68,12 @@ func generateCompareValue(condition *conditionNode) error {
 		condition.ipVersion = ipVersion
 		switch condition.comparator {
 		case "=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Equal(currentValue.GetSIP(), value)
 			}
 			return nil
 		case "!=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return !bytes.Equal(currentValue.GetSIP(), value)
 			}
 			return nil
@@ -78,12 +84,12 @@ func generateCompareValue(condition *conditionNode) error {
 		condition.ipVersion = ipVersion
 		switch condition.comparator {
 		case "=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Equal(currentValue.GetDIP(), value)
 			}
 			return nil
 		case "!=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return !bytes.Equal(currentValue.GetDIP(), value)
 			}
 			return nil
@@ -109,7 +115,7 @@ func generateCompareValue(condition *conditionNode) error {
 			// NOT EQUALS TO makes sense
 			switch condition.comparator {
 			case "=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					ip := currentValue
 					// apply the netmask on the relevant byte in order to obtain
 					// the network address
@@ -119,7 +125,7 @@ func generateCompareValue(condition *conditionNode) error {
 				}
 				return nil
 			case "!=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					ip := currentValue
 					// apply the netmask on the relevant byte in order to obtain
 					// the network address
@@ -136,12 +142,12 @@ func generateCompareValue(condition *conditionNode) error {
 			// comparison
 			switch condition.comparator {
 			case "=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					return bytes.Equal(currentValue.GetSIP()[:index], value[:index])
 				}
 				return nil
 			case "!=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					return !bytes.Equal(currentValue.GetSIP()[:index], value[:index])
 				}
 				return nil
@@ -168,7 +174,7 @@ func generateCompareValue(condition *conditionNode) error {
 			// NOT EQUALS TO makes sense
 			switch condition.comparator {
 			case "=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					ip := currentValue
 					// apply the netmask on the relevant byte in order to obtain
 					// the network address
@@ -178,7 +184,7 @@ func generateCompareValue(condition *conditionNode) error {
 				}
 				return nil
 			case "!=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					ip := currentValue
 					// apply the netmask on the relevant byte in order to obtain
 					// the network address
@@ -195,12 +201,12 @@ func generateCompareValue(condition *conditionNode) error {
 			// comparison
 			switch condition.comparator {
 			case "=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					return bytes.Equal(currentValue.GetDIP()[:index], value[:index])
 				}
 				return nil
 			case "!=":
-				condition.compareValue = func(currentValue types.Key) bool {
+				condition.compareValue = func(currentValue types.ExtendedKey) bool {
 					return !bytes.Equal(currentValue.GetDIP()[:index], value[:index])
 				}
 				return nil
@@ -211,32 +217,32 @@ func generateCompareValue(condition *conditionNode) error {
 	case types.DportName:
 		switch condition.comparator {
 		case "=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Equal(currentValue.GetDport(), value[:types.DportSizeof])
 			}
 			return nil
 		case "!=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return !bytes.Equal(currentValue.GetDport(), value[:types.DportSizeof])
 			}
 			return nil
 		case "<":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Compare(currentValue.GetDport(), value[:types.DportSizeof]) < 0
 			}
 			return nil
 		case ">":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Compare(currentValue.GetDport(), value[:types.DportSizeof]) > 0
 			}
 			return nil
 		case "<=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Compare(currentValue.GetDport(), value[:types.DportSizeof]) <= 0
 			}
 			return nil
 		case ">=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return bytes.Compare(currentValue.GetDport(), value[:types.DportSizeof]) >= 0
 			}
 			return nil
@@ -246,43 +252,186 @@ func generateCompareValue(condition *conditionNode) error {
 	case types.ProtoName:
 		switch condition.comparator {
 		case "=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return currentValue.GetProto() == value[0]
 			}
 			return nil
 		case "!=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return currentValue.GetProto() != value[0]
 			}
 			return nil
 		case "<":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return currentValue.GetProto() < value[0]
 			}
 			return nil
 		case ">":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return currentValue.GetProto() > value[0]
 			}
 			return nil
 		case "<=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return currentValue.GetProto() <= value[0]
 			}
 			return nil
 		case ">=":
-			condition.compareValue = func(currentValue types.Key) bool {
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
 				return currentValue.GetProto() >= value[0]
 			}
 			return nil
 		default:
 			return fmt.Errorf("comparator %q not allowed for attribute %q", condition.comparator, condition.attribute)
 		}
+	case types.VLANName:
+		vlan := binary.BigEndian.Uint16(value)
+		switch condition.comparator {
+		case "=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrVLAN()
+				return current == vlan
+			}
+			return nil
+		case "!=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrVLAN()
+				return current != vlan
+			}
+			return nil
+		case "<":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrVLAN()
+				return current < vlan
+			}
+			return nil
+		case ">":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrVLAN()
+				return current > vlan
+			}
+			return nil
+		case "<=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrVLAN()
+				return current <= vlan
+			}
+			return nil
+		case ">=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrVLAN()
+				return current >= vlan
+			}
+			return nil
+		default:
+			return fmt.Errorf("comparator %q not allowed for attribute %q", condition.comparator, condition.attribute)
+		}
+	case types.SMACName, types.DMACName:
+		mac, attrMAC := types.MAC(value), types.ExtendedKey.AttrSMAC
+		if condition.attribute == types.DMACName {
+			attrMAC = types.ExtendedKey.AttrDMAC
+		}
+		switch condition.comparator {
+		case "=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := attrMAC(currentValue)
+				return current == mac
+			}
+			return nil
+		case "!=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := attrMAC(currentValue)
+				return current != mac
+			}
+			return nil
+		default:
+			return fmt.Errorf("comparator %q not allowed for attribute %q", condition.comparator, condition.attribute)
+		}
+	case types.TCPFlagsName:
+		mask, want := types.TCPFlags(value[0]), types.TCPFlags(value[1])
+		switch condition.comparator {
+		case "=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrTCPFlags()
+				return current&mask == want
+			}
+			return nil
+		case "!=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrTCPFlags()
+				return current&mask != want
+			}
+			return nil
+		default:
+			return fmt.Errorf("comparator %q not allowed for attribute %q", condition.comparator, condition.attribute)
+		}
+	case types.DSCPName:
+		dscp := types.DSCP(value[0])
+		switch condition.comparator {
+		case "=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrDSCP()
+				return current == dscp
+			}
+			return nil
+		case "!=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrDSCP()
+				return current != dscp
+			}
+			return nil
+		case "<":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrDSCP()
+				return current < dscp
+			}
+			return nil
+		case ">":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrDSCP()
+				return current > dscp
+			}
+			return nil
+		case "<=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrDSCP()
+				return current <= dscp
+			}
+			return nil
+		case ">=":
+			condition.compareValue = func(currentValue types.ExtendedKey) bool {
+				current, _ := currentValue.AttrDSCP()
+				return current >= dscp
+			}
+			return nil
+		default:
+			return fmt.Errorf("comparator %q not allowed for attribute %q", condition.comparator, condition.attribute)
+		}
 	default:
 		return fmt.Errorf("unknown attribute %q", condition.attribute)
 	}
 }
 
+// Generates the comparison closure for a custom attribute. Since conditions are lowercased
+// during sanitization, the derived value is compared case-insensitively
+func generateCustomCompareValue(condition *conditionNode, plugin types.AttributePlugin) error {
+	value := condition.value
+	switch condition.comparator {
+	case "=":
+		condition.compareValue = func(currentValue types.ExtendedKey) bool {
+			return strings.EqualFold(plugin.Derive(currentValue.Key()), value)
+		}
+		return nil
+	case "!=":
+		condition.compareValue = func(currentValue types.ExtendedKey) bool {
+			return !strings.EqualFold(plugin.Derive(currentValue.Key()), value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("comparator %q not allowed for attribute %q", condition.comparator, condition.attribute)
+	}
+}
+
 // conditionBytesAndNetmask returns the database's binary representation of the
 // value of the given condition. It also validates the condition using attribute specific
 // validation logic  (e.g. no IPv4 address with digits greater than 255).
@@ -385,6 +534,36 @@ func conditionBytesAndNetmask(condition conditionNode) ([]byte, int, types.IPVer
 			}
 
 			condBytes = []byte{uint8(num >> 8), uint8(num & 0xff)}
+		case types.VLANName:
+			if num, err = strconv.ParseUint(value, 10, 16); err != nil {
+				return nil, 0, types.IPVersionNone, fmt.Errorf("could not parse vlan value: %w", err)
+			}
+			if num > types.MaxVLAN {
+				return nil, 0, types.IPVersionNone, fmt.Errorf("invalid vlan value %d: the maximum VLAN ID is %d", num, types.MaxVLAN)
+			}
+
+			condBytes = []byte{uint8(num >> 8), uint8(num & 0xff)}
+		case types.SMACName, types.DMACName:
+			mac, err := types.ParseMAC(value)
+			if err != nil {
+				return nil, 0, types.IPVersionNone, fmt.Errorf("could not parse %s value: %w", attribute, err)
+			}
+
+			condBytes = mac[:]
+		case types.TCPFlagsName:
+			mask, want, err := types.ParseTCPFlagsCondition(value)
+			if err != nil {
+				return nil, 0, types.IPVersionNone, fmt.Errorf("could not parse %s value: %w", attribute, err)
+			}
+
+			condBytes = []byte{byte(mask), byte(want)}
+		case types.DSCPName:
+			dscp, err := types.ParseDSCP(value)
+			if err != nil {
+				return nil, 0, types.IPVersionNone, fmt.Errorf("could not parse %s value: %w", attribute, err)
+			}
+
+			condBytes = []byte{byte(dscp)}
 		default:
 			return nil, 0, types.IPVersionNone, fmt.Errorf("unknown attribute: %s", attribute)
 		}
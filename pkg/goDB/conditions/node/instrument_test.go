@@ -15,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
 )
 
 var IPStringToBytesTests = []struct {
@@ -129,6 +130,32 @@ var conditionBytesAndNetmaskTests = []struct {
 	{conditionNode{attribute: "dport", comparator: "=", value: "65536"}, nil, 0, types.IPVersionNone, false},
 	{conditionNode{attribute: "dport", comparator: "=", value: "-1"}, nil, 0, types.IPVersionNone, false},
 
+	// valid vlan
+	{conditionNode{attribute: "vlan", comparator: "=", value: "0"}, []byte{0, 0}, 0, types.IPVersionNone, true},
+	{conditionNode{attribute: "vlan", comparator: ">=", value: "4094"}, []byte{0x0F, 0xFE}, 0, types.IPVersionNone, true},
+	// invalid vlan
+	{conditionNode{attribute: "vlan", comparator: "=", value: "4095"}, nil, 0, types.IPVersionNone, false},
+	{conditionNode{attribute: "vlan", comparator: "=", value: "dmz"}, nil, 0, types.IPVersionNone, false},
+	// valid mac
+	{conditionNode{attribute: "smac", comparator: "=", value: "aa:bb:cc:00:11:22"}, []byte{0xaa, 0xbb, 0xcc, 0x00, 0x11, 0x22}, 0, types.IPVersionNone, true},
+	{conditionNode{attribute: "dmac", comparator: "!=", value: "aabb.cc00.1122"}, []byte{0xaa, 0xbb, 0xcc, 0x00, 0x11, 0x22}, 0, types.IPVersionNone, true},
+	// valid tcp flags
+	{conditionNode{attribute: "flags", comparator: "=", value: "syn&!ack"}, []byte{0x12, 0x02}, 0, types.IPVersionNone, true},
+	{conditionNode{attribute: "flags", comparator: "!=", value: "rst"}, []byte{0x04, 0x04}, 0, types.IPVersionNone, true},
+	// invalid tcp flags
+	{conditionNode{attribute: "flags", comparator: "=", value: "syn&!syn"}, nil, 0, types.IPVersionNone, false},
+	{conditionNode{attribute: "flags", comparator: "=", value: "0x02"}, nil, 0, types.IPVersionNone, false},
+	// valid dscp
+	{conditionNode{attribute: "dscp", comparator: "=", value: "46"}, []byte{46}, 0, types.IPVersionNone, true},
+	{conditionNode{attribute: "dscp", comparator: ">=", value: "af41"}, []byte{34}, 0, types.IPVersionNone, true},
+	{conditionNode{attribute: "dscp", comparator: "!=", value: "be"}, []byte{0}, 0, types.IPVersionNone, true},
+	// invalid dscp
+	{conditionNode{attribute: "dscp", comparator: "=", value: "64"}, nil, 0, types.IPVersionNone, false},
+	{conditionNode{attribute: "dscp", comparator: "=", value: "af44"}, nil, 0, types.IPVersionNone, false},
+	// invalid mac
+	{conditionNode{attribute: "smac", comparator: "=", value: "aa:bb:cc"}, nil, 0, types.IPVersionNone, false},
+	{conditionNode{attribute: "dmac", comparator: "=", value: "00:00:5e:10:00:00:00:01"}, nil, 0, types.IPVersionNone, false},
+
 	// wrong attribute
 	{conditionNode{attribute: "proto", comparator: "=", value: "leagueoflegends"}, nil, 0, types.IPVersionNone, false},
 }
@@ -153,3 +180,175 @@ func TestConditionBytesAndNetmask(t *testing.T) {
 		}
 	}
 }
+
+type testServicePlugin struct{}
+
+func (testServicePlugin) Name() string { return "service" }
+
+func (testServicePlugin) Columns() []types.ColumnIndex {
+	return []types.ColumnIndex{types.DportColIdx, types.ProtoColIdx}
+}
+
+func (testServicePlugin) Derive(key types.Key) string {
+	if key.GetProto() == 6 && types.PortToUint16(key.GetDport()) == 443 {
+		return "Web-Frontend"
+	}
+	return ""
+}
+
+func init() {
+	types.RegisterAttributePlugin(testServicePlugin{})
+}
+
+func TestCustomAttributeCondition(t *testing.T) {
+	var (
+		web = types.ExtendedKey(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6))
+		dns = types.ExtendedKey(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{0, 53}, 17))
+	)
+
+	for _, test := range []struct {
+		condition string
+		web, dns  bool
+	}{
+		{"service = web-frontend", true, false},
+		{"service != web-frontend", false, true},
+		{"service = web-frontend | dport = 53", true, true},
+		{"!(service = web-frontend) & sip = 10.0.0.1", false, true},
+	} {
+		t.Run(test.condition, func(t *testing.T) {
+			cond, _, err := ParseAndInstrument(test.condition, 0)
+			require.Nil(t, err)
+			require.Contains(t, cond.Attributes(), "service")
+			require.Equal(t, test.web, cond.Evaluate(web))
+			require.Equal(t, test.dns, cond.Evaluate(dns))
+		})
+	}
+
+	// custom attributes are not ordered
+	_, _, err := ParseAndInstrument("service > web-frontend", 0)
+	require.Error(t, err)
+}
+
+func TestVLANCondition(t *testing.T) {
+	var (
+		tagged   = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6).ExtendTagged(0)
+		untagged = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{0, 53}, 17).ExtendTagged(0)
+	)
+	tagged.PutVLAN(100)
+
+	for _, test := range []struct {
+		condition        string
+		tagged, untagged bool
+	}{
+		{"vlan = 100", true, false},
+		{"vlan != 100", false, true},
+		{"vlan = 0", false, true},
+		{"vlan > 10", true, false},
+		{"vlan <= 100 & dport = 443", true, false},
+		{"vlan < 100 | proto = udp", false, true},
+	} {
+		t.Run(test.condition, func(t *testing.T) {
+			cond, _, err := ParseAndInstrument(test.condition, 0)
+			require.Nil(t, err)
+			require.Contains(t, cond.Attributes(), types.VLANName)
+			require.Equal(t, test.tagged, cond.Evaluate(tagged))
+			require.Equal(t, test.untagged, cond.Evaluate(untagged))
+		})
+	}
+}
+
+func TestMACCondition(t *testing.T) {
+	var (
+		withMACs    = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6).ExtendTagged(0)
+		withoutMACs = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{0, 53}, 17).ExtendTagged(0)
+	)
+	withMACs.PutSMAC(types.MAC{0xaa, 0xbb, 0xcc, 0x00, 0x11, 0x22})
+	withMACs.PutDMAC(types.MAC{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})
+
+	for _, test := range []struct {
+		condition             string
+		withMACs, withoutMACs bool
+	}{
+		{"smac = aa:bb:cc:00:11:22", true, false},
+		{"smac = AA-BB-CC-00-11-22", true, false},
+		{"smac != aa:bb:cc:00:11:22", false, true},
+		{"dmac = aa:bb:cc:00:11:22", false, false},
+		{"dmac = 00:11:22:33:44:55 & dport = 443", true, false},
+		{"smac = 00:00:00:00:00:00 | proto = udp", false, true},
+	} {
+		t.Run(test.condition, func(t *testing.T) {
+			cond, _, err := ParseAndInstrument(test.condition, 0)
+			require.Nil(t, err)
+			require.Equal(t, test.withMACs, cond.Evaluate(withMACs))
+			require.Equal(t, test.withoutMACs, cond.Evaluate(withoutMACs))
+		})
+	}
+
+	// MAC addresses are not ordered
+	_, _, err := ParseAndInstrument("smac > aa:bb:cc:00:11:22", 0)
+	require.Error(t, err)
+}
+
+func TestTCPFlagsCondition(t *testing.T) {
+	var (
+		handshake    = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6).ExtendTagged(0)
+		withoutFlags = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{0, 53}, 17).ExtendTagged(0)
+	)
+	handshake.PutTCPFlags(types.TCPFlagSYN)
+
+	for _, test := range []struct {
+		condition               string
+		handshake, withoutFlags bool
+	}{
+		{"flags = syn", true, false},
+		{"flags = SYN & !ack", true, false},
+		{"flags != syn & !ack", false, true},
+		{"flags = !rst", true, true},
+		{"flags = syn & ack", false, false},
+		{"flags = syn & dport = 443", true, false},
+		{"flags = syn & !(dport = 443)", false, false},
+		{"flags = fin | proto = udp", false, true},
+		{"!(flags = syn & !ack)", false, true},
+	} {
+		t.Run(test.condition, func(t *testing.T) {
+			cond, _, err := ParseAndInstrument(test.condition, 0)
+			require.Nil(t, err)
+			require.Equal(t, test.handshake, cond.Evaluate(handshake))
+			require.Equal(t, test.withoutFlags, cond.Evaluate(withoutFlags))
+		})
+	}
+
+	// TCP flags are not ordered
+	_, _, err := ParseAndInstrument("flags > syn", 0)
+	require.Error(t, err)
+}
+
+func TestDSCPCondition(t *testing.T) {
+	var (
+		voice       = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{19, 196}, 17).ExtendTagged(0)
+		withoutDSCP = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6).ExtendTagged(0)
+	)
+	voice.PutDSCP(46)
+
+	for _, test := range []struct {
+		condition          string
+		voice, withoutDSCP bool
+	}{
+		{"dscp = ef", true, false},
+		{"dscp = 46", true, false},
+		{"dscp = EF & proto = udp", true, false},
+		{"dscp != be", true, false},
+		{"dscp = 0", false, true},
+		{"dscp > cs4", true, false},
+		{"dscp < af11", false, true},
+		{"dscp >= 46 | dport = 443", true, true},
+		{"!(dscp = ef)", false, true},
+	} {
+		t.Run(test.condition, func(t *testing.T) {
+			cond, _, err := ParseAndInstrument(test.condition, 0)
+			require.Nil(t, err)
+			require.Equal(t, test.voice, cond.Evaluate(voice))
+			require.Equal(t, test.withoutDSCP, cond.Evaluate(withoutDSCP))
+		})
+	}
+}
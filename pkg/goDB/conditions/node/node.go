@@ -23,6 +23,8 @@ package node
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/els0r/goProbe/pkg/goDB/conditions"
@@ -32,9 +34,40 @@ import (
 
 const resNil = "<nil>"
 
+// ParseOption configures the parsing of a conditional
+type ParseOption func(*parseConfig)
+
+type parseConfig struct {
+	strictHostnames bool
+	warn            func(msg string)
+}
+
+// WithStrictHostnames makes parsing fail if a hostname in a condition resolves to multiple addresses
+// (instead of matching any of them), ensuring that a condition refers to exactly one host
+func WithStrictHostnames(strict bool) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.strictHostnames = strict
+	}
+}
+
+// WithWarnings sets a function called for every warning encountered while parsing the conditional,
+// e.g. for hostnames resolving to multiple addresses
+func WithWarnings(warn func(msg string)) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.warn = warn
+	}
+}
+
 // ParseAndInstrument parses and instruments the given conditional string for evaluation.
 // This is the main external function related to conditionals.
-func ParseAndInstrument(conditional string, dnsTimeout time.Duration) (Node, *ValFilterNode, error) {
+func ParseAndInstrument(conditional string, dnsTimeout time.Duration, opts ...ParseOption) (Node, *ValFilterNode, error) {
+	cfg := parseConfig{
+		warn: func(string) {},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	tokens, err := conditions.Tokenize(conditional)
 	if err != nil {
 		return nil, nil, err
@@ -54,7 +87,7 @@ func ParseAndInstrument(conditional string, dnsTimeout time.Duration) (Node, *Va
 			return nil, nil, err
 		}
 
-		if conditionalNode, err = resolve(conditionalNode, dnsTimeout); err != nil {
+		if conditionalNode, err = resolve(conditionalNode, dnsTimeout, cfg); err != nil {
 			return nil, nil, err
 		}
 
@@ -68,6 +101,47 @@ func ParseAndInstrument(conditional string, dnsTimeout time.Duration) (Node, *Va
 	return conditionalNode, &valFilterNode, nil
 }
 
+// ConditionAttributes returns the (sorted) names of all attributes / labels referred to by the given
+// conditional (with aliases such as "host" or "snet" mapped to the underlying attributes). Since hostnames are
+// not resolved, no DNS lookups are performed
+func ConditionAttributes(conditional string) ([]string, error) {
+	tokens, err := conditions.Tokenize(conditional)
+	if err != nil {
+		return nil, err
+	}
+
+	conditionalNode, err := parseConditional(tokens)
+	if err != nil {
+		if errors.Is(err, errEmptyConditional) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	conditionalNode, _, err = splitOffDirectionFilter(conditionalNode)
+	if err != nil {
+		if errors.Is(err, errEmptyConditional) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if conditionalNode, err = desugar(conditionalNode); err != nil {
+		return nil, err
+	}
+
+	// network conditions refer to the underlying IP attributes
+	attributes := make(map[string]struct{})
+	for attribute := range conditionalNode.Attributes() {
+		switch attribute {
+		case "snet":
+			attribute = types.SIPName
+		case "dnet":
+			attribute = types.DIPName
+		}
+		attributes[attribute] = struct{}{}
+	}
+	return slices.Sorted(maps.Keys(attributes)), nil
+}
+
 // Node describes an AST node for the conditional grammar
 // This interface is not meant to be implemented by structs
 // outside of this package.
@@ -81,8 +155,9 @@ type Node interface {
 	transform(func(conditionNode) (Node, error)) (Node, error)
 
 	// Evaluates the conditional. Make sure that you called
-	// instrument before calling this.
-	Evaluate(types.Key) bool
+	// instrument before calling this. Conditions on labels (e.g.
+	// the VLAN or MAC addresses) require the key to be extended via ExtendTagged().
+	Evaluate(types.ExtendedKey) bool
 
 	// Returns the set of attributes used in the conditional.
 	Attributes() map[string]types.IPVersion
@@ -94,7 +169,7 @@ type conditionNode struct {
 	value        string
 	ipVersion    types.IPVersion
 	currentValue []byte
-	compareValue func(types.Key) bool
+	compareValue func(types.ExtendedKey) bool
 }
 
 func newConditionNode(attribute, comparator, value string) conditionNode {
@@ -113,7 +188,7 @@ func (n conditionNode) instrument() (Node, error) {
 	err := generateCompareValue(&n)
 	return n, err
 }
-func (n conditionNode) Evaluate(comparisonValue types.Key) bool {
+func (n conditionNode) Evaluate(comparisonValue types.ExtendedKey) bool {
 	return n.compareValue(comparisonValue)
 }
 func (n conditionNode) Attributes() map[string]types.IPVersion {
@@ -140,7 +215,7 @@ func (n notNode) transform(transformer func(conditionNode) (Node, error)) (Node,
 	n.node, err = n.node.transform(transformer)
 	return n, err
 }
-func (n notNode) Evaluate(comparisonValue types.Key) bool {
+func (n notNode) Evaluate(comparisonValue types.ExtendedKey) bool {
 	return !n.node.Evaluate(comparisonValue)
 }
 func (n notNode) Attributes() map[string]types.IPVersion {
@@ -175,7 +250,7 @@ func (n andNode) transform(transformer func(conditionNode) (Node, error)) (Node,
 	n.right, err = n.right.transform(transformer)
 	return n, err
 }
-func (n andNode) Evaluate(comparisonValue types.Key) bool {
+func (n andNode) Evaluate(comparisonValue types.ExtendedKey) bool {
 	return n.left.Evaluate(comparisonValue) && n.right.Evaluate(comparisonValue)
 }
 func (n andNode) Attributes() map[string]types.IPVersion {
@@ -215,7 +290,7 @@ func (n orNode) transform(transformer func(conditionNode) (Node, error)) (Node,
 	return n, err
 }
 
-func (n orNode) Evaluate(comparisonValue types.Key) bool {
+func (n orNode) Evaluate(comparisonValue types.ExtendedKey) bool {
 	return n.left.Evaluate(comparisonValue) || n.right.Evaluate(comparisonValue)
 }
 
@@ -132,3 +132,31 @@ func TestQueryConditionalString(t *testing.T) {
 		}
 	}
 }
+
+var conditionAttributesTests = []struct {
+	conditional string
+	expected    []string
+}{
+	{"", nil},
+	{"dir = in", nil},
+	{"dport = 443", []string{"dport"}},
+	{"host = 10.0.0.1 & proto = tcp", []string{"dip", "proto", "sip"}},
+	{"(dport = 53 | port = 853) & dir = out", []string{"dport"}},
+	{"snet = 10.0.0.0/8 & vlan = 100", []string{"sip", "vlan"}},
+	{"net = 10.0.0.0/8", []string{"dip", "sip"}},
+}
+
+func TestConditionAttributes(t *testing.T) {
+	for _, test := range conditionAttributesTests {
+		got, err := ConditionAttributes(test.conditional)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", test.conditional, err)
+		}
+		if fmt.Sprint(test.expected) != fmt.Sprint(got) {
+			t.Fatalf("Expected: %v Got: %v", test.expected, got)
+		}
+	}
+	if _, err := ConditionAttributes("dport = "); err == nil {
+		t.Fatalf("expected error for invalid conditional")
+	}
+}
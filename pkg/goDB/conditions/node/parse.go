@@ -32,6 +32,7 @@ package node
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/els0r/goProbe/pkg/types"
 )
@@ -74,13 +75,17 @@ func parseConditional(tokens []string) (conditionalNode Node, err error) {
 //	conjunction -> negation ('&' negation)*
 //	negation -> '!' primitive | primitive
 //	primitive -> '(' disjunction ')' | condition
-//	condition -> attribute comparator value
+//	condition -> attribute comparator value | 'flags' comparator tcpflags
 //	comparator -> '=' | '!=' | '<' | '>' | '<=' | '>='
+//	tcpflags -> tcpflag ('&' tcpflag)*
+//	tcpflag -> '!' flagname | flagname
 //
 // (Terminal symbols are written in single quotes)
 // (A rule part written with a star is meant to be repeated zero or more times)
 // We observe that this grammar is in LL(1), i.e. the parser can always decide which
-// production it should use by looking ahead a single token.
+// production it should use by looking ahead a single token. The only exception is the
+// value of a TCP flags condition, where an '&' continues the value only if it is followed
+// by another (optionally negated) flag name (requiring a lookahead of up to three tokens).
 // As a result we can translate the grammar into code almost one-to-one; furthermore,
 // the resulting parser runs in O(n).
 type parser struct {
@@ -294,7 +299,11 @@ func (p *parser) condition() (result Node) {
 	if !p.success() {
 		return
 	}
-	condition.value = p.value()
+	if condition.attribute == types.TCPFlagsName {
+		condition.value = p.tcpFlags()
+	} else {
+		condition.value = p.value()
+	}
 	result = condition
 	return
 }
@@ -302,9 +311,10 @@ func (p *parser) condition() (result Node) {
 // Corresponds to grammar rule "attribute"
 func (p *parser) attribute() (result string) {
 	attributes := []string{
-		types.DIPName, types.SIPName, "dnet", "snet", types.DportName, types.ProtoName, types.FilterKeywordDirection, // non-sugar
+		types.DIPName, types.SIPName, "dnet", "snet", types.DportName, types.ProtoName, types.VLANName, types.SMACName, types.DMACName, types.TCPFlagsName, types.DSCPName, types.FilterKeywordDirection, // non-sugar
 		"dst", "src", "host", "net", "port", "protocol", "ipproto", types.FilterKeywordDirectionSugared, // sugar
 	}
+	attributes = append(attributes, types.AttributePluginNames()...) // custom attributes
 	for _, attrib := range attributes {
 		if p.accept(attrib) {
 			if !p.success() {
@@ -361,3 +371,40 @@ func (p *parser) value() (result string) {
 	result = p.advance()
 	return
 }
+
+// Corresponds to grammar rule "tcpflags". The (optionally negated) flags are joined into a single
+// value, e.g. "syn&!ack"
+func (p *parser) tcpFlags() (result string) {
+	var flags []string
+	for {
+		negation := ""
+		if p.accept("!") {
+			negation = "!"
+		}
+		flag := p.value()
+		if !p.success() {
+			return
+		}
+		flags = append(flags, negation+flag)
+
+		if !p.continuesTCPFlags() {
+			break
+		}
+		p.expect("&")
+	}
+	return strings.Join(flags, "&")
+}
+
+// continuesTCPFlags determines if the upcoming tokens continue the value of a TCP flags condition,
+// i.e. an '&' followed by another (optionally negated) flag name rather than another condition
+func (p *parser) continuesTCPFlags() bool {
+	next := p.pos
+	if next >= len(p.tokens) || p.tokens[next] != "&" {
+		return false
+	}
+	next++
+	if next < len(p.tokens) && p.tokens[next] == "!" {
+		next++
+	}
+	return next < len(p.tokens) && types.IsTCPFlagName(p.tokens[next])
+}
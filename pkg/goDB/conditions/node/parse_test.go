@@ -54,6 +54,17 @@ var parseConditionalTests = []struct {
 	{[]string{"directio", "=", "in"},
 		"direction = in",
 		false},
+	{[]string{"flags", "=", "syn", "&", "!", "ack"},
+		"flags = syn&!ack",
+		true},
+	{[]string{"flags", "!=", "!", "rst", "&", "dport", "=", "443"},
+		"(flags != !rst & dport = 443)",
+		true},
+	{[]string{"flags", "=", "fin", "&", "!", "(", "dport", "=", "443", ")"},
+		"(flags = fin & !(dport = 443))",
+		true},
+	{[]string{"flags", "=", "syn", "&"}, "", false},
+	{[]string{"flags", "=", "!"}, "", false},
 }
 
 var (
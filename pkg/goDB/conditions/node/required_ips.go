@@ -0,0 +1,43 @@
+package node
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// RequiredIPs determines a set of IPs (in their 4 or 16 byte representation) of which at least one is
+// the source or destination IP of every flow matching the conditional. It allows to skip data known not
+// to contain any of the IPs (e.g. via a Bloom filter). If no such set can be derived from the conditional
+// (e.g. because it only restricts ports), false is returned
+func RequiredIPs(node Node) ([][]byte, bool) {
+	switch node := node.(type) {
+	case conditionNode:
+		if node.comparator != "=" || (node.attribute != types.SIPName && node.attribute != types.DIPName) {
+			return nil, false
+		}
+		ip, _, err := types.IPStringToBytes(node.value)
+		if err != nil {
+			return nil, false
+		}
+		return [][]byte{ip}, true
+	case andNode:
+		// any of the sides restricting the IPs suffices, the smaller set being the more selective one
+		left, leftOK := RequiredIPs(node.left)
+		right, rightOK := RequiredIPs(node.right)
+		if !leftOK || (rightOK && len(right) < len(left)) {
+			return right, rightOK
+		}
+		return left, true
+	case orNode:
+		// both sides have to restrict the IPs
+		left, leftOK := RequiredIPs(node.left)
+		right, rightOK := RequiredIPs(node.right)
+		if !leftOK || !rightOK {
+			return nil, false
+		}
+		return slices.CompactFunc(slices.SortedFunc(slices.Values(append(left, right...)), bytes.Compare), bytes.Equal), true
+	}
+	return nil, false
+}
@@ -0,0 +1,43 @@
+package node
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredIPs(t *testing.T) {
+	var tests = []struct {
+		conditional string
+		expected    []string
+	}{
+		{"sip = 10.0.0.1", []string{"10.0.0.1"}},
+		{"dst = 2001:db8::1", []string{"2001:db8::1"}},
+		{"host = 10.0.0.1", []string{"10.0.0.1"}},
+		{"host = 10.0.0.1 & dport = 443", []string{"10.0.0.1"}},
+		{"dport = 443 & (sip = 10.0.0.2 | dip = 10.0.0.1)", []string{"10.0.0.1", "10.0.0.2"}},
+		{"(sip = 10.0.0.1 | sip = 10.0.0.2) & dip = 10.0.0.3", []string{"10.0.0.3"}},
+		{"sip = 10.0.0.1 | dport = 443", nil},
+		{"host != 10.0.0.1", nil},
+		{"!(sip != 10.0.0.1)", []string{"10.0.0.1"}},
+		{"snet = 10.0.0.0/8", nil},
+		{"proto = tcp", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.conditional, func(t *testing.T) {
+			node, _, err := ParseAndInstrument(test.conditional, 0)
+			require.Nil(t, err)
+
+			ips, ok := RequiredIPs(node)
+			require.Equal(t, test.expected != nil, ok)
+
+			var expected [][]byte
+			for _, ip := range test.expected {
+				expected = append(expected, netip.MustParseAddr(ip).AsSlice())
+			}
+			require.Equal(t, expected, ips)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package node
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// RequiredValues determines the set of values (in their raw representation, sorted) one of which the
+// attribute (sip, dip, dport or proto) takes in every flow matching the conditional. It allows to locate
+// matching flows in data sorted by the attribute (e.g. via binary search). If no such set can be derived
+// from the conditional (e.g. because it only restricts other attributes), false is returned
+func RequiredValues(node Node, attribute string) ([][]byte, bool) {
+	switch attribute {
+	case types.SIPName, types.DIPName, types.DportName, types.ProtoName:
+	default:
+		return nil, false
+	}
+
+	switch node := node.(type) {
+	case conditionNode:
+		if node.comparator != "=" || node.attribute != attribute {
+			return nil, false
+		}
+		value, _, _, err := conditionBytesAndNetmask(node)
+		if err != nil {
+			return nil, false
+		}
+		return [][]byte{value}, true
+	case andNode:
+		// any of the sides restricting the attribute suffices, the smaller set being the more selective one
+		left, leftOK := RequiredValues(node.left, attribute)
+		right, rightOK := RequiredValues(node.right, attribute)
+		if !leftOK || (rightOK && len(right) < len(left)) {
+			return right, rightOK
+		}
+		return left, true
+	case orNode:
+		// both sides have to restrict the attribute
+		left, leftOK := RequiredValues(node.left, attribute)
+		right, rightOK := RequiredValues(node.right, attribute)
+		if !leftOK || !rightOK {
+			return nil, false
+		}
+		return slices.CompactFunc(slices.SortedFunc(slices.Values(append(left, right...)), bytes.Compare), bytes.Equal), true
+	}
+	return nil, false
+}
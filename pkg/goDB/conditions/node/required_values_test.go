@@ -0,0 +1,41 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredValues(t *testing.T) {
+	var tests = []struct {
+		conditional string
+		attribute   string
+		expected    [][]byte
+	}{
+		{"proto = tcp", types.ProtoName, [][]byte{{6}}},
+		{"proto = udp | proto = tcp", types.ProtoName, [][]byte{{6}, {17}}},
+		{"proto = tcp & dport = 443", types.DportName, [][]byte{{1, 187}}},
+		{"dport = 443 | dport = 80", types.DportName, [][]byte{{0, 80}, {1, 187}}},
+		{"dport = 443 | proto = udp", types.DportName, nil},
+		{"dport != 443", types.DportName, nil},
+		{"dport > 443", types.DportName, nil},
+		{"!(proto != tcp)", types.ProtoName, [][]byte{{6}}},
+		{"sip = 10.0.0.1 & dport = 53", types.SIPName, [][]byte{{10, 0, 0, 1}}},
+		{"host = 10.0.0.1", types.SIPName, nil},
+		{"snet = 10.0.0.0/8", types.SIPName, nil},
+		{"snet = 10.0.0.0/8", "snet", nil},
+		{"proto = tcp", types.DportName, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.conditional+"/"+test.attribute, func(t *testing.T) {
+			node, _, err := ParseAndInstrument(test.conditional, 0)
+			require.Nil(t, err)
+
+			values, ok := RequiredValues(node, test.attribute)
+			require.Equal(t, test.expected != nil, ok)
+			require.Equal(t, test.expected, values)
+		})
+	}
+}
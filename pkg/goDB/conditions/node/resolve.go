@@ -11,10 +11,12 @@
 package node
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/els0r/goProbe/pkg/types"
@@ -22,14 +24,21 @@ import (
 
 var hostnameRegexp = regexp.MustCompile(`[a-zA-Z0-9\-]+(?:\.[a-zA-Z0-9\-]+)*\.?`)
 
+// lookupHost performs the forward lookup (A / AAAA) of a hostname. It is a variable so that
+// tests don't have to rely on working DNS resolution
+var lookupHost = net.LookupHost
+
 type lookupHostResult struct {
 	hostname string
 	addrs    []string
 	err      error
 }
 
-// Returns a resolved version of node.
-func resolve(node Node, timeout time.Duration) (Node, error) {
+// Returns a resolved version of node. Every condition on a hostname is replaced by the conditions
+// on the addresses it resolves to (matching any of them for "=", none of them for "!="). A hostname
+// resolving to multiple addresses causes a warning (or an error if strict hostnames are requested),
+// whereas a hostname not resolving to any address is always an error
+func resolve(node Node, timeout time.Duration, cfg parseConfig) (Node, error) {
 	// Find all hostnames
 	hostnames := make(map[string]struct{})
 	_, err := node.transform(func(node conditionNode) (Node, error) {
@@ -63,7 +72,7 @@ func resolve(node Node, timeout time.Duration) (Node, error) {
 	for hostname := range hostnames {
 		hostname := hostname
 		go func() {
-			addrs, err := net.LookupHost(hostname)
+			addrs, err := lookupHost(hostname)
 
 			// always arrange the addresses such that IPv4 comes before IPv6
 			sort.SliceStable(addrs, func(i, j int) bool {
@@ -85,10 +94,30 @@ func resolve(node Node, timeout time.Duration) (Node, error) {
 			if result.err != nil {
 				return nil, result.err
 			}
+			if len(result.addrs) == 0 {
+				return nil, fmt.Errorf("hostname %s does not resolve to any address", result.hostname)
+			}
 			lookups[result.hostname] = result.addrs
 		}
 	}
 
+	// check for ambiguous hostnames (in a stable order)
+	ambiguous := make([]string, 0, len(lookups))
+	for hostname, addrs := range lookups {
+		if len(addrs) > 1 {
+			ambiguous = append(ambiguous, hostname)
+		}
+	}
+	sort.Strings(ambiguous)
+	for _, hostname := range ambiguous {
+		addrs := lookups[hostname]
+		msg := fmt.Sprintf("hostname %s resolves to %d addresses (%s)", hostname, len(addrs), strings.Join(addrs, ", "))
+		if cfg.strictHostnames {
+			return nil, errors.New(msg)
+		}
+		cfg.warn(msg + ", conditions apply to all of them")
+	}
+
 	// Rewrite all conditions involving hostnames to use IPs
 	return node.transform(func(node conditionNode) (Node, error) {
 		// We only expect a domain in sip or dip attributes
@@ -107,6 +136,7 @@ func resolve(node Node, timeout time.Duration) (Node, error) {
 			conditions = append(conditions, condition)
 		}
 
-		return listToTree(false, conditions), nil
+		// a flow matches a negated condition only if it doesn't involve any of the addresses
+		return listToTree(node.comparator == "!=", conditions), nil
 	})
 }
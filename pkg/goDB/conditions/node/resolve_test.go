@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/els0r/goProbe/pkg/goDB/conditions"
+	"github.com/stretchr/testify/require"
 )
 
 var resolveTests = []struct {
@@ -86,7 +87,7 @@ func TestResolveInConditional(t *testing.T) {
 			t.Fatalf("Parsing %v unexpectly failed. Error:\n%v", tokens, err)
 		}
 
-		resolvedNode, err := resolve(node, test.timeout)
+		resolvedNode, err := resolve(node, test.timeout, parseConfig{warn: func(string) {}})
 		if !test.success {
 			if err == nil {
 				fmt.Println(resolvedNode)
@@ -107,3 +108,64 @@ func TestResolveInConditional(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveHostnamePolicy(t *testing.T) {
+	defer func(lookup func(string) ([]string, error)) {
+		lookupHost = lookup
+	}(lookupHost)
+	lookupHost = func(hostname string) ([]string, error) {
+		switch hostname {
+		case "single.example.com":
+			return []string{"10.0.0.1"}, nil
+		case "multi.example.com":
+			return []string{"2001:db8::1", "10.0.0.2"}, nil
+		case "empty.example.com":
+			return nil, nil
+		}
+		return nil, fmt.Errorf("lookup %s: no such host", hostname)
+	}
+
+	var tests = []struct {
+		conditional string
+		strict      bool
+		output      string
+		warnings    []string
+		success     bool
+	}{
+		{"dip = single.example.com", true, "dip = 10.0.0.1", nil, true},
+		{"dip = multi.example.com", false, "(dip = 10.0.0.2 | dip = 2001:db8::1)", []string{
+			"hostname multi.example.com resolves to 2 addresses (10.0.0.2, 2001:db8::1), conditions apply to all of them",
+		}, true},
+		{"dip != multi.example.com", false, "(dip != 10.0.0.2 & dip != 2001:db8::1)", []string{
+			"hostname multi.example.com resolves to 2 addresses (10.0.0.2, 2001:db8::1), conditions apply to all of them",
+		}, true},
+		{"dip = multi.example.com", true, "", nil, false},
+		{"sip = single.example.com | dip = multi.example.com", true, "", nil, false},
+		{"dip = empty.example.com", false, "", nil, false},
+		{"dip = unknown.example.com", false, "", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s (strict: %t)", test.conditional, test.strict), func(t *testing.T) {
+			tokens, err := conditions.Tokenize(test.conditional)
+			require.Nil(t, err)
+			node, err := parseConditional(tokens)
+			require.Nil(t, err)
+
+			var warnings []string
+			resolvedNode, err := resolve(node, time.Second, parseConfig{
+				strictHostnames: test.strict,
+				warn: func(msg string) {
+					warnings = append(warnings, msg)
+				},
+			})
+			if !test.success {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.output, resolvedNode.String())
+			require.Equal(t, test.warnings, warnings)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// TagDefinition denotes a flow tag, assigned to all flows satisfying its condition
+type TagDefinition struct {
+	Name      string // Name: the name of the tag (used for logging / errors only)
+	Bit       int    // Bit: the bit representing the tag in the bitmap of flow tags
+	Condition string // Condition: the condition (same grammar as query conditions) a flow has to satisfy
+}
+
+// Tagger evaluates a set of tag conditions against the keys of in-memory flow maps, yielding a bitmap
+// of the tags each flow satisfies. It provides lightweight classification of flows (e.g. by application)
+// without having to inspect their payload
+type Tagger struct {
+	tags []taggerTag
+
+	// Some conditions (e.g. network conditions) modify the key during evaluation, hence it is
+	// evaluated on a (reusable) copy
+	comparisonValue types.ExtendedKey
+}
+
+type taggerTag struct {
+	mask   uint64
+	filter *FlowFilter
+}
+
+// NewTagger parses and instruments the conditions of all tag definitions. The same restrictions as for
+// flow filters apply (i.e. direction conditions are not supported)
+func NewTagger(defs ...TagDefinition) (*Tagger, error) {
+	t := &Tagger{
+		tags: make([]taggerTag, 0, len(defs)),
+	}
+	for _, def := range defs {
+		if def.Bit < 0 || def.Bit >= 64 {
+			return nil, fmt.Errorf("invalid bit %d for tag `%s`", def.Bit, def.Name)
+		}
+		filter, err := NewFlowFilter(def.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition for tag `%s`: %w", def.Name, err)
+		}
+		t.tags = append(t.tags, taggerTag{
+			mask:   1 << def.Bit,
+			filter: filter,
+		})
+	}
+	return t, nil
+}
+
+// Tag returns the bitmap of all tags satisfied by the flow identified by key. Since the comparison
+// value is reused, a Tagger must not be used concurrently
+func (t *Tagger) Tag(key types.Key) (bitmap uint64) {
+	if len(t.tags) == 0 {
+		return 0
+	}
+
+	isIPv4 := key.IsIPv4()
+	for _, tag := range t.tags {
+
+		// Conditions on IPv4 addresses / networks can never be satisfied by IPv6 flows and vice versa
+		if (isIPv4 && tag.filter.ipVersion == types.IPVersionV6) || (!isIPv4 && tag.filter.ipVersion == types.IPVersionV4) {
+			continue
+		}
+
+		t.comparisonValue = append(t.comparisonValue[:0], key...)
+		if tag.filter.conditional.Evaluate(t.comparisonValue) {
+			bitmap |= tag.mask
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagger(t *testing.T) {
+	var (
+		sipV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0x13, 0xc4}, 17)
+		rtpV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{0x3a, 0x98}, 17)
+		webV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{8, 8, 8, 8}, []byte{1, 187}, 6)
+		webV6 = types.NewV6KeyStatic([16]byte{0x20, 0x01, 15: 1}, [16]byte{0x2a, 0x00, 15: 2}, []byte{1, 187}, 6)
+		dnsV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 53}, []byte{0, 53}, 17)
+		sshV4 = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 22}, 6)
+	)
+
+	tagger, err := NewTagger(
+		TagDefinition{Name: "voip", Bit: 0, Condition: "proto = udp & (dport = 5060 | (dport >= 10000 & dport <= 20000))"},
+		TagDefinition{Name: "web", Bit: 1, Condition: "proto = tcp & dport = 443"},
+		TagDefinition{Name: "internal", Bit: 5, Condition: "dnet = 10.0.0.0/8"},
+	)
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		name     string
+		key      types.Key
+		expected uint64
+	}{
+		{"sip", sipV4, 0b100001},
+		{"rtp", rtpV4, 0b1},
+		{"web", webV4, 0b10},
+		{"web (IPv6)", webV6, 0b10},
+		{"dns", dnsV4, 0b100000},
+		{"ssh", sshV4, 0b100000},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, tagger.Tag(test.key))
+		})
+	}
+
+	// keys must remain unchanged by the evaluation
+	require.Equal(t, types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 53}, []byte{0, 53}, 17), dnsV4)
+
+	empty, err := NewTagger()
+	require.Nil(t, err)
+	require.Zero(t, empty.Tag(webV4))
+}
+
+func TestTaggerInvalid(t *testing.T) {
+	for _, def := range []TagDefinition{
+		{Name: "empty", Condition: ""},
+		{Name: "direction", Condition: "dir = in"},
+		{Name: "bit", Bit: 64, Condition: "dport = 80"},
+		{Name: "negative", Bit: -1, Condition: "dport = 80"},
+	} {
+		_, err := NewTagger(def)
+		require.Error(t, err, def.Name)
+	}
+}
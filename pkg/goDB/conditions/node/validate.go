@@ -0,0 +1,140 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB/conditions"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// Validation describes a conditional as understood by the parser, allowing to check a conditional
+// without evaluating it against any data
+type Validation struct {
+	// Tokens denotes the tokenized form of the conditional (canonical if joined by a single space)
+	Tokens []string `json:"tokens"`
+
+	// Conditions lists all conditions the conditional is evaluated by, i.e. after desugaring (e.g. of
+	// host / port conditions) and resolving hostnames. The values of all conditions are literals
+	Conditions []Condition `json:"conditions"`
+
+	// Resolved denotes the conditional after desugaring, resolving hostnames and bringing it into
+	// negation normal form (as shown in the "Conditions" output field of a query)
+	Resolved string `json:"resolved"`
+
+	// Tree denotes a human-readable representation of the parse tree of the conditional
+	Tree string `json:"tree"`
+
+	// Warnings lists issues that don't render the conditional invalid, e.g. hostnames resolving to
+	// multiple addresses
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Condition denotes a single (leaf) condition of a conditional
+type Condition struct {
+	Attribute  string `json:"attribute"`
+	Comparator string `json:"comparator"`
+	Value      string `json:"value"`
+}
+
+// String returns a string representation of the condition
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s %s", c.Attribute, c.Comparator, c.Value)
+}
+
+// Validate sanitizes and parses the given conditional (including resolving hostnames, see ParseAndInstrument)
+// and describes it. An empty conditional is valid (and results in an empty Validation)
+func Validate(conditional string, dnsTimeout time.Duration, opts ...ParseOption) (*Validation, error) {
+	conditional = conditions.SanitizeUserInput(conditional)
+
+	tokens, err := conditions.Tokenize(conditional)
+	if err != nil {
+		return nil, err
+	}
+	parsedNode, err := parseConditional(tokens)
+	if err != nil {
+		if errors.Is(err, errEmptyConditional) {
+			return &Validation{}, nil
+		}
+		return nil, err
+	}
+
+	var warnings []string
+	conditionalNode, valFilterNode, err := ParseAndInstrument(conditional, dnsTimeout, append(opts, WithWarnings(func(msg string) {
+		warnings = append(warnings, msg)
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	validation := &Validation{
+		Tokens:   tokens,
+		Resolved: QueryConditionalString(conditionalNode, valFilterNode),
+		Tree:     parseTree(parsedNode),
+		Warnings: warnings,
+	}
+	if valFilterNode.FilterType != types.FilterKeywordNone && valFilterNode.LeftNode {
+		validation.Conditions = append(validation.Conditions, newCondition(valFilterNode.conditionNode))
+	}
+	if conditionalNode != nil {
+		_, _ = conditionalNode.transform(func(node conditionNode) (Node, error) {
+			validation.Conditions = append(validation.Conditions, newCondition(node))
+			return node, nil
+		})
+	}
+	if valFilterNode.FilterType != types.FilterKeywordNone && !valFilterNode.LeftNode {
+		validation.Conditions = append(validation.Conditions, newCondition(valFilterNode.conditionNode))
+	}
+
+	return validation, nil
+}
+
+func newCondition(node conditionNode) Condition {
+	return Condition{
+		Attribute:  node.attribute,
+		Comparator: node.comparator,
+		Value:      node.value,
+	}
+}
+
+// parseTree renders a (parsed) conditional as tree, e.g. for "sip = 127.0.0.1 | !(dport < 80)"
+//
+//	OR
+//	├── sip = 127.0.0.1
+//	└── NOT
+//	    └── dport < 80
+func parseTree(node Node) string {
+	var sb strings.Builder
+
+	var render func(node Node, prefix, childPrefix string)
+	render = func(node Node, prefix, childPrefix string) {
+		var label string
+		var children []Node
+		switch node := node.(type) {
+		case conditionNode:
+			label = node.String()
+		case notNode:
+			label, children = "NOT", []Node{node.node}
+		case andNode:
+			label, children = "AND", []Node{node.left, node.right}
+		case orNode:
+			label, children = "OR", []Node{node.left, node.right}
+		default:
+			label = fmt.Sprint(node)
+		}
+
+		sb.WriteString(prefix + label + "\n")
+		for i, child := range children {
+			if i == len(children)-1 {
+				render(child, childPrefix+"└── ", childPrefix+"    ")
+			} else {
+				render(child, childPrefix+"├── ", childPrefix+"│   ")
+			}
+		}
+	}
+	render(node, "", "")
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		conditional string
+		expected    *Validation
+	}{
+		{"", &Validation{}},
+		{"sip = 127.0.0.1 | !(dport < 80)", &Validation{
+			Tokens:     []string{"sip", "=", "127.0.0.1", "|", "!", "(", "dport", "<", "80", ")"},
+			Conditions: []Condition{{"sip", "=", "127.0.0.1"}, {"dport", ">=", "80"}},
+			Resolved:   "(sip = 127.0.0.1 | dport >= 80)",
+			Tree:       "OR\n├── sip = 127.0.0.1\n└── NOT\n    └── dport < 80",
+		}},
+		{"HOST = 10.0.0.1 and proto = TCP", &Validation{
+			Tokens:     []string{"host", "=", "10.0.0.1", "&", "proto", "=", "tcp"},
+			Conditions: []Condition{{"sip", "=", "10.0.0.1"}, {"dip", "=", "10.0.0.1"}, {"proto", "=", "tcp"}},
+			Resolved:   "((sip = 10.0.0.1 | dip = 10.0.0.1) & proto = tcp)",
+			Tree:       "AND\n├── host = 10.0.0.1\n└── proto = tcp",
+		}},
+		{"dir = in & dport = 443", &Validation{
+			Tokens:     []string{"dir", "=", "in", "&", "dport", "=", "443"},
+			Conditions: []Condition{{types.FilterKeywordDirection, "=", "in"}, {"dport", "=", "443"}},
+			Resolved:   "(dir = in & dport = 443)",
+			Tree:       "AND\n├── dir = in\n└── dport = 443",
+		}},
+		{"sip = ", nil},
+		{"dport = https", nil},
+		{"sip = 10.0.0.1 & (dport = 80", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.conditional, func(t *testing.T) {
+			validation, err := Validate(test.conditional, 0)
+			if test.expected == nil {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expected, validation)
+		})
+	}
+}
+
+func TestValidateAmbiguousHostname(t *testing.T) {
+	defer func(lookup func(string) ([]string, error)) {
+		lookupHost = lookup
+	}(lookupHost)
+	lookupHost = func(string) ([]string, error) {
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+
+	validation, err := Validate("dip = www.example.com", time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "(dip = 10.0.0.1 | dip = 10.0.0.2)", validation.Resolved)
+	require.Equal(t, []string{
+		"hostname www.example.com resolves to 2 addresses (10.0.0.1, 10.0.0.2), conditions apply to all of them",
+	}, validation.Warnings)
+
+	_, err = Validate("dip = www.example.com", time.Second, WithStrictHostnames(true))
+	require.NotNil(t, err)
+}
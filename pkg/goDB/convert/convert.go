@@ -0,0 +1,439 @@
+// Package convert provides means to convert an existing goDB into a new goDB, rewriting all
+// of its blocks in the current layout and (optionally) with a different encoder. It is used
+// to migrate (potentially multi-TB) databases written by previous releases.
+//
+// The (daily) directories of all interfaces are converted in parallel. Each directory is
+// recorded in a checkpoint file at the root of the destination once it has been converted
+// completely, so an interrupted conversion resumes with the remaining directories when it
+// is restarted with the same source and destination (any partially converted directory is
+// discarded and converted again).
+//
+// The source is expected to be static during conversion (e.g. a stopped goProbe or a
+// snapshot), blocks added to an already converted directory afterwards are not picked up.
+package convert
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// CheckpointFileName denotes the name of the file recording all converted directories at the
+// root of the destination
+const CheckpointFileName = ".convert-checkpoint"
+
+// Stats summarizes a conversion
+type Stats struct {
+	Dirs    int // Dirs denotes the number of (daily) directories converted
+	Resumed int // Resumed denotes the number of directories skipped since they had been converted previously
+	Blocks  int // Blocks denotes the number of blocks converted
+}
+
+// Progress denotes the progress of a conversion, reported after each converted directory
+type Progress struct {
+	Done    int           // Done denotes the number of directories converted so far (including resumed ones)
+	Total   int           // Total denotes the total number of directories to convert
+	Elapsed time.Duration // Elapsed denotes the time elapsed since the start of the conversion
+	ETA     time.Duration // ETA denotes the estimated remaining time (based on the rate of this run)
+}
+
+// Option configures a conversion
+type Option func(*converter)
+
+// WithEncoderType sets the encoder used for the converted blocks (defaults to goDB's default encoder)
+func WithEncoderType(encoderType encoders.Type) Option {
+	return func(c *converter) {
+		c.encoderType = encoderType
+	}
+}
+
+// WithEncoderLevel sets the compression level of the encoder used for the converted blocks (defaults
+// to the encoder's default level)
+func WithEncoderLevel(level int) Option {
+	return func(c *converter) {
+		c.encoderLevel = level
+	}
+}
+
+// WithPermissions sets the permissions of the files written to the destination
+func WithPermissions(permissions fs.FileMode) Option {
+	return func(c *converter) {
+		c.permissions = permissions
+	}
+}
+
+// WithWorkers sets the number of directories converted in parallel (defaults to the number of CPUs)
+func WithWorkers(n int) Option {
+	return func(c *converter) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithProgress sets a function which is called with the progress after each converted directory
+// (calls are serialized)
+func WithProgress(fn func(Progress)) Option {
+	return func(c *converter) {
+		c.progress = fn
+	}
+}
+
+type converter struct {
+	src, dst     string
+	encoderType  encoders.Type
+	encoderLevel int
+	permissions  fs.FileMode
+	workers      int
+	progress     func(Progress)
+
+	checkpoint *os.File
+	stats      Stats
+	sync.Mutex
+}
+
+// dirJob denotes a (daily) directory of the source to convert
+type dirJob struct {
+	iface     string
+	relPath   string // relPath denotes the path relative to the source root (excluding the metadata suffix)
+	timestamp int64
+	suffix    string
+}
+
+// Run converts the goDB located at src into dst. If dst contains a checkpoint of a previous
+// (interrupted) conversion, all directories recorded in it are skipped. Cancelling the context
+// stops the conversion after the directories currently being converted
+func Run(ctx context.Context, src, dst string, opts ...Option) (*Stats, error) {
+	c := &converter{
+		src:         filepath.Clean(src),
+		dst:         filepath.Clean(dst),
+		encoderType: encoders.EncoderTypeLZ4,
+		permissions: goDB.DefaultPermissions,
+		workers:     runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if rel, err := filepath.Rel(c.src, c.dst); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("conversion destination %s must not be located inside the source DB", c.dst)
+	}
+	if err := os.MkdirAll(c.dst, 0755); err != nil {
+		return nil, err
+	}
+
+	converted, err := readCheckpoint(c.dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if c.checkpoint, err = os.OpenFile(filepath.Join(c.dst, CheckpointFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, c.permissions); err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer c.checkpoint.Close()
+
+	jobs, err := c.listDirs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directories: %w", err)
+	}
+
+	// Skip all directories converted by a previous run
+	pending := jobs[:0]
+	for _, job := range jobs {
+		if _, exists := converted[job.relPath]; exists {
+			c.stats.Resumed++
+			continue
+		}
+		pending = append(pending, job)
+	}
+
+	if err := c.convertDirs(ctx, pending, len(jobs)); err != nil {
+		return &c.stats, err
+	}
+
+	if err := c.finalize(); err != nil {
+		return &c.stats, err
+	}
+
+	return &c.stats, nil
+}
+
+func (c *converter) convertDirs(ctx context.Context, jobs []dirJob, total int) error {
+	var (
+		start    = time.Now()
+		jobChan  = make(chan dirJob)
+		errChan  = make(chan error, c.workers)
+		wg       sync.WaitGroup
+		firstErr error
+	)
+
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				if err := c.convertDir(job); err != nil {
+					errChan <- fmt.Errorf("failed to convert directory %s: %w", job.relPath, err)
+					return
+				}
+				c.reportProgress(start, total)
+			}
+		}()
+	}
+
+dispatch:
+	for _, job := range jobs {
+		select {
+		case jobChan <- job:
+		case firstErr = <-errChan:
+			break dispatch
+		case <-ctx.Done():
+			firstErr = ctx.Err()
+			break dispatch
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+
+	if firstErr == nil {
+		select {
+		case firstErr = <-errChan:
+		default:
+		}
+	}
+	return firstErr
+}
+
+func (c *converter) reportProgress(start time.Time, total int) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.progress == nil {
+		return
+	}
+
+	done := c.stats.Resumed + c.stats.Dirs
+	elapsed := time.Since(start)
+	var eta time.Duration
+	if c.stats.Dirs > 0 {
+		eta = time.Duration(float64(elapsed) / float64(c.stats.Dirs) * float64(total-done))
+	}
+	c.progress(Progress{Done: done, Total: total, Elapsed: elapsed, ETA: eta})
+}
+
+// listDirs returns all (daily) directories of all interfaces of the source (in chronological
+// order per interface)
+func (c *converter) listDirs() ([]dirJob, error) {
+	ifaces, err := info.GetInterfaces(c.src)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []dirJob
+	for _, iface := range ifaces {
+		dayPaths, err := filepath.Glob(filepath.Join(c.src, iface, "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, dayPath := range dayPaths {
+			timestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dayPath))
+			if err != nil {
+				continue
+			}
+			relPath, err := filepath.Rel(c.src, filepath.Join(filepath.Dir(dayPath), strconv.FormatInt(timestamp, 10)))
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, dirJob{
+				iface:     iface,
+				relPath:   relPath,
+				timestamp: timestamp,
+				suffix:    suffix,
+			})
+		}
+	}
+	return jobs, nil
+}
+
+// convertDir rewrites all blocks of a directory to the destination and records it in the checkpoint
+func (c *converter) convertDir(job dirJob) error {
+
+	// Discard any leftovers of a previous attempt to convert the directory
+	if err := c.removePartial(job); err != nil {
+		return err
+	}
+
+	src := gpfile.NewDirReader(filepath.Join(c.src, job.iface), job.timestamp, job.suffix)
+	if err := src.Open(); err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// The origin and the byte accounting bases of the data (if any) are retained
+	origin, err := src.Origin()
+	if err != nil {
+		return err
+	}
+	accounting, err := src.ByteAccounting()
+	if err != nil {
+		return err
+	}
+	dstOpts := []gpfile.Option{gpfile.WithPermissions(c.permissions), gpfile.WithEncoderTypeLevel(c.encoderType, c.encoderLevel), gpfile.WithByteAccounting(accounting...)}
+	if origin != nil {
+		dstOpts = append(dstOpts, gpfile.WithOrigin(*origin))
+	}
+	dst := gpfile.NewDirWriter(filepath.Join(c.dst, job.iface), job.timestamp, dstOpts...)
+	if err := dst.Open(); err != nil {
+		return err
+	}
+
+	nBlocks := src.NBlocks()
+	for blockIdx := 0; blockIdx < nBlocks; blockIdx++ {
+		var (
+			data        [types.ColIdxCount][]byte
+			deltaPacked []types.ColumnIndex
+			err         error
+		)
+		for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+
+			// Empty blocks (e.g. of columns not in use) have no data file to read from
+			if src.BlockMetadata[colIdx].BlockList[blockIdx].Len == 0 {
+				continue
+			}
+			if data[colIdx], err = src.ReadBlockAtIndex(colIdx, blockIdx); err != nil {
+				_ = dst.Close()
+				return err
+			}
+			if src.DeltaPackedAtIndex(colIdx, blockIdx) {
+				deltaPacked = append(deltaPacked, colIdx)
+			}
+		}
+
+		// The counters are only stored in aggregate per directory, hence they are recomputed
+		// from the blocks
+		var counters types.Counters
+		for colIdx, counter := range map[types.ColumnIndex]*uint64{
+			types.BytesRcvdColIdx:   &counters.BytesRcvd,
+			types.BytesSentColIdx:   &counters.BytesSent,
+			types.PacketsRcvdColIdx: &counters.PacketsRcvd,
+			types.PacketsSentColIdx: &counters.PacketsSent,
+		} {
+			if len(data[colIdx]) == 0 {
+				continue
+			}
+			for _, v := range deltapack.Unpack(data[colIdx], src.DeltaPackedAtIndex(colIdx, blockIdx)) {
+				*counter += v
+			}
+		}
+
+		timestamp := src.BlockMetadata[0].BlockList[blockIdx].Timestamp
+		if err := dst.WriteBlocks(timestamp, src.BlockTraffic[blockIdx], src.BlockOrderAtIndex(blockIdx), counters, data, deltaPacked...); err != nil {
+			_ = dst.Close()
+			return err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, err := fmt.Fprintln(c.checkpoint, job.relPath); err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+	if err := c.checkpoint.Sync(); err != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", err)
+	}
+	c.stats.Dirs++
+	c.stats.Blocks += nBlocks
+
+	return nil
+}
+
+// removePartial removes a (partially) converted directory from the destination (regardless of its
+// metadata suffix)
+func (c *converter) removePartial(job dirJob) error {
+	monthPath := filepath.Join(c.dst, filepath.Dir(job.relPath))
+	dirents, err := os.ReadDir(monthPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, dirent := range dirents {
+		if timestamp, _, err := gpfile.ExtractTimestampMetadataSuffix(dirent.Name()); err == nil && timestamp == job.timestamp {
+			if err := os.RemoveAll(filepath.Join(monthPath, dirent.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finalize carries over the label files of the source and rebuilds the manifest (if the source has one)
+// from the converted data
+func (c *converter) finalize() error {
+	for _, name := range info.LabelFileNames {
+		data, err := os.ReadFile(filepath.Join(c.src, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(c.dst, name), data, c.permissions); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(c.src, info.ManifestFileName)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	manifest, err := info.BuildManifest(c.dst)
+	if err != nil {
+		return fmt.Errorf("failed to build manifest: %w", err)
+	}
+	return manifest.Write(c.dst, c.permissions)
+}
+
+// readCheckpoint returns the relative paths of all directories recorded in the checkpoint at dst
+func readCheckpoint(dst string) (map[string]struct{}, error) {
+	converted := make(map[string]struct{})
+
+	f, err := os.Open(filepath.Join(dst, CheckpointFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return converted, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			converted[line] = struct{}{}
+		}
+	}
+	return converted, scanner.Err()
+}
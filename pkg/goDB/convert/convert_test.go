@@ -0,0 +1,188 @@
+package convert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTimestamp = int64(1700000000)
+	testInterval  = int64(300)
+)
+
+var testIfaces = []string{"eth0", "eth1"}
+
+func TestConvert(t *testing.T) {
+	src := newTestDB(t)
+
+	for _, encoderType := range []encoders.Type{encoders.EncoderTypeNull, encoders.EncoderTypeLZ4, encoders.EncoderTypeZSTD} {
+		t.Run(encoderType.String(), func(t *testing.T) {
+			dst := t.TempDir()
+
+			var lastProgress Progress
+			stats, err := Run(context.Background(), src, dst,
+				WithEncoderType(encoderType),
+				WithEncoderLevel(3),
+				WithWorkers(2),
+				WithProgress(func(p Progress) {
+					lastProgress = p
+				}),
+			)
+			require.Nil(t, err)
+			require.Equal(t, Stats{Dirs: 4, Blocks: 22}, *stats)
+			require.Equal(t, 4, lastProgress.Done)
+			require.Equal(t, 4, lastProgress.Total)
+
+			requireEqualDBs(t, src, dst, encoderType)
+
+			_, err = info.ReadManifest(dst)
+			require.Nil(t, err)
+			_, err = os.Stat(filepath.Join(dst, info.TagsFileName))
+			require.Nil(t, err)
+		})
+	}
+
+	t.Run("destination inside DB", func(t *testing.T) {
+		_, err := Run(context.Background(), src, filepath.Join(src, "converted"))
+		require.NotNil(t, err)
+	})
+}
+
+func TestConvertResume(t *testing.T) {
+	src, dst := newTestDB(t), t.TempDir()
+
+	stats, err := Run(context.Background(), src, dst, WithEncoderType(encoders.EncoderTypeNull))
+	require.Nil(t, err)
+	require.Equal(t, 4, stats.Dirs)
+
+	// Simulate an interruption while converting the last directory: it is not recorded in the
+	// checkpoint and only partially written
+	checkpoint, err := os.ReadFile(filepath.Join(dst, CheckpointFileName))
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(checkpoint)), "\n")
+	require.Len(t, lines, 4)
+	require.Nil(t, os.WriteFile(filepath.Join(dst, CheckpointFileName), []byte(strings.Join(lines[:3], "\n")+"\n"), 0644))
+
+	partial, err := filepath.Glob(filepath.Join(dst, lines[3]+"*"))
+	require.Nil(t, err)
+	require.Len(t, partial, 1)
+	require.Nil(t, os.Remove(filepath.Join(partial[0], types.ColumnFileNames[types.SIPColIdx]+".gpf")))
+
+	stats, err = Run(context.Background(), src, dst, WithEncoderType(encoders.EncoderTypeNull))
+	require.Nil(t, err)
+	require.Equal(t, 1, stats.Dirs)
+	require.Equal(t, 3, stats.Resumed)
+
+	requireEqualDBs(t, src, dst, encoders.EncoderTypeNull)
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		stats, err := Run(ctx, src, t.TempDir())
+		require.ErrorIs(t, err, context.Canceled)
+		require.Zero(t, stats.Dirs)
+	})
+}
+
+// newTestDB writes two days worth of blocks for all test interfaces
+func newTestDB(t *testing.T) string {
+	t.Helper()
+
+	dbPath := t.TempDir()
+	manifest := info.NewManifest()
+	for _, iface := range testIfaces {
+		w := goDB.NewDBWriter(dbPath, iface, encoders.EncoderTypeNull).Manifest(manifest)
+		for i := int64(0); i < 10; i++ {
+			require.Nil(t, w.Write(testFlows(byte(i)), capturetypes.CaptureStats{}, testTimestamp+i*testInterval))
+		}
+		require.Nil(t, w.Write(testFlows(1), capturetypes.CaptureStats{}, testTimestamp+gpfile.EpochDay))
+	}
+	require.Nil(t, manifest.Write(dbPath, 0644))
+
+	registry := make(info.TagRegistry)
+	_, err := registry.Register("web")
+	require.Nil(t, err)
+	require.Nil(t, registry.Write(dbPath, 0644))
+
+	return dbPath
+}
+
+// requireEqualDBs ensures that all blocks (and their traffic metadata) of src and dst are identical and
+// that the blocks of dst were written using the expected encoder (blocks not benefiting from compression
+// are always stored using the null encoder)
+func requireEqualDBs(t *testing.T, src, dst string, encoderType encoders.Type) {
+	t.Helper()
+
+	var nEncoded int
+
+	for _, iface := range testIfaces {
+		srcDirs, err := filepath.Glob(filepath.Join(src, iface, "*", "*", "*"))
+		require.Nil(t, err)
+		dstDirs, err := filepath.Glob(filepath.Join(dst, iface, "*", "*", "*"))
+		require.Nil(t, err)
+		require.Len(t, dstDirs, len(srcDirs))
+
+		for i := range srcDirs {
+			require.Equal(t, filepath.Base(srcDirs[i]), filepath.Base(dstDirs[i]))
+
+			timestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(srcDirs[i]))
+			require.Nil(t, err)
+
+			srcDir := gpfile.NewDirReader(filepath.Join(src, iface), timestamp, suffix)
+			require.Nil(t, srcDir.Open())
+			dstDir := gpfile.NewDirReader(filepath.Join(dst, iface), timestamp, suffix)
+			require.Nil(t, dstDir.Open())
+
+			require.Equal(t, srcDir.NBlocks(), dstDir.NBlocks())
+			require.Equal(t, srcDir.Metadata.Counts, dstDir.Metadata.Counts)
+			require.Equal(t, srcDir.BlockTraffic, dstDir.BlockTraffic)
+			for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+				for blockIdx, block := range dstDir.BlockMetadata[colIdx].Blocks() {
+					srcBlock := srcDir.BlockMetadata[colIdx].BlockList[blockIdx]
+					require.Equal(t, srcBlock.Timestamp, block.Timestamp)
+					if srcBlock.Len == 0 {
+						require.Zero(t, block.Len)
+						continue
+					}
+					if block.EncoderType.Base() == encoderType {
+						nEncoded++
+					} else {
+						require.Equal(t, encoders.EncoderTypeNull, block.EncoderType.Base())
+					}
+
+					srcData, err := srcDir.ReadBlockAtIndex(colIdx, blockIdx)
+					require.Nil(t, err)
+					dstData, err := dstDir.ReadBlockAtIndex(colIdx, blockIdx)
+					require.Nil(t, err)
+					require.Equal(t, srcData, dstData)
+					require.Equal(t, srcDir.DeltaPackedAtIndex(colIdx, blockIdx), dstDir.DeltaPackedAtIndex(colIdx, blockIdx))
+				}
+			}
+			require.Nil(t, srcDir.Close())
+			require.Nil(t, dstDir.Close())
+		}
+	}
+	require.Positive(t, nEncoded)
+}
+
+func testFlows(seed byte) *hashmap.AggFlowMap {
+	flows := hashmap.NewAggFlowMap()
+	for i := byte(0); i < 100; i++ {
+		flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, seed, i}, [4]byte{10, 0, 1, i}, []byte{0, 80}, 6),
+			types.Counters{BytesRcvd: uint64(seed) + 100, BytesSent: 50, PacketsRcvd: 2, PacketsSent: 1})
+	}
+	return flows
+}
@@ -11,31 +11,61 @@
 package goDB
 
 import (
+	"cmp"
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"slices"
+	"sync"
 
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
 	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
-	"github.com/fako1024/gotools/bitpack"
 )
 
 // DefaultPermissions denotes the default permissions used during writeout
 const DefaultPermissions = fs.FileMode(0644)
 
+// ProcessAttributor attributes flows to the local processes owning their sockets
+type ProcessAttributor interface {
+
+	// ProcessID returns the ID of the label of the process a flow is attributed to (zero if the
+	// flow cannot be attributed to any process)
+	ProcessID(key types.Key) uint32
+}
+
 // DBWriter writes goProbe flows to goDB database files
 type DBWriter struct {
 	dbpath string
 	iface  string
 
-	encoderType  encoders.Type
-	encoderLevel int
-	permissions  fs.FileMode
+	encoderType      encoders.Type
+	encoderLevel     int
+	adaptiveEncoding *gpfile.AdaptiveEncoding
+	blockFrames      bool
+	permissions      fs.FileMode
+
+	manifest   *info.Manifest
+	tagger     *node.Tagger
+	decapTags  DecapsulationTags
+	attributor ProcessAttributor
+
+	metadataCache *MetadataCache
+	origin        gpfile.Origin
+	accounting    string
+
+	flowSizesObserver func(sizes gpfile.FlowSizes)
 }
 
+// DecapsulationTags denotes the bitmaps of the flow tags marking decapsulated flows (per
+// encapsulation type)
+type DecapsulationTags [capturetypes.NumEncapsulations]uint64
+
 // NewDBWriter initializes a new DBWriter
 func NewDBWriter(dbpath string, iface string, encoderType encoders.Type) (w *DBWriter) {
 	return &DBWriter{
@@ -58,29 +88,110 @@ func (w *DBWriter) EncoderLevel(level int) *DBWriter {
 	return w
 }
 
+// AdaptiveEncoding enables the per-block selection of the encoder for files / directories in the DB
+// (disabled if nil)
+func (w *DBWriter) AdaptiveEncoding(adaptiveEncoding *gpfile.AdaptiveEncoding) *DBWriter {
+	w.adaptiveEncoding = adaptiveEncoding
+	return w
+}
+
+// BlockFrames enables / disables preceding each block written to the column files of the DB with a frame
+// header, allowing to rebuild the metadata of a directory from its column files (see gpfile.WithBlockFrames)
+func (w *DBWriter) BlockFrames(enabled bool) *DBWriter {
+	w.blockFrames = enabled
+	return w
+}
+
+// Manifest sets a DB manifest which is updated on each write
+func (w *DBWriter) Manifest(manifest *info.Manifest) *DBWriter {
+	w.manifest = manifest
+	return w
+}
+
+// Tagger sets a flow tagger, whose bitmap of tags is stored for each flow in the tags column
+// (the column remains empty if no tagger is set)
+func (w *DBWriter) Tagger(tagger *node.Tagger) *DBWriter {
+	w.tagger = tagger
+	return w
+}
+
+// DecapsulationTags sets the flow tags marking decapsulated flows, which are added to the tags column
+// of all flows written via WriteCaptured() according to their encapsulation
+func (w *DBWriter) DecapsulationTags(tags DecapsulationTags) *DBWriter {
+	w.decapTags = tags
+	return w
+}
+
+// ProcessAttributor sets a process attributor, whose process ID is stored for each flow in the process
+// column (the column remains empty if no attributor is set)
+func (w *DBWriter) ProcessAttributor(attributor ProcessAttributor) *DBWriter {
+	w.attributor = attributor
+	return w
+}
+
+// MetadataCache sets a metadata cache, which is updated with the metadata of the daily directory
+// on each write
+func (w *DBWriter) MetadataCache(cache *MetadataCache) *DBWriter {
+	w.metadataCache = cache
+	return w
+}
+
+// Origin sets the origin of the flows (i.e. the capturing host), which is stored in each directory
+// written to, so that the data remains attributable to its origin if the DB is copied off the host
+func (w *DBWriter) Origin(origin gpfile.Origin) *DBWriter {
+	w.origin = origin
+	return w
+}
+
+// ByteAccounting sets the basis the traffic volume of the flows is accounted on, which is recorded in
+// each directory written to (alongside the bases of any data written previously)
+func (w *DBWriter) ByteAccounting(basis string) *DBWriter {
+	w.accounting = basis
+	return w
+}
+
+// FlowSizesObserver sets a function, which is called with the flow size histograms of each block
+// written (e.g. in order to expose them as metrics)
+func (w *DBWriter) FlowSizesObserver(observer func(sizes gpfile.FlowSizes)) *DBWriter {
+	w.flowSizesObserver = observer
+	return w
+}
+
 // Write takes an aggregated flow map and its metadata and writes it to disk for a given timestamp
 func (w *DBWriter) Write(flowmap *hashmap.AggFlowMap, captureStats capturetypes.CaptureStats, timestamp int64) error {
+	return w.WriteCaptured(flowmap, capturetypes.FlowAttributes{}, captureStats, timestamp)
+}
+
+// WriteCaptured takes an aggregated flow map, the attributes recorded along with its flows (e.g. their
+// encapsulations, VLAN IDs or MAC addresses) and its metadata and writes it to disk for a given timestamp
+func (w *DBWriter) WriteCaptured(flowmap *hashmap.AggFlowMap, attrs capturetypes.FlowAttributes, captureStats capturetypes.CaptureStats, timestamp int64) error {
 	var (
-		data   [types.ColIdxCount][]byte
-		update gpfile.Stats
-		err    error
+		data        [types.ColIdxCount][]byte
+		deltaPacked []types.ColumnIndex
+		update      gpfile.Stats
+		sizes       gpfile.FlowSizes
+		err         error
 	)
 
-	dir := gpfile.NewDirWriter(filepath.Join(w.dbpath, w.iface), timestamp, gpfile.WithPermissions(w.permissions), gpfile.WithEncoderTypeLevel(w.encoderType, w.encoderLevel))
+	dir := gpfile.NewDirWriter(filepath.Join(w.dbpath, w.iface), timestamp, w.dirOptions()...)
 	if err = dir.Open(); err != nil {
 		return fmt.Errorf("failed to create / open daily directory: %w", err)
 	}
 
-	data, update = dbData(flowmap)
+	data, deltaPacked, update, sizes = dbData(flowmap, w.flowTags(attrs.Decapsulated()), w.attributor, attrs)
 	if err := dir.WriteBlocks(timestamp, gpfile.TrafficMetadata{
 		NumV4Entries: update.Traffic.NumV4Entries,
 		NumV6Entries: update.Traffic.NumV6Entries,
 		NumDrops:     captureStats.Dropped,
-	}, update.Counts, data); err != nil {
+	}, gpfile.BlockOrderSorted, update.Counts, data, deltaPacked...); err != nil {
+		return err
+	}
+	if err := w.setFlowSizes(dir, timestamp, sizes); err != nil {
 		return err
 	}
+	w.updateManifest(dir, timestamp)
 
-	return dir.Close()
+	return w.closeDir(dir, timestamp)
 }
 
 // BulkWorkload denotes a set of workloads / writes to perform during WriteBulk()
@@ -90,83 +201,356 @@ type BulkWorkload struct {
 	Timestamp    int64
 }
 
-// WriteBulk takes multiple aggregated flow maps and their metadata and writes it to disk for a given timestamp
+// WriteBulk takes multiple aggregated flow maps and their metadata and writes it to disk for a given timestamp.
+// Workloads may be provided in any order and may predate data already present (e.g. when ingesting late or
+// historical data), but must not overlap with each other or with any existing block
 func (w *DBWriter) WriteBulk(workloads []BulkWorkload, dirTimestamp int64) (err error) {
 	var (
-		data   [types.ColIdxCount][]byte
-		update gpfile.Stats
+		data        [types.ColIdxCount][]byte
+		deltaPacked []types.ColumnIndex
+		update      gpfile.Stats
+		sizes       gpfile.FlowSizes
 	)
 
-	dir := gpfile.NewDirWriter(filepath.Join(w.dbpath, w.iface), dirTimestamp, gpfile.WithPermissions(w.permissions), gpfile.WithEncoderTypeLevel(w.encoderType, w.encoderLevel))
+	// Write the workloads in chronological order (minimizing the number of blocks that have to be inserted
+	// instead of appended) and reject overlapping workloads prior to writing any data
+	workloads = slices.Clone(workloads)
+	slices.SortStableFunc(workloads, func(a, b BulkWorkload) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+	for i := 1; i < len(workloads); i++ {
+		if workloads[i].Timestamp == workloads[i-1].Timestamp {
+			return fmt.Errorf("%w: duplicate workload for timestamp=%d", gpfile.ErrBlockExists, workloads[i].Timestamp)
+		}
+	}
+
+	dir := gpfile.NewDirWriter(filepath.Join(w.dbpath, w.iface), dirTimestamp, w.dirOptions()...)
 	if err = dir.Open(); err != nil {
 		return fmt.Errorf("failed to create / open daily directory: %w", err)
 	}
 
 	for _, workload := range workloads {
-		data, update = dbData(workload.FlowMap)
+		data, deltaPacked, update, sizes = dbData(workload.FlowMap, w.flowTags(false), w.attributor, capturetypes.FlowAttributes{})
 		if err := dir.WriteBlocks(workload.Timestamp, gpfile.TrafficMetadata{
 			NumV4Entries: update.Traffic.NumV4Entries,
 			NumV6Entries: update.Traffic.NumV6Entries,
 			NumDrops:     workload.CaptureStats.Dropped,
-		}, update.Counts, data); err != nil {
+		}, gpfile.BlockOrderSorted, update.Counts, data, deltaPacked...); err != nil {
 			return err
 		}
+		if err := w.setFlowSizes(dir, workload.Timestamp, sizes); err != nil {
+			return err
+		}
+		w.updateManifest(dir, workload.Timestamp)
+	}
+
+	return w.closeDir(dir, dirTimestamp)
+}
+
+// closeDir closes the daily directory written to and updates the metadata cache (if any)
+func (w *DBWriter) closeDir(dir *gpfile.GPDir, timestamp int64) error {
+	// The metadata has to be copied prior to closing the directory (which releases it), while the
+	// header version is only determined upon writing it
+	var meta *gpfile.Metadata
+	if w.metadataCache != nil {
+		meta = dir.Metadata.Clone()
+	}
+	if err := dir.Close(); err != nil {
+		return err
+	}
+	if w.manifest != nil {
+		w.manifest.UpdateFormatVersion(dir.Version)
+	}
+	if meta != nil {
+		meta.Version = dir.Version
+		w.metadataCache.Update(filepath.Join(w.dbpath, w.iface), gpfile.DirTimestamp(timestamp), meta)
+	}
+
+	return nil
+}
+
+// setFlowSizes stores the flow size histograms of the block written for timestamp and passes them on to
+// the observer (if any)
+func (w *DBWriter) setFlowSizes(dir *gpfile.GPDir, timestamp int64, sizes gpfile.FlowSizes) error {
+	if err := dir.SetFlowSizes(timestamp, sizes); err != nil {
+		return fmt.Errorf("failed to set flow size histograms: %w", err)
+	}
+	if w.flowSizesObserver != nil {
+		w.flowSizesObserver(sizes)
+	}
+	return nil
+}
+
+// updateManifest registers the blocks written for timestamp with the manifest (if any)
+func (w *DBWriter) updateManifest(dir *gpfile.GPDir, timestamp int64) {
+	if w.manifest == nil {
+		return
+	}
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		if block, exists := dir.BlockMetadata[colIdx].BlockAtTime(timestamp); exists {
+			w.manifest.Update(w.iface, timestamp, block.EncoderType, uint64(block.Len))
+		}
 	}
+}
+
+// flowTags returns the function determining the bitmap of tags of a flow (combining the tagger with
+// the tags marking decapsulated flows), or nil if no flow can carry any tags
+func (w *DBWriter) flowTags(decapsulated bool) func(types.Key, capturetypes.Encapsulation) uint64 {
+	if !decapsulated && w.tagger == nil {
+		return nil
+	}
+
+	return func(key types.Key, encap capturetypes.Encapsulation) (bitmap uint64) {
+		if w.tagger != nil {
+			bitmap = w.tagger.Tag(key)
+		}
+		return bitmap | w.decapTags[encap]
+	}
+}
+
+// rowAttributes denotes the attributes of a row of a block beyond the key and counters of its flow
+type rowAttributes struct {
+	capturetypes.FlowLabels
+	tcpFlags types.TCPFlags
+}
+
+// flowRows denotes the rows of a block, i.e. its flows along with their attributes (nil if no flow carries
+// any). A flow observed with different sets of labels is split into one row per share, directly following
+// each other (hence retaining the order of the flows)
+type flowRows struct {
+	flows hashmap.List
+	attrs []rowAttributes
+}
+
+// attributesAt returns the attributes of the i-th row
+func (r flowRows) attributesAt(i int) rowAttributes {
+	if r.attrs == nil {
+		return rowAttributes{}
+	}
+	return r.attrs[i]
+}
+
+// attributeColumns denotes which of the columns storing the attributes of the rows are populated (all other
+// ones are left empty, and hence not written at all)
+type attributeColumns struct {
+	vlan, macs, tcpFlags, dscp bool
+}
 
-	return dir.Close()
+func (c *attributeColumns) observe(attrs rowAttributes) {
+	c.vlan = c.vlan || attrs.VLAN != 0
+	c.macs = c.macs || !attrs.MACs.IsZero()
+	c.tcpFlags = c.tcpFlags || attrs.tcpFlags != 0
+	c.dscp = c.dscp || attrs.DSCP != 0
 }
 
-func dbData(aggFlowMap *hashmap.AggFlowMap) ([types.ColIdxCount][]byte, gpfile.Stats) {
+// splitRows splits the flows into rows according to the attributes recorded along with them, keeping
+// track of the attribute columns populated by any of them
+func splitRows(flows hashmap.List, attrs capturetypes.FlowAttributes, columns *attributeColumns) flowRows {
+	if len(attrs.Labeled) == 0 && len(attrs.TCPFlags) == 0 {
+		return flowRows{flows: flows}
+	}
+
+	rows := flowRows{
+		flows: make(hashmap.List, 0, len(flows)),
+		attrs: make([]rowAttributes, 0, len(flows)),
+	}
+	add := func(flow hashmap.Item, row rowAttributes) {
+		rows.flows = append(rows.flows, flow)
+		rows.attrs = append(rows.attrs, row)
+		columns.observe(row)
+	}
+	for _, flow := range flows {
+		shares := attrs.Labeled[string(flow.Key)]
+
+		// The remainder of the flow not covered by any share was observed without labels
+		remainder := flow.Val
+		for _, share := range shares {
+			add(hashmap.Item{Key: flow.Key, Val: share.Counters}, rowAttributes{FlowLabels: share.FlowLabels, tcpFlags: share.TCPFlags})
+			remainder.Sub(share.Counters)
+		}
+		if len(shares) == 0 || remainder.SumPackets() > 0 {
+			add(hashmap.Item{Key: flow.Key, Val: remainder}, rowAttributes{tcpFlags: attrs.TCPFlags[string(flow.Key)]})
+		}
+	}
+	return rows
+}
+
+// minParallelEncodingFlows denotes the number of flows from which on the columns of a block are
+// extracted and encoded concurrently. For smaller flow maps, the overhead of spawning goroutines
+// outweighs the gain
+var minParallelEncodingFlows = 4096
+
+// dbData extracts and encodes the columns of a block from the flows of aggFlowMap (split into one row per
+// share of the flows observed with different sets of labels)
+func dbData(aggFlowMap *hashmap.AggFlowMap, tag func(types.Key, capturetypes.Encapsulation) uint64, attributor ProcessAttributor, attrs capturetypes.FlowAttributes) ([types.ColIdxCount][]byte, []types.ColumnIndex, gpfile.Stats, gpfile.FlowSizes) {
 	var dbData [types.ColIdxCount][]byte
+	var deltaPacked []types.ColumnIndex
 	var summUpdate gpfile.Stats
+	var flowSizes gpfile.FlowSizes
 
 	v4List, v6List := aggFlowMap.Flatten()
-	v4List = v4List.Sort()
-	v6List = v6List.Sort()
-	for i := types.ColumnIndex(0); i < types.ColIdxAttributeCount; i++ {
-		columnSizeof := types.ColumnSizeofs[i]
-		if columnSizeof == types.IPSizeOf {
-			dbData[i] = make([]byte, 0, 4*len(v4List)+16*len(v6List))
-		} else {
-			dbData[i] = make([]byte, 0, types.ColumnSizeofs[i]*(len(v4List)+len(v6List)))
+	parallel := len(v4List)+len(v6List) >= minParallelEncodingFlows
+
+	runJobs(parallel,
+		func() { v4List = v4List.Sort() },
+		func() { v6List = v6List.Sort() },
+	)
+
+	// Split the (sorted) flows into rows according to their attributes
+	var columns attributeColumns
+	lists := []flowRows{splitRows(v4List, attrs, &columns), splitRows(v6List, attrs, &columns)}
+	nV4Rows, nV6Rows := len(lists[0].flows), len(lists[1].flows)
+	nRows := nV4Rows + nV6Rows
+
+	// Each column is extracted from the rows independently, so the columns can be populated and
+	// encoded concurrently while the resulting blocks remain identical to a sequential run
+	attribute := func(colIdx types.ColumnIndex, put func(column []byte, flow hashmap.Item) []byte) func() {
+		return func() {
+			size := types.ColumnSizeofs[colIdx] * nRows
+			if types.ColumnSizeofs[colIdx] == types.IPSizeOf {
+				size = 4*nV4Rows + 16*nV6Rows
+			}
+			dbData[colIdx] = make([]byte, 0, size)
+			for _, list := range lists {
+				for _, flow := range list.flows {
+					dbData[colIdx] = put(dbData[colIdx], flow)
+				}
+			}
+		}
+	}
+
+	// Counter columns are (adaptively) bit packed, keeping track of the delta encoded ones
+	var isDelta [types.ColIdxCount]bool
+	counter := func(colIdx types.ColumnIndex, get func(flow hashmap.Item, attrs rowAttributes) uint64) func() {
+		return func() {
+			values := make([]uint64, 0, nRows)
+			for _, list := range lists {
+				for i, flow := range list.flows {
+					values = append(values, get(flow, list.attributesAt(i)))
+				}
+			}
+			dbData[colIdx], isDelta[colIdx] = deltapack.Pack(values)
+		}
+	}
+
+	jobs := []func(){
+		attribute(types.SIPColIdx, func(column []byte, flow hashmap.Item) []byte { return append(column, flow.GetSIP()...) }),
+		attribute(types.DIPColIdx, func(column []byte, flow hashmap.Item) []byte { return append(column, flow.GetDIP()...) }),
+		attribute(types.ProtoColIdx, func(column []byte, flow hashmap.Item) []byte { return append(column, flow.GetProto()) }),
+		attribute(types.DportColIdx, func(column []byte, flow hashmap.Item) []byte { return append(column, flow.GetDport()...) }),
+		counter(types.BytesRcvdColIdx, func(flow hashmap.Item, _ rowAttributes) uint64 { return flow.BytesRcvd }),
+		counter(types.BytesSentColIdx, func(flow hashmap.Item, _ rowAttributes) uint64 { return flow.BytesSent }),
+		counter(types.PacketsRcvdColIdx, func(flow hashmap.Item, _ rowAttributes) uint64 { return flow.PacketsRcvd }),
+		counter(types.PacketsSentColIdx, func(flow hashmap.Item, _ rowAttributes) uint64 { return flow.PacketsSent }),
+
+		// global counters
+		func() {
+			for _, list := range lists {
+				for _, flow := range list.flows {
+					summUpdate.Counts.Add(flow.Val)
+				}
+			}
+		},
+
+		// flow size histograms
+		func() {
+			for _, list := range lists {
+				for _, flow := range list.flows {
+					flowSizes.Observe(flow.Val)
+				}
+			}
+		},
+	}
+
+	// Without a tagger (or decapsulated flows), the tags column is left empty (and hence not written at all)
+	if tag != nil {
+		jobs = append(jobs, counter(types.TagsColIdx, func(flow hashmap.Item, attrs rowAttributes) uint64 { return tag(flow.Key, attrs.Encapsulation) }))
+	}
+
+	// The same applies to the process column if no attributor is set
+	if attributor != nil {
+		jobs = append(jobs, counter(types.ProcessColIdx, func(flow hashmap.Item, _ rowAttributes) uint64 { return uint64(attributor.ProcessID(flow.Key)) }))
+	}
+
+	// ... and to the VLAN column if no flow was observed on a VLAN
+	if columns.vlan {
+		jobs = append(jobs, counter(types.VLANColIdx, func(_ hashmap.Item, attrs rowAttributes) uint64 { return uint64(attrs.VLAN) }))
+	}
+
+	// ... and to the MAC address columns if no MAC addresses were recorded
+	if columns.macs {
+		jobs = append(jobs,
+			counter(types.SMACColIdx, func(_ hashmap.Item, attrs rowAttributes) uint64 { return attrs.MACs.Src.Uint64() }),
+			counter(types.DMACColIdx, func(_ hashmap.Item, attrs rowAttributes) uint64 { return attrs.MACs.Dst.Uint64() }),
+		)
+	}
+
+	// ... and to the TCP flags column if no TCP flags were observed
+	if columns.tcpFlags {
+		jobs = append(jobs, counter(types.TCPFlagsColIdx, func(_ hashmap.Item, attrs rowAttributes) uint64 { return uint64(attrs.tcpFlags) }))
+	}
+
+	// ... and to the DSCP column if no flow was observed with a non-default DSCP
+	if columns.dscp {
+		jobs = append(jobs, counter(types.DSCPColIdx, func(_ hashmap.Item, attrs rowAttributes) uint64 { return uint64(attrs.DSCP) }))
+	}
+
+	runJobs(parallel, jobs...)
+
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		if isDelta[colIdx] {
+			deltaPacked = append(deltaPacked, colIdx)
 		}
 	}
 
-	// loop through the v4 & v6 flow maps to extract the relevant
-	// values into database blocks.
-	bytesRcvd, bytesSent, pktsRcvd, pktsSent :=
-		make([]uint64, 0, len(v4List)+len(v6List)),
-		make([]uint64, 0, len(v4List)+len(v6List)),
-		make([]uint64, 0, len(v4List)+len(v6List)),
-		make([]uint64, 0, len(v4List)+len(v6List))
-	for _, list := range []hashmap.List{v4List, v6List} {
-		for _, flow := range list {
-
-			// global counters
-			summUpdate.Counts.Add(flow.Val)
-
-			// counters
-			bytesRcvd = append(bytesRcvd, flow.BytesRcvd)
-			bytesSent = append(bytesSent, flow.BytesSent)
-			pktsRcvd = append(pktsRcvd, flow.PacketsRcvd)
-			pktsSent = append(pktsSent, flow.PacketsSent)
-
-			// attributes
-			dbData[types.DportColIdx] = append(dbData[types.DportColIdx], flow.GetDport()...)
-			dbData[types.ProtoColIdx] = append(dbData[types.ProtoColIdx], flow.GetProto())
-			dbData[types.SIPColIdx] = append(dbData[types.SIPColIdx], flow.GetSIP()...)
-			dbData[types.DIPColIdx] = append(dbData[types.DIPColIdx], flow.GetDIP()...)
+	summUpdate.Traffic.NumV4Entries = uint64(nV4Rows)
+	summUpdate.Traffic.NumV6Entries = uint64(nV6Rows)
+
+	return dbData, deltaPacked, summUpdate, flowSizes
+}
+
+// runJobs runs the jobs (concurrently if requested) and waits for all of them to complete. A panic
+// in any job is propagated to the caller
+func runJobs(parallel bool, jobs ...func()) {
+	if !parallel {
+		for _, job := range jobs {
+			job()
 		}
+		return
 	}
 
-	// Perform bit packing on the counter columns
-	dbData[types.BytesRcvdColIdx] = bitpack.Pack(bytesRcvd)
-	dbData[types.BytesSentColIdx] = bitpack.Pack(bytesSent)
-	dbData[types.PacketsRcvdColIdx] = bitpack.Pack(pktsRcvd)
-	dbData[types.PacketsSentColIdx] = bitpack.Pack(pktsSent)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		panicked any
+	)
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					once.Do(func() { panicked = r })
+				}
+			}()
+			job()
+		}()
+	}
+	wg.Wait()
 
-	summUpdate.Traffic.NumV4Entries = uint64(len(v4List))
-	summUpdate.Traffic.NumV6Entries = uint64(len(v6List))
+	if panicked != nil {
+		panic(panicked)
+	}
+}
 
-	return dbData, summUpdate
+// dirOptions returns the options of the directories written to
+func (w *DBWriter) dirOptions() []gpfile.Option {
+	opts := []gpfile.Option{gpfile.WithPermissions(w.permissions), gpfile.WithEncoderTypeLevel(w.encoderType, w.encoderLevel), gpfile.WithOrigin(w.origin), gpfile.WithByteAccounting(w.accounting)}
+	if w.adaptiveEncoding != nil {
+		opts = append(opts, gpfile.WithAdaptiveEncoding(*w.adaptiveEncoding))
+	}
+	if w.blockFrames {
+		opts = append(opts, gpfile.WithBlockFrames())
+	}
+	return opts
 }
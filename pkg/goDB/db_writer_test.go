@@ -1,7 +1,10 @@
 package goDB
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,7 +13,9 @@ import (
 
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
 	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/stretchr/testify/require"
 )
@@ -60,3 +65,191 @@ func TestPanicDuringWrite(t *testing.T) {
 	})
 
 }
+
+func TestManifestUpdate(t *testing.T) {
+
+	tempDir := t.TempDir()
+	timestamp := time.Now().Unix()
+
+	manifest := info.NewManifest()
+	w := NewDBWriter(tempDir, "test", encoders.EncoderTypeLZ4).Permissions(0600).Manifest(manifest)
+	require.Nil(t, w.Write(generateFlows(), capturetypes.CaptureStats{}, timestamp))
+	require.Nil(t, manifest.Write(tempDir, 0600))
+
+	stored, err := info.ReadManifest(tempDir)
+	require.Nil(t, err)
+	require.Contains(t, stored.Interfaces, "test")
+	require.Equal(t, []string{encoders.EncoderTypeLZ4.String()}, stored.Interfaces["test"].Encoders)
+	require.Equal(t, timestamp, stored.Interfaces["test"].First.Unix())
+	require.Equal(t, timestamp, stored.Interfaces["test"].Last.Unix())
+	require.NotZero(t, stored.SizeBytes)
+	require.NotZero(t, stored.FormatVersion)
+	require.Nil(t, stored.CheckFormatVersion())
+
+	// the manifest maintained during writes must match the one generated from the DB contents
+	built, err := info.BuildManifest(tempDir)
+	require.Nil(t, err)
+	require.Equal(t, stored.SizeBytes, built.SizeBytes)
+	require.Equal(t, stored.FormatVersion, built.FormatVersion)
+	for iface, im := range stored.Interfaces {
+		require.Contains(t, built.Interfaces, iface)
+		require.Equal(t, im.SizeBytes, built.Interfaces[iface].SizeBytes)
+		require.Equal(t, im.Encoders, built.Interfaces[iface].Encoders)
+		require.True(t, im.First.Equal(built.Interfaces[iface].First))
+		require.True(t, im.Last.Equal(built.Interfaces[iface].Last))
+	}
+}
+
+type staticAttributor uint32
+
+func (a staticAttributor) ProcessID(_ types.Key) uint32 {
+	return uint32(a)
+}
+
+func TestProcessColumnLayout(t *testing.T) {
+	for _, cfg := range []struct {
+		name            string
+		attributor      ProcessAttributor
+		expectedVersion uint64
+	}{
+		{"disabled", nil, 1},
+		{"enabled", staticAttributor(1), 3},
+	} {
+		t.Run(cfg.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			// without process attribution (e.g. if socket tracking isn't compiled in), the
+			// metadata layout must remain readable by previous releases
+			w := NewDBWriter(tempDir, "test", encoders.EncoderTypeLZ4).Permissions(0600)
+			if cfg.attributor != nil {
+				w.ProcessAttributor(cfg.attributor)
+			}
+			require.Nil(t, w.Write(generateFlows(), capturetypes.CaptureStats{}, time.Now().Unix()))
+
+			metaFiles, err := filepath.Glob(filepath.Join(tempDir, "test", "*", "*", "*", gpfile.MetadataFileName))
+			require.Nil(t, err)
+			require.Len(t, metaFiles, 1)
+
+			data, err := os.ReadFile(metaFiles[0])
+			require.Nil(t, err)
+			require.Equal(t, cfg.expectedVersion, binary.BigEndian.Uint64(data[0:8]))
+		})
+	}
+}
+
+func TestWriteBulkOutOfOrder(t *testing.T) {
+
+	tempDir := t.TempDir()
+	dayTimestamp := gpfile.DirTimestamp(time.Now().Unix())
+
+	w := NewDBWriter(tempDir, "test", encoders.EncoderTypeLZ4).Permissions(0600)
+	require.Nil(t, w.Write(generateFlows(), capturetypes.CaptureStats{}, dayTimestamp+600))
+
+	workloads := func(timestamps ...int64) (res []BulkWorkload) {
+		for _, ts := range timestamps {
+			res = append(res, BulkWorkload{
+				FlowMap:   generateFlows(),
+				Timestamp: dayTimestamp + ts,
+			})
+		}
+		return
+	}
+	blockTimestamps := func() (res []int64) {
+		t.Helper()
+		metaFiles, err := filepath.Glob(filepath.Join(tempDir, "test", "*", "*", "*", gpfile.MetadataFileName))
+		require.Nil(t, err)
+		require.Len(t, metaFiles, 1)
+
+		ts, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(filepath.Dir(metaFiles[0])))
+		require.Nil(t, err)
+		dir := gpfile.NewDirReader(filepath.Join(tempDir, "test"), ts, suffix)
+		require.Nil(t, dir.Open())
+		defer func() {
+			require.Nil(t, dir.Close())
+		}()
+		for _, block := range dir.BlockMetadata[types.SIPColIdx].Blocks() {
+			res = append(res, block.Timestamp-dayTimestamp)
+		}
+		return
+	}
+
+	// late workloads (in arbitrary order) are merged with the existing blocks
+	require.Nil(t, w.WriteBulk(workloads(900, 300, 0), dayTimestamp))
+	require.Equal(t, []int64{0, 300, 600, 900}, blockTimestamps())
+
+	// overlapping workloads are rejected without writing any data
+	require.ErrorIs(t, w.WriteBulk(workloads(1200, 450, 1200), dayTimestamp), gpfile.ErrBlockExists)
+	require.Equal(t, []int64{0, 300, 600, 900}, blockTimestamps())
+	require.ErrorIs(t, w.WriteBulk(workloads(600), dayTimestamp), gpfile.ErrBlockExists)
+	require.Equal(t, []int64{0, 300, 600, 900}, blockTimestamps())
+}
+
+func TestParallelEncoding(t *testing.T) {
+	rng := rand.New(rand.NewPCG(42, 0))
+
+	m := hashmap.NewAggFlowMap()
+	for i := 0; i < 3*minParallelEncodingFlows; i++ {
+		counters := types.Counters{BytesRcvd: rng.Uint64N(1 << 20), BytesSent: rng.Uint64N(1 << 20), PacketsRcvd: rng.Uint64N(1 << 10), PacketsSent: uint64(i)}
+		if i%4 == 0 {
+			var ip [16]byte
+			binary.BigEndian.PutUint64(ip[8:], rng.Uint64())
+			m.SecondaryMap.Set(types.NewV6KeyStatic(ip, ip, []byte{byte(i), byte(i >> 8)}, 17), counters)
+			continue
+		}
+		var sip, dip [4]byte
+		binary.BigEndian.PutUint32(sip[:], rng.Uint32())
+		binary.BigEndian.PutUint32(dip[:], rng.Uint32())
+		m.PrimaryMap.Set(types.NewV4KeyStatic(sip, dip, []byte{byte(i), byte(i >> 8)}, 6), counters)
+	}
+	tag := func(key types.Key, encap capturetypes.Encapsulation) uint64 {
+		return uint64(key.GetProto()) | uint64(encap)<<8
+	}
+
+	// every other flow is split into two shares observed with different labels
+	attrs := capturetypes.FlowAttributes{
+		Labeled:  make(capturetypes.LabeledFlows),
+		TCPFlags: make(capturetypes.TCPFlags),
+	}
+	v4List, v6List := m.Flatten()
+	expectedRows := len(v4List) + len(v6List)
+	for i, flow := range append(v4List, v6List...) {
+		key := string(flow.Key)
+		attrs.TCPFlags[key] = types.TCPFlags(flow.GetDport()[0] ^ flow.GetProto())
+		if i%2 == 0 {
+			continue
+		}
+		share := flow.Val
+		share.PacketsSent /= 2
+		if share.PacketsSent < flow.PacketsSent {
+			expectedRows++ // the remainder of the flow is stored in a row of its own
+		}
+		attrs.Labeled.Add(key, capturetypes.LabeledFlow{
+			FlowLabels: capturetypes.FlowLabels{
+				Encapsulation: capturetypes.Encapsulation(i % int(capturetypes.NumEncapsulations)),
+				VLAN:          uint16(flow.GetDport()[0]) + 1,
+				MACs:          capturetypes.MACPair{Src: types.MACFromUint64(uint64(flow.GetDport()[1])), Dst: types.MACFromUint64(uint64(flow.GetProto()))},
+				DSCP:          types.DSCP(flow.GetDport()[1]%types.MaxDSCP + 1),
+			},
+			Counters: share,
+			TCPFlags: types.TCPFlagACK,
+		})
+	}
+
+	// the blocks encoded concurrently must be identical to those encoded sequentially
+	encode := func(minFlows int) ([types.ColIdxCount][]byte, []types.ColumnIndex, gpfile.Stats, gpfile.FlowSizes) {
+		defer func(orig int) { minParallelEncodingFlows = orig }(minParallelEncodingFlows)
+		minParallelEncodingFlows = minFlows
+		return dbData(m, tag, staticAttributor(3), attrs)
+	}
+	expectedData, expectedDeltaPacked, expectedStats, expectedSizes := encode(math.MaxInt)
+	data, deltaPacked, stats, sizes := encode(0)
+
+	require.Equal(t, expectedData, data)
+	require.Equal(t, expectedDeltaPacked, deltaPacked)
+	require.Equal(t, expectedStats, stats)
+	require.Equal(t, expectedSizes, sizes)
+	require.EqualValues(t, expectedRows, stats.Traffic.NumV4Entries+stats.Traffic.NumV6Entries)
+	for colIdx := range data {
+		require.NotEmpty(t, data[colIdx], colIdx)
+	}
+}
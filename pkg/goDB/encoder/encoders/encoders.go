@@ -21,6 +21,22 @@ const (
 	MaxEncoderType = EncoderTypeLZ4
 )
 
+// FlagDeltaPacked denotes a flag in the encoder type of a block, indicating that the (decompressed) values
+// of the block are delta / zigzag encoded prior to bitpacking (see storage/deltapack). It is combined with
+// the type of the encoder / compressor used for the block. Releases not supporting delta encoding consider
+// the resulting encoder type unknown and hence reject such blocks instead of misinterpreting them
+const FlagDeltaPacked Type = 0x80
+
+// Base returns the encoder type without any flags (i.e. the encoder / compressor used for a block)
+func (t Type) Base() Type {
+	return t &^ FlagDeltaPacked
+}
+
+// IsDeltaPacked returns if the encoder type carries the FlagDeltaPacked flag
+func (t Type) IsDeltaPacked() bool {
+	return t&FlagDeltaPacked != 0
+}
+
 var encoderNames = map[Type]string{
 	EncoderTypeLZ4:                 "lz4",
 	EncoderTypeLZ4CustomDeprecated: "lz4cust",
@@ -28,9 +44,9 @@ var encoderNames = map[Type]string{
 	EncoderTypeZSTD:                "zstd",
 }
 
-// String returns a string representation of the encoding type
+// String returns a string representation of the encoding type (omitting any flags)
 func (t Type) String() string {
-	return encoderNames[t]
+	return encoderNames[t.Base()]
 }
 
 // GetTypeByString returns the encoder type based on a named string
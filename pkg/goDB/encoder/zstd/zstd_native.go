@@ -50,8 +50,8 @@ func (e *Encoder) Compress(data, buf []byte, dst io.Writer) (n int, err error) {
 		}
 	}
 
-	// Compress data
-	encData := e.encoder.EncodeAll(data, buf)
+	// Compress data (EncodeAll appends to the buffer, hence any existing content has to be discarded)
+	encData := e.encoder.EncodeAll(data, buf[:0])
 
 	// If provided, write output to the writer
 	if dst != nil {
@@ -171,6 +171,30 @@ func TestSingleCharacter(t *testing.T) {
 	decompress(t, "KLUv/QAACQAAMA==", "0")
 }
 
+func TestCompressIntoUsedBuffer(t *testing.T) {
+	in := []byte(testCases[0].uncompressed)
+
+	// The content of a reused buffer (e.g. from a memory pool) must not leak into the output
+	enc := New()
+	buf := bytes.NewBuffer(nil)
+	n, err := enc.Compress(in, bytes.Repeat([]byte{0xFF}, 1024), buf)
+	if err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+	if n != buf.Len() {
+		t.Fatalf("unexpected number of bytes written, want %d, have %d", buf.Len(), n)
+	}
+
+	out := make([]byte, len(in))
+	n, err = enc.Decompress(make([]byte, n), out, buf)
+	if err != nil {
+		t.Fatalf("failed to decompress: %s", err)
+	}
+	if string(out[:n]) != string(in) {
+		t.Fatalf("mismatch detected after compression roundtrip, want `%s`, have `%s`", in, out[:n])
+	}
+}
+
 func TestCompressUncompress(t *testing.T) {
 	for tn, tc := range testCases {
 		for i := 1; i <= MaxCompressionLevel; i++ {
@@ -3,8 +3,11 @@ package engine
 import (
 	"context"
 	"fmt"
-	"runtime"
+	"time"
 
+	"github.com/els0r/goProbe/pkg/cgroup"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/els0r/goProbe/pkg/types/workload"
@@ -15,10 +18,13 @@ type aggregateResult struct {
 	aggregatedMaps hashmap.NamedAggFlowMapWithMetadata
 	stats          *workload.Stats
 	totals         types.Counters
+	mergeDuration  time.Duration
 	err            error
 }
 
-var numProcessingUnits = runtime.NumCPU()
+// numProcessingUnits denotes the default number of processing units per query, taking into account
+// the CPU limit of the control group (if any)
+var numProcessingUnits = cgroup.NumCPU()
 
 type internalError int
 
@@ -28,6 +34,8 @@ const (
 	errorMemoryBreach
 	errorInternalProcessing
 	errorMismatchingHosts
+	errorBatchMismatch
+	errorQueryMemoryBreach
 )
 
 // Error implements the error interface for query processing errors
@@ -37,6 +45,10 @@ func (i internalError) Error() string {
 		return "memory limit exceeded"
 	case errorInternalProcessing:
 		return "internal error during query processing"
+	case errorBatchMismatch:
+		return "batched queries must cover the same time range and interfaces"
+	case errorQueryMemoryBreach:
+		return "memory limit per query exceeded"
 	}
 	return fmt.Sprintf("(!(internalError: %d))", i)
 }
@@ -52,13 +64,15 @@ func logWorkloadStats(logger *logging.L, msg string, stats *workload.Stats) {
 // Then send aggregation result over resultChan.
 // If an error occurs, aggregate may return prematurely.
 // Closes resultChan on termination.
-func (qr *QueryRunner) aggregate(ctx context.Context, mapChan <-chan hashmap.AggFlowMapWithMetadata, ifaces []string, isLowMem bool) chan aggregateResult {
+func (qr *QueryRunner) aggregate(ctx context.Context, query *goDB.Query, mapChan <-chan hashmap.AggFlowMapWithMetadata, ifaces []string, isLowMem bool, usage *queryUsage) chan aggregateResult {
 	// create channel that returns the final aggregate result
 	resultChan := make(chan aggregateResult, 1)
-	logger := logging.FromContext(ctx)
+	logger := logs.FromContext(ctx, logs.ModuleQuery)
 
+	usage.goroutinesStarted(1)
 	go func() {
 		defer close(resultChan)
+		defer usage.goroutinesDone(1)
 
 		var (
 			totals types.Counters
@@ -67,15 +81,19 @@ func (qr *QueryRunner) aggregate(ctx context.Context, mapChan <-chan hashmap.Agg
 			// Since we know that the source maps retrieved over the channel are not
 			// changed anymore we can re-use the memory allocated for the keys in them by
 			// using them for the aggregate map
-			finalMaps  = hashmap.NewNamedAggFlowMapWithMetadata(ifaces)
-			finalStats = new(workload.Stats)
+			finalMaps     = hashmap.NewNamedAggFlowMapWithMetadata(ifaces)
+			finalStats    = new(workload.Stats)
+			mergeDuration time.Duration
+
+			// estimated memory occupied by the final maps (as accounted for in the usage of the query)
+			memSize int64
 		)
 
 		// keep-alive updating of queries
 		if qr.keepAlive > 0 {
-			qr.query.Keepalive(func() {
+			query.Keepalive(func() {
 				finalStats.RLock()
-				logWorkloadStats(logger, "processing stats update", finalStats)
+				logWorkloadStats(logger.With("resources", usage.snapshot()), "processing stats update", finalStats)
 				finalStats.RUnlock()
 			}, qr.keepAlive)
 		}
@@ -83,9 +101,18 @@ func (qr *QueryRunner) aggregate(ctx context.Context, mapChan <-chan hashmap.Agg
 		for item := range mapChan {
 			if item.IsNil() || item.Interface == "" {
 				resultChan <- aggregateResult{err: errorInternalProcessing}
+
+				// the map channel is bounded, hence it has to be drained in order for the workers to finish
+				drain(mapChan)
 				return
 			}
 
+			// if the query was cancelled (e.g. due to a memory breach), the remaining items are discarded
+			if ctx.Err() != nil {
+				item.ClearFast()
+				continue
+			}
+
 			finalMap := finalMaps[item.Interface]
 			finalMap.Stats.Add(item.Stats)
 			finalStats.Add(item.Stats)
@@ -97,9 +124,15 @@ func (qr *QueryRunner) aggregate(ctx context.Context, mapChan <-chan hashmap.Agg
 			}
 
 			// Merge the item into the final map for this interface
+			tMergeStart := time.Now()
 			finalMap.Merge(item)
+			mergeDuration += time.Since(tMergeStart)
 			nAgg[item.Interface] = nAgg[item.Interface] + 1
 
+			newMemSize := flowMemEstimate(finalMaps)
+			usage.addMem(newMemSize - memSize)
+			memSize = newMemSize
+
 			// Cleanup the now unused item / map
 			if isLowMem {
 				item.Clear()
@@ -109,6 +142,12 @@ func (qr *QueryRunner) aggregate(ctx context.Context, mapChan <-chan hashmap.Agg
 		}
 
 		// Push the final result
+		if err := ctx.Err(); err != nil {
+			finalMaps.ClearFast()
+			usage.addMem(-memSize)
+			resultChan <- aggregateResult{err: err}
+			return
+		}
 		if finalMaps.Len() == 0 {
 			resultChan <- aggregateResult{}
 			return
@@ -118,8 +157,16 @@ func (qr *QueryRunner) aggregate(ctx context.Context, mapChan <-chan hashmap.Agg
 			aggregatedMaps: finalMaps,
 			stats:          finalStats,
 			totals:         totals,
+			mergeDuration:  mergeDuration,
 		}
 	}()
 
 	return resultChan
 }
+
+// drain discards all remaining items until the map channel is closed
+func drain(mapChan <-chan hashmap.AggFlowMapWithMetadata) {
+	for item := range mapChan {
+		item.ClearFast()
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// keySet denotes a compact set of flow keys, storing only a 64 bit hash of each key (including the
+// interface and labels, but excluding the timestamp). It is used to track the attribute combinations
+// observed during the baseline time range of a new talkers query without having to retain the (much
+// larger) aggregated flow maps. A hash collision merely causes a new key to be considered known
+type keySet struct {
+	withIface bool
+	hashes    map[uint64]struct{}
+
+	hash *maphash.Hash
+	buf  [8]byte
+}
+
+func newKeySet(withIface bool) *keySet {
+	return &keySet{
+		withIface: withIface,
+		hashes:    make(map[uint64]struct{}),
+		hash:      new(maphash.Hash),
+	}
+}
+
+// sum computes the hash of the key observed on the interface
+func (k *keySet) sum(iface string, key types.ExtendedKey) uint64 {
+	k.hash.Reset()
+	if k.withIface {
+		_, _ = k.hash.WriteString(iface)
+		_ = k.hash.WriteByte(0)
+	}
+	_, _ = k.hash.Write(key.Key())
+	if bitmap, hasTags := key.AttrTags(); hasTags {
+		binary.BigEndian.PutUint64(k.buf[:], bitmap)
+		_, _ = k.hash.Write(k.buf[:])
+	}
+	if id, hasProcess := key.AttrProcess(); hasProcess {
+		binary.BigEndian.PutUint32(k.buf[:4], id)
+		_, _ = k.hash.Write(k.buf[:4])
+	}
+	if vlan, hasVLAN := key.AttrVLAN(); hasVLAN {
+		binary.BigEndian.PutUint16(k.buf[:2], vlan)
+		_, _ = k.hash.Write(k.buf[:2])
+	}
+	if smac, hasSMAC := key.AttrSMAC(); hasSMAC {
+		_, _ = k.hash.Write(smac[:])
+	}
+	if dmac, hasDMAC := key.AttrDMAC(); hasDMAC {
+		_, _ = k.hash.Write(dmac[:])
+	}
+	if flags, hasTCPFlags := key.AttrTCPFlags(); hasTCPFlags {
+		_ = k.hash.WriteByte(byte(flags))
+	}
+	if dscp, hasDSCP := key.AttrDSCP(); hasDSCP {
+		_ = k.hash.WriteByte(byte(dscp))
+	}
+	return k.hash.Sum64()
+}
+
+// add adds the key observed on the interface to the set
+func (k *keySet) add(iface string, key types.ExtendedKey) {
+	k.hashes[k.sum(iface, key)] = struct{}{}
+}
+
+// contains returns whether the key observed on the interface is part of the set
+func (k *keySet) contains(iface string, key types.ExtendedKey) bool {
+	_, exists := k.hashes[k.sum(iface, key)]
+	return exists
+}
+
+// Len returns the number of keys in the set
+func (k *keySet) Len() int {
+	return len(k.hashes)
+}
+
+// collectBaseline runs a pass over the baseline time range of the statement, collecting the keys
+// observed during it. The same attributes, interfaces and conditions as for the statement apply,
+// whereas the time bins are ignored (a key observed at any time during the baseline is known)
+func (qr *QueryRunner) collectBaseline(ctx context.Context, stmt *query.Statement, zones info.Zones, tags info.TagRegistry) (*keySet, error) {
+	baseline := *stmt
+	baseline.Ifaces = slices.Clone(stmt.Ifaces)
+	baseline.First, baseline.Last = stmt.BaselineFirst, stmt.BaselineLast
+	baseline.BaselineFirst, baseline.BaselineLast = 0, 0
+	baseline.LabelSelector.Timestamp = false
+
+	// none of the supplementary information is required for the baseline
+	baseline.Live, baseline.Profile, baseline.Drops, baseline.Provenance = false, false, false, false
+	baseline.MatrixSrcGroups, baseline.MatrixDstGroups = nil, nil
+
+	e, err := qr.prepareExecution(&baseline, zones, tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare baseline: %w", err)
+	}
+	defer e.result.End()
+
+	e.collect = newKeySet(stmt.LabelSelector.Iface)
+	if _, err := qr.execute(ctx, []*execution{e}, zones, tags, nil); err != nil {
+		return nil, fmt.Errorf("failed to collect baseline: %w", err)
+	}
+	return e.collect, nil
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/telemetry/tracing"
+)
+
+// DryRun implements the query.DryRunner interface: the query is prepared (validating it in the process)
+// and its cost is estimated from the metadata of the DB without reading any blocks
+func (qr *QueryRunner) DryRun(ctx context.Context, args *query.Args) (*results.DryRun, error) {
+	_, span := tracing.Start(ctx, "(*engine.QueryRunner).DryRun")
+	defer span.End()
+
+	stmt, err := qr.prepare(args)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err := info.ReadZones(qr.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read interface zones: %w", err)
+	}
+	tags, err := info.ReadTagRegistry(qr.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flow tags: %w", err)
+	}
+	e, err := qr.prepareExecution(stmt, zones, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun := &results.DryRun{
+		First:      time.Unix(stmt.First, 0),
+		Last:       time.Unix(stmt.Last, 0),
+		Interfaces: stmt.Ifaces,
+		Warnings:   e.result.Query.Warnings,
+	}
+
+	// the options affecting which directories are read have to match the ones of the execution
+	var opts []goDB.WorkManagerOption
+	if stmt.Drops {
+		opts = append(opts, goDB.WithDropTracking())
+	}
+	if qr.metadataCache != nil {
+		opts = append(opts, goDB.WithMetadataCache(qr.metadataCache))
+	}
+
+	// queries for new talkers additionally scan the baseline time range
+	ranges := [][2]int64{{stmt.First, stmt.Last}}
+	if stmt.HasBaseline() {
+		ranges = append(ranges, [2]int64{stmt.BaselineFirst, stmt.BaselineLast})
+	}
+
+	for _, iface := range stmt.Ifaces {
+		workManager, err := goDB.NewDBWorkManager(e.query, qr.dbPath, iface, 1, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize query work manager for interface '%s': %w", iface, err)
+		}
+		for i, r := range ranges {
+			cost, err := workManager.EstimateCost(r[0], r[1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to estimate query cost for interface '%s': %w", iface, err)
+			}
+			if i > 0 {
+				cost.Interfaces = 0
+			}
+			dryRun.Cost.Add(cost)
+		}
+	}
+
+	return dryRun, nil
+}
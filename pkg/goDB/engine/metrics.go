@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	querySubsystem = "query"
+)
+
+var workerStallSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: querySubsystem,
+	Name:      "worker_stall_seconds_total",
+	Help:      "Total time query workers spent blocked passing their results on to the merge stage, accumulated across all workers",
+}, []string{"iface"})
+
+var workerThrottledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: querySubsystem,
+	Name:      "worker_throttled_total",
+	Help:      "Total number of times the number of concurrently processing query workers was reduced because the merge stage could not keep up",
+}, []string{"iface"})
+
+var dirsPrunedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: querySubsystem,
+	Name:      "directories_pruned_total",
+	Help:      "Total number of directories skipped by queries since their IP filter ruled out all IPs required by the query condition",
+}, []string{"iface"})
+
+func init() {
+	prometheus.MustRegister(
+		workerStallSeconds,
+		workerThrottledTotal,
+		dirsPrunedTotal,
+	)
+}
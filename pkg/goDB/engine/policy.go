@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// ResourcePolicy restricts the resources available to queries during recurring time windows (e.g. fewer
+// processing units and a lower memory ceiling during peak capture hours), so that analytics workloads
+// do not jeopardize capture fidelity
+type ResourcePolicy struct {
+	Name     string
+	Windows  types.TimeWindows
+	Location *time.Location // location the windows are evaluated in (the local one if nil)
+
+	MaxProcessingUnits int // maximum number of processing units (unrestricted if zero)
+	MaxMemPct          int // maximum percentage of available host memory (unrestricted if zero)
+}
+
+// ResourcePolicies denotes an ordered list of resource policies. If several policies are in effect
+// at the same time, the first one applies
+type ResourcePolicies []ResourcePolicy
+
+// Active returns the policy in effect at time t (or nil if there is none)
+func (p ResourcePolicies) Active(t time.Time) *ResourcePolicy {
+	for i, policy := range p {
+		loc := policy.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		if policy.Windows.Contains(t.In(loc)) {
+			return &p[i]
+		}
+	}
+	return nil
+}
+
+// limits returns the number of processing units and the memory ceiling resulting from applying the
+// policy to the requested ones
+func (p *ResourcePolicy) limits(processingUnits, maxMemPct int) (int, int) {
+	if p.MaxProcessingUnits > 0 {
+		processingUnits = min(processingUnits, p.MaxProcessingUnits)
+	}
+	if p.MaxMemPct > 0 && (maxMemPct <= 0 || maxMemPct > p.MaxMemPct) {
+		maxMemPct = p.MaxMemPct
+	}
+	return processingUnits, maxMemPct
+}
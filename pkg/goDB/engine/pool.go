@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/cgroup"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+// QueryPool bounds the processing units shared by all queries run concurrently by a query runner, so
+// that a single (pathological) query can neither occupy all CPUs of the host (starving e.g. the writeout
+// of the capture) nor the other queries. Processing units are granted in the order the queries request
+// them. Optionally, the (estimated) memory occupied by the flows aggregated by each query is capped
+type QueryPool struct {
+	size        int    // total number of processing units shared by all queries
+	maxPerQuery int    // maximum number of processing units granted to a single query
+	maxQueryMem uint64 // maximum memory a single query may occupy (unrestricted if zero)
+
+	free    int
+	waiters []*poolWaiter
+	sync.Mutex
+}
+
+type poolWaiter struct {
+	units int
+	ready chan struct{}
+}
+
+// DefaultQueryPoolSize returns the default number of processing units shared by all queries, leaving
+// one CPU to the capture (and its writeout) on hosts with more than one. CPU limits of the control
+// group (e.g. of a container) are taken into account
+func DefaultQueryPoolSize() int {
+	return max(1, cgroup.NumCPU()-1)
+}
+
+// NewQueryPool creates a pool of size processing units (DefaultQueryPoolSize() if zero), granting at
+// most maxPerQuery of them to a single query (half of the pool if zero) and restricting each query to
+// maxQueryMem bytes of aggregated flows (unrestricted if zero)
+func NewQueryPool(size, maxPerQuery int, maxQueryMem uint64) *QueryPool {
+	if size <= 0 {
+		size = DefaultQueryPoolSize()
+	}
+	if maxPerQuery <= 0 {
+		maxPerQuery = max(1, size/2)
+	}
+	return &QueryPool{
+		size:        size,
+		maxPerQuery: min(maxPerQuery, size),
+		maxQueryMem: maxQueryMem,
+		free:        size,
+	}
+}
+
+// Size returns the total number of processing units shared by all queries
+func (p *QueryPool) Size() int {
+	return p.size
+}
+
+// Free returns the number of processing units currently not granted to any query
+func (p *QueryPool) Free() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.free
+}
+
+// acquire waits until processing units are available and grants them to the query. The number of units
+// granted is the requested one, limited to the maximum per query. They have to be returned via release()
+func (p *QueryPool) acquire(ctx context.Context, requested int) (int, error) {
+	units := max(1, min(requested, p.maxPerQuery))
+
+	p.Lock()
+	if len(p.waiters) == 0 && p.free >= units {
+		p.free -= units
+		p.Unlock()
+		return units, nil
+	}
+	w := &poolWaiter{units: units, ready: make(chan struct{})}
+	p.waiters = append(p.waiters, w)
+	p.Unlock()
+
+	select {
+	case <-w.ready:
+		return units, nil
+	case <-ctx.Done():
+		p.Lock()
+		select {
+		case <-w.ready:
+			// the units were granted concurrently, hence they have to be returned
+			p.free += units
+		default:
+			for i, waiter := range p.waiters {
+				if waiter == w {
+					p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		p.grant()
+		p.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// release returns processing units granted via acquire() to the pool
+func (p *QueryPool) release(units int) {
+	p.Lock()
+	p.free += units
+	p.grant()
+	p.Unlock()
+}
+
+// grant hands out the available processing units to the waiting queries (in order). It must be called
+// with the lock held
+func (p *QueryPool) grant() {
+	for len(p.waiters) > 0 && p.free >= p.waiters[0].units {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		p.free -= w.units
+		close(w.ready)
+	}
+}
+
+// queryUsage accounts the resources spent on a query: the processing units granted to it, the goroutines
+// run on its behalf and the (estimated) memory occupied by the flows it aggregated
+type queryUsage struct {
+	hostname        string
+	processingUnits int
+	queueWait       time.Duration
+
+	goroutines, peakGoroutines atomic.Int64
+	mem, peakMem               atomic.Int64
+
+	maxMem     int64         // maximum memory the query may occupy (unrestricted if zero)
+	breached   chan struct{} // closed once the memory occupied by the query exceeds maxMem
+	breachOnce sync.Once
+}
+
+func newQueryUsage(hostname string, maxMem uint64) *queryUsage {
+	return &queryUsage{
+		hostname: hostname,
+		maxMem:   int64(maxMem),
+		breached: make(chan struct{}),
+	}
+}
+
+// goroutinesStarted / goroutinesDone track the goroutines run on behalf of the query
+func (u *queryUsage) goroutinesStarted(n int) {
+	current := u.goroutines.Add(int64(n))
+	for peak := u.peakGoroutines.Load(); current > peak && !u.peakGoroutines.CompareAndSwap(peak, current); {
+		peak = u.peakGoroutines.Load()
+	}
+}
+
+func (u *queryUsage) goroutinesDone(n int) {
+	u.goroutines.Add(-int64(n))
+}
+
+// addMem tracks a change of the memory occupied by the query, flagging a breach of its limit (if any)
+func (u *queryUsage) addMem(delta int64) {
+	current := u.mem.Add(delta)
+	for peak := u.peakMem.Load(); current > peak && !u.peakMem.CompareAndSwap(peak, current); {
+		peak = u.peakMem.Load()
+	}
+	if u.maxMem > 0 && current > u.maxMem {
+		u.breachOnce.Do(func() {
+			close(u.breached)
+		})
+	}
+}
+
+// snapshot returns the current resource usage of the query
+func (u *queryUsage) snapshot() results.ResourceUsage {
+	return results.ResourceUsage{
+		Hostname:        u.hostname,
+		ProcessingUnits: u.processingUnits,
+		Goroutines:      int(u.goroutines.Load()),
+		PeakGoroutines:  int(u.peakGoroutines.Load()),
+		MemBytes:        uint64(max(0, u.mem.Load())),
+		PeakMemBytes:    uint64(max(0, u.peakMem.Load())),
+		QueueWait:       u.queueWait,
+	}
+}
+
+// flowMemOverhead denotes the estimated memory occupied by an aggregated flow in addition to its key,
+// i.e. its counters and its share of the buckets of the map (given their load factor)
+const flowMemOverhead = 72
+
+// flowMemEstimate estimates the memory occupied by the flows of the aggregated maps
+func flowMemEstimate(maps hashmap.NamedAggFlowMapWithMetadata) (size int64) {
+	for _, m := range maps {
+		if m.IsNil() {
+			continue
+		}
+		size += int64(m.PrimaryMap.Len()) * int64(types.KeyWidthIPv4+flowMemOverhead)
+		size += int64(m.SecondaryMap.Len()) * int64(types.KeyWidthIPv6+flowMemOverhead)
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryPoolDefaults(t *testing.T) {
+	pool := NewQueryPool(0, 0, 0)
+	require.Equal(t, DefaultQueryPoolSize(), pool.Size())
+	require.Equal(t, max(1, pool.Size()/2), pool.maxPerQuery)
+
+	pool = NewQueryPool(4, 8, 0)
+	require.Equal(t, 4, pool.maxPerQuery)
+}
+
+func TestQueryPoolAcquire(t *testing.T) {
+	pool := NewQueryPool(4, 3, 0)
+
+	// the units granted are limited to the maximum per query (and at least one)
+	units, err := pool.acquire(context.Background(), 8)
+	require.Nil(t, err)
+	require.Equal(t, 3, units)
+	require.Equal(t, 1, pool.Free())
+
+	units, err = pool.acquire(context.Background(), 0)
+	require.Nil(t, err)
+	require.Equal(t, 1, units)
+	require.Zero(t, pool.Free())
+
+	// queries waiting for processing units are served in order
+	granted := make(chan int, 2)
+	for _, requested := range []int{2, 1} {
+		go func(requested int) {
+			units, err := pool.acquire(context.Background(), requested)
+			require.Nil(t, err)
+			granted <- units
+		}(requested)
+		require.Eventually(t, func() bool {
+			pool.Lock()
+			defer pool.Unlock()
+			return len(pool.waiters) > 0 && pool.waiters[len(pool.waiters)-1].units == requested
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	pool.release(1)
+	select {
+	case units := <-granted:
+		t.Fatalf("unexpectedly granted %d unit(s) ahead of the first waiting query", units)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	pool.release(3)
+	require.ElementsMatch(t, []int{2, 1}, []int{<-granted, <-granted})
+	require.Equal(t, 1, pool.Free())
+
+	// waiting is aborted once the context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.acquire(ctx, 2)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, pool.Free())
+
+	pool.release(3)
+	require.Equal(t, 4, pool.Free())
+}
+
+func TestQueryUsage(t *testing.T) {
+	usage := newQueryUsage("hostA", 100)
+
+	usage.goroutinesStarted(4)
+	usage.goroutinesDone(3)
+	usage.goroutinesStarted(1)
+	usage.addMem(60)
+	usage.addMem(-20)
+
+	require.Equal(t, results.ResourceUsage{
+		Hostname:       "hostA",
+		Goroutines:     2,
+		PeakGoroutines: 4,
+		MemBytes:       40,
+		PeakMemBytes:   60,
+	}, usage.snapshot())
+
+	select {
+	case <-usage.breached:
+		t.Fatal("memory limit unexpectedly breached")
+	default:
+	}
+
+	// exceeding the memory limit is flagged (only once)
+	usage.addMem(70)
+	usage.addMem(10)
+	select {
+	case <-usage.breached:
+	default:
+		t.Fatal("memory limit breach not flagged")
+	}
+}
+
+func TestQueryPoolQuery(t *testing.T) {
+	newArgs := func() *query.Args {
+		return query.NewArgs("sip,dip", "eth1",
+			query.WithFirst("1456358400"), query.WithLast("1456473000"), query.WithFormat(types.FormatJSON),
+		).AddOutputs(io.Discard)
+	}
+
+	// without a pool, no resource usage is reported
+	expected, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs())
+	require.Nil(t, err)
+	require.Nil(t, expected.Summary.ResourceUsage)
+
+	// the resource usage of queries run in a pool is reported (without affecting the result)
+	pool := NewQueryPool(2, 1, 0)
+
+	var progress func() results.ResourceUsage
+	ctx := query.WithResourceUsageFn(context.Background(), func(usage func() results.ResourceUsage) {
+		progress = usage
+	})
+	res, err := NewQueryRunner(TestDB, WithQueryPool(pool)).Run(ctx, newArgs())
+	require.Nil(t, err)
+	require.Len(t, res.Summary.ResourceUsage, 1)
+	require.NotNil(t, progress)
+
+	usage := res.Summary.ResourceUsage[0]
+	require.NotEmpty(t, usage.Hostname)
+	require.Equal(t, 1, usage.ProcessingUnits)
+	require.Zero(t, usage.Goroutines)
+	require.Positive(t, usage.PeakGoroutines)
+	require.Positive(t, usage.PeakMemBytes)
+	require.Equal(t, usage, progress())
+	require.Equal(t, expected.Rows, res.Rows)
+	require.Equal(t, 2, pool.Free())
+
+	// queries exceeding the memory limit are aborted
+	_, err = NewQueryRunner(TestDB, WithQueryPool(NewQueryPool(2, 1, 1))).Run(context.Background(), newArgs())
+	require.ErrorIs(t, err, errorQueryMemoryBreach)
+}
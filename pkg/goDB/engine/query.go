@@ -1,14 +1,17 @@
 package engine
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"runtime"
 	"runtime/debug"
 	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,12 +19,15 @@ import (
 	"github.com/els0r/goProbe/pkg/goDB"
 	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
 	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
 	"github.com/els0r/goProbe/pkg/query"
 	"github.com/els0r/goProbe/pkg/query/heap"
 	"github.com/els0r/goProbe/pkg/results"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/els0r/goProbe/pkg/types/workload"
+	"github.com/els0r/goProbe/pkg/version"
 	"github.com/els0r/telemetry/tracing"
 	jsoniter "github.com/json-iterator/go"
 	"go.opentelemetry.io/otel/attribute"
@@ -31,9 +37,11 @@ import (
 // QueryRunner implements the Runner interface to execute queries
 // against the goDB flow database
 type QueryRunner struct {
-	query          *goDB.Query
 	captureManager *capture.Manager
 	dbPath         string
+	metadataCache  *goDB.MetadataCache
+	policies       ResourcePolicies
+	pool           *QueryPool
 
 	keepAlive      time.Duration
 	stats          *workload.Stats
@@ -51,6 +59,30 @@ func WithLiveData(captureManager *capture.Manager) RunnerOption {
 	}
 }
 
+// WithMetadataCache uses the provided cache for directory listings and GPDir metadata, speeding up
+// the planning phase of repeated queries (nil disables caching)
+func WithMetadataCache(cache *goDB.MetadataCache) RunnerOption {
+	return func(qr *QueryRunner) {
+		qr.metadataCache = cache
+	}
+}
+
+// WithResourcePolicies restricts the resources available to queries according to the policy in effect
+// when a query is run (if any). The applied limits are reported in the result summary
+func WithResourcePolicies(policies ...ResourcePolicy) RunnerOption {
+	return func(qr *QueryRunner) {
+		qr.policies = policies
+	}
+}
+
+// WithQueryPool runs all queries within the bounds of the provided pool, accounting the resources spent on
+// each of them. The resource usage is reported in the result summary
+func WithQueryPool(pool *QueryPool) RunnerOption {
+	return func(qr *QueryRunner) {
+		qr.pool = pool
+	}
+}
+
 // WithKeepAlive toggles keep-alive messages emitted by the runner. It's meant to signal to a
 // calling process that a query is still being processed
 func WithKeepAlive(interval time.Duration) RunnerOption {
@@ -115,7 +147,45 @@ func (qr *QueryRunner) Run(ctx context.Context, args *query.Args) (res *results.
 	ctx, span := tracing.Start(ctx, "(*engine.QueryRunner).Run", trace.WithAttributes(attribute.String("args", argsStr)))
 	defer span.End()
 
-	stmt, err := args.Prepare()
+	stmt, err := qr.prepare(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return qr.RunStatement(ctx, stmt)
+}
+
+// RunBatch implements the query.BatchRunner interface. All queries must cover the same time range and
+// interfaces, allowing them to be evaluated in a single pass over the DB
+func (qr *QueryRunner) RunBatch(ctx context.Context, args []*query.Args) ([]*results.Result, error) {
+	ctx, span := tracing.Start(ctx, "(*engine.QueryRunner).RunBatch", trace.WithAttributes(attribute.Int("queries", len(args))))
+	defer span.End()
+
+	if len(args) == 0 {
+		return nil, errors.New("no queries provided")
+	}
+
+	stmts := make([]*query.Statement, len(args))
+	for i, queryArgs := range args {
+		stmt, err := qr.prepare(queryArgs)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+
+		// relative times are resolved during preparation (and may hence differ by the time elapsed in
+		// between), so identical time ranges are aligned explicitly
+		if i > 0 && queryArgs.First == args[0].First && queryArgs.Last == args[0].Last {
+			stmt.First, stmt.Last = stmts[0].First, stmts[0].Last
+		}
+		stmts[i] = stmt
+	}
+
+	return qr.RunStatements(ctx, stmts...)
+}
+
+// prepare prepares the statement for the query args, resolving the interfaces to be queried
+func (qr *QueryRunner) prepare(args *query.Args) (stmt *query.Statement, err error) {
+	stmt, err = args.Prepare()
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare query statement: %w", err)
 	}
@@ -133,47 +203,112 @@ func (qr *QueryRunner) Run(ctx context.Context, args *query.Args) (res *results.
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare query statement: %w", err)
 	}
+	return stmt, nil
+}
 
-	return qr.RunStatement(ctx, stmt)
+// execution tracks the state of a single statement during (potentially batched) query execution
+type execution struct {
+	stmt          *query.Statement
+	query         *goDB.Query
+	valFilterNode *node.ValFilterNode
+	result        *results.Result
+
+	profile *results.Profile
+	drops   *results.Drops
+
+	mapChan       chan hashmap.AggFlowMapWithMetadata
+	aggregateChan chan aggregateResult
+
+	// baseline holds the keys observed during the baseline time range (if new talkers were
+	// requested), whereas collect receives the keys of the execution instead of result rows
+	baseline *keySet
+	collect  *keySet
 }
 
 // RunStatement executes the prepared statement and generates the results
 func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement) (res *results.Result, err error) {
-	result := results.New()
-	result.Start()
-	defer result.End()
+	rs, err := qr.RunStatements(ctx, stmt)
+	if err != nil {
+		return res, err
+	}
+	return rs[0], nil
+}
 
-	// cross-check parameters
-	if len(stmt.Ifaces) == 0 {
-		return res, errors.New("no interfaces provided")
+// RunStatements executes the prepared statements in a single pass over the DB and generates their
+// results (in the order of the statements). Each block is read and decompressed only once, while
+// the flows are aggregated independently for each statement. Hence, all statements must cover the
+// same time range and interfaces. The resource limits (memory and deadline) of the first statement
+// apply to the whole batch
+func (qr *QueryRunner) RunStatements(ctx context.Context, stmts ...*query.Statement) (rs []*results.Result, err error) {
+	if len(stmts) == 0 {
+		return nil, errors.New("no query statements provided")
 	}
 
-	sort.Slice(stmt.Ifaces, func(i, j int) bool {
-		return stmt.Ifaces[i] < stmt.Ifaces[j]
-	})
-	result.Summary.Interfaces = stmt.Ifaces
+	// reject a goDB containing data in a format unknown to this release upfront (instead of failing
+	// on the first affected directory)
+	if err := info.CheckFormatVersion(qr.dbPath); err != nil {
+		return nil, err
+	}
 
-	// parse query
-	queryAttributes, _, err := types.ParseQueryType(stmt.QueryType)
+	// the interface zones, flow tags and process labels are shared by all statements
+	zones, err := info.ReadZones(qr.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read interface zones: %w", err)
+	}
+	tags, err := info.ReadTagRegistry(qr.dbPath)
 	if err != nil {
-		return res, fmt.Errorf("failed to parse query type: %w", err)
+		return nil, fmt.Errorf("failed to read flow tags: %w", err)
 	}
 
-	// build condition tree to check if there is a syntax error before starting processing
-	queryConditional, valFilterNode, parseErr := node.ParseAndInstrument(stmt.Condition, stmt.DNSResolution.Timeout)
-	if parseErr != nil {
-		return res, fmt.Errorf("conditions parsing error: %w", parseErr)
+	// the labels of the processes flows were attributed to are only required if they are part of a query
+	var processLabels map[uint32]string
+	if slices.ContainsFunc(stmts, func(stmt *query.Statement) bool { return stmt.LabelSelector.Process }) {
+		processes, err := info.ReadProcessRegistry(qr.dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read process labels: %w", err)
+		}
+		processLabels = processes.Labels()
 	}
 
-	qr.query = goDB.NewQuery(queryAttributes, queryConditional, stmt.LabelSelector).LowMem(stmt.LowMem)
-	if qr.query == nil {
-		return res, errors.New("query is not executable")
+	execs := make([]*execution, len(stmts))
+	for i, stmt := range stmts {
+		e, err := qr.prepareExecution(stmt, zones, tags)
+		if err != nil {
+			return nil, err
+		}
+		defer e.result.End()
+
+		if i > 0 && (stmt.First != stmts[0].First || stmt.Last != stmts[0].Last || !slices.Equal(stmt.Ifaces, stmts[0].Ifaces)) {
+			return nil, errorBatchMismatch
+		}
+		execs[i] = e
 	}
 
-	result.Query = results.Query{
-		Attributes: qr.query.AttributesToString(),
+	// new talkers are determined against the keys observed during the baseline time range, which
+	// requires a preceding pass over the DB for each statement requesting them
+	for _, e := range execs {
+		if !e.stmt.HasBaseline() {
+			continue
+		}
+		e.baseline, err = qr.collectBaseline(ctx, e.stmt, zones, tags)
+		if err != nil {
+			return nil, err
+		}
+		e.result.Summary.Baseline = &results.Baseline{
+			First: time.Unix(e.stmt.BaselineFirst, 0),
+			Last:  time.Unix(e.stmt.BaselineLast, 0),
+			Keys:  e.baseline.Len(),
+		}
 	}
-	result.Query.Condition = node.QueryConditionalString(qr.query.Conditional, valFilterNode)
+
+	return qr.execute(ctx, execs, zones, tags, processLabels)
+}
+
+// execute runs the executions in a single pass over the DB and generates their results
+func (qr *QueryRunner) execute(ctx context.Context, execs []*execution, zones info.Zones, tags info.TagRegistry, processLabels map[uint32]string) (rs []*results.Result, err error) {
+
+	// the time range, interfaces and resource limits are taken from the first statement
+	stmt := execs[0].stmt
 
 	// get hostname and host ID if available
 	hostname, err := os.Hostname()
@@ -181,44 +316,102 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 		return nil, fmt.Errorf("failed to get system hostname: %w", err)
 	}
 	hostID := info.GetHostID(qr.dbPath)
-	result.Hostname = hostname
+
+	// data is attributed to this host unless the directories read were captured on another one
+	origins := dataOrigins{local: gpfile.Origin{Hostname: hostname, HostID: hostID}}
 
 	// assign the hostname to the list of hosts handled in this query. Here, the only one
 	defer func() {
-		result.HostsStatuses[hostname] = result.Status
+		// the last writeout allows callers (e.g. caching the result) to detect when the data has changed
+		var lastWriteout time.Time
+		if qr.captureManager != nil {
+			_, lastWriteout = qr.captureManager.GetTimestamps()
+		}
+		for _, e := range execs {
+			if e == nil {
+				continue
+			}
+			if !lastWriteout.IsZero() {
+				e.result.Status.LastWriteout = &lastWriteout
+			}
+			e.result.HostsStatuses[origins.result(e.stmt.Live).Hostname] = e.result.Status
+		}
 	}()
 
+	// restrict the resources of the query according to the policy in effect (if any)
+	processingUnits, maxMemPct := numProcessingUnits, stmt.MaxMemPct
+	if policy := qr.policies.Active(time.Now()); policy != nil {
+		processingUnits, maxMemPct = policy.limits(processingUnits, maxMemPct)
+		for _, e := range execs {
+			e.result.Summary.ResourcePolicies = []results.ResourcePolicy{{
+				Hostname:        hostname,
+				Name:            policy.Name,
+				ProcessingUnits: processingUnits,
+				MaxMemPct:       maxMemPct,
+			}}
+		}
+	}
+
+	// run the query within the bounds of the query pool (if any), which may require waiting for processing
+	// units to be released by other queries
+	usage := newQueryUsage(hostname, 0)
+	if qr.pool != nil {
+		usage.maxMem = int64(qr.pool.maxQueryMem)
+
+		tAcquireStart := time.Now()
+		if processingUnits, err = qr.pool.acquire(ctx, processingUnits); err != nil {
+			return nil, fmt.Errorf("failed to acquire processing units: %w", err)
+		}
+		defer qr.pool.release(processingUnits)
+		usage.processingUnits, usage.queueWait = processingUnits, time.Since(tAcquireStart)
+
+		if f := query.ResourceUsageFn(ctx); f != nil {
+			f(usage.snapshot)
+		}
+	}
+
 	// start ticker to check memory consumption every second
 	heapWatchCtx, cancelHeapWatch := context.WithCancel(ctx)
 	defer cancelHeapWatch()
 
-	memErrors := heap.Watch(heapWatchCtx, stmt.MaxMemPct)
+	memErrors := heap.Watch(heapWatchCtx, maxMemPct)
 
 	queryCtx, cancelQuery := context.WithCancel(ctx)
 	defer cancelQuery()
 
-	// Channel for handling of returned maps
-	mapChan := make(chan hashmap.AggFlowMapWithMetadata, 1024)
-	aggregateChan := qr.aggregate(ctx, mapChan, stmt.Ifaces, stmt.LowMem)
+	// The query deadline (if any) only applies to reading from the DB, so that whatever was
+	// processed until the deadline can still be aggregated and returned
+	workerCtx := queryCtx
+	if stmt.Deadline > 0 {
+		var cancelWorkers context.CancelFunc
+		workerCtx, cancelWorkers = context.WithTimeout(queryCtx, stmt.Deadline)
+		defer cancelWorkers()
+	}
+
+	// Channels for handling of returned maps (one per statement). They are bounded so that workers
+	// cannot produce (potentially large) maps faster than they are merged, in which case they are throttled
+	var (
+		queries  = make([]*goDB.Query, len(execs))
+		mapChans = make([]chan hashmap.AggFlowMapWithMetadata, len(execs))
+	)
+	for i, e := range execs {
+		e.mapChan = make(chan hashmap.AggFlowMapWithMetadata, 2*processingUnits)
+		e.aggregateChan = qr.aggregate(queryCtx, e.query, e.mapChan, stmt.Ifaces, e.stmt.LowMem, usage)
+		queries[i], mapChans[i] = e.query, e.mapChan
+	}
 
 	go func() {
 		select {
 		case err = <-memErrors:
 			err = fmt.Errorf("%w: %w", errorMemoryBreach, err)
-			cancelQuery()
-
-			// close the map channel. This will make sure that the aggregation routine
-			// actually finishes
-			close(mapChan)
-
-			// empty the aggregateChan
-			agg := <-aggregateChan
-
-			// call the garbage collector
-			agg.aggregatedMaps.ClearFast()
-			runtime.GC()
-			debug.FreeOSMemory()
 
+			// cancelling the query stops the workers and makes the aggregation routines discard
+			// all remaining maps. The map channels are closed once all workers are done
+			cancelQuery()
+			return
+		case <-usage.breached:
+			err = errorQueryMemoryBreach
+			cancelQuery()
 			return
 		case <-queryCtx.Done():
 			return
@@ -227,18 +420,73 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 
 	var opts = []goDB.WorkManagerOption{}
 
+	// per-stage timings are only tracked if requested
+	for _, e := range execs {
+		if e.stmt.Profile {
+			e.profile = new(results.Profile)
+		}
+	}
+	if slices.ContainsFunc(execs, func(e *execution) bool { return e.profile != nil }) {
+		opts = append(opts, goDB.WithProfiling())
+	}
+
+	// the same holds for dropped packets
+	for _, e := range execs {
+		if e.stmt.Drops {
+			e.drops = new(results.Drops)
+		}
+	}
+	if slices.ContainsFunc(execs, func(e *execution) bool { return e.drops != nil }) {
+		opts = append(opts, goDB.WithDropTracking())
+	}
+	// the same holds for the provenance of the data
+	if slices.ContainsFunc(execs, func(e *execution) bool { return e.stmt.Provenance }) {
+		opts = append(opts, goDB.WithProvenanceTracking())
+	}
+	if qr.metadataCache != nil {
+		opts = append(opts, goDB.WithMetadataCache(qr.metadataCache))
+	}
+
 	// create work managers
 	workManagers := map[string]*goDB.DBWorkManager{} // map interfaces to workManagers
+	tDirWalkStart := time.Now()
 	for _, iface := range stmt.Ifaces {
-		wm, nonempty, err := createWorkManager(qr.dbPath, iface, stmt.First, stmt.Last, qr.query, numProcessingUnits, opts...)
+		wm, nonempty, err := createWorkManager(qr.dbPath, iface, stmt.First, stmt.Last, queries, processingUnits, opts...)
 		if err != nil {
-			return res, err
+			return nil, err
 		}
 		// Only add work managers that have work to do.
 		if nonempty {
 			workManagers[iface] = wm
 		}
 	}
+	origins.ifaces = make(map[string]gpfile.Origin, len(workManagers))
+	for iface, workManager := range workManagers {
+		origins.ifaces[iface] = origins.local
+		if origin := workManager.Origin(); origin != nil {
+			origins.ifaces[iface] = *origin
+		}
+	}
+
+	// the byte accounting bases are the union of the bases of all directories covered
+	var accounting []string
+	for _, workManager := range workManagers {
+		for _, basis := range workManager.ByteAccounting() {
+			if !slices.Contains(accounting, basis) {
+				accounting = append(accounting, basis)
+			}
+		}
+	}
+	slices.Sort(accounting)
+	for _, e := range execs {
+		e.result.Summary.ByteAccounting = accounting
+	}
+
+	for _, e := range execs {
+		if e.profile != nil {
+			e.profile.DirWalk = time.Since(tDirWalkStart)
+		}
+	}
 
 	// the covered time period is the union of all covered times
 	tSpanFirst, tSpanLast := time.Now().AddDate(100, 0, 0), time.Time{} // a hundred years in the future, the beginning of time
@@ -252,31 +500,80 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 		}
 	}
 
-	// Check if there actually was data available from disk (or a live query was performed)
-	if len(workManagers) > 0 || stmt.Live {
-		result.Summary.DataAvailable = true
-	}
+	for _, e := range execs {
+		// Check if there actually was data available from disk (or a live query was performed)
+		if len(workManagers) > 0 || e.stmt.Live {
+			e.result.Summary.DataAvailable = true
+		}
 
-	result.Summary.First = tSpanFirst
-	result.Summary.Last = tSpanLast
+		e.result.Summary.First = tSpanFirst
+		e.result.Summary.Last = tSpanLast
+	}
 
-	// If enabled, run a live query in the background / parallel to the DB query and put the results on the same output channel
-	liveQueryWG := qr.runLiveQuery(queryCtx, mapChan, stmt)
+	// If enabled, run live queries in the background / parallel to the DB query and put the results on the same output channels
+	liveQueryWG := new(sync.WaitGroup)
+	for _, e := range execs {
+		qr.runLiveQuery(queryCtx, liveQueryWG, e, usage)
+	}
 
 	// spawn reader processing units and make them work on the individual DB blocks
 	// processing by interface is sequential, e.g. for multi-interface queries
-	for _, workManager := range workManagers {
-		workManager.ExecuteWorkerReadJobs(queryCtx, mapChan)
+	for iface, workManager := range workManagers {
+		usage.goroutinesStarted(processingUnits)
+		workManager.ExecuteWorkerReadJobs(workerCtx, mapChans...)
+		usage.goroutinesDone(processingUnits)
+		workerStallSeconds.WithLabelValues(iface).Add(workManager.StallTime().Seconds())
+		workerThrottledTotal.WithLabelValues(iface).Add(float64(workManager.Throttled()))
+		dirsPrunedTotal.WithLabelValues(iface).Add(float64(workManager.Pruned()))
+		for _, e := range execs {
+			if workManager.Truncated() {
+				e.result.Summary.TruncatedByDeadline = true
+			}
+			if e.profile != nil {
+				e.profile.Add(workManager.Profile())
+			}
+		}
+	}
+
+	// drops are tracked per block, which directly maps to the time bins of the result rows
+	for _, e := range execs {
+		if e.drops == nil {
+			continue
+		}
+		for iface, workManager := range workManagers {
+			for ts, numDrops := range workManager.Drops() {
+				e.drops.Packets += numDrops
+				if e.stmt.LabelSelector.Timestamp {
+					e.drops.Ranges = append(e.drops.Ranges, results.DropsRange{
+						Timestamp: time.Unix(ts, 0),
+						Hostname:  origins.iface(iface).Hostname,
+						Iface:     iface,
+						Packets:   numDrops,
+					})
+				}
+			}
+		}
+	}
+
+	for _, e := range execs {
+		if e.stmt.Provenance {
+			e.result.Summary.Provenance = qr.provenance(e, workManagers, origins)
+		}
 	}
 
-	// In case a live query is being performed in the background, ensure it is done
+	// In case live queries are being performed in the background, ensure they are done
 	liveQueryWG.Wait()
 
-	// We are done with all worker jobs, close the ouput / result channel
-	close(mapChan)
+	// We are done with all worker jobs, close the ouput / result channels
+	for _, mapChan := range mapChans {
+		close(mapChan)
+	}
 
-	// wait for the job to complete, then call a garbage collection
-	agg := <-aggregateChan
+	// wait for the jobs to complete, then call a garbage collection
+	aggs := make([]aggregateResult, len(execs))
+	for i, e := range execs {
+		aggs[i] = <-e.aggregateChan
+	}
 	for _, workManager := range workManagers {
 		workManager.Close()
 		workManager = nil
@@ -285,17 +582,148 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 
 	// first inspect if err is set due to problems not related to aggregation
 	if err != nil {
-		return res, err
+		if errors.Is(err, errorMemoryBreach) || errors.Is(err, errorQueryMemoryBreach) {
+			for _, agg := range aggs {
+				agg.aggregatedMaps.ClearFast()
+			}
+			runtime.GC()
+			debug.FreeOSMemory()
+		}
+		return nil, err
+	}
+
+	// check aggregations for errors
+	for _, agg := range aggs {
+		if agg.err != nil {
+			return nil, agg.err
+		}
+	}
+
+	rs = make([]*results.Result, len(execs))
+	for i, e := range execs {
+		qr.prepareResult(e, aggs[i], zones, tags, processLabels, origins)
+		rs[i] = e.result
+	}
+
+	// the resources spent on the query are only accounted for if it was run in a query pool
+	if qr.pool != nil {
+		resources := usage.snapshot()
+		for _, e := range execs {
+			e.result.Summary.ResourceUsage = []results.ResourceUsage{resources}
+		}
+		logs.FromContext(ctx, logs.ModuleQuery).With("resources", resources).Info("query resource usage")
+	}
+	return rs, nil
+}
+
+// prepareExecution parses the statement into the query to be executed
+func (qr *QueryRunner) prepareExecution(stmt *query.Statement, zones info.Zones, tags info.TagRegistry) (*execution, error) {
+	result := results.New()
+	result.Start()
+
+	// cross-check parameters
+	if len(stmt.Ifaces) == 0 {
+		return nil, errors.New("no interfaces provided")
+	}
+
+	// restrict the interfaces to those tagged with any of the requested network zones (if any)
+	if len(stmt.Zones) > 0 {
+		stmt.Ifaces = zones.Filter(stmt.Ifaces, stmt.Zones...)
+		if len(stmt.Ifaces) == 0 {
+			return nil, fmt.Errorf("no interfaces tagged with zone(s) %s", strings.Join(stmt.Zones, ","))
+		}
+	}
+
+	// resolve the requested flow tags (if any) into the bitmap of their bits
+	tagMask := tags.Mask(stmt.Tags...)
+	if len(stmt.Tags) > 0 && tagMask == 0 {
+		return nil, fmt.Errorf("no flow tag(s) %s defined", strings.Join(stmt.Tags, ","))
 	}
 
-	// check aggregation for errors
-	if agg.err != nil {
-		return res, agg.err
+	sort.Slice(stmt.Ifaces, func(i, j int) bool {
+		return stmt.Ifaces[i] < stmt.Ifaces[j]
+	})
+	result.Summary.Interfaces = stmt.Ifaces
+
+	// parse query
+	queryAttributes, _, err := types.ParseQueryType(stmt.QueryType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query type: %w", err)
+	}
+
+	// build condition tree to check if there is a syntax error before starting processing
+	var warnings []string
+	queryConditional, valFilterNode, parseErr := node.ParseAndInstrument(stmt.Condition, stmt.DNSResolution.Timeout,
+		node.WithStrictHostnames(stmt.StrictHostnames),
+		node.WithWarnings(func(msg string) {
+			warnings = append(warnings, msg)
+		}),
+	)
+	if parseErr != nil {
+		return nil, fmt.Errorf("conditions parsing error: %w", parseErr)
+	}
+
+	// the recurring time windows (if any) are evaluated in the requested time zone
+	loc, err := stmt.TimeWindowsLocation()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone of time windows: %w", err)
+	}
+
+	q := goDB.NewQuery(queryAttributes, queryConditional, stmt.LabelSelector).LowMem(stmt.LowMem).ClassifyPorts(stmt.PortClasses).FilterTags(tagMask).
+		FilterTimeWindows(stmt.TimeWindows, loc)
+	if q == nil {
+		return nil, errors.New("query is not executable")
+	}
+
+	result.Query = results.Query{
+		Attributes: q.AttributesToString(),
+		Warnings:   warnings,
+	}
+	result.Query.Condition = node.QueryConditionalString(q.Conditional, valFilterNode)
+	if len(stmt.TimeWindows) > 0 {
+		result.Query.TimeWindows = fmt.Sprintf("%s (%s)", stmt.TimeWindows, loc)
+	}
+
+	return &execution{
+		stmt:          stmt,
+		query:         q,
+		valFilterNode: valFilterNode,
+		result:        result,
+	}, nil
+}
+
+// prepareResult populates the result of a statement from its aggregated flows
+func (qr *QueryRunner) prepareResult(e *execution, agg aggregateResult, zones info.Zones, tags info.TagRegistry, processLabels map[uint32]string, origins dataOrigins) {
+	var (
+		stmt    = e.stmt
+		result  = e.result
+		profile = e.profile
+		drops   = e.drops
+	)
+	result.Hostname = origins.result(stmt.Live).Hostname
+
+	// the flows of a baseline pass are only tracked as keys
+	if e.collect != nil {
+		for iface, aggMap := range agg.aggregatedMaps {
+			for i := aggMap.Iter(); i.Next(); {
+				e.collect.add(iface, types.ExtendedKey(i.Key()))
+			}
+			aggMap.ClearFast()
+		}
+		return
 	}
 
 	/// RESULTS PREPARATION ///
-	var sip, dip, dport, proto types.Attribute
-	for _, attribute := range qr.query.Attributes {
+	tPreparationStart := time.Now()
+	var (
+		sip, dip, dport, dportClass, proto types.Attribute
+		custom                             []types.CustomAttribute
+	)
+	for _, attribute := range e.query.Attributes {
+		if c, isCustom := attribute.(types.CustomAttribute); isCustom {
+			custom = append(custom, c)
+			continue
+		}
 		switch attribute.Name() {
 		case types.SIPName:
 			sip = attribute
@@ -303,17 +731,24 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 			dip = attribute
 		case types.DportName:
 			dport = attribute
+		case types.DportClassName:
+			dportClass = attribute
 		case types.ProtoName:
 			proto = attribute
 		}
 	}
 
+	portClasses := e.query.PortClasses()
+
+	// the number of distinct combinations of tags is small, hence their labels are only computed once
+	tagLabels := make(map[uint64]string)
+
 	var rs = make(results.Rows, agg.aggregatedMaps.Len())
 	count := 0
 
 	var metaIterOption hashmap.MetaIterOption
-	if valFilterNode != nil && valFilterNode.ValFilter != nil {
-		metaIterOption = hashmap.WithFilter(valFilterNode.ValFilter)
+	if e.valFilterNode != nil && e.valFilterNode.ValFilter != nil {
+		metaIterOption = hashmap.WithFilter(e.valFilterNode.ValFilter)
 	}
 	var totals hashmap.Val
 	for iface, aggMap := range agg.aggregatedMaps {
@@ -324,17 +759,51 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 		for i.Next() {
 
 			key := types.ExtendedKey(i.Key())
+
+			// only keys absent during the baseline (if any) are considered
+			if e.baseline != nil && e.baseline.contains(iface, key) {
+				continue
+			}
+
 			val := i.Val()
 			totals.Add(val)
 			if ts, hasTS := key.AttrTime(); hasTS {
 				rs[count].Labels.Timestamp = time.Unix(ts, 0)
 			}
 			rs[count].Labels.Iface = iface
+			rs[count].Labels.Zone = zones.Zone(iface)
+			if bitmap, hasTags := key.AttrTags(); hasTags {
+				label, exists := tagLabels[bitmap]
+				if !exists {
+					label = tags.Label(bitmap)
+					tagLabels[bitmap] = label
+				}
+				rs[count].Labels.Tag = label
+			}
+			if id, hasProcess := key.AttrProcess(); hasProcess {
+				rs[count].Labels.Process = processLabels[id]
+			}
+			if vlan, hasVLAN := key.AttrVLAN(); hasVLAN {
+				rs[count].Labels.VLAN = vlan
+			}
+			if smac, hasSMAC := key.AttrSMAC(); hasSMAC {
+				rs[count].Labels.SMAC = smac.String()
+			}
+			if dmac, hasDMAC := key.AttrDMAC(); hasDMAC {
+				rs[count].Labels.DMAC = dmac.String()
+			}
+			if flags, hasTCPFlags := key.AttrTCPFlags(); hasTCPFlags {
+				rs[count].Labels.TCPFlags = flags.String()
+			}
+			if dscp, hasDSCP := key.AttrDSCP(); hasDSCP && dscp != 0 {
+				rs[count].Labels.DSCP = dscp.String()
+			}
 
-			// the host ID and hostname are statically assigned since a goDB is inherently limited to the
-			// system it runs on. The two parameters never change during query execution
-			rs[count].Labels.HostID = hostID
-			rs[count].Labels.Hostname = hostname
+			// the host ID and hostname denote the host the data of the interface was captured on (which
+			// differs from this host if the DB was copied off another one)
+			origin := origins.iface(iface)
+			rs[count].Labels.HostID = origin.HostID
+			rs[count].Labels.Hostname = origin.Hostname
 
 			if sip != nil {
 				rs[count].Attributes.SrcIP = types.RawIPToAddr(key.Key().GetSIP())
@@ -348,6 +817,16 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 			if dport != nil {
 				rs[count].Attributes.DstPort = types.PortToUint16(key.Key().GetDport())
 			}
+			if dportClass != nil {
+				rs[count].Attributes.DstPortClass = portClasses.Label(types.PortToUint16(key.Key().GetDport()))
+			}
+			if len(custom) > 0 {
+				values := make(map[string]string, len(custom))
+				for _, c := range custom {
+					values[c.Name()] = c.Derive(key.Key())
+				}
+				rs[count].Attributes.Custom = results.NewCustomAttributes(values)
+			}
 
 			// assign / update counters
 			rs[count].Counters.Add(val)
@@ -356,10 +835,10 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 
 		// add statistics to final result and trigger keepalive (if required)
 		result.Summary.Stats.Add(aggMap.Stats)
-		qr.query.UpdateKeepalive()
+		e.query.UpdateKeepalive()
 
 		// Now is a good time to release memory one last time for the final processing step
-		if qr.query.IsLowMem() {
+		if e.query.IsLowMem() {
 			aggMap.Clear()
 		} else {
 			aggMap.ClearFast()
@@ -370,11 +849,37 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 	// Ensure that potentially unused pre-allocated rows are dropped
 	rs = rs[:count]
 
+	// Custom attributes are derived from the columns they depend on (which were aggregated
+	// over), hence rows sharing the same derived values have to be merged
+	if len(custom) > 0 {
+		merged := make(results.RowsMap, len(rs))
+		merged.MergeRows(rs)
+		rs = merged.ToRows()
+		count = len(rs)
+	}
+
 	result.Summary.Totals = totals
+	if drops != nil {
+		drops.Estimate(totals)
+		result.Summary.Drops = drops
+	}
+
+	// the traffic matrix covers all rows, not only the ones displayed
+	if len(stmt.MatrixSrcGroups) > 0 {
+		result.Summary.Matrix = results.NewMatrix(stmt.MatrixSrcGroups, stmt.MatrixDstGroups, rs)
+	}
 
 	// sort the results
+	tSortStart := time.Now()
 	results.By(stmt.SortBy, stmt.Direction, stmt.SortAscending).Sort(rs)
 
+	if profile != nil {
+		profile.Merge = agg.mergeDuration
+		profile.Sort = time.Since(tSortStart)
+		profile.ResultPreparation = tSortStart.Sub(tPreparationStart)
+		result.Summary.Profile = profile
+	}
+
 	// stop timing everything related to the query and store the hits
 	result.Summary.Hits.Total = count
 
@@ -389,27 +894,135 @@ func (qr *QueryRunner) RunStatement(ctx context.Context, stmt *query.Statement)
 	}
 	result.Summary.Hits.Displayed = len(rs)
 	result.Rows = rs
-	return result, nil
 }
 
-func (qr *QueryRunner) runLiveQuery(ctx context.Context, mapChan chan hashmap.AggFlowMapWithMetadata, stmt *query.Statement) (wg *sync.WaitGroup) {
-	wg = new(sync.WaitGroup)
+// dataOrigins denotes the hosts the data of the interfaces queried was captured on
+type dataOrigins struct {
+	local  gpfile.Origin            // this host
+	ifaces map[string]gpfile.Origin // interfaces read from the DB
+}
 
-	if !stmt.Live {
+// iface returns the origin of the data of an interface. It is this host if the origin is unknown (e.g.
+// because its directories were written by an older release)
+func (o dataOrigins) iface(iface string) gpfile.Origin {
+	if origin, exists := o.ifaces[iface]; exists {
+		return origin
+	}
+	return o.local
+}
+
+// result returns the origin of the data of a result, which is this host unless the data of all
+// interfaces was captured on a single other host (live flows always originate from this host)
+func (o dataOrigins) result(live bool) gpfile.Origin {
+	if live || len(o.ifaces) == 0 {
+		return o.local
+	}
+	var origin *gpfile.Origin
+	for _, ifaceOrigin := range o.ifaces {
+		if origin != nil && ifaceOrigin != *origin {
+			return o.local
+		}
+		origin = &ifaceOrigin
+	}
+	return *origin
+}
+
+// provenance documents the data the statement was run on, based on the blocks read by the work
+// managers (which are shared by all statements of a batch). The blocks are documented per host they
+// were captured on
+func (qr *QueryRunner) provenance(e *execution, workManagers map[string]*goDB.DBWorkManager, origins dataOrigins) *results.Provenance {
+	type sourceBlocks struct {
+		source       results.Source
+		first, last  int64
+		encoderTypes map[string]struct{}
+	}
+	sources := make(map[gpfile.Origin]*sourceBlocks)
+	sourceOf := func(origin gpfile.Origin) *sourceBlocks {
+		if s, exists := sources[origin]; exists {
+			return s
+		}
+		s := &sourceBlocks{
+			source: results.Source{
+				Hostname: origin.Hostname,
+				HostID:   origin.HostID,
+				Version:  version.Short(),
+				DBPath:   qr.dbPath,
+				Sampling: results.SamplingNone,
+			},
+			encoderTypes: make(map[string]struct{}),
+		}
+		if e.result.Summary.TruncatedByDeadline {
+			s.source.Sampling = results.SamplingPartial
+		}
+		sources[origin] = s
+		return s
+	}
+
+	for iface, workManager := range workManagers {
+		blocks := workManager.Provenance()
+		if blocks == nil {
+			continue
+		}
+		s := sourceOf(origins.iface(iface))
+		if blocks.First != 0 && (s.first == 0 || blocks.First < s.first) {
+			s.first = blocks.First
+		}
+		s.last = max(s.last, blocks.Last)
+		for encoderType := range blocks.Encoders {
+			s.encoderTypes[encoderType.String()] = struct{}{}
+		}
+		for _, ts := range blocks.CorruptBlocks {
+			s.source.CorruptBlocks = append(s.source.CorruptBlocks, results.CorruptBlock{
+				Iface:     iface,
+				Timestamp: time.Unix(ts, 0),
+			})
+		}
+	}
+
+	// live flows originate from this host, which is also documented if no block was read at all
+	if e.stmt.Live || len(sources) == 0 {
+		sourceOf(origins.local).source.Live = e.stmt.Live
+	}
+
+	provenance := &results.Provenance{Sources: make([]results.Source, 0, len(sources))}
+	for _, s := range sources {
+
+		// blocks are timestamped at the end of the interval they cover
+		if s.first != 0 {
+			s.source.Blocks = &results.TimeRange{
+				First: time.Unix(s.first-goDB.DBWriteInterval, 0),
+				Last:  time.Unix(s.last, 0),
+			}
+		}
+		s.source.Encoders = slices.Sorted(maps.Keys(s.encoderTypes))
+		slices.SortFunc(s.source.CorruptBlocks, func(a, b results.CorruptBlock) int {
+			return cmp.Or(strings.Compare(a.Iface, b.Iface), a.Timestamp.Compare(b.Timestamp))
+		})
+		provenance.Sources = append(provenance.Sources, s.source)
+	}
+	slices.SortFunc(provenance.Sources, func(a, b results.Source) int {
+		return cmp.Or(strings.Compare(a.Hostname, b.Hostname), strings.Compare(a.HostID, b.HostID))
+	})
+
+	return provenance
+}
+
+func (qr *QueryRunner) runLiveQuery(ctx context.Context, wg *sync.WaitGroup, e *execution, usage *queryUsage) {
+	if !e.stmt.Live {
 		return
 	}
 
 	wg.Add(1)
+	usage.goroutinesStarted(1)
 	go func() {
-		qr.captureManager.GetFlowMaps(ctx, goDB.QueryFilter(qr.query), mapChan, stmt.Ifaces...)
+		qr.captureManager.GetFlowMaps(ctx, goDB.QueryFilter(e.query), e.mapChan, e.stmt.Ifaces...)
+		usage.goroutinesDone(1)
 		wg.Done()
 	}()
-
-	return
 }
 
-func createWorkManager(dbPath string, iface string, tfirst, tlast int64, query *goDB.Query, numProcessingUnits int, opts ...goDB.WorkManagerOption) (workManager *goDB.DBWorkManager, nonempty bool, err error) {
-	workManager, err = goDB.NewDBWorkManager(query, dbPath, iface, numProcessingUnits, opts...)
+func createWorkManager(dbPath string, iface string, tfirst, tlast int64, queries []*goDB.Query, numProcessingUnits int, opts ...goDB.WorkManagerOption) (workManager *goDB.DBWorkManager, nonempty bool, err error) {
+	workManager, err = goDB.NewBatchDBWorkManager(queries, dbPath, iface, numProcessingUnits, opts...)
 	if err != nil {
 		return nil, false, fmt.Errorf("could not initialize query work manager for interface '%s': %w", iface, err)
 	}
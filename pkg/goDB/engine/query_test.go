@@ -2,11 +2,23 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
 	"github.com/els0r/goProbe/pkg/query"
+	"github.com/els0r/goProbe/pkg/results"
 	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/stretchr/testify/require"
 )
 
@@ -125,6 +137,404 @@ func TestSimpleQuery(t *testing.T) {
 	}
 }
 
+func TestQueryDeadline(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		deadline  time.Duration
+		truncated bool
+	}{
+		{"no deadline", 0, false},
+		{"deadline exceeded", time.Nanosecond, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a := query.NewArgs("sip", "eth1",
+				query.WithFirst("1456358400"), query.WithLast("1456473000"),
+				query.WithFormat(types.FormatJSON), query.WithDeadline(test.deadline),
+			).AddOutputs(io.Discard)
+
+			// exceeding the deadline must not fail the query
+			res, err := NewQueryRunner(TestDB).Run(context.Background(), a)
+			require.Nil(t, err)
+			require.Equal(t, test.truncated, res.Summary.TruncatedByDeadline)
+			if !test.truncated {
+				require.NotEmpty(t, res.Rows)
+			}
+		})
+	}
+}
+
+func TestQueryProfile(t *testing.T) {
+	newArgs := func(lowMem bool, opts ...query.Option) *query.Args {
+		a := query.NewArgs("sip,dip", "eth1", append([]query.Option{
+			query.WithFirst("1456358400"), query.WithLast("1456473000"),
+			query.WithFormat(types.FormatJSON), query.WithCondition("dport=443"),
+		}, opts...)...).AddOutputs(io.Discard)
+		a.LowMem = lowMem
+		return a
+	}
+
+	for _, lowMem := range []bool{false, true} {
+		t.Run(fmt.Sprintf("low_mem=%t", lowMem), func(t *testing.T) {
+
+			// profiling is disabled by default
+			res, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs(lowMem))
+			require.Nil(t, err)
+			require.Nil(t, res.Summary.Profile)
+
+			res, err = NewQueryRunner(TestDB).Run(context.Background(), newArgs(lowMem, query.WithProfile()))
+			require.Nil(t, err)
+			require.NotEmpty(t, res.Rows)
+
+			profile := res.Summary.Profile
+			require.NotNil(t, profile)
+			require.Positive(t, profile.DirWalk)
+			require.Positive(t, profile.BlockRead)
+			require.Positive(t, profile.Decompression)
+			require.Positive(t, profile.Aggregation)
+			require.Positive(t, profile.Merge)
+			require.Positive(t, profile.ResultPreparation)
+			require.Zero(t, profile.Serialization)
+			require.Zero(t, profile.DNSResolution)
+		})
+	}
+}
+
+func TestQueryDrops(t *testing.T) {
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth1", append([]query.Option{
+			query.WithFirst("1456358400"), query.WithLast("1456473000"),
+			query.WithFormat(types.FormatJSON),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// drops are not reported by default
+	res, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs("sip"))
+	require.Nil(t, err)
+	require.Nil(t, res.Summary.Drops)
+
+	// the query covers all blocks, hence all drops recorded for the interface must be reported
+	res, err = NewQueryRunner(TestDB).Run(context.Background(), newArgs("sip", query.WithDrops()))
+	require.Nil(t, err)
+
+	drops := res.Summary.Drops
+	require.NotNil(t, drops)
+	require.Equal(t, uint64(2442065), drops.Packets)
+	require.Empty(t, drops.Ranges)
+	require.Positive(t, drops.EstimatedMissingBytes)
+	require.Positive(t, drops.EstimatedMissingPct)
+
+	// querying the time attribute additionally provides the drops per time bin
+	res, err = NewQueryRunner(TestDB).Run(context.Background(), newArgs("time", query.WithDrops()))
+	require.Nil(t, err)
+	require.Equal(t, drops.Packets, res.Summary.Drops.Packets)
+	require.NotEmpty(t, res.Summary.Drops.Ranges)
+
+	var sum uint64
+	for i, r := range res.Summary.Drops.Ranges {
+		require.Equal(t, "eth1", r.Iface)
+		if i > 0 {
+			require.True(t, res.Summary.Drops.Ranges[i-1].Timestamp.Before(r.Timestamp))
+		}
+		sum += r.Packets
+	}
+	require.Equal(t, drops.Packets, sum)
+}
+
+func TestQueryZones(t *testing.T) {
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0,eth1,eth2", append([]query.Option{
+			query.WithFirst("1456358400"), query.WithLast("1456473000"),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	require.Nil(t, info.Zones{"eth0": "external", "eth2": "external", "eth1": "internal"}.Write(TestDB, 0644))
+	t.Cleanup(func() {
+		require.Nil(t, info.Zones{}.Write(TestDB, 0644))
+	})
+
+	// the zone of the interface is provided as label
+	res, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs("zone,proto"))
+	require.Nil(t, err)
+	require.NotEmpty(t, res.Rows)
+	for _, row := range res.Rows {
+		require.Equal(t, map[string]string{"eth0": "external", "eth1": "internal", "eth2": "external"}[row.Labels.Iface], row.Labels.Zone)
+	}
+
+	// restricting the query to a zone only queries the interfaces tagged with it
+	res, err = NewQueryRunner(TestDB).Run(context.Background(), newArgs("proto", query.WithZones("external")))
+	require.Nil(t, err)
+	require.Equal(t, results.Interfaces{"eth0", "eth2"}, res.Summary.Interfaces)
+	for _, row := range res.Rows {
+		require.Equal(t, "external", row.Labels.Zone)
+	}
+
+	_, err = NewQueryRunner(TestDB).Run(context.Background(), newArgs("proto", query.WithZones("dmz")))
+	require.ErrorContains(t, err, "no interfaces tagged with zone(s) dmz")
+}
+
+func TestQueryPortClasses(t *testing.T) {
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth1", append([]query.Option{
+			query.WithFirst("1456358400"), query.WithLast("1456473000"),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// the destination port classes must match the individual destination ports bucketed
+	// into their respective class
+	portRes, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs("dport,proto"))
+	require.Nil(t, err)
+	require.NotEmpty(t, portRes.Rows)
+
+	for _, test := range []struct {
+		name    string
+		opts    []query.Option
+		classes types.PortClasses
+	}{
+		{"default", nil, types.DefaultPortClasses},
+		{"user-defined", []query.Option{query.WithPortClasses("web=80,443;dns=53")}, types.PortClasses{
+			{Name: "web", Ranges: []types.PortRange{{First: 80, Last: 80}, {First: 443, Last: 443}}},
+			{Name: "dns", Ranges: []types.PortRange{{First: 53, Last: 53}}},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			expected := make(map[results.Attributes]types.Counters)
+			for _, row := range portRes.Rows {
+				attr := results.Attributes{
+					IPProto:      row.Attributes.IPProto,
+					DstPortClass: test.classes.Label(test.classes.Classify(row.Attributes.DstPort)),
+				}
+				counters := expected[attr]
+				counters.Add(row.Counters)
+				expected[attr] = counters
+			}
+
+			res, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs("dportclass,proto", test.opts...))
+			require.Nil(t, err)
+			require.Equal(t, portRes.Summary.Totals, res.Summary.Totals)
+
+			actual := make(map[results.Attributes]types.Counters)
+			for _, row := range res.Rows {
+				require.Zero(t, row.Attributes.DstPort)
+				actual[row.Attributes] = row.Counters
+			}
+			require.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestQueryMatrix(t *testing.T) {
+	const groups = "private=10.0.0.0/8,172.16.0.0/12,192.168.0.0/16;v6=::/0"
+
+	newArgs := func(opts ...query.Option) *query.Args {
+		return query.NewArgs("sip,dip", "eth1", append([]query.Option{
+			query.WithFirst("1456358400"), query.WithLast("1456473000"), query.WithFormat(types.FormatJSON),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	rowsRes, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs(query.WithNumResults(query.MaxResults)))
+	require.Nil(t, err)
+	require.Nil(t, rowsRes.Summary.Matrix)
+
+	// the matrix covers all rows, not only the ones displayed
+	res, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs(query.WithNumResults(1), query.WithMatrix(groups, groups)))
+	require.Nil(t, err)
+	require.Len(t, res.Rows, 1)
+	require.NotNil(t, res.Summary.Matrix)
+
+	prefixGroups, err := types.ParsePrefixGroups(groups)
+	require.Nil(t, err)
+	require.Equal(t, results.NewMatrix(prefixGroups, prefixGroups, rowsRes.Rows), res.Summary.Matrix)
+
+	var total types.Counters
+	for _, row := range res.Summary.Matrix.Cells {
+		for _, counters := range row {
+			total.Add(counters)
+		}
+	}
+	require.Equal(t, res.Summary.Totals, total)
+}
+
+func TestQueryBaseline(t *testing.T) {
+	const baselineFirst, first, last = "1456358400", "1456444800", "1456473000"
+
+	run := func(queryType, first, last string, opts ...query.Option) *results.Result {
+		res, err := NewQueryRunner(TestDB).Run(context.Background(), query.NewArgs(queryType, "eth1", append([]query.Option{
+			query.WithFirst(first), query.WithLast(last), query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard))
+		require.Nil(t, err)
+		return res
+	}
+
+	baseline := run("dip", baselineFirst, first)
+	known := make(map[string]struct{}, len(baseline.Rows))
+	for _, row := range baseline.Rows {
+		known[row.Attributes.DstIP.String()] = struct{}{}
+	}
+
+	var (
+		all      = run("dip", first, last)
+		expected results.Rows
+	)
+	for _, row := range all.Rows {
+		if _, exists := known[row.Attributes.DstIP.String()]; !exists {
+			expected = append(expected, row)
+		}
+	}
+	require.NotEmpty(t, expected)
+	require.Less(t, len(expected), len(all.Rows))
+
+	// only destinations absent during the baseline (directly preceding the queried time range) are returned
+	res := run("dip", first, last, query.WithBaseline(baselineFirst, ""))
+	require.Equal(t, expected, res.Rows)
+	require.Equal(t, len(expected), res.Summary.Hits.Total)
+	require.NotNil(t, res.Summary.Baseline)
+	require.Equal(t, len(baseline.Rows), res.Summary.Baseline.Keys)
+	require.EqualValues(t, 1456444800, res.Summary.Baseline.Last.Unix())
+
+	var totals types.Counters
+	for _, row := range expected {
+		totals.Add(row.Counters)
+	}
+	require.Equal(t, totals, res.Summary.Totals)
+
+	// the time bins of the baseline are ignored, whereas the ones of the queried time range are retained
+	timed := run("time,dip", first, last, query.WithBaseline(baselineFirst, ""))
+	require.GreaterOrEqual(t, len(timed.Rows), len(expected))
+	for _, row := range timed.Rows {
+		_, exists := known[row.Attributes.DstIP.String()]
+		require.False(t, exists)
+	}
+	require.Equal(t, len(baseline.Rows), timed.Summary.Baseline.Keys)
+}
+
+func TestQueryResourcePolicies(t *testing.T) {
+	newArgs := func() *query.Args {
+		return query.NewArgs("sip,dip", "eth1",
+			query.WithFirst("1456358400"), query.WithLast("1456473000"), query.WithFormat(types.FormatJSON),
+		).AddOutputs(io.Discard)
+	}
+
+	always, err := types.ParseTimeWindows("00:00-24:00")
+	require.Nil(t, err)
+	never := types.TimeWindows{}
+
+	// without a policy in effect, queries are unrestricted
+	expected, err := NewQueryRunner(TestDB, WithResourcePolicies(ResourcePolicy{Name: "never", Windows: never, MaxProcessingUnits: 1})).
+		Run(context.Background(), newArgs())
+	require.Nil(t, err)
+	require.Nil(t, expected.Summary.ResourcePolicies)
+
+	// the first policy in effect applies (without affecting the result)
+	res, err := NewQueryRunner(TestDB, WithResourcePolicies(
+		ResourcePolicy{Name: "never", Windows: never, MaxProcessingUnits: 2},
+		ResourcePolicy{Name: "always", Windows: always, Location: time.UTC, MaxProcessingUnits: 1, MaxMemPct: 10},
+		ResourcePolicy{Name: "shadowed", Windows: always, MaxProcessingUnits: 3},
+	)).Run(context.Background(), newArgs())
+	require.Nil(t, err)
+	require.Len(t, res.Summary.ResourcePolicies, 1)
+
+	policy := res.Summary.ResourcePolicies[0]
+	require.Equal(t, "always", policy.Name)
+	require.Equal(t, 1, policy.ProcessingUnits)
+	require.Equal(t, 10, policy.MaxMemPct)
+	require.NotEmpty(t, policy.Hostname)
+	require.Equal(t, expected.Rows, res.Rows)
+	require.Equal(t, expected.Summary.Totals, res.Summary.Totals)
+}
+
+func TestResourcePolicyLimits(t *testing.T) {
+	for _, test := range []struct {
+		policy           ResourcePolicy
+		units, memPct    int
+		expUnits, expPct int
+	}{
+		{ResourcePolicy{MaxProcessingUnits: 2}, 8, 60, 2, 60},
+		{ResourcePolicy{MaxProcessingUnits: 16}, 8, 60, 8, 60},
+		{ResourcePolicy{MaxMemPct: 20}, 8, 60, 8, 20},
+		{ResourcePolicy{MaxMemPct: 20}, 8, 10, 8, 10},
+		{ResourcePolicy{MaxMemPct: 20}, 8, 0, 8, 20},
+	} {
+		units, memPct := test.policy.limits(test.units, test.memPct)
+		require.Equal(t, test.expUnits, units)
+		require.Equal(t, test.expPct, memPct)
+	}
+}
+
+// testServicePlugin maps the destination port and IP protocol of a flow onto a service
+type testServicePlugin struct{}
+
+func (testServicePlugin) Name() string { return "service" }
+
+func (testServicePlugin) Columns() []types.ColumnIndex {
+	return []types.ColumnIndex{types.DportColIdx, types.ProtoColIdx}
+}
+
+func (testServicePlugin) Derive(key types.Key) string {
+	return testService(types.PortToUint16(key.GetDport()), key.GetProto())
+}
+
+func testService(dport uint16, proto uint8) string {
+	switch {
+	case proto == capturetypes.TCP && (dport == 80 || dport == 443):
+		return "web"
+	case dport == 53:
+		return "dns"
+	}
+	return "other"
+}
+
+func init() {
+	types.RegisterAttributePlugin(testServicePlugin{})
+}
+
+func TestQueryCustomAttributes(t *testing.T) {
+	newArgs := func(queryType, condition string) *query.Args {
+		return query.NewArgs(queryType, "eth1",
+			query.WithFirst("1456358400"), query.WithLast("1456473000"), query.WithCondition(condition),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		).AddOutputs(io.Discard)
+	}
+
+	portRes, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs("dport,proto", ""))
+	require.Nil(t, err)
+	require.NotEmpty(t, portRes.Rows)
+
+	expected := make(map[string]types.Counters)
+	for _, row := range portRes.Rows {
+		service := testService(row.Attributes.DstPort, row.Attributes.IPProto)
+		counters := expected[service]
+		counters.Add(row.Counters)
+		expected[service] = counters
+	}
+
+	// the rows are merged by the derived service (none of the columns it is derived from are printed)
+	res, err := NewQueryRunner(TestDB).Run(context.Background(), newArgs("service", ""))
+	require.Nil(t, err)
+	require.Equal(t, []string{"service"}, res.Query.Attributes)
+	require.Equal(t, portRes.Summary.Totals, res.Summary.Totals)
+	require.Len(t, res.Rows, len(expected))
+	require.Equal(t, len(res.Rows), res.Summary.Hits.Total)
+
+	actual := make(map[string]types.Counters)
+	for _, row := range res.Rows {
+		require.Zero(t, row.Attributes.DstPort)
+		require.Zero(t, row.Attributes.IPProto)
+		actual[row.Attributes.Custom.Get("service")] = row.Counters
+	}
+	require.Equal(t, expected, actual)
+
+	// the custom attribute can be used in conditions
+	res, err = NewQueryRunner(TestDB).Run(context.Background(), newArgs("dport,proto", "service = WEB"))
+	require.Nil(t, err)
+	require.NotEmpty(t, res.Rows)
+	require.Equal(t, expected["web"], res.Summary.Totals)
+	for _, row := range res.Rows {
+		require.Equal(t, "web", testService(row.Attributes.DstPort, row.Attributes.IPProto))
+	}
+}
+
 type MockInterfaceLister struct {
 	interfaces []string
 }
@@ -263,3 +673,692 @@ func TestDetectRegExpArgument(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryTags(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	registry := make(info.TagRegistry)
+	var defs []node.TagDefinition
+	for _, tag := range []struct{ name, condition string }{
+		{"web", "dport = 443 & proto = tcp"},
+		{"dns", "dport = 53"},
+		{"internal", "snet = 10.0.0.0/8"},
+	} {
+		bit, err := registry.Register(tag.name)
+		require.Nil(t, err)
+		defs = append(defs, node.TagDefinition{Name: tag.name, Bit: bit, Condition: tag.condition})
+	}
+	require.Nil(t, registry.Write(dbPath, 0644))
+	tagger, err := node.NewTagger(defs...)
+	require.Nil(t, err)
+
+	flows := hashmap.NewAggFlowMap()
+	for _, flow := range []struct {
+		sip, dip [4]byte
+		dport    uint16
+		proto    byte
+		bytes    uint64
+	}{
+		{[4]byte{10, 0, 0, 1}, [4]byte{1, 1, 1, 1}, 443, 6, 100},
+		{[4]byte{10, 0, 0, 2}, [4]byte{8, 8, 8, 8}, 53, 17, 10},
+		{[4]byte{192, 168, 0, 1}, [4]byte{1, 1, 1, 1}, 443, 6, 1000},
+		{[4]byte{192, 168, 0, 1}, [4]byte{1, 1, 1, 1}, 22, 6, 1},
+	} {
+		flows.PrimaryMap.Set(types.NewV4KeyStatic(flow.sip, flow.dip, []byte{byte(flow.dport >> 8), byte(flow.dport)}, flow.proto),
+			types.Counters{BytesRcvd: flow.bytes, PacketsRcvd: 1})
+	}
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).Tagger(tagger).Write(flows, capturetypes.CaptureStats{}, timestamp))
+
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(timestamp - 3600)), query.WithLast(fmt.Sprint(timestamp + 3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// the tags of each flow are provided as label
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("tag"))
+	require.Nil(t, err)
+	actual := make(map[string]uint64)
+	for _, row := range res.Rows {
+		actual[row.Labels.Tag] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[string]uint64{"web,internal": 100, "dns,internal": 10, "web": 1000, "": 1}, actual)
+
+	// restricting the query to tags only considers flows carrying any of them
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithTags("web,dns")))
+	require.Nil(t, err)
+	require.Equal(t, uint64(1110), res.Summary.Totals.BytesRcvd)
+	for _, row := range res.Rows {
+		require.Contains(t, []uint16{53, 443}, row.Attributes.DstPort)
+	}
+
+	_, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithTags("voip")))
+	require.ErrorContains(t, err, "no flow tag(s) voip defined")
+}
+
+func TestQueryDecapsulatedFlows(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	registry := make(info.TagRegistry)
+	var decapTags goDB.DecapsulationTags
+	for encap := capturetypes.EncapGRE; encap < capturetypes.NumEncapsulations; encap++ {
+		bit, err := registry.Register(encap.Tag())
+		require.Nil(t, err)
+		decapTags[encap] = 1 << bit
+	}
+	require.Nil(t, registry.Write(dbPath, 0644))
+
+	flows := hashmap.NewAggFlowMap()
+	tunneled := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 22}, 6)
+	flows.PrimaryMap.Set(tunneled, types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+	flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{192, 168, 0, 1}, [4]byte{192, 168, 0, 2}, []byte{0x12, 0xb5}, 17),
+		types.Counters{BytesRcvd: 10, PacketsRcvd: 1})
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).DecapsulationTags(decapTags).
+		WriteCaptured(flows, capturetypes.FlowAttributes{Labeled: capturetypes.LabeledFlows{string(tunneled): {{
+			FlowLabels: capturetypes.FlowLabels{Encapsulation: capturetypes.EncapVXLAN},
+			Counters:   types.Counters{BytesRcvd: 100, PacketsRcvd: 1},
+		}}}}, capturetypes.CaptureStats{}, timestamp))
+
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(timestamp - 3600)), query.WithLast(fmt.Sprint(timestamp + 3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// decapsulated flows are labeled with the tag of their encapsulation
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("tag"))
+	require.Nil(t, err)
+	actual := make(map[string]uint64)
+	for _, row := range res.Rows {
+		actual[row.Labels.Tag] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[string]uint64{"decap:vxlan": 100, "": 10}, actual)
+
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("sip", query.WithTags("decap:vxlan")))
+	require.Nil(t, err)
+	require.Equal(t, uint64(100), res.Summary.Totals.BytesRcvd)
+}
+
+func TestQueryTimeWindows(t *testing.T) {
+	dbPath := t.TempDir()
+
+	// write one block per hour over two days (Friday / Saturday), each carrying the hour of day
+	// as number of bytes
+	tFirst := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC).Unix()
+	w := goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull)
+	for ts := tFirst + 3600; ts <= tFirst+2*24*3600; ts += 3600 {
+		flows := hashmap.NewAggFlowMap()
+		flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 80}, 6),
+			types.Counters{BytesRcvd: uint64(time.Unix(ts, 0).UTC().Hour()), PacketsRcvd: 1})
+		require.Nil(t, w.Write(flows, capturetypes.CaptureStats{}, ts))
+	}
+
+	newArgs := func(opts ...query.Option) *query.Args {
+		return query.NewArgs("time", "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(tFirst)), query.WithLast(fmt.Sprint(tFirst + 2*24*3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	var tests = []struct {
+		name     string
+		windows  string
+		zone     string
+		expected []int64 // hours (relative to tFirst) of the blocks considered
+	}{
+		// the block written at 10:00 covers 09:55-10:00 and hence falls into the window, the one
+		// written at 09:00 doesn't
+		{"business hours", "mon-fri 09:00-12:00", "UTC", []int64{10, 11, 12}},
+		{"weekend", "sat,sun 23:00-24:00", "UTC", []int64{24 + 24}},
+		{"spanning midnight", "fri 23:00-01:00", "UTC", []int64{24, 24 + 1}},
+		{"time zone", "sat 00:00-02:00", "Europe/Zurich", []int64{24, 24 + 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs(query.WithTimeWindows(test.windows, test.zone)))
+			require.Nil(t, err)
+			require.NotEmpty(t, res.Query.TimeWindows)
+
+			var actual []int64
+			for _, row := range res.Rows {
+				actual = append(actual, (row.Labels.Timestamp.Unix()-tFirst)/3600)
+			}
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestQueryProvenance(t *testing.T) {
+	dbPath := t.TempDir()
+
+	tFirst := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+	w := goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeLZ4)
+	for i := int64(1); i <= 3; i++ {
+		// blocks are only stored compressed if it pays off, hence a sufficient number of flows is required
+		flows := hashmap.NewAggFlowMap()
+		for j := 0; j < 1000; j++ {
+			flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, byte(j >> 8), byte(j)}, [4]byte{10, 0, 0, 2}, []byte{0, 80}, 6),
+				types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+		}
+		require.Nil(t, w.Write(flows, capturetypes.CaptureStats{}, tFirst+i*goDB.DBWriteInterval))
+	}
+
+	runQuery := func(opts ...query.Option) *results.Result {
+		res, err := NewQueryRunner(dbPath).Run(context.Background(), query.NewArgs("sip,dip,dport", "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(tFirst)), query.WithLast(fmt.Sprint(tFirst + 3600)),
+			query.WithFormat(types.FormatJSON),
+		}, opts...)...).AddOutputs(io.Discard))
+		require.Nil(t, err)
+		return res
+	}
+
+	// provenance is only reported if requested
+	require.Nil(t, runQuery().Summary.Provenance)
+
+	res := runQuery(query.WithProvenance())
+	require.NotNil(t, res.Summary.Provenance)
+	require.Len(t, res.Summary.Provenance.Sources, 1)
+	source := res.Summary.Provenance.Sources[0]
+	require.Equal(t, res.Hostname, source.Hostname)
+	require.Equal(t, dbPath, source.DBPath)
+	require.NotEmpty(t, source.Version)
+	require.Equal(t, &results.TimeRange{
+		First: time.Unix(tFirst, 0),
+		Last:  time.Unix(tFirst+3*goDB.DBWriteInterval, 0),
+	}, source.Blocks)
+	require.Contains(t, source.Encoders, encoders.EncoderTypeLZ4.String())
+	require.Empty(t, source.CorruptBlocks)
+	require.Equal(t, results.SamplingNone, source.Sampling)
+
+	// truncate the destination port column, cutting off the last block
+	dportPaths, err := filepath.Glob(filepath.Join(dbPath, "eth0", "*", "*", "*", types.ColumnFileNames[types.DportColIdx]+gpfile.FileSuffix))
+	require.Nil(t, err)
+	require.Len(t, dportPaths, 1)
+	stat, err := os.Stat(dportPaths[0])
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(dportPaths[0], stat.Size()-1))
+
+	source = runQuery(query.WithProvenance()).Summary.Provenance.Sources[0]
+	require.Equal(t, []results.CorruptBlock{{Iface: "eth0", Timestamp: time.Unix(tFirst+3*goDB.DBWriteInterval, 0)}}, source.CorruptBlocks)
+	require.Equal(t, time.Unix(tFirst+2*goDB.DBWriteInterval, 0), source.Blocks.Last)
+}
+
+func TestQueryOrigin(t *testing.T) {
+	dbPath := t.TempDir()
+
+	// eth0 was captured on another host (e.g. copied off a probe), eth1 by an older release without
+	// stamping its origin
+	origin := gpfile.Origin{Hostname: "probe-a", HostID: "0123456789abcdef"}
+	tFirst := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for iface, w := range map[string]*goDB.DBWriter{
+		"eth0": goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeLZ4).Origin(origin),
+		"eth1": goDB.NewDBWriter(dbPath, "eth1", encoders.EncoderTypeLZ4),
+	} {
+		flows := hashmap.NewAggFlowMap()
+		flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 80}, 6),
+			types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+		require.Nil(t, w.Write(flows, capturetypes.CaptureStats{}, tFirst+goDB.DBWriteInterval), iface)
+	}
+
+	runQuery := func(ifaces string) *results.Result {
+		res, err := NewQueryRunner(dbPath).Run(context.Background(), query.NewArgs("hostname,hostid,iface", ifaces,
+			query.WithFirst(fmt.Sprint(tFirst)), query.WithLast(fmt.Sprint(tFirst+3600)),
+			query.WithFormat(types.FormatJSON), query.WithProvenance(),
+		).AddOutputs(io.Discard))
+		require.Nil(t, err)
+		return res
+	}
+
+	hostname, err := os.Hostname()
+	require.Nil(t, err)
+	local := gpfile.Origin{Hostname: hostname, HostID: info.GetHostID(dbPath)}
+
+	// the rows of each interface are attributed to the host its data was captured on
+	res := runQuery("eth0,eth1")
+	require.Equal(t, local.Hostname, res.Hostname)
+	require.Len(t, res.Rows, 2)
+	for _, row := range res.Rows {
+		expected := local
+		if row.Labels.Iface == "eth0" {
+			expected = origin
+		}
+		require.Equal(t, expected.Hostname, row.Labels.Hostname, row.Labels.Iface)
+		require.Equal(t, expected.HostID, row.Labels.HostID, row.Labels.Iface)
+	}
+	require.Len(t, res.Summary.Provenance.Sources, 2)
+	for _, source := range res.Summary.Provenance.Sources {
+		require.Contains(t, []string{origin.Hostname, local.Hostname}, source.Hostname)
+		require.NotNil(t, source.Blocks)
+	}
+
+	// a result covering data of another host only is attributed to it
+	res = runQuery("eth0")
+	require.Equal(t, origin.Hostname, res.Hostname)
+	require.Contains(t, res.HostsStatuses, origin.Hostname)
+	require.Len(t, res.Summary.Provenance.Sources, 1)
+	require.Equal(t, origin.HostID, res.Summary.Provenance.Sources[0].HostID)
+}
+
+// testAttributor attributes flows to processes by their destination port
+type testAttributor map[uint16]uint32
+
+func (a testAttributor) ProcessID(key types.Key) uint32 {
+	return a[types.PortToUint16(key.GetDport())]
+}
+
+func TestQueryProcesses(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	registry := make(info.ProcessRegistry)
+	attributor := make(testAttributor)
+	for dport, label := range map[uint16]string{
+		5432: "postgres (/system.slice/postgresql.service)",
+		53:   "dnsmasq",
+	} {
+		id, _, err := registry.Register(label)
+		require.Nil(t, err)
+		attributor[dport] = id
+	}
+	require.Nil(t, registry.Write(dbPath, 0644))
+
+	newFlows := func(bytes uint64) *hashmap.AggFlowMap {
+		flows := hashmap.NewAggFlowMap()
+		for _, dport := range []uint16{5432, 53, 22} {
+			flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{127, 0, 0, 1}, [4]byte{127, 0, 0, 1}, []byte{byte(dport >> 8), byte(dport)}, 6),
+				types.Counters{BytesRcvd: bytes, PacketsRcvd: 1})
+		}
+		return flows
+	}
+
+	// the first block is written without process attribution (e.g. prior to enabling it)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "lo", encoders.EncoderTypeNull).Write(newFlows(1), capturetypes.CaptureStats{}, timestamp))
+	require.Nil(t, goDB.NewDBWriter(dbPath, "lo", encoders.EncoderTypeNull).ProcessAttributor(attributor).Write(newFlows(100), capturetypes.CaptureStats{}, timestamp+300))
+
+	newArgs := func(queryType string) *query.Args {
+		return query.NewArgs(queryType, "lo",
+			query.WithFirst(fmt.Sprint(timestamp-3600)), query.WithLast(fmt.Sprint(timestamp+3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		).AddOutputs(io.Discard)
+	}
+
+	// the process each flow was attributed to is provided as label
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("process"))
+	require.Nil(t, err)
+	actual := make(map[string]uint64)
+	for _, row := range res.Rows {
+		actual[row.Labels.Process] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[string]uint64{"postgres (/system.slice/postgresql.service)": 100, "dnsmasq": 100, "": 103}, actual)
+
+	// process labels can be combined with timestamps and attributes
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("time,process,dport"))
+	require.Nil(t, err)
+	require.Len(t, res.Rows, 6)
+	for _, row := range res.Rows {
+		switch {
+		case row.Labels.Timestamp.Unix() == timestamp:
+			require.Empty(t, row.Labels.Process)
+		case row.Attributes.DstPort == 5432:
+			require.Equal(t, "postgres (/system.slice/postgresql.service)", row.Labels.Process)
+		case row.Attributes.DstPort == 22:
+			require.Empty(t, row.Labels.Process)
+		}
+	}
+}
+
+func TestQueryVLANs(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	newFlows := func(bytes uint64) (*hashmap.AggFlowMap, capturetypes.LabeledFlows) {
+		flows, vlans := hashmap.NewAggFlowMap(), make(capturetypes.LabeledFlows)
+		for dport, vlan := range map[uint16]uint16{443: 100, 53: 200, 22: 0} {
+			key := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{byte(dport >> 8), byte(dport)}, 6)
+			flows.PrimaryMap.Set(key, types.Counters{BytesRcvd: bytes, PacketsRcvd: 1})
+			if vlan != 0 {
+				vlans.Add(string(key), capturetypes.LabeledFlow{
+					FlowLabels: capturetypes.FlowLabels{VLAN: vlan},
+					Counters:   types.Counters{BytesRcvd: bytes, PacketsRcvd: 1},
+				})
+			}
+		}
+		return flows, vlans
+	}
+
+	// the first block is written without any flows observed on a VLAN (e.g. prior to trunking the interface)
+	flows, _ := newFlows(1)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).Write(flows, capturetypes.CaptureStats{}, timestamp))
+	flows, vlans := newFlows(100)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).WriteCaptured(flows, capturetypes.FlowAttributes{Labeled: vlans}, capturetypes.CaptureStats{}, timestamp+300))
+
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(timestamp - 3600)), query.WithLast(fmt.Sprint(timestamp + 3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// the VLAN each flow was observed on is provided as label
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("vlan"))
+	require.Nil(t, err)
+	actual := make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		actual[row.Labels.VLAN] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{100: 100, 200: 100, 0: 103}, actual)
+
+	// conditions on the VLAN only match flows observed on it (flows written without VLAN column are untagged)
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithCondition("vlan = 100 | vlan = 0")))
+	require.Nil(t, err)
+	actual = make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		require.Zero(t, row.Labels.VLAN)
+		actual[row.Attributes.DstPort] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{443: 101, 53: 1, 22: 101}, actual)
+
+	// a flow observed on several VLANs (and untagged) is accounted to each of them by its share
+	key := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0x1f, 0x90}, 6)
+	flows = hashmap.NewAggFlowMap()
+	flows.PrimaryMap.Set(key, types.Counters{BytesRcvd: 60, PacketsRcvd: 6})
+	vlans = make(capturetypes.LabeledFlows)
+	vlans.Add(string(key), capturetypes.LabeledFlow{FlowLabels: capturetypes.FlowLabels{VLAN: 100}, Counters: types.Counters{BytesRcvd: 30, PacketsRcvd: 3}})
+	vlans.Add(string(key), capturetypes.LabeledFlow{FlowLabels: capturetypes.FlowLabels{VLAN: 200}, Counters: types.Counters{BytesRcvd: 20, PacketsRcvd: 2}})
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).WriteCaptured(flows, capturetypes.FlowAttributes{Labeled: vlans}, capturetypes.CaptureStats{}, timestamp+600))
+
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("vlan", query.WithCondition("dport = 8080")))
+	require.Nil(t, err)
+	actual = make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		actual[row.Labels.VLAN] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{100: 30, 200: 20, 0: 10}, actual)
+}
+
+func TestQueryMACs(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	var (
+		gateway = types.MAC{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+		hostA   = types.MAC{0xaa, 0xbb, 0xcc, 0x00, 0x00, 0x01}
+		hostB   = types.MAC{0xaa, 0xbb, 0xcc, 0x00, 0x00, 0x02}
+	)
+	newFlows := func(bytes uint64) (*hashmap.AggFlowMap, capturetypes.LabeledFlows) {
+		flows, macs := hashmap.NewAggFlowMap(), make(capturetypes.LabeledFlows)
+		for dport, smac := range map[uint16]types.MAC{443: hostA, 53: hostB, 22: hostA} {
+			key := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{byte(dport >> 8), byte(dport)}, 6)
+			flows.PrimaryMap.Set(key, types.Counters{BytesRcvd: bytes, PacketsRcvd: 1})
+			macs.Add(string(key), capturetypes.LabeledFlow{
+				FlowLabels: capturetypes.FlowLabels{MACs: capturetypes.MACPair{Src: smac, Dst: gateway}},
+				Counters:   types.Counters{BytesRcvd: bytes, PacketsRcvd: 1},
+			})
+		}
+		return flows, macs
+	}
+
+	// the first block is written without any MAC addresses (e.g. prior to enabling their capture)
+	flows, _ := newFlows(1)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).Write(flows, capturetypes.CaptureStats{}, timestamp))
+	flows, macs := newFlows(100)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).WriteCaptured(flows, capturetypes.FlowAttributes{Labeled: macs}, capturetypes.CaptureStats{}, timestamp+300))
+
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(timestamp - 3600)), query.WithLast(fmt.Sprint(timestamp + 3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// the MAC addresses of each flow are provided as labels
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("smac,dmac"))
+	require.Nil(t, err)
+	actual := make(map[string]uint64)
+	for _, row := range res.Rows {
+		actual[row.Labels.SMAC+"/"+row.Labels.DMAC] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[string]uint64{
+		hostA.String() + "/" + gateway.String(): 200,
+		hostB.String() + "/" + gateway.String(): 100,
+		"/":                                     3,
+	}, actual)
+
+	// conditions on the MAC addresses only match flows carrying them (flows written without MAC columns
+	// carry none)
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithCondition("smac = aa:bb:cc:00:00:01 & dmac = 00:11:22:33:44:55")))
+	require.Nil(t, err)
+	actualPorts := make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		require.Empty(t, row.Labels.SMAC)
+		actualPorts[row.Attributes.DstPort] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{443: 100, 22: 100}, actualPorts)
+}
+
+func TestQueryTCPFlags(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	newFlows := func(bytes uint64) (*hashmap.AggFlowMap, capturetypes.TCPFlags) {
+		flows, tcpFlags := hashmap.NewAggFlowMap(), make(capturetypes.TCPFlags)
+		for dport, flags := range map[uint16]types.TCPFlags{
+			443: types.TCPFlagSYN | types.TCPFlagACK | types.TCPFlagFIN,
+			80:  types.TCPFlagSYN,
+			53:  0,
+		} {
+			proto := byte(6)
+			if flags == 0 {
+				proto = 17
+			}
+			key := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{byte(dport >> 8), byte(dport)}, proto)
+			flows.PrimaryMap.Set(key, types.Counters{BytesRcvd: bytes, PacketsRcvd: 1})
+			if flags != 0 {
+				tcpFlags[string(key)] = flags
+			}
+		}
+		return flows, tcpFlags
+	}
+
+	// the first block is written without any TCP flags (e.g. prior to their introduction)
+	flows, _ := newFlows(1)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).Write(flows, capturetypes.CaptureStats{}, timestamp))
+	flows, tcpFlags := newFlows(100)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).WriteCaptured(flows, capturetypes.FlowAttributes{TCPFlags: tcpFlags}, capturetypes.CaptureStats{}, timestamp+300))
+
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(timestamp - 3600)), query.WithLast(fmt.Sprint(timestamp + 3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// the TCP flags of each flow are provided as label
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport,flags"))
+	require.Nil(t, err)
+	actual := make(map[string]uint64)
+	for _, row := range res.Rows {
+		actual[fmt.Sprintf("%d/%s", row.Attributes.DstPort, row.Labels.TCPFlags)] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[string]uint64{
+		"443/FIN,SYN,ACK": 100,
+		"80/SYN":          100,
+		"443/":            1,
+		"80/":             1,
+		"53/":             101,
+	}, actual)
+
+	// conditions on the TCP flags allow to single out e.g. unanswered connection attempts
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithCondition("flags = syn & !ack")))
+	require.Nil(t, err)
+	actualPorts := make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		require.Empty(t, row.Labels.TCPFlags)
+		actualPorts[row.Attributes.DstPort] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{80: 100}, actualPorts)
+}
+
+func TestQueryDSCP(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+
+	newFlows := func(bytes uint64) (*hashmap.AggFlowMap, capturetypes.LabeledFlows) {
+		flows, dscps := hashmap.NewAggFlowMap(), make(capturetypes.LabeledFlows)
+		for dport, dscp := range map[uint16]types.DSCP{
+			5060: 46,
+			3478: 34,
+			443:  0,
+		} {
+			key := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{byte(dport >> 8), byte(dport)}, 17)
+			flows.PrimaryMap.Set(key, types.Counters{BytesRcvd: bytes, PacketsRcvd: 1})
+			if dscp != 0 {
+				dscps.Add(string(key), capturetypes.LabeledFlow{
+					FlowLabels: capturetypes.FlowLabels{DSCP: dscp},
+					Counters:   types.Counters{BytesRcvd: bytes, PacketsRcvd: 1},
+				})
+			}
+		}
+		return flows, dscps
+	}
+
+	// the first block is written without any DSCPs (e.g. prior to their introduction)
+	flows, _ := newFlows(1)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).Write(flows, capturetypes.CaptureStats{}, timestamp))
+	flows, dscps := newFlows(100)
+	require.Nil(t, goDB.NewDBWriter(dbPath, "eth0", encoders.EncoderTypeNull).WriteCaptured(flows, capturetypes.FlowAttributes{Labeled: dscps}, capturetypes.CaptureStats{}, timestamp+300))
+
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0", append([]query.Option{
+			query.WithFirst(fmt.Sprint(timestamp - 3600)), query.WithLast(fmt.Sprint(timestamp + 3600)),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(query.MaxResults),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	// the DSCP of each flow is provided as label
+	res, err := NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport,dscp"))
+	require.Nil(t, err)
+	actual := make(map[string]uint64)
+	for _, row := range res.Rows {
+		actual[fmt.Sprintf("%d/%s", row.Attributes.DstPort, row.Labels.DSCP)] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[string]uint64{
+		"5060/EF":   100,
+		"3478/AF41": 100,
+		"5060/":     1,
+		"3478/":     1,
+		"443/":      101,
+	}, actual)
+
+	// conditions on the DSCP allow to single out e.g. traffic with expedited forwarding
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithCondition("dscp = ef")))
+	require.Nil(t, err)
+	actualPorts := make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		require.Empty(t, row.Labels.DSCP)
+		actualPorts[row.Attributes.DstPort] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{5060: 100}, actualPorts)
+
+	// ... or all traffic marked with any non-default DSCP
+	res, err = NewQueryRunner(dbPath).Run(context.Background(), newArgs("dport", query.WithCondition("dscp != be")))
+	require.Nil(t, err)
+	actualPorts = make(map[uint16]uint64)
+	for _, row := range res.Rows {
+		actualPorts[row.Attributes.DstPort] = row.Counters.BytesRcvd
+	}
+	require.Equal(t, map[uint16]uint64{5060: 100, 3478: 100}, actualPorts)
+}
+
+func TestRunBatch(t *testing.T) {
+	newArgs := func(queryType string, opts ...query.Option) *query.Args {
+		return query.NewArgs(queryType, "eth0,eth1", append([]query.Option{
+			query.WithFirst("1456358400"), query.WithLast("1456473000"),
+			query.WithFormat(types.FormatJSON), query.WithNumResults(50),
+		}, opts...)...).AddOutputs(io.Discard)
+	}
+
+	batch := []*query.Args{
+		newArgs("sip,dip"),
+		newArgs("dport,proto", query.WithCondition("proto = tcp")),
+		newArgs("time,iface", query.WithMaxMemPct(80)),
+		newArgs("sip", query.WithCondition("dport = 443"), query.WithProfile()),
+	}
+
+	res, err := NewQueryRunner(TestDB).RunBatch(context.Background(), batch)
+	require.Nil(t, err)
+	require.Len(t, res, len(batch))
+
+	// the results of a batch are identical to the ones of the individual queries
+	for i, args := range batch {
+		expected, err := NewQueryRunner(TestDB).Run(context.Background(), args)
+		require.Nil(t, err)
+		require.NotEmpty(t, expected.Rows)
+
+		require.Equal(t, expected.Query, res[i].Query)
+		require.Equal(t, expected.Rows, res[i].Rows)
+		require.Equal(t, expected.Summary.Totals, res[i].Summary.Totals)
+		require.Equal(t, expected.Summary.Hits, res[i].Summary.Hits)
+		require.Equal(t, expected.Summary.Interfaces, res[i].Summary.Interfaces)
+		require.Equal(t, expected.Summary.First, res[i].Summary.First)
+		require.Equal(t, expected.Summary.Last, res[i].Summary.Last)
+
+		// all queries share the same reads
+		require.Equal(t, res[0].Summary.Stats.BytesLoaded, res[i].Summary.Stats.BytesLoaded)
+	}
+	require.NotNil(t, res[3].Summary.Profile)
+	require.Nil(t, res[0].Summary.Profile)
+
+	// all queries of a batch must cover the same time range and interfaces
+	_, err = NewQueryRunner(TestDB).RunBatch(context.Background(), []*query.Args{
+		newArgs("sip"), newArgs("dip", query.WithLast("1456400000")),
+	})
+	require.ErrorIs(t, err, errorBatchMismatch)
+
+	mismatchingIfaces := newArgs("dip")
+	mismatchingIfaces.Ifaces = "eth1"
+	_, err = NewQueryRunner(TestDB).RunBatch(context.Background(), []*query.Args{newArgs("sip"), mismatchingIfaces})
+	require.ErrorIs(t, err, errorBatchMismatch)
+
+	_, err = NewQueryRunner(TestDB).RunBatch(context.Background(), nil)
+	require.Error(t, err)
+}
+
+func TestDryRun(t *testing.T) {
+	args := query.NewArgs("sip,dip", "eth0,eth1",
+		query.WithFirst("1456358400"), query.WithLast("1456473000"),
+		query.WithFormat(types.FormatJSON), query.WithNumResults(50),
+	).AddOutputs(io.Discard)
+
+	dryRun, err := NewQueryRunner(TestDB).DryRun(context.Background(), args)
+	require.Nil(t, err)
+	require.Equal(t, []string{"eth0", "eth1"}, dryRun.Interfaces)
+	require.Equal(t, int64(1456358400), dryRun.First.Unix())
+	require.Equal(t, 2, dryRun.Cost.Interfaces)
+	require.NotZero(t, dryRun.Cost.Bytes)
+	require.NotZero(t, dryRun.Cost.Flows)
+
+	// the estimate matches the reads of the query
+	res, err := NewQueryRunner(TestDB).Run(context.Background(), args)
+	require.Nil(t, err)
+	require.NotNil(t, res.Summary.Stats)
+	require.Equal(t, res.Summary.Stats.DirectoriesProcessed, uint64(dryRun.Cost.Directories))
+	require.NotZero(t, dryRun.Cost.Blocks)
+	require.NotEmpty(t, res.Rows)
+
+	// the estimate covers exactly the blocks within the time range
+	narrowed := *args
+	narrowed.Last = "1456400000"
+	narrowedDryRun, err := NewQueryRunner(TestDB).DryRun(context.Background(), &narrowed)
+	require.Nil(t, err)
+	require.Less(t, narrowedDryRun.Cost.Blocks, dryRun.Cost.Blocks)
+	require.Less(t, narrowedDryRun.Cost.Flows, dryRun.Cost.Flows)
+
+	// invalid queries are rejected
+	_, err = NewQueryRunner(TestDB).DryRun(context.Background(), query.NewArgs("sip", "eth0", query.WithCondition("dport = ")))
+	require.Error(t, err)
+}
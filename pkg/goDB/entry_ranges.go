@@ -0,0 +1,102 @@
+package goDB
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// entryRange denotes a contiguous range [start, end) of entries of a block
+type entryRange struct {
+	start, end int
+}
+
+// narrowsEntries returns if the query can narrow down the entries of sorted blocks, i.e. if its
+// conditional requires specific protocol values
+func (q *Query) narrowsEntries() bool {
+	return q.condProtos != nil
+}
+
+// entryRanges determines the (ascending) ranges of entries of a block within [start, end) which may
+// satisfy the conditional of the query. For blocks sorted by protocol, destination port and source IP
+// (see gpfile.BlockOrderSorted), the entries carrying the values required by the conditional are located
+// via binary search (separately for IPv4 and IPv6 entries). Otherwise, all entries are considered
+func (q *Query) entryRanges(cols *blockColumns, start, end int) []entryRange {
+	if !cols.sorted || !q.narrowsEntries() {
+		return []entryRange{{start, end}}
+	}
+
+	var ranges []entryRange
+	if v4End := min(end, cols.numV4Entries); start < v4End {
+		ranges = q.narrowEntries(cols, start, v4End, types.IPv4Width, ranges)
+	}
+	if v6Start := max(start, cols.numV4Entries); v6Start < end {
+		ranges = q.narrowEntries(cols, v6Start, end, types.IPv6Width, ranges)
+	}
+	return ranges
+}
+
+// narrowEntries appends the ranges of entries within [lo, hi) (all of the same IP version) carrying the
+// values required by the conditional. Since the entries are sorted by protocol first, narrowing stops at
+// the first attribute (in sort order) the conditional does not restrict
+func (q *Query) narrowEntries(cols *blockColumns, lo, hi, ipWidth int, ranges []entryRange) []entryRange {
+	for _, proto := range q.condProtos {
+		pLo, pHi := equalRange(lo, hi, func(i int) int {
+			return bytes.Compare(cols.proto[i:i+1], proto)
+		})
+		if pLo == pHi {
+			continue
+		}
+		if q.condDports == nil {
+			ranges = append(ranges, entryRange{pLo, pHi})
+			continue
+		}
+		for _, dport := range q.condDports {
+			dLo, dHi := equalRange(pLo, pHi, func(i int) int {
+				return bytes.Compare(cols.dport[i*types.DportSizeof:i*types.DportSizeof+types.DportSizeof], dport)
+			})
+			if dLo == dHi {
+				continue
+			}
+			if q.condSIPs == nil {
+				ranges = append(ranges, entryRange{dLo, dHi})
+				continue
+			}
+			for _, sip := range q.condSIPs {
+
+				// IPs of the other IP version cannot match any entry
+				if len(sip) != ipWidth {
+					continue
+				}
+				if sLo, sHi := equalRange(dLo, dHi, func(i int) int {
+					return bytes.Compare(cols.sipAt(i), sip)
+				}); sLo < sHi {
+					ranges = append(ranges, entryRange{sLo, sHi})
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// equalRange returns the range of entries within [lo, hi) comparing equal (zero) to the value searched
+// for, provided that compare is non-decreasing on [lo, hi)
+func equalRange(lo, hi int, compare func(i int) int) (int, int) {
+	first := lo + sort.Search(hi-lo, func(j int) bool {
+		return compare(lo+j) >= 0
+	})
+	last := first + sort.Search(hi-first, func(j int) bool {
+		return compare(first+j) > 0
+	})
+	return first, last
+}
+
+// sipAt returns the source IP of the entry at a given index
+func (c *blockColumns) sipAt(i int) []byte {
+	if i < c.numV4Entries {
+		return c.sip[i*types.IPv4Width : i*types.IPv4Width+types.IPv4Width]
+	}
+	offset := c.numV4Entries*types.IPv4Width + (i-c.numV4Entries)*types.IPv6Width
+	return c.sip[offset : offset+types.IPv6Width]
+}
@@ -0,0 +1,56 @@
+package goDB
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/results"
+)
+
+// EstimateCost estimates the cost of evaluating the queries over the given time range from the metadata
+// of the directories covered (without reading any blocks). Directories which would be skipped during
+// execution (based on their IP filter) are accounted for separately
+func (w *DBWorkManager) EstimateCost(tfirst, tlast int64) (*results.Cost, error) {
+	cost := &results.Cost{Interfaces: 1}
+
+	walkFunc := func(_ int, dayTimestamp int64, suffix string) error {
+		dir := w.newDirReader(dayTimestamp, suffix)
+		if w.excludedByIPFilter(dir) {
+			cost.DirectoriesPruned++
+			return nil
+		}
+
+		if err := dir.Open(); err != nil {
+			return fmt.Errorf("failed to open GPDir %s to estimate query cost: %w", dir.Path(), err)
+		}
+		if w.metadataCache != nil {
+			w.metadataCache.storeDir(w.dbIfaceDir, dir)
+		}
+		cost.Directories++
+
+		for b, block := range dir.BlockMetadata[0].Blocks() {
+			if block.Timestamp < tfirst || block.Timestamp > tlast {
+				continue
+			}
+			if !slices.ContainsFunc(w.queries, func(q *Query) bool { return q.coversBlock(block.Timestamp) }) {
+				continue
+			}
+
+			cost.Blocks++
+			cost.Flows += dir.NumIPv4EntriesAtIndex(b) + dir.NumIPv6EntriesAtIndex(b)
+			for _, colIdx := range w.columnIndices {
+				// optional columns (e.g. the tags) may not be present in the metadata of older blocks
+				if colBlocks := dir.BlockMetadata[colIdx].BlockList; b < len(colBlocks) {
+					cost.Bytes += uint64(colBlocks[b].Len)
+				}
+			}
+		}
+
+		return dir.Close()
+	}
+
+	if _, err := w.walkDB(tfirst, tlast, walkFunc); err != nil {
+		return nil, err
+	}
+	return cost, nil
+}
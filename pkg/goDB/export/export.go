@@ -0,0 +1,386 @@
+// Package export converts the (daily) directories of an entire goDB into Apache Parquet files, so that
+// the raw flows can be analyzed by e.g. Spark, DuckDB or ClickHouse without custom readers.
+//
+// The files are partitioned by interface and date (Hive-style, i.e. as directories named
+// iface=<iface>/date=<YYYY-MM-DD>), each directory of the goDB being converted into a single file.
+// Since the partition columns are derived from the paths of the files, they are not part of the data.
+package export
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/export/parquet"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/inspect"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const (
+	// FileSuffix denotes the suffix of the exported files
+	FileSuffix = ".parquet"
+
+	partitionDateFormat = "2006-01-02"
+
+	// prefix of the keys of the key / value metadata of the exported files
+	metadataPrefix = "goprobe."
+)
+
+// columns denotes the columns of the exported files (in the order of the values of a row)
+var columns = []parquet.Column{
+	{Name: types.TimeName, Type: parquet.Timestamp},
+	{Name: types.SIPName, Type: parquet.String},
+	{Name: types.DIPName, Type: parquet.String},
+	{Name: types.DportName, Type: parquet.Uint16},
+	{Name: types.ProtoName, Type: parquet.Uint8},
+	{Name: types.BytesRcvdName, Type: parquet.Uint64},
+	{Name: types.BytesSentName, Type: parquet.Uint64},
+	{Name: types.PktsRcvdName, Type: parquet.Uint64},
+	{Name: types.PktsSentName, Type: parquet.Uint64},
+	{Name: types.TagsName, Type: parquet.String},
+	{Name: types.ProcessName, Type: parquet.String},
+	{Name: types.VLANName, Type: parquet.Uint16},
+	{Name: types.SMACName, Type: parquet.String},
+	{Name: types.DMACName, Type: parquet.String},
+	{Name: types.TCPFlagsName, Type: parquet.String},
+	{Name: types.DSCPName, Type: parquet.String},
+}
+
+// Report summarizes the export of a goDB
+type Report struct {
+	Path      string `json:"path"`
+	Out       string `json:"out"`
+	NumIfaces int    `json:"num_ifaces"`
+	NumDirs   int    `json:"num_dirs"`
+	NumBlocks int    `json:"num_blocks"`
+	NumFiles  int    `json:"num_files"`
+	NumRows   int    `json:"num_rows"`
+
+	// Skipped lists all directories / blocks which could not be read (and hence were not exported)
+	Skipped []Skipped `json:"skipped,omitempty"`
+}
+
+// Skipped denotes a directory (or a block of it) which could not be exported
+type Skipped struct {
+	Path      string `json:"path"`                // Path denotes the path of the directory relative to the goDB
+	Timestamp int64  `json:"timestamp,omitempty"` // Timestamp denotes the skipped block (zero if the whole directory was skipped)
+	Reason    string `json:"reason"`
+}
+
+func (s Skipped) String() string {
+	if s.Timestamp == 0 {
+		return fmt.Sprintf("%s: %s", s.Path, s.Reason)
+	}
+	return fmt.Sprintf("%s (block %d): %s", s.Path, s.Timestamp, s.Reason)
+}
+
+// Option configures an export
+type Option func(*exporter)
+
+// WithIfaces restricts the export to the given interfaces (defaults to all interfaces of the goDB)
+func WithIfaces(ifaces ...string) Option {
+	return func(e *exporter) {
+		e.ifaces = ifaces
+	}
+}
+
+// WithPermissions sets the permissions of the exported files
+func WithPermissions(permissions fs.FileMode) Option {
+	return func(e *exporter) {
+		e.permissions = permissions
+	}
+}
+
+// WithWorkers sets the number of directories exported in parallel (defaults to the number of CPUs)
+func WithWorkers(n int) Option {
+	return func(e *exporter) {
+		if n > 0 {
+			e.workers = n
+		}
+	}
+}
+
+type exporter struct {
+	dbPath      string
+	outPath     string
+	ifaces      []string
+	permissions fs.FileMode
+	workers     int
+
+	tags      info.TagRegistry
+	processes map[uint32]string
+
+	report Report
+	sync.Mutex
+}
+
+// dirJob denotes a (daily) directory of the goDB to export
+type dirJob struct {
+	iface     string
+	relPath   string // relPath denotes the path relative to the goDB (including the metadata suffix)
+	timestamp int64
+	suffix    string
+}
+
+// Run exports all directories of the goDB located at dbPath to partitioned Parquet files below outPath
+// and returns a report of the export. Existing files are replaced. Cancelling the context stops the
+// export after the directories currently being exported (returning the partial report)
+func Run(ctx context.Context, dbPath, outPath string, opts ...Option) (*Report, error) {
+	e := &exporter{
+		dbPath:      filepath.Clean(dbPath),
+		outPath:     filepath.Clean(outPath),
+		permissions: goDB.DefaultPermissions,
+		workers:     runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.report.Path, e.report.Out = e.dbPath, e.outPath
+
+	if rel, err := filepath.Rel(e.dbPath, e.outPath); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("output directory %s must not be located inside the DB", e.outPath)
+	}
+
+	var err error
+	if e.tags, err = info.ReadTagRegistry(e.dbPath); err != nil {
+		return nil, fmt.Errorf("failed to read flow tags: %w", err)
+	}
+	processes, err := info.ReadProcessRegistry(e.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process labels: %w", err)
+	}
+	e.processes = processes.Labels()
+
+	jobs, err := e.listDirs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directories: %w", err)
+	}
+	e.report.NumDirs = len(jobs)
+
+	if err := e.exportDirs(ctx, jobs); err != nil {
+		return &e.report, err
+	}
+
+	slices.SortFunc(e.report.Skipped, func(a, b Skipped) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+
+	return &e.report, nil
+}
+
+// FilePath returns the path of the file a directory of an interface is exported to (relative to the
+// output directory)
+func FilePath(iface string, timestamp int64) string {
+	return filepath.Join(
+		"iface="+iface,
+		"date="+time.Unix(timestamp, 0).UTC().Format(partitionDateFormat),
+		"part-"+strconv.FormatInt(timestamp, 10)+FileSuffix,
+	)
+}
+
+func (e *exporter) exportDirs(ctx context.Context, jobs []dirJob) error {
+	var (
+		jobChan  = make(chan dirJob)
+		errChan  = make(chan error, e.workers)
+		wg       sync.WaitGroup
+		firstErr error
+	)
+
+	for i := 0; i < e.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				if err := e.exportDir(job); err != nil {
+					errChan <- fmt.Errorf("failed to export directory %s: %w", job.relPath, err)
+					return
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, job := range jobs {
+		select {
+		case jobChan <- job:
+		case firstErr = <-errChan:
+			break dispatch
+		case <-ctx.Done():
+			firstErr = ctx.Err()
+			break dispatch
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+
+	if firstErr == nil {
+		select {
+		case firstErr = <-errChan:
+		default:
+		}
+	}
+	return firstErr
+}
+
+// exportDir converts a single directory into a Parquet file. Directories which cannot be opened and
+// inconsistent blocks are skipped (and reported), errors are only returned if writing the file fails
+func (e *exporter) exportDir(job dirJob) error {
+	var skipped []Skipped
+
+	gpDir := gpfile.NewDirReader(filepath.Join(e.dbPath, job.iface), job.timestamp, job.suffix)
+	if err := gpDir.Open(); err != nil {
+		e.Lock()
+		e.report.Skipped = append(e.report.Skipped, Skipped{Path: job.relPath, Reason: fmt.Sprintf("failed to open directory: %s", err)})
+		e.Unlock()
+		return nil
+	}
+	defer gpDir.Close()
+
+	path := filepath.Join(e.outPath, FilePath(job.iface, job.timestamp))
+	// #nosec G301
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// the file is written to a temporary location first, replacing any previous export atomically
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	w := parquet.NewWriter(tempFile, columns)
+	w.SetMetadata(metadataPrefix+types.IfaceName, job.iface)
+	if origin, err := gpDir.Origin(); err == nil && origin != nil {
+		if origin.Hostname != "" {
+			w.SetMetadata(metadataPrefix+types.HostnameName, origin.Hostname)
+		}
+		if origin.HostID != "" {
+			w.SetMetadata(metadataPrefix+types.HostIDName, origin.HostID)
+		}
+	}
+
+	nBlocks := gpDir.NBlocks()
+	for blockIdx := 0; blockIdx < nBlocks; blockIdx++ {
+		timestamp := gpDir.BlockMetadata[types.SIPColIdx].BlockList[blockIdx].Timestamp
+		entries, err := inspect.DumpBlock(gpDir, timestamp)
+		if err != nil {
+			skipped = append(skipped, Skipped{Path: job.relPath, Timestamp: timestamp, Reason: err.Error()})
+			continue
+		}
+		for _, entry := range entries {
+			if err := w.WriteRow(e.row(timestamp, entry)...); err != nil {
+				return err
+			}
+		}
+	}
+	numRows := w.NumRows()
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := tempFile.Chmod(e.permissions); err != nil {
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.report.NumBlocks += nBlocks
+	e.report.NumFiles++
+	e.report.NumRows += numRows
+	e.report.Skipped = append(e.report.Skipped, skipped...)
+	return nil
+}
+
+// row returns the values of the columns of an entry of the block at the given timestamp
+func (e *exporter) row(timestamp int64, entry inspect.Entry) []any {
+	var process string
+	if entry.ProcessID != 0 {
+		process = e.processes[uint32(entry.ProcessID)] // #nosec G115
+	}
+
+	return []any{
+		time.Unix(timestamp, 0),
+		entry.SrcIP.String(),
+		entry.DstIP.String(),
+		entry.DstPort,
+		entry.IPProto,
+		entry.Counters.BytesRcvd,
+		entry.Counters.BytesSent,
+		entry.Counters.PacketsRcvd,
+		entry.Counters.PacketsSent,
+		e.tags.Label(entry.Tags),
+		process,
+		uint16(entry.VLAN), // #nosec G115
+		entry.SrcMAC,
+		entry.DstMAC,
+		entry.TCPFlags,
+		entry.DSCP,
+	}
+}
+
+// listDirs returns all (daily) directories of the interfaces to export (in chronological order per
+// interface)
+func (e *exporter) listDirs() ([]dirJob, error) {
+	ifaces := e.ifaces
+	if len(ifaces) == 0 {
+		var err error
+		if ifaces, err = info.GetInterfaces(e.dbPath); err != nil {
+			return nil, err
+		}
+	}
+	e.report.NumIfaces = len(ifaces)
+
+	var jobs []dirJob
+	for _, iface := range ifaces {
+		dayPaths, err := filepath.Glob(filepath.Join(e.dbPath, iface, "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, dayPath := range dayPaths {
+			timestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dayPath))
+			if err != nil {
+				continue
+			}
+			relPath, err := filepath.Rel(e.dbPath, dayPath)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, dirJob{
+				iface:     iface,
+				relPath:   relPath,
+				timestamp: timestamp,
+				suffix:    suffix,
+			})
+		}
+	}
+	return jobs, nil
+}
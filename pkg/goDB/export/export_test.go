@@ -0,0 +1,108 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTimestamp = int64(1700000000)
+	testInterval  = int64(300)
+	testBlocks    = 4
+
+	// number of flows per directory (each block i holding i+1 flows)
+	testRowsPerDir = testBlocks * (testBlocks + 1) / 2
+)
+
+func TestExport(t *testing.T) {
+	dbPath, outPath := t.TempDir(), t.TempDir()
+	writeTestDB(t, dbPath)
+
+	// the output must reside outside of the DB
+	_, err := Run(context.Background(), dbPath, filepath.Join(dbPath, "export"))
+	require.NotNil(t, err)
+
+	report, err := Run(context.Background(), dbPath, outPath)
+	require.Nil(t, err)
+	require.Equal(t, 2, report.NumIfaces)
+	require.Equal(t, 3, report.NumDirs)
+	require.Equal(t, 3, report.NumFiles)
+	require.Equal(t, 3*testBlocks, report.NumBlocks)
+	require.Equal(t, 3*testRowsPerDir, report.NumRows)
+	require.Empty(t, report.Skipped)
+
+	dirTimestamp := testTimestamp - testTimestamp%gpfile.EpochDay
+	for _, path := range []string{
+		FilePath("eth0", dirTimestamp),
+		FilePath("eth0", dirTimestamp+gpfile.EpochDay),
+		FilePath("eth1", dirTimestamp),
+	} {
+		data, err := os.ReadFile(filepath.Join(outPath, path))
+		require.Nil(t, err)
+		require.Equal(t, "PAR1", string(data[:4]))
+		require.Equal(t, "PAR1", string(data[len(data)-4:]))
+		require.True(t, bytes.Contains(data, []byte("goprobe.iface")))
+	}
+	require.Equal(t, filepath.Join("iface=eth0", "date=2023-11-14", "part-1699920000.parquet"), FilePath("eth0", dirTimestamp))
+
+	// the export is restricted to the requested interfaces, inconsistent blocks are skipped
+	eth1Dirs, err := filepath.Glob(filepath.Join(dbPath, "eth1", "*", "*", "*"))
+	require.Nil(t, err)
+	require.Len(t, eth1Dirs, 1)
+	dportPath := filepath.Join(eth1Dirs[0], types.ColumnFileNames[types.DportColIdx]+gpfile.FileSuffix)
+	stat, err := os.Stat(dportPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(dportPath, stat.Size()-1))
+
+	report, err = Run(context.Background(), dbPath, outPath, WithIfaces("eth1"), WithWorkers(1))
+	require.Nil(t, err)
+	require.Equal(t, 1, report.NumFiles)
+	require.Equal(t, testRowsPerDir-testBlocks, report.NumRows)
+	require.Len(t, report.Skipped, 1)
+	require.Equal(t, testTimestamp+(testBlocks-1)*testInterval, report.Skipped[0].Timestamp)
+
+	// directories which cannot be opened are skipped as a whole
+	require.Nil(t, os.WriteFile(filepath.Join(eth1Dirs[0], gpfile.MetadataFileName), []byte("corrupt"), 0600))
+	require.Nil(t, os.Remove(filepath.Join(eth1Dirs[0], gpfile.MetadataFileName+gpfile.MetadataPrevFileSuffix)))
+	report, err = Run(context.Background(), dbPath, outPath, WithIfaces("eth1"))
+	require.Nil(t, err)
+	require.Zero(t, report.NumFiles)
+	require.Len(t, report.Skipped, 1)
+	require.Zero(t, report.Skipped[0].Timestamp)
+}
+
+// writeTestDB writes two days of testBlocks blocks for eth0 and a single one for eth1
+func writeTestDB(t *testing.T, dbPath string) {
+	t.Helper()
+
+	for iface, days := range map[string]int64{"eth0": 2, "eth1": 1} {
+		w := goDB.NewDBWriter(dbPath, iface, encoders.EncoderTypeLZ4)
+		for day := int64(0); day < days; day++ {
+			for i := int64(0); i < testBlocks; i++ {
+				require.Nil(t, w.Write(testFlows(byte(i)), capturetypes.CaptureStats{}, testTimestamp+day*gpfile.EpochDay+i*testInterval))
+			}
+		}
+	}
+}
+
+func testFlows(n byte) *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	for i := byte(0); i <= n; i++ {
+		m.PrimaryMap.Set(types.NewV4KeyStatic(
+			[4]byte{10, 0, 0, i},
+			[4]byte{10, 0, 1, i},
+			[]byte{1, 187}, 6), types.Counters{BytesRcvd: uint64(i) + 1, PacketsRcvd: 1})
+	}
+	return m
+}
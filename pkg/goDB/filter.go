@@ -1,6 +1,7 @@
 package goDB
 
 import (
+	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
 )
 
@@ -9,11 +10,17 @@ import (
 type FilterFn func(*hashmap.AggFlowMap) *hashmap.AggFlowMap
 
 // QueryFilter returns a FilterFn that applies a query condition to an existing AggFlowMap
+// (and buckets the destination ports into their port classes, if required by the query)
 func QueryFilter(query *Query) FilterFn {
 	return func(input *hashmap.AggFlowMap) (result *hashmap.AggFlowMap) {
 
-		// If there is no condition, return the input map as is
-		if query.Conditional == nil {
+		// Flows are only tagged during writeout, hence in-memory flows can never satisfy a tag filter
+		if query.tagMask != 0 {
+			return hashmap.NewAggFlowMap()
+		}
+
+		// If there is no condition and no port classification, return the input map as is
+		if query.Conditional == nil && query.portClassKeys == nil {
 			return input
 		}
 
@@ -21,8 +28,8 @@ func QueryFilter(query *Query) FilterFn {
 
 		// Loop over primary (IPv4) entries
 		for it := input.PrimaryMap.Iter(); it.Next(); {
-			if conditionalSatisfied := query.Conditional.Evaluate(it.Key()); conditionalSatisfied {
-				result.PrimaryMap.SetOrUpdate(it.Key(),
+			if query.Conditional == nil || query.Conditional.Evaluate(it.Key()) {
+				result.PrimaryMap.SetOrUpdate(query.classifyKey(it.Key()),
 					it.Val().BytesRcvd,
 					it.Val().BytesSent,
 					it.Val().PacketsRcvd,
@@ -33,8 +40,8 @@ func QueryFilter(query *Query) FilterFn {
 
 		// Loop over primary (IPv6) entries
 		for it := input.SecondaryMap.Iter(); it.Next(); {
-			if conditionalSatisfied := query.Conditional.Evaluate(it.Key()); conditionalSatisfied {
-				result.SecondaryMap.SetOrUpdate(it.Key(),
+			if query.Conditional == nil || query.Conditional.Evaluate(it.Key()) {
+				result.SecondaryMap.SetOrUpdate(query.classifyKey(it.Key()),
 					it.Val().BytesRcvd,
 					it.Val().BytesSent,
 					it.Val().PacketsRcvd,
@@ -46,3 +53,31 @@ func QueryFilter(query *Query) FilterFn {
 		return
 	}
 }
+
+// classifyKey returns a copy of the key with the destination port replaced by its port class
+// (or the key itself if no port classification is required)
+func (q *Query) classifyKey(key types.Key) types.Key {
+	if q.portClassKeys == nil {
+		return key
+	}
+	classified := key.Clone()
+	classified.PutDport(q.classifyDport(key.GetDport()))
+	return classified
+}
+
+// KeyFilter returns a FilterFn that only retains the entry for a single flow key
+func KeyFilter(key types.Key) FilterFn {
+	return func(input *hashmap.AggFlowMap) (result *hashmap.AggFlowMap) {
+		result = hashmap.NewAggFlowMap()
+
+		m, resultMap := input.PrimaryMap, result.PrimaryMap
+		if !key.IsIPv4() {
+			m, resultMap = input.SecondaryMap, result.SecondaryMap
+		}
+		if val, exists := m.Get(key); exists {
+			resultMap.Set(key, val)
+		}
+
+		return
+	}
+}
@@ -0,0 +1,38 @@
+package goDB
+
+import (
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFilter(t *testing.T) {
+	flows := generateFlows()
+
+	t.Run("IPv4", func(t *testing.T) {
+		key := types.NewV4KeyStatic([4]byte{1, 1, 1, 1}, [4]byte{1, 1, 1, 1}, []byte{1, 1}, 1)
+		filtered := KeyFilter(key)(flows)
+		require.Equal(t, 1, filtered.PrimaryMap.Len())
+		require.Equal(t, 0, filtered.SecondaryMap.Len())
+
+		val, exists := filtered.PrimaryMap.Get(key)
+		require.True(t, exists)
+		require.Equal(t, hashmap.Val{BytesRcvd: 1, PacketsRcvd: 1}, val)
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		ip := [16]byte{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
+		key := types.NewV6KeyStatic(ip, ip, []byte{2, 2}, 2)
+		filtered := KeyFilter(key)(flows)
+		require.Equal(t, 0, filtered.PrimaryMap.Len())
+		require.Equal(t, 1, filtered.SecondaryMap.Len())
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		key := types.NewV4KeyStatic([4]byte{1, 1, 1, 1}, [4]byte{1, 1, 1, 1}, []byte{1, 1}, 17)
+		filtered := KeyFilter(key)(flows)
+		require.Equal(t, 0, filtered.PrimaryMap.Len()+filtered.SecondaryMap.Len())
+	})
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
 	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
 	"github.com/els0r/goProbe/pkg/types"
 	"github.com/els0r/goProbe/pkg/types/hashmap"
@@ -138,11 +143,11 @@ func populateTestDir(t *testing.T, basePath, iface string, timestamp time.Time)
 	f := gpfile.NewDirWriter(testPath, timestamp.Unix())
 	require.Nil(t, f.Open())
 
-	data, update := dbData(generateFlows())
+	data, deltaPacked, update, _ := dbData(generateFlows(), nil, nil, capturetypes.FlowAttributes{})
 	require.Nil(t, f.WriteBlocks(timestamp.Unix()+300, gpfile.TrafficMetadata{
 		NumV4Entries: update.Traffic.NumV4Entries,
 		NumV6Entries: update.Traffic.NumV6Entries,
-	}, update.Counts, data))
+	}, gpfile.BlockOrderSorted, update.Counts, data, deltaPacked...))
 	require.Nil(t, f.Close())
 }
 
@@ -224,3 +229,145 @@ func testWorkload(t *testing.T, c testCase, dryRun bool) {
 		}
 	}
 }
+
+func TestIPFilterPruning(t *testing.T) {
+	testPath := t.TempDir()
+	require.Nil(t, os.Mkdir(filepath.Join(testPath, "eth0"), 0700))
+
+	nDays := 3
+	for day := 1; day <= nDays; day++ {
+		populateTestDir(t, testPath, "eth0", time.Date(2000, time.January, day, 0, 0, 0, 0, time.UTC))
+	}
+
+	var tests = []struct {
+		conditional    string
+		expectedPruned uint64
+	}{
+		{"host = 5.5.5.5", 0},
+		{"sip = 5.5.5.5 | dip = 200.200.200.200", 0},
+		{"dport = 443", 0},
+		{"host = 200.200.200.200", uint64(nDays)},
+		{"sip = 200.200.200.200 & dport = 443", uint64(nDays)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.conditional, func(t *testing.T) {
+			conditional, _, err := node.ParseAndInstrument(test.conditional, 0)
+			require.Nil(t, err)
+
+			workMgr, err := NewDBWorkManager(NewQuery([]types.Attribute{
+				types.SIPAttribute{},
+				types.DIPAttribute{}}, conditional, types.LabelSelector{}), testPath, "eth0", 1)
+			require.Nil(t, err)
+
+			nonempty, err := workMgr.CreateWorkerJobs(
+				time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Unix(),
+				time.Date(2000, time.January, 31, 0, 0, 0, 0, time.UTC).Unix(),
+			)
+			require.Nil(t, err)
+			require.True(t, nonempty)
+			require.Equal(t, test.expectedPruned, workMgr.Pruned())
+
+			var numDirs int
+			for i := uint64(0); i < workMgr.nWorkloads; i++ {
+				workload := <-workMgr.workloadChan
+				numDirs += len(workload.WorkDirs())
+			}
+			require.Equal(t, nDays-int(test.expectedPruned), numDirs)
+		})
+	}
+}
+
+func TestReadIPIndices(t *testing.T) {
+	testPath := t.TempDir()
+	require.Nil(t, os.Mkdir(filepath.Join(testPath, "eth0"), 0700))
+
+	nDays := 3
+	for day := 1; day <= nDays; day++ {
+		populateTestDir(t, testPath, "eth0", time.Date(2000, time.January, day, 0, 0, 0, 0, time.UTC))
+	}
+
+	indices, err := ReadIPIndices(testPath, []string{"eth0", "eth1"},
+		time.Date(2000, time.January, 2, 0, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2000, time.January, 31, 0, 0, 0, 0, time.UTC).Unix(),
+	)
+	require.Nil(t, err)
+	require.Len(t, indices, nDays-1)
+
+	for i, index := range indices {
+		require.Equal(t, "eth0", index.Iface)
+		require.Equal(t, time.Date(2000, time.January, i+2, 0, 0, 0, 0, time.UTC).Unix(), index.Day.Unix())
+		require.NotNil(t, index.Index)
+		require.Equal(t, testNv4+testNv6, index.Index.Len())
+		require.True(t, index.Index.Contains(netip.MustParseAddr("5.5.5.5")))
+		require.False(t, index.Index.Contains(netip.MustParseAddr("200.200.200.200")))
+	}
+}
+
+func TestSortedBlockEvaluation(t *testing.T) {
+	m := hashmap.NewAggFlowMap()
+	protos, dports := []byte{1, 6, 17}, [][]byte{{0, 53}, {0, 80}, {1, 187}, {31, 144}}
+	for i := byte(0); i < 240; i++ {
+		proto, dport := protos[i%3], dports[i%4]
+		m.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, i % 5, i % 7}, [4]byte{10, 1, 0, i}, dport, proto),
+			types.Counters{BytesRcvd: uint64(i), PacketsRcvd: 1})
+		m.SecondaryMap.Set(types.NewV6KeyStatic([16]byte{0x20, 0x01, 15: i % 5}, [16]byte{0x20, 0x02, 15: i}, dport, proto),
+			types.Counters{BytesSent: uint64(i), PacketsSent: 1})
+	}
+	data, deltaPacked, update, _ := dbData(m, nil, nil, capturetypes.FlowAttributes{})
+	unpack := func(colIdx types.ColumnIndex) []uint64 {
+		return deltapack.Unpack(data[colIdx], slices.Contains(deltaPacked, colIdx))
+	}
+
+	var tests = []string{
+		"proto = tcp",
+		"proto = udp | proto = icmp",
+		"proto = tcp & dport = 443",
+		"proto = udp & (dport = 53 | dport = 8080)",
+		"proto = tcp & dport = 80 & sip = 10.0.1.3",
+		"proto = tcp & dport = 80 & (sip = 10.0.1.3 | sip = 2001::1)",
+		"proto = udp & dport = 53 & sip = 10.0.2.2 & dip = 10.1.0.17",
+		"proto = tcp & sip = 2001::4",
+		"(proto = tcp & dport = 443) | (proto = udp & dport = 53)",
+		"proto = tcp & dport != 443",
+		"proto = 47",
+	}
+	for _, conditional := range tests {
+		t.Run(conditional, func(t *testing.T) {
+			cond, _, err := node.ParseAndInstrument(conditional, 0)
+			require.Nil(t, err)
+			query := NewQuery([]types.Attribute{
+				types.SIPAttribute{},
+				types.DIPAttribute{},
+				types.DportAttribute{},
+				types.ProtoAttribute{}}, cond, types.LabelSelector{})
+			require.True(t, query.narrowsEntries())
+
+			evaluate := func(sorted bool) (hashmap.List, hashmap.List) {
+				cols := blockColumns{
+					numEntries:   int(update.Traffic.NumFlows()),
+					numV4Entries: int(update.Traffic.NumV4Entries),
+					sorted:       sorted,
+					sip:          data[types.SIPColIdx],
+					dip:          data[types.DIPColIdx],
+					dport:        data[types.DportColIdx],
+					proto:        data[types.ProtoColIdx],
+					bytesRcvd:    unpack(types.BytesRcvdColIdx),
+					bytesSent:    unpack(types.BytesSentColIdx),
+					pktsRcvd:     unpack(types.PacketsRcvdColIdx),
+					pktsSent:     unpack(types.PacketsSentColIdx),
+				}
+				resultMap := hashmap.NewAggFlowMapWithMetadata()
+				evaluateBlock(query, &cols, &resultMap)
+				v4, v6 := resultMap.Flatten()
+				return v4.Sort(), v6.Sort()
+			}
+
+			// narrowing down the entries of a sorted block must not change the result of a full scan
+			v4, v6 := evaluate(true)
+			v4Scan, v6Scan := evaluate(false)
+			require.Equal(t, v4Scan, v4)
+			require.Equal(t, v6Scan, v6)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package info
+
+// Bases the traffic volume of an interface can be accounted on
+const (
+	ByteAccountingL2   = "l2"   // ByteAccountingL2 : frames including the link-layer header (as seen by the kernel)
+	ByteAccountingL3   = "l3"   // ByteAccountingL3 : IP packets only (excluding the link-layer header)
+	ByteAccountingWire = "wire" // ByteAccountingWire : frames including the frame check sequence and VLAN tags
+)
+
+// ByteAccounting maps interfaces to the basis their traffic volume is accounted on
+type ByteAccounting map[string]string
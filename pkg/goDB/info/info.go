@@ -7,6 +7,11 @@ import (
 	"os"
 )
 
+// LabelFileNames lists the files stored at the root of a goDB which resolve the labels of the data
+// (e.g. the names of flow tags). All of them are replaced atomically and only ever grow, so they
+// can be copied as is (e.g. along with a snapshot or conversion of the data)
+var LabelFileNames = []string{ZonesFileName, TagsFileName, ProcessesFileName}
+
 // CheckDBExists will return nil if a DB at path exists and otherwise the error encountered
 func CheckDBExists(path string) error {
 	if path == "" {
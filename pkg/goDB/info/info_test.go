@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
 	"github.com/stretchr/testify/require"
 )
 
@@ -108,3 +109,119 @@ func TestDBExists(t *testing.T) {
 	require.ErrorIs(t, CheckDBExists("/hjgfkjagdjhkad/kjagsduasgdjasg"), fs.ErrNotExist)
 	require.EqualError(t, CheckDBExists("/hjgfkjagdjhkad/kjagsduasgdjasg"), "database directory does not exist: stat /hjgfkjagdjhkad/kjagsduasgdjasg: no such file or directory")
 }
+
+func TestZones(t *testing.T) {
+	dbPath := t.TempDir()
+
+	zones, err := ReadZones(dbPath)
+	require.Nil(t, err)
+	require.Empty(t, zones)
+
+	require.Nil(t, Zones{"eth0": "external", "eth1": "internal", "eth2": "external"}.Write(dbPath, 0644))
+	zones, err = ReadZones(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, "internal", zones.Zone("eth1"))
+	require.Empty(t, zones.Zone("eth3"))
+	require.Equal(t, []string{"eth0", "eth2"}, zones.Filter([]string{"eth0", "eth1", "eth2", "eth3"}, "external"))
+	require.Equal(t, []string{"eth0", "eth1"}, zones.Filter([]string{"eth0", "eth1", "eth3"}, "external", "internal"))
+
+	// the zones file is not considered to be an interface
+	ifaces, err := GetInterfaces(dbPath)
+	require.Nil(t, err)
+	require.Empty(t, ifaces)
+
+	// removing all tags removes the file
+	require.Nil(t, Zones{}.Write(dbPath, 0644))
+	_, err = os.Stat(filepath.Join(dbPath, ZonesFileName))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestTagRegistry(t *testing.T) {
+	dbPath := t.TempDir()
+
+	registry, err := ReadTagRegistry(dbPath)
+	require.Nil(t, err)
+	require.Empty(t, registry)
+
+	for i, name := range []string{"voip", "web", "voip", "dns"} {
+		bit, err := registry.Register(name)
+		require.Nil(t, err)
+		require.Equal(t, []int{0, 1, 0, 2}[i], bit)
+	}
+	require.Nil(t, registry.Write(dbPath, 0644))
+
+	// tags retain their bits across restarts, even if they are no longer configured
+	registry, err = ReadTagRegistry(dbPath)
+	require.Nil(t, err)
+	bit, err := registry.Register("ssh")
+	require.Nil(t, err)
+	require.Equal(t, 3, bit)
+	bit, err = registry.Register("dns")
+	require.Nil(t, err)
+	require.Equal(t, 2, bit)
+
+	require.Equal(t, uint64(0b101), registry.Mask("voip", "dns", "unknown"))
+	require.Zero(t, registry.Mask("unknown"))
+	require.Equal(t, []string{"voip", "dns"}, registry.Names(0b101))
+	require.Equal(t, "web,ssh", registry.Label(0b1010))
+	require.Empty(t, registry.Label(0))
+
+	// the number of tags is limited by the width of the bitmap
+	for i := len(registry); i < MaxTags; i++ {
+		_, err := registry.Register(fmt.Sprintf("tag%d", i))
+		require.Nil(t, err)
+	}
+	_, err = registry.Register("overflow")
+	require.ErrorIs(t, err, ErrTooManyTags)
+	require.Equal(t, fmt.Sprintf("tag%d", MaxTags-1), registry.Label(1<<(MaxTags-1)))
+}
+
+func TestProcessRegistry(t *testing.T) {
+	dbPath := t.TempDir()
+
+	registry, err := ReadProcessRegistry(dbPath)
+	require.Nil(t, err)
+	require.Empty(t, registry)
+
+	for i, label := range []string{"sshd", "nginx (/system.slice/nginx.service)", "sshd"} {
+		id, added, err := registry.Register(label)
+		require.Nil(t, err)
+		require.Equal(t, []uint32{1, 2, 1}[i], id)
+		require.Equal(t, i < 2, added)
+	}
+	require.Nil(t, registry.Write(dbPath, 0644))
+
+	// labels retain their IDs across restarts
+	registry, err = ReadProcessRegistry(dbPath)
+	require.Nil(t, err)
+	id, added, err := registry.Register("chronyd")
+	require.Nil(t, err)
+	require.True(t, added)
+	require.Equal(t, uint32(3), id)
+
+	labels := registry.Labels()
+	require.Equal(t, "nginx (/system.slice/nginx.service)", labels[2])
+	require.Empty(t, labels[0])
+}
+
+func TestManifestFormatVersion(t *testing.T) {
+	dbPath := t.TempDir()
+
+	// a missing manifest (or one predating the format version) does not constitute an incompatibility
+	require.Nil(t, CheckFormatVersion(dbPath))
+	m := NewManifest()
+	require.Nil(t, m.Write(dbPath, 0644))
+	require.Nil(t, CheckFormatVersion(dbPath))
+
+	// the format version is never lowered
+	m.UpdateFormatVersion(gpfile.HeaderVersion)
+	m.UpdateFormatVersion(gpfile.MinHeaderVersion)
+	require.Equal(t, uint64(gpfile.HeaderVersion), m.FormatVersion)
+	require.Nil(t, m.Write(dbPath, 0644))
+	require.Nil(t, CheckFormatVersion(dbPath))
+
+	// data written by a newer release is rejected
+	m.UpdateFormatVersion(gpfile.HeaderVersion + 1)
+	require.Nil(t, m.Write(dbPath, 0644))
+	require.ErrorIs(t, CheckFormatVersion(dbPath), ErrIncompatibleFormat)
+}
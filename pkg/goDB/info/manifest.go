@@ -0,0 +1,308 @@
+package info
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+	"github.com/els0r/goProbe/pkg/version"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ManifestFileName denotes the name of the manifest file stored at the root of a goDB
+const ManifestFileName = "manifest.json"
+
+var (
+	// ErrManifestMissing denotes that a goDB does not (yet) contain a manifest
+	ErrManifestMissing = errors.New("manifest missing")
+
+	// ErrIncompatibleFormat denotes that a goDB contains data in a format not supported by this release
+	ErrIncompatibleFormat = errors.New("incompatible goDB format version")
+)
+
+// Manifest provides a machine-readable summary of the contents of a goDB. It is
+// meant to be consumed by external tools (e.g. backup / cataloging solutions) which
+// require knowledge about a DB's content without having to walk all its directories
+type Manifest struct {
+	// Version: the version of the software which last updated the manifest
+	Version string `json:"version" doc:"Version of the software which last updated the manifest" example:"4.0.0-824f5847"`
+	// UpdatedAt: the time of the last update of the manifest
+	UpdatedAt time.Time `json:"updated_at" doc:"Time of the last update of the manifest" example:"2024-04-12T09:47:00+02:00"`
+	// FormatVersion: the latest metadata format version of any directory stored in the DB (zero if
+	// the manifest was written by a release predating the field)
+	FormatVersion uint64 `json:"format_version,omitempty" doc:"Latest metadata format version of any directory stored in the DB" example:"4"`
+	// SizeBytes: the total size of all data blocks stored in the DB
+	SizeBytes uint64 `json:"size_bytes" doc:"Total size of all data blocks stored in the DB (in bytes)" example:"1048576"`
+	// Interfaces: the manifest of each interface stored in the DB
+	Interfaces map[string]*InterfaceManifest `json:"interfaces" doc:"Manifest of each interface stored in the DB"`
+
+	mu sync.Mutex
+}
+
+// InterfaceManifest summarizes the data available for a single interface
+type InterfaceManifest struct {
+	// First: the timestamp of the first block stored for the interface
+	First time.Time `json:"first" doc:"Timestamp of the first block stored for the interface" example:"2024-04-12T00:05:00+02:00"`
+	// Last: the timestamp of the last block stored for the interface
+	Last time.Time `json:"last" doc:"Timestamp of the last block stored for the interface" example:"2024-04-13T00:00:00+02:00"`
+	// Encoders: the encoder types used for the blocks of the interface
+	Encoders []string `json:"encoders" doc:"Encoder types used for the blocks of the interface" example:"lz4,zstd"`
+	// SizeBytes: the total size of all data blocks stored for the interface
+	SizeBytes uint64 `json:"size_bytes" doc:"Total size of all data blocks stored for the interface (in bytes)" example:"524288"`
+}
+
+// NewManifest creates a new, empty manifest
+func NewManifest() *Manifest {
+	return &Manifest{
+		Version:    version.Short(),
+		Interfaces: make(map[string]*InterfaceManifest),
+	}
+}
+
+// ReadManifest reads the manifest stored at the root of the goDB at dbPath
+func ReadManifest(dbPath string) (*Manifest, error) {
+	f, err := os.Open(filepath.Clean(filepath.Join(dbPath, ManifestFileName)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %w", ErrManifestMissing, err)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	m := NewManifest()
+	if err := jsoniter.NewDecoder(f).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Interfaces == nil {
+		m.Interfaces = make(map[string]*InterfaceManifest)
+	}
+	return m, nil
+}
+
+// ReadOrBuildManifest reads the manifest stored at the root of the goDB at dbPath. If
+// none exists, it is generated from the DB contents
+func ReadOrBuildManifest(dbPath string) (*Manifest, error) {
+	m, err := ReadManifest(dbPath)
+	if err == nil {
+		return m, nil
+	}
+	if !errors.Is(err, ErrManifestMissing) {
+		return nil, err
+	}
+	return BuildManifest(dbPath)
+}
+
+// BuildManifest generates a manifest by walking all directories of the goDB at dbPath
+func BuildManifest(dbPath string) (*Manifest, error) {
+	ifaces, err := GetInterfaces(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewManifest()
+	for _, iface := range ifaces {
+		if err := m.addIface(filepath.Join(dbPath, iface), iface); err != nil {
+			return nil, fmt.Errorf("failed to build manifest for interface %s: %w", iface, err)
+		}
+	}
+	m.UpdatedAt = time.Now()
+
+	return m, nil
+}
+
+func (m *Manifest) addIface(ifacePath, iface string) error {
+	years, err := os.ReadDir(ifacePath)
+	if err != nil {
+		return err
+	}
+	for _, year := range years {
+		if !year.IsDir() {
+			continue
+		}
+		months, err := os.ReadDir(filepath.Join(ifacePath, year.Name()))
+		if err != nil {
+			return err
+		}
+		for _, month := range months {
+			if !month.IsDir() {
+				continue
+			}
+			days, err := os.ReadDir(filepath.Join(ifacePath, year.Name(), month.Name()))
+			if err != nil {
+				return err
+			}
+			for _, day := range days {
+				if !day.IsDir() {
+					continue
+				}
+				dayTimestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(day.Name())
+				if err != nil {
+					continue
+				}
+				if err := m.addDir(gpfile.NewDirReader(ifacePath, dayTimestamp, suffix), iface); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) addDir(dir *gpfile.GPDir, iface string) error {
+	if err := dir.Open(); err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if dir.NBlocks() == 0 {
+		return nil
+	}
+	m.FormatVersion = max(m.FormatVersion, dir.Version)
+
+	for i := types.ColumnIndex(0); i < types.ColIdxCount; i++ {
+		for _, block := range dir.BlockMetadata[i].Blocks() {
+			m.update(iface, block.Timestamp, block.EncoderType, uint64(block.Len))
+		}
+	}
+
+	return nil
+}
+
+// Rebuild regenerates the manifest of the provided interfaces from the contents of the goDB
+// at dbPath (e.g. after data has been removed). Interfaces without any remaining data are
+// removed from the manifest
+func (m *Manifest) Rebuild(dbPath string, ifaces ...string) error {
+	rebuilt := NewManifest()
+	for _, iface := range ifaces {
+		if err := rebuilt.addIface(filepath.Join(dbPath, iface), iface); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to rebuild manifest for interface %s: %w", iface, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, iface := range ifaces {
+		if im, exists := m.Interfaces[iface]; exists {
+			m.SizeBytes -= im.SizeBytes
+			delete(m.Interfaces, iface)
+		}
+		if im, exists := rebuilt.Interfaces[iface]; exists {
+			m.SizeBytes += im.SizeBytes
+			m.Interfaces[iface] = im
+		}
+	}
+
+	// the format version can only be determined across all interfaces, hence it is never lowered here
+	m.FormatVersion = max(m.FormatVersion, rebuilt.FormatVersion)
+	m.Version = version.Short()
+	m.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// Update registers a write of size bytes with the given encoder type at timestamp for an interface
+func (m *Manifest) Update(iface string, timestamp int64, encoderType encoders.Type, size uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.update(iface, timestamp, encoderType, size)
+	m.Version = version.Short()
+	m.UpdatedAt = time.Now()
+}
+
+// IfacesSize returns the total size of all data blocks stored for the provided interfaces
+func (m *Manifest) IfacesSize(ifaces ...string) (size uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, iface := range ifaces {
+		if im, exists := m.Interfaces[iface]; exists {
+			size += im.SizeBytes
+		}
+	}
+	return size
+}
+
+// UpdateFormatVersion registers a write of a directory's metadata in the given format version
+func (m *Manifest) UpdateFormatVersion(formatVersion uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.FormatVersion = max(m.FormatVersion, formatVersion)
+}
+
+// CheckFormatVersion determines if all data of the goDB described by the manifest can be read by this
+// release, returning an error wrapping ErrIncompatibleFormat (naming the release which last updated the
+// manifest) otherwise. Manifests lacking a format version are assumed to be compatible
+func (m *Manifest) CheckFormatVersion() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.FormatVersion == 0 {
+		return nil
+	}
+	if gpfile.CheckHeaderVersion(m.FormatVersion) != nil {
+		return fmt.Errorf("%w: the goDB (last updated by release %s) contains data in format version %d, whereas this release (%s) supports versions %d to %d",
+			ErrIncompatibleFormat, m.Version, m.FormatVersion, version.Short(), gpfile.MinHeaderVersion, gpfile.HeaderVersion)
+	}
+	return nil
+}
+
+// CheckFormatVersion determines if all data of the goDB at dbPath can be read by this release based on
+// its manifest (c.f. Manifest.CheckFormatVersion). Since the manifest is informational, a missing or
+// unreadable manifest does not constitute an incompatibility
+func CheckFormatVersion(dbPath string) error {
+	m, err := ReadManifest(dbPath)
+	if err != nil {
+		return nil
+	}
+	return m.CheckFormatVersion()
+}
+
+func (m *Manifest) update(iface string, timestamp int64, encoderType encoders.Type, size uint64) {
+	ts := time.Unix(timestamp, 0)
+
+	im, exists := m.Interfaces[iface]
+	if !exists {
+		im = &InterfaceManifest{First: ts, Last: ts}
+		m.Interfaces[iface] = im
+	}
+	if ts.Before(im.First) {
+		im.First = ts
+	}
+	if ts.After(im.Last) {
+		im.Last = ts
+	}
+
+	// empty blocks are stored with the null encoder, so it is not tracked explicitly
+	if encoderType != encoders.EncoderTypeNull || size > 0 {
+		if name := encoderType.String(); !slices.Contains(im.Encoders, name) {
+			im.Encoders = append(im.Encoders, name)
+			slices.Sort(im.Encoders)
+		}
+	}
+
+	im.SizeBytes += size
+	m.SizeBytes += size
+}
+
+// Write atomically stores the manifest at the root of the goDB at dbPath
+func (m *Manifest) Write(dbPath string, permissions fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return fsutil.WriteFileAtomic(filepath.Join(dbPath, ManifestFileName), permissions, func(f *os.File) error {
+		return jsoniter.NewEncoder(f).Encode(m)
+	})
+}
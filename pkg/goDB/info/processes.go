@@ -0,0 +1,75 @@
+package info
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ProcessesFileName denotes the name of the file storing the registry of process labels at the root of a goDB
+const ProcessesFileName = "processes.json"
+
+// ErrTooManyProcesses denotes that no ID is left to register a process label
+var ErrTooManyProcesses = errors.New("maximum number of process labels exceeded")
+
+// ProcessRegistry maps the labels of the local processes flows were attributed to onto the ID representing
+// them in the process column. Like the registry of flow tags, it is append-only so that the data written
+// remains interpretable. The ID zero is reserved for flows which could not be attributed to any process
+type ProcessRegistry map[string]uint32
+
+// Register returns the ID of a process label, assigning the next free one if it is not yet registered. The
+// second result parameter indicates if the label was newly registered
+func (p ProcessRegistry) Register(label string) (uint32, bool, error) {
+	if id, exists := p[label]; exists {
+		return id, false, nil
+	}
+	if len(p) >= math.MaxUint32 {
+		return 0, false, fmt.Errorf("%w: %s", ErrTooManyProcesses, label)
+	}
+
+	id := uint32(len(p)) + 1
+	p[label] = id
+	return id, true, nil
+}
+
+// Labels returns the process labels indexed by their ID
+func (p ProcessRegistry) Labels() map[uint32]string {
+	labels := make(map[uint32]string, len(p))
+	for label, id := range p {
+		labels[id] = label
+	}
+	return labels
+}
+
+// ReadProcessRegistry reads the registry of process labels stored at the root of the goDB at dbPath. If none
+// is stored, an empty registry is returned
+func ReadProcessRegistry(dbPath string) (ProcessRegistry, error) {
+	f, err := os.Open(filepath.Clean(filepath.Join(dbPath, ProcessesFileName)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return make(ProcessRegistry), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	registry := make(ProcessRegistry)
+	if err := jsoniter.NewDecoder(f).Decode(&registry); err != nil {
+		return nil, fmt.Errorf("failed to decode process labels: %w", err)
+	}
+	return registry, nil
+}
+
+// Write atomically stores the registry of process labels at the root of the goDB at dbPath
+func (p ProcessRegistry) Write(dbPath string, permissions fs.FileMode) error {
+	return fsutil.WriteFileAtomic(filepath.Join(dbPath, ProcessesFileName), permissions, func(f *os.File) error {
+		return jsoniter.NewEncoder(f).Encode(p)
+	})
+}
@@ -0,0 +1,112 @@
+package info
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// TagsFileName denotes the name of the file storing the registry of flow tags at the root of a goDB
+	TagsFileName = "tags.json"
+
+	// MaxTags denotes the maximum number of flow tags that can be registered (one bit per tag in the
+	// bitmap stored in the tags column)
+	MaxTags = 64
+
+	// TagSep denotes the separator used when labeling flows carrying multiple tags
+	TagSep = ","
+)
+
+// ErrTooManyTags denotes that no bit is left to register a flow tag
+var ErrTooManyTags = fmt.Errorf("maximum number of flow tags (%d) exceeded", MaxTags)
+
+// TagRegistry maps the names of flow tags to the bit representing them in the tags column. The
+// registry is append-only: tags removed from the configuration retain their bit so that the data
+// written while they were active remains interpretable (and their bit is never reassigned)
+type TagRegistry map[string]int
+
+// Register returns the bit of a flow tag, assigning the next free one if it is not yet registered
+func (t TagRegistry) Register(name string) (int, error) {
+	if bit, exists := t[name]; exists {
+		return bit, nil
+	}
+	if len(t) >= MaxTags {
+		return 0, fmt.Errorf("%w: %s", ErrTooManyTags, name)
+	}
+
+	bit := len(t)
+	t[name] = bit
+	return bit, nil
+}
+
+// Mask returns the bitmap of all given flow tags, ignoring tags which are not registered
+func (t TagRegistry) Mask(names ...string) (mask uint64) {
+	for _, name := range names {
+		if bit, exists := t[name]; exists {
+			mask |= 1 << bit
+		}
+	}
+	return
+}
+
+// Names returns the names of all flow tags set in a bitmap (ordered by their bit)
+func (t TagRegistry) Names(bitmap uint64) []string {
+	if bitmap == 0 {
+		return nil
+	}
+
+	var byBit [MaxTags]string
+	for name, bit := range t {
+		if bit >= 0 && bit < MaxTags {
+			byBit[bit] = name
+		}
+	}
+
+	names := make([]string, 0, bits.OnesCount64(bitmap))
+	for ; bitmap != 0; bitmap &= bitmap - 1 {
+		if name := byBit[bits.TrailingZeros64(bitmap)]; name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Label returns the label of a bitmap of flow tags (the names of all tags set in it, separated by TagSep)
+func (t TagRegistry) Label(bitmap uint64) string {
+	return strings.Join(t.Names(bitmap), TagSep)
+}
+
+// ReadTagRegistry reads the registry of flow tags stored at the root of the goDB at dbPath. If none
+// is stored, an empty registry is returned
+func ReadTagRegistry(dbPath string) (TagRegistry, error) {
+	f, err := os.Open(filepath.Clean(filepath.Join(dbPath, TagsFileName)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return make(TagRegistry), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	registry := make(TagRegistry)
+	if err := jsoniter.NewDecoder(f).Decode(&registry); err != nil {
+		return nil, fmt.Errorf("failed to decode flow tags: %w", err)
+	}
+	return registry, nil
+}
+
+// Write atomically stores the registry of flow tags at the root of the goDB at dbPath
+func (t TagRegistry) Write(dbPath string, permissions fs.FileMode) error {
+	return fsutil.WriteFileAtomic(filepath.Join(dbPath, TagsFileName), permissions, func(f *os.File) error {
+		return jsoniter.NewEncoder(f).Encode(t)
+	})
+}
@@ -0,0 +1,75 @@
+package info
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ZonesFileName denotes the name of the file storing the network zones of the interfaces at the
+// root of a goDB
+const ZonesFileName = "zones.json"
+
+// Zones maps interfaces to the network zone (e.g. internal, external, dmz) they were tagged with
+type Zones map[string]string
+
+// Zone returns the network zone of an interface (or an empty string if it is not tagged)
+func (z Zones) Zone(iface string) string {
+	return z[iface]
+}
+
+// Filter returns those of the provided interfaces tagged with any of the given zones
+func (z Zones) Filter(ifaces []string, zones ...string) []string {
+	allowed := make(map[string]struct{}, len(zones))
+	for _, zone := range zones {
+		allowed[zone] = struct{}{}
+	}
+
+	var filtered []string
+	for _, iface := range ifaces {
+		if _, exists := allowed[z.Zone(iface)]; exists {
+			filtered = append(filtered, iface)
+		}
+	}
+	return filtered
+}
+
+// ReadZones reads the network zones of the interfaces stored at the root of the goDB at dbPath.
+// If none are stored, an empty set of zones is returned
+func ReadZones(dbPath string) (Zones, error) {
+	f, err := os.Open(filepath.Clean(filepath.Join(dbPath, ZonesFileName)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return make(Zones), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	zones := make(Zones)
+	if err := jsoniter.NewDecoder(f).Decode(&zones); err != nil {
+		return nil, fmt.Errorf("failed to decode interface zones: %w", err)
+	}
+	return zones, nil
+}
+
+// Write atomically stores the network zones of the interfaces at the root of the goDB at dbPath. If
+// no interface is tagged, a previously stored file is removed instead
+func (z Zones) Write(dbPath string, permissions fs.FileMode) error {
+	if len(z) == 0 {
+		if err := os.Remove(filepath.Join(dbPath, ZonesFileName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	return fsutil.WriteFileAtomic(filepath.Join(dbPath, ZonesFileName), permissions, func(f *os.File) error {
+		return jsoniter.NewEncoder(f).Encode(z)
+	})
+}
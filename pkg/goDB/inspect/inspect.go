@@ -0,0 +1,528 @@
+// Package inspect provides means to analyze the on-disk representation of a single goDB directory
+// (GPDir), e.g. to diagnose corrupted blocks or to assess the efficiency of the compression.
+//
+// All functions operate on a GPDir opened in read mode and never modify any data.
+package inspect
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/storage"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// zstdMagic denotes the magic number every ZSTD frame starts with (little endian). Note that blocks
+// encoded by the LZ4 encoder are stored in the raw LZ4 block format, which has no magic number (their
+// integrity is verified upon decoding)
+const zstdMagic = 0xfd2fb528
+
+// ErrBlockNotFound denotes that the GPDir does not hold a block for the requested timestamp
+var ErrBlockNotFound = errors.New("block not found")
+
+// Dir summarizes the metadata of a GPDir
+type Dir struct {
+	Path      string                 `json:"path"`
+	Timestamp int64                  `json:"timestamp"`
+	Version   uint64                 `json:"version"`
+	NumBlocks int                    `json:"num_blocks"`
+	Traffic   gpfile.TrafficMetadata `json:"traffic"`
+	Counts    types.Counters         `json:"counts"`
+	FlowSizes *FlowSizes             `json:"flow_sizes,omitempty"`
+	Columns   []Column               `json:"columns"`
+}
+
+// FlowSizes summarizes the histograms of the bytes and packets per flow of all blocks of a GPDir
+// covered by them (blocks written by older releases are not)
+type FlowSizes struct {
+	NumBlocks int `json:"num_blocks"`
+	gpfile.FlowSizes
+}
+
+// Column summarizes the blocks of a single column of a GPDir
+type Column struct {
+	Name    string  `json:"name"`
+	Size    uint64  `json:"size"`
+	RawSize uint64  `json:"raw_size"`
+	Blocks  []Block `json:"blocks"`
+}
+
+// Block summarizes a single block of a column
+type Block struct {
+	Timestamp    int64   `json:"timestamp"`
+	Offset       uint64  `json:"offset"`
+	Len          uint32  `json:"len"`
+	RawLen       uint32  `json:"raw_len"`
+	Encoder      string  `json:"encoder"`
+	DeltaPacked  bool    `json:"delta_packed,omitempty"`
+	RatioPct     float64 `json:"ratio_pct"`
+	NumV4Entries uint64  `json:"num_v4_entries"`
+	NumV6Entries uint64  `json:"num_v6_entries"`
+	NumDrops     uint64  `json:"num_drops"`
+	Header       string  `json:"header,omitempty"`
+	Issue        string  `json:"issue,omitempty"`
+}
+
+// BlockRatios denotes the compression ratios (compressed vs. raw size in percent) of all columns
+// of a block
+type BlockRatios struct {
+	Timestamp int64              `json:"timestamp"`
+	Ratios    map[string]float64 `json:"ratios_pct"`
+}
+
+// Issue denotes an inconsistency found in a block (or in the metadata of the GPDir, if the timestamp is zero)
+type Issue struct {
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Column    string `json:"column,omitempty"`
+	Message   string `json:"message"`
+}
+
+// String returns a human-readable representation of the issue
+func (i Issue) String() string {
+	if i.Timestamp == 0 {
+		if i.Column == "" {
+			return "metadata: " + i.Message
+		}
+		return fmt.Sprintf("metadata, column %s: %s", i.Column, i.Message)
+	}
+	if i.Column == "" {
+		return fmt.Sprintf("block %d: %s", i.Timestamp, i.Message)
+	}
+	return fmt.Sprintf("block %d, column %s: %s", i.Timestamp, i.Column, i.Message)
+}
+
+// Entry denotes a single (decoded) flow entry of a block
+type Entry struct {
+	SrcIP     netip.Addr     `json:"sip"`
+	DstIP     netip.Addr     `json:"dip"`
+	DstPort   uint16         `json:"dport"`
+	IPProto   uint8          `json:"proto"`
+	Counters  types.Counters `json:"counters"`
+	Tags      uint64         `json:"tags,omitempty"`
+	ProcessID uint64         `json:"process_id,omitempty"`
+	VLAN      uint64         `json:"vlan,omitempty"`
+	SrcMAC    string         `json:"smac,omitempty"`
+	DstMAC    string         `json:"dmac,omitempty"`
+	TCPFlags  string         `json:"flags,omitempty"`
+	DSCP      string         `json:"dscp,omitempty"`
+}
+
+// Open opens the GPDir at the given path in read mode. The path may denote the directory itself
+// (e.g. /path/to/db/eth0/2024/04/1712880000_...) or its metadata file
+func Open(path string) (*gpfile.GPDir, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if filepath.Base(path) == gpfile.MetadataFileName {
+		path = filepath.Dir(path)
+	}
+
+	timestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract timestamp from %s: %w", path, err)
+	}
+
+	// the base path is the interface directory (above the year / month directories)
+	gpDir := gpfile.NewDirReader(filepath.Dir(filepath.Dir(filepath.Dir(path))), timestamp, suffix)
+	if err := gpDir.Open(); err != nil {
+		return nil, fmt.Errorf("failed to open GPDir %s: %w", path, err)
+	}
+	return gpDir, nil
+}
+
+// Describe summarizes the metadata of the GPDir, including the header bytes of each block stored on
+// disk (flagging blocks whose header does not match their encoder)
+func Describe(gpDir *gpfile.GPDir) (*Dir, error) {
+	dir := &Dir{
+		Path:      gpDir.Path(),
+		Version:   gpDir.Version,
+		NumBlocks: gpDir.NBlocks(),
+		Traffic:   gpDir.Traffic,
+		Counts:    gpDir.Counts,
+	}
+	dir.Timestamp, _ = gpDir.TimeRange()
+	dir.Timestamp = gpfile.DirTimestamp(dir.Timestamp)
+
+	blockSizes, err := gpDir.FlowSizes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flow size histograms: %w", err)
+	}
+	if len(blockSizes) > 0 {
+		dir.FlowSizes = &FlowSizes{NumBlocks: len(blockSizes)}
+		for _, sizes := range blockSizes {
+			dir.FlowSizes.Add(sizes.FlowSizes)
+		}
+	}
+
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		header := gpDir.BlockMetadata[colIdx]
+		if header == nil {
+			continue
+		}
+
+		colFile, err := gpDir.Column(colIdx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to access column %s: %w", types.ColumnFileNames[colIdx], err)
+		}
+
+		column := Column{
+			Name:   types.ColumnFileNames[colIdx],
+			Size:   header.CurrentOffset,
+			Blocks: make([]Block, 0, len(header.Blocks())),
+		}
+		for i, block := range header.Blocks() {
+			column.RawSize += uint64(block.RawLen)
+
+			b := Block{
+				Timestamp:   block.Timestamp,
+				Offset:      block.Offset,
+				Len:         block.Len,
+				RawLen:      block.RawLen,
+				Encoder:     block.EncoderType.Base().String(),
+				DeltaPacked: block.EncoderType.IsDeltaPacked(),
+				RatioPct:    ratio(block.Block),
+			}
+			if i < len(gpDir.BlockTraffic) {
+				b.NumV4Entries = gpDir.BlockTraffic[i].NumV4Entries
+				b.NumV6Entries = gpDir.BlockTraffic[i].NumV6Entries
+				b.NumDrops = gpDir.BlockTraffic[i].NumDrops
+			}
+			b.Header, b.Issue = readHeader(colFile.Filename(), block)
+
+			column.Blocks = append(column.Blocks, b)
+		}
+		dir.Columns = append(dir.Columns, column)
+	}
+
+	return dir, nil
+}
+
+// CompressionRatios returns the compression ratios of all columns for each block of the GPDir (in
+// chronological order), allowing to assess how the compression performs over time
+func CompressionRatios(gpDir *gpfile.GPDir) []BlockRatios {
+	ratios := make([]BlockRatios, 0, gpDir.NBlocks())
+	for i := 0; i < gpDir.NBlocks(); i++ {
+		var blockRatios BlockRatios
+		for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+			block, exists := blockAtIndex(gpDir, colIdx, i)
+			if !exists {
+				continue
+			}
+			if blockRatios.Ratios == nil {
+				blockRatios = BlockRatios{Timestamp: block.Timestamp, Ratios: make(map[string]float64)}
+			}
+
+			// columns which are not in use (e.g. the tags of an untagged block) are omitted
+			if !block.IsEmpty() {
+				blockRatios.Ratios[types.ColumnFileNames[colIdx]] = ratio(block.Block)
+			}
+		}
+		ratios = append(ratios, blockRatios)
+	}
+	return ratios
+}
+
+// Verify checks the consistency of the metadata of the GPDir and reads all of its blocks to check
+// their consistency across columns, i.e. that every block is contained in its column file, starts with
+// the magic number of its encoder (if any), can be decoded and holds the number of entries stated in the metadata.
+// All issues found are returned (none if the GPDir is consistent)
+func Verify(gpDir *gpfile.GPDir) (issues []Issue) {
+	issues = verifyMetadata(gpDir)
+	for i := 0; i < gpDir.NBlocks(); i++ {
+		_, blockIssues := ReadBlock(gpDir, i)
+		issues = append(issues, blockIssues...)
+	}
+	return
+}
+
+// DumpBlock decodes all entries of the block at the given timestamp. The entries are returned in the
+// order they are stored in (IPv4 entries first)
+func DumpBlock(gpDir *gpfile.GPDir, timestamp int64) ([]Entry, error) {
+	idx, found := gpDir.BlockMetadata[types.SIPColIdx].BlockIndex(timestamp)
+	if !found {
+		return nil, fmt.Errorf("%w: no block for timestamp %d in %s", ErrBlockNotFound, timestamp, gpDir.Path())
+	}
+
+	blocks, issues := ReadBlock(gpDir, idx)
+	if len(issues) > 0 {
+		return nil, fmt.Errorf("block is inconsistent: %s", issues[0])
+	}
+
+	var (
+		numV4Entries = int(gpDir.NumIPv4EntriesAtIndex(idx))
+		bytesRcvd    = deltapack.Unpack(blocks[types.BytesRcvdColIdx], gpDir.DeltaPackedAtIndex(types.BytesRcvdColIdx, idx))
+		bytesSent    = deltapack.Unpack(blocks[types.BytesSentColIdx], gpDir.DeltaPackedAtIndex(types.BytesSentColIdx, idx))
+		pktsRcvd     = deltapack.Unpack(blocks[types.PacketsRcvdColIdx], gpDir.DeltaPackedAtIndex(types.PacketsRcvdColIdx, idx))
+		pktsSent     = deltapack.Unpack(blocks[types.PacketsSentColIdx], gpDir.DeltaPackedAtIndex(types.PacketsSentColIdx, idx))
+		tags         []uint64
+		processes    []uint64
+		vlans        []uint64
+		smacs, dmacs []uint64
+		tcpFlags     []uint64
+		dscps        []uint64
+	)
+	if len(blocks[types.TagsColIdx]) > 0 {
+		tags = deltapack.Unpack(blocks[types.TagsColIdx], gpDir.DeltaPackedAtIndex(types.TagsColIdx, idx))
+	}
+	if len(blocks[types.ProcessColIdx]) > 0 {
+		processes = deltapack.Unpack(blocks[types.ProcessColIdx], gpDir.DeltaPackedAtIndex(types.ProcessColIdx, idx))
+	}
+	if len(blocks[types.VLANColIdx]) > 0 {
+		vlans = deltapack.Unpack(blocks[types.VLANColIdx], gpDir.DeltaPackedAtIndex(types.VLANColIdx, idx))
+	}
+	if len(blocks[types.SMACColIdx]) > 0 {
+		smacs = deltapack.Unpack(blocks[types.SMACColIdx], gpDir.DeltaPackedAtIndex(types.SMACColIdx, idx))
+	}
+	if len(blocks[types.DMACColIdx]) > 0 {
+		dmacs = deltapack.Unpack(blocks[types.DMACColIdx], gpDir.DeltaPackedAtIndex(types.DMACColIdx, idx))
+	}
+	if len(blocks[types.TCPFlagsColIdx]) > 0 {
+		tcpFlags = deltapack.Unpack(blocks[types.TCPFlagsColIdx], gpDir.DeltaPackedAtIndex(types.TCPFlagsColIdx, idx))
+	}
+	if len(blocks[types.DSCPColIdx]) > 0 {
+		dscps = deltapack.Unpack(blocks[types.DSCPColIdx], gpDir.DeltaPackedAtIndex(types.DSCPColIdx, idx))
+	}
+
+	entries := make([]Entry, len(bytesRcvd))
+	for i := range entries {
+		entry := Entry{
+			DstPort: binary.BigEndian.Uint16(blocks[types.DportColIdx][i*types.DportSizeof:]),
+			IPProto: blocks[types.ProtoColIdx][i],
+			Counters: types.Counters{
+				BytesRcvd:   bytesRcvd[i],
+				BytesSent:   bytesSent[i],
+				PacketsRcvd: pktsRcvd[i],
+				PacketsSent: pktsSent[i],
+			},
+		}
+		entry.SrcIP = ipAt(blocks[types.SIPColIdx], i, numV4Entries)
+		entry.DstIP = ipAt(blocks[types.DIPColIdx], i, numV4Entries)
+		if tags != nil {
+			entry.Tags = tags[i]
+		}
+		if processes != nil {
+			entry.ProcessID = processes[i]
+		}
+		if vlans != nil {
+			entry.VLAN = vlans[i]
+		}
+		if smacs != nil {
+			entry.SrcMAC = types.MACFromUint64(smacs[i]).String()
+		}
+		if dmacs != nil {
+			entry.DstMAC = types.MACFromUint64(dmacs[i]).String()
+		}
+		if tcpFlags != nil {
+			entry.TCPFlags = types.TCPFlags(tcpFlags[i]).String()
+		}
+		if dscps != nil {
+			entry.DSCP = types.DSCP(dscps[i]).String()
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+// verifyMetadata checks the consistency of the metadata of the GPDir, i.e. that all columns hold the
+// same number of (chronologically ordered) blocks and that the traffic totals match the ones of the blocks.
+// Metadata recovered from its previous generation upon opening the GPDir is reported as well
+func verifyMetadata(gpDir *gpfile.GPDir) (issues []Issue) {
+	if gpDir.Recovered() {
+		issues = append(issues, Issue{Message: "missing / corrupt, recovered from its previous generation (losing any blocks written since)"})
+	}
+
+	nBlocks := gpDir.NBlocks()
+	if len(gpDir.BlockTraffic) != nBlocks {
+		issues = append(issues, Issue{Message: fmt.Sprintf("traffic metadata of %d blocks, expected %d", len(gpDir.BlockTraffic), nBlocks)})
+	}
+	for colIdx := types.ColumnIndex(1); colIdx < types.ColIdxCount; colIdx++ {
+		header := gpDir.BlockMetadata[colIdx]
+
+		// the label columns are missing for directories written prior to their introduction
+		if header == nil || (colIdx.IsLabelCol() && header.NBlocks() == 0) {
+			continue
+		}
+		if header.NBlocks() != nBlocks {
+			issues = append(issues, Issue{Column: types.ColumnFileNames[colIdx], Message: fmt.Sprintf("metadata of %d blocks, expected %d", header.NBlocks(), nBlocks)})
+		}
+	}
+
+	blocks := gpDir.BlockMetadata[types.SIPColIdx].Blocks()
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].Timestamp <= blocks[i-1].Timestamp {
+			issues = append(issues, Issue{Timestamp: blocks[i].Timestamp, Message: fmt.Sprintf("block out of order (follows block %d)", blocks[i-1].Timestamp)})
+		}
+	}
+
+	var traffic gpfile.TrafficMetadata
+	for _, blockTraffic := range gpDir.BlockTraffic {
+		traffic = traffic.Add(blockTraffic)
+	}
+	if traffic != gpDir.Traffic {
+		issues = append(issues, Issue{Message: fmt.Sprintf("traffic totals mismatch: expected %d / %d / %d flows / drops (IPv4 / IPv6 / drops), found %d / %d / %d",
+			traffic.NumV4Entries, traffic.NumV6Entries, traffic.NumDrops, gpDir.Traffic.NumV4Entries, gpDir.Traffic.NumV6Entries, gpDir.Traffic.NumDrops)})
+	}
+
+	return issues
+}
+
+// ReadBlock reads the block at the given index from all columns and checks their consistency,
+// returning the (decompressed) data of all columns. The data is only valid if no issues are returned
+func ReadBlock(gpDir *gpfile.GPDir, idx int) (blocks [types.ColIdxCount][]byte, issues []Issue) {
+	sipBlock, _ := blockAtIndex(gpDir, types.SIPColIdx, idx)
+	timestamp := sipBlock.Timestamp
+
+	addIssue := func(colIdx types.ColumnIndex, msg string, args ...any) {
+		issues = append(issues, Issue{Timestamp: timestamp, Column: types.ColumnFileNames[colIdx], Message: fmt.Sprintf(msg, args...)})
+	}
+
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		block, exists := blockAtIndex(gpDir, colIdx, idx)
+		if !exists {
+			// the tags / process / VLAN / MAC columns are missing for directories written prior to their introduction
+			if !colIdx.IsLabelCol() {
+				addIssue(colIdx, "block missing in metadata")
+			}
+			continue
+		}
+		if block.Timestamp != timestamp {
+			addIssue(colIdx, "block timestamp mismatch (have %d)", block.Timestamp)
+			continue
+		}
+		if issue := checkBlockStorage(gpDir, colIdx, block); issue != "" {
+			addIssue(colIdx, issue)
+			continue
+		}
+
+		data, err := gpDir.ReadBlockAtIndex(colIdx, idx)
+		if err != nil {
+			addIssue(colIdx, "failed to read block: %s", err)
+			continue
+		}
+
+		// the data returned by the GPFile is only valid until the next read from the same column
+		blocks[colIdx] = append([]byte{}, data...)
+	}
+	if len(issues) > 0 {
+		return blocks, issues
+	}
+
+	var (
+		numV4Entries  = int(gpDir.NumIPv4EntriesAtIndex(idx))
+		numEntries    = numV4Entries + int(gpDir.NumIPv6EntriesAtIndex(idx))
+		numIPBytes    = numV4Entries*types.IPv4Width + (numEntries-numV4Entries)*types.IPv6Width
+		numEntriesCol = func(colIdx types.ColumnIndex) int {
+			return deltapack.Len(blocks[colIdx], gpDir.DeltaPackedAtIndex(colIdx, idx))
+		}
+	)
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		l := len(blocks[colIdx])
+		switch {
+		case colIdx.IsCounterCol():
+			if l == 0 && numEntries > 0 {
+				addIssue(colIdx, "invalid (empty) bitpack slice")
+			} else if n := numEntriesCol(colIdx); n != numEntries {
+				addIssue(colIdx, "bitpack length mismatch: expected %d entries, found %d", numEntries, n)
+			}
+		case colIdx.IsLabelCol():
+			// the tags / process / VLAN / MAC columns are empty for blocks written without a flow tagger /
+			// process attributor / flows observed on a VLAN / recorded MAC addresses
+			if n := numEntriesCol(colIdx); l > 0 && n != numEntries {
+				addIssue(colIdx, "bitpack length mismatch: expected %d entries, found %d", numEntries, n)
+			}
+		case types.ColumnSizeofs[colIdx] == types.IPSizeOf:
+			if l != numIPBytes {
+				addIssue(colIdx, "length mismatch: expected %d bytes, found %d", numIPBytes, l)
+			}
+		default:
+			if l != numEntries*types.ColumnSizeofs[colIdx] {
+				addIssue(colIdx, "length mismatch: expected %d bytes, found %d", numEntries*types.ColumnSizeofs[colIdx], l)
+			}
+		}
+	}
+
+	return blocks, issues
+}
+
+// blockAtIndex returns the block of a column at a given block index (if present)
+func blockAtIndex(gpDir *gpfile.GPDir, colIdx types.ColumnIndex, idx int) (storage.BlockAtTime, bool) {
+	header := gpDir.BlockMetadata[colIdx]
+	if header == nil || idx >= len(header.BlockList) {
+		return storage.BlockAtTime{}, false
+	}
+	return header.BlockList[idx], true
+}
+
+// checkBlockStorage checks whether a block is contained in its column file and starts with the magic
+// number of its encoder (if it has one), stating an issue otherwise
+func checkBlockStorage(gpDir *gpfile.GPDir, colIdx types.ColumnIndex, block storage.BlockAtTime) string {
+	if block.Len == 0 {
+		return ""
+	}
+	colFile, err := gpDir.Column(colIdx)
+	if err != nil {
+		return fmt.Sprintf("failed to access column file: %s", err)
+	}
+	stat, err := os.Stat(colFile.Filename())
+	if err != nil {
+		return fmt.Sprintf("failed to access column file: %s", err)
+	}
+	if end := block.Offset + uint64(block.Len); end > uint64(stat.Size()) {
+		return fmt.Sprintf("block exceeds column file (ends at %d, file size %d bytes)", end, stat.Size())
+	}
+	_, issue := readHeader(colFile.Filename(), block)
+	return issue
+}
+
+// readHeader reads the first bytes of a block as stored on disk, stating an issue if they don't
+// match the encoder of the block
+func readHeader(filename string, block storage.BlockAtTime) (header string, issue string) {
+	if block.Len < 4 {
+		return
+	}
+
+	f, err := os.Open(filepath.Clean(filename))
+	if err != nil {
+		return "", fmt.Sprintf("failed to open column file: %s", err)
+	}
+	defer f.Close()
+
+	b := make([]byte, 4)
+	if _, err := f.ReadAt(b, int64(block.Offset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", "block exceeds column file"
+		}
+		return "", fmt.Sprintf("failed to read block header: %s", err)
+	}
+
+	header = fmt.Sprintf("%x", b)
+	if block.EncoderType.Base() == encoders.EncoderTypeZSTD && binary.LittleEndian.Uint32(b) != zstdMagic {
+		issue = "ZSTD magic number mismatch"
+	}
+	return
+}
+
+func ratio(block storage.Block) float64 {
+	if block.IsEmpty() || block.RawLen == 0 {
+		return 0
+	}
+	return 100 * float64(block.Len) / float64(block.RawLen)
+}
+
+func ipAt(data []byte, i, numV4Entries int) netip.Addr {
+	if i < numV4Entries {
+		return netip.AddrFrom4([4]byte(data[i*types.IPv4Width:]))
+	}
+	offset := numV4Entries*types.IPv4Width + (i-numV4Entries)*types.IPv6Width
+	return netip.AddrFrom16([16]byte(data[offset:]))
+}
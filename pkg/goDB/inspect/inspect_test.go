@@ -0,0 +1,177 @@
+package inspect
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIface     = "eth0"
+	testTimestamp = int64(1700000000)
+	testInterval  = int64(300)
+	testBlocks    = 5
+)
+
+func TestInspect(t *testing.T) {
+	dirPath := writeTestDir(t)
+
+	gpDir, err := Open(filepath.Join(dirPath, gpfile.MetadataFileName))
+	require.Nil(t, err)
+	defer gpDir.Close()
+
+	t.Run("describe", func(t *testing.T) {
+		dir, err := Describe(gpDir)
+		require.Nil(t, err)
+		require.Equal(t, testBlocks, dir.NumBlocks)
+		require.Len(t, dir.Columns, int(types.ColIdxCount))
+		for _, column := range dir.Columns {
+			require.Len(t, column.Blocks, testBlocks)
+			for _, block := range column.Blocks {
+				require.Empty(t, block.Issue)
+			}
+		}
+
+		// every flow holds a single packet
+		require.NotNil(t, dir.FlowSizes)
+		require.Equal(t, testBlocks, dir.FlowSizes.NumBlocks)
+		require.EqualValues(t, 20, dir.FlowSizes.Packets.Buckets[0])
+		require.EqualValues(t, 20, dir.FlowSizes.Bytes.Count())
+	})
+
+	t.Run("ratios", func(t *testing.T) {
+		ratios := CompressionRatios(gpDir)
+		require.Len(t, ratios, testBlocks)
+		require.Equal(t, testTimestamp, ratios[0].Timestamp)
+		require.Contains(t, ratios[0].Ratios, types.ColumnFileNames[types.SIPColIdx])
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		require.Empty(t, Verify(gpDir))
+	})
+
+	t.Run("dump block", func(t *testing.T) {
+		entries, err := DumpBlock(gpDir, testTimestamp+2*testInterval)
+		require.Nil(t, err)
+		require.Len(t, entries, 4)
+
+		// entries are stored sorted, IPv4 entries first
+		require.Equal(t, netip.MustParseAddr("10.0.0.0"), entries[0].SrcIP)
+		require.Equal(t, netip.MustParseAddr("10.0.1.0"), entries[0].DstIP)
+		require.Equal(t, uint16(443), entries[0].DstPort)
+		require.Equal(t, uint8(6), entries[0].IPProto)
+		require.Equal(t, types.Counters{BytesRcvd: 1, PacketsRcvd: 1}, entries[0].Counters)
+		require.Equal(t, netip.MustParseAddr("2001:db8::1"), entries[3].SrcIP)
+		require.Equal(t, uint8(17), entries[3].IPProto)
+
+		_, err = DumpBlock(gpDir, testTimestamp+1)
+		require.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
+
+func TestVerifyCorruptedColumn(t *testing.T) {
+	dirPath := writeTestDir(t)
+
+	// truncate the destination port column, cutting off the last block
+	dportPath := filepath.Join(dirPath, types.ColumnFileNames[types.DportColIdx]+gpfile.FileSuffix)
+	stat, err := os.Stat(dportPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(dportPath, stat.Size()-1))
+
+	gpDir, err := Open(dirPath)
+	require.Nil(t, err)
+	defer gpDir.Close()
+
+	issues := Verify(gpDir)
+	require.Len(t, issues, 1)
+	require.Equal(t, testTimestamp+(testBlocks-1)*testInterval, issues[0].Timestamp)
+	require.Equal(t, types.ColumnFileNames[types.DportColIdx], issues[0].Column)
+
+	_, err = DumpBlock(gpDir, issues[0].Timestamp)
+	require.NotNil(t, err)
+}
+
+func TestVerifyCorruptedMagic(t *testing.T) {
+
+	// blocks are only stored compressed if compression pays off, hence they require a sufficient number of flows
+	dbPath := t.TempDir()
+	w := goDB.NewDBWriter(dbPath, testIface, encoders.EncoderTypeZSTD)
+	for i := int64(0); i < 2; i++ {
+		m := hashmap.NewAggFlowMap()
+		for j := 0; j < 1000; j++ {
+			m.PrimaryMap.Set(types.NewV4KeyStatic(
+				[4]byte{10, 0, byte(j >> 8), byte(j)},
+				[4]byte{10, 0, 255, 1},
+				[]byte{1, 187}, 6), types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+		}
+		require.Nil(t, w.Write(m, capturetypes.CaptureStats{}, testTimestamp+i*testInterval))
+	}
+	dirs, err := filepath.Glob(filepath.Join(dbPath, testIface, "*", "*", "*"))
+	require.Nil(t, err)
+	require.Len(t, dirs, 1)
+	dirPath := dirs[0]
+
+	gpDir, err := Open(dirPath)
+	require.Nil(t, err)
+	require.Empty(t, Verify(gpDir))
+
+	// overwrite the magic number of the second block of the source IP column
+	block := gpDir.BlockMetadata[types.SIPColIdx].BlockList[1]
+	require.Equal(t, encoders.EncoderTypeZSTD, block.EncoderType.Base())
+	require.Nil(t, gpDir.Close())
+
+	f, err := os.OpenFile(filepath.Join(dirPath, types.ColumnFileNames[types.SIPColIdx]+gpfile.FileSuffix), os.O_WRONLY, 0)
+	require.Nil(t, err)
+	_, err = f.WriteAt([]byte{0, 0, 0, 0}, int64(block.Offset))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	gpDir, err = Open(dirPath)
+	require.Nil(t, err)
+	defer gpDir.Close()
+
+	issues := Verify(gpDir)
+	require.Len(t, issues, 1)
+	require.Equal(t, Issue{Timestamp: block.Timestamp, Column: types.ColumnFileNames[types.SIPColIdx], Message: "ZSTD magic number mismatch"}, issues[0])
+}
+
+// writeTestDir writes a GPDir with testBlocks blocks and returns its path
+func writeTestDir(t *testing.T) string {
+	t.Helper()
+
+	dbPath := t.TempDir()
+	w := goDB.NewDBWriter(dbPath, testIface, encoders.EncoderTypeNull)
+	for i := int64(0); i < testBlocks; i++ {
+		require.Nil(t, w.Write(testFlows(byte(i)), capturetypes.CaptureStats{}, testTimestamp+i*testInterval))
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(dbPath, testIface, "*", "*", "*"))
+	require.Nil(t, err)
+	require.Len(t, dirs, 1)
+
+	return dirs[0]
+}
+
+func testFlows(n byte) *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	for i := byte(0); i <= n; i++ {
+		m.PrimaryMap.Set(types.NewV4KeyStatic(
+			[4]byte{10, 0, 0, i},
+			[4]byte{10, 0, 1, i},
+			[]byte{1, 187}, 6), types.Counters{BytesRcvd: uint64(i) + 1, PacketsRcvd: 1})
+	}
+	m.SecondaryMap.Set(types.NewV6KeyStatic(
+		netip.MustParseAddr("2001:db8::1").As16(),
+		netip.MustParseAddr("2001:db8::2").As16(),
+		[]byte{0, 53}, 17), types.Counters{BytesSent: 100, PacketsSent: 1})
+	return m
+}
@@ -0,0 +1,85 @@
+package goDB
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+)
+
+// DayIPIndex denotes the index of all unique IPs observed on an interface during a day
+type DayIPIndex struct {
+	Iface string
+	Day   time.Time
+
+	// Index holds the unique IPs of the day. It is nil if the day is not covered by an index (e.g.
+	// because its data was written by an older release)
+	Index *gpfile.IPIndex
+}
+
+// ReadIPIndices reads the IP indices of all days of the interface overlapping with the time range (in
+// chronological order). Only the indices are read, none of the blocks
+func (w *DBWorkManager) ReadIPIndices(tfirst, tlast int64) ([]DayIPIndex, error) {
+	var indices []DayIPIndex
+	_, err := w.walkDB(tfirst, tlast, func(_ int, dayTimestamp int64, suffix string) error {
+		dir := w.newDirReader(dayTimestamp, suffix)
+
+		// the index is validated against the metadata of the directory, which is read from disk
+		// unless it has been provided via the suffix / the cache
+		if dir.Metadata == nil {
+			if err := dir.Open(); err != nil {
+				return fmt.Errorf("failed to open GPDir %s to read its IP index: %w", dir.Path(), err)
+			}
+			defer func() {
+				_ = dir.Close()
+			}()
+		}
+
+		index, err := dir.IPIndex()
+		if err != nil {
+			return fmt.Errorf("failed to read IP index of GPDir %s: %w", dir.Path(), err)
+		}
+		indices = append(indices, DayIPIndex{
+			Iface: w.iface,
+			Day:   time.Unix(dayTimestamp, 0),
+			Index: index,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return indices, nil
+}
+
+// ReadIPIndices reads the IP indices of all days overlapping with the time range for each of the
+// interfaces (all interfaces of the DB if none are provided, interfaces not present in the DB are
+// ignored). The indices are grouped by interface (in the order of the interfaces)
+func ReadIPIndices(dbPath string, ifaces []string, tfirst, tlast int64) ([]DayIPIndex, error) {
+	dbIfaces, err := info.GetInterfaces(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(ifaces) == 0 {
+		ifaces = dbIfaces
+	}
+
+	var indices []DayIPIndex
+	for _, iface := range ifaces {
+		if !slices.Contains(dbIfaces, iface) {
+			continue
+		}
+		wm, err := NewDBWorkManager(NewMetadataQuery(), dbPath, iface, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up work manager for %s: %w", iface, err)
+		}
+		ifaceIndices, err := wm.ReadIPIndices(tfirst, tlast)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, ifaceIndices...)
+	}
+	return indices, nil
+}
@@ -1,6 +1,10 @@
 package goDB
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/els0r/goProbe/pkg/formatting"
 	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
 	"github.com/els0r/goProbe/pkg/results"
@@ -11,19 +15,70 @@ import (
 // were recorded and how much traffic was captured
 type InterfaceMetadata struct {
 	Iface string `json:"iface"`
+	Zone  string `json:"zone,omitempty"`
 	results.TimeRange
 
 	gpfile.Stats
+
+	// Gaps denotes the periods without data between the first and last block covered
+	Gaps CoverageGaps `json:"gaps,omitempty"`
+}
+
+// CoverageGap denotes a period without data (i.e. missing blocks or days) between two blocks of
+// an interface, e.g. due to goProbe not running or data having been lost
+type CoverageGap struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Duration returns the duration of the gap
+func (g CoverageGap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+// CoverageGaps denotes a list of gaps in the data coverage (in chronological order)
+type CoverageGaps []CoverageGap
+
+// Duration returns the accumulated duration of all gaps
+func (gs CoverageGaps) Duration() (d time.Duration) {
+	for _, g := range gs {
+		d += g.Duration()
+	}
+	return
+}
+
+// minGapInterval denotes the interval between two consecutive blocks from which on a gap is
+// reported. Since writeouts aren't strictly periodic (e.g. upon restart of goProbe), the blocks
+// may be up to half a writeout interval further apart than usual
+const minGapInterval = DBWriteInterval + DBWriteInterval/2
+
+// gapDetector detects the gaps in a series of (chronologically ordered) block timestamps
+type gapDetector struct {
+	last int64
+	gaps CoverageGaps
+}
+
+// add adds the timestamp of the next block, registering a gap if it is too far apart from the
+// previous one. A block contains the flows of the writeout interval preceding its timestamp,
+// hence the gap ends one writeout interval before it
+func (d *gapDetector) add(timestamp int64) {
+	if d.last > 0 && timestamp-d.last > minGapInterval {
+		d.gaps = append(d.gaps, CoverageGap{
+			From: time.Unix(d.last, 0),
+			To:   time.Unix(timestamp-DBWriteInterval, 0),
+		})
+	}
+	d.last = timestamp
 }
 
 // TableHeader constructs the table header for pretty printing metadata
 func (i *InterfaceMetadata) TableHeader(detailed bool) (headerRows [][]string) {
-	r1 := []string{"iface"}
+	r1 := []string{"iface", "zone"}
 	fromTo := []string{"from", "to"}
 
 	if detailed {
-		r0 := []string{"", "packets", "packets", "bytes", "bytes", "# of", "# of", "", "", ""}
-		r1 = append(r1, "in", "out", "in", "out", "IPv4 flows", "IPv6 flows", "drops")
+		r0 := []string{"", "", "packets", "packets", "bytes", "bytes", "# of", "# of", "", "", "", ""}
+		r1 = append(r1, "in", "out", "in", "out", "IPv4 flows", "IPv6 flows", "drops", "gaps")
 
 		headerRows = append(headerRows, r0)
 	} else {
@@ -38,9 +93,9 @@ func (i *InterfaceMetadata) TableHeader(detailed bool) (headerRows [][]string) {
 
 // TableRow puts all attributes of the metadata into a row that can be used for table printing.
 // If detailed is false, the counts and metadata is summarized to their sum (e.g. IPv4 + IPv6 flows = NumFlows).
-// Drops are only printed in detail mode
+// Drops and gaps in the data coverage are only printed in detail mode
 func (i *InterfaceMetadata) TableRow(detailed bool) []string {
-	str := []string{i.Iface}
+	str := []string{i.Iface, i.Zone}
 	fromTo := []string{i.First.Format(types.DefaultTimeOutputFormat), i.Last.Format(types.DefaultTimeOutputFormat)}
 	if detailed {
 		str = append(str,
@@ -48,6 +103,7 @@ func (i *InterfaceMetadata) TableRow(detailed bool) []string {
 			formatting.Size(i.Counts.BytesRcvd), formatting.Size(i.Counts.BytesSent),
 			formatting.Count(i.Traffic.NumV4Entries), formatting.Count(i.Traffic.NumV6Entries),
 			formatting.Count(i.Traffic.NumDrops),
+			i.gapsSummary(),
 		)
 	} else {
 		str = append(str,
@@ -60,3 +116,68 @@ func (i *InterfaceMetadata) TableRow(detailed bool) []string {
 	str = append(str, fromTo...)
 	return str
 }
+
+// gapsSummary summarizes the gaps in the data coverage by their number and accumulated duration
+func (i *InterfaceMetadata) gapsSummary() string {
+	if len(i.Gaps) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d (%s)", len(i.Gaps), formatting.Durationable(i.Gaps.Duration()))
+}
+
+// InterfaceSummary denotes the flat, machine-parsable representation of the metadata of an
+// interface, e.g. for inventory automation. Its fields (and their order in CSV output) are
+// considered stable
+type InterfaceSummary struct {
+	Iface       string    `json:"iface"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+	FlowsV4     uint64    `json:"flows_v4"`
+	FlowsV6     uint64    `json:"flows_v6"`
+	BytesRcvd   uint64    `json:"bytes_rcvd"`
+	BytesSent   uint64    `json:"bytes_sent"`
+	PacketsRcvd uint64    `json:"packets_rcvd"`
+	PacketsSent uint64    `json:"packets_sent"`
+	Drops       uint64    `json:"drops"`
+	Zone        string    `json:"zone"`
+}
+
+// InterfaceSummaryCSVHeader denotes the CSV header matching InterfaceSummary.CSVRecord()
+var InterfaceSummaryCSVHeader = []string{
+	"iface", "first", "last", "flows_v4", "flows_v6", "bytes_rcvd", "bytes_sent", "packets_rcvd", "packets_sent", "drops", "zone",
+}
+
+// Summary returns the flat representation of the metadata
+func (i *InterfaceMetadata) Summary() InterfaceSummary {
+	return InterfaceSummary{
+		Iface:       i.Iface,
+		First:       i.First,
+		Last:        i.Last,
+		FlowsV4:     i.Traffic.NumV4Entries,
+		FlowsV6:     i.Traffic.NumV6Entries,
+		BytesRcvd:   i.Counts.BytesRcvd,
+		BytesSent:   i.Counts.BytesSent,
+		PacketsRcvd: i.Counts.PacketsRcvd,
+		PacketsSent: i.Counts.PacketsSent,
+		Drops:       i.Traffic.NumDrops,
+		Zone:        i.Zone,
+	}
+}
+
+// CSVRecord returns the summary as CSV record (with timestamps in epoch seconds, in line with
+// the CSV output of queries)
+func (s InterfaceSummary) CSVRecord() []string {
+	return []string{
+		s.Iface,
+		strconv.FormatInt(s.First.Unix(), 10),
+		strconv.FormatInt(s.Last.Unix(), 10),
+		strconv.FormatUint(s.FlowsV4, 10),
+		strconv.FormatUint(s.FlowsV6, 10),
+		strconv.FormatUint(s.BytesRcvd, 10),
+		strconv.FormatUint(s.BytesSent, 10),
+		strconv.FormatUint(s.PacketsRcvd, 10),
+		strconv.FormatUint(s.PacketsSent, 10),
+		strconv.FormatUint(s.Drops, 10),
+		s.Zone,
+	}
+}
@@ -0,0 +1,201 @@
+package goDB
+
+import (
+	"container/list"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+)
+
+// DefaultMetadataCacheMaxDirs denotes the default maximum number of GPDirs whose metadata is cached
+const DefaultMetadataCacheMaxDirs = 1024
+
+// MetadataCache keeps the directory listings of the DB and the metadata of its GPDirs (per interface
+// and day) in memory across queries, so that repeated queries neither have to walk the directory tree
+// nor read the metadata of the directories they cover from disk. Cached entries are validated against
+// the modification time of the respective directory / metadata file before being used (covering
+// any changes made by other processes, e.g. the removal of old data). In addition, the writeout path
+// updates the metadata of the directories it writes to, keeping the current day up to date
+type MetadataCache struct {
+	maxDirs int
+
+	listings map[string]*cachedListing     // directory listings, per path
+	dirs     map[metadataKey]*list.Element // GPDir metadata, per interface and day
+	lru      *list.List                    // GPDir metadata in order of use (most recently used first)
+	sync.Mutex
+
+	hits, misses atomic.Uint64
+}
+
+type metadataKey struct {
+	ifaceDir     string
+	dayTimestamp int64
+}
+
+type cachedListing struct {
+	modTime time.Time
+	entries []fs.DirEntry
+}
+
+type cachedMetadata struct {
+	key     metadataKey
+	suffix  string
+	modTime time.Time
+	size    int64
+	meta    *gpfile.Metadata
+}
+
+// NewMetadataCache instantiates a new metadata cache, holding the metadata of up to maxDirs GPDirs
+// (evicting the least recently used ones). If maxDirs is zero, DefaultMetadataCacheMaxDirs is used
+func NewMetadataCache(maxDirs int) *MetadataCache {
+	if maxDirs <= 0 {
+		maxDirs = DefaultMetadataCacheMaxDirs
+	}
+	return &MetadataCache{
+		maxDirs:  maxDirs,
+		listings: make(map[string]*cachedListing),
+		dirs:     make(map[metadataKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Stats returns the number of metadata lookups served from / missing the cache, as well as the
+// number of GPDirs currently cached
+func (c *MetadataCache) Stats() (hits, misses uint64, numDirs int) {
+	c.Lock()
+	numDirs = len(c.dirs)
+	c.Unlock()
+
+	return c.hits.Load(), c.misses.Load(), numDirs
+}
+
+// Update stores the metadata of a GPDir just written to the DB (replacing any previously cached
+// metadata for the same interface and day). Since the directory suffix is derived from the metadata,
+// it is expected to reflect the state of the directory after writing (i.e. after closing it)
+func (c *MetadataCache) Update(ifaceDir string, dayTimestamp int64, meta *gpfile.Metadata) {
+	suffix := strings.TrimPrefix(meta.MarshalString(), "_")
+	c.store(ifaceDir, dayTimestamp, suffix, gpfile.NewDirReader(ifaceDir, dayTimestamp, suffix).MetadataPath(), meta)
+}
+
+// metadata returns the cached metadata of a GPDir (or nil if it is not cached or outdated)
+func (c *MetadataCache) metadata(ifaceDir string, dayTimestamp int64, suffix, metaPath string) *gpfile.Metadata {
+	key := metadataKey{ifaceDir: ifaceDir, dayTimestamp: dayTimestamp}
+
+	c.Lock()
+	elem, exists := c.dirs[key]
+	c.Unlock()
+	if !exists {
+		c.misses.Add(1)
+		return nil
+	}
+	entry := elem.Value.(*cachedMetadata)
+
+	// Validate the entry against the metadata file on disk (outside of the lock)
+	stat, err := os.Stat(metaPath)
+	valid := err == nil && entry.suffix == suffix && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size()
+
+	c.Lock()
+	defer c.Unlock()
+
+	// The entry might have been replaced / evicted in the meantime, in which case it is simply
+	// considered a miss
+	if cur, exists := c.dirs[key]; !exists || cur != elem {
+		c.misses.Add(1)
+		return nil
+	}
+	if !valid {
+		c.remove(elem)
+		c.misses.Add(1)
+		return nil
+	}
+
+	c.lru.MoveToFront(elem)
+	c.hits.Add(1)
+	return entry.meta
+}
+
+// storeDir stores the metadata of a GPDir opened for reading, unless an entry for the directory
+// with the same suffix is already present
+func (c *MetadataCache) storeDir(ifaceDir string, dir *gpfile.GPDir) {
+	dayTimestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dir.Path()))
+	if err != nil || dir.Metadata == nil {
+		return
+	}
+
+	c.Lock()
+	elem, exists := c.dirs[metadataKey{ifaceDir: ifaceDir, dayTimestamp: dayTimestamp}]
+	c.Unlock()
+	if exists && elem.Value.(*cachedMetadata).suffix == suffix {
+		return
+	}
+
+	c.store(ifaceDir, dayTimestamp, suffix, dir.MetadataPath(), dir.Metadata.Clone())
+}
+
+func (c *MetadataCache) store(ifaceDir string, dayTimestamp int64, suffix, metaPath string, meta *gpfile.Metadata) {
+	stat, err := os.Stat(metaPath)
+	if err != nil {
+		return
+	}
+	entry := &cachedMetadata{
+		key:     metadataKey{ifaceDir: ifaceDir, dayTimestamp: dayTimestamp},
+		suffix:  suffix,
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		meta:    meta,
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, exists := c.dirs[entry.key]; exists {
+		c.remove(elem)
+	}
+	c.dirs[entry.key] = c.lru.PushFront(entry)
+
+	// Evict the least recently used entries if the cache is full
+	for len(c.dirs) > c.maxDirs {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *MetadataCache) remove(elem *list.Element) {
+	delete(c.dirs, elem.Value.(*cachedMetadata).key)
+	c.lru.Remove(elem)
+}
+
+// readDir returns the (sorted) entries of a directory, reading them from disk only if the directory
+// was modified since it was last read
+func (c *MetadataCache) readDir(path string) ([]fs.DirEntry, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	listing, exists := c.listings[path]
+	c.Unlock()
+	if exists && listing.modTime.Equal(stat.ModTime()) {
+		return listing.entries, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	c.listings[path] = &cachedListing{
+		modTime: stat.ModTime(),
+		entries: entries,
+	}
+	c.Unlock()
+
+	return entries, nil
+}
@@ -0,0 +1,113 @@
+package goDB
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataCache(t *testing.T) {
+	testPath := t.TempDir()
+	cache := NewMetadataCache(0)
+
+	day := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	w := NewDBWriter(testPath, "eth0", encoders.EncoderTypeNull).MetadataCache(cache)
+	for i := int64(1); i <= 3; i++ {
+		require.Nil(t, w.Write(generateFlows(), capturetypes.CaptureStats{}, day.Unix()+i*DBWriteInterval))
+	}
+
+	// the writer keeps the metadata of the directory up to date
+	_, _, numDirs := cache.Stats()
+	require.Equal(t, 1, numDirs)
+	dirs, err := filepath.Glob(filepath.Join(testPath, "eth0", "*", "*", "*"))
+	require.Nil(t, err)
+	require.Len(t, dirs, 1)
+	dayTimestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dirs[0]))
+	require.Nil(t, err)
+
+	onDisk := gpfile.NewDirReader(filepath.Join(testPath, "eth0"), dayTimestamp, suffix)
+	require.Nil(t, onDisk.Open())
+	cached := cache.metadata(filepath.Join(testPath, "eth0"), dayTimestamp, suffix, onDisk.MetadataPath())
+	require.NotNil(t, cached)
+	require.Equal(t, onDisk.Metadata, cached)
+	require.Nil(t, onDisk.Close())
+
+	// queries are served from the cache (and yield the same results as without it)
+	expected := runCacheTestQuery(t, testPath, nil, day)
+	require.Equal(t, expected, runCacheTestQuery(t, testPath, cache, day))
+	hits, misses, _ := cache.Stats()
+	require.Equal(t, uint64(2), hits) // single lookup per directory and query
+	require.Zero(t, misses)
+
+	// directories modified by another writer are read from disk (and cached subsequently)
+	require.Nil(t, NewDBWriter(testPath, "eth0", encoders.EncoderTypeNull).Write(generateFlows(), capturetypes.CaptureStats{}, day.Unix()+4*DBWriteInterval))
+	require.Nil(t, NewDBWriter(testPath, "eth0", encoders.EncoderTypeNull).Write(generateFlows(), capturetypes.CaptureStats{}, day.Add(24*time.Hour).Unix()+DBWriteInterval))
+	expected = runCacheTestQuery(t, testPath, nil, day)
+	require.Equal(t, expected, runCacheTestQuery(t, testPath, cache, day))
+	_, misses, numDirs = cache.Stats()
+	require.Equal(t, uint64(2), misses)
+	require.Equal(t, 2, numDirs)
+
+	// a modification of the metadata file invalidates the cached metadata
+	dirs, err = filepath.Glob(filepath.Join(testPath, "eth0", "*", "*", "*", gpfile.MetadataFileName))
+	require.Nil(t, err)
+	require.Len(t, dirs, 2)
+	require.Nil(t, os.Chtimes(dirs[0], time.Now(), time.Now().Add(time.Hour)))
+	require.Equal(t, expected, runCacheTestQuery(t, testPath, cache, day))
+	_, misses, _ = cache.Stats()
+	require.Equal(t, uint64(3), misses)
+}
+
+func TestMetadataCacheEviction(t *testing.T) {
+	testPath := t.TempDir()
+	cache := NewMetadataCache(1)
+
+	w := NewDBWriter(testPath, "eth0", encoders.EncoderTypeNull).MetadataCache(cache)
+	for day := 1; day <= 3; day++ {
+		require.Nil(t, w.Write(generateFlows(), capturetypes.CaptureStats{}, time.Date(2000, time.January, day, 0, 5, 0, 0, time.UTC).Unix()))
+	}
+	_, _, numDirs := cache.Stats()
+	require.Equal(t, 1, numDirs)
+
+	// only the most recently written directory is retained
+	require.Nil(t, cache.metadata(filepath.Join(testPath, "eth0"), time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Unix(), "", ""))
+	_, exists := cache.dirs[metadataKey{ifaceDir: filepath.Join(testPath, "eth0"), dayTimestamp: time.Date(2000, time.January, 3, 0, 0, 0, 0, time.UTC).Unix()}]
+	require.True(t, exists)
+}
+
+// runCacheTestQuery runs a query covering the month of day and returns the number of flows aggregated
+// per workload
+func runCacheTestQuery(t *testing.T, path string, cache *MetadataCache, day time.Time) (numFlows []int) {
+	t.Helper()
+
+	var opts []WorkManagerOption
+	if cache != nil {
+		opts = append(opts, WithMetadataCache(cache))
+	}
+	workMgr, err := NewDBWorkManager(NewQuery([]types.Attribute{
+		types.SIPAttribute{},
+		types.DIPAttribute{}}, nil, types.LabelSelector{}), path, "eth0", 1, opts...)
+	require.Nil(t, err)
+
+	nonempty, err := workMgr.CreateWorkerJobs(day.Unix(), day.AddDate(0, 1, 0).Unix())
+	require.Nil(t, err)
+	require.True(t, nonempty)
+
+	mapChan := make(chan hashmap.AggFlowMapWithMetadata, 1024)
+	workMgr.ExecuteWorkerReadJobs(context.Background(), mapChan)
+	close(mapChan)
+
+	for aggMap := range mapChan {
+		numFlows = append(numFlows, aggMap.PrimaryMap.Len()+aggMap.SecondaryMap.Len())
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package goDB
+
+import (
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/results"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterfaceSummary(t *testing.T) {
+	metadata := &InterfaceMetadata{
+		Iface: "eth0",
+		Zone:  "external",
+		TimeRange: results.TimeRange{
+			First: time.Unix(1700000000, 0),
+			Last:  time.Unix(1700086400, 0),
+		},
+		Stats: gpfile.Stats{
+			Counts:  types.Counters{BytesRcvd: 1000, BytesSent: 2000, PacketsRcvd: 10, PacketsSent: 20},
+			Traffic: gpfile.TrafficMetadata{NumV4Entries: 5, NumV6Entries: 3, NumDrops: 7},
+		},
+	}
+
+	summary := metadata.Summary()
+	require.Equal(t, InterfaceSummary{
+		Iface:       "eth0",
+		First:       time.Unix(1700000000, 0),
+		Last:        time.Unix(1700086400, 0),
+		FlowsV4:     5,
+		FlowsV6:     3,
+		BytesRcvd:   1000,
+		BytesSent:   2000,
+		PacketsRcvd: 10,
+		PacketsSent: 20,
+		Drops:       7,
+		Zone:        "external",
+	}, summary)
+
+	record := summary.CSVRecord()
+	require.Len(t, record, len(InterfaceSummaryCSVHeader))
+	require.Equal(t, []string{"eth0", "1700000000", "1700086400", "5", "3", "1000", "2000", "10", "20", "7", "external"}, record)
+}
+
+func TestCoverageGaps(t *testing.T) {
+	var d gapDetector
+
+	// regular blocks, including a slightly delayed writeout
+	ts := int64(1700000000)
+	for _, offset := range []int64{0, 300, 600, 1000, 1300} {
+		d.add(ts + offset)
+	}
+	require.Empty(t, d.gaps)
+
+	// an hour without data, followed by a missing day
+	d.add(ts + 1300 + 3600)
+	d.add(ts + 1300 + 3600 + 86400)
+
+	require.Equal(t, CoverageGaps{
+		{From: time.Unix(ts+1300, 0), To: time.Unix(ts+1300+3600-DBWriteInterval, 0)},
+		{From: time.Unix(ts+1300+3600, 0), To: time.Unix(ts+1300+3600+86400-DBWriteInterval, 0)},
+	}, d.gaps)
+	require.Equal(t, time.Duration(3600+86400-2*DBWriteInterval)*time.Second, d.gaps.Duration())
+
+	metadata := &InterfaceMetadata{Iface: "eth0"}
+	require.Equal(t, "-", metadata.gapsSummary())
+	metadata.Gaps = d.gaps
+	require.Len(t, metadata.TableRow(true), len(metadata.TableHeader(true)[1]))
+}
@@ -0,0 +1,311 @@
+// Package retention enforces retention policies and storage quotas on a goDB.
+//
+// A retention policy applies to all interfaces of the goDB, limiting the age of the stored data
+// and / or its total on-disk size. Once a limit is exceeded, the oldest (daily) directories are
+// evicted. The same applies if the free space of the file system holding the goDB falls short of
+// a minimum.
+//
+// A quota limits the on-disk size of the data stored for a single interface or a group of
+// interfaces. Once it is exceeded, the oldest (daily) directories of the interface(s) are
+// evicted until the data fits the quota again. Since interfaces commonly differ by orders
+// of magnitude in traffic volume, this allows to retain the history of low-volume interfaces
+// independently of the high-volume ones (as opposed to a global age-based retention policy).
+//
+// The most recent directory of each interface is never evicted, since it is (potentially)
+// still being written to.
+package retention
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"golang.org/x/sys/unix"
+)
+
+// Quota denotes a storage quota shared by a group of interfaces
+type Quota struct {
+	Ifaces   []string // Ifaces denotes the interfaces sharing the quota
+	MaxBytes int64    // MaxBytes denotes the maximum on-disk size of all data stored for the interfaces
+}
+
+// Stats summarizes the evictions performed while enforcing quotas / a retention policy
+type Stats struct {
+	Dirs   int      // Dirs denotes the number of evicted (daily) directories
+	Bytes  int64    // Bytes denotes the total size of all evicted directories
+	Ifaces []string // Ifaces denotes the interfaces for which directories were evicted
+}
+
+// dir denotes a (daily) directory of an interface
+type dir struct {
+	iface     string
+	path      string
+	timestamp int64
+	size      int64
+	current   bool
+}
+
+// Enforce evicts the oldest directories of all interface groups exceeding their quota in the
+// goDB at dbPath
+func Enforce(dbPath string, quotas ...Quota) (*Stats, error) {
+	stats := new(Stats)
+	for _, quota := range quotas {
+		if err := enforce(dbPath, quota, stats); err != nil {
+			return stats, err
+		}
+	}
+	slices.Sort(stats.Ifaces)
+
+	return stats, nil
+}
+
+func enforce(dbPath string, quota Quota, stats *Stats) error {
+	var (
+		dirs  []dir
+		total int64
+	)
+	for _, iface := range quota.Ifaces {
+		ifaceDirs, err := listDirs(filepath.Join(dbPath, iface), iface)
+		if err != nil {
+			return fmt.Errorf("failed to list directories of interface %s: %w", iface, err)
+		}
+		for _, d := range ifaceDirs {
+			total += d.size
+		}
+		dirs = append(dirs, ifaceDirs...)
+	}
+	if total <= quota.MaxBytes {
+		return nil
+	}
+
+	// Evict the oldest directories first (across all interfaces of the group)
+	sortDirs(dirs)
+	for _, d := range dirs {
+		if total <= quota.MaxBytes {
+			break
+		}
+		if d.current {
+			continue
+		}
+		if err := evict(dbPath, d, stats); err != nil {
+			return err
+		}
+		total -= d.size
+	}
+
+	return nil
+}
+
+// EnforceMaxAge evicts all directories of the goDB at dbPath whose data is older than maxAge at
+// the time now (i.e. all days ending before now - maxAge)
+func EnforceMaxAge(dbPath string, maxAge time.Duration, now time.Time) (*Stats, error) {
+	stats := new(Stats)
+
+	ifaces, err := listIfaces(dbPath)
+	if err != nil {
+		return stats, err
+	}
+
+	cutoff := now.Add(-maxAge).Unix()
+	for _, iface := range ifaces {
+		dirs, err := listDirs(filepath.Join(dbPath, iface), iface)
+		if err != nil {
+			return stats, fmt.Errorf("failed to list directories of interface %s: %w", iface, err)
+		}
+		for _, d := range dirs {
+			if d.current || d.timestamp+gpfile.EpochDay > cutoff {
+				continue
+			}
+			if err := evict(dbPath, d, stats); err != nil {
+				return stats, err
+			}
+		}
+	}
+	slices.Sort(stats.Ifaces)
+
+	return stats, nil
+}
+
+// EnforceMaxSize evicts the oldest directories of the goDB at dbPath (across all of its interfaces)
+// until the on-disk size of all data stored fits maxBytes
+func EnforceMaxSize(dbPath string, maxBytes int64) (*Stats, error) {
+	ifaces, err := listIfaces(dbPath)
+	if err != nil {
+		return new(Stats), err
+	}
+	return Enforce(dbPath, Quota{Ifaces: ifaces, MaxBytes: maxBytes})
+}
+
+// EnforceMinFree evicts the oldest directories of the goDB at dbPath (across all of its interfaces)
+// until the file system holding it provides at least minFree bytes of free space (or only the current
+// directory of each interface is left)
+func EnforceMinFree(dbPath string, minFree uint64) (*Stats, error) {
+	return enforceMinFree(dbPath, minFree, FreeSpace)
+}
+
+func enforceMinFree(dbPath string, minFree uint64, freeSpace func(path string) (uint64, error)) (*Stats, error) {
+	stats := new(Stats)
+
+	ifaces, err := listIfaces(dbPath)
+	if err != nil {
+		return stats, err
+	}
+
+	var dirs []dir
+	for _, iface := range ifaces {
+		ifaceDirs, err := listDirs(filepath.Join(dbPath, iface), iface)
+		if err != nil {
+			return stats, fmt.Errorf("failed to list directories of interface %s: %w", iface, err)
+		}
+		dirs = append(dirs, ifaceDirs...)
+	}
+	sortDirs(dirs)
+
+	for _, d := range dirs {
+		free, err := freeSpace(dbPath)
+		if err != nil {
+			return stats, err
+		}
+		if free >= minFree {
+			break
+		}
+		if d.current {
+			continue
+		}
+		if err := evict(dbPath, d, stats); err != nil {
+			return stats, err
+		}
+	}
+	slices.Sort(stats.Ifaces)
+
+	return stats, nil
+}
+
+// FreeSpace returns the free space (available to unprivileged users) of the file system holding path
+func FreeSpace(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed to determine free space of %s: %w", path, err)
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil // #nosec G115
+}
+
+// evict removes a directory (along with its month / year directories if they end up empty) and
+// accounts for it in the stats
+func evict(dbPath string, d dir, stats *Stats) error {
+	if err := os.RemoveAll(d.path); err != nil {
+		return fmt.Errorf("failed to evict directory %s: %w", d.path, err)
+	}
+	removeEmptyParents(d.path, filepath.Join(dbPath, d.iface))
+
+	stats.Dirs++
+	stats.Bytes += d.size
+	if !slices.Contains(stats.Ifaces, d.iface) {
+		stats.Ifaces = append(stats.Ifaces, d.iface)
+	}
+	return nil
+}
+
+// sortDirs sorts directories by age (oldest first, across all interfaces)
+func sortDirs(dirs []dir) {
+	slices.SortFunc(dirs, func(a, b dir) int {
+		if c := cmp.Compare(a.timestamp, b.timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.iface, b.iface)
+	})
+}
+
+// listIfaces returns all interfaces of the goDB at dbPath (none if the goDB doesn't exist yet)
+func listIfaces(dbPath string) ([]string, error) {
+	ifaces, err := info.GetInterfaces(dbPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	return ifaces, nil
+}
+
+// listDirs returns all (daily) directories of an interface along with their on-disk size,
+// marking the most recent one
+func listDirs(ifacePath, iface string) ([]dir, error) {
+	dayPaths, err := filepath.Glob(filepath.Join(ifacePath, "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []dir
+	for _, dayPath := range dayPaths {
+		timestamp, _, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dayPath))
+		if err != nil {
+			continue
+		}
+		size, err := dirSize(dayPath)
+		if err != nil {
+			// The directory has been renamed during writeout in the meantime, skip it (it
+			// will be accounted for during the next run)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		dirs = append(dirs, dir{
+			iface:     iface,
+			path:      dayPath,
+			timestamp: timestamp,
+			size:      size,
+		})
+	}
+
+	if len(dirs) > 0 {
+		latest := 0
+		for i, d := range dirs {
+			if d.timestamp > dirs[latest].timestamp {
+				latest = i
+			}
+		}
+		dirs[latest].current = true
+	}
+
+	return dirs, nil
+}
+
+func dirSize(path string) (size int64, err error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// removeEmptyParents removes the month / year directories of an evicted directory in case
+// they are empty (errors are ignored since a leftover empty directory is harmless)
+func removeEmptyParents(path, ifacePath string) {
+	for parent := filepath.Dir(path); parent != ifacePath && parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+		if err := os.Remove(parent); err != nil {
+			return
+		}
+	}
+}
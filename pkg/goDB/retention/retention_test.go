@@ -0,0 +1,263 @@
+package retention
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTimestamp = int64(1700006400) // 2023-11-15 00:00:00 UTC
+	testDays      = 5
+)
+
+func TestEnforce(t *testing.T) {
+	t.Run("quota not exceeded", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+
+		stats, err := Enforce(dbPath, Quota{Ifaces: []string{"eth0"}, MaxBytes: ifaceSize(t, dbPath, "eth0")})
+		require.Nil(t, err)
+		require.Zero(t, stats.Dirs)
+		require.Len(t, listTimestamps(t, dbPath, "eth0"), testDays)
+	})
+
+	t.Run("single interface", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0", "eth1")
+
+		eth1Size := ifaceSize(t, dbPath, "eth1")
+		stats, err := Enforce(dbPath, Quota{Ifaces: []string{"eth0"}, MaxBytes: ifaceSize(t, dbPath, "eth0") - 1})
+		require.Nil(t, err)
+		require.Equal(t, 1, stats.Dirs)
+		require.Positive(t, stats.Bytes)
+		require.Equal(t, []string{"eth0"}, stats.Ifaces)
+
+		// the oldest directory is evicted, other interfaces are left untouched
+		require.Equal(t, dayTimestamps(1, testDays), listTimestamps(t, dbPath, "eth0"))
+		require.Equal(t, eth1Size, ifaceSize(t, dbPath, "eth1"))
+	})
+
+	t.Run("current directory is retained", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+
+		stats, err := Enforce(dbPath, Quota{Ifaces: []string{"eth0"}, MaxBytes: 1})
+		require.Nil(t, err)
+		require.Equal(t, testDays-1, stats.Dirs)
+		require.Equal(t, dayTimestamps(testDays-1, testDays), listTimestamps(t, dbPath, "eth0"))
+	})
+
+	t.Run("interface group", func(t *testing.T) {
+		dbPath := t.TempDir()
+
+		// eth1 holds only recent data, so the oldest data of the group is stored for eth0
+		writeDays(t, dbPath, nil, "eth0")
+		writeDays(t, dbPath, func(day int) bool { return day >= 3 }, "eth1")
+
+		groupSize := ifaceSize(t, dbPath, "eth0") + ifaceSize(t, dbPath, "eth1")
+		stats, err := Enforce(dbPath, Quota{Ifaces: []string{"eth0", "eth1"}, MaxBytes: groupSize - 1})
+		require.Nil(t, err)
+		require.Equal(t, []string{"eth0"}, stats.Ifaces)
+		require.Equal(t, dayTimestamps(1, testDays), listTimestamps(t, dbPath, "eth0"))
+		require.Equal(t, dayTimestamps(3, testDays), listTimestamps(t, dbPath, "eth1"))
+	})
+
+	t.Run("manifest rebuild", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0", "eth1")
+
+		manifest, err := info.BuildManifest(dbPath)
+		require.Nil(t, err)
+		eth1Manifest := *manifest.Interfaces["eth1"]
+
+		stats, err := Enforce(dbPath, Quota{Ifaces: []string{"eth0"}, MaxBytes: 1})
+		require.Nil(t, err)
+		require.Nil(t, manifest.Rebuild(dbPath, stats.Ifaces...))
+
+		expected, err := info.BuildManifest(dbPath)
+		require.Nil(t, err)
+		require.Equal(t, expected.SizeBytes, manifest.SizeBytes)
+		require.Equal(t, expected.Interfaces["eth0"], manifest.Interfaces["eth0"])
+		require.Equal(t, eth1Manifest, *manifest.Interfaces["eth1"])
+	})
+
+	t.Run("missing interface", func(t *testing.T) {
+		stats, err := Enforce(t.TempDir(), Quota{Ifaces: []string{"eth0"}, MaxBytes: 1})
+		require.Nil(t, err)
+		require.Zero(t, stats.Dirs)
+	})
+}
+
+func TestEnforceMaxAge(t *testing.T) {
+	now := time.Unix(testTimestamp+testDays*gpfile.EpochDay, 0)
+
+	t.Run("data within max age", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+
+		stats, err := EnforceMaxAge(dbPath, testDays*24*time.Hour, now)
+		require.Nil(t, err)
+		require.Zero(t, stats.Dirs)
+		require.Len(t, listTimestamps(t, dbPath, "eth0"), testDays)
+	})
+
+	t.Run("all interfaces", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+		writeDays(t, dbPath, func(day int) bool { return day >= 1 }, "eth1")
+
+		stats, err := EnforceMaxAge(dbPath, 2*24*time.Hour, now)
+		require.Nil(t, err)
+		require.Equal(t, 5, stats.Dirs)
+		require.Positive(t, stats.Bytes)
+		require.Equal(t, []string{"eth0", "eth1"}, stats.Ifaces)
+
+		// only the days ending within the last two days are retained
+		require.Equal(t, dayTimestamps(3, testDays), listTimestamps(t, dbPath, "eth0"))
+		require.Equal(t, dayTimestamps(3, testDays), listTimestamps(t, dbPath, "eth1"))
+	})
+
+	t.Run("current directory is retained", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+
+		stats, err := EnforceMaxAge(dbPath, 0, now.Add(365*24*time.Hour))
+		require.Nil(t, err)
+		require.Equal(t, testDays-1, stats.Dirs)
+		require.Equal(t, dayTimestamps(testDays-1, testDays), listTimestamps(t, dbPath, "eth0"))
+	})
+
+	t.Run("missing DB", func(t *testing.T) {
+		stats, err := EnforceMaxAge(filepath.Join(t.TempDir(), "db"), time.Hour, now)
+		require.Nil(t, err)
+		require.Zero(t, stats.Dirs)
+	})
+}
+
+func TestEnforceMaxSize(t *testing.T) {
+	dbPath := t.TempDir()
+	writeDays(t, dbPath, nil, "eth0")
+	writeDays(t, dbPath, func(day int) bool { return day >= 3 }, "eth1")
+
+	// the oldest data across all interfaces is evicted first
+	totalSize := ifaceSize(t, dbPath, "eth0") + ifaceSize(t, dbPath, "eth1")
+	stats, err := EnforceMaxSize(dbPath, totalSize-1)
+	require.Nil(t, err)
+	require.Equal(t, 1, stats.Dirs)
+	require.Equal(t, []string{"eth0"}, stats.Ifaces)
+	require.Equal(t, dayTimestamps(1, testDays), listTimestamps(t, dbPath, "eth0"))
+	require.Equal(t, dayTimestamps(3, testDays), listTimestamps(t, dbPath, "eth1"))
+
+	stats, err = EnforceMaxSize(filepath.Join(t.TempDir(), "db"), 1)
+	require.Nil(t, err)
+	require.Zero(t, stats.Dirs)
+}
+
+func TestEnforceMinFree(t *testing.T) {
+	t.Run("free space restored", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+		writeDays(t, dbPath, func(day int) bool { return day >= 3 }, "eth1")
+
+		// free space suffices once only three directories are left
+		freeSpace := func(string) (uint64, error) {
+			if len(listTimestamps(t, dbPath, "eth0"))+len(listTimestamps(t, dbPath, "eth1")) <= 3 {
+				return 100, nil
+			}
+			return 0, nil
+		}
+
+		stats, err := enforceMinFree(dbPath, 100, freeSpace)
+		require.Nil(t, err)
+		require.Equal(t, 4, stats.Dirs)
+		require.Equal(t, []string{"eth0"}, stats.Ifaces)
+		require.Equal(t, dayTimestamps(4, testDays), listTimestamps(t, dbPath, "eth0"))
+		require.Equal(t, dayTimestamps(3, testDays), listTimestamps(t, dbPath, "eth1"))
+	})
+
+	t.Run("current directories are retained", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0", "eth1")
+
+		stats, err := enforceMinFree(dbPath, 100, func(string) (uint64, error) { return 0, nil })
+		require.Nil(t, err)
+		require.Equal(t, 2*(testDays-1), stats.Dirs)
+		require.Equal(t, dayTimestamps(testDays-1, testDays), listTimestamps(t, dbPath, "eth0"))
+		require.Equal(t, dayTimestamps(testDays-1, testDays), listTimestamps(t, dbPath, "eth1"))
+	})
+
+	t.Run("sufficient free space", func(t *testing.T) {
+		dbPath := t.TempDir()
+		writeDays(t, dbPath, nil, "eth0")
+
+		stats, err := EnforceMinFree(dbPath, 1)
+		require.Nil(t, err)
+		require.Zero(t, stats.Dirs)
+		require.Len(t, listTimestamps(t, dbPath, "eth0"), testDays)
+	})
+}
+
+// writeDays writes one block per day for all provided interfaces (for all days permitted by
+// the filter, if any)
+func writeDays(t *testing.T, dbPath string, filter func(day int) bool, ifaces ...string) {
+	t.Helper()
+
+	for _, iface := range ifaces {
+		w := goDB.NewDBWriter(dbPath, iface, encoders.EncoderTypeNull)
+		for day := 0; day < testDays; day++ {
+			if filter != nil && !filter(day) {
+				continue
+			}
+			require.Nil(t, w.Write(testFlows(), capturetypes.CaptureStats{}, testTimestamp+int64(day)*gpfile.EpochDay+300))
+		}
+	}
+}
+
+func listTimestamps(t *testing.T, dbPath, iface string) []int64 {
+	t.Helper()
+
+	dirs, err := listDirs(filepath.Join(dbPath, iface), iface)
+	require.Nil(t, err)
+
+	timestamps := make([]int64, 0, len(dirs))
+	for _, d := range dirs {
+		timestamps = append(timestamps, d.timestamp)
+	}
+	return timestamps
+}
+
+func dayTimestamps(from, to int) []int64 {
+	timestamps := make([]int64, 0, to-from)
+	for day := from; day < to; day++ {
+		timestamps = append(timestamps, testTimestamp+int64(day)*gpfile.EpochDay)
+	}
+	return timestamps
+}
+
+func ifaceSize(t *testing.T, dbPath, iface string) (size int64) {
+	t.Helper()
+
+	dirs, err := listDirs(filepath.Join(dbPath, iface), iface)
+	require.Nil(t, err)
+	for _, d := range dirs {
+		size += d.size
+	}
+	return
+}
+
+func testFlows() *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	m.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0, 80}, 6),
+		types.Counters{BytesRcvd: 1, PacketsRcvd: 1})
+	return m
+}
@@ -0,0 +1,354 @@
+// Package snapshot provides means to create consistent point-in-time copies of a goDB
+// while it is being written to (e.g. for backup purposes).
+//
+// A naive recursive copy of a live goDB races with the atomic directory renames performed
+// during writeout (the metadata suffix of a daily directory changes whenever a block is
+// added) and may hence produce broken / incomplete directories. A snapshot avoids this by
+// relying on the guarantees provided by the storage layer:
+//
+//   - the metadata file of a directory is only ever replaced atomically (via rename), so a
+//     copy of it always refers to a consistent state
+//   - data (.gpf) files are written in append-only fashion, so any block referenced by a
+//     given metadata state remains unchanged on disk
+//   - sidecar files (e.g. the block order or the IP index) are replaced atomically and are
+//     validated against the metadata when read, so they may cover more blocks than it
+//
+// Consequently, copying the metadata of a directory first and its data files second yields a
+// consistent directory, even if more blocks are written in the meantime.
+//
+// Files are copied by default. Hardlinking them instead (see WithHardlinks) is instantaneous and
+// does not consume additional disk space, but the snapshot then shares its data files with the
+// live goDB: blocks appended afterwards are reflected in the snapshot, so it is not an independent
+// backup.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// maxResolveAttempts limits how often the source path of a directory is re-resolved in
+// case it was renamed concurrently (which happens at most once per writeout)
+const maxResolveAttempts = 5
+
+var (
+	// ErrDestinationNotEmpty denotes that the snapshot destination already contains data
+	ErrDestinationNotEmpty = errors.New("snapshot destination exists and is not empty")
+)
+
+// Stats summarizes the contents of a snapshot
+type Stats struct {
+	Interfaces int   // Interfaces denotes the number of interfaces contained in the snapshot
+	Dirs       int   // Dirs denotes the number of (daily) directories contained in the snapshot
+	Files      int   // Files denotes the number of files contained in the snapshot
+	Linked     int   // Linked denotes the number of files that were hardlinked instead of copied
+	SizeBytes  int64 // SizeBytes denotes the total size of all files contained in the snapshot
+}
+
+// Option configures the creation of a snapshot
+type Option func(*snapshotter)
+
+// WithHardlinks hardlinks files instead of copying them (falling back to copying if the destination
+// resides on a different file system). Note that the data files are then shared with the source goDB,
+// so any later modification of the latter is reflected in the snapshot
+func WithHardlinks() Option {
+	return func(s *snapshotter) {
+		s.hardlink = true
+	}
+}
+
+// WithPermissions sets the permissions used for directories created in the destination
+func WithPermissions(permissions fs.FileMode) Option {
+	return func(s *snapshotter) {
+		s.permissions = permissions
+	}
+}
+
+type snapshotter struct {
+	src, dst    string
+	hardlink    bool
+	permissions fs.FileMode
+
+	stats Stats
+}
+
+// Create generates a consistent snapshot of the goDB located at dbPath in dst. The destination
+// must either not exist or be an empty directory. Directories of the source which have not
+// yet been committed (i.e. do not contain any metadata) are skipped
+func Create(dbPath, dst string, opts ...Option) (*Stats, error) {
+	s := &snapshotter{
+		src:         filepath.Clean(dbPath),
+		dst:         filepath.Clean(dst),
+		permissions: 0755,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.prepareDestination(); err != nil {
+		return nil, err
+	}
+
+	ifaces, err := info.GetInterfaces(s.src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if err := s.snapshotIface(iface); err != nil {
+			return nil, fmt.Errorf("failed to snapshot interface %s: %w", iface, err)
+		}
+		s.stats.Interfaces++
+	}
+
+	// The manifest and label files are replaced atomically as well, so they can be linked / copied safely.
+	// Since the label files only ever grow, they resolve the labels of all data copied before
+	for _, name := range append([]string{info.ManifestFileName}, info.LabelFileNames...) {
+		if err := s.transferFile(filepath.Join(s.src, name), filepath.Join(s.dst, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", name, err)
+		}
+	}
+
+	return &s.stats, nil
+}
+
+func (s *snapshotter) prepareDestination() error {
+	if rel, err := filepath.Rel(s.src, s.dst); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("snapshot destination %s must not be located inside the DB", s.dst)
+	}
+
+	dirents, err := os.ReadDir(s.dst)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return os.MkdirAll(s.dst, s.permissions)
+		}
+		return err
+	}
+	if len(dirents) > 0 {
+		return fmt.Errorf("%w: %s", ErrDestinationNotEmpty, s.dst)
+	}
+	return nil
+}
+
+func (s *snapshotter) snapshotIface(iface string) error {
+	ifacePath := filepath.Join(s.src, iface)
+	years, err := os.ReadDir(ifacePath)
+	if err != nil {
+		return err
+	}
+	for _, year := range years {
+		if !year.IsDir() {
+			continue
+		}
+		months, err := os.ReadDir(filepath.Join(ifacePath, year.Name()))
+		if err != nil {
+			return err
+		}
+		for _, month := range months {
+			if !month.IsDir() {
+				continue
+			}
+			relMonthPath := filepath.Join(iface, year.Name(), month.Name())
+			days, err := os.ReadDir(filepath.Join(s.src, relMonthPath))
+			if err != nil {
+				return err
+			}
+
+			// Deduplicate by timestamp, a directory might show up under its old and new name
+			// if it is renamed during the listing
+			seen := make(map[int64]struct{}, len(days))
+			for _, day := range days {
+				if !day.IsDir() {
+					continue
+				}
+				dayTimestamp, _, err := gpfile.ExtractTimestampMetadataSuffix(day.Name())
+				if err != nil {
+					continue
+				}
+				if _, exists := seen[dayTimestamp]; exists {
+					continue
+				}
+				seen[dayTimestamp] = struct{}{}
+
+				if err := s.snapshotDir(relMonthPath, dayTimestamp); err != nil {
+					return fmt.Errorf("failed to snapshot directory %d: %w", dayTimestamp, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *snapshotter) snapshotDir(relMonthPath string, dayTimestamp int64) error {
+	prefix := strconv.FormatInt(dayTimestamp, 10)
+
+	// Stage the directory under its bare timestamp, the final name (including the metadata
+	// suffix) is only known once the metadata has been transferred
+	dstMonthPath := filepath.Join(s.dst, relMonthPath)
+	stagingPath := filepath.Join(dstMonthPath, prefix)
+	if err := os.MkdirAll(stagingPath, s.permissions); err != nil {
+		return err
+	}
+
+	// Transfer the metadata first: it pins the set of blocks covered by the snapshot
+	committed, err := s.transferFromDir(relMonthPath, prefix, gpfile.MetadataFileName, stagingPath, true)
+	if err != nil {
+		return err
+	}
+	if !committed {
+		return os.Remove(stagingPath)
+	}
+
+	for _, name := range types.ColumnFileNames {
+		if _, err := s.transferFromDir(relMonthPath, prefix, name+gpfile.FileSuffix, stagingPath, false); err != nil {
+			return err
+		}
+	}
+	for _, name := range gpfile.SidecarFileNames {
+		if _, err := s.transferFromDir(relMonthPath, prefix, name, stagingPath, false); err != nil {
+			return err
+		}
+	}
+
+	// Determine the metadata suffix from the transferred metadata and move the directory
+	// to its final location
+	dir := gpfile.NewDirReader(filepath.Join(s.dst, filepath.Dir(filepath.Dir(relMonthPath))), dayTimestamp, "")
+	if err := dir.Open(); err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	suffix := dir.Metadata.MarshalString()
+	if err := dir.Close(); err != nil {
+		return err
+	}
+	if suffix != "" {
+		if err := os.Rename(stagingPath, stagingPath+suffix); err != nil {
+			return err
+		}
+	}
+	s.stats.Dirs++
+
+	return nil
+}
+
+// transferFromDir links / copies a file from the source directory identified by its timestamp
+// prefix. If the source directory is renamed concurrently, its location is re-resolved. A file
+// (or directory) that does not exist is skipped and reported via the return value (unless it
+// is required to exist, in which case the directory is considered not yet committed)
+func (s *snapshotter) transferFromDir(relMonthPath, prefix, name, dstDir string, required bool) (bool, error) {
+	for i := 0; i < maxResolveAttempts; i++ {
+		srcDir, found, err := s.resolveDir(relMonthPath, prefix)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			// The directory has been removed (e.g. by a cleanup)
+			return false, nil
+		}
+
+		err = s.transferFile(filepath.Join(srcDir, name), filepath.Join(dstDir, name))
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+
+		// If the directory still exists under the same name, the file itself is missing
+		if _, statErr := os.Stat(srcDir); statErr == nil {
+			if required {
+				return false, nil
+			}
+
+			// Data files are only created once a non-empty block is written for a column
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("failed to resolve source of %s: directory renamed too often", name)
+}
+
+func (s *snapshotter) resolveDir(relMonthPath, prefix string) (string, bool, error) {
+	monthPath := filepath.Join(s.src, relMonthPath)
+	days, err := os.ReadDir(monthPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	for _, day := range days {
+		if name := day.Name(); name == prefix || strings.HasPrefix(name, prefix+"_") {
+			return filepath.Join(monthPath, name), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (s *snapshotter) transferFile(src, dst string) error {
+	if s.hardlink {
+		err := os.Link(src, dst)
+		if err == nil {
+			return s.account(dst, true)
+		}
+
+		// Fall back to copying if the destination resides on a different file system (or the
+		// file system does not support hardlinks)
+		if !errors.Is(err, syscall.EXDEV) && !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.ENOTSUP) {
+			return err
+		}
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return s.account(dst, false)
+}
+
+func (s *snapshotter) account(path string, linked bool) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	s.stats.Files++
+	s.stats.SizeBytes += stat.Size()
+	if linked {
+		s.stats.Linked++
+	}
+	return nil
+}
+
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := in.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(filepath.Clean(dst), os.O_CREATE|os.O_EXCL|os.O_WRONLY, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,169 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIface     = "eth0"
+	testTimestamp = int64(1700000000)
+	testInterval  = int64(300)
+)
+
+func TestSnapshot(t *testing.T) {
+	dbPath, dst := t.TempDir(), filepath.Join(t.TempDir(), "snapshot")
+
+	manifest := info.NewManifest()
+	w := goDB.NewDBWriter(dbPath, testIface, encoders.EncoderTypeNull).Manifest(manifest).
+		Origin(gpfile.Origin{Hostname: "probe-a"}).ByteAccounting("l3")
+	for i := int64(0); i < 10; i++ {
+		require.Nil(t, w.Write(testFlows(byte(i)), capturetypes.CaptureStats{}, testTimestamp+i*testInterval))
+	}
+	require.Nil(t, w.Write(testFlows(1), capturetypes.CaptureStats{}, testTimestamp+gpfile.EpochDay))
+	require.Nil(t, manifest.Write(dbPath, 0644))
+
+	tags := info.TagRegistry{}
+	_, err := tags.Register("voip")
+	require.Nil(t, err)
+	require.Nil(t, tags.Write(dbPath, 0644))
+	processes := info.ProcessRegistry{}
+	_, _, err = processes.Register("nginx")
+	require.Nil(t, err)
+	require.Nil(t, processes.Write(dbPath, 0644))
+	zones := info.Zones{testIface: "dmz"}
+	require.Nil(t, zones.Write(dbPath, 0644))
+
+	stats, err := Create(dbPath, dst)
+	require.Nil(t, err)
+	require.Equal(t, 1, stats.Interfaces)
+	require.Equal(t, 2, stats.Dirs)
+	require.Positive(t, stats.SizeBytes)
+	require.Zero(t, stats.Linked)
+
+	_, err = info.ReadManifest(dst)
+	require.Nil(t, err)
+
+	// The tags of the snapshot can be resolved
+	snapshotTags, err := info.ReadTagRegistry(dst)
+	require.Nil(t, err)
+	require.Equal(t, tags, snapshotTags)
+
+	// The processes of the snapshot can be resolved
+	snapshotProcesses, err := info.ReadProcessRegistry(dst)
+	require.Nil(t, err)
+	require.Equal(t, processes, snapshotProcesses)
+
+	// The zones of the snapshot can be resolved
+	snapshotZones, err := info.ReadZones(dst)
+	require.Nil(t, err)
+	require.Equal(t, zones, snapshotZones)
+	require.Equal(t, 11, validateSnapshot(t, dst))
+
+	// All sidecar files of the directories are carried over
+	for _, name := range gpfile.SidecarFileNames {
+		srcFiles, err := filepath.Glob(filepath.Join(dbPath, testIface, "*", "*", "*", name))
+		require.Nil(t, err)
+		require.Len(t, srcFiles, 2, name)
+		dstFiles, err := filepath.Glob(filepath.Join(dst, testIface, "*", "*", "*", name))
+		require.Nil(t, err)
+		require.Len(t, dstFiles, 2, name)
+	}
+
+	t.Run("destination not empty", func(t *testing.T) {
+		_, err := Create(dbPath, dst)
+		require.ErrorIs(t, err, ErrDestinationNotEmpty)
+	})
+
+	t.Run("destination inside DB", func(t *testing.T) {
+		_, err := Create(dbPath, filepath.Join(dbPath, "snapshot"))
+		require.NotNil(t, err)
+	})
+
+	t.Run("hardlinks", func(t *testing.T) {
+		stats, err := Create(dbPath, t.TempDir(), WithHardlinks())
+		require.Nil(t, err)
+		require.Equal(t, stats.Files, stats.Linked)
+	})
+}
+
+func TestSnapshotConcurrentWrites(t *testing.T) {
+	dbPath := t.TempDir()
+
+	w := goDB.NewDBWriter(dbPath, testIface, encoders.EncoderTypeNull)
+	require.Nil(t, w.Write(testFlows(0), capturetypes.CaptureStats{}, testTimestamp))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := int64(1); i < 200; i++ {
+			if err := w.Write(testFlows(byte(i)), capturetypes.CaptureStats{}, testTimestamp+i*testInterval); err != nil {
+				t.Errorf("failed to write block %d: %v", i, err)
+				return
+			}
+		}
+	}()
+
+	// Every snapshot taken while the writer is active must be consistent
+	for i := 0; i < 20; i++ {
+		dst := filepath.Join(t.TempDir(), "snapshot")
+		_, err := Create(dbPath, dst)
+		require.Nil(t, err)
+		require.Positive(t, validateSnapshot(t, dst))
+	}
+	wg.Wait()
+}
+
+// validateSnapshot ensures that all directories of the snapshot are named after their
+// metadata and that all blocks can be read, returning the total number of blocks
+func validateSnapshot(t *testing.T, dbPath string) (nBlocks int) {
+	t.Helper()
+
+	ifacePath := filepath.Join(dbPath, testIface)
+	dirs, err := filepath.Glob(filepath.Join(ifacePath, "*", "*", "*"))
+	require.Nil(t, err)
+	for _, dirPath := range dirs {
+		timestamp, suffix, err := gpfile.ExtractTimestampMetadataSuffix(filepath.Base(dirPath))
+		require.Nil(t, err)
+
+		dir := gpfile.NewDirReader(ifacePath, timestamp, suffix)
+		require.Nil(t, dir.Open())
+		require.Equal(t, "_"+suffix, dir.Metadata.MarshalString())
+
+		for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+			for blockIdx := range dir.BlockMetadata[colIdx].Blocks() {
+				_, err := dir.ReadBlockAtIndex(colIdx, blockIdx)
+				require.Nil(t, err)
+			}
+		}
+		nBlocks += dir.NBlocks()
+		require.Nil(t, dir.Close())
+
+		_, err = os.Stat(filepath.Join(dirPath, gpfile.MetadataFileName))
+		require.Nil(t, err)
+	}
+	return
+}
+
+func testFlows(n byte) *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	for i := byte(0); i <= n%16; i++ {
+		m.PrimaryMap.Set(types.NewV4KeyStatic(
+			[4]byte{10, 0, 0, i},
+			[4]byte{10, 0, 1, i},
+			[]byte{0, 80}, 6), types.Counters{BytesRcvd: uint64(i) + 1, PacketsRcvd: 1})
+	}
+	return m
+}
@@ -0,0 +1,115 @@
+// Package bloom provides a Bloom filter over arbitrary byte sequences (e.g. IP addresses). It answers
+// whether a value may have been added to the filter: false positives are possible (at a rate depending
+// on the size of the filter and the number of values added), while false negatives are not. Filters
+// have a fixed size, hence the false positive rate grows beyond the configured one if more values than
+// anticipated are added (without ever producing false negatives)
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/zeebo/xxh3"
+)
+
+// version denotes the version of the serialized filter layout
+const version = 1
+
+// headerLen denotes the length of the serialized filter header, laid out as follows:
+//
+//	[version (1 byte)][number of hash functions (1 byte)][number of words (4 bytes, big-endian)]
+const headerLen = 6
+
+var (
+	// ErrInvalidFilter denotes that a serialized filter is malformed
+	ErrInvalidFilter = errors.New("invalid bloom filter")
+
+	// ErrUnsupportedVersion denotes that a filter was serialized in an (unknown) layout newer than the
+	// one supported by this release
+	ErrUnsupportedVersion = errors.New("unsupported bloom filter version")
+)
+
+// Filter denotes a Bloom filter
+type Filter struct {
+	words []uint64
+	k     uint8
+}
+
+// New creates a new filter sized for capacity values at the given false positive rate
+func New(capacity uint64, falsePositiveRate float64) *Filter {
+	capacity = max(capacity, 1)
+	falsePositiveRate = min(max(falsePositiveRate, 1e-9), 0.5)
+
+	// optimal number of bits m = -n * ln(p) / ln(2)^2, number of hash functions k = m / n * ln(2)
+	nBits := math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	nWords := uint64(math.Ceil(nBits / 64))
+	k := math.Round(float64(nWords*64) / float64(capacity) * math.Ln2)
+
+	return &Filter{
+		words: make([]uint64, nWords),
+		k:     uint8(min(max(k, 1), math.MaxUint8)),
+	}
+}
+
+// Add adds a value to the filter
+func (f *Filter) Add(value []byte) {
+	h1, h2, nBits := f.hashes(value)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % nBits
+		f.words[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains returns whether the value may have been added to the filter (false if it was definitely not)
+func (f *Filter) Contains(value []byte) bool {
+	h1, h2, nBits := f.hashes(value)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % nBits
+		if f.words[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives the two hashes used to compute the k bit positions of a value (see Kirsch and
+// Mitzenmacher, "Less Hashing, Same Performance: Building a Better Bloom Filter")
+func (f *Filter) hashes(value []byte) (h1, h2, nBits uint64) {
+	h := xxh3.Hash128(value)
+	return h.Lo, h.Hi | 1, uint64(len(f.words)) * 64
+}
+
+// MarshalBinary serializes the filter
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerLen+8*len(f.words))
+	data[0] = version
+	data[1] = f.k
+	binary.BigEndian.PutUint32(data[2:headerLen], uint32(len(f.words)))
+	for i, word := range f.words {
+		binary.BigEndian.PutUint64(data[headerLen+8*i:], word)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary deserializes a filter serialized via MarshalBinary
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen {
+		return fmt.Errorf("%w: input too short (len: %d)", ErrInvalidFilter, len(data))
+	}
+	if data[0] > version {
+		return fmt.Errorf("%w: %d (supported up to %d)", ErrUnsupportedVersion, data[0], version)
+	}
+	nWords := int(binary.BigEndian.Uint32(data[2:headerLen]))
+	if data[1] == 0 || nWords == 0 || len(data) != headerLen+8*nWords {
+		return fmt.Errorf("%w: inconsistent header (k: %d, words: %d, len: %d)", ErrInvalidFilter, data[1], nWords, len(data))
+	}
+
+	f.k = data[1]
+	f.words = make([]uint64, nWords)
+	for i := range f.words {
+		f.words[i] = binary.BigEndian.Uint64(data[headerLen+8*i:])
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func value(i uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, i)
+}
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+
+	f := New(n, 0.01)
+	for i := uint32(0); i < n; i++ {
+		f.Add(value(i))
+	}
+
+	// no false negatives
+	for i := uint32(0); i < n; i++ {
+		require.True(t, f.Contains(value(i)))
+	}
+
+	// false positives roughly at the configured rate
+	var falsePositives int
+	for i := uint32(n); i < 11*n; i++ {
+		if f.Contains(value(i)) {
+			falsePositives++
+		}
+	}
+	require.Less(t, float64(falsePositives)/(10*n), 0.02)
+}
+
+func TestMarshal(t *testing.T) {
+	f := New(100, 0.01)
+	f.Add([]byte{10, 0, 0, 1})
+
+	data, err := f.MarshalBinary()
+	require.Nil(t, err)
+
+	var g Filter
+	require.Nil(t, g.UnmarshalBinary(data))
+	require.Equal(t, f, &g)
+	require.True(t, g.Contains([]byte{10, 0, 0, 1}))
+
+	require.ErrorIs(t, g.UnmarshalBinary(data[:headerLen-1]), ErrInvalidFilter)
+	require.ErrorIs(t, g.UnmarshalBinary(data[:len(data)-1]), ErrInvalidFilter)
+
+	data[0] = version + 1
+	require.ErrorIs(t, g.UnmarshalBinary(data), ErrUnsupportedVersion)
+}
@@ -0,0 +1,142 @@
+// Package deltapack provides adaptive bitpacking of counter columns. In addition to plain bitpacking,
+// values are optionally delta / zigzag encoded prior to packing if doing so reduces the size of the
+// packed column (e.g. if values within a block are clustered). The packed data itself does not indicate
+// the chosen encoding. Instead, it is flagged in the encoder type of the block the column is stored in
+// (see encoders.FlagDeltaPacked), so columns packed without delta encoding (including all columns written
+// prior to its introduction) remain plain bitpack slices, while releases not supporting delta encoding
+// reject delta encoded blocks as being of an unknown encoder type (instead of misinterpreting them)
+package deltapack
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/fako1024/gotools/bitpack"
+)
+
+// deltaBaseLen denotes the number of bytes used to store the first (i.e. base) value of a delta
+// encoded column (following the header byte)
+const deltaBaseLen = 8
+
+// Pack compresses a slice of uint64 values into a byte slice using the minimal possible number of
+// bytes per value, applying delta / zigzag encoding if it reduces the size of the packed column (as
+// indicated by the second return value)
+//
+// Delta encoded columns are laid out as follows:
+//
+//	[width][first value (8 bytes, little-endian)][zigzag deltas (width bytes each, little-endian)]
+func Pack(data []uint64) ([]byte, bool) {
+	if len(data) < 2 {
+		return bitpack.Pack(data), false
+	}
+
+	// The byte width of a value is determined by its highest bit, hence the OR'ed values are sufficient
+	maxVal, maxDelta := data[0], uint64(0)
+	for i := 1; i < len(data); i++ {
+		maxVal |= data[i]
+		maxDelta |= zigzag(data[i] - data[i-1])
+	}
+
+	// Delta encoding only pays off if the column becomes smaller (taking into account the base value)
+	rawWidth, deltaWidth := byteWidth(maxVal), byteWidth(maxDelta)
+	if 1+deltaBaseLen+(len(data)-1)*deltaWidth >= 1+len(data)*rawWidth {
+		return bitpack.Pack(data), false
+	}
+
+	b := make([]byte, 1+deltaBaseLen+(len(data)-1)*deltaWidth)
+	b[0] = byte(deltaWidth)
+	binary.LittleEndian.PutUint64(b[1:], data[0])
+
+	var buf [8]byte
+	for i, pos := 1, 1+deltaBaseLen; i < len(data); i, pos = i+1, pos+deltaWidth {
+		binary.LittleEndian.PutUint64(buf[:], zigzag(data[i]-data[i-1]))
+		copy(b[pos:pos+deltaWidth], buf[:deltaWidth])
+	}
+
+	return b, true
+}
+
+// UnpackInto decompresses a packed byte slice (delta encoded or not) into a pre-existing slice of uint64
+// values (which will be allocated / grown in case its capacity is insufficient)
+func UnpackInto(b []byte, isDelta bool, res []uint64) []uint64 {
+	if !isDelta {
+		return bitpack.UnpackInto(b, res)
+	}
+
+	n := Len(b, true)
+	if n == 0 {
+		return res[:0]
+	}
+	if cap(res) < n {
+		res = make([]uint64, n, n*2)
+	}
+	res = res[:n]
+
+	var (
+		width = ByteWidth(b)
+		mask  = uint64(1)<<(8*width) - 1
+		pos   = 1 + deltaBaseLen
+		val   = binary.LittleEndian.Uint64(b[1:])
+	)
+	if width == 8 {
+		mask = ^uint64(0)
+	}
+	res[0] = val
+
+	// As long as at least 8 bytes remain, each delta can be read as a full (masked) uint64, otherwise
+	// its bytes are read individually
+	i := 1
+	for ; i < n && pos+8 <= len(b); i, pos = i+1, pos+width {
+		val += unzigzag(binary.LittleEndian.Uint64(b[pos:]) & mask)
+		res[i] = val
+	}
+	for ; i < n; i, pos = i+1, pos+width {
+		var z uint64
+		for j := width - 1; j >= 0; j-- {
+			z = z<<8 | uint64(b[pos+j])
+		}
+		val += unzigzag(z)
+		res[i] = val
+	}
+
+	return res
+}
+
+// Unpack decompresses a packed byte slice (delta encoded or not) into the original slice of uint64 values
+func Unpack(b []byte, isDelta bool) []uint64 {
+	return UnpackInto(b, isDelta, nil)
+}
+
+// Len returns the number of encoded elements in the packed byte slice (delta encoded or not)
+func Len(b []byte, isDelta bool) int {
+	if !isDelta {
+		return bitpack.Len(b)
+	}
+	width := ByteWidth(b)
+	if width == 0 || len(b) < 1+deltaBaseLen {
+		return 0
+	}
+	return 1 + (len(b)-1-deltaBaseLen)/width
+}
+
+// ByteWidth returns the amount of bytes used to encode each (delta) element in the packed byte slice
+func ByteWidth(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+	return int(b[0])
+}
+
+// zigzag maps the (two's complement) difference of two values to an unsigned integer such that small
+// negative differences remain small
+func zigzag(d uint64) uint64 {
+	return (d << 1) ^ uint64(int64(d)>>63)
+}
+
+func unzigzag(z uint64) uint64 {
+	return (z >> 1) ^ -(z & 1)
+}
+
+func byteWidth(v uint64) int {
+	return max(1, (bits.Len64(v)+7)/8)
+}
@@ -0,0 +1,133 @@
+package deltapack
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fako1024/gotools/bitpack"
+	"github.com/stretchr/testify/require"
+)
+
+const benchmarkBlockSize = 10000
+
+var testCases = []struct {
+	name    string
+	input   []uint64
+	isDelta bool
+}{
+	{"empty", nil, false},
+	{"single", []uint64{1 << 40}, false},
+	{"small values", []uint64{1, 2, 3, 255, 0, 17}, false},
+	{"clustered", []uint64{1 << 32, 1<<32 + 10, 1<<32 - 100, 1<<32 + 5}, true},
+	{"monotonic", []uint64{1000000, 1000001, 1000002, 1000100, 1000200}, true},
+	{"unclustered", []uint64{1 << 40, 3, 1 << 39, 7}, false},
+	{"max values", []uint64{math.MaxUint64, math.MaxUint64 - 1, math.MaxUint64}, true},
+	{"wraparound", []uint64{0, math.MaxUint64, 0, math.MaxUint64}, true},
+	{"alternating", []uint64{1 << 20, 1<<20 - 1, 1 << 20, 1<<20 - 1}, true},
+}
+
+func TestPackUnpack(t *testing.T) {
+	for _, cs := range testCases {
+		t.Run(cs.name, func(t *testing.T) {
+			b, isDelta := Pack(cs.input)
+			require.Equal(t, cs.isDelta, isDelta)
+			require.Equal(t, len(cs.input), Len(b, isDelta))
+			require.LessOrEqual(t, len(b), len(bitpack.Pack(cs.input)))
+
+			// columns packed without delta encoding are plain bitpack slices
+			if !isDelta {
+				require.Equal(t, bitpack.Pack(cs.input), b)
+			}
+
+			res := Unpack(b, isDelta)
+			require.Equal(t, cs.input, res)
+
+			// decoding must not alter the packed data, allowing it to be decoded again
+			res = UnpackInto(b, isDelta, res)
+			require.Equal(t, cs.input, res)
+		})
+	}
+}
+
+func TestLegacyBlocks(t *testing.T) {
+	for _, cs := range testCases {
+		t.Run(cs.name, func(t *testing.T) {
+			b := bitpack.Pack(cs.input)
+			require.Equal(t, bitpack.Len(b), Len(b, false))
+			require.Equal(t, cs.input, Unpack(b, false))
+		})
+	}
+}
+
+func TestRandomRoundtrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for _, spread := range []uint64{1, 1 << 8, 1 << 16, 1 << 32, math.MaxUint64} {
+		t.Run(fmt.Sprintf("spread %d", spread), func(t *testing.T) {
+			input := genClustered(rnd, 1<<40, spread, 1000)
+			require.Equal(t, input, Unpack(Pack(input)))
+		})
+	}
+}
+
+func BenchmarkPack(b *testing.B) {
+	for _, spread := range []uint64{1 << 8, 1 << 32} {
+		input := genClustered(rand.New(rand.NewSource(42)), 1<<40, spread, benchmarkBlockSize)
+		b.Run(fmt.Sprintf("bitpack spread %d", spread), func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = bitpack.Pack(input)
+			}
+			b.ReportMetric(float64(len(bitpack.Pack(input))), "bytes/block")
+		})
+		b.Run(fmt.Sprintf("deltapack spread %d", spread), func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = Pack(input)
+			}
+			packed, _ := Pack(input)
+			b.ReportMetric(float64(len(packed)), "bytes/block")
+		})
+	}
+}
+
+func BenchmarkUnpack(b *testing.B) {
+	for _, spread := range []uint64{1 << 8, 1 << 32} {
+		var (
+			input = genClustered(rand.New(rand.NewSource(42)), 1<<40, spread, benchmarkBlockSize)
+			res   = make([]uint64, benchmarkBlockSize)
+		)
+		b.Run(fmt.Sprintf("bitpack spread %d", spread), func(b *testing.B) {
+			packed := bitpack.Pack(input)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				res = bitpack.UnpackInto(packed, res)
+			}
+		})
+		b.Run(fmt.Sprintf("deltapack spread %d", spread), func(b *testing.B) {
+			packed, isDelta := Pack(input)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				res = UnpackInto(packed, isDelta, res)
+			}
+		})
+	}
+}
+
+// genClustered generates n values randomly distributed around base within the given spread
+func genClustered(rnd *rand.Rand, base, spread uint64, n int) []uint64 {
+	res := make([]uint64, n)
+	for i := range res {
+		if spread == math.MaxUint64 {
+			res[i] = rnd.Uint64()
+			continue
+		}
+		res[i] = base - spread/2 + uint64(rnd.Int63n(int64(spread)))
+	}
+	return res
+}
@@ -0,0 +1,56 @@
+package gpfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+)
+
+// ByteAccountingFileName denotes the name of the file holding the byte accounting bases of the data of a GPDir
+const ByteAccountingFileName = ".accounting"
+
+// ByteAccounting reads the (sorted, distinct) bases the traffic volume of the data of the GPDir was accounted
+// on. If none are stored (e.g. because the directory was written by an older release), nil is returned. It does
+// not require the GPDir to be open
+func (d *GPDir) ByteAccounting() ([]string, error) {
+	return readByteAccounting(d.dirPath)
+}
+
+// readByteAccounting reads the byte accounting bases from the GPDir path (returning nil if there are none)
+func readByteAccounting(dirPath string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, ByteAccountingFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The bases are stored as (sorted) lines of text
+	return strings.Fields(string(data)), nil
+}
+
+// byteAccountingStored determines the byte accounting bases of the GPDir (adding the bases of the data
+// written to the ones stored), returning whether they are stored already
+func (d *GPDir) byteAccountingStored(stored []string) bool {
+	d.accountingBases = stored
+	for _, basis := range d.accountingWritten {
+		if !slices.Contains(d.accountingBases, basis) {
+			d.accountingBases = append(d.accountingBases, basis)
+		}
+	}
+	slices.Sort(d.accountingBases)
+	return len(d.accountingBases) == len(stored)
+}
+
+// writeByteAccountingAtomic writes the byte accounting bases to the GPDir path (via a temporary file, so
+// that readers never observe partially written bases)
+func writeByteAccountingAtomic(dirPath string, bases []string, permissions fs.FileMode) error {
+	return fsutil.WriteAtomic(filepath.Join(dirPath, ByteAccountingFileName),
+		[]byte(strings.Join(bases, "\n")+"\n"), permissions)
+}
@@ -0,0 +1,147 @@
+package gpfile
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/els0r/goProbe/pkg/goDB/encoder"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/null"
+)
+
+const (
+	// DefaultMinCompressedBlockSize denotes the default minimum size of a block for it to be compressed
+	// in adaptive encoding mode (smaller blocks are stored uncompressed)
+	DefaultMinCompressedBlockSize = 512
+
+	// adaptiveSampleSize denotes the (maximum) number of bytes of a block compressed in order to determine
+	// the achievable compression ratio
+	adaptiveSampleSize = 4096
+
+	// adaptiveMinGain denotes the minimum relative size reduction of the sample for a block to be
+	// compressed at all (blocks compressing worse are stored uncompressed)
+	adaptiveMinGain = 0.1
+
+	// adaptiveMinZSTDGain denotes the minimum relative size reduction of the sample compressed by ZSTD
+	// compared to LZ4 for ZSTD to be selected (CPUBudgetMedium only)
+	adaptiveMinZSTDGain = 0.2
+)
+
+// CPUBudget denotes the CPU time which may be spent on the compression of blocks in adaptive encoding
+// mode
+type CPUBudget int
+
+const (
+	// CPUBudgetLow restricts the compression of blocks to LZ4
+	CPUBudgetLow CPUBudget = iota
+
+	// CPUBudgetMedium selects ZSTD for blocks where it compresses considerably better than LZ4
+	// (and LZ4 otherwise)
+	CPUBudgetMedium
+
+	// CPUBudgetHigh selects ZSTD for all blocks worth compressing
+	CPUBudgetHigh
+)
+
+var cpuBudgetNames = map[CPUBudget]string{
+	CPUBudgetLow:    "low",
+	CPUBudgetMedium: "medium",
+	CPUBudgetHigh:   "high",
+}
+
+// String returns a string representation of the CPU budget
+func (b CPUBudget) String() string {
+	return cpuBudgetNames[b]
+}
+
+// GetCPUBudgetByString returns the CPU budget based on a named string
+func GetCPUBudgetByString(s string) (CPUBudget, error) {
+	for budget, name := range cpuBudgetNames {
+		if strings.EqualFold(s, name) {
+			return budget, nil
+		}
+	}
+	return CPUBudgetLow, fmt.Errorf("unsupported CPU budget: %v", s)
+}
+
+// AdaptiveEncoding denotes the configuration of the per-block selection of the encoder, based on
+// the compression ratio achieved on a sample of each block and the CPU budget
+type AdaptiveEncoding struct {
+	CPUBudget CPUBudget // CPUBudget governs which encoders may be selected
+
+	// MinBlockSize denotes the minimum size of a block for it to be compressed, since compressing
+	// small blocks costs CPU time without any significant gain (uses DefaultMinCompressedBlockSize
+	// if zero)
+	MinBlockSize int
+}
+
+// selectEncoder returns the encoder used to write the block data. Unless adaptive encoding is enabled,
+// the default encoder is used for all blocks
+func (g *GPFile) selectEncoder(blockData []byte) (encoder.Encoder, error) {
+	if g.adaptiveEncoding == nil {
+		return g.defaultEncoder, nil
+	}
+
+	minBlockSize := g.adaptiveEncoding.MinBlockSize
+	if minBlockSize == 0 {
+		minBlockSize = DefaultMinCompressedBlockSize
+	}
+	if len(blockData) < minBlockSize {
+		return null.DefaultEncoder, nil
+	}
+
+	sample := blockData[:min(len(blockData), adaptiveSampleSize)]
+
+	// With a high budget, ZSTD is used for all blocks worth compressing
+	if g.adaptiveEncoding.CPUBudget == CPUBudgetHigh {
+		zstdEnc, nZSTD, err := g.compressSample(encoders.EncoderTypeZSTD, sample)
+		if err != nil {
+			return nil, err
+		}
+		if !hasGain(nZSTD, len(sample), adaptiveMinGain) {
+			return null.DefaultEncoder, nil
+		}
+		return zstdEnc, nil
+	}
+
+	lz4Enc, nLZ4, err := g.compressSample(encoders.EncoderTypeLZ4, sample)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a medium budget, ZSTD is used if it compresses the sample considerably better than LZ4
+	if g.adaptiveEncoding.CPUBudget == CPUBudgetMedium {
+		zstdEnc, nZSTD, err := g.compressSample(encoders.EncoderTypeZSTD, sample)
+		if err != nil {
+			return nil, err
+		}
+		if hasGain(nZSTD, len(sample), adaptiveMinGain) && hasGain(nZSTD, nLZ4, adaptiveMinZSTDGain) {
+			return zstdEnc, nil
+		}
+	}
+
+	if !hasGain(nLZ4, len(sample), adaptiveMinGain) {
+		return null.DefaultEncoder, nil
+	}
+	return lz4Enc, nil
+}
+
+// compressSample compresses the sample using the encoder of the given type and returns the encoder
+// along with the compressed size of the sample
+func (g *GPFile) compressSample(encType encoders.Type, sample []byte) (encoder.Encoder, int, error) {
+	enc, err := g.codec(encType)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := enc.Compress(sample, g.blockData, io.Discard)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to compress sample with %s encoder: %w", encType, err)
+	}
+	return enc, n, nil
+}
+
+// hasGain returns if a size reduces the reference size by at least the relative minimum gain
+func hasGain(size, refSize int, minGain float64) bool {
+	return float64(size) <= float64(refSize)*(1-minGain)
+}
@@ -0,0 +1,280 @@
+package gpfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/storage"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const (
+
+	// blockFrameMagic denotes the magic number each block frame header starts with ("GPBF")
+	blockFrameMagic uint32 = 0x47504246
+
+	// blockFrameHeaderLen denotes the size of a block frame header:
+	//
+	//	[magic (4)][timestamp (8)][Len (4)][RawLen (4)][EncoderType (1)][CRC32 of the data (4)][CRC32 of the header (4)]
+	blockFrameHeaderLen = 29
+)
+
+// ErrNoBlockFrames denotes that the column files of a GPDir have not been written with block frames
+// (see WithBlockFrames), hence its metadata cannot be rebuilt from them
+var ErrNoBlockFrames = errors.New("column files without block frames")
+
+// blockFrame denotes a block found in a column file written with block frames (the offset of the block
+// pointing to its data, i.e. following its frame header)
+type blockFrame struct {
+	storage.BlockAtTime
+	crc uint32
+}
+
+// putBlockFrameHeader serializes the frame header of a block into the provided buffer
+func putBlockFrameHeader(header []byte, frame blockFrame) {
+	_ = header[blockFrameHeaderLen-1] // Compiler hint
+
+	binary.BigEndian.PutUint32(header[0:4], blockFrameMagic)
+	binary.BigEndian.PutUint64(header[4:12], uint64(frame.Timestamp))
+	binary.BigEndian.PutUint32(header[12:16], frame.Len)
+	binary.BigEndian.PutUint32(header[16:20], frame.RawLen)
+	header[20] = byte(frame.EncoderType)
+	binary.BigEndian.PutUint32(header[21:25], frame.crc)
+	binary.BigEndian.PutUint32(header[25:29], crc32.ChecksumIEEE(header[0:25]))
+}
+
+// parseBlockFrameHeader deserializes the frame header of a block (whose data follows at the given offset),
+// returning false if it is not a valid frame header
+func parseBlockFrameHeader(header []byte, offset uint64) (blockFrame, bool) {
+	_ = header[blockFrameHeaderLen-1] // Compiler hint
+
+	if binary.BigEndian.Uint32(header[0:4]) != blockFrameMagic ||
+		binary.BigEndian.Uint32(header[25:29]) != crc32.ChecksumIEEE(header[0:25]) {
+		return blockFrame{}, false
+	}
+
+	return blockFrame{
+		BlockAtTime: storage.BlockAtTime{
+			Timestamp: int64(binary.BigEndian.Uint64(header[4:12])),
+			Block: storage.Block{
+				Offset:      offset,
+				Len:         binary.BigEndian.Uint32(header[12:16]),
+				RawLen:      binary.BigEndian.Uint32(header[16:20]),
+				EncoderType: encoders.Type(header[20]),
+			},
+		},
+		crc: binary.BigEndian.Uint32(header[21:25]),
+	}, true
+}
+
+// writeBlockFrame writes the frame header of a block followed by its (compressed) data, which has been
+// buffered in frameData
+func (g *GPFile) writeBlockFrame(timestamp int64, block storage.Block) error {
+	var header [blockFrameHeaderLen]byte
+	putBlockFrameHeader(header[:], blockFrame{
+		BlockAtTime: storage.BlockAtTime{Timestamp: timestamp, Block: block},
+		crc:         crc32.ChecksumIEEE(g.frameData.Bytes()),
+	})
+	if _, err := g.fileWriteBuffer.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := g.frameData.WriteTo(g.fileWriteBuffer)
+	return err
+}
+
+// scanBlockFrames reads the block frames of a column file in the order they were written. Scanning stops
+// at the first frame whose header or data is invalid or incomplete (e.g. after an unclean shutdown). If the
+// file does not start with a valid frame, it has not been written with block frames (ErrNoBlockFrames)
+func scanBlockFrames(path string) ([]blockFrame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var (
+		frames []blockFrame
+		header [blockFrameHeaderLen]byte
+		offset uint64
+		r      = bufio.NewReader(file)
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return frames, nil
+			}
+			return nil, err
+		}
+		frame, valid := parseBlockFrameHeader(header[:], offset+blockFrameHeaderLen)
+		if !valid && offset == 0 {
+			return nil, ErrNoBlockFrames
+		}
+		if !valid {
+			return frames, nil
+		}
+
+		hash := crc32.NewIEEE()
+		n, err := io.CopyN(hash, r, int64(frame.Len))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if n != int64(frame.Len) || hash.Sum32() != frame.crc {
+			return frames, nil
+		}
+
+		frames = append(frames, frame)
+		offset = frame.Offset + uint64(frame.Len)
+	}
+}
+
+// rebuildMetadata rebuilds the metadata of a GPDir whose column files have been written with block frames
+// by scanning the frames of all columns. Only blocks present in all mandatory columns (i.e. the ones of the
+// initial header version) are recovered, and the frames of each column are only considered up to the first
+// one of a block not recovered (subsequent writes overwrite them). The traffic of each block is derived from
+// its IP / protocol columns and the counters from its counter columns, whereas the number of dropped packets
+// (not contained in the column files) is lost. Likewise, blocks without any flows are not contained in the
+// column files and hence lost as well
+func (d *GPDir) rebuildMetadata() error {
+
+	var frames [types.ColIdxCount][]blockFrame
+	for colIdx := range frames {
+		colFrames, err := scanBlockFrames(filepath.Join(d.dirPath, types.ColumnFileNames[colIdx]+FileSuffix))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("%w: column %s", err, types.ColumnFileNames[colIdx])
+		}
+		frames[colIdx] = colFrames
+	}
+
+	// Determine the blocks present in all mandatory columns and cut the frames of all columns at the first
+	// frame of a block not present, until all remaining frames belong to a recovered block
+	var timestamps []int64
+	for {
+		counts := make(map[int64]int)
+		for colIdx := types.ColumnIndex(0); colIdx < types.TagsColIdx; colIdx++ {
+			for _, frame := range frames[colIdx] {
+				counts[frame.Timestamp]++
+			}
+		}
+
+		cut := false
+		for colIdx := range frames {
+			for i, frame := range frames[colIdx] {
+				if counts[frame.Timestamp] != int(types.TagsColIdx) {
+					frames[colIdx], cut = frames[colIdx][:i], true
+					break
+				}
+			}
+		}
+		if !cut {
+			timestamps = timestamps[:0]
+			for timestamp, count := range counts {
+				if count == int(types.TagsColIdx) {
+					timestamps = append(timestamps, timestamp)
+				}
+			}
+			slices.Sort(timestamps)
+			break
+		}
+	}
+	if len(timestamps) == 0 {
+		return ErrNoBlockFrames
+	}
+
+	meta := newMetadata()
+	for colIdx, colFrames := range frames {
+		header := meta.BlockMetadata[colIdx]
+		for _, frame := range colFrames {
+			header.CurrentOffset = max(header.CurrentOffset, frame.Offset+uint64(frame.Len))
+		}
+		header.BlockList = make([]storage.BlockAtTime, len(timestamps))
+		for i, timestamp := range timestamps {
+			header.BlockList[i] = storage.BlockAtTime{
+				Timestamp: timestamp,
+				Block: storage.Block{
+					Offset:      header.CurrentOffset,
+					EncoderType: encoders.EncoderTypeNull,
+				},
+			}
+			if j := slices.IndexFunc(colFrames, func(frame blockFrame) bool {
+				return frame.Timestamp == timestamp
+			}); j >= 0 {
+				header.BlockList[i].Block = colFrames[j].Block
+			}
+		}
+	}
+
+	// Derive the number of IPv4 / IPv6 entries of each block from the length of its protocol (one byte per
+	// entry) and source IP column
+	const ipv4Width, ipv6Width = uint64(types.IPv4Width), uint64(types.IPv6Width)
+	meta.BlockTraffic = make([]TrafficMetadata, len(timestamps))
+	for i := range timestamps {
+		nEntries := uint64(meta.BlockMetadata[types.ProtoColIdx].BlockList[i].RawLen) / uint64(types.ProtoSizeof)
+		sipLen := uint64(meta.BlockMetadata[types.SIPColIdx].BlockList[i].RawLen)
+		if sipLen < nEntries*ipv4Width || (sipLen-nEntries*ipv4Width)%(ipv6Width-ipv4Width) != 0 {
+			return fmt.Errorf("%w: block at %d holds %d bytes of IPs for %d entries", ErrInconsistentBlocks, timestamps[i], sipLen, nEntries)
+		}
+		meta.BlockTraffic[i].NumV6Entries = (sipLen - nEntries*ipv4Width) / (ipv6Width - ipv4Width)
+		meta.BlockTraffic[i].NumV4Entries = nEntries - meta.BlockTraffic[i].NumV6Entries
+		meta.Traffic = meta.Traffic.Add(meta.BlockTraffic[i])
+	}
+
+	// Recompute the counters from the blocks
+	for colIdx, counter := range map[types.ColumnIndex]*uint64{
+		types.BytesRcvdColIdx:   &meta.Counts.BytesRcvd,
+		types.BytesSentColIdx:   &meta.Counts.BytesSent,
+		types.PacketsRcvdColIdx: &meta.Counts.PacketsRcvd,
+		types.PacketsSentColIdx: &meta.Counts.PacketsSent,
+	} {
+		if err := sumCounters(filepath.Join(d.dirPath, types.ColumnFileNames[colIdx]+FileSuffix), meta.BlockMetadata[colIdx], meta.BlockTraffic, counter, d.options...); err != nil {
+			return fmt.Errorf("failed to read column %s: %w", types.ColumnFileNames[colIdx], err)
+		}
+	}
+
+	d.Metadata = meta
+	d.Metadata.Version = d.requiredHeaderVersion()
+
+	return nil
+}
+
+// sumCounters adds up the values of all blocks of a counter column, verifying that each of them holds
+// the number of entries of the respective block
+func sumCounters(path string, header *storage.BlockHeader, blockTraffic []TrafficMetadata, sum *uint64, options ...Option) error {
+	column, err := New(path, header, ModeRead, options...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = column.Close()
+	}()
+
+	for i, block := range header.BlockList {
+		data, err := column.ReadBlockAtIndex(i)
+		if err != nil {
+			return err
+		}
+		values := deltapack.Unpack(data, block.EncoderType.IsDeltaPacked())
+		if nEntries := blockTraffic[i].NumV4Entries + blockTraffic[i].NumV6Entries; uint64(len(values)) != nEntries {
+			return fmt.Errorf("%w: block at %d holds %d instead of %d entries", ErrInconsistentBlocks, block.Timestamp, len(values), nEntries)
+		}
+		for _, v := range values {
+			*sum += v
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package gpfile
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+)
+
+// BlockOrderFileName denotes the name of the file holding the order of the entries of all blocks of a GPDir
+const BlockOrderFileName = ".blockorder"
+
+// BlockOrder denotes the order of the entries within a block
+type BlockOrder uint8
+
+const (
+
+	// BlockOrderUnsorted denotes a block whose entries are stored in arbitrary order (e.g. because it was
+	// written by an older release)
+	BlockOrderUnsorted BlockOrder = iota
+
+	// BlockOrderSorted denotes a block whose IPv4 and IPv6 entries are each sorted by protocol, destination
+	// port, source IP and destination IP (comparing their raw representation)
+	BlockOrderSorted
+)
+
+// BlockOrderAtIndex returns the order of the entries of the block at a given block index. Blocks not
+// covered by the block order file (e.g. because they were written by an older release) are considered
+// unsorted
+func (d *GPDir) BlockOrderAtIndex(blockIdx int) BlockOrder {
+
+	// In read mode, the block order file is only read once it is actually required
+	if !d.blockOrderLoaded {
+		d.blockOrder = d.readBlockOrder()
+		d.blockOrderLoaded = true
+	}
+
+	if blockIdx < len(d.blockOrder) {
+		return d.blockOrder[blockIdx]
+	}
+	return BlockOrderUnsorted
+}
+
+// readBlockOrder reads the block order from the GPDir path. An order covering more blocks than the GPDir
+// holds is inconsistent and hence discarded (considering all blocks unsorted), whereas any blocks missing
+// from it (i.e. appended by an older release) are considered unsorted
+func (d *GPDir) readBlockOrder() []BlockOrder {
+	data, err := os.ReadFile(filepath.Join(d.dirPath, BlockOrderFileName))
+	if err != nil || len(data) > len(d.BlockTraffic) {
+		return nil
+	}
+
+	order := make([]BlockOrder, len(data), len(d.BlockTraffic))
+	for i, b := range data {
+		order[i] = BlockOrder(b)
+	}
+	return order
+}
+
+// writeBlockOrderAtomic writes the block order to the GPDir path (via a temporary file, so that readers
+// never observe a partially written order)
+func writeBlockOrderAtomic(dirPath string, order []BlockOrder, permissions fs.FileMode) (err error) {
+	data := make([]byte, len(order))
+	for i, o := range order {
+		data[i] = byte(o)
+	}
+
+	return fsutil.WriteAtomic(filepath.Join(dirPath, BlockOrderFileName), data, permissions)
+}
@@ -0,0 +1,207 @@
+package gpfile
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+)
+
+const (
+
+	// FlowSizesFileName denotes the name of the file holding the flow size histograms of the blocks of a GPDir
+	FlowSizesFileName = ".flowsizes"
+
+	// NumFlowSizeBuckets denotes the number of (log-scale) buckets of a FlowSizeHistogram, covering the
+	// full range of uint64 values
+	NumFlowSizeBuckets = 65
+)
+
+// ErrInvalidFlowSizes denotes that the flow size histograms of a GPDir cannot be decoded
+var ErrInvalidFlowSizes = errors.New("invalid flow size histograms")
+
+// FlowSizeHistogram denotes a histogram over the sizes of flows on a log2 scale: bucket 0 counts all
+// flows of size zero or one, any other bucket i the flows of a size in (2^(i-1), 2^i]
+type FlowSizeHistogram struct {
+	Buckets [NumFlowSizeBuckets]uint64 `json:"buckets"`
+	Sum     uint64                     `json:"sum"`
+}
+
+// FlowSizeBucketBound returns the (inclusive) upper bound of the bucket with index i
+func FlowSizeBucketBound(i int) uint64 {
+	if i >= NumFlowSizeBuckets-1 {
+		return math.MaxUint64
+	}
+	return 1 << i
+}
+
+// Observe adds a flow of size v to the histogram
+func (h *FlowSizeHistogram) Observe(v uint64) {
+	if v == 0 {
+		h.Buckets[0]++
+		return
+	}
+	h.Buckets[bits.Len64(v-1)]++
+	h.Sum += v
+}
+
+// Count returns the number of flows in the histogram
+func (h *FlowSizeHistogram) Count() (count uint64) {
+	for _, n := range h.Buckets {
+		count += n
+	}
+	return
+}
+
+// Add adds all flows of h2 to the histogram
+func (h *FlowSizeHistogram) Add(h2 FlowSizeHistogram) {
+	for i, n := range h2.Buckets {
+		h.Buckets[i] += n
+	}
+	h.Sum += h2.Sum
+}
+
+// FlowSizes denotes the histograms of the total (received and sent) bytes and packets per flow
+type FlowSizes struct {
+	Bytes   FlowSizeHistogram `json:"bytes"`
+	Packets FlowSizeHistogram `json:"packets"`
+}
+
+// Observe adds a flow with the given counters to the histograms
+func (f *FlowSizes) Observe(counters types.Counters) {
+	f.Bytes.Observe(counters.SumBytes())
+	f.Packets.Observe(counters.SumPackets())
+}
+
+// Add adds all flows of f2 to the histograms
+func (f *FlowSizes) Add(f2 FlowSizes) {
+	f.Bytes.Add(f2.Bytes)
+	f.Packets.Add(f2.Packets)
+}
+
+// BlockFlowSizes denotes the flow size histograms of a single block
+type BlockFlowSizes struct {
+	Timestamp int64 `json:"timestamp"`
+	FlowSizes
+}
+
+// SetFlowSizes sets the flow size histograms of the block at the given timestamp, which are written
+// along with the metadata upon Close() (write mode only)
+func (d *GPDir) SetFlowSizes(timestamp int64, sizes FlowSizes) error {
+	if !d.isOpen {
+		return ErrDirNotOpen
+	}
+	if _, exists := d.BlockMetadata[0].BlockIndex(timestamp); !exists {
+		return fmt.Errorf("%w: timestamp=%d", ErrBlockNotFound, timestamp)
+	}
+
+	idx, exists := slices.BinarySearchFunc(d.flowSizes, timestamp, func(b BlockFlowSizes, ts int64) int {
+		return cmp.Compare(b.Timestamp, ts)
+	})
+	if exists {
+		d.flowSizes[idx].FlowSizes = sizes
+	} else {
+		d.flowSizes = slices.Insert(d.flowSizes, idx, BlockFlowSizes{Timestamp: timestamp, FlowSizes: sizes})
+	}
+	d.flowSizesModified = true
+
+	return nil
+}
+
+// FlowSizes reads the flow size histograms of the blocks of the GPDir (in chronological order). Blocks
+// written without histograms (e.g. by an older release) are not covered. It does not require the
+// GPDir to be open
+func (d *GPDir) FlowSizes() ([]BlockFlowSizes, error) {
+	return readFlowSizes(d.dirPath)
+}
+
+// readFlowSizes reads the flow size histograms from the GPDir path (returning none if there are none)
+func readFlowSizes(dirPath string) ([]BlockFlowSizes, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, FlowSizesFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sizes []BlockFlowSizes
+	for len(data) > 0 {
+		var (
+			block BlockFlowSizes
+			n     int
+		)
+		if block.Timestamp, n = binary.Varint(data); n <= 0 {
+			return nil, fmt.Errorf("%w: failed to decode timestamp", ErrInvalidFlowSizes)
+		}
+		data = data[n:]
+		for _, h := range []*FlowSizeHistogram{&block.Bytes, &block.Packets} {
+			if data, err = decodeFlowSizeHistogram(data, h); err != nil {
+				return nil, fmt.Errorf("%w (timestamp=%d): %w", ErrInvalidFlowSizes, block.Timestamp, err)
+			}
+		}
+		sizes = append(sizes, block)
+	}
+	return sizes, nil
+}
+
+// writeFlowSizesAtomic writes the flow size histograms to the GPDir path (via a temporary file, so that
+// readers never observe partially written histograms). Each block is encoded as its (varint) timestamp
+// followed by the byte and packet histograms, each encoded as (uvarint) sum, number of buckets up to
+// the last non-empty one and their counts
+func writeFlowSizesAtomic(dirPath string, sizes []BlockFlowSizes, permissions fs.FileMode) (err error) {
+	var data []byte
+	for _, block := range sizes {
+		data = binary.AppendVarint(data, block.Timestamp)
+		for _, h := range []FlowSizeHistogram{block.Bytes, block.Packets} {
+			data = encodeFlowSizeHistogram(data, h)
+		}
+	}
+
+	return fsutil.WriteAtomic(filepath.Join(dirPath, FlowSizesFileName), data, permissions)
+}
+
+func encodeFlowSizeHistogram(data []byte, h FlowSizeHistogram) []byte {
+	nBuckets := NumFlowSizeBuckets
+	for nBuckets > 0 && h.Buckets[nBuckets-1] == 0 {
+		nBuckets--
+	}
+
+	data = binary.AppendUvarint(data, h.Sum)
+	data = binary.AppendUvarint(data, uint64(nBuckets))
+	for _, n := range h.Buckets[:nBuckets] {
+		data = binary.AppendUvarint(data, n)
+	}
+	return data
+}
+
+func decodeFlowSizeHistogram(data []byte, h *FlowSizeHistogram) ([]byte, error) {
+	var n int
+	if h.Sum, n = binary.Uvarint(data); n <= 0 {
+		return nil, errors.New("failed to decode sum")
+	}
+	data = data[n:]
+
+	nBuckets, n := binary.Uvarint(data)
+	if n <= 0 || nBuckets > NumFlowSizeBuckets {
+		return nil, errors.New("failed to decode number of buckets")
+	}
+	data = data[n:]
+
+	for i := range int(nBuckets) {
+		if h.Buckets[i], n = binary.Uvarint(data); n <= 0 {
+			return nil, fmt.Errorf("failed to decode bucket %d", i)
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
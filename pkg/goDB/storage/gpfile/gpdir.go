@@ -1,19 +1,23 @@
 package gpfile
 
 import (
+	"cmp"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 	"github.com/els0r/goProbe/pkg/goDB/storage"
 	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/util/fsutil"
 	"github.com/fako1024/gotools/concurrency"
 )
 
@@ -25,6 +29,10 @@ const (
 	maxUint32 = 1<<32 - 1 // 4294967295
 )
 
+// minParallelWriteEntries denotes the number of flows a block must hold for its columns to be written
+// concurrently. For smaller blocks, the overhead of spawning goroutines outweighs the gain
+var minParallelWriteEntries uint64 = 4096
+
 var (
 
 	// Global memory pool used to minimize allocations
@@ -42,6 +50,17 @@ var (
 
 	// ErrInvalidDirName denotes that the provided name for the GPDir is invalid
 	ErrInvalidDirName = errors.New("invalid GPDir path / name")
+
+	// ErrUnsupportedVersion denotes that the metadata was written in an (unknown) header version
+	// newer than the one(s) supported by this release
+	ErrUnsupportedVersion = errors.New("unsupported GPDir metadata header version")
+
+	// ErrColumnTruncated denotes that a column file holds less data than stated in the metadata
+	ErrColumnTruncated = errors.New("column file truncated")
+
+	// ErrInconsistentBlocks denotes that the offsets / lengths of the blocks stated in the metadata do
+	// not add up to the data of the respective column
+	ErrInconsistentBlocks = errors.New("inconsistent block offsets")
 )
 
 // GPDir denotes a timestamped goDB directory (usually a daily set of blocks)
@@ -56,6 +75,26 @@ type GPDir struct {
 	accessMode       int         // Access mode (also forwarded to all GPFiles)
 	permissions      os.FileMode // Permissions (also forwarded to all GPFiles)
 
+	ipFilter *IPFilter // Filter over all IPs (maintained in write mode, if the GPDir is covered by it)
+	ipIndex  *IPIndex  // Index of all unique IPs (maintained in write mode, if the GPDir is covered by it)
+
+	flowSizes         []BlockFlowSizes // Flow size histograms of the blocks (maintained in write mode)
+	flowSizesModified bool
+
+	blockOrder       []BlockOrder // Order of the entries of each block (lazy-load in read mode)
+	blockOrderLoaded bool
+
+	providedMetadata *Metadata // Metadata used instead of reading it from disk (read mode only), if any
+
+	origin       Origin // Origin of the data, stamped upon Close() (write mode only, if known)
+	originStored bool   // Set if the origin is already stored in the GPDir
+
+	accountingWritten []string // Byte accounting bases of the data written (write mode only, if known)
+	accountingBases   []string // Byte accounting bases of all data of the GPDir, stamped upon Close() (write mode only)
+	accountingStored  bool     // Set if the byte accounting bases are already stored in the GPDir
+
+	recovered bool // Set if the metadata has been recovered from its previous generation
+
 	isOpen bool
 	*Metadata
 }
@@ -92,7 +131,7 @@ func NewDirWriter(basePath string, timestamp int64, options ...Option) *GPDir {
 	}
 
 	obj.dirTimestampPath, obj.dirPath = genWritePathForTimestamp(basePath, timestamp)
-	obj.metaPath = filepath.Join(obj.dirPath, metadataFileName)
+	obj.metaPath = filepath.Join(obj.dirPath, MetadataFileName)
 
 	return &obj
 }
@@ -108,7 +147,7 @@ func NewDirReader(basePath string, timestamp int64, metadataSuffix string, optio
 	}
 
 	obj.dirPath = genReadPathForTimestamp(basePath, timestamp, metadataSuffix)
-	obj.metaPath = filepath.Join(obj.dirPath, metadataFileName)
+	obj.metaPath = filepath.Join(obj.dirPath, MetadataFileName)
 
 	// If metdadata was provided via a suffix, attempt to read / decode it and fall
 	// back to doing nothing in case it fails
@@ -130,6 +169,13 @@ func (d *GPDir) Open(options ...Option) error {
 		opt(d)
 	}
 
+	// Use the provided metadata (if any) instead of reading it from disk
+	if d.accessMode == ModeRead && d.providedMetadata != nil {
+		d.Metadata = d.providedMetadata.Clone()
+		d.isOpen = true
+		return nil
+	}
+
 	// If the directory has been opened in write mode, ensure it is created if required
 	if d.accessMode == ModeWrite {
 		if err := d.createIfRequired(); err != nil {
@@ -137,30 +183,75 @@ func (d *GPDir) Open(options ...Option) error {
 		}
 	}
 
-	// Attempt to read the metadata from file
-	metadataFile, err := os.Open(d.MetadataPath())
-	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
-
-			// In read mode the metadata file has to be present, otherwise we instantiate
-			// an empty one
-			if d.accessMode == ModeRead {
-				return fmt.Errorf("metadata file `%s` missing", d.MetadataPath())
-			}
+	// Attempt to read the metadata from file, recovering it from its previous generation if it is missing,
+	// cannot be decoded, states inconsistent blocks or blocks beyond the end of the column files (e.g. after
+	// an unclean shutdown). Metadata written by a newer release is never replaced
+	err := d.readMetadata(d.MetadataPath())
+	needsRecovery := (err != nil && !errors.Is(err, ErrUnsupportedVersion)) ||
+		(err == nil && d.accessMode == ModeWrite && d.checkColumns() != nil)
+	if !needsRecovery || d.recoverMetadata() != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && d.accessMode == ModeRead:
+
+			// In read mode the metadata file has to be present
+			return fmt.Errorf("metadata file `%s` missing", d.MetadataPath())
+		case errors.Is(err, fs.ErrNotExist):
+
+			// In write mode we instantiate an empty one
 			d.Metadata = newMetadata()
-		} else {
+			d.originStored = d.origin.IsZero()
+			d.accountingStored = d.byteAccountingStored(nil)
+
+			// The IP filter is only maintained for directories it covers from their creation onwards
+			d.ipFilter = newIPFilter()
+			d.ipIndex = newIPIndex()
+			d.blockOrder, d.blockOrderLoaded = nil, true
+
+			d.isOpen = true
+			return nil
+		case errors.As(err, new(*fs.PathError)):
 			return fmt.Errorf("error reading metadata file `%s`: %w", d.MetadataPath(), err)
+		case err != nil:
+			return fmt.Errorf("error decoding metadata file `%s`: %w", d.MetadataPath(), err)
 		}
-	} else {
 
-		// Deserialize and close underlying file after reading is complete
-		defer func() {
-			if cerr := metadataFile.Close(); cerr != nil && err != nil {
-				err = cerr
-			}
-		}()
-		if err := d.Unmarshal(metadataFile); err != nil {
-			return fmt.Errorf("error decoding metadata file `%s`: %w", d.MetadataPath(), err)
+		// Otherwise the metadata read is continued as is (if it states blocks beyond the end of the column
+		// files without any previous generation being available, these remain unreadable)
+	}
+
+	// Continue maintaining the IP filter of an existing directory (unless it misses any blocks)
+	if d.accessMode == ModeWrite {
+		if filter, ferr := readIPFilter(d.dirPath); ferr == nil && filter != nil && filter.covers(d.Metadata.Traffic) {
+			d.ipFilter = filter
+		}
+		if index, ierr := readIPIndex(d.dirPath); ierr == nil && index != nil && index.covers(d.Metadata.Traffic) {
+			d.ipIndex = index
+		}
+
+		// Continue the flow size histograms (discarding them if they cannot be decoded)
+		d.flowSizes, _ = readFlowSizes(d.dirPath)
+
+		// Continue the block order, considering all blocks it does not cover unsorted
+		d.blockOrder, d.blockOrderLoaded = d.readBlockOrder(), true
+		for len(d.blockOrder) < len(d.BlockTraffic) {
+			d.blockOrder = append(d.blockOrder, BlockOrderUnsorted)
+		}
+
+		// The origin is only rewritten if it differs from the one stored (if any)
+		stored, _ := readOrigin(d.dirPath)
+		d.originStored = d.origin.IsZero() || (stored != nil && *stored == d.origin)
+
+		// Likewise, the byte accounting bases are only rewritten if the basis is not stored yet
+		bases, _ := readByteAccounting(d.dirPath)
+		d.accountingStored = d.byteAccountingStored(bases)
+
+		// Discard the flow size histograms of blocks lost during recovery
+		if d.recovered {
+			d.flowSizes = slices.DeleteFunc(d.flowSizes, func(sizes BlockFlowSizes) bool {
+				_, exists := d.BlockMetadata[0].BlockIndex(sizes.Timestamp)
+				return !exists
+			})
+			d.flowSizesModified = true
 		}
 	}
 
@@ -168,6 +259,111 @@ func (d *GPDir) Open(options ...Option) error {
 	return nil
 }
 
+// readMetadata reads and decodes the metadata from the given file
+func (d *GPDir) readMetadata(path string) error {
+	metadataFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	// The file is closed upon deserialization, hence closing it is only required in case of failure
+	defer func() {
+		_ = metadataFile.Close()
+	}()
+
+	return d.Unmarshal(metadataFile)
+}
+
+// recoverMetadata rebuilds the metadata from the block frames of the column files (if written with block
+// frames, see WithBlockFrames) or otherwise reads its previous generation (retained upon each write), provided
+// that its blocks are consistent and the column files still hold all of them (otherwise the previous
+// generation is refused). Since column files written without block frames are a mere concatenation of blocks
+// (carrying neither their length nor their timestamp), any blocks written after the previous generation are
+// lost in the latter case (their data is discarded / overwritten by subsequent writes)
+func (d *GPDir) recoverMetadata() (err error) {
+
+	// Retain the metadata read so far (if any) in case the recovery fails
+	meta := d.Metadata
+	defer func() {
+		if err != nil {
+			d.Metadata = meta
+		}
+	}()
+
+	if err = d.rebuildMetadata(); err == nil {
+		d.recovered = true
+		return nil
+	}
+	if err = d.readMetadata(d.MetadataPath() + MetadataPrevFileSuffix); err != nil {
+		return err
+	}
+	if err = d.checkColumns(); err != nil {
+		return err
+	}
+
+	d.recovered = true
+	return nil
+}
+
+// checkColumns verifies that the blocks stated in the metadata are consistent (i.e. their data seamlessly
+// covers each column up to its current offset) and that all column files hold (at least) the data of all
+// of them
+func (d *GPDir) checkColumns() error {
+	for colIdx, header := range d.BlockMetadata {
+		if err := checkBlockOffsets(header); err != nil {
+			return fmt.Errorf("%w: column %s", err, types.ColumnFileNames[colIdx])
+		}
+		if header.CurrentOffset == 0 {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(d.dirPath, types.ColumnFileNames[colIdx]+FileSuffix))
+		if err != nil {
+			return err
+		}
+		if uint64(stat.Size()) < header.CurrentOffset {
+			return fmt.Errorf("%w: column %s holds %d of %d bytes", ErrColumnTruncated, types.ColumnFileNames[colIdx], stat.Size(), header.CurrentOffset)
+		}
+	}
+	return nil
+}
+
+// checkBlockOffsets verifies that the (non-empty) blocks of a column neither overlap nor leave any gaps
+// (other than their frame header, if written with block frames) and end at its current offset. Blocks are
+// not necessarily stored in chronological order (see headerVersionBlockOffsets), hence they are checked in
+// the order of their offsets
+func checkBlockOffsets(header *storage.BlockHeader) error {
+	blocks := make([]storage.BlockAtTime, 0, len(header.BlockList))
+	for _, block := range header.BlockList {
+		if block.Len > 0 {
+			blocks = append(blocks, block)
+		}
+	}
+	slices.SortFunc(blocks, func(a, b storage.BlockAtTime) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+
+	offset := uint64(0)
+	for _, block := range blocks {
+		if block.Offset == offset+blockFrameHeaderLen {
+			offset += blockFrameHeaderLen
+		}
+		if block.Offset != offset {
+			return fmt.Errorf("%w: block at %d starts at offset %d instead of %d", ErrInconsistentBlocks, block.Timestamp, block.Offset, offset)
+		}
+		offset += uint64(block.Len)
+	}
+	if offset != header.CurrentOffset {
+		return fmt.Errorf("%w: blocks end at offset %d instead of %d", ErrInconsistentBlocks, offset, header.CurrentOffset)
+	}
+	return nil
+}
+
+// Recovered returns if the metadata of the GPDir was missing or corrupt and has been rebuilt from the
+// block frames of its column files or recovered from its previous generation upon Open()
+func (d *GPDir) Recovered() bool {
+	return d.recovered
+}
+
 // IsOpen returns if the GPFile instance is currently opened
 func (d *GPDir) IsOpen() bool {
 	return d.isOpen
@@ -183,6 +379,11 @@ func (d *GPDir) NumIPv6EntriesAtIndex(blockIdx int) uint64 {
 	return d.BlockTraffic[blockIdx].NumV6Entries
 }
 
+// DeltaPackedAtIndex returns if the block of a column at a given block index is delta encoded
+func (d *GPDir) DeltaPackedAtIndex(colIdx types.ColumnIndex, blockIdx int) bool {
+	return d.BlockMetadata[colIdx].BlockList[blockIdx].EncoderType.IsDeltaPacked()
+}
+
 // ReadBlockAtIndex returns the block for a specified block index from the underlying GPFile
 func (d *GPDir) ReadBlockAtIndex(colIdx types.ColumnIndex, blockIdx int) ([]byte, error) {
 
@@ -200,24 +401,70 @@ func (d *GPDir) ReadBlockAtIndex(colIdx types.ColumnIndex, blockIdx int) ([]byte
 	return d.gpFiles[colIdx].ReadBlockAtIndex(blockIdx)
 }
 
-// WriteBlocks writes a set of blocks to the underlying GPFiles and updates the metadata
-func (d *GPDir) WriteBlocks(timestamp int64, blockTraffic TrafficMetadata, counters types.Counters, dbData [types.ColIdxCount][]byte) error {
-	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+// WriteBlocks writes a set of blocks to the underlying GPFiles and updates the metadata. The blocks of all
+// columns listed in deltaPacked are flagged as delta encoded (see storage/deltapack), the order of their
+// entries is recorded in the block order file. Blocks older than the latest block present (e.g. late or
+// historical data) are inserted at their position instead of being appended, whereas blocks for a timestamp
+// already present are rejected (prior to writing any data)
+func (d *GPDir) WriteBlocks(timestamp int64, blockTraffic TrafficMetadata, order BlockOrder, counters types.Counters, dbData [types.ColIdxCount][]byte, deltaPacked ...types.ColumnIndex) error {
+	if !d.isOpen {
+		return ErrDirNotOpen
+	}
+	if _, exists := d.BlockMetadata[0].BlockIndex(timestamp); exists {
+		return fmt.Errorf("%w: timestamp=%d", ErrBlockExists, timestamp)
+	}
 
-		// Load column if required
-		_, err := d.Column(colIdx)
-		if err != nil {
+	// Load columns if required
+	for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+		if _, err := d.Column(colIdx); err != nil {
 			return err
 		}
+	}
 
-		// Write data to column file
-		if err := d.gpFiles[colIdx].writeBlock(timestamp, dbData[colIdx]); err != nil {
+	// Write data to column files. Since each column file carries its own encoder and buffers, the
+	// blocks of large writes are compressed / written concurrently
+	var errs [types.ColIdxCount]error
+	writeBlock := func(colIdx types.ColumnIndex) {
+		var flags encoders.Type
+		if slices.Contains(deltaPacked, colIdx) {
+			flags = encoders.FlagDeltaPacked
+		}
+		errs[colIdx] = d.gpFiles[colIdx].writeBlock(timestamp, dbData[colIdx], flags)
+	}
+	if blockTraffic.NumV4Entries+blockTraffic.NumV6Entries >= minParallelWriteEntries {
+		var wg sync.WaitGroup
+		for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				writeBlock(colIdx)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+			writeBlock(colIdx)
+		}
+	}
+
+	// Errors are reported in column order, regardless of the order the columns were written in
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
 
-	// Update global block info / counters
-	d.Metadata.BlockTraffic = append(d.Metadata.BlockTraffic, blockTraffic)
+	if d.ipFilter != nil {
+		d.ipFilter.addBlock(dbData[types.SIPColIdx], dbData[types.DIPColIdx], blockTraffic)
+	}
+	if d.ipIndex != nil {
+		d.ipIndex.addBlock(dbData[types.SIPColIdx], dbData[types.DIPColIdx], blockTraffic)
+	}
+
+	// Update global block info / counters (at the position the blocks were written to)
+	blockIdx, _ := d.BlockMetadata[0].BlockIndex(timestamp)
+	d.Metadata.BlockTraffic = slices.Insert(d.Metadata.BlockTraffic, blockIdx, blockTraffic)
+	d.blockOrder = slices.Insert(d.blockOrder, blockIdx, order)
 	d.Metadata.Traffic = d.Metadata.Traffic.Add(blockTraffic)
 	d.Metadata.Counts.Add(counters)
 
@@ -268,8 +515,17 @@ func (d *GPDir) Unmarshal(r concurrency.ReadWriteSeekCloser) error {
 	d.Metadata.Counts.PacketsSent = binary.BigEndian.Uint64(data[64:72])   // Get global Counters (PacketsSent)
 	pos := minMetadataFileSizePos
 
-	// Get block information
-	for i := 0; i < int(types.ColIdxCount); i++ {
+	// Reject metadata in a layout unknown to this release (instead of misinterpreting it)
+	if err := CheckHeaderVersion(d.Metadata.Version); err != nil {
+		return err
+	}
+
+	// Get block information (for all columns present in the respective header version)
+	nColumns, explicitOffsets := numColumns(d.Metadata.Version), d.Metadata.Version >= headerVersionBlockOffsets
+	if size := metadataSize(d.Metadata.Version, nBlocks); len(data) < size {
+		return fmt.Errorf("%w (len: %d, expected: %d)", ErrInputSizeTooSmall, len(data), size)
+	}
+	for i := 0; i < nColumns; i++ {
 		d.BlockMetadata[i].CurrentOffset = binary.BigEndian.Uint64(data[pos : pos+8])
 		d.BlockMetadata[i].BlockList = make([]storage.BlockAtTime, nBlocks)
 		pos += 8
@@ -281,10 +537,24 @@ func (d *GPDir) Unmarshal(r concurrency.ReadWriteSeekCloser) error {
 			d.BlockMetadata[i].BlockList[j].EncoderType = encoders.Type(data[pos+8])
 			pos += 9
 
+			// Offsets are implied by the order of the blocks unless stored explicitly
+			if explicitOffsets {
+				d.BlockMetadata[i].BlockList[j].Offset = binary.BigEndian.Uint64(data[pos : pos+8])
+				pos += 8
+			}
 			curOffset += uint64(d.BlockMetadata[i].BlockList[j].Len)
 		}
 	}
 
+	// Columns added in later header versions are treated as empty for all blocks (just like
+	// empty blocks written to them)
+	for i := nColumns; i < int(types.ColIdxCount); i++ {
+		d.BlockMetadata[i].BlockList = make([]storage.BlockAtTime, nBlocks)
+		for j := 0; j < nBlocks; j++ {
+			d.BlockMetadata[i].BlockList[j].EncoderType = encoders.EncoderTypeNull
+		}
+	}
+
 	// Get Metadata.NumIPV4Entries
 	d.BlockTraffic = make([]TrafficMetadata, nBlocks)
 	lastTimestamp := int64(binary.BigEndian.Uint64(data[pos : pos+8]))
@@ -307,22 +577,12 @@ func (d *GPDir) Unmarshal(r concurrency.ReadWriteSeekCloser) error {
 // Marshal marshals and writes the metadata of the GPDir instance into serialized metadata set
 func (d *GPDir) Marshal(w concurrency.ReadWriteSeekCloser) error {
 
+	// Determine the header version (and hence the columns) to store
+	d.Metadata.Version = d.requiredHeaderVersion()
+	nColumns, explicitOffsets := numColumns(d.Metadata.Version), d.Metadata.Version >= headerVersionBlockOffsets
+
 	nBlocks := len(d.BlockTraffic)
-	size := 8 + // Overall number of blocks
-		8 + // Metadata.Version
-		8 + // Metadata.NumV4Entries
-		8 + // Metadata.NumV6Entries
-		8 + // Metadata.NumDrops
-		8*4 + // Metadata.Counts
-		8 + // Metadata.BlockMetadata (first timestampm)
-		nBlocks*4 + // Metadata.GlobalBlockMetadata.NumV4Entries
-		nBlocks*4 + // Metadata.GlobalBlockMetadata.NumV6Entries
-		nBlocks*4 + // Metadata.GlobalBlockMetadata.NumDrops
-		nBlocks*4 + // Metadata.BlockMetadata.BlockList.Timestamp (Delta)
-		int(types.ColIdxCount)*8 + // Metadata.BlockMetadata.CurrentOffset
-		nBlocks*int(types.ColIdxCount)*4 + // Metadata.BlockMetadata.BlockList.Len
-		nBlocks*int(types.ColIdxCount)*4 + // Metadata.BlockMetadata.BlockList.RawLen
-		nBlocks*int(types.ColIdxCount) // Metadata.BlockMetadata.BlockList.Block.EncoderType
+	size := metadataSize(d.Metadata.Version, nBlocks)
 
 	// Note: Lengths and timestamp deltas are encoded as uint32s, allowing for a maximum block (!) size of
 	// 4 GiB (uncompressed / compressed).
@@ -346,8 +606,8 @@ func (d *GPDir) Marshal(w concurrency.ReadWriteSeekCloser) error {
 
 	if nBlocks > 0 {
 
-		// Store block information
-		for i := 0; i < int(types.ColIdxCount); i++ {
+		// Store block information (for all columns present in the header version)
+		for i := 0; i < nColumns; i++ {
 			binary.BigEndian.PutUint64(data[pos:pos+8], d.BlockMetadata[i].CurrentOffset)
 			pos += 8
 			for _, block := range d.BlockMetadata[i].BlockList {
@@ -361,6 +621,10 @@ func (d *GPDir) Marshal(w concurrency.ReadWriteSeekCloser) error {
 				binary.BigEndian.PutUint32(data[pos+4:pos+8], block.RawLen)
 				data[pos+8] = byte(block.EncoderType)
 				pos += 9
+				if explicitOffsets {
+					binary.BigEndian.PutUint64(data[pos:pos+8], block.Offset)
+					pos += 8
+				}
 			}
 		}
 
@@ -399,6 +663,117 @@ func (d *GPDir) Marshal(w concurrency.ReadWriteSeekCloser) error {
 	return nil
 }
 
+// CheckHeaderVersion determines if metadata stored in the given header version can be read by this
+// release, returning an error wrapping ErrUnsupportedVersion otherwise
+func CheckHeaderVersion(version uint64) error {
+	if version > HeaderVersion {
+		return fmt.Errorf("%w: %d (supported up to %d, written by a newer release)", ErrUnsupportedVersion, version, HeaderVersion)
+	}
+	if version < MinHeaderVersion {
+		return fmt.Errorf("%w: %d (supported from %d onwards)", ErrUnsupportedVersion, version, MinHeaderVersion)
+	}
+	return nil
+}
+
+// requiredHeaderVersion returns the header version to store the metadata in. The version of existing
+// metadata is retained unless an optional column introduced in a later version is actually in use (i.e.
+// contains any non-empty block), in which case the layout is upgraded accordingly
+func (d *GPDir) requiredHeaderVersion() uint64 {
+	version := max(d.Metadata.Version, headerVersionInitial)
+	if version < headerVersionTags && d.columnInUse(types.TagsColIdx) {
+		version = headerVersionTags
+	}
+	if version < headerVersionProcess && d.columnInUse(types.ProcessColIdx) {
+		version = headerVersionProcess
+	}
+	if version < headerVersionVLAN && d.columnInUse(types.VLANColIdx) {
+		version = headerVersionVLAN
+	}
+	if version < headerVersionMAC && (d.columnInUse(types.SMACColIdx) || d.columnInUse(types.DMACColIdx)) {
+		version = headerVersionMAC
+	}
+	if version < headerVersionTCPFlags && d.columnInUse(types.TCPFlagsColIdx) {
+		version = headerVersionTCPFlags
+	}
+	if version < headerVersionDSCP && d.columnInUse(types.DSCPColIdx) {
+		version = headerVersionDSCP
+	}
+	if version < headerVersionBlockOffsets && !d.blocksInOrder() {
+		version = headerVersionBlockOffsets
+	}
+	return version
+}
+
+// blocksInOrder determines if the data of all blocks is stored in chronological order, i.e. if their
+// offsets are implied by the order of the blocks (which is not the case once a late block was appended)
+func (d *GPDir) blocksInOrder() bool {
+	for colIdx := range d.BlockMetadata {
+		offset := uint64(0)
+		for _, block := range d.BlockMetadata[colIdx].BlockList {
+			if block.Len > 0 && block.Offset != offset {
+				return false
+			}
+			offset += uint64(block.Len)
+		}
+	}
+	return true
+}
+
+// metadataSize returns the size of the serialized metadata of a given header version
+func metadataSize(version uint64, nBlocks int) int {
+	nColumns, blockInfoSize := numColumns(version), 4+4+1
+	if version >= headerVersionBlockOffsets {
+		blockInfoSize += 8
+	}
+
+	return 8 + // Overall number of blocks
+		8 + // Metadata.Version
+		8 + // Metadata.NumV4Entries
+		8 + // Metadata.NumV6Entries
+		8 + // Metadata.NumDrops
+		8*4 + // Metadata.Counts
+		8 + // Metadata.BlockMetadata (first timestampm)
+		nBlocks*4 + // Metadata.GlobalBlockMetadata.NumV4Entries
+		nBlocks*4 + // Metadata.GlobalBlockMetadata.NumV6Entries
+		nBlocks*4 + // Metadata.GlobalBlockMetadata.NumDrops
+		nBlocks*4 + // Metadata.BlockMetadata.BlockList.Timestamp (Delta)
+		nColumns*8 + // Metadata.BlockMetadata.CurrentOffset
+		nBlocks*nColumns*blockInfoSize // Metadata.BlockMetadata.BlockList.(Len, RawLen, EncoderType[, Offset])
+}
+
+// columnInUse determines if any block of a column contains data
+func (d *GPDir) columnInUse(colIdx types.ColumnIndex) bool {
+	for _, block := range d.BlockMetadata[colIdx].BlockList {
+		if block.Len > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// numColumns returns the number of columns stored in the metadata of a given header version
+func numColumns(version uint64) int {
+	if version < headerVersionTags {
+		return int(types.TagsColIdx)
+	}
+	if version < headerVersionProcess {
+		return int(types.ProcessColIdx)
+	}
+	if version < headerVersionVLAN {
+		return int(types.VLANColIdx)
+	}
+	if version < headerVersionMAC {
+		return int(types.SMACColIdx)
+	}
+	if version < headerVersionTCPFlags {
+		return int(types.TCPFlagsColIdx)
+	}
+	if version < headerVersionDSCP {
+		return int(types.DSCPColIdx)
+	}
+	return int(types.ColIdxCount)
+}
+
 // Path returns the path of the GPDir (up to the timestamp and including a potential metadata suffix)
 func (d *GPDir) Path() string {
 	return d.dirPath
@@ -434,6 +809,9 @@ func (d *GPDir) Close() error {
 	// Ensure resources are marked for cleanup
 	defer func() {
 		d.Metadata.BlockTraffic = nil
+		d.blockOrder, d.blockOrderLoaded = nil, false
+		d.flowSizes, d.flowSizesModified = nil, false
+		d.ipIndex = nil
 		for i := 0; i < int(types.ColIdxCount); i++ {
 			d.Metadata.BlockMetadata[i].BlockList = nil
 			d.Metadata.BlockMetadata[i] = nil
@@ -447,14 +825,76 @@ func (d *GPDir) Close() error {
 		return fmt.Errorf("errors encountered during write of GPFile(s): %v", errs)
 	}
 
-	// In write mode, update the metadata on disk (creating / overwriting)
+	// In write mode, update the IP filter / index, the block order, the flow size histograms, the origin and the
+	// byte accounting bases (if
+	// modified) and the metadata on disk (creating / overwriting). The former have to be written first
+	// since the directory may be renamed along with the metadata
 	if d.accessMode == ModeWrite {
+		if d.ipFilter != nil {
+			if err := writeIPFilterAtomic(d.dirPath, d.ipFilter, d.permissions); err != nil {
+				return fmt.Errorf("failed to write IP filter: %w", err)
+			}
+		}
+		if d.ipIndex != nil {
+			if err := writeIPIndexAtomic(d.dirPath, d.ipIndex, d.permissions); err != nil {
+				return fmt.Errorf("failed to write IP index: %w", err)
+			}
+		}
+		if d.flowSizesModified {
+			if err := writeFlowSizesAtomic(d.dirPath, d.flowSizes, d.permissions); err != nil {
+				return fmt.Errorf("failed to write flow size histograms: %w", err)
+			}
+		}
+		if !d.originStored {
+			if err := writeOriginAtomic(d.dirPath, d.origin, d.permissions); err != nil {
+				return fmt.Errorf("failed to write origin: %w", err)
+			}
+			d.originStored = true
+		}
+		if !d.accountingStored {
+			if err := writeByteAccountingAtomic(d.dirPath, d.accountingBases, d.permissions); err != nil {
+				return fmt.Errorf("failed to write byte accounting: %w", err)
+			}
+			d.accountingStored = true
+		}
+		if err := writeBlockOrderAtomic(d.dirPath, d.blockOrder, d.permissions); err != nil {
+			return fmt.Errorf("failed to write block order: %w", err)
+		}
 		return d.writeMetadataAtomic()
 	}
 
 	return nil
 }
 
+// IPFilter reads the filter over all source and destination IPs stored in the GPDir. It does not
+// require the GPDir to be open, but relies on its metadata (either read via Open() or provided via the
+// suffix of its path) to validate that the filter covers all blocks. If there is no valid filter (e.g.
+// because the directory was written by an older release), nil is returned
+func (d *GPDir) IPFilter() (*IPFilter, error) {
+	if d.Metadata == nil {
+		return nil, nil
+	}
+	filter, err := readIPFilter(d.dirPath)
+	if err != nil || filter == nil || !filter.covers(d.Metadata.Traffic) {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// IPIndex reads the index of all unique source and destination IPs stored in the GPDir. Like IPFilter(),
+// it does not require the GPDir to be open. If there is no valid index (e.g. because the directory was
+// written by an older release), nil is returned
+func (d *GPDir) IPIndex() (*IPIndex, error) {
+	if d.Metadata == nil {
+		return nil, nil
+	}
+	index, err := readIPIndex(d.dirPath)
+	if err != nil || index == nil || !index.covers(d.Metadata.Traffic) {
+		return nil, err
+	}
+	return index, nil
+}
+
 // Column returns the underlying GPFile for a specified column (lazy-access)
 func (d *GPDir) Column(colIdx types.ColumnIndex) (*GPFile, error) {
 
@@ -479,38 +919,45 @@ func (d *GPDir) createIfRequired() error {
 
 func (d *GPDir) writeMetadataAtomic() error {
 
-	// Create a temporary file (in the destinantion directory to avoid moving accross the FS barrier)
-	tempFile, err := os.CreateTemp(d.dirPath, ".tmp-metadata-*")
+	// Serialize the metadata to a temporary file and replace the current one. The current metadata is
+	// retained as previous generation (unless it has been recovered from the latter), allowing to recover
+	// the directory should the metadata get lost
+	err := fsutil.WriteFileAtomic(d.metaPath, d.permissions, func(f *os.File) error {
+		return d.Marshal(f)
+	}, fsutil.WithBeforeReplace(func() error {
+		if d.recovered {
+			return nil
+		}
+		return d.retainPrevMetadata()
+	}))
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if cerr := os.Remove(tempFile.Name()); cerr != nil && err == nil {
-			err = cerr
-		}
-	}()
+	d.recovered = false
 
-	// Serialize the metadata and flush / close the temporary file
-	if err = d.Marshal(tempFile); err != nil {
-		return err
-	}
-	if err = tempFile.Close(); err != nil {
-		return err
+	// Move / rename the output directory (if suffix has changed)
+	if curDirPath, newDirPath := d.dirPath, d.dirTimestampPath+d.Metadata.MarshalString(); curDirPath != newDirPath {
+		return os.Rename(curDirPath, newDirPath)
 	}
+	return nil
+}
 
-	// Set permissions / file mode
-	if err = os.Chmod(tempFile.Name(), d.permissions); err != nil {
+// retainPrevMetadata retains the current metadata as previous generation. It is hardlinked (instead of
+// moved), so the metadata file remains present at all times for concurrent readers / snapshots
+func (d *GPDir) retainPrevMetadata() error {
+	prevPath := d.metaPath + MetadataPrevFileSuffix
+	if err := os.Remove(prevPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
-
-	// Move the temporary file
-	if err = os.Rename(tempFile.Name(), d.metaPath); err != nil {
-		return err
+	err := os.Link(d.metaPath, prevPath)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
 	}
 
-	// Move / rename the output directory (if suffix has changed)
-	if curDirPath, newDirPath := d.dirPath, d.dirTimestampPath+d.Metadata.MarshalString(); curDirPath != newDirPath {
-		return os.Rename(curDirPath, newDirPath)
+	// Fall back to moving the metadata if the file system does not support hardlinks (readers transparently
+	// fall back to the previous generation until the new metadata is in place)
+	if err = os.Rename(d.metaPath, prevPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
 	}
 	return nil
 }
@@ -519,6 +966,22 @@ func (d *GPDir) setPermissions(permissions fs.FileMode) {
 	d.permissions = permissions
 }
 
+func (d *GPDir) setMetadata(meta *Metadata) {
+	d.providedMetadata = meta
+}
+
+func (d *GPDir) setOrigin(origin Origin) {
+	d.origin = origin
+}
+
+func (d *GPDir) setByteAccounting(bases []string) {
+	for _, basis := range bases {
+		if basis != "" && !slices.Contains(d.accountingWritten, basis) {
+			d.accountingWritten = append(d.accountingWritten, basis)
+		}
+	}
+}
+
 func (d *GPDir) setMetadataFromSuffix(metadataSuffix string) {
 	meta := new(Metadata) // no need to use newMetadata() since no block information is used
 	if err := meta.UnmarshalString(metadataSuffix); err == nil {
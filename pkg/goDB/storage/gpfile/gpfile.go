@@ -2,10 +2,16 @@ package gpfile
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/els0r/goProbe/pkg/goDB/encoder"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
@@ -17,6 +23,13 @@ import (
 // Global pool for reusable memory buffers
 var bufPool = concurrency.NewMemPoolNoLimit()
 
+// ErrBlockExists denotes that a block for the given timestamp is already present (blocks are never
+// overwritten or merged, hence overlapping data for a timestamp is rejected)
+var ErrBlockExists = errors.New("block already present for timestamp")
+
+// ErrBlockNotFound denotes that no block is present for the given timestamp
+var ErrBlockNotFound = errors.New("no block present for timestamp")
+
 const (
 	// FileSuffix denotes the suffix used for the raw data stored
 	FileSuffix = ".gpf"
@@ -31,8 +44,47 @@ const (
 	// all reusable buffers (to avoid unnecessary grow operations)
 	bufferPreallocSize = 8192
 
-	// headerVersion denotes the current header version
-	headerVersion = 1
+	// headerVersion denotes the current (i.e. latest supported) header version
+	headerVersion = headerVersionBlockOffsets
+
+	// headerVersionInitial denotes the initial header version (without any of the optional columns
+	// introduced later on). Metadata is written in the layout of the oldest version able to represent
+	// its content, so that directories not making use of any optional column remain readable by
+	// previous releases
+	headerVersionInitial = 1
+
+	// headerVersionTags denotes the header version introducing the (optional) tags column. Metadata
+	// of earlier versions is read as if the column was empty for all blocks
+	headerVersionTags = 2
+
+	// headerVersionProcess denotes the header version introducing the (optional) process column
+	headerVersionProcess = 3
+
+	// headerVersionVLAN denotes the header version introducing the (optional) VLAN column
+	headerVersionVLAN = 4
+
+	// headerVersionMAC denotes the header version introducing the (optional) source / destination MAC
+	// address columns
+	headerVersionMAC = 5
+
+	// headerVersionTCPFlags denotes the header version introducing the (optional) TCP flags column
+	headerVersionTCPFlags = 6
+
+	// headerVersionDSCP denotes the header version introducing the (optional) DSCP column
+	headerVersionDSCP = 7
+
+	// headerVersionBlockOffsets denotes the header version storing the offset of each block explicitly
+	// (instead of implying it by the order of the blocks), required once a block older than the latest
+	// one present has been appended to the column files
+	headerVersionBlockOffsets = 8
+
+	// HeaderVersion denotes the latest metadata header version supported (and written) by this release
+	HeaderVersion = headerVersion
+
+	// MinHeaderVersion denotes the oldest metadata header version supported by this release. Support
+	// for a version is retained for at least two subsequent versions, so that fleets can be upgraded
+	// in stages without readers losing access to data written by a previous release
+	MinHeaderVersion = headerVersionInitial
 
 	// ModeRead denotes read access
 	ModeRead = os.O_RDONLY
@@ -64,6 +116,19 @@ type GPFile struct {
 	defaultEncoder      encoder.Encoder
 	freeEncoder         bool
 
+	// codecs caches the encoders / decoders of blocks written with an encoder other than the default
+	// one (e.g. after the encoder type of the DB was changed or via adaptive encoding), since the
+	// encoder type is negotiated per block
+	codecs map[encoders.Type]encoder.Encoder
+
+	// adaptiveEncoding (if set) governs the per-block selection of the encoder during write operations
+	adaptiveEncoding *AdaptiveEncoding
+
+	// blockFrames governs if the data of each block written is preceded by a frame header (see
+	// WithBlockFrames), in which case the (compressed) data is buffered in frameData first
+	blockFrames bool
+	frameData   bytes.Buffer
+
 	// accessMode denotes if the file is opened for read or write operations (to avoid
 	// race conditions and unpredictable behavior, only one mode is possible at a time)
 	// permissions defines the permissions / mode to use for this GPFile
@@ -75,6 +140,29 @@ type GPFile struct {
 
 	// Memory pool (optional)
 	memPool concurrency.MemPoolGCable
+
+	// Read / decompression timings (optional)
+	readTimings *ReadTimings
+}
+
+// ReadTimings tracks the (cumulative) time spent reading blocks from disk and decompressing them
+type ReadTimings struct {
+	Read          time.Duration // Read denotes the time spent reading (compressed) data from disk
+	Decompression time.Duration // Decompression denotes the time spent decompressing data
+}
+
+// timedReader wraps a reader, tracking the time spent reading from it
+type timedReader struct {
+	io.Reader
+	elapsed time.Duration
+}
+
+// Read implements the io.Reader interface
+func (r *timedReader) Read(p []byte) (n int, err error) {
+	t0 := time.Now()
+	n, err = r.Reader.Read(p)
+	r.elapsed += time.Since(t0)
+	return
 }
 
 // New returns a new GPFile object to read and write goProbe flow data
@@ -164,33 +252,45 @@ func (g *GPFile) ReadBlockAtIndex(idx int) ([]byte, error) {
 		}
 	}
 
+	// If timings are tracked, reads from the file are timed separately so that the remainder
+	// of the time spent in the decoder can be attributed to the decompression
+	var (
+		src      io.Reader = g.file
+		timedSrc *timedReader
+		t0       time.Time
+	)
+	if g.readTimings != nil {
+		timedSrc = &timedReader{Reader: g.file}
+		src, t0 = timedSrc, time.Now()
+	}
+
 	// Perform decompression of data and store in output slice
 	var nRead int
 	if uint32(cap(g.uncompData)) < block.RawLen {
 		g.uncompData = make([]byte, 0, 2*block.RawLen)
 	}
 	g.uncompData = g.uncompData[:block.RawLen]
-	if block.EncoderType != encoders.EncoderTypeNull {
-
-		// Instantiate decoder / decompressor (if required)
-		if block.EncoderType != g.defaultEncoder.Type() {
-			decoder, err := encoder.New(block.EncoderType)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode block %d based on detected encoder type %v: %w", block, block.EncoderType, err)
-			}
-			g.defaultEncoder = decoder
+	if encType := block.EncoderType.Base(); encType != encoders.EncoderTypeNull {
+
+		decoder, err := g.codec(encType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode block %d based on detected encoder type %v: %w", idx, block.EncoderType, err)
 		}
 
 		if uint32(cap(g.blockData)) < block.Len {
 			g.blockData = make([]byte, 0, 2*block.Len)
 		}
 		g.blockData = g.blockData[:block.Len]
-		nRead, err = g.defaultEncoder.Decompress(g.blockData, g.uncompData, g.file)
+		nRead, err = decoder.Decompress(g.blockData, g.uncompData, src)
 	} else {
 		// micro-optimization that saves the allocation of blockData for decompression
 		// in the Null decompression case, since it is essentially just a byte read
 		// and the src bytes aren't used
-		nRead, err = null.DefaultEncoder.Decompress(nil, g.uncompData, g.file)
+		nRead, err = null.DefaultEncoder.Decompress(nil, g.uncompData, src)
+	}
+	if timedSrc != nil {
+		g.readTimings.Read += timedSrc.elapsed
+		g.readTimings.Decompression += time.Since(t0) - timedSrc.elapsed
 	}
 	if err != nil {
 		return nil, err
@@ -203,11 +303,34 @@ func (g *GPFile) ReadBlockAtIndex(idx int) ([]byte, error) {
 	return g.uncompData, nil
 }
 
-// writeBlock writes data for a given timestamp to the file (not exposed to ensure handling by GPDir)
-func (g *GPFile) writeBlock(timestamp int64, blockData []byte) error {
+// codec returns the encoder / decoder for blocks of the provided encoder type, instantiating (and
+// caching) one if the type differs from the one of the default encoder
+func (g *GPFile) codec(encType encoders.Type) (encoder.Encoder, error) {
+	if encType == g.defaultEncoder.Type() {
+		return g.defaultEncoder, nil
+	}
+	if codec, exists := g.codecs[encType]; exists {
+		return codec, nil
+	}
+
+	codec, err := encoder.New(encType)
+	if err != nil {
+		return nil, err
+	}
+	if g.codecs == nil {
+		g.codecs = make(map[encoders.Type]encoder.Encoder)
+	}
+	g.codecs[encType] = codec
+
+	return codec, nil
+}
+
+// writeBlock writes data for a given timestamp to the file (not exposed to ensure handling by GPDir). Flags
+// (e.g. encoders.FlagDeltaPacked) are stored alongside the encoder type of the block
+func (g *GPFile) writeBlock(timestamp int64, blockData []byte, flags encoders.Type) error {
 	blockIdx, exists := g.header.BlockIndex(timestamp)
 	if exists {
-		return fmt.Errorf("timestamp %d already present: offset=%d", timestamp, g.header.BlockList[int64(blockIdx)].Offset)
+		return fmt.Errorf("%w: timestamp=%d, offset=%d", ErrBlockExists, timestamp, g.header.BlockList[int64(blockIdx)].Offset)
 	}
 
 	// Check that the file has been opened in the correct mode
@@ -217,11 +340,10 @@ func (g *GPFile) writeBlock(timestamp int64, blockData []byte) error {
 
 	// If block data is empty, do nothing except updating the header
 	if len(blockData) == 0 {
-		block := storage.Block{
+		g.addBlock(timestamp, storage.Block{
 			Offset:      g.header.CurrentOffset,
 			EncoderType: encoders.EncoderTypeNull,
-		}
-		g.header.AddBlock(timestamp, block)
+		})
 		return nil
 	}
 
@@ -233,38 +355,74 @@ func (g *GPFile) writeBlock(timestamp int64, blockData []byte) error {
 	}
 
 	// Compress + write block data to file (append)
-	nWritten, err := g.defaultEncoder.Compress(blockData, g.blockData, g.fileWriteBuffer)
+	enc, err := g.selectEncoder(blockData)
+	if err != nil {
+		return err
+	}
+	var dst io.Writer = g.fileWriteBuffer
+	if g.blockFrames {
+		g.frameData.Reset()
+		dst = &g.frameData
+	}
+	nWritten, err := enc.Compress(blockData, g.blockData, dst)
 	if err != nil {
 		return err
 	}
-	encType := g.defaultEncoderType
+	encType := enc.Type()
 
 	// if compressed size is bigger than input size, make sure to rewrite the bytes
 	// with NullCompression to optimize storage and increase read speed
 	if nWritten > len(blockData) {
 		encType = encoders.EncoderTypeNull
-		g.fileWriteBuffer.Reset(g.file)
-		nWritten, err = null.DefaultEncoder.Compress(blockData, g.blockData, g.fileWriteBuffer)
+		if g.blockFrames {
+			g.frameData.Reset()
+		} else {
+			g.fileWriteBuffer.Reset(g.file)
+		}
+		nWritten, err = null.DefaultEncoder.Compress(blockData, g.blockData, dst)
 		if err != nil {
 			return fmt.Errorf("failed to re-encode with %s encoder: %w", encType, err)
 		}
 	}
+	block := storage.Block{
+		Offset:      g.header.CurrentOffset,
+		Len:         uint32(nWritten),
+		RawLen:      uint32(len(blockData)),
+		EncoderType: encType | flags,
+	}
+
+	// With block frames, the data is preceded by its frame header
+	if g.blockFrames {
+		block.Offset += blockFrameHeaderLen
+		if err = g.writeBlockFrame(timestamp, block); err != nil {
+			return err
+		}
+	}
 	if err = g.fileWriteBuffer.Flush(); err != nil {
 		return err
 	}
 
 	// Update and write header data
-	g.header.AddBlock(timestamp, storage.Block{
-		Offset:      g.header.CurrentOffset,
-		Len:         uint32(nWritten),
-		RawLen:      uint32(len(blockData)),
-		EncoderType: encType,
-	})
-	g.header.CurrentOffset += uint64(nWritten)
+	g.addBlock(timestamp, block)
+	g.header.CurrentOffset = block.Offset + uint64(block.Len)
 
 	return nil
 }
 
+// addBlock adds a block (whose data has been appended to the file) to the header. Blocks older than the
+// latest block present (e.g. late / historical data) are inserted at their position in the (ordered) list
+// of blocks, the file itself is never modified other than by appending to it
+func (g *GPFile) addBlock(timestamp int64, block storage.Block) {
+	if nBlocks := g.header.NBlocks(); nBlocks > 0 && timestamp < g.header.BlockList[nBlocks-1].Timestamp {
+		blockIdx, _ := slices.BinarySearchFunc(g.header.BlockList, timestamp, func(block storage.BlockAtTime, ts int64) int {
+			return cmp.Compare(block.Timestamp, ts)
+		})
+		g.header.InsertBlock(blockIdx, timestamp, block)
+		return
+	}
+	g.header.AddBlock(timestamp, block)
+}
+
 // RawFile returns the raw underlying file as a concurrency.ReadWriteSeekCloser
 func (g *GPFile) RawFile() concurrency.ReadWriteSeekCloser {
 	return g.file
@@ -280,6 +438,12 @@ func (g *GPFile) Close() error {
 			return err
 		}
 	}
+	for encType, codec := range g.codecs {
+		if err := codec.Close(); err != nil {
+			return err
+		}
+		delete(g.codecs, encType)
+	}
 	if g.file != nil {
 		return g.file.Close()
 	}
@@ -322,9 +486,13 @@ func (g *GPFile) open() (err error) {
 		g.fileWriteBuffer = bufio.NewWriter(g.file)
 	}
 	if g.accessMode == ModeRead && g.memPool != nil {
+		t0 := time.Now()
 		if g.file, err = concurrency.NewMemFile(g.file, g.memPool); err != nil {
 			return err
 		}
+		if g.readTimings != nil {
+			g.readTimings.Read += time.Since(t0)
+		}
 	}
 
 	return
@@ -334,6 +502,10 @@ func (g *GPFile) setPermissions(permissions fs.FileMode) {
 	g.permissions = permissions
 }
 
+func (g *GPFile) setReadTimings(t *ReadTimings) {
+	g.readTimings = t
+}
+
 func (g *GPFile) setMemPool(pool concurrency.MemPoolGCable) {
 	g.memPool = pool
 }
@@ -344,6 +516,14 @@ func (g *GPFile) setEncoder(e encoder.Encoder) {
 	g.freeEncoder = false
 }
 
+func (g *GPFile) setAdaptiveEncoding(a AdaptiveEncoding) {
+	g.adaptiveEncoding = &a
+}
+
+func (g *GPFile) setBlockFrames() {
+	g.blockFrames = true
+}
+
 func (g *GPFile) setEncoderTypeLevel(t encoders.Type, l int) {
 	g.defaultEncoderType = t
 	if l > 0 {
@@ -5,15 +5,20 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io/fs"
+	"math"
+	"math/rand"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/els0r/goProbe/pkg/goDB/encoder"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 	"github.com/els0r/goProbe/pkg/goDB/storage"
+	"github.com/els0r/goProbe/pkg/goDB/storage/deltapack"
 	"github.com/els0r/goProbe/pkg/types"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/require"
@@ -29,6 +34,7 @@ var (
 
 	testEncoders = []encoders.Type{
 		encoders.EncoderTypeLZ4,
+		encoders.EncoderTypeZSTD,
 		encoders.EncoderTypeNull,
 	}
 )
@@ -77,7 +83,7 @@ func TestDirPermissions(t *testing.T) {
 			require.Nil(t, err, "failed to call Stat() on new GPDir")
 			require.Equal(t, stat.Mode().Perm(), calculateDirPerm(perm), stat.Mode().String())
 
-			stat, err = os.Stat(filepath.Join(testDirPath, "1970/01/0_0-0-0-0-0-0-0", metadataFileName))
+			stat, err = os.Stat(filepath.Join(testDirPath, "1970/01/0_0-0-0-0-0-0-0", MetadataFileName))
 			require.Nil(t, err, "failed to call Stat() on block metadata file")
 			require.Equal(t, stat.Mode().Perm(), perm, stat.Mode().String())
 		})
@@ -102,7 +108,7 @@ func TestFilePermissions(t *testing.T) {
 
 			gpf, err := New(testFilePath, newMetadata().BlockMetadata[0], ModeWrite, opts...)
 			require.Nil(t, err, "failed to create new GPFile")
-			require.Nil(t, gpf.writeBlock(time.Now().Unix(), []byte{1, 2, 3, 4}), "failed to write block")
+			require.Nil(t, gpf.writeBlock(time.Now().Unix(), []byte{1, 2, 3, 4}, 0), "failed to write block")
 			require.Nil(t, gpf.Close(), "failed to close test file")
 			stat, err := os.Stat(testFilePath)
 			require.Nil(t, err, "failed to call Stat() on new GPFile")
@@ -133,7 +139,7 @@ func TestWriteFile(t *testing.T) {
 	}(t)
 
 	timestamp := time.Now()
-	require.Nil(t, gpf.writeBlock(timestamp.Unix(), []byte{1, 2, 3, 4}), "failed to write block")
+	require.Nil(t, gpf.writeBlock(timestamp.Unix(), []byte{1, 2, 3, 4}, 0), "failed to write block")
 	require.Nil(t, gpf.validateBlocks(1), "failed to validate block")
 	require.Nil(t, gpf.Close(), "failed to close test file")
 }
@@ -165,7 +171,7 @@ func testRoundtrip(t *testing.T, encType encoders.Type) {
 			binary.BigEndian.PutUint64(data, uint64(i))
 		}
 
-		require.Nil(t, gpf.writeBlock(int64(i), data), "failed to write block")
+		require.Nil(t, gpf.writeBlock(int64(i), data, 0), "failed to write block")
 		require.Nilf(t, gpf.validateBlocks(i+1), "failed to validate block %d", i)
 	}
 	require.Nil(t, gpf.Close(), "failed to close test file")
@@ -219,6 +225,123 @@ func testRoundtrip(t *testing.T, encType encoders.Type) {
 	require.Nil(t, gpf.Close(), "failed to close test file")
 }
 
+func TestMixedEncoders(t *testing.T) {
+	m := newMetadata()
+
+	// Data compressible by any encoder (so that no block falls back to the null encoder)
+	blockData := func(i int) []byte {
+		return bytes.Repeat([]byte{byte(i)}, 64)
+	}
+
+	// Write blocks with different encoders to the same file (e.g. after changing the encoder type of the DB)
+	for i, encType := range []encoders.Type{encoders.EncoderTypeLZ4, encoders.EncoderTypeZSTD} {
+		gpf, err := New(testFilePath, m.BlockMetadata[0], ModeWrite, WithEncoderTypeLevel(encType, 3))
+		require.Nil(t, err)
+		for j := 0; j < 10; j++ {
+			require.Nil(t, gpf.writeBlock(int64(10*i+j), blockData(10*i+j), 0))
+		}
+		require.Nil(t, gpf.Close())
+	}
+	defer func(t *testing.T) {
+		require.Nil(t, os.Remove(testFilePath))
+	}(t)
+
+	for _, block := range m.BlockMetadata[0].Blocks() {
+		expected := encoders.EncoderTypeLZ4
+		if block.Timestamp >= 10 {
+			expected = encoders.EncoderTypeZSTD
+		}
+		require.Equal(t, expected, block.EncoderType)
+	}
+
+	// Blocks are decoded according to their encoder type, irrespective of the default encoder of the file
+	// (caching a decoder for each other encoder type)
+	for encType, nDecoders := range map[encoders.Type]int{
+		encoders.EncoderTypeLZ4:  1,
+		encoders.EncoderTypeZSTD: 1,
+		encoders.EncoderTypeNull: 2,
+	} {
+		gpf, err := New(testFilePath, m.BlockMetadata[0], ModeRead, WithEncoderTypeLevel(encType, 0))
+		require.Nil(t, err)
+		for i := 0; i < 20; i++ {
+			data, err := gpf.ReadBlock(int64(i))
+			require.Nil(t, err)
+			require.Equal(t, blockData(i), data)
+		}
+		require.Equal(t, encType, gpf.DefaultEncoder().Type())
+		require.Len(t, gpf.codecs, nDecoders)
+		require.Nil(t, gpf.Close())
+		require.Empty(t, gpf.codecs)
+	}
+}
+
+func TestAdaptiveEncoding(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	randomData := func(n, nSymbols int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(rnd.Intn(nSymbols))
+		}
+		return data
+	}
+
+	// Blocks too small to be compressed, incompressible, compressed considerably better by ZSTD (due to
+	// its entropy coding) and compressed similarly well by LZ4 / ZSTD (due to a repeated random sequence)
+	var (
+		smallBlock  = bytes.Repeat([]byte{1}, DefaultMinCompressedBlockSize-1)
+		randomBlock = randomData(8192, 256)
+		lowEntropy  = randomData(8192, 4)
+		duplicated  = bytes.Repeat(randomData(2048, 256), 4)
+	)
+
+	for _, c := range []struct {
+		budget   CPUBudget
+		expected []encoders.Type
+	}{
+		{CPUBudgetLow, []encoders.Type{encoders.EncoderTypeNull, encoders.EncoderTypeNull, encoders.EncoderTypeLZ4, encoders.EncoderTypeLZ4}},
+		{CPUBudgetMedium, []encoders.Type{encoders.EncoderTypeNull, encoders.EncoderTypeNull, encoders.EncoderTypeZSTD, encoders.EncoderTypeLZ4}},
+		{CPUBudgetHigh, []encoders.Type{encoders.EncoderTypeNull, encoders.EncoderTypeNull, encoders.EncoderTypeZSTD, encoders.EncoderTypeZSTD}},
+	} {
+		t.Run(c.budget.String(), func(t *testing.T) {
+			m := newMetadata()
+			gpf, err := New(testFilePath, m.BlockMetadata[0], ModeWrite, WithAdaptiveEncoding(AdaptiveEncoding{CPUBudget: c.budget}))
+			require.Nil(t, err)
+			defer func(t *testing.T) {
+				require.Nil(t, os.Remove(testFilePath))
+			}(t)
+
+			blocks := [][]byte{smallBlock, randomBlock, lowEntropy, duplicated}
+			for i, data := range blocks {
+				require.Nil(t, gpf.writeBlock(int64(i), data, 0))
+			}
+			require.Nil(t, gpf.Close())
+
+			for i, block := range m.BlockMetadata[0].Blocks() {
+				require.Equalf(t, c.expected[i], block.EncoderType, "unexpected encoder type for block %d", i)
+			}
+
+			gpf, err = New(testFilePath, m.BlockMetadata[0], ModeRead)
+			require.Nil(t, err)
+			for i, data := range blocks {
+				blockData, err := gpf.ReadBlock(int64(i))
+				require.Nil(t, err)
+				require.Equal(t, data, blockData)
+			}
+			require.Nil(t, gpf.Close())
+		})
+	}
+}
+
+func TestCPUBudgetByString(t *testing.T) {
+	for _, budget := range []CPUBudget{CPUBudgetLow, CPUBudgetMedium, CPUBudgetHigh} {
+		parsed, err := GetCPUBudgetByString(strings.ToUpper(budget.String()))
+		require.Nil(t, err)
+		require.Equal(t, budget, parsed)
+	}
+	_, err := GetCPUBudgetByString("unlimited")
+	require.NotNil(t, err)
+}
+
 func TestInvalidMetadata(t *testing.T) {
 
 	require.Nil(t, os.RemoveAll(testDirPath))
@@ -325,6 +448,395 @@ func TestMetadataRoundTrip(t *testing.T) {
 	require.Equal(t, sumDrops, int(testDir.Metadata.Traffic.NumDrops), "mismatched number of total packet drops vs. computed")
 }
 
+func TestLegacyMetadata(t *testing.T) {
+	for _, version := range []uint64{1, headerVersionTags, headerVersionProcess, headerVersionVLAN, headerVersionMAC, headerVersionTCPFlags} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			testLegacyMetadata(t, version)
+		})
+	}
+}
+
+func testLegacyMetadata(t *testing.T, version uint64) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	testDir := NewDirWriter(testDirPath, 1000)
+	require.Nil(t, testDir.Open(), "error opening test dir for writing")
+	for i := 0; i < int(types.ColIdxCount); i++ {
+		testDir.BlockMetadata[i].AddBlock(1575244800, storage.Block{Len: 100, RawLen: 200, EncoderType: 1})
+		testDir.BlockMetadata[i].AddBlock(1575245100, storage.Block{Offset: 100, Len: 50, RawLen: 80, EncoderType: 1})
+		testDir.BlockMetadata[i].CurrentOffset = 150
+	}
+	testDir.BlockTraffic = append(testDir.BlockTraffic, TrafficMetadata{NumV4Entries: 10}, TrafficMetadata{NumV6Entries: 5})
+	require.Nil(t, testDir.Close(), "error writing test dir")
+
+	// Rewrite the metadata in the legacy layout (without the columns introduced later on)
+	_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+	data, err := os.ReadFile(filepath.Join(fullPath, MetadataFileName))
+	require.Nil(t, err)
+	nColumns := types.ColumnIndex(numColumns(version))
+	colLen := 8 + 2*9
+	legacyPos := minMetadataFileSizePos + int(nColumns)*colLen
+	legacy := append(append([]byte{}, data[:legacyPos]...), data[minMetadataFileSizePos+int(types.ColIdxCount)*colLen:]...)
+	binary.BigEndian.PutUint64(legacy[0:8], version)
+	require.Nil(t, os.WriteFile(filepath.Join(fullPath, MetadataFileName), legacy, 0600))
+
+	ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+	require.Nil(t, err)
+	testDir = NewDirReader(testDirPath, ts, suffix)
+	require.Nil(t, testDir.Open(), "error opening test dir for reading")
+	require.Equal(t, version, testDir.Metadata.Version)
+	require.Equal(t, 2, testDir.NBlocks())
+
+	for i := types.ColumnIndex(0); i < nColumns; i++ {
+		require.Equal(t, uint64(150), testDir.BlockMetadata[i].CurrentOffset)
+		require.Equal(t, uint32(50), testDir.BlockMetadata[i].BlockList[1].Len)
+	}
+	for i := nColumns; i < types.ColIdxCount; i++ {
+		for _, block := range testDir.BlockMetadata[i].Blocks() {
+			require.Zero(t, block.Len)
+			require.Zero(t, block.RawLen)
+		}
+		require.Equal(t, int64(1575245100), testDir.BlockMetadata[i].BlockList[1].Timestamp)
+
+		// Empty blocks of the legacy columns can be read without the column file being present
+		block, err := testDir.ReadBlockAtIndex(i, 1)
+		require.Nil(t, err)
+		require.Empty(t, block)
+	}
+	require.Nil(t, testDir.Close())
+}
+
+func TestMetadataHeaderVersion(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	writeBlock := func(timestamp int64, optionalCols ...types.ColumnIndex) {
+		testDir := NewDirWriter(testDirPath, 1000)
+		require.Nil(t, testDir.Open(), "error opening test dir for writing")
+		var dbData [types.ColIdxCount][]byte
+		for i := types.ColumnIndex(0); i < types.TagsColIdx; i++ {
+			dbData[i] = []byte{1}
+		}
+		for _, colIdx := range optionalCols {
+			dbData[colIdx] = []byte{1}
+		}
+		require.Nil(t, testDir.WriteBlocks(timestamp, TrafficMetadata{NumV4Entries: 1}, BlockOrderUnsorted, types.Counters{}, dbData))
+		require.Nil(t, testDir.Close(), "error writing test dir")
+	}
+	readVersion := func() uint64 {
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		data, err := os.ReadFile(filepath.Join(fullPath, MetadataFileName))
+		require.Nil(t, err)
+		return binary.BigEndian.Uint64(data[0:8])
+	}
+
+	// Without any of the optional columns in use, the initial layout is retained
+	writeBlock(1575244800)
+	require.Equal(t, uint64(headerVersionInitial), readVersion())
+
+	// The layout is upgraded as soon as an optional column is in use (and retained afterwards)
+	writeBlock(1575245100, types.TagsColIdx)
+	require.Equal(t, uint64(headerVersionTags), readVersion())
+	writeBlock(1575245400)
+	require.Equal(t, uint64(headerVersionTags), readVersion())
+	writeBlock(1575245700, types.ProcessColIdx)
+	require.Equal(t, uint64(headerVersionProcess), readVersion())
+	writeBlock(1575246000, types.VLANColIdx)
+	require.Equal(t, uint64(headerVersionVLAN), readVersion())
+	writeBlock(1575246300, types.DMACColIdx)
+	require.Equal(t, uint64(headerVersionMAC), readVersion())
+	writeBlock(1575246600, types.TCPFlagsColIdx)
+	require.Equal(t, uint64(headerVersionTCPFlags), readVersion())
+	writeBlock(1575246900, types.DSCPColIdx)
+	require.Equal(t, uint64(headerVersionDSCP), readVersion())
+
+	// Metadata of unknown (newer) versions is rejected
+	_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+	metaPath := filepath.Join(fullPath, MetadataFileName)
+	data, err := os.ReadFile(metaPath)
+	require.Nil(t, err)
+	binary.BigEndian.PutUint64(data[0:8], headerVersion+1)
+	require.Nil(t, os.WriteFile(metaPath, data, 0600))
+
+	ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+	require.Nil(t, err)
+	testDir := NewDirReader(testDirPath, ts, suffix)
+	require.ErrorIs(t, testDir.Open(), ErrUnsupportedVersion)
+}
+
+func TestRecoverMetadata(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	writeBlock := func(timestamp int64, dummyByte byte) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, 1000)
+		require.Nil(t, testDir.Open(), "error opening test dir for writing")
+		require.Nil(t, writeDummyBlock(timestamp, testDir, dummyByte), "failed to write blocks")
+		require.Nil(t, testDir.Close(), "error writing test dir")
+	}
+	openDir := func() (*GPDir, error) {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		testDir := NewDirReader(testDirPath, ts, suffix)
+		return testDir, testDir.Open()
+	}
+	requireBlocks := func(testDir *GPDir, dummyBytes ...byte) {
+		t.Helper()
+		require.Equal(t, len(dummyBytes), testDir.NBlocks())
+		for i, dummyByte := range dummyBytes {
+			for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+				block, err := testDir.ReadBlockAtIndex(colIdx, i)
+				require.Nil(t, err)
+				require.Equal(t, []byte{dummyByte}, block)
+			}
+		}
+	}
+
+	writeBlock(1575244800, 1)
+	writeBlock(1575245100, 2)
+	writeBlock(1575245400, 3)
+
+	_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+	metaPath := filepath.Join(fullPath, MetadataFileName)
+	require.FileExists(t, metaPath+MetadataPrevFileSuffix)
+
+	// Metadata truncated (e.g. by an unclean shutdown) is recovered from its previous generation,
+	// losing the last block only
+	require.Nil(t, os.Truncate(metaPath, 10))
+	testDir, err := openDir()
+	require.Nil(t, err)
+	require.True(t, testDir.Recovered())
+	requireBlocks(testDir, 1, 2)
+	require.Nil(t, testDir.Close())
+
+	// Writing to the recovered directory overwrites the data of the lost block and persists the
+	// recovered metadata
+	writeBlock(1575245700, 4)
+	testDir, err = openDir()
+	require.Nil(t, err)
+	require.False(t, testDir.Recovered())
+	requireBlocks(testDir, 1, 2, 4)
+	require.Nil(t, testDir.Close())
+
+	// Metadata stating blocks beyond the end of the column files is recovered when writing
+	writeBlock(1575246000, 5)
+	_, fullPath = genWritePathForTimestamp(testDirPath, 1000)
+	colPath := filepath.Join(fullPath, types.ColumnFileNames[types.DportColIdx]+FileSuffix)
+	stat, err := os.Stat(colPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(colPath, stat.Size()-1))
+	writeBlock(1575246300, 6)
+	testDir, err = openDir()
+	require.Nil(t, err)
+	requireBlocks(testDir, 1, 2, 4, 6)
+	require.Nil(t, testDir.Close())
+
+	// A previous generation whose blocks disagree with the column data is refused
+	writeBlock(1575246600, 7)
+	_, fullPath = genWritePathForTimestamp(testDirPath, 1000)
+	metaPath = filepath.Join(fullPath, MetadataFileName)
+	prevData, err := os.ReadFile(metaPath + MetadataPrevFileSuffix)
+	require.Nil(t, err)
+	curOffset := binary.BigEndian.Uint64(prevData[minMetadataFileSizePos:])
+	binary.BigEndian.PutUint64(prevData[minMetadataFileSizePos:], curOffset-1)
+	require.Nil(t, os.WriteFile(metaPath+MetadataPrevFileSuffix, prevData, 0644))
+	require.Nil(t, os.Truncate(metaPath, 10))
+	_, err = openDir()
+	require.NotNil(t, err)
+
+	testDir = NewDirWriter(testDirPath, 1000)
+	require.ErrorIs(t, testDir.Open(), ErrInputSizeTooSmall)
+
+	// Without any previous generation, missing metadata cannot be recovered
+	_, fullPath = genWritePathForTimestamp(testDirPath, 1000)
+	metaPath = filepath.Join(fullPath, MetadataFileName)
+	require.Nil(t, os.Remove(metaPath))
+	require.Nil(t, os.Remove(metaPath+MetadataPrevFileSuffix))
+	_, err = openDir()
+	require.NotNil(t, err)
+}
+
+func TestRebuildMetadata(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	type testBlock struct {
+		timestamp int64
+		v4, v6    int
+		value     byte
+		tagged    bool
+	}
+	genBlock := func(b testBlock) (data [types.ColIdxCount][]byte, counters types.Counters, deltaPacked []types.ColumnIndex) {
+		n := b.v4 + b.v6
+		ips := append(bytes.Repeat([]byte{b.value}, types.IPv4Width*b.v4), bytes.Repeat([]byte{b.value}, types.IPv6Width*b.v6)...)
+		data[types.SIPColIdx], data[types.DIPColIdx] = ips, ips
+		data[types.ProtoColIdx] = bytes.Repeat([]byte{6}, n)
+		data[types.DportColIdx] = bytes.Repeat([]byte{0, b.value}, n)
+
+		values := make([]uint64, n)
+		for i := range values {
+			values[i] = uint64(b.value) + uint64(i)*1000
+			counters.BytesRcvd += values[i]
+		}
+		counters.BytesSent, counters.PacketsRcvd, counters.PacketsSent = counters.BytesRcvd, counters.BytesRcvd, counters.BytesRcvd
+		for _, colIdx := range []types.ColumnIndex{types.BytesRcvdColIdx, types.BytesSentColIdx, types.PacketsRcvdColIdx, types.PacketsSentColIdx} {
+			var isDelta bool
+			if data[colIdx], isDelta = deltapack.Pack(values); isDelta {
+				deltaPacked = append(deltaPacked, colIdx)
+			}
+		}
+		if b.tagged {
+			data[types.TagsColIdx], _ = deltapack.Pack(slices.Repeat([]uint64{1}, n))
+		}
+		return
+	}
+	writeBlock := func(b testBlock) {
+		t.Helper()
+		data, counters, deltaPacked := genBlock(b)
+		testDir := NewDirWriter(testDirPath, 1000, WithBlockFrames())
+		require.Nil(t, testDir.Open())
+		require.Nil(t, testDir.WriteBlocks(b.timestamp, TrafficMetadata{
+			NumV4Entries: uint64(b.v4),
+			NumV6Entries: uint64(b.v6),
+		}, BlockOrderUnsorted, counters, data, deltaPacked...))
+		require.Nil(t, testDir.Close())
+	}
+	openDir := func() *GPDir {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		testDir := NewDirReader(testDirPath, ts, suffix)
+		require.Nil(t, testDir.Open())
+		return testDir
+	}
+	requireBlocks := func(testDir *GPDir, blocks ...testBlock) {
+		t.Helper()
+		var counts types.Counters
+		require.Equal(t, len(blocks), testDir.NBlocks())
+		for i, b := range blocks {
+			data, counters, deltaPacked := genBlock(b)
+			counts.Add(counters)
+			require.Equal(t, b.timestamp, testDir.BlockMetadata[0].BlockList[i].Timestamp)
+			require.Equal(t, uint64(b.v4), testDir.NumIPv4EntriesAtIndex(i))
+			require.Equal(t, uint64(b.v6), testDir.NumIPv6EntriesAtIndex(i))
+			for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+				block, err := testDir.ReadBlockAtIndex(colIdx, i)
+				require.Nil(t, err)
+				require.Equal(t, len(data[colIdx]), len(block))
+				if len(block) > 0 {
+					require.Equal(t, data[colIdx], block)
+				}
+				require.Equal(t, slices.Contains(deltaPacked, colIdx), testDir.DeltaPackedAtIndex(colIdx, i))
+			}
+		}
+		require.Equal(t, counts, testDir.Counts)
+	}
+
+	// Write blocks with block frames, including a late block and a block carrying an optional column
+	blocks := []testBlock{
+		{timestamp: 1575244800, v4: 2, v6: 1, value: 1},
+		{timestamp: 1575245400, v4: 1, v6: 2, value: 3, tagged: true},
+		{timestamp: 1575245100, v4: 3, value: 2},
+	}
+	for _, b := range blocks {
+		writeBlock(b)
+	}
+	slices.SortFunc(blocks, func(a, b testBlock) int {
+		return int(a.timestamp - b.timestamp)
+	})
+
+	testDir := openDir()
+	require.False(t, testDir.Recovered())
+	requireBlocks(testDir, blocks...)
+	require.Nil(t, testDir.Close())
+
+	// Without the metadata and its previous generation, the metadata is rebuilt from the block frames
+	_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+	metaPath := filepath.Join(fullPath, MetadataFileName)
+	require.Nil(t, os.Remove(metaPath))
+	require.Nil(t, os.Remove(metaPath+MetadataPrevFileSuffix))
+
+	testDir = openDir()
+	require.True(t, testDir.Recovered())
+	require.Equal(t, uint64(headerVersionBlockOffsets), testDir.Version)
+	requireBlocks(testDir, blocks...)
+	require.Nil(t, testDir.Close())
+
+	// A block whose frame is incomplete in any of the columns (e.g. after an unclean shutdown) is lost,
+	// its data in the other columns being overwritten by the next write
+	writeBlock(testBlock{timestamp: 1575245700, v4: 1, value: 4, tagged: true})
+	_, fullPath = genWritePathForTimestamp(testDirPath, 1000)
+	colPath := filepath.Join(fullPath, types.ColumnFileNames[types.DportColIdx]+FileSuffix)
+	stat, err := os.Stat(colPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(colPath, stat.Size()-1))
+
+	nextBlock := testBlock{timestamp: 1575246000, v4: 2, v6: 2, value: 5}
+	writeBlock(nextBlock)
+	testDir = openDir()
+	require.False(t, testDir.Recovered())
+	requireBlocks(testDir, append(blocks, nextBlock)...)
+	require.Nil(t, testDir.Close())
+
+	// Directories written without block frames cannot be rebuilt
+	require.Nil(t, os.RemoveAll(testDirPath))
+	testDir = NewDirWriter(testDirPath, 1000)
+	require.Nil(t, testDir.Open())
+	data, counters, _ := genBlock(blocks[0])
+	require.Nil(t, testDir.WriteBlocks(blocks[0].timestamp, TrafficMetadata{NumV4Entries: 2, NumV6Entries: 1}, BlockOrderUnsorted, counters, data))
+	require.Nil(t, testDir.Close())
+	testDir = NewDirWriter(testDirPath, 1000)
+	require.ErrorIs(t, testDir.rebuildMetadata(), ErrNoBlockFrames)
+}
+
+func TestCheckHeaderVersion(t *testing.T) {
+
+	// At least the two versions preceding the current one must remain readable
+	require.GreaterOrEqual(t, HeaderVersion-MinHeaderVersion, 2)
+
+	for version := uint64(MinHeaderVersion); version <= HeaderVersion; version++ {
+		require.Nil(t, CheckHeaderVersion(version))
+	}
+	require.ErrorIs(t, CheckHeaderVersion(MinHeaderVersion-1), ErrUnsupportedVersion)
+	require.ErrorIs(t, CheckHeaderVersion(HeaderVersion+1), ErrUnsupportedVersion)
+}
+
+func TestDeltaPackedFlag(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	testDir := NewDirWriter(testDirPath, 1000)
+	require.Nil(t, testDir.Open(), "error opening test dir for writing")
+	require.Nil(t, writeDummyBlock(1, testDir, 1, types.BytesRcvdColIdx), "failed to write blocks")
+	require.Nil(t, testDir.Close(), "error writing test dir")
+
+	_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+	ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+	require.Nil(t, err)
+	testDir = NewDirReader(testDirPath, ts, suffix)
+	require.Nil(t, testDir.Open(), "error opening test dir for reading")
+
+	// The flag is carried by the encoder type only, the block itself is decompressed as usual
+	require.True(t, testDir.DeltaPackedAtIndex(types.BytesRcvdColIdx, 0))
+	require.False(t, testDir.DeltaPackedAtIndex(types.BytesSentColIdx, 0))
+	block, err := testDir.ReadBlockAtIndex(types.BytesRcvdColIdx, 0)
+	require.Nil(t, err)
+	require.Equal(t, []byte{1}, block)
+
+	// Releases not supporting delta encoding fail to instantiate a decoder for the flagged block
+	encType := testDir.BlockMetadata[types.BytesRcvdColIdx].Blocks()[0].EncoderType
+	require.Equal(t, encoders.FlagDeltaPacked, encType&encoders.FlagDeltaPacked)
+	_, err = encoder.New(encType)
+	require.Error(t, err)
+
+	require.Nil(t, testDir.Close())
+}
+
 func TestBrokenAccess(t *testing.T) {
 
 	require.Nil(t, os.RemoveAll(testDirPath))
@@ -509,15 +1021,483 @@ func (g *GPFile) validateBlocks(nExpected int) error {
 	return nil
 }
 
-func writeDummyBlock(timestamp int64, dir *GPDir, dummyByte byte) error {
+func writeDummyBlock(timestamp int64, dir *GPDir, dummyByte byte, deltaPacked ...types.ColumnIndex) error {
 	return dir.WriteBlocks(timestamp, TrafficMetadata{
 		NumV4Entries: uint64(dummyByte),
 		NumV6Entries: uint64(dummyByte),
 		NumDrops:     uint64(dummyByte),
-	}, types.Counters{
+	}, BlockOrderUnsorted, types.Counters{
 		BytesRcvd:   uint64(dummyByte),
 		BytesSent:   uint64(dummyByte),
 		PacketsRcvd: uint64(dummyByte),
 		PacketsSent: uint64(dummyByte),
-	}, [types.ColIdxCount][]byte{{dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}})
+	}, [types.ColIdxCount][]byte{{dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}, {dummyByte}}, deltaPacked...)
+}
+
+func TestIPFilter(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	var (
+		v4A, v4B = []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+		v6       = bytes.Repeat([]byte{0x20}, types.IPv6Width)
+	)
+	writeIPs := func(timestamp int64, sips, dips []byte, traffic TrafficMetadata, maintainFilter bool) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, timestamp)
+		require.Nil(t, testDir.Open())
+		if !maintainFilter {
+			testDir.ipFilter = nil
+		}
+		var data [types.ColIdxCount][]byte
+		data[types.SIPColIdx], data[types.DIPColIdx] = sips, dips
+		require.Nil(t, testDir.WriteBlocks(timestamp, traffic, BlockOrderUnsorted, types.Counters{}, data))
+		require.Nil(t, testDir.Close())
+	}
+	readFilter := func() *IPFilter {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		filter, err := NewDirReader(testDirPath, ts, suffix).IPFilter()
+		require.Nil(t, err)
+		return filter
+	}
+
+	// the filter covers the IPs of all blocks
+	writeIPs(1000, v4A, v4B, TrafficMetadata{NumV4Entries: 1}, true)
+	writeIPs(1300, append(slices.Clone(v4A), v6...), append(slices.Clone(v4B), v4A...), TrafficMetadata{NumV4Entries: 1, NumV6Entries: 1}, true)
+	filter := readFilter()
+	require.NotNil(t, filter)
+	require.True(t, filter.Contains(v4A))
+	require.True(t, filter.Contains(v4B))
+	require.True(t, filter.Contains(v6))
+	require.False(t, filter.Contains([]byte{192, 168, 1, 1}))
+
+	// a filter missing any blocks is disregarded (and no longer maintained)
+	writeIPs(1600, v4A, v4A, TrafficMetadata{NumV4Entries: 1}, false)
+	require.Nil(t, readFilter())
+	writeIPs(1900, v4A, v4A, TrafficMetadata{NumV4Entries: 1}, true)
+	require.Nil(t, readFilter())
+}
+
+func TestIPIndex(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	var (
+		v4A, v4B = []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+		v4C      = []byte{192, 168, 1, 1}
+		v6       = bytes.Repeat([]byte{0x20}, types.IPv6Width)
+	)
+	writeIPs := func(timestamp int64, sips, dips []byte, traffic TrafficMetadata, maintainIndex bool) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, timestamp)
+		require.Nil(t, testDir.Open())
+		if !maintainIndex {
+			testDir.ipIndex = nil
+		}
+		var data [types.ColIdxCount][]byte
+		data[types.SIPColIdx], data[types.DIPColIdx] = sips, dips
+		require.Nil(t, testDir.WriteBlocks(timestamp, traffic, BlockOrderUnsorted, types.Counters{}, data))
+		require.Nil(t, testDir.Close())
+	}
+	readIndex := func() *IPIndex {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		index, err := NewDirReader(testDirPath, ts, suffix).IPIndex()
+		require.Nil(t, err)
+		return index
+	}
+
+	// the index holds the unique IPs of all blocks (in sorted order)
+	writeIPs(1000, v4C, v4B, TrafficMetadata{NumV4Entries: 1}, true)
+	writeIPs(1300, append(slices.Clone(v4A), v6...), append(slices.Clone(v4B), v4A...), TrafficMetadata{NumV4Entries: 1, NumV6Entries: 1}, true)
+	index := readIndex()
+	require.NotNil(t, index)
+	require.Equal(t, 4, index.Len())
+	require.Equal(t, []netip.Addr{
+		netip.AddrFrom4([4]byte(v4A)), netip.AddrFrom4([4]byte(v4B)), netip.AddrFrom4([4]byte(v4C)), netip.AddrFrom16([16]byte(v6)),
+	}, index.IPs())
+	require.True(t, index.Contains(netip.MustParseAddr("10.0.0.1")))
+	require.True(t, index.Contains(netip.MustParseAddr("::ffff:10.0.0.2")))
+	require.True(t, index.Contains(netip.AddrFrom16([16]byte(v6))))
+	require.False(t, index.Contains(netip.MustParseAddr("10.0.0.3")))
+	require.False(t, index.Contains(netip.MustParseAddr("2001:db8::1")))
+
+	// an index missing any blocks is disregarded (and no longer maintained)
+	writeIPs(1600, v4A, v4A, TrafficMetadata{NumV4Entries: 1}, false)
+	require.Nil(t, readIndex())
+	writeIPs(1900, v4A, v4A, TrafficMetadata{NumV4Entries: 1}, true)
+	require.Nil(t, readIndex())
+}
+
+func TestIPIndexMarshal(t *testing.T) {
+	index := newIPIndex()
+	index.addBlock([]byte{0, 0, 0, 0, 255, 255, 255, 255}, []byte{10, 0, 0, 1, 10, 0, 0, 1}, TrafficMetadata{NumV4Entries: 2})
+
+	data, err := index.MarshalBinary()
+	require.Nil(t, err)
+
+	decoded := new(IPIndex)
+	require.Nil(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, index.IPs(), decoded.IPs())
+	require.Equal(t, index.covered, decoded.covered)
+
+	// truncated / corrupted indices are rejected
+	require.ErrorIs(t, decoded.UnmarshalBinary(data[:ipIndexHeaderLen-1]), ErrInvalidIPIndex)
+	require.ErrorIs(t, decoded.UnmarshalBinary(data[:len(data)-1]), ErrInvalidIPIndex)
+	require.ErrorIs(t, decoded.UnmarshalBinary(append(slices.Clone(data), 0)), ErrInvalidIPIndex)
+
+	data[16] = ipIndexVersion + 1
+	require.ErrorIs(t, decoded.UnmarshalBinary(data), ErrUnsupportedIPIndexVersion)
+}
+
+func TestBlockOrder(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	writeBlock := func(timestamp int64, order BlockOrder) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, 1000)
+		require.Nil(t, testDir.Open())
+		require.Nil(t, testDir.WriteBlocks(timestamp, TrafficMetadata{}, order, types.Counters{}, [types.ColIdxCount][]byte{}))
+		require.Nil(t, testDir.Close())
+	}
+	dirPath := func() string {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		return fullPath
+	}
+	readOrder := func() (order []BlockOrder) {
+		t.Helper()
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(dirPath()))
+		require.Nil(t, err)
+		testDir := NewDirReader(testDirPath, ts, suffix)
+		require.Nil(t, testDir.Open())
+		for i := range testDir.BlockTraffic {
+			order = append(order, testDir.BlockOrderAtIndex(i))
+		}
+		require.Nil(t, testDir.Close())
+		return
+	}
+
+	writeBlock(1000, BlockOrderSorted)
+	writeBlock(1300, BlockOrderUnsorted)
+	require.Equal(t, []BlockOrder{BlockOrderSorted, BlockOrderUnsorted}, readOrder())
+
+	// blocks appended without maintaining the block order (e.g. by an older release) are unsorted,
+	// also after further blocks have been appended
+	writeBlock(1600, BlockOrderSorted)
+	require.Nil(t, os.Truncate(filepath.Join(dirPath(), BlockOrderFileName), 2))
+	require.Equal(t, []BlockOrder{BlockOrderSorted, BlockOrderUnsorted, BlockOrderUnsorted}, readOrder())
+	writeBlock(1900, BlockOrderSorted)
+	require.Equal(t, []BlockOrder{BlockOrderSorted, BlockOrderUnsorted, BlockOrderUnsorted, BlockOrderSorted}, readOrder())
+
+	// an inconsistent block order (covering more blocks than present) is disregarded
+	require.Nil(t, os.WriteFile(filepath.Join(dirPath(), BlockOrderFileName), bytes.Repeat([]byte{byte(BlockOrderSorted)}, 5), 0644))
+	require.Equal(t, []BlockOrder{BlockOrderUnsorted, BlockOrderUnsorted, BlockOrderUnsorted, BlockOrderUnsorted}, readOrder())
+}
+
+func TestOrigin(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	writeBlock := func(timestamp int64, opts ...Option) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, 1000, opts...)
+		require.Nil(t, testDir.Open())
+		require.Nil(t, testDir.WriteBlocks(timestamp, TrafficMetadata{}, BlockOrderSorted, types.Counters{}, [types.ColIdxCount][]byte{}))
+		require.Nil(t, testDir.Close())
+	}
+	storedOrigin := func() *Origin {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		origin, err := NewDirReader(testDirPath, ts, suffix).Origin()
+		require.Nil(t, err)
+		return origin
+	}
+
+	// directories written without an origin (e.g. by an older release) have none
+	writeBlock(1000)
+	require.Nil(t, storedOrigin())
+
+	origin := Origin{Hostname: "probe-a", HostID: "0123456789abcdef"}
+	writeBlock(1300, WithOrigin(origin))
+	require.Equal(t, &origin, storedOrigin())
+
+	// the origin is retained by writes not providing one and replaced by writes providing another one
+	writeBlock(1600)
+	require.Equal(t, &origin, storedOrigin())
+	origin = Origin{Hostname: "probe-b"}
+	writeBlock(1900, WithOrigin(origin))
+	require.Equal(t, &origin, storedOrigin())
+
+	// a truncated origin is rejected
+	_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+	require.Nil(t, os.Truncate(filepath.Join(fullPath, OriginFileName), 4))
+	_, err := readOrigin(fullPath)
+	require.ErrorIs(t, err, ErrInvalidOrigin)
+}
+
+func TestByteAccounting(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	accountingPath := func() string {
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		return filepath.Join(fullPath, ByteAccountingFileName)
+	}
+	writeBlock := func(timestamp int64, opts ...Option) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, 1000, opts...)
+		require.Nil(t, testDir.Open())
+		require.Nil(t, testDir.WriteBlocks(timestamp, TrafficMetadata{}, BlockOrderSorted, types.Counters{}, [types.ColIdxCount][]byte{}))
+		require.Nil(t, testDir.Close())
+	}
+	storedBases := func() []string {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		bases, err := NewDirReader(testDirPath, ts, suffix).ByteAccounting()
+		require.Nil(t, err)
+		return bases
+	}
+
+	// directories written without a basis (e.g. by an older release) have none
+	writeBlock(1000, WithByteAccounting(""))
+	require.Nil(t, storedBases())
+	_, err := os.Stat(accountingPath())
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	writeBlock(1300, WithByteAccounting("l3"))
+	require.Equal(t, []string{"l3"}, storedBases())
+
+	// the file is only rewritten if a basis not stored yet is added
+	stat, err := os.Stat(accountingPath())
+	require.Nil(t, err)
+	writeBlock(1600, WithByteAccounting("l3"))
+	writeBlock(1900)
+	restat, err := os.Stat(accountingPath())
+	require.Nil(t, err)
+	require.True(t, os.SameFile(stat, restat))
+
+	writeBlock(2200, WithByteAccounting("wire"))
+	require.Equal(t, []string{"l3", "wire"}, storedBases())
+	writeBlock(2500, WithByteAccounting("l2", "l3"))
+	require.Equal(t, []string{"l2", "l3", "wire"}, storedBases())
+}
+
+func TestFlowSizes(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	var h FlowSizeHistogram
+	for _, v := range []uint64{0, 1, 2, 3, 4, 5, 1 << 40, math.MaxUint64} {
+		h.Observe(v)
+	}
+	require.Equal(t, [NumFlowSizeBuckets]uint64{0: 2, 1: 1, 2: 2, 3: 1, 40: 1, 64: 1}, h.Buckets)
+	require.EqualValues(t, 8, h.Count())
+	require.EqualValues(t, 4, FlowSizeBucketBound(2))
+	require.EqualValues(t, uint64(math.MaxUint64), FlowSizeBucketBound(NumFlowSizeBuckets-1))
+
+	sizesAt := func(timestamp int64) FlowSizes {
+		var sizes FlowSizes
+		sizes.Observe(types.Counters{BytesRcvd: uint64(timestamp), BytesSent: 1, PacketsRcvd: 1})
+		return sizes
+	}
+	writeBlock := func(timestamp int64, withSizes bool) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, 1000)
+		require.Nil(t, testDir.Open())
+		require.ErrorIs(t, testDir.SetFlowSizes(timestamp, sizesAt(timestamp)), ErrBlockNotFound)
+		require.Nil(t, testDir.WriteBlocks(timestamp, TrafficMetadata{}, BlockOrderSorted, types.Counters{}, [types.ColIdxCount][]byte{}))
+		if withSizes {
+			require.Nil(t, testDir.SetFlowSizes(timestamp, sizesAt(timestamp)))
+		}
+		require.Nil(t, testDir.Close())
+	}
+	readSizes := func() []BlockFlowSizes {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		sizes, err := NewDirReader(testDirPath, ts, suffix).FlowSizes()
+		require.Nil(t, err)
+		return sizes
+	}
+
+	// blocks written without histograms (e.g. by an older release) are not covered, blocks inserted
+	// out of order are kept in chronological order
+	writeBlock(1000, false)
+	require.Empty(t, readSizes())
+	writeBlock(1600, true)
+	writeBlock(1300, true)
+	writeBlock(1900, false)
+	require.Equal(t, []BlockFlowSizes{
+		{Timestamp: 1300, FlowSizes: sizesAt(1300)},
+		{Timestamp: 1600, FlowSizes: sizesAt(1600)},
+	}, readSizes())
+	require.EqualValues(t, 1601, readSizes()[1].Bytes.Sum)
+	require.EqualValues(t, 1, readSizes()[1].Packets.Buckets[0])
+}
+
+func TestOutOfOrderBlocks(t *testing.T) {
+
+	require.Nil(t, os.RemoveAll(testDirPath))
+
+	// payload generates block data of varying length (compressible and non-compressible)
+	payload := func(timestamp int64, colIdx types.ColumnIndex) []byte {
+		if timestamp%200 == 0 {
+			return bytes.Repeat([]byte{byte(timestamp / 100), byte(colIdx)}, int(timestamp/10))
+		}
+		data := make([]byte, int(timestamp/100)+int(colIdx))
+		for i := range data {
+			data[i] = byte(i*31) ^ byte(timestamp)
+		}
+		return data
+	}
+	order := func(timestamp int64) BlockOrder {
+		if timestamp%300 == 0 {
+			return BlockOrderSorted
+		}
+		return BlockOrderUnsorted
+	}
+	writeBlocks := func(timestamps ...int64) {
+		t.Helper()
+		testDir := NewDirWriter(testDirPath, 1000)
+		require.Nil(t, testDir.Open())
+		for _, ts := range timestamps {
+			var data [types.ColIdxCount][]byte
+			if ts != 1450 {
+				for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+					data[colIdx] = payload(ts, colIdx)
+				}
+			}
+			require.Nil(t, testDir.WriteBlocks(ts, TrafficMetadata{NumV4Entries: uint64(ts)}, order(ts), types.Counters{BytesRcvd: 1}, data))
+		}
+		require.Nil(t, testDir.Close())
+	}
+	validate := func(expected ...int64) {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		testDir := NewDirReader(testDirPath, ts, suffix)
+		require.Nil(t, testDir.Open())
+		defer func() {
+			require.Nil(t, testDir.Close())
+		}()
+
+		require.Equal(t, uint64(len(expected)), testDir.Counts.BytesRcvd)
+		require.Len(t, testDir.BlockTraffic, len(expected))
+		for i, ts := range expected {
+			require.Equal(t, uint64(ts), testDir.BlockTraffic[i].NumV4Entries)
+			require.Equal(t, order(ts), testDir.BlockOrderAtIndex(i))
+			for colIdx := types.ColumnIndex(0); colIdx < types.ColIdxCount; colIdx++ {
+				require.Equal(t, ts, testDir.BlockMetadata[colIdx].BlockList[i].Timestamp)
+				data, err := testDir.ReadBlockAtIndex(colIdx, i)
+				require.Nil(t, err)
+				if ts == 1450 {
+					require.Empty(t, data)
+				} else {
+					require.Equal(t, payload(ts, colIdx), data)
+				}
+			}
+		}
+	}
+
+	readColumn := func() []byte {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		data, err := os.ReadFile(filepath.Join(fullPath, types.ColumnFileNames[types.SIPColIdx]+FileSuffix))
+		require.Nil(t, err)
+		return data
+	}
+	headerVersion := func() uint64 {
+		t.Helper()
+		_, fullPath := genWritePathForTimestamp(testDirPath, 1000)
+		ts, suffix, err := ExtractTimestampMetadataSuffix(filepath.Base(fullPath))
+		require.Nil(t, err)
+		testDir := NewDirReader(testDirPath, ts, suffix)
+		require.Nil(t, testDir.Open())
+		defer func() {
+			require.Nil(t, testDir.Close())
+		}()
+		return testDir.Metadata.Version
+	}
+
+	writeBlocks(1000, 1600)
+	validate(1000, 1600)
+	require.Less(t, headerVersion(), uint64(headerVersionBlockOffsets))
+
+	// late blocks are inserted at their position (both across and within write sessions), their data
+	// being appended to the column files (leaving all existing data untouched)
+	before := readColumn()
+	writeBlocks(1300, 2200, 1900)
+	validate(1000, 1300, 1600, 1900, 2200)
+	require.Equal(t, before, readColumn()[:len(before)])
+	require.Equal(t, uint64(headerVersionBlockOffsets), headerVersion())
+
+	before = readColumn()
+	writeBlocks(1450, 800, 1400)
+	validate(800, 1000, 1300, 1400, 1450, 1600, 1900, 2200)
+	require.Equal(t, before, readColumn()[:len(before)])
+
+	// overlapping blocks are rejected without modifying the GPDir
+	testDir := NewDirWriter(testDirPath, 1000)
+	require.Nil(t, testDir.Open())
+	require.ErrorIs(t, writeDummyBlock(1300, testDir, 1), ErrBlockExists)
+	require.ErrorIs(t, writeDummyBlock(2200, testDir, 1), ErrBlockExists)
+	require.Nil(t, testDir.Close())
+	validate(800, 1000, 1300, 1400, 1450, 1600, 1900, 2200)
+}
+
+func TestParallelWriteBlocks(t *testing.T) {
+
+	// Blocks written concurrently must result in the same files as those written sequentially
+	writeDir := func(basePath string, minEntries uint64) {
+		defer func(orig uint64) { minParallelWriteEntries = orig }(minParallelWriteEntries)
+		minParallelWriteEntries = minEntries
+
+		testDir := NewDirWriter(basePath, 1000, WithEncoderTypeLevel(encoders.EncoderTypeLZ4, 0))
+		require.Nil(t, testDir.Open())
+		for ts := int64(1000); ts < 1010; ts++ {
+			var data [types.ColIdxCount][]byte
+			for colIdx := range data {
+				data[colIdx] = bytes.Repeat([]byte{byte(ts), byte(colIdx)}, 1000*(colIdx+1))
+			}
+			require.Nil(t, testDir.WriteBlocks(ts, TrafficMetadata{NumV4Entries: 10}, BlockOrderSorted,
+				types.Counters{BytesRcvd: uint64(ts)}, data, types.BytesRcvdColIdx))
+		}
+		require.Nil(t, testDir.Close())
+	}
+
+	sequentialPath, parallelPath := filepath.Join(t.TempDir(), "sequential"), filepath.Join(t.TempDir(), "parallel")
+	writeDir(sequentialPath, ^uint64(0))
+	writeDir(parallelPath, 0)
+
+	nFiles := 0
+	require.Nil(t, filepath.WalkDir(sequentialPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(sequentialPath, path)
+		require.Nil(t, err)
+
+		expected, err := os.ReadFile(path)
+		require.Nil(t, err)
+		actual, err := os.ReadFile(filepath.Join(parallelPath, rel))
+		require.Nil(t, err)
+		require.Equal(t, expected, actual, rel)
+
+		nFiles++
+		return nil
+	}))
+	require.Greater(t, nFiles, int(types.ColIdxCount))
 }
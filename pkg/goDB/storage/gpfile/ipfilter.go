@@ -0,0 +1,110 @@
+package gpfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/goDB/storage/bloom"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+)
+
+const (
+
+	// IPFilterFileName denotes the name of the file holding the Bloom filter over all IPs of a GPDir
+	IPFilterFileName = ".ipfilter"
+
+	// ipFilterCapacity denotes the number of distinct IPs per GPDir the filter is sized for. Beyond
+	// it, the false positive rate of the filter grows (without ever producing false negatives)
+	ipFilterCapacity = 1 << 16
+
+	// ipFilterFalsePositiveRate denotes the false positive rate of the filter at its capacity
+	ipFilterFalsePositiveRate = 0.01
+
+	// ipFilterHeaderLen denotes the length of the header preceding the serialized filter, stating the
+	// number of IPv4 and IPv6 flows covered by the filter (8 bytes each, big-endian)
+	ipFilterHeaderLen = 16
+)
+
+// IPFilter denotes a Bloom filter over all source and destination IPs stored in a GPDir. It allows
+// to rule out the presence of an IP without reading any block
+type IPFilter struct {
+	filter  *bloom.Filter
+	covered TrafficMetadata // flows covered by the filter
+}
+
+func newIPFilter() *IPFilter {
+	return &IPFilter{filter: bloom.New(ipFilterCapacity, ipFilterFalsePositiveRate)}
+}
+
+// Contains returns whether the IP (in its 4 or 16 byte representation) may be stored in the GPDir
+// (false if it is definitely not)
+func (f *IPFilter) Contains(ip []byte) bool {
+	return f.filter.Contains(ip)
+}
+
+// addBlock adds all IPs of the source and destination IP columns of a block to the filter. The
+// columns hold the IPv4 addresses of all IPv4 flows, followed by the IPv6 addresses of all IPv6 flows
+func (f *IPFilter) addBlock(sipCol, dipCol []byte, blockTraffic TrafficMetadata) {
+	v4Len := int(blockTraffic.NumV4Entries) * types.IPv4Width
+	for _, col := range [][]byte{sipCol, dipCol} {
+		if len(col) != v4Len+int(blockTraffic.NumV6Entries)*types.IPv6Width {
+			continue
+		}
+		for i := 0; i < v4Len; i += types.IPv4Width {
+			f.filter.Add(col[i : i+types.IPv4Width])
+		}
+		for i := v4Len; i < len(col); i += types.IPv6Width {
+			f.filter.Add(col[i : i+types.IPv6Width])
+		}
+	}
+	f.covered.NumV4Entries += blockTraffic.NumV4Entries
+	f.covered.NumV6Entries += blockTraffic.NumV6Entries
+}
+
+// covers returns whether the filter covers all flows of the traffic metadata of a GPDir. This is not
+// the case if blocks were written without maintaining the filter (e.g. by an older release)
+func (f *IPFilter) covers(traffic TrafficMetadata) bool {
+	return f.covered.NumV4Entries == traffic.NumV4Entries && f.covered.NumV6Entries == traffic.NumV6Entries
+}
+
+// readIPFilter reads the IP filter from the GPDir path (returning nil if there is none)
+func readIPFilter(dirPath string) (*IPFilter, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, IPFilterFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < ipFilterHeaderLen {
+		return nil, fmt.Errorf("%w: IP filter too short (len: %d)", bloom.ErrInvalidFilter, len(data))
+	}
+
+	f := &IPFilter{filter: new(bloom.Filter)}
+	f.covered.NumV4Entries = binary.BigEndian.Uint64(data[0:8])
+	f.covered.NumV6Entries = binary.BigEndian.Uint64(data[8:16])
+	if err := f.filter.UnmarshalBinary(data[ipFilterHeaderLen:]); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeIPFilterAtomic writes the IP filter to the GPDir path (via a temporary file, so that readers
+// never observe a partially written filter)
+func writeIPFilterAtomic(dirPath string, f *IPFilter, permissions fs.FileMode) (err error) {
+	filterData, err := f.filter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, ipFilterHeaderLen, ipFilterHeaderLen+len(filterData))
+	binary.BigEndian.PutUint64(data[0:8], f.covered.NumV4Entries)
+	binary.BigEndian.PutUint64(data[8:16], f.covered.NumV6Entries)
+	data = append(data, filterData...)
+
+	return fsutil.WriteAtomic(filepath.Join(dirPath, IPFilterFileName), data, permissions)
+}
@@ -0,0 +1,239 @@
+package gpfile
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+)
+
+const (
+
+	// IPIndexFileName denotes the name of the file holding the index of all unique IPs of a GPDir
+	IPIndexFileName = ".ipindex"
+
+	// ipIndexVersion denotes the version of the serialized index layout
+	ipIndexVersion = 1
+
+	// ipIndexHeaderLen denotes the length of the header preceding the serialized index, stating the
+	// number of IPv4 and IPv6 flows covered by the index (8 bytes each, big-endian) and the layout version
+	ipIndexHeaderLen = 17
+)
+
+var (
+	// ErrInvalidIPIndex denotes that a serialized IP index is malformed
+	ErrInvalidIPIndex = errors.New("invalid IP index")
+
+	// ErrUnsupportedIPIndexVersion denotes that an IP index was serialized in an (unknown) layout newer
+	// than the one supported by this release
+	ErrUnsupportedIPIndexVersion = errors.New("unsupported IP index version")
+)
+
+// IPIndex denotes the sorted set of all unique source and destination IPs stored in a GPDir. In contrast
+// to the IPFilter, it provides exact answers and allows to enumerate the IPs of a day
+type IPIndex struct {
+	v4      []uint32        // IPv4 addresses (sorted, unique)
+	v6      [][16]byte      // IPv6 addresses (sorted, unique)
+	covered TrafficMetadata // flows covered by the index
+}
+
+func newIPIndex() *IPIndex {
+	return &IPIndex{}
+}
+
+// Len returns the number of unique IPs in the index
+func (x *IPIndex) Len() int {
+	return len(x.v4) + len(x.v6)
+}
+
+// Contains returns whether the IP is stored in the GPDir (as source or destination)
+func (x *IPIndex) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.Is4() {
+		_, found := slices.BinarySearch(x.v4, binary.BigEndian.Uint32(ip.AsSlice()))
+		return found
+	}
+	_, found := slices.BinarySearchFunc(x.v6, ip.As16(), compareIPv6)
+	return found
+}
+
+// IPs returns all IPs of the index (IPv4 addresses first, each sorted in ascending order)
+func (x *IPIndex) IPs() []netip.Addr {
+	ips := make([]netip.Addr, 0, x.Len())
+	for _, ip := range x.v4 {
+		ips = append(ips, netip.AddrFrom4([4]byte(binary.BigEndian.AppendUint32(nil, ip))))
+	}
+	for _, ip := range x.v6 {
+		ips = append(ips, netip.AddrFrom16(ip))
+	}
+	return ips
+}
+
+// addBlock adds all IPs of the source and destination IP columns of a block to the index. The columns
+// hold the IPv4 addresses of all IPv4 flows, followed by the IPv6 addresses of all IPv6 flows
+func (x *IPIndex) addBlock(sipCol, dipCol []byte, blockTraffic TrafficMetadata) {
+	var (
+		v4Len = int(blockTraffic.NumV4Entries) * types.IPv4Width
+		v4    = make([]uint32, 0, 2*blockTraffic.NumV4Entries)
+		v6    = make([][16]byte, 0, 2*blockTraffic.NumV6Entries)
+	)
+	for _, col := range [][]byte{sipCol, dipCol} {
+		if len(col) != v4Len+int(blockTraffic.NumV6Entries)*types.IPv6Width {
+			continue
+		}
+		for i := 0; i < v4Len; i += types.IPv4Width {
+			v4 = append(v4, binary.BigEndian.Uint32(col[i:i+types.IPv4Width]))
+		}
+		for i := v4Len; i < len(col); i += types.IPv6Width {
+			v6 = append(v6, [16]byte(col[i:i+types.IPv6Width]))
+		}
+	}
+
+	// the IPs of the block are merged into the (sorted) index, which is considerably cheaper than
+	// re-sorting the whole index since the IPs of a day mostly recur across its blocks
+	slices.Sort(v4)
+	slices.SortFunc(v6, compareIPv6)
+	x.v4 = mergeUnique(x.v4, slices.Compact(v4), cmp.Compare[uint32])
+	x.v6 = mergeUnique(x.v6, slices.Compact(v6), compareIPv6)
+
+	x.covered.NumV4Entries += blockTraffic.NumV4Entries
+	x.covered.NumV6Entries += blockTraffic.NumV6Entries
+}
+
+// covers returns whether the index covers all flows of the traffic metadata of a GPDir. This is not
+// the case if blocks were written without maintaining the index (e.g. by an older release)
+func (x *IPIndex) covers(traffic TrafficMetadata) bool {
+	return x.covered.NumV4Entries == traffic.NumV4Entries && x.covered.NumV6Entries == traffic.NumV6Entries
+}
+
+// MarshalBinary serializes the index. Its layout is as follows:
+//
+//	[covered IPv4 flows (8 bytes)][covered IPv6 flows (8 bytes)][version (1 byte)]
+//	[number of IPv4 addresses (uvarint)][IPv4 addresses, delta-encoded (uvarint each)]
+//	[number of IPv6 addresses (uvarint)][IPv6 addresses (16 bytes each)]
+func (x *IPIndex) MarshalBinary() ([]byte, error) {
+	data := make([]byte, ipIndexHeaderLen, ipIndexHeaderLen+2*binary.MaxVarintLen64+2*len(x.v4)+16*len(x.v6))
+	binary.BigEndian.PutUint64(data[0:8], x.covered.NumV4Entries)
+	binary.BigEndian.PutUint64(data[8:16], x.covered.NumV6Entries)
+	data[16] = ipIndexVersion
+
+	data = binary.AppendUvarint(data, uint64(len(x.v4)))
+	var prev uint32
+	for _, ip := range x.v4 {
+		data = binary.AppendUvarint(data, uint64(ip-prev))
+		prev = ip
+	}
+	data = binary.AppendUvarint(data, uint64(len(x.v6)))
+	for _, ip := range x.v6 {
+		data = append(data, ip[:]...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary deserializes the index (see MarshalBinary)
+func (x *IPIndex) UnmarshalBinary(data []byte) error {
+	if len(data) < ipIndexHeaderLen {
+		return fmt.Errorf("%w: too short (len: %d)", ErrInvalidIPIndex, len(data))
+	}
+	if data[16] != ipIndexVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedIPIndexVersion, data[16])
+	}
+	x.covered.NumV4Entries = binary.BigEndian.Uint64(data[0:8])
+	x.covered.NumV6Entries = binary.BigEndian.Uint64(data[8:16])
+	data = data[ipIndexHeaderLen:]
+
+	numV4, n := binary.Uvarint(data)
+	if n <= 0 || numV4 > uint64(len(data)) {
+		return fmt.Errorf("%w: invalid number of IPv4 addresses", ErrInvalidIPIndex)
+	}
+	data = data[n:]
+	x.v4 = make([]uint32, 0, numV4)
+	var prev uint64
+	for i := uint64(0); i < numV4; i++ {
+		delta, n := binary.Uvarint(data)
+		if n <= 0 || delta > math.MaxUint32-prev || (i > 0 && delta == 0) {
+			return fmt.Errorf("%w: invalid IPv4 address at index %d", ErrInvalidIPIndex, i)
+		}
+		data = data[n:]
+		prev += delta
+		x.v4 = append(x.v4, uint32(prev))
+	}
+
+	numV6, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) != numV6*16 {
+		return fmt.Errorf("%w: invalid number of IPv6 addresses", ErrInvalidIPIndex)
+	}
+	data = data[n:]
+	x.v6 = make([][16]byte, 0, numV6)
+	for i := 0; i < len(data); i += 16 {
+		x.v6 = append(x.v6, [16]byte(data[i:i+16]))
+	}
+	return nil
+}
+
+// readIPIndex reads the IP index from the GPDir path (returning nil if there is none)
+func readIPIndex(dirPath string) (*IPIndex, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, IPIndexFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	x := new(IPIndex)
+	if err := x.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// writeIPIndexAtomic writes the IP index to the GPDir path (via a temporary file, so that readers
+// never observe a partially written index)
+func writeIPIndexAtomic(dirPath string, x *IPIndex, permissions fs.FileMode) (err error) {
+	data, err := x.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteAtomic(filepath.Join(dirPath, IPIndexFileName), data, permissions)
+}
+
+func compareIPv6(a, b [16]byte) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// mergeUnique merges two sorted slices of unique elements into a sorted slice of unique elements
+func mergeUnique[T any](a, b []T, compare func(T, T) int) []T {
+	if len(b) == 0 {
+		return a
+	}
+	merged := make([]T, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch c := compare(a[i], b[j]); {
+		case c < 0:
+			merged = append(merged, a[i])
+			i++
+		case c > 0:
+			merged = append(merged, b[j])
+			j++
+		default:
+			merged = append(merged, a[i])
+			i++
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
@@ -11,9 +11,27 @@ import (
 )
 
 const (
-	metadataFileName = ".blockmeta"
+
+	// MetadataFileName denotes the name of the file holding the metadata of a GPDir
+	MetadataFileName = ".blockmeta"
+
+	// MetadataPrevFileSuffix denotes the suffix of the file holding the previous generation of the metadata
+	// of a GPDir (used to recover the GPDir should the metadata get lost or corrupted)
+	MetadataPrevFileSuffix = ".prev"
 )
 
+// SidecarFileNames lists the names of the (optional) files stored alongside the metadata and the column
+// files of a GPDir. All of them are replaced atomically and tolerate covering blocks not (yet) referenced
+// by the metadata, hence they can be copied after it (e.g. by a snapshot)
+var SidecarFileNames = []string{
+	BlockOrderFileName,
+	OriginFileName,
+	ByteAccountingFileName,
+	IPFilterFileName,
+	IPIndexFileName,
+	FlowSizesFileName,
+}
+
 // TrafficMetadata denotes a serializable set of metadata information about traffic stats
 type TrafficMetadata struct {
 	NumV4Entries uint64 `json:"num_v4_entries"`
@@ -75,7 +93,7 @@ type Metadata struct {
 func newMetadata() *Metadata {
 	m := Metadata{
 		BlockTraffic: make([]TrafficMetadata, 0),
-		Version:      headerVersion,
+		Version:      headerVersionInitial,
 	}
 	for i := 0; i < int(types.ColIdxCount); i++ {
 		m.BlockMetadata[i] = &storage.BlockHeader{
@@ -86,6 +104,21 @@ func newMetadata() *Metadata {
 	return &m
 }
 
+// Clone returns a copy of the metadata, which can be used by a GPDir (and released upon closing it)
+// independently of m. The block lists and traffic metadata are shared and must not be modified
+func (m *Metadata) Clone() *Metadata {
+	c := *m
+	for i, header := range m.BlockMetadata {
+		if header != nil {
+			c.BlockMetadata[i] = &storage.BlockHeader{
+				BlockList:     header.BlockList,
+				CurrentOffset: header.CurrentOffset,
+			}
+		}
+	}
+	return &c
+}
+
 const (
 	maxDirnameLength = 96 // accounts for a 12-digit epoch timestamp and 7 worst-case compressed uint64 values & delimeters
 
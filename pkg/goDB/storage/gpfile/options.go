@@ -16,12 +16,22 @@ type optionSetterCommon interface {
 	setPermissions(fs.FileMode)
 }
 
+// optionSetterDir denotes options that apply to GPDir only
+type optionSetterDir interface {
+	setMetadata(*Metadata)
+	setOrigin(Origin)
+	setByteAccounting([]string)
+}
+
 // optionSetterFile denotes options that apply to GPFile only
 type optionSetterFile interface {
 	optionSetterCommon
 	setMemPool(concurrency.MemPoolGCable)
 	setEncoder(encoder.Encoder)
 	setEncoderTypeLevel(encoders.Type, int)
+	setAdaptiveEncoding(AdaptiveEncoding)
+	setBlockFrames()
+	setReadTimings(*ReadTimings)
 }
 
 // WithEncoder allows to set the compression implementation
@@ -42,6 +52,29 @@ func WithEncoderTypeLevel(t encoders.Type, l int) Option {
 	}
 }
 
+// WithAdaptiveEncoding enables the per-block selection of the encoder (among the null encoder, LZ4 and
+// ZSTD) during write operations, based on the compression ratio achieved on a sample of each block and
+// the CPU budget
+func WithAdaptiveEncoding(a AdaptiveEncoding) Option {
+	return func(o any) {
+		if obj, ok := o.(optionSetterFile); ok {
+			obj.setAdaptiveEncoding(a)
+		}
+	}
+}
+
+// WithBlockFrames precedes the data of each block written with a frame header stating its timestamp, its
+// length and its encoder type (see blockframes.go), allowing to rebuild the metadata of a GPDir from its
+// column files should it get lost. Since the data of the blocks is no longer contiguous, the metadata of
+// directories written with block frames requires header version 8 (headerVersionBlockOffsets)
+func WithBlockFrames() Option {
+	return func(o any) {
+		if obj, ok := o.(optionSetterFile); ok {
+			obj.setBlockFrames()
+		}
+	}
+}
+
 // WithReadAll triggers a full read of the underlying file from disk
 // upon first read access to minimize I/O load.
 // Seeking is handled by replacing the underlying file with a seekable
@@ -54,6 +87,17 @@ func WithReadAll(pool concurrency.MemPoolGCable) Option {
 	}
 }
 
+// WithReadTimings enables tracking of the time spent reading / decompressing blocks. Since
+// the timings are not protected against concurrent access, they must not be shared between
+// concurrently used files
+func WithReadTimings(t *ReadTimings) Option {
+	return func(o any) {
+		if obj, ok := o.(optionSetterFile); ok {
+			obj.setReadTimings(t)
+		}
+	}
+}
+
 // WithPermissions sets a non-default set of permissions / file mode for
 // the file
 func WithPermissions(permissions fs.FileMode) Option {
@@ -63,3 +107,34 @@ func WithPermissions(permissions fs.FileMode) Option {
 		}
 	}
 }
+
+// WithMetadata provides the (previously read) metadata of a GPDir opened in read mode, which is used
+// instead of reading it from disk (e.g. from a cache). A copy is used, hence the metadata remains
+// valid after closing the GPDir
+func WithMetadata(meta *Metadata) Option {
+	return func(o any) {
+		if obj, ok := o.(optionSetterDir); ok {
+			obj.setMetadata(meta)
+		}
+	}
+}
+
+// WithOrigin sets the origin of the data written to a GPDir opened in write mode (i.e. the capturing
+// host), which is stored along with its metadata. It replaces any origin stored previously
+func WithOrigin(origin Origin) Option {
+	return func(o any) {
+		if obj, ok := o.(optionSetterDir); ok {
+			obj.setOrigin(origin)
+		}
+	}
+}
+
+// WithByteAccounting sets the bases the traffic volume of the data written to a GPDir opened in write mode
+// was accounted on, which are added to the bases stored along with its metadata (empty bases are ignored)
+func WithByteAccounting(bases ...string) Option {
+	return func(o any) {
+		if obj, ok := o.(optionSetterDir); ok {
+			obj.setByteAccounting(bases)
+		}
+	}
+}
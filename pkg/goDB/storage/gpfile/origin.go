@@ -0,0 +1,72 @@
+package gpfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/els0r/goProbe/pkg/util/fsutil"
+)
+
+// OriginFileName denotes the name of the file holding the origin of the data of a GPDir
+const OriginFileName = ".origin"
+
+// ErrInvalidOrigin denotes that the origin of a GPDir could not be decoded
+var ErrInvalidOrigin = errors.New("invalid GPDir origin")
+
+// Origin denotes the host which captured the data of a GPDir, allowing to attribute it to its origin
+// even after it was copied off the host (e.g. for offline analysis)
+type Origin struct {
+	Hostname string // Hostname of the capturing host
+	HostID   string // Host ID of the capturing host
+}
+
+// IsZero returns whether the origin is unknown
+func (o Origin) IsZero() bool {
+	return o.Hostname == "" && o.HostID == ""
+}
+
+// Origin reads the origin of the data of the GPDir. If there is none (e.g. because the directory was
+// written by an older release), nil is returned. It does not require the GPDir to be open
+func (d *GPDir) Origin() (*Origin, error) {
+	return readOrigin(d.dirPath)
+}
+
+// readOrigin reads the origin from the GPDir path (returning nil if there is none)
+func readOrigin(dirPath string) (*Origin, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, OriginFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The origin is stored as two length-prefixed strings (2 bytes each, big-endian)
+	var fields [2]string
+	for i := range fields {
+		if len(data) < 2 || len(data) < 2+int(binary.BigEndian.Uint16(data)) {
+			return nil, fmt.Errorf("%w: truncated field %d", ErrInvalidOrigin, i)
+		}
+		n := 2 + int(binary.BigEndian.Uint16(data))
+		fields[i], data = string(data[2:n]), data[n:]
+	}
+	return &Origin{Hostname: fields[0], HostID: fields[1]}, nil
+}
+
+// writeOriginAtomic writes the origin to the GPDir path (via a temporary file, so that readers never
+// observe a partially written origin)
+func writeOriginAtomic(dirPath string, origin Origin, permissions fs.FileMode) (err error) {
+	data := make([]byte, 0, 4+len(origin.Hostname)+len(origin.HostID))
+	for _, field := range []string{origin.Hostname, origin.HostID} {
+		field = field[:min(len(field), math.MaxUint16)]
+		data = binary.BigEndian.AppendUint16(data, uint16(len(field)))
+		data = append(data, field...)
+	}
+
+	return fsutil.WriteAtomic(filepath.Join(dirPath, OriginFileName), data, permissions)
+}
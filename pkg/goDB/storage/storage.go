@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"slices"
+
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
 )
 
@@ -106,6 +108,19 @@ func (b *BlockHeader) AddBlock(ts int64, block Block) {
 	b.blocks[ts] = len(b.BlockList) - 1
 }
 
+// InsertBlock inserts a new block into the header at a given index (retaining the chronological order of
+// the list of blocks). Its offset is not related to the ones of its neighbours, i.e. the data of the blocks
+// is not necessarily stored in order
+func (b *BlockHeader) InsertBlock(idx int, ts int64, block Block) {
+	b.BlockList = slices.Insert(b.BlockList, idx, BlockAtTime{
+		Timestamp: ts,
+		Block:     block,
+	})
+
+	// Since the indices of all subsequent blocks have changed, the lookup map is recreated
+	b.populateLookupMap()
+}
+
 func (b *BlockHeader) populateLookupMap() {
 	b.blocks = make(map[int64]int, len(b.BlockList))
 	for i := 0; i < len(b.BlockList); i++ {
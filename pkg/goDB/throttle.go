@@ -0,0 +1,73 @@
+package goDB
+
+import (
+	"context"
+	"sync"
+)
+
+// readThrottle adaptively limits the number of workers of a DBWorkManager concurrently processing
+// workloads. Whenever a worker is stalled passing its result on to the (slower) merge stage, the limit
+// is halved, and it is raised again by one for each result passed on without stalling (AIMD). This way,
+// the number of (potentially large) aggregated maps held in memory at once remains low if the merge
+// stage cannot keep up, while the full concurrency is used otherwise
+type readThrottle struct {
+	limit, active, max int
+	reductions         uint64
+
+	cond *sync.Cond
+	sync.Mutex
+}
+
+func newReadThrottle(max int) *readThrottle {
+	t := &readThrottle{
+		limit: max,
+		max:   max,
+	}
+	t.cond = sync.NewCond(&t.Mutex)
+	return t
+}
+
+// acquire waits until the worker may process the next workload. Once ctx is done, workers are admitted
+// immediately (in order to handle the cancellation / deadline)
+func (t *readThrottle) acquire(ctx context.Context) {
+	stop := context.AfterFunc(ctx, func() {
+		t.Lock()
+		t.cond.Broadcast()
+		t.Unlock()
+	})
+	defer stop()
+
+	t.Lock()
+	defer t.Unlock()
+
+	for t.active >= t.limit && ctx.Err() == nil {
+		t.cond.Wait()
+	}
+	t.active++
+}
+
+// release signals that the worker has passed on its result, adapting the limit depending on whether
+// it was stalled doing so
+func (t *readThrottle) release(stalled bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.active--
+	if stalled {
+		if t.limit > 1 {
+			t.limit /= 2
+			t.reductions++
+		}
+	} else if t.limit < t.max {
+		t.limit++
+	}
+	t.cond.Broadcast()
+}
+
+// stats returns the current limit and the number of times it was reduced
+func (t *readThrottle) stats() (limit int, reductions uint64) {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.limit, t.reductions
+}
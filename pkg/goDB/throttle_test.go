@@ -0,0 +1,67 @@
+package goDB
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadThrottle(t *testing.T) {
+	throttle := newReadThrottle(4)
+
+	// stalls halve the limit (down to a minimum of one)
+	for i := 0; i < 4; i++ {
+		throttle.acquire(context.Background())
+	}
+	for i := 0; i < 4; i++ {
+		throttle.release(true)
+	}
+	limit, reductions := throttle.stats()
+	require.Equal(t, 1, limit)
+	require.Equal(t, uint64(2), reductions)
+
+	// a worker exceeding the limit has to wait for another one to release
+	throttle.acquire(context.Background())
+	acquired := make(chan struct{})
+	go func() {
+		throttle.acquire(context.Background())
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("worker exceeded the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	throttle.release(false)
+	<-acquired
+
+	// results passed on without stalling raise the limit again (up to the maximum)
+	for i := 0; i < 8; i++ {
+		throttle.release(false)
+	}
+	limit, _ = throttle.stats()
+	require.Equal(t, 4, limit)
+}
+
+func TestReadThrottleCancel(t *testing.T) {
+	throttle := newReadThrottle(1)
+	throttle.acquire(context.Background())
+
+	// once the context is done, workers are admitted irrespective of the limit
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan struct{})
+	go func() {
+		throttle.acquire(ctx)
+		close(acquired)
+	}()
+	cancel()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("worker not admitted after cancellation")
+	}
+}
@@ -0,0 +1,337 @@
+// Package alerting implements goProbe's built-in alerting: simple threshold rules over the probe's
+// own metrics (e.g. the packet drop rate of an interface) are evaluated in-process and the resulting
+// alerts are exposed via the API and as Prometheus metrics. Alerts starting to fire or resolving are
+// additionally posted to a set of webhooks, providing a minimal self-contained alerting capability
+// for sites without a dedicated alerting infrastructure (such as Prometheus Alertmanager)
+package alerting
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/telemetry/logging"
+)
+
+// State denotes the state of an alert
+type State string
+
+const (
+	StatePending  State = "pending"  // StatePending : the condition holds, but not (yet) for the configured duration
+	StateFiring   State = "firing"   // StateFiring : the condition holds for at least the configured duration
+	StateResolved State = "resolved" // StateResolved : the condition no longer holds after the alert fired
+)
+
+// Alert denotes the state of an alert rule (for a specific interface)
+type Alert struct {
+	// Rule: the name of the rule
+	Rule string `json:"rule" doc:"Name of the rule" example:"high-drops"`
+	// Metric: the metric evaluated by the rule
+	Metric string `json:"metric" doc:"Metric evaluated by the rule" example:"drops_rate"`
+	// Iface: the interface the alert refers to
+	Iface string `json:"iface,omitempty" doc:"Interface the alert refers to (empty for global metrics)" example:"eth0"`
+	// State: the state of the alert
+	State State `json:"state" doc:"State of the alert" enum:"pending,firing,resolved" example:"firing"`
+	// Value: the last evaluated value of the metric
+	Value float64 `json:"value" doc:"Last evaluated value of the metric" example:"250"`
+	// Threshold: the value the metric is compared against
+	Threshold float64 `json:"threshold" doc:"Value the metric is compared against" example:"100"`
+	// ActiveSince: the time when the condition started to hold
+	ActiveSince time.Time `json:"active_since" doc:"Time when the condition started to hold" example:"2024-04-12T09:45:00+02:00"`
+	// FiredAt: the time when the alert fired
+	FiredAt *time.Time `json:"fired_at,omitempty" doc:"Time when the alert fired" example:"2024-04-12T09:46:00+02:00"`
+	// ResolvedAt: the time when the alert resolved
+	ResolvedAt *time.Time `json:"resolved_at,omitempty" doc:"Time when the alert resolved" example:"2024-04-12T09:50:00+02:00"`
+}
+
+// Source denotes a source of the metrics evaluated by the alert rules (usually the capture manager)
+type Source interface {
+	Status(ctx context.Context, ifaces ...string) capturetypes.InterfaceStats
+	WriteoutCongested() bool
+}
+
+// ConfigSource provides the current alerting configuration and the configured interfaces (usually
+// the config monitor), allowing rules to be changed at runtime
+type ConfigSource interface {
+	GetAlertingConfig() *config.AlertingConfig
+	GetIfaces() []string
+}
+
+// alertKey identifies an alert by its rule and interface
+type alertKey struct {
+	rule  string
+	iface string
+}
+
+// counterSample stores the packet counters of an interface at the time of an evaluation, allowing
+// to derive rates from subsequent evaluations
+type counterSample struct {
+	startedAt time.Time
+	received  uint64
+	dropped   uint64
+	timestamp time.Time
+}
+
+// Evaluator periodically evaluates the alert rules and tracks the state of the resulting alerts
+type Evaluator struct {
+	source       Source
+	configSource ConfigSource
+	notifier     *notifier
+
+	samples map[string]counterSample
+	alerts  map[alertKey]*Alert
+
+	sync.Mutex
+}
+
+// New creates a new alert rule evaluator
+func New(source Source, configSource ConfigSource) *Evaluator {
+	return &Evaluator{
+		source:       source,
+		configSource: configSource,
+		notifier:     newNotifier(),
+		samples:      make(map[string]counterSample),
+		alerts:       make(map[alertKey]*Alert),
+	}
+}
+
+// Run evaluates the alert rules in the configured interval until the context is cancelled. Changes
+// of the interval (e.g. via a config reload) take effect after the current interval has passed
+func (e *Evaluator) Run(ctx context.Context) {
+	interval := e.interval()
+
+	logger := logging.FromContext(ctx)
+	logger.With("interval", interval).Info("starting alert rule evaluation")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// take an initial sample immediately so that rates are available after the first interval
+	e.Evaluate(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping alert rule evaluation")
+			return
+		case t := <-ticker.C:
+			e.Evaluate(ctx, t)
+
+			if newInterval := e.interval(); newInterval != interval {
+				logger.With("interval", newInterval).Info("changing alert rule evaluation interval")
+				interval = newInterval
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+// interval returns the currently configured evaluation interval
+func (e *Evaluator) interval() time.Duration {
+	if cfg := e.configSource.GetAlertingConfig(); cfg != nil && cfg.Interval > 0 {
+		return cfg.Interval
+	}
+	return config.DefaultAlertingInterval
+}
+
+// Alerts returns all (pending, firing and resolved) alerts, sorted by rule and interface
+func (e *Evaluator) Alerts() []Alert {
+	e.Lock()
+	defer e.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	slices.SortFunc(alerts, func(a, b Alert) int {
+		if c := strings.Compare(a.Rule, b.Rule); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Iface, b.Iface)
+	})
+
+	return alerts
+}
+
+// Evaluate performs a single evaluation of all alert rules at time t
+func (e *Evaluator) Evaluate(ctx context.Context, t time.Time) {
+	cfg := e.configSource.GetAlertingConfig()
+	if cfg == nil {
+		cfg = new(config.AlertingConfig)
+	}
+	ifaces := e.configSource.GetIfaces()
+	values := e.sample(ctx, t, ifaces)
+
+	e.Lock()
+	defer e.Unlock()
+
+	var (
+		changed []Alert
+		active  = make(map[alertKey]struct{})
+	)
+	for _, rule := range cfg.Rules {
+		for _, iface := range ruleIfaces(rule, ifaces) {
+			key := alertKey{rule: rule.Name, iface: iface}
+			active[key] = struct{}{}
+
+			// metrics without a value (e.g. rates directly after the capture was started) leave
+			// the state of the alert unchanged
+			value, exists := values[metricKey{metric: rule.Metric, iface: iface}]
+			if !exists {
+				continue
+			}
+			if alert, changedState := e.update(key, rule, value, t); changedState {
+				changed = append(changed, alert)
+			}
+		}
+	}
+
+	// remove alerts whose rules (or interfaces) no longer exist
+	for key := range e.alerts {
+		if _, exists := active[key]; !exists {
+			delete(e.alerts, key)
+			promAlertFiring.DeleteLabelValues(key.rule, key.iface)
+		}
+	}
+
+	if len(changed) > 0 {
+		e.notifier.notify(ctx, cfg.Webhooks, changed)
+	}
+}
+
+// update transitions the alert identified by key based on the current value of the metric and
+// returns the alert and whether it started to fire or resolved
+func (e *Evaluator) update(key alertKey, rule config.AlertRule, value float64, t time.Time) (Alert, bool) {
+	alert, exists := e.alerts[key]
+	if !compare(value, rule.Op, rule.Threshold) {
+		if !exists {
+			return Alert{}, false
+		}
+		alert.Value = value
+		switch alert.State {
+		case StatePending:
+			// the alert never fired, so there is nothing to resolve
+			delete(e.alerts, key)
+		case StateFiring:
+			alert.State, alert.ResolvedAt = StateResolved, &t
+			promAlertFiring.WithLabelValues(key.rule, key.iface).Set(0)
+			return *alert, true
+		}
+		return Alert{}, false
+	}
+
+	if !exists || alert.State == StateResolved {
+		alert = &Alert{
+			Rule:        rule.Name,
+			Metric:      rule.Metric,
+			Iface:       key.iface,
+			State:       StatePending,
+			ActiveSince: t,
+		}
+		e.alerts[key] = alert
+	}
+	alert.Value, alert.Threshold = value, rule.Threshold
+
+	if alert.State == StatePending && t.Sub(alert.ActiveSince) >= rule.For {
+		alert.State, alert.FiredAt = StateFiring, &t
+		promAlertFiring.WithLabelValues(key.rule, key.iface).Set(1)
+		return *alert, true
+	}
+	return Alert{}, false
+}
+
+// metricKey identifies the value of a metric (for a specific interface)
+type metricKey struct {
+	metric string
+	iface  string
+}
+
+// sample determines the current values of all metrics
+func (e *Evaluator) sample(ctx context.Context, t time.Time, ifaces []string) map[metricKey]float64 {
+	values := make(map[metricKey]float64)
+
+	congested := 0.
+	if e.source.WriteoutCongested() {
+		congested = 1.
+	}
+	values[metricKey{metric: config.AlertMetricWriteoutCongested}] = congested
+
+	stats := e.source.Status(ctx)
+	for _, iface := range ifaces {
+		_, capturing := stats[iface]
+		down := 1.
+		if capturing {
+			down = 0.
+		}
+		values[metricKey{metric: config.AlertMetricIfaceDown, iface: iface}] = down
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	for iface, stat := range stats {
+
+		// an interface which never carried traffic (since its capture was started) isn't considered silent,
+		// allowing to apply rules to all interfaces, including those which are idle by design
+		if !stat.LastPacketAt.IsZero() {
+			values[metricKey{metric: config.AlertMetricSilenceSeconds, iface: iface}] = max(t.Sub(stat.LastPacketAt).Seconds(), 0)
+		}
+
+		current := counterSample{
+			startedAt: stat.StartedAt,
+			received:  stat.ReceivedTotal,
+			dropped:   stat.DroppedTotal,
+			timestamp: t,
+		}
+		previous, exists := e.samples[iface]
+		e.samples[iface] = current
+
+		// rates can only be derived from two samples of the same capture
+		elapsed := current.timestamp.Sub(previous.timestamp).Seconds()
+		if !exists || !previous.startedAt.Equal(current.startedAt) || elapsed <= 0 ||
+			current.received < previous.received || current.dropped < previous.dropped {
+			continue
+		}
+		values[metricKey{metric: config.AlertMetricPacketsRate, iface: iface}] = float64(current.received-previous.received) / elapsed
+		values[metricKey{metric: config.AlertMetricDropsRate, iface: iface}] = float64(current.dropped-previous.dropped) / elapsed
+	}
+	for iface := range e.samples {
+		if _, exists := stats[iface]; !exists {
+			delete(e.samples, iface)
+		}
+	}
+
+	return values
+}
+
+// ruleIfaces returns the interfaces a rule is evaluated for (a single, empty one for global metrics)
+func ruleIfaces(rule config.AlertRule, ifaces []string) []string {
+	if rule.Metric == config.AlertMetricWriteoutCongested {
+		return []string{""}
+	}
+	if len(rule.Ifaces) > 0 {
+		return rule.Ifaces
+	}
+	return ifaces
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
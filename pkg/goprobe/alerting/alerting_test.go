@@ -0,0 +1,265 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSource struct {
+	stats     capturetypes.InterfaceStats
+	congested bool
+}
+
+func (m *mockSource) Status(_ context.Context, _ ...string) capturetypes.InterfaceStats {
+	return m.stats
+}
+
+func (m *mockSource) WriteoutCongested() bool {
+	return m.congested
+}
+
+type mockConfigSource struct {
+	cfg    *config.AlertingConfig
+	ifaces []string
+}
+
+func (m *mockConfigSource) GetAlertingConfig() *config.AlertingConfig {
+	return m.cfg
+}
+
+func (m *mockConfigSource) GetIfaces() []string {
+	return m.ifaces
+}
+
+func TestDropsRate(t *testing.T) {
+	var (
+		startedAt = time.Now()
+		source    = &mockSource{stats: capturetypes.InterfaceStats{
+			"eth0": {StartedAt: startedAt},
+			"eth1": {StartedAt: startedAt},
+		}}
+		configSource = &mockConfigSource{
+			cfg: &config.AlertingConfig{Rules: config.AlertRules{
+				{Name: "high-drops", Metric: config.AlertMetricDropsRate, Op: ">", Threshold: 10, For: time.Minute},
+			}},
+			ifaces: []string{"eth0", "eth1"},
+		}
+		e  = New(source, configSource)
+		t0 = time.Now()
+	)
+
+	// the initial evaluation only samples the counters
+	e.Evaluate(context.Background(), t0)
+	require.Empty(t, e.Alerts())
+
+	// 20 drops per second on eth0
+	source.stats["eth0"] = capturetypes.CaptureStats{StartedAt: startedAt, ReceivedTotal: 3000, DroppedTotal: 600}
+	e.Evaluate(context.Background(), t0.Add(30*time.Second))
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "eth0", alerts[0].Iface)
+	require.Equal(t, StatePending, alerts[0].State)
+	require.Equal(t, 20., alerts[0].Value)
+
+	// the alert fires once the condition held for the configured duration
+	source.stats["eth0"] = capturetypes.CaptureStats{StartedAt: startedAt, ReceivedTotal: 6000, DroppedTotal: 1200}
+	e.Evaluate(context.Background(), t0.Add(60*time.Second))
+	source.stats["eth0"] = capturetypes.CaptureStats{StartedAt: startedAt, ReceivedTotal: 9000, DroppedTotal: 1800}
+	e.Evaluate(context.Background(), t0.Add(90*time.Second))
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StateFiring, alerts[0].State)
+	require.NotNil(t, alerts[0].FiredAt)
+
+	// a restarted capture does not yield a rate and hence leaves the alert unchanged
+	source.stats["eth0"] = capturetypes.CaptureStats{StartedAt: startedAt.Add(time.Hour), ReceivedTotal: 10}
+	e.Evaluate(context.Background(), t0.Add(120*time.Second))
+	require.Equal(t, StateFiring, e.Alerts()[0].State)
+
+	// the alert resolves once the condition no longer holds
+	source.stats["eth0"] = capturetypes.CaptureStats{StartedAt: startedAt.Add(time.Hour), ReceivedTotal: 3010}
+	e.Evaluate(context.Background(), t0.Add(150*time.Second))
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StateResolved, alerts[0].State)
+	require.NotNil(t, alerts[0].ResolvedAt)
+	require.Zero(t, alerts[0].Value)
+}
+
+func TestIfaceDown(t *testing.T) {
+	var (
+		source = &mockSource{stats: capturetypes.InterfaceStats{
+			"eth0": {},
+		}}
+		configSource = &mockConfigSource{
+			cfg: &config.AlertingConfig{Rules: config.AlertRules{
+				{Name: "down", Metric: config.AlertMetricIfaceDown, Op: "==", Threshold: 1},
+			}},
+			ifaces: []string{"eth0", "eth1"},
+		}
+		e = New(source, configSource)
+	)
+
+	e.Evaluate(context.Background(), time.Now())
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "eth1", alerts[0].Iface)
+	require.Equal(t, StateFiring, alerts[0].State)
+
+	// removing the rule drops its alerts
+	configSource.cfg.Rules = nil
+	e.Evaluate(context.Background(), time.Now())
+	require.Empty(t, e.Alerts())
+}
+
+func TestSilence(t *testing.T) {
+	var (
+		t0     = time.Now()
+		source = &mockSource{stats: capturetypes.InterfaceStats{
+			"eth0": {LastPacketAt: t0},
+			"eth1": {},
+		}}
+		configSource = &mockConfigSource{
+			cfg: &config.AlertingConfig{Rules: config.AlertRules{
+				{Name: "silent", Metric: config.AlertMetricSilenceSeconds, Op: ">", Threshold: 600},
+			}},
+			ifaces: []string{"eth0", "eth1"},
+		}
+		e = New(source, configSource)
+	)
+
+	e.Evaluate(context.Background(), t0.Add(5*time.Minute))
+	require.Empty(t, e.Alerts())
+
+	// eth1 never carried traffic, hence only eth0 is considered silent
+	e.Evaluate(context.Background(), t0.Add(15*time.Minute))
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "eth0", alerts[0].Iface)
+	require.Equal(t, StateFiring, alerts[0].State)
+	require.Equal(t, 900., alerts[0].Value)
+
+	// the alert resolves once traffic is seen again
+	source.stats["eth0"] = capturetypes.CaptureStats{LastPacketAt: t0.Add(16 * time.Minute)}
+	e.Evaluate(context.Background(), t0.Add(16*time.Minute))
+	alerts = e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StateResolved, alerts[0].State)
+}
+
+func TestWebhook(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		notifications []Notification
+		received      = make(chan struct{}, 2)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&n))
+
+		mu.Lock()
+		notifications = append(notifications, n)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+		received <- struct{}{}
+	}))
+	defer srv.Close()
+
+	var (
+		source       = &mockSource{congested: true}
+		configSource = &mockConfigSource{
+			cfg: &config.AlertingConfig{
+				Rules: config.AlertRules{
+					{Name: "congested", Metric: config.AlertMetricWriteoutCongested, Op: ">", Threshold: 0},
+				},
+				Webhooks: []string{srv.URL},
+			},
+		}
+		e = New(source, configSource)
+	)
+
+	// firing
+	e.Evaluate(context.Background(), time.Now())
+	<-received
+
+	// resolved
+	source.congested = false
+	e.Evaluate(context.Background(), time.Now())
+	<-received
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, notifications, 2)
+	for i, state := range []State{StateFiring, StateResolved} {
+		require.Len(t, notifications[i].Alerts, 1)
+		require.Equal(t, "congested", notifications[i].Alerts[0].Rule)
+		require.Empty(t, notifications[i].Alerts[0].Iface)
+		require.Equal(t, state, notifications[i].Alerts[0].State)
+	}
+}
+
+// reloadingConfigSource allows the alerting config to be changed while the evaluator is running
+type reloadingConfigSource struct {
+	mockConfigSource
+	sync.Mutex
+}
+
+func (r *reloadingConfigSource) GetAlertingConfig() *config.AlertingConfig {
+	r.Lock()
+	defer r.Unlock()
+	return r.cfg
+}
+
+func (r *reloadingConfigSource) setInterval(interval time.Duration) {
+	r.Lock()
+	r.cfg = &config.AlertingConfig{Interval: interval}
+	r.Unlock()
+}
+
+// countingSource counts the number of evaluations
+type countingSource struct {
+	mockSource
+	evaluations atomic.Int64
+}
+
+func (c *countingSource) Status(ctx context.Context, ifaces ...string) capturetypes.InterfaceStats {
+	c.evaluations.Add(1)
+	return c.mockSource.Status(ctx, ifaces...)
+}
+
+func TestIntervalReload(t *testing.T) {
+	var (
+		source       = &countingSource{}
+		configSource = &reloadingConfigSource{mockConfigSource: mockConfigSource{ifaces: []string{"eth0"}}}
+		e            = New(source, configSource)
+	)
+	require.Equal(t, config.DefaultAlertingInterval, e.interval())
+
+	configSource.setInterval(5 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return source.evaluations.Load() > 3
+	}, time.Second, time.Millisecond)
+
+	// once the interval has been changed (e.g. by a config reload), the evaluations follow it
+	configSource.setInterval(time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	evaluations := source.evaluations.Load()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, evaluations, source.evaluations.Load())
+}
@@ -0,0 +1,30 @@
+package alerting
+
+import (
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const alertingSubsystem = "alerting"
+
+var promAlertFiring = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: config.ServiceName,
+	Subsystem: alertingSubsystem,
+	Name:      "alert_firing",
+	Help:      "Indicates whether an alert is firing (1) or resolved (0)",
+},
+	[]string{"rule", "iface"},
+)
+var promNotificationsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: alertingSubsystem,
+	Name:      "notifications_failed_total",
+	Help:      "Number of alert notifications which could not be delivered to a webhook",
+})
+
+func init() {
+	prometheus.MustRegister(
+		promAlertFiring,
+		promNotificationsFailed,
+	)
+}
@@ -0,0 +1,58 @@
+package alerting
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/els0r/telemetry/logging"
+	"github.com/fako1024/httpc"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Notification is the payload posted to the webhooks whenever alerts start to fire or resolve
+type Notification struct {
+	// Hostname: the name of the host running goProbe
+	Hostname string `json:"hostname" doc:"Name of the host running goProbe" example:"probe-01"`
+	// Alerts: the alerts which started to fire or resolved
+	Alerts []Alert `json:"alerts" doc:"Alerts which started to fire or resolved"`
+}
+
+// notifier posts notifications to the webhooks
+type notifier struct {
+	client   *http.Client
+	hostname string
+}
+
+func newNotifier() *notifier {
+	hostname, _ := os.Hostname()
+	return &notifier{
+		client:   &http.Client{Timeout: webhookTimeout},
+		hostname: hostname,
+	}
+}
+
+// notify posts the alerts to all webhooks in the background (so that slow or unreachable webhooks
+// do not delay subsequent evaluations)
+func (n *notifier) notify(ctx context.Context, webhooks []string, alerts []Alert) {
+	logger := logging.FromContext(ctx)
+	for _, alert := range alerts {
+		logger.With("rule", alert.Rule, "iface", alert.Iface, "value", alert.Value).Warnf("alert %s", alert.State)
+	}
+
+	notification := Notification{Hostname: n.hostname, Alerts: alerts}
+	for _, webhook := range webhooks {
+		go func(webhook string) {
+			err := httpc.NewWithClient(http.MethodPost, webhook, n.client).
+				AcceptedResponseCodes([]int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent}).
+				EncodeJSON(notification).
+				RunWithContext(context.WithoutCancel(ctx))
+			if err != nil {
+				promNotificationsFailed.Inc()
+				logger.With("webhook", webhook).Errorf("failed to send alert notification: %v", err)
+			}
+		}(webhook)
+	}
+}
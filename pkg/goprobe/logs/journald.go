@@ -0,0 +1,126 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalSocket denotes the socket of the journal's native protocol
+var journalSocket = "/run/systemd/journal/socket"
+
+// journaldHandler writes records to the systemd journal using its native protocol, storing all
+// attributes as individual (upper-case) journal fields, so they can be filtered on directly
+// (e.g. journalctl MODULE=capture)
+type journaldHandler struct {
+	conn *net.UnixConn
+
+	prefix string // prefix of the current group (if any)
+	fields []byte // pre-encoded fields (from the ident and WithAttrs)
+}
+
+func newJournaldHandler(ident string) (*journaldHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	h := &journaldHandler{conn: conn}
+	h.fields = appendField(h.fields, "SYSLOG_IDENTIFIER", ident)
+	return h, nil
+}
+
+func (h *journaldHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (h *journaldHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 512))
+	buf.Write(h.fields)
+
+	fields := appendField(nil, "MESSAGE", r.Message)
+	fields = appendField(fields, "PRIORITY", strconv.Itoa(severity(r.Level)))
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, attr)
+		return true
+	})
+	buf.Write(fields)
+
+	_, err := h.conn.Write(buf.Bytes())
+	return err
+}
+
+func (h *journaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.fields = bytes.Clone(h.fields)
+	for _, attr := range attrs {
+		c.fields = appendAttr(c.fields, h.prefix, attr)
+	}
+	return &c
+}
+
+func (h *journaldHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "_"
+	return &c
+}
+
+func appendAttr(b []byte, prefix string, attr slog.Attr) []byte {
+	attr.Value = attr.Value.Resolve()
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		if attr.Key != "" {
+			prefix += attr.Key + "_"
+		}
+		for _, a := range attr.Value.Group() {
+			b = appendAttr(b, prefix, a)
+		}
+		return b
+	case slog.KindTime:
+		return appendField(b, prefix+attr.Key, attr.Value.Time().Format(time.RFC3339Nano))
+	}
+	if attr.Equal(slog.Attr{}) {
+		return b
+	}
+	return appendField(b, prefix+attr.Key, attr.Value.String())
+}
+
+// appendField appends a field in the journal's native format: KEY=value for single-line values, the
+// key followed by the little-endian length and the raw value for values spanning multiple lines
+func appendField(b []byte, key, value string) []byte {
+	key = fieldName(key)
+	if key == "" {
+		return b
+	}
+
+	b = append(b, key...)
+	if !strings.ContainsRune(value, '\n') {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// fieldName converts an attribute key into a valid journal field name (upper-case letters, digits
+// and underscores, not starting with an underscore or digit, which are reserved / invalid)
+func fieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	return strings.TrimLeft(string(name), "_0123456789")
+}
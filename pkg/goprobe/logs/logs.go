@@ -0,0 +1,214 @@
+// Package logs extends goProbe's logging setup by per-module log levels (adjustable at runtime)
+// and native sinks for journald and (local or remote) syslog, preserving the structured fields
+// of each log record
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/els0r/telemetry/logging"
+)
+
+// ModuleKey denotes the attribute identifying the module a logger belongs to
+const ModuleKey = "module"
+
+// Module denotes a part of goProbe whose log level can be set individually
+type Module string
+
+const (
+	ModuleCapture  Module = "capture"  // ModuleCapture : packet capture and interface management
+	ModuleWriteout Module = "writeout" // ModuleWriteout : writeout of flow data to the database
+	ModuleAPI      Module = "api"      // ModuleAPI : API server and request handling
+	ModuleQuery    Module = "query"    // ModuleQuery : query execution
+)
+
+// Modules lists all modules with individual log levels
+var Modules = []Module{ModuleCapture, ModuleWriteout, ModuleAPI, ModuleQuery}
+
+// ParseModule parses a module name
+func ParseModule(s string) (Module, error) {
+	m := Module(strings.ToLower(s))
+	if !slices.Contains(Modules, m) {
+		return "", fmt.Errorf("unknown log module %q", s)
+	}
+	return m, nil
+}
+
+// ParseLevel parses a log level name (debug, info, warn, error, fatal, panic)
+func ParseLevel(s string) (slog.Level, error) {
+	level := logging.LevelFromString(s)
+	if level == logging.LevelUnknown {
+		return level, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// LevelString returns the name of a log level (as accepted by ParseLevel)
+func LevelString(level slog.Level) string {
+	switch {
+	case level < logging.LevelInfo:
+		return "debug"
+	case level < logging.LevelWarn:
+		return "info"
+	case level < logging.LevelError:
+		return "warn"
+	case level < logging.LevelFatal:
+		return "error"
+	case level < logging.LevelPanic:
+		return "fatal"
+	}
+	return "panic"
+}
+
+// unset denotes a module without an individual log level (using the default level)
+const unset = int64(logging.LevelUnknown)
+
+// Levels stores the default log level and the individual levels of all modules. All methods
+// are safe for concurrent use, allowing to adjust the levels at runtime
+type Levels struct {
+	def     slog.LevelVar
+	modules map[Module]*atomic.Int64
+}
+
+// NewLevels creates a new set of log levels, with all modules using the default level
+func NewLevels(def slog.Level) *Levels {
+	l := &Levels{
+		modules: make(map[Module]*atomic.Int64, len(Modules)),
+	}
+	l.def.Set(def)
+	for _, m := range Modules {
+		l.modules[m] = new(atomic.Int64)
+		l.modules[m].Store(unset)
+	}
+	return l
+}
+
+// Default returns the default log level
+func (l *Levels) Default() slog.Level {
+	return l.def.Level()
+}
+
+// SetDefault sets the default log level (applying to all modules without an individual level)
+func (l *Levels) SetDefault(level slog.Level) {
+	l.def.Set(level)
+}
+
+// Level returns the effective log level of a module. Unknown modules use the default level
+func (l *Levels) Level(m Module) slog.Level {
+	if level, exists := l.modules[m]; exists {
+		if v := level.Load(); v != unset {
+			return slog.Level(v)
+		}
+	}
+	return l.def.Level()
+}
+
+// Set sets the individual log level of a module
+func (l *Levels) Set(m Module, level slog.Level) error {
+	ml, exists := l.modules[m]
+	if !exists {
+		return fmt.Errorf("unknown log module %q", m)
+	}
+	ml.Store(int64(level))
+	return nil
+}
+
+// Reset removes the individual log level of a module (which uses the default level thereafter)
+func (l *Levels) Reset(m Module) error {
+	ml, exists := l.modules[m]
+	if !exists {
+		return fmt.Errorf("unknown log module %q", m)
+	}
+	ml.Store(unset)
+	return nil
+}
+
+// Overrides returns the individual log levels of all modules having one
+func (l *Levels) Overrides() map[Module]slog.Level {
+	overrides := make(map[Module]slog.Level)
+	for m, level := range l.modules {
+		if v := level.Load(); v != unset {
+			overrides[m] = slog.Level(v)
+		}
+	}
+	return overrides
+}
+
+// NewHandler wraps a handler such that records are filtered according to the log level of the
+// module they originate from. The wrapped handler is expected to accept all levels (filtering
+// is entirely done based on the levels)
+func NewHandler(levels *Levels, next slog.Handler) slog.Handler {
+	return &moduleHandler{levels: levels, next: next}
+}
+
+type moduleHandler struct {
+	levels  *Levels
+	module  Module
+	grouped bool
+	next    slog.Handler
+}
+
+func (h *moduleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.levels.Level(h.module) && h.next.Enabled(ctx, level)
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	if !h.grouped {
+		for _, attr := range attrs {
+			if attr.Key == ModuleKey {
+				c.module = Module(attr.Value.String())
+			}
+		}
+	}
+	c.next = h.next.WithAttrs(attrs)
+	return &c
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.grouped = true
+	c.next = h.next.WithGroup(name)
+	return &c
+}
+
+// global denotes the log levels of the default logger
+var global = NewLevels(logging.LevelInfo)
+
+// Init sets the log levels of the default logger and makes it respect them (including any
+// subsequent runtime changes). It is expected to be called once, after the default logger was
+// initialized (at the lowest log level)
+func Init(def slog.Level, modules map[Module]slog.Level) error {
+	global.SetDefault(def)
+	for m, level := range modules {
+		if err := global.Set(m, level); err != nil {
+			return err
+		}
+	}
+	slog.SetDefault(slog.New(NewHandler(global, slog.Default().Handler())))
+	return nil
+}
+
+// GlobalLevels returns the log levels of the default logger
+func GlobalLevels() *Levels {
+	return global
+}
+
+// Logger returns the default logger of a module
+func Logger(m Module) *logging.L {
+	return logging.Logger().With(ModuleKey, string(m))
+}
+
+// FromContext returns the logger of a module, including all fields set in the context
+func FromContext(ctx context.Context, m Module) *logging.L {
+	return logging.FromContext(ctx).With(ModuleKey, string(m))
+}
@@ -0,0 +1,178 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/els0r/telemetry/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleLevels(t *testing.T) {
+	levels := NewLevels(logging.LevelInfo)
+
+	buf := new(bytes.Buffer)
+	logger := slog.New(NewHandler(levels, slog.NewTextHandler(buf, &slog.HandlerOptions{Level: logging.LevelDebug})))
+	capture, query := logger.With(ModuleKey, string(ModuleCapture)), logger.With(ModuleKey, string(ModuleQuery))
+
+	capture.Debug("capture debug")
+	query.Debug("query debug")
+	logger.Debug("default debug")
+	require.Empty(t, buf.String())
+
+	// adjust the level of a single module at runtime
+	require.Nil(t, levels.Set(ModuleCapture, logging.LevelDebug))
+	capture.Debug("capture debug")
+	query.Debug("query debug")
+	require.Contains(t, buf.String(), "capture debug")
+	require.NotContains(t, buf.String(), "query debug")
+	require.Equal(t, map[Module]slog.Level{ModuleCapture: logging.LevelDebug}, levels.Overrides())
+
+	// module levels take precedence over the default level
+	buf.Reset()
+	levels.SetDefault(logging.LevelError)
+	capture.Info("capture info")
+	query.Warn("query warn")
+	logger.Error("default error")
+	require.Contains(t, buf.String(), "capture info")
+	require.NotContains(t, buf.String(), "query warn")
+	require.Contains(t, buf.String(), "default error")
+
+	// attributes within groups do not denote the module
+	buf.Reset()
+	logger.WithGroup("req").With(ModuleKey, string(ModuleCapture)).Info("grouped info")
+	require.Empty(t, buf.String())
+
+	require.Nil(t, levels.Reset(ModuleCapture))
+	require.Equal(t, logging.LevelError, levels.Level(ModuleCapture))
+	require.Empty(t, levels.Overrides())
+
+	require.NotNil(t, levels.Set("unknown", logging.LevelDebug))
+	require.Equal(t, logging.LevelError, levels.Level("unknown"))
+}
+
+func TestParse(t *testing.T) {
+	m, err := ParseModule("Capture")
+	require.Nil(t, err)
+	require.Equal(t, ModuleCapture, m)
+	_, err = ParseModule("unknown")
+	require.NotNil(t, err)
+
+	for _, name := range []string{"debug", "info", "warn", "error", "fatal", "panic"} {
+		level, err := ParseLevel(name)
+		require.Nil(t, err)
+		require.Equal(t, name, LevelString(level))
+	}
+	_, err = ParseLevel("verbose")
+	require.NotNil(t, err)
+}
+
+func TestParseSink(t *testing.T) {
+	var tests = []struct {
+		dest     string
+		expected Sink
+		ok       bool
+		err      bool
+	}{
+		{"", Sink{}, false, false},
+		{"/var/log/goprobe.log", Sink{}, false, false},
+		{"journald", Sink{Type: SinkJournald}, true, false},
+		{"syslog", Sink{Type: SinkSyslog}, true, false},
+		{"syslog+udp://logs.example.com:514", Sink{Type: SinkSyslog, Network: "udp", Address: "logs.example.com:514"}, true, false},
+		{"syslog+tcp://[2001:db8::1]:6514", Sink{Type: SinkSyslog, Network: "tcp", Address: "[2001:db8::1]:6514"}, true, false},
+		{"syslog+udp://logs.example.com", Sink{}, true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dest, func(t *testing.T) {
+			sink, ok, err := ParseSink(test.dest)
+			if test.err {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.expected, sink)
+		})
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	sink, ok, err := ParseSink("syslog+udp://" + conn.LocalAddr().String())
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	handler, err := sink.NewHandler("goProbe", logging.EncodingLogfmt)
+	require.Nil(t, err)
+
+	logger := slog.New(handler).With(ModuleKey, string(ModuleCapture))
+	logger.Warn("interface down", "iface", "eth0")
+
+	buf := make([]byte, 1024)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+
+	// daemon facility (3) and warning severity (4)
+	msg := string(buf[:n])
+	require.True(t, strings.HasPrefix(msg, "<28>"), msg)
+	require.Contains(t, msg, "goProbe[")
+	require.Contains(t, msg, `msg="interface down" module=capture iface=eth0`)
+	require.NotContains(t, msg, "level=")
+}
+
+func TestJournaldSink(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.Nil(t, err)
+	defer conn.Close()
+
+	journalSocket = socket
+	handler, err := Sink{Type: SinkJournald}.NewHandler("goProbe", logging.EncodingLogfmt)
+	require.Nil(t, err)
+
+	logger := slog.New(handler).With(ModuleKey, string(ModuleQuery), "query-id", 42)
+	logger.WithGroup("stats").Error("query failed", "err", "no data\nfound", "_hidden", 1)
+
+	buf := make([]byte, 4096)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+
+	multiline := []byte("STATS_ERR\n")
+	multiline = binary.LittleEndian.AppendUint64(multiline, uint64(len("no data\nfound")))
+	multiline = append(multiline, "no data\nfound\n"...)
+
+	require.Equal(t, "SYSLOG_IDENTIFIER=goProbe\n"+
+		"MODULE=query\n"+
+		"QUERY_ID=42\n"+
+		"MESSAGE=query failed\n"+
+		"PRIORITY=3\n"+
+		string(multiline)+
+		"STATS__HIDDEN=1\n", string(buf[:n]))
+}
+
+func TestLoggerModule(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+
+	// the module is attached to all loggers of a module, including those carrying context fields
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(prev)
+
+	ctx := logging.WithFields(context.Background(), slog.String("iface", "eth0"))
+	FromContext(ctx, ModuleWriteout).Info("writeout completed")
+	require.Contains(t, buf.String(), "iface=eth0 module=writeout")
+}
@@ -0,0 +1,128 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/els0r/telemetry/logging"
+)
+
+// SinkType denotes the type of a native log sink
+type SinkType string
+
+const (
+	SinkJournald SinkType = "journald" // SinkJournald : the systemd journal (using its native protocol)
+	SinkSyslog   SinkType = "syslog"   // SinkSyslog : a local or remote syslog daemon
+)
+
+const (
+	syslogUDPScheme = "syslog+udp://"
+	syslogTCPScheme = "syslog+tcp://"
+)
+
+// Sink denotes a native log sink
+type Sink struct {
+	Type SinkType
+
+	// Network and Address denote the remote syslog daemon (the local one is used if empty)
+	Network string
+	Address string
+}
+
+// ParseSink parses a log destination into a native log sink. Destinations not denoting a native
+// sink (i.e. log files or the console) are reported via ok == false. Supported sinks are
+//
+//	journald                   : the systemd journal
+//	syslog                     : the local syslog daemon
+//	syslog+udp://<host>:<port> : a remote syslog daemon (via UDP)
+//	syslog+tcp://<host>:<port> : a remote syslog daemon (via TCP)
+func ParseSink(dest string) (sink Sink, ok bool, err error) {
+	switch {
+	case dest == string(SinkJournald):
+		return Sink{Type: SinkJournald}, true, nil
+	case dest == string(SinkSyslog):
+		return Sink{Type: SinkSyslog}, true, nil
+	case strings.HasPrefix(dest, syslogUDPScheme):
+		sink = Sink{Type: SinkSyslog, Network: "udp", Address: strings.TrimPrefix(dest, syslogUDPScheme)}
+	case strings.HasPrefix(dest, syslogTCPScheme):
+		sink = Sink{Type: SinkSyslog, Network: "tcp", Address: strings.TrimPrefix(dest, syslogTCPScheme)}
+	default:
+		return Sink{}, false, nil
+	}
+
+	if _, _, err := net.SplitHostPort(sink.Address); err != nil {
+		return Sink{}, true, fmt.Errorf("invalid syslog address %q: %w", sink.Address, err)
+	}
+	return sink, true, nil
+}
+
+// NewHandler creates a handler writing to the sink. The identifier denotes the application
+// (e.g. the syslog tag), the encoding applies to the message body of syslog records (the journal
+// stores all attributes as individual fields). The handler accepts all log levels
+func (s Sink) NewHandler(ident string, encoding logging.Encoding) (slog.Handler, error) {
+	switch s.Type {
+	case SinkJournald:
+		return newJournaldHandler(ident)
+	case SinkSyslog:
+		return newSyslogHandler(s.Network, s.Address, ident, encoding)
+	}
+	return nil, fmt.Errorf("unknown log sink %q", s.Type)
+}
+
+// Severity levels as defined in RFC 5424
+const (
+	severityAlert   = 1
+	severityCrit    = 2
+	severityErr     = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+func severity(level slog.Level) int {
+	switch {
+	case level < logging.LevelInfo:
+		return severityDebug
+	case level < logging.LevelWarn:
+		return severityInfo
+	case level < logging.LevelError:
+		return severityWarning
+	case level < logging.LevelFatal:
+		return severityErr
+	case level < logging.LevelPanic:
+		return severityCrit
+	}
+	return severityAlert
+}
+
+// recordEncoder encodes the attributes of records into a (shared) buffer, dropping the time and
+// level (which are reported by the sink itself)
+type recordEncoder struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func newEncodingHandler(enc *recordEncoder, encoding logging.Encoding) (slog.Handler, error) {
+	hopts := &slog.HandlerOptions{
+		Level: logging.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	switch encoding {
+	case logging.EncodingJSON:
+		return slog.NewJSONHandler(enc, hopts), nil
+	case logging.EncodingLogfmt:
+		return slog.NewTextHandler(enc, hopts), nil
+	case logging.EncodingPlain:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
@@ -0,0 +1,79 @@
+package logs
+
+import (
+	"context"
+	"log/slog"
+	"log/syslog"
+	"strings"
+
+	"github.com/els0r/telemetry/logging"
+)
+
+// syslogHandler writes records to a syslog daemon, mapping their level to the syslog severity. The
+// message body carries the record's message and attributes in the configured encoding
+type syslogHandler struct {
+	w *syslog.Writer
+
+	enc  *recordEncoder
+	next slog.Handler // encodes into enc (nil for plain encoding)
+}
+
+func newSyslogHandler(network, addr, tag string, encoding logging.Encoding) (*syslogHandler, error) {
+	enc := new(recordEncoder)
+	next, err := newEncodingHandler(enc, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHandler{w: w, enc: enc, next: next}, nil
+}
+
+func (h *syslogHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	msg := r.Message
+	if h.next != nil {
+		h.enc.Lock()
+		h.enc.Reset()
+		if err := h.next.Handle(ctx, r); err != nil {
+			h.enc.Unlock()
+			return err
+		}
+		msg = strings.TrimSuffix(h.enc.String(), "\n")
+		h.enc.Unlock()
+	}
+
+	switch severity(r.Level) {
+	case severityDebug:
+		return h.w.Debug(msg)
+	case severityInfo:
+		return h.w.Info(msg)
+	case severityWarning:
+		return h.w.Warning(msg)
+	case severityErr:
+		return h.w.Err(msg)
+	case severityCrit:
+		return h.w.Crit(msg)
+	}
+	return h.w.Alert(msg)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.next == nil {
+		return h
+	}
+	return &syslogHandler{w: h.w, enc: h.enc, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	if h.next == nil {
+		return h
+	}
+	return &syslogHandler{w: h.w, enc: h.enc, next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,790 @@
+// Package replication implements the replication of the live flow maps of an active goProbe to a
+// standby probe, which takes over capturing and writing out flows if the active probe fails.
+//
+// Both probes listen for connections of their peer. All connections are mutually authenticated via
+// TLS: each probe presents a certificate issued by the configured CA, which must be valid for the host
+// of its address as configured as peer of the other probe (connections of any other party are rejected).
+// The active probe connects to the standby and streams the changes of its flow maps in regular intervals:
+//
+//  1. Both ends exchange a hello message carrying their node ID, role and epoch
+//  2. The active probe sends a delta comprising the counter increments of all flows changed since
+//     the previous one, along with those of their shares observed with labels (encapsulation, VLAN,
+//     MAC addresses or DSCP) and their TCP flags (or all flows captured since the last writeout if a
+//     writeout occurred in the meantime, in which case the standby resets its replica)
+//  3. The standby merges the delta into its replica of the flows captured since the last writeout
+//     and acknowledges it
+//
+// If the standby doesn't receive anything from the active probe for the failover timeout, it takes
+// over: it increments the epoch, starts its captures and replays its replica during its first
+// writeout.
+//
+// The epoch serves as fencing token. Whenever both probes consider themselves active (e.g. once a
+// failed probe returns or after a network partition), the one with the lower epoch (or, if equal,
+// the larger node ID) steps down and discards the flows it captured since its last writeout. In
+// addition, an active probe only writes out without further ado while it holds a lease, i.e. within
+// the failover timeout of the last delta acknowledged by the standby. Otherwise it contacts its peer
+// before writing out and steps down if the peer has taken over in the meantime. If the peer cannot
+// be reached at all, the probe writes out anyway (favoring availability), hence flows may be written
+// out by both probes during a network partition between them.
+//
+// Note that the capture stats are not replicated.
+package replication
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+)
+
+// Role denotes the role of a probe
+type Role string
+
+const (
+	RoleActive  Role = "active"  // RoleActive : the probe captures and writes out flows
+	RoleStandby Role = "standby" // RoleStandby : the probe receives the flows of the active probe
+)
+
+const (
+	// DefaultInterval denotes the default interval in which deltas are sent to the standby
+	DefaultInterval = 5 * time.Second
+
+	// DefaultFailoverTimeout denotes the default duration without contact to the active probe after
+	// which the standby takes over
+	DefaultFailoverTimeout = 30 * time.Second
+
+	// EpochFileName denotes the name of the file persisting the epoch (in the DB directory)
+	EpochFileName = "replication_epoch"
+)
+
+var (
+	errorInvalidRole            = errors.New("invalid replication role")
+	errorInvalidFailoverTimeout = errors.New("the failover timeout must exceed the replication interval")
+	errorNotActive              = errors.New("probe is not active")
+	errorFenced                 = errors.New("peer has taken over")
+	errorUnexpectedMessage      = errors.New("unexpected message")
+	errorNoCredentials          = errors.New("replication requires a certificate and the CA issuing the certificates of both probes")
+	errorUnexpectedPeer         = errors.New("certificate of the connecting probe is not valid for the configured peer")
+	errorUnauthenticated        = errors.New("TLS handshake failed")
+)
+
+// Captures denotes the captures controlled by the replication (usually the capture manager)
+type Captures interface {
+	GetTaggedFlowMaps(ctx context.Context, ifaces ...string) []capturetypes.TaggedAggFlowMap
+	LastRotation() time.Time
+	ReplayFlows(flows ...capturetypes.TaggedAggFlowMap)
+	Activate(ctx context.Context) error
+	Standby(ctx context.Context)
+}
+
+type messageType uint8
+
+const (
+	msgHello messageType = iota + 1
+	msgDelta
+	msgAck
+)
+
+// message is exchanged between the probes. Each message carries the state of its sender
+type message struct {
+	Type   messageType
+	NodeID string
+	Role   Role
+	Epoch  uint64
+
+	// Reset and Flows denote the content of a delta
+	Reset bool
+	Flows []flowMap
+}
+
+// flowMap is the wire representation of the changes of the flow map of an interface. Its attributes
+// carry the counter increments of the changed shares of flows observed with labels and the current TCP
+// flags of the changed flows
+type flowMap struct {
+	Iface      string
+	Primary    hashmap.KeyVals
+	Secondary  hashmap.KeyVals
+	Attributes capturetypes.FlowAttributes
+}
+
+// Node denotes a probe taking part in the replication
+type Node struct {
+	id        string
+	listener  net.Listener
+	peer      string
+	captures  Captures
+	clientTLS *tls.Config
+
+	interval        time.Duration
+	failoverTimeout time.Duration
+	epochFile       string
+
+	mu    sync.Mutex
+	role  Role
+	epoch uint64
+
+	// lastContact denotes the time of the last contact to the active probe (in standby) or the time
+	// the last delta acknowledged by the standby was sent (if active), respectively
+	lastContact time.Time
+
+	// replica stores the flows captured by the active probe since its last writeout (in standby)
+	replica map[string]*capturetypes.TaggedAggFlowMap
+}
+
+// Option denotes a functional option for a Node
+type Option func(n *Node)
+
+// WithNodeID sets the ID of the node, which breaks ties between active probes of the same epoch (defaults
+// to the hostname and listen address)
+func WithNodeID(id string) Option {
+	return func(n *Node) {
+		if id != "" {
+			n.id = id
+		}
+	}
+}
+
+// WithInterval sets the interval in which deltas are sent to the standby
+func WithInterval(interval time.Duration) Option {
+	return func(n *Node) {
+		if interval > 0 {
+			n.interval = interval
+		}
+	}
+}
+
+// WithFailoverTimeout sets the duration without contact to the active probe after which the standby
+// takes over
+func WithFailoverTimeout(timeout time.Duration) Option {
+	return func(n *Node) {
+		if timeout > 0 {
+			n.failoverTimeout = timeout
+		}
+	}
+}
+
+// WithEpochFile persists the epoch in the provided file, so that it survives restarts
+func WithEpochFile(path string) Option {
+	return func(n *Node) {
+		n.epochFile = path
+	}
+}
+
+// LoadTLSConfig loads the certificate / key of a node and the CA certificate(s) issuing the certificates
+// of both nodes (all of them PEM encoded) to be used by New
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replication certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(filepath.Clean(caFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replication CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no valid certificate found in replication CA file %s", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// New creates a node starting in the provided role, which accepts connections of its peer on the
+// listener and connects to the peer at the provided address. The TLS config must provide the certificate
+// of the node and the CA issuing the certificates of both nodes (c.f. LoadTLSConfig). Captures of a
+// standby node must be in standby as well (c.f. capture.WithStandby)
+func New(role Role, listener net.Listener, peer string, tlsConfig *tls.Config, captures Captures, opts ...Option) (*Node, error) {
+	if role != RoleActive && role != RoleStandby {
+		return nil, fmt.Errorf("%w: %q", errorInvalidRole, role)
+	}
+	if tlsConfig == nil || len(tlsConfig.Certificates) == 0 || tlsConfig.RootCAs == nil {
+		return nil, errorNoCredentials
+	}
+	peerHost, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address: %w", err)
+	}
+
+	// The peer must present a certificate valid for its configured host, regardless of which side
+	// initiates the connection
+	clientTLS := tlsConfig.Clone()
+	clientTLS.ServerName = peerHost
+	serverTLS := tlsConfig.Clone()
+	serverTLS.ClientAuth, serverTLS.ClientCAs = tls.RequireAndVerifyClientCert, tlsConfig.RootCAs
+	serverTLS.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 || state.PeerCertificates[0].VerifyHostname(peerHost) != nil {
+			return fmt.Errorf("%w (%s)", errorUnexpectedPeer, peerHost)
+		}
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	n := &Node{
+		id:              hostname + "/" + listener.Addr().String(),
+		listener:        tls.NewListener(listener, serverTLS),
+		peer:            peer,
+		captures:        captures,
+		clientTLS:       clientTLS,
+		interval:        DefaultInterval,
+		failoverTimeout: DefaultFailoverTimeout,
+		role:            role,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	if n.failoverTimeout <= n.interval {
+		return nil, errorInvalidFailoverTimeout
+	}
+
+	// A standby waits for the failover timeout before taking over, whereas an active node doesn't
+	// hold a lease before it has contacted its peer
+	if role == RoleStandby {
+		n.lastContact = time.Now()
+	}
+
+	if n.epochFile != "" {
+		epoch, err := readEpoch(n.epochFile)
+		if err != nil {
+			return nil, err
+		}
+		n.epoch = epoch
+	}
+
+	return n, nil
+}
+
+// Role returns the current role of the node
+func (n *Node) Role() (role Role) {
+	n.mu.Lock()
+	role = n.role
+	n.mu.Unlock()
+
+	return
+}
+
+// Epoch returns the current epoch of the node
+func (n *Node) Epoch() (epoch uint64) {
+	n.mu.Lock()
+	epoch = n.epoch
+	n.mu.Unlock()
+
+	return
+}
+
+// Run runs the replication until the context is cancelled: an active node streams its flows to the
+// peer, whereas a standby node receives them and takes over once the active probe fails
+func (n *Node) Run(ctx context.Context) {
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
+
+	go n.serve(ctx)
+	go func() {
+		<-ctx.Done()
+		_ = n.listener.Close()
+	}()
+
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	var failing bool
+	for {
+		switch {
+		case n.Role() == RoleActive:
+			err := n.replicate(ctx)
+			if err != nil && ctx.Err() == nil && !failing {
+				logger.With("peer", n.peer).Warnf("failed to replicate flows: %v", err)
+			}
+			failing = err != nil
+		case n.failoverDue():
+			n.takeOver(ctx)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckWriteout checks if the node may write out its flows and can be used as writeout guard of the
+// capture manager (c.f. capture.WithWriteoutGuard). Without a lease, the node contacts its peer in
+// order to fence off writeouts once the peer has taken over
+func (n *Node) CheckWriteout(ctx context.Context) error {
+	n.mu.Lock()
+	role, leaseExpiry := n.role, n.lastContact.Add(n.failoverTimeout)
+	n.mu.Unlock()
+
+	if role != RoleActive {
+		return errorNotActive
+	}
+	if time.Now().Before(leaseExpiry) {
+		return nil
+	}
+
+	if err := n.probe(ctx); err != nil {
+		logs.FromContext(ctx, logs.ModuleCapture).With("peer", n.peer).Warnf("writing out without lease, failed to contact peer: %v", err)
+		return nil
+	}
+	if n.Role() != RoleActive {
+		return errorFenced
+	}
+	return nil
+}
+
+// HealthCheck reports a warning if the node is active without holding a lease (i.e. if the flows are
+// not replicated to the standby). It can be used as an API health check
+func (n *Node) HealthCheck(_ context.Context) (warnings []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.role == RoleActive && time.Since(n.lastContact) >= n.failoverTimeout {
+		warnings = append(warnings, fmt.Sprintf("flows not replicated: no contact to standby peer %s", n.peer))
+	}
+	return
+}
+
+// replicate connects to the peer and streams deltas until the connection fails or the node steps down
+func (n *Node) replicate(ctx context.Context) error {
+	conn, err := n.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	enc, dec := gob.NewEncoder(conn), gob.NewDecoder(conn)
+	if err := n.handshake(ctx, conn, enc, dec); err != nil {
+		return err
+	}
+	logs.FromContext(ctx, logs.ModuleCapture).With("peer", n.peer, "epoch", n.Epoch()).Info("replicating flows to standby")
+
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	var t tracker
+	for n.Role() == RoleActive {
+
+		// If a writeout interfered with the snapshot of the flows, only a heartbeat is sent
+		msg := n.message(msgDelta)
+		if reset, flows, ok := t.delta(ctx, n.captures); ok {
+			msg.Reset, msg.Flows = reset, flows
+		}
+
+		sent := time.Now()
+		if err := conn.SetDeadline(sent.Add(n.failoverTimeout)); err != nil {
+			return err
+		}
+		if err := enc.Encode(msg); err != nil {
+			return fmt.Errorf("failed to send delta: %w", err)
+		}
+		var ack message
+		if err := dec.Decode(&ack); err != nil {
+			return fmt.Errorf("failed to receive acknowledgement: %w", err)
+		}
+		if ack.Type != msgAck {
+			return fmt.Errorf("%w (type %d)", errorUnexpectedMessage, ack.Type)
+		}
+		if n.resolve(ctx, ack) {
+			return nil
+		}
+		n.renewLease(sent)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// probe contacts the peer in order to verify that it hasn't taken over (stepping down otherwise)
+func (n *Node) probe(ctx context.Context) error {
+	conn, err := n.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sent := time.Now()
+	if err := n.handshake(ctx, conn, gob.NewEncoder(conn), gob.NewDecoder(conn)); err != nil {
+		return err
+	}
+	if n.Role() == RoleActive {
+		n.renewLease(sent)
+	}
+	return nil
+}
+
+func (n *Node) dial(ctx context.Context) (net.Conn, error) {
+	dialer := tls.Dialer{NetDialer: &net.Dialer{Timeout: n.interval}, Config: n.clientTLS}
+	return dialer.DialContext(ctx, "tcp", n.peer)
+}
+
+// handshake exchanges hello messages with the peer (initiated by the connecting side) and resolves
+// any conflicting roles
+func (n *Node) handshake(ctx context.Context, conn net.Conn, enc *gob.Encoder, dec *gob.Decoder) error {
+	if err := conn.SetDeadline(time.Now().Add(n.failoverTimeout)); err != nil {
+		return err
+	}
+	if err := enc.Encode(n.message(msgHello)); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+	var hello message
+	if err := dec.Decode(&hello); err != nil {
+		return fmt.Errorf("failed to receive hello: %w", err)
+	}
+	if hello.Type != msgHello {
+		return fmt.Errorf("%w (type %d)", errorUnexpectedMessage, hello.Type)
+	}
+	n.resolve(ctx, hello)
+
+	return nil
+}
+
+// serve accepts the connections of the peer
+func (n *Node) serve(ctx context.Context) {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				logs.FromContext(ctx, logs.ModuleCapture).Errorf("failed to accept replication connection: %v", err)
+			}
+			return
+		}
+		go func() {
+			logger := logs.FromContext(ctx, logs.ModuleCapture).With("peer", conn.RemoteAddr().String())
+			if err := n.handle(ctx, conn.(*tls.Conn)); err != nil && ctx.Err() == nil {
+				if errors.Is(err, errorUnauthenticated) {
+					logger.Warnf("rejected replication connection: %v", err)
+				} else {
+					logger.Debugf("replication connection closed: %v", err)
+				}
+			}
+			_ = conn.Close()
+		}()
+	}
+}
+
+// handle authenticates the peer, answers its hello and, while in standby, receives its deltas
+func (n *Node) handle(ctx context.Context, conn *tls.Conn) error {
+	enc, dec := gob.NewEncoder(conn), gob.NewDecoder(conn)
+
+	if err := conn.SetDeadline(time.Now().Add(n.failoverTimeout)); err != nil {
+		return err
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("%w: %w", errorUnauthenticated, err)
+	}
+	var hello message
+	if err := dec.Decode(&hello); err != nil {
+		return err
+	}
+	if hello.Type != msgHello {
+		return fmt.Errorf("%w (type %d)", errorUnexpectedMessage, hello.Type)
+	}
+	if err := enc.Encode(n.message(msgHello)); err != nil {
+		return err
+	}
+	n.resolve(ctx, hello)
+
+	for n.Role() == RoleStandby {
+		if err := conn.SetDeadline(time.Now().Add(n.failoverTimeout)); err != nil {
+			return err
+		}
+		var delta message
+		if err := dec.Decode(&delta); err != nil {
+			return err
+		}
+		if delta.Type != msgDelta {
+			return fmt.Errorf("%w (type %d)", errorUnexpectedMessage, delta.Type)
+		}
+
+		// The acknowledgement carries the state after applying the delta, so that the active probe
+		// steps down if this node has taken over in the meantime
+		n.apply(ctx, delta)
+		if err := enc.Encode(n.message(msgAck)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// message returns a message of the given type carrying the current state of the node
+func (n *Node) message(msgType messageType) message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return message{
+		Type:   msgType,
+		NodeID: n.id,
+		Role:   n.role,
+		Epoch:  n.epoch,
+	}
+}
+
+// resolve reconciles the state of the node with the one of its peer (as carried by a message): if
+// both are active, the node with the lower epoch (or, if equal, the larger node ID) steps down.
+// Both nodes adopt the larger epoch. It returns whether the node stepped down
+func (n *Node) resolve(ctx context.Context, peer message) (steppedDown bool) {
+	n.mu.Lock()
+	if peer.Role == RoleActive {
+		switch n.role {
+		case RoleActive:
+			steppedDown = peer.Epoch > n.epoch || (peer.Epoch == n.epoch && peer.NodeID < n.id)
+		case RoleStandby:
+			n.lastContact = time.Now()
+		}
+	}
+	if steppedDown {
+		n.role, n.replica, n.lastContact = RoleStandby, nil, time.Now()
+	}
+	if peer.Epoch > n.epoch {
+		n.setEpoch(ctx, peer.Epoch)
+	}
+	epoch := n.epoch
+	n.mu.Unlock()
+
+	if steppedDown {
+		logs.FromContext(ctx, logs.ModuleCapture).With("peer", n.peer, "epoch", epoch).Warn("peer is active, stepping down to standby")
+		n.captures.Standby(ctx)
+	}
+	return
+}
+
+// apply merges a delta received from the active probe into the replica
+func (n *Node) apply(ctx context.Context, delta message) {
+	n.resolve(ctx, delta)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.role != RoleStandby {
+		return
+	}
+	if delta.Reset || n.replica == nil {
+		n.replica = make(map[string]*capturetypes.TaggedAggFlowMap)
+	}
+	for _, flows := range delta.Flows {
+		r, exists := n.replica[flows.Iface]
+		if !exists {
+			r = &capturetypes.TaggedAggFlowMap{Map: hashmap.NewAggFlowMap(), Iface: flows.Iface}
+			n.replica[flows.Iface] = r
+		}
+		for _, kv := range flows.Primary {
+			r.Map.PrimaryMap.SetOrUpdate(kv.Key, kv.Val.BytesRcvd, kv.Val.BytesSent, kv.Val.PacketsRcvd, kv.Val.PacketsSent)
+		}
+		for _, kv := range flows.Secondary {
+			r.Map.SecondaryMap.SetOrUpdate(kv.Key, kv.Val.BytesRcvd, kv.Val.BytesSent, kv.Val.PacketsRcvd, kv.Val.PacketsSent)
+		}
+
+		// Share increments add up and TCP flags are OR-combined, hence merging the attributes yields
+		// those of the active probe
+		r.Attributes.Merge(flows.Attributes)
+	}
+}
+
+func (n *Node) renewLease(sent time.Time) {
+	n.mu.Lock()
+	if sent.After(n.lastContact) {
+		n.lastContact = sent
+	}
+	n.mu.Unlock()
+}
+
+func (n *Node) failoverDue() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.role == RoleStandby && time.Since(n.lastContact) > n.failoverTimeout
+}
+
+// takeOver promotes the node to active, starting the captures and replaying the replica
+func (n *Node) takeOver(ctx context.Context) {
+	logger := logs.FromContext(ctx, logs.ModuleCapture)
+
+	n.mu.Lock()
+	n.role, n.lastContact = RoleActive, time.Now()
+	n.setEpoch(ctx, n.epoch+1)
+	epoch, replica := n.epoch, n.replica
+	n.replica = nil
+	n.mu.Unlock()
+
+	logger.With("peer", n.peer, "epoch", epoch).Warn("no contact to active peer, taking over")
+	if err := n.captures.Activate(ctx); err != nil {
+		logger.Errorf("failed to start captures: %v", err)
+	}
+
+	flows := make([]capturetypes.TaggedAggFlowMap, 0, len(replica))
+	for _, r := range replica {
+		flows = append(flows, *r)
+	}
+	n.captures.ReplayFlows(flows...)
+}
+
+// setEpoch sets (and persists) the epoch (the caller must hold the lock)
+func (n *Node) setEpoch(ctx context.Context, epoch uint64) {
+	n.epoch = epoch
+	if n.epochFile == "" {
+		return
+	}
+	if err := writeEpoch(n.epochFile, epoch); err != nil {
+		logs.FromContext(ctx, logs.ModuleCapture).Errorf("failed to persist replication epoch: %v", err)
+	}
+}
+
+// tracker keeps track of the flows sent to the standby in order to compute deltas
+type tracker struct {
+	lastRotation time.Time
+	sent         map[string]*sentFlows
+}
+
+// sentFlows denotes the flows of an interface sent to the standby, along with their shares observed
+// with labels and their TCP flags
+type sentFlows struct {
+	flows    *hashmap.AggFlowMap
+	labeled  map[labeledKey]capturetypes.LabeledFlow
+	tcpFlags capturetypes.TCPFlags
+}
+
+// labeledKey identifies the share of a flow observed with a distinct set of labels
+type labeledKey struct {
+	key    string
+	labels capturetypes.FlowLabels
+}
+
+// delta takes a snapshot of the flows captured since the last writeout and returns the changes since
+// the previous delta (or all flows if a writeout occurred in the meantime, denoted by reset). If a
+// writeout interfered with the snapshot, no delta is returned
+func (t *tracker) delta(ctx context.Context, captures Captures) (reset bool, flows []flowMap, ok bool) {
+	lastRotation := captures.LastRotation()
+
+	snapshot := captures.GetTaggedFlowMaps(ctx)
+
+	// LastRotation() blocks during writeouts, hence an unchanged timestamp guarantees that the
+	// snapshot was taken before the writeout started
+	if !captures.LastRotation().Equal(lastRotation) {
+		return false, nil, false
+	}
+	if t.sent == nil || !lastRotation.Equal(t.lastRotation) {
+		reset, t.sent, t.lastRotation = true, make(map[string]*sentFlows), lastRotation
+	}
+
+	for _, m := range snapshot {
+		sent, exists := t.sent[m.Iface]
+		if !exists {
+			sent = &sentFlows{
+				flows:    hashmap.NewAggFlowMap(),
+				labeled:  make(map[labeledKey]capturetypes.LabeledFlow),
+				tcpFlags: make(capturetypes.TCPFlags),
+			}
+			t.sent[m.Iface] = sent
+		}
+		changes := flowMap{
+			Iface:      m.Iface,
+			Primary:    diff(m.Map.PrimaryMap, sent.flows.PrimaryMap),
+			Secondary:  diff(m.Map.SecondaryMap, sent.flows.SecondaryMap),
+			Attributes: diffAttributes(m.Attributes, sent),
+		}
+		if len(changes.Primary) > 0 || len(changes.Secondary) > 0 ||
+			len(changes.Attributes.Labeled) > 0 || len(changes.Attributes.TCPFlags) > 0 {
+			flows = append(flows, changes)
+		}
+	}
+	return reset, flows, true
+}
+
+// diff returns the counter increments of all flows changed since they were last sent (updating the
+// latter). Within a writeout interval, the counters of a flow never decrease
+func diff(current, sent *hashmap.Map) (changes hashmap.KeyVals) {
+	for it := current.Iter(); it.Next(); {
+		key, val := it.Key(), it.Val()
+		increment := val
+		if prev, exists := sent.Get(key); exists {
+			if prev == val {
+				continue
+			}
+			increment.Sub(prev)
+		}
+		sent.Set(key, val)
+		changes = append(changes, hashmap.KeyVal{Key: key, Val: increment})
+	}
+	return
+}
+
+// diffAttributes returns the counter increments of all shares of flows observed with labels and the TCP
+// flags of all flows changed since they were last sent (updating the latter). Within a writeout interval,
+// the counters of a share never decrease and TCP flags are only ever added
+func diffAttributes(current capturetypes.FlowAttributes, sent *sentFlows) (changes capturetypes.FlowAttributes) {
+	for key, shares := range current.Labeled {
+		for _, share := range shares {
+			lk := labeledKey{key: key, labels: share.FlowLabels}
+			increment := share
+			if prev, exists := sent.labeled[lk]; exists {
+				if prev == share {
+					continue
+				}
+				increment.Counters.Sub(prev.Counters)
+			}
+			sent.labeled[lk] = share
+			if changes.Labeled == nil {
+				changes.Labeled = make(capturetypes.LabeledFlows)
+			}
+			changes.Labeled.Add(key, increment)
+		}
+	}
+
+	for key, flags := range current.TCPFlags {
+		if sent.tcpFlags[key] == flags {
+			continue
+		}
+		sent.tcpFlags[key] = flags
+		if changes.TCPFlags == nil {
+			changes.TCPFlags = make(capturetypes.TCPFlags)
+		}
+		changes.TCPFlags[key] = flags
+	}
+	return
+}
+
+func readEpoch(path string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read replication epoch: %w", err)
+	}
+	epoch, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid replication epoch in %s: %w", path, err)
+	}
+	return epoch, nil
+}
+
+// writeEpoch persists the epoch atomically (via a temporary file)
+func writeEpoch(path string, epoch uint64) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatUint(epoch, 10)+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,494 @@
+package replication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testInterval        = 20 * time.Millisecond
+	testFailoverTimeout = 250 * time.Millisecond
+)
+
+var (
+	testKeyA = types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0, 80}, 6)
+	testKeyB = types.NewV4KeyStatic([4]byte{10, 0, 0, 2}, [4]byte{10, 0, 1, 1}, []byte{1, 187}, 6)
+)
+
+type testCaptures struct {
+	sync.Mutex
+	flows        map[string]*hashmap.AggFlowMap
+	attrs        map[string]*capturetypes.FlowAttributes
+	lastRotation time.Time
+	standby      bool
+	replayed     []capturetypes.TaggedAggFlowMap
+}
+
+func newTestCaptures(standby bool) *testCaptures {
+	return &testCaptures{
+		flows:   make(map[string]*hashmap.AggFlowMap),
+		attrs:   make(map[string]*capturetypes.FlowAttributes),
+		standby: standby,
+	}
+}
+
+func (c *testCaptures) add(iface string, key types.Key, val types.Counters) {
+	c.Lock()
+	defer c.Unlock()
+
+	m, exists := c.flows[iface]
+	if !exists {
+		m = hashmap.NewAggFlowMap()
+		c.flows[iface] = m
+	}
+	m.PrimaryMap.SetOrUpdate(key, val.BytesRcvd, val.BytesSent, val.PacketsRcvd, val.PacketsSent)
+}
+
+// addLabeled adds a packet observed with labels (and TCP flags) to a flow
+func (c *testCaptures) addLabeled(iface string, key types.Key, share capturetypes.LabeledFlow) {
+	c.add(iface, key, share.Counters)
+
+	c.Lock()
+	defer c.Unlock()
+
+	attrs, exists := c.attrs[iface]
+	if !exists {
+		attrs = new(capturetypes.FlowAttributes)
+		c.attrs[iface] = attrs
+	}
+	attrs.Merge(capturetypes.FlowAttributes{Labeled: capturetypes.LabeledFlows{string(key): {share}}})
+}
+
+func (c *testCaptures) rotate() {
+	c.Lock()
+	c.flows, c.attrs, c.lastRotation = make(map[string]*hashmap.AggFlowMap), make(map[string]*capturetypes.FlowAttributes), time.Now()
+	c.Unlock()
+}
+
+func (c *testCaptures) GetTaggedFlowMaps(_ context.Context, _ ...string) (flows []capturetypes.TaggedAggFlowMap) {
+	c.Lock()
+	defer c.Unlock()
+
+	for iface, m := range c.flows {
+		snapshot := capturetypes.TaggedAggFlowMap{Map: hashmap.NewAggFlowMap(), Iface: iface}
+		snapshot.Map.Merge(*m)
+		if attrs, exists := c.attrs[iface]; exists {
+			snapshot.Attributes.Merge(*attrs)
+		}
+		flows = append(flows, snapshot)
+	}
+	return
+}
+
+func (c *testCaptures) LastRotation() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lastRotation
+}
+
+func (c *testCaptures) ReplayFlows(flows ...capturetypes.TaggedAggFlowMap) {
+	c.Lock()
+	c.replayed = append(c.replayed, flows...)
+	c.Unlock()
+}
+
+func (c *testCaptures) Activate(context.Context) error {
+	c.Lock()
+	c.standby = false
+	c.Unlock()
+
+	return nil
+}
+
+func (c *testCaptures) Standby(context.Context) {
+	c.Lock()
+	c.standby, c.flows, c.attrs = true, make(map[string]*hashmap.AggFlowMap), make(map[string]*capturetypes.FlowAttributes)
+	c.Unlock()
+}
+
+func (c *testCaptures) isStandby() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.standby
+}
+
+func (n *Node) replicaCounters(iface string, key types.Key) types.Counters {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if r, exists := n.replica[iface]; exists {
+		val, _ := r.Map.PrimaryMap.Get(key)
+		return val
+	}
+	return types.Counters{}
+}
+
+// testCA issues the certificates of the test nodes
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// tlsConfig issues a certificate for the provided host (an IP or DNS name) and returns the TLS config
+// of a node presenting it
+func (ca *testCA) tlsConfig(t *testing.T, host string) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.Nil(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      roots,
+		MinVersion:   tls.VersionTLS13,
+	}
+}
+
+func newTestNode(t *testing.T, role Role, listener net.Listener, peer string, tlsConfig *tls.Config, captures Captures, opts ...Option) *Node {
+	t.Helper()
+
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		require.Nil(t, err)
+	}
+	n, err := New(role, listener, peer, tlsConfig, captures,
+		append([]Option{WithInterval(testInterval), WithFailoverTimeout(testFailoverTimeout)}, opts...)...)
+	require.Nil(t, err)
+
+	return n
+}
+
+func TestDelta(t *testing.T) {
+	captures := newTestCaptures(false)
+	ctx := context.Background()
+
+	var tr tracker
+	captures.add("eth0", testKeyA, types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+	reset, flows, ok := tr.delta(ctx, captures)
+	require.True(t, ok)
+	require.True(t, reset)
+	require.Equal(t, []flowMap{{Iface: "eth0", Primary: hashmap.KeyVals{{Key: testKeyA, Val: types.Counters{BytesRcvd: 100, PacketsRcvd: 1}}}}}, flows)
+
+	// Only the increments of changed flows are sent
+	captures.add("eth0", testKeyA, types.Counters{BytesRcvd: 50, PacketsRcvd: 1})
+	captures.add("eth0", testKeyB, types.Counters{BytesSent: 10, PacketsSent: 1})
+	reset, flows, ok = tr.delta(ctx, captures)
+	require.True(t, ok)
+	require.False(t, reset)
+	require.Len(t, flows, 1)
+	require.ElementsMatch(t, hashmap.KeyVals{
+		{Key: testKeyA, Val: types.Counters{BytesRcvd: 50, PacketsRcvd: 1}},
+		{Key: testKeyB, Val: types.Counters{BytesSent: 10, PacketsSent: 1}},
+	}, flows[0].Primary)
+
+	reset, flows, ok = tr.delta(ctx, captures)
+	require.True(t, ok)
+	require.False(t, reset)
+	require.Empty(t, flows)
+
+	// After a writeout, all flows captured since are sent (resetting the replica)
+	captures.rotate()
+	captures.add("eth0", testKeyA, types.Counters{BytesRcvd: 20, PacketsRcvd: 1})
+	reset, flows, ok = tr.delta(ctx, captures)
+	require.True(t, ok)
+	require.True(t, reset)
+	require.Equal(t, []flowMap{{Iface: "eth0", Primary: hashmap.KeyVals{{Key: testKeyA, Val: types.Counters{BytesRcvd: 20, PacketsRcvd: 1}}}}}, flows)
+
+	// The shares of flows observed with labels are sent as increments along with their TCP flags
+	labels := capturetypes.FlowLabels{VLAN: 100, DSCP: 46}
+	captures.addLabeled("eth0", testKeyA, capturetypes.LabeledFlow{FlowLabels: labels,
+		Counters: types.Counters{BytesRcvd: 10, PacketsRcvd: 1}, TCPFlags: types.TCPFlagSYN})
+	_, flows, ok = tr.delta(ctx, captures)
+	require.True(t, ok)
+	require.Equal(t, []flowMap{{
+		Iface:   "eth0",
+		Primary: hashmap.KeyVals{{Key: testKeyA, Val: types.Counters{BytesRcvd: 10, PacketsRcvd: 1}}},
+		Attributes: capturetypes.FlowAttributes{Labeled: capturetypes.LabeledFlows{string(testKeyA): {{
+			FlowLabels: labels, Counters: types.Counters{BytesRcvd: 10, PacketsRcvd: 1}, TCPFlags: types.TCPFlagSYN,
+		}}}},
+	}}, flows)
+
+	captures.addLabeled("eth0", testKeyA, capturetypes.LabeledFlow{FlowLabels: labels,
+		Counters: types.Counters{BytesRcvd: 5, PacketsRcvd: 1}, TCPFlags: types.TCPFlagACK})
+	_, flows, ok = tr.delta(ctx, captures)
+	require.True(t, ok)
+	require.Len(t, flows, 1)
+	require.Equal(t, capturetypes.LabeledFlows{string(testKeyA): {{
+		FlowLabels: labels, Counters: types.Counters{BytesRcvd: 5, PacketsRcvd: 1}, TCPFlags: types.TCPFlagSYN | types.TCPFlagACK,
+	}}}, flows[0].Attributes.Labeled)
+}
+
+func TestNew(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+	tlsConfig := newTestCA(t).tlsConfig(t, "127.0.0.1")
+
+	_, err = New("primary", listener, "127.0.0.1:1", tlsConfig, newTestCaptures(false))
+	require.ErrorIs(t, err, errorInvalidRole)
+	_, err = New(RoleActive, listener, "127.0.0.1:1", tlsConfig, newTestCaptures(false), WithInterval(time.Minute))
+	require.ErrorIs(t, err, errorInvalidFailoverTimeout)
+	_, err = New(RoleActive, listener, "127.0.0.1:1", nil, newTestCaptures(false))
+	require.ErrorIs(t, err, errorNoCredentials)
+	_, err = New(RoleActive, listener, "127.0.0.1:1", &tls.Config{Certificates: tlsConfig.Certificates, MinVersion: tls.VersionTLS13}, newTestCaptures(false))
+	require.ErrorIs(t, err, errorNoCredentials)
+	_, err = New(RoleActive, listener, "127.0.0.1", tlsConfig, newTestCaptures(false))
+	require.NotNil(t, err)
+
+	// The epoch is restored from the epoch file
+	epochFile := filepath.Join(t.TempDir(), "replication.epoch")
+	require.Nil(t, writeEpoch(epochFile, 3))
+	n, err := New(RoleStandby, listener, "127.0.0.1:1", tlsConfig, newTestCaptures(true), WithEpochFile(epochFile))
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), n.Epoch())
+
+	require.Nil(t, os.WriteFile(epochFile, []byte("invalid"), 0600))
+	_, err = New(RoleStandby, listener, "127.0.0.1:1", tlsConfig, newTestCaptures(true), WithEpochFile(epochFile))
+	require.NotNil(t, err)
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	tlsConfig := ca.tlsConfig(t, "probe-a.example.com")
+	key, err := x509.MarshalECPrivateKey(tlsConfig.Certificates[0].PrivateKey.(*ecdsa.PrivateKey))
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "probe.crt"), filepath.Join(dir, "probe.key"), filepath.Join(dir, "ca.crt")
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsConfig.Certificates[0].Certificate[0]}), 0600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600))
+	require.Nil(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+
+	loaded, err := LoadTLSConfig(certFile, keyFile, caFile)
+	require.Nil(t, err)
+	require.Len(t, loaded.Certificates, 1)
+	require.Equal(t, tlsConfig.Certificates[0].Certificate, loaded.Certificates[0].Certificate)
+	require.True(t, loaded.RootCAs.Equal(tlsConfig.RootCAs))
+
+	_, err = LoadTLSConfig(certFile, keyFile, keyFile)
+	require.NotNil(t, err)
+	_, err = LoadTLSConfig(certFile, caFile, caFile)
+	require.NotNil(t, err)
+}
+
+func TestRejectUnexpectedPeer(t *testing.T) {
+	ca := newTestCA(t)
+	standby := newTestNode(t, RoleStandby, nil, "127.0.0.1:1", ca.tlsConfig(t, "127.0.0.1"), newTestCaptures(true))
+	defer standby.listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go standby.serve(ctx)
+
+	for _, c := range []struct {
+		name      string
+		tlsConfig *tls.Config
+	}{
+		{"certificate_of_other_host", ca.tlsConfig(t, "probe-c.example.com")},
+		{"certificate_of_other_ca", newTestCA(t).tlsConfig(t, "127.0.0.1")},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+
+			// Connections of any node other than the configured peer are rejected during the TLS handshake
+			// (the CA of the other node being trusted by the standby in order to reach the handshake in the
+			// first place)
+			tlsConfig := c.tlsConfig.Clone()
+			tlsConfig.RootCAs.AddCert(ca.cert)
+			intruder := newTestNode(t, RoleActive, nil, standby.listener.Addr().String(), tlsConfig, newTestCaptures(false))
+			defer intruder.listener.Close()
+
+			require.NotNil(t, intruder.replicate(ctx))
+			require.Equal(t, RoleStandby, standby.Role())
+			require.Equal(t, uint64(0), standby.Epoch())
+			standby.mu.Lock()
+			require.Nil(t, standby.replica)
+			standby.mu.Unlock()
+		})
+	}
+}
+
+func TestFailover(t *testing.T) {
+	listenerA, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	listenerB, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addrA, addrB := listenerA.Addr().String(), listenerB.Addr().String()
+
+	// Both nodes run on the same host, hence they share a certificate
+	tlsConfig := newTestCA(t).tlsConfig(t, "127.0.0.1")
+
+	capturesA, capturesB := newTestCaptures(false), newTestCaptures(true)
+	epochFile := filepath.Join(t.TempDir(), "replication.epoch")
+	nodeA := newTestNode(t, RoleActive, listenerA, addrB, tlsConfig, capturesA)
+	nodeB := newTestNode(t, RoleStandby, listenerB, addrA, tlsConfig, capturesB, WithEpochFile(epochFile))
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go nodeA.Run(ctxA)
+	go nodeB.Run(ctxB)
+
+	// The flows of the active probe are replicated to the standby
+	capturesA.add("eth0", testKeyA, types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+	require.Eventually(t, func() bool {
+		return nodeB.replicaCounters("eth0", testKeyA) == types.Counters{BytesRcvd: 100, PacketsRcvd: 1}
+	}, 5*time.Second, testInterval)
+	share := capturetypes.LabeledFlow{FlowLabels: capturetypes.FlowLabels{VLAN: 100},
+		Counters: types.Counters{BytesRcvd: 50, PacketsRcvd: 1}, TCPFlags: types.TCPFlagACK}
+	capturesA.addLabeled("eth0", testKeyA, share)
+	require.Eventually(t, func() bool {
+		return nodeB.replicaCounters("eth0", testKeyA) == types.Counters{BytesRcvd: 150, PacketsRcvd: 2}
+	}, 5*time.Second, testInterval)
+	require.Eventually(t, func() bool {
+		return nodeA.HealthCheck(ctxA) == nil
+	}, 5*time.Second, testInterval)
+	require.Nil(t, nodeA.CheckWriteout(ctxA))
+	require.ErrorIs(t, nodeB.CheckWriteout(ctxB), errorNotActive)
+
+	// Once the active probe fails, the standby takes over and replays the replicated flows
+	cancelA()
+	require.Eventually(t, func() bool {
+		return nodeB.Role() == RoleActive
+	}, 5*time.Second, testInterval)
+	require.False(t, capturesB.isStandby())
+	require.Equal(t, uint64(1), nodeB.Epoch())
+	epoch, err := readEpoch(epochFile)
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), epoch)
+
+	capturesB.Lock()
+	require.Len(t, capturesB.replayed, 1)
+	require.Equal(t, "eth0", capturesB.replayed[0].Iface)
+	val, exists := capturesB.replayed[0].Map.PrimaryMap.Get(testKeyA)
+	attrs := capturesB.replayed[0].Attributes
+	capturesB.Unlock()
+	require.True(t, exists)
+	require.Equal(t, types.Counters{BytesRcvd: 150, PacketsRcvd: 2}, val)
+	require.Equal(t, capturetypes.LabeledFlows{string(testKeyA): {share}}, attrs.Labeled)
+
+	// When the failed probe returns as active, it is fenced by the larger epoch of the probe that took over
+	// and steps down (becoming its standby)
+	listenerA, err = net.Listen("tcp", addrA)
+	require.Nil(t, err)
+	capturesA = newTestCaptures(false)
+	nodeA = newTestNode(t, RoleActive, listenerA, addrB, tlsConfig, capturesA)
+	ctxA, cancelA = context.WithCancel(context.Background())
+	defer cancelA()
+	go nodeA.Run(ctxA)
+
+	require.Eventually(t, func() bool {
+		return nodeA.Role() == RoleStandby
+	}, 5*time.Second, testInterval)
+	require.True(t, capturesA.isStandby())
+	require.Equal(t, uint64(1), nodeA.Epoch())
+	require.ErrorIs(t, nodeA.CheckWriteout(ctxA), errorNotActive)
+
+	capturesB.add("eth0", testKeyB, types.Counters{BytesSent: 10, PacketsSent: 1})
+	require.Eventually(t, func() bool {
+		return nodeA.replicaCounters("eth0", testKeyB) == types.Counters{BytesSent: 10, PacketsSent: 1}
+	}, 5*time.Second, testInterval)
+	require.Equal(t, RoleActive, nodeB.Role())
+	require.Nil(t, nodeB.CheckWriteout(ctxB))
+}
+
+func TestConflictingActives(t *testing.T) {
+	listenerA, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	listenerB, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	tlsConfig := newTestCA(t).tlsConfig(t, "127.0.0.1")
+
+	// With equal epochs, the probe with the larger node ID steps down
+	capturesA, capturesB := newTestCaptures(false), newTestCaptures(false)
+	nodeA := newTestNode(t, RoleActive, listenerA, listenerB.Addr().String(), tlsConfig, capturesA, WithNodeID("a"))
+	nodeB := newTestNode(t, RoleActive, listenerB, listenerA.Addr().String(), tlsConfig, capturesB, WithNodeID("b"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go nodeA.Run(ctx)
+	go nodeB.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return nodeB.Role() == RoleStandby
+	}, 5*time.Second, testInterval)
+	require.True(t, capturesB.isStandby())
+	require.Equal(t, RoleActive, nodeA.Role())
+	require.False(t, capturesA.isStandby())
+}
+
+func TestCheckWriteoutWithoutPeer(t *testing.T) {
+	// Reserve an address nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	peer := listener.Addr().String()
+	require.Nil(t, listener.Close())
+
+	n := newTestNode(t, RoleActive, nil, peer, newTestCA(t).tlsConfig(t, "127.0.0.1"), newTestCaptures(false))
+	defer n.listener.Close()
+
+	// Without a lease, an unreachable peer doesn't prevent writeouts (but is reported)
+	ctx := context.Background()
+	require.Nil(t, n.CheckWriteout(ctx))
+	require.Len(t, n.HealthCheck(ctx), 1)
+}
@@ -0,0 +1,192 @@
+// Package simulate simulates the resource usage of goProbe for a configuration and a traffic profile
+// without capturing any packets, allowing to size the ring buffers, local buffers and storage quotas
+// before deploying goProbe to a new site.
+//
+// For each interface, the flows of one writeout interval are synthesized and processed by the regular
+// flow log (c.f. capture.Simulate) before being written to a temporary goDB using the configured encoder,
+// so that the memory usage, rotation / writeout durations and writeout sizes reflect the actual
+// implementation (on the host running the simulation).
+package simulate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture"
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/cgroup"
+	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+)
+
+// MinRingBufferDuration denotes the minimum duration of traffic a ring buffer should be able to hold in
+// order to absorb short stalls of the capture (e.g. due to scheduling)
+const MinRingBufferDuration = 100 * time.Millisecond
+
+const writeoutsPerDay = 86400 / goDB.DBWriteInterval
+
+var errInvalidProfile = errors.New("invalid traffic profile")
+
+// IfaceResult stores the simulated resource usage of an interface
+type IfaceResult struct {
+	capture.Simulation
+
+	// WriteoutSize denotes the on-disk size of the data written per writeout
+	WriteoutSize int64 `json:"writeout_size"`
+	// WriteoutDuration denotes the duration of writing the flows of a writeout interval to the goDB
+	WriteoutDuration time.Duration `json:"writeout_duration"`
+	// DailySize denotes the on-disk size of the data written per day
+	DailySize int64 `json:"daily_size"`
+}
+
+// QuotaResult stores the retention resulting from a storage quota
+type QuotaResult struct {
+	Ifaces    []string      `json:"ifaces"`
+	MaxSize   int64         `json:"max_size"`
+	DailySize int64         `json:"daily_size"`
+	Retention time.Duration `json:"retention"`
+}
+
+// Report stores the result of a simulation
+type Report struct {
+	Profile capture.TrafficProfile `json:"profile"`
+
+	Ifaces map[string]IfaceResult `json:"ifaces"`
+	Quotas []QuotaResult          `json:"quotas,omitempty"`
+
+	// LocalBufferSize denotes the size limit of the local buffers
+	LocalBufferSize int `json:"local_buffer_size"`
+
+	// Warnings lists all aspects of the configuration that are likely insufficient for the profile
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Run simulates the capture of the traffic profile on all interfaces of the configuration (or the subset
+// provided), using a temporary goDB
+func Run(cfg *config.Config, profile capture.TrafficProfile, ifaces ...string) (*Report, error) {
+	if profile.PacketRate < 0 || profile.Flows < 0 || profile.PacketSize < 0 ||
+		profile.IPv6Share < 0 || profile.IPv6Share > 1 {
+		return nil, fmt.Errorf("%w: rates, flows and packet sizes must not be negative, the IPv6 share must be between 0 and 1", errInvalidProfile)
+	}
+
+	encoderType, err := encoders.GetTypeByString(cfg.DB.EncoderType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encoder type from %s: %w", cfg.DB.EncoderType, err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "goprobe-simulate-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary goDB: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	report := &Report{
+		Profile:         profile,
+		Ifaces:          make(map[string]IfaceResult),
+		LocalBufferSize: config.DefaultLocalBufferSize(cgroup.Current().MemoryBytes),
+	}
+	if cfg.LocalBuffers != nil {
+		report.LocalBufferSize = cfg.LocalBuffers.SizeLimit
+	}
+
+	interval := time.Duration(goDB.DBWriteInterval) * time.Second
+	timestamp := time.Now().Unix()
+	for iface, ifaceCfg := range cfg.Interfaces {
+		if len(ifaces) > 0 && !slices.Contains(ifaces, iface) {
+			continue
+		}
+
+		agg, sim := capture.Simulate(ifaceCfg, profile, interval)
+		res := IfaceResult{Simulation: sim}
+
+		w := goDB.NewDBWriter(tempDir, iface, encoderType).
+			EncoderLevel(cfg.DB.EncoderLevel).
+			AdaptiveEncoding(cfg.DB.AdaptiveEncoding.AdaptiveEncoding()).
+			BlockFrames(cfg.DB.BlockFrames)
+
+		t0 := time.Now()
+		if err := w.Write(agg, capturetypes.CaptureStats{}, timestamp); err != nil {
+			return nil, fmt.Errorf("failed to write simulated flows of %s: %w", iface, err)
+		}
+		res.WriteoutDuration = time.Since(t0)
+		if res.WriteoutSize, err = dirSize(filepath.Join(tempDir, iface)); err != nil {
+			return nil, err
+		}
+		res.DailySize = res.WriteoutSize * writeoutsPerDay
+
+		report.Ifaces[iface] = res
+		report.Warnings = append(report.Warnings, res.warnings(iface, report.LocalBufferSize)...)
+	}
+	if len(report.Ifaces) == 0 {
+		return nil, fmt.Errorf("none of the interfaces %v are configured", ifaces)
+	}
+
+	report.Quotas = quotaRetention(cfg.DB.Quotas, report.Ifaces)
+	slices.Sort(report.Warnings)
+
+	return report, nil
+}
+
+// warnings returns all aspects of the configuration of an interface that are likely insufficient
+func (r IfaceResult) warnings(iface string, localBufferSize int) (warnings []string) {
+	if r.LocalBufferSize > localBufferSize {
+		warnings = append(warnings, fmt.Sprintf("%s: the local buffer (%d bytes) cannot hold the packets arriving during a live query (%d bytes required), packets may be dropped",
+			iface, localBufferSize, r.LocalBufferSize))
+	}
+	if r.RingBufferSize > 0 && r.RingBufferDuration < MinRingBufferDuration {
+		warnings = append(warnings, fmt.Sprintf("%s: the ring buffer only holds %v of traffic (at least %v recommended), consider increasing its number of blocks / block size",
+			iface, r.RingBufferDuration.Round(time.Microsecond), MinRingBufferDuration))
+	}
+	if r.WriteoutDuration+r.AggregationDuration > time.Duration(goDB.DBWriteInterval)*time.Second/2 {
+		warnings = append(warnings, fmt.Sprintf("%s: a writeout takes %v, which is a significant share of the writeout interval",
+			iface, (r.WriteoutDuration+r.AggregationDuration).Round(time.Millisecond)))
+	}
+	return
+}
+
+// quotaRetention determines the retention resulting from each storage quota (considering only the
+// simulated interfaces)
+func quotaRetention(quotas config.Quotas, ifaces map[string]IfaceResult) (results []QuotaResult) {
+	for _, quota := range quotas {
+		res := QuotaResult{
+			Ifaces:  quota.Ifaces,
+			MaxSize: quota.MaxSize,
+		}
+		for _, iface := range quota.Ifaces {
+			res.DailySize += ifaces[iface].DailySize
+		}
+		if res.DailySize > 0 {
+			res.Retention = time.Duration(float64(res.MaxSize) / float64(res.DailySize) * float64(24*time.Hour))
+		}
+		results = append(results, res)
+	}
+	return
+}
+
+// dirSize returns the total size of all files below path
+func dirSize(path string) (size int64, err error) {
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine size of %s: %w", path, err)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package simulate
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/capture"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	cfg := &config.Config{
+		DB: config.DBConfig{
+			EncoderType: "null",
+			Quotas: config.Quotas{
+				{Ifaces: []string{"eth0", "eth1"}, MaxSize: 1 << 40},
+			},
+		},
+		Interfaces: config.Ifaces{
+			"eth0": config.CaptureConfig{
+				RingBuffer: &config.RingBufferConfig{BlockSize: os.Getpagesize(), NumBlocks: 2},
+			},
+			"eth1": config.CaptureConfig{
+				RingBuffer: &config.RingBufferConfig{BlockSize: 1 << 20, NumBlocks: 4},
+			},
+			"router0": config.CaptureConfig{
+				Ingest: &config.IngestConfig{Listen: ":2055"},
+			},
+		},
+		LocalBuffers: &config.LocalBufferConfig{SizeLimit: 1, NumBuffers: 1},
+	}
+	profile := capture.TrafficProfile{PacketRate: 10000, Flows: 1000, IPv6Share: 0.5, PacketSize: 500}
+
+	report, err := Run(cfg, profile)
+	require.NoError(t, err)
+	require.Len(t, report.Ifaces, 3)
+	require.Equal(t, 1, report.LocalBufferSize)
+
+	for iface, res := range report.Ifaces {
+		require.Equal(t, uint64(3000000), res.Packets, iface)
+		require.NotZero(t, res.FlowLogSize, iface)
+		require.Positive(t, res.WriteoutSize, iface)
+		require.Equal(t, res.WriteoutSize*writeoutsPerDay, res.DailySize, iface)
+	}
+
+	// The ring buffer of eth0 only holds two pages of frames, whereas no ring buffer is used for
+	// the ingestion of flow records
+	require.Less(t, report.Ifaces["eth0"].RingBufferDuration, MinRingBufferDuration)
+	require.Greater(t, report.Ifaces["eth1"].RingBufferDuration, MinRingBufferDuration)
+	require.Zero(t, report.Ifaces["router0"].RingBufferSize)
+	require.Contains(t, report.Warnings, "eth0: the ring buffer only holds "+
+		report.Ifaces["eth0"].RingBufferDuration.Round(time.Microsecond).String()+
+		" of traffic (at least 100ms recommended), consider increasing its number of blocks / block size")
+
+	// The same (deterministic) flows are written for all interfaces
+	require.Equal(t, report.Ifaces["eth0"].WriteoutSize, report.Ifaces["eth1"].WriteoutSize)
+
+	require.Len(t, report.Quotas, 1)
+	require.Equal(t, report.Ifaces["eth0"].DailySize+report.Ifaces["eth1"].DailySize, report.Quotas[0].DailySize)
+	require.InDelta(t, float64(1<<40)/float64(report.Quotas[0].DailySize), report.Quotas[0].Retention.Hours()/24, 0.01)
+
+	// Restricted to a subset of the interfaces
+	report, err = Run(cfg, profile, "eth1")
+	require.NoError(t, err)
+	require.Len(t, report.Ifaces, 1)
+	require.Contains(t, report.Ifaces, "eth1")
+
+	_, err = Run(cfg, profile, "eth2")
+	require.Error(t, err)
+	_, err = Run(cfg, capture.TrafficProfile{IPv6Share: 2})
+	require.ErrorIs(t, err, errInvalidProfile)
+}
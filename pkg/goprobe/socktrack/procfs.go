@@ -0,0 +1,405 @@
+package socktrack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/telemetry/logging"
+)
+
+// sockTables lists the socket tables exposed by the kernel (relative to the procfs root)
+var sockTables = []struct {
+	path  string
+	proto byte
+}{
+	{"net/tcp", capturetypes.TCP},
+	{"net/tcp6", capturetypes.TCP},
+	{"net/udp", capturetypes.UDP},
+	{"net/udp6", capturetypes.UDP},
+}
+
+// connKey identifies a connected socket by its local address and its peer
+type connKey struct {
+	proto      byte
+	local      netip.Addr
+	remote     netip.Addr
+	remotePort uint16
+}
+
+// boundKey identifies a listening (or unconnected) socket by its local address and port
+type boundKey struct {
+	proto byte
+	local netip.Addr
+	port  uint16
+}
+
+type socket struct {
+	inode uint64
+	seen  time.Time
+}
+
+type owner struct {
+	Process
+	seen time.Time
+}
+
+// sockEntry denotes a single entry of a socket table
+type sockEntry struct {
+	proto  byte
+	local  netip.AddrPort
+	remote netip.AddrPort
+	inode  uint64
+}
+
+// procFS tracks sockets by polling the socket tables and process information exposed via procfs
+type procFS struct {
+	root         string
+	pollInterval time.Duration
+	retention    time.Duration
+	now          func() time.Time
+
+	connected map[connKey]socket
+	bound     map[boundKey]socket
+	owners    map[uint64]owner // indexed by socket inode
+
+	sync.RWMutex
+}
+
+func newProcFS(root string, opts ...Option) *procFS {
+	p := &procFS{
+		root:         root,
+		pollInterval: DefaultPollInterval,
+		retention:    DefaultRetention,
+		now:          time.Now,
+		connected:    make(map[connKey]socket),
+		bound:        make(map[boundKey]socket),
+		owners:       make(map[uint64]owner),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Run polls the sockets until the context is cancelled. It implements the Tracker interface
+func (p *procFS) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.poll(); err != nil {
+			logger.Warnf("failed to poll sockets: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lookup returns the process owning the local socket of a flow. Since the source port of a flow is
+// not part of its key, outbound flows are matched against connected sockets via their peer, while
+// inbound flows are matched against the socket listening on their destination. It implements the
+// Tracker interface
+func (p *procFS) Lookup(key types.Key) (Process, bool) {
+	proto := key.GetProto()
+	if proto != capturetypes.TCP && proto != capturetypes.UDP {
+		return Process{}, false
+	}
+
+	var (
+		sip   = types.RawIPToAddr(key.GetSIP())
+		dip   = types.RawIPToAddr(key.GetDIP())
+		dport = types.PortToUint16(key.GetDport())
+	)
+
+	p.RLock()
+	defer p.RUnlock()
+
+	if s, exists := p.connected[connKey{proto: proto, local: sip, remote: dip, remotePort: dport}]; exists {
+		if o, exists := p.owners[s.inode]; exists {
+			return o.Process, true
+		}
+	}
+
+	// sockets bound to the wildcard address accept flows to any local address (IPv6 sockets
+	// generally accept IPv4 flows as well)
+	candidates := []netip.Addr{dip, netip.IPv6Unspecified()}
+	if dip.Is4() {
+		candidates = []netip.Addr{dip, netip.IPv4Unspecified(), netip.IPv6Unspecified()}
+	}
+	for _, local := range candidates {
+		if s, exists := p.bound[boundKey{proto: proto, local: local, port: dport}]; exists {
+			if o, exists := p.owners[s.inode]; exists {
+				return o.Process, true
+			}
+		}
+	}
+	return Process{}, false
+}
+
+// poll reads the socket tables, resolves the owners of all sockets not seen before and expires
+// sockets not seen for longer than the retention period
+func (p *procFS) poll() error {
+	var sockets []sockEntry
+	for _, table := range sockTables {
+		entries, err := readSockTable(filepath.Join(p.root, table.path), table.proto)
+		if err != nil {
+			// the IPv6 tables are missing if IPv6 is disabled
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		sockets = append(sockets, entries...)
+	}
+
+	// resolving the owner of a socket requires scanning the file descriptors of all processes, hence
+	// it is limited to sockets not seen before (only the poller modifies the owners)
+	unknown := make(map[uint64]struct{})
+	p.RLock()
+	for _, s := range sockets {
+		if _, exists := p.owners[s.inode]; !exists {
+			unknown[s.inode] = struct{}{}
+		}
+	}
+	p.RUnlock()
+	resolved := p.resolveOwners(unknown)
+
+	now := p.now()
+
+	p.Lock()
+	defer p.Unlock()
+
+	for inode, proc := range resolved {
+		p.owners[inode] = owner{Process: proc}
+	}
+	for _, s := range sockets {
+		o, exists := p.owners[s.inode]
+		if !exists {
+			continue
+		}
+		o.seen = now
+		p.owners[s.inode] = o
+
+		if s.remote.Addr().IsUnspecified() {
+			p.bound[boundKey{proto: s.proto, local: s.local.Addr(), port: s.local.Port()}] = socket{inode: s.inode, seen: now}
+			continue
+		}
+		p.connected[connKey{proto: s.proto, local: s.local.Addr(), remote: s.remote.Addr(), remotePort: s.remote.Port()}] = socket{inode: s.inode, seen: now}
+	}
+
+	expired := now.Add(-p.retention)
+	for k, s := range p.connected {
+		if s.seen.Before(expired) {
+			delete(p.connected, k)
+		}
+	}
+	for k, s := range p.bound {
+		if s.seen.Before(expired) {
+			delete(p.bound, k)
+		}
+	}
+	for inode, o := range p.owners {
+		if o.seen.Before(expired) {
+			delete(p.owners, inode)
+		}
+	}
+	return nil
+}
+
+// resolveOwners scans the file descriptors of all processes for the socket inodes
+func (p *procFS) resolveOwners(inodes map[uint64]struct{}) map[uint64]Process {
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(p.root)
+	if err != nil {
+		return nil
+	}
+
+	owners := make(map[uint64]Process)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// processes may exit at any time, hence all errors are ignored
+		fdDir := filepath.Join(p.root, entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		var (
+			proc     Process
+			resolved bool
+		)
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			inode, isSocket := socketInode(link)
+			if !isSocket {
+				continue
+			}
+			if _, wanted := inodes[inode]; !wanted {
+				continue
+			}
+
+			if !resolved {
+				if proc, err = p.process(pid); err != nil {
+					break
+				}
+				resolved = true
+			}
+			owners[inode] = proc
+			delete(inodes, inode)
+		}
+
+		if len(inodes) == 0 {
+			break
+		}
+	}
+	return owners
+}
+
+// process reads the name and cgroup of a process
+func (p *procFS) process(pid int) (Process, error) {
+	dir := filepath.Join(p.root, strconv.Itoa(pid))
+
+	comm, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "comm")))
+	if err != nil {
+		return Process{}, err
+	}
+	proc := Process{
+		PID:  pid,
+		Comm: strings.TrimSpace(string(comm)),
+	}
+
+	// the cgroup is optional (e.g. if cgroups aren't mounted)
+	if cgroup, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "cgroup"))); err == nil {
+		proc.Cgroup = parseCgroup(cgroup)
+	}
+	return proc, nil
+}
+
+// parseCgroup extracts the cgroup path from the contents of /proc/<pid>/cgroup, preferring the unified
+// (v2) hierarchy over the systemd one (v1)
+func parseCgroup(data []byte) (cgroup string) {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			return fields[2]
+		case fields[1] == "name=systemd" || cgroup == "":
+			cgroup = fields[2]
+		}
+	}
+	return
+}
+
+// socketInode extracts the inode from the target of a file descriptor link referencing a socket
+// (e.g. "socket:[12345]")
+func socketInode(link string) (uint64, bool) {
+	inode, found := strings.CutPrefix(link, "socket:[")
+	if !found {
+		return 0, false
+	}
+	inode, found = strings.CutSuffix(inode, "]")
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(inode, 10, 64)
+	return n, err == nil
+}
+
+// readSockTable reads a socket table (e.g. /proc/net/tcp), skipping sockets without an inode (such as
+// those in TIME_WAIT state)
+func readSockTable(path string, proto byte) ([]sockEntry, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []sockEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 0; scanner.Scan(); lineNo++ {
+		// the first line is the header
+		if lineNo == 0 {
+			continue
+		}
+
+		//   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, err := parseSockAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo+1, err)
+		}
+		remote, err := parseSockAddr(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo+1, err)
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid inode: %w", path, lineNo+1, err)
+		}
+		if inode == 0 {
+			continue
+		}
+
+		entries = append(entries, sockEntry{proto: proto, local: local, remote: remote, inode: inode})
+	}
+	return entries, scanner.Err()
+}
+
+// parseSockAddr parses an address of a socket table (e.g. "0100007F:0277"). The kernel prints the
+// IP address as sequence of 32 bit words in host byte order, IPv4 mapped IPv6 addresses are unmapped
+func parseSockAddr(s string) (netip.AddrPort, error) {
+	host, port, found := strings.Cut(s, ":")
+	if !found {
+		return netip.AddrPort{}, fmt.Errorf("invalid socket address %q", s)
+	}
+
+	raw, err := hex.DecodeString(host)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("invalid socket address %q", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(raw[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+
+	portNum, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid socket port %q", s)
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(portNum)), nil
+}
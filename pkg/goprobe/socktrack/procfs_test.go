@@ -0,0 +1,165 @@
+package socktrack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const sockTableHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+// sockAddr encodes an address the way the kernel prints it in the socket tables
+func sockAddr(addrPort string) string {
+	ap := netip.MustParseAddrPort(addrPort)
+	raw := ap.Addr().AsSlice()
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(raw[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	return fmt.Sprintf("%X:%04X", raw, ap.Port())
+}
+
+type testProcFS struct {
+	root string
+}
+
+func newTestProcFS(t *testing.T) *testProcFS {
+	t.Helper()
+
+	root := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "net"), 0755))
+	return &testProcFS{root: root}
+}
+
+func (fs *testProcFS) sockets(t *testing.T, table string, entries ...string) {
+	t.Helper()
+
+	var sb strings.Builder
+	sb.WriteString(sockTableHeader)
+	for i, entry := range entries {
+		var local, remote string
+		var inode uint64
+		_, err := fmt.Sscanf(entry, "%s %s %d", &local, &remote, &inode)
+		require.Nil(t, err)
+		fmt.Fprintf(&sb, "%4d: %s %s 0A 00000000:00000000 00:00000000 00000000     0        0 %d 1 0000000000000000 100 0 0 10 0\n",
+			i, sockAddr(local), sockAddr(remote), inode)
+	}
+	require.Nil(t, os.WriteFile(filepath.Join(fs.root, "net", table), []byte(sb.String()), 0600))
+}
+
+func (fs *testProcFS) process(t *testing.T, pid int, comm, cgroup string, inodes ...uint64) {
+	t.Helper()
+
+	dir := filepath.Join(fs.root, fmt.Sprint(pid))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "fd"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0600))
+	require.Nil(t, os.Symlink("/dev/null", filepath.Join(dir, "fd", "0")))
+	for i, inode := range inodes {
+		require.Nil(t, os.Symlink(fmt.Sprintf("socket:[%d]", inode), filepath.Join(dir, "fd", fmt.Sprint(i+3))))
+	}
+}
+
+func testKey(sip, dip string, dport uint16, proto byte) types.Key {
+	return types.NewKey(
+		netip.MustParseAddr(sip).AsSlice(),
+		netip.MustParseAddr(dip).AsSlice(),
+		binary.BigEndian.AppendUint16(nil, dport),
+		proto,
+	)
+}
+
+func TestParseSockAddr(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:631", "0.0.0.0:0", "[fe80::1]:53", "[::]:22"} {
+		ap, err := parseSockAddr(sockAddr(addr))
+		require.Nil(t, err)
+		require.Equal(t, netip.MustParseAddrPort(addr), ap)
+	}
+
+	// IPv4 mapped addresses are unmapped
+	ap, err := parseSockAddr(sockAddr("[::ffff:10.0.0.1]:443"))
+	require.Nil(t, err)
+	require.Equal(t, netip.MustParseAddrPort("10.0.0.1:443"), ap)
+
+	for _, invalid := range []string{"", "0100007F", "0100007:0277", "0100007F:XYZ"} {
+		_, err := parseSockAddr(invalid)
+		require.Error(t, err)
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	require.Equal(t, "/system.slice/nginx.service", parseCgroup([]byte("0::/system.slice/nginx.service\n")))
+	require.Equal(t, "/system.slice/sshd.service", parseCgroup([]byte("12:cpu,cpuacct:/\n1:name=systemd:/system.slice/sshd.service\n")))
+	require.Equal(t, "/user.slice", parseCgroup([]byte("4:memory:/user.slice\n")))
+	require.Empty(t, parseCgroup(nil))
+}
+
+func TestProcessLabel(t *testing.T) {
+	require.Equal(t, "sshd", Process{PID: 1, Comm: "sshd", Cgroup: "/"}.Label())
+	require.Equal(t, "nginx (/system.slice/nginx.service)", Process{Comm: "nginx", Cgroup: "/system.slice/nginx.service"}.Label())
+}
+
+func TestTracker(t *testing.T) {
+	fs := newTestProcFS(t)
+	fs.sockets(t, "tcp",
+		"0.0.0.0:22 0.0.0.0:0 100",
+		"127.0.0.1:40000 127.0.0.1:5432 101",
+		"127.0.0.1:5432 0.0.0.0:0 102",
+		"10.0.0.1:50000 192.0.2.1:443 0", // TIME_WAIT
+	)
+	fs.sockets(t, "udp6", "[::]:53 [::]:0 103")
+	fs.process(t, 1, "sshd", "0::/system.slice/ssh.service\n", 100)
+	fs.process(t, 42, "app", "0::/system.slice/app.service\n", 101)
+	fs.process(t, 43, "postgres", "0::/system.slice/postgresql.service\n", 102)
+	fs.process(t, 44, "dnsmasq", "0::/\n", 103)
+
+	now := time.Now()
+	tracker := newProcFS(fs.root, WithRetention(time.Minute))
+	tracker.now = func() time.Time { return now }
+	require.Nil(t, tracker.poll())
+
+	var tests = []struct {
+		name     string
+		key      types.Key
+		expected string
+	}{
+		{"outbound connection", testKey("127.0.0.1", "127.0.0.1", 5432, capturetypes.TCP), "app (/system.slice/app.service)"},
+		{"inbound via wildcard listener", testKey("192.0.2.1", "10.0.0.1", 22, capturetypes.TCP), "sshd (/system.slice/ssh.service)"},
+		{"inbound via local listener", testKey("127.0.0.2", "127.0.0.1", 5432, capturetypes.TCP), "postgres (/system.slice/postgresql.service)"},
+		{"IPv4 via dual-stack listener", testKey("10.0.0.2", "10.0.0.1", 53, capturetypes.UDP), "dnsmasq"},
+		{"IPv6 via dual-stack listener", testKey("fe80::2", "fe80::1", 53, capturetypes.UDP), "dnsmasq"},
+		{"no socket", testKey("10.0.0.1", "192.0.2.1", 443, capturetypes.TCP), ""},
+		{"protocol mismatch", testKey("192.0.2.1", "10.0.0.1", 22, capturetypes.UDP), ""},
+		{"no transport protocol", testKey("192.0.2.1", "10.0.0.1", 0, 1), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc, found := tracker.Lookup(test.key)
+			require.Equal(t, test.expected != "", found)
+			require.Equal(t, test.expected, proc.Label())
+		})
+	}
+
+	// sockets are remembered for the retention period after they were last seen
+	fs.sockets(t, "tcp", "0.0.0.0:22 0.0.0.0:0 100")
+	now = now.Add(30 * time.Second)
+	require.Nil(t, tracker.poll())
+	_, found := tracker.Lookup(testKey("127.0.0.1", "127.0.0.1", 5432, capturetypes.TCP))
+	require.True(t, found)
+
+	now = now.Add(time.Minute)
+	require.Nil(t, tracker.poll())
+	_, found = tracker.Lookup(testKey("127.0.0.1", "127.0.0.1", 5432, capturetypes.TCP))
+	require.False(t, found)
+	_, found = tracker.Lookup(testKey("192.0.2.1", "10.0.0.1", 22, capturetypes.TCP))
+	require.True(t, found)
+	require.Len(t, tracker.owners, 2) // sshd and dnsmasq (whose UDP socket remains open)
+}
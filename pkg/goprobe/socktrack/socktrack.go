@@ -0,0 +1,75 @@
+// Package socktrack attributes flows to the local processes owning their sockets. This allows flows
+// observed on host-internal interfaces (such as loopback or container bridges) to be labeled with the
+// process / service that generated them. The tracker provided here periodically polls the socket tables
+// exposed by the kernel via procfs and maps the sockets onto their owning processes (and cgroups). It is
+// only available on Linux and has to be enabled explicitly via the goprobe_socktrack build tag. Other
+// implementations (e.g. based on eBPF socket hooks) can be plugged in via the Tracker interface
+package socktrack
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+const (
+	// DefaultPollInterval denotes the default interval in which the sockets are polled
+	DefaultPollInterval = time.Second
+
+	// DefaultRetention denotes the default duration sockets (and their owners) are remembered after
+	// they were last seen, allowing flows of short-lived connections to be attributed upon writeout
+	DefaultRetention = 10 * time.Minute
+)
+
+// ErrUnsupported denotes that socket tracking is not available in this build / on this platform
+var ErrUnsupported = errors.New("socket tracking not supported (requires Linux and the goprobe_socktrack build tag)")
+
+// Process denotes a local process owning a socket
+type Process struct {
+	PID    int
+	Comm   string
+	Cgroup string
+}
+
+// Label returns the label of the process, consisting of its name and (unless it runs in the root
+// cgroup) its cgroup. The PID is omitted since it is neither stable nor meaningful in queries
+func (p Process) Label() string {
+	if p.Cgroup == "" || p.Cgroup == "/" {
+		return p.Comm
+	}
+	return p.Comm + " (" + p.Cgroup + ")"
+}
+
+// Tracker tracks the sockets of all local processes
+type Tracker interface {
+
+	// Run tracks the sockets until the context is cancelled
+	Run(ctx context.Context)
+
+	// Lookup returns the process owning the local socket of a flow (indicating if the flow could
+	// be attributed via the second result parameter)
+	Lookup(key types.Key) (Process, bool)
+}
+
+// Option denotes a functional option for a tracker
+type Option func(*procFS)
+
+// WithPollInterval sets the interval in which the sockets are polled
+func WithPollInterval(interval time.Duration) Option {
+	return func(p *procFS) {
+		if interval > 0 {
+			p.pollInterval = interval
+		}
+	}
+}
+
+// WithRetention sets the duration sockets are remembered after they were last seen
+func WithRetention(retention time.Duration) Option {
+	return func(p *procFS) {
+		if retention > 0 {
+			p.retention = retention
+		}
+	}
+}
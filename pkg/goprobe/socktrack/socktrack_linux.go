@@ -0,0 +1,10 @@
+//go:build linux && goprobe_socktrack
+
+package socktrack
+
+const procRoot = "/proc"
+
+// New instantiates a new tracker polling the sockets of all local processes via procfs
+func New(opts ...Option) (Tracker, error) {
+	return newProcFS(procRoot, opts...), nil
+}
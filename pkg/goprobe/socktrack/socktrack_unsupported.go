@@ -0,0 +1,8 @@
+//go:build !linux || !goprobe_socktrack
+
+package socktrack
+
+// New returns ErrUnsupported, since socket tracking is not available in this build / on this platform
+func New(_ ...Option) (Tracker, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,422 @@
+// Package upgrade implements zero-downtime binary upgrades of goProbe.
+//
+// An upgrade re-executes the (new) goProbe binary, which is connected to the running process
+// via a UNIX socket pair inherited on startup. It proceeds as follows:
+//
+//  1. The new process loads its configuration and signals that it is ready to take over
+//  2. The running process hands over the API listener (via SCM_RIGHTS)
+//  3. The new process starts its captures and signals that it is capturing
+//  4. The running process stops its captures and hands over all flows captured since the last
+//     writeout, which the new process replays during its first writeout
+//  5. The new process signals that it has taken over and the running process terminates
+//
+// The running process keeps capturing until the captures of the new process are running, so
+// upgrades cause neither a gap nor a partially captured writeout interval in the goDB. If the
+// new process fails before it is capturing, the running process simply continues as before.
+//
+// Note that the capture sockets themselves are re-opened by the new process (the capture
+// library does not support adopting existing sockets). Packets arriving between the start of
+// the captures of the new process and the stop of the ones of the running process (usually a
+// matter of milliseconds) are hence accounted for by both processes.
+package upgrade
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// EnvFD denotes the environment variable used to pass the file descriptor of the new process'
+	// end of the socket pair
+	EnvFD = "GOPROBE_UPGRADE_FD"
+
+	// DefaultTimeout denotes the default maximum duration of each step of an upgrade
+	DefaultTimeout = 30 * time.Second
+
+	// the inherited socket is the first (and only) extra file of the new process
+	inheritedFD = 3
+)
+
+type messageType uint8
+
+const (
+	msgReady messageType = iota + 1
+	msgCapturing
+	msgDone
+	msgFailed
+)
+
+// message is sent by the new process to report on the progress of the upgrade
+type message struct {
+	Type  messageType
+	Error string
+}
+
+// flowMap is the wire representation of a flow map tagged with its interface and stats, along with
+// the attributes recorded for its flows (labels and TCP flags)
+type flowMap struct {
+	Iface      string
+	Stats      capturetypes.CaptureStats
+	Primary    hashmap.KeyVals
+	Secondary  hashmap.KeyVals
+	Attributes capturetypes.FlowAttributes
+}
+
+// handover is the wire representation of the flows handed over to the new process
+type handover struct {
+	Flows []flowMap
+}
+
+// Upgrader denotes the running process' end of an upgrade
+type Upgrader struct {
+	cmd      *exec.Cmd
+	conn     *net.UnixConn
+	dec      *gob.Decoder
+	timeout  time.Duration
+	listener net.Listener
+}
+
+// Start starts the new process by executing the binary at path with the provided arguments and
+// waits until it is ready to take over. If the new process fails to become ready within the
+// timeout, it is killed
+func Start(path string, args []string, timeout time.Duration) (*Upgrader, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket pair: %w", err)
+	}
+	unix.CloseOnExec(fds[0])
+	unix.CloseOnExec(fds[1])
+
+	parentFile, childFile := os.NewFile(uintptr(fds[0]), "upgrade-parent"), os.NewFile(uintptr(fds[1]), "upgrade-child")
+	defer childFile.Close()
+
+	conn, err := fileConn(parentFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G204
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), EnvFD+"="+strconv.Itoa(inheritedFD))
+	cmd.ExtraFiles = []*os.File{childFile}
+	if err := cmd.Start(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	u := newUpgrader(conn, timeout)
+	u.cmd = cmd
+	if err := u.receive(msgReady); err != nil {
+		u.Abort()
+		return nil, fmt.Errorf("new process failed to become ready: %w", err)
+	}
+
+	return u, nil
+}
+
+func newUpgrader(conn *net.UnixConn, timeout time.Duration) *Upgrader {
+	return &Upgrader{
+		conn:    conn,
+		dec:     gob.NewDecoder(conn),
+		timeout: timeout,
+	}
+}
+
+// HandoverListener hands the API listener (may be nil) over to the new process and waits until
+// it has started its captures. The running process keeps capturing in the meantime. If an error
+// is returned, the upgrade must be aborted (the running process continues as before)
+func (u *Upgrader) HandoverListener(listener net.Listener) error {
+	if err := u.conn.SetDeadline(time.Now().Add(u.timeout)); err != nil {
+		return err
+	}
+
+	// The listener is passed out-of-band via SCM_RIGHTS, prefixed by a flag indicating its presence
+	var (
+		hasListener byte
+		rights      []byte
+	)
+	if listener != nil {
+		f, err := listenerFile(listener)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		hasListener, rights = 1, unix.UnixRights(int(f.Fd()))
+	}
+	if _, _, err := u.conn.WriteMsgUnix([]byte{hasListener}, rights, nil); err != nil {
+		return fmt.Errorf("failed to hand over listener: %w", err)
+	}
+
+	if err := u.receive(msgCapturing); err != nil {
+		return fmt.Errorf("new process failed to start capturing: %w", err)
+	}
+	u.listener = listener
+
+	return nil
+}
+
+// HandoverFlows hands the flows captured since the last writeout (i.e. after stopping all captures)
+// over to the new process and waits until it has taken over. Once this method returns without error,
+// the running process must no longer capture or write to the goDB and should terminate (after shutting
+// down its API server)
+func (u *Upgrader) HandoverFlows(flows []capturetypes.TaggedAggFlowMap) error {
+	if err := u.conn.SetDeadline(time.Now().Add(u.timeout)); err != nil {
+		return err
+	}
+
+	state := handover{Flows: make([]flowMap, 0, len(flows))}
+	for _, flow := range flows {
+		state.Flows = append(state.Flows, toWire(flow))
+	}
+	if err := gob.NewEncoder(u.conn).Encode(state); err != nil {
+		return fmt.Errorf("failed to hand over flows: %w", err)
+	}
+
+	if err := u.receive(msgDone); err != nil {
+		return fmt.Errorf("new process failed to take over: %w", err)
+	}
+
+	// The UNIX socket file (if any) is now in use by the new process and must not be removed
+	// when the listener is closed during shutdown
+	if unixListener, ok := u.listener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+
+	if u.cmd != nil {
+		if err := u.cmd.Process.Release(); err != nil {
+			return err
+		}
+	}
+	return u.conn.Close()
+}
+
+// Abort terminates the new process (if still running)
+func (u *Upgrader) Abort() {
+	_ = u.conn.Close()
+	if u.cmd != nil {
+		_ = u.cmd.Process.Kill()
+		_ = u.cmd.Wait()
+	}
+}
+
+func (u *Upgrader) receive(expected messageType) error {
+	if err := u.conn.SetDeadline(time.Now().Add(u.timeout)); err != nil {
+		return err
+	}
+
+	var msg message
+	if err := u.dec.Decode(&msg); err != nil {
+		return err
+	}
+	switch msg.Type {
+	case expected:
+		return nil
+	case msgFailed:
+		return errors.New(msg.Error)
+	}
+	return fmt.Errorf("unexpected message type %d", msg.Type)
+}
+
+// Child denotes the new process' end of an upgrade
+type Child struct {
+	conn    *net.UnixConn
+	enc     *gob.Encoder
+	timeout time.Duration
+}
+
+// Inherited returns the new process' end of an upgrade if the process was started by Start (or
+// nil if it wasn't)
+func Inherited(timeout time.Duration) (*Child, error) {
+	fdStr, isSet := os.LookupEnv(EnvFD)
+	if !isSet {
+		return nil, nil
+	}
+
+	// Ensure that the file descriptor isn't mistakenly picked up by any subsequent upgrade
+	if err := os.Unsetenv(EnvFD); err != nil {
+		return nil, err
+	}
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upgrade file descriptor %q: %w", fdStr, err)
+	}
+	conn, err := fileConn(os.NewFile(uintptr(fd), "upgrade-child"))
+	if err != nil {
+		return nil, err
+	}
+
+	return newChild(conn, timeout), nil
+}
+
+func newChild(conn *net.UnixConn, timeout time.Duration) *Child {
+	return &Child{
+		conn:    conn,
+		enc:     gob.NewEncoder(conn),
+		timeout: timeout,
+	}
+}
+
+// Ready signals the running process that the new process is ready to take over and returns the
+// API listener handed over by it (nil if the running process doesn't serve an API)
+func (c *Child) Ready() (net.Listener, error) {
+	if err := c.send(message{Type: msgReady}); err != nil {
+		return nil, err
+	}
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	var (
+		hasListener = make([]byte, 1)
+		oob         = make([]byte, unix.CmsgSpace(4))
+	)
+	_, oobn, _, _, err := c.conn.ReadMsgUnix(hasListener, oob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive listener: %w", err)
+	}
+	if hasListener[0] != 1 {
+		return nil, nil
+	}
+	return parseListener(oob[:oobn])
+}
+
+// Capturing signals the running process that the captures of the new process are running and
+// returns the flows captured by the running process since the last writeout (once it has stopped
+// its captures)
+func (c *Child) Capturing() ([]capturetypes.TaggedAggFlowMap, error) {
+	if err := c.send(message{Type: msgCapturing}); err != nil {
+		return nil, err
+	}
+
+	// The handover may take a while since the running process has to stop its captures first
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	var state handover
+	if err := gob.NewDecoder(c.conn).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to receive flows: %w", err)
+	}
+	flows := make([]capturetypes.TaggedAggFlowMap, 0, len(state.Flows))
+	for _, flow := range state.Flows {
+		flows = append(flows, fromWire(flow))
+	}
+
+	return flows, nil
+}
+
+// Done signals the running process that the new process has taken over (or failed to do so, in
+// which case the running process continues to run)
+func (c *Child) Done(takeoverErr error) error {
+	msg := message{Type: msgDone}
+	if takeoverErr != nil {
+		msg = message{Type: msgFailed, Error: takeoverErr.Error()}
+	}
+	if err := c.send(msg); err != nil {
+		_ = c.conn.Close()
+		return err
+	}
+	return c.conn.Close()
+}
+
+func (c *Child) send(msg message) error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	return c.enc.Encode(msg)
+}
+
+func fileConn(f *os.File) (*net.UnixConn, error) {
+	defer f.Close()
+
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upgrade connection: %w", err)
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected upgrade connection type %T", conn)
+	}
+	return unixConn, nil
+}
+
+func listenerFile(listener net.Listener) (*os.File, error) {
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("cannot hand over listener of type %T", listener)
+	}
+	return filer.File()
+}
+
+func parseListener(oob []byte) (net.Listener, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse socket control message: %w", err)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("unexpected number of socket control messages: %d", len(msgs))
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse listener file descriptor: %w", err)
+	}
+	if len(fds) != 1 {
+		return nil, fmt.Errorf("unexpected number of listener file descriptors: %d", len(fds))
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "listener")
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+func toWire(flow capturetypes.TaggedAggFlowMap) flowMap {
+	wire := flowMap{
+		Iface:      flow.Iface,
+		Stats:      flow.Stats,
+		Attributes: flow.Attributes,
+	}
+	if flow.Map == nil {
+		return wire
+	}
+	for it := flow.Map.PrimaryMap.Iter(); it.Next(); {
+		wire.Primary = append(wire.Primary, hashmap.KeyVal{Key: it.Key(), Val: it.Val()})
+	}
+	for it := flow.Map.SecondaryMap.Iter(); it.Next(); {
+		wire.Secondary = append(wire.Secondary, hashmap.KeyVal{Key: it.Key(), Val: it.Val()})
+	}
+	return wire
+}
+
+func fromWire(wire flowMap) capturetypes.TaggedAggFlowMap {
+	m := &hashmap.AggFlowMap{
+		PrimaryMap:   hashmap.New(len(wire.Primary)),
+		SecondaryMap: hashmap.New(len(wire.Secondary)),
+	}
+	for _, kv := range wire.Primary {
+		m.PrimaryMap.Set(kv.Key, kv.Val)
+	}
+	for _, kv := range wire.Secondary {
+		m.SecondaryMap.Set(kv.Key, kv.Val)
+	}
+	return capturetypes.TaggedAggFlowMap{
+		Map:        m,
+		Stats:      wire.Stats,
+		Iface:      wire.Iface,
+		Attributes: wire.Attributes,
+	}
+}
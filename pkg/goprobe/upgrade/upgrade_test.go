@@ -0,0 +1,156 @@
+package upgrade
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const testTimeout = 5 * time.Second
+
+func testPair(t *testing.T) (*Upgrader, *Child) {
+	t.Helper()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	require.Nil(t, err)
+
+	parentConn, err := fileConn(os.NewFile(uintptr(fds[0]), "upgrade-parent"))
+	require.Nil(t, err)
+	childConn, err := fileConn(os.NewFile(uintptr(fds[1]), "upgrade-child"))
+	require.Nil(t, err)
+
+	return newUpgrader(parentConn, testTimeout), newChild(childConn, testTimeout)
+}
+
+func testFlows() []capturetypes.TaggedAggFlowMap {
+	keyV4 := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 1, 1}, []byte{0, 80}, 6)
+	m := hashmap.NewAggFlowMap()
+	m.PrimaryMap.Set(keyV4, types.Counters{BytesRcvd: 300, PacketsRcvd: 3})
+	m.SecondaryMap.Set(types.NewV6KeyStatic([16]byte{0x20, 0x01, 15: 1}, [16]byte{0x20, 0x01, 15: 2}, []byte{1, 187}, 17),
+		types.Counters{BytesSent: 200, PacketsSent: 2})
+
+	return []capturetypes.TaggedAggFlowMap{
+		{
+			Map:   m,
+			Stats: capturetypes.CaptureStats{Received: 5, Processed: 5},
+			Iface: "eth0",
+			Attributes: capturetypes.FlowAttributes{
+				Labeled: capturetypes.LabeledFlows{string(keyV4): {{
+					FlowLabels: capturetypes.FlowLabels{VLAN: 100, DSCP: 46},
+					Counters:   types.Counters{BytesRcvd: 200, PacketsRcvd: 2},
+					TCPFlags:   types.TCPFlagSYN | types.TCPFlagACK,
+				}}},
+				TCPFlags: capturetypes.TCPFlags{string(keyV4): types.TCPFlagACK},
+			},
+		},
+	}
+}
+
+func TestHandover(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	upgrader, child := testPair(t)
+	flows := testFlows()
+
+	var (
+		listenerChan = make(chan net.Listener, 1)
+		flowsChan    = make(chan []capturetypes.TaggedAggFlowMap, 1)
+		capturing    = make(chan struct{})
+	)
+	go func() {
+		defer close(flowsChan)
+
+		l, err := child.Ready()
+		if err != nil {
+			_ = child.Done(err)
+			return
+		}
+		listenerChan <- l
+
+		// the captures of the new process are started here
+		close(capturing)
+		flows, err := child.Capturing()
+		if err != nil {
+			_ = child.Done(err)
+			return
+		}
+		flowsChan <- flows
+		_ = child.Done(nil)
+	}()
+
+	require.Nil(t, upgrader.receive(msgReady))
+	require.Nil(t, upgrader.HandoverListener(listener))
+
+	// the running process only stops capturing once the new process is capturing
+	select {
+	case <-capturing:
+	default:
+		t.Fatal("listener handover completed before the new process started capturing")
+	}
+	require.Nil(t, upgrader.HandoverFlows(flows))
+
+	inherited := <-listenerChan
+	require.NotNil(t, inherited)
+	defer inherited.Close()
+
+	// the inherited listener accepts connections to the original address
+	require.Equal(t, listener.Addr().String(), inherited.Addr().String())
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			_, _ = conn.Write([]byte("ping"))
+			_ = conn.Close()
+		}
+	}()
+	conn, err := inherited.Accept()
+	require.Nil(t, err)
+	data, err := io.ReadAll(conn)
+	require.Nil(t, err)
+	require.Equal(t, "ping", string(data))
+	require.Nil(t, conn.Close())
+
+	// the flows are handed over unchanged
+	handedOver := <-flowsChan
+	require.Len(t, handedOver, 1)
+	require.Equal(t, flows[0].Iface, handedOver[0].Iface)
+	require.Equal(t, flows[0].Stats, handedOver[0].Stats)
+	require.Equal(t, flows[0].Attributes, handedOver[0].Attributes)
+	for _, m := range []struct{ expected, actual *hashmap.Map }{
+		{flows[0].Map.PrimaryMap, handedOver[0].Map.PrimaryMap},
+		{flows[0].Map.SecondaryMap, handedOver[0].Map.SecondaryMap},
+	} {
+		require.Equal(t, m.expected.Len(), m.actual.Len())
+		for it := m.expected.Iter(); it.Next(); {
+			val, exists := m.actual.Get(it.Key())
+			require.True(t, exists)
+			require.Equal(t, it.Val(), val)
+		}
+	}
+}
+
+func TestHandoverFailed(t *testing.T) {
+	upgrader, child := testPair(t)
+
+	// a new process failing to start its captures fails the upgrade before the running process
+	// has to stop its own ones
+	go func() {
+		if _, err := child.Ready(); err != nil {
+			return
+		}
+		_ = child.Done(errors.New("failed to start captures"))
+	}()
+
+	require.Nil(t, upgrader.receive(msgReady))
+	require.ErrorContains(t, upgrader.HandoverListener(nil), "failed to start captures")
+}
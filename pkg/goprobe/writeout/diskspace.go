@@ -0,0 +1,68 @@
+package writeout
+
+import (
+	"context"
+	"slices"
+
+	"github.com/els0r/goProbe/pkg/goDB/retention"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+)
+
+// ensureDiskSpace makes sure that the writeout of an interface doesn't exhaust its storage, evicting
+// data right away (instead of in the background after the writeout) if required:
+//   - if the interface is subject to a storage quota which is exceeded according to the manifest,
+//     the quota is enforced
+//   - if the free space of the file system holding the GoDB falls short of the minimum, the oldest
+//     data of all interfaces is evicted
+//
+// It returns false if the writeout has to be skipped since the free space still falls short. Must be
+// called with the handler lock held
+func (h *GoDBHandler) ensureDiskSpace(ctx context.Context, iface string) bool {
+	logger := logs.FromContext(ctx, logs.ModuleWriteout)
+
+	evicted := evictions{logger: logger}
+	defer func() {
+		h.rebuildManifest(logger, evicted.ifaces)
+	}()
+
+	// the manifest tracks the size of each interface, avoiding to walk the GoDB for the check
+	if h.manifest != nil {
+		for _, quota := range h.quotas {
+			if !slices.Contains(quota.Ifaces, iface) || h.manifest.IfacesSize(quota.Ifaces...) <= uint64(quota.MaxBytes) {
+				continue
+			}
+			stats, err := retention.Enforce(h.path, quota)
+			evicted.record(evictionReasonQuota, stats, err)
+		}
+	}
+
+	if h.minFreeSpace == 0 {
+		return true
+	}
+	free, err := h.freeSpace(h.path)
+	if err != nil {
+		// writeouts are not prevented if the free space cannot be determined (e.g. since the GoDB
+		// hasn't been created yet)
+		logger.Warnf("failed to check free disk space: %v", err)
+		return true
+	}
+	freeDiskSpace.Set(float64(free))
+	if free >= h.minFreeSpace {
+		return true
+	}
+
+	logger.With("free", free, "min_free", h.minFreeSpace).Warn("free disk space below minimum, evicting oldest data")
+	stats, err := retention.EnforceMinFree(h.path, h.minFreeSpace)
+	evicted.record(evictionReasonMinFree, stats, err)
+
+	if free, err = h.freeSpace(h.path); err == nil {
+		freeDiskSpace.Set(float64(free))
+		if free >= h.minFreeSpace {
+			return true
+		}
+	}
+
+	writeoutsSkipped.WithLabelValues(iface).Inc()
+	logger.With("free", free, "min_free", h.minFreeSpace).Error("skipping writeout, insufficient free disk space")
+	return false
+}
@@ -0,0 +1,88 @@
+package writeout
+
+import (
+	"sync"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+
+	// flowSizeBucketStep denotes the step between the (log2-scale) flow size buckets exposed as metrics,
+	// i.e. every second bucket is exposed (powers of four), bounding the cardinality of the metrics
+	flowSizeBucketStep = 2
+
+	// flowSizeMaxBucket denotes the largest flow size bucket exposed as metrics (2^40, i.e. 1 TiB / 1 Ti
+	// packets per flow and writeout). Larger flows are only accounted for by the +Inf bucket
+	flowSizeMaxBucket = 40
+)
+
+// flowSizesCollector exposes the histograms of the bytes and packets per flow written to the DB,
+// accumulated across all writeouts of each interface (each flow being accounted for once per writeout
+// it is active in)
+type flowSizesCollector struct {
+	bytesDesc, packetsDesc *prometheus.Desc
+
+	sizes map[string]gpfile.FlowSizes
+	sync.Mutex
+}
+
+var flowSizeHistograms = newFlowSizesCollector()
+
+func newFlowSizesCollector() *flowSizesCollector {
+	return &flowSizesCollector{
+		bytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(config.ServiceName, writeoutSubsystem, "flow_size_bytes"),
+			"Bytes (received and sent) per flow and writeout written to DB",
+			[]string{"iface"}, nil,
+		),
+		packetsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(config.ServiceName, writeoutSubsystem, "flow_size_packets"),
+			"Packets (received and sent) per flow and writeout written to DB",
+			[]string{"iface"}, nil,
+		),
+		sizes: make(map[string]gpfile.FlowSizes),
+	}
+}
+
+// observe adds the flow size histograms of a writeout of the interface
+func (f *flowSizesCollector) observe(iface string, sizes gpfile.FlowSizes) {
+	f.Lock()
+	defer f.Unlock()
+
+	accumulated := f.sizes[iface]
+	accumulated.Add(sizes)
+	f.sizes[iface] = accumulated
+}
+
+// Describe implements prometheus.Collector
+func (f *flowSizesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.bytesDesc
+	ch <- f.packetsDesc
+}
+
+// Collect implements prometheus.Collector
+func (f *flowSizesCollector) Collect(ch chan<- prometheus.Metric) {
+	f.Lock()
+	defer f.Unlock()
+
+	for iface, sizes := range f.sizes {
+		ch <- constFlowSizeHistogram(f.bytesDesc, sizes.Bytes, iface)
+		ch <- constFlowSizeHistogram(f.packetsDesc, sizes.Packets, iface)
+	}
+}
+
+func constFlowSizeHistogram(desc *prometheus.Desc, h gpfile.FlowSizeHistogram, iface string) prometheus.Metric {
+	buckets := make(map[float64]uint64, flowSizeMaxBucket/flowSizeBucketStep+1)
+
+	var cumulative uint64
+	for i := 0; i <= flowSizeMaxBucket; i++ {
+		cumulative += h.Buckets[i]
+		if i%flowSizeBucketStep == 0 {
+			buckets[float64(gpfile.FlowSizeBucketBound(i))] = cumulative
+		}
+	}
+	return prometheus.MustNewConstHistogram(desc, h.Count(), float64(h.Sum), buckets, iface)
+}
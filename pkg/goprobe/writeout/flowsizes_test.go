@@ -0,0 +1,49 @@
+package writeout
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowSizeHistograms(t *testing.T) {
+	c := newFlowSizesCollector()
+
+	// the histograms accumulate across writeouts
+	for _, packets := range [][]uint64{{1, 3}, {4, 5, 1 << 41}} {
+		var sizes gpfile.FlowSizes
+		for _, n := range packets {
+			sizes.Observe(types.Counters{BytesRcvd: 100 * n, PacketsRcvd: n})
+		}
+		c.observe("eth0", sizes)
+	}
+
+	expected := new(strings.Builder)
+	expected.WriteString(`
+# HELP goprobe_godb_handler_flow_size_packets Packets (received and sent) per flow and writeout written to DB
+# TYPE goprobe_godb_handler_flow_size_packets histogram
+`)
+	for i := 0; i <= flowSizeMaxBucket; i += flowSizeBucketStep {
+		var cumulative int
+		switch {
+		case i == 0:
+			cumulative = 1
+		case i == 2:
+			cumulative = 3
+		default:
+			cumulative = 4
+		}
+		fmt.Fprintf(expected, "goprobe_godb_handler_flow_size_packets_bucket{iface=\"eth0\",le=\"%g\"} %d\n", float64(gpfile.FlowSizeBucketBound(i)), cumulative)
+	}
+	fmt.Fprintf(expected, "goprobe_godb_handler_flow_size_packets_bucket{iface=\"eth0\",le=\"+Inf\"} 5\n")
+	fmt.Fprintf(expected, "goprobe_godb_handler_flow_size_packets_sum{iface=\"eth0\"} %g\n", float64(1+3+4+5+1<<41))
+	fmt.Fprintf(expected, "goprobe_godb_handler_flow_size_packets_count{iface=\"eth0\"} 5\n")
+
+	require.Nil(t, testutil.CollectAndCompare(c, strings.NewReader(expected.String()), "goprobe_godb_handler_flow_size_packets"))
+	require.Equal(t, 2, testutil.CollectAndCount(c))
+}
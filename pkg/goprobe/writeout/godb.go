@@ -4,34 +4,113 @@ import (
 	"context"
 	"io/fs"
 	"log/slog"
+	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/export/netflow"
 	"github.com/els0r/goProbe/pkg/goDB"
+	"github.com/els0r/goProbe/pkg/goDB/conditions/node"
 	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/retention"
+	"github.com/els0r/goProbe/pkg/goDB/storage/gpfile"
+	"github.com/els0r/goProbe/pkg/goprobe/logs"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
 	"github.com/els0r/telemetry/logging"
 )
 
+// DefaultQuotaInterval denotes the default minimum interval between two enforcements of the
+// storage quotas / the retention policy
+const DefaultQuotaInterval = time.Hour
+
+// Reasons for the eviction of DB directories (as reported in metrics)
+const (
+	evictionReasonQuota   = "quota"
+	evictionReasonMaxAge  = "max_age"
+	evictionReasonMaxSize = "max_size"
+	evictionReasonMinFree = "min_free_space"
+)
+
 // GoDBHandler denotes a GoDB writeout handler
 type GoDBHandler struct {
-	encoderType encoders.Type
-	permissions fs.FileMode
+	encoderType      encoders.Type
+	encoderLevel     int
+	adaptiveEncoding *gpfile.AdaptiveEncoding
+	blockFrames      bool
+	permissions      fs.FileMode
 
 	path        string
 	dbWriters   map[string]*goDB.DBWriter
 	logToSyslog bool
+	manifest    *info.Manifest
+	quotas      []retention.Quota
+
+	// retention policy applying to all interfaces (disabled if zero)
+	maxAge  time.Duration
+	maxSize int64
+
+	// minimum free space of the file system holding the GoDB required for writeouts (disabled if
+	// zero), along with the function determining the free space
+	minFreeSpace uint64
+	freeSpace    func(path string) (uint64, error)
+
+	// quota / retention enforcement walks the whole GoDB, hence it is performed in the background
+	// and at most once per quotaInterval (tracked via the writeout timestamp of the last enforcement)
+	quotaInterval      time.Duration
+	lastQuotaTimestamp time.Time
+	enforcingQuotas    atomic.Bool
+
+	// optional per-sink filters restricting the flows written to the GoDB / syslog
+	filter       *node.FlowFilter
+	syslogFilter *node.FlowFilter
+
+	// optional flow tagger, classifying the flows written to the GoDB
+	tagger *node.Tagger
+
+	// flow tags marking decapsulated flows (registered upon the first writeout containing any)
+	decapTags *goDB.DecapsulationTags
+
+	// optional process attribution, labeling the flows written to the GoDB with their local process
+	processes *ProcessAttribution
+
+	// optional top talker tracker, exposing the largest flows of each writeout as metrics
+	topTalkers *TopTalkers
+
+	// optional NetFlow / IPFIX exporter (along with its filter), sending the flows of each writeout
+	// to a collector
+	netflowExporter *netflow.Exporter
+	netflowFilter   *node.FlowFilter
+
+	// optional metadata cache, kept up to date with the metadata of the directories written to
+	metadataCache *goDB.MetadataCache
+
+	// origin (i.e. this host) stamped on all directories written to
+	origin gpfile.Origin
+
+	// byte accounting basis of the interfaces, recorded in all directories written to
+	accounting info.ByteAccounting
 
 	sync.Mutex
 }
 
 // NewGoDBHandler instantiates a new GoDB handler
 func NewGoDBHandler(path string, encoderType encoders.Type) *GoDBHandler {
+	hostname, _ := os.Hostname()
 	return &GoDBHandler{
-		path:        path,
-		dbWriters:   make(map[string]*goDB.DBWriter),
-		encoderType: encoderType,
-		permissions: goDB.DefaultPermissions,
+		path:          path,
+		dbWriters:     make(map[string]*goDB.DBWriter),
+		encoderType:   encoderType,
+		permissions:   goDB.DefaultPermissions,
+		quotaInterval: DefaultQuotaInterval,
+		freeSpace:     retention.FreeSpace,
+		origin: gpfile.Origin{
+			Hostname: hostname,
+			HostID:   info.GetHostID(path),
+		},
 	}
 }
 
@@ -41,19 +120,164 @@ func (h *GoDBHandler) WithSyslogWriting(b bool) *GoDBHandler {
 	return h
 }
 
+// WithEncoderLevel sets the compression level of the encoder (0 selects the encoder's default level)
+func (h *GoDBHandler) WithEncoderLevel(level int) *GoDBHandler {
+	h.encoderLevel = level
+	return h
+}
+
+// WithAdaptiveEncoding enables the per-block selection of the encoder (disabled if nil)
+func (h *GoDBHandler) WithAdaptiveEncoding(adaptiveEncoding *gpfile.AdaptiveEncoding) *GoDBHandler {
+	h.adaptiveEncoding = adaptiveEncoding
+	return h
+}
+
+// WithBlockFrames enables / disables preceding each block written with a frame header (allowing to rebuild
+// the metadata of a directory from its column files)
+func (h *GoDBHandler) WithBlockFrames(enabled bool) *GoDBHandler {
+	h.blockFrames = enabled
+	return h
+}
+
 // WithPermissions sets explicit permissions for the underlying GoDB
 func (h *GoDBHandler) WithPermissions(permissions fs.FileMode) *GoDBHandler {
 	h.permissions = permissions
 	return h
 }
 
+// WithManifest enables / disables maintenance of the DB manifest at the root of the GoDB
+func (h *GoDBHandler) WithManifest(b bool) *GoDBHandler {
+	if !b {
+		h.manifest = nil
+		return h
+	}
+
+	manifest, err := info.ReadOrBuildManifest(h.path)
+	if err != nil {
+		logs.Logger(logs.ModuleWriteout).Warnf("failed to read existing manifest, starting from scratch: %v", err)
+		manifest = info.NewManifest()
+	}
+	if err := manifest.CheckFormatVersion(); err != nil {
+		logs.Logger(logs.ModuleWriteout).Errorf("writes to directories in an unsupported format will fail: %v", err)
+	}
+	h.manifest = manifest
+	return h
+}
+
+// WithQuotas sets storage quotas for (groups of) interfaces, which are enforced in the background
+// after a writeout (at most once per quota interval)
+func (h *GoDBHandler) WithQuotas(quotas ...retention.Quota) *GoDBHandler {
+	h.quotas = quotas
+	return h
+}
+
+// WithRetention sets a retention policy applying to all interfaces, evicting data older than maxAge
+// and / or the oldest data once the GoDB exceeds maxSize bytes (each disabled if zero). Like quotas,
+// it is enforced in the background after a writeout (at most once per quota interval)
+func (h *GoDBHandler) WithRetention(maxAge time.Duration, maxSize int64) *GoDBHandler {
+	h.maxAge = maxAge
+	h.maxSize = maxSize
+	return h
+}
+
+// WithMinFreeSpace sets the minimum free space (in bytes) of the file system holding the GoDB. If it
+// falls short before a writeout, the oldest data of all interfaces is evicted right away. If the free
+// space still falls short, the writeout is skipped instead of filling up the file system (disabled
+// if zero)
+func (h *GoDBHandler) WithMinFreeSpace(minFreeSpace uint64) *GoDBHandler {
+	h.minFreeSpace = minFreeSpace
+	return h
+}
+
+// WithQuotaInterval sets the minimum interval between two enforcements of the storage quotas /
+// the retention policy (the default interval is retained if zero)
+func (h *GoDBHandler) WithQuotaInterval(interval time.Duration) *GoDBHandler {
+	if interval > 0 {
+		h.quotaInterval = interval
+	}
+	return h
+}
+
+// WithFilter restricts the flows written to the GoDB to those satisfying the filter (nil disables filtering).
+// Note that the capture stats (e.g. the number of packets received / dropped) remain unaffected
+func (h *GoDBHandler) WithFilter(filter *node.FlowFilter) *GoDBHandler {
+	h.filter = filter
+	return h
+}
+
+// WithSyslogFilter restricts the flows written to syslog to those satisfying the filter (nil disables filtering)
+func (h *GoDBHandler) WithSyslogFilter(filter *node.FlowFilter) *GoDBHandler {
+	h.syslogFilter = filter
+	return h
+}
+
+// WithTagger sets a flow tagger whose tags are stored alongside the flows written to the GoDB (nil disables
+// tagging)
+func (h *GoDBHandler) WithTagger(tagger *node.Tagger) *GoDBHandler {
+	h.tagger = tagger
+	return h
+}
+
+// WithMetadataCache sets a metadata cache (e.g. used by the query API), which is updated with the
+// metadata of the directories written to on each writeout (nil disables updates)
+func (h *GoDBHandler) WithMetadataCache(cache *goDB.MetadataCache) *GoDBHandler {
+	h.metadataCache = cache
+	return h
+}
+
+// WithProcessAttribution sets a process attribution whose process labels are stored alongside the flows
+// of the respective interfaces written to the GoDB (nil disables the attribution)
+func (h *GoDBHandler) WithProcessAttribution(processes *ProcessAttribution) *GoDBHandler {
+	h.processes = processes
+	return h
+}
+
+// WithTopTalkers sets a tracker exposing the largest flows of each interface as metrics upon writeout (nil
+// disables tracking). The top talkers are determined irrespective of the database filter
+func (h *GoDBHandler) WithTopTalkers(topTalkers *TopTalkers) *GoDBHandler {
+	h.topTalkers = topTalkers
+	return h
+}
+
+// WithNetFlowExporter sets an exporter sending the flows of each writeout as NetFlow v9 / IPFIX records to
+// a collector (nil disables the export)
+func (h *GoDBHandler) WithNetFlowExporter(exporter *netflow.Exporter) *GoDBHandler {
+	h.netflowExporter = exporter
+	return h
+}
+
+// WithNetFlowFilter restricts the flows exported to the NetFlow / IPFIX collector to those satisfying the
+// filter (nil disables filtering)
+func (h *GoDBHandler) WithNetFlowFilter(filter *node.FlowFilter) *GoDBHandler {
+	h.netflowFilter = filter
+	return h
+}
+
+// WriteZones stores the network zones of the interfaces at the root of the GoDB, making them available
+// to queries
+func (h *GoDBHandler) WriteZones(zones info.Zones) error {
+	return zones.Write(h.path, h.permissions)
+}
+
+// SetByteAccounting sets the byte accounting basis of the interfaces, which is recorded in each directory
+// written to subsequently (making it available to queries over the data)
+func (h *GoDBHandler) SetByteAccounting(accounting info.ByteAccounting) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.accounting = accounting
+	for iface, w := range h.dbWriters {
+		w.ByteAccounting(accounting[iface])
+	}
+}
+
 // HandleWriteout provides access to writeouts to a GoDB via a channel
 func (h *GoDBHandler) HandleWriteout(ctx context.Context, timestamp time.Time, writeoutChan <-chan capturetypes.TaggedAggFlowMap) <-chan struct{} {
 
 	doneChan := make(chan struct{})
 	go func() {
 
-		logger := logging.FromContext(ctx)
+		logger := logs.FromContext(ctx, logs.ModuleWriteout)
 		t0 := time.Now()
 
 		var syslogWriter *goDB.SyslogDBWriter
@@ -82,6 +306,24 @@ func (h *GoDBHandler) HandleWriteout(ctx context.Context, timestamp time.Time, w
 		}
 		h.Unlock()
 
+		// drop the top talkers of interfaces which have not been written out in a while
+		if h.topTalkers != nil {
+			h.topTalkers.Expire(timestamp.Add(-2 * time.Duration(goDB.DBWriteInterval) * time.Second))
+		}
+
+		// evict the oldest data of all interfaces exceeding their quota / the retention policy
+		// (asynchronously, so the writeout isn't held up by walking the GoDB)
+		if (len(h.quotas) > 0 || h.maxAge > 0 || h.maxSize > 0) && len(seenIfaces) > 0 {
+			h.triggerQuotaEnforcement(ctx, timestamp)
+		}
+
+		// persist the manifest now that all interfaces have been written
+		if h.manifest != nil && len(seenIfaces) > 0 {
+			if err := h.manifest.Write(h.path, h.permissions); err != nil {
+				logger.Errorf("failed to write DB manifest: %v", err)
+			}
+		}
+
 		elapsed := time.Since(t0)
 		writeoutDuration.Observe(float64(elapsed) / float64(time.Second))
 
@@ -92,9 +334,86 @@ func (h *GoDBHandler) HandleWriteout(ctx context.Context, timestamp time.Time, w
 	return doneChan
 }
 
+// triggerQuotaEnforcement starts a background enforcement of the storage quotas / the retention
+// policy unless one is still running or the last one happened less than a quota interval before the writeout at timestamp
+func (h *GoDBHandler) triggerQuotaEnforcement(ctx context.Context, timestamp time.Time) {
+	if !h.enforcingQuotas.CompareAndSwap(false, true) {
+		return
+	}
+	if !h.lastQuotaTimestamp.IsZero() && timestamp.Sub(h.lastQuotaTimestamp) < h.quotaInterval {
+		h.enforcingQuotas.Store(false)
+		return
+	}
+	h.lastQuotaTimestamp = timestamp
+
+	go func() {
+		defer h.enforcingQuotas.Store(false)
+		h.enforceQuotas(ctx, timestamp)
+	}()
+}
+
+func (h *GoDBHandler) enforceQuotas(ctx context.Context, timestamp time.Time) {
+	logger := logs.FromContext(ctx, logs.ModuleWriteout)
+
+	evicted := evictions{logger: logger}
+	if h.maxAge > 0 {
+		stats, err := retention.EnforceMaxAge(h.path, h.maxAge, timestamp)
+		evicted.record(evictionReasonMaxAge, stats, err)
+	}
+	if h.maxSize > 0 {
+		stats, err := retention.EnforceMaxSize(h.path, h.maxSize)
+		evicted.record(evictionReasonMaxSize, stats, err)
+	}
+	if len(h.quotas) > 0 {
+		stats, err := retention.Enforce(h.path, h.quotas...)
+		evicted.record(evictionReasonQuota, stats, err)
+	}
+	h.rebuildManifest(logger, evicted.ifaces)
+}
+
+// rebuildManifest updates the manifest (if maintained) for all interfaces whose data has been evicted
+func (h *GoDBHandler) rebuildManifest(logger *logging.L, ifaces []string) {
+	if h.manifest == nil || len(ifaces) == 0 {
+		return
+	}
+	if err := h.manifest.Rebuild(h.path, ifaces...); err != nil {
+		logger.Errorf("failed to update DB manifest after eviction: %v", err)
+		return
+	}
+	if err := h.manifest.Write(h.path, h.permissions); err != nil {
+		logger.Errorf("failed to write DB manifest after eviction: %v", err)
+	}
+}
+
+// evictions collects the interfaces whose data has been evicted while enforcing (several) retention
+// limits, accounting for the evictions in the metrics
+type evictions struct {
+	logger *logging.L
+	ifaces []string
+}
+
+func (e *evictions) record(reason string, stats *retention.Stats, err error) {
+	if err != nil {
+		e.logger.With("reason", reason).Errorf("failed to enforce retention: %v", err)
+	}
+	if stats.Dirs == 0 {
+		return
+	}
+
+	evictedDirs.WithLabelValues(reason).Add(float64(stats.Dirs))
+	evictedBytes.WithLabelValues(reason).Add(float64(stats.Bytes))
+	e.logger.With("reason", reason, "ifaces", stats.Ifaces, "dirs", stats.Dirs, "bytes", stats.Bytes).Info("evicted data exceeding retention limit")
+
+	for _, iface := range stats.Ifaces {
+		if !slices.Contains(e.ifaces, iface) {
+			e.ifaces = append(e.ifaces, iface)
+		}
+	}
+}
+
 func (h *GoDBHandler) handleIfaceWriteout(ctx context.Context, timestamp time.Time, taggedMap capturetypes.TaggedAggFlowMap, syslogWriter *goDB.SyslogDBWriter) {
 	ctx = logging.WithFields(ctx, slog.String("iface", taggedMap.Iface))
-	logger := logging.FromContext(ctx)
+	logger := logs.FromContext(ctx, logs.ModuleWriteout)
 
 	// Ensure that there is a DBWriter for the given interface
 	h.Lock()
@@ -102,17 +421,53 @@ func (h *GoDBHandler) handleIfaceWriteout(ctx context.Context, timestamp time.Ti
 		w := goDB.NewDBWriter(h.path,
 			taggedMap.Iface,
 			h.encoderType,
-		).Permissions(h.permissions)
+		).EncoderLevel(h.encoderLevel).AdaptiveEncoding(h.adaptiveEncoding).BlockFrames(h.blockFrames).Permissions(h.permissions).Manifest(h.manifest).Tagger(h.tagger).MetadataCache(h.metadataCache).Origin(h.origin).ByteAccounting(h.accounting[taggedMap.Iface])
+		if h.processes != nil && h.processes.Enabled(taggedMap.Iface) {
+			w.ProcessAttributor(h.processes)
+		}
+		w.FlowSizesObserver(func(sizes gpfile.FlowSizes) {
+			flowSizeHistograms.observe(taggedMap.Iface, sizes)
+		})
 		h.dbWriters[taggedMap.Iface] = w
 	}
 
-	// Write to database, update summary
-	err := h.dbWriters[taggedMap.Iface].Write(taggedMap.Map, taggedMap.Stats, timestamp.Unix())
-	if err != nil {
-		logger.Errorf("failed to perform writeout: %s", err)
+	// Mark decapsulated flows (if any) with the flow tag of their encapsulation
+	if taggedMap.Attributes.Decapsulated() {
+		if err := h.registerDecapsulationTags(); err != nil {
+			logger.Errorf("failed to register decapsulation flow tags: %v", err)
+		} else {
+			h.dbWriters[taggedMap.Iface].DecapsulationTags(*h.decapTags)
+		}
+	}
+
+	// Write to database (unless there is insufficient disk space left), update summary
+	var err error
+	if h.ensureDiskSpace(ctx, taggedMap.Iface) {
+		err = h.dbWriters[taggedMap.Iface].WriteCaptured(applyFilter(h.filter, taggedMap.Map, sinkGoDB), taggedMap.Attributes, taggedMap.Stats, timestamp.Unix())
+		if err != nil {
+			logger.Errorf("failed to perform writeout: %s", err)
+		}
+	}
+
+	// persist the labels of all processes newly encountered during the writeout
+	if h.processes != nil {
+		if err := h.processes.Flush(h.path, h.permissions); err != nil {
+			logger.Errorf("failed to store process labels: %v", err)
+		}
 	}
 	h.Unlock()
 
+	if h.topTalkers != nil {
+		h.topTalkers.Update(taggedMap.Iface, taggedMap.Map, timestamp)
+	}
+
+	// export flows to the NetFlow / IPFIX collector if necessary
+	if h.netflowExporter != nil {
+		if err := h.netflowExporter.Export(taggedMap.Iface, applyFilter(h.netflowFilter, taggedMap.Map, sinkNetFlow), timestamp); err != nil {
+			logger.Errorf("failed to export flows to NetFlow collector: %v", err)
+		}
+	}
+
 	// write out flows to syslog if necessary
 	if h.logToSyslog {
 		if syslogWriter == nil {
@@ -125,6 +480,52 @@ func (h *GoDBHandler) handleIfaceWriteout(ctx context.Context, timestamp time.Ti
 			}
 		}
 
-		syslogWriter.Write(taggedMap.Map, taggedMap.Iface, timestamp.Unix())
+		syslogWriter.Write(applyFilter(h.syslogFilter, taggedMap.Map, sinkSyslog), taggedMap.Iface, timestamp.Unix())
 	}
 }
+
+// registerDecapsulationTags registers the flow tags marking decapsulated flows with the registry stored
+// in the GoDB (unless already done). Must be called with the handler lock held
+func (h *GoDBHandler) registerDecapsulationTags() error {
+	if h.decapTags != nil {
+		return nil
+	}
+
+	registry, err := info.ReadTagRegistry(h.path)
+	if err != nil {
+		return err
+	}
+
+	var decapTags goDB.DecapsulationTags
+	for encap := capturetypes.EncapGRE; encap < capturetypes.NumEncapsulations; encap++ {
+		bit, err := registry.Register(encap.Tag())
+		if err != nil {
+			return err
+		}
+		decapTags[encap] = 1 << bit
+	}
+	if err := registry.Write(h.path, h.permissions); err != nil {
+		return err
+	}
+
+	h.decapTags = &decapTags
+	return nil
+}
+
+const (
+	sinkGoDB    = "godb"
+	sinkSyslog  = "syslog"
+	sinkNetFlow = "netflow"
+)
+
+// applyFilter returns the flows of m satisfying the filter of the sink (or m itself if there is none)
+func applyFilter(filter *node.FlowFilter, m *hashmap.AggFlowMap, sink string) *hashmap.AggFlowMap {
+	if filter == nil || m == nil {
+		return m
+	}
+
+	filtered := filter.Filter(m)
+	numFiltered := m.PrimaryMap.Len() + m.SecondaryMap.Len() - filtered.PrimaryMap.Len() - filtered.SecondaryMap.Len()
+	flowsFiltered.WithLabelValues(sink).Add(float64(numFiltered))
+	return filtered
+}
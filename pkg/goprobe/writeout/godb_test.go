@@ -0,0 +1,170 @@
+package writeout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/encoder/encoders"
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goDB/retention"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaEnforcementThrottling(t *testing.T) {
+	h := NewGoDBHandler(t.TempDir(), encoders.EncoderTypeNull).
+		WithQuotas(retention.Quota{Ifaces: []string{"eth0"}, MaxBytes: 1}).
+		WithQuotaInterval(time.Hour)
+
+	trigger := func(ts time.Time) {
+		h.triggerQuotaEnforcement(context.Background(), ts)
+		require.Eventually(t, func() bool {
+			return !h.enforcingQuotas.Load()
+		}, time.Second, time.Millisecond)
+	}
+
+	ts := time.Unix(1700000000, 0)
+	trigger(ts)
+	require.Equal(t, ts, h.lastQuotaTimestamp)
+
+	// within the interval, no enforcement takes place
+	trigger(ts.Add(30 * time.Minute))
+	require.Equal(t, ts, h.lastQuotaTimestamp)
+
+	trigger(ts.Add(time.Hour))
+	require.Equal(t, ts.Add(time.Hour), h.lastQuotaTimestamp)
+
+	// an enforcement still running is never overlapped by another one
+	h.enforcingQuotas.Store(true)
+	h.triggerQuotaEnforcement(context.Background(), ts.Add(3*time.Hour))
+	require.Equal(t, ts.Add(time.Hour), h.lastQuotaTimestamp)
+	h.enforcingQuotas.Store(false)
+}
+
+func TestRetentionEnforcement(t *testing.T) {
+	dbPath := t.TempDir()
+	h := NewGoDBHandler(dbPath, encoders.EncoderTypeNull).
+		WithManifest(true).
+		WithRetention(24*time.Hour, 0)
+
+	day := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		flows := hashmap.NewAggFlowMap()
+		flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 22}, 6), types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+
+		writeoutChan := make(chan capturetypes.TaggedAggFlowMap, 1)
+		writeoutChan <- capturetypes.TaggedAggFlowMap{Map: flows, Iface: "eth0"}
+		close(writeoutChan)
+		<-h.HandleWriteout(context.Background(), day.AddDate(0, 0, i), writeoutChan)
+
+		require.Eventually(t, func() bool {
+			return !h.enforcingQuotas.Load()
+		}, time.Second, time.Millisecond)
+	}
+
+	// only the data of the last 24 hours (i.e. the days ending within them) is retained, which is
+	// reflected by the manifest
+	manifest, err := info.ReadManifest(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, day.AddDate(0, 0, 1).Unix(), manifest.Interfaces["eth0"].First.Unix())
+
+	expected, err := info.BuildManifest(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, expected.Interfaces["eth0"].First.Unix(), manifest.Interfaces["eth0"].First.Unix())
+}
+
+func TestDiskSpaceGuard(t *testing.T) {
+	day := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	writeout := func(h *GoDBHandler, timestamp time.Time) {
+		flows := hashmap.NewAggFlowMap()
+		flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 22}, 6), types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+
+		writeoutChan := make(chan capturetypes.TaggedAggFlowMap, 1)
+		writeoutChan <- capturetypes.TaggedAggFlowMap{Map: flows, Iface: "eth0"}
+		close(writeoutChan)
+		<-h.HandleWriteout(context.Background(), timestamp, writeoutChan)
+
+		require.Eventually(t, func() bool {
+			return !h.enforcingQuotas.Load()
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("insufficient free space", func(t *testing.T) {
+		dbPath := t.TempDir()
+		h := NewGoDBHandler(dbPath, encoders.EncoderTypeNull).
+			WithManifest(true).
+			WithMinFreeSpace(1024)
+
+		var free uint64
+		h.freeSpace = func(string) (uint64, error) {
+			return free, nil
+		}
+
+		// the writeout is skipped as long as the free space falls short of the minimum
+		writeout(h, day)
+		manifest, err := info.ReadManifest(dbPath)
+		require.Nil(t, err)
+		require.NotContains(t, manifest.Interfaces, "eth0")
+
+		free = 1024
+		writeout(h, day.Add(5*time.Minute))
+		manifest, err = info.ReadManifest(dbPath)
+		require.Nil(t, err)
+		require.Equal(t, day.Add(5*time.Minute).Unix(), manifest.Interfaces["eth0"].Last.Unix())
+	})
+
+	t.Run("exceeded quota", func(t *testing.T) {
+		dbPath := t.TempDir()
+
+		// the background enforcement only runs after the first writeout
+		h := NewGoDBHandler(dbPath, encoders.EncoderTypeNull).
+			WithManifest(true).
+			WithQuotas(retention.Quota{Ifaces: []string{"eth0"}, MaxBytes: 1}).
+			WithQuotaInterval(1000 * time.Hour)
+		for i := 0; i < 3; i++ {
+			writeout(h, day.AddDate(0, 0, i))
+		}
+
+		// the exceeded quota is enforced prior to the last writeout, evicting all but the (then)
+		// current directory
+		manifest, err := info.ReadManifest(dbPath)
+		require.Nil(t, err)
+		require.Equal(t, day.AddDate(0, 0, 1).Unix(), manifest.Interfaces["eth0"].First.Unix())
+		require.Equal(t, day.AddDate(0, 0, 2).Unix(), manifest.Interfaces["eth0"].Last.Unix())
+	})
+}
+
+func TestDecapsulationTags(t *testing.T) {
+	dbPath := t.TempDir()
+	timestamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	// a previously registered flow tag retains its bit
+	registry := make(info.TagRegistry)
+	_, err := registry.Register("web")
+	require.Nil(t, err)
+	require.Nil(t, registry.Write(dbPath, 0644))
+
+	flows := hashmap.NewAggFlowMap()
+	tunneled := types.NewV4KeyStatic([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, []byte{0, 22}, 6)
+	flows.PrimaryMap.Set(tunneled, types.Counters{BytesRcvd: 100, PacketsRcvd: 1})
+	flows.PrimaryMap.Set(types.NewV4KeyStatic([4]byte{192, 168, 0, 1}, [4]byte{192, 168, 0, 2}, []byte{0x12, 0xb5}, 17), types.Counters{BytesRcvd: 10, PacketsRcvd: 1})
+
+	writeoutChan := make(chan capturetypes.TaggedAggFlowMap, 1)
+	writeoutChan <- capturetypes.TaggedAggFlowMap{
+		Map:   flows,
+		Iface: "eth0",
+		Attributes: capturetypes.FlowAttributes{Labeled: capturetypes.LabeledFlows{string(tunneled): {{
+			FlowLabels: capturetypes.FlowLabels{Encapsulation: capturetypes.EncapVXLAN},
+			Counters:   types.Counters{BytesRcvd: 100, PacketsRcvd: 1},
+		}}}},
+	}
+	close(writeoutChan)
+	<-NewGoDBHandler(dbPath, encoders.EncoderTypeNull).HandleWriteout(context.Background(), timestamp, writeoutChan)
+
+	registry, err = info.ReadTagRegistry(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, info.TagRegistry{"web": 0, "decap:gre": 1, "decap:vxlan": 2, "decap:geneve": 3}, registry)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/els0r/goProbe/pkg/capture/capturetypes"
+	"github.com/els0r/goProbe/pkg/goDB/info"
 )
 
 // WriteoutsChanDepth defines a default depth for sending writeouts over the writeout channel
@@ -16,3 +17,20 @@ type Handler interface {
 	// HandleWriteout provides access to writeouts via a channel
 	HandleWriteout(ctx context.Context, timestamp time.Time, writeoutChan <-chan capturetypes.TaggedAggFlowMap) <-chan struct{}
 }
+
+// ZoneWriter defines an (optional) interface for handlers persisting the network zones of the
+// interfaces alongside the flow data
+type ZoneWriter interface {
+
+	// WriteZones stores the network zones of the interfaces
+	WriteZones(zones info.Zones) error
+}
+
+// ByteAccountingRecorder defines an (optional) interface for handlers recording the byte accounting basis
+// of the interfaces alongside the flow data
+type ByteAccountingRecorder interface {
+
+	// SetByteAccounting sets the byte accounting basis of the interfaces, recorded along with all
+	// subsequent writeouts
+	SetByteAccounting(accounting info.ByteAccounting)
+}
@@ -18,8 +18,49 @@ var writeoutDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
 	Buckets: []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 5, 10, 30, 60},
 })
 
+var evictedDirs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: writeoutSubsystem,
+	Name:      "evicted_dirs_total",
+	Help:      "Total number of DB directories evicted due to exceeded storage quotas / retention limits",
+}, []string{"reason"})
+
+var evictedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: writeoutSubsystem,
+	Name:      "evicted_bytes_total",
+	Help:      "Total size of DB directories evicted due to exceeded storage quotas / retention limits (i.e. the reclaimed disk space)",
+}, []string{"reason"})
+
+var writeoutsSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: writeoutSubsystem,
+	Name:      "writeouts_skipped_total",
+	Help:      "Total number of interface writeouts skipped due to insufficient free disk space",
+}, []string{"iface"})
+
+var freeDiskSpace = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: config.ServiceName,
+	Subsystem: writeoutSubsystem,
+	Name:      "free_disk_bytes",
+	Help:      "Free space of the file system holding the DB (as of the last writeout, only tracked if a minimum free space is configured)",
+})
+
+var flowsFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: config.ServiceName,
+	Subsystem: writeoutSubsystem,
+	Name:      "flows_filtered_total",
+	Help:      "Total number of flows excluded from a writeout sink by its filter",
+}, []string{"sink"})
+
 func init() {
 	prometheus.MustRegister(
 		writeoutDuration,
+		evictedDirs,
+		evictedBytes,
+		writeoutsSkipped,
+		freeDiskSpace,
+		flowsFiltered,
+		flowSizeHistograms,
 	)
 }
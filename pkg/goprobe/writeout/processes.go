@@ -0,0 +1,72 @@
+package writeout
+
+import (
+	"io/fs"
+	"slices"
+	"sync"
+
+	"github.com/els0r/goProbe/pkg/goDB/info"
+	"github.com/els0r/goProbe/pkg/goprobe/socktrack"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// ProcessAttribution attributes the flows of a set of interfaces to the local processes owning their
+// sockets, registering the labels of all processes encountered with the registry stored in the GoDB
+type ProcessAttribution struct {
+	tracker  socktrack.Tracker
+	ifaces   []string
+	registry info.ProcessRegistry
+	modified bool
+
+	sync.Mutex
+}
+
+// NewProcessAttribution instantiates a new process attribution for the interfaces (all interfaces if
+// none are provided), extending the registry of process labels
+func NewProcessAttribution(tracker socktrack.Tracker, registry info.ProcessRegistry, ifaces ...string) *ProcessAttribution {
+	return &ProcessAttribution{
+		tracker:  tracker,
+		ifaces:   ifaces,
+		registry: registry,
+	}
+}
+
+// Enabled returns if the flows of an interface are attributed
+func (p *ProcessAttribution) Enabled(iface string) bool {
+	return len(p.ifaces) == 0 || slices.Contains(p.ifaces, iface)
+}
+
+// ProcessID returns the ID of the label of the process a flow is attributed to (zero if the flow cannot be
+// attributed to any process). It implements the goDB.ProcessAttributor interface
+func (p *ProcessAttribution) ProcessID(key types.Key) uint32 {
+	proc, found := p.tracker.Lookup(key)
+	if !found {
+		return 0
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	id, added, err := p.registry.Register(proc.Label())
+	if err != nil {
+		return 0
+	}
+	p.modified = p.modified || added
+	return id
+}
+
+// Flush stores the registry of process labels at the root of the GoDB at dbPath if any labels were
+// registered since the last call
+func (p *ProcessAttribution) Flush(dbPath string, permissions fs.FileMode) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.modified {
+		return nil
+	}
+	if err := p.registry.Write(dbPath, permissions); err != nil {
+		return err
+	}
+	p.modified = false
+	return nil
+}
@@ -0,0 +1,229 @@
+package writeout
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/els0r/goProbe/cmd/goProbe/config"
+	"github.com/els0r/goProbe/pkg/goDB/protocols"
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TopTalkers tracks the largest flows (by bytes) of each interface as seen during its last writeout and
+// exposes them as Prometheus metrics, providing basic top talker dashboards without having to query
+// the GoDB. The flows are aggregated by the configured labels and at most k of them are exposed per
+// interface, bounding the cardinality of the metrics
+type TopTalkers struct {
+	k      int
+	labels []string
+
+	// flags denoting if the respective attribute is part of the labels
+	sip, dip, dport, proto bool
+
+	bytesDesc, packetsDesc *prometheus.Desc
+
+	snapshots map[string]topTalkersSnapshot
+
+	sync.Mutex
+}
+
+type topTalkersSnapshot struct {
+	talkers []topTalker
+	updated time.Time
+}
+
+type topTalker struct {
+	key      types.Key // the key of the flow(s), with all attributes not part of the labels zeroed
+	counters types.Counters
+}
+
+// NewTopTalkers creates a new top talker tracker, exposing the k largest flows per interface (the default
+// number if zero) aggregated by labels (all flow attributes if none are provided)
+func NewTopTalkers(k int, labels ...string) (*TopTalkers, error) {
+	if k < 0 {
+		return nil, fmt.Errorf("invalid number of top talkers: %d", k)
+	}
+	if k == 0 {
+		k = config.DefaultTopTalkersK
+	}
+	if len(labels) == 0 {
+		labels = config.TopTalkersLabels
+	}
+
+	t := &TopTalkers{
+		k:         k,
+		labels:    slices.Clone(labels),
+		snapshots: make(map[string]topTalkersSnapshot),
+	}
+	for _, label := range labels {
+		switch label {
+		case config.TopTalkersLabelSIP:
+			t.sip = true
+		case config.TopTalkersLabelDIP:
+			t.dip = true
+		case config.TopTalkersLabelDport:
+			t.dport = true
+		case config.TopTalkersLabelProto:
+			t.proto = true
+		default:
+			return nil, fmt.Errorf("unknown top talkers label %q", label)
+		}
+	}
+
+	variableLabels := append([]string{"iface"}, t.labels...)
+	t.bytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(config.ServiceName, writeoutSubsystem, "top_talker_bytes"),
+		"Bytes (received and sent) of the top talkers of each interface during the last writeout interval",
+		variableLabels, nil,
+	)
+	t.packetsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(config.ServiceName, writeoutSubsystem, "top_talker_packets"),
+		"Packets (received and sent) of the top talkers of each interface during the last writeout interval",
+		variableLabels, nil,
+	)
+	return t, nil
+}
+
+// Update replaces the top talkers of the interface by the largest flows of m
+func (t *TopTalkers) Update(iface string, m *hashmap.AggFlowMap, timestamp time.Time) {
+	talkers := make([]topTalker, 0, t.k)
+	if m != nil {
+		if t.sip && t.dip && t.dport && t.proto {
+
+			// No aggregation required, each flow is a (potential) top talker on its own
+			for it := m.Iter(); it.Next(); {
+				talkers = t.insert(talkers, it.Key(), it.Val())
+			}
+		} else {
+			aggregated := make(map[string]types.Counters)
+			var masked types.Key
+			for it := m.Iter(); it.Next(); {
+				masked = t.mask(masked, it.Key())
+				counters := aggregated[string(masked)]
+				counters.Add(it.Val())
+				aggregated[string(masked)] = counters
+			}
+			for key, counters := range aggregated {
+				talkers = t.insert(talkers, types.Key(key), counters)
+			}
+		}
+	}
+
+	// Keys may reference the memory of the flow map (which is reused after the writeout)
+	for i := range talkers {
+		talkers[i].key = t.mask(nil, talkers[i].key)
+	}
+
+	t.Lock()
+	t.snapshots[iface] = topTalkersSnapshot{
+		talkers: talkers,
+		updated: timestamp,
+	}
+	t.Unlock()
+}
+
+// Expire drops the top talkers of all interfaces which have not been updated since the provided time
+// (e.g. because they are no longer captured)
+func (t *TopTalkers) Expire(before time.Time) {
+	t.Lock()
+	defer t.Unlock()
+
+	for iface, snapshot := range t.snapshots {
+		if snapshot.updated.Before(before) {
+			delete(t.snapshots, iface)
+		}
+	}
+}
+
+// Describe implements the prometheus.Collector interface
+func (t *TopTalkers) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.bytesDesc
+	ch <- t.packetsDesc
+}
+
+// Collect implements the prometheus.Collector interface
+func (t *TopTalkers) Collect(ch chan<- prometheus.Metric) {
+	t.Lock()
+	defer t.Unlock()
+
+	for iface, snapshot := range t.snapshots {
+		for _, talker := range snapshot.talkers {
+			labelValues := t.labelValues(iface, talker.key)
+			ch <- prometheus.MustNewConstMetric(t.bytesDesc, prometheus.GaugeValue, float64(talker.counters.SumBytes()), labelValues...)
+			ch <- prometheus.MustNewConstMetric(t.packetsDesc, prometheus.GaugeValue, float64(talker.counters.SumPackets()), labelValues...)
+		}
+	}
+}
+
+// insert adds the flow to the (descendingly sorted) top talkers if it is among the k largest ones
+func (t *TopTalkers) insert(talkers []topTalker, key types.Key, counters types.Counters) []topTalker {
+	bytes := counters.SumBytes()
+	if len(talkers) == t.k && bytes <= talkers[len(talkers)-1].counters.SumBytes() {
+		return talkers
+	}
+
+	pos, _ := slices.BinarySearchFunc(talkers, bytes, func(talker topTalker, bytes uint64) int {
+		if talker.counters.SumBytes() > bytes {
+			return -1
+		}
+		return 1
+	})
+	if len(talkers) == t.k {
+		talkers = talkers[:len(talkers)-1]
+	}
+	return slices.Insert(talkers, pos, topTalker{key: key, counters: counters})
+}
+
+// mask copies key to dst (allocating if required), zeroing all attributes which are not part of the
+// labels. If neither IP is part of the labels, IPv6 keys are converted to IPv4 keys in order to
+// aggregate the flows of both IP versions
+func (t *TopTalkers) mask(dst, key types.Key) types.Key {
+	if !t.sip && !t.dip && !key.IsIPv4() {
+		dst = append(dst[:0], make(types.Key, types.KeyWidthIPv4)...)
+		dst.PutDportV4(key.GetDport())
+		dst.PutProtoV4(key.GetProto())
+	} else {
+		dst = append(dst[:0], key...)
+	}
+
+	if !t.sip {
+		clear(dst.GetSIP())
+	}
+	if !t.dip {
+		clear(dst.GetDIP())
+	}
+	if !t.dport {
+		clear(dst.GetDport())
+	}
+	if !t.proto {
+		dst.PutProto(0)
+	}
+	return dst
+}
+
+func (t *TopTalkers) labelValues(iface string, key types.Key) []string {
+	values := make([]string, 0, len(t.labels)+1)
+	values = append(values, iface)
+	for _, label := range t.labels {
+		switch label {
+		case config.TopTalkersLabelSIP:
+			values = append(values, types.RawIPToString(key.GetSIP()))
+		case config.TopTalkersLabelDIP:
+			values = append(values, types.RawIPToString(key.GetDIP()))
+		case config.TopTalkersLabelDport:
+			values = append(values, strconv.Itoa(int(types.PortToUint16(key.GetDport()))))
+		case config.TopTalkersLabelProto:
+			proto := protocols.GetIPProto(int(key.GetProto()))
+			if proto == "" {
+				proto = strconv.Itoa(int(key.GetProto()))
+			}
+			values = append(values, proto)
+		}
+	}
+	return values
+}
@@ -0,0 +1,88 @@
+package writeout
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/els0r/goProbe/pkg/types/hashmap"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTopTalkersTestMap() *hashmap.AggFlowMap {
+	m := hashmap.NewAggFlowMap()
+	for _, flow := range []struct {
+		sip, dip string
+		dport    uint16
+		proto    byte
+		bytes    uint64
+	}{
+		{"10.0.0.1", "10.0.0.2", 443, 6, 1000},
+		{"10.0.0.1", "10.0.0.3", 443, 6, 500},
+		{"10.0.0.4", "10.0.0.2", 53, 17, 200},
+		{"10.0.0.5", "10.0.0.2", 22, 6, 100},
+		{"2001:db8::1", "2001:db8::2", 443, 6, 300},
+	} {
+		sip, dip := netip.MustParseAddr(flow.sip), netip.MustParseAddr(flow.dip)
+		key := types.NewKey(sip.AsSlice(), dip.AsSlice(), []byte{byte(flow.dport >> 8), byte(flow.dport)}, flow.proto)
+		m.SetOrUpdate(key, sip.Is4(), flow.bytes, 0, 1, 0)
+	}
+	return m
+}
+
+func TestTopTalkers(t *testing.T) {
+	var tests = []struct {
+		name     string
+		k        int
+		labels   []string
+		expected string
+	}{
+		{"all labels", 2, nil, `
+goprobe_godb_handler_top_talker_bytes{dip="10.0.0.2",dport="443",iface="eth0",proto="TCP",sip="10.0.0.1"} 1000
+goprobe_godb_handler_top_talker_bytes{dip="10.0.0.3",dport="443",iface="eth0",proto="TCP",sip="10.0.0.1"} 500
+`},
+		{"aggregated by dport", 2, []string{"dport"}, `
+goprobe_godb_handler_top_talker_bytes{dport="443",iface="eth0"} 1800
+goprobe_godb_handler_top_talker_bytes{dport="53",iface="eth0"} 200
+`},
+		{"aggregated by dip and proto", 10, []string{"dip", "proto"}, `
+goprobe_godb_handler_top_talker_bytes{dip="10.0.0.2",iface="eth0",proto="TCP"} 1100
+goprobe_godb_handler_top_talker_bytes{dip="10.0.0.2",iface="eth0",proto="UDP"} 200
+goprobe_godb_handler_top_talker_bytes{dip="10.0.0.3",iface="eth0",proto="TCP"} 500
+goprobe_godb_handler_top_talker_bytes{dip="2001:db8::2",iface="eth0",proto="TCP"} 300
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topTalkers, err := NewTopTalkers(test.k, test.labels...)
+			require.Nil(t, err)
+
+			topTalkers.Update("eth0", newTopTalkersTestMap(), time.Now())
+			require.Nil(t, testutil.CollectAndCompare(topTalkers, strings.NewReader(`
+# HELP goprobe_godb_handler_top_talker_bytes Bytes (received and sent) of the top talkers of each interface during the last writeout interval
+# TYPE goprobe_godb_handler_top_talker_bytes gauge`+test.expected), "goprobe_godb_handler_top_talker_bytes"))
+		})
+	}
+}
+
+func TestTopTalkersExpire(t *testing.T) {
+	topTalkers, err := NewTopTalkers(0, "proto")
+	require.Nil(t, err)
+
+	now := time.Now()
+	topTalkers.Update("eth0", newTopTalkersTestMap(), now.Add(-time.Hour))
+	topTalkers.Update("eth1", newTopTalkersTestMap(), now)
+	topTalkers.Update("eth2", nil, now)
+	require.Equal(t, 8, testutil.CollectAndCount(topTalkers))
+
+	// the top talkers of interfaces which have not been updated are dropped
+	topTalkers.Expire(now.Add(-time.Minute))
+	require.Equal(t, 4, testutil.CollectAndCount(topTalkers))
+
+	_, err = NewTopTalkers(10, "iface")
+	require.NotNil(t, err)
+}
@@ -87,6 +87,8 @@ type Args struct {
 	// data filtering
 	// Condition: the condition to filter data by
 	Condition string `json:"condition,omitempty" yaml:"condition,omitempty" query:"condition" required:"false" doc:"Condition to filter data by" example:"port=80 & proto=TCP"`
+	// StrictHostnames: fail if a hostname in the condition resolves to multiple addresses
+	StrictHostnames bool `json:"strict_hostnames,omitempty" yaml:"strict_hostnames,omitempty" query:"strict_hostnames" required:"false" doc:"Fail if a hostname in the condition (e.g. dip = www.example.com) resolves to multiple addresses instead of reporting a warning and matching any of them" example:"false"`
 
 	// counter addition
 	// In: only show incoming packets/bytes
@@ -104,13 +106,15 @@ type Args struct {
 
 	// formatting
 	// Format: the output format
-	Format string `json:"format,omitempty" yaml:"format,omitempty" query:"format" required:"false" doc:"Output format" enum:"json,txt,csv" example:"json"`
+	Format string `json:"format,omitempty" yaml:"format,omitempty" query:"format" required:"false" doc:"Output format" enum:"json,txt,csv,xlsx,parquet" example:"json"`
 	// SortBy: column to sort by
-	SortBy string `json:"sort_by,omitempty" yaml:"sort_by,omitempty" query:"sort_by" required:"false" doc:"Colum to sort by" enum:"bytes,packets" example:"packets" default:"bytes"`
+	SortBy string `json:"sort_by,omitempty" yaml:"sort_by,omitempty" query:"sort_by" required:"false" doc:"Column to sort by" enum:"bytes,packets,time,sip,dip,dport,proto,iface" example:"packets" default:"bytes"`
 	// NumResults: number of results to return/print
 	NumResults uint64 `json:"num_results,omitempty" yaml:"num_results,omitempty" query:"num_results" required:"false" doc:"Number of results to return/print" example:"25" minimum:"1" default:"1000"`
-	// SortAscending: sort ascending instead of the default descending
-	SortAscending bool `json:"sort_ascending,omitempty" yaml:"sort_ascending,omitempty" query:"sort_ascending" required:"false" doc:"Sort ascending instead of descending" example:"false"`
+	// SortAscending: sort ascending instead of the default descending (counter columns)
+	SortAscending bool `json:"sort_ascending,omitempty" yaml:"sort_ascending,omitempty" query:"sort_ascending" required:"false" doc:"Sort ascending instead of descending (attribute columns are sorted ascending by default)" example:"false"`
+	// SortDescending: sort descending instead of the default ascending (attribute columns)
+	SortDescending bool `json:"sort_descending,omitempty" yaml:"sort_descending,omitempty" query:"sort_descending" required:"false" doc:"Sort attribute columns descending instead of ascending (counter columns are sorted descending by default)" example:"false"`
 
 	// do-and-exit arguments
 	// List: only list interfaces and return
@@ -135,6 +139,40 @@ type Args struct {
 	// Live can be used to request live flow data (in addition to DB results)
 	Live bool `json:"live,omitempty" yaml:"live,omitempty" query:"live" required:"false" doc:"Live can be used to request live flow data (in addition to DB results)" example:"false"`
 
+	// Deadline: maximum duration of query processing. Once exceeded, the results aggregated so far are returned
+	Deadline time.Duration `json:"deadline,omitempty" yaml:"deadline,omitempty" query:"deadline" required:"false" doc:"Maximum duration of query processing in nanoseconds. Once exceeded, the results aggregated so far are returned (flagged as truncated)" example:"30000000000" minimum:"0"`
+
+	// Profile: report per-stage timings of the query in the result summary
+	Profile bool `json:"profile,omitempty" yaml:"profile,omitempty" query:"profile" required:"false" doc:"Report per-stage timings of the query in the result summary" example:"false"`
+
+	// Drops: report the packets dropped during the covered time range and the traffic estimated to be missing due to them
+	Drops bool `json:"drops,omitempty" yaml:"drops,omitempty" query:"drops" required:"false" doc:"Report the packets dropped during the covered time range (per time bin if the time attribute is queried) and the traffic estimated to be missing due to them in the result summary" example:"false"`
+
+	// Provenance: report the hosts / DBs the data originated from and how it was obtained
+	Provenance bool `json:"provenance,omitempty" yaml:"provenance,omitempty" query:"provenance" required:"false" doc:"Report the hosts / DBs the data originated from and how it was obtained (software versions, block time range actually covered, encoders and corrupt blocks encountered, sampling state) in the result summary" example:"false"`
+
+	// Zones: the network zones to restrict the queried interfaces to (comma-separated list)
+	Zones string `json:"zones,omitempty" yaml:"zones,omitempty" query:"zones" required:"false" doc:"Network zones to restrict the queried interfaces to (comma-separated list). Only interfaces tagged with any of the zones in the goProbe configuration are queried" example:"external,dmz"`
+
+	// Tags: the flow tags to restrict the query to (comma-separated list)
+	Tags string `json:"tags,omitempty" yaml:"tags,omitempty" query:"tags" required:"false" doc:"Flow tags to restrict the query to (comma-separated list). Only flows tagged with any of them during writeout are considered" example:"voip,web"`
+
+	// TimeWindows: recurring time windows to restrict the query to (semicolon-separated list)
+	TimeWindows string `json:"time_windows,omitempty" yaml:"time_windows,omitempty" query:"time_windows" required:"false" doc:"Recurring time windows to restrict the query to within its time range (semicolon-separated list of optional weekdays / weekday ranges followed by a time of day range). Blocks straddling a window boundary are considered if at least half of the interval they cover falls into the window" example:"mon-fri 09:00-17:00;sat 10:00-12:00"`
+	// TimeWindowsZone: the time zone the time windows are evaluated in
+	TimeWindowsZone string `json:"time_windows_zone,omitempty" yaml:"time_windows_zone,omitempty" query:"time_windows_zone" required:"false" doc:"IANA time zone the time windows are evaluated in. Defaults to the local time zone of the host running the query" example:"Europe/Zurich"`
+
+	// PortClasses: user-defined port classes used for the dportclass attribute
+	PortClasses string `json:"port_classes,omitempty" yaml:"port_classes,omitempty" query:"port_classes" required:"false" doc:"User-defined port classes used for the dportclass attribute (semicolon-separated list of named ports / port ranges). Defaults to well-known, registered and ephemeral ports" example:"web=80,443,8080-8090;dns=53"`
+
+	// MatrixSrcGroups / MatrixDstGroups: the prefix groups by which source / destination IPs are bucketed into a traffic matrix
+	MatrixSrcGroups string `json:"matrix_src_groups,omitempty" yaml:"matrix_src_groups,omitempty" query:"matrix_src_groups" required:"false" doc:"Prefix groups (e.g. sites or VLAN subnets) forming the rows of a traffic matrix reported in the result summary (semicolon-separated list of named prefixes / IPs). Requires the sip and dip attributes and the matrix_dst_groups to be set" example:"siteA=10.1.0.0/16,10.2.0.0/16;siteB=192.168.0.0/24"`
+	MatrixDstGroups string `json:"matrix_dst_groups,omitempty" yaml:"matrix_dst_groups,omitempty" query:"matrix_dst_groups" required:"false" doc:"Prefix groups (e.g. sites or VLAN subnets) forming the columns of a traffic matrix reported in the result summary (semicolon-separated list of named prefixes / IPs). Requires the sip and dip attributes and the matrix_src_groups to be set" example:"siteA=10.1.0.0/16,10.2.0.0/16;siteB=192.168.0.0/24"`
+
+	// BaselineFirst / BaselineLast: the baseline time range new talkers are determined against
+	BaselineFirst string `json:"baseline_first,omitempty" yaml:"baseline_first,omitempty" query:"baseline_first" required:"false" doc:"Start of the baseline time range. If set, only rows whose attribute combination did not occur during the baseline are returned (new talkers)" example:"-7d"`
+	BaselineLast  string `json:"baseline_last,omitempty" yaml:"baseline_last,omitempty" query:"baseline_last" required:"false" doc:"End of the baseline time range. Defaults to the first timestamp of the query (i.e. the baseline directly precedes the queried time range). Requires the baseline_first to be set" example:"-1h"`
+
 	// outputs is unexported
 	outputs []io.Writer
 }
@@ -203,6 +241,9 @@ func (a *Args) String() string {
 	if a.Condition != "" {
 		str += fmt.Sprintf(", condition: %s", a.Condition)
 	}
+	if a.StrictHostnames {
+		str += ", strict-hostnames: true"
+	}
 	str += fmt.Sprintf(", limit: %d, from: %s, to: %s",
 		a.NumResults,
 		a.First,
@@ -216,6 +257,42 @@ func (a *Args) String() string {
 	if a.Caller != "" {
 		str += fmt.Sprintf(", caller: %s", a.Caller)
 	}
+	if a.Deadline > 0 {
+		str += fmt.Sprintf(", deadline: %s", a.Deadline)
+	}
+	if a.Profile {
+		str += ", profile: true"
+	}
+	if a.Drops {
+		str += ", drops: true"
+	}
+	if a.Provenance {
+		str += ", provenance: true"
+	}
+	if a.PortClasses != "" {
+		str += fmt.Sprintf(", port-classes: %s", a.PortClasses)
+	}
+	if a.MatrixSrcGroups != "" || a.MatrixDstGroups != "" {
+		str += fmt.Sprintf(", matrix: %s x %s", a.MatrixSrcGroups, a.MatrixDstGroups)
+	}
+	if a.BaselineFirst != "" {
+		str += fmt.Sprintf(", baseline-from: %s", a.BaselineFirst)
+		if a.BaselineLast != "" {
+			str += fmt.Sprintf(", baseline-to: %s", a.BaselineLast)
+		}
+	}
+	if a.Zones != "" {
+		str += fmt.Sprintf(", zones: %s", a.Zones)
+	}
+	if a.Tags != "" {
+		str += fmt.Sprintf(", tags: %s", a.Tags)
+	}
+	if a.TimeWindows != "" {
+		str += fmt.Sprintf(", time-windows: %s", a.TimeWindows)
+		if a.TimeWindowsZone != "" {
+			str += fmt.Sprintf(" (%s)", a.TimeWindowsZone)
+		}
+	}
 	str += "}"
 	return str
 }
@@ -245,7 +322,8 @@ const (
 	invalidQueryTypeMsg            = "invalid query type"
 	invalidFormatMsg               = "unknown format"
 	invalidNumResults              = "invalid number of result rows"
-	invalidSortByMsg               = "unknown format"
+	invalidSortByMsg               = "invalid sort order"
+	invalidSortDirectionMsg        = "conflicting sort directions"
 	invalidTimeRangeMsg            = "invalid time range"
 	invalidDNSResolutionTimeoutMsg = "invalid resolution timeout"
 	invalidDNSResolutionRowsMsg    = "invalid number of rows"
@@ -253,6 +331,11 @@ const (
 	invalidMaxMemPctMsg            = "invalid max memory percentage"
 	invalidRowLimitMsg             = "invalid row limit"
 	invalidLiveQueryMsg            = "query not possible"
+	invalidDeadlineMsg             = "invalid query deadline"
+	invalidPortClassesMsg          = "invalid port classes"
+	invalidBaselineMsg             = "invalid baseline"
+	invalidTimeWindowsMsg          = "invalid time windows"
+	invalidMatrixGroupsMsg         = "invalid traffic matrix groups"
 	unboundedQuery                 = "unbounded query"
 )
 
@@ -301,13 +384,18 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 	)
 
 	s := &Statement{
-		QueryType:     a.Query,
-		DNSResolution: a.DNSResolution,
-		Condition:     a.Condition,
-		LowMem:        a.LowMem,
-		Caller:        a.Caller,
-		Live:          a.Live,
-		Output:        os.Stdout, // by default, we write results to the console
+		QueryType:       a.Query,
+		DNSResolution:   a.DNSResolution,
+		Condition:       a.Condition,
+		StrictHostnames: a.StrictHostnames,
+		LowMem:          a.LowMem,
+		Caller:          a.Caller,
+		Live:            a.Live,
+		Deadline:        a.Deadline,
+		Profile:         a.Profile,
+		Drops:           a.Drops,
+		Provenance:      a.Provenance,
+		Output:          os.Stdout, // by default, we write results to the console
 	}
 
 	// the query type is parsed here already in order to validate if the query contains
@@ -350,9 +438,9 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 	if !verifies {
 		// collect error
 		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
-			Message:  fmt.Sprintf("%s: %v", invalidSortByMsg, PermittedFormats()),
+			Message:  fmt.Sprintf("%s: %v", invalidSortByMsg, PermittedSortBy()),
 			Location: "body.sort_by",
-			Value:    a.Format,
+			Value:    a.SortBy,
 		})
 	}
 
@@ -383,6 +471,112 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 	}
 	s.LabelSelector = selector
 
+	// sorting by an attribute / label column is only possible if it is part of the query
+	if s.SortBy.IsAttribute() && !selectsColumn(s.attributes, selector, a.SortBy) {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: column %q is not part of the query", invalidSortByMsg, a.SortBy),
+			Location: "body.sort_by",
+			Value:    a.SortBy,
+		})
+	}
+
+	// counter columns are sorted descending by default (largest flows first), while attribute
+	// columns are sorted ascending (natural order)
+	if a.SortAscending && a.SortDescending {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: cannot sort both ascending and descending", invalidSortDirectionMsg),
+			Location: "body.sort_descending",
+			Value:    a.SortDescending,
+		})
+	}
+	s.SortAscending = a.SortAscending
+	if s.SortBy.IsAttribute() {
+		s.SortAscending = !a.SortDescending
+	}
+
+	// restrict the queried interfaces to those tagged with any of the zones (if provided)
+	for _, zone := range strings.Split(a.Zones, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			s.Zones = append(s.Zones, zone)
+		}
+	}
+
+	// restrict the query to flows carrying any of the tags (if provided)
+	for _, tag := range strings.Split(a.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+
+	// restrict the query to recurring time windows (if provided)
+	s.TimeWindows, err = types.ParseTimeWindows(a.TimeWindows)
+	if err != nil {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: %s", invalidTimeWindowsMsg, err),
+			Location: "body.time_windows",
+			Value:    a.TimeWindows,
+		})
+	}
+	s.TimeWindowsZone = a.TimeWindowsZone
+	if _, err := s.TimeWindowsLocation(); err != nil {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: unknown time zone", invalidTimeWindowsMsg),
+			Location: "body.time_windows_zone",
+			Value:    a.TimeWindowsZone,
+		})
+	}
+
+	// user-defined port classes are only meaningful if destination ports are bucketed
+	s.PortClasses, err = types.ParsePortClasses(a.PortClasses)
+	if err != nil {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: %s", invalidPortClassesMsg, err),
+			Location: "body.port_classes",
+			Value:    a.PortClasses,
+		})
+	} else if len(s.PortClasses) > 0 && !selectsColumn(s.attributes, selector, types.DportClassName) {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: column %q is not part of the query", invalidPortClassesMsg, types.DportClassName),
+			Location: "body.port_classes",
+			Value:    a.PortClasses,
+		})
+	}
+
+	// a traffic matrix buckets the source and destination IPs of the result rows into groups
+	for _, groups := range []struct {
+		def, location string
+		groups        *types.PrefixGroups
+	}{
+		{a.MatrixSrcGroups, "body.matrix_src_groups", &s.MatrixSrcGroups},
+		{a.MatrixDstGroups, "body.matrix_dst_groups", &s.MatrixDstGroups},
+	} {
+		*groups.groups, err = types.ParsePrefixGroups(groups.def)
+		if err != nil {
+			errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+				Message:  fmt.Sprintf("%s: %s", invalidMatrixGroupsMsg, err),
+				Location: groups.location,
+				Value:    groups.def,
+			})
+		}
+	}
+	if (a.MatrixSrcGroups == "") != (a.MatrixDstGroups == "") {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: both source and destination groups are required", invalidMatrixGroupsMsg),
+			Location: "body.matrix_src_groups",
+			Value:    a.MatrixSrcGroups,
+		})
+	} else if a.MatrixSrcGroups != "" {
+		for _, name := range []string{types.SIPName, types.DIPName} {
+			if !selectsColumn(s.attributes, selector, name) {
+				errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+					Message:  fmt.Sprintf("%s: column %q is not part of the query", invalidMatrixGroupsMsg, name),
+					Location: "body.query",
+					Value:    a.Query,
+				})
+			}
+		}
+	}
+
 	// override sorting direction and number of entries for time based queries
 	if selector.Timestamp {
 		s.SortBy = results.SortTime
@@ -397,6 +591,14 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 		errModel.Errors = append(errModel.Errors, timeRangeDetails...)
 	}
 
+	// the baseline of a new talkers query has to end before the queried time range starts (by default,
+	// it directly precedes it)
+	if a.BaselineFirst != "" || a.BaselineLast != "" {
+		var baselineDetails []*huma.ErrorDetail
+		s.BaselineFirst, s.BaselineLast, baselineDetails = parseBaseline(a.BaselineFirst, a.BaselineLast, s.First)
+		errModel.Errors = append(errModel.Errors, baselineDetails...)
+	}
+
 	switch {
 	case a.Sum:
 		s.Direction = types.DirectionSum
@@ -442,7 +644,7 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 	s.Condition = conditions.SanitizeUserInput(a.Condition)
 
 	// build condition tree to check if there is a syntax error before starting processing
-	_, _, parseErr := node.ParseAndInstrument(s.Condition, s.DNSResolution.Timeout)
+	_, _, parseErr := node.ParseAndInstrument(s.Condition, s.DNSResolution.Timeout, node.WithStrictHostnames(s.StrictHostnames))
 	if parseErr != nil {
 		errMsg := parseErr.Error()
 		var p *types.ParseError
@@ -462,6 +664,16 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 	tokens, _ := conditions.Tokenize(s.Condition)
 	s.Condition = strings.Join(tokens, " ")
 
+	// check query deadline
+	if a.Deadline < 0 {
+		// collect error
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: must not be negative", invalidDeadlineMsg),
+			Location: "body.deadline",
+			Value:    a.Deadline,
+		})
+	}
+
 	// check memory flag
 	if !(0 < a.MaxMemPct && a.MaxMemPct <= 100) {
 		// collect error
@@ -493,6 +705,13 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 			Value:    s.Last,
 		})
 	}
+	if s.Live && len(s.TimeWindows) > 0 {
+		errModel.Errors = append(errModel.Errors, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: time windows unsupported", invalidLiveQueryMsg),
+			Location: "live",
+			Value:    a.TimeWindows,
+		})
+	}
 
 	// fan-out query results in case multiple writers were supplied
 	writers = append(writers, a.outputs...)
@@ -506,3 +725,69 @@ func (a *Args) Prepare(writers ...io.Writer) (*Statement, error) {
 
 	return s, nil
 }
+
+// parseBaseline parses the baseline time range of a new talkers query, which ends at the first
+// timestamp of the query unless specified otherwise
+func parseBaseline(firstStr, lastStr string, queryFirst int64) (first, last int64, details []*huma.ErrorDetail) {
+	if firstStr == "" {
+		return 0, 0, []*huma.ErrorDetail{{
+			Message:  fmt.Sprintf("%s: start of baseline required", invalidBaselineMsg),
+			Location: "body.baseline_first",
+			Value:    firstStr,
+		}}
+	}
+
+	var err error
+	first, err = ParseTimeArgument(firstStr)
+	if err != nil {
+		details = append(details, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: %s: %s", invalidBaselineMsg, errorInvalidTimeFormat, err),
+			Location: "body.baseline_first",
+			Value:    firstStr,
+		})
+	}
+	last = queryFirst
+	if lastStr != "" {
+		last, err = ParseTimeArgument(lastStr)
+		if err != nil {
+			details = append(details, &huma.ErrorDetail{
+				Message:  fmt.Sprintf("%s: %s: %s", invalidBaselineMsg, errorInvalidTimeFormat, err),
+				Location: "body.baseline_last",
+				Value:    lastStr,
+			})
+		}
+	}
+	if len(details) > 0 {
+		return first, last, details
+	}
+
+	if first >= last {
+		details = append(details, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: the start of the baseline must precede its end", invalidBaselineMsg),
+			Location: "body.baseline_first",
+			Value:    firstStr,
+		})
+	}
+	if last > queryFirst {
+		details = append(details, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("%s: the baseline must end before the queried time range starts", invalidBaselineMsg),
+			Location: "body.baseline_last",
+			Value:    lastStr,
+		})
+	}
+	return first, last, details
+}
+
+// selectsColumn returns whether the attribute / label column with the given name is
+// selected by the query
+func selectsColumn(attributes []types.Attribute, selector types.LabelSelector, name string) bool {
+	if name == types.IfaceName {
+		return selector.Iface
+	}
+	for _, attribute := range attributes {
+		if attribute.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -26,6 +26,33 @@ func TestPrepareArgs(t *testing.T) {
 		{"wrong sort by", &Args{Query: "sip", Format: types.FormatJSON, SortBy: "biscuits"},
 			&DetailError{},
 		},
+		{"negative deadline",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20, Deadline: -time.Second,
+			},
+			&DetailError{},
+		},
+		{"sort by attribute not in query", &Args{Ifaces: "eth0", Query: "sip", Format: types.FormatJSON, SortBy: "dip"},
+			&DetailError{},
+		},
+		{"sort by attribute in query",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip,dip", Format: types.FormatJSON, SortBy: "dip",
+				MaxMemPct: 20, NumResults: 20,
+			},
+			nil,
+		},
+		{"sort by iface across interfaces",
+			&Args{
+				Ifaces: "eth0,eth1",
+				Query:  "sip", Format: types.FormatJSON, SortBy: "iface",
+				MaxMemPct: 20, NumResults: 20,
+			},
+			nil,
+		},
 		{"empty sort by, invalid time",
 			&Args{Query: "sip,time", Format: types.FormatJSON, First: "10:"},
 			&DetailError{},
@@ -79,6 +106,123 @@ func TestPrepareArgs(t *testing.T) {
 			},
 			&DetailError{},
 		},
+		{"invalid time windows",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				TimeWindows: "mon-fri 9-17",
+			},
+			&DetailError{},
+		},
+		{"unknown time windows zone",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				TimeWindows: "mon-fri 09:00-17:00", TimeWindowsZone: "Mars/Olympus",
+			},
+			&DetailError{},
+		},
+		{"time windows in live mode",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				TimeWindows: "mon-fri 09:00-17:00", Live: true,
+			},
+			&DetailError{},
+		},
+		{"valid time windows",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				TimeWindows: "mon-fri 09:00-17:00", TimeWindowsZone: "Europe/Zurich",
+			},
+			nil,
+		},
+		{"matrix without destination groups",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip,dip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				MatrixSrcGroups: "siteA=10.1.0.0/16",
+			},
+			&DetailError{},
+		},
+		{"matrix without dip attribute",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				MatrixSrcGroups: "siteA=10.1.0.0/16", MatrixDstGroups: "siteB=10.2.0.0/16",
+			},
+			&DetailError{},
+		},
+		{"invalid matrix groups",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip,dip", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				MatrixSrcGroups: "siteA=10.1.0.1/16", MatrixDstGroups: "siteB=10.2.0.0/16",
+			},
+			&DetailError{},
+		},
+		{"valid matrix groups",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "sip,dip,dport", Format: types.FormatJSON,
+				MaxMemPct: 20, NumResults: 20,
+				MatrixSrcGroups: "siteA=10.1.0.0/16;siteB=10.2.0.0/16", MatrixDstGroups: "siteB=10.2.0.0/16;dmz=2001:db8::/32",
+			},
+			nil,
+		},
+		{"baseline without start",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "dip", Format: types.FormatJSON, First: "-1h",
+				MaxMemPct: 20, NumResults: 20,
+				BaselineLast: "-2h",
+			},
+			&DetailError{},
+		},
+		{"baseline overlapping query",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "dip", Format: types.FormatJSON, First: "-1h",
+				MaxMemPct: 20, NumResults: 20,
+				BaselineFirst: "-7d", BaselineLast: "-30m",
+			},
+			&DetailError{},
+		},
+		{"baseline start after end",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "dip", Format: types.FormatJSON, First: "-1h",
+				MaxMemPct: 20, NumResults: 20,
+				BaselineFirst: "-2h", BaselineLast: "-3h",
+			},
+			&DetailError{},
+		},
+		{"invalid baseline start",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "dip", Format: types.FormatJSON, First: "-1h",
+				MaxMemPct: 20, NumResults: 20,
+				BaselineFirst: "last week",
+			},
+			&DetailError{},
+		},
+		{"valid baseline",
+			&Args{
+				Ifaces: "eth0",
+				Query:  "dip,time", Format: types.FormatJSON, First: "-1h",
+				MaxMemPct: 20, NumResults: 20,
+				BaselineFirst: "-7d",
+			},
+			nil,
+		},
 		{"valid query args",
 			&Args{
 				Ifaces: "eth0",
@@ -105,6 +249,39 @@ func TestPrepareArgs(t *testing.T) {
 	}
 }
 
+func TestSortDirection(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     *Args
+		ascending bool
+	}{
+		{"counter, default", &Args{SortBy: "bytes"}, false},
+		{"counter, ascending", &Args{SortBy: "packets", SortAscending: true}, true},
+		{"attribute, default", &Args{SortBy: "dip"}, true},
+		{"attribute, ascending", &Args{SortBy: "dip", SortAscending: true}, true},
+		{"attribute, descending", &Args{SortBy: "dip", SortDescending: true}, false},
+		{"time query", &Args{Query: "sip,dip,time", SortBy: "dip", SortDescending: true}, true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.input.Ifaces, test.input.Format = "eth0", types.FormatJSON
+			test.input.MaxMemPct, test.input.NumResults = 20, 20
+			if test.input.Query == "" {
+				test.input.Query = "sip,dip"
+			}
+			stmt, err := test.input.Prepare()
+			require.Nil(t, err)
+			require.Equal(t, test.ascending, stmt.SortAscending)
+		})
+	}
+
+	_, err := (&Args{Ifaces: "eth0", Query: "sip,dip", Format: types.FormatJSON, MaxMemPct: 20, NumResults: 20,
+		SortBy: "dip", SortAscending: true, SortDescending: true}).Prepare()
+	require.ErrorAs(t, err, new(*DetailError))
+}
+
 func TestSelector(t *testing.T) {
 	var tests = []struct {
 		name     string
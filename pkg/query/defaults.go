@@ -23,9 +23,11 @@ var (
 
 // PermittedFormats stores all supported output formats
 var permittedFormats = map[string]struct{}{
-	types.FormatTXT:  {},
-	types.FormatJSON: {},
-	types.FormatCSV:  {},
+	types.FormatTXT:     {},
+	types.FormatJSON:    {},
+	types.FormatCSV:     {},
+	types.FormatXLSX:    {},
+	types.FormatParquet: {},
 }
 
 var (
@@ -55,6 +57,13 @@ var permittedSortBy = map[string]results.SortOrder{
 	"bytes":   results.SortTraffic,
 	"packets": results.SortPackets,
 	"time":    results.SortTime,
+
+	// attribute / label columns
+	types.SIPName:   results.SortSrcIP,
+	types.DIPName:   results.SortDstIP,
+	types.DportName: results.SortDstPort,
+	types.ProtoName: results.SortProto,
+	types.IfaceName: results.SortIface,
 }
 
 // PermittedSortBy lists which sort by methods are supported
@@ -7,6 +7,8 @@ import (
 	"runtime"
 	"runtime/debug"
 	"time"
+
+	"github.com/els0r/goProbe/pkg/cgroup"
 )
 
 // Parameters for checking memory consumption of query
@@ -42,6 +44,10 @@ func Watch(ctx context.Context, maxAllowedMemPct int) (errors chan error) {
 			return
 		}
 
+		// if running in a control group with a memory limit (e.g. in a container), the limit
+		// applies instead of the physical memory of the host (both in kB)
+		physMem = float64(cgroup.Current().Memory(uint64(physMem*1024))) / 1024
+
 		// Create global MemStats object for tracking of memory consumption
 		memTicker := time.NewTicker(MemCheckInterval)
 		m := runtime.MemStats{}
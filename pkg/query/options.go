@@ -8,6 +8,9 @@ type Option func(*Args)
 // WithCondition sets the condition argument
 func WithCondition(c string) Option { return func(a *Args) { a.Condition = c } }
 
+// WithStrictHostnames makes the query fail if a hostname in the condition resolves to multiple addresses
+func WithStrictHostnames() Option { return func(a *Args) { a.StrictHostnames = true } }
+
 // WithDirectionIn considers the incoming flows
 func WithDirectionIn() Option { return func(a *Args) { a.In = true } }
 
@@ -35,6 +38,10 @@ func WithNumResults(n uint64) Option { return func(a *Args) { a.NumResults = n }
 // WithSortAscending sorts rows ascending
 func WithSortAscending() Option { return func(a *Args) { a.SortAscending = true } }
 
+// WithSortDescending sorts rows descending (only relevant for attribute columns, which are sorted
+// ascending by default)
+func WithSortDescending() Option { return func(a *Args) { a.SortDescending = true } }
+
 // WithList sets the list parameter (only lists interfaces)
 func WithList() Option { return func(a *Args) { a.List = true } }
 
@@ -55,3 +62,39 @@ func WithMaxMemPct(m int) Option { return func(a *Args) { a.MaxMemPct = m } }
 
 // WithCaller sets the name of the program/tool calling the query
 func WithCaller(c string) Option { return func(a *Args) { a.Caller = c } }
+
+// WithDeadline sets the maximum query processing duration, after which partial results are returned
+func WithDeadline(d time.Duration) Option { return func(a *Args) { a.Deadline = d } }
+
+// WithProfile enables reporting of per-stage query timings
+func WithProfile() Option { return func(a *Args) { a.Profile = true } }
+
+// WithDrops enables reporting of dropped packets and the traffic estimated to be missing due to them
+func WithDrops() Option { return func(a *Args) { a.Drops = true } }
+
+// WithProvenance enables reporting of the hosts / DBs the data originated from and how it was obtained
+func WithProvenance() Option { return func(a *Args) { a.Provenance = true } }
+
+// WithZones restricts the queried interfaces to those tagged with any of the given network zones (e.g. "external,dmz")
+func WithZones(zones string) Option { return func(a *Args) { a.Zones = zones } }
+
+// WithTags restricts the query to flows carrying any of the given flow tags (e.g. "voip,web")
+func WithTags(tags string) Option { return func(a *Args) { a.Tags = tags } }
+
+// WithTimeWindows restricts the query to recurring time windows (e.g. "mon-fri 09:00-17:00"), evaluated in the given time zone (the local one if empty)
+func WithTimeWindows(windows, zone string) Option {
+	return func(a *Args) { a.TimeWindows, a.TimeWindowsZone = windows, zone }
+}
+
+// WithPortClasses sets user-defined port classes for the dportclass attribute (e.g. "web=80,443;dns=53")
+func WithPortClasses(classes string) Option { return func(a *Args) { a.PortClasses = classes } }
+
+// WithMatrix requests a traffic matrix between source and destination prefix groups (e.g. "siteA=10.1.0.0/16;siteB=10.2.0.0/16")
+func WithMatrix(srcGroups, dstGroups string) Option {
+	return func(a *Args) { a.MatrixSrcGroups, a.MatrixDstGroups = srcGroups, dstGroups }
+}
+
+// WithBaseline restricts the result to new talkers, i.e. rows whose attribute combination did not occur during the baseline time range (ending at the first timestamp of the query if last is empty)
+func WithBaseline(first, last string) Option {
+	return func(a *Args) { a.BaselineFirst, a.BaselineLast = first, last }
+}
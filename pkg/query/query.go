@@ -17,6 +17,11 @@ func (s *Statement) Print(ctx context.Context, result *results.Result, opts ...r
 	ctx, span := tracing.Start(ctx, "(*Statement).Print")
 	defer span.End()
 
+	// in matrix mode, the traffic between the groups is printed instead of the individual rows
+	if result.Summary.Matrix != nil {
+		return result.Summary.Matrix.Print(s.Output, s.Format, s.SortBy, s.Direction)
+	}
+
 	var sip, dip types.Attribute
 
 	var hasDNSattributes bool
@@ -48,6 +53,9 @@ func (s *Statement) Print(ctx context.Context, result *results.Result, opts ...r
 		resolveStart := time.Now()
 		ips2domains = dns.TimedReverseLookup(ctx, ips, s.DNSResolution.Timeout)
 		result.Summary.Timings.ResolutionDuration = time.Since(resolveStart)
+		if result.Summary.Profile != nil {
+			result.Summary.Profile.DNSResolution = result.Summary.Timings.ResolutionDuration
+		}
 
 		opts = append(opts, results.WithIPDomainMapping(ips2domains, s.DNSResolution.Timeout))
 	}
@@ -12,3 +12,36 @@ type Runner interface {
 	// Run takes a query statement, executes the underlying query and returns the result(s)
 	Run(ctx context.Context, args *Args) (*results.Result, error)
 }
+
+// BatchRunner specifies the functionality a query runner must provide in order to evaluate multiple
+// queries at once
+type BatchRunner interface {
+
+	// RunBatch takes multiple queries covering the same time range and interfaces, executes them in a
+	// single pass over the data and returns their results (in the order of the queries)
+	RunBatch(ctx context.Context, args []*Args) ([]*results.Result, error)
+}
+
+// DryRunner specifies the functionality a query runner must provide in order to validate queries and
+// estimate their cost without running them
+type DryRunner interface {
+
+	// DryRun takes a query, validates it and estimates its cost without executing it
+	DryRun(ctx context.Context, args *Args) (*results.DryRun, error)
+}
+
+type resourceUsageFnKey struct{}
+
+// WithResourceUsageFn returns a copy of ctx which makes runners accounting the resources of their queries
+// call f with a function reporting the current resource usage of the query as soon as it has been granted
+// its resources. It allows to report the usage of queries while they are still running (e.g. for queries
+// run in the background)
+func WithResourceUsageFn(ctx context.Context, f func(usage func() results.ResourceUsage)) context.Context {
+	return context.WithValue(ctx, resourceUsageFnKey{}, f)
+}
+
+// ResourceUsageFn returns the function provided via WithResourceUsageFn (or nil if there is none)
+func ResourceUsageFn(ctx context.Context) func(usage func() results.ResourceUsage) {
+	f, _ := ctx.Value(resourceUsageFnKey{}).(func(usage func() results.ResourceUsage))
+	return f
+}
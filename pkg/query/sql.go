@@ -0,0 +1,432 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SQL keywords starting a clause of an SQL-like statement
+const (
+	sqlSelect = "select"
+	sqlFrom   = "from"
+	sqlWhere  = "where"
+	sqlSince  = "since"
+	sqlUntil  = "until"
+	sqlOrder  = "order"
+	sqlLimit  = "limit"
+)
+
+var sqlClauses = []string{sqlFrom, sqlWhere, sqlSince, sqlUntil, sqlOrder, sqlLimit}
+
+// ErrInvalidSQL denotes an SQL-like statement which cannot be translated into query arguments
+var ErrInvalidSQL = errors.New("invalid SQL statement")
+
+// IsSQL returns whether stmt is an SQL-like statement (i.e. starts with SELECT)
+func IsSQL(stmt string) bool {
+	fields := strings.Fields(stmt)
+	return len(fields) > 0 && strings.EqualFold(fields[0], sqlSelect)
+}
+
+// ApplySQL translates an SQL-like statement into the query arguments, providing an alternative to
+// specifying the attributes, interfaces, condition and time range individually, e.g.
+//
+//	SELECT sip,dip,bytes WHERE dport = 443 AND iface = 'eth0' SINCE -24h LIMIT 50
+//
+// is equivalent to the query "sip,dip" on interface eth0 with condition "dport = 443", first "-24h"
+// and 50 results. The supported clauses are (in any order after SELECT):
+//
+//	SELECT <attributes>            attributes to group by (bytes / packets are always reported)
+//	FROM <ifaces>                  interfaces to query (alternatively: iface = ... / iface IN (...) in WHERE)
+//	WHERE <condition>              condition, using AND / OR / NOT, IN (...) and quoted values
+//	SINCE <time> / UNTIL <time>    time range (any format supported by first / last)
+//	ORDER BY <column> [ASC|DESC]   column to sort by
+//	LIMIT <n>                      number of results
+//
+// Arguments not covered by the statement (e.g. the output format) remain unchanged
+func (a *Args) ApplySQL(stmt string) error {
+	tokens, err := lexSQL(stmt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSQL, err)
+	}
+	if err := a.applySQLTokens(tokens); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSQL, err)
+	}
+	return nil
+}
+
+func (a *Args) applySQLTokens(tokens []sqlToken) error {
+	if len(tokens) == 0 || !tokens[0].isKeyword(sqlSelect) {
+		return errors.New("statement must start with SELECT")
+	}
+
+	clauses, err := splitSQLClauses(tokens[1:])
+	if err != nil {
+		return err
+	}
+
+	var ifaces []string
+	for _, clause := range clauses {
+		switch clause.keyword {
+		case sqlSelect:
+			if a.Query, err = sqlAttributes(clause.tokens); err != nil {
+				return err
+			}
+		case sqlFrom:
+			list, err := sqlList(clause.tokens)
+			if err != nil {
+				return fmt.Errorf("FROM: %w", err)
+			}
+			ifaces = append(ifaces, list...)
+		case sqlWhere:
+			condition, whereIfaces, err := sqlCondition(clause.tokens)
+			if err != nil {
+				return fmt.Errorf("WHERE: %w", err)
+			}
+			a.Condition = condition
+			ifaces = append(ifaces, whereIfaces...)
+		case sqlSince:
+			if a.First, err = sqlValue(clause.tokens); err != nil {
+				return fmt.Errorf("SINCE: %w", err)
+			}
+		case sqlUntil:
+			if a.Last, err = sqlValue(clause.tokens); err != nil {
+				return fmt.Errorf("UNTIL: %w", err)
+			}
+		case sqlOrder:
+			if err := a.applySQLOrder(clause.tokens); err != nil {
+				return fmt.Errorf("ORDER BY: %w", err)
+			}
+		case sqlLimit:
+			value, err := sqlValue(clause.tokens)
+			if err != nil {
+				return fmt.Errorf("LIMIT: %w", err)
+			}
+			if a.NumResults, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return fmt.Errorf("LIMIT: invalid number of results %q", value)
+			}
+		}
+	}
+	if len(ifaces) > 0 {
+		a.Ifaces = strings.Join(ifaces, ",")
+	}
+
+	return nil
+}
+
+func (a *Args) applySQLOrder(tokens []sqlToken) error {
+	if len(tokens) < 2 || !tokens[0].isKeyword("by") || tokens[1].kind != sqlTokenWord {
+		return errors.New("expected ORDER BY <column> [ASC|DESC]")
+	}
+	a.SortBy = strings.ToLower(tokens[1].value)
+
+	// without an explicit direction, the default one of the column applies
+	switch {
+	case len(tokens) == 2:
+		a.SortAscending, a.SortDescending = false, false
+	case len(tokens) == 3 && tokens[2].isKeyword("asc"):
+		a.SortAscending, a.SortDescending = true, false
+	case len(tokens) == 3 && tokens[2].isKeyword("desc"):
+		a.SortAscending, a.SortDescending = false, true
+	default:
+		return errors.New("expected ORDER BY <column> [ASC|DESC]")
+	}
+	return nil
+}
+
+type sqlClause struct {
+	keyword string
+	tokens  []sqlToken
+}
+
+// splitSQLClauses splits the tokens following SELECT into the individual clauses
+func splitSQLClauses(tokens []sqlToken) ([]sqlClause, error) {
+	var (
+		clauses = []sqlClause{{keyword: sqlSelect}}
+		seen    = map[string]struct{}{sqlSelect: {}}
+		depth   int
+	)
+	for _, tok := range tokens {
+		switch {
+		case tok.kind == sqlTokenOpen:
+			depth++
+		case tok.kind == sqlTokenClose:
+			depth--
+		case depth == 0 && tok.kind == sqlTokenWord:
+			keyword := strings.ToLower(tok.value)
+			if !slices.Contains(sqlClauses, keyword) {
+				break
+			}
+			if _, exists := seen[keyword]; exists {
+				return nil, fmt.Errorf("duplicate %s clause", strings.ToUpper(keyword))
+			}
+			seen[keyword] = struct{}{}
+			clauses = append(clauses, sqlClause{keyword: keyword})
+			continue
+		}
+		clauses[len(clauses)-1].tokens = append(clauses[len(clauses)-1].tokens, tok)
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+	for _, clause := range clauses {
+		if len(clause.tokens) == 0 {
+			return nil, fmt.Errorf("empty %s clause", strings.ToUpper(clause.keyword))
+		}
+	}
+	return clauses, nil
+}
+
+// sqlAttributes translates the SELECT list into the query attributes. Since the counters are always
+// reported, bytes and packets are accepted but omitted
+func sqlAttributes(tokens []sqlToken) (string, error) {
+	list, err := sqlList(tokens)
+	if err != nil {
+		return "", fmt.Errorf("SELECT: %w", err)
+	}
+
+	var attributes []string
+	for _, attr := range list {
+		switch attr = strings.ToLower(attr); attr {
+		case "bytes", "packets":
+		case "*":
+			attributes = append(attributes, "raw")
+		default:
+			attributes = append(attributes, attr)
+		}
+	}
+	if len(attributes) == 0 {
+		return "", errors.New("SELECT: no attributes selected")
+	}
+	return strings.Join(attributes, ","), nil
+}
+
+// sqlList parses a comma-separated list of values
+func sqlList(tokens []sqlToken) (list []string, err error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("empty list")
+	}
+	for i, tok := range tokens {
+		if i%2 == 1 {
+			if tok.kind != sqlTokenComma {
+				return nil, fmt.Errorf("expected comma, got %q", tok.value)
+			}
+			continue
+		}
+		if tok.kind != sqlTokenWord && tok.kind != sqlTokenString {
+			return nil, fmt.Errorf("expected value, got %q", tok.value)
+		}
+		list = append(list, tok.value)
+	}
+	if len(tokens)%2 == 0 {
+		return nil, errors.New("trailing comma")
+	}
+	return list, nil
+}
+
+// sqlValue parses a single value
+func sqlValue(tokens []sqlToken) (string, error) {
+	if len(tokens) != 1 || (tokens[0].kind != sqlTokenWord && tokens[0].kind != sqlTokenString) {
+		return "", errors.New("expected a single value")
+	}
+	return tokens[0].value, nil
+}
+
+// sqlCondition translates the WHERE clause into a condition. Conditions on the interface are
+// extracted from it (which requires them to be combined with the remaining condition via AND)
+func sqlCondition(tokens []sqlToken) (condition string, ifaces []string, err error) {
+	var (
+		conjuncts [][]sqlToken
+		current   []sqlToken
+		depth     int
+		hasOr     bool
+	)
+	for _, tok := range tokens {
+		switch {
+		case tok.kind == sqlTokenOpen:
+			depth++
+		case tok.kind == sqlTokenClose:
+			depth--
+		case depth == 0 && tok.isKeyword("or"):
+			hasOr = true
+		case depth == 0 && tok.isKeyword("and"):
+			conjuncts, current = append(conjuncts, current), nil
+			continue
+		}
+		current = append(current, tok)
+	}
+	conjuncts = append(conjuncts, current)
+
+	var parts []string
+	for _, conjunct := range conjuncts {
+		if len(conjunct) > 0 && conjunct[0].isKeyword("iface") && !hasOr {
+			list, err := sqlIfaceCondition(conjunct)
+			if err != nil {
+				return "", nil, err
+			}
+			ifaces = append(ifaces, list...)
+			continue
+		}
+
+		part, err := translateSQLCondition(conjunct)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, " & "), ifaces, nil
+}
+
+// sqlIfaceCondition parses a condition on the interface (iface = <iface> or iface IN (<ifaces>))
+func sqlIfaceCondition(tokens []sqlToken) ([]string, error) {
+	switch {
+	case len(tokens) == 3 && tokens[1].kind == sqlTokenOp && tokens[1].value == "=":
+		return sqlList(tokens[2:])
+	case len(tokens) > 3 && tokens[1].isKeyword("in") && tokens[2].kind == sqlTokenOpen && tokens[len(tokens)-1].kind == sqlTokenClose:
+		return sqlList(tokens[3 : len(tokens)-1])
+	}
+	return nil, errors.New("unsupported iface condition (expected iface = <iface> or iface IN (<ifaces>))")
+}
+
+// translateSQLCondition translates a (part of a) WHERE clause into the condition grammar
+func translateSQLCondition(tokens []sqlToken) (string, error) {
+	if len(tokens) == 0 {
+		return "", errors.New("empty condition")
+	}
+
+	var out []string
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.isKeyword("iface"):
+			return "", errors.New("iface conditions can only be combined with the remaining condition via AND")
+		case tok.isKeyword("and"):
+			out = append(out, "&")
+		case tok.isKeyword("or"):
+			out = append(out, "|")
+		case tok.isKeyword("not") && !(i+1 < len(tokens) && tokens[i+1].isKeyword("in")):
+			out = append(out, "!")
+		case tok.kind == sqlTokenOp && tok.value == "<>":
+			out = append(out, "!=")
+		case tok.kind == sqlTokenComma:
+			return "", errors.New("unexpected comma")
+
+		// attr IN (a, b) / attr NOT IN (a, b) are expanded into a disjunction of equality conditions
+		case tok.kind == sqlTokenWord && i+1 < len(tokens) && (tokens[i+1].isKeyword("in") || tokens[i+1].isKeyword("not")):
+			negate := tokens[i+1].isKeyword("not")
+			start := i + 2
+			if negate {
+				start++
+				if start-1 >= len(tokens) || !tokens[start-1].isKeyword("in") {
+					return "", fmt.Errorf("expected IN after %s NOT", tok.value)
+				}
+			}
+			end := start
+			for end < len(tokens) && tokens[end].kind != sqlTokenClose {
+				end++
+			}
+			if start >= len(tokens) || tokens[start].kind != sqlTokenOpen || end == len(tokens) {
+				return "", fmt.Errorf("expected list of values after %s IN", tok.value)
+			}
+			values, err := sqlList(tokens[start+1 : end])
+			if err != nil {
+				return "", fmt.Errorf("%s IN: %w", tok.value, err)
+			}
+
+			conditions := make([]string, 0, len(values))
+			for _, value := range values {
+				conditions = append(conditions, fmt.Sprintf("%s = %s", tok.value, value))
+			}
+			expanded := "(" + strings.Join(conditions, " | ") + ")"
+			if negate {
+				expanded = "!" + expanded
+			}
+			out = append(out, expanded)
+			i = end
+		default:
+			out = append(out, tok.value)
+		}
+	}
+	return strings.Join(out, " "), nil
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenWord sqlTokenKind = iota
+	sqlTokenString
+	sqlTokenOp
+	sqlTokenComma
+	sqlTokenOpen
+	sqlTokenClose
+)
+
+type sqlToken struct {
+	kind  sqlTokenKind
+	value string
+}
+
+func (t sqlToken) isKeyword(keyword string) bool {
+	return t.kind == sqlTokenWord && strings.EqualFold(t.value, keyword)
+}
+
+// lexSQL splits an SQL-like statement into its tokens
+func lexSQL(stmt string) (tokens []sqlToken, err error) {
+	runes := []rune(stmt)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", i)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenString, value: string(runes[i+1 : end])})
+			i = end + 1
+		case r == ',':
+			tokens = append(tokens, sqlToken{kind: sqlTokenComma, value: ","})
+			i++
+		case r == '(':
+			tokens = append(tokens, sqlToken{kind: sqlTokenOpen, value: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, sqlToken{kind: sqlTokenClose, value: ")"})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			end := i + 1
+			for end < len(runes) && strings.ContainsRune("=<>", runes[end]) {
+				end++
+			}
+			op := string(runes[i:end])
+			switch op {
+			case "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+				if op == "==" {
+					op = "="
+				}
+				tokens = append(tokens, sqlToken{kind: sqlTokenOp, value: op})
+			case "!":
+				tokens = append(tokens, sqlToken{kind: sqlTokenWord, value: "not"})
+			default:
+				return nil, fmt.Errorf("invalid operator %q at position %d", op, i)
+			}
+			i = end
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`'",()=!<>`, runes[end]) {
+				end++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenWord, value: string(runes[i:end])})
+			i = end
+		}
+	}
+	return tokens, nil
+}
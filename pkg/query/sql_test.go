@@ -0,0 +1,85 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySQL(t *testing.T) {
+	var tests = []struct {
+		name     string
+		stmt     string
+		expected Args
+	}{
+		{"full statement",
+			"SELECT sip,dip,bytes WHERE dport=443 AND iface='eth0' SINCE -24h LIMIT 50",
+			Args{Query: "sip,dip", Ifaces: "eth0", Condition: "dport = 443", First: "-24h", NumResults: 50},
+		},
+		{"lower case",
+			"select sip, dport from eth0, eth1 where proto = tcp order by packets asc",
+			Args{Query: "sip,dport", Ifaces: "eth0,eth1", Condition: "proto = tcp", SortBy: "packets", SortAscending: true},
+		},
+		{"time range",
+			`SELECT time,sip UNTIL "2024-01-02 10:00" SINCE '2024-01-01 10:00'`,
+			Args{Query: "time,sip", First: "2024-01-01 10:00", Last: "2024-01-02 10:00"},
+		},
+		{"all attributes",
+			"SELECT * FROM any",
+			Args{Query: "raw", Ifaces: "any"},
+		},
+		{"boolean operators",
+			"SELECT sip WHERE (dport = 80 OR dport = 443) AND NOT snet = 10.0.0.0/8 AND sip <> 'fe80::1'",
+			Args{Query: "sip", Condition: "( dport = 80 | dport = 443 ) & ! snet = 10.0.0.0/8 & sip != fe80::1"},
+		},
+		{"in lists",
+			"SELECT dport WHERE iface IN ('eth0', 'eth1') AND dport IN (80, 443) AND proto NOT IN (udp)",
+			Args{Query: "dport", Ifaces: "eth0,eth1", Condition: "(dport = 80 | dport = 443) & !(proto = udp)"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.True(t, IsSQL(test.stmt))
+
+			var args Args
+			require.Nil(t, args.ApplySQL(test.stmt))
+			require.Equal(t, test.expected, args)
+		})
+	}
+}
+
+func TestApplySQLRetainsArgs(t *testing.T) {
+	args := NewArgs("", "eth0", WithFormat("json"), WithCondition("dport = 53"))
+	require.Nil(t, args.ApplySQL("SELECT sip"))
+	require.Equal(t, "sip", args.Query)
+	require.Equal(t, "eth0", args.Ifaces)
+	require.Equal(t, "dport = 53", args.Condition)
+	require.Equal(t, "json", args.Format)
+}
+
+func TestApplySQLInvalid(t *testing.T) {
+	for _, stmt := range []string{
+		"",
+		"sip,dip",
+		"SELECT",
+		"SELECT bytes",
+		"SELECT sip,",
+		"SELECT sip WHERE",
+		"SELECT sip LIMIT ten",
+		"SELECT sip LIMIT 10 LIMIT 20",
+		"SELECT sip ORDER bytes",
+		"SELECT sip WHERE dport = 'unterminated",
+		"SELECT sip WHERE (dport = 80",
+		"SELECT sip WHERE dport = 80 OR iface = eth0",
+		"SELECT sip WHERE iface != eth0",
+		"SELECT sip WHERE dport IN 80",
+		"SELECT sip WHERE dport =< 80",
+	} {
+		t.Run(stmt, func(t *testing.T) {
+			var args Args
+			require.ErrorIs(t, args.ApplySQL(stmt), ErrInvalidSQL)
+		})
+	}
+	require.False(t, IsSQL("sip,dip"))
+}
@@ -22,6 +22,9 @@ type Statement struct {
 	attributes []types.Attribute `json:"-"`
 	Condition  string            `json:"condition,omitempty"`
 
+	// fail if a hostname in the condition resolves to multiple addresses
+	StrictHostnames bool `json:"strict_hostnames,omitempty"`
+
 	// which direction is added
 	Direction types.Direction `json:"direction"`
 
@@ -48,6 +51,57 @@ type Statement struct {
 
 	// request live flow data (in addition to DB)
 	Live bool `json:"live,omitempty"`
+
+	// maximum duration of query processing (zero means no deadline)
+	Deadline time.Duration `json:"deadline,omitempty"`
+
+	// report per-stage timings of the query
+	Profile bool `json:"profile,omitempty"`
+
+	// report dropped packets and the traffic estimated to be missing due to them
+	Drops bool `json:"drops,omitempty"`
+
+	// report the hosts / DBs the data originated from and how it was obtained
+	Provenance bool `json:"provenance,omitempty"`
+
+	// network zones to restrict the queried interfaces to (if unset, all interfaces are queried)
+	Zones []string `json:"zones,omitempty"`
+
+	// flow tags to restrict the query to (if unset, all flows are considered)
+	Tags []string `json:"tags,omitempty"`
+
+	// recurring time windows to restrict the query to (if unset, the whole time range is
+	// considered), evaluated in the given time zone (the local one if unset)
+	TimeWindows     types.TimeWindows `json:"time_windows,omitempty"`
+	TimeWindowsZone string            `json:"time_windows_zone,omitempty"`
+
+	// user-defined port classes used for the dportclass attribute (if unset, the default
+	// port classes are used)
+	PortClasses types.PortClasses `json:"port_classes,omitempty"`
+
+	// prefix groups by which the source / destination IPs of the result rows are bucketed
+	// into a traffic matrix (if unset, no matrix is computed)
+	MatrixSrcGroups types.PrefixGroups `json:"matrix_src_groups,omitempty"`
+	MatrixDstGroups types.PrefixGroups `json:"matrix_dst_groups,omitempty"`
+
+	// baseline time range the result rows are compared against (if set, only rows whose
+	// attribute combination did not occur during the baseline are returned)
+	BaselineFirst int64 `json:"baseline_from,omitempty"`
+	BaselineLast  int64 `json:"baseline_to,omitempty"`
+}
+
+// HasBaseline returns whether the statement requests new talkers, i.e. the rows absent during
+// the baseline time range
+func (s *Statement) HasBaseline() bool {
+	return s.BaselineLast > 0
+}
+
+// TimeWindowsLocation returns the location the time windows are evaluated in
+func (s *Statement) TimeWindowsLocation() (*time.Location, error) {
+	if s.TimeWindowsZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.TimeWindowsZone)
 }
 
 // String prints the executable statement in human-readable form
@@ -56,6 +110,15 @@ func (s *Statement) String() string {
 		s.QueryType,
 		s.Ifaces,
 	)
+	if len(s.Zones) > 0 {
+		str += fmt.Sprintf(", zones: %s", s.Zones)
+	}
+	if len(s.Tags) > 0 {
+		str += fmt.Sprintf(", tags: %s", s.Tags)
+	}
+	if len(s.TimeWindows) > 0 {
+		str += fmt.Sprintf(", time-windows: %s", s.TimeWindows)
+	}
 	if s.Condition != "" {
 		str += fmt.Sprintf(", condition: %s", s.Condition)
 	}
@@ -65,6 +128,12 @@ func (s *Statement) String() string {
 		tFrom.Format(time.ANSIC),
 		tTo.Format(time.ANSIC),
 	)
+	if s.HasBaseline() {
+		str += fmt.Sprintf(", baseline-from: %s, baseline-to: %s",
+			time.Unix(s.BaselineFirst, 0).Format(time.ANSIC),
+			time.Unix(s.BaselineLast, 0).Format(time.ANSIC),
+		)
+	}
 	if s.DNSResolution.Enabled {
 		str += fmt.Sprintf(", dns-resolution: %t", s.DNSResolution.Enabled)
 	}
@@ -16,6 +16,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -38,11 +39,20 @@ const (
 	OutcolHostname
 	OutcolHostID
 	OutcolIface
+	OutcolZone
+	OutcolTag
+	OutcolProcess
+	OutcolVLAN
+	OutcolSMAC
+	OutcolDMAC
+	OutcolTCPFlags
+	OutcolDSCP
 	// attributes
 	OutcolSIP
 	OutcolDIP
 	OutcolDport
 	OutcolProto
+	OutcolDportClass
 	// counters
 	OutcolInPkts
 	OutcolInPktsPercent
@@ -65,6 +75,15 @@ const (
 	CountOutcol
 )
 
+// OutcolCustom denotes the output column of the first custom attribute of a query. The columns
+// of all further custom attributes follow in the order of the query
+const OutcolCustom = CountOutcol
+
+// isCustom returns if the column holds a custom attribute
+func (c OutputColumn) isCustom() bool {
+	return c >= OutcolCustom
+}
+
 const (
 	packetsStr = "packets"
 	bytesStr   = "bytes"
@@ -88,8 +107,38 @@ func columns(selector types.LabelSelector, attributes []types.Attribute, d types
 	if selector.Iface {
 		cols = append(cols, OutcolIface)
 	}
+	if selector.Zone {
+		cols = append(cols, OutcolZone)
+	}
+	if selector.Tag {
+		cols = append(cols, OutcolTag)
+	}
+	if selector.Process {
+		cols = append(cols, OutcolProcess)
+	}
+	if selector.VLAN {
+		cols = append(cols, OutcolVLAN)
+	}
+	if selector.SMAC {
+		cols = append(cols, OutcolSMAC)
+	}
+	if selector.DMAC {
+		cols = append(cols, OutcolDMAC)
+	}
+	if selector.TCPFlags {
+		cols = append(cols, OutcolTCPFlags)
+	}
+	if selector.DSCP {
+		cols = append(cols, OutcolDSCP)
+	}
 
+	var numCustom OutputColumn
 	for _, attrib := range attributes {
+		if _, isCustom := attrib.(types.CustomAttribute); isCustom {
+			cols = append(cols, OutcolCustom+numCustom)
+			numCustom++
+			continue
+		}
 		switch attrib.Name() {
 		case types.SIPName:
 			cols = append(cols, OutcolSIP)
@@ -99,6 +148,8 @@ func columns(selector types.LabelSelector, attributes []types.Attribute, d types
 			cols = append(cols, OutcolProto)
 		case types.DportName:
 			cols = append(cols, OutcolDport)
+		case types.DportClassName:
+			cols = append(cols, OutcolDportClass)
 		}
 	}
 
@@ -155,11 +206,27 @@ func tryLookup(ips2domains map[string]string, ip string) string {
 	return ip
 }
 
+// customAttributeNames returns the names of all custom attributes in the order of their
+// output columns
+func customAttributeNames(attributes []types.Attribute) (names []string) {
+	for _, attrib := range attributes {
+		if _, isCustom := attrib.(types.CustomAttribute); isCustom {
+			names = append(names, attrib.Name())
+		}
+	}
+	return
+}
+
 // extract extracts the string that needs to be printed for the given OutputColumn.
 // The format argument is used to format the string appropriatly for the desired
 // output format. ips2domains is needed for reverse DNS lookups. totals is needed
-// for percentage calculations. e contains the actual data that is extracted.
-func extract(format Formatter, ips2domains map[string]string, totals types.Counters, row Row, col OutputColumn) string {
+// for percentage calculations. custom holds the names of the custom attributes.
+// e contains the actual data that is extracted.
+func extract(format Formatter, ips2domains map[string]string, totals types.Counters, custom []string, row Row, col OutputColumn) string {
+	if col.isCustom() {
+		return format.String(row.Attributes.Custom.Get(custom[col-OutcolCustom]))
+	}
+
 	nz := func(u uint64) uint64 {
 		if u == 0 {
 			u = (1 << 64) - 1
@@ -172,6 +239,26 @@ func extract(format Formatter, ips2domains map[string]string, totals types.Count
 		return format.Time(row.Labels.Timestamp.Unix())
 	case OutcolIface:
 		return format.String(row.Labels.Iface)
+	case OutcolZone:
+		return format.String(row.Labels.Zone)
+	case OutcolTag:
+		return format.String(row.Labels.Tag)
+	case OutcolProcess:
+		return format.String(row.Labels.Process)
+	case OutcolVLAN:
+		// untagged flows are printed without VLAN ID
+		if row.Labels.VLAN == 0 {
+			return format.String("")
+		}
+		return format.String(strconv.Itoa(int(row.Labels.VLAN)))
+	case OutcolSMAC:
+		return format.String(row.Labels.SMAC)
+	case OutcolDMAC:
+		return format.String(row.Labels.DMAC)
+	case OutcolTCPFlags:
+		return format.String(row.Labels.TCPFlags)
+	case OutcolDSCP:
+		return format.String(row.Labels.DSCP)
 	case OutcolHostname:
 		return format.String(row.Labels.Hostname)
 	case OutcolHostID:
@@ -185,6 +272,8 @@ func extract(format Formatter, ips2domains map[string]string, totals types.Count
 		return format.String(fmt.Sprintf("%d", row.Attributes.DstPort))
 	case OutcolProto:
 		return format.String(protocols.GetIPProto(int(row.Attributes.IPProto)))
+	case OutcolDportClass:
+		return format.String(row.Attributes.DstPortClass)
 
 	case OutcolInBytes, OutcolBothBytesRcvd:
 		return format.Size(row.Counters.BytesRcvd)
@@ -237,7 +326,7 @@ func extractTotal(format Formatter, totals types.Counters, col OutputColumn) str
 }
 
 // describe comes up with a nice string for the given SortOrder and types.Direction.
-func describe(o SortOrder, d types.Direction) string {
+func describe(o SortOrder, d types.Direction, aliases ColumnAliases) string {
 	result := "accumulated "
 	switch o {
 	case SortPackets:
@@ -246,6 +335,8 @@ func describe(o SortOrder, d types.Direction) string {
 		result += "data volume "
 	case SortTime:
 		return "first packet time" // TODO(lob): Is this right?
+	case SortSrcIP, SortDstIP, SortDstPort, SortProto, SortIface:
+		return aliases.Name(o.String()) + " column"
 	}
 
 	switch d {
@@ -290,12 +381,24 @@ type basePrinter struct {
 	// query attributes
 	attributes []types.Attribute
 
+	// names of the custom attributes among the query attributes
+	custom []string
+
 	ips2domains map[string]string
 
 	// needed for computing percentages
 	totals types.Counters
 
 	cols []OutputColumn
+
+	// only print the summary / footer, skipping all rows
+	summaryOnly bool
+
+	// user-defined names of label / attribute columns
+	aliases ColumnAliases
+
+	// omit all elements varying between runs of the same query (e.g. runtimes)
+	deterministic bool
 }
 
 // newBasePrinter sets up the basic printing facilities
@@ -308,13 +411,25 @@ func newBasePrinter(
 	ips2domains map[string]string,
 	totals types.Counters,
 ) basePrinter {
-	result := basePrinter{output, sort, selector, direction, attributes, ips2domains, totals,
-		columns(selector, attributes, direction),
+	result := basePrinter{output, sort, selector, direction, attributes, customAttributeNames(attributes), ips2domains, totals,
+		columns(selector, attributes, direction), false, nil, false,
 	}
 
 	return result
 }
 
+// columnHeaders returns the headers of all output columns (indexed by OutputColumn) for the flat,
+// single-line header of machine-readable formats
+func (b basePrinter) columnHeaders() []string {
+	headers := append(b.aliases.columns(), []string{
+		packetsStr, "%", "data vol.", "%",
+		packetsStr, "%", "data vol.", "%",
+		packetsStr, "%", "data vol.", "%",
+		"packets received", "packets sent", "%", "data vol. received", "data vol. sent", "%",
+	}...)
+	return append(headers, b.aliases.customColumns(b.custom)...)
+}
+
 // PrinterConfig configures printer behavior
 type PrinterConfig struct {
 	Format        string
@@ -330,6 +445,9 @@ type PrinterConfig struct {
 	ipDomainMapping   map[string]string
 
 	printQueryStats bool
+	summaryOnly     bool
+	columnAliases   ColumnAliases
+	deterministic   bool
 }
 
 // PrinterOption allows to configure the printer
@@ -350,9 +468,34 @@ func WithQueryStats(b bool) PrinterOption {
 	}
 }
 
+// WithSummaryOnly sets whether only the summary / footer should be printed (omitting all rows)
+func WithSummaryOnly(b bool) PrinterOption {
+	return func(pc *PrinterConfig) {
+		pc.summaryOnly = b
+	}
+}
+
+// WithColumnAliases sets user-defined names for label / attribute columns (e.g. "client" instead of "sip")
+func WithColumnAliases(aliases ColumnAliases) PrinterOption {
+	return func(pc *PrinterConfig) {
+		pc.columnAliases = aliases
+	}
+}
+
+// WithDeterministic sets whether all elements varying between runs of the same query (e.g. the query
+// runtime) should be omitted from the footer, see also Result.MakeDeterministic
+func WithDeterministic(b bool) PrinterOption {
+	return func(pc *PrinterConfig) {
+		pc.deterministic = b
+	}
+}
+
 // NewTablePrinter instantiates a new table printer
 func NewTablePrinter(output io.Writer, cfg *PrinterConfig) (TablePrinter, error) {
 	b := newBasePrinter(output, cfg.SortOrder, cfg.LabelSelector, cfg.Direction, cfg.Attributes, cfg.ipDomainMapping, cfg.Totals)
+	b.summaryOnly = cfg.summaryOnly
+	b.aliases = cfg.columnAliases
+	b.deterministic = cfg.deterministic
 
 	var printer TablePrinter
 	switch cfg.Format {
@@ -360,6 +503,10 @@ func NewTablePrinter(output io.Writer, cfg *PrinterConfig) (TablePrinter, error)
 		printer = NewTextTablePrinter(b, cfg.NumFlows, cfg.resolutionTimeout, cfg.printQueryStats)
 	case types.FormatCSV:
 		printer = NewCSVTablePrinter(b)
+	case types.FormatXLSX:
+		printer = NewXLSXTablePrinter(b)
+	case types.FormatParquet:
+		printer = NewParquetTablePrinter(b)
 	default:
 		return nil, fmt.Errorf("unknown output format %s", cfg.Format)
 	}
@@ -414,12 +561,12 @@ func NewCSVTablePrinter(b basePrinter) *CSVTablePrinter {
 		make([]string, 0, len(b.cols)),
 	}
 
-	headers := append(types.AllColumns(), []string{
-		packetsStr, "%", "data vol.", "%",
-		packetsStr, "%", "data vol.", "%",
-		packetsStr, "%", "data vol.", "%",
-		"packets received", "packets sent", "%", "data vol. received", "data vol. sent", "%",
-	}...)
+	headers := b.columnHeaders()
+
+	// the column headers are meaningless if no rows are printed
+	if b.summaryOnly {
+		return &c
+	}
 
 	for _, col := range c.cols {
 		c.fields = append(c.fields, headers[col])
@@ -436,13 +583,16 @@ func NewCSVTablePrinter(b basePrinter) *CSVTablePrinter {
 func (c *CSVTablePrinter) AddRow(row Row) error {
 	c.fields = c.fields[:0]
 	for _, col := range c.cols {
-		c.fields = append(c.fields, extract(CSVFormatter{}, c.ips2domains, c.totals, row, col))
+		c.fields = append(c.fields, extract(CSVFormatter{}, c.ips2domains, c.totals, c.custom, row, col))
 	}
 	return c.writer.Write(c.fields)
 }
 
 // AddRows adds several flow entries to the CSVTablePrinter
 func (c *CSVTablePrinter) AddRows(ctx context.Context, rows Rows) error {
+	if c.summaryOnly {
+		return nil
+	}
 	return addRows(ctx, c, rows)
 }
 
@@ -460,16 +610,30 @@ func (c *CSVTablePrinter) Footer(_ context.Context, result *Result) error {
 	summaryEntries[OutcolBothBytesRcvd] = "Received data volume (bytes)"
 	summaryEntries[OutcolBothBytesSent] = "Sent data volume (bytes)"
 	for _, col := range c.cols {
-		if summaryEntries[col] != "" {
+		if !col.isCustom() && summaryEntries[col] != "" {
 			if err := c.writer.Write([]string{summaryEntries[col], extractTotal(CSVFormatter{}, c.totals, col)}); err != nil {
 				return err
 			}
 		}
 	}
-	if err := c.writer.Write([]string{"Sorting and flow direction", describe(c.sort, c.direction)}); err != nil {
+	if err := c.writer.Write([]string{"Sorting and flow direction", describe(c.sort, c.direction, c.aliases)}); err != nil {
+		return err
+	}
+	if err := c.writer.Write([]string{"Interface", strings.Join(result.Summary.Interfaces, ",")}); err != nil {
 		return err
 	}
-	return c.writer.Write([]string{"Interface", strings.Join(result.Summary.Interfaces, ",")})
+	if provenance := result.Summary.Provenance; provenance != nil {
+		for _, source := range provenance.Sources {
+			label := "Source"
+			if source.Hostname != "" {
+				label += " " + source.Hostname
+			}
+			if err := c.writer.Write([]string{label, source.String()}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // Print flushes the writer and actually prints out all CSV rows contained in the table printer
@@ -555,15 +719,18 @@ func NewTextTablePrinter(b basePrinter, numFlows int, resolveTimeout time.Durati
 	header1[OutcolBothBytesRcvd] = bytesStr
 	header1[OutcolBothBytesSent] = bytesStr
 
-	var header2 = append(types.AllColumns(), []string{
+	var header2 = append(b.aliases.columns(), []string{
 		"in", "%", "in", "%",
 		"out", "%", "out", "%",
 		"in+out", "%", "in+out", "%",
 		"in", "out", "%", "in", "out", "%",
 	}...)
+	header2 = append(header2, b.aliases.customColumns(b.custom)...)
 
 	for _, col := range t.cols {
-		fmt.Fprint(t.writer, header1[col])
+		if !col.isCustom() {
+			fmt.Fprint(t.writer, header1[col])
+		}
 		fmt.Fprint(t.writer, "\t")
 
 	}
@@ -596,7 +763,7 @@ func addRows(ctx context.Context, p TablePrinter, rows Rows) error {
 // AddRow adds a flow entry to the table printer
 func (t *TextTablePrinter) AddRow(row Row) error {
 	for _, col := range t.cols {
-		fmt.Fprintf(t.writer, "%s\t", extract(TextFormatter{}, t.ips2domains, t.totals, row, col))
+		fmt.Fprintf(t.writer, "%s\t", extract(TextFormatter{}, t.ips2domains, t.totals, t.custom, row, col))
 	}
 	fmt.Fprintln(t.writer)
 	t.numPrinted++
@@ -605,16 +772,26 @@ func (t *TextTablePrinter) AddRow(row Row) error {
 
 // AddRows adds several flow entries to the table printer
 func (t *TextTablePrinter) AddRows(ctx context.Context, rows Rows) error {
+	if t.summaryOnly {
+		return nil
+	}
 	return addRows(ctx, t, rows)
 }
 
 const (
-	hostsKey      = "Hosts"
-	ifaceKey      = "Interface"
-	queryStatsKey = "Query stats"
-	sortedByKey   = "Sorted by"
-	totalsKey     = "Totals"
-	traceIDKey    = "Trace ID"
+	accountingKey  = "Byte accounting"
+	approximateKey = "Approximate"
+	baselineKey    = "New talkers vs."
+	clockSkewKey   = "Max. clock skew"
+	dropsKey       = "Dropped packets"
+	hostsKey       = "Hosts"
+	ifaceKey       = "Interface"
+	policyKey      = "Resource policy"
+	queryStatsKey  = "Query stats"
+	sortedByKey    = "Sorted by"
+	totalsKey      = "Totals"
+	traceIDKey     = "Trace ID"
+	truncatedKey   = "Truncated"
 )
 
 // Footer appends the summary to the table printer
@@ -632,17 +809,19 @@ func (t *TextTablePrinter) Footer(ctx context.Context, result *Result) error {
 	isTotal[OutcolBothBytesSent] = true
 
 	// line with ... in the right places to separate totals
-	for _, col := range t.cols {
-		if isTotal[col] && t.numPrinted < t.numFlows {
-			fmt.Fprint(t.writer, "...")
+	if !t.summaryOnly {
+		for _, col := range t.cols {
+			if !col.isCustom() && isTotal[col] && t.numPrinted < t.numFlows {
+				fmt.Fprint(t.writer, "...")
+			}
+			fmt.Fprint(t.writer, "\t")
 		}
-		fmt.Fprint(t.writer, "\t")
+		fmt.Fprintln(t.writer)
 	}
-	fmt.Fprintln(t.writer)
 
 	// Totals
 	for _, col := range t.cols {
-		if isTotal[col] {
+		if !col.isCustom() && isTotal[col] {
 			fmt.Fprint(t.writer, extractTotal(TextFormatter{}, t.totals, col))
 		}
 		fmt.Fprint(t.writer, "\t")
@@ -689,18 +868,72 @@ func (t *TextTablePrinter) Footer(ctx context.Context, result *Result) error {
 	// attach distributed query information from hosts if available
 	if len(result.HostsStatuses) > 1 {
 		t.footerWriter.WriteEntry(iKey+" / "+hostsKey, ifaceSummary+" on "+result.HostsStatuses.Summary())
+
+		// skew shifts the time bins of a host relative to those of the others, hence it is surfaced
+		if host, skew := result.HostsStatuses.MaxClockSkew(); skew.Round(time.Millisecond) != 0 {
+			t.footerWriter.WriteEntry(clockSkewKey, "%s (%s)", skew.Round(time.Millisecond), host)
+		}
 	} else {
 		t.footerWriter.WriteEntry(ifaceKey, ifaceSummary)
 	}
 
-	t.footerWriter.WriteEntry(sortedByKey, describe(t.sort, t.direction))
+	t.footerWriter.WriteEntry(sortedByKey, describe(t.sort, t.direction, t.aliases))
+
+	// the volumes of interfaces accounted on different bases are not directly comparable
+	switch bases := result.Summary.ByteAccounting; len(bases) {
+	case 0:
+	case 1:
+		t.footerWriter.WriteEntry(accountingKey, bases[0])
+	default:
+		t.footerWriter.WriteEntry(accountingKey, "%s (mixed, volumes are not directly comparable)", strings.Join(bases, ", "))
+	}
 
 	result.Query.PrintFooter(t.footerWriter)
-	t.footerWriter.WriteEntry(queryStatsKey, "displayed top %s hits out of %s in %s",
-		formatting.CountSmall(uint64(result.Summary.Hits.Displayed), false),
-		formatting.CountSmall(uint64(result.Summary.Hits.Total), false),
-		textFormatter.Duration(result.Summary.Timings.QueryDuration),
-	)
+	var queryStats string
+	if t.summaryOnly {
+		queryStats = fmt.Sprintf("%s hits",
+			formatting.CountSmall(uint64(result.Summary.Hits.Total), false),
+		)
+	} else {
+		queryStats = fmt.Sprintf("displayed top %s hits out of %s",
+			formatting.CountSmall(uint64(result.Summary.Hits.Displayed), false),
+			formatting.CountSmall(uint64(result.Summary.Hits.Total), false),
+		)
+	}
+	if !t.deterministic {
+		queryStats += " in " + textFormatter.Duration(result.Summary.Timings.QueryDuration)
+	}
+	t.footerWriter.WriteEntry(queryStatsKey, "%s", queryStats)
+
+	if baseline := result.Summary.Baseline; baseline != nil {
+		t.footerWriter.WriteEntry(baselineKey, "[%s, %s] (%s keys)",
+			baseline.First.Format(types.DefaultTimeOutputFormat),
+			baseline.Last.Format(types.DefaultTimeOutputFormat),
+			formatting.CountSmall(uint64(baseline.Keys), false),
+		)
+	}
+
+	if result.Summary.TruncatedByDeadline {
+		t.footerWriter.WriteEntry(truncatedKey, "query deadline reached, results are partial")
+	}
+	if result.Summary.TopNApproximate {
+		t.footerWriter.WriteEntry(approximateKey, "hosts returned their top rows only, rows may be missing or ranked incorrectly")
+	}
+
+	for _, policy := range result.Summary.ResourcePolicies {
+		t.footerWriter.WriteEntry(policyKey, "%s on %s (%d processing units, max. %d%% of memory)",
+			policy.Name, policy.Hostname, policy.ProcessingUnits, policy.MaxMemPct,
+		)
+	}
+
+	// the individual time bins are omitted here, they are only available in machine-readable output formats
+	if drops := result.Summary.Drops; drops != nil {
+		t.footerWriter.WriteEntry(dropsKey, "%s (est. %s / %.2f%% of traffic missing)",
+			formatting.CountSmall(drops.Packets, false),
+			formatting.SizeSmall(drops.EstimatedMissingBytes, false),
+			drops.EstimatedMissingPct,
+		)
+	}
 
 	if t.printQueryStats {
 		stats := result.Summary.Stats
@@ -725,8 +958,16 @@ func (t *TextTablePrinter) Footer(ctx context.Context, result *Result) error {
 		)
 	}
 
+	// per-stage timings are only available if profiling was requested for the query
+	if profile := result.Summary.Profile; profile != nil {
+		for _, stage := range profile.stages() {
+			// stages commonly take less than a millisecond, hence the finer resolution
+			t.footerWriter.WriteEntry(stage.name, "%s", stage.duration.Round(time.Microsecond))
+		}
+	}
+
 	// provide the trace ID in case it was provided in a distributed call
-	if len(result.HostsStatuses) > 1 {
+	if len(result.HostsStatuses) > 1 && !t.deterministic {
 		sc := trace.SpanFromContext(ctx).SpanContext()
 		if sc.HasTraceID() {
 			t.footerWriter.WriteEntry(traceIDKey, sc.TraceID().String())
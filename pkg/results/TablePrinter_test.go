@@ -0,0 +1,243 @@
+package results
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+)
+
+func testPrinterResult() *Result {
+	r := New()
+	r.Rows = Rows{
+		{
+			Attributes: Attributes{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), IPProto: 6, DstPort: 443},
+			Counters:   types.Counters{BytesRcvd: 100, BytesSent: 200, PacketsRcvd: 1, PacketsSent: 2},
+		},
+	}
+	r.Summary.Totals = r.Rows[0].Counters
+	r.Summary.Interfaces = Interfaces{"eth0"}
+	r.Summary.Hits = Hits{Displayed: 1, Total: 1}
+	return r
+}
+
+func TestSummaryOnly(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("sip,dip")
+	require.Nil(t, err)
+
+	for _, format := range []string{types.FormatTXT, types.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			result := testPrinterResult()
+
+			buf := new(bytes.Buffer)
+			printer, err := NewTablePrinter(buf, &PrinterConfig{
+				Format:        format,
+				SortOrder:     SortTraffic,
+				LabelSelector: selector,
+				Direction:     types.DirectionSum,
+				Attributes:    attributes,
+				Totals:        result.Summary.Totals,
+				NumFlows:      result.Summary.Hits.Total,
+				summaryOnly:   true,
+			})
+			require.Nil(t, err)
+
+			require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+			require.Nil(t, printer.Footer(context.Background(), result))
+			require.Nil(t, printer.Print(result))
+
+			out := buf.String()
+			require.False(t, strings.Contains(out, "10.0.0.1"), "row was printed: %s", out)
+			require.True(t, strings.Contains(out, "eth0"), "summary is missing: %s", out)
+		})
+	}
+}
+
+func TestDportClassColumn(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("dportclass,proto")
+	require.Nil(t, err)
+
+	for _, format := range []string{types.FormatTXT, types.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			result := testPrinterResult()
+			result.Rows[0].Attributes = Attributes{IPProto: 6, DstPortClass: "well-known"}
+
+			buf := new(bytes.Buffer)
+			printer, err := NewTablePrinter(buf, &PrinterConfig{
+				Format:        format,
+				SortOrder:     SortTraffic,
+				LabelSelector: selector,
+				Direction:     types.DirectionSum,
+				Attributes:    attributes,
+				Totals:        result.Summary.Totals,
+				NumFlows:      result.Summary.Hits.Total,
+				columnAliases: ColumnAliases{types.DportClassName: "class"},
+			})
+			require.Nil(t, err)
+
+			require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+			require.Nil(t, printer.Footer(context.Background(), result))
+			require.Nil(t, printer.Print(result))
+
+			out := buf.String()
+			for _, expected := range []string{"class", "well-known", "TCP"} {
+				require.True(t, strings.Contains(out, expected), "%q missing: %s", expected, out)
+			}
+		})
+	}
+}
+
+type testServicePlugin struct{}
+
+func (testServicePlugin) Name() string                 { return "service" }
+func (testServicePlugin) Columns() []types.ColumnIndex { return []types.ColumnIndex{types.DportColIdx} }
+func (testServicePlugin) Derive(types.Key) string      { return "" }
+
+func init() {
+	types.RegisterAttributePlugin(testServicePlugin{})
+}
+
+func TestCustomAttributeColumn(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("service,proto")
+	require.Nil(t, err)
+
+	for _, format := range []string{types.FormatTXT, types.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			result := testPrinterResult()
+			result.Rows[0].Attributes = Attributes{IPProto: 6, Custom: NewCustomAttributes(map[string]string{"service": "web-frontend"})}
+
+			buf := new(bytes.Buffer)
+			printer, err := NewTablePrinter(buf, &PrinterConfig{
+				Format:        format,
+				SortOrder:     SortTraffic,
+				LabelSelector: selector,
+				Direction:     types.DirectionBoth,
+				Attributes:    attributes,
+				Totals:        result.Summary.Totals,
+				NumFlows:      result.Summary.Hits.Total,
+				columnAliases: ColumnAliases{"service": "svc"},
+			})
+			require.Nil(t, err)
+
+			require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+			require.Nil(t, printer.Footer(context.Background(), result))
+			require.Nil(t, printer.Print(result))
+
+			out := buf.String()
+			for _, expected := range []string{"svc", "web-frontend", "TCP"} {
+				require.True(t, strings.Contains(out, expected), "%q missing: %s", expected, out)
+			}
+		})
+	}
+}
+
+func TestCustomAttributesJSON(t *testing.T) {
+	attributes := Attributes{DstPort: 443, Custom: NewCustomAttributes(map[string]string{"service": "web", "owner": "team-a"})}
+	require.Equal(t, "web", attributes.Custom.Get("service"))
+	require.Equal(t, "team-a", attributes.Custom.Get("owner"))
+	require.Empty(t, attributes.Custom.Get("unknown"))
+
+	b, err := jsoniter.Marshal(attributes)
+	require.Nil(t, err)
+	require.JSONEq(t, `{"dport":443,"custom":{"owner":"team-a","service":"web"}}`, string(b))
+
+	var decoded Attributes
+	require.Nil(t, jsoniter.Unmarshal(b, &decoded))
+	require.Equal(t, attributes, decoded)
+
+	// attributes without custom values omit them altogether
+	b, err = jsoniter.Marshal(Attributes{DstPort: 443})
+	require.Nil(t, err)
+	require.JSONEq(t, `{"dport":443}`, string(b))
+}
+
+func TestDropRows(t *testing.T) {
+	result := testPrinterResult()
+	result.DropRows()
+
+	require.Empty(t, result.Rows)
+	require.Equal(t, 0, result.Summary.Hits.Displayed)
+	require.Equal(t, 1, result.Summary.Hits.Total)
+}
+
+func TestProfileFooter(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("sip,dip")
+	require.Nil(t, err)
+
+	for _, profile := range []*Profile{nil, {DirWalk: time.Millisecond, Aggregation: 2 * time.Second}} {
+		result := testPrinterResult()
+		result.Summary.Profile = profile
+
+		buf := new(bytes.Buffer)
+		printer, err := NewTablePrinter(buf, &PrinterConfig{
+			Format:        types.FormatTXT,
+			SortOrder:     SortTraffic,
+			LabelSelector: selector,
+			Direction:     types.DirectionSum,
+			Attributes:    attributes,
+			Totals:        result.Summary.Totals,
+			NumFlows:      result.Summary.Hits.Total,
+		})
+		require.Nil(t, err)
+
+		require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+		require.Nil(t, printer.Footer(context.Background(), result))
+		require.Nil(t, printer.Print(result))
+
+		out := buf.String()
+		for _, stage := range []string{"Directory walk", "Aggregation", "Result preparation"} {
+			require.Equal(t, profile != nil, strings.Contains(out, stage), "unexpected presence of %q: %s", stage, out)
+		}
+	}
+}
+
+func TestProvenanceCSVFooter(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("sip,dip")
+	require.Nil(t, err)
+
+	result := testPrinterResult()
+	result.Summary.Provenance = &Provenance{Sources: []Source{{
+		Hostname: "hostA",
+		Version:  "v4.1.0",
+		DBPath:   "/usr/local/goProbe/db",
+		Blocks: &TimeRange{
+			First: time.Date(2024, time.April, 12, 0, 0, 0, 0, time.UTC),
+			Last:  time.Date(2024, time.April, 12, 1, 0, 0, 0, time.UTC),
+		},
+		Encoders:      []string{"lz4", "null"},
+		CorruptBlocks: []CorruptBlock{{Iface: "eth0", Timestamp: time.Date(2024, time.April, 12, 0, 5, 0, 0, time.UTC)}},
+		Sampling:      SamplingNone,
+	}}}
+
+	buf := new(bytes.Buffer)
+	printer, err := NewTablePrinter(buf, &PrinterConfig{
+		Format:        types.FormatCSV,
+		SortOrder:     SortTraffic,
+		LabelSelector: selector,
+		Direction:     types.DirectionSum,
+		Attributes:    attributes,
+		Totals:        result.Summary.Totals,
+		NumFlows:      result.Summary.Hits.Total,
+	})
+	require.Nil(t, err)
+
+	require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+	require.Nil(t, printer.Footer(context.Background(), result))
+	require.Nil(t, printer.Print(result))
+
+	require.Contains(t, buf.String(), `Source hostA,"version=v4.1.0 db=/usr/local/goProbe/db blocks=2024-04-12T00:00:00Z-2024-04-12T01:00:00Z encoders=lz4,null corrupt_blocks=1 sampling=none"`+"\n")
+}
+
+func TestProfileAdd(t *testing.T) {
+	profile := &Profile{DirWalk: time.Second, Sort: time.Millisecond}
+	profile.Add(nil)
+	profile.Add(&Profile{DirWalk: time.Second, BlockRead: time.Minute})
+
+	require.Equal(t, Profile{DirWalk: 2 * time.Second, BlockRead: time.Minute, Sort: time.Millisecond}, *profile)
+}
@@ -0,0 +1,195 @@
+package results
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	aliasSep       = ","
+	aliasAssignSep = "="
+)
+
+// aliasedJSON sorts the (aliased) label / attribute keys to provide deterministic output
+var aliasedJSON = jsoniter.Config{EscapeHTML: true, SortMapKeys: true}.Froze()
+
+// ColumnAliases maps column names (e.g. "sip") to user-defined names (e.g. "client") which
+// are used in place of the column name in all output formats (including JSON keys)
+type ColumnAliases map[string]string
+
+// ParseColumnAliases parses a list of column aliases of the form "sip=client,dip=server"
+func ParseColumnAliases(s string) (ColumnAliases, error) {
+	aliases := make(ColumnAliases)
+	if strings.TrimSpace(s) == "" {
+		return aliases, nil
+	}
+
+	// custom attributes are printed in dedicated columns following the built-in ones
+	allColumns := append(columnNames(), types.AttributePluginNames()...)
+	used := make(map[string]string)
+	for _, assignment := range strings.Split(s, aliasSep) {
+		column, alias, found := strings.Cut(assignment, aliasAssignSep)
+		column, alias = strings.TrimSpace(column), strings.TrimSpace(alias)
+		if !found || column == "" || alias == "" {
+			return nil, fmt.Errorf("invalid column alias %q, expected <column>%s<alias>", assignment, aliasAssignSep)
+		}
+		if !slices.Contains(allColumns, column) {
+			return nil, fmt.Errorf("cannot alias unknown column %q, supported columns: %s", column, strings.Join(allColumns, aliasSep))
+		}
+		if _, exists := aliases[column]; exists {
+			return nil, fmt.Errorf("column %q aliased more than once", column)
+		}
+		if other, exists := used[alias]; exists {
+			return nil, fmt.Errorf("alias %q used for both %q and %q", alias, other, column)
+		}
+		aliases[column] = alias
+		used[alias] = column
+	}
+	return aliases, nil
+}
+
+// Name returns the alias for a column or the column name itself if it isn't aliased
+func (a ColumnAliases) Name(column string) string {
+	if alias, exists := a[column]; exists {
+		return alias
+	}
+	return column
+}
+
+// columnNames returns the names of all label / attribute columns in the order of the
+// corresponding output columns
+func columnNames() []string {
+	columns := types.AllColumns()
+
+	// the zone, tag, process, VLAN, MAC and TCP flags labels are not part of the raw query, but printed right after the interface
+	columns = slices.Insert(columns, slices.Index(columns, types.IfaceName)+1, types.ZoneName, types.TagName, types.ProcessName, types.VLANName, types.SMACName, types.DMACName, types.TCPFlagsName, types.DSCPName)
+
+	return append(columns, types.DportClassName)
+}
+
+// columns returns the names of all label / attribute columns, replacing aliased ones
+func (a ColumnAliases) columns() []string {
+	columns := columnNames()
+	for i, column := range columns {
+		columns[i] = a.Name(column)
+	}
+	return columns
+}
+
+// customColumns returns the names of the custom attribute columns, replacing aliased ones
+func (a ColumnAliases) customColumns(custom []string) []string {
+	columns := make([]string, len(custom))
+	for i, column := range custom {
+		columns[i] = a.Name(column)
+	}
+	return columns
+}
+
+// key returns the alias for a column or the provided (JSON) key if it isn't aliased
+func (a ColumnAliases) key(column, key string) string {
+	if alias, exists := a[column]; exists {
+		return alias
+	}
+	return key
+}
+
+// aliasedRow is the JSON representation of a row with aliased label / attribute keys
+type aliasedRow struct {
+	Labels     map[string]any `json:"labels,omitempty"`
+	Attributes map[string]any `json:"attributes"`
+	Counters   types.Counters `json:"counters"`
+}
+
+func (a ColumnAliases) row(row Row) aliasedRow {
+	r := aliasedRow{
+		Labels:     make(map[string]any),
+		Attributes: make(map[string]any),
+		Counters:   row.Counters,
+	}
+
+	// empty values are omitted in accordance with the (un-aliased) JSON representation
+	if !row.Labels.Timestamp.IsZero() {
+		r.Labels[a.key(types.TimeName, "timestamp")] = row.Labels.Timestamp
+	}
+	if row.Labels.Iface != "" {
+		r.Labels[a.key(types.IfaceName, "iface")] = row.Labels.Iface
+	}
+	if row.Labels.Zone != "" {
+		r.Labels[a.key(types.ZoneName, "zone")] = row.Labels.Zone
+	}
+	if row.Labels.Tag != "" {
+		r.Labels[a.key(types.TagName, "tag")] = row.Labels.Tag
+	}
+	if row.Labels.Process != "" {
+		r.Labels[a.key(types.ProcessName, "process")] = row.Labels.Process
+	}
+	if row.Labels.VLAN != 0 {
+		r.Labels[a.key(types.VLANName, "vlan")] = row.Labels.VLAN
+	}
+	if row.Labels.SMAC != "" {
+		r.Labels[a.key(types.SMACName, "smac")] = row.Labels.SMAC
+	}
+	if row.Labels.DMAC != "" {
+		r.Labels[a.key(types.DMACName, "dmac")] = row.Labels.DMAC
+	}
+	if row.Labels.TCPFlags != "" {
+		r.Labels[a.key(types.TCPFlagsName, "flags")] = row.Labels.TCPFlags
+	}
+	if row.Labels.DSCP != "" {
+		r.Labels[a.key(types.DSCPName, "dscp")] = row.Labels.DSCP
+	}
+	if row.Labels.Hostname != "" {
+		r.Labels[a.key(types.HostnameName, "host")] = row.Labels.Hostname
+	}
+	if row.Labels.HostID != "" {
+		r.Labels[a.key(types.HostIDName, "host_id")] = row.Labels.HostID
+	}
+
+	if row.Attributes.SrcIP.IsValid() {
+		r.Attributes[a.Name(types.SIPName)] = row.Attributes.SrcIP
+	}
+	if row.Attributes.DstIP.IsValid() {
+		r.Attributes[a.Name(types.DIPName)] = row.Attributes.DstIP
+	}
+	if row.Attributes.IPProto != 0 {
+		r.Attributes[a.Name(types.ProtoName)] = row.Attributes.IPProto
+	}
+	if row.Attributes.DstPort != 0 {
+		r.Attributes[a.Name(types.DportName)] = row.Attributes.DstPort
+	}
+	if row.Attributes.DstPortClass != "" {
+		r.Attributes[a.key(types.DportClassName, "dport_class")] = row.Attributes.DstPortClass
+	}
+	if custom := row.Attributes.Custom.Map(); len(custom) > 0 {
+		aliased := make(map[string]string, len(custom))
+		for name, value := range custom {
+			aliased[a.Name(name)] = value
+		}
+		r.Attributes["custom"] = aliased
+	}
+	return r
+}
+
+// EncodeJSON serializes the result to w, replacing the keys of all aliased labels / attributes
+// in the result rows
+func EncodeJSON(w io.Writer, result *Result, aliases ColumnAliases) error {
+	if len(aliases) == 0 {
+		return jsoniter.NewEncoder(w).Encode(result)
+	}
+
+	rows := make([]aliasedRow, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = aliases.row(row)
+	}
+
+	// the rows of the embedded result are shadowed by the aliased ones
+	return aliasedJSON.NewEncoder(w).Encode(struct {
+		*Result
+		Rows []aliasedRow `json:"rows"`
+	}{result, rows})
+}
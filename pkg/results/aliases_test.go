@@ -0,0 +1,112 @@
+package results
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColumnAliases(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected ColumnAliases
+		err      bool
+	}{
+		{"empty", "", ColumnAliases{}, false},
+		{"single", "sip=client", ColumnAliases{"sip": "client"}, false},
+		{"multiple with spaces", "sip = client, dip=server", ColumnAliases{"sip": "client", "dip": "server"}, false},
+		{"label column", "iface=link", ColumnAliases{"iface": "link"}, false},
+		{"missing alias", "sip=", nil, true},
+		{"missing separator", "sip", nil, true},
+		{"unknown column", "sport=client", nil, true},
+		{"duplicate column", "sip=client,sip=server", nil, true},
+		{"duplicate alias", "sip=host,dip=host", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aliases, err := ParseColumnAliases(test.input)
+			if test.err {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expected, aliases)
+		})
+	}
+}
+
+func TestColumnAliasesPrinter(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("sip,dip,dport")
+	require.Nil(t, err)
+
+	aliases := ColumnAliases{"sip": "client", "dip": "server"}
+	for _, format := range []string{types.FormatTXT, types.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			result := testPrinterResult()
+
+			buf := new(bytes.Buffer)
+			printer, err := NewTablePrinter(buf, &PrinterConfig{
+				Format:        format,
+				SortOrder:     SortSrcIP,
+				LabelSelector: selector,
+				Direction:     types.DirectionSum,
+				Attributes:    attributes,
+				Totals:        result.Summary.Totals,
+				NumFlows:      result.Summary.Hits.Total,
+				columnAliases: aliases,
+			})
+			require.Nil(t, err)
+
+			require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+			require.Nil(t, printer.Footer(context.Background(), result))
+			require.Nil(t, printer.Print(result))
+
+			out := buf.String()
+			for _, expected := range []string{"client", "server", "dport", "client column"} {
+				require.True(t, strings.Contains(out, expected), "%q missing: %s", expected, out)
+			}
+			for _, unexpected := range []string{"sip", "dip"} {
+				require.False(t, strings.Contains(out, unexpected), "%q present: %s", unexpected, out)
+			}
+		})
+	}
+}
+
+func TestColumnAliasesJSON(t *testing.T) {
+	result := testPrinterResult()
+	result.Rows[0].Labels.Iface = "eth0"
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, EncodeJSON(buf, result, ColumnAliases{"sip": "client", "dip": "server", "iface": "link"}))
+
+	var decoded struct {
+		Summary Summary `json:"summary"`
+		Rows    []struct {
+			Labels     map[string]any `json:"labels"`
+			Attributes map[string]any `json:"attributes"`
+			Counters   types.Counters `json:"counters"`
+		} `json:"rows"`
+	}
+	require.Nil(t, jsoniter.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, result.Summary.Totals, decoded.Summary.Totals)
+	require.Len(t, decoded.Rows, 1)
+
+	row := decoded.Rows[0]
+	require.Equal(t, map[string]any{"link": "eth0"}, row.Labels)
+	require.Equal(t, map[string]any{"client": "10.0.0.1", "server": "10.0.0.2", "proto": float64(6), "dport": float64(443)}, row.Attributes)
+	require.Equal(t, result.Rows[0].Counters, row.Counters)
+
+	t.Run("no aliases", func(t *testing.T) {
+		aliased, plain := new(bytes.Buffer), new(bytes.Buffer)
+		require.Nil(t, EncodeJSON(aliased, result, nil))
+		require.Nil(t, jsoniter.NewEncoder(plain).Encode(result))
+		require.Equal(t, plain.String(), aliased.String())
+	})
+}
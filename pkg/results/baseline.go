@@ -0,0 +1,28 @@
+package results
+
+import "time"
+
+// Baseline denotes the time range the result rows were compared against in a "new talkers" query.
+// Only rows whose attribute combination did not occur during the baseline are part of the result
+type Baseline struct {
+	// First: the start of the baseline time range
+	First time.Time `json:"time_first" doc:"Start of the baseline time range" example:"2024-04-05T09:47:00+02:00"`
+	// Last: the end of the baseline time range
+	Last time.Time `json:"time_last" doc:"End of the baseline time range" example:"2024-04-12T08:47:00+02:00"`
+	// Keys: the number of distinct attribute combinations observed during the baseline
+	Keys int `json:"keys" doc:"Number of distinct attribute combinations observed during the baseline (summed over all hosts)" example:"48211"`
+}
+
+// Add adds the baseline of another host to b, extending its time range if required
+func (b *Baseline) Add(b2 *Baseline) {
+	if b2 == nil {
+		return
+	}
+	if b.First.IsZero() || (!b2.First.IsZero() && b2.First.Before(b.First)) {
+		b.First = b2.First
+	}
+	if b2.Last.After(b.Last) {
+		b.Last = b2.Last
+	}
+	b.Keys += b2.Keys
+}
@@ -0,0 +1,19 @@
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaselineAdd(t *testing.T) {
+	t0 := time.Unix(1456358400, 0)
+
+	var b Baseline
+	b.Add(&Baseline{First: t0.Add(time.Hour), Last: t0.Add(2 * time.Hour), Keys: 10})
+	b.Add(&Baseline{First: t0, Last: t0.Add(time.Hour), Keys: 5})
+	b.Add(nil)
+
+	require.Equal(t, Baseline{First: t0, Last: t0.Add(2 * time.Hour), Keys: 15}, b)
+}
@@ -0,0 +1,100 @@
+package results
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	customAttributeSep       = "\x00"
+	customAttributeAssignSep = "="
+)
+
+// CustomAttributes holds the values of the custom attributes derived by attribute plugins (see
+// types.AttributePlugin). In order for rows to remain comparable (and hence mergeable), the name /
+// value pairs are kept in a canonical string encoding (ordered by name). In JSON, they are
+// represented as object mapping the names onto the values
+type CustomAttributes string
+
+// NewCustomAttributes returns the custom attributes holding the provided values (indexed by name)
+func NewCustomAttributes(values map[string]string) CustomAttributes {
+	if len(values) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString(customAttributeSep)
+		}
+		sb.WriteString(name)
+		sb.WriteString(customAttributeAssignSep)
+		sb.WriteString(values[name])
+	}
+	return CustomAttributes(sb.String())
+}
+
+// Get returns the value of the custom attribute name (or an empty string if it isn't present)
+func (c CustomAttributes) Get(name string) string {
+	for _, pair := range c.pairs() {
+		if n, value, _ := strings.Cut(pair, customAttributeAssignSep); n == name {
+			return value
+		}
+	}
+	return ""
+}
+
+// Map returns the values of all custom attributes, indexed by name
+func (c CustomAttributes) Map() map[string]string {
+	pairs := c.pairs()
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, _ := strings.Cut(pair, customAttributeAssignSep)
+		values[name] = value
+	}
+	return values
+}
+
+func (c CustomAttributes) pairs() []string {
+	if c == "" {
+		return nil
+	}
+	return strings.Split(string(c), customAttributeSep)
+}
+
+// MarshalJSON marshals the custom attributes into a JSON object
+func (c CustomAttributes) MarshalJSON() ([]byte, error) {
+	return jsoniter.Marshal(c.Map())
+}
+
+// UnmarshalJSON unmarshals the custom attributes from a JSON object
+func (c *CustomAttributes) UnmarshalJSON(data []byte) error {
+	var values map[string]string
+	if err := jsoniter.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*c = NewCustomAttributes(values)
+	return nil
+}
+
+// Schema returns the schema of the (JSON) representation of the custom attributes. It implements
+// the huma.SchemaProvider interface
+func (CustomAttributes) Schema(huma.Registry) *huma.Schema {
+	return &huma.Schema{
+		Type:                 huma.TypeObject,
+		AdditionalProperties: &huma.Schema{Type: huma.TypeString},
+	}
+}
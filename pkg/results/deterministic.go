@@ -0,0 +1,70 @@
+package results
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// MakeDeterministic prepares the result for golden-output comparisons (e.g. CI assertions of downstream
+// pipelines): all elements varying between runs of the same query against the same data (runtimes, query
+// start, clock skew and last writeout of the hosts, per-stage timings, resource usage) are removed, all timestamps are
+// converted to UTC and the rows as well as all per-host lists of the summary are brought into a total order.
+// Rows are ordered by less (cf. By), with the host ID as the final tie-break
+func (r *Result) MakeDeterministic(less by) {
+	r.Summary.Timings = Timings{}
+	r.Summary.Profile = nil
+	r.Summary.ResourceUsage = nil
+
+	r.Summary.First, r.Summary.Last = r.Summary.First.UTC(), r.Summary.Last.UTC()
+
+	for host, status := range r.HostsStatuses {
+		status.ClockSkew = 0
+		status.LastWriteout = nil
+		r.HostsStatuses[host] = status
+	}
+
+	for i := range r.Rows {
+		if !r.Rows[i].Labels.Timestamp.IsZero() {
+			r.Rows[i].Labels.Timestamp = r.Rows[i].Labels.Timestamp.UTC()
+		}
+	}
+	sort.SliceStable(r.Rows, func(i, j int) bool {
+		if less(&r.Rows[i], &r.Rows[j]) {
+			return true
+		}
+		if less(&r.Rows[j], &r.Rows[i]) {
+			return false
+		}
+		// identical hostnames don't necessarily imply the same host
+		return r.Rows[i].Labels.HostID < r.Rows[j].Labels.HostID
+	})
+
+	if baseline := r.Summary.Baseline; baseline != nil {
+		baseline.First, baseline.Last = baseline.First.UTC(), baseline.Last.UTC()
+	}
+	if drops := r.Summary.Drops; drops != nil {
+		for i := range drops.Ranges {
+			drops.Ranges[i].Timestamp = drops.Ranges[i].Timestamp.UTC()
+		}
+	}
+	if provenance := r.Summary.Provenance; provenance != nil {
+		for i := range provenance.Sources {
+			source := &provenance.Sources[i]
+			if source.Blocks != nil {
+				source.Blocks.First, source.Blocks.Last = source.Blocks.First.UTC(), source.Blocks.Last.UTC()
+			}
+			for j := range source.CorruptBlocks {
+				source.CorruptBlocks[j].Timestamp = source.CorruptBlocks[j].Timestamp.UTC()
+			}
+		}
+
+		// the sources of a distributed query are listed in the order the hosts responded in
+		slices.SortStableFunc(provenance.Sources, func(s1, s2 Source) int {
+			return cmp.Or(cmp.Compare(s1.Hostname, s2.Hostname), cmp.Compare(s1.HostID, s2.HostID))
+		})
+	}
+	slices.SortStableFunc(r.Summary.ResourcePolicies, func(p1, p2 ResourcePolicy) int {
+		return cmp.Compare(p1.Hostname, p2.Hostname)
+	})
+}
@@ -0,0 +1,79 @@
+package results
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeDeterministic(t *testing.T) {
+	var (
+		loc = time.FixedZone("UTC+2", 2*3600)
+		ts  = time.Unix(1700000000, 0).In(loc)
+		ip  = netip.MustParseAddr("10.0.0.1")
+
+		skew      = 3 * time.Second
+		writeout  = ts.Add(time.Minute)
+		newResult = func(hostIDs ...string) *Result {
+			result := New()
+			result.Summary.TimeRange = TimeRange{First: ts.Add(-time.Hour), Last: ts}
+			result.Summary.Timings = Timings{QueryStart: time.Now(), QueryDuration: time.Second}
+			result.Summary.Profile = &Profile{Sort: time.Millisecond}
+			result.HostsStatuses["hostA"] = Status{Code: types.StatusOK, ClockSkew: skew, LastWriteout: &writeout}
+			for _, hostID := range hostIDs {
+				result.Rows = append(result.Rows, Row{
+					Labels:     Labels{Timestamp: ts, Hostname: "hostA", HostID: hostID},
+					Attributes: Attributes{SrcIP: ip, DstPort: 443},
+					Counters:   types.Counters{BytesRcvd: 100},
+				})
+			}
+			result.Summary.Provenance = &Provenance{Sources: []Source{
+				{Hostname: "hostB", Sampling: SamplingNone},
+				{Hostname: "hostA", HostID: "1", Sampling: SamplingNone, Blocks: &TimeRange{First: ts, Last: ts}},
+			}}
+			return result
+		}
+	)
+
+	less := By(SortTraffic, types.DirectionSum, false)
+
+	// the host order of identical rows (e.g. of hosts sharing a hostname) must not matter
+	r1, r2 := newResult("2", "1"), newResult("1", "2")
+	r1.MakeDeterministic(less)
+	r2.MakeDeterministic(less)
+	require.Equal(t, r1, r2)
+
+	require.Equal(t, "1", r1.Rows[0].Labels.HostID)
+	require.Equal(t, time.UTC, r1.Rows[0].Labels.Timestamp.Location())
+	require.Equal(t, time.UTC, r1.Summary.First.Location())
+	require.True(t, r1.Summary.Last.Equal(ts))
+	require.Equal(t, Timings{}, r1.Summary.Timings)
+	require.Nil(t, r1.Summary.Profile)
+	require.Equal(t, Status{Code: types.StatusOK}, r1.HostsStatuses["hostA"])
+	require.Equal(t, "hostA", r1.Summary.Provenance.Sources[0].Hostname)
+	require.Equal(t, time.UTC, r1.Summary.Provenance.Sources[0].Blocks.First.Location())
+
+	// the footer omits the query runtime
+	for _, deterministic := range []bool{false, true} {
+		cfg := &PrinterConfig{
+			Format:     types.FormatTXT,
+			SortOrder:  SortTraffic,
+			Direction:  types.DirectionSum,
+			Attributes: []types.Attribute{types.SIPAttribute{}},
+		}
+		WithDeterministic(deterministic)(cfg)
+
+		var buf bytes.Buffer
+		printer, err := NewTablePrinter(&buf, cfg)
+		require.Nil(t, err)
+		require.Nil(t, printer.Footer(context.Background(), r1))
+		require.Nil(t, printer.Print(r1))
+		require.Equal(t, !deterministic, strings.Contains(buf.String(), " hits out of 0 in "), buf.String())
+	}
+}
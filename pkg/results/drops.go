@@ -0,0 +1,70 @@
+package results
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// Drops provides the number of packets dropped during capture over the covered time range and an
+// estimate of the traffic missing from the result due to them. Since drops are tracked per interface
+// and time bin (not per flow), the estimate assumes that dropped packets are distributed like the
+// queried traffic, i.e. it is derived from the average packet size of the totals
+type Drops struct {
+	// Packets: the number of packets dropped during the covered time range
+	Packets uint64 `json:"packets" doc:"Number of packets dropped during the covered time range" example:"1204"`
+	// EstimatedMissingBytes: the traffic volume estimated to be missing due to dropped packets
+	EstimatedMissingBytes uint64 `json:"estimated_missing_bytes" doc:"Traffic volume estimated to be missing due to dropped packets (based on the average packet size of the totals)" example:"1565200"`
+	// EstimatedMissingPct: the share of packets estimated to be missing from the totals
+	EstimatedMissingPct float64 `json:"estimated_missing_pct" doc:"Share of packets estimated to be missing from the totals (in percent)" example:"0.42"`
+	// Ranges: the dropped packets per time bin and interface (only if the time attribute was queried)
+	Ranges []DropsRange `json:"ranges,omitempty" doc:"Dropped packets per time bin and interface (only present if the time attribute was queried)"`
+}
+
+// DropsRange denotes the packets dropped on an interface during a single time bin
+type DropsRange struct {
+	// Timestamp: the end of the time bin
+	Timestamp time.Time `json:"timestamp" doc:"End of the time bin" example:"2024-04-12T09:45:00+02:00"`
+	// Hostname: the host the drops occurred on
+	Hostname string `json:"host,omitempty" doc:"Host the drops occurred on" example:"hostA"`
+	// Iface: the interface the drops occurred on
+	Iface string `json:"iface" doc:"Interface the drops occurred on" example:"eth0"`
+	// Packets: the number of packets dropped during the time bin
+	Packets uint64 `json:"packets" doc:"Number of packets dropped during the time bin" example:"17"`
+}
+
+// Add adds the dropped packets of drops to d. The estimate has to be recomputed via Estimate afterwards
+func (d *Drops) Add(drops *Drops) {
+	if drops == nil {
+		return
+	}
+	d.Packets += drops.Packets
+	d.Ranges = append(d.Ranges, drops.Ranges...)
+}
+
+// Estimate derives the traffic missing due to the dropped packets from the totals of the result and
+// sorts the time bins
+func (d *Drops) Estimate(totals types.Counters) {
+	d.EstimatedMissingBytes, d.EstimatedMissingPct = 0, 0
+
+	packets := totals.PacketsRcvd + totals.PacketsSent
+	if packets > 0 {
+		bytes := totals.BytesRcvd + totals.BytesSent
+		d.EstimatedMissingBytes = uint64(float64(d.Packets) * float64(bytes) / float64(packets))
+	}
+	if d.Packets > 0 {
+		d.EstimatedMissingPct = 100 * float64(d.Packets) / float64(d.Packets+packets)
+	}
+
+	slices.SortFunc(d.Ranges, func(a, b DropsRange) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Hostname, b.Hostname); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Iface, b.Iface)
+	})
+}
@@ -0,0 +1,42 @@
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropsEstimate(t *testing.T) {
+	var (
+		t0    = time.Unix(1456358700, 0)
+		drops = &Drops{
+			Packets: 100,
+			Ranges: []DropsRange{
+				{Timestamp: t0.Add(300 * time.Second), Iface: "eth0", Packets: 40},
+				{Timestamp: t0, Iface: "eth1", Packets: 10},
+			},
+		}
+	)
+	drops.Add(&Drops{
+		Packets: 50,
+		Ranges:  []DropsRange{{Timestamp: t0, Iface: "eth0", Packets: 50}},
+	})
+	require.Equal(t, uint64(150), drops.Packets)
+
+	// an average packet size of 1000 bytes
+	drops.Estimate(types.Counters{BytesRcvd: 600000, BytesSent: 250000, PacketsRcvd: 600, PacketsSent: 250})
+	require.Equal(t, uint64(150000), drops.EstimatedMissingBytes)
+	require.Equal(t, 15., drops.EstimatedMissingPct)
+	require.Equal(t, []DropsRange{
+		{Timestamp: t0, Iface: "eth0", Packets: 50},
+		{Timestamp: t0, Iface: "eth1", Packets: 10},
+		{Timestamp: t0.Add(300 * time.Second), Iface: "eth0", Packets: 40},
+	}, drops.Ranges)
+
+	// without any traffic, the missing volume cannot be estimated
+	drops.Estimate(types.Counters{})
+	require.Zero(t, drops.EstimatedMissingBytes)
+	require.Equal(t, 100., drops.EstimatedMissingPct)
+}
@@ -0,0 +1,54 @@
+package results
+
+import "time"
+
+// Cost denotes the estimated cost of a query, determined from the metadata of the DB only (i.e.
+// without reading any blocks). Blocks skipped during execution based on their contents (e.g. if
+// their entries can be narrowed down by the condition) are included in the estimate
+type Cost struct {
+	// Hosts: the number of hosts the estimate covers (distributed queries only)
+	Hosts int `json:"hosts,omitempty" doc:"Number of hosts the estimate covers (only present for distributed queries)" example:"42"`
+	// Interfaces: the number of interfaces queried
+	Interfaces int `json:"interfaces" doc:"Number of interfaces queried" example:"2"`
+	// Directories: the number of (daily) directories read
+	Directories int `json:"directories" doc:"Number of (daily) directories read" example:"30"`
+	// DirectoriesPruned: the number of directories skipped since they cannot hold any matching flows
+	DirectoriesPruned int `json:"directories_pruned,omitempty" doc:"Number of directories skipped since their IP filter rules out all IPs required by the condition" example:"12"`
+	// Blocks: the number of blocks read
+	Blocks int `json:"blocks" doc:"Number of blocks read" example:"8640"`
+	// Bytes: the (compressed) size of all column blocks read
+	Bytes uint64 `json:"bytes" doc:"Compressed size of all column blocks read (in bytes)" example:"734003200"`
+	// Flows: the number of flows scanned
+	Flows uint64 `json:"flows" doc:"Number of flows stored in the blocks read" example:"21600000"`
+}
+
+// Add adds the cost of c2 to c
+func (c *Cost) Add(c2 *Cost) {
+	if c2 == nil {
+		return
+	}
+	c.Hosts += c2.Hosts
+	c.Interfaces += c2.Interfaces
+	c.Directories += c2.Directories
+	c.DirectoriesPruned += c2.DirectoriesPruned
+	c.Blocks += c2.Blocks
+	c.Bytes += c2.Bytes
+	c.Flows += c2.Flows
+}
+
+// DryRun denotes the outcome of validating a query and estimating its cost without running it
+type DryRun struct {
+	// First / Last: the (resolved) time range of the query
+	First time.Time `json:"first" doc:"Start of the time range of the query" example:"2024-03-12T09:45:00+02:00"`
+	Last  time.Time `json:"last" doc:"End of the time range of the query" example:"2024-04-12T09:45:00+02:00"`
+	// Interfaces: the interfaces queried (local queries only)
+	Interfaces []string `json:"interfaces,omitempty" doc:"Interfaces queried (only present for local queries)" example:"eth0,eth1"`
+	// Warnings: warnings emitted while preparing the query (e.g. for ambiguous hostnames in the condition)
+	Warnings []string `json:"warnings,omitempty" doc:"Warnings emitted while preparing the query" example:"hostname example.com resolves to multiple addresses"`
+
+	// Cost: the estimated cost of the query
+	Cost Cost `json:"cost" doc:"Estimated cost of the query"`
+
+	// HostsStatuses: the outcome of the estimate per host (distributed queries only)
+	HostsStatuses HostsStatuses `json:"hosts_statuses,omitempty" doc:"Outcome of the estimate per host (only present for distributed queries)"`
+}
@@ -0,0 +1,221 @@
+package results
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// GrafanaMetric denotes the counter exported as value of Grafana time series
+type GrafanaMetric string
+
+// Supported Grafana metrics
+const (
+	GrafanaBytes      GrafanaMetric = "bytes"
+	GrafanaBytesIn    GrafanaMetric = "bytes_in"
+	GrafanaBytesOut   GrafanaMetric = "bytes_out"
+	GrafanaPackets    GrafanaMetric = "packets"
+	GrafanaPacketsIn  GrafanaMetric = "packets_in"
+	GrafanaPacketsOut GrafanaMetric = "packets_out"
+)
+
+const (
+	grafanaTypeTable   = "table"
+	grafanaColumnTime  = "time"
+	grafanaColumnStr   = "string"
+	grafanaColumnNum   = "number"
+	grafanaDefaultName = "total"
+)
+
+// grafanaCounterColumns stores the titles of the counter columns of Grafana tables
+var grafanaCounterColumns = []string{"bytes_rcvd", "bytes_sent", "packets_rcvd", "packets_sent"}
+
+// Value extracts the metric from the counters
+func (m GrafanaMetric) Value(c types.Counters) (uint64, error) {
+	switch m {
+	case GrafanaBytes, "":
+		return c.SumBytes(), nil
+	case GrafanaBytesIn:
+		return c.BytesRcvd, nil
+	case GrafanaBytesOut:
+		return c.BytesSent, nil
+	case GrafanaPackets:
+		return c.SumPackets(), nil
+	case GrafanaPacketsIn:
+		return c.PacketsRcvd, nil
+	case GrafanaPacketsOut:
+		return c.PacketsSent, nil
+	}
+	return 0, fmt.Errorf("unsupported metric: %s", m)
+}
+
+// GrafanaTimeSeries is a time series in the format of the Grafana JSON datasource
+type GrafanaTimeSeries struct {
+	// Target: the name of the series
+	Target string `json:"target" doc:"Name of the series (labels / attributes of the series in InfluxDB line protocol tag notation)" example:"dport=443,proto=TCP"`
+	// Datapoints: the values of the series and their timestamps (in ms since epoch)
+	Datapoints [][2]float64 `json:"datapoints" doc:"Values of the series along with their timestamps in milliseconds since epoch"`
+}
+
+// GrafanaColumn is a column of a Grafana table
+type GrafanaColumn struct {
+	Text string `json:"text" doc:"Column title" example:"sip"`
+	Type string `json:"type" doc:"Column type" enum:"time,string,number" example:"string"`
+}
+
+// GrafanaTable is a table in the format of the Grafana JSON datasource
+type GrafanaTable struct {
+	Type    string          `json:"type" doc:"Type of the response" example:"table"`
+	Columns []GrafanaColumn `json:"columns" doc:"Columns of the table"`
+	Rows    [][]any         `json:"rows" doc:"Rows of the table"`
+}
+
+// GrafanaTable converts the result rows into a Grafana table holding the attributes / labels of the
+// query (with timestamps in ms since epoch) as well as the byte and packet counters (in and out)
+func (r *Result) GrafanaTable(selector types.LabelSelector, attributes []types.Attribute) *GrafanaTable {
+	cols, custom := grafanaColumns(selector, attributes), customAttributeNames(attributes)
+
+	table := &GrafanaTable{
+		Type: grafanaTypeTable,
+		Rows: make([][]any, 0, len(r.Rows)),
+	}
+	for _, col := range cols {
+		colType := grafanaColumnStr
+		if col == OutcolTime {
+			colType = grafanaColumnTime
+		}
+		table.Columns = append(table.Columns, GrafanaColumn{Text: grafanaColumnName(col, custom), Type: colType})
+	}
+	for _, name := range grafanaCounterColumns {
+		table.Columns = append(table.Columns, GrafanaColumn{Text: name, Type: grafanaColumnNum})
+	}
+
+	for _, row := range r.Rows {
+		values := make([]any, 0, len(table.Columns))
+		for _, col := range cols {
+			if col == OutcolTime {
+				values = append(values, row.Labels.Timestamp.UnixMilli())
+				continue
+			}
+			values = append(values, extract(CSVFormatter{}, nil, r.Summary.Totals, custom, row, col))
+		}
+		table.Rows = append(table.Rows, append(values,
+			row.Counters.BytesRcvd, row.Counters.BytesSent, row.Counters.PacketsRcvd, row.Counters.PacketsSent,
+		))
+	}
+	return table
+}
+
+// GrafanaTimeSeries converts the result rows into Grafana time series of the metric, one per distinct
+// set of attributes / labels (excluding the timestamp). The series are named by their attributes /
+// labels in InfluxDB line protocol tag notation, so they can be forwarded / split up unambiguously.
+// If the query has no attributes / labels besides the timestamp, a single series named by name (or
+// "total" if empty) is returned
+func (r *Result) GrafanaTimeSeries(selector types.LabelSelector, attributes []types.Attribute, metric GrafanaMetric, name string) ([]GrafanaTimeSeries, error) {
+	if !selector.Timestamp {
+		return nil, fmt.Errorf("time series require the %s attribute to be queried", types.TimeName)
+	}
+	if name == "" {
+		name = grafanaDefaultName
+	}
+
+	cols, custom := grafanaColumns(selector, attributes), customAttributeNames(attributes)
+
+	var (
+		series []GrafanaTimeSeries
+		index  = make(map[string]int)
+		sb     strings.Builder
+	)
+	for _, row := range r.Rows {
+		val, err := metric.Value(row.Counters)
+		if err != nil {
+			return nil, err
+		}
+
+		sb.Reset()
+		for _, col := range cols {
+			if col == OutcolTime {
+				continue
+			}
+			if sb.Len() > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(escapeLineProtocol(grafanaColumnName(col, custom)))
+			sb.WriteByte('=')
+			sb.WriteString(escapeLineProtocol(extract(CSVFormatter{}, nil, r.Summary.Totals, custom, row, col)))
+		}
+		target := sb.String()
+		if target == "" {
+			target = name
+		}
+
+		i, exists := index[target]
+		if !exists {
+			i = len(series)
+			index[target] = i
+			series = append(series, GrafanaTimeSeries{Target: target})
+		}
+		series[i].Datapoints = append(series[i].Datapoints, [2]float64{float64(val), float64(row.Labels.Timestamp.UnixMilli())})
+	}
+
+	// Grafana expects the datapoints in chronological order
+	for _, s := range series {
+		slices.SortFunc(s.Datapoints, func(a, b [2]float64) int {
+			switch {
+			case a[1] < b[1]:
+				return -1
+			case a[1] > b[1]:
+				return 1
+			}
+			return 0
+		})
+	}
+	return series, nil
+}
+
+// grafanaColumns returns the attribute / label columns of the query
+func grafanaColumns(selector types.LabelSelector, attributes []types.Attribute) (cols []OutputColumn) {
+	for _, col := range columns(selector, attributes, types.DirectionSum) {
+		if col < OutcolInPkts || col.isCustom() {
+			cols = append(cols, col)
+		}
+	}
+	return
+}
+
+var grafanaColumnNames = map[OutputColumn]string{
+	OutcolTime:       types.TimeName,
+	OutcolHostname:   types.HostnameName,
+	OutcolHostID:     types.HostIDName,
+	OutcolIface:      types.IfaceName,
+	OutcolZone:       types.ZoneName,
+	OutcolTag:        types.TagName,
+	OutcolProcess:    types.ProcessName,
+	OutcolVLAN:       types.VLANName,
+	OutcolSMAC:       types.SMACName,
+	OutcolDMAC:       types.DMACName,
+	OutcolTCPFlags:   types.TCPFlagsName,
+	OutcolDSCP:       types.DSCPName,
+	OutcolSIP:        types.SIPName,
+	OutcolDIP:        types.DIPName,
+	OutcolDport:      types.DportName,
+	OutcolProto:      types.ProtoName,
+	OutcolDportClass: types.DportClassName,
+}
+
+func grafanaColumnName(col OutputColumn, custom []string) string {
+	if col.isCustom() {
+		return custom[col-OutcolCustom]
+	}
+	return grafanaColumnNames[col]
+}
+
+// lineProtocolEscaper escapes the characters with special meaning in InfluxDB line protocol tag
+// keys / values
+var lineProtocolEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func escapeLineProtocol(s string) string {
+	return lineProtocolEscaper.Replace(s)
+}
@@ -0,0 +1,65 @@
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrafanaExport(t *testing.T) {
+	t0, t1 := time.Unix(1712900000, 0), time.Unix(1712900300, 0)
+	r := &Result{
+		Rows: Rows{
+			{Labels: Labels{Timestamp: t1, Iface: "eth 0"}, Attributes: Attributes{DstPort: 443, IPProto: 6}, Counters: types.Counters{BytesRcvd: 10, BytesSent: 20, PacketsRcvd: 1, PacketsSent: 2}},
+			{Labels: Labels{Timestamp: t0, Iface: "eth 0"}, Attributes: Attributes{DstPort: 443, IPProto: 6}, Counters: types.Counters{BytesRcvd: 5, PacketsRcvd: 1}},
+			{Labels: Labels{Timestamp: t0, Iface: "eth 0"}, Attributes: Attributes{DstPort: 53, IPProto: 17}, Counters: types.Counters{BytesSent: 7, PacketsSent: 1}},
+		},
+	}
+
+	attributes, selector, err := types.ParseQueryType("time,iface,dport,proto")
+	require.Nil(t, err)
+
+	series, err := r.GrafanaTimeSeries(selector, attributes, GrafanaBytes, "A")
+	require.Nil(t, err)
+	require.Equal(t, []GrafanaTimeSeries{
+		{Target: `iface=eth\ 0,dport=443,proto=TCP`, Datapoints: [][2]float64{{5, float64(t0.UnixMilli())}, {30, float64(t1.UnixMilli())}}},
+		{Target: `iface=eth\ 0,dport=53,proto=UDP`, Datapoints: [][2]float64{{7, float64(t0.UnixMilli())}}},
+	}, series)
+
+	series, err = r.GrafanaTimeSeries(selector, attributes, GrafanaPacketsOut, "A")
+	require.Nil(t, err)
+	require.Equal(t, [2]float64{2, float64(t1.UnixMilli())}, series[0].Datapoints[1])
+
+	_, err = r.GrafanaTimeSeries(selector, attributes, "flows", "A")
+	require.NotNil(t, err)
+
+	// series without attributes are named by the provided name
+	_, timeOnly, err := types.ParseQueryType("time")
+	require.Nil(t, err)
+	series, err = r.GrafanaTimeSeries(timeOnly, nil, GrafanaBytes, "A")
+	require.Nil(t, err)
+	require.Len(t, series, 1)
+	require.Equal(t, "A", series[0].Target)
+	require.Len(t, series[0].Datapoints, 3)
+
+	// time series require the timestamp
+	attributes, selector, err = types.ParseQueryType("dport,proto")
+	require.Nil(t, err)
+	_, err = r.GrafanaTimeSeries(selector, attributes, GrafanaBytes, "A")
+	require.NotNil(t, err)
+
+	table := r.GrafanaTable(selector, attributes)
+	require.Equal(t, "table", table.Type)
+	require.Equal(t, []GrafanaColumn{
+		{Text: "dport", Type: "string"},
+		{Text: "proto", Type: "string"},
+		{Text: "bytes_rcvd", Type: "number"},
+		{Text: "bytes_sent", Type: "number"},
+		{Text: "packets_rcvd", Type: "number"},
+		{Text: "packets_sent", Type: "number"},
+	}, table.Columns)
+	require.Equal(t, []any{"443", "TCP", uint64(10), uint64(20), uint64(1), uint64(2)}, table.Rows[0])
+	require.Len(t, table.Rows, 3)
+}
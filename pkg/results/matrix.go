@@ -0,0 +1,215 @@
+package results
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// heatLevels denotes the shades used to indicate the share of a cell in the largest cell of a
+// text matrix (from lowest to highest)
+var heatLevels = []string{" ", "░", "▒", "▓", "█"}
+
+// Matrix denotes the traffic between groups of source and destination IPs (e.g. sites or VLAN subnets)
+// over the queried time range. Each group includes an implicit last group collecting all IPs not covered
+// by any of the user-defined groups
+type Matrix struct {
+	// Sources: the labels of the source groups (rows of the matrix)
+	Sources []string `json:"sources" doc:"Labels of the source groups (rows of the matrix). The last group collects all source IPs not covered by any other group" example:"siteA,siteB,other"`
+	// Destinations: the labels of the destination groups (columns of the matrix)
+	Destinations []string `json:"destinations" doc:"Labels of the destination groups (columns of the matrix). The last group collects all destination IPs not covered by any other group" example:"siteA,siteB,other"`
+	// Cells: the traffic between each pair of groups, indexed by source and destination group
+	Cells [][]types.Counters `json:"cells" doc:"Traffic between each pair of groups, indexed by source group (outer) and destination group (inner)"`
+}
+
+// NewMatrix creates the traffic matrix between the source and destination groups from the rows of a
+// result. The rows are expected to carry both the source and destination IP attributes
+func NewMatrix(src, dst types.PrefixGroups, rows Rows) *Matrix {
+	m := newMatrix(src.Labels(), dst.Labels())
+	for _, row := range rows {
+		m.Cells[src.Classify(row.Attributes.SrcIP)][dst.Classify(row.Attributes.DstIP)].Add(row.Counters)
+	}
+	return m
+}
+
+func newMatrix(sources, destinations []string) *Matrix {
+	m := &Matrix{
+		Sources:      sources,
+		Destinations: destinations,
+		Cells:        make([][]types.Counters, len(sources)),
+	}
+	for i := range m.Cells {
+		m.Cells[i] = make([]types.Counters, len(destinations))
+	}
+	return m
+}
+
+// Add adds the traffic of another matrix (e.g. of the result of another host). Cells are matched
+// by the labels of their groups, groups not yet present are appended
+func (m *Matrix) Add(m2 *Matrix) {
+	if m2 == nil {
+		return
+	}
+
+	dstIdx := make([]int, len(m2.Destinations))
+	for j, label := range m2.Destinations {
+		dstIdx[j] = slices.Index(m.Destinations, label)
+		if dstIdx[j] < 0 {
+			m.Destinations = append(m.Destinations, label)
+			for i := range m.Cells {
+				m.Cells[i] = append(m.Cells[i], types.Counters{})
+			}
+			dstIdx[j] = len(m.Destinations) - 1
+		}
+	}
+	for i, label := range m2.Sources {
+		srcIdx := slices.Index(m.Sources, label)
+		if srcIdx < 0 {
+			m.Sources = append(m.Sources, label)
+			m.Cells = append(m.Cells, make([]types.Counters, len(m.Destinations)))
+			srcIdx = len(m.Sources) - 1
+		}
+		for j, counters := range m2.Cells[i] {
+			m.Cells[srcIdx][dstIdx[j]].Add(counters)
+		}
+	}
+}
+
+// Clone returns a deep copy of the matrix
+func (m *Matrix) Clone() *Matrix {
+	c := &Matrix{
+		Sources:      slices.Clone(m.Sources),
+		Destinations: slices.Clone(m.Destinations),
+		Cells:        make([][]types.Counters, len(m.Cells)),
+	}
+	for i, row := range m.Cells {
+		c.Cells[i] = slices.Clone(row)
+	}
+	return c
+}
+
+// Print renders the matrix in the requested format (text heat table or CSV). Cells show the data
+// volume (or packets, if sorting by packets) in the given direction, summing up both directions
+// unless only received / sent traffic was requested
+func (m *Matrix) Print(w io.Writer, format string, sort SortOrder, d types.Direction) error {
+	values, totalsBySrc, totalsByDst, total := m.values(sort, d)
+
+	switch format {
+	case types.FormatCSV:
+		return m.printCSV(w, values, totalsBySrc, totalsByDst, total)
+	case types.FormatTXT:
+		format := TextFormatter{}.Size
+		if sort == SortPackets {
+			format = TextFormatter{}.Count
+		}
+		return m.printText(w, format, values, totalsBySrc, totalsByDst, total, describe(sort, d, nil))
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// values extracts the value to be displayed for each cell, along with the totals per source group,
+// per destination group and overall
+func (m *Matrix) values(sort SortOrder, d types.Direction) (values [][]uint64, totalsBySrc, totalsByDst []uint64, total uint64) {
+	value := func(c types.Counters) uint64 {
+		switch d {
+		case types.DirectionIn:
+			if sort == SortPackets {
+				return c.PacketsRcvd
+			}
+			return c.BytesRcvd
+		case types.DirectionOut:
+			if sort == SortPackets {
+				return c.PacketsSent
+			}
+			return c.BytesSent
+		}
+		if sort == SortPackets {
+			return c.SumPackets()
+		}
+		return c.SumBytes()
+	}
+
+	values = make([][]uint64, len(m.Sources))
+	totalsBySrc, totalsByDst = make([]uint64, len(m.Sources)), make([]uint64, len(m.Destinations))
+	for i, row := range m.Cells {
+		values[i] = make([]uint64, len(row))
+		for j, counters := range row {
+			values[i][j] = value(counters)
+			totalsBySrc[i] += values[i][j]
+			totalsByDst[j] += values[i][j]
+			total += values[i][j]
+		}
+	}
+	return
+}
+
+func (m *Matrix) printCSV(w io.Writer, values [][]uint64, totalsBySrc, totalsByDst []uint64, total uint64) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(append(append([]string{"src\\dst"}, m.Destinations...), "total")); err != nil {
+		return err
+	}
+	for i, label := range m.Sources {
+		record := []string{label}
+		for _, value := range values[i] {
+			record = append(record, strconv.FormatUint(value, 10))
+		}
+		if err := writer.Write(append(record, strconv.FormatUint(totalsBySrc[i], 10))); err != nil {
+			return err
+		}
+	}
+	record := []string{"total"}
+	for _, value := range totalsByDst {
+		record = append(record, strconv.FormatUint(value, 10))
+	}
+	if err := writer.Write(append(record, strconv.FormatUint(total, 10))); err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (m *Matrix) printText(w io.Writer, format func(uint64) string, values [][]uint64, totalsBySrc, totalsByDst []uint64, total uint64, description string) error {
+	var largest uint64
+	for _, row := range values {
+		largest = max(largest, slices.Max(append([]uint64{0}, row...)))
+	}
+
+	// the heat level indicates the share of a cell in the largest cell of the matrix
+	heat := func(value uint64) string {
+		if value == 0 || largest == 0 {
+			return heatLevels[0]
+		}
+		return heatLevels[1+int(uint64(len(heatLevels)-2)*value/largest)]
+	}
+
+	fmt.Fprintf(w, "Traffic matrix (%s)\n\n", description)
+
+	writer := tabwriter.NewWriter(w, 0, 1, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(writer, "src \\ dst\t")
+	for _, label := range append(slices.Clone(m.Destinations), "total") {
+		fmt.Fprintf(writer, "%s %s\t", label, heatLevels[0])
+	}
+	fmt.Fprintln(writer)
+	for i, label := range m.Sources {
+		fmt.Fprintf(writer, "%s\t", label)
+		for _, value := range values[i] {
+			fmt.Fprintf(writer, "%s %s\t", format(value), heat(value))
+		}
+		fmt.Fprintf(writer, "%s %s\t\n", format(totalsBySrc[i]), heatLevels[0])
+	}
+	fmt.Fprint(writer, "total\t")
+	for _, value := range totalsByDst {
+		fmt.Fprintf(writer, "%s %s\t", format(value), heatLevels[0])
+	}
+	fmt.Fprintf(writer, "%s %s\t\n", format(total), heatLevels[0])
+
+	return writer.Flush()
+}
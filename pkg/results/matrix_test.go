@@ -0,0 +1,71 @@
+package results
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatrix(t *testing.T) {
+	groups, err := types.ParsePrefixGroups("siteA=10.1.0.0/16;siteB=10.2.0.0/16")
+	require.Nil(t, err)
+
+	row := func(sip, dip string, bytesRcvd, bytesSent uint64) Row {
+		return Row{
+			Attributes: Attributes{SrcIP: netip.MustParseAddr(sip), DstIP: netip.MustParseAddr(dip)},
+			Counters:   types.Counters{BytesRcvd: bytesRcvd, BytesSent: bytesSent, PacketsRcvd: 1, PacketsSent: 1},
+		}
+	}
+	matrix := NewMatrix(groups, groups, Rows{
+		row("10.1.0.1", "10.2.0.1", 100, 200),
+		row("10.1.0.2", "10.2.0.2", 300, 400),
+		row("10.2.0.1", "8.8.8.8", 10, 20),
+	})
+	require.Equal(t, []string{"siteA", "siteB", types.PrefixGroupOther}, matrix.Sources)
+	require.Equal(t, types.Counters{BytesRcvd: 400, BytesSent: 600, PacketsRcvd: 2, PacketsSent: 2}, matrix.Cells[0][1])
+	require.Equal(t, types.Counters{BytesRcvd: 10, BytesSent: 20, PacketsRcvd: 1, PacketsSent: 1}, matrix.Cells[1][2])
+	require.Zero(t, matrix.Cells[0][0])
+
+	// matrices of other hosts are merged by the labels of their groups
+	other := &Matrix{
+		Sources:      []string{"siteB", "dmz"},
+		Destinations: []string{"siteA"},
+		Cells:        [][]types.Counters{{{BytesRcvd: 1}}, {{BytesSent: 2}}},
+	}
+	merged := new(Matrix)
+	merged.Add(matrix)
+	merged.Add(other)
+	require.Equal(t, []string{"siteA", "siteB", types.PrefixGroupOther, "dmz"}, merged.Sources)
+	require.Equal(t, matrix.Destinations, merged.Destinations)
+	require.Equal(t, types.Counters{BytesRcvd: 1}, merged.Cells[1][0])
+	require.Equal(t, types.Counters{BytesSent: 2}, merged.Cells[3][0])
+	require.Equal(t, matrix.Cells[0][1], merged.Cells[0][1])
+
+	// the merged matrix must not share any cells with the original one
+	require.Zero(t, matrix.Cells[1][0])
+	require.Equal(t, merged, merged.Clone())
+
+	var buf bytes.Buffer
+	require.Nil(t, matrix.Print(&buf, types.FormatCSV, SortTraffic, types.DirectionOut))
+	require.Equal(t, `src\dst,siteA,siteB,other,total
+siteA,0,600,0,600
+siteB,0,0,20,20
+other,0,0,0,0
+total,0,600,20,620
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, matrix.Print(&buf, types.FormatCSV, SortPackets, types.DirectionBoth))
+	require.Contains(t, buf.String(), "total,0,4,2,6\n")
+
+	buf.Reset()
+	require.Nil(t, matrix.Print(&buf, types.FormatTXT, SortTraffic, types.DirectionSum))
+	require.Contains(t, buf.String(), "Traffic matrix (accumulated data volume (sent and received))")
+	require.Contains(t, buf.String(), "1000    █")
+	require.Contains(t, buf.String(), "30    ░")
+
+	require.Error(t, matrix.Print(&buf, types.FormatJSON, SortTraffic, types.DirectionSum))
+}
@@ -0,0 +1,202 @@
+package results
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/export/parquet"
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// prefix of the keys of the summary entries stored in the key / value metadata of the Parquet file
+const parquetMetadataPrefix = "goprobe."
+
+// ParquetFormatter formats values as raw (unformatted) strings, which are converted to the type of
+// their column
+type ParquetFormatter struct{}
+
+// Size prints the size in bytes
+func (ParquetFormatter) Size(s uint64) string {
+	return strconv.FormatUint(s, 10)
+}
+
+// Duration prints the string representation of duration
+func (ParquetFormatter) Duration(d time.Duration) string {
+	return d.String()
+}
+
+// Count prints c
+func (ParquetFormatter) Count(c uint64) string {
+	return strconv.FormatUint(c, 10)
+}
+
+// Float prints f
+func (ParquetFormatter) Float(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Time prints epoch
+func (ParquetFormatter) Time(epoch int64) string {
+	return strconv.FormatInt(epoch, 10)
+}
+
+// String returns s
+func (ParquetFormatter) String(s string) string {
+	return s
+}
+
+// parquetCounterNames holds the (machine-friendly) names of the counter columns, indexed by
+// OutputColumn (relative to OutcolInPkts)
+var parquetCounterNames = []string{
+	types.PktsRcvdName, types.PktsRcvdName + "_percent", types.BytesRcvdName, types.BytesRcvdName + "_percent",
+	types.PktsSentName, types.PktsSentName + "_percent", types.BytesSentName, types.BytesSentName + "_percent",
+	"pkts", "pkts_percent", "bytes", "bytes_percent",
+	types.PktsRcvdName, types.PktsSentName, "pkts_percent", types.BytesRcvdName, types.BytesSentName, "bytes_percent",
+}
+
+// parquetType returns the type of the Parquet column of an output column
+func parquetType(col OutputColumn) parquet.Type {
+	switch col {
+	case OutcolTime:
+		return parquet.Timestamp
+	case OutcolDport:
+		return parquet.Uint16
+	case OutcolInPkts, OutcolInBytes, OutcolOutPkts, OutcolOutBytes, OutcolSumPkts, OutcolSumBytes,
+		OutcolBothPktsRcvd, OutcolBothPktsSent, OutcolBothBytesRcvd, OutcolBothBytesSent:
+		return parquet.Uint64
+	case OutcolInPktsPercent, OutcolInBytesPercent, OutcolOutPktsPercent, OutcolOutBytesPercent,
+		OutcolSumPktsPercent, OutcolSumBytesPercent, OutcolBothPktsPercent, OutcolBothBytesPercent:
+		return parquet.Double
+	}
+	return parquet.String
+}
+
+// parquetValue converts the raw value of a cell to the type of its column
+func parquetValue(t parquet.Type, value string) any {
+	switch t {
+	case parquet.Timestamp:
+		epoch, _ := strconv.ParseInt(value, 10, 64)
+		return time.Unix(epoch, 0)
+	case parquet.Uint16:
+		port, _ := strconv.ParseUint(value, 10, 16)
+		return uint16(port)
+	case parquet.Uint64:
+		count, _ := strconv.ParseUint(value, 10, 64)
+		return count
+	case parquet.Double:
+		f, _ := strconv.ParseFloat(value, 64)
+		return f
+	}
+	return value
+}
+
+// ParquetTablePrinter writes out all flows as Apache Parquet file with typed columns (timestamps,
+// ports, counters and percentages being numeric), to be analyzed by e.g. Spark, DuckDB or ClickHouse.
+// The summary of the result is stored in the key / value metadata of the file (written upon Print)
+type ParquetTablePrinter struct {
+	basePrinter
+
+	types  []parquet.Type
+	writer *parquet.Writer
+}
+
+// NewParquetTablePrinter creates a new ParquetTablePrinter
+func NewParquetTablePrinter(b basePrinter) *ParquetTablePrinter {
+	p := &ParquetTablePrinter{
+		basePrinter: b,
+	}
+
+	headers := b.columnHeaders()
+	columns := make([]parquet.Column, 0, len(p.cols))
+	for _, col := range p.cols {
+		name := headers[col]
+		if col >= OutcolInPkts && !col.isCustom() {
+			name = parquetCounterNames[col-OutcolInPkts]
+		}
+		p.types = append(p.types, parquetType(col))
+		columns = append(columns, parquet.Column{Name: name, Type: parquetType(col)})
+	}
+	p.writer = parquet.NewWriter(b.output, columns)
+
+	return p
+}
+
+// AddRow adds a flow entry to the ParquetTablePrinter
+func (p *ParquetTablePrinter) AddRow(row Row) error {
+	values := make([]any, len(p.cols))
+	for i, col := range p.cols {
+		values[i] = parquetValue(p.types[i], extract(ParquetFormatter{}, p.ips2domains, p.totals, p.custom, row, col))
+	}
+	return p.writer.WriteRow(values...)
+}
+
+// AddRows adds several flow entries to the ParquetTablePrinter
+func (p *ParquetTablePrinter) AddRows(ctx context.Context, rows Rows) error {
+	if p.summaryOnly {
+		return nil
+	}
+	return addRows(ctx, p, rows)
+}
+
+// Footer is a no-op, the summary of the result is stored in the metadata of the file upon Print
+func (p *ParquetTablePrinter) Footer(_ context.Context, _ *Result) error {
+	return nil
+}
+
+// Print writes the remaining rows and the metadata of the file
+func (p *ParquetTablePrinter) Print(result *Result) error {
+	f := ParquetFormatter{}
+	entry := func(key, value string) {
+		p.writer.SetMetadata(parquetMetadataPrefix+key, value)
+	}
+
+	if result != nil {
+		summary := result.Summary
+		entry("interfaces", strings.Join(summary.Interfaces, ","))
+		entry("first", summary.First.UTC().Format(time.RFC3339))
+		entry("last", summary.Last.UTC().Format(time.RFC3339))
+		if result.Query.Condition != "" {
+			entry("condition", result.Query.Condition)
+		}
+		if result.Query.TimeWindows != "" {
+			entry("time_windows", result.Query.TimeWindows)
+		}
+	}
+	entry("sorting", describe(p.sort, p.direction, p.aliases))
+	entry(types.PktsRcvdName, f.Count(p.totals.PacketsRcvd))
+	entry(types.PktsSentName, f.Count(p.totals.PacketsSent))
+	entry(types.BytesRcvdName, f.Size(p.totals.BytesRcvd))
+	entry(types.BytesSentName, f.Size(p.totals.BytesSent))
+
+	if result != nil {
+		summary := result.Summary
+		entry("hits_displayed", strconv.Itoa(summary.Hits.Displayed))
+		entry("hits_total", strconv.Itoa(summary.Hits.Total))
+		if len(summary.ByteAccounting) > 0 {
+			entry("byte_accounting", strings.Join(summary.ByteAccounting, ","))
+		}
+
+		var warnings []string
+		if summary.TruncatedByDeadline {
+			warnings = append(warnings, "query deadline reached, results are partial")
+		}
+		if summary.TopNApproximate {
+			warnings = append(warnings, "ranking of the rows could not be verified, rows may be missing or ranked incorrectly")
+		}
+		warnings = append(warnings, result.Query.Warnings...)
+		if len(warnings) > 0 {
+			entry("warnings", strings.Join(warnings, "\n"))
+		}
+		if provenance := summary.Provenance; provenance != nil {
+			sources := make([]string, 0, len(provenance.Sources))
+			for _, source := range provenance.Sources {
+				sources = append(sources, source.String())
+			}
+			entry("sources", strings.Join(sources, "\n"))
+		}
+	}
+
+	return p.writer.Close()
+}
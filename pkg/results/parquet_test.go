@@ -0,0 +1,62 @@
+package results
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParquetTablePrinter(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("time,sip,dip,dport")
+	require.Nil(t, err)
+
+	render := func(result *Result, direction types.Direction, summaryOnly bool) []byte {
+		buf := new(bytes.Buffer)
+		printer, err := NewTablePrinter(buf, &PrinterConfig{
+			Format:        types.FormatParquet,
+			SortOrder:     SortTraffic,
+			LabelSelector: selector,
+			Direction:     direction,
+			Attributes:    attributes,
+			Totals:        result.Summary.Totals,
+			NumFlows:      result.Summary.Hits.Total,
+			summaryOnly:   summaryOnly,
+		})
+		require.Nil(t, err)
+
+		require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+		require.Nil(t, printer.Footer(context.Background(), result))
+		require.Nil(t, printer.Print(result))
+
+		data := buf.Bytes()
+		require.Equal(t, "PAR1", string(data[:4]))
+		require.Equal(t, "PAR1", string(data[len(data)-4:]))
+		return data
+	}
+
+	result := testPrinterResult()
+	result.Query.Condition = "dport = 443"
+	data := render(result, types.DirectionSum, false)
+
+	// the schema and the summary are stored (uncompressed) in the footer
+	for _, column := range []string{"time", "sip", "dip", "dport", "pkts", "pkts_percent", "bytes", "bytes_percent"} {
+		require.True(t, bytes.Contains(data, []byte(column)), "missing column %s", column)
+	}
+	for _, entry := range []string{"goprobe.interfaces", "eth0", "goprobe.condition", "dport = 443", "goprobe.hits_total"} {
+		require.True(t, bytes.Contains(data, []byte(entry)), "missing metadata %s", entry)
+	}
+	require.True(t, bytes.Contains(data, []byte("10.0.0.1")))
+
+	data = render(result, types.DirectionBoth, false)
+	for _, column := range []string{"pkts_rcvd", "pkts_sent", "bytes_rcvd", "bytes_sent"} {
+		require.True(t, bytes.Contains(data, []byte(column)), "missing column %s", column)
+	}
+
+	// no rows are written if they are skipped
+	data = render(result, types.DirectionSum, true)
+	require.False(t, bytes.Contains(data, []byte("10.0.0.1")))
+	require.True(t, bytes.Contains(data, []byte("goprobe.interfaces")))
+}
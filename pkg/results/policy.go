@@ -0,0 +1,14 @@
+package results
+
+// ResourcePolicy denotes the resource limits a host applied to a query, as determined by the
+// (time-of-day dependent) resource policy in effect when the query was run
+type ResourcePolicy struct {
+	// Hostname: the host which applied the policy
+	Hostname string `json:"host,omitempty" doc:"Host which applied the policy" example:"hostA"`
+	// Name: the name of the policy
+	Name string `json:"name" doc:"Name of the policy in effect when the query was run" example:"business-hours"`
+	// ProcessingUnits: the number of processing units the query was run with
+	ProcessingUnits int `json:"processing_units" doc:"Number of processing units (parallel block readers) the query was run with" example:"2"`
+	// MaxMemPct: the maximum percentage of available host memory the query was allowed to use
+	MaxMemPct int `json:"max_mem_pct" doc:"Maximum percentage of available host memory the query was allowed to use" example:"20"`
+}
@@ -49,12 +49,24 @@ func (tr TimeRange) PrintFooter(fw *FooterTabwriter) error {
 	)
 }
 
-// PrintFooter prints the conditions of the query in case they are available
+// PrintFooter prints the time windows, conditions and warnings of the query in case they are available
 func (q Query) PrintFooter(fw *FooterTabwriter) error {
-	if q.Condition == "" {
-		return nil
+	if q.TimeWindows != "" {
+		if err := fw.WriteEntry("Time windows", q.TimeWindows); err != nil {
+			return err
+		}
 	}
-	return fw.WriteEntry("Conditions", q.Condition)
+	if q.Condition != "" {
+		if err := fw.WriteEntry("Conditions", q.Condition); err != nil {
+			return err
+		}
+	}
+	for _, warning := range q.Warnings {
+		if err := fw.WriteEntry("Warning", "%s", warning); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // PrintFooter prints the queried hosts summary (total, ok, empty, error)
@@ -0,0 +1,75 @@
+package results
+
+import (
+	"time"
+)
+
+// Profile provides per-stage timings of a query, allowing to assess where a (slow) query spends its
+// time. Stages processed concurrently (block reads, decompression and aggregation) are accumulated
+// across all workers and may hence exceed the overall query duration
+type Profile struct {
+	// DirWalk: time spent walking the DB directories to determine the workloads
+	DirWalk time.Duration `json:"dir_walk_ns" doc:"Time spent walking the DB directories to determine the workloads (in nanoseconds)" example:"1200000"`
+	// BlockRead: time spent reading blocks from disk (accumulated across all workers)
+	BlockRead time.Duration `json:"block_read_ns" doc:"Time spent reading blocks from disk, accumulated across all workers (in nanoseconds)" example:"35000000"`
+	// Decompression: time spent decompressing blocks (accumulated across all workers)
+	Decompression time.Duration `json:"decompression_ns" doc:"Time spent decompressing blocks, accumulated across all workers (in nanoseconds)" example:"48000000"`
+	// Aggregation: time spent evaluating conditions and aggregating flows (accumulated across all workers)
+	Aggregation time.Duration `json:"aggregation_ns" doc:"Time spent evaluating conditions and aggregating flows, accumulated across all workers (in nanoseconds)" example:"120000000"`
+	// Merge: time spent merging the flows aggregated by the individual workers
+	Merge time.Duration `json:"merge_ns" doc:"Time spent merging the flows aggregated by the individual workers (in nanoseconds)" example:"15000000"`
+	// Stall: time workers spent blocked passing their results on to the merge stage (accumulated across all workers)
+	Stall time.Duration `json:"stall_ns,omitempty" doc:"Time workers spent blocked passing their results on to the merge stage, accumulated across all workers (in nanoseconds)" example:"3000000"`
+	// Sort: time spent sorting the result rows
+	Sort time.Duration `json:"sort_ns" doc:"Time spent sorting the result rows (in nanoseconds)" example:"2500000"`
+	// DNSResolution: time spent on reverse DNS lookups
+	DNSResolution time.Duration `json:"dns_resolution_ns,omitempty" doc:"Time spent on reverse DNS lookups (in nanoseconds)" example:"515000000"`
+	// ResultPreparation: time spent converting the aggregated flows to result rows
+	ResultPreparation time.Duration `json:"result_preparation_ns" doc:"Time spent converting the aggregated flows to result rows (in nanoseconds)" example:"4000000"`
+	// Serialization: time spent rendering / marshalling the result. It is only known to the client
+	// producing the output (e.g. goQuery) once done, hence it is not part of results returned by the API
+	Serialization time.Duration `json:"serialization_ns,omitempty" doc:"Time spent rendering / marshalling the result (in nanoseconds), only provided by clients rendering the output themselves" example:"1500000"`
+}
+
+// Add adds the timings of profile to p
+func (p *Profile) Add(profile *Profile) {
+	if profile == nil {
+		return
+	}
+	p.DirWalk += profile.DirWalk
+	p.BlockRead += profile.BlockRead
+	p.Decompression += profile.Decompression
+	p.Aggregation += profile.Aggregation
+	p.Merge += profile.Merge
+	p.Stall += profile.Stall
+	p.Sort += profile.Sort
+	p.DNSResolution += profile.DNSResolution
+	p.ResultPreparation += profile.ResultPreparation
+	p.Serialization += profile.Serialization
+}
+
+// profileStage denotes a single (named) stage of a profile
+type profileStage struct {
+	name     string
+	duration time.Duration
+}
+
+// stages returns all stages of the profile in order of processing (omitting the serialization unless
+// it has been measured already)
+func (p *Profile) stages() []profileStage {
+	stages := []profileStage{
+		{"Directory walk", p.DirWalk},
+		{"Block reads", p.BlockRead},
+		{"Decompression", p.Decompression},
+		{"Aggregation", p.Aggregation},
+		{"Merge", p.Merge},
+		{"Merge stalls", p.Stall},
+		{"Sort", p.Sort},
+		{"DNS resolution", p.DNSResolution},
+		{"Result preparation", p.ResultPreparation},
+	}
+	if p.Serialization > 0 {
+		stages = append(stages, profileStage{"Serialization", p.Serialization})
+	}
+	return stages
+}
@@ -0,0 +1,110 @@
+package results
+
+import (
+	"maps"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/els0r/goProbe/pkg/types"
+)
+
+// Project removes all attributes and labels not visible according to the visibility function (which is
+// called with their names as used in queries, e.g. "sip" or "iface") from the result in place. Rows
+// becoming indistinguishable are merged, retaining the order of their first occurrence. The traffic
+// matrix is removed unless both the source and destination IPs are visible
+func (r *Result) Project(visible func(name string) bool) {
+	r.Query.Attributes = slices.DeleteFunc(r.Query.Attributes, func(name string) bool {
+		return !visible(name)
+	})
+	if !visible(types.SIPName) || !visible(types.DIPName) {
+		r.Summary.Matrix = nil
+	}
+
+	var (
+		rowIdx    = make(map[MergeableAttributes]int, len(r.Rows))
+		projected = r.Rows[:0]
+	)
+	for _, row := range r.Rows {
+		row.Labels = row.Labels.project(visible)
+		row.Attributes = row.Attributes.project(visible)
+
+		key := MergeableAttributes{row.Labels, row.Attributes}
+		if idx, exists := rowIdx[key]; exists {
+			projected[idx].Counters.Add(row.Counters)
+			continue
+		}
+		rowIdx[key] = len(projected)
+		projected = append(projected, row)
+	}
+	clear(r.Rows[len(projected):])
+	r.Rows = projected
+	r.Summary.Hits.Displayed = len(r.Rows)
+}
+
+func (l Labels) project(visible func(name string) bool) Labels {
+	if !visible(types.TimeName) {
+		l.Timestamp = time.Time{}
+	}
+	if !visible(types.IfaceName) {
+		l.Iface = ""
+	}
+	if !visible(types.ZoneName) {
+		l.Zone = ""
+	}
+	if !visible(types.TagName) {
+		l.Tag = ""
+	}
+	if !visible(types.ProcessName) {
+		l.Process = ""
+	}
+	if !visible(types.VLANName) {
+		l.VLAN = 0
+	}
+	if !visible(types.SMACName) {
+		l.SMAC = ""
+	}
+	if !visible(types.DMACName) {
+		l.DMAC = ""
+	}
+	if !visible(types.TCPFlagsName) {
+		l.TCPFlags = ""
+	}
+	if !visible(types.DSCPName) {
+		l.DSCP = ""
+	}
+	if !visible(types.HostnameName) {
+		l.Hostname = ""
+	}
+	if !visible(types.HostIDName) {
+		l.HostID = ""
+	}
+	return l
+}
+
+func (a Attributes) project(visible func(name string) bool) Attributes {
+	if !visible(types.SIPName) {
+		a.SrcIP = netip.Addr{}
+	}
+	if !visible(types.DIPName) {
+		a.DstIP = netip.Addr{}
+	}
+	if !visible(types.ProtoName) {
+		a.IPProto = 0
+	}
+	if !visible(types.DportName) {
+		a.DstPort = 0
+	}
+	if !visible(types.DportClassName) {
+		a.DstPortClass = ""
+	}
+
+	// custom attributes are projected by their names
+	if custom := a.Custom.Map(); len(custom) > 0 {
+		maps.DeleteFunc(custom, func(name, _ string) bool {
+			return !visible(name)
+		})
+		a.Custom = NewCustomAttributes(custom)
+	}
+	return a
+}
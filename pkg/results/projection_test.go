@@ -0,0 +1,41 @@
+package results
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProject(t *testing.T) {
+	var (
+		ip1 = netip.MustParseAddr("10.0.0.1")
+		ip2 = netip.MustParseAddr("10.0.0.2")
+		ip3 = netip.MustParseAddr("8.8.8.8")
+	)
+	result := New()
+	result.Query.Attributes = []string{types.SIPName, types.DIPName, types.DportName, types.ProtoName}
+	result.Summary.Matrix = &Matrix{}
+	result.Rows = Rows{
+		{Labels: Labels{Iface: "eth0", Hostname: "hostA"}, Attributes: Attributes{SrcIP: ip1, DstIP: ip3, IPProto: 6, DstPort: 443, Custom: NewCustomAttributes(map[string]string{"app": "web", "owner": "teamA"})}, Counters: types.Counters{BytesRcvd: 1}},
+		{Labels: Labels{Iface: "eth0", Hostname: "hostA"}, Attributes: Attributes{SrcIP: ip2, DstIP: ip3, IPProto: 17, DstPort: 53}, Counters: types.Counters{BytesRcvd: 2}},
+		{Labels: Labels{Iface: "eth0", Hostname: "hostA"}, Attributes: Attributes{SrcIP: ip2, DstIP: ip3, IPProto: 6, DstPort: 443, Custom: NewCustomAttributes(map[string]string{"app": "web", "owner": "teamB"})}, Counters: types.Counters{BytesRcvd: 4}},
+	}
+	result.Summary.Hits = Hits{Displayed: 3, Total: 3}
+
+	visible := []string{types.DportName, types.ProtoName, types.IfaceName, "app"}
+	result.Project(func(name string) bool {
+		return slices.Contains(visible, name)
+	})
+
+	// rows differing in hidden attributes only are merged
+	require.Equal(t, []string{types.DportName, types.ProtoName}, result.Query.Attributes)
+	require.Nil(t, result.Summary.Matrix)
+	require.Equal(t, Rows{
+		{Labels: Labels{Iface: "eth0"}, Attributes: Attributes{IPProto: 6, DstPort: 443, Custom: NewCustomAttributes(map[string]string{"app": "web"})}, Counters: types.Counters{BytesRcvd: 5}},
+		{Labels: Labels{Iface: "eth0"}, Attributes: Attributes{IPProto: 17, DstPort: 53}, Counters: types.Counters{BytesRcvd: 2}},
+	}, result.Rows)
+	require.Equal(t, Hits{Displayed: 2, Total: 3}, result.Summary.Hits)
+}
@@ -0,0 +1,102 @@
+package results
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sampling states of a source, denoting to which extent the data available to a query was processed
+const (
+	// SamplingNone denotes that all data available to the query was processed (goProbe itself
+	// captures all packets, hence flows are never sampled)
+	SamplingNone = "none"
+
+	// SamplingPartial denotes that processing was cut short by the query deadline, hence only a
+	// subset of the data available was processed
+	SamplingPartial = "partial"
+)
+
+// Provenance documents where the data of a result originated from and how it was obtained, allowing
+// to assess the quality of the result and to reproduce the query later
+type Provenance struct {
+	// Sources: the hosts / DBs the data originated from
+	Sources []Source `json:"sources" doc:"Hosts / DBs the data of the result originated from"`
+}
+
+// Source documents the data a single host contributed to a result
+type Source struct {
+	// Hostname: the host the data originated from
+	Hostname string `json:"hostname,omitempty" doc:"Hostname of the host the data originated from" example:"hostA"`
+	// HostID: the ID of the host the data originated from
+	HostID string `json:"host_id,omitempty" doc:"ID of the host the data originated from" example:"123456"`
+	// Version: the version of the software which ran the query
+	Version string `json:"version" doc:"Version of goProbe / goQuery which ran the query on the host" example:"v4.1.0"`
+	// DBPath: the path of the DB queried
+	DBPath string `json:"db_path,omitempty" doc:"Path of the DB queried on the host" example:"/usr/local/goProbe/db"`
+
+	// Blocks: the time range covered by the blocks actually read (nil if no block was read)
+	Blocks *TimeRange `json:"blocks,omitempty" doc:"Time range actually covered by the blocks read from the DB (absent if no block was read)"`
+	// Encoders: the encoders / compressors of the blocks read
+	Encoders []string `json:"encoders,omitempty" doc:"Encoders / compressors of the blocks read from the DB" example:"lz4,zstd"`
+	// CorruptBlocks: the blocks skipped since they could not be read or processed
+	CorruptBlocks []CorruptBlock `json:"corrupt_blocks,omitempty" doc:"Blocks skipped since they could not be read or processed"`
+
+	// Live: live flows (not yet written to the DB) were included
+	Live bool `json:"live,omitempty" doc:"Live flows not yet written to the DB were included (which a later query cannot reproduce)" example:"false"`
+	// Sampling: the extent to which the data available was processed
+	Sampling string `json:"sampling" doc:"Extent to which the data available was processed (partial if processing was cut short by the query deadline)" enum:"none,partial" example:"none"`
+}
+
+// CorruptBlock denotes a block of the DB which could not be read or processed
+type CorruptBlock struct {
+	// Iface: the interface the block belongs to
+	Iface string `json:"iface" doc:"Interface the block belongs to" example:"eth0"`
+	// Timestamp: the timestamp of the block
+	Timestamp time.Time `json:"timestamp" doc:"Timestamp (end) of the 5-minute interval stored in the block" example:"2024-04-12T03:20:00+02:00"`
+}
+
+// Add adds the sources of another provenance (e.g. of the result of another host)
+func (p *Provenance) Add(p2 *Provenance) {
+	if p2 == nil {
+		return
+	}
+	p.Sources = append(p.Sources, p2.Sources...)
+}
+
+// Clone returns a deep copy of the provenance
+func (p *Provenance) Clone() *Provenance {
+	c := &Provenance{Sources: slices.Clone(p.Sources)}
+	for i, source := range c.Sources {
+		if source.Blocks != nil {
+			blocks := *source.Blocks
+			c.Sources[i].Blocks = &blocks
+		}
+		c.Sources[i].Encoders = slices.Clone(source.Encoders)
+		c.Sources[i].CorruptBlocks = slices.Clone(source.CorruptBlocks)
+	}
+	return c
+}
+
+// String returns a single-line description of the source
+func (s Source) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version=%s", s.Version)
+	if s.DBPath != "" {
+		fmt.Fprintf(&sb, " db=%s", s.DBPath)
+	}
+	if s.Blocks != nil {
+		fmt.Fprintf(&sb, " blocks=%s-%s", s.Blocks.First.Format(time.RFC3339), s.Blocks.Last.Format(time.RFC3339))
+	}
+	if len(s.Encoders) > 0 {
+		fmt.Fprintf(&sb, " encoders=%s", strings.Join(s.Encoders, ","))
+	}
+	fmt.Fprintf(&sb, " corrupt_blocks=%d", len(s.CorruptBlocks))
+	if s.Live {
+		sb.WriteString(" live=true")
+	}
+	fmt.Fprintf(&sb, " sampling=%s", s.Sampling)
+
+	return sb.String()
+}
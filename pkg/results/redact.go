@@ -0,0 +1,225 @@
+package results
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/netip"
+	"strings"
+)
+
+const (
+	redactionKeyLen = 32
+
+	redactedHostPrefix = "host-"
+	redactedHostLen    = 8 // number of hex characters of a redacted host name / ID
+)
+
+// Redactor consistently pseudonymizes the IP addresses and host names / IDs of results, allowing them to be
+// shared without leaking internal addressing. Pseudonyms are derived via keyed hashing, hence the same
+// address always maps to the same pseudonym for a given Redactor. Since the key is random, pseudonyms
+// cannot be correlated across Redactors (i.e. across runs)
+type Redactor struct {
+	mac hash.Hash
+
+	preservePrefixes bool
+
+	ips   map[netip.Addr]netip.Addr
+	hosts map[string]string
+}
+
+// RedactorOption configures the Redactor
+type RedactorOption func(*Redactor)
+
+// WithPreservedPrefixes makes the pseudonymization of IP addresses prefix-preserving: two addresses
+// sharing a prefix of n bits map to pseudonyms sharing a prefix of n bits as well (but not the
+// original prefix), retaining the subnet structure of the result
+func WithPreservedPrefixes(b bool) RedactorOption {
+	return func(r *Redactor) {
+		r.preservePrefixes = b
+	}
+}
+
+// WithRedactionKey sets the key used to derive the pseudonyms (instead of a random one), making them
+// reproducible across runs
+func WithRedactionKey(key []byte) RedactorOption {
+	return func(r *Redactor) {
+		r.mac = hmac.New(sha256.New, key)
+	}
+}
+
+// NewRedactor creates a new Redactor keyed with a random key
+func NewRedactor(opts ...RedactorOption) (*Redactor, error) {
+	r := &Redactor{
+		ips:   make(map[netip.Addr]netip.Addr),
+		hosts: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.mac == nil {
+		key := make([]byte, redactionKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate redaction key: %w", err)
+		}
+		r.mac = hmac.New(sha256.New, key)
+	}
+	return r, nil
+}
+
+// Redact pseudonymizes all IP addresses (in the rows and the query condition) and host names / IDs
+// of the result in place
+func (r *Redactor) Redact(result *Result) {
+	if result.Hostname != "" {
+		result.Hostname = r.Host(result.Hostname)
+	}
+	if len(result.HostsStatuses) > 0 {
+		statuses := make(HostsStatuses, len(result.HostsStatuses))
+		for host, status := range result.HostsStatuses {
+			statuses[r.Host(host)] = status
+		}
+		result.HostsStatuses = statuses
+	}
+
+	result.Query.Condition = r.redactIPs(result.Query.Condition)
+	if len(result.Query.Warnings) > 0 {
+		warnings := make([]string, len(result.Query.Warnings))
+		for i, warning := range result.Query.Warnings {
+			warnings[i] = r.redactIPs(warning)
+		}
+		result.Query.Warnings = warnings
+	}
+
+	if provenance := result.Summary.Provenance; provenance != nil {
+		for i := range provenance.Sources {
+			source := &provenance.Sources[i]
+			if source.Hostname != "" {
+				source.Hostname = r.Host(source.Hostname)
+			}
+			if source.HostID != "" {
+				source.HostID = r.Host(source.HostID)
+			}
+		}
+	}
+
+	for i := range result.Summary.ResourcePolicies {
+		policy := &result.Summary.ResourcePolicies[i]
+		if policy.Hostname != "" {
+			policy.Hostname = r.Host(policy.Hostname)
+		}
+	}
+
+	for i := range result.Summary.ResourceUsage {
+		usage := &result.Summary.ResourceUsage[i]
+		if usage.Hostname != "" {
+			usage.Hostname = r.Host(usage.Hostname)
+		}
+	}
+
+	for i := range result.Rows {
+		labels, attributes := &result.Rows[i].Labels, &result.Rows[i].Attributes
+		if labels.Hostname != "" {
+			labels.Hostname = r.Host(labels.Hostname)
+		}
+		if labels.HostID != "" {
+			labels.HostID = r.Host(labels.HostID)
+		}
+		attributes.SrcIP = r.IP(attributes.SrcIP)
+		attributes.DstIP = r.IP(attributes.DstIP)
+	}
+}
+
+// IP returns the pseudonym of the IP address, which is of the same family (IPv4 / IPv6). Invalid
+// addresses are returned as is
+func (r *Redactor) IP(ip netip.Addr) netip.Addr {
+	if !ip.IsValid() {
+		return ip
+	}
+	if pseudonym, exists := r.ips[ip]; exists {
+		return pseudonym
+	}
+
+	var pseudonym netip.Addr
+	if ip.Is4() {
+		pseudonym = netip.AddrFrom4([4]byte(r.pseudonymize(ip.AsSlice())))
+	} else {
+		pseudonym = netip.AddrFrom16([16]byte(r.pseudonymize(ip.AsSlice()))).WithZone(ip.Zone())
+	}
+	r.ips[ip] = pseudonym
+
+	return pseudonym
+}
+
+// Host returns the pseudonym of the host name / ID
+func (r *Redactor) Host(host string) string {
+	if pseudonym, exists := r.hosts[host]; exists {
+		return pseudonym
+	}
+	pseudonym := redactedHostPrefix + hex.EncodeToString(r.sum([]byte(host)))[:redactedHostLen]
+	r.hosts[host] = pseudonym
+
+	return pseudonym
+}
+
+// pseudonymize derives the pseudonym of the address bytes. In prefix-preserving mode, each bit is
+// flipped depending on all preceding bits (the same scheme as Crypto-PAn), otherwise all bits are
+// replaced by the keyed hash of the address
+func (r *Redactor) pseudonymize(addr []byte) []byte {
+	if !r.preservePrefixes {
+		return r.sum(addr)[:len(addr)]
+	}
+
+	pseudonym := make([]byte, len(addr))
+	prefix := make([]byte, len(addr)+1)
+	for bit := 0; bit < 8*len(addr); bit++ {
+		// the input of the PRF consists of the preceding bits and the current bit position (so that
+		// prefixes of different lengths don't collide)
+		prefix[len(addr)] = byte(bit)
+		if r.sum(prefix)[0]&1 == 1 {
+			pseudonym[bit/8] |= 0x80 >> (bit % 8)
+		}
+		pseudonym[bit/8] ^= addr[bit/8] & (0x80 >> (bit % 8))
+		prefix[bit/8] |= addr[bit/8] & (0x80 >> (bit % 8))
+	}
+	return pseudonym
+}
+
+func (r *Redactor) sum(data []byte) []byte {
+	r.mac.Reset()
+	r.mac.Write(data)
+	return r.mac.Sum(nil)
+}
+
+// redactIPs replaces all IP addresses and prefixes within s by their pseudonyms
+func (r *Redactor) redactIPs(s string) string {
+	isAddrChar := func(c byte) bool {
+		return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') ||
+			c == ':' || c == '.' || c == '/'
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if !isAddrChar(s[i]) {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isAddrChar(s[j]) {
+			j++
+		}
+
+		token := s[i:j]
+		if ip, err := netip.ParseAddr(token); err == nil {
+			token = r.IP(ip).String()
+		} else if prefix, err := netip.ParsePrefix(token); err == nil {
+			token = netip.PrefixFrom(r.IP(prefix.Addr()), prefix.Bits()).Masked().String()
+		}
+		sb.WriteString(token)
+		i = j
+	}
+	return sb.String()
+}
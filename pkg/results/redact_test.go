@@ -0,0 +1,93 @@
+package results
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	r, err := NewRedactor()
+	require.Nil(t, err)
+
+	var (
+		ip4 = netip.MustParseAddr("10.0.0.1")
+		ip6 = netip.MustParseAddr("2001:db8::1")
+	)
+	result := New()
+	result.Hostname = "hostA"
+	result.HostsStatuses["hostA"] = Status{Code: types.StatusOK}
+	result.Query.Condition = "(sip = 10.0.0.1 | dip = 2001:db8::1) & dport = 443 & snet = 10.0.0.0/8"
+	result.Rows = Rows{
+		{Labels: Labels{Hostname: "hostA", HostID: "123456"}, Attributes: Attributes{SrcIP: ip4, DstIP: ip6, DstPort: 443}},
+		{Labels: Labels{Hostname: "hostA", HostID: "123456"}, Attributes: Attributes{SrcIP: ip6, DstIP: ip4, DstPort: 443}},
+	}
+	result.Summary.Provenance = &Provenance{Sources: []Source{{Hostname: "hostA", HostID: "123456", Sampling: SamplingNone}}}
+
+	r.Redact(result)
+
+	// pseudonyms are consistent and preserve the address family
+	redacted4, redacted6 := result.Rows[0].Attributes.SrcIP, result.Rows[0].Attributes.DstIP
+	require.True(t, redacted4.Is4())
+	require.True(t, redacted6.Is6())
+	require.NotEqual(t, ip4, redacted4)
+	require.NotEqual(t, ip6, redacted6)
+	require.Equal(t, redacted6, result.Rows[1].Attributes.SrcIP)
+	require.Equal(t, redacted4, result.Rows[1].Attributes.DstIP)
+	require.Equal(t, uint16(443), result.Rows[0].Attributes.DstPort)
+
+	// host names / IDs are stripped
+	require.True(t, strings.HasPrefix(result.Hostname, redactedHostPrefix))
+	require.Equal(t, result.Hostname, result.Rows[0].Labels.Hostname)
+	require.NotEqual(t, "123456", result.Rows[0].Labels.HostID)
+	require.Contains(t, result.HostsStatuses, result.Hostname)
+	require.NotContains(t, result.HostsStatuses, "hostA")
+	require.Equal(t, result.Hostname, result.Summary.Provenance.Sources[0].Hostname)
+	require.Equal(t, result.Rows[0].Labels.HostID, result.Summary.Provenance.Sources[0].HostID)
+
+	// IP addresses in the condition map to the same pseudonyms
+	require.True(t, strings.HasPrefix(result.Query.Condition, "(sip = "+redacted4.String()+" | dip = "+redacted6.String()+") & dport = 443 & snet = "))
+	require.NotContains(t, result.Query.Condition, "10.0.0.")
+}
+
+func TestRedactPreservedPrefixes(t *testing.T) {
+	r, err := NewRedactor(WithPreservedPrefixes(true), WithRedactionKey([]byte("test")))
+	require.Nil(t, err)
+
+	var tests = []struct {
+		a, b       string
+		commonBits int
+	}{
+		{"10.0.0.1", "10.0.0.2", 30},
+		{"10.1.2.3", "10.200.2.3", 8},
+		{"192.168.1.1", "10.0.0.1", 0},
+		{"2001:db8::1", "2001:db8:1::1", 47},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+"_"+test.b, func(t *testing.T) {
+			a, b := r.IP(netip.MustParseAddr(test.a)), r.IP(netip.MustParseAddr(test.b))
+			require.NotEqual(t, netip.MustParseAddr(test.a), a)
+			require.Equal(t, test.commonBits, commonPrefixLen(a, b))
+		})
+	}
+
+	// the same key yields the same pseudonyms
+	r2, err := NewRedactor(WithPreservedPrefixes(true), WithRedactionKey([]byte("test")))
+	require.Nil(t, err)
+	require.Equal(t, r.IP(netip.MustParseAddr("10.0.0.1")), r2.IP(netip.MustParseAddr("10.0.0.1")))
+}
+
+func commonPrefixLen(a, b netip.Addr) int {
+	ab, bb := a.AsSlice(), b.AsSlice()
+	for bit := 0; bit < 8*len(ab); bit++ {
+		mask := byte(0x80 >> (bit % 8))
+		if ab[bit/8]&mask != bb[bit/8]&mask {
+			return bit
+		}
+	}
+	return 8 * len(ab)
+}
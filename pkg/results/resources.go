@@ -0,0 +1,22 @@
+package results
+
+import "time"
+
+// ResourceUsage denotes the resources a host spent on a query, as accounted by its query pool (the
+// pool bounding the processing units shared by all queries run concurrently on the host)
+type ResourceUsage struct {
+	// Hostname: the host which ran the query
+	Hostname string `json:"host,omitempty" doc:"Host which ran the query" example:"hostA"`
+	// ProcessingUnits: the number of processing units granted to the query
+	ProcessingUnits int `json:"processing_units" doc:"Number of processing units (parallel block readers) granted to the query by the query pool" example:"2"`
+	// Goroutines: the number of goroutines currently run on behalf of the query
+	Goroutines int `json:"goroutines" doc:"Number of goroutines run on behalf of the query at the time of reporting (zero once it completed)" example:"0"`
+	// PeakGoroutines: the maximum number of goroutines run concurrently on behalf of the query
+	PeakGoroutines int `json:"peak_goroutines" doc:"Maximum number of goroutines run concurrently on behalf of the query" example:"4"`
+	// MemBytes: the estimated memory occupied by the flows aggregated by the query
+	MemBytes uint64 `json:"mem_bytes" doc:"Estimated memory occupied by the flows aggregated by the query at the time of reporting (in bytes)" example:"1048576"`
+	// PeakMemBytes: the maximum estimated memory occupied by the flows aggregated by the query
+	PeakMemBytes uint64 `json:"peak_mem_bytes" doc:"Maximum estimated memory occupied by the flows aggregated by the query (in bytes)" example:"2097152"`
+	// QueueWait: the time the query waited for processing units to become available
+	QueueWait time.Duration `json:"queue_wait_ns" doc:"Time the query waited for processing units to become available (in nanoseconds)" example:"1500000"`
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/netip"
+	"slices"
 	"sort"
 	"strings"
 	"text/tabwriter"
@@ -27,6 +29,8 @@ var (
 type Result struct {
 	// Hostname: from which the result originated
 	Hostname string `json:"hostname,omitempty" doc:"Hostname from which the result originated" example:"hostA"`
+	// ID: the ID of the query, allowing to re-attach to it
+	ID string `json:"query_id,omitempty" doc:"ID of the query, allowing to re-attach to it (only set for checkpointed distributed queries and stored results)" example:"5f0c6e2a9d7b4c1e8a3f2b6d9e0c4a7b"`
 
 	// Status: the overall status of the result
 	Status Status `json:"status" doc:"Status of the result"`
@@ -73,6 +77,10 @@ type Query struct {
 	Attributes []string `json:"attributes" doc:"Attributes which were queried" example:"sip,dip,dport"`
 	// Condition: the condition that was provided
 	Condition string `json:"condition,omitempty" doc:"Condition which was provided" example:"port=80 && proto=TCP"`
+	// TimeWindows: the recurring time windows the query was restricted to
+	TimeWindows string `json:"time_windows,omitempty" doc:"Recurring time windows the query was restricted to" example:"mon,tue,wed,thu,fri 09:00-17:00 (Europe/Zurich)"`
+	// Warnings: issues with the query that didn't prevent it from being run
+	Warnings []string `json:"warnings,omitempty" doc:"Issues with the query that didn't prevent it from being run, e.g. hostnames in the condition resolving to multiple addresses" example:"hostname www.example.com resolves to 2 addresses (93.184.215.14, 2606:2800:21f:cb07:6820:80da:af6b:8b2c), conditions apply to all of them"`
 }
 
 // TimeRange describes the interval for which data is queried and presented
@@ -98,6 +106,26 @@ type Summary struct {
 	DataAvailable bool `json:"data_available" doc:"Was there any data available to query at all"`
 	// Stats tracks interactions with the underlying DB data
 	Stats *workload.Stats `json:"stats,omitempty" doc:"Stats tracks interactions with the underlying DB data"`
+	// TruncatedByDeadline: the query deadline was reached before all data was processed
+	TruncatedByDeadline bool `json:"truncated_by_deadline,omitempty" doc:"Query deadline was reached before all data was processed, results are partial" example:"false"`
+	// TopNApproximate: the hosts of a distributed query returned their top rows only, and the ranking could not be verified
+	TopNApproximate bool `json:"top_n_approximate,omitempty" doc:"Hosts of a distributed query returned their top rows only and the ranking of the rows could not be verified, rows may be missing or ranked incorrectly" example:"false"`
+	// Profile: per-stage timings of the query (only present if profiling was requested)
+	Profile *Profile `json:"profile,omitempty" doc:"Per-stage timings of the query (only present if profiling was requested)"`
+	// Drops: packets dropped during the covered time range and the traffic estimated to be missing due to them (only present if requested)
+	Drops *Drops `json:"drops,omitempty" doc:"Packets dropped during the covered time range and the traffic estimated to be missing due to them (only present if requested)"`
+	// Provenance: the hosts / DBs the data originated from and how it was obtained (only present if requested)
+	Provenance *Provenance `json:"provenance,omitempty" doc:"Hosts / DBs the data originated from and how it was obtained, allowing to assess the quality of the result and to reproduce the query (only present if requested)"`
+	// Matrix: the traffic between the source and destination groups (only present if requested)
+	Matrix *Matrix `json:"matrix,omitempty" doc:"Traffic between the source and destination prefix groups over the queried time range (only present if a traffic matrix was requested)"`
+	// Baseline: the time range new talkers were determined against (only present if requested)
+	Baseline *Baseline `json:"baseline,omitempty" doc:"Time range the result rows were compared against, only rows whose attribute combination did not occur during it are returned (only present if new talkers were requested)"`
+	// ByteAccounting: the bases the traffic volume of the queried interfaces was accounted on (only present if recorded)
+	ByteAccounting []string `json:"byte_accounting,omitempty" doc:"Bases the traffic volume of the queried interfaces was accounted on: l2 (frames including the link-layer header), l3 (IP packets only) or wire (frames including the frame check sequence and VLAN tags). Only present if recorded by the hosts, several bases indicate that the volumes are not directly comparable" example:"l2"`
+	// ResourcePolicies: the resource limits applied to the query by the hosts (only present if a policy was in effect)
+	ResourcePolicies []ResourcePolicy `json:"resource_policies,omitempty" doc:"Resource limits applied to the query by the hosts, as determined by the resource policy in effect when the query was run (only present for hosts with a policy in effect)"`
+	// ResourceUsage: the resources the hosts spent on the query (only present for hosts running queries in a query pool)
+	ResourceUsage []ResourceUsage `json:"resource_usage,omitempty" doc:"Resources (processing units, goroutines and memory) the hosts spent on the query (only present for hosts running queries in a bounded query pool)"`
 }
 
 // Interfaces collects all interface names
@@ -105,8 +133,14 @@ type Interfaces []string
 
 // Status denotes the overall status of the result
 type Status struct {
-	Code    types.Status `json:"code" doc:"Status code" enum:"empty,error,missing_data,ok" example:"empty"`         // Code: the status code
+	Code    types.Status `json:"code" doc:"Status code" enum:"empty,error,missing_data,ok,pending" example:"empty"` // Code: the status code
 	Message string       `json:"message,omitempty" doc:"Optional status description" example:"no results returned"` // Message: an optional message
+
+	// ClockSkew: the estimated offset of the host's clock (only set if skew was detected)
+	ClockSkew time.Duration `json:"clock_skew_ns,omitempty" doc:"Estimated offset of the host's clock relative to the querying server in nanoseconds (only present if skew was detected)" example:"-7300000000"`
+
+	// LastWriteout: the time of the last writeout to the host's goDB (only set if the host is capturing)
+	LastWriteout *time.Time `json:"last_writeout,omitempty" doc:"Time of the last writeout to the host's goDB (only present if the host is capturing). Results of the host are outdated once it reports a newer writeout" example:"2024-04-12T09:45:00+02:00"`
 }
 
 // Timings summarizes query runtimes
@@ -146,6 +180,22 @@ type Labels struct {
 	Timestamp time.Time `json:"timestamp,omitempty" doc:"Timestamp (end) of the 5-minute interval storing the flow record" example:"2024-04-12T03:20:00+02:00"`
 	// Iface: the interface on which the flow was observed
 	Iface string `json:"iface,omitempty" doc:"Interface on which the flow was observed" example:"eth0"`
+	// Zone: the network zone of the interface on which the flow was observed
+	Zone string `json:"zone,omitempty" doc:"Network zone of the interface on which the flow was observed" example:"external"`
+	// Tag: the flow tags assigned to the flow during writeout (comma-separated)
+	Tag string `json:"tag,omitempty" doc:"Flow tags assigned to the flow during writeout (comma-separated)" example:"voip"`
+	// Process: the local process (and its cgroup) the flow was attributed to
+	Process string `json:"process,omitempty" doc:"Local process (and its cgroup) the flow was attributed to" example:"nginx (/system.slice/nginx.service)"`
+	// VLAN: the 802.1Q VLAN ID the flow was observed on (zero if untagged)
+	VLAN uint16 `json:"vlan,omitempty" doc:"802.1Q VLAN ID the flow was observed on (omitted if untagged)" example:"100"`
+	// SMAC: the source MAC address of the flow (empty if not recorded)
+	SMAC string `json:"smac,omitempty" doc:"Source MAC address of the flow (omitted if not recorded)" example:"aa:bb:cc:00:11:22"`
+	// DMAC: the destination MAC address of the flow (empty if not recorded)
+	DMAC string `json:"dmac,omitempty" doc:"Destination MAC address of the flow (omitted if not recorded)" example:"00:11:22:33:44:55"`
+	// TCPFlags: the TCP flags observed for the flow (comma-separated, empty if none were observed)
+	TCPFlags string `json:"flags,omitempty" doc:"TCP flags observed for the flow (comma-separated, omitted if none were observed)" example:"SYN,ACK"`
+	// DSCP: the DSCP the flow was observed with (empty if it was the default one)
+	DSCP string `json:"dscp,omitempty" doc:"DSCP the flow was observed with (omitted if it was the default one)" example:"EF"`
 	// Hostname: the hostname of the host on which the flow was observed
 	Hostname string `json:"host,omitempty" doc:"Hostname of the host on which the flow was observed" example:"hostA"`
 	// HostID: the host id of the host on which the flow was observed
@@ -154,10 +204,12 @@ type Labels struct {
 
 // Attributes are traffic attributes by which the goDB can be aggregated
 type Attributes struct {
-	SrcIP   netip.Addr `json:"sip,omitempty" doc:"Source IP" example:"10.81.45.1"`   // SrcIP: the source IP address
-	DstIP   netip.Addr `json:"dip,omitempty" doc:"Destination IP" example:"8.8.8.8"` // DstIP: the destination IP address
-	IPProto uint8      `json:"proto,omitempty" doc:"IP protocol number" example:"6"` // IPProto: the IP protocol number
-	DstPort uint16     `json:"dport,omitempty" doc:"Destination port" example:"80"`  // DstPort: the destination port
+	SrcIP        netip.Addr       `json:"sip,omitempty" doc:"Source IP" example:"10.81.45.1"`                                     // SrcIP: the source IP address
+	DstIP        netip.Addr       `json:"dip,omitempty" doc:"Destination IP" example:"8.8.8.8"`                                   // DstIP: the destination IP address
+	IPProto      uint8            `json:"proto,omitempty" doc:"IP protocol number" example:"6"`                                   // IPProto: the IP protocol number
+	DstPort      uint16           `json:"dport,omitempty" doc:"Destination port" example:"80"`                                    // DstPort: the destination port
+	DstPortClass string           `json:"dport_class,omitempty" doc:"Class (range) of the destination port" example:"well-known"` // DstPortClass: the class of the destination port
+	Custom       CustomAttributes `json:"custom,omitempty" doc:"Values of custom attributes derived by attribute plugins"`        // Custom: the values of custom attributes derived by attribute plugins
 }
 
 // New instantiates a new result
@@ -200,6 +252,75 @@ func (r *Result) End() {
 	sort.Strings(r.Summary.Interfaces)
 }
 
+// ClockSkew estimates the offset of the clock of the host which ran the query, given the (local) times
+// the query was sent to and its result received from the host. Since the query ran in between these
+// times, any deviation of its start / end beyond them is due to clock skew. The estimate is hence a
+// lower bound of the actual skew (which is zero if it cannot be detected, e.g. due to network latency)
+func (t Timings) ClockSkew(sent, received time.Time) time.Duration {
+	if t.QueryStart.IsZero() {
+		return 0
+	}
+	if t.QueryStart.Before(sent) {
+		return t.QueryStart.Sub(sent)
+	}
+	if end := t.QueryStart.Add(t.QueryDuration); end.After(received) {
+		return end.Sub(received)
+	}
+	return 0
+}
+
+// DropRows removes all data rows from the result, leaving only the summary and
+// meta information intact
+func (r *Result) DropRows() {
+	r.Rows = Rows{}
+	r.Summary.Hits.Displayed = 0
+}
+
+// Clone returns a deep copy of the result, which can be modified without affecting r
+func (r *Result) Clone() *Result {
+	c := *r
+	c.HostsStatuses = maps.Clone(r.HostsStatuses)
+	c.Query.Attributes = slices.Clone(r.Query.Attributes)
+	c.Query.Warnings = slices.Clone(r.Query.Warnings)
+	c.Rows = slices.Clone(r.Rows)
+	c.Summary.Interfaces = slices.Clone(r.Summary.Interfaces)
+	if r.Summary.Stats != nil {
+		r.Summary.Stats.RLock()
+		c.Summary.Stats = &workload.Stats{
+			BytesLoaded:          r.Summary.Stats.BytesLoaded,
+			BytesDecompressed:    r.Summary.Stats.BytesDecompressed,
+			BlocksProcessed:      r.Summary.Stats.BlocksProcessed,
+			BlocksCorrupted:      r.Summary.Stats.BlocksCorrupted,
+			DirectoriesProcessed: r.Summary.Stats.DirectoriesProcessed,
+			Workloads:            r.Summary.Stats.Workloads,
+		}
+		r.Summary.Stats.RUnlock()
+	}
+	if r.Summary.Profile != nil {
+		profile := *r.Summary.Profile
+		c.Summary.Profile = &profile
+	}
+	if r.Summary.Drops != nil {
+		drops := *r.Summary.Drops
+		drops.Ranges = slices.Clone(drops.Ranges)
+		c.Summary.Drops = &drops
+	}
+	if r.Summary.Provenance != nil {
+		c.Summary.Provenance = r.Summary.Provenance.Clone()
+	}
+	if r.Summary.Matrix != nil {
+		c.Summary.Matrix = r.Summary.Matrix.Clone()
+	}
+	if r.Summary.Baseline != nil {
+		baseline := *r.Summary.Baseline
+		c.Summary.Baseline = &baseline
+	}
+	c.Summary.ByteAccounting = slices.Clone(r.Summary.ByteAccounting)
+	c.Summary.ResourcePolicies = slices.Clone(r.Summary.ResourcePolicies)
+	c.Summary.ResourceUsage = slices.Clone(r.Summary.ResourceUsage)
+	return &c
+}
+
 // Summary returns a summary of the interfaces without listing them explicitly
 func (is Interfaces) Summary() string {
 	return fmt.Sprintf("%d", len(is))
@@ -246,6 +367,24 @@ func (hs HostsStatuses) Summary() string {
 	return fmt.Sprintf("%d hosts: %d ok / %d empty / %d error", len(hs), ok, empty, withError)
 }
 
+// SetClockSkew sets the clock skew of all hosts
+func (hs HostsStatuses) SetClockSkew(skew time.Duration) {
+	for host, status := range hs {
+		status.ClockSkew = skew
+		hs[host] = status
+	}
+}
+
+// MaxClockSkew returns the host with the largest (absolute) clock skew
+func (hs HostsStatuses) MaxClockSkew() (maxHost string, maxSkew time.Duration) {
+	for _, host := range hs.getSortedStatuses() {
+		if host.ClockSkew.Abs() > maxSkew.Abs() {
+			maxHost, maxSkew = host.Hostname, host.ClockSkew
+		}
+	}
+	return maxHost, maxSkew
+}
+
 // HostStatus bundles the Hostname with the Status for that Hostname
 type HostStatus struct {
 	Hostname string
@@ -331,11 +470,27 @@ func (l Labels) MarshalJSON() ([]byte, error) {
 		// values in order to properly treat empties
 		Timestamp *time.Time `json:"timestamp,omitempty"`
 		Iface     string     `json:"iface,omitempty"`
+		Zone      string     `json:"zone,omitempty"`
+		Tag       string     `json:"tag,omitempty"`
+		Process   string     `json:"process,omitempty"`
+		VLAN      uint16     `json:"vlan,omitempty"`
+		SMAC      string     `json:"smac,omitempty"`
+		DMAC      string     `json:"dmac,omitempty"`
+		TCPFlags  string     `json:"flags,omitempty"`
+		DSCP      string     `json:"dscp,omitempty"`
 		Hostname  string     `json:"host,omitempty"`
 		HostID    string     `json:"host_id,omitempty"`
 	}{
 		nil,
 		l.Iface,
+		l.Zone,
+		l.Tag,
+		l.Process,
+		l.VLAN,
+		l.SMAC,
+		l.DMAC,
+		l.TCPFlags,
+		l.DSCP,
 		l.Hostname,
 		l.HostID,
 	}
@@ -347,9 +502,17 @@ func (l Labels) MarshalJSON() ([]byte, error) {
 
 // String prints all result labels
 func (l Labels) String() string {
-	return fmt.Sprintf("ts=%s iface=%s hostname=%s hostID=%s",
+	return fmt.Sprintf("ts=%s iface=%s zone=%s tag=%s process=%s vlan=%d smac=%s dmac=%s flags=%s dscp=%s hostname=%s hostID=%s",
 		l.Timestamp,
 		l.Iface,
+		l.Zone,
+		l.Tag,
+		l.Process,
+		l.VLAN,
+		l.SMAC,
+		l.DMAC,
+		l.TCPFlags,
+		l.DSCP,
 		l.Hostname,
 		l.HostID,
 	)
@@ -367,7 +530,35 @@ func (l Labels) Less(l2 Labels) bool {
 		return l.Hostname < l2.Hostname
 	}
 
-	return l.Iface < l2.Iface
+	if l.Iface != l2.Iface {
+		return l.Iface < l2.Iface
+	}
+
+	if l.Tag != l2.Tag {
+		return l.Tag < l2.Tag
+	}
+
+	if l.Process != l2.Process {
+		return l.Process < l2.Process
+	}
+
+	if l.VLAN != l2.VLAN {
+		return l.VLAN < l2.VLAN
+	}
+
+	if l.SMAC != l2.SMAC {
+		return l.SMAC < l2.SMAC
+	}
+
+	if l.DMAC != l2.DMAC {
+		return l.DMAC < l2.DMAC
+	}
+
+	if l.TCPFlags != l2.TCPFlags {
+		return l.TCPFlags < l2.TCPFlags
+	}
+
+	return l.DSCP < l2.DSCP
 }
 
 // ExtendedAttributes includes the source port. It is meant to be used if (and only if)
@@ -382,13 +573,17 @@ func (a Attributes) MarshalJSON() ([]byte, error) {
 	var aux = struct {
 		// TODO: this is expensive. Check how to get rid of re-assigning
 		// values in order to properly treat empties
-		SrcIP   *netip.Addr `json:"sip,omitempty"`
-		DstIP   *netip.Addr `json:"dip,omitempty"`
-		IPProto uint8       `json:"proto,omitempty"`
-		DstPort uint16      `json:"dport,omitempty"`
+		SrcIP        *netip.Addr       `json:"sip,omitempty"`
+		DstIP        *netip.Addr       `json:"dip,omitempty"`
+		IPProto      uint8             `json:"proto,omitempty"`
+		DstPort      uint16            `json:"dport,omitempty"`
+		DstPortClass string            `json:"dport_class,omitempty"`
+		Custom       map[string]string `json:"custom,omitempty"`
 	}{
-		IPProto: a.IPProto,
-		DstPort: a.DstPort,
+		IPProto:      a.IPProto,
+		DstPort:      a.DstPort,
+		DstPortClass: a.DstPortClass,
+		Custom:       a.Custom.Map(),
 	}
 	if a.SrcIP.IsValid() {
 		aux.SrcIP = &a.SrcIP
@@ -401,12 +596,19 @@ func (a Attributes) MarshalJSON() ([]byte, error) {
 
 // String prints all result attributes
 func (a Attributes) String() string {
-	return fmt.Sprintf("sip=%s dip=%s proto=%d dport=%d",
+	str := fmt.Sprintf("sip=%s dip=%s proto=%d dport=%d",
 		a.SrcIP.String(),
 		a.DstIP.String(),
 		a.IPProto,
 		a.DstPort,
 	)
+	if a.DstPortClass != "" {
+		str += " dport_class=" + a.DstPortClass
+	}
+	if a.Custom != "" {
+		str += " custom=" + strings.ReplaceAll(string(a.Custom), customAttributeSep, ",")
+	}
+	return str
 }
 
 // Less returns wether the set of attributes a sorts before a2
@@ -420,7 +622,13 @@ func (a Attributes) Less(a2 Attributes) bool {
 	if a.IPProto != a2.IPProto {
 		return a.IPProto < a2.IPProto
 	}
-	return a.DstPort < a2.DstPort
+	if a.DstPort != a2.DstPort {
+		return a.DstPort < a2.DstPort
+	}
+	if a.DstPortClass != a2.DstPortClass {
+		return a.DstPortClass < a2.DstPortClass
+	}
+	return a.Custom < a2.Custom
 }
 
 // Rows is a list of results
@@ -3,6 +3,7 @@ package results
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/els0r/goProbe/pkg/types"
 	jsoniter "github.com/json-iterator/go"
@@ -32,3 +33,36 @@ func TestMerge(t *testing.T) {
 		})
 	}
 }
+
+func TestClockSkew(t *testing.T) {
+	var (
+		sent     = time.Now()
+		received = sent.Add(time.Second)
+	)
+
+	var tests = []struct {
+		name     string
+		timings  Timings
+		expected time.Duration
+	}{
+		{"no timings", Timings{}, 0},
+		{"no skew", Timings{QueryStart: sent.Add(100 * time.Millisecond), QueryDuration: 500 * time.Millisecond}, 0},
+		{"clock behind", Timings{QueryStart: sent.Add(-7 * time.Second), QueryDuration: 500 * time.Millisecond}, -7 * time.Second},
+		{"clock ahead", Timings{QueryStart: received.Add(3 * time.Second), QueryDuration: 500 * time.Millisecond}, 3500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.timings.ClockSkew(sent.Round(0), received.Round(0)))
+		})
+	}
+
+	hs := HostsStatuses{
+		"hostA": {Code: types.StatusOK},
+		"hostB": {Code: types.StatusOK, ClockSkew: -7 * time.Second},
+		"hostC": {Code: types.StatusOK, ClockSkew: 3 * time.Second},
+	}
+	host, skew := hs.MaxClockSkew()
+	assert.Equal(t, "hostB", host)
+	assert.Equal(t, -7*time.Second, skew)
+}
@@ -1,6 +1,7 @@
 package results
 
 import (
+	"cmp"
 	"sort"
 
 	"github.com/els0r/goProbe/pkg/types"
@@ -16,6 +17,11 @@ const (
 	SortPackets
 	SortTraffic
 	SortTime
+	SortSrcIP
+	SortDstIP
+	SortDstPort
+	SortProto
+	SortIface
 )
 
 type by func(e1, e2 *Row) bool
@@ -34,6 +40,16 @@ func (s SortOrder) String() string {
 		return "bytes"
 	case SortTime:
 		return "time"
+	case SortSrcIP:
+		return types.SIPName
+	case SortDstIP:
+		return types.DIPName
+	case SortDstPort:
+		return types.DportName
+	case SortProto:
+		return types.ProtoName
+	case SortIface:
+		return types.IfaceName
 	}
 	return "unknown"
 }
@@ -47,10 +63,26 @@ func SortOrderFromString(s string) SortOrder {
 		return SortTraffic
 	case "time":
 		return SortTime
+	case types.SIPName:
+		return SortSrcIP
+	case types.DIPName:
+		return SortDstIP
+	case types.DportName:
+		return SortDstPort
+	case types.ProtoName:
+		return SortProto
+	case types.IfaceName:
+		return SortIface
 	}
 	return SortUnknown
 }
 
+// IsAttribute denotes if the sort order is based on an attribute / label column (as opposed
+// to counters or time)
+func (s SortOrder) IsAttribute() bool {
+	return s >= SortSrcIP && s <= SortIface
+}
+
 // MarshalJSON implements the Marshaler interface for sort order
 func (s *SortOrder) MarshalJSON() ([]byte, error) {
 	return jsoniter.Marshal(s.String())
@@ -205,7 +237,71 @@ func By(sort SortOrder, direction types.Direction, ascending bool) by {
 			}
 			return e1.Labels.Timestamp.After(e2.Labels.Timestamp)
 		}
+	case SortSrcIP:
+		return byColumn(ascending, func(e1, e2 *Row) int {
+			return e1.Attributes.SrcIP.Compare(e2.Attributes.SrcIP)
+		})
+	case SortDstIP:
+		return byColumn(ascending, func(e1, e2 *Row) int {
+			return e1.Attributes.DstIP.Compare(e2.Attributes.DstIP)
+		})
+	case SortDstPort:
+		return byColumn(ascending, func(e1, e2 *Row) int {
+			return cmp.Compare(e1.Attributes.DstPort, e2.Attributes.DstPort)
+		})
+	case SortProto:
+		return byColumn(ascending, func(e1, e2 *Row) int {
+			return cmp.Compare(e1.Attributes.IPProto, e2.Attributes.IPProto)
+		})
+	case SortIface:
+		return byColumn(ascending, func(e1, e2 *Row) int {
+			return cmp.Compare(e1.Labels.Iface, e2.Labels.Iface)
+		})
 	}
 
 	panic("Failed to generate Less func for sorting entries")
 }
+
+// byColumn generates a Less func for sorting entries by an attribute / label column. IP
+// addresses are compared numerically (IPv4 before IPv6). Ties are broken by the natural
+// order of the rows in order to guarantee a stable output
+func byColumn(ascending bool, compare func(e1, e2 *Row) int) by {
+	if ascending {
+		return func(e1, e2 *Row) bool {
+			if c := compare(e1, e2); c != 0 {
+				return c < 0
+			}
+			return e1.Less(e2)
+		}
+	}
+	return func(e1, e2 *Row) bool {
+		if c := compare(e1, e2); c != 0 {
+			return c > 0
+		}
+		return e2.Less(e1)
+	}
+}
+
+// CounterValue returns a function extracting the counter value the rows are ranked by when sorting by
+// packets or bytes in the given direction (and false for any other sort order)
+func CounterValue(sort SortOrder, direction types.Direction) (func(c types.Counters) uint64, bool) {
+	switch sort {
+	case SortPackets:
+		switch direction {
+		case types.DirectionIn:
+			return func(c types.Counters) uint64 { return c.PacketsRcvd }, true
+		case types.DirectionOut:
+			return func(c types.Counters) uint64 { return c.PacketsSent }, true
+		}
+		return types.Counters.SumPackets, true
+	case SortTraffic:
+		switch direction {
+		case types.DirectionIn:
+			return func(c types.Counters) uint64 { return c.BytesRcvd }, true
+		case types.DirectionOut:
+			return func(c types.Counters) uint64 { return c.BytesSent }, true
+		}
+		return types.Counters.SumBytes, true
+	}
+	return nil, false
+}
@@ -0,0 +1,54 @@
+package results
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortOrderFromString(t *testing.T) {
+	for _, order := range []SortOrder{SortPackets, SortTraffic, SortTime, SortSrcIP, SortDstIP, SortDstPort, SortProto, SortIface} {
+		require.Equal(t, order, SortOrderFromString(order.String()))
+	}
+	require.Equal(t, SortUnknown, SortOrderFromString("biscuits"))
+}
+
+func TestSortByColumn(t *testing.T) {
+	rows := Rows{
+		{Labels: Labels{Iface: "eth1"}, Attributes: Attributes{DstIP: netip.MustParseAddr("10.0.0.10"), DstPort: 443, IPProto: 6}},
+		{Labels: Labels{Iface: "eth0"}, Attributes: Attributes{DstIP: netip.MustParseAddr("2001:db8::1"), DstPort: 53, IPProto: 17}},
+		{Labels: Labels{Iface: "eth2"}, Attributes: Attributes{DstIP: netip.MustParseAddr("10.0.0.9"), DstPort: 8080, IPProto: 6}},
+		{Labels: Labels{Iface: "eth0"}, Attributes: Attributes{DstIP: netip.MustParseAddr("10.0.0.9"), DstPort: 22, IPProto: 1}},
+	}
+
+	var tests = []struct {
+		name      string
+		order     SortOrder
+		ascending bool
+		expected  []int
+	}{
+		// IPs are sorted numerically (i.e. 10.0.0.9 before 10.0.0.10), ties are broken by the
+		// natural row order (in the requested direction)
+		{"dip ascending", SortDstIP, true, []int{3, 2, 0, 1}},
+		{"dip descending", SortDstIP, false, []int{1, 0, 2, 3}},
+		{"dport ascending", SortDstPort, true, []int{3, 1, 0, 2}},
+		{"proto descending", SortProto, false, []int{1, 0, 2, 3}},
+		{"iface ascending", SortIface, true, []int{3, 1, 0, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sorted := make(Rows, len(rows))
+			copy(sorted, rows)
+			By(test.order, types.DirectionBoth, test.ascending).Sort(sorted)
+
+			expected := make(Rows, 0, len(rows))
+			for _, i := range test.expected {
+				expected = append(expected, rows[i])
+			}
+			require.Equal(t, expected, sorted)
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package results
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	xlsxResultsSheet = "Results"
+	xlsxSummarySheet = "Summary"
+
+	// number of top rows (by the sort order of the result) highlighted in the counter columns
+	xlsxTopRows = 10
+
+	// Excel's serial date of the Unix epoch (days since 1899-12-30)
+	xlsxEpochSerial = 25569
+)
+
+// cell styles, indexing the cellXfs of the styles part
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleCount
+	xlsxStylePercent
+	xlsxStyleTime
+)
+
+// XLSXFormatter formats values as raw cell values of an Excel workbook (numbers are formatted by the
+// style of their cell)
+type XLSXFormatter struct{}
+
+// Size prints the size in bytes
+func (XLSXFormatter) Size(s uint64) string {
+	return strconv.FormatUint(s, 10)
+}
+
+// Duration prints the string representation of duration
+func (XLSXFormatter) Duration(d time.Duration) string {
+	return d.String()
+}
+
+// Count prints c
+func (XLSXFormatter) Count(c uint64) string {
+	return strconv.FormatUint(c, 10)
+}
+
+// Float prints f
+func (XLSXFormatter) Float(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Time prints epoch as Excel serial date (in local time, since Excel has no notion of time zones)
+func (XLSXFormatter) Time(epoch int64) string {
+	_, offset := time.Unix(epoch, 0).Zone()
+	return strconv.FormatFloat(float64(epoch+int64(offset))/86400+xlsxEpochSerial, 'f', -1, 64)
+}
+
+// String returns s
+func (XLSXFormatter) String(s string) string {
+	return s
+}
+
+// xlsxStyle returns the style of the cells of an output column (string cells are unstyled)
+func xlsxStyle(col OutputColumn) (style int, numeric bool) {
+	switch col {
+	case OutcolTime:
+		return xlsxStyleTime, true
+	case OutcolDport:
+		return xlsxStyleDefault, true
+	case OutcolInPkts, OutcolInBytes, OutcolOutPkts, OutcolOutBytes, OutcolSumPkts, OutcolSumBytes,
+		OutcolBothPktsRcvd, OutcolBothPktsSent, OutcolBothBytesRcvd, OutcolBothBytesSent:
+		return xlsxStyleCount, true
+	case OutcolInPktsPercent, OutcolInBytesPercent, OutcolOutPktsPercent, OutcolOutBytesPercent,
+		OutcolSumPktsPercent, OutcolSumBytesPercent, OutcolBothPktsPercent, OutcolBothBytesPercent:
+		return xlsxStylePercent, true
+	}
+	return xlsxStyleDefault, false
+}
+
+// XLSXTablePrinter writes out all flows as Excel workbook (Office Open XML), holding a sheet with the
+// result rows (typed numeric columns, the top rows of the counter columns being highlighted) and a
+// sheet with the summary of the result. Since the workbook is a ZIP archive, it is only written upon Print
+type XLSXTablePrinter struct {
+	basePrinter
+
+	headers []string
+	rows    bytes.Buffer
+	numRows int
+}
+
+// NewXLSXTablePrinter creates a new XLSXTablePrinter
+func NewXLSXTablePrinter(b basePrinter) *XLSXTablePrinter {
+	x := &XLSXTablePrinter{
+		basePrinter: b,
+	}
+
+	headers := b.columnHeaders()
+	for _, col := range x.cols {
+		x.headers = append(x.headers, headers[col])
+	}
+
+	return x
+}
+
+// AddRow adds a flow entry to the XLSXTablePrinter
+func (x *XLSXTablePrinter) AddRow(row Row) error {
+	x.numRows++
+	r := x.numRows + 1 // accounting for the header row
+
+	fmt.Fprintf(&x.rows, `<row r="%d">`, r)
+	for i, col := range x.cols {
+		style, numeric := xlsxStyle(col)
+		value := extract(XLSXFormatter{}, x.ips2domains, x.totals, x.custom, row, col)
+		if numeric {
+			writeXLSXNumber(&x.rows, xlsxCellRef(i, r), value, style)
+		} else {
+			writeXLSXString(&x.rows, xlsxCellRef(i, r), value, style)
+		}
+	}
+	x.rows.WriteString(`</row>`)
+
+	return nil
+}
+
+// AddRows adds several flow entries to the XLSXTablePrinter
+func (x *XLSXTablePrinter) AddRows(ctx context.Context, rows Rows) error {
+	if x.summaryOnly {
+		return nil
+	}
+	return addRows(ctx, x, rows)
+}
+
+// Footer is a no-op, the summary of the result is written to its own sheet upon Print
+func (x *XLSXTablePrinter) Footer(_ context.Context, _ *Result) error {
+	return nil
+}
+
+// Print writes the workbook
+func (x *XLSXTablePrinter) Print(result *Result) error {
+	sheets := []string{xlsxResultsSheet, xlsxSummarySheet}
+	if x.summaryOnly {
+		sheets = sheets[1:]
+	}
+
+	zw := zip.NewWriter(x.output)
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", x.workbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		if err := writeZIPEntry(zw, part.name, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheetNum := 1
+	if !x.summaryOnly {
+		if err := x.writeResultsSheet(zw, sheetNum); err != nil {
+			return err
+		}
+		sheetNum++
+	}
+	if err := writeZIPEntry(zw, fmt.Sprintf("xl/worksheets/sheet%d.xml", sheetNum), x.summarySheet(result)); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// lastRef returns the reference of the last cell of the results sheet
+func (x *XLSXTablePrinter) lastRef() string {
+	return xlsxCellRef(max(len(x.cols)-1, 0), x.numRows+1)
+}
+
+func (x *XLSXTablePrinter) workbook(sheets []string) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&sb, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, sheet, i+1, i+1)
+	}
+	sb.WriteString(`</sheets>`)
+	if !x.summaryOnly {
+		fmt.Fprintf(&sb, `<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">%s!$A$1:%s</definedName></definedNames>`,
+			xlsxResultsSheet, xlsxAbsRef(x.lastRef()))
+	}
+	sb.WriteString(`</workbook>`)
+	return sb.String()
+}
+
+func (x *XLSXTablePrinter) writeResultsSheet(zw *zip.Writer, sheetNum int) error {
+	w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", sheetNum))
+	if err != nil {
+		return err
+	}
+
+	var sb bytes.Buffer
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(x.cols) > 0 {
+		fmt.Fprintf(&sb, `<cols><col min="1" max="%d" width="18" customWidth="1"/></cols>`, len(x.cols))
+	}
+	sb.WriteString(`<sheetData><row r="1">`)
+	for i, header := range x.headers {
+		writeXLSXString(&sb, xlsxCellRef(i, 1), header, xlsxStyleHeader)
+	}
+	sb.WriteString(`</row>`)
+	if _, err := sb.WriteTo(w); err != nil {
+		return err
+	}
+	if _, err := x.rows.WriteTo(w); err != nil {
+		return err
+	}
+	sb.WriteString(`</sheetData>`)
+
+	fmt.Fprintf(&sb, `<autoFilter ref="A1:%s"/>`, x.lastRef())
+	if x.numRows > 0 {
+		for i, col := range x.cols {
+			if !x.isRanked(col) {
+				continue
+			}
+			fmt.Fprintf(&sb, `<conditionalFormatting sqref="%s:%s"><cfRule type="top10" dxfId="0" priority="%d" rank="%d"/></conditionalFormatting>`,
+				xlsxCellRef(i, 2), xlsxCellRef(i, x.numRows+1), i+1, xlsxTopRows)
+		}
+	}
+	sb.WriteString(`</worksheet>`)
+
+	_, err = sb.WriteTo(w)
+	return err
+}
+
+// isRanked returns if the top rows of a column are highlighted, i.e. if it is a counter column of the
+// kind the result is ranked by (packets or data volume)
+func (x *XLSXTablePrinter) isRanked(col OutputColumn) bool {
+	if x.sort == SortPackets {
+		switch col {
+		case OutcolInPkts, OutcolOutPkts, OutcolSumPkts, OutcolBothPktsRcvd, OutcolBothPktsSent:
+			return true
+		}
+		return false
+	}
+	switch col {
+	case OutcolInBytes, OutcolOutBytes, OutcolSumBytes, OutcolBothBytesRcvd, OutcolBothBytesSent:
+		return true
+	}
+	return false
+}
+
+func (x *XLSXTablePrinter) summarySheet(result *Result) string {
+	var (
+		sb bytes.Buffer
+		r  int
+		f  = XLSXFormatter{}
+	)
+	entry := func(key, value string, style int, numeric bool) {
+		r++
+		sb.WriteString(`<row r="` + strconv.Itoa(r) + `">`)
+		writeXLSXString(&sb, xlsxCellRef(0, r), key, xlsxStyleHeader)
+		if numeric {
+			writeXLSXNumber(&sb, xlsxCellRef(1, r), value, style)
+		} else {
+			writeXLSXString(&sb, xlsxCellRef(1, r), value, style)
+		}
+		sb.WriteString(`</row>`)
+	}
+
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sb.WriteString(`<cols><col min="1" max="1" width="32" customWidth="1"/><col min="2" max="2" width="48" customWidth="1"/></cols>`)
+	sb.WriteString(`<sheetData>`)
+
+	if result != nil {
+		summary := result.Summary
+		entry("Interfaces", strings.Join(summary.Interfaces, ","), xlsxStyleDefault, false)
+		entry("First", f.Time(summary.First.Unix()), xlsxStyleTime, true)
+		entry("Last", f.Time(summary.Last.Unix()), xlsxStyleTime, true)
+		if result.Query.Condition != "" {
+			entry("Conditions", result.Query.Condition, xlsxStyleDefault, false)
+		}
+		if result.Query.TimeWindows != "" {
+			entry("Time windows", result.Query.TimeWindows, xlsxStyleDefault, false)
+		}
+	}
+	entry("Sorting and flow direction", describe(x.sort, x.direction, x.aliases), xlsxStyleDefault, false)
+	for _, total := range []struct {
+		key   string
+		value uint64
+	}{
+		{"Received packets", x.totals.PacketsRcvd},
+		{"Sent packets", x.totals.PacketsSent},
+		{"Overall packets", x.totals.SumPackets()},
+		{"Received data volume (bytes)", x.totals.BytesRcvd},
+		{"Sent data volume (bytes)", x.totals.BytesSent},
+		{"Overall data volume (bytes)", x.totals.SumBytes()},
+	} {
+		entry(total.key, f.Count(total.value), xlsxStyleCount, true)
+	}
+
+	if result != nil {
+		summary := result.Summary
+		entry("Displayed rows", f.Count(uint64(summary.Hits.Displayed)), xlsxStyleCount, true)
+		entry("Total rows", f.Count(uint64(summary.Hits.Total)), xlsxStyleCount, true)
+		if len(summary.ByteAccounting) > 0 {
+			entry(accountingKey, strings.Join(summary.ByteAccounting, ","), xlsxStyleDefault, false)
+		}
+		if summary.TruncatedByDeadline {
+			entry("Warning", "query deadline reached, results are partial", xlsxStyleDefault, false)
+		}
+		if summary.TopNApproximate {
+			entry("Warning", "ranking of the rows could not be verified, rows may be missing or ranked incorrectly", xlsxStyleDefault, false)
+		}
+		for _, warning := range result.Query.Warnings {
+			entry("Warning", warning, xlsxStyleDefault, false)
+		}
+		if provenance := summary.Provenance; provenance != nil {
+			for _, source := range provenance.Sources {
+				label := "Source"
+				if source.Hostname != "" {
+					label += " " + source.Hostname
+				}
+				entry(label, source.String(), xlsxStyleDefault, false)
+			}
+		}
+	}
+
+	sb.WriteString(`</sheetData></worksheet>`)
+	return sb.String()
+}
+
+// xlsxCellRef returns the A1-style reference of a cell (zero-based column, one-based row)
+func xlsxCellRef(col, row int) string {
+	var name []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = append([]byte{byte('A' + (col-1)%26)}, name...)
+	}
+	return string(name) + strconv.Itoa(row)
+}
+
+// xlsxAbsRef turns an A1-style reference into an absolute one ($A$1)
+func xlsxAbsRef(ref string) string {
+	i := strings.IndexAny(ref, "0123456789")
+	return "$" + ref[:i] + "$" + ref[i:]
+}
+
+func writeXLSXNumber(w *bytes.Buffer, ref, value string, style int) {
+	fmt.Fprintf(w, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, value)
+}
+
+func writeXLSXString(w *bytes.Buffer, ref, value string, style int) {
+	fmt.Fprintf(w, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+	_ = xml.EscapeText(w, []byte(value))
+	w.WriteString(`</t></is></c>`)
+}
+
+func writeZIPEntry(zw *zip.Writer, name, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+func xlsxContentTypes(numSheets int) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	sb.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	sb.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= numSheets; i++ {
+		fmt.Fprintf(&sb, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	sb.WriteString(`</Types>`)
+	return sb.String()
+}
+
+func xlsxWorkbookRels(numSheets int) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= numSheets; i++ {
+		fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, numSheets+1)
+	sb.WriteString(`</Relationships>`)
+	return sb.String()
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles defines the cell styles (in the order of the xlsxStyle... constants) and the differential
+// style highlighting the top rows
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`<dxfs count="1"><dxf><font><color rgb="FF006100"/></font><fill><patternFill><bgColor rgb="FFC6EFCE"/></patternFill></fill></dxf></dxfs>` +
+	`</styleSheet>`
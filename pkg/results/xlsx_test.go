@@ -0,0 +1,111 @@
+package results
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/els0r/goProbe/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXLSXCellRef(t *testing.T) {
+	for _, test := range []struct {
+		col, row int
+		expected string
+	}{
+		{0, 1, "A1"},
+		{25, 2, "Z2"},
+		{26, 10, "AA10"},
+		{51, 3, "AZ3"},
+		{52, 4, "BA4"},
+		{701, 5, "ZZ5"},
+		{702, 6, "AAA6"},
+	} {
+		require.Equal(t, test.expected, xlsxCellRef(test.col, test.row))
+	}
+	require.Equal(t, "$AB$12", xlsxAbsRef("AB12"))
+}
+
+// readXLSX returns the parts of the workbook by name
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.Nil(t, err)
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.Nil(t, err)
+		content, err := io.ReadAll(rc)
+		require.Nil(t, err)
+		require.Nil(t, rc.Close())
+
+		// all parts must be well-formed XML
+		dec := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			require.Nil(t, err, "part %s is malformed", f.Name)
+		}
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+func TestXLSXTablePrinter(t *testing.T) {
+	attributes, selector, err := types.ParseQueryType("sip,dip,dport")
+	require.Nil(t, err)
+
+	render := func(result *Result, summaryOnly bool) map[string]string {
+		buf := new(bytes.Buffer)
+		printer, err := NewTablePrinter(buf, &PrinterConfig{
+			Format:        types.FormatXLSX,
+			SortOrder:     SortTraffic,
+			LabelSelector: selector,
+			Direction:     types.DirectionSum,
+			Attributes:    attributes,
+			Totals:        result.Summary.Totals,
+			NumFlows:      result.Summary.Hits.Total,
+			summaryOnly:   summaryOnly,
+		})
+		require.Nil(t, err)
+
+		require.Nil(t, printer.AddRows(context.Background(), result.Rows))
+		require.Nil(t, printer.Footer(context.Background(), result))
+		require.Nil(t, printer.Print(result))
+
+		return readXLSX(t, buf.Bytes())
+	}
+
+	result := testPrinterResult()
+	result.Query.Condition = "dport = 443 & sip < dip"
+	parts := render(result, false)
+
+	require.Contains(t, parts["xl/workbook.xml"], `<sheet name="Results" sheetId="1" r:id="rId1"/><sheet name="Summary" sheetId="2" r:id="rId2"/>`)
+
+	// strings are written inline, counters as (styled) numbers
+	rows := parts["xl/worksheets/sheet1.xml"]
+	require.Contains(t, rows, `<c r="A2" s="0" t="inlineStr"><is><t xml:space="preserve">10.0.0.1</t></is></c>`)
+	require.Contains(t, rows, `<c r="C2" s="0"><v>443</v></c>`)
+	require.Contains(t, rows, `<v>300</v>`)
+	require.Contains(t, rows, `<v>100</v>`)
+	require.Contains(t, rows, `<autoFilter ref="A1:`)
+	require.Contains(t, rows, `<cfRule type="top10" dxfId="0"`)
+
+	// the summary is escaped
+	summary := parts["xl/worksheets/sheet2.xml"]
+	require.Contains(t, summary, "dport = 443 &amp; sip &lt; dip")
+	require.Contains(t, summary, "Overall data volume (bytes)")
+
+	// only the summary sheet is written if the rows are skipped
+	parts = render(result, true)
+	require.Contains(t, parts["xl/workbook.xml"], `<sheet name="Summary" sheetId="1" r:id="rId1"/>`)
+	require.NotContains(t, parts["xl/worksheets/sheet1.xml"], "10.0.0.1")
+	require.Contains(t, parts["xl/worksheets/sheet1.xml"], "eth0")
+	require.NotContains(t, parts, "xl/worksheets/sheet2.xml")
+}
@@ -15,6 +15,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"unicode"
 
@@ -40,6 +41,19 @@ const (
 	BytesSentColIdx, _
 	PacketsRcvdColIdx, _
 	PacketsSentColIdx, _
+
+	// ... and finally the (optional) bitmap of flow tags assigned during writeout, the
+	// (optional) ID of the local process the flow was attributed to, the (optional)
+	// 802.1Q VLAN ID the flow was observed on, the (optional) source / destination
+	// MAC addresses of the flow, the (optional) OR-combination of its TCP flags and the
+	// (optional) DSCP it was observed with
+	TagsColIdx, _
+	ProcessColIdx, _
+	VLANColIdx, _
+	SMACColIdx, _
+	DMACColIdx, _
+	TCPFlagsColIdx, _
+	DSCPColIdx, _
 	ColIdxCount, _
 )
 
@@ -57,16 +71,28 @@ const (
 	HostnameName = "host"
 	HostIDName   = "hostid"
 	IfaceName    = "iface"
+	ZoneName     = "zone"
+	TagName      = "tag"
+	ProcessName  = "process"
+	VLANName     = "vlan"
+	SMACName     = "smac"
+	DMACName     = "dmac"
+	TCPFlagsName = "flags"
+	DSCPName     = "dscp"
 
 	SIPName   = "sip"
 	DIPName   = "dip"
 	DportName = "dport"
 	ProtoName = "proto"
 
+	DportClassName = "dportclass"
+
 	BytesRcvdName = "bytes_rcvd"
 	BytesSentName = "bytes_sent"
 	PktsRcvdName  = "pkts_rcvd"
 	PktsSentName  = "pkts_sent"
+
+	TagsName = "tags"
 )
 
 // IsCounterCol returns if a column is a counter (and hence does
@@ -75,6 +101,12 @@ func (c ColumnIndex) IsCounterCol() bool {
 	return c >= ColIdxAttributeCount && c <= PacketsSentColIdx
 }
 
+// IsLabelCol returns if a column is one of the (optional) label columns (which are
+// empty for blocks written without the respective labels)
+func (c ColumnIndex) IsLabelCol() bool {
+	return c >= TagsColIdx && c < ColIdxCount
+}
+
 // ColumnSizeofs returns the data sizes for each column
 var ColumnSizeofs = [ColIdxCount]int{
 	SIPSizeof, DIPSizeof, ProtoSizeof, DportSizeof,
@@ -84,6 +116,7 @@ var ColumnSizeofs = [ColIdxCount]int{
 var ColumnFileNames = [ColIdxCount]string{
 	SIPName, DIPName, ProtoName, DportName,
 	BytesRcvdName, BytesSentName, PktsRcvdName, PktsSentName,
+	TagsName, ProcessName, VLANName, SMACName, DMACName, TCPFlagsName, DSCPName,
 }
 
 // Column denotes a generic column and enforces the existence of certain methods
@@ -217,10 +250,43 @@ func (DportAttribute) Name() string {
 
 func (DportAttribute) attributeMarker() {}
 
-var errorUnknownAttribute = errors.New("unknown attribute")
+// DportClassAttribute implements the destination port class attribute, bucketing destination
+// ports into port classes (e.g. well-known / registered / ephemeral ports) during aggregation
+type DportClassAttribute struct {
+	data []byte
+}
+
+// Width returns the amount of bytes the destination port class attribute takes up in a key
+// (the port class is stored in place of the destination port)
+func (DportClassAttribute) Width() Width {
+	return DPortWidth
+}
+
+// String returns the string representation of the destination port class attribute (in
+// terms of the default port classes)
+func (d DportClassAttribute) String() string {
+	return DefaultPortClasses.Label(PortToUint16(d.data))
+}
+
+// Resolvable returns if the destination port class is resolvable
+func (DportClassAttribute) Resolvable() bool {
+	return false
+}
+
+// Name returns the destination port class attribute name
+func (DportClassAttribute) Name() string {
+	return DportClassName
+}
+
+func (DportClassAttribute) attributeMarker() {}
+
+var (
+	errorUnknownAttribute      = errors.New("unknown attribute")
+	errorConflictingDportClass = fmt.Errorf("attributes %s and %s are mutually exclusive", DportName, DportClassName)
+)
 
-// NewAttribute returns an attribute for the given name. If no such attribute
-// exists, an error is returned.
+// NewAttribute returns an attribute for the given name (including custom attributes
+// registered via RegisterAttributePlugin). If no such attribute exists, an error is returned.
 func NewAttribute(name string) (Attribute, error) {
 	// name/alias to attribute matching
 	switch name {
@@ -232,7 +298,12 @@ func NewAttribute(name string) (Attribute, error) {
 		return ProtoAttribute{}, nil
 	case DportName, "port":
 		return DportAttribute{}, nil
+	case DportClassName, "portclass":
+		return DportClassAttribute{}, nil
 	default:
+		if plugin, exists := GetAttributePlugin(name); exists {
+			return CustomAttribute{plugin: plugin}, nil
+		}
 		return nil, errorUnknownAttribute
 	}
 }
@@ -341,6 +412,30 @@ func ParseQueryType(queryType string) (attributes []Attribute, selector LabelSel
 		case HostIDName:
 			selector.HostID = true
 			continue
+		case ZoneName:
+			selector.Zone = true
+			continue
+		case TagName, TagsName:
+			selector.Tag = true
+			continue
+		case ProcessName:
+			selector.Process = true
+			continue
+		case VLANName:
+			selector.VLAN = true
+			continue
+		case SMACName:
+			selector.SMAC = true
+			continue
+		case DMACName:
+			selector.DMAC = true
+			continue
+		case TCPFlagsName:
+			selector.TCPFlags = true
+			continue
+		case DSCPName:
+			selector.DSCP = true
+			continue
 		}
 
 		attribute, err := NewAttribute(attributeName)
@@ -351,10 +446,35 @@ func ParseQueryType(queryType string) (attributes []Attribute, selector LabelSel
 			attributeSet[attribute.Name()] = struct{}{}
 			attributes = append(attributes, attribute)
 		}
+
+		// both the destination port and its class are stored in the same part of the key
+		_, hasDport := attributeSet[DportName]
+		_, hasDportClass := attributeSet[DportClassName]
+		if hasDport && hasDportClass {
+			return nil, LabelSelector{}, NewParseError(parser.tokens, parser.pos, AttrSep, errorConflictingDportClass.Error())
+		}
+
+		// for the same reason, custom attributes cannot be derived from the destination port if
+		// it is bucketed into its class
+		if hasDportClass {
+			if err := checkDportClassConflict(attributes); err != nil {
+				return nil, LabelSelector{}, NewParseError(parser.tokens, parser.pos, AttrSep, err.Error())
+			}
+		}
 	}
 	return attributes, selector, nil
 }
 
+func checkDportClassConflict(attributes []Attribute) error {
+	for _, attr := range attributes {
+		custom, isCustom := attr.(CustomAttribute)
+		if isCustom && slices.Contains(custom.Columns(), DportColIdx) {
+			return fmt.Errorf("attributes %s and %s are mutually exclusive (%s is derived from %s)", custom.Name(), DportClassName, custom.Name(), DportName)
+		}
+	}
+	return nil
+}
+
 // HasDNSAttributes finds out if any of the attributes are usable for a reverse DNS lookup
 // (e.g. check for IP attributes)
 func HasDNSAttributes(attributes []Attribute) bool {
@@ -102,6 +102,14 @@ var parseQueryTypeTests = []struct {
 	{"talk_src,dip", []Attribute{SIPAttribute{}, DIPAttribute{}}, false, false},
 	{"talk_src,src", []Attribute{SIPAttribute{}}, false, false},
 	{"raw", []Attribute{SIPAttribute{}, DIPAttribute{}, DportAttribute{}, ProtoAttribute{}}, true, true},
+	{"dportclass,proto", []Attribute{DportClassAttribute{}, ProtoAttribute{}}, false, false},
+	{"sip,portclass,dportclass", []Attribute{SIPAttribute{}, DportClassAttribute{}}, false, false},
+	{"tag,dport", []Attribute{DportAttribute{}}, false, false},
+	{"process,sip", []Attribute{SIPAttribute{}}, false, false},
+	{"vlan,dip", []Attribute{DIPAttribute{}}, false, false},
+	{"smac,dmac,sip", []Attribute{SIPAttribute{}}, false, false},
+	{"flags,dport", []Attribute{DportAttribute{}}, false, false},
+	{"dscp,proto", []Attribute{ProtoAttribute{}}, false, false},
 }
 
 func TestParseQueryType(t *testing.T) {
@@ -131,6 +139,8 @@ func TestParseQueryError(t *testing.T) {
 			NewParseError([]string{"sip", "dipl", "sip"}, 1, ",", errorUnknownAttribute.Error())},
 		{"incorrect end", "sip,dip,talk_src,d",
 			NewParseError([]string{"sip", "dip", "sip", "d"}, 3, ",", errorUnknownAttribute.Error())},
+		{"dport and dportclass", "apps_port,dportclass",
+			NewParseError([]string{"dport", "proto", "dportclass"}, 2, ",", errorConflictingDportClass.Error())},
 	}
 
 	for _, test := range tests {
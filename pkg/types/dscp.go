@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DSCP denotes the Differentiated Services Code Point of a packet, i.e. the upper six bits of the
+// IPv4 ToS / IPv6 Traffic Class field
+type DSCP uint8
+
+// MaxDSCP denotes the highest valid DSCP value
+const MaxDSCP = 63
+
+// dscpNames lists the (uppercase) names of the standardized code points (RFC 2474, 2597, 3246, 5865)
+var dscpNames = map[DSCP]string{
+	0: "CS0", 8: "CS1", 16: "CS2", 24: "CS3", 32: "CS4", 40: "CS5", 48: "CS6", 56: "CS7",
+	10: "AF11", 12: "AF12", 14: "AF13",
+	18: "AF21", 20: "AF22", 22: "AF23",
+	26: "AF31", 28: "AF32", 30: "AF33",
+	34: "AF41", 36: "AF42", 38: "AF43",
+	44: "VOICE-ADMIT", 46: "EF",
+}
+
+// ParseDSCP parses a DSCP value, given either as number (0-63) or as name of a standardized code
+// point (e.g. "ef" or "af41", ignoring its case). The default code point may also be given as "be"
+func ParseDSCP(value string) (DSCP, error) {
+	if num, err := strconv.ParseUint(value, 10, 8); err == nil {
+		if num > MaxDSCP {
+			return 0, fmt.Errorf("invalid DSCP value %d: the maximum DSCP is %d", num, MaxDSCP)
+		}
+		return DSCP(num), nil
+	}
+	if strings.EqualFold(value, "be") || strings.EqualFold(value, "default") {
+		return 0, nil
+	}
+	for dscp, name := range dscpNames {
+		if strings.EqualFold(value, name) {
+			return dscp, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown DSCP %q (expected a number between 0 and %d or a code point name such as ef, af41 or cs1)", value, MaxDSCP)
+}
+
+// String prints the name of the code point (or its decimal value if it isn't standardized)
+func (d DSCP) String() string {
+	if name, exists := dscpNames[d]; exists {
+		return name
+	}
+	return strconv.Itoa(int(d))
+}
@@ -34,23 +34,25 @@ func (a *AggFlowMap) Flatten() (primaryList List, secondaryList List) {
 	return
 }
 
-// Sort orders relevant flow columns so that they become more compressible
+// Sort orders the flows by protocol, destination port, source IP and destination IP (comparing their
+// raw representation). Apart from making the flow columns more compressible, this allows to locate
+// flows with given values of these attributes via binary search (see gpfile.BlockOrderSorted)
 func (l List) Sort() List {
 	sort.Slice(l, func(i, j int) bool {
 
 		iv, jv := l[i], l[j]
 
-		if comp := bytes.Compare(iv.GetSIP(), jv.GetSIP()); comp != 0 {
-			return comp < 0
+		if iv.GetProto() != jv.GetProto() {
+			return iv.GetProto() < jv.GetProto()
 		}
-		if comp := bytes.Compare(iv.GetDIP(), jv.GetDIP()); comp != 0 {
+		if comp := bytes.Compare(iv.GetDport(), jv.GetDport()); comp != 0 {
 			return comp < 0
 		}
-		if comp := bytes.Compare(iv.GetDport(), jv.GetDport()); comp != 0 {
+		if comp := bytes.Compare(iv.GetSIP(), jv.GetSIP()); comp != 0 {
 			return comp < 0
 		}
-		if iv.GetProto() != jv.GetProto() {
-			return iv.GetProto() < jv.GetProto()
+		if comp := bytes.Compare(iv.GetDIP(), jv.GetDIP()); comp != 0 {
+			return comp < 0
 		}
 
 		return false
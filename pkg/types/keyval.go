@@ -267,6 +267,27 @@ func (k Key) ExtendEmpty() (e ExtendedKey) {
 	return k.Extend(0)
 }
 
+// ExtendTagged extends a "normal" key by wrapping it in an "ExtendedKey" carrying a timestamp
+// (zero if not present), a bitmap of flow tags, a process ID, a VLAN ID, the source / destination
+// MAC addresses, the TCP flags and the DSCP (all initially empty, populated via PutTags() /
+// PutProcess() / PutVLAN() / PutSMAC() / PutDMAC() / PutTCPFlags() / PutDSCP())
+func (k Key) ExtendTagged(ts int64) (e ExtendedKey) {
+
+	// Allocate a copy of sufficient size
+	requiredLen := len(k) + TimestampWidth + labelsWidth
+	e = make(ExtendedKey, requiredLen)
+
+	// Copy basic key into the new, extended one
+	pos := copy(e, k)
+
+	// Encode the timestamp
+	if ts > 0 {
+		binary.BigEndian.PutUint64(e[pos:pos+8], uint64(ts))
+	}
+
+	return
+}
+
 // ExtendedKey is a Key with supplemental information
 type ExtendedKey []byte
 
@@ -288,10 +309,10 @@ func (e ExtendedKey) Key() Key {
 
 // IsIPv4 returns if the key represents an IPv4 packet / flow
 func (e ExtendedKey) IsIPv4() bool {
-	if len(e) == KeyWidthIPv4 || len(e) == KeyWidthIPv4+TimestampWidth {
+	switch len(e) {
+	case KeyWidthIPv4, KeyWidthIPv4 + TimestampWidth, KeyWidthIPv4 + TimestampWidth + labelsWidth:
 		return true
-	}
-	if len(e) == KeyWidthIPv6 || len(e) == KeyWidthIPv6+TimestampWidth {
+	case KeyWidthIPv6, KeyWidthIPv6 + TimestampWidth, KeyWidthIPv6 + TimestampWidth + labelsWidth:
 		return false
 	}
 	panic(fmt.Sprintf("extended key `%v` is neither ipv4 nor ipv6", []byte(e)))
@@ -412,9 +433,145 @@ func (e ExtendedKey) AttrTime() (int64, bool) {
 		return 0, false
 	}
 
+	// If the key carries labels (flow tags, process ID, ...), the timestamp precedes them (and may be empty)
+	if e.hasLabels() {
+		ts := int64(binary.BigEndian.Uint64(e[len(e)-labelsWidth-TimestampWidth : len(e)-labelsWidth]))
+		return ts, ts > 0
+	}
+
 	return int64(binary.BigEndian.Uint64(e[len(e)-8:])), true
 }
 
+// PutTags stores the bitmap of flow tags in the key (assuming it was extended via ExtendTagged())
+func (e ExtendedKey) PutTags(tags uint64) {
+	binary.BigEndian.PutUint64(e[len(e)-labelsWidth:], tags)
+}
+
+// AttrTags retrieves the bitmap of flow tags (indicating its presence via the second result parameter)
+func (e ExtendedKey) AttrTags() (uint64, bool) {
+	if !e.hasLabels() {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint64(e[len(e)-labelsWidth:]), true
+}
+
+// PutProcess stores the ID of the process a flow is attributed to in the key (assuming it was extended
+// via ExtendTagged())
+func (e ExtendedKey) PutProcess(id uint32) {
+	binary.BigEndian.PutUint32(e[len(e)-processOffset:], id)
+}
+
+// AttrProcess retrieves the ID of the process a flow is attributed to (indicating its presence via the
+// second result parameter)
+func (e ExtendedKey) AttrProcess() (uint32, bool) {
+	if !e.hasLabels() {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint32(e[len(e)-processOffset:]), true
+}
+
+// PutVLAN stores the 802.1Q VLAN ID a flow was observed on in the key (assuming it was extended via
+// ExtendTagged())
+func (e ExtendedKey) PutVLAN(vlan uint16) {
+	binary.BigEndian.PutUint16(e[len(e)-vlanOffset:], vlan)
+}
+
+// AttrVLAN retrieves the 802.1Q VLAN ID a flow was observed on (zero if untagged, indicating its presence
+// via the second result parameter)
+func (e ExtendedKey) AttrVLAN() (uint16, bool) {
+	if !e.hasLabels() {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint16(e[len(e)-vlanOffset:]), true
+}
+
+// PutSMAC stores the source MAC address of a flow in the key (assuming it was extended via ExtendTagged())
+func (e ExtendedKey) PutSMAC(mac MAC) {
+	copy(e[len(e)-smacOffset:], mac[:])
+}
+
+// PutDMAC stores the destination MAC address of a flow in the key (assuming it was extended via
+// ExtendTagged())
+func (e ExtendedKey) PutDMAC(mac MAC) {
+	copy(e[len(e)-dmacOffset:], mac[:])
+}
+
+// AttrSMAC retrieves the source MAC address of a flow (zero if not recorded, indicating its presence via
+// the second result parameter)
+func (e ExtendedKey) AttrSMAC() (mac MAC, present bool) {
+	if !e.hasLabels() {
+		return mac, false
+	}
+
+	copy(mac[:], e[len(e)-smacOffset:])
+	return mac, true
+}
+
+// AttrDMAC retrieves the destination MAC address of a flow (zero if not recorded, indicating its presence
+// via the second result parameter)
+func (e ExtendedKey) AttrDMAC() (mac MAC, present bool) {
+	if !e.hasLabels() {
+		return mac, false
+	}
+
+	copy(mac[:], e[len(e)-dmacOffset:])
+	return mac, true
+}
+
+// PutTCPFlags stores the (OR-combined) TCP flags of a flow in the key (assuming it was extended via
+// ExtendTagged())
+func (e ExtendedKey) PutTCPFlags(flags TCPFlags) {
+	e[len(e)-tcpFlagsOffset] = byte(flags)
+}
+
+// AttrTCPFlags retrieves the (OR-combined) TCP flags of a flow (zero if not recorded, indicating its
+// presence via the second result parameter)
+func (e ExtendedKey) AttrTCPFlags() (TCPFlags, bool) {
+	if !e.hasLabels() {
+		return 0, false
+	}
+
+	return TCPFlags(e[len(e)-tcpFlagsOffset]), true
+}
+
+// PutDSCP stores the DSCP of a flow in the key (assuming it was extended via ExtendTagged())
+func (e ExtendedKey) PutDSCP(dscp DSCP) {
+	e[len(e)-dscpOffset] = byte(dscp)
+}
+
+// AttrDSCP retrieves the DSCP a flow was observed with (zero if not recorded, indicating its presence
+// via the second result parameter)
+func (e ExtendedKey) AttrDSCP() (DSCP, bool) {
+	if !e.hasLabels() {
+		return 0, false
+	}
+
+	return DSCP(e[len(e)-dscpOffset]), true
+}
+
+// labelsWidth denotes the width of the labels carried by keys extended via ExtendTagged() (the bitmap of
+// flow tags followed by the process ID, the VLAN ID, the source / destination MAC addresses, the TCP
+// flags and the DSCP). Note that the resulting key lengths must remain distinct for IPv4 and IPv6 keys (since the IP
+// version is derived from the length of a key)
+const labelsWidth = TagsWidth + ProcessWidth + VLANWidth + 2*MACWidth + TCPFlagsWidth + DSCPWidth
+
+// Offsets of the individual labels from the end of a key extended via ExtendTagged()
+const (
+	dscpOffset     = DSCPWidth
+	tcpFlagsOffset = dscpOffset + TCPFlagsWidth
+	dmacOffset     = tcpFlagsOffset + MACWidth
+	smacOffset     = dmacOffset + MACWidth
+	vlanOffset     = smacOffset + VLANWidth
+	processOffset  = vlanOffset + ProcessWidth
+)
+
+func (e ExtendedKey) hasLabels() bool {
+	return len(e) == KeyWidthIPv4+TimestampWidth+labelsWidth || len(e) == KeyWidthIPv6+TimestampWidth+labelsWidth
+}
+
 // String prints the key as a comma separated attribute list
 func (k Key) String() string {
 	return fmt.Sprintf("%s,%s,%d,%s",
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// MAC denotes a (48 bit) Ethernet MAC address
+type MAC [MACWidth]byte
+
+// ParseMAC parses a MAC address in any of the notations supported by net.ParseMAC (e.g.
+// "aa:bb:cc:dd:ee:ff" or "aabb.ccdd.eeff"), rejecting addresses other than 48 bit ones
+func ParseMAC(s string) (mac MAC, err error) {
+	hwAddr, err := net.ParseMAC(s)
+	if err != nil {
+		return mac, err
+	}
+	if len(hwAddr) != MACWidth {
+		return mac, fmt.Errorf("invalid MAC address %s: only 48 bit addresses are supported", s)
+	}
+	copy(mac[:], hwAddr)
+	return mac, nil
+}
+
+// MACFromUint64 converts the lower 48 bits of a number to a MAC address (c.f. MAC.Uint64())
+func MACFromUint64(v uint64) (mac MAC) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	copy(mac[:], buf[2:])
+	return
+}
+
+// Uint64 converts the MAC address to a number (e.g. for storage in a counter column)
+func (m MAC) Uint64() uint64 {
+	var buf [8]byte
+	copy(buf[2:], m[:])
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// IsZero returns if the MAC address is empty (i.e. was not recorded)
+func (m MAC) IsZero() bool {
+	return m == MAC{}
+}
+
+// String prints the MAC address in colon notation (or an empty string if it is empty)
+func (m MAC) String() string {
+	if m.IsZero() {
+		return ""
+	}
+	return net.HardwareAddr(m[:]).String()
+}
@@ -0,0 +1,145 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+// AttributePlugin derives a custom attribute from the attribute columns stored in the goDB, e.g.
+// mapping the destination port and IP protocol of a flow onto the ID of an internal service
+// catalog. Custom attributes can be used like any other attribute in queries and conditions.
+//
+// Plugins are compiled in and register themselves via RegisterAttributePlugin (typically from
+// their init() function, see plugins/attribute)
+type AttributePlugin interface {
+	// Name returns the name by which the attribute is referenced in queries and conditions
+	Name() string
+
+	// Columns returns the attribute columns the attribute is derived from (e.g. DportColIdx
+	// and ProtoColIdx)
+	Columns() []ColumnIndex
+
+	// Derive returns the value of the attribute for a flow. Only the columns the attribute is
+	// derived from are guaranteed to be populated in the key. Derive is called concurrently
+	Derive(key Key) string
+}
+
+var (
+	attributePlugins   = make(map[string]AttributePlugin)
+	attributePluginsMu sync.RWMutex
+
+	// names are restricted in order to be unambiguous in both query types and conditions
+	attributePluginNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+	// names reserved by the conditions, which aren't valid attributes in queries
+	reservedConditionNames = []string{"snet", "dnet", "host", "net", FilterKeywordDirection, FilterKeywordDirectionSugared}
+)
+
+// RegisterAttributePlugin registers a custom attribute plugin. It panics if the name of the attribute
+// is invalid or already taken (by a built-in attribute / label or another plugin), or if the attribute
+// isn't derived from any valid attribute column
+func RegisterAttributePlugin(plugin AttributePlugin) {
+	name := plugin.Name()
+	if err := validateAttributePluginName(name); err != nil {
+		panic(fmt.Sprintf("invalid attribute plugin %q: %v", name, err))
+	}
+	columns := plugin.Columns()
+	if len(columns) == 0 {
+		panic(fmt.Sprintf("invalid attribute plugin %q: not derived from any column", name))
+	}
+	for _, colIdx := range columns {
+		if colIdx < 0 || colIdx >= ColIdxAttributeCount {
+			panic(fmt.Sprintf("invalid attribute plugin %q: %d is not an attribute column", name, colIdx))
+		}
+	}
+
+	attributePluginsMu.Lock()
+	defer attributePluginsMu.Unlock()
+
+	if _, exists := attributePlugins[name]; exists {
+		panic(fmt.Sprintf("%q attribute plugin already registered", name))
+	}
+	attributePlugins[name] = plugin
+}
+
+// GetAttributePlugin returns the attribute plugin registered for name (if any)
+func GetAttributePlugin(name string) (AttributePlugin, bool) {
+	attributePluginsMu.RLock()
+	plugin, exists := attributePlugins[name]
+	attributePluginsMu.RUnlock()
+
+	return plugin, exists
+}
+
+// AttributePluginNames returns the (sorted) names of all registered attribute plugins
+func AttributePluginNames() []string {
+	attributePluginsMu.RLock()
+	names := make([]string, 0, len(attributePlugins))
+	for name := range attributePlugins {
+		names = append(names, name)
+	}
+	attributePluginsMu.RUnlock()
+
+	slices.Sort(names)
+	return names
+}
+
+func validateAttributePluginName(name string) error {
+	if !attributePluginNameRegexp.MatchString(name) {
+		return fmt.Errorf("name must match %s", attributePluginNameRegexp)
+	}
+	if _, err := NewAttribute(name); err == nil {
+		return fmt.Errorf("name is taken by a built-in attribute")
+	}
+	if tokens := Tokenize(name); len(tokens) != 1 || tokens[0] != name {
+		return fmt.Errorf("name is taken by a query type")
+	}
+	if _, selector, err := ParseQueryType(name); err == nil && selector != (LabelSelector{}) {
+		return fmt.Errorf("name is taken by a label")
+	}
+	if slices.Contains(reservedConditionNames, name) {
+		return fmt.Errorf("name is reserved by the conditions")
+	}
+	return nil
+}
+
+// CustomAttribute implements an attribute derived from the stored attribute columns by an
+// attribute plugin
+type CustomAttribute struct {
+	plugin AttributePlugin
+}
+
+// Width returns the amount of bytes the custom attribute takes up in a key (none, since it is
+// derived from the columns it depends on)
+func (CustomAttribute) Width() Width {
+	return 0
+}
+
+// String returns the string representation of the custom attribute
+func (c CustomAttribute) String() string {
+	return c.plugin.Name()
+}
+
+// Resolvable returns if the custom attribute is resolvable
+func (CustomAttribute) Resolvable() bool {
+	return false
+}
+
+// Name returns the custom attribute's name
+func (c CustomAttribute) Name() string {
+	return c.plugin.Name()
+}
+
+// Columns returns the attribute columns the custom attribute is derived from
+func (c CustomAttribute) Columns() []ColumnIndex {
+	return c.plugin.Columns()
+}
+
+// Derive returns the value of the custom attribute for a flow
+func (c CustomAttribute) Derive(key Key) string {
+	return c.plugin.Derive(key)
+}
+
+func (CustomAttribute) attributeMarker() {}
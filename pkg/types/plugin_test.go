@@ -0,0 +1,65 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testAttributePlugin struct {
+	name    string
+	columns []ColumnIndex
+}
+
+func (p testAttributePlugin) Name() string           { return p.name }
+func (p testAttributePlugin) Columns() []ColumnIndex { return p.columns }
+func (p testAttributePlugin) Derive(key Key) string {
+	if PortToUint16(key.GetDport()) < 1024 {
+		return "system"
+	}
+	return "user"
+}
+
+func init() {
+	RegisterAttributePlugin(testAttributePlugin{name: "portrange", columns: []ColumnIndex{DportColIdx}})
+}
+
+func TestRegisterAttributePlugin(t *testing.T) {
+	for _, invalid := range []testAttributePlugin{
+		{name: "", columns: []ColumnIndex{DportColIdx}},
+		{name: "Service", columns: []ColumnIndex{DportColIdx}},
+		{name: "svc,id", columns: []ColumnIndex{DportColIdx}},
+		{name: "dport", columns: []ColumnIndex{DportColIdx}},
+		{name: "src", columns: []ColumnIndex{SIPColIdx}},
+		{name: "talk_conv", columns: []ColumnIndex{SIPColIdx}},
+		{name: "iface", columns: []ColumnIndex{SIPColIdx}},
+		{name: "hostname", columns: []ColumnIndex{SIPColIdx}},
+		{name: "dnet", columns: []ColumnIndex{DIPColIdx}},
+		{name: "service"},
+		{name: "service", columns: []ColumnIndex{BytesRcvdColIdx}},
+		{name: "portrange", columns: []ColumnIndex{DportColIdx}}, // already registered
+	} {
+		require.Panics(t, func() { RegisterAttributePlugin(invalid) }, invalid.name)
+	}
+	require.Equal(t, []string{"portrange"}, AttributePluginNames())
+}
+
+func TestParseQueryTypeCustomAttribute(t *testing.T) {
+	attributes, _, err := ParseQueryType("sip,portrange,proto")
+	require.Nil(t, err)
+	require.Len(t, attributes, 3)
+
+	custom, isCustom := attributes[1].(CustomAttribute)
+	require.True(t, isCustom)
+	require.Equal(t, "portrange", custom.Name())
+	require.Equal(t, []ColumnIndex{DportColIdx}, custom.Columns())
+	require.Equal(t, "system", custom.Derive(NewV4KeyStatic([4]byte{}, [4]byte{}, []byte{0, 22}, 6)))
+	require.Equal(t, "user", custom.Derive(NewV4KeyStatic([4]byte{}, [4]byte{}, []byte{0x1f, 0x90}, 6)))
+
+	// the destination port class replaces the destination port the attribute is derived from
+	_, _, err = ParseQueryType("portrange,dportclass")
+	require.Error(t, err)
+
+	_, _, err = ParseQueryType("portrange,dport")
+	require.Nil(t, err)
+}
@@ -0,0 +1,187 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	portClassSep       = ";"
+	portClassAssignSep = "="
+	portRangeSep       = ","
+	portRangeBoundSep  = "-"
+
+	// PortClassOther denotes the label of all ports not covered by any of the port classes
+	PortClassOther = "other"
+)
+
+// PortRange denotes a (closed) range of ports
+type PortRange struct {
+	First uint16 `json:"first"`
+	Last  uint16 `json:"last"`
+}
+
+// Contains returns if the port is part of the range
+func (r PortRange) Contains(port uint16) bool {
+	return r.First <= port && port <= r.Last
+}
+
+// String returns the string representation of the port range
+func (r PortRange) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(int(r.First))
+	}
+	return fmt.Sprintf("%d%s%d", r.First, portRangeBoundSep, r.Last)
+}
+
+// PortClass denotes a named set of port ranges by which destination ports are bucketed
+type PortClass struct {
+	Name   string      `json:"name"`
+	Ranges []PortRange `json:"ranges"`
+}
+
+// PortClasses denotes an ordered list of port classes. Ports not covered by any of the classes
+// are attributed to the (implicit) PortClassOther class
+type PortClasses []PortClass
+
+// DefaultPortClasses buckets destination ports into the IANA well-known, registered and
+// ephemeral (dynamic) port ranges
+var DefaultPortClasses = PortClasses{
+	{Name: "well-known", Ranges: []PortRange{{0, 1023}}},
+	{Name: "registered", Ranges: []PortRange{{1024, 49151}}},
+	{Name: "ephemeral", Ranges: []PortRange{{49152, math.MaxUint16}}},
+}
+
+// ParsePortClasses parses a list of port classes of the form "web=80,443,8080-8090;dns=53"
+func ParsePortClasses(s string) (PortClasses, error) {
+	s = spaceMap(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var classes PortClasses
+	for _, def := range strings.Split(s, portClassSep) {
+		name, ranges, found := strings.Cut(def, portClassAssignSep)
+		if !found || name == "" || ranges == "" {
+			return nil, fmt.Errorf("invalid port class %q, expected <name>%s<port|range>[%s<port|range>...]", def, portClassAssignSep, portRangeSep)
+		}
+		if name == PortClassOther {
+			return nil, fmt.Errorf("port class name %q is reserved for uncovered ports", PortClassOther)
+		}
+
+		class := PortClass{Name: name}
+		for _, r := range strings.Split(ranges, portRangeSep) {
+			portRange, err := parsePortRange(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port class %q: %w", name, err)
+			}
+			class.Ranges = append(class.Ranges, portRange)
+		}
+		classes = append(classes, class)
+	}
+
+	return classes, classes.validate()
+}
+
+func parsePortRange(s string) (PortRange, error) {
+	first, last, isRange := strings.Cut(s, portRangeBoundSep)
+	if !isRange {
+		last = first
+	}
+	firstPort, err := strconv.ParseUint(first, 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q", first)
+	}
+	lastPort, err := strconv.ParseUint(last, 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q", last)
+	}
+	if firstPort > lastPort {
+		return PortRange{}, fmt.Errorf("invalid port range %q: first port exceeds last port", s)
+	}
+	return PortRange{First: uint16(firstPort), Last: uint16(lastPort)}, nil
+}
+
+func (p PortClasses) validate() error {
+	// the class index is stored in place of the destination port, so the implicit "other"
+	// class must still be representable
+	if len(p) >= math.MaxUint16 {
+		return fmt.Errorf("too many port classes: %d", len(p))
+	}
+
+	type classRange struct {
+		class string
+		PortRange
+	}
+
+	var (
+		names  = make(map[string]struct{}, len(p))
+		ranges []classRange
+	)
+	for _, class := range p {
+		if _, exists := names[class.Name]; exists {
+			return fmt.Errorf("port class %q defined more than once", class.Name)
+		}
+		names[class.Name] = struct{}{}
+
+		for _, r := range class.Ranges {
+			for _, other := range ranges {
+				if r.First <= other.Last && other.First <= r.Last {
+					return fmt.Errorf("port range %s of class %q overlaps with port range %s of class %q", r, class.Name, other.PortRange, other.class)
+				}
+			}
+			ranges = append(ranges, classRange{class.Name, r})
+		}
+	}
+	return nil
+}
+
+// Classify returns the index of the port class covering the port. Ports not covered by any
+// of the classes yield len(p), denoting the PortClassOther class
+func (p PortClasses) Classify(port uint16) uint16 {
+	for i, class := range p {
+		for _, r := range class.Ranges {
+			if r.Contains(port) {
+				return uint16(i)
+			}
+		}
+	}
+	return uint16(len(p))
+}
+
+// Label returns the label of the port class with the given index (as returned by Classify)
+func (p PortClasses) Label(idx uint16) string {
+	if int(idx) < len(p) {
+		return p[idx].Name
+	}
+	return PortClassOther
+}
+
+// KeyTable creates a lookup table mapping each (raw) destination port to the (raw) index of
+// its port class, allowing to replace the destination port in a key by its class without
+// having to evaluate the port ranges for each flow. The class of port p is stored at
+// [p*DportSizeof:(p+1)*DportSizeof]
+func (p PortClasses) KeyTable() []byte {
+	table := make([]byte, (math.MaxUint16+1)*DportSizeof)
+	for port := 0; port <= math.MaxUint16; port++ {
+		binary.BigEndian.PutUint16(table[port*DportSizeof:], p.Classify(uint16(port)))
+	}
+	return table
+}
+
+// String returns the string representation of the port classes (in the format
+// accepted by ParsePortClasses)
+func (p PortClasses) String() string {
+	classes := make([]string, len(p))
+	for i, class := range p {
+		ranges := make([]string, len(class.Ranges))
+		for j, r := range class.Ranges {
+			ranges[j] = r.String()
+		}
+		classes[i] = class.Name + portClassAssignSep + strings.Join(ranges, portRangeSep)
+	}
+	return strings.Join(classes, portClassSep)
+}
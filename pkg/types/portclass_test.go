@@ -0,0 +1,79 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortClasses(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected PortClasses
+		errMsg   string
+	}{
+		{"empty", " ", nil, ""},
+		{"single port", "dns=53", PortClasses{{Name: "dns", Ranges: []PortRange{{53, 53}}}}, ""},
+		{"ports and ranges", " web = 80, 443,8080-8090 ; dns=53", PortClasses{
+			{Name: "web", Ranges: []PortRange{{80, 80}, {443, 443}, {8080, 8090}}},
+			{Name: "dns", Ranges: []PortRange{{53, 53}}},
+		}, ""},
+		{"missing assignment", "web", nil, `invalid port class "web"`},
+		{"missing ports", "web=", nil, `invalid port class "web="`},
+		{"reserved name", "other=80", nil, `port class name "other" is reserved for uncovered ports`},
+		{"invalid port", "web=http", nil, `invalid port class "web": invalid port "http"`},
+		{"port out of range", "web=65536", nil, `invalid port class "web": invalid port "65536"`},
+		{"inverted range", "web=90-80", nil, `invalid port class "web": invalid port range "90-80": first port exceeds last port`},
+		{"duplicate class", "web=80;web=443", nil, `port class "web" defined more than once`},
+		{"overlapping ranges", "web=80,8000-9000;alt=8080", nil, `port range 8080 of class "alt" overlaps with port range 8000-9000 of class "web"`},
+		{"duplicate port", "web=80,80", nil, `port range 80 of class "web" overlaps with port range 80 of class "web"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			classes, err := ParsePortClasses(test.input)
+			if test.errMsg != "" {
+				require.ErrorContains(t, err, test.errMsg)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expected, classes)
+
+			// the string representation must be parsable again
+			reparsed, err := ParsePortClasses(classes.String())
+			require.Nil(t, err)
+			require.Equal(t, classes, reparsed)
+		})
+	}
+}
+
+func TestClassifyPorts(t *testing.T) {
+	classes, err := ParsePortClasses("web=80,443;dns=53")
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		classes  PortClasses
+		port     uint16
+		expected string
+	}{
+		{DefaultPortClasses, 0, "well-known"},
+		{DefaultPortClasses, 1023, "well-known"},
+		{DefaultPortClasses, 1024, "registered"},
+		{DefaultPortClasses, 49151, "registered"},
+		{DefaultPortClasses, 49152, "ephemeral"},
+		{DefaultPortClasses, math.MaxUint16, "ephemeral"},
+		{classes, 443, "web"},
+		{classes, 53, "dns"},
+		{classes, 22, PortClassOther},
+	} {
+		require.Equal(t, test.expected, test.classes.Label(test.classes.Classify(test.port)), "port %d", test.port)
+	}
+
+	// the lookup table must yield the same classes as the direct classification
+	table := classes.KeyTable()
+	for port := 0; port <= math.MaxUint16; port++ {
+		require.Equal(t, classes.Classify(uint16(port)), PortToUint16(table[port*DportSizeof:(port+1)*DportSizeof]))
+	}
+}
@@ -0,0 +1,138 @@
+package types
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const (
+	prefixGroupSep       = ";"
+	prefixGroupAssignSep = "="
+	prefixSep            = ","
+
+	// PrefixGroupOther denotes the label of all IPs not covered by any of the prefix groups
+	PrefixGroupOther = "other"
+)
+
+// PrefixGroup denotes a named set of IP prefixes (e.g. the subnets of a site or VLAN)
+type PrefixGroup struct {
+	Name     string         `json:"name"`
+	Prefixes []netip.Prefix `json:"prefixes"`
+}
+
+// PrefixGroups denotes an ordered list of prefix groups. IPs not covered by any of the groups
+// are attributed to the (implicit) PrefixGroupOther group
+type PrefixGroups []PrefixGroup
+
+// ParsePrefixGroups parses a list of prefix groups of the form "siteA=10.1.0.0/16,10.2.0.0/16;siteB=192.168.0.0/24".
+// Single IPs are accepted as host prefixes
+func ParsePrefixGroups(s string) (PrefixGroups, error) {
+	s = spaceMap(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var groups PrefixGroups
+	for _, def := range strings.Split(s, prefixGroupSep) {
+		name, prefixes, found := strings.Cut(def, prefixGroupAssignSep)
+		if !found || name == "" || prefixes == "" {
+			return nil, fmt.Errorf("invalid prefix group %q, expected <name>%s<prefix|ip>[%s<prefix|ip>...]", def, prefixGroupAssignSep, prefixSep)
+		}
+		if name == PrefixGroupOther {
+			return nil, fmt.Errorf("prefix group name %q is reserved for uncovered IPs", PrefixGroupOther)
+		}
+
+		group := PrefixGroup{Name: name}
+		for _, p := range strings.Split(prefixes, prefixSep) {
+			prefix, err := parsePrefix(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid prefix group %q: %w", name, err)
+			}
+			group.Prefixes = append(group.Prefixes, prefix)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, groups.validate()
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+	}
+	if prefix != prefix.Masked() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q: host bits set (use %s)", s, prefix.Masked())
+	}
+	return prefix, nil
+}
+
+func (p PrefixGroups) validate() error {
+	var (
+		names    = make(map[string]struct{}, len(p))
+		prefixes = make(map[netip.Prefix]string)
+	)
+	for _, group := range p {
+		if _, exists := names[group.Name]; exists {
+			return fmt.Errorf("prefix group %q defined more than once", group.Name)
+		}
+		names[group.Name] = struct{}{}
+
+		// overlapping prefixes are resolved by the longest match, identical ones would be ambiguous
+		for _, prefix := range group.Prefixes {
+			if other, exists := prefixes[prefix]; exists {
+				return fmt.Errorf("prefix %s of group %q is already part of group %q", prefix, group.Name, other)
+			}
+			prefixes[prefix] = group.Name
+		}
+	}
+	return nil
+}
+
+// Classify returns the index of the prefix group covering the IP (using the longest matching
+// prefix if several groups cover it). IPs not covered by any of the groups yield len(p), denoting
+// the PrefixGroupOther group
+func (p PrefixGroups) Classify(addr netip.Addr) int {
+	addr = addr.Unmap()
+
+	idx, bits := len(p), -1
+	for i, group := range p {
+		for _, prefix := range group.Prefixes {
+			if prefix.Bits() > bits && prefix.Contains(addr) {
+				idx, bits = i, prefix.Bits()
+			}
+		}
+	}
+	return idx
+}
+
+// Labels returns the labels of all groups (in order), including the trailing PrefixGroupOther group
+func (p PrefixGroups) Labels() []string {
+	labels := make([]string, 0, len(p)+1)
+	for _, group := range p {
+		labels = append(labels, group.Name)
+	}
+	return append(labels, PrefixGroupOther)
+}
+
+// String returns the string representation of the prefix groups (in the format
+// accepted by ParsePrefixGroups)
+func (p PrefixGroups) String() string {
+	groups := make([]string, len(p))
+	for i, group := range p {
+		prefixes := make([]string, len(group.Prefixes))
+		for j, prefix := range group.Prefixes {
+			prefixes[j] = prefix.String()
+		}
+		groups[i] = group.Name + prefixGroupAssignSep + strings.Join(prefixes, prefixSep)
+	}
+	return strings.Join(groups, prefixGroupSep)
+}
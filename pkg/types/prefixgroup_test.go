@@ -0,0 +1,72 @@
+package types
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefixGroups(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected PrefixGroups
+		errMsg   string
+	}{
+		{"empty", " ", nil, ""},
+		{"single prefix", "siteA=10.1.0.0/16", PrefixGroups{
+			{Name: "siteA", Prefixes: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}},
+		}, ""},
+		{"prefixes and IPs", " siteA = 10.1.0.0/16, 10.2.0.1 ; v6=2001:db8::/32", PrefixGroups{
+			{Name: "siteA", Prefixes: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("10.2.0.1/32")}},
+			{Name: "v6", Prefixes: []netip.Prefix{netip.MustParsePrefix("2001:db8::/32")}},
+		}, ""},
+		{"missing assignment", "siteA", nil, `invalid prefix group "siteA"`},
+		{"missing prefixes", "siteA=", nil, `invalid prefix group "siteA="`},
+		{"reserved name", "other=10.0.0.0/8", nil, `prefix group name "other" is reserved for uncovered IPs`},
+		{"invalid prefix", "siteA=10.1.0.0/33", nil, `invalid prefix group "siteA": invalid prefix "10.1.0.0/33"`},
+		{"invalid IP", "siteA=siteB", nil, `invalid prefix group "siteA": invalid prefix "siteB"`},
+		{"host bits set", "siteA=10.1.0.1/16", nil, `invalid prefix group "siteA": invalid prefix "10.1.0.1/16": host bits set (use 10.1.0.0/16)`},
+		{"duplicate group", "siteA=10.1.0.0/16;siteA=10.2.0.0/16", nil, `prefix group "siteA" defined more than once`},
+		{"duplicate prefix", "siteA=10.1.0.0/16;siteB=10.1.0.0/16", nil, `prefix 10.1.0.0/16 of group "siteB" is already part of group "siteA"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups, err := ParsePrefixGroups(test.input)
+			if test.errMsg != "" {
+				require.ErrorContains(t, err, test.errMsg)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expected, groups)
+
+			// the string representation must be parsable again
+			reparsed, err := ParsePrefixGroups(groups.String())
+			require.Nil(t, err)
+			require.Equal(t, groups, reparsed)
+		})
+	}
+}
+
+func TestClassifyPrefixGroups(t *testing.T) {
+	groups, err := ParsePrefixGroups("corp=10.0.0.0/8;dmz=10.10.0.0/16,192.168.1.1;v6=2001:db8::/32")
+	require.Nil(t, err)
+	require.Equal(t, []string{"corp", "dmz", "v6", PrefixGroupOther}, groups.Labels())
+
+	for _, test := range []struct {
+		addr     string
+		expected string
+	}{
+		{"10.1.2.3", "corp"},
+		{"10.10.2.3", "dmz"}, // longest prefix match
+		{"::ffff:10.10.2.3", "dmz"},
+		{"192.168.1.1", "dmz"},
+		{"192.168.1.2", PrefixGroupOther},
+		{"2001:db8::1", "v6"},
+		{"2001:db9::1", PrefixGroupOther},
+	} {
+		require.Equal(t, test.expected, groups.Labels()[groups.Classify(netip.MustParseAddr(test.addr))], "addr %s", test.addr)
+	}
+}
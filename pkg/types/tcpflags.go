@@ -0,0 +1,84 @@
+package types
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// TCPFlags denotes a bitmap of TCP flags (in the layout of the TCP header), e.g. the OR-combination of
+// the flags of all packets of a flow
+type TCPFlags uint8
+
+// TCP flags
+const (
+	TCPFlagFIN TCPFlags = 1 << iota
+	TCPFlagSYN
+	TCPFlagRST
+	TCPFlagPSH
+	TCPFlagACK
+	TCPFlagURG
+	TCPFlagECE
+	TCPFlagCWR
+)
+
+// TCPFlagSep denotes the separator of the names of the flags of a bitmap of TCP flags (c.f. String())
+const TCPFlagSep = ","
+
+// tcpFlagNames lists the (lowercase) names of the TCP flags, indexed by their bit
+var tcpFlagNames = [8]string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr"}
+
+// ParseTCPFlag parses the name of a single TCP flag (e.g. "syn"), ignoring its case
+func ParseTCPFlag(name string) (TCPFlags, error) {
+	for i, flagName := range tcpFlagNames {
+		if strings.EqualFold(name, flagName) {
+			return TCPFlags(1 << i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown TCP flag %q (expected one of %s)", name, strings.Join(tcpFlagNames[:], ", "))
+}
+
+// IsTCPFlagName returns if name denotes a single TCP flag (c.f. ParseTCPFlag())
+func IsTCPFlagName(name string) bool {
+	_, err := ParseTCPFlag(name)
+	return err == nil
+}
+
+// Has returns if all flags of mask are set
+func (f TCPFlags) Has(mask TCPFlags) bool {
+	return f&mask == mask
+}
+
+// String prints the (uppercase) names of all flags set, separated by TCPFlagSep (or an empty string if
+// none are set)
+func (f TCPFlags) String() string {
+	names := make([]string, 0, bits.OnesCount8(uint8(f)))
+	for i, flagName := range tcpFlagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, strings.ToUpper(flagName))
+		}
+	}
+	return strings.Join(names, TCPFlagSep)
+}
+
+// ParseTCPFlagsCondition parses a conjunction of (optionally negated) TCP flags, e.g. "syn&!ack", into
+// the mask of flags it refers to and the state they are required to be in. A bitmap of TCP flags f
+// satisfies the condition iff f&mask == want
+func ParseTCPFlagsCondition(expr string) (mask, want TCPFlags, err error) {
+	for _, term := range strings.Split(expr, "&") {
+		term = strings.TrimSpace(term)
+		negated := strings.HasPrefix(term, "!")
+		flag, err := ParseTCPFlag(strings.TrimSpace(strings.TrimPrefix(term, "!")))
+		if err != nil {
+			return 0, 0, err
+		}
+		if mask&flag != 0 && (want&flag != 0) == negated {
+			return 0, 0, fmt.Errorf("contradicting conditions on TCP flag %q", tcpFlagNames[bits.TrailingZeros8(uint8(flag))])
+		}
+		mask |= flag
+		if !negated {
+			want |= flag
+		}
+	}
+	return mask, want, nil
+}
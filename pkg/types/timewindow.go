@@ -0,0 +1,201 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	timeWindowSep     = ";"
+	weekdaysTimeSep   = " "
+	weekdaySep        = ","
+	weekdayRangeSep   = "-"
+	timeOfDayRangeSep = "-"
+	timeOfDayFormat   = "15:04"
+	endOfDay          = "24:00"
+
+	secondsPerDay = 24 * 60 * 60
+	allWeekdays   = 1<<7 - 1
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeWindow denotes a window recurring on each of its weekdays, e.g. from 09:00 to 17:00 on
+// Mondays to Fridays. Windows ending before they start (e.g. from 22:00 to 06:00) span midnight
+// and are attributed to the weekday they start on
+type TimeWindow struct {
+	// Weekdays denotes the bitmap of weekdays the window starts on (bit i denotes time.Weekday(i))
+	Weekdays uint8 `json:"weekdays"`
+
+	// From / To denote the start (inclusive) and end (exclusive) of the window in seconds
+	// since midnight
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Contains returns if the window contains the (wall clock) time t, evaluated in the location of t
+func (w TimeWindow) Contains(t time.Time) bool {
+	sec := t.Hour()*3600 + t.Minute()*60 + t.Second()
+	if w.From < w.To {
+		return w.From <= sec && sec < w.To && w.startsOn(t.Weekday())
+	}
+
+	// windows spanning midnight contain the time either on the weekday they start on or on the
+	// subsequent one
+	if sec >= w.From {
+		return w.startsOn(t.Weekday())
+	}
+	return sec < w.To && w.startsOn((t.Weekday()+6)%7)
+}
+
+// String returns the string representation of the window
+func (w TimeWindow) String() string {
+	var days []string
+	if w.Weekdays != allWeekdays {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if w.startsOn(day) {
+				days = append(days, strings.ToLower(day.String()[:3]))
+			}
+		}
+	}
+	tod := formatTimeOfDay(w.From) + timeOfDayRangeSep + formatTimeOfDay(w.To)
+	if len(days) == 0 {
+		return tod
+	}
+	return strings.Join(days, weekdaySep) + weekdaysTimeSep + tod
+}
+
+func (w TimeWindow) startsOn(day time.Weekday) bool {
+	return w.Weekdays&(1<<day) != 0
+}
+
+// TimeWindows denotes a list of recurring time windows. A time is covered if any of the windows
+// contains it
+type TimeWindows []TimeWindow
+
+// Contains returns if any of the windows contains the (wall clock) time t, evaluated in the
+// location of t
+func (ws TimeWindows) Contains(t time.Time) bool {
+	for _, w := range ws {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the string representation of the windows
+func (ws TimeWindows) String() string {
+	strs := make([]string, len(ws))
+	for i, w := range ws {
+		strs[i] = w.String()
+	}
+	return strings.Join(strs, timeWindowSep)
+}
+
+// ParseTimeWindows parses a list of recurring time windows of the form
+// "mon-fri 09:00-17:00;sat,sun 10:00-12:00". Weekdays are optional (a window without weekdays
+// recurs daily) and may be given as a list of days and / or day ranges
+func ParseTimeWindows(s string) (TimeWindows, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var windows TimeWindows
+	for _, def := range strings.Split(s, timeWindowSep) {
+		fields := strings.Fields(def)
+
+		var (
+			window = TimeWindow{Weekdays: allWeekdays}
+			err    error
+		)
+		switch len(fields) {
+		case 1:
+		case 2:
+			if window.Weekdays, err = parseWeekdays(strings.ToLower(fields[0])); err != nil {
+				return nil, fmt.Errorf("invalid time window %q: %w", def, err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid time window %q, expected [<day|day range>[%s<day|day range>...]] <HH:MM>%s<HH:MM>", def, weekdaySep, timeOfDayRangeSep)
+		}
+		if window.From, window.To, err = parseTimeOfDayRange(fields[len(fields)-1]); err != nil {
+			return nil, fmt.Errorf("invalid time window %q: %w", def, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseWeekdays(s string) (weekdays uint8, err error) {
+	for _, def := range strings.Split(s, weekdaySep) {
+		first, last, isRange := strings.Cut(def, weekdayRangeSep)
+		if !isRange {
+			last = first
+		}
+		firstDay, exists := weekdayNames[first]
+		if !exists {
+			return 0, fmt.Errorf("invalid weekday %q", first)
+		}
+		lastDay, exists := weekdayNames[last]
+		if !exists {
+			return 0, fmt.Errorf("invalid weekday %q", last)
+		}
+
+		// day ranges may wrap around the end of the week (e.g. "fri-mon")
+		for day := firstDay; ; day = (day + 1) % 7 {
+			weekdays |= 1 << day
+			if day == lastDay {
+				break
+			}
+		}
+	}
+	return weekdays, nil
+}
+
+func parseTimeOfDayRange(s string) (from, to int, err error) {
+	first, last, isRange := strings.Cut(s, timeOfDayRangeSep)
+	if !isRange {
+		return 0, 0, fmt.Errorf("invalid time of day range %q, expected <HH:MM>%s<HH:MM>", s, timeOfDayRangeSep)
+	}
+	if from, err = parseTimeOfDay(first); err != nil {
+		return 0, 0, err
+	}
+	if to, err = parseTimeOfDay(last); err != nil {
+		return 0, 0, err
+	}
+	if from == secondsPerDay {
+		return 0, 0, fmt.Errorf("invalid start of time of day range %q", first)
+	}
+	if from == to {
+		return 0, 0, fmt.Errorf("empty time of day range %q", s)
+	}
+	return from, to, nil
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	if s == endOfDay {
+		return secondsPerDay, nil
+	}
+	t, err := time.Parse(timeOfDayFormat, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected <HH:MM>", s)
+	}
+	return t.Hour()*3600 + t.Minute()*60, nil
+}
+
+func formatTimeOfDay(sec int) string {
+	if sec == secondsPerDay {
+		return endOfDay
+	}
+	return fmt.Sprintf("%02d:%02d", sec/3600, (sec%3600)/60)
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeWindows(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected TimeWindows
+		errMsg   string
+	}{
+		{"empty", " ", nil, ""},
+		{"daily", "09:00-17:00", TimeWindows{{Weekdays: allWeekdays, From: 9 * 3600, To: 17 * 3600}}, ""},
+		{"weekdays", " Mon-Fri 09:00-17:30 ; sat,sun 10:00-24:00", TimeWindows{
+			{Weekdays: 0b0111110, From: 9 * 3600, To: 17*3600 + 30*60},
+			{Weekdays: 0b1000001, From: 10 * 3600, To: secondsPerDay},
+		}, ""},
+		{"wrapping day range", "fri-mon 22:00-06:00", TimeWindows{{Weekdays: 0b1100011, From: 22 * 3600, To: 6 * 3600}}, ""},
+		{"invalid weekday", "monday 09:00-17:00", nil, `invalid time window "monday 09:00-17:00": invalid weekday "monday"`},
+		{"missing range", "mon 09:00", nil, `invalid time of day range "09:00"`},
+		{"invalid time", "mon 09:00-25:00", nil, `invalid time of day "25:00"`},
+		{"empty range", "09:00-09:00", nil, `empty time of day range "09:00-09:00"`},
+		{"too many fields", "mon 09:00 17:00", nil, `invalid time window "mon 09:00 17:00"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			windows, err := ParseTimeWindows(test.input)
+			if test.errMsg != "" {
+				require.ErrorContains(t, err, test.errMsg)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, test.expected, windows)
+
+			// the string representation must parse into the same windows
+			if windows != nil {
+				reparsed, err := ParseTimeWindows(windows.String())
+				require.Nil(t, err)
+				require.Equal(t, windows, reparsed)
+			}
+		})
+	}
+}
+
+func TestTimeWindowsContains(t *testing.T) {
+	windows, err := ParseTimeWindows("mon-fri 09:00-17:00;fri 22:00-06:00")
+	require.Nil(t, err)
+
+	var tests = []struct {
+		time     string
+		expected bool
+	}{
+		{"2024-04-15T09:00:00Z", true},  // Monday, start of window
+		{"2024-04-15T08:59:59Z", false}, // Monday, before window
+		{"2024-04-15T17:00:00Z", false}, // Monday, end of window
+		{"2024-04-13T12:00:00Z", false}, // Saturday
+		{"2024-04-19T23:00:00Z", true},  // Friday night
+		{"2024-04-20T05:59:00Z", true},  // Saturday morning (window started on Friday)
+		{"2024-04-16T05:59:00Z", false}, // Tuesday morning (no window started on Monday night)
+	}
+	for _, test := range tests {
+		t.Run(test.time, func(t *testing.T) {
+			ts, err := time.Parse(time.RFC3339, test.time)
+			require.Nil(t, err)
+			require.Equal(t, test.expected, windows.Contains(ts))
+		})
+	}
+}
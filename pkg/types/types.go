@@ -15,6 +15,8 @@ const (
 	FormatCSV      = "csv"      // CSV format
 	FormatTXT      = "txt"      // Text / Shell output format
 	FormatInfluxDB = "influxdb" // Influx DB format
+	FormatXLSX     = "xlsx"     // Excel workbook format
+	FormatParquet  = "parquet"  // Apache Parquet format
 )
 
 // IPVersion denotes the IP layer version (if any) of a conditional node
@@ -65,6 +67,7 @@ const (
 	StatusEmpty       Status = "empty"
 	StatusMissingData Status = "missing_data"
 	StatusOK          Status = "ok"
+	StatusPending     Status = "pending"
 )
 
 // DefaultTimeOutputFormat denotes the default time format to use when displaying time.Time information
@@ -76,6 +79,14 @@ type LabelSelector struct {
 	Iface     bool `json:"iface,omitempty"`
 	Hostname  bool `json:"hostname,omitempty"`
 	HostID    bool `json:"host_id,omitempty"`
+	Zone      bool `json:"zone,omitempty"`
+	Tag       bool `json:"tag,omitempty"`
+	Process   bool `json:"process,omitempty"`
+	VLAN      bool `json:"vlan,omitempty"`
+	SMAC      bool `json:"smac,omitempty"`
+	DMAC      bool `json:"dmac,omitempty"`
+	TCPFlags  bool `json:"flags,omitempty"`
+	DSCP      bool `json:"dscp,omitempty"`
 }
 
 // Width denotes the on-screen column width based on column type
@@ -89,8 +100,17 @@ const (
 	ProtoWidth Width = 1
 
 	TimestampWidth Width = 8
+	TagsWidth      Width = 8
+	ProcessWidth   Width = 4
+	VLANWidth      Width = 2
+	MACWidth       Width = 6
+	TCPFlagsWidth  Width = 1
+	DSCPWidth      Width = 1
 )
 
+// MaxVLAN denotes the highest valid 802.1Q VLAN ID (4095 is reserved)
+const MaxVLAN = 4094
+
 // Basic constants used to simplify column width calculations
 const (
 	sipPos       = 0
@@ -56,3 +56,218 @@ func TestIPAddressStringParsing(t *testing.T) {
 		require.Equal(t, test.expectedErr, err)
 	}
 }
+
+func TestExtendedKeyTags(t *testing.T) {
+	for _, key := range []Key{
+		NewV4Key([]byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, []byte{0, 53}, 17),
+		NewV6Key(make([]byte, 16), make([]byte, 16), []byte{1, 187}, 6),
+	} {
+		isIPv4 := key.IsIPv4()
+
+		t.Run("untagged", func(t *testing.T) {
+			e := key.Extend(1700000000)
+			_, hasTags := e.AttrTags()
+			require.False(t, hasTags)
+		})
+
+		t.Run("tagged without timestamp", func(t *testing.T) {
+			e := key.ExtendTagged(0)
+			e.PutTags(0b101)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			require.Equal(t, key, e.Key())
+			_, hasTS := e.AttrTime()
+			require.False(t, hasTS)
+			tags, hasTags := e.AttrTags()
+			require.True(t, hasTags)
+			require.Equal(t, uint64(0b101), tags)
+		})
+
+		t.Run("tagged with timestamp", func(t *testing.T) {
+			e := key.ExtendTagged(1700000000)
+			e.PutTags(1 << 63)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			ts, hasTS := e.AttrTime()
+			require.True(t, hasTS)
+			require.Equal(t, int64(1700000000), ts)
+			tags, hasTags := e.AttrTags()
+			require.True(t, hasTags)
+			require.Equal(t, uint64(1<<63), tags)
+		})
+
+		t.Run("tagged with process", func(t *testing.T) {
+			e := key.ExtendTagged(1700000000)
+			e.PutTags(0b11)
+			e.PutProcess(42)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			require.Equal(t, key, e.Key())
+			ts, hasTS := e.AttrTime()
+			require.True(t, hasTS)
+			require.Equal(t, int64(1700000000), ts)
+			tags, _ := e.AttrTags()
+			require.Equal(t, uint64(0b11), tags)
+			id, hasProcess := e.AttrProcess()
+			require.True(t, hasProcess)
+			require.Equal(t, uint32(42), id)
+
+			_, hasProcess = key.Extend(1700000000).AttrProcess()
+			require.False(t, hasProcess)
+		})
+
+		t.Run("tagged with vlan", func(t *testing.T) {
+			e := key.ExtendTagged(1700000000)
+			e.PutTags(0b11)
+			e.PutProcess(42)
+			e.PutVLAN(4094)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			require.Equal(t, key, e.Key())
+			ts, _ := e.AttrTime()
+			require.Equal(t, int64(1700000000), ts)
+			tags, _ := e.AttrTags()
+			require.Equal(t, uint64(0b11), tags)
+			id, _ := e.AttrProcess()
+			require.Equal(t, uint32(42), id)
+			vlan, hasVLAN := e.AttrVLAN()
+			require.True(t, hasVLAN)
+			require.Equal(t, uint16(4094), vlan)
+
+			_, hasVLAN = key.Extend(1700000000).AttrVLAN()
+			require.False(t, hasVLAN)
+		})
+
+		t.Run("tagged with macs", func(t *testing.T) {
+			src, dst := MAC{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, MAC{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+			e := key.ExtendTagged(1700000000)
+			e.PutProcess(42)
+			e.PutVLAN(100)
+			e.PutSMAC(src)
+			e.PutDMAC(dst)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			require.Equal(t, key, e.Key())
+			id, _ := e.AttrProcess()
+			require.Equal(t, uint32(42), id)
+			vlan, _ := e.AttrVLAN()
+			require.Equal(t, uint16(100), vlan)
+			smac, hasSMAC := e.AttrSMAC()
+			require.True(t, hasSMAC)
+			require.Equal(t, src, smac)
+			dmac, hasDMAC := e.AttrDMAC()
+			require.True(t, hasDMAC)
+			require.Equal(t, dst, dmac)
+
+			_, hasSMAC = key.Extend(1700000000).AttrSMAC()
+			require.False(t, hasSMAC)
+		})
+
+		t.Run("tagged with tcp flags", func(t *testing.T) {
+			dst := MAC{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+			e := key.ExtendTagged(1700000000)
+			e.PutDMAC(dst)
+			e.PutTCPFlags(TCPFlagSYN | TCPFlagCWR)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			require.Equal(t, key, e.Key())
+			dmac, _ := e.AttrDMAC()
+			require.Equal(t, dst, dmac)
+			flags, hasFlags := e.AttrTCPFlags()
+			require.True(t, hasFlags)
+			require.Equal(t, TCPFlagSYN|TCPFlagCWR, flags)
+
+			_, hasFlags = key.Extend(1700000000).AttrTCPFlags()
+			require.False(t, hasFlags)
+		})
+
+		t.Run("tagged with dscp", func(t *testing.T) {
+			e := key.ExtendTagged(1700000000)
+			e.PutTCPFlags(TCPFlagACK)
+			e.PutDSCP(46)
+
+			require.Equal(t, isIPv4, e.IsIPv4())
+			require.Equal(t, key, e.Key())
+			flags, _ := e.AttrTCPFlags()
+			require.Equal(t, TCPFlagACK, flags)
+			dscp, hasDSCP := e.AttrDSCP()
+			require.True(t, hasDSCP)
+			require.Equal(t, DSCP(46), dscp)
+
+			_, hasDSCP = key.Extend(1700000000).AttrDSCP()
+			require.False(t, hasDSCP)
+		})
+	}
+}
+
+func TestDSCP(t *testing.T) {
+	for value, expected := range map[string]DSCP{"0": 0, "be": 0, "46": 46, "EF": 46, "af41": 34, "cs1": 8, "63": 63} {
+		dscp, err := ParseDSCP(value)
+		require.Nil(t, err, value)
+		require.Equal(t, expected, dscp, value)
+	}
+	for _, invalid := range []string{"", "64", "-1", "af14", "0x2e"} {
+		_, err := ParseDSCP(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	require.Equal(t, "EF", DSCP(46).String())
+	require.Equal(t, "CS0", DSCP(0).String())
+	require.Equal(t, "VOICE-ADMIT", DSCP(44).String())
+	require.Equal(t, "13", DSCP(13).String())
+}
+
+func TestMAC(t *testing.T) {
+	for _, notation := range []string{"aa:bb:cc:00:11:22", "AA-BB-CC-00-11-22", "aabb.cc00.1122"} {
+		mac, err := ParseMAC(notation)
+		require.Nil(t, err)
+		require.Equal(t, "aa:bb:cc:00:11:22", mac.String())
+		require.Equal(t, uint64(0xaabbcc001122), mac.Uint64())
+		require.Equal(t, mac, MACFromUint64(mac.Uint64()))
+	}
+
+	for _, invalid := range []string{"", "aa:bb:cc", "00:00:5e:10:00:00:00:01", "gateway"} {
+		_, err := ParseMAC(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	require.True(t, MAC{}.IsZero())
+	require.Empty(t, MAC{}.String())
+}
+
+func TestTCPFlags(t *testing.T) {
+	for name, expected := range map[string]TCPFlags{"fin": TCPFlagFIN, "SYN": TCPFlagSYN, "Ack": TCPFlagACK, "cwr": TCPFlagCWR} {
+		flag, err := ParseTCPFlag(name)
+		require.Nil(t, err)
+		require.Equal(t, expected, flag)
+		require.True(t, IsTCPFlagName(name))
+	}
+	for _, invalid := range []string{"", "syn,ack", "0x02", "ns"} {
+		_, err := ParseTCPFlag(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	flags := TCPFlagSYN | TCPFlagACK | TCPFlagFIN
+	require.Equal(t, "FIN,SYN,ACK", flags.String())
+	require.True(t, flags.Has(TCPFlagSYN|TCPFlagACK))
+	require.False(t, flags.Has(TCPFlagSYN|TCPFlagRST))
+	require.Empty(t, TCPFlags(0).String())
+}
+
+func TestParseTCPFlagsCondition(t *testing.T) {
+	for expr, expected := range map[string][2]TCPFlags{
+		"syn":          {TCPFlagSYN, TCPFlagSYN},
+		"!rst":         {TCPFlagRST, 0},
+		"syn&!ack":     {TCPFlagSYN | TCPFlagACK, TCPFlagSYN},
+		"syn & syn":    {TCPFlagSYN, TCPFlagSYN},
+		"fin&ack&!psh": {TCPFlagFIN | TCPFlagACK | TCPFlagPSH, TCPFlagFIN | TCPFlagACK},
+	} {
+		mask, want, err := ParseTCPFlagsCondition(expr)
+		require.Nil(t, err, expr)
+		require.Equal(t, expected, [2]TCPFlags{mask, want}, expr)
+	}
+	for _, invalid := range []string{"", "syn&", "syn|ack", "!!syn", "syn&!syn"} {
+		_, _, err := ParseTCPFlagsCondition(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,75 @@
+// Package fsutil provides file system helpers shared across goProbe's packages
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Option denotes a functional option for WriteAtomic / WriteFileAtomic
+type Option func(*options)
+
+type options struct {
+	beforeReplace func() error
+}
+
+// WithBeforeReplace registers a function to be called after the temporary file has been persisted,
+// right before it replaces the destination file (e.g. to retain the current file as previous generation)
+func WithBeforeReplace(fn func() error) Option {
+	return func(o *options) {
+		o.beforeReplace = fn
+	}
+}
+
+// WriteAtomic atomically replaces the file at path with data, see WriteFileAtomic
+func WriteAtomic(path string, data []byte, permissions fs.FileMode, opts ...Option) error {
+	return WriteFileAtomic(path, permissions, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	}, opts...)
+}
+
+// WriteFileAtomic atomically replaces the file at path with the content written by write. The content is
+// written to a temporary file (in the destination directory to avoid moving across the FS barrier), which
+// is synced and moved to path, so readers observe either the previous or the new content, never a partial
+// one
+func WriteFileAtomic(path string, permissions fs.FileMode, write func(f *os.File) error, opts ...Option) (err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := os.Remove(tempFile.Name()); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+			err = rerr
+		}
+	}()
+
+	if err = write(tempFile); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err = tempFile.Sync(); err != nil {
+		_ = tempFile.Close()
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), permissions); err != nil {
+		return err
+	}
+
+	if o.beforeReplace != nil {
+		if err = o.beforeReplace(); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tempFile.Name(), path)
+}
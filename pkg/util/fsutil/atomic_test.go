@@ -0,0 +1,44 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+
+	require.Nil(t, WriteAtomic(path, []byte("first"), 0640))
+	require.Nil(t, WriteAtomic(path, []byte("second"), 0600))
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "second", string(data))
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// a failing hook / write retains the current file
+	errHook := errors.New("hook failed")
+	require.ErrorIs(t, WriteAtomic(path, []byte("third"), 0600, WithBeforeReplace(func() error {
+		return errHook
+	})), errHook)
+	require.ErrorIs(t, WriteFileAtomic(path, 0600, func(*os.File) error {
+		return errHook
+	}), errHook)
+
+	data, err = os.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "second", string(data))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,10 @@
+// Package attribute enumerates the compiled-in attribute plugins (see types.AttributePlugin). Since
+// custom attributes have to be known to all binaries parsing queries, it is imported by goProbe,
+// goQuery and global-query alike.
+//
+// Deployment-specific plugins are added to the list via blank import, e.g.
+//
+//	import _ "example.com/acme/goprobe-plugins/service"
+package attribute
+
+// enumerates the default attribute plugin list (none by default)
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/els0r/goProbe/cmd/global-query/pkg/distributed"
+	"github.com/els0r/goProbe/pkg/types"
 )
 
 func init() {
@@ -17,7 +18,8 @@ func init() {
 type pluginType string
 
 const (
-	querierPlugin pluginType = "querier"
+	querierPlugin   pluginType = "querier"
+	attributePlugin pluginType = "attribute"
 )
 
 // Initializer is a singleton that holds all registered plugins
@@ -29,6 +31,7 @@ type Initializer struct {
 func (i *Initializer) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.Any("queriers", i.getQueriers()),
+		slog.Any("attributes", types.AttributePluginNames()),
 	)
 }
 
@@ -64,7 +67,8 @@ func (i *Initializer) getQueriers() []string {
 // GetAvailable Plugins returns a list of all registered plugins by plugin type
 func GetAvailablePlugins() map[string][]string {
 	return map[string][]string{
-		string(querierPlugin): GetAvailableQuerierPlugins(),
+		string(querierPlugin):   GetAvailableQuerierPlugins(),
+		string(attributePlugin): types.AttributePluginNames(),
 	}
 }
 
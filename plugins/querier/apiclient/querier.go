@@ -181,6 +181,49 @@ func (a *APIClientQuerier) Query(ctx context.Context, hosts hosts.Hosts, args *q
 	return out
 }
 
+// DryRun validates the query and estimates its cost on all hosts concurrently and returns a channel from
+// which the outcomes can be read
+func (a *APIClientQuerier) DryRun(ctx context.Context, hostList hosts.Hosts, args *query.Args) <-chan *distributed.HostDryRun {
+	out := make(chan *distributed.HostDryRun, len(hostList))
+
+	numRunners := len(hostList)
+	if 0 < a.maxConcurrent && a.maxConcurrent < numRunners {
+		numRunners = a.maxConcurrent
+	}
+	sem := make(chan struct{}, max(numRunners, 1))
+
+	wg := new(sync.WaitGroup)
+	wg.Add(len(hostList))
+	for _, host := range hostList {
+		go func(host string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := &distributed.HostDryRun{Hostname: host}
+			cfg, exists := a.apiEndpoints[host]
+			if !exists {
+				res.Err = fmt.Errorf("couldn't find endpoint configuration for host")
+				out <- res
+				return
+			}
+
+			ctx := logging.WithFields(ctx, slog.String("host", host))
+			res.DryRun, res.Err = client.NewFromConfig(cfg).DryRun(ctx, args)
+			if res.Err == nil {
+				res.DryRun.Cost.Hosts = 1
+			}
+			out <- res
+		}(host)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
 // queryWorkload denotes an individual workload to perform a query on a remote host
 type queryWorkload struct {
 	Host string